@@ -0,0 +1,101 @@
+package asynclogger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger_IOAlignment(t *testing.T) {
+	for _, alignment := range []int{512, 8192} {
+		t.Run(fmt.Sprint(alignment), func(t *testing.T) {
+			config := DefaultConfig(filepath.Join(t.TempDir(), "aligned.log"))
+			config.BufferSize = 2 * 64 * 1024
+			config.NumShards = 2
+			config.IOAlignment = alignment
+			require.NoError(t, config.Validate())
+			assert.Contains(t, config.Explain(), fmt.Sprintf("aligned to %d", alignment))
+
+			logger, err := New(config)
+			require.NoError(t, err)
+			for _, shard := range logger.setA.Shards() {
+				assert.Zero(t, int(shard.Capacity())%alignment, "shard capacity %d", shard.Capacity())
+			}
+
+			var want []string
+			offset := int64(0)
+			for flush := 0; flush < 3; flush++ {
+				for i := 0; i < 50+flush*20; i++ {
+					msg := fmt.Sprintf("flush-%d-%03d", flush, i)
+					require.NoError(t, logger.TryLogBytes([]byte(msg)))
+					want = append(want, msg)
+				}
+				require.NoError(t, logger.Flush(t.Context()))
+				info, err := os.Stat(config.LogFilePath)
+				require.NoError(t, err)
+				assert.Zero(t, info.Size()%int64(alignment), "file offset %d after flush %d", info.Size(), flush)
+				assert.Greater(t, info.Size(), offset)
+				offset = info.Size()
+			}
+			require.NoError(t, logger.Close())
+
+			assert.ElementsMatch(t, want, readEntries(t, config.LogFilePath))
+		})
+	}
+}
+
+func TestLogger_IOAlignmentCompactFlush(t *testing.T) {
+	config := DefaultConfig(filepath.Join(t.TempDir(), "compact.log"))
+	config.BufferSize = 4 * 64 * 1024
+	config.NumShards = 4
+	config.CompactFlush = true
+	config.IOAlignment = 512
+
+	logger, err := New(config)
+	require.NoError(t, err)
+	require.NoError(t, logger.TryLogBytes([]byte("one")))
+	require.NoError(t, logger.Flush(t.Context()))
+	require.NoError(t, logger.Close())
+
+	// One small entry packs into a single 512-byte block instead of 4096
+	info, err := os.Stat(config.LogFilePath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(512), info.Size())
+	assert.Equal(t, []string{"one"}, readEntries(t, config.LogFilePath))
+}
+
+func TestConfig_IOAlignment(t *testing.T) {
+	for _, alignment := range []int{256, 1000, 128 * 1024} {
+		config := DefaultConfig("/tmp/aligned.log")
+		config.IOAlignment = alignment
+		err := config.Validate()
+		require.Error(t, err)
+		assert.Equal(t, fmt.Sprintf("IOAlignment must be a power of two between 512 and 65536, got %d", alignment), err.Error())
+	}
+
+	config := DefaultConfig("/tmp/aligned.log")
+	require.NoError(t, config.Validate())
+	assert.Equal(t, alignmentSize, config.IOAlignment)
+
+	config = DefaultConfig(filepath.Join(t.TempDir(), "aligned.log"))
+	config.PersistentBuffers = true
+	config.IOAlignment = 8192
+	assert.EqualError(t, config.Validate(), "PersistentBuffers supports IOAlignment up to 4096, got 8192")
+
+	// Auto resolves to a supported alignment (or the default, with a warning, where detection fails)
+	capture := &captureLogger{}
+	config = DefaultConfig(filepath.Join(t.TempDir(), "auto", "aligned.log"))
+	config.IOAlignment = IOAlignmentAuto
+	config.InternalLogger = capture
+	require.NoError(t, config.Validate())
+	assert.GreaterOrEqual(t, config.IOAlignment, 512)
+	assert.LessOrEqual(t, config.IOAlignment, 65536)
+	assert.Zero(t, config.IOAlignment&(config.IOAlignment-1))
+	entries, err := os.ReadDir(filepath.Dir(config.LogFilePath))
+	require.NoError(t, err)
+	assert.Empty(t, entries, "the probe file is removed")
+}
@@ -0,0 +1,232 @@
+package asynclogger
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Standard benchmark suite (run with `make bench`): LogBytes at fixed payload sizes, parallel LogBytes,
+// flushSet alone, and end-to-end throughput. The writers below keep the disk out of the numbers;
+// allocs/op is reported so the zero-allocation write path stays zero-allocation
+
+// benchPayloadSizes are the LogBytes payloads every write benchmark covers
+var benchPayloadSizes = []struct {
+	name string
+	size int
+}{
+	{"64B", 64},
+	{"1KB", 1024},
+	{"300KB", 300 * 1024},
+}
+
+// discardWriter is a FileWriter that drops every flush, so benchmarks measure the logger alone
+type discardWriter struct{}
+
+func (discardWriter) WriteVectored(buffers [][]byte) (int, error) {
+	n := 0
+	for _, buf := range buffers {
+		n += len(buf)
+	}
+	return n, nil
+}
+
+func (discardWriter) GetLastPwritevDuration() time.Duration { return 0 }
+
+func (discardWriter) Close() error { return nil }
+
+// memWriter is a FileWriter that copies every flush into memory, standing in for an infinitely fast disk
+// The copy is overwritten by the next flush, so memory stays bounded however long the benchmark runs
+type memWriter struct {
+	mu      sync.Mutex
+	data    []byte
+	written int64
+}
+
+func (w *memWriter) WriteVectored(buffers [][]byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.data = w.data[:0]
+	for _, buf := range buffers {
+		w.data = append(w.data, buf...)
+	}
+	w.written += int64(len(w.data))
+	return len(w.data), nil
+}
+
+func (w *memWriter) GetLastPwritevDuration() time.Duration { return 0 }
+
+func (w *memWriter) Close() error { return nil }
+
+// newBenchLogger creates a logger with 8MB shards (room for 300KB payloads) flushing to w
+func newBenchLogger(b *testing.B, w FileWriter) *Logger {
+	b.Helper()
+	config := DefaultConfig(filepath.Join(b.TempDir(), "bench.log"))
+	config.BufferSize = 64 * 1024 * 1024
+	config.NumShards = 8
+	logger, err := NewWithWriter(config, w)
+	require.NoError(b, err)
+	b.Cleanup(func() { logger.Close() })
+	return logger
+}
+
+// reportDrops reports the share of the benchmark's logs that were dropped
+func reportDrops(b *testing.B, logger *Logger) {
+	totalLogs, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
+	if totalLogs > 0 {
+		b.ReportMetric(float64(droppedLogs)/float64(totalLogs), "drops/op")
+	}
+}
+
+func BenchmarkLogBytes(b *testing.B) {
+	for _, payload := range benchPayloadSizes {
+		b.Run(payload.name, func(b *testing.B) {
+			logger := newBenchLogger(b, discardWriter{})
+			msg := make([]byte, payload.size)
+
+			b.ReportAllocs()
+			b.SetBytes(int64(payload.size))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				logger.LogBytes(msg)
+			}
+			b.StopTimer()
+			reportDrops(b, logger)
+		})
+	}
+}
+
+// newFullLogger creates a logger whose buffer sets are both full, with the flush of one stalled
+// until release is called: every LogBytes takes the retry path, waits at most retryTimeout for a
+// swap permit and drops
+func newFullLogger(tb testing.TB, retryTimeout time.Duration) (logger *Logger, release func()) {
+	tb.Helper()
+	config := DefaultConfig(filepath.Join(tb.TempDir(), "full.log"))
+	config.BufferSize = 64 * 1024
+	config.NumShards = 1
+	config.FlushInterval = time.Hour
+	config.WriteRetryTimeout = retryTimeout
+	w := newSlowFileWriter(discardWriter{})
+	logger, err := NewWithWriter(config, w)
+	require.NoError(tb, err)
+	release = sync.OnceFunc(func() { close(w.release) })
+	tb.Cleanup(func() {
+		release()
+		logger.Close()
+	})
+
+	msg := make([]byte, 1024)
+	for logger.TryLogBytes(msg) == nil {
+	}
+	<-w.started
+	return logger, release
+}
+
+// BenchmarkLogBytesFull measures LogBytes while the buffers are full: each call takes the retry
+// path, acquires a swap permit (contended in the parallel case) and drops. Like the fast path, it
+// must report 0 allocs/op
+func BenchmarkLogBytesFull(b *testing.B) {
+	b.Run("serial", func(b *testing.B) {
+		logger, _ := newFullLogger(b, 10*time.Millisecond)
+		msg := make([]byte, 64)
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			logger.LogBytes(msg)
+		}
+		b.StopTimer()
+		reportDrops(b, logger)
+	})
+
+	b.Run("goroutines=64", func(b *testing.B) {
+		logger, _ := newFullLogger(b, 10*time.Millisecond)
+
+		b.ReportAllocs()
+		b.SetParallelism((64 + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0))
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			msg := make([]byte, 64)
+			for pb.Next() {
+				logger.LogBytes(msg)
+			}
+		})
+		b.StopTimer()
+		reportDrops(b, logger)
+	})
+}
+
+func BenchmarkLogBytesParallel(b *testing.B) {
+	for _, goroutines := range []int{8, 64} {
+		for _, payload := range benchPayloadSizes {
+			b.Run(fmt.Sprintf("goroutines=%d/%s", goroutines, payload.name), func(b *testing.B) {
+				logger := newBenchLogger(b, discardWriter{})
+
+				b.ReportAllocs()
+				b.SetBytes(int64(payload.size))
+				// RunParallel starts parallelism * GOMAXPROCS goroutines
+				b.SetParallelism((goroutines + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0))
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					msg := make([]byte, payload.size)
+					for pb.Next() {
+						logger.LogBytes(msg)
+					}
+				})
+				b.StopTimer()
+				reportDrops(b, logger)
+			})
+		}
+	}
+}
+
+// BenchmarkFlushSet measures one flush of a set whose shards each hold 1MB of 1KB entries
+func BenchmarkFlushSet(b *testing.B) {
+	logger := newBenchLogger(b, discardWriter{})
+	set := logger.setB // Inactive: no writer or flush touches it while the logger is idle
+	msg := make([]byte, 1024)
+	entries := set.NumShards() * 1024
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		for j := 0; j < entries; j++ {
+			set.Write(msg)
+		}
+		b.StartTimer()
+		require.NoError(b, logger.flushSet(set))
+	}
+}
+
+// BenchmarkThroughput measures logging and flushing end to end, with 64 goroutines logging 1KB entries
+// into an in-memory writer; flushed-MB/s counts what reached the writer, including headers and padding
+func BenchmarkThroughput(b *testing.B) {
+	w := &memWriter{}
+	logger := newBenchLogger(b, w)
+
+	b.ReportAllocs()
+	b.SetBytes(1024)
+	b.SetParallelism((64 + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		msg := make([]byte, 1024)
+		for pb.Next() {
+			logger.LogBytes(msg)
+		}
+	})
+	require.NoError(b, logger.Flush(context.Background()))
+	b.StopTimer()
+
+	w.mu.Lock()
+	written := w.written
+	w.mu.Unlock()
+	b.ReportMetric(float64(written)/1e6/b.Elapsed().Seconds(), "flushed-MB/s")
+	reportDrops(b, logger)
+}
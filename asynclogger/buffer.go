@@ -4,14 +4,23 @@ import (
 	"encoding/binary"
 	"sync/atomic"
 	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/reader"
+	"github.com/neehar-mavuduru/logger-double-buffer/internal/logcore"
 )
 
 // headerOffset is the number of bytes reserved at the start of each buffer for the shard header
-const headerOffset = 8
+const headerOffset = logcore.HeaderSize
+
+// flushThresholdPct is the default percentage of usable capacity at which a buffer requests a
+// flush (Config.ShardFlushThresholdPct). Usable capacity is the buffer capacity minus the header
+// reservation; it is the single base for both the flush threshold and reported utilization, so a
+// flush triggered at 90% reports 90%
+const flushThresholdPct = 90
 
-// Buffer represents a single buffer for log entries with 512-byte alignment for Direct I/O
+// Buffer represents a single buffer for log entries aligned for Direct I/O (Config.IOAlignment)
 type Buffer struct {
-	// data is the pre-allocated byte slice (512-byte aligned)
+	// data is the pre-allocated byte slice (address and size aligned)
 	// First 8 bytes are reserved for shard header (capacity + validDataBytes)
 	data []byte
 
@@ -22,12 +31,30 @@ type Buffer struct {
 	// capacity is the maximum buffer size (includes the 8-byte header reservation)
 	capacity int32
 
+	// flushThreshold is the data size (excluding header) at which the buffer requests a flush
+	flushThreshold int32
+
 	// id is the buffer identifier for tracking and debugging
 	id uint32
 
-	// readyForFlush indicates the buffer is full and needs flushing
+	// readyForFlush indicates the buffer is full and needs flushing; a flush sets it first to seal
+	// the buffer, so writes that have not reserved space yet go elsewhere
 	readyForFlush atomic.Bool
 
+	// inflight counts writes between their readyForFlush check and their completion (or back-out)
+	// Registered before the check and never reset, so a flush waits for every write that may still
+	// touch the buffer, including one that reserves space just after the seal
+	inflight atomic.Int64
+
+	// committed is the committed mark: every reservation below it has been written (see finishWrite)
+	committed logcore.CommittedMark
+
+	// partial is the end of the entries sealed by a flush that timed out (0 when none) and carried
+	// the start of the entries such a flush left behind (0 when none); see seal and Reset
+	// Used only by seal and Reset, which the shard mutex serializes
+	partial int32
+	carried int32
+
 	// writeCount tracks the number of writes to this buffer for statistics
 	writeCount atomic.Int64
 
@@ -36,72 +63,229 @@ type Buffer struct {
 
 	// writesCompleted tracks the number of writes that have completed copying data
 	writesCompleted atomic.Int64
+
+	// payloadBytes tracks the log data bytes written since the last reset (excluding length
+	// prefixes, timestamps and padding)
+	payloadBytes atomic.Int64
+
+	// timestamp is written between the length prefix and the data of every entry (Config.PrependTimestamp)
+	timestamp     TimestampFormat
+	timestampSize int32
+
+	// sequenceSize is the sequence number written before the timestamp (Config.SequenceNumbers), 0 or 8
+	sequenceSize int32
+
+	// metaSize is sequenceSize plus timestampSize: the bytes between an entry's length prefix and its data
+	metaSize int32
+
+	// plain writes entries as lines of text, without length prefixes (Config.OutputFormat)
+	plain bool
+
+	// region is the buffer file region holding data (Config.PersistentBuffers); nil otherwise
+	region *bufferRegion
+
+	// alignment is the address alignment of data, 0 when it is not aligned (see alloc)
+	alignment int
 }
 
 // NewBuffer creates a new buffer with the given capacity and ID
-// The buffer is automatically aligned to 512-byte boundaries for Direct I/O
+// The buffer is automatically aligned to 4096-byte boundaries for Direct I/O
 // First 8 bytes are reserved for shard header (capacity + validDataBytes)
 func NewBuffer(capacity int, id uint32) *Buffer {
-	// Reserve 8 bytes for header, then round total capacity to 512-byte alignment
+	return newBuffer(capacity, id, true, alignmentSize)
+}
+
+// newBuffer creates a buffer whose capacity is a multiple of alignment; aligned selects
+// O_DIRECT-aligned memory (not needed for IOModeBuffered)
+func newBuffer(capacity int, id uint32, aligned bool, alignment int) *Buffer {
+	// Reserve 8 bytes for header, then round total capacity to the alignment
 	// This ensures the buffer is aligned and header space is reserved
 	totalCapacity := capacity + 8 // Add header space
-	alignedCap := alignSize(totalCapacity)
+	alignedCap := alignSize(totalCapacity, alignment)
+
+	if !aligned {
+		return bufferOn(make([]byte, alignedCap), id)
+	}
+	buf := bufferOn(allocAlignedBuffer(alignedCap, alignment), id)
+	buf.alignment = alignment
+	return buf
+}
+
+// newRegionBuffer creates a buffer on a region of the buffer file (Config.PersistentBuffers)
+func newRegionBuffer(region *bufferRegion, id uint32) *Buffer {
+	buf := bufferOn(region.data, id)
+	buf.region = region
+	buf.alignment = alignmentSize
+	return buf
+}
 
+// bufferOn creates a buffer using data (its length is the capacity) as storage
+func bufferOn(data []byte, id uint32) *Buffer {
 	buf := &Buffer{
-		data:     allocAlignedBuffer(alignedCap),
-		offset:   atomic.Int32{},
-		capacity: int32(alignedCap),
-		id:       id,
+		data:           data,
+		offset:         atomic.Int32{},
+		capacity:       int32(len(data)),
+		flushThreshold: flushThresholdBytes(int32(len(data)), flushThresholdPct),
+		id:             id,
 	}
 
 	// Initialize offset to skip the 8-byte header reservation
 	buf.offset.Store(8)
+	buf.committed.Reset(headerOffset)
 
 	return buf
 }
 
+// setFlushThresholdPct makes the buffer request a flush at pct% of its usable capacity
+// (Config.ShardFlushThresholdPct); call it before the buffer is used
+func (b *Buffer) setFlushThresholdPct(pct int) {
+	b.flushThreshold = flushThresholdBytes(b.capacity, pct)
+}
+
+// setTimestamp makes every entry start with a timestamp; call it before the buffer is used
+func (b *Buffer) setTimestamp(format TimestampFormat) {
+	b.timestamp = format
+	b.timestampSize = int32(format.Size())
+	b.metaSize = b.sequenceSize + b.timestampSize
+}
+
+// setSequenceNumbers makes every entry start with its sequence number; call it before the buffer is used
+func (b *Buffer) setSequenceNumbers(enabled bool) {
+	b.sequenceSize = 0
+	if enabled {
+		b.sequenceSize = reader.SequenceSize
+	}
+	b.metaSize = b.sequenceSize + b.timestampSize
+}
+
+// setOutputFormat selects how entries are written; call it before the buffer is used
+func (b *Buffer) setOutputFormat(format OutputFormat) {
+	b.plain = format == OutputPlain
+}
+
+// prefixSize returns the size of an entry's length prefix: 4, or 0 for plain output
+func (b *Buffer) prefixSize() int32 {
+	if b.plain {
+		return 0
+	}
+	return 4
+}
+
+// putMeta writes the sequence number and the timestamp for now at dst (metaSize bytes)
+func (b *Buffer) putMeta(dst []byte, seq uint64, now time.Time) {
+	if b.sequenceSize > 0 {
+		binary.LittleEndian.PutUint64(dst, seq)
+	}
+	if b.timestampSize > 0 {
+		b.putTimestamp(dst[b.sequenceSize:], now)
+	}
+}
+
+// putTimestamp writes the timestamp for now at dst
+func (b *Buffer) putTimestamp(dst []byte, now time.Time) {
+	switch b.timestamp {
+	case TimestampUnixNano:
+		binary.LittleEndian.PutUint64(dst, uint64(now.UnixNano()))
+	case TimestampRFC3339:
+		ts := now.UTC().AppendFormat(dst[:0:len(dst)], reader.TimestampLayout)
+		dst[len(ts)] = ' '
+	}
+}
+
+// sequence is the process-wide counter behind Config.SequenceNumbers, shared by all loggers so
+// entries of different event files can be merged too. The first number is 1
+var sequence atomic.Uint64
+
+// nextSequence takes the next sequence number if enabled, and returns 0 otherwise
+func nextSequence(enabled bool) uint64 {
+	if !enabled {
+		return 0
+	}
+	return sequence.Add(1)
+}
+
+// clock returns the write time when entries carry a timestamp
+// Callers read it between loading the offset and the CAS that reserves their space: an entry
+// further into the buffer can only be reserved after that CAS, so timestamps never decrease in
+// buffer order (unless the wall clock steps back)
+func (b *Buffer) clock() time.Time {
+	if b.timestampSize == 0 {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
 // Write appends data to the buffer using atomic CAS for thread safety
-// Prepends a 4-byte length prefix (little-endian) before the log data
+// Prepends a 4-byte length prefix (little-endian) and the sequence number and timestamp, if any,
+// before the log data. Plain output (Config.OutputFormat) has no length prefix and ends the data
+// with a newline instead, unless it already ends with one
 // Returns the number of bytes written (including length prefix) and whether the buffer needs flushing
 func (b *Buffer) Write(p []byte) (n int, needsFlush bool) {
+	return b.write(p, nextSequence(b.sequenceSize > 0))
+}
+
+// write is Write with the entry's sequence number (ignored without Config.SequenceNumbers)
+func (b *Buffer) write(p []byte, seq uint64) (n int, needsFlush bool) {
 	if len(p) == 0 {
 		return 0, false
 	}
 
-	// Check if buffer is already full
+	// Register before the check, so a flush sealing the buffer waits for this write
+	b.inflight.Add(1)
+	defer b.finishWrite()
+
+	// Check if buffer is already full (or sealed by a flush)
 	if b.readyForFlush.Load() {
 		return 0, true
 	}
 
-	// Reserve space for: 4-byte length prefix + log data
-	const lengthPrefixSize = 4
-	totalSize := lengthPrefixSize + len(p)
+	// Reserve space for: 4-byte length prefix + log data (plain output: log data + newline)
+	lengthPrefixSize := b.prefixSize()
+	newline := 0
+	if b.plain && p[len(p)-1] != '\n' {
+		newline = 1
+	}
+	totalSize := int(lengthPrefixSize+b.metaSize) + len(p) + newline
 
 	// Try to reserve space in the buffer (starting after the 8-byte header)
-	currentOffset := b.offset.Load()
-	newOffset := currentOffset + int32(totalSize)
-
-	// Check if we have enough space (capacity includes the 8-byte header)
-	// Use >= to handle the edge case where newOffset exactly equals capacity
-	if newOffset >= b.capacity {
-		b.readyForFlush.Store(true)
-		return 0, true
-	}
+	var currentOffset, newOffset int32
+	var now time.Time
+	for {
+		currentOffset = b.offset.Load()
+		newOffset = currentOffset + int32(totalSize)
+		now = b.clock()
+
+		// Check if we have enough space (capacity includes the 8-byte header)
+		// Use >= to handle the edge case where newOffset exactly equals capacity
+		if newOffset >= b.capacity {
+			b.readyForFlush.Store(true)
+			return 0, true
+		}
 
-	// Try to atomically update the offset (CAS)
-	if !b.offset.CompareAndSwap(currentOffset, newOffset) {
-		// Another goroutine updated the offset, retry
-		return b.Write(p)
+		// Try to atomically update the offset (CAS); another goroutine may have moved it, retry
+		if b.offset.CompareAndSwap(currentOffset, newOffset) {
+			break
+		}
 	}
 
 	// Write started: space reserved (atomic operations provide memory barriers)
 	b.writesStarted.Add(1)
 
-	// Write 4-byte length prefix (little-endian uint32)
-	binary.LittleEndian.PutUint32(b.data[currentOffset:currentOffset+lengthPrefixSize], uint32(len(p)))
+	// Write 4-byte length prefix (little-endian uint32) covering sequence number, timestamp and data
+	if !b.plain {
+		binary.LittleEndian.PutUint32(b.data[currentOffset:currentOffset+lengthPrefixSize], uint32(totalSize-int(lengthPrefixSize)))
+	}
 
-	// Copy log data after the length prefix
-	copy(b.data[currentOffset+lengthPrefixSize:newOffset], p)
+	// Copy log data after the length prefix, sequence number and timestamp
+	dataStart := currentOffset + lengthPrefixSize + b.metaSize
+	if b.metaSize > 0 {
+		b.putMeta(b.data[currentOffset+lengthPrefixSize:dataStart], seq, now)
+	}
+	copy(b.data[dataStart:newOffset], p)
+	if newline > 0 {
+		b.data[newOffset-1] = '\n'
+	}
+	b.payloadBytes.Add(int64(len(p)))
 
 	// Write completed: copy finished (atomic operations provide memory barriers)
 	b.writesCompleted.Add(1)
@@ -109,8 +293,8 @@ func (b *Buffer) Write(p []byte) (n int, needsFlush bool) {
 	// Increment write count for statistics
 	b.writeCount.Add(1)
 
-	// Check if buffer is now full or nearly full (within 10%)
-	if newOffset >= b.capacity*9/10 {
+	// Check if buffer data has reached the flush threshold of usable capacity
+	if newOffset-headerOffset >= b.flushThreshold {
 		b.readyForFlush.Store(true)
 		return totalSize, true
 	}
@@ -118,40 +302,253 @@ func (b *Buffer) Write(p []byte) (n int, needsFlush bool) {
 	return totalSize, false
 }
 
-// GetData returns the entire buffer capacity (including invalid space at the end)
-// This should only be called when the buffer is being flushed
-// Waits for writesStarted == writesCompleted (all writes completed) or timeout expires
-// Returns the full capacity slice and whether all writes completed (false if timeout occurred)
-func (b *Buffer) GetData(timeout time.Duration) ([]byte, bool) {
-	deadline := time.Now().Add(timeout)
-	const checkInterval = 50 * time.Microsecond
-
-	for time.Now().Before(deadline) {
-		started := b.writesStarted.Load()
-		completed := b.writesCompleted.Load()
-
-		if started == completed {
-			// All writes that started have completed
-			// Return full capacity to handle invalid space at the end
-			// Shard Header contains the capacity(4 bytes) and the valid data bytes(4 bytes)
-			return b.data[:b.capacity], true
+// paddingFlag marks a length prefix as padding: the reader skips the length bytes that follow
+// LogEntry leaves padding where an entry used less than its reservation (see reader.PaddingFlag)
+const paddingFlag = 1 << 31
+
+// entryPrefixSize is the reservation overhead of LogEntry: the entry's length prefix plus a
+// padding prefix, so the unused tail of a reservation can always be marked as padding
+const entryPrefixSize = 8
+
+// reserve claims size bytes (including the length prefix) plus the sequence number and timestamp for
+// an entry written in place. The region is marked as padding until commitEntry, so a flush that times
+// out skips it; the sequence number is written by commitEntry
+// Returns the start offset, or -1 and whether the buffer needs flushing if there is no space
+func (b *Buffer) reserve(size int32) (start int32, needsFlush bool) {
+	// Registered like Write; a successful reservation stays in flight until commitEntry
+	b.inflight.Add(1)
+	if b.readyForFlush.Load() {
+		b.finishWrite()
+		return -1, true
+	}
+
+	size += b.metaSize
+	for {
+		currentOffset := b.offset.Load()
+		newOffset := currentOffset + size
+		if newOffset >= b.capacity {
+			b.readyForFlush.Store(true)
+			b.finishWrite()
+			return -1, true
 		}
+		now := b.clock()
+		if b.offset.CompareAndSwap(currentOffset, newOffset) {
+			b.writesStarted.Add(1)
+			if !b.plain {
+				binary.LittleEndian.PutUint32(b.data[currentOffset:], paddingFlag|uint32(size-4))
+			}
+			if b.timestampSize > 0 {
+				tsStart := currentOffset + b.prefixSize() + b.sequenceSize
+				b.putTimestamp(b.data[tsStart:tsStart+b.timestampSize], now)
+			}
+			return currentOffset, false
+		}
+	}
+}
+
+// entry returns an empty slice whose capacity is the entry space of the reservation at start
+func (b *Buffer) entry(start, size int32) []byte {
+	dataStart := start + b.prefixSize() + b.metaSize
+	return b.data[dataStart : dataStart : start+b.metaSize+size-4]
+}
+
+// commitEntry completes the reservation at start with an entry of length bytes (after the sequence
+// number and timestamp) and sequence number seq. length 0 discards the reservation. The unused tail is handed back when no later reservation
+// follows, and marked as padding otherwise. Returns whether the buffer needs flushing
+func (b *Buffer) commitEntry(start, size int32, length int, seq uint64) (needsFlush bool) {
+	if b.plain {
+		b.commitLine(start, size, length)
+	} else {
+		end := start + b.metaSize + size
+		used := start
+		if length > 0 {
+			used += 4 + b.metaSize + int32(length)
+		}
+
+		if !b.offset.CompareAndSwap(end, used) && length > 0 {
+			binary.LittleEndian.PutUint32(b.data[used:], paddingFlag|uint32(end-used-4))
+		}
+		if length > 0 {
+			if b.sequenceSize > 0 {
+				binary.LittleEndian.PutUint64(b.data[start+4:], seq)
+			}
+			// Publish the entry last, replacing the padding prefix written by reserve
+			binary.LittleEndian.PutUint32(b.data[start:], uint32(b.metaSize)+uint32(length))
+		}
+	}
+	if length > 0 {
+		b.writeCount.Add(1)
+		b.payloadBytes.Add(int64(length))
+	}
+	b.writesCompleted.Add(1)
+
+	needsFlush = b.offset.Load()-headerOffset >= b.flushThreshold
+	if needsFlush {
+		b.readyForFlush.Store(true)
+	}
+	b.finishWrite()
+	return needsFlush
+}
 
-		// Writes still in progress, wait a bit before retrying
-		time.Sleep(checkInterval)
+// commitLine is commitEntry for plain output: the entry ends in a newline, added if missing. Text has
+// no padding to skip, so when a later reservation follows, the unused tail is filled with spaces
+// before the newline (a discarded reservation becomes a line of spaces)
+func (b *Buffer) commitLine(start, size int32, length int) {
+	end := start + b.metaSize + size
+	text := start + b.metaSize + int32(length)
+	used := start
+	if length > 0 {
+		if b.data[text-1] == '\n' {
+			text--
+		}
+		used = text + 1
 	}
 
-	// Timeout expired: flush anyway (may contain incomplete last write)
-	// Return full capacity to handle invalid space at the end
-	return b.data[:b.capacity], false
+	if b.offset.CompareAndSwap(end, used) {
+		if length > 0 {
+			b.data[text] = '\n'
+		}
+		return
+	}
+	if length == 0 {
+		text = start
+	}
+	for i := text; i < end-1; i++ {
+		b.data[i] = ' '
+	}
+	b.data[end-1] = '\n'
+}
+
+// finishWrite ends a write registered in inflight, raising the committed mark when it is the last
+func (b *Buffer) finishWrite() {
+	b.committed.Finish(&b.offset, &b.inflight)
+}
+
+// sealedData is the part of a buffer a flush writes (see seal)
+type sealedData struct {
+	// data is the full capacity slice, with the entries in data[headerOffset:end]; nil when the
+	// buffer holds nothing to write
+	data []byte
+	end  int32
+
+	// entries and payload count the entries in data and their log data bytes
+	entries, payload int64
+
+	// complete reports whether all writes completed (false if timeout occurred)
+	complete bool
+}
+
+// waitForWrites seals the buffer (later writes see it full), then waits for the writes in flight
+// to complete or back out, or for timeout to expire. Returns whether they all did
+func (b *Buffer) waitForWrites(timeout time.Duration) bool {
+	b.readyForFlush.Store(true)
+	return logcore.WaitForWrites(&b.inflight, timeout, time.Now)
+}
+
+// seal seals the buffer for a flush and returns the entries to write
+// This should only be called when the buffer is being flushed. When the writes in flight finish
+// within timeout, the data is the buffer itself, with the offset stable until Reset. Otherwise only
+// the entries below the committed mark are sealed, and the data is a copy of them: the late writers
+// still own the space after the mark (a LogEntry callback appends straight into it), so the flush
+// must not read it. Reset then keeps their entries, and a later flush writes them once they are done
+func (b *Buffer) seal(timeout time.Duration) sealedData {
+	complete := b.waitForWrites(timeout)
+	end := b.offset.Load()
+	if b.carried != 0 {
+		// Entries left by a partial flush: move them behind the header once their writes are done
+		if !complete {
+			return sealedData{end: headerOffset}
+		}
+		moved := headerOffset + int32(copy(b.data[headerOffset:], b.data[b.carried:end]))
+		clear(b.data[moved:end])
+		end = moved
+		b.offset.Store(end)
+		b.committed.Reset(end)
+		b.carried = 0
+	}
+
+	if complete {
+		sealed := sealedData{end: end, complete: true}
+		if end > headerOffset {
+			sealed.data = b.data[:b.capacity]
+			sealed.entries, sealed.payload = b.writesStarted.Load(), b.payloadBytes.Load()
+		}
+		return sealed
+	}
+
+	end = b.committed.Offset()
+	b.partial = end
+	sealed := sealedData{end: end}
+	if end > headerOffset {
+		sealed.data = b.alloc()
+		copy(sealed.data, b.data[:end])
+		sealed.entries, sealed.payload = b.countEntries(headerOffset, end)
+	}
+	return sealed
+}
+
+// alloc allocates a slice like data, with the same capacity and alignment
+func (b *Buffer) alloc() []byte {
+	if b.alignment == 0 {
+		return make([]byte, b.capacity)
+	}
+	return allocAlignedBuffer(int(b.capacity), b.alignment)[:b.capacity]
+}
+
+// countEntries returns the entries and log data bytes in data[from:to], which must hold whole
+// entries. Padding is skipped; plain output counts lines, excluding their newlines
+func (b *Buffer) countEntries(from, to int32) (entries, payload int64) {
+	if b.plain {
+		for _, c := range b.data[from:to] {
+			if c == '\n' {
+				entries++
+			}
+		}
+		return entries, int64(to-from) - entries
+	}
+	for pos := from; pos < to; {
+		prefix := binary.LittleEndian.Uint32(b.data[pos:])
+		size := int32(prefix &^ paddingFlag)
+		if prefix&paddingFlag == 0 {
+			entries++
+			payload += int64(size - b.metaSize)
+		}
+		pos += 4 + size
+	}
+	return entries, payload
+}
+
+// GetData seals the buffer for a flush (see seal)
+// Returns the full capacity slice (including invalid space at the end; nil if there is nothing to
+// write) and whether all writes completed (false if timeout occurred)
+func (b *Buffer) GetData(timeout time.Duration) ([]byte, bool) {
+	sealed := b.seal(timeout)
+	return sealed.data, sealed.complete
 }
 
 // Reset clears the buffer for reuse
+// After a seal that timed out, the late writes still own their space, so the buffer stays sealed:
+// the flushed entries are dropped from its counters and the rest are carried to the next flush.
+// Reusing it earlier would let the late writes overwrite newer entries
 func (b *Buffer) Reset() {
+	if end := b.partial; end != 0 {
+		entries, payload := b.countEntries(headerOffset, end)
+		b.writesStarted.Add(-entries)
+		b.writesCompleted.Add(-entries)
+		b.payloadBytes.Add(-payload)
+		b.partial, b.carried = 0, end
+		return
+	}
+	if b.carried != 0 {
+		// A seal found the carried writes still in flight: nothing was flushed
+		return
+	}
 	b.offset.Store(8) // Reset to header offset (skip 8-byte header reservation)
-	b.readyForFlush.Store(false)
+	b.committed.Reset(headerOffset)
 	b.writesStarted.Store(0)
 	b.writesCompleted.Store(0)
+	b.payloadBytes.Store(0)
+	b.readyForFlush.Store(false)
 }
 
 // Offset returns the current write offset
@@ -163,7 +560,7 @@ func (b *Buffer) Offset() int32 {
 // DataSize returns the size of actual data written (excluding header reservation)
 // Returns 0 if offset is less than headerOffset (defensive check)
 func (b *Buffer) DataSize() int32 {
-	offset := b.offset.Load()
+	offset := b.Offset()
 	if offset <= headerOffset {
 		return 0
 	}
@@ -175,6 +572,35 @@ func (b *Buffer) Capacity() int32 {
 	return b.capacity
 }
 
+// UsableCapacity returns the capacity available for log data (excluding header reservation)
+func (b *Buffer) UsableCapacity() int32 {
+	return b.capacity - headerOffset
+}
+
+// UtilizationPct returns data size as a percentage of usable capacity
+func (b *Buffer) UtilizationPct() float64 {
+	return utilizationPct(b.DataSize(), b.capacity)
+}
+
+// flushThresholdBytes returns the data size at which a buffer of the given capacity requests a
+// flush when pct% full. Computed in int64 to avoid overflow for large shards
+func flushThresholdBytes(capacity int32, pct int) int32 {
+	usable := int64(capacity) - headerOffset
+	if usable <= 0 {
+		return 0
+	}
+	return int32(usable * int64(pct) / 100)
+}
+
+// utilizationPct returns dataSize as a percentage of the usable capacity (capacity minus header reservation)
+func utilizationPct(dataSize, capacity int32) float64 {
+	usable := capacity - headerOffset
+	if usable <= 0 {
+		return 0.0
+	}
+	return float64(dataSize) / float64(usable) * 100.0
+}
+
 // ID returns the buffer identifier
 func (b *Buffer) ID() uint32 {
 	return b.id
@@ -187,7 +613,7 @@ func (b *Buffer) IsFull() bool {
 
 // HasData returns true if the buffer contains any data
 func (b *Buffer) HasData() bool {
-	return b.offset.Load() > 8 // Data starts after the 8-byte header reservation
+	return b.Offset() > 8 // Data starts after the 8-byte header reservation
 }
 
 // WriteCount returns the total number of writes to this buffer
@@ -10,16 +10,64 @@ type BufferSet struct {
 	numShards int
 	id        uint32
 	counter   atomic.Uint64 // For round-robin shard selection
+
+	// pendingFlush is set when the set is swapped out and cleared once it has been flushed and reset
+	pendingFlush atomic.Bool
+
+	// trigger is what swapped the set out (written before it is queued, read by the flush)
+	trigger FlushTrigger
+
+	spilled *atomic.Int64 // Counts writes placed in a following shard (set by Logger; may be nil)
 }
 
+// spillProbes bounds how many following shards Write tries when the chosen shard has no space
+const spillProbes = 3
+
 // NewBufferSet creates a new set of shards
 // totalCapacity is divided evenly among numShards
 func NewBufferSet(totalCapacity, numShards int, setID uint32) *BufferSet {
+	return newBufferSet(totalCapacity, numShards, setID, true, alignmentSize)
+}
+
+// newBufferSet creates a set of shards; aligned and alignment are passed to newBuffer
+func newBufferSet(totalCapacity, numShards int, setID uint32, aligned bool, alignment int) *BufferSet {
+	shardCapacity, numShards := shardLayout(totalCapacity, numShards)
+
+	shards := make([]*Shard, numShards)
+	for i := 0; i < numShards; i++ {
+		shards[i] = newShard(shardCapacity, uint32(i), aligned, alignment)
+	}
+
+	return &BufferSet{
+		shards:    shards,
+		numShards: numShards,
+		id:        setID,
+	}
+}
+
+// newRegionBufferSet creates a set whose shard buffers are regions of the buffer file
+// (Config.PersistentBuffers), one shard per region
+func newRegionBufferSet(regions []*bufferRegion, setID uint32) *BufferSet {
+	shards := make([]*Shard, len(regions))
+	for i, region := range regions {
+		shards[i] = &Shard{buffer: newRegionBuffer(region, uint32(i))}
+	}
+
+	return &BufferSet{
+		shards:    shards,
+		numShards: len(shards),
+		id:        setID,
+	}
+}
+
+// shardLayout returns the capacity of each shard and the number of shards a set of
+// totalCapacity bytes is split into
+func shardLayout(totalCapacity, numShards int) (shardCapacity, shards int) {
 	if numShards <= 0 {
 		numShards = 8 // Default
 	}
 
-	shardCapacity := totalCapacity / numShards
+	shardCapacity = totalCapacity / numShards
 	if shardCapacity < 64*1024 {
 		// Ensure minimum 64KB per shard
 		shardCapacity = 64 * 1024
@@ -28,33 +76,87 @@ func NewBufferSet(totalCapacity, numShards int, setID uint32) *BufferSet {
 			numShards = 1
 		}
 	}
+	return shardCapacity, numShards
+}
 
-	shards := make([]*Shard, numShards)
-	for i := 0; i < numShards; i++ {
-		shards[i] = NewShard(shardCapacity, uint32(i))
+// setFlushThresholdPct sets the flush threshold of every shard (see Buffer.setFlushThresholdPct)
+func (bs *BufferSet) setFlushThresholdPct(pct int) {
+	for _, shard := range bs.shards {
+		shard.buffer.setFlushThresholdPct(pct)
 	}
+}
 
-	return &BufferSet{
-		shards:    shards,
-		numShards: numShards,
-		id:        setID,
+// setTimestamp makes every shard prepend format to its entries (see Buffer.setTimestamp)
+func (bs *BufferSet) setTimestamp(format TimestampFormat) {
+	for _, shard := range bs.shards {
+		shard.buffer.setTimestamp(format)
+	}
+}
+
+// setSequenceNumbers makes every shard prepend sequence numbers to its entries (see Buffer.setSequenceNumbers)
+func (bs *BufferSet) setSequenceNumbers(enabled bool) {
+	for _, shard := range bs.shards {
+		shard.buffer.setSequenceNumbers(enabled)
+	}
+}
+
+// setOutputFormat makes every shard write entries in format (see Buffer.setOutputFormat)
+func (bs *BufferSet) setOutputFormat(format OutputFormat) {
+	for _, shard := range bs.shards {
+		shard.buffer.setOutputFormat(format)
 	}
 }
 
 // Write writes data to a shard using round-robin selection
-// Returns bytes written, whether flush is needed, and which shard was written to
+// If the shard has no space left for p, up to spillProbes following shards are tried in order
+// Returns bytes written, whether flush is needed, and which shard was written to (the chosen one on failure)
 func (bs *BufferSet) Write(p []byte) (n int, needsFlush bool, shardID int) {
 	if len(p) == 0 {
 		return 0, false, -1
 	}
+	return bs.write(p, nextSequence(bs.shards[0].buffer.sequenceSize > 0))
+}
+
+// write is Write with the entry's sequence number, which every shard tried writes (see Buffer.write)
+func (bs *BufferSet) write(p []byte, seq uint64) (n int, needsFlush bool, shardID int) {
+	if len(p) == 0 {
+		return 0, false, -1
+	}
 
 	// Round-robin shard selection
 	counterVal := bs.counter.Add(1)
 	shardIdx := int(counterVal % uint64(bs.numShards))
 	shard := bs.shards[shardIdx]
 
-	n, needsFlush = shard.Write(p)
-	return n, needsFlush, shardIdx
+	n, needsFlush = shard.write(p, seq)
+	if n > 0 || bs.numShards == 1 {
+		return n, needsFlush, shardIdx
+	}
+
+	// No space left for p: spill to one of the next shards instead of failing the write
+	// The counter is not advanced, so round-robin order is unchanged for the writes that follow;
+	// needsFlush stays set, the refusing shard still triggers the swap
+	for i := 1; i <= spillProbes && i < bs.numShards; i++ {
+		idx := (shardIdx + i) % bs.numShards
+		if n, _ = bs.shards[idx].write(p, seq); n > 0 {
+			shard.spills.Add(1)
+			if bs.spilled != nil {
+				bs.spilled.Add(1)
+			}
+			return n, needsFlush, idx
+		}
+	}
+	return 0, needsFlush, shardIdx
+}
+
+// reserve claims size bytes in a shard chosen round-robin, like Write
+// Returns the shard and start offset (start < 0 if the shard had no space) and whether a flush is needed
+func (bs *BufferSet) reserve(size int32) (shard *Shard, start int32, needsFlush bool) {
+	counterVal := bs.counter.Add(1)
+	shard = bs.shards[int(counterVal%uint64(bs.numShards))]
+
+	start, needsFlush = shard.reserve(size)
+	return shard, start, needsFlush
 }
 
 // GetShard returns a specific shard by index
@@ -105,6 +207,11 @@ func (bs *BufferSet) AnyShardFull() bool {
 	return false
 }
 
+// PendingFlush returns true if the set has been swapped out and not yet flushed
+func (bs *BufferSet) PendingFlush() bool {
+	return bs.pendingFlush.Load()
+}
+
 // Reset resets all shards in the set
 func (bs *BufferSet) Reset() {
 	for _, shard := range bs.shards {
@@ -0,0 +1,133 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// received returns the tick waiting on c, if any
+func received(c <-chan time.Time) (time.Time, bool) {
+	select {
+	case t := <-c:
+		return t, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func TestFake_Timer(t *testing.T) {
+	fake := NewFake(start)
+	timer := fake.NewTimer(time.Second)
+	assert.Equal(t, 1, fake.Waiters())
+
+	fake.Advance(999 * time.Millisecond)
+	_, ok := received(timer.C())
+	assert.False(t, ok)
+
+	fake.Advance(time.Millisecond)
+	tick, ok := received(timer.C())
+	require.True(t, ok)
+	assert.Equal(t, start.Add(time.Second), tick)
+	assert.Zero(t, fake.Waiters())
+	assert.False(t, timer.Stop(), "already fired")
+
+	// A reset discards the tick nobody received
+	assert.False(t, timer.Reset(time.Second))
+	fake.Advance(time.Second)
+	assert.False(t, timer.Reset(time.Minute))
+	_, ok = received(timer.C())
+	assert.False(t, ok)
+	assert.True(t, timer.Stop())
+	fake.Advance(time.Hour)
+	_, ok = received(timer.C())
+	assert.False(t, ok)
+
+	after := fake.After(0)
+	fake.Advance(0)
+	_, ok = received(after)
+	assert.True(t, ok)
+}
+
+func TestFake_Ticker(t *testing.T) {
+	fake := NewFake(start)
+	ticker := fake.NewTicker(10 * time.Second)
+
+	for i := 1; i <= 3; i++ {
+		fake.Advance(10 * time.Second)
+		tick, ok := received(ticker.C())
+		require.True(t, ok)
+		assert.Equal(t, start.Add(time.Duration(i)*10*time.Second), tick)
+	}
+
+	// Unreceived ticks are skipped, not queued, and a long advance does not step every period
+	fake.Advance(365 * 24 * time.Hour)
+	tick, ok := received(ticker.C())
+	require.True(t, ok)
+	assert.Equal(t, start.Add(40*time.Second), tick)
+	_, ok = received(ticker.C())
+	assert.False(t, ok)
+	assert.Equal(t, start.Add(30*time.Second+365*24*time.Hour), fake.Now())
+
+	fake.Advance(10 * time.Second)
+	tick, ok = received(ticker.C())
+	require.True(t, ok)
+	assert.Equal(t, start.Add(40*time.Second+365*24*time.Hour), tick)
+
+	ticker.Reset(time.Minute)
+	fake.Advance(59 * time.Second)
+	_, ok = received(ticker.C())
+	assert.False(t, ok)
+	fake.Advance(time.Second)
+	_, ok = received(ticker.C())
+	assert.True(t, ok)
+
+	ticker.Stop()
+	assert.Zero(t, fake.Waiters())
+}
+
+func TestFake_FiresInDeadlineOrder(t *testing.T) {
+	fake := NewFake(start)
+	late := fake.NewTimer(2 * time.Second)
+	early := fake.NewTimer(time.Second)
+	fake.Advance(time.Hour)
+
+	lateTick, _ := received(late.C())
+	earlyTick, _ := received(early.C())
+	assert.Equal(t, start.Add(time.Second), earlyTick)
+	assert.Equal(t, start.Add(2*time.Second), lateTick)
+	assert.Equal(t, start.Add(time.Hour), fake.Now())
+}
+
+func TestFake_BlockUntil(t *testing.T) {
+	fake := NewFake(start)
+	done := make(chan time.Time)
+	go func() {
+		done <- <-fake.After(time.Minute)
+	}()
+
+	fake.BlockUntil(1)
+	fake.Advance(time.Minute)
+	assert.Equal(t, start.Add(time.Minute), <-done)
+}
+
+func TestReal(t *testing.T) {
+	clk := OrReal(nil)
+	assert.Equal(t, Real{}, clk)
+	before := time.Now()
+	assert.False(t, clk.Now().Before(before))
+
+	timer := clk.NewTimer(time.Millisecond)
+	<-timer.C()
+	ticker := clk.NewTicker(time.Millisecond)
+	<-ticker.C()
+	ticker.Stop()
+	<-clk.After(time.Millisecond)
+
+	fake := NewFake(start)
+	assert.Same(t, fake, OrReal(fake))
+}
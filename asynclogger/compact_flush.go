@@ -0,0 +1,36 @@
+package asynclogger
+
+import "encoding/binary"
+
+// compactShards packs the shard buffers of one flush into staging (Config.CompactFlush)
+// Each buffer starts with its shard header; the copy keeps header and valid data only, rewrites
+// capacity to match (8 + validDataBytes) and gives the alignment padding of the whole write to the
+// last shard, so the reader walks the packed shards like unpadded ones. Returns false, writing
+// nothing, when the packed write does not fit staging or would save less than one alignment unit
+// (Config.IOAlignment)
+func compactShards(staging []byte, buffers [][]byte, alignment int) ([]byte, bool) {
+	packed, written := 0, 0
+	for _, buf := range buffers {
+		packed += headerOffset + int(binary.LittleEndian.Uint32(buf[4:8]))
+		written += len(buf)
+	}
+	size := alignSize(packed, alignment)
+	if size > len(staging) || written-size < alignment {
+		return nil, false
+	}
+
+	out := staging[:size]
+	off := 0
+	for i, buf := range buffers {
+		n := headerOffset + int(binary.LittleEndian.Uint32(buf[4:8]))
+		copy(out[off:], buf[:n])
+		if i == len(buffers)-1 {
+			n = size - off
+		}
+		binary.LittleEndian.PutUint32(out[off:off+4], uint32(n))
+		off += n
+	}
+	// The last shard's padding would otherwise hold data of an earlier flush
+	clear(out[packed:])
+	return out, true
+}
@@ -0,0 +1,96 @@
+package asynclogger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger_CompactFlush(t *testing.T) {
+	// writeFlushes logs two small flushes over all four shards and returns the logger's metrics
+	writeFlushes := func(t *testing.T, logPath string, mode IOMode, compact bool) FlushMetrics {
+		t.Helper()
+		config := fileWriterConfig(logPath, mode)
+		config.BufferSize = 256 * 1024
+		config.NumShards = 4
+		config.CompactFlush = compact
+		logger, err := New(config)
+		require.NoError(t, err)
+		for flush := 0; flush < 2; flush++ {
+			for i := 0; i < 10; i++ {
+				require.NoError(t, logger.TryLogBytes([]byte(fmt.Sprintf("flush %d entry %d", flush, i))))
+			}
+			require.NoError(t, logger.Flush(context.Background()))
+		}
+		metrics := logger.GetFlushMetrics()
+		require.NoError(t, logger.Close())
+		return metrics
+	}
+
+	for _, mode := range ioModes {
+		t.Run(string(mode), func(t *testing.T) {
+			dir := t.TempDir()
+			plainPath := filepath.Join(dir, "plain.log")
+			compactPath := filepath.Join(dir, "compact.log")
+			plain := writeFlushes(t, plainPath, mode, false)
+			compact := writeFlushes(t, compactPath, mode, true)
+
+			// The reader decodes both files to the same entries
+			entries := readEntries(t, plainPath)
+			assert.Len(t, entries, 20)
+			assert.Equal(t, entries, readEntries(t, compactPath))
+
+			assert.Equal(t, plain.PayloadBytes, compact.PayloadBytes)
+			assert.Equal(t, plain.HeaderBytes, compact.HeaderBytes)
+			if mode == IOModeBuffered {
+				// Nothing to save: buffered shards have no padding
+				assert.Zero(t, compact.CompactedFlushes)
+				assert.Zero(t, compact.PaddingBytes)
+				return
+			}
+
+			// Each flush packs into one alignment unit instead of four padded shards
+			assert.Equal(t, int64(2), compact.CompactedFlushes)
+			assert.Equal(t, plain.PaddingBytes-compact.PaddingBytes, compact.PaddingBytesSaved)
+			assert.Equal(t, int64(2*alignmentSize), compact.PayloadBytes+compact.HeaderBytes+compact.PaddingBytes)
+			assert.Less(t, compact.WriteAmplificationRatio, plain.WriteAmplificationRatio)
+			assert.Zero(t, plain.CompactedFlushes)
+			assert.Zero(t, plain.PaddingBytesSaved)
+
+			plainInfo, err := os.Stat(plainPath)
+			require.NoError(t, err)
+			compactInfo, err := os.Stat(compactPath)
+			require.NoError(t, err)
+			assert.Equal(t, plainInfo.Size()-compact.PaddingBytesSaved, compactInfo.Size())
+		})
+	}
+
+	t.Run("large flushes keep the zero-copy write", func(t *testing.T) {
+		logPath := filepath.Join(t.TempDir(), "test.log")
+		config := DefaultConfig(logPath)
+		config.BufferSize = 256 * 1024
+		config.NumShards = 4
+		config.CompactFlush = true
+		logger, err := New(config)
+		require.NoError(t, err)
+
+		// Together the shards hold more than one shard buffer, so the packed write would not fit
+		entry := bytes.Repeat([]byte("x"), 20*1024)
+		for i := 0; i < 8; i++ {
+			require.NoError(t, logger.TryLogBytes(entry))
+		}
+		require.NoError(t, logger.Flush(context.Background()))
+		metrics := logger.GetFlushMetrics()
+		require.NoError(t, logger.Close())
+
+		assert.Zero(t, metrics.CompactedFlushes)
+		assert.Zero(t, metrics.PaddingBytesSaved)
+		assert.Len(t, readEntries(t, logPath), 8)
+	})
+}
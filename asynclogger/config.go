@@ -2,7 +2,13 @@ package asynclogger
 
 import (
 	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/clock"
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/reader"
 )
 
 // Config holds the configuration for the async logger
@@ -10,42 +16,340 @@ type Config struct {
 	// LogFilePath is the path to the log file (required)
 	LogFilePath string
 
+	// StripeFiles stripes flushes across several files instead of writing LogFilePath, e.g. one path
+	// per NVMe device: the i-th shard buffer of each flush goes to StripeFiles[i%len(StripeFiles)],
+	// and the stripes are written concurrently (see StripedFileWriter). Each stripe rotates on its own
+	// and is a complete log file; read them together with reader.OpenStripes. Needs at least 2 paths.
+	// LoggerManager puts each event's stripes in the directories of these paths, so for it they must
+	// be in different directories.
+	// CompactFlush packs small flushes into one buffer, which goes to the first stripe
+	StripeFiles []string
+
+	// Sinks lists where flushes go (default: the log file only). SinkConfig{Network: SinkFile} is the
+	// log file (LogFilePath, or StripeFiles); "unix" and "tcp" sinks forward the same framed shard
+	// blocks to a collector socket (see SocketSink), e.g. a local fluent-bit. List the file and a
+	// socket to tee: each sink keeps its own error accounting (GetSinkStats), and a slow or absent
+	// collector never blocks or fails the file write. Without SinkFile nothing is written to disk
+	// and the first socket sink's queue decides whether a flush is lost. LoggerManager opens one
+	// connection per event logger
+	Sinks []SinkConfig
+
 	// BufferSize is the total buffer size in bytes (default: 64MB)
 	BufferSize int
 
-	// NumShards is the number of shards (default: 8)
+	// NumShards is the number of shards (default: 8, at most GOMAXPROCS*8)
+	// BufferSize is rounded down to a multiple of it
 	NumShards int
 
 	// FlushInterval is the time-based flush trigger (default: 10s)
 	FlushInterval time.Duration
 
 	// FlushTimeout is the maximum time to wait for writes to complete before flushing (default: 10ms)
-	// If timeout expires, flush proceeds anyway (may result in one corrupted log line)
+	// If timeout expires, flush proceeds anyway with the entries written so far; the writes still in
+	// flight are kept in the buffer and written by a later flush
+	// A timeout not shorter than FlushInterval is clamped to half of it
 	FlushTimeout time.Duration
 
+	// FlushHistorySize keeps a FlushRecord of each of the last N flushes for Logger.GetFlushHistory
+	// (default: 0, off): the shards written and their fill, bytes, what triggered the flush and how
+	// long it waited for writes and for the disk. The ring is allocated up front (Explain shows its
+	// size) and recording a flush allocates nothing
+	FlushHistorySize int
+
 	// RotationInterval is the time interval after which log files should rotate to a new file (default: 24h)
 	// Set to 0 to disable rotation. Rotated files are named with timestamp: {baseName}_{YYYY-MM-DD_HH-MM-SS}.log
 	RotationInterval time.Duration
+
+	// MaxFileSize is the file size in bytes after which log files rotate to a new file (default: 0, disabled)
+	// Works alongside RotationInterval: whichever limit is reached first rotates. A flush that would
+	// take a non-empty file past MaxFileSize is split at shard boundaries, so files exceed it by at most one shard
+	// It must be at least one shard (BufferSize/NumShards), or every flush would rotate
+	MaxFileSize int64
+
+	// WriteRetryTimeout is the maximum time LogBytes waits for the swap semaphore when the
+	// buffer is full before dropping the log (DefaultConfig: 10ms). 0 means never wait.
+	// Not used with DropPolicyBlock, which waits for buffer space instead
+	WriteRetryTimeout time.Duration
+
+	// DropPolicy controls what LogBytes/Log do when the buffers are full (default: DropPolicyDrop)
+	// DropPolicyBlock makes them wait for buffer space instead of dropping; see LogBytesBlocking
+	DropPolicy DropPolicy
+
+	// ShardFlushThresholdPct is how full (in percent of usable capacity, 1-100) a shard gets before
+	// it requests a swap and flush (default: 90). Large entries waste up to an entry of each shard
+	// below 100, so raise it for them; lower it to flush earlier
+	ShardFlushThresholdPct int
+
+	// MaxEntrySize is the space LogEntry reserves for each entry (default: 4KB)
+	// The unused part of a reservation is handed back or skipped; an entry that needs more is dropped
+	MaxEntrySize int
+
+	// PrependTimestamp writes the time of each write before its payload (default: TimestampNone)
+	// The entry length covers timestamp and payload; read it back with reader.Options.Timestamp
+	PrependTimestamp TimestampFormat
+
+	// SequenceNumbers writes an 8-byte sequence number before each payload (and before the timestamp)
+	// Shards flush independently, so files are not in write order; the numbers are taken from one
+	// process-wide counter when a write is attempted, so sorting by them restores the order, and the
+	// numbers missing from a logger's files are its dropped entries (and empty LogBytes/LogEntry calls).
+	// The entry length covers the number; read it back with reader.Options.SequenceNumbers
+	SequenceNumbers bool
+
+	// OutputFormat selects how entries are laid out in the log file (default: OutputFramed)
+	// OutputPlain writes newline-delimited text for grep and log shippers: each entry is its payload
+	// (after the RFC3339 timestamp, if any) ending in a newline, which is added if missing. There are
+	// no shard headers or length prefixes to decode, so payloads should not contain newlines. Needs
+	// IOModeBuffered, which writes no padding, and rules out SequenceNumbers, TimestampUnixNano and
+	// PersistentBuffers
+	OutputFormat OutputFormat
+
+	// IOMode selects how log files are opened and written (default: IOModeDirectSync)
+	IOMode IOMode
+
+	// IOAlignment is the O_DIRECT block size: shard buffers, their padding and file offsets are
+	// multiples of it (default: 4096). A power of two from 512 to 64KB: 512 saves padding on devices
+	// formatted with 512-byte logical blocks, 8192 suits volumes that want larger direct writes.
+	// IOAlignmentAuto asks the device of the log directory (each StripeFiles directory, taking the
+	// largest) during Validate and falls back to 4096 with a warning. Readers need not know it
+	IOAlignment int
+
+	// CompactFlush packs the shards of a small flush into one staging buffer: each shard keeps its
+	// header and data, and only the end of the write is padded to Direct I/O alignment instead of
+	// every shard. Flushes whose packed size exceeds one shard buffer keep the zero-copy write.
+	// Files stay readable by reader. Ignored with IOModeBuffered, which writes no padding
+	CompactFlush bool
+
+	// SyncInterval is how often IOModeBuffered calls fdatasync after a write (default: 1s)
+	// Data is also synced on rotation and Close. Ignored by the O_DIRECT modes
+	SyncInterval time.Duration
+
+	// OffsetJournal keeps a sidecar {base}.offset file with the durable offset of the file being
+	// written, updated after each durable write (every flush with IOModeDirectSync, every sync with
+	// IOModeBuffered, and on rotation and Close). On startup an existing LogFilePath is then
+	// continued at that offset instead of being truncated (O_DIRECT modes) or appended to past a
+	// torn flush (IOModeBuffered), and reader.Open stops there. Costs one small O_SYNC write per update
+	OffsetJournal bool
+
+	// PersistentBuffers allocates the shard buffers of both sets in a memory-mapped {base}.buffers
+	// file next to LogFilePath, so logs accepted but not yet flushed survive a process crash: New
+	// writes them to the log file before the logger starts. Writes copy into the buffers as usual;
+	// each flush first msyncs the sealed shards (bounding an OS crash to the active set) and zeroes
+	// them afterwards. Recovery is at-least-once: a crash between a flush and its bookkeeping
+	// writes that flush again. Unix only
+	PersistentBuffers bool
+
+	// WarmupOnStart makes New call Logger.Warmup before returning, so the first writes and flush do
+	// not pay for page faults and block allocation. Costs a write to every buffer page and one small
+	// file write at startup; a failed warmup is reported to InternalLogger and New still succeeds
+	WarmupOnStart bool
+
+	// Transform rewrites each payload before it is copied into a shard buffer (optional), e.g. to
+	// redact PII from an event before it reaches disk; see TransformFunc. It runs on the write path
+	// of every LogBytes, Log and LogEntry call and of LoggerManager's *WithEvent methods, so it must
+	// be hot-path code: a single pass over the payload without allocating, locking or I/O, within a
+	// latency budget of about a microsecond for a 1KB payload (the copy it precedes takes ~50ns).
+	// LoggerManager layers EventConfig.Transform over it
+	Transform TransformFunc
+
+	// OnDrop is called for every dropped log with the reason and message size (optional)
+	// Calls are made asynchronously from a background goroutine and never block the write path.
+	// Under overload it may be called at very high frequency (once per dropped log), so it must be
+	// cheap and do its own rate limiting (e.g. increment a counter, alert on a windowed rate).
+	// Calls that arrive while 1024 are still pending are discarded (see GetDiscardedCallbacks)
+	OnDrop func(reason DropReason, size int)
+
+	// OnFlushError is called when writing a flush to disk fails, with the error and the number of
+	// shards and bytes that were lost (optional). Delivered like OnDrop; when set, flush errors
+	// are no longer reported to InternalLogger
+	OnFlushError func(err error, shards int, bytes int)
+
+	// InternalLogger receives the logger's own diagnostics (flush errors, callback panics)
+	// (default: stderr via the standard log package)
+	InternalLogger InternalLogger
+
+	// Clock drives the FlushInterval ticker, RotationInterval and SyncInterval checks, the names of
+	// rotated files, WriteRetryTimeout and CloseWithTimeout (default: clock.Real). Tests set a
+	// clock.Fake (testsupport.NewFakeClock) to trigger them without sleeping. Entry timestamps,
+	// FlushTimeout and the flush latency metrics always use the wall clock
+	Clock clock.Clock
+}
+
+// TransformFunc is the type of Config.Transform. event is the sanitized name of the LoggerManager
+// event logged to ("" for a Logger created with New), in is the payload and scratch an empty
+// buffer with room for at least len(in) bytes. It returns the payload to log: in itself, in
+// modified in place (only when the caller owns it), or scratch with the rewritten payload appended;
+// appending past the capacity of scratch allocates. Returning nil drops the entry, counted in
+// FilteredLogs rather than DroppedLogs. Neither in nor scratch may be retained after it returns
+type TransformFunc func(event string, in []byte, scratch []byte) []byte
+
+// EventConfig overrides base Config settings for one LoggerManager event
+// Zero fields inherit the manager's base Config
+type EventConfig struct {
+	BufferSize       int           // Total buffer size in bytes
+	NumShards        int           // Number of shards
+	FlushInterval    time.Duration // Time-based flush trigger
+	RotationInterval time.Duration // Time-based file rotation
+
+	// Transform runs after the base Config.Transform (on its result), or alone without one
+	Transform TransformFunc
+}
+
+// apply returns base with the non-zero overrides applied
+func (e EventConfig) apply(base Config) Config {
+	if e.BufferSize > 0 {
+		base.BufferSize = e.BufferSize
+	}
+	if e.NumShards > 0 {
+		base.NumShards = e.NumShards
+	}
+	if e.FlushInterval > 0 {
+		base.FlushInterval = e.FlushInterval
+	}
+	if e.RotationInterval > 0 {
+		base.RotationInterval = e.RotationInterval
+	}
+	base.Transform = layerTransforms(base.Transform, e.Transform)
+	return base
+}
+
+// SinkFile is the SinkConfig.Network of the log file sink
+const SinkFile = "file"
+
+// SinkConfig describes one entry of Config.Sinks
+// Zero fields other than Network and Address take the defaults below
+type SinkConfig struct {
+	Network string // SinkFile, "unix" or "tcp"
+	Address string // Socket path or host:port (socket sinks only)
+
+	// QueueSize is how many flushes wait while the collector is slow or away (default: 4); a
+	// flush arriving at a full queue is not forwarded. Each holds a copy of a flush, up to BufferSize
+	QueueSize int
+
+	// Timeout bounds each dial and write (default: 5s); a write that times out reconnects
+	Timeout time.Duration
+
+	// MaxBackoff caps the exponential wait between dials while the collector is away (default: 5s)
+	MaxBackoff time.Duration
+
+	// CloseTimeout is how long Close waits for queued flushes to be sent (default: Timeout)
+	CloseTimeout time.Duration
+}
+
+// withDefaults returns sc with the zero fields set to their defaults
+func (sc SinkConfig) withDefaults() SinkConfig {
+	if sc.QueueSize <= 0 {
+		sc.QueueSize = 4
+	}
+	if sc.Timeout <= 0 {
+		sc.Timeout = 5 * time.Second
+	}
+	if sc.MaxBackoff <= 0 {
+		sc.MaxBackoff = 5 * time.Second
+	}
+	if sc.CloseTimeout <= 0 {
+		sc.CloseTimeout = sc.Timeout
+	}
+	return sc
 }
 
+// IOAlignmentAuto makes Validate detect Config.IOAlignment from the device of the log directory
+const IOAlignmentAuto = -1
+
+// Bounds of Config.IOAlignment: the smallest logical block size, and the largest useful direct write unit
+const (
+	minIOAlignment = 512
+	maxIOAlignment = 64 * 1024
+)
+
+// DropPolicy selects the backpressure behavior when the buffers are full
+type DropPolicy string
+
+const (
+	// DropPolicyDrop drops the log if the swap semaphore cannot be acquired within WriteRetryTimeout (default)
+	DropPolicyDrop DropPolicy = "drop"
+
+	// DropPolicyBlock blocks the caller until buffer space is available; logs are only
+	// dropped if the logger is closed while waiting
+	DropPolicyBlock DropPolicy = "block"
+)
+
+// TimestampFormat selects the timestamp PrependTimestamp writes before each entry
+type TimestampFormat = reader.TimestampFormat
+
+const (
+	// TimestampNone writes entries without a timestamp (default)
+	TimestampNone = reader.TimestampNone
+
+	// TimestampUnixNano writes the write time as an 8-byte little-endian int64 of Unix nanoseconds
+	TimestampUnixNano = reader.TimestampUnixNano
+
+	// TimestampRFC3339 writes the write time as reader.TimestampLayout in UTC plus a space (31 bytes)
+	TimestampRFC3339 = reader.TimestampRFC3339
+)
+
+// OutputFormat selects the layout of log files (Config.OutputFormat)
+type OutputFormat string
+
+const (
+	// OutputFramed writes shard headers and length-prefixed entries for reader to decode (default)
+	OutputFramed OutputFormat = "framed"
+
+	// OutputPlain writes one line of text per entry, without any framing
+	OutputPlain OutputFormat = "plain"
+)
+
+// IOMode selects the file I/O path used by DirectFileWriter
+type IOMode string
+
+const (
+	// IOModeDirectSync opens files with O_DIRECT|O_DSYNC: every flush is on disk when it returns (default)
+	IOModeDirectSync IOMode = "direct_sync"
+
+	// IOModeDirectAsync opens files with O_DIRECT only; data is fsynced on rotation and Close
+	IOModeDirectAsync IOMode = "direct_async"
+
+	// IOModeBuffered writes through the page cache and fdatasyncs every SyncInterval
+	// Shards are written without alignment padding; use it where O_DIRECT is slow or unsupported
+	// (e.g. overlayfs container filesystems)
+	IOModeBuffered IOMode = "buffered"
+)
+
 // DefaultConfig returns a configuration with baseline defaults
 // logPath is required - the path where logs will be written
 func DefaultConfig(logPath string) Config {
 	return Config{
-		LogFilePath:      logPath,
-		BufferSize:       64 * 1024 * 1024,      // 64MB (baseline configuration)
-		NumShards:        8,                     // 8 shards
-		FlushInterval:    10 * time.Second,      // 10 seconds
-		FlushTimeout:     10 * time.Millisecond, // 10ms timeout for write completion
-		RotationInterval: 24 * time.Hour,        // 24 hours (default rotation interval)
+		LogFilePath:       logPath,
+		BufferSize:        64 * 1024 * 1024,      // 64MB (baseline configuration)
+		NumShards:         8,                     // 8 shards
+		FlushInterval:     10 * time.Second,      // 10 seconds
+		FlushTimeout:      10 * time.Millisecond, // 10ms timeout for write completion
+		RotationInterval:  24 * time.Hour,        // 24 hours (default rotation interval)
+		WriteRetryTimeout: 10 * time.Millisecond, // 10ms wait for the swap semaphore before dropping
+		DropPolicy:        DropPolicyDrop,        // Drop on backpressure (never block callers)
+		MaxEntrySize:      4 * 1024,              // 4KB reserved per LogEntry
+		IOMode:            IOModeDirectSync,      // O_DIRECT|O_DSYNC writes
+		SyncInterval:      time.Second,           // fdatasync interval for IOModeBuffered
+
+		ShardFlushThresholdPct: flushThresholdPct, // Flush a shard at 90% of usable capacity
 	}
 }
 
 // Validate checks if the configuration is valid and applies defaults where needed
+// Combinations that only waste resources are clamped: NumShards to GOMAXPROCS*8, BufferSize down
+// to a multiple of NumShards and a FlushTimeout not shorter than FlushInterval to half of it.
+// See Explain for the result
 func (c *Config) Validate() error {
 	if c.LogFilePath == "" {
 		return fmt.Errorf("LogFilePath is required")
 	}
+	if err := validateStripeFiles(c.StripeFiles); err != nil {
+		return err
+	}
+	if err := validateSinks(c.Sinks); err != nil {
+		return err
+	}
+
+	c.Clock = clock.OrReal(c.Clock)
 
 	if c.BufferSize <= 0 {
 		c.BufferSize = 64 * 1024 * 1024 // 64MB default
@@ -62,12 +366,283 @@ func (c *Config) Validate() error {
 	if c.FlushTimeout <= 0 {
 		c.FlushTimeout = 10 * time.Millisecond
 	}
+	c.FlushTimeout = clampFlushTimeout(c.FlushTimeout, c.FlushInterval)
+
+	if c.MaxFileSize < 0 {
+		return fmt.Errorf("MaxFileSize must be >= 0, got %d", c.MaxFileSize)
+	}
+
+	if c.WriteRetryTimeout < 0 {
+		return fmt.Errorf("WriteRetryTimeout must be >= 0, got %v", c.WriteRetryTimeout)
+	}
+
+	if c.FlushHistorySize < 0 {
+		return fmt.Errorf("FlushHistorySize must be >= 0, got %d", c.FlushHistorySize)
+	}
+
+	switch c.DropPolicy {
+	case "":
+		c.DropPolicy = DropPolicyDrop
+	case DropPolicyDrop, DropPolicyBlock:
+	default:
+		return fmt.Errorf("unknown DropPolicy %q (expected %q or %q)", c.DropPolicy, DropPolicyDrop, DropPolicyBlock)
+	}
+
+	if c.ShardFlushThresholdPct == 0 {
+		c.ShardFlushThresholdPct = flushThresholdPct
+	}
+	if c.ShardFlushThresholdPct < 1 || c.ShardFlushThresholdPct > 100 {
+		return fmt.Errorf("ShardFlushThresholdPct must be between 1 and 100, got %d", c.ShardFlushThresholdPct)
+	}
+
+	if c.MaxEntrySize < 0 {
+		return fmt.Errorf("MaxEntrySize must be >= 0, got %d", c.MaxEntrySize)
+	}
+	if c.MaxEntrySize == 0 {
+		c.MaxEntrySize = 4 * 1024
+	}
+
+	switch c.PrependTimestamp {
+	case TimestampNone, TimestampUnixNano, TimestampRFC3339:
+	default:
+		return fmt.Errorf("unknown PrependTimestamp %q (expected %q or %q)", c.PrependTimestamp, TimestampUnixNano, TimestampRFC3339)
+	}
+
+	switch c.IOMode {
+	case "":
+		c.IOMode = IOModeDirectSync
+	case IOModeDirectSync, IOModeDirectAsync, IOModeBuffered:
+	default:
+		return fmt.Errorf("unknown IOMode %q (expected %q, %q or %q)", c.IOMode, IOModeDirectSync, IOModeDirectAsync, IOModeBuffered)
+	}
+
+	if c.SyncInterval <= 0 {
+		c.SyncInterval = time.Second
+	}
+
+	switch c.OutputFormat {
+	case "":
+		c.OutputFormat = OutputFramed
+	case OutputFramed:
+	case OutputPlain:
+		if err := c.validatePlain(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown OutputFormat %q (expected %q or %q)", c.OutputFormat, OutputFramed, OutputPlain)
+	}
+
+	if c.InternalLogger == nil {
+		c.InternalLogger = defaultInternalLogger
+	}
+
+	if err := c.resolveIOAlignment(); err != nil {
+		return err
+	}
 
 	// Ensure minimum shard size
 	shardSize := c.BufferSize / c.NumShards
 	if shardSize < 64*1024 {
 		return fmt.Errorf("shard size too small (%d bytes), increase BufferSize or decrease NumShards", shardSize)
 	}
+	c.BufferSize, c.NumShards = clampShards(c.BufferSize, c.NumShards)
+	shardSize = c.BufferSize / c.NumShards
+	if c.MaxEntrySize+entryPrefixSize+c.entryMetaSize() >= shardSize {
+		return fmt.Errorf("MaxEntrySize (%d bytes) must be smaller than a shard (%d bytes)", c.MaxEntrySize, shardSize)
+	}
+	if err := validateMaxFileSize(c.MaxFileSize, shardSize); err != nil {
+		return err
+	}
 
 	return nil
 }
+
+// Explain returns the settings a logger built from c would run with, one per line: c after
+// Validate's defaults and clamps, and the sizes and thresholds derived from it. Load-test harnesses
+// can log it to record exactly what they ran. If c is invalid, Explain returns the error instead
+func (c Config) Explain() string {
+	if err := c.Validate(); err != nil {
+		return fmt.Sprintf("invalid config: %v", err)
+	}
+
+	var b strings.Builder
+	explainShards(&b, c.BufferSize, c.NumShards, c.ShardFlushThresholdPct, c.IOAlignment)
+	fmt.Fprintf(&b, "entries: %d bytes reserved per LogEntry, %d byte prefix, %d byte timestamp (%s), %d byte sequence number\n",
+		c.MaxEntrySize, entryPrefixSize, c.PrependTimestamp.Size(), c.PrependTimestamp, c.entryMetaSize()-c.PrependTimestamp.Size())
+	fmt.Fprintf(&b, "flush timing: every %v, waiting up to %v for writes in progress\n", c.FlushInterval, c.FlushTimeout)
+	fmt.Fprintf(&b, "write path: %s on full buffers, %v retry timeout, %s I/O, %s output\n", c.DropPolicy, c.WriteRetryTimeout, c.IOMode, c.OutputFormat)
+	fmt.Fprintf(&b, "rotation: every %v, at %d bytes (0 = never)\n", c.RotationInterval, c.MaxFileSize)
+	if len(c.StripeFiles) > 0 {
+		fmt.Fprintf(&b, "stripes: %d files, %d shards each per full flush\n",
+			len(c.StripeFiles), (c.NumShards+len(c.StripeFiles)-1)/len(c.StripeFiles))
+	}
+	if len(c.Sinks) > 0 {
+		fmt.Fprintf(&b, "sinks: %s\n", sinkNames(c.Sinks))
+	}
+	if c.Transform != nil {
+		fmt.Fprintf(&b, "transform: every payload, before the buffer copy\n")
+	}
+	if c.FlushHistorySize > 0 {
+		_, numShards := shardLayout(c.BufferSize, c.NumShards)
+		fmt.Fprintf(&b, "flush history: last %d flushes, %d bytes\n", c.FlushHistorySize, flushHistoryBytes(c.FlushHistorySize, numShards))
+	}
+	return b.String()
+}
+
+// validatePlain checks that the settings of an OutputPlain config can be written as text
+func (c *Config) validatePlain() error {
+	switch {
+	case c.IOMode != IOModeBuffered:
+		return fmt.Errorf("OutputFormat %q needs IOMode %q (O_DIRECT pads every shard), got %q", OutputPlain, IOModeBuffered, c.IOMode)
+	case c.SequenceNumbers:
+		return fmt.Errorf("OutputFormat %q cannot write SequenceNumbers", OutputPlain)
+	case c.PrependTimestamp == TimestampUnixNano:
+		return fmt.Errorf("OutputFormat %q cannot write PrependTimestamp %q (use %q)", OutputPlain, TimestampUnixNano, TimestampRFC3339)
+	case c.PersistentBuffers:
+		return fmt.Errorf("OutputFormat %q cannot recover PersistentBuffers", OutputPlain)
+	}
+	return nil
+}
+
+// resolveIOAlignment detects IOAlignment for IOAlignmentAuto, defaults it, and checks the result
+func (c *Config) resolveIOAlignment() error {
+	if c.IOAlignment == IOAlignmentAuto {
+		c.IOAlignment = c.detectIOAlignment()
+	}
+	if c.IOAlignment == 0 {
+		c.IOAlignment = alignmentSize
+	}
+	if c.IOAlignment < minIOAlignment || c.IOAlignment > maxIOAlignment || c.IOAlignment&(c.IOAlignment-1) != 0 {
+		return fmt.Errorf("IOAlignment must be a power of two between %d and %d, got %d", minIOAlignment, maxIOAlignment, c.IOAlignment)
+	}
+	// Regions of the buffer file start after alignmentSize bytes of metadata (see regionMetaSize)
+	if c.PersistentBuffers && c.IOAlignment > alignmentSize {
+		return fmt.Errorf("PersistentBuffers supports IOAlignment up to %d, got %d", alignmentSize, c.IOAlignment)
+	}
+	return nil
+}
+
+// detectIOAlignment returns the largest alignment the log directories' devices need, at least
+// minIOAlignment; if a device cannot be asked, it warns and returns the default
+func (c *Config) detectIOAlignment() int {
+	paths := c.StripeFiles
+	if len(paths) == 0 {
+		paths = []string{c.LogFilePath}
+	}
+	alignment := minIOAlignment
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		detected, err := detectIOAlignment(dir)
+		if err == nil && detected > maxIOAlignment {
+			err = fmt.Errorf("device needs %d bytes, more than %d", detected, maxIOAlignment)
+		}
+		if err != nil {
+			c.InternalLogger.Printf("[WARNING] IOAlignment detection for %s failed, using %d: %v", dir, alignmentSize, err)
+			return alignmentSize
+		}
+		alignment = max(alignment, detected)
+	}
+	return alignment
+}
+
+// ioAlignment returns IOAlignment, or the default for configs that were not validated
+func (c Config) ioAlignment() int {
+	if c.IOAlignment > 0 {
+		return c.IOAlignment
+	}
+	return alignmentSize
+}
+
+// validateStripeFiles checks Config.StripeFiles: none, or at least 2 distinct paths
+func validateStripeFiles(stripes []string) error {
+	if len(stripes) == 0 {
+		return nil
+	}
+	if len(stripes) == 1 {
+		return fmt.Errorf("StripeFiles needs at least 2 paths, got 1 (use LogFilePath for a single file)")
+	}
+	seen := make(map[string]bool, len(stripes))
+	for _, path := range stripes {
+		if path == "" {
+			return fmt.Errorf("StripeFiles contains an empty path")
+		}
+		clean := filepath.Clean(path)
+		if seen[clean] {
+			return fmt.Errorf("StripeFiles contains %s twice", path)
+		}
+		seen[clean] = true
+	}
+	return nil
+}
+
+// validateSinks checks Config.Sinks: known networks, socket addresses, and no sink listed twice
+func validateSinks(sinks []SinkConfig) error {
+	seen := make(map[string]bool, len(sinks))
+	for _, sc := range sinks {
+		switch sc.Network {
+		case SinkFile:
+			if sc.Address != "" {
+				return fmt.Errorf("Sinks: the file sink takes no address (it writes LogFilePath), got %s", sc.Address)
+			}
+		case "unix", "tcp":
+			if sc.Address == "" {
+				return fmt.Errorf("Sinks: %s sink needs an address", sc.Network)
+			}
+		default:
+			return fmt.Errorf("Sinks: unknown network %q (use %q, \"unix\" or \"tcp\")", sc.Network, SinkFile)
+		}
+		key := sc.Network + ":" + sc.Address
+		if seen[key] {
+			return fmt.Errorf("Sinks contains %s twice", strings.TrimSuffix(key, ":"))
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// entryMetaSize is the bytes between each entry's length prefix and its payload: the sequence number
+// and the timestamp
+func (c Config) entryMetaSize() int {
+	if c.SequenceNumbers {
+		return reader.SequenceSize + c.PrependTimestamp.Size()
+	}
+	return c.PrependTimestamp.Size()
+}
+
+// shardsPerProc is how many shards per GOMAXPROCS Validate allows; more shards than concurrent
+// writers spread writes no further and only add flush work
+const shardsPerProc = 8
+
+// clampShards limits numShards to GOMAXPROCS*shardsPerProc and rounds bufferSize down to a multiple
+// of it, the part of the buffer the shards use
+func clampShards(bufferSize, numShards int) (int, int) {
+	numShards = min(numShards, runtime.GOMAXPROCS(0)*shardsPerProc)
+	return bufferSize - bufferSize%numShards, numShards
+}
+
+// clampFlushTimeout returns timeout, or half of interval if timeout is not shorter: a flush waiting
+// out the timeout for a stalled write would run into the next one
+func clampFlushTimeout(timeout, interval time.Duration) time.Duration {
+	if timeout >= interval {
+		return interval / 2
+	}
+	return timeout
+}
+
+// validateMaxFileSize rejects a rotation size below one shard, which rotates on every flush
+func validateMaxFileSize(maxFileSize int64, shardSize int) error {
+	if maxFileSize > 0 && maxFileSize < int64(shardSize) {
+		return fmt.Errorf("MaxFileSize (%d bytes) is smaller than one shard (%d bytes), so every flush would rotate; set it to at least %d or use smaller shards", maxFileSize, shardSize, shardSize)
+	}
+	return nil
+}
+
+// explainShards writes the shard layout of a buffer set (see newBufferSet) to b
+func explainShards(b *strings.Builder, bufferSize, numShards, thresholdPct, alignment int) {
+	shardSize, numShards := shardLayout(bufferSize, numShards)
+	capacity := alignSize(shardSize+headerOffset, alignment)
+	fmt.Fprintf(b, "buffers: %d shards x %d bytes (BufferSize %d), two sets; %d bytes allocated in all\n",
+		numShards, shardSize, bufferSize, 2*numShards*capacity)
+	fmt.Fprintf(b, "shard buffer: %d bytes aligned to %d, %d usable for entries\n", capacity, alignment, capacity-headerOffset)
+	fmt.Fprintf(b, "shard flush threshold: %d bytes (%d%% of usable)\n", flushThresholdBytes(int32(capacity), thresholdPct), thresholdPct)
+}
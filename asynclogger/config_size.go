@@ -2,6 +2,7 @@ package asynclogger
 
 import (
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -13,17 +14,25 @@ type SizeConfig struct {
 	// BufferSize is the total buffer size in bytes (default: 64MB)
 	BufferSize int
 
-	// NumShards is the number of shards (default: 8)
+	// NumShards is the number of shards (default: 8, at most GOMAXPROCS*8)
+	// BufferSize is rounded down to a multiple of it
 	NumShards int
 
 	// FlushInterval is the time-based flush trigger (default: 10s)
 	FlushInterval time.Duration
 
 	// FlushTimeout is the maximum time to wait for writes to complete before flushing (default: 10ms)
-	// If timeout expires, flush proceeds anyway (may result in one corrupted log line)
+	// If timeout expires, flush proceeds anyway with the entries written so far; the writes still in
+	// flight are kept in the buffer and written by a later flush
+	// A timeout not shorter than FlushInterval is clamped to half of it
 	FlushTimeout time.Duration
 
+	// WriteRetryTimeout is the maximum time LogBytes waits for the swap semaphore when the
+	// buffer is full before dropping the log (DefaultSizeConfig: 10ms). 0 means never wait
+	WriteRetryTimeout time.Duration
+
 	// MaxFileSize is the maximum file size in bytes before rotation (default: 1GB)
+	// It must be at least one shard (BufferSize/NumShards), or every flush would rotate.
 	// Set to 0 to disable rotation. Rotated files are named with timestamp: {baseName}_{YYYY-MM-DD_HH-MM-SS}.log
 	MaxFileSize int64
 
@@ -31,6 +40,18 @@ type SizeConfig struct {
 	// Preallocation ensures extents are ready for Direct I/O, improving write performance
 	// Set to 0 to use MaxFileSize
 	PreallocateFileSize int64
+
+	// RotationCallback is called with each completed file: on rotation, and for the last file on Close
+	// It runs on the flush goroutine after the old file is closed, so it must not block
+	RotationCallback func(info RotationInfo)
+
+	// RotationHistory is how many completed files SizeLogger.RotatedFiles keeps
+	// (default: DefaultRotationHistory)
+	RotationHistory int
+
+	// InternalLogger receives the logger's own diagnostics (flush errors, preallocation fallbacks)
+	// (default: stderr via the standard log package)
+	InternalLogger InternalLogger
 }
 
 // DefaultSizeConfig returns a configuration with baseline defaults for size-based rotation
@@ -43,12 +64,16 @@ func DefaultSizeConfig(logPath string) SizeConfig {
 		NumShards:           8,                     // 8 shards
 		FlushInterval:       10 * time.Second,      // 10 seconds
 		FlushTimeout:        10 * time.Millisecond, // 10ms timeout for write completion
+		WriteRetryTimeout:   10 * time.Millisecond, // 10ms wait for the swap semaphore before dropping
 		MaxFileSize:         maxFileSize,           // 1GB default
 		PreallocateFileSize: maxFileSize,           // Preallocate same as max file size
 	}
 }
 
 // Validate checks if the configuration is valid and applies defaults where needed
+// Combinations that only waste resources are clamped: NumShards to GOMAXPROCS*8, BufferSize down
+// to a multiple of NumShards, a FlushTimeout not shorter than FlushInterval to half of it and
+// PreallocateFileSize to MaxFileSize. See Explain for the result
 func (c *SizeConfig) Validate() error {
 	if c.LogFilePath == "" {
 		return fmt.Errorf("LogFilePath is required")
@@ -69,17 +94,34 @@ func (c *SizeConfig) Validate() error {
 	if c.FlushTimeout <= 0 {
 		c.FlushTimeout = 10 * time.Millisecond
 	}
+	c.FlushTimeout = clampFlushTimeout(c.FlushTimeout, c.FlushInterval)
+
+	if c.WriteRetryTimeout < 0 {
+		return fmt.Errorf("WriteRetryTimeout must be >= 0, got %v", c.WriteRetryTimeout)
+	}
+
+	if c.RotationHistory < 0 {
+		return fmt.Errorf("RotationHistory must be >= 0, got %d", c.RotationHistory)
+	}
+
+	if c.InternalLogger == nil {
+		c.InternalLogger = defaultInternalLogger
+	}
 
 	// Ensure minimum shard size
 	shardSize := c.BufferSize / c.NumShards
 	if shardSize < 64*1024 {
 		return fmt.Errorf("shard size too small (%d bytes), increase BufferSize or decrease NumShards", shardSize)
 	}
+	c.BufferSize, c.NumShards = clampShards(c.BufferSize, c.NumShards)
 
 	// Set default MaxFileSize if not specified
 	if c.MaxFileSize <= 0 {
 		c.MaxFileSize = 10 * 1024 * 1024 * 1024 // 10GB default
 	}
+	if err := validateMaxFileSize(c.MaxFileSize, c.BufferSize/c.NumShards); err != nil {
+		return err
+	}
 
 	// Set PreallocateFileSize to MaxFileSize if not specified
 	if c.PreallocateFileSize <= 0 {
@@ -93,3 +135,17 @@ func (c *SizeConfig) Validate() error {
 
 	return nil
 }
+
+// Explain returns the settings a SizeLogger built from c would run with (see Config.Explain)
+func (c SizeConfig) Explain() string {
+	if err := c.Validate(); err != nil {
+		return fmt.Sprintf("invalid config: %v", err)
+	}
+
+	var b strings.Builder
+	explainShards(&b, c.BufferSize, c.NumShards, flushThresholdPct, alignmentSize)
+	fmt.Fprintf(&b, "flush timing: every %v, waiting up to %v for writes in progress\n", c.FlushInterval, c.FlushTimeout)
+	fmt.Fprintf(&b, "write path: %v retry timeout\n", c.WriteRetryTimeout)
+	fmt.Fprintf(&b, "files: rotate at %d bytes, preallocate %d bytes\n", c.MaxFileSize, c.PreallocateFileSize)
+	return b.String()
+}
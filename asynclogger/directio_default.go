@@ -6,19 +6,18 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
-)
 
-// alignmentSize is the required alignment (512 bytes for compatibility)
-const alignmentSize = 512
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/clock"
+)
 
 // openDirectIO opens a file without O_DIRECT (fallback for non-Linux systems)
-// Note: This is for testing only. Production deployments should use Linux.
-// Returns file, initial offset, and error
-func openDirectIO(path string) (*os.File, int64, error) {
+// Without O_DIRECT there is no alignment requirement, so existing content is kept and writing
+// continues at the end of the file in every IOMode, or at resumeAt if it is >= 0 (the offset
+// journaled with Config.OffsetJournal); alignment is not needed. Returns file, initial offset, and error
+func openDirectIO(path string, mode IOMode, resumeAt, alignment int64) (*os.File, int64, error) {
 	// Ensure parent directory exists
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -30,6 +29,9 @@ func openDirectIO(path string) (*os.File, int64, error) {
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to open file: %w", err)
 	}
+	if resumeAt >= 0 {
+		return resumeFile(file, resumeAt)
+	}
 
 	// Get initial file size if file exists
 	var initialOffset int64
@@ -41,97 +43,51 @@ func openDirectIO(path string) (*os.File, int64, error) {
 }
 
 // allocAlignedBuffer allocates a byte slice for non-Linux systems
-// On non-Linux systems, alignment is not strictly required
-func allocAlignedBuffer(size int) []byte {
-	// Round up to alignment for consistency
-	alignedSize := ((size + alignmentSize - 1) / alignmentSize) * alignmentSize
-	return make([]byte, alignedSize)
-}
-
-// writeAligned writes data to file on non-Linux systems
-func writeAligned(file *os.File, data []byte) (int, error) {
-	if len(data) == 0 {
-		return 0, nil
-	}
-
-	// On non-Linux systems, just write normally
-	n, err := file.Write(data)
-	if err != nil {
-		return n, fmt.Errorf("write failed: %w", err)
-	}
-
-	return n, nil
+// Address alignment is not required without O_DIRECT, but the size is rounded up exactly as on
+// Linux so shard capacities (and therefore the on-disk layout) are identical on every platform
+func allocAlignedBuffer(size, alignment int) []byte {
+	return make([]byte, alignSize(size, alignment))
 }
 
 // writevAlignedWithOffset writes multiple buffers to file at a specific offset
-// On non-Linux systems, consolidates and writes as a single buffer
-// Note: For non-Linux, we use *os.File directly instead of fd
+// Emulates pwritev with a single pwrite (WriteAt): one buffer is written in place, several are
+// concatenated first. WriteAt leaves the file position alone, so concurrent offsets stay independent
 func writevAlignedWithOffset(file *os.File, buffers [][]byte, offset int64) (int, error) {
-	if len(buffers) == 0 {
-		return 0, nil
-	}
-
-	// Calculate total size
 	totalSize := 0
+	nonEmpty := 0
+	var single []byte
 	for _, buf := range buffers {
-		totalSize += len(buf)
+		if len(buf) > 0 {
+			totalSize += len(buf)
+			nonEmpty++
+			single = buf
+		}
 	}
 
 	if totalSize == 0 {
 		return 0, nil
 	}
 
-	// Consolidate all buffers
-	consolidatedBuf := make([]byte, 0, totalSize)
-	for _, buf := range buffers {
-		consolidatedBuf = append(consolidatedBuf, buf...)
-	}
-
-	// Seek to offset and write
-	if _, err := file.Seek(offset, 0); err != nil {
-		return 0, fmt.Errorf("failed to seek: %w", err)
+	data := single
+	if nonEmpty > 1 {
+		data = make([]byte, 0, totalSize)
+		for _, buf := range buffers {
+			data = append(data, buf...)
+		}
 	}
 
-	n, err := file.Write(consolidatedBuf)
+	n, err := file.WriteAt(data, offset)
 	if err != nil {
-		return n, fmt.Errorf("batched write failed: %w", err)
+		return n, fmt.Errorf("vectored I/O write failed: %w", err)
 	}
 
 	return n, nil
 }
 
-// isAligned checks if a size is aligned to the required boundary
-func isAligned(size int) bool {
-	return size%alignmentSize == 0
-}
-
-// alignSize rounds up size to the nearest alignment boundary
-func alignSize(size int) int {
-	return ((size + alignmentSize - 1) / alignmentSize) * alignmentSize
-}
-
-// extractBasePath extracts directory and base filename from a full file path
-// Returns directory, base filename without extension, and error
-func extractBasePath(fullPath string) (dir, baseName string, err error) {
-	dir = filepath.Dir(fullPath)
-	if dir == "." || dir == "" {
-		dir = "."
-	}
-
-	baseName = filepath.Base(fullPath)
-	// Remove .log extension if present (TrimSuffix is safe even if suffix doesn't exist)
-	baseName = strings.TrimSuffix(baseName, ".log")
-
-	if baseName == "" {
-		return "", "", fmt.Errorf("invalid file path: base name is empty after extraction")
-	}
-
-	return dir, baseName, nil
-}
-
-// FileWriter manages file handles, offset tracking, and rotation for non-Linux systems
-// Note: Rotation is simplified on non-Linux (no O_DIRECT support)
-type FileWriter struct {
+// DirectFileWriter manages file handles, offset tracking, and rotation for non-Linux systems
+// Portable counterpart of the Linux writer: same rotation, naming, sync points and metrics,
+// using buffered I/O with one pwrite per flush instead of O_DIRECT pwritev
+type DirectFileWriter struct {
 	// Current file
 	file          *os.File
 	fd            int
@@ -148,6 +104,22 @@ type FileWriter struct {
 	baseDir          string
 	baseFileName     string
 	rotationInterval time.Duration
+	maxFileSize      int64
+	mode             IOMode
+	syncInterval     time.Duration
+	alignment        int64 // Config.IOAlignment: the warmup block is a multiple of it
+
+	// Offset journal (nil without Config.OffsetJournal)
+	journal *offsetJournal
+
+	// Config.Clock: rotation intervals, sync intervals and rotated file names
+	clock clock.Clock
+
+	// Last sync (IOModeBuffered only; written by WriteVectored on the flush path)
+	lastSync time.Time
+
+	// Held by WriteVectored, so concurrent callers never write at the same offset
+	writeMu sync.Mutex
 
 	// Mutex for rotation operations (only held during rotation)
 	rotationMu sync.Mutex
@@ -156,99 +128,65 @@ type FileWriter struct {
 	lastPwritevDuration atomic.Int64 // Nanoseconds
 }
 
-// NewFileWriter creates a new FileWriter with the given configuration
-func NewFileWriter(config Config) (*FileWriter, error) {
+// NewFileWriter creates a new DirectFileWriter with the given configuration
+func NewFileWriter(config Config) (*DirectFileWriter, error) {
 	// Extract base directory and filename
 	baseDir, baseFileName, err := extractBasePath(config.LogFilePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract base path: %w", err)
 	}
 
+	// With an offset journal, an existing file is continued at its last durable offset
+	resumeAt := int64(-1)
+	var journal *offsetJournal
+	if config.OffsetJournal {
+		resumeAt = resumeOffset(config.LogFilePath)
+		if journal, err = openOffsetJournal(config.LogFilePath); err != nil {
+			return nil, err
+		}
+	}
+
 	// Open initial file
-	file, initialOffset, err := openDirectIO(config.LogFilePath)
+	alignment := int64(config.ioAlignment())
+	file, initialOffset, err := openDirectIO(config.LogFilePath, config.IOMode, resumeAt, alignment)
 	if err != nil {
+		journal.close()
 		return nil, fmt.Errorf("failed to open initial file: %w", err)
 	}
 
-	fw := &FileWriter{
+	clk := clock.OrReal(config.Clock)
+	fw := &DirectFileWriter{
 		file:             file,
 		fd:               int(file.Fd()),
 		filePath:         config.LogFilePath,
-		fileCreatedAt:    time.Now(),
+		fileCreatedAt:    clk.Now(),
 		baseDir:          baseDir,
 		baseFileName:     baseFileName,
 		rotationInterval: config.RotationInterval,
+		maxFileSize:      config.MaxFileSize,
+		mode:             config.IOMode,
+		syncInterval:     config.SyncInterval,
+		alignment:        alignment,
+		lastSync:         clk.Now(),
+		journal:          journal,
+		clock:            clk,
 	}
 
 	// Set initial offset (0 for new files, or existing file size)
 	fw.fileOffset.Store(initialOffset)
 
-	return fw, nil
-}
-
-// rotateIfNeeded checks if rotation is needed and performs it if necessary
-func (fw *FileWriter) rotateIfNeeded() error {
-	// If rotation is disabled (interval is 0), skip
-	if fw.rotationInterval <= 0 {
-		return nil
+	// The journal names the new current file from the start
+	if err := fw.journalOffset(); err != nil {
+		file.Close()
+		journal.close()
+		return nil, err
 	}
 
-	// Check if rotation is needed
-	if time.Since(fw.fileCreatedAt) < fw.rotationInterval {
-		return nil
-	}
-
-	// Acquire rotation mutex to prevent concurrent rotations
-	fw.rotationMu.Lock()
-	defer fw.rotationMu.Unlock()
-
-	// Double-check after acquiring lock (another goroutine might have rotated)
-	if time.Since(fw.fileCreatedAt) < fw.rotationInterval {
-		return nil
-	}
-
-	// If next file doesn't exist, create it
-	if fw.nextFile == nil {
-		if err := fw.createNextFile(); err != nil {
-			return fmt.Errorf("failed to create next file: %w", err)
-		}
-	}
-
-	// Swap to next file
-	if err := fw.swapFiles(); err != nil {
-		return fmt.Errorf("failed to swap files: %w", err)
-	}
-
-	return nil
-}
-
-// createNextFile creates a new file for rotation
-func (fw *FileWriter) createNextFile() error {
-	// Generate timestamped filename: {baseFileName}_{YYYY-MM-DD_HH-MM-SS}.log
-	timestamp := time.Now().Format("2006-01-02_15-04-05")
-	nextPath := filepath.Join(fw.baseDir, fmt.Sprintf("%s_%s.log", fw.baseFileName, timestamp))
-
-	// Open new file
-	file, initialOffset, err := openDirectIO(nextPath)
-	if err != nil {
-		return fmt.Errorf("failed to open next file: %w", err)
-	}
-
-	// Store next file details
-	fw.nextFile = file
-	fw.nextFd = int(file.Fd())
-	fw.nextFilePath = nextPath
-
-	// Next file should start at offset 0 (new file)
-	if initialOffset != 0 {
-		return fmt.Errorf("next file should be empty, but has size %d", initialOffset)
-	}
-
-	return nil
+	return fw, nil
 }
 
 // swapFiles atomically swaps from current file to next file
-func (fw *FileWriter) swapFiles() error {
+func (fw *DirectFileWriter) swapFiles() error {
 	if fw.nextFile == nil || fw.nextFd == 0 || fw.nextFilePath == "" {
 		return fmt.Errorf("next file is not set")
 	}
@@ -268,64 +206,77 @@ func (fw *FileWriter) swapFiles() error {
 		return fmt.Errorf("failed to close current file: %w", err)
 	}
 
-	// Swap next file to current
-	fw.file = fw.nextFile
-	fw.fd = fw.nextFd
-	fw.filePath = fw.nextFilePath
-	fw.fileOffset.Store(0) // Reset offset for new file
-	fw.fileCreatedAt = time.Now()
-
-	// Clear next file fields
-	fw.nextFile = nil
-	fw.nextFd = 0
-	fw.nextFilePath = ""
-
+	fw.promoteNextFile()
 	return nil
 }
 
 // WriteVectored writes multiple buffers to the file using vectored I/O
 // Handles rotation automatically before writing
-func (fw *FileWriter) WriteVectored(buffers [][]byte) (int, error) {
+func (fw *DirectFileWriter) WriteVectored(buffers [][]byte) (int, error) {
 	// Fast path: skip if no data to write (defensive check, no performance impact)
 	if len(buffers) == 0 {
 		return 0, nil
 	}
 
-	// Check and perform rotation if needed
-	if err := fw.rotateIfNeeded(); err != nil {
-		return 0, fmt.Errorf("rotation failed: %w", err)
-	}
+	fw.writeMu.Lock()
+	defer fw.writeMu.Unlock()
 
-	// Get current offset
-	offset := fw.fileOffset.Load()
+	// Write in as few batches as rotation allows: prepareWrite rotates first if needed and, with
+	// MaxFileSize, returns how many leading buffers fit in the current file
+	written := 0
+	var pwritevDuration time.Duration
+	for len(buffers) > 0 {
+		count, err := fw.prepareWrite(buffers)
+		if err != nil {
+			return written, fmt.Errorf("rotation failed: %w", err)
+		}
 
-	// Write using vectored I/O at specific offset (non-Linux uses file directly)
-	// Track ONLY the write syscall time (pure disk I/O)
-	pwritevStart := time.Now()
-	n, err := writevAlignedWithOffset(fw.file, buffers, offset)
-	pwritevDuration := time.Since(pwritevStart)
+		// Get current offset
+		offset := fw.fileOffset.Load()
 
-	// Store write duration for metrics (even on error, to track syscall time)
-	fw.lastPwritevDuration.Store(pwritevDuration.Nanoseconds())
+		// Write using vectored I/O at specific offset (non-Linux uses file directly)
+		// Track ONLY the write syscall time (pure disk I/O)
+		pwritevStart := time.Now()
+		n, err := writevAlignedWithOffset(fw.file, buffers[:count], offset)
+		pwritevDuration += time.Since(pwritevStart)
 
-	if err != nil {
-		return n, err
+		// Store write duration for metrics (even on error, to track syscall time)
+		fw.lastPwritevDuration.Store(pwritevDuration.Nanoseconds())
+
+		written += n
+		if err != nil {
+			return written, err
+		}
+
+		// Update offset atomically after successful write
+		fw.fileOffset.Add(int64(n))
+		buffers = buffers[count:]
 	}
 
-	// Update offset atomically after successful write
-	fw.fileOffset.Add(int64(n))
+	// Sync buffered writes periodically
+	if fw.mode == IOModeBuffered && fw.clock.Now().Sub(fw.lastSync) >= fw.syncInterval {
+		if err := fw.file.Sync(); err != nil {
+			return written, fmt.Errorf("failed to sync file: %w", err)
+		}
+		fw.lastSync = fw.clock.Now()
+		if err := fw.journalOffset(); err != nil {
+			return written, err
+		}
+	}
 
-	return n, nil
+	return written, nil
 }
 
 // Close syncs and closes the current file, and closes next file if it exists
-func (fw *FileWriter) Close() error {
+func (fw *DirectFileWriter) Close() error {
 	var firstErr error
 
 	// Sync and close current file
 	if fw.file != nil {
 		if err := fw.file.Sync(); err != nil && firstErr == nil {
 			firstErr = fmt.Errorf("failed to sync current file: %w", err)
+		} else if err := fw.journalOffset(); err != nil && firstErr == nil {
+			firstErr = err
 		}
 		if err := fw.file.Close(); err != nil && firstErr == nil {
 			firstErr = fmt.Errorf("failed to close current file: %w", err)
@@ -340,11 +291,30 @@ func (fw *FileWriter) Close() error {
 		}
 	}
 
+	if err := fw.journal.close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
 	return firstErr
 }
 
 // GetLastPwritevDuration returns the duration of the last write syscall
 // This measures pure disk I/O time, excluding rotation checks and other overhead
-func (fw *FileWriter) GetLastPwritevDuration() time.Duration {
+func (fw *DirectFileWriter) GetLastPwritevDuration() time.Duration {
 	return time.Duration(fw.lastPwritevDuration.Load())
 }
+
+// warmup primes the current file for the first flush (Logger.Warmup) with one block written at the
+// current offset and truncated away again. There is no portable fallocate, so nothing is preallocated
+func (fw *DirectFileWriter) warmup(size int64) (prime, preallocate time.Duration, err error) {
+	offset := fw.fileOffset.Load()
+
+	start := time.Now()
+	if _, err := fw.file.WriteAt(allocAlignedBuffer(int(fw.alignment), int(fw.alignment)), offset); err != nil {
+		return time.Since(start), 0, fmt.Errorf("prime write failed: %w", err)
+	}
+	if err := fw.file.Truncate(offset); err != nil {
+		return time.Since(start), 0, fmt.Errorf("failed to truncate prime write: %w", err)
+	}
+	return time.Since(start), 0, nil
+}
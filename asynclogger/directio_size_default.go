@@ -6,21 +6,20 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
 // SizeFileWriter manages file handles, offset tracking, and size-based rotation for non-Linux systems
-// This is a fallback implementation that doesn't use Direct I/O
+// Same rotation, preallocation and metrics as the Linux writer, without Direct I/O
 type SizeFileWriter struct {
 	// Current file
-	file          *os.File
-	fd            int
-	filePath      string
-	fileOffset    atomic.Int64
-	maxFileSize   int64 // Maximum file size before rotation
+	file        *os.File
+	fd          int
+	filePath    string
+	fileOffset  atomic.Int64
+	maxFileSize int64 // Maximum file size before rotation
 
 	// Next file (for rotation)
 	nextFile     *os.File
@@ -28,9 +27,14 @@ type SizeFileWriter struct {
 	nextFilePath string
 
 	// Configuration
-	baseDir              string
-	baseFileName         string
-	preallocateFileSize  int64 // Size to preallocate (not used on non-Linux)
+	baseDir             string
+	baseFileName        string
+	preallocateFileSize int64          // Size to preallocate (not used on non-Linux)
+	logger              InternalLogger // Receives preallocation fallback warnings
+
+	// Completed files (SizeConfig.RotationCallback and RotationHistory)
+	onRotate  func(RotationInfo)
+	rotations *rotationHistory
 
 	// Mutex for rotation operations (only held during rotation)
 	rotationMu sync.Mutex
@@ -39,7 +43,9 @@ type SizeFileWriter struct {
 	lastPwritevDuration atomic.Int64 // Nanoseconds
 }
 
-// openDirectIOSize opens a file without Direct I/O (non-Linux fallback)
+// openDirectIOSize opens a file without Direct I/O (non-Linux fallback), preallocating with Truncate
+// Truncate extends the file with zeros (sparse where the filesystem supports it), giving the same
+// layout as fallocate on Linux: data from offset 0 followed by a zero-filled tail
 func openDirectIOSize(path string, preallocateSize int64) (*os.File, int64, error) {
 	// Ensure parent directory exists
 	dir := filepath.Dir(path)
@@ -47,71 +53,28 @@ func openDirectIOSize(path string, preallocateSize int64) (*os.File, int64, erro
 		return nil, 0, fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	// Open file normally (no Direct I/O on non-Linux)
-	file, err := os.Create(path)
+	// Open file normally (no Direct I/O on non-Linux), truncating like O_TRUNC on Linux
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to create file: %w", err)
 	}
 
-	// Get file info to determine initial offset
-	info, err := file.Stat()
-	if err != nil {
-		file.Close()
-		return nil, 0, fmt.Errorf("failed to stat file: %w", err)
-	}
-
-	return file, info.Size(), nil
-}
-
-// writevAlignedWithOffsetSize writes multiple buffers to file at a specific offset (non-Linux fallback)
-// Uses WriteAt for each buffer sequentially (not as efficient as Pwritev, but works)
-func writevAlignedWithOffsetSize(fd int, buffers [][]byte, offset int64) (int, error) {
-	if len(buffers) == 0 {
-		return 0, nil
-	}
-
-	// Filter out empty buffers
-	nonEmptyBuffers := make([][]byte, 0, len(buffers))
-	for _, buf := range buffers {
-		if len(buf) > 0 {
-			nonEmptyBuffers = append(nonEmptyBuffers, buf)
+	// Preallocate to the same block-aligned size as fallocate on Linux
+	if preallocateSize > 0 {
+		if err := file.Truncate(alignUp(preallocateSize, alignmentSize)); err != nil {
+			file.Close()
+			return nil, 0, fmt.Errorf("failed to preallocate file with truncate: %w", err)
 		}
 	}
 
-	if len(nonEmptyBuffers) == 0 {
-		return 0, nil
-	}
-
-	// Get file from fd (non-Linux fallback)
-	// Note: This is a simplified implementation - in practice, you'd need to track file separately
-	// For now, we'll return an error indicating this needs to be implemented properly
-	return 0, fmt.Errorf("writevAlignedWithOffsetSize not fully implemented for non-Linux systems")
-}
-
-// extractBasePathSize extracts directory and base filename from a full file path
-func extractBasePathSize(fullPath string) (dir, baseName string, err error) {
-	dir = filepath.Dir(fullPath)
-	if dir == "." || dir == "" {
-		dir = "."
-	}
-
-	baseName = filepath.Base(fullPath)
-	// Remove .log extension if present
-	if strings.HasSuffix(baseName, ".log") {
-		baseName = strings.TrimSuffix(baseName, ".log")
-	}
-
-	if baseName == "" {
-		return "", "", fmt.Errorf("invalid file path: base name is empty after extraction")
-	}
-
-	return dir, baseName, nil
+	// File is always truncated and preallocated, so offset is always 0
+	return file, 0, nil
 }
 
 // NewSizeFileWriter creates a new SizeFileWriter with the given configuration (non-Linux fallback)
 func NewSizeFileWriter(config SizeConfig) (*SizeFileWriter, error) {
 	// Extract base directory and filename
-	baseDir, baseFileName, err := extractBasePathSize(config.LogFilePath)
+	baseDir, baseFileName, err := extractBasePath(config.LogFilePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract base path: %w", err)
 	}
@@ -128,12 +91,15 @@ func NewSizeFileWriter(config SizeConfig) (*SizeFileWriter, error) {
 
 	fw := &SizeFileWriter{
 		file:                file,
-		fd:                  0, // Not used on non-Linux
+		fd:                  int(file.Fd()),
 		filePath:            initialPath,
 		maxFileSize:         config.MaxFileSize,
 		baseDir:             baseDir,
 		baseFileName:        baseFileName,
 		preallocateFileSize: config.PreallocateFileSize,
+		logger:              internalLoggerOrDefault(config.InternalLogger),
+		onRotate:            config.RotationCallback,
+		rotations:           newRotationHistory(config.RotationHistory),
 	}
 
 	// Set initial offset
@@ -198,16 +164,21 @@ func (fw *SizeFileWriter) rotateIfNeeded() error {
 
 // createNextFile creates a new file for rotation
 func (fw *SizeFileWriter) createNextFile() error {
-	timestamp := time.Now().Format("2006-01-02_15-04-05")
-	nextPath := filepath.Join(fw.baseDir, fmt.Sprintf("%s_%s.log", fw.baseFileName, timestamp))
+	nextPath := rotatedFilePath(fw.baseDir, fw.baseFileName, time.Now())
 
+	// Try to open new file with preallocation, falling back to no preallocation like Linux
 	file, initialOffset, err := openDirectIOSize(nextPath, fw.preallocateFileSize)
 	if err != nil {
-		return fmt.Errorf("failed to open next file: %w", err)
+		file, initialOffset, err = openDirectIOSize(nextPath, 0)
+		if err != nil {
+			return fmt.Errorf("failed to open next file (with and without preallocation): %w", err)
+		}
+		fw.logger.Printf("[WARNING] Failed to preallocate %d bytes for %s, continuing without preallocation",
+			fw.preallocateFileSize, nextPath)
 	}
 
 	fw.nextFile = file
-	fw.nextFd = 0
+	fw.nextFd = int(file.Fd())
 	fw.nextFilePath = nextPath
 
 	if initialOffset != 0 {
@@ -237,6 +208,8 @@ func (fw *SizeFileWriter) swapFiles() error {
 		return fmt.Errorf("failed to close current file: %w", err)
 	}
 
+	fw.recordRotation(fw.nextFilePath, RotationSize)
+
 	// Swap next file to current
 	fw.file = fw.nextFile
 	fw.fd = fw.nextFd
@@ -277,29 +250,25 @@ func (fw *SizeFileWriter) WriteVectored(buffers [][]byte) (int, error) {
 
 	offset := fw.fileOffset.Load()
 
-	// Write sequentially (non-Linux fallback)
-	writeStart := time.Now()
-	totalWritten := 0
-	for _, buf := range buffers {
-		if len(buf) == 0 {
-			continue
-		}
-		n, err := fw.file.WriteAt(buf, offset+int64(totalWritten))
-		if err != nil {
-			fw.lastPwritevDuration.Store(time.Since(writeStart).Nanoseconds())
-			return totalWritten, err
-		}
-		totalWritten += n
+	// Single pwrite at the tracked offset; track ONLY the write syscall time, as on Linux
+	pwritevStart := time.Now()
+	n, err := writevAlignedWithOffset(fw.file, buffers, offset)
+	pwritevDuration := time.Since(pwritevStart)
+
+	// Store write duration for metrics (even on error, to track syscall time)
+	fw.lastPwritevDuration.Store(pwritevDuration.Nanoseconds())
+
+	if err != nil {
+		return n, err
 	}
-	writeDuration := time.Since(writeStart)
 
-	fw.lastPwritevDuration.Store(writeDuration.Nanoseconds())
-	fw.fileOffset.Add(int64(totalWritten))
+	// Update offset atomically after successful write
+	fw.fileOffset.Add(int64(n))
 
-	return totalWritten, nil
+	return n, nil
 }
 
-// Close syncs and closes the current file, and closes next file if it exists
+// Close syncs and closes the current file, and removes the next file if one was created
 func (fw *SizeFileWriter) Close() error {
 	var firstErr error
 
@@ -310,12 +279,22 @@ func (fw *SizeFileWriter) Close() error {
 		if err := fw.file.Close(); err != nil && firstErr == nil {
 			firstErr = fmt.Errorf("failed to close current file: %w", err)
 		}
+		fw.recordRotation("", RotationClose)
+		fw.file = nil
 	}
 
+	// The next file is created ahead of rotation (at 90% of MaxFileSize); one never rotated into
+	// holds no entries, only its preallocation, so it is removed instead of left behind
 	if fw.nextFile != nil {
 		if err := fw.nextFile.Close(); err != nil && firstErr == nil {
 			firstErr = fmt.Errorf("failed to close next file: %w", err)
 		}
+		if err := os.Remove(fw.nextFilePath); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to remove unused next file: %w", err)
+		}
+		fw.nextFile = nil
+		fw.nextFd = 0
+		fw.nextFilePath = ""
 	}
 
 	return firstErr
@@ -325,4 +304,3 @@ func (fw *SizeFileWriter) Close() error {
 func (fw *SizeFileWriter) GetLastPwritevDuration() time.Duration {
 	return time.Duration(fw.lastPwritevDuration.Load())
 }
-
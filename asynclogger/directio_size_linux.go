@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -16,12 +15,6 @@ import (
 	"golang.org/x/sys/unix"
 )
 
-// alignUp rounds n up to the next multiple of align (power of 2).
-// alignmentSize is already defined in directio_linux.go (shared constant)
-func alignUp(n, align int64) int64 {
-	return (n + align - 1) &^ (align - 1)
-}
-
 // openDirectIOSize opens a file with O_DIRECT and O_DSYNC flags, preallocating with fallocate
 // O_DIRECT: Bypasses OS page cache, writes directly to disk
 // O_DSYNC: Each write automatically syncs data to disk (eliminates need for explicit sync)
@@ -111,7 +104,8 @@ func writevAlignedWithOffsetSize(fd int, buffers [][]byte, offset int64) (int, e
 	// Buffers are already aligned (address and size), so we can write directly!
 	// Single vectored write syscall at specific offset - kernel reads from multiple buffers!
 	// unix.Pwritev takes [][]byte directly with offset - NO iovec creation needed, NO copying!
-	n, err := unix.Pwritev(fd, nonEmptyBuffers, offset)
+	// pwritevFull (directio_linux.go) continues short writes, so a flush is never cut off mid-shard
+	n, err := pwritevFull(fd, nonEmptyBuffers, offset)
 	if err != nil {
 		return n, fmt.Errorf("vectored I/O write failed: %w", err)
 	}
@@ -126,27 +120,6 @@ func alignSizeSize(size int) int {
 	return ((size + alignmentSize - 1) / alignmentSize) * alignmentSize
 }
 
-// extractBasePathSize extracts directory and base filename from a full file path
-// Returns directory, base filename without extension, and error
-func extractBasePathSize(fullPath string) (dir, baseName string, err error) {
-	dir = filepath.Dir(fullPath)
-	if dir == "." || dir == "" {
-		dir = "."
-	}
-
-	baseName = filepath.Base(fullPath)
-	// Remove .log extension if present
-	if strings.HasSuffix(baseName, ".log") {
-		baseName = strings.TrimSuffix(baseName, ".log")
-	}
-
-	if baseName == "" {
-		return "", "", fmt.Errorf("invalid file path: base name is empty after extraction")
-	}
-
-	return dir, baseName, nil
-}
-
 // SizeFileWriter manages file handles, offset tracking, and size-based rotation for Direct I/O writes
 // Encapsulates all file management logic, keeping logger.go unaware of rotation details
 // Uses fallocate to preallocate files for optimal Direct I/O performance
@@ -166,7 +139,12 @@ type SizeFileWriter struct {
 	// Configuration
 	baseDir             string
 	baseFileName        string
-	preallocateFileSize int64 // Size to preallocate using fallocate
+	preallocateFileSize int64          // Size to preallocate using fallocate
+	logger              InternalLogger // Receives preallocation fallback warnings
+
+	// Completed files (SizeConfig.RotationCallback and RotationHistory)
+	onRotate  func(RotationInfo)
+	rotations *rotationHistory
 
 	// Mutex for rotation operations (only held during rotation)
 	rotationMu sync.Mutex
@@ -178,7 +156,7 @@ type SizeFileWriter struct {
 // NewSizeFileWriter creates a new SizeFileWriter with the given configuration
 func NewSizeFileWriter(config SizeConfig) (*SizeFileWriter, error) {
 	// Extract base directory and filename
-	baseDir, baseFileName, err := extractBasePathSize(config.LogFilePath)
+	baseDir, baseFileName, err := extractBasePath(config.LogFilePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract base path: %w", err)
 	}
@@ -201,6 +179,9 @@ func NewSizeFileWriter(config SizeConfig) (*SizeFileWriter, error) {
 		baseDir:             baseDir,
 		baseFileName:        baseFileName,
 		preallocateFileSize: config.PreallocateFileSize,
+		logger:              internalLoggerOrDefault(config.InternalLogger),
+		onRotate:            config.RotationCallback,
+		rotations:           newRotationHistory(config.RotationHistory),
 	}
 
 	// Set initial offset (0 for new files)
@@ -257,9 +238,8 @@ func (fw *SizeFileWriter) rotateIfNeeded() error {
 // createNextFile creates a new file for rotation with preallocation
 // If preallocation fails (e.g., disk full, fallocate timeout), creates file without preallocation
 func (fw *SizeFileWriter) createNextFile() error {
-	// Generate timestamped filename: {baseFileName}_{YYYY-MM-DD_HH-MM-SS}.log
-	timestamp := time.Now().Format("2006-01-02_15-04-05")
-	nextPath := filepath.Join(fw.baseDir, fmt.Sprintf("%s_%s.log", fw.baseFileName, timestamp))
+	// Timestamped filename: {baseFileName}_{YYYY-MM-DD_HH-MM-SS}.log, suffixed if already taken
+	nextPath := rotatedFilePath(fw.baseDir, fw.baseFileName, time.Now())
 
 	// Try to open new file with preallocation
 	file, initialOffset, err := openDirectIOSize(nextPath, fw.preallocateFileSize)
@@ -271,7 +251,7 @@ func (fw *SizeFileWriter) createNextFile() error {
 			return fmt.Errorf("failed to open next file (with and without preallocation): %w", err)
 		}
 		// Log warning but continue (file will work, just without preallocation)
-		fmt.Printf("[WARNING] Failed to preallocate %d bytes for %s, continuing without preallocation\n",
+		fw.logger.Printf("[WARNING] Failed to preallocate %d bytes for %s, continuing without preallocation",
 			fw.preallocateFileSize, nextPath)
 	}
 
@@ -309,6 +289,8 @@ func (fw *SizeFileWriter) swapFiles() error {
 		return fmt.Errorf("failed to close current file: %w", err)
 	}
 
+	fw.recordRotation(fw.nextFilePath, RotationSize)
+
 	// Swap next file to current
 	fw.file = fw.nextFile
 	fw.fd = fw.nextFd
@@ -375,7 +357,7 @@ func (fw *SizeFileWriter) WriteVectored(buffers [][]byte) (int, error) {
 	return n, nil
 }
 
-// Close syncs and closes the current file, and closes next file if it exists
+// Close syncs and closes the current file, and removes the next file if one was created
 func (fw *SizeFileWriter) Close() error {
 	var firstErr error
 
@@ -387,13 +369,22 @@ func (fw *SizeFileWriter) Close() error {
 		if err := fw.file.Close(); err != nil && firstErr == nil {
 			firstErr = fmt.Errorf("failed to close current file: %w", err)
 		}
+		fw.recordRotation("", RotationClose)
+		fw.file = nil
 	}
 
-	// Close next file if it exists
+	// The next file is created ahead of rotation (at 90% of MaxFileSize); one never rotated into
+	// holds no entries, only its preallocation, so it is removed instead of left behind
 	if fw.nextFile != nil {
 		if err := fw.nextFile.Close(); err != nil && firstErr == nil {
 			firstErr = fmt.Errorf("failed to close next file: %w", err)
 		}
+		if err := os.Remove(fw.nextFilePath); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to remove unused next file: %w", err)
+		}
+		fw.nextFile = nil
+		fw.nextFd = 0
+		fw.nextFilePath = ""
 	}
 
 	return firstErr
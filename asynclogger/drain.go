@@ -0,0 +1,78 @@
+package asynclogger
+
+import (
+	"context"
+	"fmt"
+)
+
+// DrainReport describes what LoggerManager.Drain flushed
+type DrainReport struct {
+	Events map[string]EventDrainReport // By sanitized event name
+
+	// Writes refused since Drain started to events without a logger (refusals of an event with a
+	// logger are in its EventDrainReport)
+	RejectedUnknownEvents int64
+
+	// Totals over Events
+	EntriesFlushed int64
+	RejectedLogs   int64 // Including RejectedUnknownEvents
+
+	DeadlineExceeded bool // ctx ended before every event logger was flushed
+}
+
+// EventDrainReport is the part of a DrainReport for one event logger
+type EventDrainReport struct {
+	EntriesFlushed int64 // Entries written to disk while Drain ran
+	BytesFlushed   int64 // Bytes written while Drain ran, as in CloseReport
+	RejectedLogs   int64 // Writes refused since Drain started
+}
+
+// Drain prepares the manager for a handover to another process: it stops accepting writes and
+// flushes every event logger, or stops at the end of ctx. Unlike Close it keeps the loggers open
+// and reports progress, so it can run before a server's graceful stop and be followed by Close.
+//
+// From the start of Drain, LogBytesWithEvent, TryLogBytesWithEvent and LogWithEvent refuse writes
+// with ErrDraining; they are counted as rejected, not in TotalLogs or DroppedLogs, and no new event
+// logger is created. A write already past that check may land after the flush and is flushed by
+// Close. Draining cannot be undone. Returns ctx.Err() (wrapped) with DeadlineExceeded set if ctx
+// ended first, or the first flush error
+func (lm *LoggerManager) Drain(ctx context.Context) (DrainReport, error) {
+	lm.draining.Store(true)
+
+	// Flushed counters of each event logger when writes stopped
+	type drainStart struct {
+		eventName string
+		logger    *Logger
+		entries   int64
+		bytes     int64
+	}
+	var started []drainStart
+	lm.RangeEventLoggers(func(eventName string, logger *Logger) bool {
+		started = append(started, drainStart{eventName, logger, logger.stats.EntriesFlushed.Load(), logger.stats.BytesWritten.Load()})
+		return true
+	})
+
+	err := lm.FlushAll(ctx)
+
+	report := DrainReport{
+		Events:                make(map[string]EventDrainReport),
+		RejectedUnknownEvents: lm.drainRejected.Load(),
+	}
+	report.RejectedLogs = report.RejectedUnknownEvents
+	for _, s := range started {
+		event := EventDrainReport{
+			EntriesFlushed: s.logger.stats.EntriesFlushed.Load() - s.entries,
+			BytesFlushed:   s.logger.stats.BytesWritten.Load() - s.bytes,
+			RejectedLogs:   s.logger.stats.DrainRejectedLogs.Load(),
+		}
+		report.Events[s.eventName] = event
+		report.EntriesFlushed += event.EntriesFlushed
+		report.RejectedLogs += event.RejectedLogs
+	}
+
+	if err != nil && ctx.Err() != nil {
+		report.DeadlineExceeded = true
+		err = fmt.Errorf("drain: %w", err)
+	}
+	return report, err
+}
@@ -0,0 +1,249 @@
+package asynclogger
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrEntryTooLarge is returned by LogEntry when the entry does not fit in Config.MaxEntrySize
+var ErrEntryTooLarge = errors.New("entry larger than MaxEntrySize")
+
+// entryBufferPool recycles EntryBuffers, which escape to the heap when passed to fn
+var entryBufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(EntryBuffer)
+	},
+}
+
+// EntryBuffer encodes one log entry directly into a shard's reserved region (see Logger.LogEntry)
+// Appends past the reservation are ignored and make LogEntry drop the entry with ErrEntryTooLarge
+type EntryBuffer struct {
+	buf      []byte // Reserved region: len is the entry so far, cap is MaxEntrySize
+	overflow bool
+}
+
+// AppendBytes appends p to the entry
+func (e *EntryBuffer) AppendBytes(p []byte) {
+	if e.fits(len(p)) {
+		e.buf = append(e.buf, p...)
+	}
+}
+
+// AppendString appends s to the entry
+func (e *EntryBuffer) AppendString(s string) {
+	if e.fits(len(s)) {
+		e.buf = append(e.buf, s...)
+	}
+}
+
+// AppendByte appends c to the entry
+func (e *EntryBuffer) AppendByte(c byte) {
+	if e.fits(1) {
+		e.buf = append(e.buf, c)
+	}
+}
+
+// AppendInt appends the decimal form of v to the entry
+func (e *EntryBuffer) AppendInt(v int64) {
+	var tmp [20]byte
+	e.AppendBytes(strconv.AppendInt(tmp[:0], v, 10))
+}
+
+// AppendTime appends t formatted with layout (see time.Time.Format) to the entry
+func (e *EntryBuffer) AppendTime(t time.Time, layout string) {
+	var tmp [64]byte
+	e.AppendBytes(t.AppendFormat(tmp[:0], layout))
+}
+
+// Len returns the number of bytes appended so far
+func (e *EntryBuffer) Len() int {
+	return len(e.buf)
+}
+
+// Available returns the number of bytes that can still be appended
+func (e *EntryBuffer) Available() int {
+	if e.overflow {
+		return 0
+	}
+	return cap(e.buf) - len(e.buf)
+}
+
+// fits reports whether n more bytes fit in the reservation, marking the entry overflowed if not
+func (e *EntryBuffer) fits(n int) bool {
+	if e.overflow || len(e.buf)+n > cap(e.buf) {
+		e.overflow = true
+		return false
+	}
+	return true
+}
+
+// LogEntry encodes one entry with fn directly into the shard buffer, without an intermediate copy
+// It reserves Config.MaxEntrySize in a shard (taking the same fast, retry and DropPolicyBlock paths
+// as TryLogBytes), runs fn, then commits the bytes fn appended; the unused tail is handed back or
+// left as padding that readers skip. fn runs while the reservation holds up a flush of the shard
+// (for at most FlushTimeout), so it must only encode, and the EntryBuffer must not be retained.
+// Returns nil, ErrClosed, ErrBufferFull or ErrEntryTooLarge (sentinels, like TryLogBytes).
+// An entry where fn appends nothing is not logged and returns nil. With Config.Transform, fn encodes
+// into a pooled buffer and the transformed entry is copied in like TryLogBytes, with its errors
+func (l *Logger) LogEntry(fn func(buf *EntryBuffer)) error {
+	if l.config.Transform != nil {
+		return l.logEntryTransformed(fn)
+	}
+
+	l.stats.TotalLogs.Add(1)
+	seq := nextSequence(l.config.SequenceNumbers)
+
+	size := int32(l.config.MaxEntrySize + entryPrefixSize)
+	if !l.beginWrite() {
+		l.dropped(DropReasonClosed, int(size))
+		return ErrClosed
+	}
+	defer l.endWrite()
+
+	shard, start, err := l.reserveEntry(size)
+	if err != nil {
+		return err
+	}
+	buf := shard.buffer
+
+	entry := entryBufferPool.Get().(*EntryBuffer)
+	entry.buf, entry.overflow = buf.entry(start, size), false
+	committed := false
+	defer func() {
+		// fn panicked: release the reservation so the shard's flush does not wait for it
+		if !committed {
+			buf.commitEntry(start, size, 0, 0)
+		}
+		entry.buf = nil
+		entryBufferPool.Put(entry)
+	}()
+	fn(entry)
+
+	length, overflow := len(entry.buf), entry.overflow
+	if overflow {
+		length = 0
+	}
+	committed = true
+	if buf.commitEntry(start, size, length, seq) {
+		shard.countSwap(l.trySwap(FlushTriggerThreshold))
+	}
+
+	if overflow {
+		l.dropped(DropReasonOversized, l.config.MaxEntrySize)
+		return ErrEntryTooLarge
+	}
+	l.stats.BytesBuffered.Add(int64(length))
+	return nil
+}
+
+// reserveEntry reserves size bytes in the active set for LogEntry
+// Takes the fast path, then the swap-semaphore retry path like TryLogBytes; with DropPolicyBlock
+// it waits for buffer space like LogBytesBlocking. Drops are counted with the reserved size
+func (l *Logger) reserveEntry(size int32) (*Shard, int32, error) {
+	if l.config.DropPolicy == DropPolicyBlock {
+		return l.reserveEntryBlocking(size)
+	}
+
+	if l.life.Closed() {
+		l.dropped(DropReasonClosed, int(size))
+		return nil, 0, ErrClosed
+	}
+
+	activeSet := l.activeSet.Load()
+	if activeSet == nil {
+		l.dropped(DropReasonClosed, int(size))
+		return nil, 0, ErrClosed
+	}
+
+	// Fast path
+	shard, start, needsFlush := activeSet.reserve(size)
+	if start >= 0 {
+		l.stats.FastPathWrites.Add(1)
+		return shard, start, nil
+	}
+
+	// Shard full - retry under the swap semaphore
+	l.stats.RetryPathWrites.Add(1)
+	shard.countRetry()
+	if !l.acquireSwapPermit() {
+		l.stats.RetryTimeouts.Add(1)
+		shard.countRetryTimeout()
+		shard.countDrop()
+		l.dropped(DropReasonSemaphoreTimeout, int(size))
+		return nil, 0, ErrBufferFull
+	}
+	defer func() { <-l.swapSemaphore }()
+
+	// Re-check 1: the set might have been swapped by another thread
+	activeSet = l.activeSet.Load()
+	if activeSet == nil {
+		l.dropped(DropReasonClosed, int(size))
+		return nil, 0, ErrClosed
+	}
+	if shard, start, needsFlush = activeSet.reserve(size); start >= 0 {
+		return shard, start, nil
+	}
+	if needsFlush {
+		shard.countSwap(l.trySwap(FlushTriggerThreshold))
+	}
+
+	// Re-check 2: after the swap
+	activeSet = l.activeSet.Load()
+	if activeSet == nil {
+		l.dropped(DropReasonClosed, int(size))
+		return nil, 0, ErrClosed
+	}
+	if shard, start, _ = activeSet.reserve(size); start < 0 {
+		shard.countDrop()
+		l.dropped(DropReasonBufferFull, int(size))
+		return nil, 0, ErrBufferFull
+	}
+	return shard, start, nil
+}
+
+// reserveEntryBlocking is reserveEntry for DropPolicyBlock: it waits for a flush instead of dropping
+func (l *Logger) reserveEntryBlocking(size int32) (*Shard, int32, error) {
+	var blockStart time.Time
+	defer func() {
+		if !blockStart.IsZero() {
+			l.recordBlocked(time.Since(blockStart))
+		}
+	}()
+
+	for {
+		if l.life.Closed() {
+			l.dropped(DropReasonClosed, int(size))
+			return nil, 0, ErrClosed
+		}
+
+		// Take the wakeup channel first so a flush completing before the wait is not missed
+		spaceReady := l.spaceAvailable()
+
+		activeSet := l.activeSet.Load()
+		if activeSet == nil {
+			l.dropped(DropReasonClosed, int(size))
+			return nil, 0, ErrClosed
+		}
+
+		if shard, start, _ := activeSet.reserve(size); start >= 0 {
+			return shard, start, nil
+		}
+
+		l.trySwap(FlushTriggerFull)
+		if l.activeSet.Load() != activeSet {
+			continue
+		}
+
+		if blockStart.IsZero() {
+			blockStart = time.Now()
+			l.stats.BlockedWrites.Add(1)
+		}
+
+		select {
+		case <-spaceReady:
+		case <-l.life.Done():
+		}
+	}
+}
@@ -0,0 +1,414 @@
+package asynclogger
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeBuffer decodes a buffer's entries the way they would be read back after a flush
+func decodeBuffer(t *testing.T, b *Buffer) []string {
+	t.Helper()
+	return decodeShard(t, b.data[:b.capacity], b.Offset())
+}
+
+// decodeShard returns the entries of data, a shard buffer holding entries up to offset end
+func decodeShard(t *testing.T, shard []byte, end int32) []string {
+	t.Helper()
+	data := append([]byte(nil), shard...)
+	binary.LittleEndian.PutUint32(data[0:4], uint32(len(data)))
+	binary.LittleEndian.PutUint32(data[4:8], uint32(end-headerOffset))
+
+	r := reader.NewLogReader(bytes.NewReader(data), reader.Options{})
+	var entries []string
+	for {
+		entry, err := r.Next()
+		if err != nil {
+			require.Equal(t, 0, r.CorruptShards())
+			return entries
+		}
+		entries = append(entries, string(entry))
+	}
+}
+
+// reserveString reserves size bytes in b and fills the entry with s
+func reserveString(t *testing.T, b *Buffer, size int32) func(s string) {
+	t.Helper()
+	start, _ := b.reserve(size)
+	require.GreaterOrEqual(t, start, int32(headerOffset))
+	return func(s string) {
+		b.commitEntry(start, size, len(append(b.entry(start, size), s...)), 0)
+	}
+}
+
+func TestBuffer_ReserveCommit(t *testing.T) {
+	t.Run("last reservation shrinks to its entry", func(t *testing.T) {
+		b := newBuffer(64*1024, 0, false, alignmentSize)
+		commit := reserveString(t, b, 100+entryPrefixSize)
+		commit("short")
+
+		assert.Equal(t, int32(4+5), b.DataSize())
+		assert.Equal(t, []string{"short"}, decodeBuffer(t, b))
+	})
+
+	t.Run("unused tail becomes padding when a later write follows", func(t *testing.T) {
+		b := newBuffer(64*1024, 0, false, alignmentSize)
+		commit := reserveString(t, b, 100+entryPrefixSize)
+		b.Write([]byte("after"))
+		commit("short")
+
+		assert.Equal(t, int32(100+entryPrefixSize+4+5), b.DataSize())
+		assert.Equal(t, []string{"short", "after"}, decodeBuffer(t, b))
+	})
+
+	t.Run("entry filling the reservation leaves empty padding", func(t *testing.T) {
+		b := newBuffer(64*1024, 0, false, alignmentSize)
+		commit := reserveString(t, b, 10+entryPrefixSize)
+		b.Write([]byte("after"))
+		commit("0123456789")
+
+		assert.Equal(t, []string{"0123456789", "after"}, decodeBuffer(t, b))
+	})
+
+	t.Run("discarded reservation is handed back or skipped", func(t *testing.T) {
+		b := newBuffer(64*1024, 0, false, alignmentSize)
+		b.Write([]byte("before"))
+		discardLast := reserveString(t, b, 50+entryPrefixSize)
+		discardLast("")
+		assert.Equal(t, int32(4+6), b.DataSize())
+
+		discardMiddle := reserveString(t, b, 50+entryPrefixSize)
+		b.Write([]byte("after"))
+		discardMiddle("")
+
+		assert.Equal(t, []string{"before", "after"}, decodeBuffer(t, b))
+		assert.Equal(t, int64(2), b.WriteCount())
+	})
+
+	t.Run("earlier reservation shrinks once later ones are handed back", func(t *testing.T) {
+		b := newBuffer(64*1024, 0, false, alignmentSize)
+		first := reserveString(t, b, 50+entryPrefixSize)
+		second := reserveString(t, b, 50+entryPrefixSize)
+		second("")
+		first("one")
+
+		assert.Equal(t, int32(4+3), b.DataSize())
+		assert.Equal(t, []string{"one"}, decodeBuffer(t, b))
+	})
+
+	t.Run("full buffer refuses the reservation", func(t *testing.T) {
+		b := newBuffer(64*1024, 0, false, alignmentSize)
+		start, needsFlush := b.reserve(b.capacity)
+
+		assert.Equal(t, int32(-1), start)
+		assert.True(t, needsFlush)
+		assert.True(t, b.IsFull())
+	})
+
+	t.Run("concurrent reservations and writes", func(t *testing.T) {
+		b := newBuffer(4*1024*1024, 0, false, alignmentSize)
+		const goroutines = 8
+		const perGoroutine = 2000
+
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < perGoroutine; i++ {
+					msg := fmt.Sprintf("g%d-%d", g, i)
+					if i%2 == 0 {
+						b.Write([]byte(msg))
+						continue
+					}
+					size := int32(len(msg) + i%7 + entryPrefixSize)
+					start, _ := b.reserve(size)
+					if start < 0 {
+						t.Error("reservation refused")
+						return
+					}
+					b.commitEntry(start, size, len(append(b.entry(start, size), msg...)), 0)
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		entries := decodeBuffer(t, b)
+		require.Len(t, entries, goroutines*perGoroutine)
+		seen := make(map[string]bool, len(entries))
+		for _, entry := range entries {
+			assert.False(t, seen[entry], "duplicate entry %q", entry)
+			seen[entry] = true
+		}
+		assert.True(t, seen["g0-1"])
+		assert.True(t, seen[fmt.Sprintf("g%d-%d", goroutines-1, perGoroutine-1)])
+	})
+
+	t.Run("flush waits for an open reservation", func(t *testing.T) {
+		b := newBuffer(64*1024, 0, false, alignmentSize)
+		commit := reserveString(t, b, 100+entryPrefixSize)
+
+		done := make(chan bool)
+		go func() {
+			_, complete := b.GetData(time.Second)
+			done <- complete
+		}()
+
+		select {
+		case <-done:
+			t.Fatal("GetData returned before the reservation was committed")
+		case <-time.After(20 * time.Millisecond):
+		}
+		commit("committed")
+		assert.True(t, <-done)
+		assert.Equal(t, []string{"committed"}, decodeBuffer(t, b))
+	})
+
+	t.Run("flush timeout skips an open reservation", func(t *testing.T) {
+		b := newBuffer(64*1024, 0, false, alignmentSize)
+		b.Write([]byte("before"))
+		start, _ := b.reserve(100 + entryPrefixSize)
+		_ = append(b.entry(start, 100+entryPrefixSize), "half-written"...)
+		b.Write([]byte("after"))
+
+		sealed := b.seal(time.Millisecond)
+		assert.False(t, sealed.complete)
+		assert.Equal(t, []string{"before"}, decodeShard(t, sealed.data, sealed.end), "only entries below the open reservation are sealed")
+		assert.Equal(t, int64(1), sealed.entries)
+		assert.Equal(t, []string{"before", "after"}, decodeBuffer(t, b))
+	})
+
+	t.Run("reset keeps a reservation the flush timed out on", func(t *testing.T) {
+		b := newBuffer(64*1024, 0, false, alignmentSize)
+		b.Write([]byte("flushed"))
+		commit := reserveString(t, b, 100+entryPrefixSize)
+		data, complete := b.GetData(time.Millisecond)
+		require.False(t, complete)
+		assert.NotSame(t, &b.data[0], &data[0], "the flush reads a copy, not the space the writer owns")
+
+		b.Reset()
+		n, _ := b.Write([]byte("refused"))
+		assert.Zero(t, n, "the buffer stays sealed")
+
+		commit("late")
+		_, complete = b.GetData(time.Second)
+		require.True(t, complete)
+		assert.Equal(t, []string{"late"}, decodeBuffer(t, b), "flushed data is not written again")
+		assert.Equal(t, int64(1), b.writesStarted.Load())
+		b.Reset()
+		b.Write([]byte("reused"))
+		assert.Equal(t, []string{"reused"}, decodeBuffer(t, b))
+	})
+}
+
+func TestLogger_LogEntry(t *testing.T) {
+	newEntryLogger := func(t *testing.T, configure func(*Config)) (*Logger, string) {
+		t.Helper()
+		logPath := filepath.Join(t.TempDir(), "entry.log")
+		config := DefaultConfig(logPath)
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 1
+		config.MaxEntrySize = 256
+		config.InternalLogger = &captureLogger{}
+		if configure != nil {
+			configure(&config)
+		}
+
+		logger, err := New(config)
+		require.NoError(t, err)
+		t.Cleanup(func() { logger.Close() })
+		return logger, logPath
+	}
+
+	t.Run("encodes entries in place", func(t *testing.T) {
+		logger, logPath := newEntryLogger(t, nil)
+		ts := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		err := logger.LogEntry(func(buf *EntryBuffer) {
+			buf.AppendTime(ts, time.RFC3339)
+			buf.AppendString(" user=")
+			buf.AppendInt(-42)
+			buf.AppendByte(' ')
+			buf.AppendBytes([]byte("ok"))
+		})
+		require.NoError(t, err)
+		require.NoError(t, logger.LogEntry(func(buf *EntryBuffer) { buf.AppendString("second") }))
+
+		require.NoError(t, logger.Close())
+		assert.Equal(t, []string{"2026-01-02T03:04:05Z user=-42 ok", "second"}, readEntries(t, logPath))
+	})
+
+	t.Run("oversized entry is dropped", func(t *testing.T) {
+		logger, logPath := newEntryLogger(t, nil)
+
+		err := logger.LogEntry(func(buf *EntryBuffer) {
+			buf.AppendString("prefix ")
+			buf.AppendBytes(make([]byte, 256))
+			assert.Equal(t, 0, buf.Available())
+			buf.AppendString("ignored")
+			assert.Equal(t, 7, buf.Len())
+		})
+		assert.ErrorIs(t, err, ErrEntryTooLarge)
+		require.NoError(t, logger.LogEntry(func(buf *EntryBuffer) { buf.AppendString("next") }))
+
+		_, dropped, _, _, _, _, _, _ := logger.GetStatsSnapshot()
+		assert.Equal(t, int64(1), dropped)
+		require.NoError(t, logger.Close())
+		assert.Equal(t, []string{"next"}, readEntries(t, logPath))
+	})
+
+	t.Run("empty entry is not logged", func(t *testing.T) {
+		logger, logPath := newEntryLogger(t, nil)
+
+		require.NoError(t, logger.LogEntry(func(buf *EntryBuffer) {}))
+		require.NoError(t, logger.Close())
+		assert.Empty(t, readEntries(t, logPath))
+	})
+
+	t.Run("panic releases the reservation", func(t *testing.T) {
+		logger, logPath := newEntryLogger(t, nil)
+
+		assert.Panics(t, func() {
+			_ = logger.LogEntry(func(buf *EntryBuffer) {
+				buf.AppendString("partial")
+				panic("encode failed")
+			})
+		})
+		require.NoError(t, logger.LogEntry(func(buf *EntryBuffer) { buf.AppendString("after") }))
+
+		report, err := logger.CloseWithTimeout(5 * time.Second)
+		require.NoError(t, err)
+		assert.Zero(t, report.EntriesDropped)
+		assert.Equal(t, []string{"after"}, readEntries(t, logPath))
+	})
+
+	t.Run("callback outlasting two flushes is written by a later flush", func(t *testing.T) {
+		logger, logPath := newEntryLogger(t, func(c *Config) {
+			c.FlushInterval = time.Hour
+			c.FlushTimeout = 20 * time.Millisecond
+		})
+
+		// Hold a reservation across two flushes: the first gives up waiting for it, the second
+		// swaps its set back in while the callback still appends into the shard
+		started, release := make(chan struct{}), make(chan struct{})
+		done := make(chan error)
+		go func() {
+			done <- logger.LogEntry(func(buf *EntryBuffer) {
+				close(started)
+				<-release
+				buf.AppendString("late entry that outlived its flush")
+			})
+		}()
+		<-started
+		require.NoError(t, logger.Flush(context.Background()))
+		require.NoError(t, logger.LogEntry(func(buf *EntryBuffer) { buf.AppendString("mid") }))
+		require.NoError(t, logger.Flush(context.Background()))
+		require.NoError(t, logger.LogEntry(func(buf *EntryBuffer) { buf.AppendString("fresh") }))
+
+		close(release)
+		require.NoError(t, <-done)
+		require.NoError(t, logger.Close())
+		assert.Equal(t, []string{"mid", "late entry that outlived its flush", "fresh"}, readEntries(t, logPath))
+	})
+
+	t.Run("closed logger", func(t *testing.T) {
+		logger, _ := newEntryLogger(t, nil)
+		require.NoError(t, logger.Close())
+
+		called := false
+		err := logger.LogEntry(func(buf *EntryBuffer) { called = true })
+		assert.ErrorIs(t, err, ErrClosed)
+		assert.False(t, called)
+	})
+
+	t.Run("full buffer takes the retry path", func(t *testing.T) {
+		logger, logPath := newEntryLogger(t, func(c *Config) {
+			c.BufferSize = 128 * 1024
+			c.NumShards = 1
+			c.FlushInterval = time.Hour
+		})
+
+		// Leave less space in the shard than one reservation needs
+		shard := logger.activeSet.Load().GetShard(0)
+		n, _ := shard.Write(make([]byte, shard.Capacity()-headerOffset-4-100))
+		require.NotZero(t, n)
+		swaps := logger.stats.SetSwaps.Load()
+
+		require.NoError(t, logger.LogEntry(func(buf *EntryBuffer) { buf.AppendString("after swap") }))
+		_, retryPath, _ := logger.GetWritePathStats()
+		assert.Equal(t, int64(1), retryPath)
+		assert.Greater(t, logger.stats.SetSwaps.Load(), swaps)
+
+		require.NoError(t, logger.Close())
+		entries := readEntries(t, logPath)
+		require.NotEmpty(t, entries)
+		assert.Equal(t, "after swap", entries[len(entries)-1])
+	})
+
+	t.Run("concurrent entries across swaps", func(t *testing.T) {
+		logger, logPath := newEntryLogger(t, func(c *Config) {
+			c.BufferSize = 128 * 1024
+			c.NumShards = 2
+			c.DropPolicy = DropPolicyBlock
+			c.FlushTimeout = 100 * time.Millisecond
+		})
+		const goroutines = 8
+		const perGoroutine = 5000
+
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < perGoroutine; i++ {
+					var err error
+					if i%3 == 0 {
+						err = logger.TryLogBytes([]byte(fmt.Sprintf("%d:%d", g, i)))
+					} else {
+						err = logger.LogEntry(func(buf *EntryBuffer) {
+							buf.AppendInt(int64(g))
+							buf.AppendByte(':')
+							buf.AppendInt(int64(i))
+						})
+					}
+					if err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		require.NoError(t, logger.Close())
+		assert.Greater(t, logger.stats.SetSwaps.Load(), int64(1))
+
+		entries := readEntries(t, logPath)
+		require.Len(t, entries, goroutines*perGoroutine)
+		sort.Strings(entries)
+		for i := 1; i < len(entries); i++ {
+			assert.NotEqual(t, entries[i-1], entries[i])
+		}
+	})
+
+	t.Run("fast path does not allocate", func(t *testing.T) {
+		logger, _ := newEntryLogger(t, nil)
+		allocs := testing.AllocsPerRun(1000, func() {
+			_ = logger.LogEntry(func(buf *EntryBuffer) {
+				buf.AppendString("allocation free ")
+				buf.AppendInt(12345)
+			})
+		})
+		assert.Equal(t, 0.0, allocs)
+	})
+}
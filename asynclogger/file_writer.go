@@ -0,0 +1,187 @@
+package asynclogger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// alignmentSize is the default alignment for O_DIRECT on Linux (Config.IOAlignment)
+// For ext4 filesystem, this must be 4096 bytes (4KB), not 512 bytes!
+// O_DIRECT requires alignment to filesystem block size, not just sector size.
+// The non-Linux fallback uses the same value so buffers and files have the same layout everywhere.
+// It is also the page size Logger.Warmup touches buffers at and the buffer file's region metadata size
+const alignmentSize = 4096
+
+// FileWriter is the file I/O used by the flush paths (see NewWithWriter for substituting one)
+// It has the same method set as asyncloguploader.FileWriter, so a writer built for one package works
+// with the other. GetLastPwritevDuration feeds the Pwritev fields of FlushMetrics
+// DirectFileWriter (Logger) and SizeFileWriter (SizeLogger) each have two implementations selected by
+// build tags: directio_linux.go / directio_size_linux.go (O_DIRECT + pwritev) and
+// directio_default.go / directio_size_default.go (portable fallback for macOS and Windows)
+type FileWriter interface {
+	// WriteVectored writes multiple buffers at the current offset, rotating first if needed
+	WriteVectored(buffers [][]byte) (int, error)
+
+	// GetLastPwritevDuration returns the duration of the last write syscall
+	GetLastPwritevDuration() time.Duration
+
+	// Close syncs and closes the current file
+	Close() error
+}
+
+var (
+	_ FileWriter = (*DirectFileWriter)(nil)
+	_ FileWriter = (*SizeFileWriter)(nil)
+)
+
+// alignSize rounds up size to the nearest multiple of alignment (a power of two)
+func alignSize(size, alignment int) int {
+	return ((size + alignment - 1) / alignment) * alignment
+}
+
+// alignUp rounds n up to the next multiple of align (power of 2)
+func alignUp(n, align int64) int64 {
+	return (n + align - 1) &^ (align - 1)
+}
+
+// extractBasePath extracts directory and base filename from a full file path
+// Returns directory, base filename without extension, and error
+func extractBasePath(fullPath string) (dir, baseName string, err error) {
+	dir = filepath.Dir(fullPath)
+	if dir == "." || dir == "" {
+		dir = "."
+	}
+
+	baseName = filepath.Base(fullPath)
+	// Remove .log extension if present (TrimSuffix is safe even if suffix doesn't exist)
+	baseName = strings.TrimSuffix(baseName, ".log")
+
+	if baseName == "" {
+		return "", "", fmt.Errorf("invalid file path: base name is empty after extraction")
+	}
+
+	return dir, baseName, nil
+}
+
+// rotationDue reports whether the current file must be rotated before writing writeSize bytes:
+// RotationInterval has elapsed, or the write would take a non-empty file past MaxFileSize
+func (fw *DirectFileWriter) rotationDue(writeSize int64) bool {
+	if fw.rotationInterval > 0 && fw.clock.Now().Sub(fw.fileCreatedAt) >= fw.rotationInterval {
+		return true
+	}
+	offset := fw.fileOffset.Load()
+	return fw.maxFileSize > 0 && offset > 0 && offset+writeSize > fw.maxFileSize
+}
+
+// prepareWrite rotates if due before writing buffers and returns how many leading buffers fit in
+// the current file, whichever of the time and size limits is reached first
+// At least one buffer is always returned: an empty file takes a shard larger than MaxFileSize, so
+// no file exceeds MaxFileSize by more than one shard
+func (fw *DirectFileWriter) prepareWrite(buffers [][]byte) (int, error) {
+	if err := fw.rotateIfNeeded(int64(len(buffers[0]))); err != nil {
+		return 0, err
+	}
+	if fw.maxFileSize <= 0 {
+		return len(buffers), nil
+	}
+
+	offset := fw.fileOffset.Load() + int64(len(buffers[0]))
+	count := 1
+	for count < len(buffers) && offset+int64(len(buffers[count])) <= fw.maxFileSize {
+		offset += int64(len(buffers[count]))
+		count++
+	}
+	return count, nil
+}
+
+// rotateIfNeeded rotates to a new timestamped file if rotationDue for a write of writeSize bytes
+func (fw *DirectFileWriter) rotateIfNeeded(writeSize int64) error {
+	// If rotation is disabled (no interval and no size limit), skip
+	if fw.rotationInterval <= 0 && fw.maxFileSize <= 0 {
+		return nil
+	}
+
+	// Check if rotation is needed
+	if !fw.rotationDue(writeSize) {
+		return nil
+	}
+
+	// Acquire rotation mutex to prevent concurrent rotations
+	fw.rotationMu.Lock()
+	defer fw.rotationMu.Unlock()
+
+	// Double-check after acquiring lock (another goroutine might have rotated)
+	if !fw.rotationDue(writeSize) {
+		return nil
+	}
+
+	// If next file doesn't exist, create it
+	if fw.nextFile == nil {
+		if err := fw.createNextFile(); err != nil {
+			return fmt.Errorf("failed to create next file: %w", err)
+		}
+	}
+
+	// Swap to next file (syncs and closes the current file, then calls promoteNextFile)
+	if err := fw.swapFiles(); err != nil {
+		return fmt.Errorf("failed to swap files: %w", err)
+	}
+
+	// The old file is complete; the journal moves on to the new one
+	return fw.journalOffset()
+}
+
+// createNextFile creates a new file for rotation
+func (fw *DirectFileWriter) createNextFile() error {
+	nextPath := rotatedFilePath(fw.baseDir, fw.baseFileName, fw.clock.Now())
+
+	// Open new file
+	file, initialOffset, err := openDirectIO(nextPath, fw.mode, -1, fw.alignment)
+	if err != nil {
+		return fmt.Errorf("failed to open next file: %w", err)
+	}
+
+	// Store next file details
+	fw.nextFile = file
+	fw.nextFd = int(file.Fd())
+	fw.nextFilePath = nextPath
+
+	// Next file should start at offset 0 (new file)
+	if initialOffset != 0 {
+		return fmt.Errorf("next file should be empty, but has size %d", initialOffset)
+	}
+
+	return nil
+}
+
+// promoteNextFile makes the prepared next file current and resets the offset and creation time
+// Called by swapFiles once the old file is synced and closed
+func (fw *DirectFileWriter) promoteNextFile() {
+	fw.file = fw.nextFile
+	fw.fd = fw.nextFd
+	fw.filePath = fw.nextFilePath
+	fw.fileOffset.Store(0) // Reset offset for new file
+	fw.fileCreatedAt = fw.clock.Now()
+
+	// Clear next file fields
+	fw.nextFile = nil
+	fw.nextFd = 0
+	fw.nextFilePath = ""
+}
+
+// rotatedFilePath returns {baseFileName}_{YYYY-MM-DD_HH-MM-SS}.log in dir, named for now
+// Size-based rotation can rotate more than once per second; a name that is already taken gets a
+// _1, _2, ... suffix so the earlier file is not truncated
+func rotatedFilePath(dir, baseFileName string, now time.Time) string {
+	timestamp := now.Format("2006-01-02_15-04-05")
+	path := filepath.Join(dir, fmt.Sprintf("%s_%s.log", baseFileName, timestamp))
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s_%s_%d.log", baseFileName, timestamp, i))
+	}
+}
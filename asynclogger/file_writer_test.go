@@ -13,409 +13,576 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func TestNewFileWriter(t *testing.T) {
-	t.Run("creates file writer successfully", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		assert.NotNil(t, fw)
-		assert.Equal(t, logPath, fw.filePath)
-		assert.Equal(t, int64(0), fw.fileOffset.Load())
-		assert.NotNil(t, fw.file)
-		defer fw.Close()
-	})
-
-	t.Run("handles existing file with content", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-
-		// Create file with some content
-		err := os.WriteFile(logPath, []byte("existing content"), 0644)
-		require.NoError(t, err)
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		assert.NotNil(t, fw)
-		// Offset should reflect existing file size
-		assert.Greater(t, fw.fileOffset.Load(), int64(0))
-		defer fw.Close()
-	})
-
-	t.Run("extracts base path correctly", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "subdir", "event1.log")
-		config := DefaultConfig(logPath)
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		assert.Equal(t, filepath.Dir(logPath), fw.baseDir)
-		assert.Equal(t, "event1", fw.baseFileName)
-		defer fw.Close()
-	})
-
-	t.Run("handles relative path", func(t *testing.T) {
-		config := DefaultConfig("test.log")
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		assert.NotNil(t, fw)
-		assert.Equal(t, ".", fw.baseDir)
-		assert.Equal(t, "test", fw.baseFileName)
-		defer fw.Close()
-	})
+// ioModes lists the I/O modes every DirectFileWriter test runs against
+var ioModes = []IOMode{IOModeDirectSync, IOModeDirectAsync, IOModeBuffered}
+
+// writeBlock returns data as the logger hands it to the writer in mode: direct modes write
+// whole aligned blocks, so data is copied to the start of a zero-padded aligned buffer
+func writeBlock(mode IOMode, data []byte) []byte {
+	if mode == IOModeBuffered {
+		return data
+	}
+	block := allocAlignedBuffer(len(data), alignmentSize)
+	copy(block, data)
+	return block
+}
 
-	t.Run("handles file without .log extension", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test")
-		config := DefaultConfig(logPath)
+// fileWriterConfig returns a default config using the given I/O mode
+func fileWriterConfig(logPath string, mode IOMode) Config {
+	config := DefaultConfig(logPath)
+	config.IOMode = mode
+	return config
+}
 
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		assert.NotNil(t, fw)
-		assert.Equal(t, "test", fw.baseFileName)
-		defer fw.Close()
-	})
+func TestNewFileWriter(t *testing.T) {
+	for _, mode := range ioModes {
+		mode := mode
+		t.Run(string(mode), func(t *testing.T) {
+			t.Run("creates file writer successfully", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				assert.NotNil(t, fw)
+				assert.Equal(t, logPath, fw.filePath)
+				assert.Equal(t, int64(0), fw.fileOffset.Load())
+				assert.NotNil(t, fw.file)
+				defer fw.Close()
+			})
+
+			t.Run("handles existing file with content", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+
+				// Create file with some content
+				err := os.WriteFile(logPath, []byte("existing content"), 0644)
+				require.NoError(t, err)
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				assert.NotNil(t, fw)
+				defer fw.Close()
+				if mode == IOModeBuffered {
+					// Offset should reflect existing file size
+					assert.Greater(t, fw.fileOffset.Load(), int64(0))
+				} else {
+					// O_DIRECT writes must start block-aligned, so direct modes truncate
+					assert.Equal(t, int64(0), fw.fileOffset.Load())
+				}
+			})
+
+			t.Run("extracts base path correctly", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "subdir", "event1.log")
+				config := fileWriterConfig(logPath, mode)
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				assert.Equal(t, filepath.Dir(logPath), fw.baseDir)
+				assert.Equal(t, "event1", fw.baseFileName)
+				defer fw.Close()
+			})
+
+			t.Run("handles relative path", func(t *testing.T) {
+				// The file is created in the working directory, so work in a temp dir
+				t.Chdir(t.TempDir())
+				config := fileWriterConfig("test.log", mode)
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				assert.NotNil(t, fw)
+				assert.Equal(t, ".", fw.baseDir)
+				assert.Equal(t, "test", fw.baseFileName)
+				defer fw.Close()
+			})
+
+			t.Run("handles file without .log extension", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test")
+				config := fileWriterConfig(logPath, mode)
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				assert.NotNil(t, fw)
+				assert.Equal(t, "test", fw.baseFileName)
+				defer fw.Close()
+			})
+		})
+	}
 }
 
 func TestFileWriter_WriteVectored(t *testing.T) {
-	t.Run("writes single buffer", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-		config.RotationInterval = 0 // Disable rotation for this test
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		defer fw.Close()
-
-		data := []byte("test data")
-		buffers := [][]byte{data}
-
-		n, err := fw.WriteVectored(buffers)
-		assert.NoError(t, err)
-		assert.Greater(t, n, 0)
-		assert.Equal(t, int64(n), fw.fileOffset.Load())
-	})
-
-	t.Run("writes multiple buffers", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-		config.RotationInterval = 0 // Disable rotation
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		defer fw.Close()
-
-		buffers := [][]byte{
-			[]byte("buffer1"),
-			[]byte("buffer2"),
-			[]byte("buffer3"),
-		}
-
-		n, err := fw.WriteVectored(buffers)
-		assert.NoError(t, err)
-		assert.Greater(t, n, 0)
-		assert.Equal(t, int64(n), fw.fileOffset.Load())
-	})
-
-	t.Run("handles empty buffers", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		defer fw.Close()
-
-		buffers := [][]byte{}
-		n, err := fw.WriteVectored(buffers)
-		assert.NoError(t, err)
-		assert.Equal(t, 0, n)
-	})
-
-	t.Run("tracks offset correctly across multiple writes", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-		config.RotationInterval = 0 // Disable rotation
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		defer fw.Close()
-
-		// First write
-		n1, err := fw.WriteVectored([][]byte{[]byte("first")})
-		require.NoError(t, err)
-		offset1 := fw.fileOffset.Load()
-
-		// Second write
-		n2, err := fw.WriteVectored([][]byte{[]byte("second")})
-		require.NoError(t, err)
-		offset2 := fw.fileOffset.Load()
+	for _, mode := range ioModes {
+		mode := mode
+		t.Run(string(mode), func(t *testing.T) {
+			t.Run("writes single buffer", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = 0 // Disable rotation for this test
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
+
+				data := writeBlock(mode, []byte("test data"))
+				buffers := [][]byte{data}
+
+				n, err := fw.WriteVectored(buffers)
+				assert.NoError(t, err)
+				assert.Greater(t, n, 0)
+				assert.Equal(t, int64(n), fw.fileOffset.Load())
+			})
+
+			t.Run("writes multiple buffers", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = 0 // Disable rotation
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
+
+				buffers := [][]byte{
+					writeBlock(mode, []byte("buffer1")),
+					writeBlock(mode, []byte("buffer2")),
+					writeBlock(mode, []byte("buffer3")),
+				}
 
-		assert.Equal(t, int64(n1), offset1)
-		assert.Equal(t, int64(n1+n2), offset2)
-		assert.Greater(t, offset2, offset1)
-	})
+				n, err := fw.WriteVectored(buffers)
+				assert.NoError(t, err)
+				assert.Greater(t, n, 0)
+				assert.Equal(t, int64(n), fw.fileOffset.Load())
+			})
+
+			t.Run("handles empty buffers", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
+
+				buffers := [][]byte{}
+				n, err := fw.WriteVectored(buffers)
+				assert.NoError(t, err)
+				assert.Equal(t, 0, n)
+			})
+
+			t.Run("tracks offset correctly across multiple writes", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = 0 // Disable rotation
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
+
+				// First write
+				n1, err := fw.WriteVectored([][]byte{writeBlock(mode, []byte("first"))})
+				require.NoError(t, err)
+				offset1 := fw.fileOffset.Load()
+
+				// Second write
+				n2, err := fw.WriteVectored([][]byte{writeBlock(mode, []byte("second"))})
+				require.NoError(t, err)
+				offset2 := fw.fileOffset.Load()
+
+				assert.Equal(t, int64(n1), offset1)
+				assert.Equal(t, int64(n1+n2), offset2)
+				assert.Greater(t, offset2, offset1)
+			})
+		})
+	}
 }
 
 func TestFileWriter_Rotation(t *testing.T) {
-	t.Run("rotates file when interval expires", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-		config.RotationInterval = 100 * time.Millisecond // Very short interval for testing
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		defer fw.Close()
-
-		originalPath := fw.filePath
-
-		// Write initial data
-		_, err = fw.WriteVectored([][]byte{[]byte("initial data")})
-		require.NoError(t, err)
-
-		// Wait for rotation interval
-		time.Sleep(150 * time.Millisecond)
-
-		// Write again - should trigger rotation
-		_, err = fw.WriteVectored([][]byte{[]byte("after rotation")})
-		require.NoError(t, err)
-
-		// File path should have changed (timestamped)
-		assert.NotEqual(t, originalPath, fw.filePath)
-		assert.Contains(t, fw.filePath, "test_")
-		assert.Contains(t, fw.filePath, ".log")
-		assert.True(t, strings.HasSuffix(fw.filePath, ".log"))
-
-		// Offset should be reset for new file
-		assert.Greater(t, fw.fileOffset.Load(), int64(0)) // Should have written "after rotation"
-	})
-
-	t.Run("does not rotate when interval not expired", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-		config.RotationInterval = 1 * time.Hour // Long interval
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		defer fw.Close()
-
-		originalPath := fw.filePath
-
-		// Write multiple times
-		for i := 0; i < 10; i++ {
-			_, err = fw.WriteVectored([][]byte{[]byte("data")})
-			require.NoError(t, err)
-		}
-
-		// Path should not have changed
-		assert.Equal(t, originalPath, fw.filePath)
-	})
+	for _, mode := range ioModes {
+		mode := mode
+		t.Run(string(mode), func(t *testing.T) {
+			t.Run("rotates file when interval expires", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = time.Hour
+				fake := useFakeClock(&config)
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
+
+				originalPath := fw.filePath
+
+				// Write initial data
+				_, err = fw.WriteVectored([][]byte{writeBlock(mode, []byte("initial data"))})
+				require.NoError(t, err)
+
+				// Just short of the interval, then past it
+				fake.Advance(config.RotationInterval - time.Nanosecond)
+				_, err = fw.WriteVectored([][]byte{writeBlock(mode, []byte("before rotation"))})
+				require.NoError(t, err)
+				assert.Equal(t, originalPath, fw.filePath)
+				fake.Advance(time.Nanosecond)
+
+				// Write again - should trigger rotation
+				_, err = fw.WriteVectored([][]byte{writeBlock(mode, []byte("after rotation"))})
+				require.NoError(t, err)
+
+				// File path should have changed (timestamped)
+				assert.NotEqual(t, originalPath, fw.filePath)
+				assert.Contains(t, fw.filePath, "test_")
+				assert.Contains(t, fw.filePath, ".log")
+				assert.True(t, strings.HasSuffix(fw.filePath, ".log"))
+
+				// Offset should be reset for new file
+				assert.Greater(t, fw.fileOffset.Load(), int64(0)) // Should have written "after rotation"
+			})
+
+			t.Run("does not rotate when interval not expired", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = 1 * time.Hour // Long interval
+				fake := useFakeClock(&config)
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
+
+				originalPath := fw.filePath
+
+				// Write multiple times, over most of the interval
+				for i := 0; i < 10; i++ {
+					_, err = fw.WriteVectored([][]byte{writeBlock(mode, []byte("data"))})
+					require.NoError(t, err)
+					fake.Advance(5 * time.Minute)
+				}
 
-	t.Run("rotation disabled when interval is zero", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-		config.RotationInterval = 0 // Disabled
+				// Path should not have changed
+				assert.Equal(t, originalPath, fw.filePath)
+			})
 
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		defer fw.Close()
+			t.Run("rotation disabled when interval is zero", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = 0 // Disabled
+				fake := useFakeClock(&config)
 
-		originalPath := fw.filePath
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
 
-		// Write many times
-		for i := 0; i < 100; i++ {
-			_, err = fw.WriteVectored([][]byte{[]byte("data")})
-			require.NoError(t, err)
-		}
+				originalPath := fw.filePath
 
-		// Path should never change
-		assert.Equal(t, originalPath, fw.filePath)
-	})
+				// Write many times, over days
+				for i := 0; i < 100; i++ {
+					_, err = fw.WriteVectored([][]byte{writeBlock(mode, []byte("data"))})
+					require.NoError(t, err)
+					fake.Advance(time.Hour)
+				}
 
-	t.Run("creates timestamped filename correctly", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "event1.log")
-		config := DefaultConfig(logPath)
-		config.RotationInterval = 50 * time.Millisecond
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		defer fw.Close()
-
-		// Write and wait for rotation
-		_, err = fw.WriteVectored([][]byte{[]byte("data")})
-		require.NoError(t, err)
-		time.Sleep(100 * time.Millisecond)
-		_, err = fw.WriteVectored([][]byte{[]byte("data")})
-		require.NoError(t, err)
-
-		// Check filename format: event1_YYYY-MM-DD_HH-MM-SS.log
-		newPath := fw.filePath
-		assert.Contains(t, newPath, "event1_")
-		assert.Contains(t, newPath, ".log")
-		// Extract timestamp part
-		parts := strings.Split(filepath.Base(newPath), "_")
-		assert.GreaterOrEqual(t, len(parts), 2)
-		assert.Equal(t, "event1", parts[0])
-	})
+				// Path should never change
+				assert.Equal(t, originalPath, fw.filePath)
+			})
+
+			t.Run("creates timestamped filename correctly", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "event1.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = time.Hour
+				fake := useFakeClock(&config)
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
+
+				// Write and rotate
+				_, err = fw.WriteVectored([][]byte{writeBlock(mode, []byte("data"))})
+				require.NoError(t, err)
+				fake.Advance(config.RotationInterval)
+				_, err = fw.WriteVectored([][]byte{writeBlock(mode, []byte("data"))})
+				require.NoError(t, err)
+
+				// Filename format: event1_YYYY-MM-DD_HH-MM-SS.log, at the time of rotation
+				assert.Equal(t, filepath.Join(filepath.Dir(logPath), "event1_2025-03-14_10-26-53.log"), fw.filePath)
+			})
+
+			t.Run("preserves data across rotation", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = time.Hour
+				fake := useFakeClock(&config)
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
+
+				// Write before rotation
+				data1 := writeBlock(mode, []byte("before rotation"))
+				_, err = fw.WriteVectored([][]byte{data1})
+				require.NoError(t, err)
+
+				// Write after rotation
+				fake.Advance(config.RotationInterval)
+				data2 := writeBlock(mode, []byte("after rotation"))
+				_, err = fw.WriteVectored([][]byte{data2})
+				require.NoError(t, err)
+
+				// Both files should exist and contain data
+				// Original file should have first data
+				originalData, err := os.ReadFile(logPath)
+				if err == nil {
+					assert.Contains(t, string(originalData), "before rotation")
+				}
 
-	t.Run("preserves data across rotation", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-		config.RotationInterval = 50 * time.Millisecond
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		defer fw.Close()
-
-		// Write before rotation
-		data1 := []byte("before rotation")
-		_, err = fw.WriteVectored([][]byte{data1})
-		require.NoError(t, err)
-
-		// Wait and write after rotation
-		time.Sleep(100 * time.Millisecond)
-		data2 := []byte("after rotation")
-		_, err = fw.WriteVectored([][]byte{data2})
-		require.NoError(t, err)
-
-		// Both files should exist and contain data
-		// Original file should have first data
-		originalData, err := os.ReadFile(logPath)
-		if err == nil {
-			assert.Contains(t, string(originalData), "before rotation")
-		}
-
-		// New file should have second data
-		newData, err := os.ReadFile(fw.filePath)
-		require.NoError(t, err)
-		assert.Contains(t, string(newData), "after rotation")
-	})
+				// New file should have second data
+				newData, err := os.ReadFile(fw.filePath)
+				require.NoError(t, err)
+				assert.Contains(t, string(newData), "after rotation")
+			})
+
+			t.Run("rotates before a write that would exceed max file size", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = 0
+				config.MaxFileSize = 3 * alignmentSize
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
+
+				shard := allocAlignedBuffer(alignmentSize, alignmentSize)
+				for i := 0; i < 3; i++ {
+					_, err = fw.WriteVectored([][]byte{shard})
+					require.NoError(t, err)
+				}
+				assert.Equal(t, logPath, fw.filePath, "a write that reaches the limit exactly stays in the file")
+
+				// The next shard would exceed MaxFileSize: it goes to a new file
+				_, err = fw.WriteVectored([][]byte{shard})
+				require.NoError(t, err)
+				assert.NotEqual(t, logPath, fw.filePath)
+				assert.Equal(t, int64(alignmentSize), fw.fileOffset.Load(), "offset resets for the new file")
+
+				info, err := os.Stat(logPath)
+				require.NoError(t, err)
+				assert.Equal(t, int64(3*alignmentSize), info.Size())
+			})
+
+			t.Run("splits a flush across files at shard boundaries", func(t *testing.T) {
+				dir := t.TempDir()
+				config := fileWriterConfig(filepath.Join(dir, "test.log"), mode)
+				config.RotationInterval = 0
+				config.MaxFileSize = 2 * alignmentSize
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+
+				// Five shards in one flush: 2 + 2 + 1 across three files
+				shards := make([][]byte, 5)
+				for i := range shards {
+					shards[i] = allocAlignedBuffer(alignmentSize, alignmentSize)
+				}
+				n, err := fw.WriteVectored(shards)
+				require.NoError(t, err)
+				assert.Equal(t, 5*alignmentSize, n)
+				require.NoError(t, fw.Close())
+
+				files, err := filepath.Glob(filepath.Join(dir, "test*.log"))
+				require.NoError(t, err)
+				require.Len(t, files, 3, "same-second rotations must not overwrite each other")
+				var total int64
+				for _, f := range files {
+					info, err := os.Stat(f)
+					require.NoError(t, err)
+					assert.LessOrEqual(t, info.Size(), config.MaxFileSize)
+					total += info.Size()
+				}
+				assert.Equal(t, int64(5*alignmentSize), total)
+			})
+
+			t.Run("empty file takes a shard larger than max file size", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = 0
+				config.MaxFileSize = alignmentSize
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
+
+				_, err = fw.WriteVectored([][]byte{allocAlignedBuffer(2*alignmentSize, alignmentSize)})
+				require.NoError(t, err)
+				assert.Equal(t, logPath, fw.filePath)
+			})
+
+			t.Run("rotates on whichever limit is reached first", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = time.Hour
+				config.MaxFileSize = 2 * alignmentSize
+				fake := useFakeClock(&config)
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
+
+				shard := allocAlignedBuffer(alignmentSize, alignmentSize)
+
+				// Time first: one shard, well under MaxFileSize
+				_, err = fw.WriteVectored([][]byte{shard})
+				require.NoError(t, err)
+				fake.Advance(config.RotationInterval)
+				_, err = fw.WriteVectored([][]byte{shard})
+				require.NoError(t, err)
+				timeRotated := fw.filePath
+				assert.NotEqual(t, logPath, timeRotated)
+
+				// Size next: the interval has just restarted, but the file is full
+				_, err = fw.WriteVectored([][]byte{shard})
+				require.NoError(t, err)
+				assert.Equal(t, timeRotated, fw.filePath)
+				_, err = fw.WriteVectored([][]byte{shard})
+				require.NoError(t, err)
+				assert.NotEqual(t, timeRotated, fw.filePath)
+				assert.Equal(t, int64(alignmentSize), fw.fileOffset.Load())
+			})
+		})
+	}
 }
 
 func TestFileWriter_ConcurrentWrites(t *testing.T) {
-	t.Run("handles concurrent writes correctly", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-		config.RotationInterval = 0 // Disable rotation for simplicity
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		defer fw.Close()
-
-		var wg sync.WaitGroup
-		numGoroutines := 10
-		writesPerGoroutine := 10
-
-		// Concurrent writes
-		for i := 0; i < numGoroutines; i++ {
-			wg.Add(1)
-			go func(id int) {
-				defer wg.Done()
-				for j := 0; j < writesPerGoroutine; j++ {
-					data := []byte{byte(id), byte(j)}
-					_, err := fw.WriteVectored([][]byte{data})
-					assert.NoError(t, err)
+	for _, mode := range ioModes {
+		mode := mode
+		t.Run(string(mode), func(t *testing.T) {
+			t.Run("handles concurrent writes correctly", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = 0 // Disable rotation for simplicity
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
+
+				var wg sync.WaitGroup
+				numGoroutines := 10
+				writesPerGoroutine := 10
+
+				// Concurrent writes
+				for i := 0; i < numGoroutines; i++ {
+					wg.Add(1)
+					go func(id int) {
+						defer wg.Done()
+						for j := 0; j < writesPerGoroutine; j++ {
+							data := writeBlock(mode, []byte{byte(id), byte(j)})
+							_, err := fw.WriteVectored([][]byte{data})
+							assert.NoError(t, err)
+						}
+					}(i)
 				}
-			}(i)
-		}
 
-		wg.Wait()
-
-		// Verify final offset is reasonable (should be sum of all writes)
-		finalOffset := fw.fileOffset.Load()
-		assert.Greater(t, finalOffset, int64(0))
-	})
-
-	t.Run("handles concurrent writes with rotation", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-		config.RotationInterval = 200 * time.Millisecond
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		defer fw.Close()
-
-		var wg sync.WaitGroup
-		numGoroutines := 5
-		writesPerGoroutine := 20
-
-		// Concurrent writes that may trigger rotation
-		for i := 0; i < numGoroutines; i++ {
-			wg.Add(1)
-			go func(id int) {
-				defer wg.Done()
-				for j := 0; j < writesPerGoroutine; j++ {
-					data := []byte{byte(id), byte(j)}
-					_, err := fw.WriteVectored([][]byte{data})
-					assert.NoError(t, err)
-					time.Sleep(10 * time.Millisecond) // Small delay to allow rotation
+				wg.Wait()
+
+				// Verify final offset is reasonable (should be sum of all writes)
+				finalOffset := fw.fileOffset.Load()
+				assert.Greater(t, finalOffset, int64(0))
+			})
+
+			t.Run("handles concurrent writes with rotation", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = 200 * time.Millisecond
+				fake := useFakeClock(&config)
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
+
+				var wg sync.WaitGroup
+				numGoroutines := 5
+				writesPerGoroutine := 20
+
+				// Concurrent writes that may trigger rotation
+				for i := 0; i < numGoroutines; i++ {
+					wg.Add(1)
+					go func(id int) {
+						defer wg.Done()
+						for j := 0; j < writesPerGoroutine; j++ {
+							data := writeBlock(mode, []byte{byte(id), byte(j)})
+							_, err := fw.WriteVectored([][]byte{data})
+							assert.NoError(t, err)
+							fake.Advance(10 * time.Millisecond) // Rotates about every 20 writes
+						}
+					}(i)
 				}
-			}(i)
-		}
 
-		wg.Wait()
+				wg.Wait()
 
-		// Should complete without errors
-		assert.NotNil(t, fw.file)
-	})
+				// Should complete without errors
+				assert.NotNil(t, fw.file)
+			})
+		})
+	}
 }
 
 func TestFileWriter_Close(t *testing.T) {
-	t.Run("closes file successfully", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-
-		// Write some data
-		_, err = fw.WriteVectored([][]byte{[]byte("test")})
-		require.NoError(t, err)
-
-		// Close should succeed
-		err = fw.Close()
-		assert.NoError(t, err)
-
-		// File should exist and be readable
-		data, err := os.ReadFile(logPath)
-		assert.NoError(t, err)
-		assert.Greater(t, len(data), 0)
-	})
-
-	t.Run("closes with next file prepared", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-		config.RotationInterval = 50 * time.Millisecond
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-
-		// Write and trigger rotation preparation
-		_, err = fw.WriteVectored([][]byte{[]byte("data")})
-		require.NoError(t, err)
-		time.Sleep(100 * time.Millisecond)
-		_, err = fw.WriteVectored([][]byte{[]byte("data")})
-		require.NoError(t, err)
-
-		// Close should handle both current and next file
-		err = fw.Close()
-		assert.NoError(t, err)
-	})
-
-	t.Run("handles double close gracefully", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-
-		err = fw.Close()
-		assert.NoError(t, err)
-
-		// Second close should not panic
-		err = fw.Close()
-		// May return error or succeed, but shouldn't panic
-		_ = err
-	})
+	for _, mode := range ioModes {
+		mode := mode
+		t.Run(string(mode), func(t *testing.T) {
+			t.Run("closes file successfully", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+
+				// Write some data
+				_, err = fw.WriteVectored([][]byte{writeBlock(mode, []byte("test"))})
+				require.NoError(t, err)
+
+				// Close should succeed
+				err = fw.Close()
+				assert.NoError(t, err)
+
+				// File should exist and be readable
+				data, err := os.ReadFile(logPath)
+				assert.NoError(t, err)
+				assert.Greater(t, len(data), 0)
+			})
+
+			t.Run("closes with next file prepared", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = time.Hour
+				fake := useFakeClock(&config)
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+
+				// Write and trigger rotation preparation
+				_, err = fw.WriteVectored([][]byte{writeBlock(mode, []byte("data"))})
+				require.NoError(t, err)
+				fake.Advance(config.RotationInterval)
+				_, err = fw.WriteVectored([][]byte{writeBlock(mode, []byte("data"))})
+				require.NoError(t, err)
+
+				// Close should handle both current and next file
+				err = fw.Close()
+				assert.NoError(t, err)
+			})
+
+			t.Run("handles double close gracefully", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+
+				err = fw.Close()
+				assert.NoError(t, err)
+
+				// Second close should not panic
+				err = fw.Close()
+				// May return error or succeed, but shouldn't panic
+				_ = err
+			})
+		})
+	}
 }
 
 func TestExtractBasePath(t *testing.T) {
@@ -449,434 +616,445 @@ func TestExtractBasePath(t *testing.T) {
 }
 
 func TestFileWriter_DataIntegrity(t *testing.T) {
-	t.Run("exact byte matching for single write", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-		config.RotationInterval = 0 // Disable rotation
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		defer fw.Close()
-
-		// Write known data
-		expectedData := []byte("test data for integrity check")
-		n, err := fw.WriteVectored([][]byte{expectedData})
-		require.NoError(t, err)
-		assert.Equal(t, len(expectedData), n)
-
-		// Close to ensure flush
-		err = fw.Close()
-		require.NoError(t, err)
-
-		// Read back and verify exact match
-		actualData, err := os.ReadFile(logPath)
-		require.NoError(t, err)
-		assert.GreaterOrEqual(t, len(actualData), len(expectedData))
-		assert.Equal(t, expectedData, actualData[:len(expectedData)], "written data must match read data exactly")
-	})
+	for _, mode := range ioModes {
+		mode := mode
+		t.Run(string(mode), func(t *testing.T) {
+			t.Run("exact byte matching for single write", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = 0 // Disable rotation
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
+
+				// Write known data
+				expectedData := writeBlock(mode, []byte("test data for integrity check"))
+				n, err := fw.WriteVectored([][]byte{expectedData})
+				require.NoError(t, err)
+				assert.Equal(t, len(expectedData), n)
+
+				// Close to ensure flush
+				err = fw.Close()
+				require.NoError(t, err)
+
+				// Read back and verify exact match
+				actualData, err := os.ReadFile(logPath)
+				require.NoError(t, err)
+				assert.GreaterOrEqual(t, len(actualData), len(expectedData))
+				assert.Equal(t, expectedData, actualData[:len(expectedData)], "written data must match read data exactly")
+			})
+
+			t.Run("exact byte matching for multiple writes", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = 0
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
+
+				// Write multiple chunks
+				chunks := [][]byte{
+					writeBlock(mode, []byte("chunk1")),
+					writeBlock(mode, []byte("chunk2")),
+					writeBlock(mode, []byte("chunk3")),
+				}
+				expectedTotal := make([]byte, 0)
+				for _, chunk := range chunks {
+					expectedTotal = append(expectedTotal, chunk...)
+				}
 
-	t.Run("exact byte matching for multiple writes", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-		config.RotationInterval = 0
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		defer fw.Close()
-
-		// Write multiple chunks
-		chunks := [][]byte{
-			[]byte("chunk1"),
-			[]byte("chunk2"),
-			[]byte("chunk3"),
-		}
-		expectedTotal := make([]byte, 0)
-		for _, chunk := range chunks {
-			expectedTotal = append(expectedTotal, chunk...)
-		}
-
-		// Write all chunks
-		totalWritten := 0
-		for _, chunk := range chunks {
-			n, err := fw.WriteVectored([][]byte{chunk})
-			require.NoError(t, err)
-			totalWritten += n
-		}
-		assert.Equal(t, len(expectedTotal), totalWritten)
-
-		// Close
-		err = fw.Close()
-		require.NoError(t, err)
-
-		// Read back and verify
-		actualData, err := os.ReadFile(logPath)
-		require.NoError(t, err)
-		assert.GreaterOrEqual(t, len(actualData), len(expectedTotal))
-		assert.Equal(t, expectedTotal, actualData[:len(expectedTotal)], "all chunks must match exactly")
-	})
+				// Write all chunks
+				totalWritten := 0
+				for _, chunk := range chunks {
+					n, err := fw.WriteVectored([][]byte{chunk})
+					require.NoError(t, err)
+					totalWritten += n
+				}
+				assert.Equal(t, len(expectedTotal), totalWritten)
+
+				// Close
+				err = fw.Close()
+				require.NoError(t, err)
+
+				// Read back and verify
+				actualData, err := os.ReadFile(logPath)
+				require.NoError(t, err)
+				assert.GreaterOrEqual(t, len(actualData), len(expectedTotal))
+				assert.Equal(t, expectedTotal, actualData[:len(expectedTotal)], "all chunks must match exactly")
+			})
+
+			t.Run("exact byte matching for vectored write", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = 0
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
+
+				// Write multiple buffers in single call
+				buffers := [][]byte{
+					writeBlock(mode, []byte("buffer1")),
+					writeBlock(mode, []byte("buffer2")),
+					writeBlock(mode, []byte("buffer3")),
+				}
+				expectedTotal := make([]byte, 0)
+				for _, buf := range buffers {
+					expectedTotal = append(expectedTotal, buf...)
+				}
 
-	t.Run("exact byte matching for vectored write", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-		config.RotationInterval = 0
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		defer fw.Close()
-
-		// Write multiple buffers in single call
-		buffers := [][]byte{
-			[]byte("buffer1"),
-			[]byte("buffer2"),
-			[]byte("buffer3"),
-		}
-		expectedTotal := make([]byte, 0)
-		for _, buf := range buffers {
-			expectedTotal = append(expectedTotal, buf...)
-		}
-
-		n, err := fw.WriteVectored(buffers)
-		require.NoError(t, err)
-		assert.Equal(t, len(expectedTotal), n)
-
-		// Close
-		err = fw.Close()
-		require.NoError(t, err)
-
-		// Read back and verify
-		actualData, err := os.ReadFile(logPath)
-		require.NoError(t, err)
-		assert.GreaterOrEqual(t, len(actualData), len(expectedTotal))
-		assert.Equal(t, expectedTotal, actualData[:len(expectedTotal)], "vectored write must match exactly")
-	})
+				n, err := fw.WriteVectored(buffers)
+				require.NoError(t, err)
+				assert.Equal(t, len(expectedTotal), n)
+
+				// Close
+				err = fw.Close()
+				require.NoError(t, err)
+
+				// Read back and verify
+				actualData, err := os.ReadFile(logPath)
+				require.NoError(t, err)
+				assert.GreaterOrEqual(t, len(actualData), len(expectedTotal))
+				assert.Equal(t, expectedTotal, actualData[:len(expectedTotal)], "vectored write must match exactly")
+			})
+
+			t.Run("data integrity across rotation", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = time.Hour
+				fake := useFakeClock(&config)
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
+
+				// Write data before rotation
+				data1 := writeBlock(mode, []byte("data before rotation - exact match required"))
+				n1, err := fw.WriteVectored([][]byte{data1})
+				require.NoError(t, err)
+				assert.Equal(t, len(data1), n1)
+
+				originalPath := fw.filePath
+
+				// Rotate
+				fake.Advance(config.RotationInterval)
+
+				// Write data after rotation
+				data2 := writeBlock(mode, []byte("data after rotation - exact match required"))
+				n2, err := fw.WriteVectored([][]byte{data2})
+				require.NoError(t, err)
+				assert.Equal(t, len(data2), n2)
+
+				// Verify rotation occurred
+				assert.NotEqual(t, originalPath, fw.filePath)
+
+				// Close
+				err = fw.Close()
+				require.NoError(t, err)
+
+				// Verify original file has exact data
+				originalData, err := os.ReadFile(originalPath)
+				if err == nil {
+					assert.Contains(t, string(originalData), string(data1))
+					// Find data1 in file and verify exact match
+					idx := strings.Index(string(originalData), string(data1))
+					if idx >= 0 {
+						readData1 := originalData[idx : idx+len(data1)]
+						assert.Equal(t, data1, readData1, "data before rotation must match exactly")
+					}
+				}
 
-	t.Run("data integrity across rotation", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-		config.RotationInterval = 50 * time.Millisecond
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		defer fw.Close()
-
-		// Write data before rotation
-		data1 := []byte("data before rotation - exact match required")
-		n1, err := fw.WriteVectored([][]byte{data1})
-		require.NoError(t, err)
-		assert.Equal(t, len(data1), n1)
-
-		originalPath := fw.filePath
-
-		// Wait for rotation
-		time.Sleep(100 * time.Millisecond)
-
-		// Write data after rotation
-		data2 := []byte("data after rotation - exact match required")
-		n2, err := fw.WriteVectored([][]byte{data2})
-		require.NoError(t, err)
-		assert.Equal(t, len(data2), n2)
-
-		// Verify rotation occurred
-		assert.NotEqual(t, originalPath, fw.filePath)
-
-		// Close
-		err = fw.Close()
-		require.NoError(t, err)
-
-		// Verify original file has exact data
-		originalData, err := os.ReadFile(originalPath)
-		if err == nil {
-			assert.Contains(t, string(originalData), string(data1))
-			// Find data1 in file and verify exact match
-			idx := strings.Index(string(originalData), string(data1))
-			if idx >= 0 {
-				readData1 := originalData[idx : idx+len(data1)]
-				assert.Equal(t, data1, readData1, "data before rotation must match exactly")
-			}
-		}
-
-		// Verify new file has exact data
-		newData, err := os.ReadFile(fw.filePath)
-		require.NoError(t, err)
-		assert.Contains(t, string(newData), string(data2))
-		// Find data2 in file and verify exact match
-		idx := strings.Index(string(newData), string(data2))
-		require.GreaterOrEqual(t, idx, 0, "data2 should be found in new file")
-		readData2 := newData[idx : idx+len(data2)]
-		assert.Equal(t, data2, readData2, "data after rotation must match exactly")
-	})
+				// Verify new file has exact data
+				newData, err := os.ReadFile(fw.filePath)
+				require.NoError(t, err)
+				assert.Contains(t, string(newData), string(data2))
+				// Find data2 in file and verify exact match
+				idx := strings.Index(string(newData), string(data2))
+				require.GreaterOrEqual(t, idx, 0, "data2 should be found in new file")
+				readData2 := newData[idx : idx+len(data2)]
+				assert.Equal(t, data2, readData2, "data after rotation must match exactly")
+			})
+
+			t.Run("offset accuracy matches file size", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = 0
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
+
+				// Write multiple times
+				chunks := [][]byte{
+					writeBlock(mode, []byte("chunk1")),
+					writeBlock(mode, []byte("chunk2")),
+					writeBlock(mode, []byte("chunk3")),
+				}
 
-	t.Run("offset accuracy matches file size", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-		config.RotationInterval = 0
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		defer fw.Close()
-
-		// Write multiple times
-		chunks := [][]byte{
-			[]byte("chunk1"),
-			[]byte("chunk2"),
-			[]byte("chunk3"),
-		}
-
-		totalExpected := 0
-		for _, chunk := range chunks {
-			n, err := fw.WriteVectored([][]byte{chunk})
-			require.NoError(t, err)
-			totalExpected += n
-		}
-
-		// Offset should match total written
-		assert.Equal(t, int64(totalExpected), fw.fileOffset.Load())
-
-		// Close
-		err = fw.Close()
-		require.NoError(t, err)
-
-		// File size should match offset (accounting for alignment padding)
-		fileInfo, err := os.Stat(logPath)
-		require.NoError(t, err)
-		// File size may be larger due to alignment padding, but should be >= offset
-		assert.GreaterOrEqual(t, fileInfo.Size(), int64(totalExpected))
-		// Actual data written should match exactly
-		actualData, err := os.ReadFile(logPath)
-		require.NoError(t, err)
-		// Trim alignment padding - find actual data length
-		actualDataLen := len(actualData)
-		// For non-Linux, data should match exactly (no padding)
-		// For Linux, there may be padding, but actual data should match
-		assert.GreaterOrEqual(t, actualDataLen, totalExpected)
-	})
+				totalExpected := 0
+				for _, chunk := range chunks {
+					n, err := fw.WriteVectored([][]byte{chunk})
+					require.NoError(t, err)
+					totalExpected += n
+				}
 
-	t.Run("concurrent writes preserve data integrity", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-		config.RotationInterval = 0
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		defer fw.Close()
-
-		// Write unique data from multiple goroutines
-		numGoroutines := 10
-		writesPerGoroutine := 5
-		var wg sync.WaitGroup
-		writtenData := make(map[string]bool)
-		var writeErrors []error
-		var mu sync.Mutex
-		totalExpectedBytes := 0
-
-		for i := 0; i < numGoroutines; i++ {
-			wg.Add(1)
-			go func(id int) {
-				defer wg.Done()
-				for j := 0; j < writesPerGoroutine; j++ {
-					// Create unique data
-					data := []byte(fmt.Sprintf("goroutine-%d-write-%d", id, j))
-					n, err := fw.WriteVectored([][]byte{data})
-
-					mu.Lock()
-					if err != nil {
-						writeErrors = append(writeErrors, err)
-					} else {
-						assert.Equal(t, len(data), n)
-						writtenData[string(data)] = true
-						totalExpectedBytes += n
+				// Offset should match total written
+				assert.Equal(t, int64(totalExpected), fw.fileOffset.Load())
+
+				// Close
+				err = fw.Close()
+				require.NoError(t, err)
+
+				// File size should match offset (accounting for alignment padding)
+				fileInfo, err := os.Stat(logPath)
+				require.NoError(t, err)
+				// File size may be larger due to alignment padding, but should be >= offset
+				assert.GreaterOrEqual(t, fileInfo.Size(), int64(totalExpected))
+				// Actual data written should match exactly
+				actualData, err := os.ReadFile(logPath)
+				require.NoError(t, err)
+				// Trim alignment padding - find actual data length
+				actualDataLen := len(actualData)
+				// For non-Linux, data should match exactly (no padding)
+				// For Linux, there may be padding, but actual data should match
+				assert.GreaterOrEqual(t, actualDataLen, totalExpected)
+			})
+
+			t.Run("concurrent writes preserve data integrity", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = 0
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
+
+				// Write unique data from multiple goroutines
+				numGoroutines := 10
+				writesPerGoroutine := 5
+				var wg sync.WaitGroup
+				writtenData := make(map[string]bool)
+				var writeErrors []error
+				var mu sync.Mutex
+				totalExpectedBytes := 0
+
+				for i := 0; i < numGoroutines; i++ {
+					wg.Add(1)
+					go func(id int) {
+						defer wg.Done()
+						for j := 0; j < writesPerGoroutine; j++ {
+							// Create unique data
+							data := writeBlock(mode, []byte(fmt.Sprintf("goroutine-%d-write-%d", id, j)))
+							n, err := fw.WriteVectored([][]byte{data})
+
+							mu.Lock()
+							if err != nil {
+								writeErrors = append(writeErrors, err)
+							} else {
+								assert.Equal(t, len(data), n)
+								writtenData[string(data)] = true
+								totalExpectedBytes += n
+							}
+							mu.Unlock()
+						}
+					}(i)
+				}
+
+				wg.Wait()
+
+				// Verify no write errors
+				mu.Lock()
+				assert.Empty(t, writeErrors, "no write errors should occur")
+				mu.Unlock()
+
+				// Verify offset matches expected total
+				assert.Equal(t, int64(totalExpectedBytes), fw.fileOffset.Load(), "file offset should match total bytes written")
+
+				// Close
+				err = fw.Close()
+				require.NoError(t, err)
+
+				// Read file and verify all data is present
+				fileData, err := os.ReadFile(logPath)
+				require.NoError(t, err)
+
+				// Verify file size is at least expected (may be larger due to alignment)
+				assert.GreaterOrEqual(t, len(fileData), totalExpectedBytes, "file size should be >= total bytes written")
+
+				// Verify all written data is present in file
+				// Note: File may have alignment padding (null bytes), so we search byte-by-byte
+				mu.Lock()
+				missingData := []string{}
+				foundCount := 0
+				for data := range writtenData {
+					// Search for data in file (accounting for possible padding)
+					found := false
+					dataBytes := []byte(data)
+					for i := 0; i <= len(fileData)-len(dataBytes); i++ {
+						match := true
+						for j := 0; j < len(dataBytes); j++ {
+							if fileData[i+j] != dataBytes[j] {
+								match = false
+								break
+							}
+						}
+						if match {
+							found = true
+							foundCount++
+							break
+						}
+					}
+					if !found {
+						missingData = append(missingData, data)
 					}
-					mu.Unlock()
 				}
-			}(i)
-		}
-
-		wg.Wait()
-
-		// Verify no write errors
-		mu.Lock()
-		assert.Empty(t, writeErrors, "no write errors should occur")
-		mu.Unlock()
-
-		// Verify offset matches expected total
-		assert.Equal(t, int64(totalExpectedBytes), fw.fileOffset.Load(), "file offset should match total bytes written")
-
-		// Close
-		err = fw.Close()
-		require.NoError(t, err)
-
-		// Read file and verify all data is present
-		fileData, err := os.ReadFile(logPath)
-		require.NoError(t, err)
-
-		// Verify file size is at least expected (may be larger due to alignment)
-		assert.GreaterOrEqual(t, len(fileData), totalExpectedBytes, "file size should be >= total bytes written")
-
-		// Verify all written data is present in file
-		// Note: File may have alignment padding (null bytes), so we search byte-by-byte
-		mu.Lock()
-		missingData := []string{}
-		foundCount := 0
-		for data := range writtenData {
-			// Search for data in file (accounting for possible padding)
-			found := false
-			dataBytes := []byte(data)
-			for i := 0; i <= len(fileData)-len(dataBytes); i++ {
-				match := true
-				for j := 0; j < len(dataBytes); j++ {
-					if fileData[i+j] != dataBytes[j] {
-						match = false
+				totalWritten := len(writtenData)
+				mu.Unlock()
+
+				// Verify most data is present (allowing for rare race conditions in test)
+				// In production, all data should be present, but tests may have timing issues
+				assert.Greater(t, foundCount, totalWritten*9/10, "at least 90%% of concurrent writes must be present. Found %d/%d", foundCount, totalWritten)
+				if len(missingData) > 0 {
+					t.Logf("Note: %d writes not found (may be due to test timing): %v", len(missingData), missingData[:min(5, len(missingData))])
+				}
+			})
+
+			t.Run("large data integrity", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = 0
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
+
+				// Write large data (1MB)
+				largeData := make([]byte, 1024*1024)
+				for i := range largeData {
+					largeData[i] = byte(i % 256)
+				}
+				largeData = writeBlock(mode, largeData)
+
+				n, err := fw.WriteVectored([][]byte{largeData})
+				require.NoError(t, err)
+				assert.Equal(t, len(largeData), n)
+
+				// Close
+				err = fw.Close()
+				require.NoError(t, err)
+
+				// Read back and verify
+				readData, err := os.ReadFile(logPath)
+				require.NoError(t, err)
+				assert.GreaterOrEqual(t, len(readData), len(largeData))
+
+				// Verify exact match (accounting for possible alignment padding)
+				readDataTrimmed := readData[:len(largeData)]
+				assert.Equal(t, largeData, readDataTrimmed, "large data must match exactly")
+
+				// Verify pattern integrity
+				for i := 0; i < len(largeData); i++ {
+					if readDataTrimmed[i] != largeData[i] {
+						t.Errorf("data mismatch at offset %d: expected %d, got %d", i, largeData[i], readDataTrimmed[i])
 						break
 					}
 				}
-				if match {
-					found = true
-					foundCount++
-					break
+			})
+
+			t.Run("binary data integrity", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = 0
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
+
+				// Write binary data (including null bytes, control chars, etc.)
+				binaryData := []byte{
+					0x00, 0x01, 0x02, 0x03, 0xFF, 0xFE, 0xFD,
+					0x0A, 0x0D, // newline, carriage return
+					0x1B, 0x1F, // escape, unit separator
 				}
-			}
-			if !found {
-				missingData = append(missingData, data)
-			}
-		}
-		totalWritten := len(writtenData)
-		mu.Unlock()
-
-		// Verify most data is present (allowing for rare race conditions in test)
-		// In production, all data should be present, but tests may have timing issues
-		assert.Greater(t, foundCount, totalWritten*9/10, "at least 90%% of concurrent writes must be present. Found %d/%d", foundCount, totalWritten)
-		if len(missingData) > 0 {
-			t.Logf("Note: %d writes not found (may be due to test timing): %v", len(missingData), missingData[:min(5, len(missingData))])
-		}
-	})
+				binaryData = writeBlock(mode, binaryData)
+
+				n, err := fw.WriteVectored([][]byte{binaryData})
+				require.NoError(t, err)
+				assert.Equal(t, len(binaryData), n)
+
+				// Close
+				err = fw.Close()
+				require.NoError(t, err)
+
+				// Read back and verify exact match
+				readData, err := os.ReadFile(logPath)
+				require.NoError(t, err)
+				assert.GreaterOrEqual(t, len(readData), len(binaryData))
+
+				readDataTrimmed := readData[:len(binaryData)]
+				assert.Equal(t, binaryData, readDataTrimmed, "binary data must match exactly byte-by-byte")
+			})
+
+			t.Run("no data corruption during rotation", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = time.Hour
+				fake := useFakeClock(&config)
+
+				fw, err := NewFileWriter(config)
+				require.NoError(t, err)
+				defer fw.Close()
+
+				// Write data before rotation
+				data1 := make([]byte, 1000)
+				for i := range data1 {
+					data1[i] = byte(i % 256)
+				}
+				data1 = writeBlock(mode, data1)
+				n1, err := fw.WriteVectored([][]byte{data1})
+				require.NoError(t, err)
+				assert.Equal(t, len(data1), n1)
 
-	t.Run("large data integrity", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-		config.RotationInterval = 0
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		defer fw.Close()
-
-		// Write large data (1MB)
-		largeData := make([]byte, 1024*1024)
-		for i := range largeData {
-			largeData[i] = byte(i % 256)
-		}
-
-		n, err := fw.WriteVectored([][]byte{largeData})
-		require.NoError(t, err)
-		assert.Equal(t, len(largeData), n)
-
-		// Close
-		err = fw.Close()
-		require.NoError(t, err)
-
-		// Read back and verify
-		readData, err := os.ReadFile(logPath)
-		require.NoError(t, err)
-		assert.GreaterOrEqual(t, len(readData), len(largeData))
-
-		// Verify exact match (accounting for possible alignment padding)
-		readDataTrimmed := readData[:len(largeData)]
-		assert.Equal(t, largeData, readDataTrimmed, "large data must match exactly")
-
-		// Verify pattern integrity
-		for i := 0; i < len(largeData); i++ {
-			if readDataTrimmed[i] != largeData[i] {
-				t.Errorf("data mismatch at offset %d: expected %d, got %d", i, largeData[i], readDataTrimmed[i])
-				break
-			}
-		}
-	})
+				originalPath := fw.filePath
 
-	t.Run("binary data integrity", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-		config.RotationInterval = 0
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		defer fw.Close()
-
-		// Write binary data (including null bytes, control chars, etc.)
-		binaryData := []byte{
-			0x00, 0x01, 0x02, 0x03, 0xFF, 0xFE, 0xFD,
-			0x0A, 0x0D, // newline, carriage return
-			0x1B, 0x1F, // escape, unit separator
-		}
-
-		n, err := fw.WriteVectored([][]byte{binaryData})
-		require.NoError(t, err)
-		assert.Equal(t, len(binaryData), n)
-
-		// Close
-		err = fw.Close()
-		require.NoError(t, err)
-
-		// Read back and verify exact match
-		readData, err := os.ReadFile(logPath)
-		require.NoError(t, err)
-		assert.GreaterOrEqual(t, len(readData), len(binaryData))
-
-		readDataTrimmed := readData[:len(binaryData)]
-		assert.Equal(t, binaryData, readDataTrimmed, "binary data must match exactly byte-by-byte")
-	})
+				// Rotate
+				fake.Advance(config.RotationInterval)
 
-	t.Run("no data corruption during rotation", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-		config.RotationInterval = 50 * time.Millisecond
-
-		fw, err := NewFileWriter(config)
-		require.NoError(t, err)
-		defer fw.Close()
-
-		// Write data before rotation
-		data1 := make([]byte, 1000)
-		for i := range data1 {
-			data1[i] = byte(i % 256)
-		}
-		n1, err := fw.WriteVectored([][]byte{data1})
-		require.NoError(t, err)
-		assert.Equal(t, len(data1), n1)
-
-		originalPath := fw.filePath
-
-		// Wait for rotation
-		time.Sleep(100 * time.Millisecond)
-
-		// Write data after rotation
-		data2 := make([]byte, 1000)
-		for i := range data2 {
-			data2[i] = byte((i + 1000) % 256)
-		}
-		n2, err := fw.WriteVectored([][]byte{data2})
-		require.NoError(t, err)
-		assert.Equal(t, len(data2), n2)
-
-		// Verify rotation occurred
-		assert.NotEqual(t, originalPath, fw.filePath)
-
-		// Close
-		err = fw.Close()
-		require.NoError(t, err)
-
-		// Verify original file has exact data1
-		originalData, err := os.ReadFile(originalPath)
-		if err == nil && len(originalData) >= len(data1) {
-			originalDataTrimmed := originalData[:len(data1)]
-			assert.Equal(t, data1, originalDataTrimmed, "data before rotation must match exactly")
-		}
-
-		// Verify new file has exact data2
-		newData, err := os.ReadFile(fw.filePath)
-		require.NoError(t, err)
-		assert.GreaterOrEqual(t, len(newData), len(data2))
-		newDataTrimmed := newData[:len(data2)]
-		assert.Equal(t, data2, newDataTrimmed, "data after rotation must match exactly")
-	})
+				// Write data after rotation
+				data2 := make([]byte, 1000)
+				for i := range data2 {
+					data2[i] = byte((i + 1000) % 256)
+				}
+				data2 = writeBlock(mode, data2)
+				n2, err := fw.WriteVectored([][]byte{data2})
+				require.NoError(t, err)
+				assert.Equal(t, len(data2), n2)
+
+				// Verify rotation occurred
+				assert.NotEqual(t, originalPath, fw.filePath)
+
+				// Close
+				err = fw.Close()
+				require.NoError(t, err)
+
+				// Verify original file has exact data1
+				originalData, err := os.ReadFile(originalPath)
+				if err == nil && len(originalData) >= len(data1) {
+					originalDataTrimmed := originalData[:len(data1)]
+					assert.Equal(t, data1, originalDataTrimmed, "data before rotation must match exactly")
+				}
+
+				// Verify new file has exact data2
+				newData, err := os.ReadFile(fw.filePath)
+				require.NoError(t, err)
+				assert.GreaterOrEqual(t, len(newData), len(data2))
+				newDataTrimmed := newData[:len(data2)]
+				assert.Equal(t, data2, newDataTrimmed, "data after rotation must match exactly")
+			})
+		})
+	}
 }
 
 func min(a, b int) int {
@@ -887,57 +1065,66 @@ func min(a, b int) int {
 }
 
 func TestFileWriter_IntegrationWithLogger(t *testing.T) {
-	t.Run("logger uses file writer correctly", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-		config.RotationInterval = 0 // Disable rotation for this test
-		config.FlushInterval = 50 * time.Millisecond
-
-		logger, err := New(config)
-		require.NoError(t, err)
-		defer logger.Close()
-
-		// Log some messages
-		logger.Log("message 1")
-		logger.Log("message 2")
-		logger.Log("message 3")
-
-		// Wait for flush
-		time.Sleep(200 * time.Millisecond)
-
-		// Close to ensure flush
-		err = logger.Close()
-		assert.NoError(t, err)
-
-		// Verify file exists and has content
-		_, err = os.Stat(logPath)
-		assert.NoError(t, err)
-	})
-
-	t.Run("logger rotates files correctly", func(t *testing.T) {
-		logPath := filepath.Join(t.TempDir(), "test.log")
-		config := DefaultConfig(logPath)
-		config.RotationInterval = 100 * time.Millisecond
-		config.FlushInterval = 50 * time.Millisecond
-
-		logger, err := New(config)
-		require.NoError(t, err)
-		defer logger.Close()
-
-		// Log messages over time
-		for i := 0; i < 10; i++ {
-			logger.Log("message")
-			time.Sleep(50 * time.Millisecond)
-		}
-
-		// Close
-		err = logger.Close()
-		assert.NoError(t, err)
+	for _, mode := range ioModes {
+		mode := mode
+		t.Run(string(mode), func(t *testing.T) {
+			t.Run("logger uses file writer correctly", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = 0 // Disable rotation for this test
+				config.FlushInterval = 50 * time.Millisecond
+				fake := useFakeClock(&config)
+
+				logger, err := New(config)
+				require.NoError(t, err)
+				defer logger.Close()
+
+				// Log some messages
+				logger.Log("message 1")
+				logger.Log("message 2")
+				logger.Log("message 3")
+
+				// Flush on the next tick
+				fake.Advance(config.FlushInterval)
+				waitForFlushes(t, logger, 1)
+
+				// Close to ensure flush
+				err = logger.Close()
+				assert.NoError(t, err)
+
+				// Verify file exists and has content
+				_, err = os.Stat(logPath)
+				assert.NoError(t, err)
+			})
+
+			t.Run("logger rotates files correctly", func(t *testing.T) {
+				logPath := filepath.Join(t.TempDir(), "test.log")
+				config := fileWriterConfig(logPath, mode)
+				config.RotationInterval = 100 * time.Millisecond
+				config.FlushInterval = 50 * time.Millisecond
+				fake := useFakeClock(&config)
+
+				logger, err := New(config)
+				require.NoError(t, err)
+				defer logger.Close()
+
+				// Log messages over time, flushing on every tick and rotating every other flush
+				for i := 0; i < 10; i++ {
+					logger.Log("message")
+					fake.Advance(config.FlushInterval)
+					waitForFlushes(t, logger, int64(i+1))
+				}
 
-		// Check that rotated files exist
-		dir := filepath.Dir(logPath)
-		files, err := os.ReadDir(dir)
-		assert.NoError(t, err)
-		assert.Greater(t, len(files), 0)
-	})
+				// Close
+				err = logger.Close()
+				assert.NoError(t, err)
+
+				// Check that rotated files exist
+				dir := filepath.Dir(logPath)
+				files, err := os.ReadDir(dir)
+				assert.NoError(t, err)
+				assert.Greater(t, len(files), 1)
+			})
+		})
+	}
 }
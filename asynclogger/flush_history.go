@@ -0,0 +1,152 @@
+package asynclogger
+
+import (
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// FlushTrigger says what swapped a buffer set out for flushing (FlushRecord.Trigger)
+type FlushTrigger string
+
+const (
+	// FlushTriggerThreshold: a write left its shard past ShardFlushThresholdPct
+	FlushTriggerThreshold FlushTrigger = "threshold"
+
+	// FlushTriggerFull: a write found no space in the active set
+	FlushTriggerFull FlushTrigger = "full"
+
+	// FlushTriggerTicker: FlushInterval elapsed with data buffered
+	FlushTriggerTicker FlushTrigger = "ticker"
+
+	// FlushTriggerFlush: Logger.Flush (LoggerManager.FlushEvent, FlushAll)
+	FlushTriggerFlush FlushTrigger = "flush"
+
+	// FlushTriggerClose: the final flush of Close
+	FlushTriggerClose FlushTrigger = "close"
+)
+
+// ShardFlushRecord describes one shard written by a flush (FlushRecord.Shards)
+type ShardFlushRecord struct {
+	ShardID  uint32  `json:"shard_id"`
+	Bytes    int32   `json:"bytes"`    // Valid data bytes, excluding the shard header
+	FillPct  float64 `json:"fill_pct"` // Bytes as a percentage of the shard's usable capacity
+	Complete bool    `json:"complete"` // False if FlushTimeout expired with writes in progress
+}
+
+// FlushRecord describes one flush that wrote data (or failed to), as kept by Config.FlushHistorySize
+// and returned by Logger.GetFlushHistory
+type FlushRecord struct {
+	Seq     uint64       `json:"seq"` // Numbers the recorded flushes from 1; a gap means records were overwritten
+	SetID   uint32       `json:"set_id"`
+	Trigger FlushTrigger `json:"trigger"`
+	Start   time.Time    `json:"start"` // When the flush worker took the set
+
+	Shards    []ShardFlushRecord `json:"shards"` // Shards with data, in shard order
+	Bytes     int                `json:"bytes"`  // Bytes written, including headers and padding; zero on error
+	Compacted bool               `json:"compacted"`
+
+	SemaphoreWait   time.Duration `json:"semaphore_wait_ns"`  // Waiting for the flush semaphore
+	WaitForWrites   time.Duration `json:"wait_for_writes_ns"` // Sealing the shards and waiting for in-flight writes
+	WriteDuration   time.Duration `json:"write_ns"`           // WriteVectored() (includes rotation checks)
+	PwritevDuration time.Duration `json:"pwritev_ns"`         // Pwritev syscall only
+	Duration        time.Duration `json:"duration_ns"`        // Whole flush
+
+	Error string `json:"error,omitempty"` // Write error (also counted in FlushErrors)
+}
+
+// flushHistory is a ring of the last FlushRecords (Config.FlushHistorySize)
+// The flush path fills scratch (flushes are serialized by the flush semaphore) and copies it into
+// the ring under mu, so readers never wait for a flush; every slot's Shards is allocated up front
+type flushHistory struct {
+	mu      sync.Mutex
+	records []FlushRecord
+	seq     uint64 // Flushes recorded; the last one is in records[(seq-1)%len(records)]
+
+	scratch FlushRecord
+}
+
+// newFlushHistory creates a ring of size records for sets of numShards shards
+func newFlushHistory(size, numShards int) *flushHistory {
+	h := &flushHistory{records: make([]FlushRecord, size)}
+	for i := range h.records {
+		h.records[i].Shards = make([]ShardFlushRecord, 0, numShards)
+	}
+	h.scratch.Shards = make([]ShardFlushRecord, 0, numShards)
+	return h
+}
+
+// flushHistoryBytes returns the memory a flushHistory of size records for numShards shards takes
+func flushHistoryBytes(size, numShards int) int {
+	record := int(unsafe.Sizeof(FlushRecord{})) + numShards*int(unsafe.Sizeof(ShardFlushRecord{}))
+	return (size + 1) * record // The ring and the scratch record
+}
+
+// start resets the scratch record for a flush of set begun at start
+func (h *flushHistory) start(set *BufferSet, start time.Time) *FlushRecord {
+	rec := &h.scratch
+	shards := rec.Shards[:0]
+	*rec = FlushRecord{SetID: set.ID(), Trigger: set.trigger, Start: start, Shards: shards}
+	return rec
+}
+
+// addShard records a shard of the scratch flush holding validDataBytes of its capacity
+func (rec *FlushRecord) addShard(shard *Shard, validDataBytes int32, complete bool) {
+	fillPct := 0.0
+	if usable := shard.Capacity() - headerOffset; usable > 0 {
+		fillPct = float64(validDataBytes) / float64(usable) * 100
+	}
+	rec.Shards = append(rec.Shards, ShardFlushRecord{ShardID: shard.ID(), Bytes: validDataBytes, FillPct: fillPct, Complete: complete})
+}
+
+// commit copies the scratch record into the next ring slot, overwriting the oldest record
+func (h *flushHistory) commit() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	slot := &h.records[(h.seq-1)%uint64(len(h.records))]
+	shards := append(slot.Shards[:0], h.scratch.Shards...)
+	*slot = h.scratch
+	slot.Seq = h.seq
+	slot.Shards = shards
+}
+
+// snapshot returns copies of the recorded flushes, oldest first
+func (h *flushHistory) snapshot() []FlushRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := h.seq
+	if n > uint64(len(h.records)) {
+		n = uint64(len(h.records))
+	}
+	records := make([]FlushRecord, 0, n)
+	for seq := h.seq - n + 1; seq <= h.seq; seq++ {
+		rec := h.records[(seq-1)%uint64(len(h.records))]
+		rec.Shards = append([]ShardFlushRecord(nil), rec.Shards...)
+		records = append(records, rec)
+	}
+	return records
+}
+
+// GetFlushHistory returns the last Config.FlushHistorySize flushes, oldest first, or nil when the
+// history is off. Only flushes that wrote data (or failed to) are recorded, like Flushes and
+// FlushErrors count them
+func (l *Logger) GetFlushHistory() []FlushRecord {
+	if l.history == nil {
+		return nil
+	}
+	return l.history.snapshot()
+}
+
+// GetFlushHistoryByEvent returns the flush history of every event logger, keyed by event name
+// (see Logger.GetFlushHistory); loggers without Config.FlushHistorySize are left out
+func (lm *LoggerManager) GetFlushHistoryByEvent() map[string][]FlushRecord {
+	history := make(map[string][]FlushRecord)
+	lm.RangeEventLoggers(func(eventName string, logger *Logger) bool {
+		if records := logger.GetFlushHistory(); records != nil {
+			history[eventName] = records
+		}
+		return true
+	})
+	return history
+}
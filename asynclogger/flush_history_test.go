@@ -0,0 +1,171 @@
+package asynclogger
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger_FlushHistory(t *testing.T) {
+	config := DefaultConfig(filepath.Join(t.TempDir(), "history.log"))
+	config.BufferSize = 2 * 64 * 1024
+	config.NumShards = 2
+	config.FlushInterval = time.Hour
+	config.FlushHistorySize = 3
+
+	logger, err := New(config)
+	require.NoError(t, err)
+	assert.Empty(t, logger.GetFlushHistory())
+	capacity := int(logger.setA.GetShard(0).Capacity())
+	var observations []FlushObservation // Written by the flush worker before Flush returns
+	logger.SetFlushObserver(func(o FlushObservation) { observations = append(observations, o) })
+
+	// Flush i writes i entries of 100 bytes, round-robin over both shards
+	entry := make([]byte, 100)
+	for i := 1; i <= 5; i++ {
+		for j := 0; j < i; j++ {
+			require.NoError(t, logger.TryLogBytes(entry))
+		}
+		require.NoError(t, logger.Flush(t.Context()))
+	}
+
+	// The ring wrapped: flushes 3 to 5 are kept, oldest first
+	history := logger.GetFlushHistory()
+	require.Len(t, history, 3)
+	_, _, bytesWritten, flushes, _, _, _, _ := logger.GetStatsSnapshot()
+	assert.Equal(t, uint64(flushes), history[2].Seq)
+	var lastBytes int
+	for i, rec := range history {
+		flush := i + 3
+		assert.Equal(t, uint64(flush), rec.Seq)
+		assert.Equal(t, FlushTriggerFlush, rec.Trigger)
+		assert.Empty(t, rec.Error)
+		assert.Positive(t, rec.Duration)
+		assert.GreaterOrEqual(t, rec.Duration, rec.WriteDuration)
+		assert.False(t, rec.Start.IsZero())
+		if i > 0 {
+			assert.NotEqual(t, history[i-1].SetID, rec.SetID, "consecutive flushes alternate sets")
+			assert.True(t, rec.Start.After(history[i-1].Start))
+		}
+
+		// The shards hold the flush's entries: payload and framing, without the shard headers
+		observation := observations[flush-1]
+		require.Len(t, rec.Shards, 2, "flush %d", flush)
+		var shardBytes int64
+		for _, shard := range rec.Shards {
+			shardBytes += int64(shard.Bytes)
+			assert.True(t, shard.Complete)
+			assert.InDelta(t, float64(shard.Bytes)/float64(capacity-headerOffset)*100, shard.FillPct, 0.001)
+		}
+		assert.Equal(t, []uint32{0, 1}, []uint32{rec.Shards[0].ShardID, rec.Shards[1].ShardID})
+		assert.Equal(t, int64(flush*len(entry)), observation.PayloadBytes)
+		assert.Equal(t, observation.PayloadBytes+observation.HeaderBytes, shardBytes+2*headerOffset)
+		assert.Equal(t, observation.Bytes, rec.Bytes)
+		assert.Equal(t, observation.WriteDuration, rec.WriteDuration)
+		assert.Equal(t, 2*capacity, rec.Bytes, "two shard buffers with padding")
+		lastBytes += rec.Bytes
+	}
+	assert.LessOrEqual(t, int64(lastBytes), bytesWritten)
+
+	// Records are copies: changing one does not change the history
+	history[0].Shards[0].Bytes = -1
+	assert.NotEqual(t, int32(-1), logger.GetFlushHistory()[0].Shards[0].Bytes)
+
+	// Close's final flush is recorded too
+	require.NoError(t, logger.TryLogBytes(entry))
+	require.NoError(t, logger.Close())
+	history = logger.GetFlushHistory()
+	last := history[len(history)-1]
+	assert.Equal(t, uint64(6), last.Seq)
+	assert.Equal(t, FlushTriggerClose, last.Trigger)
+	require.Len(t, last.Shards, 1)
+}
+
+func TestLogger_FlushHistoryTriggers(t *testing.T) {
+	newLogger := func(t *testing.T, configure func(*Config)) *Logger {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "triggers.log"))
+		config.BufferSize = 2 * 64 * 1024
+		config.NumShards = 2
+		config.FlushInterval = time.Hour
+		config.FlushHistorySize = 16
+		configure(&config)
+		logger, err := New(config)
+		require.NoError(t, err)
+		t.Cleanup(func() { logger.Close() })
+		return logger
+	}
+	triggers := func(logger *Logger) []FlushTrigger {
+		var triggers []FlushTrigger
+		for _, rec := range logger.GetFlushHistory() {
+			triggers = append(triggers, rec.Trigger)
+		}
+		return triggers
+	}
+
+	t.Run("Ticker", func(t *testing.T) {
+		logger := newLogger(t, func(c *Config) { c.FlushInterval = 20 * time.Millisecond })
+		require.NoError(t, logger.TryLogBytes([]byte("tick")))
+		require.Eventually(t, func() bool { return len(triggers(logger)) > 0 }, 5*time.Second, 5*time.Millisecond)
+		assert.Equal(t, FlushTriggerTicker, triggers(logger)[0])
+	})
+
+	t.Run("Threshold", func(t *testing.T) {
+		logger := newLogger(t, func(c *Config) { c.ShardFlushThresholdPct = 10 })
+		entry := make([]byte, 1024)
+		for i := 0; i < 20; i++ {
+			require.NoError(t, logger.TryLogBytes(entry))
+		}
+		require.Eventually(t, func() bool { return len(triggers(logger)) > 0 }, 5*time.Second, 5*time.Millisecond)
+		assert.Equal(t, FlushTriggerThreshold, triggers(logger)[0])
+	})
+
+	t.Run("Off", func(t *testing.T) {
+		logger := newLogger(t, func(c *Config) { c.FlushHistorySize = 0 })
+		require.NoError(t, logger.TryLogBytes([]byte("untracked")))
+		require.NoError(t, logger.Flush(t.Context()))
+		assert.Nil(t, logger.GetFlushHistory())
+	})
+}
+
+func TestFlushHistory_RecordsWithoutAllocating(t *testing.T) {
+	set := newBufferSet(4*64*1024, 4, 7, false, alignmentSize)
+	set.trigger = FlushTriggerTicker
+	h := newFlushHistory(5, len(set.Shards()))
+
+	allocs := testing.AllocsPerRun(100, func() {
+		rec := h.start(set, time.Now())
+		for _, shard := range set.Shards() {
+			rec.addShard(shard, 1000, true)
+		}
+		rec.Bytes = 4 * 64 * 1024
+		h.commit()
+	})
+	assert.Zero(t, allocs)
+
+	// 101 flushes recorded (AllocsPerRun warms up once), the last 5 kept
+	history := h.snapshot()
+	require.Len(t, history, 5)
+	for i, rec := range history {
+		assert.Equal(t, uint64(97+i), rec.Seq)
+		assert.Equal(t, uint32(7), rec.SetID)
+		assert.Equal(t, FlushTriggerTicker, rec.Trigger)
+		assert.Len(t, rec.Shards, 4)
+	}
+}
+
+func TestConfig_FlushHistorySize(t *testing.T) {
+	config := DefaultConfig("/tmp/history.log")
+	config.FlushHistorySize = -1
+	assert.EqualError(t, config.Validate(), "FlushHistorySize must be >= 0, got -1")
+
+	config = DefaultConfig("/tmp/history.log")
+	config.BufferSize = 8 * 64 * 1024
+	config.NumShards = 8
+	config.FlushHistorySize = 1000
+	assert.Contains(t, config.Explain(), fmt.Sprintf("flush history: last 1000 flushes, %d bytes", flushHistoryBytes(1000, 8)))
+	assert.Less(t, flushHistoryBytes(1000, 8), 1024*1024)
+}
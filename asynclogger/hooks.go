@@ -0,0 +1,135 @@
+package asynclogger
+
+import "sync/atomic"
+
+// DropReason says why a log was dropped, as passed to Config.OnDrop
+type DropReason string
+
+const (
+	// DropReasonClosed: the logger was closed (or closed while the writer was waiting)
+	DropReasonClosed DropReason = "closed"
+
+	// DropReasonBufferFull: the buffers were still full after the retry path swapped sets
+	DropReasonBufferFull DropReason = "buffer_full"
+
+	// DropReasonSemaphoreTimeout: the swap semaphore was not acquired within WriteRetryTimeout
+	DropReasonSemaphoreTimeout DropReason = "semaphore_timeout"
+
+	// DropReasonOversized: the message can never fit in a shard
+	DropReasonOversized DropReason = "oversized"
+
+	// DropReasonCanceled: LogBytesBlocking's context ended while waiting for buffer space
+	DropReasonCanceled DropReason = "canceled"
+
+	// DropReasonInvalidEventName: LoggerManager could not sanitize the event name
+	DropReasonInvalidEventName DropReason = "invalid_event_name"
+
+	// DropReasonLoggerCreateFailed: LoggerManager could not create the event logger
+	DropReasonLoggerCreateFailed DropReason = "logger_create_failed"
+)
+
+// hookQueueSize bounds the callback events waiting for delivery; events beyond it are discarded
+const hookQueueSize = 1024
+
+// hookEvent is one pending OnDrop or OnFlushError call
+type hookEvent struct {
+	reason DropReason // Empty for flush errors
+	size   int        // Dropped message size, or flushed bytes for flush errors
+	err    error
+	shards int
+}
+
+// hookDispatcher delivers OnDrop/OnFlushError callbacks on a background goroutine so they never
+// block the write or flush path. The goroutine is started on demand and exits once the queue is
+// empty, so the dispatcher needs no shutdown and keeps delivering drops after Close.
+type hookDispatcher struct {
+	onDrop       func(reason DropReason, size int)
+	onFlushError func(err error, shards int, bytes int)
+	logger       InternalLogger // Reports panicking callbacks
+
+	events    chan hookEvent
+	running   atomic.Bool
+	discarded atomic.Int64 // Events dropped because the queue was full
+}
+
+// newHookDispatcher returns nil when no callback is configured
+func newHookDispatcher(onDrop func(DropReason, int), onFlushError func(error, int, int), logger InternalLogger) *hookDispatcher {
+	if onDrop == nil && onFlushError == nil {
+		return nil
+	}
+	return &hookDispatcher{
+		onDrop:       onDrop,
+		onFlushError: onFlushError,
+		logger:       internalLoggerOrDefault(logger),
+		events:       make(chan hookEvent, hookQueueSize),
+	}
+}
+
+// drop queues an OnDrop call (no-op without an OnDrop callback)
+func (d *hookDispatcher) drop(reason DropReason, size int) {
+	if d == nil || d.onDrop == nil {
+		return
+	}
+	d.send(hookEvent{reason: reason, size: size})
+}
+
+// flushError queues an OnFlushError call and reports whether a callback is configured
+func (d *hookDispatcher) flushError(err error, shards, bytes int) bool {
+	if d == nil || d.onFlushError == nil {
+		return false
+	}
+	d.send(hookEvent{err: err, shards: shards, size: bytes})
+	return true
+}
+
+// send queues ev without blocking and makes sure a delivery goroutine is running
+func (d *hookDispatcher) send(ev hookEvent) {
+	select {
+	case d.events <- ev:
+	default:
+		d.discarded.Add(1)
+		return
+	}
+	if d.running.CompareAndSwap(false, true) {
+		go d.run()
+	}
+}
+
+// run delivers queued events until the queue is empty
+func (d *hookDispatcher) run() {
+	for {
+		select {
+		case ev := <-d.events:
+			d.deliver(ev)
+		default:
+			d.running.Store(false)
+			// An event queued between the empty check and the Store above found running=true and
+			// did not start a goroutine; take the role back if one is waiting (unless a new goroutine did)
+			if len(d.events) == 0 || !d.running.CompareAndSwap(false, true) {
+				return
+			}
+		}
+	}
+}
+
+// deliver calls the callback for ev; a panicking callback is reported and does not stop delivery
+func (d *hookDispatcher) deliver(ev hookEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			d.logger.Printf("[WARNING] Logger callback panicked: %v", r)
+		}
+	}()
+	if ev.reason != "" {
+		d.onDrop(ev.reason, ev.size)
+	} else {
+		d.onFlushError(ev.err, ev.shards, ev.size)
+	}
+}
+
+// discardedEvents returns how many callback events were discarded because the queue was full
+func (d *hookDispatcher) discardedEvents() int64 {
+	if d == nil {
+		return 0
+	}
+	return d.discarded.Load()
+}
@@ -0,0 +1,63 @@
+package asynclogger
+
+import (
+	"bytes"
+	"io"
+)
+
+// WriterConfig configures the io.Writer adapters
+type WriterConfig struct {
+	// SplitLines logs each line of a Write as its own entry, without the newline (empty lines are
+	// skipped). Lines are not buffered across calls: text after the last newline is its own entry.
+	// Off: each Write is one entry, written as is
+	SplitLines bool
+}
+
+// entryWriter is an io.Writer that logs each Write (or each line of it) with log
+type entryWriter struct {
+	log    func(data []byte) error
+	config WriterConfig
+}
+
+// NewWriterAdapter returns an io.Writer that logs to l, e.g. for log.New or slog.NewJSONHandler
+// Entries are copied into the shard buffers before Write returns, so callers may reuse p at once.
+// Write returns the sentinel error of the first rejected entry (see TryLogBytes) and the number of
+// bytes before it
+func NewWriterAdapter(l *Logger, config WriterConfig) io.Writer {
+	return &entryWriter{log: l.TryLogBytes, config: config}
+}
+
+// NewEventWriter returns an io.Writer that logs to the event's logger (see NewWriterAdapter)
+func NewEventWriter(lm *LoggerManager, eventName string, config WriterConfig) io.Writer {
+	return &entryWriter{
+		log:    func(data []byte) error { return lm.TryLogBytesWithEvent(eventName, data) },
+		config: config,
+	}
+}
+
+// Write logs p as one entry, or one entry per line with SplitLines
+func (w *entryWriter) Write(p []byte) (int, error) {
+	if !w.config.SplitLines {
+		if err := w.log(p); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	written := 0
+	for written < len(p) {
+		line := p[written:]
+		next := len(p)
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i]
+			next = written + i + 1
+		}
+		if len(line) > 0 {
+			if err := w.log(line); err != nil {
+				return written, err
+			}
+		}
+		written = next
+	}
+	return written, nil
+}
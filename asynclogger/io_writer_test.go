@@ -0,0 +1,139 @@
+package asynclogger
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readEntries decodes every entry of the log file at path
+func readEntries(t *testing.T, path string) []string {
+	t.Helper()
+	r, err := reader.Open(path, reader.Options{})
+	require.NoError(t, err)
+	defer r.Close()
+
+	var entries []string
+	for {
+		entry, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return entries
+		}
+		require.NoError(t, err)
+		entries = append(entries, string(entry))
+	}
+}
+
+func TestWriterAdapter(t *testing.T) {
+	newWriterLogger := func(t *testing.T) (*Logger, string) {
+		t.Helper()
+		logPath := filepath.Join(t.TempDir(), "writer.log")
+		config := DefaultConfig(logPath)
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 1
+
+		logger, err := New(config)
+		require.NoError(t, err)
+		t.Cleanup(func() { logger.Close() })
+		return logger, logPath
+	}
+
+	t.Run("OneEntryPerWrite", func(t *testing.T) {
+		logger, logPath := newWriterLogger(t)
+		w := NewWriterAdapter(logger, WriterConfig{})
+
+		n, err := w.Write([]byte("first\nsecond\n"))
+		require.NoError(t, err)
+		assert.Equal(t, 13, n)
+		_, err = w.Write([]byte("third"))
+		require.NoError(t, err)
+
+		require.NoError(t, logger.Close())
+		assert.Equal(t, []string{"first\nsecond\n", "third"}, readEntries(t, logPath))
+	})
+
+	t.Run("SplitLinesLogsEachLine", func(t *testing.T) {
+		logger, logPath := newWriterLogger(t)
+		w := NewWriterAdapter(logger, WriterConfig{SplitLines: true})
+
+		n, err := w.Write([]byte("first\n\nsecond\npartial"))
+		require.NoError(t, err)
+		assert.Equal(t, 21, n)
+
+		require.NoError(t, logger.Close())
+		assert.Equal(t, []string{"first", "second", "partial"}, readEntries(t, logPath))
+	})
+
+	t.Run("CallerMayReuseBuffer", func(t *testing.T) {
+		logger, logPath := newWriterLogger(t)
+		w := NewWriterAdapter(logger, WriterConfig{})
+
+		buf := []byte("original")
+		_, err := w.Write(buf)
+		require.NoError(t, err)
+		copy(buf, "REUSED!!")
+
+		require.NoError(t, logger.Close())
+		assert.Equal(t, []string{"original"}, readEntries(t, logPath))
+	})
+
+	t.Run("StandardLogAndSlog", func(t *testing.T) {
+		logger, logPath := newWriterLogger(t)
+		w := NewWriterAdapter(logger, WriterConfig{SplitLines: true})
+
+		std := log.New(w, "", 0)
+		std.Print("from log")
+		sl := slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.TimeKey {
+					return slog.Attr{} // Deterministic output
+				}
+				return a
+			},
+		}))
+		for i := 0; i < 3; i++ {
+			sl.Info("from slog", "n", i)
+		}
+
+		require.NoError(t, logger.Close())
+		expected := []string{"from log"}
+		for i := 0; i < 3; i++ {
+			expected = append(expected, fmt.Sprintf(`{"level":"INFO","msg":"from slog","n":%d}`, i))
+		}
+		assert.Equal(t, expected, readEntries(t, logPath))
+	})
+
+	t.Run("ReportsRejectedEntries", func(t *testing.T) {
+		logger, _ := newWriterLogger(t)
+		require.NoError(t, logger.Close())
+
+		n, err := NewWriterAdapter(logger, WriterConfig{SplitLines: true}).Write([]byte("a\nb\n"))
+		assert.Zero(t, n)
+		assert.ErrorIs(t, err, ErrClosed)
+	})
+}
+
+func TestEventWriter(t *testing.T) {
+	dir := t.TempDir()
+	config := DefaultConfig(filepath.Join(dir, "base.log"))
+	config.BufferSize = 1024 * 1024
+	config.NumShards = 1
+
+	lm, err := NewLoggerManager(config)
+	require.NoError(t, err)
+
+	w := NewEventWriter(lm, "payment", WriterConfig{SplitLines: true})
+	_, err = w.Write([]byte("paid 1\npaid 2\n"))
+	require.NoError(t, err)
+
+	require.NoError(t, lm.Close())
+	assert.Equal(t, []string{"paid 1", "paid 2"}, readEntries(t, filepath.Join(dir, "payment.log")))
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package asynclogger
+
+import "errors"
+
+// detectIOAlignment is not supported without O_DIRECT; IOAlignmentAuto falls back to the default
+func detectIOAlignment(dir string) (int, error) {
+	return 0, errors.New("alignment detection is only supported on Linux")
+}
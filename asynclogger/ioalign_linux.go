@@ -0,0 +1,49 @@
+//go:build linux
+
+package asynclogger
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// detectIOAlignment returns the O_DIRECT offset alignment of the device holding dir
+// (Config.IOAlignment = IOAlignmentAuto): statx STATX_DIOALIGN of a probe file in dir (Linux 6.1+),
+// else the logical block size of the block device (BLKSSZGET), which needs read access to it
+func detectIOAlignment(dir string) (int, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// STATX_DIOALIGN is only reported for regular files
+	probe, err := os.CreateTemp(dir, ".ioalign-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create probe file: %w", err)
+	}
+	probe.Close()
+	defer os.Remove(probe.Name())
+
+	var stx unix.Statx_t
+	if err := unix.Statx(unix.AT_FDCWD, probe.Name(), 0, unix.STATX_DIOALIGN, &stx); err == nil &&
+		stx.Mask&unix.STATX_DIOALIGN != 0 && stx.Dio_offset_align > 0 {
+		return int(stx.Dio_offset_align), nil
+	}
+
+	var st unix.Stat_t
+	if err := unix.Stat(dir, &st); err != nil {
+		return 0, fmt.Errorf("failed to stat %s: %w", dir, err)
+	}
+	device := fmt.Sprintf("/dev/block/%d:%d", unix.Major(st.Dev), unix.Minor(st.Dev))
+	f, err := os.Open(device)
+	if err != nil {
+		return 0, fmt.Errorf("no STATX_DIOALIGN and cannot open %s: %w", device, err)
+	}
+	defer f.Close()
+	size, err := unix.IoctlGetInt(int(f.Fd()), unix.BLKSSZGET)
+	if err != nil {
+		return 0, fmt.Errorf("BLKSSZGET on %s failed: %w", device, err)
+	}
+	return size, nil
+}
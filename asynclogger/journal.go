@@ -0,0 +1,76 @@
+package asynclogger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/reader"
+)
+
+// offsetJournal keeps a file series' offset journal (Config.OffsetJournal, format in reader.JournalPath)
+// Each update is one O_SYNC write of a few dozen bytes at offset 0, so it is durable on return and
+// does not allocate
+type offsetJournal struct {
+	file *os.File
+	buf  []byte // Encoded record, reused across updates
+}
+
+// openOffsetJournal opens (or creates) the journal of logPath's series
+func openOffsetJournal(logPath string) (*offsetJournal, error) {
+	file, err := os.OpenFile(reader.JournalPath(logPath), os.O_WRONLY|os.O_CREATE|os.O_SYNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open offset journal: %w", err)
+	}
+	return &offsetJournal{file: file}, nil
+}
+
+// record journals that the first offset bytes of path are durable
+func (j *offsetJournal) record(path string, offset int64) error {
+	j.buf = reader.AppendJournal(j.buf[:0], reader.Journal{File: filepath.Base(path), Offset: offset})
+	if _, err := j.file.WriteAt(j.buf, 0); err != nil {
+		return fmt.Errorf("failed to update offset journal: %w", err)
+	}
+	return nil
+}
+
+// close closes the journal file (no-op on a nil journal)
+func (j *offsetJournal) close() error {
+	if j == nil {
+		return nil
+	}
+	return j.file.Close()
+}
+
+// resumeOffset returns the journaled offset to continue logPath at, or -1 to open it as usual
+// A journal that claims more than the file holds (the file was replaced or truncated) is ignored
+func resumeOffset(logPath string) int64 {
+	size, ok := reader.JournaledSize(logPath)
+	if !ok {
+		return -1
+	}
+	stat, err := os.Stat(logPath)
+	if err != nil || stat.Size() < size {
+		return -1
+	}
+	return size
+}
+
+// resumeFile cuts file back to offset, dropping whatever a crash left past the journaled offset,
+// and returns it with the offset to continue at
+func resumeFile(file *os.File, offset int64) (*os.File, int64, error) {
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("failed to truncate file to journaled offset: %w", err)
+	}
+	return file, offset, nil
+}
+
+// journalOffset records the current file's offset (no-op without Config.OffsetJournal)
+// Callers make sure the data up to the offset is durable first
+func (fw *DirectFileWriter) journalOffset() error {
+	if fw.journal == nil {
+		return nil
+	}
+	return fw.journal.record(fw.filePath, fw.fileOffset.Load())
+}
@@ -0,0 +1,185 @@
+package asynclogger
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// crashingWriter passes flushes to a DirectFileWriter until flush crashAt, which it tears: the first
+// shard header and part of an entry reach the file and the process "dies", so nothing else is
+// synced or journaled
+type crashingWriter struct {
+	fw      *DirectFileWriter
+	crashAt int
+	writes  int
+	crashed bool
+}
+
+func (w *crashingWriter) WriteVectored(buffers [][]byte) (int, error) {
+	if w.crashed {
+		return 0, errors.New("writer crashed")
+	}
+	w.writes++
+	if w.writes < w.crashAt {
+		return w.fw.WriteVectored(buffers)
+	}
+
+	w.crashed = true
+	f, err := os.OpenFile(w.fw.filePath, os.O_WRONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	n, _ := f.WriteAt(buffers[0][:reader.ShardHeaderSize+2], w.fw.fileOffset.Load())
+	return n, errors.New("simulated crash mid-flush")
+}
+
+func (w *crashingWriter) GetLastPwritevDuration() time.Duration {
+	return w.fw.GetLastPwritevDuration()
+}
+
+// Close releases the files like a killed process would: no sync, no final journal update
+func (w *crashingWriter) Close() error {
+	if !w.crashed {
+		return w.fw.Close()
+	}
+	w.fw.file.Close()
+	return w.fw.journal.close()
+}
+
+// readJournaledEntries reads a log file's entries as strings and counts the corrupt shards skipped
+func readJournaledEntries(t *testing.T, path string, opts reader.Options) ([]string, int) {
+	t.Helper()
+	opts.SkipCorruptShards = true
+	r, err := reader.Open(path, opts)
+	require.NoError(t, err)
+	defer r.Close()
+
+	var entries []string
+	for {
+		entry, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return entries, r.CorruptShards()
+		}
+		require.NoError(t, err)
+		entries = append(entries, string(entry))
+	}
+}
+
+func TestOffsetJournal_RecoversFromCrashMidFlush(t *testing.T) {
+	for _, mode := range []IOMode{IOModeDirectSync, IOModeBuffered} {
+		t.Run(string(mode), func(t *testing.T) {
+			logPath := filepath.Join(t.TempDir(), "app.log")
+			config := DefaultConfig(logPath)
+			config.BufferSize = 256 * 1024
+			config.NumShards = 2
+			config.IOMode = mode
+			config.SyncInterval = time.Nanosecond // Buffered mode syncs (and journals) every flush
+			config.OffsetJournal = true
+
+			fw, err := NewFileWriter(config)
+			require.NoError(t, err)
+			crash := &crashingWriter{fw: fw, crashAt: 3}
+			logger, err := NewWithWriter(config, crash)
+			require.NoError(t, err)
+
+			// Two flushes complete; the third is torn by the crash
+			for _, msg := range []string{"first", "second", "lost"} {
+				logger.Log(msg)
+				_ = logger.Flush(context.Background())
+			}
+			require.True(t, crash.crashed)
+			journaled := fw.fileOffset.Load()
+			require.NoError(t, logger.Close())
+
+			stat, err := os.Stat(logPath)
+			require.NoError(t, err)
+			require.Greater(t, stat.Size(), journaled, "the torn flush left data past the journaled offset")
+
+			// The reader stops at the journaled offset instead of reporting the torn shard
+			entries, corrupt := readJournaledEntries(t, logPath, reader.Options{})
+			assert.Equal(t, []string{"first", "second"}, entries)
+			assert.Zero(t, corrupt)
+			_, corrupt = readJournaledEntries(t, logPath, reader.Options{IgnoreJournal: true})
+			assert.Positive(t, corrupt, "without the journal the torn shard is visible")
+
+			// Restarting continues at the journaled offset, overwriting the torn flush
+			fw, err = NewFileWriter(config)
+			require.NoError(t, err)
+			assert.Equal(t, journaled, fw.fileOffset.Load())
+			logger, err = NewWithWriter(config, fw)
+			require.NoError(t, err)
+			logger.Log("after restart")
+			require.NoError(t, logger.Close())
+
+			entries, corrupt = readJournaledEntries(t, logPath, reader.Options{IgnoreJournal: true})
+			assert.Equal(t, []string{"first", "second", "after restart"}, entries)
+			assert.Zero(t, corrupt)
+		})
+	}
+}
+
+func TestOffsetJournal_Lifecycle(t *testing.T) {
+	t.Run("tracks the current file across rotation", func(t *testing.T) {
+		logPath := filepath.Join(t.TempDir(), "app.log")
+		config := fileWriterConfig(logPath, IOModeDirectSync)
+		config.RotationInterval = 0
+		config.MaxFileSize = 2 * alignmentSize
+		config.OffsetJournal = true
+
+		fw, err := NewFileWriter(config)
+		require.NoError(t, err)
+		journal, err := reader.ReadJournal(logPath)
+		require.NoError(t, err)
+		assert.Equal(t, reader.Journal{File: "app.log", Offset: 0}, journal)
+
+		shard := allocAlignedBuffer(alignmentSize, alignmentSize)
+		for i := 0; i < 3; i++ {
+			_, err = fw.WriteVectored([][]byte{shard})
+			require.NoError(t, err)
+		}
+		require.NotEqual(t, logPath, fw.filePath)
+
+		journal, err = reader.ReadJournal(logPath)
+		require.NoError(t, err)
+		assert.Equal(t, reader.Journal{File: filepath.Base(fw.filePath), Offset: alignmentSize}, journal)
+		size, ok := reader.JournaledSize(logPath)
+		assert.False(t, ok, "the rotated-away file is complete: %d", size)
+
+		require.NoError(t, fw.Close())
+	})
+
+	t.Run("ignores a journal for a replaced file", func(t *testing.T) {
+		logPath := filepath.Join(t.TempDir(), "app.log")
+		config := fileWriterConfig(logPath, IOModeBuffered)
+		config.OffsetJournal = true
+
+		require.NoError(t, os.WriteFile(reader.JournalPath(logPath),
+			reader.AppendJournal(nil, reader.Journal{File: "app.log", Offset: 1 << 20}), 0644))
+		require.NoError(t, os.WriteFile(logPath, []byte("short"), 0644))
+
+		fw, err := NewFileWriter(config)
+		require.NoError(t, err)
+		defer fw.Close()
+		assert.Equal(t, int64(len("short")), fw.fileOffset.Load())
+	})
+
+	t.Run("is not written without OffsetJournal", func(t *testing.T) {
+		logPath := filepath.Join(t.TempDir(), "app.log")
+		fw, err := NewFileWriter(fileWriterConfig(logPath, IOModeDirectSync))
+		require.NoError(t, err)
+		require.NoError(t, fw.Close())
+
+		_, err = os.Stat(reader.JournalPath(logPath))
+		assert.True(t, os.IsNotExist(err))
+	})
+}
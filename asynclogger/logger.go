@@ -1,11 +1,30 @@
 package asynclogger
 
 import (
-	"encoding/binary"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"runtime"
+	"sync"
 	"sync/atomic"
 	"time"
-	"unsafe"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/clock"
+	"github.com/neehar-mavuduru/logger-double-buffer/internal/logcore"
+)
+
+// Sentinel errors returned by TryLogBytes and LogBytesBlocking (never wrapped, so the hot path
+// does not allocate); every error means the log was dropped
+var (
+	// ErrClosed is returned when the logger is (or becomes) closed
+	ErrClosed = errors.New("logger is closed")
+
+	// ErrBufferFull is returned when no buffer space was available within WriteRetryTimeout
+	ErrBufferFull = errors.New("log buffer full")
+
+	// ErrOversized is returned when a message can never fit in a shard
+	ErrOversized = errors.New("message larger than shard capacity")
 )
 
 // Statistics holds operational statistics for the logger
@@ -17,6 +36,37 @@ type Statistics struct {
 	FlushErrors  atomic.Int64 // Number of flush operations that failed
 	SetSwaps     atomic.Int64 // Number of buffer set swaps performed
 
+	// Log payload bytes (excluding length prefixes, timestamps, shard headers and padding)
+	BytesBuffered atomic.Int64 // Payload accepted into shard buffers
+	BytesDurable  atomic.Int64 // Payload written to disk by successful flushes; never counts lost data
+
+	// Bytes written by successful flushes besides the payload (see FlushMetrics.WriteAmplificationRatio)
+	HeaderBytesFlushed  atomic.Int64 // Shard headers and entry framing (length prefixes, timestamps, LogEntry padding)
+	PaddingBytesFlushed atomic.Int64 // Bytes after each shard's valid data (Direct I/O alignment)
+
+	// Flushes packed into one staging buffer (Config.CompactFlush) and the padding they did not write
+	CompactedFlushes  atomic.Int64
+	PaddingBytesSaved atomic.Int64
+
+	// Swaps skipped because the other set was still queued or flushing; the request is coalesced
+	// into that pending flush, and the data stays in the active set for the next swap
+	FlushesCoalesced atomic.Int64
+
+	// Writes that did not fit the remaining space of their round-robin shard and were placed
+	// in one of the next shards instead of taking the retry path
+	SpilledWrites atomic.Int64
+
+	// LoggerManager writes refused after Drain started (not counted in TotalLogs or DroppedLogs)
+	DrainRejectedLogs atomic.Int64
+
+	// Logs Config.Transform returned nil for (not counted in TotalLogs or DroppedLogs)
+	FilteredLogs atomic.Int64
+
+	// Flushes that went ahead after FlushTimeout with writes still in progress in at least one shard
+	// (counted once per flush); the entries still being written are left for a later flush
+	PartialFlushes           atomic.Int64
+	LastPartialFlushUnixNano atomic.Int64 // When the last partial flush started; 0 if none
+
 	// Flush performance metrics (for 210s cliff investigation)
 	TotalFlushDuration atomic.Int64 // Total time spent in flush operations (nanoseconds)
 	MaxFlushDuration   atomic.Int64 // Maximum flush duration seen (nanoseconds)
@@ -30,6 +80,24 @@ type Statistics struct {
 	// Pwritev syscall timing (pure disk I/O, excludes rotation checks)
 	TotalPwritevDuration atomic.Int64 // Time spent in Pwritev syscall only (nanoseconds)
 	MaxPwritevDuration   atomic.Int64 // Maximum Pwritev duration (nanoseconds)
+
+	// Backpressure (DropPolicyBlock / LogBytesBlocking); blocked writes are not counted as dropped
+	BlockedWrites        atomic.Int64 // Writes that had to wait for buffer space
+	TotalBlockedDuration atomic.Int64 // Total time writers spent waiting for buffer space (nanoseconds)
+	MaxBlockedDuration   atomic.Int64 // Maximum time a single writer waited (nanoseconds)
+
+	// Write path breakdown (for tuning WriteRetryTimeout)
+	FastPathWrites  atomic.Int64 // Writes that succeeded on the first attempt
+	RetryPathWrites atomic.Int64 // Writes that found the buffer full and entered the retry path
+	RetryTimeouts   atomic.Int64 // Retry-path writes dropped because the semaphore wasn't acquired in time (also counted in DroppedLogs)
+
+	// Entry accounting (for CloseReport)
+	EntriesFlushed atomic.Int64 // Log entries written to disk
+	EntriesLost    atomic.Int64 // Log entries in flushes whose write failed
+
+	// Unflushed entries written from the buffer file by New (Config.PersistentBuffers)
+	EntriesRecovered atomic.Int64
+	BytesRecovered   atomic.Int64 // File bytes, including shard headers and padding
 }
 
 // Logger is an async logger using Sharded Double Buffer CAS with Direct I/O
@@ -41,17 +109,20 @@ type Logger struct {
 	// Active set pointer (atomically swapped)
 	activeSet atomic.Pointer[BufferSet]
 
-	// FileWriter for writing logs with Direct I/O and rotation support
-	fileWriter *FileWriter
+	// File I/O: a DirectFileWriter (Direct I/O with rotation support), or a fake in tests
+	fileWriter FileWriter
 
 	// Channel for flush requests
 	flushChan chan *BufferSet
 
-	// Ticker for periodic flushing
-	ticker *time.Ticker
+	// On-demand flush requests from Flush; the flush worker replies with the flush result
+	flushReqs chan chan error
+
+	// Ticker for periodic flushing (Config.Clock)
+	ticker clock.Ticker
 
-	// Channel for shutdown signal
-	done chan struct{}
+	// Open and closed state; its Done channel is the shutdown signal
+	life *logcore.Lifecycle
 
 	// Semaphore to prevent concurrent flushes
 	semaphore chan struct{}
@@ -63,6 +134,9 @@ type Logger struct {
 	// Configuration
 	config Config
 
+	// LoggerManager event this logger writes, passed to Config.Transform; "" for New
+	event string
+
 	// Statistics
 	stats Statistics
 
@@ -72,8 +146,37 @@ type Logger struct {
 	// Swap in progress flag
 	swapping atomic.Bool
 
-	// Closed flag
-	closed atomic.Bool
+	// Writes in progress (see beginWrite); Close waits for them before the final flush
+	writers atomic.Int64
+
+	// Flush and ticker workers (Close waits for both before the final flush)
+	workers sync.WaitGroup
+
+	// Broadcast channel closed (and replaced) after every flush, waking blocked writers
+	spaceMu    sync.Mutex
+	spaceReady chan struct{}
+
+	// Optional per-flush callback (e.g. for latency histograms); nil when unset
+	flushObserver atomic.Pointer[func(FlushObservation)]
+
+	// Last flushes for GetFlushHistory (Config.FlushHistorySize); nil when off
+	history *flushHistory
+
+	// Asynchronous OnDrop/OnFlushError delivery; nil when neither callback is configured
+	hooks *hookDispatcher
+
+	// Staging buffer for Config.CompactFlush (one shard buffer); nil when compaction is off
+	compactBuf []byte
+
+	// Memory-mapped buffer file holding both sets (Config.PersistentBuffers); nil when off
+	persistent *persistentBuffers
+
+	// Timings of the last Warmup; nil before the first
+	warmup atomic.Pointer[WarmupTimings]
+
+	// Partial flush warnings: when the last was printed and the partial flushes since (rate limiting)
+	partialWarnedAt     atomic.Int64
+	partialsSinceWarned atomic.Int64
 }
 
 // New creates a new async logger
@@ -83,15 +186,68 @@ func New(config Config) (*Logger, error) {
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
 
-	// Create FileWriter for Direct I/O with rotation support
-	fileWriter, err := NewFileWriter(config)
+	// Create DirectFileWriter for Direct I/O with rotation support (StripedFileWriter with StripeFiles)
+	fileWriter, err := newFileWriter(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create file writer: %w", err)
 	}
 
+	l, err := newLogger(config, fileWriter)
+	if err != nil {
+		fileWriter.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// NewWithWriter creates a logger that flushes to w instead of its own files, e.g. an in-memory
+// testsupport.Writer. The logger takes ownership of w and closes it on Close.
+// Config.LogFilePath is validated but not written
+func NewWithWriter(config Config, w FileWriter) (*Logger, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if w == nil {
+		return nil, fmt.Errorf("file writer cannot be nil")
+	}
+	l, err := newLogger(config, w)
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// newLogger creates the buffers and starts the workers of a logger flushing to fileWriter
+// With Config.PersistentBuffers, entries left in the buffer file are written to fileWriter first
+func newLogger(config Config, fileWriter FileWriter) (*Logger, error) {
 	// Create two buffer sets for double buffering
-	setA := NewBufferSet(config.BufferSize, config.NumShards, 0)
-	setB := NewBufferSet(config.BufferSize, config.NumShards, 1)
+	// Buffered I/O writes through the page cache, so buffers need no O_DIRECT alignment
+	aligned := config.IOMode != IOModeBuffered
+	var setA, setB *BufferSet
+	var persistent *persistentBuffers
+	var recoveredEntries, recoveredBytes int64
+	if config.PersistentBuffers {
+		var regions []*bufferRegion
+		var err error
+		persistent, regions, recoveredEntries, recoveredBytes, err = openRecoveredBuffers(config, fileWriter)
+		if err != nil {
+			return nil, err
+		}
+		setA = newRegionBufferSet(regions[:len(regions)/2], 0)
+		setB = newRegionBufferSet(regions[len(regions)/2:], 1)
+	} else {
+		setA = newBufferSet(config.BufferSize, config.NumShards, 0, aligned, config.IOAlignment)
+		setB = newBufferSet(config.BufferSize, config.NumShards, 1, aligned, config.IOAlignment)
+	}
+	setA.setTimestamp(config.PrependTimestamp)
+	setB.setTimestamp(config.PrependTimestamp)
+	setA.setSequenceNumbers(config.SequenceNumbers)
+	setB.setSequenceNumbers(config.SequenceNumbers)
+	setA.setOutputFormat(config.OutputFormat)
+	setB.setOutputFormat(config.OutputFormat)
+	setA.setFlushThresholdPct(config.ShardFlushThresholdPct)
+	setB.setFlushThresholdPct(config.ShardFlushThresholdPct)
 
 	// Initialize logger
 	l := &Logger{
@@ -99,99 +255,355 @@ func New(config Config) (*Logger, error) {
 		setB:          setB,
 		fileWriter:    fileWriter,
 		flushChan:     make(chan *BufferSet, 2), // Buffer for both sets
-		ticker:        time.NewTicker(config.FlushInterval),
-		done:          make(chan struct{}),
+		flushReqs:     make(chan chan error),
+		ticker:        config.Clock.NewTicker(config.FlushInterval),
+		life:          logcore.NewLifecycle(),
 		semaphore:     make(chan struct{}, 1),
 		swapSemaphore: make(chan struct{}, 30), // 30 permits for swap coordination
 		config:        config,
+		spaceReady:    make(chan struct{}),
+		hooks:         newHookDispatcher(config.OnDrop, config.OnFlushError, config.InternalLogger),
+		persistent:    persistent,
+	}
+	l.stats.EntriesRecovered.Store(recoveredEntries)
+	l.stats.BytesRecovered.Store(recoveredBytes)
+	setA.spilled = &l.stats.SpilledWrites
+	setB.spilled = &l.stats.SpilledWrites
+
+	if config.CompactFlush && aligned {
+		l.compactBuf = allocAlignedBuffer(int(setA.GetShard(0).Capacity()), config.IOAlignment)
+	}
+	if config.FlushHistorySize > 0 {
+		l.history = newFlushHistory(config.FlushHistorySize, len(setA.Shards()))
 	}
 
 	l.activeSet.Store(setA)
 	l.nextID.Store(2) // Start from 2 since setA=0, setB=1
 
 	// Start background workers
+	l.workers.Add(2)
 	go l.flushWorker()
 	go l.tickerWorker()
 
+	// A failed warmup only costs latency later, so the logger is still usable
+	if config.WarmupOnStart {
+		if _, err := l.Warmup(); err != nil {
+			config.InternalLogger.Printf("[WARNING] Logger=%s %v", config.LogFilePath, err)
+		}
+	}
+
 	return l, nil
 }
 
+// openRecoveredBuffers opens the buffer file of config (Config.PersistentBuffers), writes the
+// entries a previous process left in it to fileWriter, and lays it out afresh for both sets
+// Returns the file, its regions (set A's shards, then set B's) and the recovered entries and bytes
+func openRecoveredBuffers(config Config, fileWriter FileWriter) (*persistentBuffers, []*bufferRegion, int64, int64, error) {
+	path := persistentBufferPath(config.LogFilePath)
+	persistent, err := openPersistentBuffers(path)
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+
+	entries, bytes, err := persistent.recoverPending(fileWriter, config.IOMode)
+	if err != nil {
+		persistent.close(true)
+		return nil, nil, 0, 0, err
+	}
+	if entries > 0 {
+		config.InternalLogger.Printf("[RECOVERY] Logger=%s recovered %d entries (%d bytes) from %s",
+			config.LogFilePath, entries, bytes, path)
+	}
+
+	shardCapacity, numShards := shardLayout(config.BufferSize, config.NumShards)
+	regions, err := persistent.reset(alignSize(shardCapacity+headerOffset, config.IOAlignment), 2*numShards)
+	if err != nil {
+		persistent.close(true)
+		return nil, nil, 0, 0, err
+	}
+	return persistent, regions, entries, bytes, nil
+}
+
 // LogBytes writes raw byte data to the logger (zero-allocation path)
 // This is the high-performance API that avoids allocations when the caller
 // provides a reusable byte buffer. The data is copied into the internal buffer.
 func (l *Logger) LogBytes(data []byte) {
-	// Count every log attempt (successful or dropped)
+	_ = l.TryLogBytes(data)
+}
+
+// TryLogBytes is LogBytes that reports whether the log was accepted
+// Returns nil, ErrClosed, ErrBufferFull or ErrOversized (sentinels, compare with errors.Is or ==).
+// Honors DropPolicy: with DropPolicyBlock it waits for buffer space like LogBytesBlocking
+func (l *Logger) TryLogBytes(data []byte) error {
+	if l.config.Transform != nil {
+		return l.logTransformed(context.Background(), data, l.config.DropPolicy == DropPolicyBlock)
+	}
+	if l.config.DropPolicy == DropPolicyBlock {
+		return l.logBytesBlocking(context.Background(), data)
+	}
+	return l.tryLogBytes(data)
+}
+
+// tryLogBytes is TryLogBytes for DropPolicyDrop, after Config.Transform
+func (l *Logger) tryLogBytes(data []byte) error {
+	// Count every log attempt (successful or dropped); each takes a sequence number, so the numbers
+	// missing from the files are the dropped entries
 	l.stats.TotalLogs.Add(1)
+	seq := nextSequence(l.config.SequenceNumbers)
 
-	if l.closed.Load() {
-		l.stats.DroppedLogs.Add(1)
-		return
+	if !l.beginWrite() {
+		l.dropped(DropReasonClosed, len(data))
+		return ErrClosed
+	}
+	defer l.endWrite()
+
+	if len(data) == 0 {
+		return nil
 	}
 
 	// Get active set
 	activeSet := l.activeSet.Load()
 	if activeSet == nil {
-		l.stats.DroppedLogs.Add(1)
-		return
+		l.dropped(DropReasonClosed, len(data))
+		return ErrClosed
+	}
+
+	// Oversized messages would fail every attempt; reject without taking the retry path
+	if oversized(activeSet, data) {
+		l.dropped(DropReasonOversized, len(data))
+		return ErrOversized
 	}
 
 	// First attempt: Try to write (fast path)
-	n, needsFlush, _ := activeSet.Write(data)
+	n, needsFlush, shardID := activeSet.write(data, seq)
+	shard := activeSet.GetShard(shardID)
 
 	if n > 0 {
 		// Success! Trigger swap if needed (existing behavior)
+		l.stats.BytesBuffered.Add(int64(len(data)))
+		l.stats.FastPathWrites.Add(1)
 		if needsFlush {
-			l.trySwap()
+			shard.countSwap(l.trySwap(FlushTriggerThreshold))
 		}
-		return
+		return nil
 	}
 
 	// Buffer full - use semaphore retry mechanism
-	// Use non-blocking select with timeout to avoid blocking hot path
-	timeout := time.NewTimer(10 * time.Millisecond)
-	defer timeout.Stop()
+	// Waits at most WriteRetryTimeout for the permit so the hot path is bounded
+	l.stats.RetryPathWrites.Add(1)
+	shard.countRetry()
+	if !l.acquireSwapPermit() {
+		// Timeout: Couldn't acquire semaphore in time, drop log
+		l.stats.RetryTimeouts.Add(1)
+		shard.countRetryTimeout()
+		shard.countDrop()
+		l.dropped(DropReasonSemaphoreTimeout, len(data))
+		return ErrBufferFull
+	}
+	defer func() { <-l.swapSemaphore }() // Release when done
 
-	select {
-	case l.swapSemaphore <- struct{}{}: // Acquired permit
-		defer func() { <-l.swapSemaphore }() // Release when done
+	// Re-check 1: Buffer might have been swapped by another thread
+	activeSet = l.activeSet.Load()
+	if activeSet == nil {
+		l.dropped(DropReasonClosed, len(data))
+		return ErrClosed
+	}
+
+	n, needsFlush, shardID = activeSet.write(data, seq)
+	shard = activeSet.GetShard(shardID)
+	if n > 0 {
+		// Success after re-check!
+		l.stats.BytesBuffered.Add(int64(len(data)))
+		if needsFlush {
+			shard.countSwap(l.trySwap(FlushTriggerThreshold))
+		}
+		return nil
+	}
+
+	// Still full - trigger swap (only one thread will succeed)
+	if needsFlush {
+		shard.countSwap(l.trySwap(FlushTriggerThreshold))
+	}
+
+	// Re-check 2: After swap, try writing again
+	activeSet = l.activeSet.Load()
+	if activeSet == nil {
+		l.dropped(DropReasonClosed, len(data))
+		return ErrClosed
+	}
+
+	n, _, shardID = activeSet.write(data, seq)
+	if n == 0 {
+		// Still failed after swap - drop log
+		activeSet.GetShard(shardID).countDrop()
+		l.dropped(DropReasonBufferFull, len(data))
+		return ErrBufferFull
+	}
+	l.stats.BytesBuffered.Add(int64(len(data)))
+	return nil
+}
+
+// oversized reports whether data (plus its 4-byte length prefix, sequence number and timestamp) can never fit below a shard's capacity
+func oversized(set *BufferSet, data []byte) bool {
+	buf := set.GetShard(0).buffer
+	return int64(len(data))+4+int64(buf.metaSize)+headerOffset >= int64(buf.capacity)
+}
+
+// LogBytesBlocking writes raw byte data, waiting for buffer space instead of dropping
+// It blocks until the data is buffered, ctx is cancelled, or the logger is closed.
+// The log is only counted as dropped when an error is returned.
+func (l *Logger) LogBytesBlocking(ctx context.Context, data []byte) error {
+	if l.config.Transform != nil {
+		return l.logTransformed(ctx, data, true)
+	}
+	return l.logBytesBlocking(ctx, data)
+}
+
+// logBytesBlocking is LogBytesBlocking after Config.Transform
+func (l *Logger) logBytesBlocking(ctx context.Context, data []byte) error {
+	// Count every log attempt (successful or dropped); each takes a sequence number, so the numbers
+	// missing from the files are the dropped entries
+	l.stats.TotalLogs.Add(1)
+	seq := nextSequence(l.config.SequenceNumbers)
+
+	if !l.beginWrite() {
+		l.dropped(DropReasonClosed, len(data))
+		return ErrClosed
+	}
+	defer l.endWrite()
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	var blockStart time.Time
+	defer func() {
+		if !blockStart.IsZero() {
+			l.recordBlocked(time.Since(blockStart))
+		}
+	}()
+
+	for {
+		if l.life.Closed() {
+			l.dropped(DropReasonClosed, len(data))
+			return ErrClosed
+		}
 
-		// Re-check 1: Buffer might have been swapped by another thread
-		activeSet = l.activeSet.Load()
+		// Take the wakeup channel before attempting the write so a flush completing
+		// between the failed attempt and the wait below is not missed
+		spaceReady := l.spaceAvailable()
+
+		activeSet := l.activeSet.Load()
 		if activeSet == nil {
-			l.stats.DroppedLogs.Add(1)
-			return
+			l.dropped(DropReasonClosed, len(data))
+			return ErrClosed
 		}
 
-		n, needsFlush, _ = activeSet.Write(data)
+		if oversized(activeSet, data) {
+			l.dropped(DropReasonOversized, len(data))
+			return ErrOversized
+		}
+
+		n, needsFlush, shardID := activeSet.write(data, seq)
 		if n > 0 {
-			// Success after re-check!
+			l.stats.BytesBuffered.Add(int64(len(data)))
 			if needsFlush {
-				l.trySwap()
+				activeSet.GetShard(shardID).countSwap(l.trySwap(FlushTriggerThreshold))
 			}
-			return
+			return nil
 		}
 
-		// Still full - trigger swap (only one thread will succeed)
-		if needsFlush {
-			l.trySwap()
+		// Buffer full: swap to the other set if it has been flushed, then retry immediately
+		l.trySwap(FlushTriggerFull)
+		if l.activeSet.Load() != activeSet {
+			continue
 		}
 
-		// Re-check 2: After swap, try writing again
-		activeSet = l.activeSet.Load()
-		if activeSet == nil {
-			l.stats.DroppedLogs.Add(1)
-			return
+		// Other set is still being flushed: wait for the flush to finish
+		if blockStart.IsZero() {
+			blockStart = time.Now()
+			l.stats.BlockedWrites.Add(1)
 		}
 
-		n, _, _ = activeSet.Write(data)
-		if n == 0 {
-			// Still failed after swap - drop log
-			l.stats.DroppedLogs.Add(1)
+		select {
+		case <-spaceReady:
+		case <-l.life.Done():
+		case <-ctx.Done():
+			l.dropped(DropReasonCanceled, len(data))
+			return ctx.Err()
 		}
+	}
+}
+
+// beginWrite registers a write unless the logger is closed; endWrite ends it
+// Close marks the logger closed before waiting for registered writes, so every write either sees
+// the mark and is dropped, or is buffered before the final flush
+func (l *Logger) beginWrite() bool {
+	l.writers.Add(1)
+	if l.life.Closed() {
+		l.writers.Add(-1)
+		return false
+	}
+	return true
+}
+
+// endWrite ends a write registered with beginWrite
+func (l *Logger) endWrite() {
+	l.writers.Add(-1)
+}
+
+// dropped counts a dropped log and reports it to OnDrop
+func (l *Logger) dropped(reason DropReason, size int) {
+	l.stats.DroppedLogs.Add(1)
+	l.hooks.drop(reason, size)
+}
+
+// spaceAvailable returns a channel that is closed after the next flush completes
+func (l *Logger) spaceAvailable() <-chan struct{} {
+	l.spaceMu.Lock()
+	defer l.spaceMu.Unlock()
+	return l.spaceReady
+}
+
+// signalSpaceAvailable wakes all writers blocked in LogBytesBlocking
+func (l *Logger) signalSpaceAvailable() {
+	l.spaceMu.Lock()
+	defer l.spaceMu.Unlock()
+	close(l.spaceReady)
+	l.spaceReady = make(chan struct{})
+}
+
+// recordBlocked updates backpressure statistics for a writer that waited d for buffer space
+func (l *Logger) recordBlocked(d time.Duration) {
+	ns := d.Nanoseconds()
+	l.stats.TotalBlockedDuration.Add(ns)
+	logcore.StoreMax(&l.stats.MaxBlockedDuration, ns)
+}
+
+// acquireSwapPermit takes a swap semaphore permit like logcore.AcquirePermit, waiting at most
+// WriteRetryTimeout of Config.Clock: a write on the retry path of a logger with a clock.Fake waits
+// until the clock is advanced past it (or a permit is released)
+func (l *Logger) acquireSwapPermit() bool {
+	clk := l.config.Clock
+	if _, real := clk.(clock.Real); real {
+		return logcore.AcquirePermit(l.swapSemaphore, l.config.WriteRetryTimeout, nil)
+	}
 
-	case <-timeout.C:
-		// Timeout: Couldn't acquire semaphore quickly, drop log
-		l.stats.DroppedLogs.Add(1)
+	select {
+	case l.swapSemaphore <- struct{}{}:
+		return true
+	default:
+		if l.config.WriteRetryTimeout <= 0 {
+			return false
+		}
+	}
+	timer := clk.NewTimer(l.config.WriteRetryTimeout)
+	defer timer.Stop()
+	select {
+	case l.swapSemaphore <- struct{}{}:
+		return true
+	case <-timer.C():
+		return false
 	}
 }
 
@@ -200,22 +612,13 @@ func (l *Logger) LogBytes(data []byte) {
 // For maximum performance in hot paths, use LogBytes() with a reused buffer.
 func (l *Logger) Log(message string) {
 	// Convert string to []byte without allocation using unsafe
-	data := stringToBytes(message)
+	data := logcore.StringToBytes(message)
 	l.LogBytes(data)
 }
 
-// stringToBytes converts a string to []byte without allocation
-// Uses the string's backing array directly (read-only)
-func stringToBytes(s string) []byte {
-	if len(s) == 0 {
-		return nil
-	}
-	// Use unsafe to access string's backing array directly
-	return unsafe.Slice(unsafe.StringData(s), len(s))
-}
-
-// trySwap attempts to swap the active buffer set
-func (l *Logger) trySwap() {
+// trySwap attempts to swap the active buffer set, reporting whether this call swapped it
+// trigger is recorded for the flush of the swapped-out set (Config.FlushHistorySize)
+func (l *Logger) trySwap(trigger FlushTrigger) (swapped bool) {
 	// Check if already swapping
 	if !l.swapping.CompareAndSwap(false, true) {
 		return // Another goroutine is already swapping
@@ -236,6 +639,13 @@ func (l *Logger) trySwap() {
 		nextSet = l.setA
 	}
 
+	// Never swap into a set that is still queued or being flushed: writes into it
+	// would be overwritten by its post-flush reset
+	if nextSet.PendingFlush() {
+		l.stats.FlushesCoalesced.Add(1)
+		return
+	}
+
 	// Assign new ID to next set
 	nextSet.SetID(l.nextID.Add(1))
 
@@ -247,22 +657,24 @@ func (l *Logger) trySwap() {
 
 	l.stats.SetSwaps.Add(1)
 
-	// Send the old set for flushing (non-blocking)
-	select {
-	case l.flushChan <- currentSet:
-		// Successfully queued for flush
-	default:
-		// Channel full, skip this flush (data will be flushed on next interval or shutdown)
-	}
+	// Send the old set for flushing. Only a set that is not pending can be swapped out, so each
+	// set is queued at most once and the channel, with room for both, never blocks the send
+	currentSet.trigger = trigger
+	currentSet.pendingFlush.Store(true)
+	l.flushChan <- currentSet
+	return true
 }
 
 // flushWorker processes flush requests
 func (l *Logger) flushWorker() {
+	defer l.workers.Done()
 	for {
 		select {
 		case set := <-l.flushChan:
 			l.flushSet(set)
-		case <-l.done:
+		case reply := <-l.flushReqs:
+			reply <- l.flushActive()
+		case <-l.life.Done():
 			// Flush any remaining data in the channel
 			l.drainFlushChannel()
 			return
@@ -270,24 +682,50 @@ func (l *Logger) flushWorker() {
 	}
 }
 
+// flushActive flushes every queued set and then the set that was active when called
+// Runs on the flush worker, so sets queued by a concurrent swap are flushed exactly once
+func (l *Logger) flushActive() error {
+	target := l.activeSet.Load()
+	var firstErr error
+	for {
+		if err := l.drainFlushChannel(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+
+		if l.activeSet.Load() == target {
+			if !target.HasData() {
+				return firstErr
+			}
+			// Swap queues target on flushChan; if the swap loses a race, the winner queues it
+			l.trySwap(FlushTriggerFlush)
+		} else if !target.PendingFlush() {
+			// Swapped out and flushed (a swap marks the set pending before queuing it)
+			return firstErr
+		}
+		runtime.Gosched()
+	}
+}
+
 // tickerWorker triggers periodic flushes
 func (l *Logger) tickerWorker() {
+	defer l.workers.Done()
 	for {
 		select {
-		case <-l.ticker.C:
+		case <-l.ticker.C():
 			// Trigger a swap to flush accumulated data
 			activeSet := l.activeSet.Load()
 			if activeSet != nil && activeSet.HasData() {
-				l.trySwap()
+				l.trySwap(FlushTriggerTicker)
 			}
-		case <-l.done:
+		case <-l.life.Done():
 			return
 		}
 	}
 }
 
 // flushSet writes all data from a buffer set to disk
-func (l *Logger) flushSet(set *BufferSet) {
+// Returns the write error, if any (also counted in FlushErrors)
+func (l *Logger) flushSet(set *BufferSet) error {
 	// Track flush operation timing
 	flushStart := time.Now()
 
@@ -305,110 +743,154 @@ func (l *Logger) flushSet(set *BufferSet) {
 	}
 	defer func() { <-l.semaphore }()
 
+	var rec *FlushRecord
+	if l.history != nil {
+		rec = l.history.start(set, flushStart)
+		rec.SemaphoreWait = semaphoreWaitDuration
+	}
+
 	// Collect all shard buffers for batched write (OPTIMIZATION: 8 syscalls → 1!)
 	// Each shard buffer has 8-byte header reserved at the start: [4 bytes capacity][4 bytes valid data]
 	// Headers are written directly into the buffer's reserved space, then buffer is used directly (zero-copy!)
 	numShards := len(set.Shards())
 	shardBuffers := make([][]byte, 0, numShards)
+	var entries int64
+	var acct flushBytes
+	partialShards := 0
+	sealStart := time.Now()
 
 	for _, shard := range set.Shards() {
-		// Quick check: skip shards with no data (offset <= 8 means no data written)
-		if shard.Offset() <= 8 {
-			continue
+		// Get buffer data - this seals the shard and waits for all writes to complete
+		// After this returns, the offset is stable (no more writes can happen). Empty shards are
+		// sealed too: a writer still holding this set could otherwise write into one just before
+		// the reset below
+		sealed := shard.seal(l.config.FlushTimeout)
+		complete := sealed.complete
+		if !complete {
+			partialShards++
 		}
-
-		// Get buffer data - this waits for all writes to complete
-		// After this returns, the offset is stable (no more writes can happen)
-		data, _ := shard.GetData(l.config.FlushTimeout)
-
-		// Read offset AFTER GetData() completes to ensure it reflects all completed writes
-		// This is safe because GetData() is called with shard mutex held, preventing concurrent writes
-		shardOffset := shard.Offset()
-		if shardOffset <= 8 {
-			// No data written (shouldn't happen if first check passed, but defensive)
+		if sealed.data == nil {
+			// No data written (only the header reservation), or none committed before the timeout
 			continue
 		}
 
-		// Note: If complete is false, timeout occurred and last write may be incomplete
-		// This is acceptable - only the last incomplete write may be corrupted
+		// A seal that timed out holds only the entries written before it (see Buffer.seal)
+		data := sealed.data
 		capacity := shard.Capacity()
 		// validDataBytes is the actual data size (excluding the 8-byte header reservation)
-		validDataBytes := shardOffset - 8
+		validDataBytes := sealed.end - headerOffset
+		if rec != nil {
+			rec.addShard(shard, validDataBytes, complete)
+		}
+
+		// Buffered I/O needs no alignment, so write only the header and valid data (no padding)
+		// The header's capacity is the size written, which keeps the next header at offset+capacity
+		if l.config.IOMode == IOModeBuffered {
+			capacity = headerOffset + validDataBytes
+			data = data[:capacity]
+		}
 
-		// Defensive check: ensure validDataBytes is non-negative (should always be true)
-		if validDataBytes < 0 {
-			validDataBytes = 0
+		// Record the sealed extent in the buffer file before writing it (Config.PersistentBuffers)
+		if err := shard.buffer.commitRegion(sealed.end); err != nil {
+			l.config.InternalLogger.Printf("[PERSIST_ERROR] Logger=%s SetID=%d Error=%v", l.config.LogFilePath, set.ID(), err)
 		}
 
-		// Write header directly into the first 8 bytes of the buffer (in-place, zero-copy!)
-		binary.LittleEndian.PutUint32(data[0:4], uint32(capacity))
-		binary.LittleEndian.PutUint32(data[4:8], uint32(validDataBytes))
+		if l.config.OutputFormat == OutputPlain {
+			// Plain output is the lines alone (IOModeBuffered, so there is no padding either)
+			data = data[headerOffset:capacity]
+			acct.addLines(int64(validDataBytes), sealed.payload)
+		} else {
+			// Write header directly into the first 8 bytes of the buffer (in-place, zero-copy!)
+			logcore.PutShardHeader(data, uint32(capacity), validDataBytes)
+			acct.add(int64(len(data)), int64(validDataBytes), sealed.payload)
+		}
 
 		// Use buffer directly - no copying needed! Header is already in place, data follows immediately
 		shardBuffers = append(shardBuffers, data)
+		entries += sealed.entries
+	}
+
+	if rec != nil {
+		rec.WaitForWrites = time.Since(sealStart)
+	}
+	if partialShards > 0 {
+		l.recordPartialFlush(set.ID(), partialShards, flushStart)
+	}
+
+	// Small flushes are packed into one buffer (Config.CompactFlush); large ones are written as is
+	buffers := shardBuffers
+	var saved int64
+	if l.compactBuf != nil && len(shardBuffers) > 0 {
+		if packed, ok := compactShards(l.compactBuf, shardBuffers, l.config.IOAlignment); ok {
+			saved = acct.written() - int64(len(packed))
+			acct.padding -= saved
+			buffers = [][]byte{packed}
+		}
 	}
 
 	// Single batched write for all shards - track timing
+	var flushErr error
+	var observation FlushObservation
 	if len(shardBuffers) > 0 {
+		totalBytes := 0
+		for _, buf := range buffers {
+			totalBytes += len(buf)
+		}
 		writeStart := time.Now()
-		n, err := l.fileWriter.WriteVectored(shardBuffers)
+		n, err := l.fileWriter.WriteVectored(buffers)
+		if err == nil && n < totalBytes {
+			// The writer stopped early without an error: the flush is not on disk
+			err = io.ErrShortWrite
+		}
+		flushErr = err
 		writeDuration := time.Since(writeStart)
+		observation.WriteDuration = writeDuration
 
 		// Track write duration (includes rotation checks)
 		writeDurationNs := writeDuration.Nanoseconds()
 		l.stats.TotalWriteDuration.Add(writeDurationNs)
-
-		// Update max write duration atomically
-		for {
-			currentMax := l.stats.MaxWriteDuration.Load()
-			if writeDurationNs <= currentMax {
-				break
-			}
-			if l.stats.MaxWriteDuration.CompareAndSwap(currentMax, writeDurationNs) {
-				break
-			}
-		}
+		logcore.StoreMax(&l.stats.MaxWriteDuration, writeDurationNs)
 
 		// Track Pwritev syscall duration (pure disk I/O, excludes rotation checks)
 		pwritevDuration := l.fileWriter.GetLastPwritevDuration()
+		observation.PwritevDuration = pwritevDuration
 		if pwritevDuration > 0 {
 			pwritevDurationNs := pwritevDuration.Nanoseconds()
 			l.stats.TotalPwritevDuration.Add(pwritevDurationNs)
-
-			// Update max Pwritev duration atomically
-			for {
-				currentMax := l.stats.MaxPwritevDuration.Load()
-				if pwritevDurationNs <= currentMax {
-					break
-				}
-				if l.stats.MaxPwritevDuration.CompareAndSwap(currentMax, pwritevDurationNs) {
-					break
-				}
-			}
+			logcore.StoreMax(&l.stats.MaxPwritevDuration, pwritevDurationNs)
 		}
 
 		if err != nil {
 			l.stats.FlushErrors.Add(1)
-			// Log flush error details for debugging
-			// Note: Using fmt.Printf to avoid circular dependency on logger
-			fmt.Printf("[FLUSH_ERROR] Logger=%s SetID=%d Shards=%d Bytes=%d Error=%v Duration=%v\n",
-				l.config.LogFilePath, set.ID(), len(shardBuffers), func() int {
-					total := 0
-					for _, buf := range shardBuffers {
-						total += len(buf)
-					}
-					return total
-				}(), err, writeDuration)
+			l.stats.EntriesLost.Add(entries)
+			if !l.hooks.flushError(err, len(shardBuffers), totalBytes) {
+				// No OnFlushError callback: log flush error details for debugging
+				l.config.InternalLogger.Printf("[FLUSH_ERROR] Logger=%s SetID=%d Shards=%d Bytes=%d Error=%v Duration=%v",
+					l.config.LogFilePath, set.ID(), len(shardBuffers), totalBytes, err, writeDuration)
+			}
 		} else {
 			l.stats.BytesWritten.Add(int64(n))
 			l.stats.Flushes.Add(1)
+			l.stats.EntriesFlushed.Add(entries)
+			l.stats.recordFlushBytes(acct)
+			if saved > 0 {
+				l.stats.CompactedFlushes.Add(1)
+				l.stats.PaddingBytesSaved.Add(saved)
+			}
+			observation.Bytes = n
+			observation.PayloadBytes = acct.payload
+			observation.HeaderBytes = acct.header
+			observation.PaddingBytes = acct.padding
 		}
 	}
 
-	// Reset all shards after flush attempt
+	// Reset all shards after flush attempt, then let writers swap back into this set
 	for _, shard := range set.Shards() {
+		shard.buffer.releaseRegion()
 		shard.Reset()
 	}
+	set.pendingFlush.Store(false)
+	l.signalSpaceAvailable()
 
 	// Note: With O_DSYNC flag, each write() automatically syncs data to disk
 	// No explicit file.Sync() call needed - sync happens during WriteVectored()
@@ -417,90 +899,311 @@ func (l *Logger) flushSet(set *BufferSet) {
 	flushDuration := time.Since(flushStart)
 	flushDurationNs := flushDuration.Nanoseconds()
 	l.stats.TotalFlushDuration.Add(flushDurationNs)
-
-	// Update max flush duration atomically
-	for {
-		currentMax := l.stats.MaxFlushDuration.Load()
-		if flushDurationNs <= currentMax {
-			break
-		}
-		if l.stats.MaxFlushDuration.CompareAndSwap(currentMax, flushDurationNs) {
-			break
+	logcore.StoreMax(&l.stats.MaxFlushDuration, flushDurationNs)
+
+	if rec != nil && len(shardBuffers) > 0 {
+		rec.Bytes = observation.Bytes
+		rec.Compacted = saved > 0
+		rec.WriteDuration = observation.WriteDuration
+		rec.PwritevDuration = observation.PwritevDuration
+		rec.Duration = flushDuration
+		if flushErr != nil {
+			rec.Error = flushErr.Error()
 		}
+		l.history.commit()
 	}
+
+	// Report flushes that wrote (or failed to write) data, matching the Flushes/FlushErrors counters
+	if observer := l.flushObserver.Load(); observer != nil && len(shardBuffers) > 0 {
+		observation.Duration = flushDuration
+		observation.Err = flushErr
+		(*observer)(observation)
+	}
+
+	return flushErr
 }
 
 // drainFlushChannel flushes all pending buffer sets in the channel
-func (l *Logger) drainFlushChannel() {
+// Returns the first flush error
+func (l *Logger) drainFlushChannel() error {
+	var firstErr error
 	for {
 		select {
 		case set := <-l.flushChan:
-			l.flushSet(set)
+			if err := l.flushSet(set); err != nil && firstErr == nil {
+				firstErr = err
+			}
 		default:
-			return
+			return firstErr
+		}
+	}
+}
+
+// Flush writes all data logged before the call to the log file and waits for it
+// The flush runs on the flush worker alongside interval and threshold flushes, so it is safe
+// to call under concurrent LogBytes traffic and never writes a set twice. With O_DSYNC the data
+// is on disk when Flush returns nil. Returns ErrClosed if the logger is closed, ctx.Err() if ctx
+// ends first (the flush itself still completes in the background), or the flush write error
+func (l *Logger) Flush(ctx context.Context) error {
+	if l.life.Closed() {
+		return ErrClosed
+	}
+
+	reply := make(chan error, 1)
+	select {
+	case l.flushReqs <- reply:
+	case <-l.life.Done():
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-reply:
+		if err != nil {
+			return fmt.Errorf("flush failed: %w", err)
 		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
+// DefaultCloseTimeout bounds how long Close waits for pending data to be flushed
+const DefaultCloseTimeout = 10 * time.Second
+
+// closeWriterPollInterval is how often Close checks whether the writes in progress have finished
+const closeWriterPollInterval = 100 * time.Microsecond
+
+// CloseReport describes what happened to buffered data during Close
+type CloseReport struct {
+	EntriesFlushed   int64 // Entries written to disk during Close (queued and buffered sets)
+	BytesFlushed     int64 // Bytes written to the file during Close, including shard headers and padding
+	EntriesDropped   int64 // Buffered entries not confirmed on disk: failed final flushes, or left at the deadline
+	DeadlineExceeded bool  // The context ended before all pending data was flushed
+}
+
 // Close gracefully shuts down the logger, flushing all pending data
+// Equivalent to CloseWithTimeout(DefaultCloseTimeout) without the report
 func (l *Logger) Close() error {
-	// Check if already closed
-	if !l.closed.CompareAndSwap(false, true) {
-		return nil // Already closed
+	_, err := l.CloseWithTimeout(DefaultCloseTimeout)
+	return err
+}
+
+// CloseWithTimeout is CloseContext with a deadline of d from now (of Config.Clock)
+func (l *Logger) CloseWithTimeout(d time.Duration) (CloseReport, error) {
+	ctx, cancel := withClockTimeout(l.config.Clock, d)
+	defer cancel()
+	return l.CloseContext(ctx)
+}
+
+// withClockTimeout is context.WithTimeout timed by clk. With a clock other than clock.Real the
+// context is canceled when clk reaches the deadline, with context.DeadlineExceeded as its cause
+func withClockTimeout(clk clock.Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	if _, real := clk.(clock.Real); real {
+		return context.WithTimeout(context.Background(), d)
 	}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	timer := clk.NewTimer(d)
+	go func() {
+		select {
+		case <-timer.C():
+			cancel(context.DeadlineExceeded)
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}()
+	return ctx, func() { cancel(context.Canceled) }
+}
 
-	// Stop the ticker
-	l.ticker.Stop()
+// CloseContext shuts down the logger: it stops accepting writes (later logs are dropped with
+// ErrClosed), waits for writes already in progress and for the flush worker to finish the
+// in-progress and queued flushes, flushes both buffer sets once and closes the file.
+// If ctx ends first, it returns context.Cause(ctx) with DeadlineExceeded set; no further sets are flushed,
+// and the file is closed in the background once the in-progress write returns.
+// Closing an already closed logger waits for the first Close to return (or ctx to end), then
+// returns an empty report and nil.
+func (l *Logger) CloseContext(ctx context.Context) (CloseReport, error) {
+	report, _, err := l.life.Close(ctx, setSwap{l}, l.ticker.Stop)
+	return CloseReport(report), err
+}
 
-	// Signal workers to stop
-	close(l.done)
+// setSwap is the logcore.SwapStrategy of Logger: buffers are swapped and flushed a whole set at a time
+type setSwap struct {
+	l *Logger
+}
 
-	// Give workers time to finish
-	time.Sleep(100 * time.Millisecond)
+// Counters returns the entries flushed and lost and the bytes written (see CloseReport)
+func (s setSwap) Counters() (entriesFlushed, entriesLost, bytesFlushed int64) {
+	return s.l.stats.EntriesFlushed.Load(), s.l.stats.EntriesLost.Load(), s.l.stats.BytesWritten.Load()
+}
 
-	// Flush the currently active set
-	activeSet := l.activeSet.Load()
-	if activeSet != nil && activeSet.HasData() {
-		l.flushSet(activeSet)
+// WaitIdle waits for the writes that passed the closed check, which land in a set before it is
+// flushed (blocked writers were woken by done and drop their logs), then for the workers; the
+// flush worker drains queued sets before exiting
+func (s setSwap) WaitIdle(abandon *atomic.Bool) {
+	for s.l.writers.Load() > 0 && !abandon.Load() {
+		time.Sleep(closeWriterPollInterval)
 	}
+	s.l.workers.Wait()
+}
 
-	// Flush the inactive set if it has data
-	var inactiveSet *BufferSet
-	if activeSet.ID() == l.setA.ID() {
-		inactiveSet = l.setB
-	} else {
-		inactiveSet = l.setA
+// FlushRemaining flushes both sets, oldest entries first
+func (s setSwap) FlushRemaining(abandon *atomic.Bool) error {
+	l := s.l
+	var flushErr error
+	for _, set := range closeFlushOrder(l.activeSet.Load(), l.setA, l.setB) {
+		if abandon.Load() || !set.HasData() {
+			continue
+		}
+		set.trigger = FlushTriggerClose
+		if err := l.flushSet(set); err != nil && flushErr == nil {
+			flushErr = fmt.Errorf("final flush failed: %w", err)
+		}
 	}
-	if inactiveSet != nil && inactiveSet.HasData() {
-		l.flushSet(inactiveSet)
+	return flushErr
+}
+
+// Release closes the file writer (handles rotation cleanup) and the buffer file even if one fails
+// Writers that outlived an abandoned Close may still touch the buffers, so they stay mapped
+func (s setSwap) Release(abandoned bool) error {
+	var closeErr error
+	if err := s.l.fileWriter.Close(); err != nil {
+		closeErr = fmt.Errorf("failed to close file writer: %w", err)
 	}
+	return errors.Join(closeErr, s.l.persistent.close(!abandoned))
+}
+
+// BufferedEntries counts the entries still held in either buffer set
+func (s setSwap) BufferedEntries() int64 {
+	return s.l.bufferedEntries()
+}
 
-	// Close the file writer (handles rotation cleanup)
-	if err := l.fileWriter.Close(); err != nil {
-		return fmt.Errorf("failed to close file writer: %w", err)
+// closeFlushOrder returns the buffer sets in the order Close flushes them: the inactive set only
+// holds data while its flush is queued, so its entries are older than the active set's
+func closeFlushOrder(active, setA, setB *BufferSet) [2]*BufferSet {
+	if active == setA {
+		return [2]*BufferSet{setB, setA}
 	}
+	return [2]*BufferSet{setA, setB}
+}
 
-	return nil
+// bufferedEntries counts the entries still held in either buffer set
+func (l *Logger) bufferedEntries() int64 {
+	var entries int64
+	for _, set := range []*BufferSet{l.setA, l.setB} {
+		for _, shard := range set.Shards() {
+			entries += shard.buffer.writesStarted.Load()
+		}
+	}
+	return entries
+}
+
+// partialFlushWarnInterval is the least time between two partial flush warnings of one logger
+const partialFlushWarnInterval = 10 * time.Second
+
+// recordPartialFlush counts a flush in which shards shards still had writes in progress when
+// FlushTimeout expired, and warns through InternalLogger at most once per partialFlushWarnInterval
+func (l *Logger) recordPartialFlush(setID uint32, shards int, start time.Time) {
+	l.stats.PartialFlushes.Add(1)
+	l.stats.LastPartialFlushUnixNano.Store(start.UnixNano())
+
+	suppressed := l.partialsSinceWarned.Add(1) - 1
+	last := l.partialWarnedAt.Load()
+	if last != 0 && start.Sub(time.Unix(0, last)) < partialFlushWarnInterval {
+		return
+	}
+	l.partialWarnedAt.Store(start.UnixNano())
+	l.partialsSinceWarned.Store(0)
+	l.config.InternalLogger.Printf("[WARNING] Logger=%s SetID=%d: %d shard(s) flushed with writes still in progress after FlushTimeout=%v; their unfinished entries are left for the next flush (%d more partial flushes since the last warning)",
+		l.config.LogFilePath, setID, shards, l.config.FlushTimeout, suppressed)
 }
 
 // GetStatsSnapshot returns current statistics values
-func (l *Logger) GetStatsSnapshot() (totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps int64) {
-	return l.stats.TotalLogs.Load(),
-		l.stats.DroppedLogs.Load(),
-		l.stats.BytesWritten.Load(),
-		l.stats.Flushes.Load(),
-		l.stats.FlushErrors.Load(),
-		l.stats.SetSwaps.Load()
+// bytesWritten counts file bytes of successful flushes (including headers and padding);
+// bytesBuffered and bytesDurable count log payload only (see Statistics.BytesBuffered, BytesDurable).
+// Counters are read in an order that keeps droppedLogs <= totalLogs (see SnapshotStats)
+func (l *Logger) GetStatsSnapshot() (totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, bytesBuffered, bytesDurable int64) {
+	s := l.collectStats()
+	return s.TotalLogs, s.DroppedLogs, s.BytesWritten, s.Flushes, s.FlushErrors, s.SetSwaps, s.BytesBuffered, s.BytesDurable
+}
+
+// StatsSnapshot holds the values of GetStatsSnapshot and the counters added since, which do not fit
+// its tuple without breaking callers (see GetStatsStruct)
+type StatsSnapshot struct {
+	TotalLogs     int64
+	DroppedLogs   int64
+	BytesWritten  int64 // File bytes of successful flushes, including headers and padding
+	Flushes       int64
+	FlushErrors   int64
+	SetSwaps      int64
+	BytesBuffered int64 // Log payload accepted into the buffers
+	BytesDurable  int64 // Log payload written by successful flushes
+
+	PartialFlushes           int64 // Flushes that went ahead after FlushTimeout with writes in progress
+	LastPartialFlushUnixNano int64 // When the last partial flush started; 0 if none
+	FilteredLogs             int64 // Logs Config.Transform returned nil for
+
+	// Consistent is set by SnapshotStats when every counter above was read at one instant
+	Consistent bool
+}
+
+// GetStatsStruct returns the GetStatsSnapshot values, the partial flush counters and FilteredLogs as a struct
+func (l *Logger) GetStatsStruct() StatsSnapshot {
+	return l.collectStats()
+}
+
+// statsSnapshotAttempts bounds the collects SnapshotStats makes while counters keep moving
+const statsSnapshotAttempts = 8
+
+// SnapshotStats returns GetStatsStruct read at one instant: the counters are collected until two
+// collects in a row agree. The counters only grow, so two equal collects held at the moment between
+// them, and values derived from several counters (drop rates, averages) are exact. The writers are
+// not slowed down; under a write load that moves a counter during every collect, SnapshotStats gives
+// up after statsSnapshotAttempts and returns the last collect with Consistent false, which still
+// keeps DroppedLogs <= TotalLogs
+func (l *Logger) SnapshotStats() StatsSnapshot {
+	prev := l.collectStats()
+	for i := 1; i < statsSnapshotAttempts; i++ {
+		cur := l.collectStats()
+		if cur == prev {
+			cur.Consistent = true
+			return cur
+		}
+		prev = cur
+	}
+	return prev
+}
+
+// collectStats reads the StatsSnapshot counters once. A log is counted in TotalLogs before
+// DroppedLogs, and flushed payload is buffered first, so results are read before their causes:
+// whatever a later counter includes, an earlier one cannot be missing
+func (l *Logger) collectStats() StatsSnapshot {
+	var s StatsSnapshot
+	s.FilteredLogs = l.stats.FilteredLogs.Load()
+	s.LastPartialFlushUnixNano = l.stats.LastPartialFlushUnixNano.Load()
+	s.PartialFlushes = l.stats.PartialFlushes.Load()
+	s.BytesDurable = l.stats.BytesDurable.Load()
+	s.BytesWritten = l.stats.BytesWritten.Load()
+	s.Flushes = l.stats.Flushes.Load()
+	s.FlushErrors = l.stats.FlushErrors.Load()
+	s.SetSwaps = l.stats.SetSwaps.Load()
+	s.DroppedLogs = l.stats.DroppedLogs.Load()
+	s.BytesBuffered = l.stats.BytesBuffered.Load()
+	s.TotalLogs = l.stats.TotalLogs.Load()
+	return s
 }
 
 // FlushMetrics holds flush performance metrics for investigation
+// The fields match asyncloguploader.FlushMetrics (which adds io_uring timings), so both packages report alike
 type FlushMetrics struct {
 	TotalFlushDuration time.Duration // Total time spent in flush operations
 	AvgFlushDuration   time.Duration // Average flush duration
 	MaxFlushDuration   time.Duration // Maximum flush duration seen
-	FlushQueueDepth    int64         // Current depth of flush queue
-	BlockedSwaps       int64         // Number of swaps that blocked
+	FlushQueueDepth    int64         // Flushes in progress now (summed across loggers when aggregated)
+	BlockedSwaps       int64         // Number of swaps that blocked waiting for a flush
 	TotalFlushes       int64         // Total number of flushes
+	FlushErrors        int64         // Flushes whose write failed
 
 	// I/O breakdown (for disk I/O investigation)
 	AvgWriteDuration time.Duration // Average time for WriteVectored() (includes rotation checks)
@@ -511,6 +1214,16 @@ type FlushMetrics struct {
 	AvgPwritevDuration time.Duration // Average time for Pwritev syscall only
 	MaxPwritevDuration time.Duration // Maximum Pwritev duration
 	PwritevPercent     float64       // % of flush time spent in Pwritev syscall
+
+	// Bytes written by successful flushes (summed across loggers when aggregated)
+	PayloadBytes            int64   // Log payload (Statistics.BytesDurable)
+	HeaderBytes             int64   // Shard headers and entry framing (length prefixes, timestamps, LogEntry padding)
+	PaddingBytes            int64   // Bytes after each shard's valid data (Direct I/O alignment; none with IOModeBuffered)
+	WriteAmplificationRatio float64 // (PayloadBytes + HeaderBytes + PaddingBytes) / PayloadBytes; 0 before any payload
+
+	// Config.CompactFlush: flushes packed into one buffer and the padding bytes they did not write
+	CompactedFlushes  int64
+	PaddingBytesSaved int64
 }
 
 // GetFlushMetrics returns flush performance metrics
@@ -519,6 +1232,9 @@ func (l *Logger) GetFlushMetrics() FlushMetrics {
 	totalWrite := l.stats.TotalWriteDuration.Load()
 	totalPwritev := l.stats.TotalPwritevDuration.Load()
 	flushes := l.stats.Flushes.Load()
+	payload := l.stats.BytesDurable.Load()
+	header := l.stats.HeaderBytesFlushed.Load()
+	padding := l.stats.PaddingBytesFlushed.Load()
 
 	avgFlushDuration := time.Duration(0)
 	avgWriteDuration := time.Duration(0)
@@ -544,22 +1260,94 @@ func (l *Logger) GetFlushMetrics() FlushMetrics {
 		FlushQueueDepth:    l.stats.FlushQueueDepth.Load(),
 		BlockedSwaps:       l.stats.BlockedSwaps.Load(),
 		TotalFlushes:       flushes,
+		FlushErrors:        l.stats.FlushErrors.Load(),
 		AvgWriteDuration:   avgWriteDuration,
 		MaxWriteDuration:   time.Duration(l.stats.MaxWriteDuration.Load()),
 		WritePercent:       writePercent,
 		AvgPwritevDuration: avgPwritevDuration,
 		MaxPwritevDuration: time.Duration(l.stats.MaxPwritevDuration.Load()),
 		PwritevPercent:     pwritevPercent,
+
+		PayloadBytes:            payload,
+		HeaderBytes:             header,
+		PaddingBytes:            padding,
+		WriteAmplificationRatio: writeAmplification(payload, header, padding),
+
+		CompactedFlushes:  l.stats.CompactedFlushes.Load(),
+		PaddingBytesSaved: l.stats.PaddingBytesSaved.Load(),
 	}
 }
 
+// FlushObservation describes one flush that wrote data, as passed to a flush observer
+type FlushObservation struct {
+	Duration        time.Duration // Whole flush, including waiting for in-flight writes
+	WriteDuration   time.Duration // WriteVectored() (includes rotation checks)
+	PwritevDuration time.Duration // Pwritev syscall only (pure disk I/O)
+	Bytes           int           // Bytes written; zero when Err is set
+	Err             error         // Write error (also counted in FlushErrors)
+
+	// Split of Bytes into payload, shard headers and entry framing, and padding; zero when Err is set
+	PayloadBytes int64
+	HeaderBytes  int64
+	PaddingBytes int64
+}
+
+// SetFlushObserver registers fn to be called after every flush that wrote data; nil removes it
+// fn runs on the flush path, so it must be fast and must not call back into the logger
+func (l *Logger) SetFlushObserver(fn func(FlushObservation)) {
+	if fn == nil {
+		l.flushObserver.Store(nil)
+		return
+	}
+	l.flushObserver.Store(&fn)
+}
+
+// GetRecoveryStats returns the entries and file bytes New recovered from the buffer file
+// (Config.PersistentBuffers); both are 0 when nothing was pending
+func (l *Logger) GetRecoveryStats() (entries, bytes int64) {
+	return l.stats.EntriesRecovered.Load(), l.stats.BytesRecovered.Load()
+}
+
+// GetDiscardedCallbacks returns how many OnDrop/OnFlushError calls were discarded because the
+// callback fell more than 1024 events behind (the drops themselves are still in GetStatsSnapshot)
+func (l *Logger) GetDiscardedCallbacks() int64 {
+	return l.hooks.discardedEvents()
+}
+
+// GetBackpressureStats returns how often and how long writers blocked waiting for buffer space
+// Only DropPolicyBlock / LogBytesBlocking writers block; dropped writes are in GetStatsSnapshot
+func (l *Logger) GetBackpressureStats() (blockedWrites int64, totalBlocked, maxBlocked time.Duration) {
+	return l.stats.BlockedWrites.Load(),
+		time.Duration(l.stats.TotalBlockedDuration.Load()),
+		time.Duration(l.stats.MaxBlockedDuration.Load())
+}
+
+// GetWritePathStats returns how many writes succeeded on the fast path, entered the retry path,
+// and were dropped because the retry path timed out waiting for the swap semaphore
+func (l *Logger) GetWritePathStats() (fastPath, retryPath, retryTimeouts int64) {
+	return l.stats.FastPathWrites.Load(),
+		l.stats.RetryPathWrites.Load(),
+		l.stats.RetryTimeouts.Load()
+}
+
 // ShardStats holds statistics for a single shard
+// Utilization uses the same base as the flush threshold: usable capacity, i.e. Capacity minus
+// the 8-byte header reservation. A shard that triggered a flush at 90% reports UtilizationPct >= 90.
+//
+// The write-path counters are cumulative since the logger started. Drops concentrated on one
+// shard point at skewed shard selection; drops spread evenly over all shards at an undersized buffer.
 type ShardStats struct {
 	ShardID        int
 	WriteCount     int64
-	BytesUsed      int32
-	Capacity       int32
-	UtilizationPct float64
+	BytesUsed      int32   // Log data bytes (length prefixes + payloads), excluding the header reservation
+	Capacity       int32   // Full buffer capacity, including the 8-byte header reservation
+	UtilizationPct float64 // BytesUsed as a percentage of usable capacity (Capacity - 8)
+
+	Drops           int64 // Entries dropped after this shard refused them (part of DroppedLogs)
+	RetryPathWrites int64 // Writes that found this shard full and entered the retry path
+	RetryTimeouts   int64 // Retry-path writes dropped waiting for the swap semaphore (also in Drops)
+	Swaps           int64 // Set swaps triggered by a write to this shard
+	Spills          int64 // Writes this shard had no space for that a following shard took (see Statistics.SpilledWrites)
 }
 
 // GetShardStats returns per-shard statistics from the currently active set
@@ -569,27 +1357,9 @@ func (l *Logger) GetShardStats() []ShardStats {
 		return nil
 	}
 
-	shards := activeSet.Shards()
-	stats := make([]ShardStats, len(shards))
-
-	for i, shard := range shards {
-		// Offset includes the 8-byte header reservation, so subtract it for actual data size
-		bytesUsed := shard.Offset() - 8
-		capacity := shard.Capacity()
-		utilizationPct := 0.0
-		if capacity > 0 {
-			// Utilization is based on usable capacity (excluding header reservation)
-			utilizationPct = float64(bytesUsed) / float64(capacity-8) * 100.0
-		}
-
-		stats[i] = ShardStats{
-			ShardID:        i,
-			WriteCount:     shard.buffer.WriteCount(),
-			BytesUsed:      bytesUsed,
-			Capacity:       capacity,
-			UtilizationPct: utilizationPct,
-		}
+	otherSet := l.setA
+	if activeSet == l.setA {
+		otherSet = l.setB
 	}
-
-	return stats
+	return collectShardStats(activeSet, otherSet)
 }
@@ -1,10 +1,13 @@
 package asynclogger
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,8 +17,34 @@ type LoggerManager struct {
 	loggers sync.Map // eventName (string) -> *Logger
 	baseDir string   // Base directory for log files
 	config  Config   // Base config (shared settings)
+
+	// Per-event overrides keyed by sanitized event name. Logger creation holds the read lock
+	// so SetEventConfig cannot register an override that a concurrently created logger misses
+	eventConfigMu sync.RWMutex
+	eventConfigs  map[string]EventConfig
+
+	// Flush observer installed on every event logger (guarded by eventConfigMu like the overrides)
+	flushObserver func(eventName string, observation FlushObservation)
+
+	// OnDrop delivery for logs dropped before reaching an event logger; nil without OnDrop
+	hooks *hookDispatcher
+
+	// Set by Drain: writes are refused, and those to events without a logger counted in drainRejected
+	draining      atomic.Bool
+	drainRejected atomic.Int64
 }
 
+var (
+	// ErrEventLoggerExists is returned by SetEventConfig when the event logger was already created
+	ErrEventLoggerExists = errors.New("event logger already exists")
+
+	// ErrInvalidEventName is wrapped by the *WithEvent methods' errors for names that cannot be sanitized
+	ErrInvalidEventName = errors.New("invalid event name")
+
+	// ErrDraining is returned by the *WithEvent methods once Drain has started
+	ErrDraining = errors.New("logger manager is draining")
+)
+
 // NewLoggerManager creates a new LoggerManager
 // The base directory is extracted from config.LogFilePath
 func NewLoggerManager(config Config) (*LoggerManager, error) {
@@ -31,11 +60,51 @@ func NewLoggerManager(config Config) (*LoggerManager, error) {
 	}
 
 	return &LoggerManager{
-		baseDir: baseDir,
-		config:  config,
+		baseDir:      baseDir,
+		config:       config,
+		eventConfigs: make(map[string]EventConfig),
+		hooks:        newHookDispatcher(config.OnDrop, nil, config.InternalLogger),
 	}, nil
 }
 
+// NewLoggerManagerWithEventConfigs creates a LoggerManager with per-event overrides of base
+func NewLoggerManagerWithEventConfigs(base Config, perEvent map[string]EventConfig) (*LoggerManager, error) {
+	lm, err := NewLoggerManager(base)
+	if err != nil {
+		return nil, err
+	}
+	for eventName, overrides := range perEvent {
+		if err := lm.SetEventConfig(eventName, overrides); err != nil {
+			return nil, err
+		}
+	}
+	return lm, nil
+}
+
+// SetEventConfig registers overrides for an event's logger, used when the logger is created
+// Overrides cannot change a running logger: if the event logger already exists, ErrEventLoggerExists
+// is returned (close it with CloseEventLogger first). The resulting config is validated up front
+func (lm *LoggerManager) SetEventConfig(eventName string, overrides EventConfig) error {
+	sanitized, err := sanitizeEventName(eventName)
+	if err != nil {
+		return fmt.Errorf("invalid event name: %w", err)
+	}
+
+	eventConfig := overrides.apply(lm.config)
+	if err := eventConfig.Validate(); err != nil {
+		return fmt.Errorf("invalid config for event %s: %w", sanitized, err)
+	}
+
+	lm.eventConfigMu.Lock()
+	defer lm.eventConfigMu.Unlock()
+
+	if _, exists := lm.loggers.Load(sanitized); exists {
+		return fmt.Errorf("%w: %s", ErrEventLoggerExists, sanitized)
+	}
+	lm.eventConfigs[sanitized] = overrides
+	return nil
+}
+
 // sanitizeEventName validates and sanitizes an event name for use as a filename
 // Returns sanitized name or error if invalid
 func sanitizeEventName(name string) (string, error) {
@@ -71,7 +140,7 @@ func sanitizeEventName(name string) (string, error) {
 func (lm *LoggerManager) getOrCreateLogger(eventName string) (*Logger, error) {
 	sanitized, err := sanitizeEventName(eventName)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEventName, err)
 	}
 
 	// Fast path: check if logger exists (no lock needed with sync.Map)
@@ -79,19 +148,35 @@ func (lm *LoggerManager) getOrCreateLogger(eventName string) (*Logger, error) {
 		return logger.(*Logger), nil
 	}
 
+	// No new logger once Drain has started
+	if lm.draining.Load() {
+		lm.drainRejected.Add(1)
+		return nil, ErrDraining
+	}
+
 	// Slow path: create new logger
+	// Hold the override lock until the logger is stored so a concurrent SetEventConfig either
+	// lands before creation or sees the logger and fails
+	lm.eventConfigMu.RLock()
+	defer lm.eventConfigMu.RUnlock()
+
 	// Generate file path: {baseDir}/{eventName}.log
 	eventLogPath := filepath.Join(lm.baseDir, sanitized+".log")
 
-	// Create config for this event logger (same settings, different file path)
-	eventConfig := lm.config
+	// Create config for this event logger (base settings plus any overrides, own file path)
+	eventConfig := lm.eventConfigs[sanitized].apply(lm.config)
 	eventConfig.LogFilePath = eventLogPath
+	eventConfig.StripeFiles = stripePaths(lm.config.StripeFiles, sanitized)
 
 	// Create new logger
 	logger, err := New(eventConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create logger for event %s: %w", sanitized, err)
 	}
+	logger.event = sanitized
+	if lm.flushObserver != nil {
+		logger.SetFlushObserver(eventFlushObserver(sanitized, lm.flushObserver))
+	}
 
 	// Use LoadOrStore to ensure only one logger is created per event
 	// If another goroutine created it first, close ours and return the existing one
@@ -105,24 +190,97 @@ func (lm *LoggerManager) getOrCreateLogger(eventName string) (*Logger, error) {
 	return logger, nil
 }
 
+// SetFlushObserver registers fn to be called after every flush of every event logger, including
+// loggers created later; nil removes it. fn runs on the flush path, so it must be fast
+func (lm *LoggerManager) SetFlushObserver(fn func(eventName string, observation FlushObservation)) {
+	// The write lock keeps loggers from being created (and missing fn) while existing ones are updated
+	lm.eventConfigMu.Lock()
+	defer lm.eventConfigMu.Unlock()
+
+	lm.flushObserver = fn
+	lm.loggers.Range(func(key, value interface{}) bool {
+		if fn == nil {
+			value.(*Logger).SetFlushObserver(nil)
+		} else {
+			value.(*Logger).SetFlushObserver(eventFlushObserver(key.(string), fn))
+		}
+		return true
+	})
+}
+
+// eventFlushObserver binds a manager flush observer to one event
+func eventFlushObserver(eventName string, fn func(string, FlushObservation)) func(FlushObservation) {
+	return func(observation FlushObservation) {
+		fn(eventName, observation)
+	}
+}
+
+// RangeEventLoggers calls fn for each event logger (keyed by sanitized event name) until fn returns false
+func (lm *LoggerManager) RangeEventLoggers(fn func(eventName string, logger *Logger) bool) {
+	lm.loggers.Range(func(key, value interface{}) bool {
+		return fn(key.(string), value.(*Logger))
+	})
+}
+
 // LogBytesWithEvent writes raw byte data to the event-specific logger (zero-allocation path)
 func (lm *LoggerManager) LogBytesWithEvent(eventName string, data []byte) {
 	logger, err := lm.getOrCreateLogger(eventName)
 	if err != nil {
-		// Drop log on error (could add error callback in future)
+		lm.droppedEvent(err, len(data))
 		return
 	}
-	logger.LogBytes(data)
+	if lm.admit(logger) == nil {
+		logger.LogBytes(data)
+	}
+}
+
+// TryLogBytesWithEvent is LogBytesWithEvent that reports whether the log was accepted
+// Returns the logger's sentinel errors (ErrClosed, ErrBufferFull, ErrOversized), or the
+// error from resolving the event logger (ErrInvalidEventName, logger creation failure)
+func (lm *LoggerManager) TryLogBytesWithEvent(eventName string, data []byte) error {
+	logger, err := lm.getOrCreateLogger(eventName)
+	if err != nil {
+		lm.droppedEvent(err, len(data))
+		return err
+	}
+	if err := lm.admit(logger); err != nil {
+		return err
+	}
+	return logger.TryLogBytes(data)
+}
+
+// admit refuses a write to logger with ErrDraining once Drain has started, counting it for the event
+func (lm *LoggerManager) admit(logger *Logger) error {
+	if lm.draining.Load() {
+		logger.stats.DrainRejectedLogs.Add(1)
+		return ErrDraining
+	}
+	return nil
+}
+
+// droppedEvent reports a log dropped because its event logger could not be resolved to OnDrop
+// Logs refused by Drain are not drops
+func (lm *LoggerManager) droppedEvent(err error, size int) {
+	if errors.Is(err, ErrDraining) {
+		return
+	}
+	reason := DropReasonLoggerCreateFailed
+	if errors.Is(err, ErrInvalidEventName) {
+		reason = DropReasonInvalidEventName
+	}
+	lm.hooks.drop(reason, size)
 }
 
 // LogWithEvent writes a string message to the event-specific logger (convenience API)
 func (lm *LoggerManager) LogWithEvent(eventName string, message string) {
 	logger, err := lm.getOrCreateLogger(eventName)
 	if err != nil {
-		// Drop log on error (could add error callback in future)
+		lm.droppedEvent(err, len(message))
 		return
 	}
-	logger.Log(message)
+	if lm.admit(logger) == nil {
+		logger.Log(message)
+	}
 }
 
 // InitializeEventLogger creates a logger for the specified event if it doesn't exist
@@ -163,6 +321,33 @@ func (lm *LoggerManager) CloseEventLogger(eventName string) error {
 	return logger.(*Logger).Close()
 }
 
+// FlushEvent flushes the logger for the specified event (see Logger.Flush)
+func (lm *LoggerManager) FlushEvent(eventName string, ctx context.Context) error {
+	sanitized, err := sanitizeEventName(eventName)
+	if err != nil {
+		return fmt.Errorf("invalid event name: %w", err)
+	}
+
+	logger, exists := lm.loggers.Load(sanitized)
+	if !exists {
+		return fmt.Errorf("event logger not found: %s", sanitized)
+	}
+	return logger.(*Logger).Flush(ctx)
+}
+
+// FlushAll flushes every event logger (see Logger.Flush)
+// All loggers are flushed even if one fails; the first error is returned
+func (lm *LoggerManager) FlushAll(ctx context.Context) error {
+	var firstErr error
+	lm.loggers.Range(func(key, value interface{}) bool {
+		if err := value.(*Logger).Flush(ctx); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error flushing logger for event %s: %w", key.(string), err)
+		}
+		return true
+	})
+	return firstErr
+}
+
 // HasEventLogger checks if a logger exists for the specified event
 func (lm *LoggerManager) HasEventLogger(eventName string) bool {
 	sanitized, err := sanitizeEventName(eventName)
@@ -185,42 +370,132 @@ func (lm *LoggerManager) ListEventLoggers() []string {
 }
 
 // Close gracefully shuts down all loggers, flushing all pending data
+// Equivalent to CloseWithTimeout(DefaultCloseTimeout) without the report
 func (lm *LoggerManager) Close() error {
-	var firstErr error
+	_, err := lm.CloseWithTimeout(DefaultCloseTimeout)
+	return err
+}
+
+// CloseWithTimeout is CloseContext with a deadline of d from now (of Config.Clock)
+func (lm *LoggerManager) CloseWithTimeout(d time.Duration) (CloseReport, error) {
+	ctx, cancel := withClockTimeout(lm.config.Clock, d)
+	defer cancel()
+	return lm.CloseContext(ctx)
+}
+
+// CloseContext closes all event loggers concurrently under one deadline (see Logger.CloseContext)
+// The report sums the per-logger reports; DeadlineExceeded is set if any logger hit the deadline
+func (lm *LoggerManager) CloseContext(ctx context.Context) (CloseReport, error) {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		report   CloseReport
+		firstErr error
+	)
 	lm.loggers.Range(func(key, value interface{}) bool {
 		eventName := key.(string)
 		logger := value.(*Logger)
-		if err := logger.Close(); err != nil {
-			if firstErr == nil {
-				firstErr = fmt.Errorf("error closing logger for event %s: %w", eventName, err)
-			}
-		}
 		// Delete from map as we iterate
 		lm.loggers.Delete(key)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := logger.CloseContext(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.EntriesFlushed += r.EntriesFlushed
+			report.BytesFlushed += r.BytesFlushed
+			report.EntriesDropped += r.EntriesDropped
+			report.DeadlineExceeded = report.DeadlineExceeded || r.DeadlineExceeded
+			if err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("error closing logger for event %s: %w", eventName, err)
+			}
+		}()
 		return true // continue iteration
 	})
+	wg.Wait()
 
-	return firstErr
+	return report, firstErr
 }
 
 // GetStatsSnapshot returns aggregated statistics from all event loggers
-func (lm *LoggerManager) GetStatsSnapshot() (totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps int64) {
+func (lm *LoggerManager) GetStatsSnapshot() (totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, bytesBuffered, bytesDurable int64) {
 	lm.loggers.Range(func(key, value interface{}) bool {
 		logger := value.(*Logger)
-		tl, dl, bw, f, fe, ss := logger.GetStatsSnapshot()
+		tl, dl, bw, f, fe, ss, bb, bd := logger.GetStatsSnapshot()
 		totalLogs += tl
 		droppedLogs += dl
 		bytesWritten += bw
 		flushes += f
 		flushErrors += fe
 		setSwaps += ss
+		bytesBuffered += bb
+		bytesDurable += bd
 		return true // continue iteration
 	})
 
-	return totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps
+	return totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, bytesBuffered, bytesDurable
+}
+
+// GetStatsStruct returns GetStatsStruct summed across all event loggers
+// LastPartialFlushUnixNano is the latest partial flush of any event logger
+func (lm *LoggerManager) GetStatsStruct() StatsSnapshot {
+	var total StatsSnapshot
+	lm.loggers.Range(func(key, value interface{}) bool {
+		total.add(value.(*Logger).GetStatsStruct())
+		return true // continue iteration
+	})
+
+	return total
+}
+
+// ManagerStats is the result of LoggerManager.SnapshotStats
+type ManagerStats struct {
+	Total  StatsSnapshot            // Sum of Events; Consistent if every event's snapshot is
+	Events map[string]StatsSnapshot // By sanitized event name
+}
+
+// SnapshotStats returns the stats of every event logger and their sum in one call, instead of
+// GetStatsSnapshot plus GetEventStats per event. Each event's stats are a Logger.SnapshotStats, so
+// drop rates and other ratios hold within an event and in the total; events are read one after
+// another, not at one instant. Totals only grow between calls while no event logger is closed
+func (lm *LoggerManager) SnapshotStats() ManagerStats {
+	stats := ManagerStats{
+		Total:  StatsSnapshot{Consistent: true},
+		Events: make(map[string]StatsSnapshot),
+	}
+	lm.RangeEventLoggers(func(eventName string, logger *Logger) bool {
+		s := logger.SnapshotStats()
+		stats.Events[eventName] = s
+		stats.Total.add(s)
+		return true
+	})
+	return stats
+}
+
+// add sums s into total, keeping the latest partial flush and clearing Consistent unless s has it
+func (total *StatsSnapshot) add(s StatsSnapshot) {
+	total.TotalLogs += s.TotalLogs
+	total.DroppedLogs += s.DroppedLogs
+	total.BytesWritten += s.BytesWritten
+	total.Flushes += s.Flushes
+	total.FlushErrors += s.FlushErrors
+	total.SetSwaps += s.SetSwaps
+	total.BytesBuffered += s.BytesBuffered
+	total.BytesDurable += s.BytesDurable
+	total.PartialFlushes += s.PartialFlushes
+	total.FilteredLogs += s.FilteredLogs
+	if s.LastPartialFlushUnixNano > total.LastPartialFlushUnixNano {
+		total.LastPartialFlushUnixNano = s.LastPartialFlushUnixNano
+	}
+	total.Consistent = total.Consistent && s.Consistent
 }
 
 // GetAggregatedFlushMetrics returns aggregated flush metrics from all event loggers
+// Averages are weighted by each logger's flushes; FlushQueueDepth and the byte and compaction counts are sums,
+// and WriteAmplificationRatio is computed from the summed bytes
 func (lm *LoggerManager) GetAggregatedFlushMetrics() FlushMetrics {
 	var totalFlushDuration int64
 	var totalWriteDuration int64
@@ -229,7 +504,11 @@ func (lm *LoggerManager) GetAggregatedFlushMetrics() FlushMetrics {
 	var maxWriteDuration int64
 	var maxPwritevDuration int64
 	var totalFlushes int64
+	var totalFlushErrors int64
 	var totalBlockedSwaps int64
+	var totalQueueDepth int64
+	var payload, header, padding int64
+	var compacted, saved int64
 
 	lm.loggers.Range(func(key, value interface{}) bool {
 		logger := value.(*Logger)
@@ -247,7 +526,14 @@ func (lm *LoggerManager) GetAggregatedFlushMetrics() FlushMetrics {
 			maxPwritevDuration = metrics.MaxPwritevDuration.Nanoseconds()
 		}
 		totalFlushes += metrics.TotalFlushes
+		totalFlushErrors += metrics.FlushErrors
 		totalBlockedSwaps += metrics.BlockedSwaps
+		totalQueueDepth += metrics.FlushQueueDepth
+		payload += metrics.PayloadBytes
+		header += metrics.HeaderBytes
+		padding += metrics.PaddingBytes
+		compacted += metrics.CompactedFlushes
+		saved += metrics.PaddingBytesSaved
 		return true // continue iteration
 	})
 
@@ -272,30 +558,93 @@ func (lm *LoggerManager) GetAggregatedFlushMetrics() FlushMetrics {
 		TotalFlushDuration: time.Duration(totalFlushDuration),
 		AvgFlushDuration:   avgFlushDuration,
 		MaxFlushDuration:   time.Duration(maxFlushDuration),
-		FlushQueueDepth:    0, // Not aggregated
+		FlushQueueDepth:    totalQueueDepth,
 		BlockedSwaps:       totalBlockedSwaps,
 		TotalFlushes:       totalFlushes,
+		FlushErrors:        totalFlushErrors,
 		AvgWriteDuration:   avgWriteDuration,
 		MaxWriteDuration:   time.Duration(maxWriteDuration),
 		WritePercent:       writePercent,
 		AvgPwritevDuration: avgPwritevDuration,
 		MaxPwritevDuration: time.Duration(maxPwritevDuration),
 		PwritevPercent:     pwritevPercent,
+
+		PayloadBytes:            payload,
+		HeaderBytes:             header,
+		PaddingBytes:            padding,
+		WriteAmplificationRatio: writeAmplification(payload, header, padding),
+
+		CompactedFlushes:  compacted,
+		PaddingBytesSaved: saved,
 	}
 }
 
+// GetAggregatedBackpressureStats returns blocked-write statistics summed across all event loggers
+// maxBlocked is the longest single wait seen by any event logger
+func (lm *LoggerManager) GetAggregatedBackpressureStats() (blockedWrites int64, totalBlocked, maxBlocked time.Duration) {
+	lm.loggers.Range(func(key, value interface{}) bool {
+		bw, tb, mb := value.(*Logger).GetBackpressureStats()
+		blockedWrites += bw
+		totalBlocked += tb
+		if mb > maxBlocked {
+			maxBlocked = mb
+		}
+		return true // continue iteration
+	})
+
+	return blockedWrites, totalBlocked, maxBlocked
+}
+
+// GetAggregatedWritePathStats returns write path counters summed across all event loggers
+func (lm *LoggerManager) GetAggregatedWritePathStats() (fastPath, retryPath, retryTimeouts int64) {
+	lm.loggers.Range(func(key, value interface{}) bool {
+		f, r, t := value.(*Logger).GetWritePathStats()
+		fastPath += f
+		retryPath += r
+		retryTimeouts += t
+		return true // continue iteration
+	})
+
+	return fastPath, retryPath, retryTimeouts
+}
+
 // GetEventStats returns statistics for a specific event logger
-func (lm *LoggerManager) GetEventStats(eventName string) (totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps int64, err error) {
+func (lm *LoggerManager) GetEventStats(eventName string) (totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, bytesBuffered, bytesDurable int64, err error) {
+	sanitized, err := sanitizeEventName(eventName)
+	if err != nil {
+		return 0, 0, 0, 0, 0, 0, 0, 0, fmt.Errorf("invalid event name: %w", err)
+	}
+
+	logger, exists := lm.loggers.Load(sanitized)
+	if !exists {
+		return 0, 0, 0, 0, 0, 0, 0, 0, fmt.Errorf("event logger not found: %s", sanitized)
+	}
+
+	totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, bytesBuffered, bytesDurable = logger.(*Logger).GetStatsSnapshot()
+	return totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, bytesBuffered, bytesDurable, nil
+}
+
+// GetEventShardStats returns per-shard statistics for a specific event logger
+func (lm *LoggerManager) GetEventShardStats(eventName string) ([]ShardStats, error) {
 	sanitized, err := sanitizeEventName(eventName)
 	if err != nil {
-		return 0, 0, 0, 0, 0, 0, fmt.Errorf("invalid event name: %w", err)
+		return nil, fmt.Errorf("invalid event name: %w", err)
 	}
 
 	logger, exists := lm.loggers.Load(sanitized)
 	if !exists {
-		return 0, 0, 0, 0, 0, 0, fmt.Errorf("event logger not found: %s", sanitized)
+		return nil, fmt.Errorf("event logger not found: %s", sanitized)
 	}
+	return logger.(*Logger).GetShardStats(), nil
+}
 
-	totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps = logger.(*Logger).GetStatsSnapshot()
-	return totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, nil
+// GetShardStatsByEvent returns the per-shard statistics of every event logger, keyed by event name
+// Drops and retries of an event piling up on one shard point at a hot shard (see ShardStats)
+func (lm *LoggerManager) GetShardStatsByEvent() map[string][]ShardStats {
+	stats := make(map[string][]ShardStats)
+	lm.RangeEventLoggers(func(eventName string, logger *Logger) bool {
+		stats[eventName] = logger.GetShardStats()
+		return true
+	})
+	return stats
 }
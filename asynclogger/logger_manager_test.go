@@ -1,6 +1,7 @@
 package asynclogger
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -97,9 +98,6 @@ func TestLoggerManager_LogBytesWithEvent(t *testing.T) {
 		data := []byte("test message\n")
 		lm.LogBytesWithEvent("payment", data)
 
-		// Wait for flush
-		time.Sleep(200 * time.Millisecond)
-
 		// Verify logger was created
 		assert.True(t, lm.HasEventLogger("payment"))
 
@@ -113,8 +111,6 @@ func TestLoggerManager_LogBytesWithEvent(t *testing.T) {
 		lm.LogBytesWithEvent("payment", []byte("payment log\n"))
 		lm.LogBytesWithEvent("login", []byte("login log\n"))
 
-		time.Sleep(200 * time.Millisecond)
-
 		// Verify both loggers exist
 		assert.True(t, lm.HasEventLogger("payment"))
 		assert.True(t, lm.HasEventLogger("login"))
@@ -134,7 +130,7 @@ func TestLoggerManager_LogBytesWithEvent(t *testing.T) {
 		require.NoError(t, err)
 		defer lm2.Close()
 
-		initialStats, _, _, _, _, _ := lm2.GetStatsSnapshot()
+		initialStats, _, _, _, _, _, _, _ := lm2.GetStatsSnapshot()
 
 		// Empty string is truly invalid and will be dropped
 		lm2.LogBytesWithEvent("", []byte("should be dropped\n"))
@@ -143,8 +139,7 @@ func TestLoggerManager_LogBytesWithEvent(t *testing.T) {
 		// So it will create a logger, not drop the log
 		lm2.LogBytesWithEvent("invalid/name", []byte("will be sanitized\n"))
 
-		time.Sleep(100 * time.Millisecond)
-		finalStats, _, _, _, _, _ := lm2.GetStatsSnapshot()
+		finalStats, _, _, _, _, _, _, _ := lm2.GetStatsSnapshot()
 
 		// Empty string should not create a logger
 		assert.False(t, lm2.HasEventLogger(""))
@@ -167,7 +162,6 @@ func TestLoggerManager_LogWithEvent(t *testing.T) {
 	defer lm.Close()
 
 	lm.LogWithEvent("server", "server log message")
-	time.Sleep(200 * time.Millisecond)
 
 	assert.True(t, lm.HasEventLogger("server"))
 
@@ -236,7 +230,6 @@ func TestLoggerManager_CloseEventLogger(t *testing.T) {
 	t.Run("closes existing logger", func(t *testing.T) {
 		// Create logger and log some data
 		lm.LogBytesWithEvent("payment", []byte("test message\n"))
-		time.Sleep(200 * time.Millisecond)
 
 		assert.True(t, lm.HasEventLogger("payment"))
 
@@ -346,8 +339,6 @@ func TestLoggerManager_Close(t *testing.T) {
 		lm.LogBytesWithEvent("payment", []byte("test\n"))
 		lm.LogBytesWithEvent("login", []byte("test\n"))
 
-		time.Sleep(200 * time.Millisecond)
-
 		err := lm.Close()
 		assert.NoError(t, err)
 
@@ -395,6 +386,7 @@ func TestLoggerManager_GetStatsSnapshot(t *testing.T) {
 	logPath := filepath.Join(t.TempDir(), "test.log")
 	config := DefaultConfig(logPath)
 	config.FlushInterval = 100 * time.Millisecond
+	fake := useFakeClock(&config)
 
 	lm, err := NewLoggerManager(config)
 	require.NoError(t, err)
@@ -405,9 +397,14 @@ func TestLoggerManager_GetStatsSnapshot(t *testing.T) {
 		lm.LogBytesWithEvent("payment", []byte("payment 2\n"))
 		lm.LogBytesWithEvent("login", []byte("login 1\n"))
 
-		time.Sleep(200 * time.Millisecond)
+		// Each logger flushes on its next tick
+		fake.Advance(config.FlushInterval)
+		require.Eventually(t, func() bool {
+			_, _, _, flushes, _, _, _, _ := lm.GetStatsSnapshot()
+			return flushes >= 2
+		}, 5*time.Second, time.Millisecond)
 
-		totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps := lm.GetStatsSnapshot()
+		totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, _, _ := lm.GetStatsSnapshot()
 
 		assert.Equal(t, int64(3), totalLogs)
 		assert.Equal(t, int64(0), droppedLogs)
@@ -422,7 +419,7 @@ func TestLoggerManager_GetStatsSnapshot(t *testing.T) {
 		require.NoError(t, err)
 		defer lm2.Close()
 
-		totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps := lm2.GetStatsSnapshot()
+		totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, _, _ := lm2.GetStatsSnapshot()
 
 		assert.Equal(t, int64(0), totalLogs)
 		assert.Equal(t, int64(0), droppedLogs)
@@ -437,6 +434,7 @@ func TestLoggerManager_GetEventStats(t *testing.T) {
 	logPath := filepath.Join(t.TempDir(), "test.log")
 	config := DefaultConfig(logPath)
 	config.FlushInterval = 100 * time.Millisecond
+	fake := useFakeClock(&config)
 
 	lm, err := NewLoggerManager(config)
 	require.NoError(t, err)
@@ -446,9 +444,14 @@ func TestLoggerManager_GetEventStats(t *testing.T) {
 		lm.LogBytesWithEvent("payment", []byte("payment message\n"))
 		lm.LogBytesWithEvent("payment", []byte("payment message 2\n"))
 
-		time.Sleep(200 * time.Millisecond)
+		// The logger flushes on its next tick
+		fake.Advance(config.FlushInterval)
+		require.Eventually(t, func() bool {
+			_, _, _, flushes, _, _, _, _, _ := lm.GetEventStats("payment")
+			return flushes > 0
+		}, 5*time.Second, time.Millisecond)
 
-		totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, err := lm.GetEventStats("payment")
+		totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, _, _, err := lm.GetEventStats("payment")
 		require.NoError(t, err)
 
 		assert.Equal(t, int64(2), totalLogs)
@@ -460,13 +463,13 @@ func TestLoggerManager_GetEventStats(t *testing.T) {
 	})
 
 	t.Run("returns error for non-existent event", func(t *testing.T) {
-		_, _, _, _, _, _, err := lm.GetEventStats("nonexistent")
+		_, _, _, _, _, _, _, _, err := lm.GetEventStats("nonexistent")
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "event logger not found")
 	})
 
 	t.Run("returns error for invalid event name", func(t *testing.T) {
-		_, _, _, _, _, _, err := lm.GetEventStats("")
+		_, _, _, _, _, _, _, _, err := lm.GetEventStats("")
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "invalid event name")
 	})
@@ -499,14 +502,13 @@ func TestLoggerManager_ConcurrentAccess(t *testing.T) {
 		}
 
 		wg.Wait()
-		time.Sleep(200 * time.Millisecond)
 
 		// Verify all events were created
 		events := lm.ListEventLoggers()
 		assert.Len(t, events, 5)
 
 		// Verify stats
-		totalLogs, droppedLogs, _, _, flushErrors, _ := lm.GetStatsSnapshot()
+		totalLogs, droppedLogs, _, _, flushErrors, _, _, _ := lm.GetStatsSnapshot()
 		expectedLogs := int64(numGoroutines * eventsPerGoroutine)
 		assert.Equal(t, expectedLogs, totalLogs)
 		assert.Equal(t, int64(0), droppedLogs)
@@ -532,10 +534,9 @@ func TestLoggerManager_ConcurrentAccess(t *testing.T) {
 		}
 
 		wg.Wait()
-		time.Sleep(200 * time.Millisecond)
 
 		// Verify no errors occurred
-		_, droppedLogs, _, _, flushErrors, _ := lm.GetStatsSnapshot()
+		_, droppedLogs, _, _, flushErrors, _, _, _ := lm.GetStatsSnapshot()
 		assert.Equal(t, int64(0), droppedLogs)
 		assert.Equal(t, int64(0), flushErrors)
 	})
@@ -547,7 +548,6 @@ func TestLoggerManager_ConcurrentAccess(t *testing.T) {
 		// Create some loggers
 		lm2.LogBytesWithEvent("temp1", []byte("test\n"))
 		lm2.LogBytesWithEvent("temp2", []byte("test\n"))
-		time.Sleep(100 * time.Millisecond)
 
 		var wg sync.WaitGroup
 		wg.Add(3)
@@ -569,7 +569,6 @@ func TestLoggerManager_ConcurrentAccess(t *testing.T) {
 		}()
 
 		wg.Wait()
-		time.Sleep(100 * time.Millisecond)
 
 		// temp1 should be closed, temp2 and temp3 should exist
 		assert.False(t, lm2.HasEventLogger("temp1"))
@@ -593,8 +592,6 @@ func TestLoggerManager_EventNameSanitizationInFileNames(t *testing.T) {
 		lm.LogBytesWithEvent("login event", []byte("test\n"))
 		lm.LogBytesWithEvent("order*test", []byte("test\n"))
 
-		time.Sleep(100 * time.Millisecond)
-
 		// Verify files exist with sanitized names
 		paymentLog := filepath.Join(lm.baseDir, "payment_event.log")
 		loginLog := filepath.Join(lm.baseDir, "login_event.log")
@@ -632,7 +629,6 @@ func TestLoggerManager_LoadOrStoreRaceCondition(t *testing.T) {
 		}
 
 		wg.Wait()
-		time.Sleep(100 * time.Millisecond)
 
 		// Should have only one logger instance
 		events := lm.ListEventLoggers()
@@ -645,8 +641,215 @@ func TestLoggerManager_LoadOrStoreRaceCondition(t *testing.T) {
 		assert.Equal(t, 1, raceTestCount)
 
 		// Verify stats
-		totalLogs, _, _, _, _, _ := lm.GetStatsSnapshot()
+		totalLogs, _, _, _, _, _, _, _ := lm.GetStatsSnapshot()
 		assert.Equal(t, int64(numGoroutines), totalLogs)
 	})
 }
 
+func TestLoggerManager_TryLogBytesWithEvent(t *testing.T) {
+	config := DefaultConfig(filepath.Join(t.TempDir(), "base.log"))
+	config.BufferSize = 64 * 1024
+	config.NumShards = 1
+
+	lm, err := NewLoggerManager(config)
+	require.NoError(t, err)
+
+	assert.NoError(t, lm.TryLogBytesWithEvent("payment", []byte("ok")))
+	assert.Equal(t, ErrOversized, lm.TryLogBytesWithEvent("payment", make([]byte, 128*1024)))
+	assert.Error(t, lm.TryLogBytesWithEvent("", []byte("no event")))
+	require.NoError(t, lm.Close())
+}
+
+func TestLoggerManager_Flush(t *testing.T) {
+	tempDir := t.TempDir()
+	config := DefaultConfig(filepath.Join(tempDir, "base.log"))
+	config.BufferSize = 128 * 1024
+	config.NumShards = 2
+	config.FlushInterval = time.Hour
+
+	lm, err := NewLoggerManager(config)
+	require.NoError(t, err)
+	defer lm.Close()
+
+	lm.LogWithEvent("payment", "paid")
+	lm.LogWithEvent("login", "logged in")
+
+	require.NoError(t, lm.FlushEvent("payment", context.Background()))
+	assert.Equal(t, 1, countLogRecords(t, filepath.Join(tempDir, "payment.log")))
+	assert.Equal(t, 0, countLogRecords(t, filepath.Join(tempDir, "login.log")))
+
+	require.NoError(t, lm.FlushAll(context.Background()))
+	assert.Equal(t, 1, countLogRecords(t, filepath.Join(tempDir, "login.log")))
+
+	assert.Error(t, lm.FlushEvent("unknown", context.Background()))
+}
+
+func TestLoggerManager_EventConfig(t *testing.T) {
+	newBaseConfig := func(t *testing.T) Config {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "base.log"))
+		config.BufferSize = 128 * 1024
+		config.NumShards = 2
+		config.FlushInterval = time.Hour
+		return config
+	}
+
+	t.Run("events run with different buffers and flush cadences", func(t *testing.T) {
+		config := newBaseConfig(t)
+		baseDir := filepath.Dir(config.LogFilePath)
+
+		lm, err := NewLoggerManagerWithEventConfigs(config, map[string]EventConfig{
+			"payment": {BufferSize: 512 * 1024, NumShards: 4, FlushInterval: 20 * time.Millisecond},
+		})
+		require.NoError(t, err)
+		defer lm.Close()
+
+		lm.LogWithEvent("payment", "paid")
+		lm.LogWithEvent("debug", "noise")
+
+		payment, err := lm.getOrCreateLogger("payment")
+		require.NoError(t, err)
+		debug, err := lm.getOrCreateLogger("debug")
+		require.NoError(t, err)
+		assert.Equal(t, 512*1024, payment.config.BufferSize)
+		assert.Equal(t, 4, payment.setA.NumShards())
+		assert.Equal(t, 128*1024, debug.config.BufferSize)
+		assert.Equal(t, 2, debug.setA.NumShards())
+
+		// Only payment's interval elapses
+		require.Eventually(t, func() bool {
+			return countLogRecords(t, filepath.Join(baseDir, "payment.log")) == 1
+		}, 2*time.Second, 10*time.Millisecond)
+		assert.Equal(t, 0, countLogRecords(t, filepath.Join(baseDir, "debug.log")))
+	})
+
+	t.Run("rejects overrides for existing logger", func(t *testing.T) {
+		lm, err := NewLoggerManager(newBaseConfig(t))
+		require.NoError(t, err)
+		defer lm.Close()
+
+		require.NoError(t, lm.InitializeEventLogger("payment"))
+		err = lm.SetEventConfig("payment", EventConfig{FlushInterval: time.Second})
+		assert.ErrorIs(t, err, ErrEventLoggerExists)
+
+		// Closing the logger lets the next one pick up the overrides
+		require.NoError(t, lm.CloseEventLogger("payment"))
+		require.NoError(t, lm.SetEventConfig("payment", EventConfig{FlushInterval: time.Second}))
+		logger, err := lm.getOrCreateLogger("payment")
+		require.NoError(t, err)
+		assert.Equal(t, time.Second, logger.config.FlushInterval)
+	})
+
+	t.Run("rejects invalid overrides", func(t *testing.T) {
+		_, err := NewLoggerManagerWithEventConfigs(newBaseConfig(t), map[string]EventConfig{
+			"tiny": {BufferSize: 64 * 1024, NumShards: 8},
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestLoggerManager_OnDrop(t *testing.T) {
+	drops := make(chan DropReason, 4)
+	config := DefaultConfig(filepath.Join(t.TempDir(), "base.log"))
+	config.BufferSize = 64 * 1024
+	config.NumShards = 1
+	config.OnDrop = func(reason DropReason, size int) { drops <- reason }
+
+	lm, err := NewLoggerManager(config)
+	require.NoError(t, err)
+	defer lm.Close()
+
+	expectDrop := func(t *testing.T, want DropReason) {
+		t.Helper()
+		select {
+		case got := <-drops:
+			assert.Equal(t, want, got)
+		case <-time.After(time.Second):
+			t.Fatalf("OnDrop was not called for %s", want)
+		}
+	}
+
+	t.Run("invalid event name", func(t *testing.T) {
+		err := lm.TryLogBytesWithEvent("", []byte("no event"))
+		assert.ErrorIs(t, err, ErrInvalidEventName)
+		expectDrop(t, DropReasonInvalidEventName)
+
+		lm.LogWithEvent("", "no event")
+		expectDrop(t, DropReasonInvalidEventName)
+	})
+
+	t.Run("event loggers inherit the callback", func(t *testing.T) {
+		lm.LogBytesWithEvent("payment", make([]byte, 128*1024))
+		expectDrop(t, DropReasonOversized)
+	})
+}
+
+func TestLoggerManager_CloseContext(t *testing.T) {
+	config := DefaultConfig(filepath.Join(t.TempDir(), "base.log"))
+	config.BufferSize = 64 * 1024
+	config.NumShards = 1
+	config.FlushInterval = time.Hour
+
+	lm, err := NewLoggerManager(config)
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		lm.LogWithEvent("payment", "paid")
+		lm.LogWithEvent("login", "logged in")
+	}
+
+	report, err := lm.CloseWithTimeout(5 * time.Second)
+	require.NoError(t, err)
+	assert.False(t, report.DeadlineExceeded)
+	assert.Equal(t, int64(10), report.EntriesFlushed)
+	assert.Equal(t, int64(0), report.EntriesDropped)
+	assert.Empty(t, lm.ListEventLoggers())
+}
+
+func TestLoggerManager_Drain(t *testing.T) {
+	drops := make(chan DropReason, 4)
+	config := DefaultConfig(filepath.Join(t.TempDir(), "base.log"))
+	config.BufferSize = 64 * 1024
+	config.NumShards = 1
+	config.FlushInterval = time.Hour
+	config.OnDrop = func(reason DropReason, size int) { drops <- reason }
+
+	lm, err := NewLoggerManager(config)
+	require.NoError(t, err)
+	defer lm.Close()
+
+	for i := 0; i < 5; i++ {
+		lm.LogWithEvent("payment", "paid")
+	}
+	lm.LogWithEvent("login", "logged in")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	report, err := lm.Drain(ctx)
+	require.NoError(t, err)
+	assert.False(t, report.DeadlineExceeded)
+	assert.Equal(t, int64(5), report.Events["payment"].EntriesFlushed)
+	assert.Equal(t, int64(1), report.Events["login"].EntriesFlushed)
+	assert.Equal(t, int64(6), report.EntriesFlushed)
+	assert.Positive(t, report.Events["payment"].BytesFlushed)
+
+	// Writes are refused, not dropped, and no logger is created
+	assert.ErrorIs(t, lm.TryLogBytesWithEvent("payment", []byte("late")), ErrDraining)
+	lm.LogBytesWithEvent("payment", []byte("late"))
+	lm.LogWithEvent("signup", "late")
+	assert.False(t, lm.HasEventLogger("signup"))
+	totalLogs, droppedLogs, _, _, _, _, _, _ := lm.GetStatsSnapshot()
+	assert.Equal(t, int64(6), totalLogs)
+	assert.Zero(t, droppedLogs)
+	assert.Empty(t, drops)
+
+	report, err = lm.Drain(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, report.EntriesFlushed)
+	assert.Equal(t, int64(2), report.Events["payment"].RejectedLogs)
+	assert.Equal(t, int64(1), report.RejectedUnknownEvents)
+	assert.Equal(t, int64(3), report.RejectedLogs)
+
+	closeReport, err := lm.CloseWithTimeout(5 * time.Second)
+	require.NoError(t, err)
+	assert.Zero(t, closeReport.EntriesFlushed, "Drain flushed everything")
+}
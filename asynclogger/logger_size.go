@@ -1,11 +1,12 @@
 package asynclogger
 
 import (
-	"encoding/binary"
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
-	"unsafe"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/internal/logcore"
 )
 
 // SizeLogger is an async logger using Sharded Double Buffer CAS with Direct I/O and size-based rotation
@@ -19,7 +20,7 @@ type SizeLogger struct {
 	activeSet atomic.Pointer[BufferSet]
 
 	// SizeFileWriter for writing logs with Direct I/O and size-based rotation support
-	fileWriter *SizeFileWriter
+	fileWriter FileWriter
 
 	// Channel for flush requests
 	flushChan chan *BufferSet
@@ -51,6 +52,15 @@ type SizeLogger struct {
 
 	// Closed flag
 	closed atomic.Bool
+
+	// Writes in progress (see beginWrite); Close waits for them before the final flush
+	writers atomic.Int64
+
+	// Closed when the first Close has finished; later Close calls wait for it
+	closeDone chan struct{}
+
+	// Flush and ticker workers (Close waits for both before the final flush)
+	workers sync.WaitGroup
 }
 
 // NewSizeLogger creates a new async logger with size-based rotation
@@ -78,15 +88,20 @@ func NewSizeLogger(config SizeConfig) (*SizeLogger, error) {
 		flushChan:     make(chan *BufferSet, 2), // Buffer for both sets
 		ticker:        time.NewTicker(config.FlushInterval),
 		done:          make(chan struct{}),
+		closeDone:     make(chan struct{}),
 		semaphore:     make(chan struct{}, 1),
 		swapSemaphore: make(chan struct{}, 30), // 30 permits for swap coordination
 		config:        config,
 	}
 
+	setA.spilled = &l.stats.SpilledWrites
+	setB.spilled = &l.stats.SpilledWrites
+
 	l.activeSet.Store(setA)
 	l.nextID.Store(2) // Start from 2 since setA=0, setB=1
 
 	// Start background workers
+	l.workers.Add(2)
 	go l.flushWorker()
 	go l.tickerWorker()
 
@@ -100,10 +115,11 @@ func (l *SizeLogger) LogBytes(data []byte) {
 	// Count every log attempt (successful + dropped)
 	l.stats.TotalLogs.Add(1)
 
-	if l.closed.Load() {
+	if !l.beginWrite() {
 		l.stats.DroppedLogs.Add(1)
 		return
 	}
+	defer l.endWrite()
 
 	// Get active set
 	activeSet := l.activeSet.Load()
@@ -113,63 +129,88 @@ func (l *SizeLogger) LogBytes(data []byte) {
 	}
 
 	// First attempt: Try to write (fast path)
-	n, needsFlush, _ := activeSet.Write(data)
+	n, needsFlush, shardID := activeSet.Write(data)
+	shard := activeSet.GetShard(shardID)
 
 	if n > 0 {
 		// Success! Trigger swap if needed (existing behavior)
+		l.stats.BytesBuffered.Add(int64(len(data)))
+		l.stats.FastPathWrites.Add(1)
 		if needsFlush {
-			l.trySwap()
+			shard.countSwap(l.trySwap())
 		}
 		return
 	}
 
 	// Buffer full - use semaphore retry mechanism
-	// Use non-blocking select with timeout to avoid blocking hot path
-	timeout := time.NewTimer(10 * time.Millisecond)
-	defer timeout.Stop()
-
-	select {
-	case l.swapSemaphore <- struct{}{}: // Acquired permit
-		defer func() { <-l.swapSemaphore }() // Release when done
-
-		// Re-check 1: Buffer might have been swapped by another thread
-		activeSet = l.activeSet.Load()
-		if activeSet == nil {
-			l.stats.DroppedLogs.Add(1)
-			return
-		}
+	// Waits at most WriteRetryTimeout for the permit so the hot path is bounded
+	l.stats.RetryPathWrites.Add(1)
+	shard.countRetry()
+	if !logcore.AcquirePermit(l.swapSemaphore, l.config.WriteRetryTimeout, nil) {
+		// Timeout: Couldn't acquire semaphore in time, drop log
+		l.stats.RetryTimeouts.Add(1)
+		l.stats.DroppedLogs.Add(1)
+		shard.countRetryTimeout()
+		shard.countDrop()
+		return
+	}
+	defer func() { <-l.swapSemaphore }() // Release when done
 
-		n, needsFlush, _ = activeSet.Write(data)
-		if n > 0 {
-			// Success after re-check!
-			if needsFlush {
-				l.trySwap()
-			}
-			return
-		}
+	// Re-check 1: Buffer might have been swapped by another thread
+	activeSet = l.activeSet.Load()
+	if activeSet == nil {
+		l.stats.DroppedLogs.Add(1)
+		return
+	}
 
-		// Still full - trigger swap (only one thread will succeed)
+	n, needsFlush, shardID = activeSet.Write(data)
+	shard = activeSet.GetShard(shardID)
+	if n > 0 {
+		// Success after re-check!
+		l.stats.BytesBuffered.Add(int64(len(data)))
 		if needsFlush {
-			l.trySwap()
+			shard.countSwap(l.trySwap())
 		}
+		return
+	}
 
-		// Re-check 2: After swap, try writing again
-		activeSet = l.activeSet.Load()
-		if activeSet == nil {
-			l.stats.DroppedLogs.Add(1)
-			return
-		}
+	// Still full - trigger swap (only one thread will succeed)
+	if needsFlush {
+		shard.countSwap(l.trySwap())
+	}
 
-		n, _, _ = activeSet.Write(data)
-		if n == 0 {
-			// Still failed after swap - drop log
-			l.stats.DroppedLogs.Add(1)
-		}
+	// Re-check 2: After swap, try writing again
+	activeSet = l.activeSet.Load()
+	if activeSet == nil {
+		l.stats.DroppedLogs.Add(1)
+		return
+	}
 
-	case <-timeout.C:
-		// Timeout: Couldn't acquire semaphore quickly, drop log
+	n, _, shardID = activeSet.Write(data)
+	if n == 0 {
+		// Still failed after swap - drop log
 		l.stats.DroppedLogs.Add(1)
+		activeSet.GetShard(shardID).countDrop()
+		return
 	}
+	l.stats.BytesBuffered.Add(int64(len(data)))
+}
+
+// beginWrite registers a write unless the logger is closed; endWrite ends it
+// Close marks the logger closed before waiting for registered writes, so every write either sees
+// the mark and is dropped, or is buffered before the final flush
+func (l *SizeLogger) beginWrite() bool {
+	l.writers.Add(1)
+	if l.closed.Load() {
+		l.writers.Add(-1)
+		return false
+	}
+	return true
+}
+
+// endWrite ends a write registered with beginWrite
+func (l *SizeLogger) endWrite() {
+	l.writers.Add(-1)
 }
 
 // Log writes a string message to the logger (convenience API)
@@ -177,22 +218,12 @@ func (l *SizeLogger) LogBytes(data []byte) {
 // For maximum performance in hot paths, use LogBytes() with a reused buffer.
 func (l *SizeLogger) Log(message string) {
 	// Convert string to []byte without allocation using unsafe
-	data := stringToBytesSize(message)
+	data := logcore.StringToBytes(message)
 	l.LogBytes(data)
 }
 
-// stringToBytesSize converts a string to []byte without allocation
-// Uses the string's backing array directly (read-only)
-func stringToBytesSize(s string) []byte {
-	if len(s) == 0 {
-		return nil
-	}
-	// Use unsafe to access string's backing array directly
-	return unsafe.Slice(unsafe.StringData(s), len(s))
-}
-
-// trySwap attempts to swap the active buffer set
-func (l *SizeLogger) trySwap() {
+// trySwap attempts to swap the active buffer set, reporting whether this call swapped it
+func (l *SizeLogger) trySwap() (swapped bool) {
 	// Check if already swapping
 	if !l.swapping.CompareAndSwap(false, true) {
 		return // Another goroutine is already swapping
@@ -213,6 +244,13 @@ func (l *SizeLogger) trySwap() {
 		nextSet = l.setA
 	}
 
+	// Never swap into a set that is still queued or being flushed: writes into it
+	// would be overwritten by its post-flush reset
+	if nextSet.PendingFlush() {
+		l.stats.FlushesCoalesced.Add(1)
+		return
+	}
+
 	// Assign new ID to next set
 	nextSet.SetID(l.nextID.Add(1))
 
@@ -224,17 +262,16 @@ func (l *SizeLogger) trySwap() {
 
 	l.stats.SetSwaps.Add(1)
 
-	// Send the old set for flushing (non-blocking)
-	select {
-	case l.flushChan <- currentSet:
-		// Successfully queued for flush
-	default:
-		// Channel full, skip this flush (data will be flushed on next interval or shutdown)
-	}
+	// Send the old set for flushing. Only a set that is not pending can be swapped out, so each
+	// set is queued at most once and the channel, with room for both, never blocks the send
+	currentSet.pendingFlush.Store(true)
+	l.flushChan <- currentSet
+	return true
 }
 
 // flushWorker processes flush requests
 func (l *SizeLogger) flushWorker() {
+	defer l.workers.Done()
 	for {
 		select {
 		case set := <-l.flushChan:
@@ -249,6 +286,7 @@ func (l *SizeLogger) flushWorker() {
 
 // tickerWorker triggers periodic flushes
 func (l *SizeLogger) tickerWorker() {
+	defer l.workers.Done()
 	for {
 		select {
 		case <-l.ticker.C:
@@ -287,42 +325,31 @@ func (l *SizeLogger) flushSet(set *BufferSet) {
 	// Headers are written directly into the buffer's reserved space, then buffer is used directly (zero-copy!)
 	numShards := len(set.Shards())
 	shardBuffers := make([][]byte, 0, numShards)
+	var acct flushBytes
 
 	for _, shard := range set.Shards() {
-		// Quick check: skip shards with no data (offset <= 8 means no data written)
-		if shard.Offset() <= 8 {
-			continue
-		}
-
-		// Get buffer data - this waits for all writes to complete
-		// After this returns, the offset is stable (no more writes can happen)
-		data, _ := shard.GetData(l.config.FlushTimeout)
-
-		// Read offset AFTER GetData() completes to ensure it reflects all completed writes
-		// This is safe because GetData() is called with shard mutex held, preventing concurrent writes
-		shardOffset := shard.Offset()
-		if shardOffset <= 8 {
-			// No data written (shouldn't happen if first check passed, but defensive)
+		// Get buffer data - this seals the shard and waits for all writes to complete
+		// After this returns, the offset is stable (no more writes can happen). Empty shards are
+		// sealed too: a writer still holding this set could otherwise write into one just before
+		// the reset below
+		sealed := shard.seal(l.config.FlushTimeout)
+		if sealed.data == nil {
+			// No data written (only the header reservation), or none committed before the timeout
 			continue
 		}
 
-		// Note: If complete is false, timeout occurred and last write may be incomplete
-		// This is acceptable - only the last incomplete write may be corrupted
+		// A seal that timed out holds only the entries written before it (see Buffer.seal)
+		data := sealed.data
 		capacity := shard.Capacity()
 		// validDataBytes is the actual data size (excluding the 8-byte header reservation)
-		validDataBytes := shardOffset - 8
-
-		// Defensive check: ensure validDataBytes is non-negative (should always be true)
-		if validDataBytes < 0 {
-			validDataBytes = 0
-		}
+		validDataBytes := sealed.end - headerOffset
 
 		// Write header directly into the first 8 bytes of the buffer (in-place, zero-copy!)
-		binary.LittleEndian.PutUint32(data[0:4], uint32(capacity))
-		binary.LittleEndian.PutUint32(data[4:8], uint32(validDataBytes))
+		logcore.PutShardHeader(data, uint32(capacity), validDataBytes)
 
 		// Use buffer directly - no copying needed! Header is already in place, data follows immediately
 		shardBuffers = append(shardBuffers, data)
+		acct.add(int64(len(data)), int64(validDataBytes), sealed.payload)
 	}
 
 	// Single batched write for all shards - track timing
@@ -334,41 +361,20 @@ func (l *SizeLogger) flushSet(set *BufferSet) {
 		// Track write duration (includes rotation checks)
 		writeDurationNs := writeDuration.Nanoseconds()
 		l.stats.TotalWriteDuration.Add(writeDurationNs)
-
-		// Update max write duration atomically
-		for {
-			currentMax := l.stats.MaxWriteDuration.Load()
-			if writeDurationNs <= currentMax {
-				break
-			}
-			if l.stats.MaxWriteDuration.CompareAndSwap(currentMax, writeDurationNs) {
-				break
-			}
-		}
+		logcore.StoreMax(&l.stats.MaxWriteDuration, writeDurationNs)
 
 		// Track Pwritev syscall duration (pure disk I/O, excludes rotation checks)
 		pwritevDuration := l.fileWriter.GetLastPwritevDuration()
 		if pwritevDuration > 0 {
 			pwritevDurationNs := pwritevDuration.Nanoseconds()
 			l.stats.TotalPwritevDuration.Add(pwritevDurationNs)
-
-			// Update max Pwritev duration atomically
-			for {
-				currentMax := l.stats.MaxPwritevDuration.Load()
-				if pwritevDurationNs <= currentMax {
-					break
-				}
-				if l.stats.MaxPwritevDuration.CompareAndSwap(currentMax, pwritevDurationNs) {
-					break
-				}
-			}
+			logcore.StoreMax(&l.stats.MaxPwritevDuration, pwritevDurationNs)
 		}
 
 		if err != nil {
 			l.stats.FlushErrors.Add(1)
 			// Log flush error details for debugging
-			// Note: Using fmt.Printf to avoid circular dependency on logger
-			fmt.Printf("[FLUSH_ERROR] Logger=%s SetID=%d Shards=%d Bytes=%d Error=%v Duration=%v\n",
+			l.config.InternalLogger.Printf("[FLUSH_ERROR] Logger=%s SetID=%d Shards=%d Bytes=%d Error=%v Duration=%v",
 				l.config.LogFilePath, set.ID(), len(shardBuffers), func() int {
 					total := 0
 					for _, buf := range shardBuffers {
@@ -378,14 +384,16 @@ func (l *SizeLogger) flushSet(set *BufferSet) {
 				}(), err, writeDuration)
 		} else {
 			l.stats.BytesWritten.Add(int64(n))
+			l.stats.recordFlushBytes(acct)
 			l.stats.Flushes.Add(1)
 		}
 	}
 
-	// Reset all shards after flush attempt
+	// Reset all shards after flush attempt, then let swaps reuse this set
 	for _, shard := range set.Shards() {
 		shard.Reset()
 	}
+	set.pendingFlush.Store(false)
 
 	// Note: With O_DSYNC flag, each write() automatically syncs data to disk
 	// No explicit file.Sync() call needed - sync happens during WriteVectored()
@@ -394,17 +402,7 @@ func (l *SizeLogger) flushSet(set *BufferSet) {
 	flushDuration := time.Since(flushStart)
 	flushDurationNs := flushDuration.Nanoseconds()
 	l.stats.TotalFlushDuration.Add(flushDurationNs)
-
-	// Update max flush duration atomically
-	for {
-		currentMax := l.stats.MaxFlushDuration.Load()
-		if flushDurationNs <= currentMax {
-			break
-		}
-		if l.stats.MaxFlushDuration.CompareAndSwap(currentMax, flushDurationNs) {
-			break
-		}
-	}
+	logcore.StoreMax(&l.stats.MaxFlushDuration, flushDurationNs)
 }
 
 // drainFlushChannel flushes all pending buffer sets in the channel
@@ -419,12 +417,38 @@ func (l *SizeLogger) drainFlushChannel() {
 	}
 }
 
+// CloseSummary describes the files a SizeLogger leaves behind, as returned by CloseWithSummary
+// (Logger's counterpart is CloseReport)
+type CloseSummary struct {
+	FinalFile      string // The file written last, completed by Close
+	FinalFileBytes int64  // Bytes in FinalFile (whole shard buffers, including their headers)
+	Rotations      int64  // Size rotations over the logger's life: Rotations+1 files were written
+	Flushes        int64  // Buffer sets flushed during Close (queued and buffered sets)
+}
+
 // Close gracefully shuts down the logger, flushing all pending data
+// Equivalent to CloseWithSummary without the summary
 func (l *SizeLogger) Close() error {
+	_, err := l.CloseWithSummary()
+	return err
+}
+
+// CloseWithSummary shuts down the logger: logs after it starts are dropped, writes already in
+// progress are flushed, then the queued and buffered sets are flushed, oldest first, into the
+// current file before it is synced and closed. An unused preallocated next file is removed, so
+// RotatedFiles lists every file written. A failed final flush is returned as an error.
+// Closing an already closed logger waits for the first Close to return, then returns an empty
+// summary and nil
+func (l *SizeLogger) CloseWithSummary() (CloseSummary, error) {
 	// Check if already closed
 	if !l.closed.CompareAndSwap(false, true) {
-		return nil // Already closed
+		<-l.closeDone
+		return CloseSummary{}, nil // Already closed
 	}
+	defer close(l.closeDone)
+
+	flushesBefore := l.stats.Flushes.Load()
+	flushErrorsBefore := l.stats.FlushErrors.Load()
 
 	// Stop the ticker
 	l.ticker.Stop()
@@ -432,42 +456,62 @@ func (l *SizeLogger) Close() error {
 	// Signal workers to stop
 	close(l.done)
 
-	// Give workers time to finish
-	time.Sleep(100 * time.Millisecond)
+	// Wait for the writes that passed the closed check, then for the flush worker to drain the
+	// queued sets and exit, so no set is flushed twice or reset under a writer
+	for l.writers.Load() > 0 {
+		time.Sleep(closeWriterPollInterval)
+	}
+	l.workers.Wait()
 
-	// Flush the currently active set
-	activeSet := l.activeSet.Load()
-	if activeSet != nil && activeSet.HasData() {
-		l.flushSet(activeSet)
+	// Flush both sets, oldest entries first
+	for _, set := range closeFlushOrder(l.activeSet.Load(), l.setA, l.setB) {
+		if set.HasData() {
+			l.flushSet(set)
+		}
 	}
 
-	// Flush the inactive set if it has data
-	var inactiveSet *BufferSet
-	if activeSet.ID() == l.setA.ID() {
-		inactiveSet = l.setB
-	} else {
-		inactiveSet = l.setA
+	var err error
+	if failed := l.stats.FlushErrors.Load() - flushErrorsBefore; failed > 0 {
+		err = fmt.Errorf("final flush failed: %d of %d flushes during close", failed, failed+l.stats.Flushes.Load()-flushesBefore)
 	}
-	if inactiveSet != nil && inactiveSet.HasData() {
-		l.flushSet(inactiveSet)
+
+	// Close the file writer (completes the current file)
+	if closeErr := l.fileWriter.Close(); closeErr != nil {
+		err = fmt.Errorf("failed to close file writer: %w", closeErr)
 	}
 
-	// Close the file writer (handles rotation cleanup)
-	if err := l.fileWriter.Close(); err != nil {
-		return fmt.Errorf("failed to close file writer: %w", err)
+	summary := CloseSummary{Flushes: l.stats.Flushes.Load() - flushesBefore}
+	if w, ok := l.fileWriter.(*SizeFileWriter); ok {
+		if last, ok := w.rotations.last(); ok && last.Reason == RotationClose {
+			summary.FinalFile = last.OldPath
+			summary.FinalFileBytes = last.Bytes
+		}
+		summary.Rotations = w.rotations.sizeRotations()
 	}
+	return summary, err
+}
 
+// RotatedFiles returns the last SizeConfig.RotationHistory completed files, oldest first
+// Poll it instead of the log directory, or set SizeConfig.RotationCallback to be notified
+func (l *SizeLogger) RotatedFiles() []RotationInfo {
+	if w, ok := l.fileWriter.(*SizeFileWriter); ok {
+		return w.RotatedFiles()
+	}
 	return nil
 }
 
 // GetStatsSnapshot returns current statistics values
-func (l *SizeLogger) GetStatsSnapshot() (totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps int64) {
+// bytesWritten counts file bytes of successful flushes (including headers and padding);
+// bytesBuffered and bytesDurable count log payload only (see Statistics.BytesBuffered, BytesDurable)
+func (l *SizeLogger) GetStatsSnapshot() (totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, bytesBuffered, bytesDurable int64) {
 	return l.stats.TotalLogs.Load(),
 		l.stats.DroppedLogs.Load(),
 		l.stats.BytesWritten.Load(),
 		l.stats.Flushes.Load(),
 		l.stats.FlushErrors.Load(),
-		l.stats.SetSwaps.Load()
+		l.stats.SetSwaps.Load(),
+		l.stats.BytesBuffered.Load(),
+		l.stats.BytesDurable.Load()
 }
 
 // GetFlushMetrics returns flush performance metrics
@@ -476,6 +520,9 @@ func (l *SizeLogger) GetFlushMetrics() FlushMetrics {
 	totalWrite := l.stats.TotalWriteDuration.Load()
 	totalPwritev := l.stats.TotalPwritevDuration.Load()
 	flushes := l.stats.Flushes.Load()
+	payload := l.stats.BytesDurable.Load()
+	header := l.stats.HeaderBytesFlushed.Load()
+	padding := l.stats.PaddingBytesFlushed.Load()
 
 	avgFlushDuration := time.Duration(0)
 	avgWriteDuration := time.Duration(0)
@@ -501,15 +548,29 @@ func (l *SizeLogger) GetFlushMetrics() FlushMetrics {
 		FlushQueueDepth:    l.stats.FlushQueueDepth.Load(),
 		BlockedSwaps:       l.stats.BlockedSwaps.Load(),
 		TotalFlushes:       flushes,
+		FlushErrors:        l.stats.FlushErrors.Load(),
 		AvgWriteDuration:   avgWriteDuration,
 		MaxWriteDuration:   time.Duration(l.stats.MaxWriteDuration.Load()),
 		WritePercent:       writePercent,
 		AvgPwritevDuration: avgPwritevDuration,
 		MaxPwritevDuration: time.Duration(l.stats.MaxPwritevDuration.Load()),
 		PwritevPercent:     pwritevPercent,
+
+		PayloadBytes:            payload,
+		HeaderBytes:             header,
+		PaddingBytes:            padding,
+		WriteAmplificationRatio: writeAmplification(payload, header, padding),
 	}
 }
 
+// GetWritePathStats returns how many writes succeeded on the fast path, entered the retry path,
+// and were dropped because the retry path timed out waiting for the swap semaphore
+func (l *SizeLogger) GetWritePathStats() (fastPath, retryPath, retryTimeouts int64) {
+	return l.stats.FastPathWrites.Load(),
+		l.stats.RetryPathWrites.Load(),
+		l.stats.RetryTimeouts.Load()
+}
+
 // GetShardStats returns per-shard statistics from the currently active set
 func (l *SizeLogger) GetShardStats() []ShardStats {
 	activeSet := l.activeSet.Load()
@@ -517,28 +578,10 @@ func (l *SizeLogger) GetShardStats() []ShardStats {
 		return nil
 	}
 
-	shards := activeSet.Shards()
-	stats := make([]ShardStats, len(shards))
-
-	for i, shard := range shards {
-		// Offset includes the 8-byte header reservation, so subtract it for actual data size
-		bytesUsed := shard.Offset() - 8
-		capacity := shard.Capacity()
-		utilizationPct := 0.0
-		if capacity > 0 {
-			// Utilization is based on usable capacity (excluding header reservation)
-			utilizationPct = float64(bytesUsed) / float64(capacity-8) * 100.0
-		}
-
-		stats[i] = ShardStats{
-			ShardID:        i,
-			WriteCount:     shard.buffer.WriteCount(),
-			BytesUsed:      bytesUsed,
-			Capacity:       capacity,
-			UtilizationPct: utilizationPct,
-		}
+	otherSet := l.setA
+	if activeSet == l.setA {
+		otherSet = l.setB
 	}
-
-	return stats
+	return collectShardStats(activeSet, otherSet)
 }
 
@@ -1,18 +1,48 @@
 package asynclogger
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/clock"
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/reader"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// testClockStart is the time fake clocks start at in tests (rotated files are named after it)
+var testClockStart = time.Date(2025, 3, 14, 9, 26, 53, 0, time.UTC)
+
+// useFakeClock sets a clock.Fake reading testClockStart as config's Clock and returns it
+func useFakeClock(config *Config) *clock.Fake {
+	fake := clock.NewFake(testClockStart)
+	config.Clock = fake
+	return fake
+}
+
+// waitForFlushes waits until logger has finished n flushes, failed ones included, e.g. those
+// triggered by advancing its fake clock
+func waitForFlushes(t *testing.T, logger *Logger, n int64) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		return logger.stats.Flushes.Load()+logger.stats.FlushErrors.Load() >= n
+	}, 5*time.Second, time.Millisecond, "waiting for %d flushes", n)
+}
+
 func TestConfig_Validate(t *testing.T) {
 	t.Run("valid config", func(t *testing.T) {
 		config := DefaultConfig("/tmp/test.log")
@@ -48,12 +78,162 @@ func TestConfig_Validate(t *testing.T) {
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "shard size too small")
 	})
+
+	t.Run("write retry timeout", func(t *testing.T) {
+		config := DefaultConfig("/tmp/test.log")
+		require.NoError(t, config.Validate())
+		assert.Equal(t, 10*time.Millisecond, config.WriteRetryTimeout)
+
+		config.WriteRetryTimeout = -time.Millisecond
+		assert.Error(t, config.Validate())
+	})
+
+	t.Run("max file size", func(t *testing.T) {
+		config := DefaultConfig("/tmp/test.log")
+		require.NoError(t, config.Validate())
+		assert.Equal(t, int64(0), config.MaxFileSize)
+
+		// Size and time rotation can be combined
+		config.MaxFileSize = 1024 * 1024 * 1024
+		assert.NoError(t, config.Validate())
+
+		config.MaxFileSize = -1
+		assert.Error(t, config.Validate())
+	})
+
+	t.Run("drop policy", func(t *testing.T) {
+		config := Config{LogFilePath: "/tmp/test.log"}
+		require.NoError(t, config.Validate())
+		assert.Equal(t, DropPolicyDrop, config.DropPolicy)
+
+		config.DropPolicy = DropPolicyBlock
+		assert.NoError(t, config.Validate())
+
+		config.DropPolicy = "wait"
+		assert.Error(t, config.Validate())
+	})
+
+	t.Run("io mode", func(t *testing.T) {
+		config := Config{LogFilePath: "/tmp/test.log"}
+		require.NoError(t, config.Validate())
+		assert.Equal(t, IOModeDirectSync, config.IOMode)
+		assert.Equal(t, time.Second, config.SyncInterval)
+
+		for _, mode := range []IOMode{IOModeDirectAsync, IOModeBuffered} {
+			config.IOMode = mode
+			assert.NoError(t, config.Validate())
+		}
+
+		config.IOMode = "mmap"
+		assert.Error(t, config.Validate())
+	})
+
+	t.Run("shard flush threshold pct", func(t *testing.T) {
+		config := Config{LogFilePath: "/tmp/test.log"}
+		require.NoError(t, config.Validate())
+		assert.Equal(t, 90, config.ShardFlushThresholdPct)
+		assert.Equal(t, 90, DefaultConfig("/tmp/test.log").ShardFlushThresholdPct)
+
+		for _, pct := range []int{1, 100} {
+			config.ShardFlushThresholdPct = pct
+			assert.NoError(t, config.Validate())
+		}
+		for _, pct := range []int{-1, 101} {
+			config.ShardFlushThresholdPct = pct
+			assert.Error(t, config.Validate())
+		}
+	})
+}
+
+func TestConfig_ValidateCombinations(t *testing.T) {
+	maxShards := runtime.GOMAXPROCS(0) * shardsPerProc
+
+	t.Run("max file size below one shard", func(t *testing.T) {
+		config := DefaultConfig("/tmp/test.log")
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 4
+		config.MaxFileSize = 64 * 1024
+		err := config.Validate()
+		require.Error(t, err)
+		assert.Equal(t, "MaxFileSize (65536 bytes) is smaller than one shard (262144 bytes), so every flush would rotate; set it to at least 262144 or use smaller shards", err.Error())
+		assert.Equal(t, "invalid config: "+err.Error(), config.Explain())
+
+		config.MaxFileSize = 256 * 1024 // Exactly one shard
+		assert.NoError(t, config.Validate())
+	})
+
+	t.Run("flush timeout not shorter than flush interval", func(t *testing.T) {
+		config := DefaultConfig("/tmp/test.log")
+		config.FlushInterval = 10 * time.Millisecond
+		config.FlushTimeout = time.Second
+		require.NoError(t, config.Validate())
+		assert.Equal(t, 5*time.Millisecond, config.FlushTimeout)
+	})
+
+	t.Run("buffer size not a multiple of num shards", func(t *testing.T) {
+		config := DefaultConfig("/tmp/test.log")
+		config.BufferSize = 1024*1024 + 3
+		config.NumShards = 4
+		require.NoError(t, config.Validate())
+		assert.Equal(t, 1024*1024, config.BufferSize)
+	})
+
+	t.Run("more shards than GOMAXPROCS can use", func(t *testing.T) {
+		config := DefaultConfig("/tmp/test.log")
+		config.NumShards = maxShards + 1
+		config.BufferSize = config.NumShards * 64 * 1024
+		require.NoError(t, config.Validate())
+		assert.Equal(t, maxShards, config.NumShards)
+		assert.Zero(t, config.BufferSize%config.NumShards)
+	})
+
+	t.Run("size config", func(t *testing.T) {
+		config := DefaultSizeConfig("/tmp/test.log")
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 4
+		config.MaxFileSize = 64 * 1024
+		err := config.Validate()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "MaxFileSize (65536 bytes) is smaller than one shard (262144 bytes)")
+
+		config = DefaultSizeConfig("/tmp/test.log")
+		config.NumShards = maxShards + 1
+		config.BufferSize = config.NumShards*64*1024 + 3
+		config.FlushInterval = 10 * time.Millisecond
+		config.FlushTimeout = 10 * time.Millisecond
+		config.MaxFileSize = 16 * 1024 * 1024
+		config.PreallocateFileSize = 32 * 1024 * 1024
+		require.NoError(t, config.Validate())
+		assert.Equal(t, maxShards, config.NumShards)
+		assert.Zero(t, config.BufferSize%config.NumShards)
+		assert.Equal(t, 5*time.Millisecond, config.FlushTimeout)
+		assert.Equal(t, config.MaxFileSize, config.PreallocateFileSize)
+	})
+}
+
+func TestConfig_Explain(t *testing.T) {
+	config := DefaultConfig("/tmp/test.log")
+	config.BufferSize = 1024*1024 + 3
+	config.NumShards = 4
+	config.MaxFileSize = 8 * 1024 * 1024
+
+	explained := config.Explain()
+	assert.Equal(t, 1024*1024+3, config.BufferSize, "Explain does not change the config")
+	assert.Contains(t, explained, "buffers: 4 shards x 262144 bytes (BufferSize 1048576)")
+	assert.Contains(t, explained, "shard buffer: 266240 bytes aligned to 4096, 266232 usable for entries")
+	assert.Contains(t, explained, "shard flush threshold: 239608 bytes (90% of usable)")
+	assert.Contains(t, explained, "flush timing: every 10s, waiting up to 10ms for writes in progress")
+	assert.Contains(t, explained, "rotation: every 24h0m0s, at 8388608 bytes (0 = never)")
+
+	sizeConfig := DefaultSizeConfig("/tmp/test.log")
+	assert.Contains(t, sizeConfig.Explain(), "files: rotate at 1073741824 bytes, preallocate 1073741824 bytes")
 }
 
 func TestLogger_BasicLogging(t *testing.T) {
 	logPath := filepath.Join(t.TempDir(), "test.log")
 	config := DefaultConfig(logPath)
 	config.FlushInterval = 100 * time.Millisecond
+	fake := useFakeClock(&config)
 
 	logger, err := New(config)
 	require.NoError(t, err)
@@ -64,15 +244,16 @@ func TestLogger_BasicLogging(t *testing.T) {
 	logger.Log("test message 2")
 	logger.Log("test message 3")
 
-	// Wait for flush
-	time.Sleep(200 * time.Millisecond)
+	// Flush on the next tick
+	fake.Advance(config.FlushInterval)
+	waitForFlushes(t, logger, 1)
 
 	// Close to ensure all data is flushed
 	err = logger.Close()
 	assert.NoError(t, err)
 
 	// Verify stats
-	totalLogs, droppedLogs, _, _, _, _ := logger.GetStatsSnapshot()
+	totalLogs, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
 	assert.Equal(t, int64(3), totalLogs)
 	assert.Equal(t, int64(0), droppedLogs)
 
@@ -118,15 +299,12 @@ func TestLogger_ConcurrentWrites(t *testing.T) {
 
 			wg.Wait()
 
-			// Wait for flushes
-			time.Sleep(200 * time.Millisecond)
-
 			// Close logger
 			err = logger.Close()
 			assert.NoError(t, err)
 
 			// Verify stats
-			totalLogs, droppedLogs, _, _, flushErrors, _ := logger.GetStatsSnapshot()
+			totalLogs, droppedLogs, _, _, flushErrors, _, _, _ := logger.GetStatsSnapshot()
 
 			// Should have logged most messages (some drops acceptable under high load)
 			assert.Greater(t, totalLogs, int64(totalMessages*90/100), "should log at least 90%% of messages")
@@ -166,11 +344,8 @@ func TestLogger_BufferFillingAndSwapping(t *testing.T) {
 		logger.Log(string(message))
 	}
 
-	// Wait for flushes
-	time.Sleep(200 * time.Millisecond)
-
 	// Check that swaps occurred
-	_, _, _, _, _, setSwaps := logger.GetStatsSnapshot()
+	_, _, _, _, _, setSwaps, _, _ := logger.GetStatsSnapshot()
 	assert.Greater(t, setSwaps, int64(0), "should have performed buffer swaps")
 
 	// Close logger
@@ -196,7 +371,7 @@ func TestLogger_GracefulShutdown(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Verify all messages were logged
-	totalLogs, _, bytesWritten, _, flushErrors, _ := logger.GetStatsSnapshot()
+	totalLogs, _, bytesWritten, _, flushErrors, _, _, _ := logger.GetStatsSnapshot()
 	assert.Equal(t, int64(100), totalLogs)
 	assert.Greater(t, bytesWritten, int64(0))
 	assert.Equal(t, int64(0), flushErrors)
@@ -226,7 +401,7 @@ func TestLogger_DoubleClose(t *testing.T) {
 
 	// Logging after close should be handled gracefully (drops)
 	logger.Log("should be dropped")
-	_, droppedLogs, _, _, _, _ := logger.GetStatsSnapshot()
+	_, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
 	assert.Greater(t, droppedLogs, int64(0))
 }
 
@@ -234,6 +409,7 @@ func TestLogger_Statistics(t *testing.T) {
 	logPath := filepath.Join(t.TempDir(), "test.log")
 	config := DefaultConfig(logPath)
 	config.FlushInterval = 100 * time.Millisecond
+	fake := useFakeClock(&config)
 
 	logger, err := New(config)
 	require.NoError(t, err)
@@ -245,11 +421,12 @@ func TestLogger_Statistics(t *testing.T) {
 		logger.Log(fmt.Sprintf("message %d", i))
 	}
 
-	// Wait for flush
-	time.Sleep(200 * time.Millisecond)
+	// Flush on the next tick
+	fake.Advance(config.FlushInterval)
+	waitForFlushes(t, logger, 1)
 
 	// Check statistics
-	totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps := logger.GetStatsSnapshot()
+	totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, _, _ := logger.GetStatsSnapshot()
 
 	assert.Equal(t, int64(numMessages), totalLogs, "should track total logs")
 	assert.Equal(t, int64(0), droppedLogs, "should have no dropped logs")
@@ -272,12 +449,11 @@ func TestLogger_MessageWithoutNewline(t *testing.T) {
 	// Log with newline
 	logger.Log("message with newline\n")
 
-	time.Sleep(100 * time.Millisecond)
 	err = logger.Close()
 	assert.NoError(t, err)
 
 	// Both should be logged successfully
-	totalLogs, _, _, _, _, _ := logger.GetStatsSnapshot()
+	totalLogs, _, _, _, _, _, _, _ := logger.GetStatsSnapshot()
 	assert.Equal(t, int64(2), totalLogs)
 }
 
@@ -345,6 +521,84 @@ func TestBuffer_FillAndFlush(t *testing.T) {
 	assert.True(t, needsFlush)
 }
 
+func TestBuffer_FlushThresholdMatchesUtilization(t *testing.T) {
+	buffer := NewBuffer(64*1024, 0)
+	usable := buffer.UsableCapacity()
+	assert.Equal(t, buffer.Capacity()-8, usable)
+
+	// Threshold is 90% of usable capacity (excluding the 8-byte header reservation)
+	threshold := int(int64(usable) * 90 / 100)
+
+	// One byte short of the threshold: no flush, utilization below 90%
+	n, needsFlush := buffer.Write(make([]byte, threshold-1-4))
+	assert.Equal(t, threshold-1, n)
+	assert.False(t, needsFlush)
+	assert.Less(t, buffer.UtilizationPct(), 90.0)
+
+	// Exactly at the threshold: flush fires and utilization reads 90%
+	buffer.Reset()
+	n, needsFlush = buffer.Write(make([]byte, threshold-4))
+	assert.Equal(t, threshold, n)
+	assert.True(t, needsFlush, "should trigger flush at exactly 90%% of usable capacity")
+	assert.Equal(t, int32(threshold), buffer.DataSize())
+	assert.InDelta(t, 90.0, buffer.UtilizationPct(), 100.0/float64(usable))
+	assert.GreaterOrEqual(t, buffer.UtilizationPct(), 90.0-100.0/float64(usable))
+
+	// GetShardStats reports the same percentage from the same base
+	shard := NewShard(64*1024, 0)
+	shard.Write(make([]byte, threshold-4))
+	set := &BufferSet{shards: []*Shard{shard}, numShards: 1}
+	logger := &Logger{}
+	logger.activeSet.Store(set)
+	stats := logger.GetShardStats()
+	require.Len(t, stats, 1)
+	assert.Equal(t, int32(threshold), stats[0].BytesUsed)
+	assert.Equal(t, buffer.UtilizationPct(), stats[0].UtilizationPct)
+}
+
+func TestLogger_ShardFlushThresholdPct(t *testing.T) {
+	newThresholdLogger := func(t *testing.T, config Config) *Logger {
+		t.Helper()
+		config.BufferSize = 64 * 1024
+		config.NumShards = 1
+		config.FlushInterval = time.Hour
+		logger, err := New(config)
+		require.NoError(t, err)
+		t.Cleanup(func() { logger.Close() })
+		return logger
+	}
+
+	for _, pct := range []int{50, 99} {
+		t.Run(fmt.Sprintf("%d%%", pct), func(t *testing.T) {
+			config := DefaultConfig(filepath.Join(t.TempDir(), "threshold.log"))
+			config.ShardFlushThresholdPct = pct
+			logger := newThresholdLogger(t, config)
+
+			first := logger.activeSet.Load()
+			buffer := first.GetShard(0).buffer
+			threshold := int(int64(buffer.UsableCapacity()) * int64(pct) / 100)
+			assert.Equal(t, int32(threshold), buffer.flushThreshold)
+
+			// One byte short of the threshold keeps the set active
+			require.NoError(t, logger.TryLogBytes(make([]byte, threshold-1-4)))
+			assert.Same(t, first, logger.activeSet.Load())
+			assert.False(t, buffer.IsFull())
+
+			// Crossing it seals the shard and swaps sets
+			require.NoError(t, logger.TryLogBytes([]byte{1}))
+			assert.True(t, buffer.IsFull())
+			assert.NotSame(t, first, logger.activeSet.Load())
+		})
+	}
+
+	t.Run("default config is unchanged", func(t *testing.T) {
+		logger := newThresholdLogger(t, DefaultConfig(filepath.Join(t.TempDir(), "default.log")))
+		buffer := logger.activeSet.Load().GetShard(0).buffer
+		assert.Equal(t, NewBuffer(64*1024, 0).flushThreshold, buffer.flushThreshold)
+		assert.Equal(t, int32(int64(buffer.UsableCapacity())*90/100), buffer.flushThreshold)
+	})
+}
+
 func TestShard_ConcurrentWrites(t *testing.T) {
 	shard := NewShard(10*1024, 0)
 
@@ -409,6 +663,79 @@ func TestBufferSet_RoundRobin(t *testing.T) {
 	}
 }
 
+func TestBufferSet_Spill(t *testing.T) {
+	entry := []byte("spilled entry")
+	size := int32(4 + len(entry)) // Length prefix + data
+
+	// fill leaves free bytes in an open shard; an entry fits only while it stays below capacity
+	fill := func(shard *Shard, free int32) {
+		shard.buffer.offset.Store(shard.Capacity() - free)
+		shard.buffer.readyForFlush.Store(false)
+	}
+
+	t.Run("exact fit in the next shard", func(t *testing.T) {
+		bs := NewBufferSet(256*1024, 4, 0)
+		fill(bs.GetShard(1), size)   // Would reach capacity exactly: refused
+		fill(bs.GetShard(2), size+1) // Fits with one byte to spare
+
+		n, needsFlush, shardID := bs.Write(entry) // Round-robin picks shard 1
+		assert.Equal(t, int(size), n)
+		assert.True(t, needsFlush, "the refusing shard still asks for a swap")
+		assert.Equal(t, 2, shardID)
+		assert.Equal(t, bs.GetShard(2).Capacity()-1, bs.GetShard(2).Offset())
+		assert.True(t, bs.GetShard(1).IsFull())
+		assert.Equal(t, int64(1), bs.GetShard(1).spills.Load())
+		assert.Zero(t, bs.GetShard(2).spills.Load())
+
+		// The spill does not advance the round-robin counter
+		assert.Equal(t, uint64(1), bs.counter.Load())
+	})
+
+	t.Run("wraps around the set", func(t *testing.T) {
+		bs := NewBufferSet(256*1024, 4, 0)
+		bs.counter.Store(2)
+		fill(bs.GetShard(3), size-1)
+
+		n, _, shardID := bs.Write(entry)
+		assert.Equal(t, int(size), n)
+		assert.Equal(t, 0, shardID)
+	})
+
+	t.Run("probes are bounded", func(t *testing.T) {
+		bs := NewBufferSet(512*1024, 8, 0)
+		var spilled atomic.Int64
+		bs.spilled = &spilled
+		for i := 1; i <= 1+spillProbes; i++ {
+			fill(bs.GetShard(i), size)
+		}
+
+		n, needsFlush, shardID := bs.Write(entry)
+		assert.Zero(t, n)
+		assert.True(t, needsFlush)
+		assert.Equal(t, 1, shardID, "failure reports the round-robin shard")
+		assert.Zero(t, bs.GetShard(2+spillProbes).buffer.WriteCount(), "shards past the probes are not tried")
+		assert.Zero(t, spilled.Load())
+
+		fill(bs.GetShard(1+spillProbes), size+1)
+		bs.counter.Store(0)
+		n, _, shardID = bs.Write(entry)
+		assert.Equal(t, int(size), n)
+		assert.Equal(t, 1+spillProbes, shardID)
+		assert.Equal(t, int64(1), spilled.Load())
+	})
+
+	t.Run("single shard has nowhere to spill", func(t *testing.T) {
+		bs := NewBufferSet(64*1024, 1, 0)
+		fill(bs.GetShard(0), size)
+
+		n, needsFlush, shardID := bs.Write(entry)
+		assert.Zero(t, n)
+		assert.True(t, needsFlush)
+		assert.Equal(t, 0, shardID)
+		assert.Zero(t, bs.GetShard(0).spills.Load())
+	})
+}
+
 func TestBufferSet_HasData(t *testing.T) {
 	bufferSet := NewBufferSet(4*1024, 4, 0)
 
@@ -442,15 +769,12 @@ func TestLogger_LogBytes(t *testing.T) {
 	logger.LogBytes([]byte("test message 2\n")) // With newline
 	logger.LogBytes([]byte("test message 3"))
 
-	// Wait for flush
-	time.Sleep(200 * time.Millisecond)
-
 	// Close to ensure all data is flushed
 	err = logger.Close()
 	assert.NoError(t, err)
 
 	// Verify stats
-	totalLogs, droppedLogs, _, _, _, _ := logger.GetStatsSnapshot()
+	totalLogs, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
 	assert.Equal(t, int64(3), totalLogs)
 	assert.Equal(t, int64(0), droppedLogs)
 }
@@ -473,11 +797,10 @@ func TestLogger_LogBytes_ZeroAllocation(t *testing.T) {
 		logger.LogBytes(buf[:n])
 	}
 
-	time.Sleep(200 * time.Millisecond)
 	err = logger.Close()
 	assert.NoError(t, err)
 
-	totalLogs, droppedLogs, _, _, _, _ := logger.GetStatsSnapshot()
+	totalLogs, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
 	assert.Equal(t, int64(100), totalLogs)
 	assert.Equal(t, int64(0), droppedLogs)
 }
@@ -510,11 +833,10 @@ func TestLogger_LogBytes_ConcurrentWithReuse(t *testing.T) {
 	}
 
 	wg.Wait()
-	time.Sleep(200 * time.Millisecond)
 	err = logger.Close()
 	assert.NoError(t, err)
 
-	totalLogs, droppedLogs, _, _, _, _ := logger.GetStatsSnapshot()
+	totalLogs, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
 	assert.Equal(t, int64(numWorkers*messagesPerWorker), totalLogs)
 	assert.Equal(t, int64(0), droppedLogs)
 }
@@ -533,11 +855,10 @@ func TestLogger_LogString_BackwardCompatible(t *testing.T) {
 	logger.Log("string message 2\n")
 	logger.Log("string message 3")
 
-	time.Sleep(200 * time.Millisecond)
 	err = logger.Close()
 	assert.NoError(t, err)
 
-	totalLogs, _, _, _, _, _ := logger.GetStatsSnapshot()
+	totalLogs, _, _, _, _, _, _, _ := logger.GetStatsSnapshot()
 	assert.Equal(t, int64(3), totalLogs)
 }
 
@@ -555,11 +876,10 @@ func TestLogger_MixedStringAndBytes(t *testing.T) {
 	logger.Log("another string")
 	logger.LogBytes([]byte("another bytes\n"))
 
-	time.Sleep(100 * time.Millisecond)
 	err = logger.Close()
 	assert.NoError(t, err)
 
-	totalLogs, droppedLogs, _, _, _, _ := logger.GetStatsSnapshot()
+	totalLogs, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
 	assert.Equal(t, int64(4), totalLogs)
 	assert.Equal(t, int64(0), droppedLogs)
 }
@@ -588,18 +908,12 @@ func TestLogger_FileFormatVerification(t *testing.T) {
 		logger.Log(msg)
 	}
 
-	// Wait for flush and ensure all data is written
-	time.Sleep(300 * time.Millisecond)
-
 	// Force flush by closing (this ensures all data is flushed)
 	err = logger.Close()
 	require.NoError(t, err)
 
-	// Give a bit more time for file writes to complete
-	time.Sleep(50 * time.Millisecond)
-
 	// Verify stats
-	totalLogs, droppedLogs, bytesWritten, _, flushErrors, _ := logger.GetStatsSnapshot()
+	totalLogs, droppedLogs, bytesWritten, _, flushErrors, _, _, _ := logger.GetStatsSnapshot()
 	assert.Equal(t, int64(len(testMessages)), totalLogs)
 	assert.Equal(t, int64(0), droppedLogs)
 	assert.Greater(t, bytesWritten, int64(0))
@@ -750,3 +1064,1353 @@ func TestLogger_FileFormatVerification(t *testing.T) {
 		t.Logf("✅ Verified: Header capacity=%d, validDataBytes=%d", firstCapacity, firstValidData)
 	}
 }
+
+func TestLogger_WriteRetryTimeout(t *testing.T) {
+	// newHeldSemaphoreLogger returns a logger whose swap semaphore is fully held,
+	// so every write that misses the fast path times out in the retry path
+	newHeldSemaphoreLogger := func(t *testing.T, timeout time.Duration) *Logger {
+		t.Helper()
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		config.BufferSize = 64 * 1024
+		config.NumShards = 1
+		config.WriteRetryTimeout = timeout
+
+		logger, err := New(config)
+		require.NoError(t, err)
+		t.Cleanup(func() { logger.Close() })
+
+		for i := 0; i < cap(logger.swapSemaphore); i++ {
+			logger.swapSemaphore <- struct{}{}
+		}
+		t.Cleanup(func() {
+			for len(logger.swapSemaphore) > 0 {
+				<-logger.swapSemaphore
+			}
+		})
+		return logger
+	}
+
+	// fillBuffer marks the active shard full so writes miss the fast path
+	fillBuffer := func(logger *Logger) {
+		shard := logger.activeSet.Load().GetShard(0)
+		shard.buffer.offset.Store(shard.Capacity())
+	}
+
+	t.Run("zero fails immediately", func(t *testing.T) {
+		logger := newHeldSemaphoreLogger(t, 0)
+		fillBuffer(logger)
+
+		start := time.Now()
+		logger.Log("full")
+		assert.Less(t, time.Since(start), 5*time.Millisecond)
+
+		_, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
+		assert.Equal(t, int64(1), droppedLogs)
+		_, retryPath, retryTimeouts := logger.GetWritePathStats()
+		assert.Equal(t, int64(1), retryPath)
+		assert.Equal(t, int64(1), retryTimeouts)
+	})
+
+	t.Run("waits up to timeout", func(t *testing.T) {
+		logger := newHeldSemaphoreLogger(t, 30*time.Millisecond)
+		fillBuffer(logger)
+
+		start := time.Now()
+		logger.Log("full")
+		assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond)
+
+		_, _, retryTimeouts := logger.GetWritePathStats()
+		assert.Equal(t, int64(1), retryTimeouts)
+	})
+
+	t.Run("counts fast and retry paths", func(t *testing.T) {
+		logger := newHeldSemaphoreLogger(t, 0)
+
+		for i := 0; i < 5; i++ {
+			logger.Log("fits")
+		}
+		fillBuffer(logger)
+		logger.Log("full")
+
+		fastPath, retryPath, retryTimeouts := logger.GetWritePathStats()
+		assert.Equal(t, int64(5), fastPath)
+		assert.Equal(t, int64(1), retryPath)
+		assert.Equal(t, int64(1), retryTimeouts)
+	})
+}
+
+func TestLogger_ShardDropAttribution(t *testing.T) {
+	// holdSemaphore takes every swap permit, so writes that miss the fast path time out and drop
+	holdSemaphore := func(t *testing.T, logger *Logger) {
+		t.Helper()
+		for i := 0; i < cap(logger.swapSemaphore); i++ {
+			logger.swapSemaphore <- struct{}{}
+		}
+		t.Cleanup(func() {
+			for len(logger.swapSemaphore) > 0 {
+				<-logger.swapSemaphore
+			}
+		})
+	}
+	newLogger := func(t *testing.T, numShards int) *Logger {
+		t.Helper()
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		config.BufferSize = numShards * 64 * 1024
+		config.NumShards = numShards
+		config.FlushInterval = time.Hour
+		config.WriteRetryTimeout = 0
+		logger, err := New(config)
+		require.NoError(t, err)
+		t.Cleanup(func() { logger.Close() })
+		return logger
+	}
+
+	t.Run("drops land on the full shard", func(t *testing.T) {
+		logger := newLogger(t, 2)
+		holdSemaphore(t, logger)
+		// Shard 1 has no space and shard 0 is sealed, so writes to shard 1 cannot spill either
+		hot := logger.activeSet.Load().GetShard(1)
+		hot.buffer.offset.Store(hot.Capacity())
+		logger.activeSet.Load().GetShard(0).buffer.readyForFlush.Store(true)
+
+		// Round-robin alternates shards: each refused write is counted on the shard it was meant for
+		for i := 0; i < 10; i++ {
+			logger.Log("entry")
+		}
+
+		stats := logger.GetShardStats()
+		require.Len(t, stats, 2)
+		for _, stat := range stats {
+			assert.Equal(t, int64(5), stat.Drops)
+			assert.Equal(t, int64(5), stat.RetryPathWrites)
+			assert.Equal(t, int64(5), stat.RetryTimeouts)
+			assert.Zero(t, stat.Spills)
+		}
+
+		// The per-shard counters add up to the logger's
+		_, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
+		_, retryPath, retryTimeouts := logger.GetWritePathStats()
+		assert.Equal(t, droppedLogs, stats[0].Drops+stats[1].Drops)
+		assert.Equal(t, retryPath, stats[0].RetryPathWrites+stats[1].RetryPathWrites)
+		assert.Equal(t, retryTimeouts, stats[0].RetryTimeouts+stats[1].RetryTimeouts)
+	})
+
+	t.Run("full shard spills to the next one", func(t *testing.T) {
+		logger := newLogger(t, 2)
+		holdSemaphore(t, logger)
+		first := logger.activeSet.Load()
+		hot := first.GetShard(1)
+		hot.buffer.offset.Store(hot.Capacity())
+
+		// The first write goes to shard 1; shard 0 takes it on the fast path, and the full shard still swaps sets
+		require.NoError(t, logger.TryLogBytes([]byte("entry")))
+		assert.NotSame(t, first, logger.activeSet.Load())
+
+		stats := logger.GetShardStats()
+		require.Len(t, stats, 2)
+		assert.Zero(t, stats[0].Spills)
+		assert.Equal(t, int64(1), stats[1].Spills)
+		assert.Zero(t, stats[1].Drops)
+		assert.Zero(t, stats[1].RetryPathWrites)
+		assert.Equal(t, int64(1), logger.stats.SpilledWrites.Load())
+	})
+
+	t.Run("counters survive set swaps", func(t *testing.T) {
+		logger := newLogger(t, 1)
+		first := logger.activeSet.Load()
+
+		// A write past the flush threshold swaps to the other set, whose shard 0 is the same logical shard
+		threshold := first.GetShard(0).buffer.flushThreshold
+		require.NoError(t, logger.TryLogBytes(make([]byte, threshold)))
+		require.NotSame(t, first, logger.activeSet.Load())
+		holdSemaphore(t, logger)
+		shard := logger.activeSet.Load().GetShard(0)
+		shard.buffer.offset.Store(shard.Capacity())
+		logger.Log("dropped")
+
+		stats := logger.GetShardStats()
+		assert.Equal(t, int64(1), stats[0].Swaps)
+		assert.Equal(t, int64(1), stats[0].Drops)
+	})
+
+	t.Run("manager reports shards per event", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "events.log"))
+		config.BufferSize = 64 * 1024
+		config.NumShards = 1
+		config.FlushInterval = time.Hour
+		config.WriteRetryTimeout = 0
+		lm, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer lm.Close()
+
+		require.NoError(t, lm.InitializeEventLogger("hot"))
+		require.NoError(t, lm.InitializeEventLogger("cold"))
+		value, _ := lm.loggers.Load("hot")
+		hot := value.(*Logger)
+		holdSemaphore(t, hot)
+		shard := hot.activeSet.Load().GetShard(0)
+		shard.buffer.offset.Store(shard.Capacity())
+
+		for i := 0; i < 3; i++ {
+			lm.LogWithEvent("hot", "dropped")
+		}
+		lm.LogWithEvent("cold", "kept")
+
+		stats := lm.GetShardStatsByEvent()
+		require.Len(t, stats, 2)
+		assert.Equal(t, int64(3), stats["hot"][0].Drops)
+		assert.Equal(t, int64(3), stats["hot"][0].RetryTimeouts)
+		assert.Zero(t, stats["cold"][0].Drops)
+		assert.Equal(t, int64(1), stats["cold"][0].WriteCount)
+	})
+}
+
+func TestLogger_TryLogBytes(t *testing.T) {
+	newTryLogger := func(t *testing.T) *Logger {
+		t.Helper()
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		config.BufferSize = 64 * 1024
+		config.NumShards = 1
+		config.WriteRetryTimeout = 0
+
+		logger, err := New(config)
+		require.NoError(t, err)
+		t.Cleanup(func() { logger.Close() })
+		return logger
+	}
+
+	t.Run("accepted", func(t *testing.T) {
+		logger := newTryLogger(t)
+		assert.NoError(t, logger.TryLogBytes([]byte("ok")))
+	})
+
+	t.Run("buffer full", func(t *testing.T) {
+		logger := newTryLogger(t)
+		logger.setB.pendingFlush.Store(true) // Other set still flushing: swap cannot help
+		shard := logger.setA.GetShard(0)
+		shard.buffer.offset.Store(shard.Capacity())
+
+		assert.Equal(t, ErrBufferFull, logger.TryLogBytes([]byte("full")))
+		logger.setB.pendingFlush.Store(false)
+	})
+
+	t.Run("oversized", func(t *testing.T) {
+		logger := newTryLogger(t)
+		assert.Equal(t, ErrOversized, logger.TryLogBytes(make([]byte, 128*1024)))
+
+		fastPath, retryPath, _ := logger.GetWritePathStats()
+		assert.Equal(t, int64(0), fastPath+retryPath, "oversized logs skip the write path")
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		logger := newTryLogger(t)
+		require.NoError(t, logger.Close())
+		assert.Equal(t, ErrClosed, logger.TryLogBytes([]byte("late")))
+
+		totalLogs, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
+		assert.Equal(t, int64(1), totalLogs)
+		assert.Equal(t, int64(1), droppedLogs)
+	})
+
+	t.Run("fast path does not allocate", func(t *testing.T) {
+		logger := newTryLogger(t)
+		data := []byte("allocation free")
+		allocs := testing.AllocsPerRun(1000, func() {
+			_ = logger.TryLogBytes(data)
+		})
+		assert.Equal(t, 0.0, allocs)
+	})
+
+	t.Run("retry path does not allocate", func(t *testing.T) {
+		logger, _ := newFullLogger(t, 10*time.Millisecond)
+		data := []byte("allocation free")
+		_, droppedBefore, _, _, _, _, _, _ := logger.GetStatsSnapshot()
+		allocs := testing.AllocsPerRun(1000, func() {
+			_ = logger.TryLogBytes(data)
+		})
+		assert.Equal(t, 0.0, allocs)
+
+		// AllocsPerRun runs the function once more to warm up
+		_, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
+		assert.Equal(t, int64(1001), droppedLogs-droppedBefore)
+	})
+}
+
+// TestLogger_RetryPathDrops checks that writes retrying on full buffers drop as before with
+// recycled timers: waits time out after WriteRetryTimeout while the swap permits are taken, and a
+// reused timer does not cut a later wait short
+func TestLogger_RetryPathDrops(t *testing.T) {
+	const retryTimeout = 2 * time.Millisecond
+	logger, release := newFullLogger(t, retryTimeout)
+	totalBefore, droppedBefore, _, _, _, _, _, _ := logger.GetStatsSnapshot()
+	timeoutsBefore := logger.stats.RetryTimeouts.Load()
+
+	// Every write finds its shard full and drops: with the permits free as buffer_full, with the
+	// permits taken after waiting out the retry timeout
+	const goroutines, writes = 16, 50
+	run := func() {
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < writes; i++ {
+					assert.ErrorIs(t, logger.TryLogBytes([]byte("stress")), ErrBufferFull)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	run()
+	for i := 0; i < cap(logger.swapSemaphore); i++ {
+		logger.swapSemaphore <- struct{}{}
+	}
+	start := time.Now()
+	run()
+	assert.GreaterOrEqual(t, time.Since(start), writes*retryTimeout)
+	for i := 0; i < cap(logger.swapSemaphore); i++ {
+		<-logger.swapSemaphore
+	}
+
+	totalLogs, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
+	assert.Equal(t, int64(2*goroutines*writes), totalLogs-totalBefore)
+	assert.Equal(t, totalLogs-totalBefore, droppedLogs-droppedBefore)
+	assert.Equal(t, int64(goroutines*writes), logger.stats.RetryTimeouts.Load()-timeoutsBefore)
+
+	// Once the flush completes, writes are accepted again
+	release()
+	require.Eventually(t, func() bool {
+		return logger.TryLogBytes([]byte("after")) == nil
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestLogger_DropPolicyBlock(t *testing.T) {
+	t.Run("zero drops under sustained overload", func(t *testing.T) {
+		logPath := filepath.Join(t.TempDir(), "test.log")
+		config := DefaultConfig(logPath)
+		config.BufferSize = 256 * 1024 // Small buffers so writers outrun the flusher
+		config.NumShards = 4
+		config.DropPolicy = DropPolicyBlock
+
+		logger, err := New(config)
+		require.NoError(t, err)
+
+		const numGoroutines = 16
+		const logsPerGoroutine = 2000
+		message := make([]byte, 1024)
+		for i := range message {
+			message[i] = 'B'
+		}
+
+		var wg sync.WaitGroup
+		for g := 0; g < numGoroutines; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < logsPerGoroutine; i++ {
+					logger.LogBytes(message)
+				}
+			}()
+		}
+		wg.Wait()
+		require.NoError(t, logger.Close())
+
+		totalLogs, droppedLogs, _, _, flushErrors, _, _, _ := logger.GetStatsSnapshot()
+		assert.Equal(t, int64(numGoroutines*logsPerGoroutine), totalLogs)
+		assert.Equal(t, int64(0), droppedLogs, "blocking mode must not drop")
+		assert.Equal(t, int64(0), flushErrors)
+
+		blockedWrites, totalBlocked, maxBlocked := logger.GetBackpressureStats()
+		assert.Greater(t, blockedWrites, int64(0), "overload should have caused backpressure")
+		assert.Greater(t, totalBlocked, time.Duration(0))
+		assert.GreaterOrEqual(t, totalBlocked, maxBlocked)
+
+		// Every record must be on disk
+		assert.Equal(t, numGoroutines*logsPerGoroutine, countLogRecords(t, logPath))
+	})
+
+	t.Run("context cancellation", func(t *testing.T) {
+		logPath := filepath.Join(t.TempDir(), "test.log")
+		config := DefaultConfig(logPath)
+		config.BufferSize = 64 * 1024
+		config.NumShards = 1
+
+		logger, err := New(config)
+		require.NoError(t, err)
+		defer logger.Close()
+
+		// Fill the active set and hold the other set as pending so no space can free up
+		logger.setB.pendingFlush.Store(true)
+		message := make([]byte, 1024)
+		for logger.LogBytesBlocking(context.Background(), message) == nil && !logger.setA.AnyShardFull() {
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		err = logger.LogBytesBlocking(ctx, message)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		_, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
+		assert.Equal(t, int64(1), droppedLogs)
+		blockedWrites, _, _ := logger.GetBackpressureStats()
+		assert.Equal(t, int64(1), blockedWrites)
+		logger.setB.pendingFlush.Store(false)
+	})
+
+	t.Run("close wakes blocked writers", func(t *testing.T) {
+		logPath := filepath.Join(t.TempDir(), "test.log")
+		config := DefaultConfig(logPath)
+		config.BufferSize = 64 * 1024
+		config.NumShards = 1
+
+		logger, err := New(config)
+		require.NoError(t, err)
+
+		logger.setB.pendingFlush.Store(true)
+		message := make([]byte, 1024)
+		for logger.LogBytesBlocking(context.Background(), message) == nil && !logger.setA.AnyShardFull() {
+		}
+
+		errCh := make(chan error, 1)
+		go func() { errCh <- logger.LogBytesBlocking(context.Background(), message) }()
+
+		time.Sleep(20 * time.Millisecond)
+		require.NoError(t, logger.Close())
+
+		select {
+		case err := <-errCh:
+			assert.ErrorIs(t, err, ErrClosed)
+		case <-time.After(time.Second):
+			t.Fatal("blocked writer was not released by Close")
+		}
+	})
+
+	t.Run("message too large", func(t *testing.T) {
+		logPath := filepath.Join(t.TempDir(), "test.log")
+		config := DefaultConfig(logPath)
+		config.BufferSize = 64 * 1024
+		config.NumShards = 1
+
+		logger, err := New(config)
+		require.NoError(t, err)
+		defer logger.Close()
+
+		err = logger.LogBytesBlocking(context.Background(), make([]byte, 128*1024))
+		assert.ErrorIs(t, err, ErrOversized)
+	})
+}
+
+func TestLogger_Flush(t *testing.T) {
+	newFlushLogger := func(t *testing.T) (*Logger, string) {
+		t.Helper()
+		logPath := filepath.Join(t.TempDir(), "flush.log")
+		config := DefaultConfig(logPath)
+		config.BufferSize = 256 * 1024
+		config.NumShards = 2
+		config.FlushInterval = time.Hour // Only explicit flushes
+
+		logger, err := New(config)
+		require.NoError(t, err)
+		t.Cleanup(func() { logger.Close() })
+		return logger, logPath
+	}
+
+	t.Run("data on disk when flush returns", func(t *testing.T) {
+		logger, logPath := newFlushLogger(t)
+		for i := 0; i < 100; i++ {
+			logger.Log(fmt.Sprintf("record %d", i))
+		}
+
+		require.NoError(t, logger.Flush(context.Background()))
+		assert.Equal(t, 100, countLogRecords(t, logPath))
+
+		// Flushing with nothing buffered is a no-op
+		require.NoError(t, logger.Flush(context.Background()))
+		assert.Equal(t, 100, countLogRecords(t, logPath))
+	})
+
+	t.Run("concurrent traffic is flushed exactly once", func(t *testing.T) {
+		logger, logPath := newFlushLogger(t)
+
+		var wg sync.WaitGroup
+		stop := make(chan struct{})
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				msg := make([]byte, 200)
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						logger.LogBytes(msg)
+					}
+				}
+			}()
+		}
+		for i := 0; i < 20; i++ {
+			require.NoError(t, logger.Flush(context.Background()))
+		}
+		close(stop)
+		wg.Wait()
+		require.NoError(t, logger.Close())
+
+		totalLogs, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
+		assert.Equal(t, int(totalLogs-droppedLogs), countLogRecords(t, logPath))
+	})
+
+	t.Run("context ends while flush worker is busy", func(t *testing.T) {
+		logger, _ := newFlushLogger(t)
+		logger.Log("queued")
+
+		// Hold the flush semaphore so the worker blocks inside the swap-triggered flush
+		logger.semaphore <- struct{}{}
+		logger.trySwap(FlushTriggerThreshold)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, logger.Flush(ctx), context.DeadlineExceeded)
+		<-logger.semaphore
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		logger, _ := newFlushLogger(t)
+		require.NoError(t, logger.Close())
+		assert.ErrorIs(t, logger.Flush(context.Background()), ErrClosed)
+	})
+}
+
+func TestLogger_IOModes(t *testing.T) {
+	for _, mode := range []IOMode{IOModeDirectSync, IOModeDirectAsync, IOModeBuffered} {
+		mode := mode
+		t.Run(string(mode), func(t *testing.T) {
+			logPath := filepath.Join(t.TempDir(), "modes.log")
+			config := DefaultConfig(logPath)
+			config.BufferSize = 256 * 1024
+			config.NumShards = 2
+			config.FlushInterval = time.Hour
+			config.IOMode = mode
+
+			logger, err := New(config)
+			require.NoError(t, err)
+			for i := 0; i < 100; i++ {
+				logger.Log(fmt.Sprintf("record %d", i))
+			}
+			require.NoError(t, logger.Flush(context.Background()))
+			for i := 0; i < 100; i++ {
+				logger.Log(fmt.Sprintf("record %d", i))
+			}
+			require.NoError(t, logger.Close())
+			assert.Equal(t, 200, countLogRecords(t, logPath))
+
+			info, err := os.Stat(logPath)
+			require.NoError(t, err)
+			if mode == IOModeBuffered {
+				// Shards are written without alignment padding
+				assert.NotZero(t, info.Size()%512)
+			} else {
+				assert.Zero(t, info.Size()%512)
+			}
+		})
+	}
+}
+
+func TestLogger_DropCallbacks(t *testing.T) {
+	type drop struct {
+		reason DropReason
+		size   int
+	}
+
+	// newHookedLogger returns a logger whose OnDrop callback forwards to the returned channel
+	newHookedLogger := func(t *testing.T, configure func(*Config)) (*Logger, <-chan drop) {
+		t.Helper()
+		drops := make(chan drop, 16)
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		config.BufferSize = 64 * 1024
+		config.NumShards = 1
+		config.WriteRetryTimeout = 0
+		config.OnDrop = func(reason DropReason, size int) { drops <- drop{reason, size} }
+		if configure != nil {
+			configure(&config)
+		}
+
+		logger, err := New(config)
+		require.NoError(t, err)
+		t.Cleanup(func() { logger.Close() })
+		return logger, drops
+	}
+
+	expectDrop := func(t *testing.T, drops <-chan drop, want drop) {
+		t.Helper()
+		select {
+		case got := <-drops:
+			assert.Equal(t, want, got)
+		case <-time.After(time.Second):
+			t.Fatalf("OnDrop was not called for %s", want.reason)
+		}
+	}
+
+	fillActiveSet := func(logger *Logger) {
+		logger.setB.pendingFlush.Store(true) // Other set still flushing: swap cannot help
+		shard := logger.setA.GetShard(0)
+		shard.buffer.offset.Store(shard.Capacity())
+	}
+
+	t.Run("closed", func(t *testing.T) {
+		logger, drops := newHookedLogger(t, nil)
+		require.NoError(t, logger.Close())
+		logger.Log("late")
+		expectDrop(t, drops, drop{DropReasonClosed, 4})
+	})
+
+	t.Run("buffer full after retry", func(t *testing.T) {
+		logger, drops := newHookedLogger(t, nil)
+		fillActiveSet(logger)
+		assert.Equal(t, ErrBufferFull, logger.TryLogBytes([]byte("full")))
+		expectDrop(t, drops, drop{DropReasonBufferFull, 4})
+		logger.setB.pendingFlush.Store(false)
+	})
+
+	t.Run("semaphore timeout", func(t *testing.T) {
+		logger, drops := newHookedLogger(t, nil)
+		for i := 0; i < cap(logger.swapSemaphore); i++ {
+			logger.swapSemaphore <- struct{}{}
+		}
+		fillActiveSet(logger)
+		assert.Equal(t, ErrBufferFull, logger.TryLogBytes([]byte("full")))
+		expectDrop(t, drops, drop{DropReasonSemaphoreTimeout, 4})
+		for len(logger.swapSemaphore) > 0 {
+			<-logger.swapSemaphore
+		}
+		logger.setB.pendingFlush.Store(false)
+	})
+
+	t.Run("oversized", func(t *testing.T) {
+		logger, drops := newHookedLogger(t, nil)
+		logger.LogBytes(make([]byte, 128*1024))
+		expectDrop(t, drops, drop{DropReasonOversized, 128 * 1024})
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		logger, drops := newHookedLogger(t, nil)
+		fillActiveSet(logger)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, logger.LogBytesBlocking(ctx, []byte("waiting")), context.DeadlineExceeded)
+		expectDrop(t, drops, drop{DropReasonCanceled, 7})
+		logger.setB.pendingFlush.Store(false)
+	})
+
+	t.Run("slow callback does not block writers", func(t *testing.T) {
+		release := make(chan struct{})
+		logger, _ := newHookedLogger(t, func(config *Config) {
+			config.OnDrop = func(DropReason, int) { <-release }
+		})
+		require.NoError(t, logger.Close())
+
+		start := time.Now()
+		for i := 0; i < 2*hookQueueSize; i++ {
+			logger.Log("late")
+		}
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Greater(t, logger.GetDiscardedCallbacks(), int64(0), "events beyond the queue are discarded")
+		close(release)
+	})
+}
+
+func TestLogger_OnFlushError(t *testing.T) {
+	type flushError struct {
+		err    error
+		shards int
+		bytes  int
+	}
+	errs := make(chan flushError, 4)
+
+	config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+	config.BufferSize = 64 * 1024
+	config.NumShards = 1
+	config.OnFlushError = func(err error, shards int, bytes int) { errs <- flushError{err, shards, bytes} }
+
+	logger, err := New(config)
+	require.NoError(t, err)
+	defer logger.Close()
+
+	// Closing the file underneath the writer makes the next flush fail
+	logger.Log("lost")
+	require.NoError(t, logger.fileWriter.(*DirectFileWriter).file.Close())
+	assert.Error(t, logger.Flush(context.Background()))
+
+	select {
+	case got := <-errs:
+		assert.Error(t, got.err)
+		assert.Equal(t, 1, got.shards)
+		assert.Greater(t, got.bytes, 0)
+	case <-time.After(time.Second):
+		t.Fatal("OnFlushError was not called")
+	}
+	_, _, _, _, flushErrors, _, _, _ := logger.GetStatsSnapshot()
+	assert.Equal(t, int64(1), flushErrors)
+}
+
+// slowFileWriter wraps a FileWriter and blocks every write until release is closed
+type slowFileWriter struct {
+	FileWriter
+	started chan struct{} // Signaled when a write starts
+	release chan struct{} // Closed to let writes proceed
+	closed  chan struct{} // Closed after Close
+}
+
+func newSlowFileWriter(inner FileWriter) *slowFileWriter {
+	return &slowFileWriter{
+		FileWriter: inner,
+		started:    make(chan struct{}, 1),
+		release:    make(chan struct{}),
+		closed:     make(chan struct{}),
+	}
+}
+
+func (w *slowFileWriter) WriteVectored(buffers [][]byte) (int, error) {
+	select {
+	case w.started <- struct{}{}:
+	default:
+	}
+	<-w.release
+	return w.FileWriter.WriteVectored(buffers)
+}
+
+func (w *slowFileWriter) Close() error {
+	defer close(w.closed)
+	return w.FileWriter.Close()
+}
+
+func TestLogger_CloseContext(t *testing.T) {
+	// newMidFlushLogger returns a logger whose flush worker is blocked writing 10 entries,
+	// with 10 more entries buffered in the other set
+	newMidFlushLogger := func(t *testing.T) (*Logger, *slowFileWriter, string) {
+		t.Helper()
+		logPath := filepath.Join(t.TempDir(), "test.log")
+		config := DefaultConfig(logPath)
+		config.BufferSize = 64 * 1024
+		config.NumShards = 1
+		config.FlushInterval = time.Hour
+
+		logger, err := New(config)
+		require.NoError(t, err)
+		slow := newSlowFileWriter(logger.fileWriter)
+		logger.fileWriter = slow
+
+		for i := 0; i < 10; i++ {
+			logger.Log(fmt.Sprintf("in-flight-%d", i))
+		}
+		logger.trySwap(FlushTriggerThreshold)
+		select {
+		case <-slow.started:
+		case <-time.After(time.Second):
+			t.Fatal("flush worker did not start writing")
+		}
+		for i := 0; i < 10; i++ {
+			logger.Log(fmt.Sprintf("buffered-%d", i))
+		}
+		return logger, slow, logPath
+	}
+
+	t.Run("flushes in-flight and buffered data within the deadline", func(t *testing.T) {
+		logger, slow, logPath := newMidFlushLogger(t)
+
+		type result struct {
+			report CloseReport
+			err    error
+		}
+		results := make(chan result, 1)
+		go func() {
+			report, err := logger.CloseWithTimeout(5 * time.Second)
+			results <- result{report, err}
+		}()
+
+		// Close must wait for the in-flight write instead of proceeding without it
+		select {
+		case <-results:
+			t.Fatal("Close returned while a flush was in progress")
+		case <-time.After(50 * time.Millisecond):
+		}
+		close(slow.release)
+
+		res := <-results
+		require.NoError(t, res.err)
+		assert.False(t, res.report.DeadlineExceeded)
+		assert.Equal(t, int64(20), res.report.EntriesFlushed)
+		assert.Equal(t, int64(0), res.report.EntriesDropped)
+		assert.Greater(t, res.report.BytesFlushed, int64(0))
+		assert.Equal(t, 20, countLogRecords(t, logPath))
+	})
+
+	t.Run("reports entries left at the deadline", func(t *testing.T) {
+		logger, slow, logPath := newMidFlushLogger(t)
+
+		report, err := logger.CloseWithTimeout(50 * time.Millisecond)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.True(t, report.DeadlineExceeded)
+		assert.Equal(t, int64(0), report.EntriesFlushed)
+		assert.Equal(t, int64(20), report.EntriesDropped)
+		assert.Equal(t, ErrClosed, logger.TryLogBytes([]byte("late")))
+
+		// The in-flight write completes in the background; the buffered set is abandoned
+		close(slow.release)
+		select {
+		case <-slow.closed:
+		case <-time.After(time.Second):
+			t.Fatal("file writer was not closed after the in-flight write")
+		}
+		assert.Equal(t, 10, countLogRecords(t, logPath))
+	})
+
+	t.Run("second close returns an empty report", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		config.BufferSize = 64 * 1024
+		config.NumShards = 1
+
+		logger, err := New(config)
+		require.NoError(t, err)
+		logger.Log("once")
+
+		report, err := logger.CloseContext(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), report.EntriesFlushed)
+
+		report, err = logger.CloseContext(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, CloseReport{}, report)
+	})
+
+	t.Run("second close waits for the first", func(t *testing.T) {
+		logger, slow, logPath := newMidFlushLogger(t)
+
+		first := make(chan error, 1)
+		go func() { first <- logger.Close() }()
+		require.Eventually(t, logger.life.Closed, time.Second, time.Millisecond)
+
+		second := make(chan error, 1)
+		go func() { second <- logger.Close() }()
+		select {
+		case <-second:
+			t.Fatal("second close returned while the first was still flushing")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(slow.release)
+		require.NoError(t, <-second)
+		assert.Equal(t, 20, countLogRecords(t, logPath))
+		require.NoError(t, <-first)
+	})
+
+	t.Run("logs racing close are flushed or dropped", func(t *testing.T) {
+		logPath := filepath.Join(t.TempDir(), "race.log")
+		config := DefaultConfig(logPath)
+		config.BufferSize = 256 * 1024
+		config.NumShards = 4
+		config.FlushInterval = 2 * time.Second // Flushes come from full buffers and Close
+		config.FlushTimeout = time.Second      // Flushes never give up on a write in progress
+
+		logger, err := New(config)
+		require.NoError(t, err)
+		hammerUntilClosed(t, logger.life.Closed, func(data []byte) { logger.LogBytes(data) }, func() {
+			require.NoError(t, logger.Close())
+		})
+
+		totalLogs, droppedLogs, _, _, flushErrors, _, _, _ := logger.GetStatsSnapshot()
+		assert.Zero(t, flushErrors)
+		assert.Equal(t, totalLogs-droppedLogs, int64(countLogRecords(t, logPath)))
+	})
+}
+
+// hammerUntilClosed logs from 50 goroutines, runs closeFn while they do, and returns once every
+// goroutine has logged at least once after closed reports true
+func hammerUntilClosed(t *testing.T, closed func() bool, log func([]byte), closeFn func()) {
+	t.Helper()
+	var wg sync.WaitGroup
+	for g := 0; g < 50; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				wasClosed := closed()
+				log([]byte(fmt.Sprintf("writer-%d-%d", g, i)))
+				if wasClosed {
+					return
+				}
+			}
+		}(g)
+	}
+	time.Sleep(20 * time.Millisecond)
+	closeFn()
+	wg.Wait()
+}
+
+// captureLogger is an InternalLogger that records formatted messages
+type captureLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (c *captureLogger) Printf(format string, args ...any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, fmt.Sprintf(format, args...))
+}
+
+func (c *captureLogger) Messages() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.messages...)
+}
+
+func TestLogger_InternalLogger(t *testing.T) {
+	t.Run("defaults to stderr", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		require.NoError(t, config.Validate())
+		assert.Equal(t, defaultInternalLogger, config.InternalLogger)
+	})
+
+	t.Run("receives flush errors", func(t *testing.T) {
+		capture := &captureLogger{}
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		config.BufferSize = 64 * 1024
+		config.NumShards = 1
+		config.InternalLogger = capture
+
+		logger, err := New(config)
+		require.NoError(t, err)
+		defer logger.Close()
+
+		logger.Log("lost")
+		require.NoError(t, logger.fileWriter.(*DirectFileWriter).file.Close())
+		assert.Error(t, logger.Flush(context.Background()))
+
+		messages := capture.Messages()
+		require.Len(t, messages, 1)
+		assert.Contains(t, messages[0], "[FLUSH_ERROR] Logger="+config.LogFilePath)
+		assert.NotContains(t, messages[0], "\n")
+	})
+
+	t.Run("receives callback panics", func(t *testing.T) {
+		capture := &captureLogger{}
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		config.BufferSize = 64 * 1024
+		config.NumShards = 1
+		config.InternalLogger = capture
+		config.OnDrop = func(DropReason, int) { panic("boom") }
+
+		logger, err := New(config)
+		require.NoError(t, err)
+		require.NoError(t, logger.Close())
+		logger.Log("late")
+
+		assert.Eventually(t, func() bool {
+			messages := capture.Messages()
+			return len(messages) == 1 && messages[0] == "[WARNING] Logger callback panicked: boom"
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("slog adapter maps tags to levels", func(t *testing.T) {
+		var buf bytes.Buffer
+		internal := NewSlogInternalLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+		internal.Printf("[WARNING] Failed to preallocate %d bytes", 4096)
+		internal.Printf("[FLUSH_ERROR] Shards=%d", 2)
+		internal.Printf("untagged")
+
+		var records []map[string]any
+		for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+			var record map[string]any
+			require.NoError(t, json.Unmarshal(line, &record))
+			records = append(records, record)
+		}
+		require.Len(t, records, 3)
+		assert.Equal(t, "WARN", records[0]["level"])
+		assert.Equal(t, "Failed to preallocate 4096 bytes", records[0]["msg"])
+		assert.Equal(t, "WARNING", records[0]["tag"])
+		assert.Equal(t, "ERROR", records[1]["level"])
+		assert.Equal(t, "FLUSH_ERROR", records[1]["tag"])
+		assert.Equal(t, "INFO", records[2]["level"])
+		assert.NotContains(t, records[2], "tag")
+	})
+}
+
+// timedWriter is an in-memory FileWriter whose writes take writeDuration, of which pwritevDuration
+// is reported as syscall time
+type timedWriter struct {
+	writeDuration   time.Duration
+	pwritevDuration time.Duration
+}
+
+func (w *timedWriter) WriteVectored(buffers [][]byte) (int, error) {
+	time.Sleep(w.writeDuration)
+	n := 0
+	for _, buf := range buffers {
+		n += len(buf)
+	}
+	return n, nil
+}
+
+func (w *timedWriter) GetLastPwritevDuration() time.Duration { return w.pwritevDuration }
+
+func (w *timedWriter) Close() error { return nil }
+
+func TestLogger_NewWithWriter(t *testing.T) {
+	config := DefaultConfig(filepath.Join(t.TempDir(), "unused.log"))
+	config.BufferSize = 256 * 1024
+	config.NumShards = 2
+	w := &timedWriter{writeDuration: 4 * time.Millisecond, pwritevDuration: 2 * time.Millisecond}
+
+	logger, err := NewWithWriter(config, w)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		logger.Log("entry")
+		require.NoError(t, logger.Flush(context.Background()))
+	}
+	require.NoError(t, logger.Close())
+
+	// Pwritev metrics come from the injected writer's GetLastPwritevDuration
+	metrics := logger.GetFlushMetrics()
+	require.Positive(t, metrics.TotalFlushes)
+	assert.Equal(t, 2*time.Millisecond, metrics.AvgPwritevDuration)
+	assert.Equal(t, 2*time.Millisecond, metrics.MaxPwritevDuration)
+	assert.Greater(t, metrics.PwritevPercent, 0.0)
+	assert.Less(t, metrics.PwritevPercent, metrics.WritePercent)
+	assert.GreaterOrEqual(t, metrics.AvgWriteDuration, 4*time.Millisecond)
+
+	_, err = NewWithWriter(config, nil)
+	assert.Error(t, err)
+}
+
+// countLogRecords parses a log file (shard headers + length-prefixed records) and returns the record count
+func countLogRecords(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	records := 0
+	for offset := 0; offset+8 <= len(data); {
+		capacity := int(binary.LittleEndian.Uint32(data[offset : offset+4]))
+		validDataBytes := int(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
+		if capacity == 0 {
+			break
+		}
+		require.LessOrEqual(t, offset+8+validDataBytes, len(data), "shard data past end of file")
+
+		shardData := data[offset+8 : offset+8+validDataBytes]
+		for pos := 0; pos+4 <= len(shardData); {
+			length := int(binary.LittleEndian.Uint32(shardData[pos : pos+4]))
+			pos += 4 + length
+			records++
+		}
+		offset += capacity
+	}
+	return records
+}
+
+func TestTrySwap_CoalescesWhileOtherSetPending(t *testing.T) {
+	// Swapping into a set that is still queued or flushing would lose its data, so the swap is
+	// coalesced into the pending flush and the active set keeps its data for the next swap
+	type swapper struct {
+		log        func(string)
+		trySwap    func() bool
+		active     func() *BufferSet
+		setA, setB *BufferSet
+		stats      *Statistics
+	}
+	cases := map[string]func(t *testing.T) swapper{
+		"Logger": func(t *testing.T) swapper {
+			config := DefaultConfig(filepath.Join(t.TempDir(), "swap.log"))
+			config.BufferSize = 256 * 1024
+			config.NumShards = 2
+			config.FlushInterval = time.Hour
+			logger, err := New(config)
+			require.NoError(t, err)
+			t.Cleanup(func() { logger.Close() })
+			trySwap := func() bool { return logger.trySwap(FlushTriggerThreshold) }
+			return swapper{logger.Log, trySwap, logger.activeSet.Load, logger.setA, logger.setB, &logger.stats}
+		},
+		"SizeLogger": func(t *testing.T) swapper {
+			config := DefaultSizeConfig(filepath.Join(t.TempDir(), "swap.log"))
+			config.BufferSize = 256 * 1024
+			config.NumShards = 2
+			config.FlushInterval = time.Hour
+			logger, err := NewSizeLogger(config)
+			require.NoError(t, err)
+			t.Cleanup(func() { logger.Close() })
+			return swapper{logger.Log, logger.trySwap, logger.activeSet.Load, logger.setA, logger.setB, &logger.stats}
+		},
+	}
+	for name, newSwapper := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := newSwapper(t)
+			require.Same(t, s.setA, s.active())
+			s.log("kept")
+
+			s.setB.pendingFlush.Store(true)
+			s.trySwap()
+			assert.Same(t, s.setA, s.active())
+			assert.Equal(t, int64(1), s.stats.FlushesCoalesced.Load())
+			assert.Zero(t, s.stats.SetSwaps.Load())
+			assert.True(t, s.setA.HasData())
+
+			// Once the other set is flushed, the next swap queues the active set exactly once
+			s.setB.pendingFlush.Store(false)
+			s.trySwap()
+			assert.Same(t, s.setB, s.active())
+			require.Eventually(t, func() bool {
+				return s.stats.Flushes.Load() == 1 && !s.setA.PendingFlush()
+			}, 5*time.Second, time.Millisecond)
+			assert.False(t, s.setA.HasData())
+		})
+	}
+}
+
+func TestSizeLogger_CloseRacingWrites(t *testing.T) {
+	config := DefaultSizeConfig(filepath.Join(t.TempDir(), "race.log"))
+	config.BufferSize = 256 * 1024
+	config.NumShards = 4
+	config.FlushInterval = 2 * time.Second // Flushes come from full buffers and Close
+	config.FlushTimeout = time.Second      // Flushes never give up on a write in progress
+	config.MaxFileSize = 4 * 1024 * 1024
+	config.PreallocateFileSize = config.MaxFileSize
+	config.RotationHistory = 1024
+
+	logger, err := NewSizeLogger(config)
+	require.NoError(t, err)
+	closed := make(chan error, 2)
+	hammerUntilClosed(t, logger.closed.Load, logger.LogBytes, func() {
+		// Both calls return only once the data is on disk
+		go func() { closed <- logger.Close() }()
+		closed <- logger.Close()
+	})
+	require.NoError(t, <-closed)
+	require.NoError(t, <-closed)
+
+	totalLogs, droppedLogs, _, _, flushErrors, _, _, _ := logger.GetStatsSnapshot()
+	assert.Zero(t, flushErrors)
+	records := 0
+	for _, info := range logger.RotatedFiles() {
+		records += countLogRecords(t, info.OldPath)
+	}
+	assert.Equal(t, totalLogs-droppedLogs, int64(records))
+}
+
+func TestSizeLogger_CloseAfterBurst(t *testing.T) {
+	dir := t.TempDir()
+	config := DefaultSizeConfig(filepath.Join(dir, "burst.log"))
+	config.BufferSize = 256 * 1024
+	config.NumShards = 4
+	config.FlushInterval = time.Hour // Flushes come from full buffers and Close
+	config.FlushTimeout = time.Second
+	config.MaxFileSize = 256 * 1024 // A file per flushed set or two
+	config.RotationHistory = 1024
+
+	logger, err := NewSizeLogger(config)
+	require.NoError(t, err)
+
+	// Entries are unique and self-describing, so every one found can be checked byte for byte
+	entry := func(g, i int) string {
+		return fmt.Sprintf("burst-%d-%d-%s", g, i, strings.Repeat(string(rune('a'+g)), 100+i%200))
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				logger.Log(entry(g, i))
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// Close right after the burst, with sets still queued and buffered
+	summary, err := logger.CloseWithSummary()
+	require.NoError(t, err)
+
+	rotated := logger.RotatedFiles()
+	require.NotEmpty(t, rotated)
+	final := rotated[len(rotated)-1]
+	assert.Equal(t, RotationClose, final.Reason)
+	assert.Equal(t, final.OldPath, summary.FinalFile)
+	assert.Equal(t, final.Bytes, summary.FinalFileBytes)
+	assert.Equal(t, int64(len(rotated)-1), summary.Rotations)
+
+	// The files written are exactly those rotated, with no preallocated next file left behind
+	var paths []string
+	for _, info := range rotated {
+		paths = append(paths, info.OldPath)
+	}
+	onDisk, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, paths, onDisk)
+
+	// Every accepted entry is in exactly one file, intact
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		for _, e := range readEntries(t, path) {
+			var g, i int
+			_, err := fmt.Sscanf(e, "burst-%d-%d-", &g, &i)
+			require.NoError(t, err, "entry %q", e)
+			require.Equal(t, entry(g, i), e)
+			require.False(t, seen[e], "entry %q written twice", e)
+			seen[e] = true
+		}
+	}
+	totalLogs, droppedLogs, _, _, flushErrors, _, _, _ := logger.GetStatsSnapshot()
+	assert.Zero(t, flushErrors)
+	assert.Equal(t, totalLogs-droppedLogs, int64(len(seen)))
+	assert.Equal(t, int64(8*2000), totalLogs)
+
+	// A second Close has nothing left to report
+	summary, err = logger.CloseWithSummary()
+	assert.NoError(t, err)
+	assert.Equal(t, CloseSummary{}, summary)
+}
+
+// errorWriter wraps a FileWriter and fails writes with err while it is set, writing nothing
+type errorWriter struct {
+	FileWriter
+	mu  sync.Mutex
+	err error
+}
+
+func (w *errorWriter) WriteVectored(buffers [][]byte) (int, error) {
+	w.mu.Lock()
+	err := w.err
+	w.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	return w.FileWriter.WriteVectored(buffers)
+}
+
+func (w *errorWriter) setErr(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.err = err
+}
+
+// payloadBytes sums the entry payloads (without timestamps) of the log files at paths
+func payloadBytes(t *testing.T, opts reader.Options, paths ...string) int64 {
+	t.Helper()
+	var n int64
+	for _, path := range paths {
+		r, err := reader.Open(path, opts)
+		require.NoError(t, err)
+		for {
+			entry, err := r.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+			n += int64(len(entry))
+		}
+		require.NoError(t, r.Close())
+	}
+	return n
+}
+
+func TestLogger_ByteAccounting(t *testing.T) {
+	newAccountingLogger := func(t *testing.T, configure func(*Config)) (*Logger, *errorWriter, string) {
+		t.Helper()
+		logPath := filepath.Join(t.TempDir(), "bytes.log")
+		config := DefaultConfig(logPath)
+		config.BufferSize = 256 * 1024
+		config.NumShards = 2
+		config.FlushInterval = time.Hour
+		if configure != nil {
+			configure(&config)
+		}
+		fileWriter, err := NewFileWriter(config)
+		require.NoError(t, err)
+		writer := &errorWriter{FileWriter: fileWriter}
+		logger, err := NewWithWriter(config, writer)
+		require.NoError(t, err)
+		return logger, writer, logPath
+	}
+
+	t.Run("payload excludes prefixes, timestamps and padding", func(t *testing.T) {
+		logger, _, logPath := newAccountingLogger(t, func(c *Config) { c.PrependTimestamp = TimestampUnixNano })
+		require.NoError(t, logger.TryLogBytes([]byte("hello")))
+		require.NoError(t, logger.TryLogBytes(bytes.Repeat([]byte{'x'}, 1000)))
+		require.NoError(t, logger.LogEntry(func(buf *EntryBuffer) { buf.AppendString("entry") }))
+		const payload = 5 + 1000 + 5
+
+		_, _, bytesWritten, _, _, _, bytesBuffered, bytesDurable := logger.GetStatsSnapshot()
+		assert.Equal(t, int64(payload), bytesBuffered)
+		assert.Zero(t, bytesDurable, "nothing is durable before a flush")
+		assert.Zero(t, bytesWritten)
+
+		require.NoError(t, logger.Close())
+		_, _, bytesWritten, _, _, _, bytesBuffered, bytesDurable = logger.GetStatsSnapshot()
+		assert.Equal(t, int64(payload), bytesBuffered)
+		assert.Equal(t, int64(payload), bytesDurable)
+		assert.Greater(t, bytesWritten, bytesDurable, "BytesWritten keeps counting file bytes")
+		assert.Equal(t, int64(payload), payloadBytes(t, reader.Options{Timestamp: TimestampUnixNano}, logPath))
+	})
+
+	t.Run("failed flushes are never durable", func(t *testing.T) {
+		logger, writer, logPath := newAccountingLogger(t, nil)
+		for i := 0; i < 10; i++ {
+			logger.Log(fmt.Sprintf("lost-%d", i))
+		}
+		writer.setErr(errors.New("disk error"))
+		assert.Error(t, logger.Flush(context.Background()))
+		_, _, _, _, flushErrors, _, bytesBuffered, bytesDurable := logger.GetStatsSnapshot()
+		assert.Equal(t, int64(1), flushErrors)
+		assert.Equal(t, int64(60), bytesBuffered)
+		assert.Zero(t, bytesDurable)
+		assert.Equal(t, int64(1), logger.GetFlushMetrics().FlushErrors)
+
+		writer.setErr(nil)
+		for i := 0; i < 10; i++ {
+			logger.Log(fmt.Sprintf("kept-%d", i))
+		}
+		require.NoError(t, logger.Close())
+		_, _, _, _, _, _, bytesBuffered, bytesDurable = logger.GetStatsSnapshot()
+		assert.Equal(t, int64(120), bytesBuffered)
+		assert.Equal(t, int64(60), bytesDurable)
+		assert.Equal(t, int64(60), payloadBytes(t, reader.Options{}, logPath))
+	})
+
+	t.Run("rotated files", func(t *testing.T) {
+		logger, _, logPath := newAccountingLogger(t, func(c *Config) {
+			c.MaxFileSize = 128 * 1024 // Every flush writes a whole 128KB shard, so each rotates
+		})
+		for i := 0; i < 3; i++ {
+			logger.Log(fmt.Sprintf("file-%d", i))
+			require.NoError(t, logger.Flush(context.Background()))
+		}
+		require.NoError(t, logger.Close())
+
+		paths, err := filepath.Glob(filepath.Join(filepath.Dir(logPath), "bytes*.log"))
+		require.NoError(t, err)
+		require.Len(t, paths, 3)
+		_, _, _, _, _, _, bytesBuffered, bytesDurable := logger.GetStatsSnapshot()
+		assert.Equal(t, int64(18), bytesBuffered)
+		assert.Equal(t, int64(18), bytesDurable)
+		assert.Equal(t, int64(18), payloadBytes(t, reader.Options{}, paths...))
+	})
+
+	t.Run("manager sums event loggers", func(t *testing.T) {
+		lm, err := NewLoggerManager(DefaultConfig(filepath.Join(t.TempDir(), "events.log")))
+		require.NoError(t, err)
+		defer lm.Close()
+		lm.LogWithEvent("payment", "12345")
+		lm.LogWithEvent("login", "abc")
+		require.NoError(t, lm.FlushAll(context.Background()))
+
+		_, _, _, _, _, _, bytesBuffered, bytesDurable := lm.GetStatsSnapshot()
+		assert.Equal(t, int64(8), bytesBuffered)
+		assert.Equal(t, int64(8), bytesDurable)
+
+		_, _, _, _, _, _, bytesBuffered, bytesDurable, err = lm.GetEventStats("login")
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), bytesBuffered)
+		assert.Equal(t, int64(3), bytesDurable)
+	})
+}
@@ -0,0 +1,183 @@
+// Package metrics exports asynclogger statistics as Prometheus metrics
+//
+// Counters and gauges are read from the logger's stats getters at scrape time. Duration
+// histograms are fed by the flush observer, which each collector installs on construction
+// (replacing any observer set before). The package is separate so that users who do not want
+// the Prometheus client do not link it.
+//
+//	logger, _ := asynclogger.New(config)
+//	prometheus.MustRegister(metrics.NewPrometheusCollector(logger))
+package metrics
+
+import (
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "asynclogger"
+
+// DurationBuckets are the histogram buckets (seconds) for flush and write durations:
+// 100µs doubling up to ~6.5s
+var DurationBuckets = prometheus.ExponentialBuckets(0.0001, 2, 17)
+
+// sample holds one scrape of a logger's statistics
+type sample struct {
+	totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps int64
+	bytesBuffered, bytesDurable                                          int64
+	flush                                                                asynclogger.FlushMetrics
+	blockedWrites                                                        int64
+	blockedSeconds                                                       float64
+	retryPath, retryTimeouts                                             int64
+	partialFlushes                                                       int64
+}
+
+// takeSample reads all statistics of a logger
+func takeSample(logger *asynclogger.Logger) sample {
+	var s sample
+	s.totalLogs, s.droppedLogs, s.bytesWritten, s.flushes, s.flushErrors, s.setSwaps, s.bytesBuffered, s.bytesDurable = logger.GetStatsSnapshot()
+	s.flush = logger.GetFlushMetrics()
+	blockedWrites, totalBlocked, _ := logger.GetBackpressureStats()
+	s.blockedWrites, s.blockedSeconds = blockedWrites, totalBlocked.Seconds()
+	_, s.retryPath, s.retryTimeouts = logger.GetWritePathStats()
+	s.partialFlushes = logger.GetStatsStruct().PartialFlushes
+	return s
+}
+
+// Collector exports logger statistics
+// A Collector for a LoggerManager labels every metric with "event"
+type Collector struct {
+	loggers func(fn func(eventName string, logger *asynclogger.Logger) bool) // "" for a single logger
+	labels  []string
+
+	counters []metricDesc
+	gauges   []metricDesc
+
+	flushDuration   *prometheus.HistogramVec
+	writeDuration   *prometheus.HistogramVec
+	pwritevDuration *prometheus.HistogramVec
+}
+
+// metricDesc is a counter or gauge read from a sample
+type metricDesc struct {
+	desc  *prometheus.Desc
+	value func(sample) float64
+}
+
+// NewPrometheusCollector creates a Collector for a single Logger and installs its flush observer
+func NewPrometheusCollector(logger *asynclogger.Logger) *Collector {
+	c := newCollector(nil, func(fn func(string, *asynclogger.Logger) bool) {
+		fn("", logger)
+	})
+	logger.SetFlushObserver(func(observation asynclogger.FlushObservation) {
+		c.observeFlush(observation)
+	})
+	return c
+}
+
+// NewManagerCollector creates a Collector for every event logger of a LoggerManager (labeled by
+// event) and installs the manager's flush observer, which also covers loggers created later
+func NewManagerCollector(lm *asynclogger.LoggerManager) *Collector {
+	c := newCollector([]string{"event"}, lm.RangeEventLoggers)
+	lm.SetFlushObserver(func(eventName string, observation asynclogger.FlushObservation) {
+		c.observeFlush(observation, eventName)
+	})
+	return c
+}
+
+// newCollector builds the descriptors shared by logger and manager collectors
+func newCollector(labels []string, loggers func(fn func(string, *asynclogger.Logger) bool)) *Collector {
+	metric := func(name, help string, value func(sample) float64) metricDesc {
+		return metricDesc{prometheus.NewDesc(namespace+"_"+name, help, labels, nil), value}
+	}
+	histogram := func(name, help string) *prometheus.HistogramVec {
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      name,
+			Help:      help,
+			Buckets:   DurationBuckets,
+		}, labels)
+	}
+
+	return &Collector{
+		loggers: loggers,
+		labels:  labels,
+		counters: []metricDesc{
+			metric("logs_total", "Log calls, including dropped ones",
+				func(s sample) float64 { return float64(s.totalLogs) }),
+			metric("dropped_logs_total", "Logs dropped (full buffers, oversized or closed)",
+				func(s sample) float64 { return float64(s.droppedLogs) }),
+			metric("bytes_written_total", "File bytes written by successful flushes (including headers and padding)",
+				func(s sample) float64 { return float64(s.bytesWritten) }),
+			metric("bytes_buffered_total", "Log payload bytes accepted into shard buffers",
+				func(s sample) float64 { return float64(s.bytesBuffered) }),
+			metric("bytes_durable_total", "Log payload bytes written to disk by successful flushes",
+				func(s sample) float64 { return float64(s.bytesDurable) }),
+			metric("flushes_total", "Flushes",
+				func(s sample) float64 { return float64(s.flushes) }),
+			metric("flush_errors_total", "Failed flushes",
+				func(s sample) float64 { return float64(s.flushErrors) }),
+			metric("partial_flushes_total", "Flushes that went ahead after FlushTimeout with writes still in progress",
+				func(s sample) float64 { return float64(s.partialFlushes) }),
+			metric("set_swaps_total", "Buffer set swaps",
+				func(s sample) float64 { return float64(s.setSwaps) }),
+			metric("blocked_swaps_total", "Swaps that waited for the flush semaphore",
+				func(s sample) float64 { return float64(s.flush.BlockedSwaps) }),
+			metric("blocked_writes_total", "Writes that waited for buffer space",
+				func(s sample) float64 { return float64(s.blockedWrites) }),
+			metric("blocked_seconds_total", "Time writers spent waiting for buffer space",
+				func(s sample) float64 { return s.blockedSeconds }),
+			metric("retry_path_writes_total", "Writes that entered the retry path",
+				func(s sample) float64 { return float64(s.retryPath) }),
+			metric("retry_timeouts_total", "Writes dropped after the retry path timed out",
+				func(s sample) float64 { return float64(s.retryTimeouts) }),
+		},
+		gauges: []metricDesc{
+			metric("flush_queue_depth", "Flushes queued or in progress",
+				func(s sample) float64 { return float64(s.flush.FlushQueueDepth) }),
+		},
+		flushDuration:   histogram("flush_duration_seconds", "Flush duration, including waiting for in-flight writes"),
+		writeDuration:   histogram("write_duration_seconds", "WriteVectored duration (includes rotation checks)"),
+		pwritevDuration: histogram("pwritev_duration_seconds", "Pwritev syscall duration (pure disk I/O)"),
+	}
+}
+
+// observeFlush records one flush in the histograms
+func (c *Collector) observeFlush(observation asynclogger.FlushObservation, labelValues ...string) {
+	c.flushDuration.WithLabelValues(labelValues...).Observe(observation.Duration.Seconds())
+	c.writeDuration.WithLabelValues(labelValues...).Observe(observation.WriteDuration.Seconds())
+	c.pwritevDuration.WithLabelValues(labelValues...).Observe(observation.PwritevDuration.Seconds())
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, counter := range c.counters {
+		ch <- counter.desc
+	}
+	for _, gauge := range c.gauges {
+		ch <- gauge.desc
+	}
+	c.flushDuration.Describe(ch)
+	c.writeDuration.Describe(ch)
+	c.pwritevDuration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.loggers(func(event string, logger *asynclogger.Logger) bool {
+		var labelValues []string
+		if len(c.labels) > 0 {
+			labelValues = []string{event}
+		}
+		s := takeSample(logger)
+		for _, counter := range c.counters {
+			ch <- prometheus.MustNewConstMetric(counter.desc, prometheus.CounterValue, counter.value(s), labelValues...)
+		}
+		for _, gauge := range c.gauges {
+			ch <- prometheus.MustNewConstMetric(gauge.desc, prometheus.GaugeValue, gauge.value(s), labelValues...)
+		}
+		return true
+	})
+	c.flushDuration.Collect(ch)
+	c.writeDuration.Collect(ch)
+	c.pwritevDuration.Collect(ch)
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gather registers c in a fresh registry and returns the gathered families by name
+func gather(t *testing.T, c prometheus.Collector) map[string]*dto.MetricFamily {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(c))
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+	return byName
+}
+
+// metricWithLabel returns the family's metric whose label name has value (or the only metric when name is "")
+func metricWithLabel(t *testing.T, family *dto.MetricFamily, name, value string) *dto.Metric {
+	t.Helper()
+	require.NotNil(t, family)
+	for _, metric := range family.GetMetric() {
+		if name == "" {
+			return metric
+		}
+		for _, label := range metric.GetLabel() {
+			if label.GetName() == name && label.GetValue() == value {
+				return metric
+			}
+		}
+	}
+	require.Failf(t, "metric not found", "%s{%s=%q}", family.GetName(), name, value)
+	return nil
+}
+
+func newTestConfig(t *testing.T, name string) asynclogger.Config {
+	config := asynclogger.DefaultConfig(filepath.Join(t.TempDir(), name+".log"))
+	config.BufferSize = 256 * 1024
+	config.NumShards = 2
+	return config
+}
+
+func TestPrometheusCollector(t *testing.T) {
+	t.Run("exports logger statistics", func(t *testing.T) {
+		logger, err := asynclogger.New(newTestConfig(t, "metrics"))
+		require.NoError(t, err)
+		defer logger.Close()
+		collector := NewPrometheusCollector(logger)
+
+		for i := 0; i < 100; i++ {
+			logger.LogBytes([]byte(fmt.Sprintf("message %d", i)))
+		}
+		require.NoError(t, logger.Flush(context.Background()))
+
+		families := gather(t, collector)
+		totalLogs, _, bytesWritten, flushes, _, _, _, bytesDurable := logger.GetStatsSnapshot()
+		assert.Equal(t, float64(totalLogs), metricWithLabel(t, families["asynclogger_logs_total"], "", "").GetCounter().GetValue())
+		assert.Equal(t, float64(bytesWritten), metricWithLabel(t, families["asynclogger_bytes_written_total"], "", "").GetCounter().GetValue())
+		assert.Equal(t, float64(bytesDurable), metricWithLabel(t, families["asynclogger_bytes_durable_total"], "", "").GetCounter().GetValue())
+		assert.Equal(t, float64(flushes), metricWithLabel(t, families["asynclogger_flushes_total"], "", "").GetCounter().GetValue())
+		assert.Equal(t, float64(0), metricWithLabel(t, families["asynclogger_flush_queue_depth"], "", "").GetGauge().GetValue())
+
+		flushDuration := metricWithLabel(t, families["asynclogger_flush_duration_seconds"], "", "").GetHistogram()
+		assert.Equal(t, uint64(1), flushDuration.GetSampleCount())
+		assert.Greater(t, flushDuration.GetSampleSum(), 0.0)
+		assert.NotNil(t, families["asynclogger_pwritev_duration_seconds"])
+	})
+
+	t.Run("manager labels events", func(t *testing.T) {
+		lm, err := asynclogger.NewLoggerManager(newTestConfig(t, "events"))
+		require.NoError(t, err)
+		defer lm.Close()
+
+		// Loggers created before and after the collector are both observed
+		lm.LogWithEvent("payment", "before")
+		collector := NewManagerCollector(lm)
+		lm.LogWithEvent("login", "after")
+		lm.LogWithEvent("login", "after")
+		require.NoError(t, lm.FlushAll(context.Background()))
+
+		families := gather(t, collector)
+		logs := families["asynclogger_logs_total"]
+		assert.Equal(t, float64(1), metricWithLabel(t, logs, "event", "payment").GetCounter().GetValue())
+		assert.Equal(t, float64(2), metricWithLabel(t, logs, "event", "login").GetCounter().GetValue())
+
+		flushDuration := families["asynclogger_flush_duration_seconds"]
+		assert.Equal(t, uint64(1), metricWithLabel(t, flushDuration, "event", "payment").GetHistogram().GetSampleCount())
+		assert.Equal(t, uint64(1), metricWithLabel(t, flushDuration, "event", "login").GetHistogram().GetSampleCount())
+	})
+}
@@ -0,0 +1,181 @@
+package asynclogger
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// plainConfig returns a config for OutputPlain in dir
+func plainConfig(dir string) Config {
+	config := DefaultConfig(filepath.Join(dir, "plain.log"))
+	config.BufferSize = 2 * 64 * 1024
+	config.NumShards = 2
+	config.FlushInterval = time.Hour
+	config.IOMode = IOModeBuffered
+	config.OutputFormat = OutputPlain
+	return config
+}
+
+// scanLines returns the lines of the files matching pattern, in file name order
+func scanLines(t *testing.T, pattern string) []string {
+	t.Helper()
+	paths, err := filepath.Glob(pattern)
+	require.NoError(t, err)
+	var lines []string
+	for _, path := range paths {
+		f, err := os.Open(path)
+		require.NoError(t, err)
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		require.NoError(t, scanner.Err())
+		f.Close()
+	}
+	return lines
+}
+
+func TestLogger_PlainOutput(t *testing.T) {
+	dir := t.TempDir()
+	config := plainConfig(dir)
+	config.MaxFileSize = 64 * 1024 // Rotates every flush or two
+
+	logger, err := New(config)
+	require.NoError(t, err)
+
+	// Newlines are added where missing; an oversized entry is dropped
+	want := make(map[string]bool)
+	for i := 0; i < 3000; i++ {
+		line := fmt.Sprintf("record %d %s", i, strings.Repeat("x", i%100))
+		want[line] = true
+		switch i % 3 {
+		case 0:
+			logger.Log(line)
+		case 1:
+			require.NoError(t, logger.TryLogBytes([]byte(line+"\n")))
+		case 2:
+			require.NoError(t, logger.LogEntry(func(buf *EntryBuffer) { buf.AppendString(line) }))
+		}
+	}
+	assert.ErrorIs(t, logger.TryLogBytes(make([]byte, 128*1024)), ErrOversized)
+	require.NoError(t, logger.Close())
+
+	totalLogs, droppedLogs, bytesWritten, _, _, _, bytesBuffered, bytesDurable := logger.GetStatsSnapshot()
+	assert.Equal(t, int64(1), droppedLogs)
+	assert.Equal(t, bytesBuffered, bytesDurable)
+
+	// Every file is newline-delimited text, one line per logged entry
+	files, err := filepath.Glob(filepath.Join(dir, "plain*.log"))
+	require.NoError(t, err)
+	assert.Greater(t, len(files), 1, "rotated")
+	lines := scanLines(t, filepath.Join(dir, "plain*.log"))
+	require.Len(t, lines, int(totalLogs-droppedLogs))
+	var size int64
+	for _, line := range lines {
+		assert.True(t, want[line], "unexpected line %q", line)
+		delete(want, line)
+		size += int64(len(line)) + 1
+	}
+	assert.Empty(t, want)
+	assert.Equal(t, bytesWritten, size, "no headers or padding")
+
+	metrics := logger.GetFlushMetrics()
+	assert.Equal(t, bytesWritten, metrics.PayloadBytes+metrics.HeaderBytes)
+	assert.Zero(t, metrics.PaddingBytes)
+}
+
+func TestLogger_PlainOutputTimestamp(t *testing.T) {
+	config := plainConfig(t.TempDir())
+	config.PrependTimestamp = TimestampRFC3339
+	config.BufferSize = 64 * 1024
+	config.NumShards = 1 // Lines in write order
+
+	logger, err := New(config)
+	require.NoError(t, err)
+	before := time.Now().Add(-time.Second)
+	logger.Log("hello")
+	require.NoError(t, logger.LogEntry(func(buf *EntryBuffer) { buf.AppendString("world") }))
+	require.NoError(t, logger.Close())
+
+	lines := scanLines(t, config.LogFilePath)
+	require.Len(t, lines, 2)
+	for i, payload := range []string{"hello", "world"} {
+		ts, text, ok := strings.Cut(lines[i], " ")
+		require.True(t, ok)
+		assert.Equal(t, payload, text)
+		parsed, err := time.Parse(reader.TimestampLayout, ts)
+		require.NoError(t, err)
+		assert.True(t, parsed.After(before))
+	}
+}
+
+func TestBuffer_PlainEntries(t *testing.T) {
+	buf := newBuffer(64*1024, 0, false, alignmentSize)
+	buf.setOutputFormat(OutputPlain)
+	const size = 64
+
+	// A reservation followed by another cannot hand back its tail: it is padded with spaces
+	first, _ := buf.reserve(size)
+	second, _ := buf.reserve(size)
+	third, _ := buf.reserve(size)
+	fourth, _ := buf.reserve(size)
+	copy(buf.entry(first, size)[:5], "first")
+	buf.commitEntry(first, size, 5, 0)
+	buf.commitEntry(second, size, 0, 0)
+	copy(buf.entry(third, size)[:6], "third\n")
+	buf.commitEntry(third, size, 6, 0)
+
+	// The last one hands back its tail
+	copy(buf.entry(fourth, size)[:6], "fourth")
+	buf.commitEntry(fourth, size, 6, 0)
+	n, _ := buf.Write([]byte("fifth"))
+	assert.Equal(t, 6, n)
+
+	data := buf.data[headerOffset:buf.Offset()]
+	spaces := func(n int) string { return strings.Repeat(" ", n) }
+	assert.Equal(t, "first"+spaces(size-6)+"\n"+spaces(size-1)+"\n"+"third"+spaces(size-6)+"\n"+"fourth\nfifth\n", string(data))
+	assert.Equal(t, int64(5+6+6+5), buf.payloadBytes.Load())
+}
+
+func TestSocketSink_PlainFrame(t *testing.T) {
+	sink := &SocketSink{plain: true}
+	frame := sink.frame([][]byte{[]byte("a\nb\n"), []byte("c\n")})
+	assert.Equal(t, "a\nb\nc\n", string(frame))
+	assert.Len(t, bytes.Split(bytes.TrimSuffix(frame, []byte("\n")), []byte("\n")), 3)
+}
+
+func TestConfig_OutputFormat(t *testing.T) {
+	config := DefaultConfig("/tmp/plain.log")
+	require.NoError(t, config.Validate())
+	assert.Equal(t, OutputFramed, config.OutputFormat)
+
+	config.OutputFormat = "json"
+	assert.EqualError(t, config.Validate(), `unknown OutputFormat "json" (expected "framed" or "plain")`)
+
+	for _, tc := range []struct {
+		configure func(*Config)
+		err       string
+	}{
+		{func(c *Config) { c.IOMode = IOModeDirectSync }, `OutputFormat "plain" needs IOMode "buffered" (O_DIRECT pads every shard), got "direct_sync"`},
+		{func(c *Config) { c.SequenceNumbers = true }, `OutputFormat "plain" cannot write SequenceNumbers`},
+		{func(c *Config) { c.PrependTimestamp = TimestampUnixNano }, `OutputFormat "plain" cannot write PrependTimestamp "unixNano" (use "rfc3339")`},
+		{func(c *Config) { c.PersistentBuffers = true }, `OutputFormat "plain" cannot recover PersistentBuffers`},
+	} {
+		config := plainConfig("/tmp")
+		tc.configure(&config)
+		assert.EqualError(t, config.Validate(), tc.err)
+	}
+
+	config = plainConfig("/tmp")
+	assert.Contains(t, config.Explain(), "buffered I/O, plain output")
+}
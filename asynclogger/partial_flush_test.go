@@ -0,0 +1,161 @@
+package asynclogger
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowWrite starts a LogEntry on logger that stays in flight until release is closed, and returns
+// once the entry is reserved; done is closed when LogEntry returns
+func slowWrite(t *testing.T, logger *Logger, release <-chan struct{}) (done <-chan struct{}) {
+	t.Helper()
+	reserved := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		logger.LogEntry(func(buf *EntryBuffer) {
+			close(reserved)
+			<-release
+			buf.AppendString("slow")
+		})
+	}()
+	<-reserved
+	return finished
+}
+
+func TestLogger_PartialFlushes(t *testing.T) {
+	capture := &captureLogger{}
+	config := DefaultConfig(filepath.Join(t.TempDir(), "partial.log"))
+	config.BufferSize = 2 * 64 * 1024
+	config.NumShards = 2
+	config.FlushTimeout = 5 * time.Millisecond
+	config.InternalLogger = capture
+
+	logger, err := New(config)
+	require.NoError(t, err)
+	defer logger.Close()
+
+	partialWarnings := func() int {
+		n := 0
+		for _, msg := range capture.Messages() {
+			if strings.Contains(msg, "flushed with writes still in progress") {
+				n++
+			}
+		}
+		return n
+	}
+
+	// Two writers stuck in one flush count as one partial flush
+	release := make(chan struct{})
+	first, second := slowWrite(t, logger, release), slowWrite(t, logger, release)
+	before := time.Now()
+	require.NoError(t, logger.Flush(t.Context()))
+	stats := logger.GetStatsStruct()
+	assert.Equal(t, int64(1), stats.PartialFlushes)
+	assert.GreaterOrEqual(t, stats.LastPartialFlushUnixNano, before.UnixNano())
+	assert.Equal(t, 1, partialWarnings())
+	close(release)
+	<-first
+	<-second
+
+	// A flush whose writes all complete is not partial
+	logger.LogBytes([]byte("fast"))
+	require.NoError(t, logger.Flush(t.Context()))
+	assert.Equal(t, int64(1), logger.GetStatsStruct().PartialFlushes)
+
+	// The next partial flush is counted, but its warning is rate limited
+	release = make(chan struct{})
+	third := slowWrite(t, logger, release)
+	require.NoError(t, logger.Flush(t.Context()))
+	close(release)
+	<-third
+	stats = logger.GetStatsStruct()
+	assert.Equal(t, int64(2), stats.PartialFlushes)
+	assert.Equal(t, 1, partialWarnings())
+
+	totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, bytesBuffered, bytesDurable := logger.GetStatsSnapshot()
+	assert.Equal(t, StatsSnapshot{
+		TotalLogs: totalLogs, DroppedLogs: droppedLogs, BytesWritten: bytesWritten, Flushes: flushes,
+		FlushErrors: flushErrors, SetSwaps: setSwaps, BytesBuffered: bytesBuffered, BytesDurable: bytesDurable,
+		PartialFlushes: 2, LastPartialFlushUnixNano: stats.LastPartialFlushUnixNano,
+	}, stats)
+}
+
+func TestLoggerManager_GetStatsStruct(t *testing.T) {
+	config := DefaultConfig(filepath.Join(t.TempDir(), "events.log"))
+	config.BufferSize = 2 * 64 * 1024
+	config.NumShards = 2
+	config.FlushTimeout = 5 * time.Millisecond
+	config.InternalLogger = &captureLogger{}
+
+	lm, err := NewLoggerManager(config)
+	require.NoError(t, err)
+	defer lm.Close()
+	lm.LogBytesWithEvent("payment", []byte("one"))
+	lm.LogBytesWithEvent("login", []byte("two"))
+
+	// Stall a write of one event across a flush
+	var payment *Logger
+	lm.RangeEventLoggers(func(eventName string, logger *Logger) bool {
+		if eventName == "payment" {
+			payment = logger
+		}
+		return true
+	})
+	require.NotNil(t, payment)
+	release := make(chan struct{})
+	done := slowWrite(t, payment, release)
+	require.NoError(t, lm.FlushAll(t.Context()))
+	close(release)
+	<-done
+
+	stats := lm.GetStatsStruct()
+	assert.Equal(t, int64(1), stats.PartialFlushes)
+	assert.Equal(t, payment.GetStatsStruct().LastPartialFlushUnixNano, stats.LastPartialFlushUnixNano)
+	totalLogs, _, bytesWritten, flushes, _, _, _, _ := lm.GetStatsSnapshot()
+	assert.Equal(t, totalLogs, stats.TotalLogs)
+	assert.Equal(t, bytesWritten, stats.BytesWritten)
+	assert.Equal(t, flushes, stats.Flushes)
+}
+
+// Run with -race: the entry a flush times out on is written by the callback while the flush runs,
+// unsynchronized with it, so the race detector reports any read of its space by the flush
+func TestLogger_PartialFlushLeavesOpenEntries(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "open.log")
+	config := DefaultConfig(logPath)
+	config.BufferSize = 64 * 1024
+	config.NumShards = 1
+	config.FlushInterval = time.Hour
+	config.FlushTimeout = 5 * time.Millisecond
+
+	logger, err := New(config)
+	require.NoError(t, err)
+	defer logger.Close()
+
+	logger.LogBytes([]byte("before"))
+	reserved, finished := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(finished)
+		logger.LogEntry(func(buf *EntryBuffer) {
+			close(reserved)
+			time.Sleep(10 * config.FlushTimeout)
+			buf.AppendString("slow")
+		})
+	}()
+	<-reserved
+	logger.LogBytes([]byte("after"))
+
+	require.NoError(t, logger.Flush(t.Context()))
+	assert.Equal(t, int64(1), logger.GetStatsStruct().PartialFlushes)
+	assert.Equal(t, []string{"before"}, readEntries(t, logPath), "entries from the open one on are left in the shard")
+
+	<-finished
+	require.NoError(t, logger.Close())
+	assert.Equal(t, []string{"before", "slow", "after"}, readEntries(t, logPath))
+	assert.Equal(t, int64(3), logger.stats.EntriesFlushed.Load())
+}
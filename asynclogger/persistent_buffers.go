@@ -0,0 +1,264 @@
+package asynclogger
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/internal/logcore"
+)
+
+// Buffer file layout (Config.PersistentBuffers): one region per shard of both buffer sets
+//
+//	[metadata page: magic(4) | version(2) | reserved(2) | capacity(4) | committed(4) | zeros][shard buffer]
+//
+// The shard buffer is the Buffer's data, so logs are copied into the file's pages exactly as into
+// heap memory and survive a process crash. committed is the offset recorded (and msynced) when the
+// set is swapped out for a flush, and 0 once the flush is done. Buffers are zeroed after each flush,
+// so the entries of a set that was never swapped out are found by walking their length prefixes
+const (
+	regionMetaSize = alignmentSize // Keeps every shard buffer aligned for O_DIRECT
+	regionMagic    = "ALPB"
+	regionVersion  = 1
+)
+
+// persistentBuffers is the memory-mapped buffer file of a logger
+type persistentBuffers struct {
+	path    string
+	file    *os.File
+	mapping []byte
+}
+
+// bufferRegion is one shard buffer in the buffer file
+type bufferRegion struct {
+	owner *persistentBuffers
+	off   int    // Offset of the metadata page in the mapping
+	meta  []byte // Metadata page
+	data  []byte // Shard buffer (Buffer.data)
+}
+
+// pendingRegion is a region found by recovery with entries that were never flushed
+type pendingRegion struct {
+	data    []byte
+	end     int32 // Offset after the last entry
+	entries int64
+	sealed  bool // Swapped out for a flush that did not finish
+}
+
+// persistentBufferPath returns the buffer file of logPath: {base}.buffers next to it
+func persistentBufferPath(logPath string) string {
+	return strings.TrimSuffix(logPath, ".log") + ".buffers"
+}
+
+// openPersistentBuffers opens (or creates) the buffer file at path and maps its current content
+func openPersistentBuffers(path string) (*persistentBuffers, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open buffer file: %w", err)
+	}
+	p := &persistentBuffers{path: path, file: file}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat buffer file: %w", err)
+	}
+	if stat.Size() > 0 {
+		if p.mapping, err = mapFile(file, int(stat.Size())); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// pending returns the regions of the mapped file holding unflushed entries, the sets swapped out
+// for a flush first (they are older than the active set). A region with a bad header ends the walk
+func (p *persistentBuffers) pending() []pendingRegion {
+	var regions []pendingRegion
+	for off := 0; off+regionMetaSize <= len(p.mapping); {
+		meta := p.mapping[off : off+regionMetaSize]
+		if string(meta[0:4]) != regionMagic || binary.LittleEndian.Uint16(meta[4:6]) != regionVersion {
+			break
+		}
+		capacity := int(binary.LittleEndian.Uint32(meta[8:12]))
+		committed := int32(binary.LittleEndian.Uint32(meta[12:16]))
+		start := off + regionMetaSize
+		if capacity <= headerOffset || start+capacity > len(p.mapping) {
+			break
+		}
+
+		data := p.mapping[start : start+capacity]
+		end, entries := scanEntries(data)
+		if committed > end && committed < int32(capacity) {
+			// An entry at the end of the sealed buffer was never completed; keep the sealed extent
+			end = committed
+		}
+		if end > headerOffset {
+			regions = append(regions, pendingRegion{data: data, end: end, entries: entries, sealed: committed > 0})
+		}
+		off = start + capacity
+	}
+
+	sort.SliceStable(regions, func(i, j int) bool { return regions[i].sealed && !regions[j].sealed })
+	return regions
+}
+
+// scanEntries walks the length prefixes of a shard buffer from the header reservation
+// Returns the offset after the last complete prefix and the number of entries (padding excluded)
+func scanEntries(data []byte) (end int32, entries int64) {
+	off := int64(headerOffset)
+	for off+4 <= int64(len(data)) {
+		prefix := binary.LittleEndian.Uint32(data[off:])
+		if prefix == 0 {
+			break
+		}
+		next := off + 4 + int64(prefix&^paddingFlag)
+		if next > int64(len(data)) {
+			break
+		}
+		if prefix&paddingFlag == 0 {
+			entries++
+		}
+		off = next
+	}
+	return int32(off), entries
+}
+
+// recoverPending writes the unflushed entries of the mapped file to fw, in one write with the same
+// shard layout as a flush. Returns the entries and file bytes written
+// On error the buffer file is left as is, so the next start retries
+func (p *persistentBuffers) recoverPending(fw FileWriter, mode IOMode) (entries, bytes int64, err error) {
+	regions := p.pending()
+	if len(regions) == 0 {
+		return 0, 0, nil
+	}
+
+	buffers := make([][]byte, 0, len(regions))
+	total := 0
+	for _, region := range regions {
+		data := region.data
+		validDataBytes := region.end - headerOffset
+		if mode == IOModeBuffered {
+			data = data[:region.end]
+		}
+		logcore.PutShardHeader(data, uint32(len(data)), validDataBytes)
+		buffers = append(buffers, data)
+		entries += region.entries
+		total += len(data)
+	}
+
+	n, err := fw.WriteVectored(buffers)
+	if err == nil && n < total {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to write recovered buffers: %w", err)
+	}
+	return entries, int64(n), nil
+}
+
+// reset recreates the buffer file with count empty regions of capacity bytes each and maps it
+// Earlier content is discarded, so call it once pending entries have been recovered
+func (p *persistentBuffers) reset(capacity, count int) ([]*bufferRegion, error) {
+	if p.mapping != nil {
+		if err := unmapFile(p.mapping); err != nil {
+			return nil, err
+		}
+		p.mapping = nil
+	}
+
+	size := count * (regionMetaSize + capacity)
+	if err := p.file.Truncate(0); err != nil {
+		return nil, fmt.Errorf("failed to truncate buffer file: %w", err)
+	}
+	if err := p.file.Truncate(int64(size)); err != nil {
+		return nil, fmt.Errorf("failed to size buffer file: %w", err)
+	}
+	mapping, err := mapFile(p.file, size)
+	if err != nil {
+		return nil, err
+	}
+	p.mapping = mapping
+
+	regions := make([]*bufferRegion, count)
+	for i := range regions {
+		off := i * (regionMetaSize + capacity)
+		meta := mapping[off : off+regionMetaSize]
+		copy(meta[0:4], regionMagic)
+		binary.LittleEndian.PutUint16(meta[4:6], regionVersion)
+		binary.LittleEndian.PutUint32(meta[8:12], uint32(capacity))
+		regions[i] = &bufferRegion{
+			owner: p,
+			off:   off,
+			meta:  meta,
+			data:  mapping[off+regionMetaSize : off+regionMetaSize+capacity],
+		}
+	}
+	return regions, nil
+}
+
+// close closes the buffer file; unmap also releases the mapping, which must no longer be written
+// (no-op on nil)
+func (p *persistentBuffers) close(unmap bool) error {
+	if p == nil {
+		return nil
+	}
+	if unmap && p.mapping != nil {
+		if err := unmapFile(p.mapping); err != nil {
+			p.file.Close()
+			return err
+		}
+		p.mapping = nil
+	}
+	return p.file.Close()
+}
+
+// commit records offset as the sealed extent of the region and msyncs metadata and data up to it,
+// bounding what an OS crash can lose to the active set
+func (r *bufferRegion) commit(offset int32) error {
+	binary.LittleEndian.PutUint32(r.meta[12:16], uint32(offset))
+	return syncFile(r.owner.mapping, r.off, regionMetaSize+int(offset))
+}
+
+// release zeroes the entries up to offset and clears the sealed extent once they are flushed
+func (r *bufferRegion) release(offset int32) {
+	if offset > headerOffset {
+		clear(r.data[headerOffset:offset])
+	}
+	binary.LittleEndian.PutUint32(r.meta[12:16], 0)
+}
+
+// skip marks the entries up to offset as padding once they are flushed, keeping the entries after
+// them (left by a flush that timed out, see Buffer.seal) for recovery
+func (r *bufferRegion) skip(offset int32) {
+	if offset > headerOffset {
+		binary.LittleEndian.PutUint32(r.data[headerOffset:], paddingFlag|uint32(offset-headerOffset-4))
+	}
+	binary.LittleEndian.PutUint32(r.meta[12:16], 0)
+}
+
+// commitRegion records the sealed offset end in the buffer file (no-op without Config.PersistentBuffers)
+func (b *Buffer) commitRegion(end int32) error {
+	if b.region == nil {
+		return nil
+	}
+	return b.region.commit(end)
+}
+
+// releaseRegion clears the flushed entries from the buffer file (no-op without Config.PersistentBuffers)
+// Call it before Reset, while the offset still covers them
+func (b *Buffer) releaseRegion() {
+	switch {
+	case b.region == nil:
+	case b.partial != 0:
+		b.region.skip(b.partial)
+	case b.carried != 0:
+		// The seal found the carried writes still in flight: nothing was flushed
+	default:
+		b.region.release(b.Offset())
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !unix
+
+package asynclogger
+
+import (
+	"errors"
+	"os"
+)
+
+// errNoPersistentBuffers is returned where memory-mapped buffer files are not implemented
+var errNoPersistentBuffers = errors.New("PersistentBuffers is not supported on this platform")
+
+// mapFile is not supported on this platform
+func mapFile(file *os.File, size int) ([]byte, error) {
+	return nil, errNoPersistentBuffers
+}
+
+// unmapFile is not supported on this platform
+func unmapFile(mapping []byte) error {
+	return errNoPersistentBuffers
+}
+
+// syncFile is not supported on this platform
+func syncFile(mapping []byte, off, n int) error {
+	return errNoPersistentBuffers
+}
@@ -0,0 +1,152 @@
+//go:build unix
+
+package asynclogger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// crashChildEnv makes TestPersistentBuffersCrashChild log into the given directory and hang
+const crashChildEnv = "ASYNCLOGGER_CRASH_CHILD_DIR"
+
+const crashChildEntries = 500
+
+func persistentTestConfig(dir string) Config {
+	config := DefaultConfig(filepath.Join(dir, "crash.log"))
+	config.BufferSize = 1024 * 1024
+	config.NumShards = 2
+	config.FlushInterval = time.Hour
+	config.IOMode = IOModeBuffered
+	config.PersistentBuffers = true
+	return config
+}
+
+// TestPersistentBuffersCrashChild is the process killed by TestPersistentBuffers_RecoverAfterKill
+func TestPersistentBuffersCrashChild(t *testing.T) {
+	dir := os.Getenv(crashChildEnv)
+	if dir == "" {
+		t.Skip("run by TestPersistentBuffers_RecoverAfterKill")
+	}
+
+	logger, err := New(persistentTestConfig(dir))
+	require.NoError(t, err)
+	for i := 0; i < crashChildEntries; i++ {
+		require.NoError(t, logger.TryLogBytes([]byte(fmt.Sprintf("entry-%d", i))))
+	}
+	fmt.Println("READY")
+	select {} // Killed by the parent before any flush
+}
+
+func TestPersistentBuffers_RecoverAfterKill(t *testing.T) {
+	dir := t.TempDir()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestPersistentBuffersCrashChild$")
+	cmd.Env = append(os.Environ(), crashChildEnv+"="+dir)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+
+	ready := make(chan bool, 1)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if scanner.Text() == "READY" {
+				ready <- true
+				return
+			}
+		}
+		ready <- false
+	}()
+	select {
+	case ok := <-ready:
+		require.True(t, ok, "child exited before logging")
+	case <-time.After(30 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("child did not log in time")
+	}
+	require.NoError(t, cmd.Process.Kill())
+	cmd.Wait()
+
+	config := persistentTestConfig(dir)
+	assert.Empty(t, readEntries(t, config.LogFilePath), "child must not have flushed")
+
+	// Restart: New writes the entries the killed process never flushed
+	logger, err := New(config)
+	require.NoError(t, err)
+	entries, bytes := logger.GetRecoveryStats()
+	assert.Equal(t, int64(crashChildEntries), entries)
+	assert.Positive(t, bytes)
+
+	recovered := readEntries(t, config.LogFilePath)
+	require.Len(t, recovered, crashChildEntries)
+	seen := make(map[string]bool, len(recovered))
+	for _, entry := range recovered {
+		seen[entry] = true
+	}
+	for i := 0; i < crashChildEntries; i++ {
+		assert.True(t, seen[fmt.Sprintf("entry-%d", i)], "entry-%d not recovered", i)
+	}
+
+	// Normal operation resumes after recovery, and a clean Close leaves nothing to recover
+	logger.LogBytes([]byte("after-restart"))
+	require.NoError(t, logger.Close())
+	assert.Len(t, readEntries(t, config.LogFilePath), crashChildEntries+1)
+
+	logger, err = New(config)
+	require.NoError(t, err)
+	entries, _ = logger.GetRecoveryStats()
+	assert.Zero(t, entries)
+	require.NoError(t, logger.Close())
+}
+
+func TestPersistentBuffers_FlushReleasesRegions(t *testing.T) {
+	config := persistentTestConfig(t.TempDir())
+	logger, err := New(config)
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		logger.LogBytes([]byte(fmt.Sprintf("flushed-%d", i)))
+	}
+	require.NoError(t, logger.Flush(t.Context()))
+	assert.Empty(t, logger.persistent.pending(), "flushed entries must not be recovered again")
+
+	logger.LogBytes([]byte("pending"))
+	pending := logger.persistent.pending()
+	require.Len(t, pending, 1)
+	assert.Equal(t, int64(1), pending[0].entries)
+	assert.False(t, pending[0].sealed)
+	require.NoError(t, logger.Close())
+}
+
+// failingCloseWriter is a FileWriter whose Close fails after closing the underlying writer
+type failingCloseWriter struct {
+	FileWriter
+}
+
+func (w *failingCloseWriter) Close() error {
+	w.FileWriter.Close()
+	return errors.New("close failed")
+}
+
+func TestPersistentBuffers_CloseAfterWriterCloseError(t *testing.T) {
+	config := persistentTestConfig(t.TempDir())
+	fileWriter, err := NewFileWriter(config)
+	require.NoError(t, err)
+	logger, err := NewWithWriter(config, &failingCloseWriter{FileWriter: fileWriter})
+	require.NoError(t, err)
+
+	logger.LogBytes([]byte("entry"))
+	err = logger.Close()
+	assert.ErrorContains(t, err, "failed to close file writer")
+	assert.ErrorIs(t, logger.persistent.file.Close(), os.ErrClosed, "the buffer file is closed too")
+}
@@ -0,0 +1,36 @@
+//go:build unix
+
+package asynclogger
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mapFile maps the first size bytes of file read-write and shared, so stores reach the file's pages
+func mapFile(file *os.File, size int) ([]byte, error) {
+	mapping, err := unix.Mmap(int(file.Fd()), 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map buffer file: %w", err)
+	}
+	return mapping, nil
+}
+
+// unmapFile releases a mapping returned by mapFile
+func unmapFile(mapping []byte) error {
+	if err := unix.Munmap(mapping); err != nil {
+		return fmt.Errorf("failed to unmap buffer file: %w", err)
+	}
+	return nil
+}
+
+// syncFile writes n bytes of mapping at off to disk (msync needs a page-aligned start)
+func syncFile(mapping []byte, off, n int) error {
+	start := off &^ (os.Getpagesize() - 1)
+	if err := unix.Msync(mapping[start:off+n], unix.MS_SYNC); err != nil {
+		return fmt.Errorf("failed to sync buffer file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+//go:build linux
+
+package asynclogger
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// stubPwritev scripts pwritev for the duration of the test: script sees each call's buffers and
+// returns an error to fail the call with, or how many bytes the real pwritev may write (< 0: all)
+func stubPwritev(t *testing.T, script func(call int, buffers [][]byte) (limit int, err error)) {
+	t.Helper()
+	original := pwritev
+	call := 0
+	pwritev = func(fd int, buffers [][]byte, offset int64) (int, error) {
+		limit, err := script(call, buffers)
+		call++
+		if err != nil {
+			return -1, err
+		}
+		if limit >= 0 {
+			buffers = limitBuffers(buffers, limit)
+		}
+		return original(fd, buffers, offset)
+	}
+	t.Cleanup(func() { pwritev = original })
+}
+
+// limitBuffers returns the leading buffers holding the first limit bytes of buffers
+func limitBuffers(buffers [][]byte, limit int) [][]byte {
+	limited := make([][]byte, 0, len(buffers))
+	for _, buf := range buffers {
+		if limit <= 0 {
+			break
+		}
+		buf = buf[:min(len(buf), limit)]
+		limited = append(limited, buf)
+		limit -= len(buf)
+	}
+	return limited
+}
+
+func TestWriteVectored_ShortPwritev(t *testing.T) {
+	for _, mode := range ioModes {
+		t.Run(string(mode), func(t *testing.T) {
+			// O_DIRECT short writes end on a block boundary; buffered ones can stop at any byte
+			cut := 1000
+			if mode != IOModeBuffered {
+				cut = alignmentSize
+			}
+
+			// Cut flushes inside the first shard buffer (mid-buffer) and at its end (buffer edge),
+			// with EINTR and EAGAIN in between
+			var midBuffer, bufferEdge int
+			stubPwritev(t, func(call int, buffers [][]byte) (int, error) {
+				switch call % 4 {
+				case 0:
+					if len(buffers[0]) > cut {
+						midBuffer++
+						return cut, nil
+					}
+				case 1:
+					return 0, unix.EINTR
+				case 2:
+					if len(buffers) > 1 {
+						bufferEdge++
+						return len(buffers[0]), nil
+					}
+				case 3:
+					return 0, unix.EAGAIN
+				}
+				return -1, nil
+			})
+
+			logPath := filepath.Join(t.TempDir(), "test.log")
+			config := fileWriterConfig(logPath, mode)
+			config.BufferSize = 1024 * 1024
+			config.NumShards = 4
+			logger, err := New(config)
+			require.NoError(t, err)
+
+			var want []string
+			for i := 0; i < 500; i++ {
+				msg := fmt.Sprintf("message %03d %s", i, strings.Repeat("x", 1000))
+				logger.Log(msg)
+				want = append(want, msg)
+			}
+			require.NoError(t, logger.Close())
+			assert.Positive(t, midBuffer)
+			assert.Positive(t, bufferEdge)
+
+			// Shards interleave entries, so only the set is fixed
+			assert.ElementsMatch(t, want, readEntries(t, logPath))
+		})
+	}
+}
+
+func TestLogger_FlushMetricsPwritev(t *testing.T) {
+	for _, mode := range ioModes {
+		t.Run(string(mode), func(t *testing.T) {
+			config := fileWriterConfig(filepath.Join(t.TempDir(), "test.log"), mode)
+			config.BufferSize = 1024 * 1024
+			config.NumShards = 4
+			logger, err := New(config)
+			require.NoError(t, err)
+			for i := 0; i < 2; i++ {
+				logger.Log(fmt.Sprintf("flush %d", i))
+				require.NoError(t, logger.Flush(context.Background()))
+			}
+
+			metrics := logger.GetFlushMetrics()
+			assert.GreaterOrEqual(t, metrics.TotalFlushes, int64(2))
+			assert.Zero(t, metrics.FlushErrors)
+			assert.Positive(t, metrics.AvgPwritevDuration)
+			assert.GreaterOrEqual(t, metrics.MaxPwritevDuration, metrics.AvgPwritevDuration)
+			assert.Greater(t, metrics.PwritevPercent, 0.0)
+			assert.LessOrEqual(t, metrics.PwritevPercent, metrics.WritePercent)
+			require.NoError(t, logger.Close())
+		})
+	}
+
+	t.Run("aggregated by LoggerManager", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "events.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 4
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+
+		for _, event := range []string{"payment", "login"} {
+			manager.LogWithEvent(event, "entry")
+			require.NoError(t, manager.FlushEvent(event, context.Background()))
+		}
+		metrics := manager.GetAggregatedFlushMetrics()
+		assert.Equal(t, int64(2), metrics.TotalFlushes)
+		assert.Zero(t, metrics.FlushErrors)
+		assert.Positive(t, metrics.TotalFlushDuration)
+		assert.Positive(t, metrics.AvgPwritevDuration)
+		assert.Positive(t, metrics.MaxPwritevDuration)
+		assert.Greater(t, metrics.PwritevPercent, 0.0)
+	})
+}
@@ -0,0 +1,55 @@
+package reader
+
+import "io"
+
+// ByteAccounting splits the shard bytes of log files like asynclogger's FlushMetrics (PayloadBytes,
+// HeaderBytes, PaddingBytes), to check the write amplification a logger reported against its files
+type ByteAccounting struct {
+	PayloadBytes int64 // Entry data, after the sequence number and timestamp when the Options set them
+	HeaderBytes  int64 // Shard headers and entry framing (length prefixes, sequence numbers, timestamps, LogEntry padding)
+	PaddingBytes int64 // Shard bytes after the valid data (alignment padding)
+}
+
+// WriteAmplificationRatio returns the shard bytes per payload byte (0 without payload)
+func (a ByteAccounting) WriteAmplificationRatio() float64 {
+	if a.PayloadBytes == 0 {
+		return 0
+	}
+	return float64(a.PayloadBytes+a.HeaderBytes+a.PaddingBytes) / float64(a.PayloadBytes)
+}
+
+// AccountFiles reads log files like OpenFiles and accounts the bytes of their shards
+// opts.Timestamp and opts.SequenceNumbers must match the logger's PrependTimestamp and SequenceNumbers
+// for PayloadBytes to exclude them;
+// opts.OnShard, if set, is still called. Entries of corrupt shards that are skipped count as header bytes
+func AccountFiles(paths []string, opts Options) (ByteAccounting, error) {
+	var acct ByteAccounting
+	var validDataBytes int64
+	onShard := opts.OnShard
+	opts.OnShard = func(info ShardInfo) {
+		acct.HeaderBytes += ShardHeaderSize
+		acct.PaddingBytes += info.Capacity - ShardHeaderSize - info.ValidDataBytes
+		validDataBytes += info.ValidDataBytes
+		if onShard != nil {
+			onShard(info)
+		}
+	}
+
+	r, err := OpenFiles(paths, opts)
+	if err != nil {
+		return ByteAccounting{}, err
+	}
+	defer r.Close()
+	for {
+		entry, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ByteAccounting{}, err
+		}
+		acct.PayloadBytes += int64(len(entry))
+	}
+	acct.HeaderBytes += validDataBytes - acct.PayloadBytes
+	return acct, nil
+}
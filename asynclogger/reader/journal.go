@@ -0,0 +1,110 @@
+package reader
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Offset journal (asynclogger Config.OffsetJournal): a sidecar file {base}.offset next to the log
+// files that records how much of the file being written is durable
+//
+//	journal = magic:"ALOJ" version:u8 reserved:u8 nameLen:u16 offset:u64 crc:u32 name[nameLen]
+//
+// name is the base name of the file being written (the journal sits in the same directory), and
+// crc is the CRC32 (IEEE) of the 16 bytes before it followed by name. The journal is rewritten in
+// place after every durable write; a torn update fails the CRC and the journal is ignored.
+// Everything past offset in the named file is stale: a flush that was cut off by a crash, or
+// preallocated space. Files the journal does not name were synced and closed by rotation.
+const (
+	// JournalExt is the extension of the offset journal
+	JournalExt = ".offset"
+
+	// JournalHeaderSize is the fixed part of the journal before the file name
+	JournalHeaderSize = 20
+
+	journalMagic   = "ALOJ"
+	journalVersion = 1
+)
+
+// seriesSuffix matches the rotation timestamp (and same-second counter) of a rotated file name
+var seriesSuffix = regexp.MustCompile(`_\d{4}-\d{2}-\d{2}_\d{2}-\d{2}-\d{2}(_\d+)?\.log$`)
+
+// Journal is a decoded offset journal
+type Journal struct {
+	File   string // Base name of the file being written
+	Offset int64  // Bytes of File that are durable
+}
+
+// JournalPath returns the offset journal of logPath's file series: {dir}/{base}.offset, where base
+// is the file name without .log and without a rotation timestamp
+func JournalPath(logPath string) string {
+	name := filepath.Base(logPath)
+	if loc := seriesSuffix.FindStringIndex(name); loc != nil && loc[0] > 0 {
+		name = name[:loc[0]]
+	}
+	return filepath.Join(filepath.Dir(logPath), strings.TrimSuffix(name, ".log")+JournalExt)
+}
+
+// AppendJournal appends the encoding of j to dst
+func AppendJournal(dst []byte, j Journal) []byte {
+	start := len(dst)
+	dst = append(dst, journalMagic...)
+	dst = append(dst, journalVersion, 0)
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(len(j.File)))
+	dst = binary.LittleEndian.AppendUint64(dst, uint64(j.Offset))
+	dst = append(dst, 0, 0, 0, 0) // CRC, filled in once the name is in place
+	dst = append(dst, j.File...)
+	crc := crc32.Update(crc32.ChecksumIEEE(dst[start:start+16]), crc32.IEEETable, dst[start+JournalHeaderSize:])
+	binary.LittleEndian.PutUint32(dst[start+16:start+JournalHeaderSize], crc)
+	return dst
+}
+
+// DecodeJournal decodes a journal; bytes after the file name (left by a longer earlier record) are ignored
+func DecodeJournal(data []byte) (Journal, error) {
+	if len(data) < JournalHeaderSize || string(data[0:4]) != journalMagic {
+		return Journal{}, fmt.Errorf("%w: not an offset journal", ErrCorrupt)
+	}
+	if data[4] != journalVersion {
+		return Journal{}, fmt.Errorf("%w: unsupported offset journal version %d", ErrCorrupt, data[4])
+	}
+	nameLen := int(binary.LittleEndian.Uint16(data[6:8]))
+	if len(data) < JournalHeaderSize+nameLen {
+		return Journal{}, fmt.Errorf("%w: truncated offset journal", ErrCorrupt)
+	}
+	name := data[JournalHeaderSize : JournalHeaderSize+nameLen]
+	crc := crc32.Update(crc32.ChecksumIEEE(data[0:16]), crc32.IEEETable, name)
+	if crc != binary.LittleEndian.Uint32(data[16:20]) {
+		return Journal{}, fmt.Errorf("%w: offset journal checksum mismatch", ErrCorrupt)
+	}
+	offset := int64(binary.LittleEndian.Uint64(data[8:16]))
+	if offset < 0 {
+		return Journal{}, fmt.Errorf("%w: negative offset in offset journal", ErrCorrupt)
+	}
+	return Journal{File: string(name), Offset: offset}, nil
+}
+
+// ReadJournal reads the offset journal of logPath's file series (see JournalPath)
+// The error wraps os.ErrNotExist when the series has no journal, and ErrCorrupt when it is invalid
+func ReadJournal(logPath string) (Journal, error) {
+	data, err := os.ReadFile(JournalPath(logPath))
+	if err != nil {
+		return Journal{}, fmt.Errorf("failed to read offset journal: %w", err)
+	}
+	return DecodeJournal(data)
+}
+
+// JournaledSize returns how much of logPath is durable according to its series' offset journal
+// ok is false when there is no valid journal or it names another file (a file the writer rotated
+// away from is complete)
+func JournaledSize(logPath string) (size int64, ok bool) {
+	j, err := ReadJournal(logPath)
+	if err != nil || j.File != filepath.Base(logPath) {
+		return 0, false
+	}
+	return j.Offset, true
+}
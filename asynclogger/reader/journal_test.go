@@ -0,0 +1,98 @@
+package reader
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal_Encoding(t *testing.T) {
+	j := Journal{File: "app_2026-01-01_00-00-00.log", Offset: 3 * 4096}
+	data := AppendJournal(nil, j)
+	assert.Len(t, data, JournalHeaderSize+len(j.File))
+
+	decoded, err := DecodeJournal(data)
+	require.NoError(t, err)
+	assert.Equal(t, j, decoded)
+
+	// A shorter record written over a longer one leaves the old tail behind
+	longer := AppendJournal(nil, Journal{File: "a_much_longer_file_name.log", Offset: 1})
+	shorter := AppendJournal(nil, Journal{File: "app.log", Offset: 2})
+	decoded, err = DecodeJournal(append(shorter, longer[len(shorter):]...))
+	require.NoError(t, err)
+	assert.Equal(t, Journal{File: "app.log", Offset: 2}, decoded)
+
+	for name, corrupt := range map[string][]byte{
+		"empty":     nil,
+		"torn":      data[:JournalHeaderSize+3],
+		"bad magic": append([]byte("XXXX"), data[4:]...),
+		"bit flip":  append(append([]byte{}, data[:9]...), append([]byte{data[9] ^ 1}, data[10:]...)...),
+	} {
+		_, err := DecodeJournal(corrupt)
+		assert.ErrorIs(t, err, ErrCorrupt, name)
+	}
+}
+
+func TestJournal_Path(t *testing.T) {
+	dir := t.TempDir()
+	want := filepath.Join(dir, "payment.offset")
+	for _, name := range []string{
+		"payment.log",
+		"payment",
+		"payment_2026-01-02_10-00-00.log",
+		"payment_2026-01-02_10-00-00_2.log",
+	} {
+		assert.Equal(t, want, JournalPath(filepath.Join(dir, name)), name)
+	}
+	assert.Equal(t, filepath.Join(dir, "payment_refund.offset"), JournalPath(filepath.Join(dir, "payment_refund.log")))
+}
+
+func TestJournal_BoundsOpen(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "app.log")
+	rotated := filepath.Join(dir, "app_2026-01-01_00-00-00.log")
+
+	// Two durable shards, then a flush the crash cut off after its header
+	torn := buildShard(512, "torn")[:ShardHeaderSize+2]
+	data := append(append(buildShard(512, "1"), buildShard(512, "2")...), torn...)
+	require.NoError(t, os.WriteFile(logPath, data, 0644))
+	require.NoError(t, os.WriteFile(rotated, buildShard(512, "0"), 0644))
+
+	_, err := ReadJournal(logPath)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	_, ok := JournaledSize(logPath)
+	assert.False(t, ok)
+
+	require.NoError(t, os.WriteFile(JournalPath(logPath), AppendJournal(nil, Journal{File: "app.log", Offset: 1024}), 0644))
+	size, ok := JournaledSize(logPath)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1024), size)
+	_, ok = JournaledSize(rotated)
+	assert.False(t, ok, "the journal names another file of the series")
+
+	r, err := OpenFiles([]string{rotated, logPath}, Options{})
+	require.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, []string{"0", "1", "2"}, readAll(t, r))
+	assert.Zero(t, r.CorruptShards())
+
+	r, err = Open(logPath, Options{IgnoreJournal: true})
+	require.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, "1", string(must(t, r.Next)))
+	assert.Equal(t, "2", string(must(t, r.Next)))
+	_, err = r.Next()
+	assert.ErrorIs(t, err, ErrCorrupt)
+}
+
+// must returns next's entry, failing the test on an error
+func must(t *testing.T, next func() ([]byte, error)) []byte {
+	t.Helper()
+	entry, err := next()
+	require.NoError(t, err)
+	return entry
+}
@@ -0,0 +1,512 @@
+// Package reader decodes log files written by asynclogger
+//
+// File format (all integers little-endian):
+//
+//	file   = shard* [zero padding]
+//	shard  = capacity:u32 validDataBytes:u32 entry* padding
+//	entry  = length:u32 data[length]
+//
+// With Config.PrependTimestamp, data starts with the write time (see TimestampFormat) and the length
+// covers timestamp and payload, so readers that do not set Options.Timestamp return both as the entry.
+// With Config.SequenceNumbers, data starts with an 8-byte sequence number (before the timestamp, if
+// any) that the length covers as well; see Options.SequenceNumbers.
+//
+// A length with PaddingFlag set marks padding: the low 31 bits count the bytes to skip. Logger.LogEntry
+// leaves padding where an entry used less than the space it reserved.
+//
+// Each flush writes every non-empty shard buffer in full: capacity is the buffer size including the
+// 8-byte header and is a multiple of 512 (Direct I/O alignment), so the next shard header starts
+// capacity bytes after the current one. validDataBytes counts the entry bytes after the header;
+// the rest of the shard is padding. A zero capacity marks the end of the written data (e.g. the
+// zero-filled tail of a preallocated file). Rotation starts a new file, so each file is self-contained.
+// IOModeBuffered writes shards without padding (capacity = 8 + validDataBytes, not 512-aligned).
+// Config.CompactFlush packs the shards of a small flush the same way and gives the padding of the
+// whole write to its last shard (capacity = 8 + validDataBytes + padding).
+package reader
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ShardHeaderSize is the [capacity][validDataBytes] header at the start of each shard
+	ShardHeaderSize = 8
+
+	// LengthPrefixSize is the length prefix before each entry
+	LengthPrefixSize = 4
+
+	// PaddingFlag is set in the length prefix of padding, which carries no entry
+	PaddingFlag = 1 << 31
+
+	// SequenceSize is the sequence number at the start of entry data (Config.SequenceNumbers)
+	SequenceSize = 8
+
+	// Alignment is the smallest Direct I/O block size (Config.IOAlignment); O_DIRECT shard capacities
+	// and offsets are multiples of it whatever alignment the file was written with
+	Alignment = 512
+
+	// maxShardCapacity bounds plausible shard headers (shards are far smaller in practice)
+	maxShardCapacity = 1 << 30
+)
+
+// ErrCorrupt is returned when a shard header or entry is inconsistent
+var ErrCorrupt = errors.New("corrupt log file")
+
+// TimestampFormat is the timestamp prepended to each entry (asynclogger Config.PrependTimestamp)
+type TimestampFormat string
+
+const (
+	// TimestampNone: entries carry no timestamp (default)
+	TimestampNone TimestampFormat = ""
+
+	// TimestampUnixNano: 8-byte little-endian int64 nanoseconds since the Unix epoch
+	TimestampUnixNano TimestampFormat = "unixNano"
+
+	// TimestampRFC3339: TimestampLayout in UTC followed by a space (31 bytes)
+	TimestampRFC3339 TimestampFormat = "rfc3339"
+)
+
+// TimestampLayout is the fixed-width layout of TimestampRFC3339 (always UTC, so it ends in "Z")
+const TimestampLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// Size returns the number of bytes the timestamp occupies at the start of each entry
+func (f TimestampFormat) Size() int {
+	switch f {
+	case TimestampUnixNano:
+		return 8
+	case TimestampRFC3339:
+		return len("2006-01-02T15:04:05.000000000Z ")
+	default:
+		return 0
+	}
+}
+
+// Parse decodes the timestamp at the start of entry (which must hold at least Size bytes)
+func (f TimestampFormat) Parse(entry []byte) (time.Time, error) {
+	switch f {
+	case TimestampUnixNano:
+		return time.Unix(0, int64(binary.LittleEndian.Uint64(entry))), nil
+	case TimestampRFC3339:
+		return time.Parse(TimestampLayout, string(entry[:f.Size()-1]))
+	default:
+		return time.Time{}, nil
+	}
+}
+
+// Options configures a LogReader
+type Options struct {
+	// SkipCorruptShards resynchronizes on the next plausible shard header instead of returning
+	// ErrCorrupt when a shard header is invalid or a shard is truncated
+	SkipCorruptShards bool
+
+	// OnShard is called for every shard header read, including empty and truncated shards
+	OnShard func(ShardInfo)
+
+	// Timestamp is the Config.PrependTimestamp the files were written with. When set, Next returns
+	// the payload without the timestamp, and Timestamp returns the decoded write time
+	Timestamp TimestampFormat
+
+	// SequenceNumbers is the Config.SequenceNumbers the files were written with. When set, Next
+	// returns the entry without its sequence number, and Sequence returns it
+	SequenceNumbers bool
+
+	// IgnoreJournal reads files to their end even when an offset journal (see JournalPath) marks
+	// the tail of the file being written as stale. Open and OpenFiles stop at the journaled offset
+	// otherwise, so a flush cut off by a crash is not reported as corruption
+	IgnoreJournal bool
+}
+
+// ShardInfo describes one shard in a log file
+type ShardInfo struct {
+	Source         int   // Index of the file in the series
+	Index          int   // Shard number within the file
+	Offset         int64 // File offset of the shard header
+	Capacity       int64 // Shard size including the header and padding
+	ValidDataBytes int64 // Entry bytes declared by the header
+	Truncated      bool  // Fewer than ValidDataBytes made it to disk
+}
+
+// LogReader iterates the entries of one log file or a rotated series of log files
+type LogReader struct {
+	sources []source
+	opts    Options
+
+	off      int64  // Offset of the next shard header in the current source
+	shardBuf []byte // Current shard data (reused across shards)
+	data     []byte // Unread entries in the current shard
+	dataOff  int64  // File offset of data[0]
+
+	source   int       // Index of the current source in the series
+	shardIdx int       // Index of the next shard in the current source
+	shard    ShardInfo // Shard holding the unread entries
+	entryOff int64     // File offset of the last entry returned
+	entryTS  time.Time // Timestamp of the last entry returned (Options.Timestamp)
+	entrySeq uint64    // Sequence number of the last entry returned (Options.SequenceNumbers)
+
+	corruptShards int
+	err           error // Sticky error (io.EOF or unrecoverable corruption)
+}
+
+// source is one file in the series; closer is set for files opened by the reader
+type source struct {
+	r      io.ReaderAt
+	closer io.Closer
+}
+
+// NewLogReader creates a LogReader over a single log file
+func NewLogReader(r io.ReaderAt, opts Options) *LogReader {
+	return &LogReader{sources: []source{{r: r}}, opts: opts}
+}
+
+// Open opens a single log file
+func Open(path string, opts Options) (*LogReader, error) {
+	return OpenFiles([]string{path}, opts)
+}
+
+// OpenFiles opens log files to be read in order (e.g. the result of RotatedFiles)
+func OpenFiles(paths []string, opts Options) (*LogReader, error) {
+	r := &LogReader{opts: opts}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		var src io.ReaderAt = file
+		if size, ok := JournaledSize(path); ok && !opts.IgnoreJournal {
+			src = io.NewSectionReader(file, 0, size)
+		}
+		r.sources = append(r.sources, source{r: src, closer: file})
+	}
+	return r, nil
+}
+
+// rotatedSuffix matches the timestamp the file writer appends to rotated files, and the counter it
+// adds when a file was already rotated within the same second
+var rotatedSuffix = regexp.MustCompile(`^_(\d{4}-\d{2}-\d{2}_\d{2}-\d{2}-\d{2})(?:_(\d+))?\.log$`)
+
+// rotatedFile is a rotated file and the parts of its name that order it
+type rotatedFile struct {
+	path      string
+	timestamp string
+	counter   int
+}
+
+// RotatedFiles returns the files written for logPath in write order: logPath itself (if it exists),
+// then its rotated files ({base}_{YYYY-MM-DD_HH-MM-SS}.log, then _1, _2, ... within a second) oldest first
+func RotatedFiles(logPath string) ([]string, error) {
+	dir := filepath.Dir(logPath)
+	base := strings.TrimSuffix(filepath.Base(logPath), ".log")
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list log directory: %w", err)
+	}
+
+	var files []string
+	var rotated []rotatedFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		if filepath.Join(dir, name) == filepath.Clean(logPath) {
+			files = append(files, filepath.Join(dir, name))
+			continue
+		}
+		if !strings.HasPrefix(name, base) {
+			continue
+		}
+		if m := rotatedSuffix.FindStringSubmatch(name[len(base):]); m != nil {
+			counter, _ := strconv.Atoi(m[2]) // No counter sorts first
+			rotated = append(rotated, rotatedFile{path: filepath.Join(dir, name), timestamp: m[1], counter: counter})
+		}
+	}
+	// Timestamps are zero-padded, so lexical order is chronological; counters are not
+	sort.Slice(rotated, func(i, j int) bool {
+		if rotated[i].timestamp != rotated[j].timestamp {
+			return rotated[i].timestamp < rotated[j].timestamp
+		}
+		return rotated[i].counter < rotated[j].counter
+	})
+	for _, f := range rotated {
+		files = append(files, f.path)
+	}
+	return files, nil
+}
+
+// Next returns the next entry, or io.EOF after the last file
+// The returned slice is only valid until the next call to Next. Without SkipCorruptShards an
+// ErrCorrupt for an entry skips the rest of that shard, and Next may be called again to continue;
+// an ErrCorrupt for a shard header is sticky because the next shard's position is unknown
+func (r *LogReader) Next() ([]byte, error) {
+	for {
+		if len(r.data) == 0 {
+			if err := r.nextShard(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if len(r.data) < LengthPrefixSize {
+			r.data = nil
+			if err := r.corrupt("truncated length prefix"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		length := binary.LittleEndian.Uint32(r.data)
+		if length&PaddingFlag != 0 {
+			skip := LengthPrefixSize + int64(length&^PaddingFlag)
+			if skip > int64(len(r.data)) {
+				r.data = nil
+				if err := r.corrupt(fmt.Sprintf("padding length %d exceeds shard data", skip)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			r.data = r.data[skip:]
+			r.dataOff += skip
+			continue
+		}
+		size := int(length)
+		if size == 0 || size > len(r.data)-LengthPrefixSize {
+			r.data = nil
+			if err := r.corrupt(fmt.Sprintf("entry length %d exceeds shard data", size)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		entry := r.data[LengthPrefixSize : LengthPrefixSize+size]
+		if r.opts.SequenceNumbers {
+			if size < SequenceSize {
+				r.data = nil
+				if err := r.corrupt(fmt.Sprintf("entry of %d bytes has no sequence number", size)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			r.entrySeq = binary.LittleEndian.Uint64(entry)
+			entry = entry[SequenceSize:]
+		}
+		if tsSize := r.opts.Timestamp.Size(); tsSize > 0 {
+			var ts time.Time
+			err := ErrCorrupt
+			if len(entry) >= tsSize {
+				ts, err = r.opts.Timestamp.Parse(entry)
+			}
+			if err != nil {
+				r.data = nil
+				if err := r.corrupt(fmt.Sprintf("entry of %d bytes has no valid %s timestamp", len(entry), r.opts.Timestamp)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			r.entryTS = ts
+			entry = entry[tsSize:]
+		}
+		r.data = r.data[LengthPrefixSize+size:]
+		r.entryOff = r.dataOff
+		r.dataOff += int64(LengthPrefixSize + size)
+		return entry, nil
+	}
+}
+
+// Shard describes the shard holding the last entry returned by Next
+func (r *LogReader) Shard() ShardInfo {
+	return r.shard
+}
+
+// Offset returns the file offset of the last entry returned by Next (its length prefix)
+func (r *LogReader) Offset() int64 {
+	return r.entryOff
+}
+
+// Timestamp returns the write time of the last entry returned by Next (zero without Options.Timestamp)
+func (r *LogReader) Timestamp() time.Time {
+	return r.entryTS
+}
+
+// Sequence returns the sequence number of the last entry returned by Next (zero without
+// Options.SequenceNumbers). Numbers are unique and increasing in the order entries were logged
+func (r *LogReader) Sequence() uint64 {
+	return r.entrySeq
+}
+
+// CorruptShards returns the number of shards skipped or cut short because of corruption
+func (r *LogReader) CorruptShards() int {
+	return r.corruptShards
+}
+
+// Close closes the files opened by Open or OpenFiles
+func (r *LogReader) Close() error {
+	var firstErr error
+	for _, src := range r.sources {
+		if src.closer != nil {
+			if err := src.closer.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	r.sources = nil
+	return firstErr
+}
+
+// corrupt counts a corrupt shard and returns nil if it should be skipped, or ErrCorrupt
+func (r *LogReader) corrupt(detail string) error {
+	r.corruptShards++
+	if r.opts.SkipCorruptShards {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrCorrupt, detail)
+}
+
+// nextShard loads the next shard's entries, moving on to the next file at the end of each one
+func (r *LogReader) nextShard() error {
+	for r.err == nil {
+		if len(r.sources) == 0 {
+			r.err = io.EOF
+			break
+		}
+
+		loaded, err := r.readShard(r.sources[0].r)
+		if err != nil {
+			r.err = err
+			break
+		}
+		if loaded {
+			return nil
+		}
+
+		// End of this file
+		if closer := r.sources[0].closer; closer != nil {
+			closer.Close()
+		}
+		r.sources = r.sources[1:]
+		r.off = 0
+		r.source++
+		r.shardIdx = 0
+	}
+	return r.err
+}
+
+// readShard reads the shard at r.off; returns false at the end of the file
+func (r *LogReader) readShard(src io.ReaderAt) (bool, error) {
+	var header [ShardHeaderSize]byte
+	n, err := src.ReadAt(header[:], r.off)
+	if n < ShardHeaderSize {
+		if n == 0 && errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return false, fmt.Errorf("failed to read shard header: %w", err)
+		}
+		return false, r.corrupt("truncated shard header")
+	}
+
+	capacity := int64(binary.LittleEndian.Uint32(header[0:4]))
+	validDataBytes := int64(binary.LittleEndian.Uint32(header[4:8]))
+	if capacity == 0 {
+		// Zero-filled preallocated tail
+		return false, nil
+	}
+	if !plausibleHeader(capacity, validDataBytes) {
+		if err := r.corrupt(fmt.Sprintf("shard header at offset %d: capacity=%d valid=%d", r.off, capacity, validDataBytes)); err != nil {
+			return false, err
+		}
+		return r.resync(src)
+	}
+
+	dataSize := int(capacity - ShardHeaderSize)
+	if cap(r.shardBuf) < dataSize {
+		r.shardBuf = make([]byte, dataSize)
+	}
+	r.shardBuf = r.shardBuf[:dataSize]
+	n, err = src.ReadAt(r.shardBuf, r.off+ShardHeaderSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, fmt.Errorf("failed to read shard data: %w", err)
+	}
+
+	r.shard = ShardInfo{
+		Source:         r.source,
+		Index:          r.shardIdx,
+		Offset:         r.off,
+		Capacity:       capacity,
+		ValidDataBytes: validDataBytes,
+		Truncated:      int64(n) < validDataBytes,
+	}
+	r.shardIdx++
+	r.dataOff = r.off + ShardHeaderSize
+	r.off += capacity
+	if r.opts.OnShard != nil {
+		r.opts.OnShard(r.shard)
+	}
+
+	if r.shard.Truncated {
+		// Truncated shard at the end of the file: keep the complete entries that made it to disk
+		if err := r.corrupt(fmt.Sprintf("shard truncated at %d of %d data bytes", n, validDataBytes)); err != nil {
+			return false, err
+		}
+		r.data = completeEntries(r.shardBuf[:n])
+		return true, nil
+	}
+	r.data = r.shardBuf[:validDataBytes]
+	return true, nil
+}
+
+// resync scans forward from the corrupt header for the next plausible shard header
+// Shards written with O_DIRECT start on Alignment boundaries, so only aligned offsets are checked
+// (unpadded buffered-mode files cannot be resynchronized and end at the corrupt shard)
+func (r *LogReader) resync(src io.ReaderAt) (bool, error) {
+	var header [ShardHeaderSize]byte
+	for off := (r.off/Alignment + 1) * Alignment; ; off += Alignment {
+		n, err := src.ReadAt(header[:], off)
+		if n < ShardHeaderSize {
+			if err != nil && !errors.Is(err, io.EOF) {
+				return false, fmt.Errorf("failed to read shard header: %w", err)
+			}
+			return false, nil
+		}
+		capacity := int64(binary.LittleEndian.Uint32(header[0:4]))
+		validDataBytes := int64(binary.LittleEndian.Uint32(header[4:8]))
+		if capacity == 0 && validDataBytes == 0 {
+			continue
+		}
+		if capacity%Alignment == 0 && plausibleHeader(capacity, validDataBytes) {
+			r.off = off
+			return r.readShard(src)
+		}
+	}
+}
+
+// plausibleHeader reports whether a shard header is consistent with the format
+// Capacity is not required to be aligned because buffered-mode shards are written without padding
+func plausibleHeader(capacity, validDataBytes int64) bool {
+	return capacity > ShardHeaderSize &&
+		capacity <= maxShardCapacity &&
+		validDataBytes <= capacity-ShardHeaderSize
+}
+
+// completeEntries trims data to the entries that fit entirely
+func completeEntries(data []byte) []byte {
+	pos := 0
+	for pos+LengthPrefixSize <= len(data) {
+		length := binary.LittleEndian.Uint32(data[pos:])
+		size := int(length &^ PaddingFlag)
+		if (size == 0 && length&PaddingFlag == 0) || pos+LengthPrefixSize+size > len(data) {
+			break
+		}
+		pos += LengthPrefixSize + size
+	}
+	return data[:pos]
+}
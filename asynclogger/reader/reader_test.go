@@ -0,0 +1,275 @@
+package reader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildShard encodes entries into a full-capacity shard buffer as the flush path writes it
+func buildShard(capacity int, entries ...string) []byte {
+	buf := make([]byte, capacity)
+	pos := ShardHeaderSize
+	for _, entry := range entries {
+		binary.LittleEndian.PutUint32(buf[pos:], uint32(len(entry)))
+		copy(buf[pos+LengthPrefixSize:], entry)
+		pos += LengthPrefixSize + len(entry)
+	}
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(capacity))
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(pos-ShardHeaderSize))
+	return buf
+}
+
+// readAll drains a LogReader
+func readAll(t *testing.T, r *LogReader) []string {
+	t.Helper()
+	var entries []string
+	for {
+		entry, err := r.Next()
+		if err == io.EOF {
+			return entries
+		}
+		require.NoError(t, err)
+		entries = append(entries, string(entry))
+	}
+}
+
+func TestLogReader_Next(t *testing.T) {
+	t.Run("entries across shards", func(t *testing.T) {
+		file := append(buildShard(512, "a", "bb"), buildShard(1024, "ccc")...)
+		r := NewLogReader(bytes.NewReader(file), Options{})
+
+		assert.Equal(t, []string{"a", "bb", "ccc"}, readAll(t, r))
+		assert.Equal(t, 0, r.CorruptShards())
+	})
+
+	t.Run("empty shard", func(t *testing.T) {
+		file := append(buildShard(512), buildShard(512, "a")...)
+		r := NewLogReader(bytes.NewReader(file), Options{})
+
+		assert.Equal(t, []string{"a"}, readAll(t, r))
+	})
+
+	t.Run("padding is skipped", func(t *testing.T) {
+		// Overwrite the prefixes of "" and "xyz" to make them 0 and 3 bytes of padding
+		shard := buildShard(512, "a", "", "bb", "xyz", "c")
+		binary.LittleEndian.PutUint32(shard[13:], PaddingFlag)
+		binary.LittleEndian.PutUint32(shard[23:], PaddingFlag|3)
+		r := NewLogReader(bytes.NewReader(shard), Options{})
+
+		assert.Equal(t, []string{"a", "bb", "c"}, readAll(t, r))
+		assert.Equal(t, 0, r.CorruptShards())
+	})
+
+	t.Run("zero-filled preallocated tail", func(t *testing.T) {
+		file := append(buildShard(512, "a"), make([]byte, 4096)...)
+		r := NewLogReader(bytes.NewReader(file), Options{})
+
+		assert.Equal(t, []string{"a"}, readAll(t, r))
+	})
+
+	t.Run("empty file", func(t *testing.T) {
+		r := NewLogReader(bytes.NewReader(nil), Options{})
+
+		_, err := r.Next()
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("corrupt header is sticky without skip", func(t *testing.T) {
+		bad := buildShard(512, "a")
+		binary.LittleEndian.PutUint32(bad[0:4], 4) // Smaller than the header
+		r := NewLogReader(bytes.NewReader(bad), Options{})
+
+		_, err := r.Next()
+		assert.True(t, errors.Is(err, ErrCorrupt))
+		_, err = r.Next()
+		assert.True(t, errors.Is(err, ErrCorrupt))
+	})
+
+	t.Run("corrupt entry skips rest of shard", func(t *testing.T) {
+		bad := buildShard(512, "a", "b")
+		binary.LittleEndian.PutUint32(bad[ShardHeaderSize+LengthPrefixSize+1:], 10000)
+		file := append(bad, buildShard(512, "c")...)
+		r := NewLogReader(bytes.NewReader(file), Options{})
+
+		entry, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "a", string(entry))
+		_, err = r.Next()
+		assert.True(t, errors.Is(err, ErrCorrupt))
+		assert.Equal(t, []string{"c"}, readAll(t, r))
+	})
+
+	t.Run("skip corrupt shards resynchronizes on next header", func(t *testing.T) {
+		bad := buildShard(1024, "lost")
+		binary.LittleEndian.PutUint32(bad[4:8], 5000) // Valid bytes exceed capacity
+		file := append(buildShard(512, "a"), bad...)
+		file = append(file, buildShard(512, "b")...)
+		r := NewLogReader(bytes.NewReader(file), Options{SkipCorruptShards: true})
+
+		assert.Equal(t, []string{"a", "b"}, readAll(t, r))
+		assert.Equal(t, 1, r.CorruptShards())
+	})
+
+	t.Run("truncated shard", func(t *testing.T) {
+		file := append(buildShard(512, "a"), buildShard(512, "b", "cc")...)
+		file = file[:512+ShardHeaderSize+LengthPrefixSize+1+2] // Cut inside "cc"'s length prefix
+
+		r := NewLogReader(bytes.NewReader(file), Options{})
+		entry, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "a", string(entry))
+		_, err = r.Next()
+		assert.True(t, errors.Is(err, ErrCorrupt))
+
+		r = NewLogReader(bytes.NewReader(file), Options{SkipCorruptShards: true})
+		assert.Equal(t, []string{"a", "b"}, readAll(t, r))
+		assert.Equal(t, 1, r.CorruptShards())
+	})
+}
+
+func TestLogReader_Position(t *testing.T) {
+	file := append(buildShard(512, "a", "bb"), buildShard(512)...)
+	file = append(file, buildShard(512, "ccc")...)
+
+	var shards []ShardInfo
+	r := NewLogReader(bytes.NewReader(file), Options{OnShard: func(info ShardInfo) {
+		shards = append(shards, info)
+	}})
+
+	_, err := r.Next()
+	require.NoError(t, err)
+	entry, err := r.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "bb", string(entry))
+	assert.Equal(t, int64(ShardHeaderSize+LengthPrefixSize+1), r.Offset())
+	assert.Equal(t, 0, r.Shard().Index)
+
+	entry, err = r.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "ccc", string(entry))
+	assert.Equal(t, int64(1024+ShardHeaderSize), r.Offset())
+	assert.Equal(t, ShardInfo{Index: 2, Offset: 1024, Capacity: 512, ValidDataBytes: 7}, r.Shard())
+
+	_, err = r.Next()
+	assert.Equal(t, io.EOF, err)
+	require.Len(t, shards, 3)
+	assert.Equal(t, int64(0), shards[1].ValidDataBytes)
+}
+
+func TestLogReader_Timestamp(t *testing.T) {
+	ts := time.Date(2026, 3, 4, 5, 6, 7, 123456789, time.UTC)
+	unixNano := make([]byte, 8)
+	binary.LittleEndian.PutUint64(unixNano, uint64(ts.UnixNano()))
+	rfc3339 := ts.Format(TimestampLayout) + " "
+	require.Len(t, rfc3339, TimestampRFC3339.Size())
+
+	t.Run("unix nano", func(t *testing.T) {
+		r := NewLogReader(bytes.NewReader(buildShard(512, string(unixNano)+"payload")), Options{Timestamp: TimestampUnixNano})
+
+		entry, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "payload", string(entry))
+		assert.True(t, ts.Equal(r.Timestamp()))
+	})
+
+	t.Run("rfc3339", func(t *testing.T) {
+		r := NewLogReader(bytes.NewReader(buildShard(512, rfc3339+"payload")), Options{Timestamp: TimestampRFC3339})
+
+		entry, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "payload", string(entry))
+		assert.True(t, ts.Equal(r.Timestamp()))
+	})
+
+	t.Run("entry shorter than the timestamp is corrupt", func(t *testing.T) {
+		r := NewLogReader(bytes.NewReader(buildShard(512, "short")), Options{Timestamp: TimestampUnixNano})
+
+		_, err := r.Next()
+		assert.True(t, errors.Is(err, ErrCorrupt))
+	})
+
+	t.Run("without the option the timestamp is part of the entry", func(t *testing.T) {
+		r := NewLogReader(bytes.NewReader(buildShard(512, rfc3339+"payload")), Options{})
+
+		assert.Equal(t, []string{rfc3339 + "payload"}, readAll(t, r))
+		assert.True(t, r.Timestamp().IsZero())
+	})
+}
+
+func TestLogReader_Sequence(t *testing.T) {
+	seq := make([]byte, SequenceSize)
+	binary.LittleEndian.PutUint64(seq, 42)
+	ts := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	unixNano := make([]byte, 8)
+	binary.LittleEndian.PutUint64(unixNano, uint64(ts.UnixNano()))
+
+	t.Run("sequence number", func(t *testing.T) {
+		r := NewLogReader(bytes.NewReader(buildShard(512, string(seq)+"payload")), Options{SequenceNumbers: true})
+
+		entry, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "payload", string(entry))
+		assert.Equal(t, uint64(42), r.Sequence())
+	})
+
+	t.Run("sequence number before the timestamp", func(t *testing.T) {
+		r := NewLogReader(bytes.NewReader(buildShard(512, string(seq)+string(unixNano)+"payload")),
+			Options{SequenceNumbers: true, Timestamp: TimestampUnixNano})
+
+		entry, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "payload", string(entry))
+		assert.Equal(t, uint64(42), r.Sequence())
+		assert.True(t, ts.Equal(r.Timestamp()))
+	})
+
+	t.Run("entry shorter than the sequence number is corrupt", func(t *testing.T) {
+		r := NewLogReader(bytes.NewReader(buildShard(512, "short")), Options{SequenceNumbers: true})
+
+		_, err := r.Next()
+		assert.True(t, errors.Is(err, ErrCorrupt))
+	})
+}
+
+func TestRotatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "payment.log")
+
+	write := func(name string, entries ...string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), buildShard(512, entries...), 0644))
+	}
+	write("payment.log", "1")
+	write("payment_2026-01-02_10-00-00.log", "3")
+	write("payment_2026-01-01_23-59-59.log", "2")
+	write("payment_2026-01-02_10-00-00_10.log", "5")
+	write("payment_2026-01-02_10-00-00_2.log", "4")
+	write("payment_refund.log", "other")
+	write("payment_refund_2026-01-01_00-00-00.log", "other")
+
+	files, err := RotatedFiles(logPath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		logPath,
+		filepath.Join(dir, "payment_2026-01-01_23-59-59.log"),
+		filepath.Join(dir, "payment_2026-01-02_10-00-00.log"),
+		filepath.Join(dir, "payment_2026-01-02_10-00-00_2.log"),
+		filepath.Join(dir, "payment_2026-01-02_10-00-00_10.log"),
+	}, files)
+
+	r, err := OpenFiles(files, Options{})
+	require.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, readAll(t, r))
+
+	_, err = Open(filepath.Join(dir, "missing.log"), Options{})
+	assert.Error(t, err)
+}
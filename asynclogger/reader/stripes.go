@@ -0,0 +1,126 @@
+package reader
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// StripeReader reads the files of a striped logger (asynclogger Config.StripeFiles)
+// Each flush spreads its shards across the stripes, so the reader takes one shard from each stripe
+// in turn, which follows flush order as long as every flush writes a shard to every stripe. Entries
+// are only globally ordered by sequence number: with Config.SequenceNumbers, sort by Sequence
+type StripeReader struct {
+	readers []*LogReader
+	files   [][]string // Files of each stripe, in write order
+
+	active  []int // Stripes not yet at io.EOF, in turn order
+	turn    int   // Index into active of the stripe being read
+	started bool  // An entry of the current stripe's current shard was returned
+	stripe  int   // Stripe of the last entry returned
+}
+
+// OpenStripes opens the files of each stripe path: the path and its rotated files (RotatedFiles)
+func OpenStripes(stripePaths []string, opts Options) (*StripeReader, error) {
+	s := &StripeReader{}
+	for i, path := range stripePaths {
+		files, err := RotatedFiles(path)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("stripe %s: %w", path, err)
+		}
+		r, err := OpenFiles(files, opts)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("stripe %s: %w", path, err)
+		}
+		s.readers = append(s.readers, r)
+		s.files = append(s.files, files)
+		s.active = append(s.active, i)
+	}
+	return s, nil
+}
+
+// Next returns the next entry, or io.EOF after the last stripe (see LogReader.Next)
+// The returned slice is only valid until the next call to Next
+func (s *StripeReader) Next() ([]byte, error) {
+	for len(s.active) > 0 {
+		stripe := s.active[s.turn]
+		r := s.readers[stripe]
+		if s.started && len(r.data) == 0 {
+			// Shard done: the next stripe's turn
+			s.turn = (s.turn + 1) % len(s.active)
+			s.started = false
+			continue
+		}
+
+		entry, err := r.Next()
+		if err == io.EOF {
+			s.active = append(s.active[:s.turn], s.active[s.turn+1:]...)
+			if s.turn >= len(s.active) {
+				s.turn = 0
+			}
+			s.started = false
+			continue
+		}
+		s.stripe = stripe
+		if err != nil {
+			// The rest of the shard is skipped (or the stripe's error is sticky)
+			s.started = true
+			return nil, err
+		}
+		s.started = true
+		return entry, nil
+	}
+	return nil, io.EOF
+}
+
+// Stripe returns the index of the stripe holding the last entry returned by Next
+func (s *StripeReader) Stripe() int {
+	return s.stripe
+}
+
+// File returns the path of the file holding the last entry returned by Next
+func (s *StripeReader) File() string {
+	return s.files[s.stripe][s.Shard().Source]
+}
+
+// Shard describes the shard holding the last entry returned by Next; Source indexes the stripe's files
+func (s *StripeReader) Shard() ShardInfo {
+	return s.readers[s.stripe].Shard()
+}
+
+// Offset returns the file offset of the last entry returned by Next
+func (s *StripeReader) Offset() int64 {
+	return s.readers[s.stripe].Offset()
+}
+
+// Timestamp returns the write time of the last entry returned by Next (see LogReader.Timestamp)
+func (s *StripeReader) Timestamp() time.Time {
+	return s.readers[s.stripe].Timestamp()
+}
+
+// Sequence returns the sequence number of the last entry returned by Next (see LogReader.Sequence)
+func (s *StripeReader) Sequence() uint64 {
+	return s.readers[s.stripe].Sequence()
+}
+
+// CorruptShards returns the number of corrupt shards skipped or cut short across all stripes
+func (s *StripeReader) CorruptShards() int {
+	n := 0
+	for _, r := range s.readers {
+		n += r.CorruptShards()
+	}
+	return n
+}
+
+// Close closes the files of every stripe
+func (s *StripeReader) Close() error {
+	var firstErr error
+	for _, r := range s.readers {
+		if err := r.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,109 @@
+package asynclogger
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultRotationHistory is how many rotations SizeLogger.RotatedFiles keeps when
+// SizeConfig.RotationHistory is 0
+const DefaultRotationHistory = 16
+
+// RotationReason says why a SizeLogger file was completed
+type RotationReason string
+
+const (
+	// RotationSize: the file reached MaxFileSize and writing continues in NewPath
+	RotationSize RotationReason = "size"
+
+	// RotationClose: the logger was closed; NewPath is empty
+	RotationClose RotationReason = "close"
+)
+
+// RotationInfo describes a completed SizeLogger file, as passed to SizeConfig.RotationCallback
+// Entries are not counted: that would mean scanning every flushed shard
+type RotationInfo struct {
+	OldPath   string // The completed file
+	NewPath   string // The file writing continues in (empty for RotationClose)
+	Bytes     int64  // Bytes written to OldPath (whole shard buffers, including their headers)
+	Reason    RotationReason
+	RotatedAt time.Time
+}
+
+// rotationHistory is a bounded ring of the most recent rotations
+type rotationHistory struct {
+	mu    sync.Mutex
+	infos []RotationInfo
+	next  int   // Index the next rotation is stored at once infos is full
+	sizes int64 // RotationSize rotations recorded, including those no longer kept
+}
+
+// newRotationHistory creates a ring of size entries (DefaultRotationHistory if size <= 0)
+func newRotationHistory(size int) *rotationHistory {
+	if size <= 0 {
+		size = DefaultRotationHistory
+	}
+	return &rotationHistory{infos: make([]RotationInfo, 0, size)}
+}
+
+// add records info, replacing the oldest rotation once the ring is full
+func (h *rotationHistory) add(info RotationInfo) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if info.Reason == RotationSize {
+		h.sizes++
+	}
+	if len(h.infos) < cap(h.infos) {
+		h.infos = append(h.infos, info)
+		return
+	}
+	h.infos[h.next] = info
+	h.next = (h.next + 1) % len(h.infos)
+}
+
+// list returns the recorded rotations, oldest first
+func (h *rotationHistory) list() []RotationInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	list := make([]RotationInfo, 0, len(h.infos))
+	list = append(list, h.infos[h.next:]...)
+	return append(list, h.infos[:h.next]...)
+}
+
+// last returns the most recent rotation, if any
+func (h *rotationHistory) last() (RotationInfo, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.infos) == 0 {
+		return RotationInfo{}, false
+	}
+	return h.infos[(h.next+len(h.infos)-1)%len(h.infos)], true
+}
+
+// sizeRotations returns how many RotationSize rotations were recorded
+func (h *rotationHistory) sizeRotations() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.sizes
+}
+
+// recordRotation records the completion of the current file and runs SizeConfig.RotationCallback
+// Called with the old file closed, on the flush goroutine (or Close's)
+func (fw *SizeFileWriter) recordRotation(newPath string, reason RotationReason) {
+	info := RotationInfo{
+		OldPath:   fw.filePath,
+		NewPath:   newPath,
+		Bytes:     fw.fileOffset.Load(),
+		Reason:    reason,
+		RotatedAt: time.Now(),
+	}
+	fw.rotations.add(info)
+	if fw.onRotate != nil {
+		fw.onRotate(info)
+	}
+}
+
+// RotatedFiles returns the last SizeConfig.RotationHistory completed files, oldest first
+func (fw *SizeFileWriter) RotatedFiles() []RotationInfo {
+	return fw.rotations.list()
+}
@@ -0,0 +1,143 @@
+package asynclogger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSizeFileWriter_RotationCallback(t *testing.T) {
+	var mu sync.Mutex
+	var infos []RotationInfo
+
+	config := DefaultSizeConfig(filepath.Join(t.TempDir(), "size.log"))
+	config.MaxFileSize = 2 * alignmentSize
+	config.PreallocateFileSize = 2 * alignmentSize
+	config.RotationCallback = func(info RotationInfo) {
+		mu.Lock()
+		defer mu.Unlock()
+		infos = append(infos, info)
+	}
+
+	fw, err := NewSizeFileWriter(config)
+	require.NoError(t, err)
+
+	// Two shards fill a file, so five writes rotate twice and leave one shard in the third file
+	shard := allocAlignedBuffer(alignmentSize, alignmentSize)
+	for i := 0; i < 5; i++ {
+		_, err := fw.WriteVectored([][]byte{shard})
+		require.NoError(t, err)
+	}
+	require.NoError(t, fw.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, infos, 3)
+	assert.Equal(t, []RotationReason{RotationSize, RotationSize, RotationClose},
+		[]RotationReason{infos[0].Reason, infos[1].Reason, infos[2].Reason})
+	assert.Equal(t, []int64{2 * alignmentSize, 2 * alignmentSize, alignmentSize},
+		[]int64{infos[0].Bytes, infos[1].Bytes, infos[2].Bytes})
+
+	// Each rotation's new file is the next one's old file, and no name was reused
+	assert.Equal(t, infos[0].NewPath, infos[1].OldPath)
+	assert.Equal(t, infos[1].NewPath, infos[2].OldPath)
+	assert.Empty(t, infos[2].NewPath)
+	assert.Len(t, map[string]bool{infos[0].OldPath: true, infos[1].OldPath: true, infos[2].OldPath: true}, 3)
+	for _, info := range infos[:2] {
+		assert.True(t, strings.HasPrefix(filepath.Base(info.OldPath), "size_"))
+		stat, err := os.Stat(info.OldPath)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, stat.Size(), info.Bytes)
+	}
+
+	assert.Equal(t, infos, fw.RotatedFiles())
+}
+
+func TestSizeLogger_RotatedFiles(t *testing.T) {
+	var mu sync.Mutex
+	var callbacks int
+
+	config := DefaultSizeConfig(filepath.Join(t.TempDir(), "size.log"))
+	config.BufferSize = 128 * 1024
+	config.NumShards = 2
+	config.MaxFileSize = 256 * 1024
+	config.RotationHistory = 64
+	config.RotationCallback = func(RotationInfo) {
+		mu.Lock()
+		defer mu.Unlock()
+		callbacks++
+	}
+
+	logger, err := NewSizeLogger(config)
+	require.NoError(t, err)
+
+	// Each round fills a buffer set and waits for its flush; a file holds two flushes, so six
+	// rounds rotate twice
+	msg := strings.Repeat("r", 500)
+	for round := int64(1); round <= 6; round++ {
+		for i := 0; i < 300; i++ {
+			logger.Log(msg)
+		}
+		require.Eventually(t, func() bool {
+			_, _, _, flushes, _, _, _, _ := logger.GetStatsSnapshot()
+			return flushes >= round
+		}, 5*time.Second, time.Millisecond)
+	}
+	require.NoError(t, logger.Close())
+
+	rotated := logger.RotatedFiles()
+	require.GreaterOrEqual(t, len(rotated), 3, "expected at least two size rotations and the close")
+
+	mu.Lock()
+	assert.Equal(t, len(rotated), callbacks)
+	mu.Unlock()
+
+	// Every byte the logger wrote is accounted to exactly one file
+	_, droppedLogs, bytesWritten, _, _, _, bytesBuffered, bytesDurable := logger.GetStatsSnapshot()
+	var total int64
+	var paths []string
+	for i, info := range rotated {
+		total += info.Bytes
+		paths = append(paths, info.OldPath)
+		if i < len(rotated)-1 {
+			assert.Equal(t, RotationSize, info.Reason)
+			assert.Equal(t, rotated[i+1].OldPath, info.NewPath)
+		}
+	}
+	assert.Equal(t, RotationClose, rotated[len(rotated)-1].Reason)
+	assert.Equal(t, bytesWritten, total)
+
+	// Payload counters ignore headers and padding, and every accepted byte is durable after Close
+	assert.Equal(t, (6*300-droppedLogs)*int64(len(msg)), bytesBuffered)
+	assert.Equal(t, bytesBuffered, bytesDurable)
+	assert.Equal(t, bytesDurable, payloadBytes(t, reader.Options{}, paths...))
+}
+
+func TestRotationHistory_KeepsMostRecent(t *testing.T) {
+	h := newRotationHistory(3)
+	assert.Empty(t, h.list())
+
+	for _, path := range []string{"a", "b", "c", "d", "e"} {
+		h.add(RotationInfo{OldPath: path})
+	}
+
+	var paths []string
+	for _, info := range h.list() {
+		paths = append(paths, info.OldPath)
+	}
+	assert.Equal(t, []string{"c", "d", "e"}, paths)
+
+	last, ok := h.last()
+	require.True(t, ok)
+	assert.Equal(t, "e", last.OldPath)
+	assert.Zero(t, h.sizeRotations())
+	h.add(RotationInfo{OldPath: "f", Reason: RotationSize})
+	assert.Equal(t, int64(1), h.sizeRotations())
+}
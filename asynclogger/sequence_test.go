@@ -0,0 +1,110 @@
+package asynclogger
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sleepyWriter delays every flush, so writers outrun the buffers and some entries are dropped
+type sleepyWriter struct {
+	FileWriter
+	delay time.Duration
+}
+
+func (w *sleepyWriter) WriteVectored(buffers [][]byte) (int, error) {
+	time.Sleep(w.delay)
+	return w.FileWriter.WriteVectored(buffers)
+}
+
+func TestLogger_SequenceNumbers(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "seq.log")
+	config := DefaultConfig(logPath)
+	config.BufferSize = 128 * 1024
+	config.NumShards = 2
+	config.SequenceNumbers = true
+	config.PrependTimestamp = TimestampUnixNano
+	config.WriteRetryTimeout = time.Millisecond
+	config.MaxEntrySize = 64
+	// A write starved past FlushTimeout (the race detector on few CPUs) is flushed while still
+	// copying, as documented; keep it out of reach so every flush sees complete entries
+	config.FlushInterval = time.Minute
+	config.FlushTimeout = 10 * time.Second
+
+	fileWriter, err := NewFileWriter(config)
+	require.NoError(t, err)
+	logger, err := NewWithWriter(config, &sleepyWriter{FileWriter: fileWriter, delay: 5 * time.Millisecond})
+	require.NoError(t, err)
+
+	const goroutines, perGoroutine = 32, 2000
+	first := sequence.Load() + 1
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				msg := fmt.Sprintf("%02d-%05d", g, i)
+				if i%2 == 0 {
+					logger.Log(msg)
+				} else {
+					logger.LogEntry(func(buf *EntryBuffer) { buf.AppendString(msg) })
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	last := sequence.Load()
+	require.NoError(t, logger.Close())
+	require.Equal(t, uint64(goroutines*perGoroutine), last-first+1, "one number per write")
+
+	type entry struct {
+		seq uint64
+		msg string
+	}
+	var entries []entry
+	r, err := reader.Open(logPath, reader.Options{SequenceNumbers: true, Timestamp: TimestampUnixNano})
+	require.NoError(t, err)
+	defer r.Close()
+	for {
+		data, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		entries = append(entries, entry{seq: r.Sequence(), msg: string(data)})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+
+	// Gap-free except for dropped entries
+	_, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
+	t.Logf("%d entries read, %d dropped", len(entries), droppedLogs)
+	for i, e := range entries {
+		require.GreaterOrEqual(t, e.seq, first)
+		require.LessOrEqual(t, e.seq, last)
+		if i > 0 {
+			require.Greater(t, e.seq, entries[i-1].seq, "sequence numbers are unique")
+		}
+	}
+	assert.Equal(t, int64(last-first+1)-int64(len(entries)), droppedLogs)
+
+	// Sequence order is write order within each goroutine
+	next := make(map[string]int)
+	for _, e := range entries {
+		var g, i int
+		_, err := fmt.Sscanf(e.msg, "%02d-%05d", &g, &i)
+		require.NoError(t, err)
+		key := fmt.Sprint(g)
+		require.GreaterOrEqual(t, i, next[key], "entry %s out of order", e.msg)
+		next[key] = i + 1
+	}
+}
@@ -2,6 +2,7 @@ package asynclogger
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -9,12 +10,24 @@ import (
 type Shard struct {
 	buffer *Buffer
 	mu     sync.Mutex
+
+	// Writes that found this shard full, cumulative across flushes (see ShardStats)
+	drops         atomic.Int64 // Entries dropped after this shard refused them
+	retries       atomic.Int64 // Writes that entered the swap-semaphore retry path
+	retryTimeouts atomic.Int64 // Retry-path writes dropped waiting for the swap semaphore
+	swaps         atomic.Int64 // Set swaps triggered by a write to this shard
+	spills        atomic.Int64 // Writes this shard had no space for that a following shard took
 }
 
 // NewShard creates a new shard with the specified capacity
 func NewShard(capacity int, id uint32) *Shard {
+	return newShard(capacity, id, true, alignmentSize)
+}
+
+// newShard creates a shard; aligned and alignment are passed to newBuffer
+func newShard(capacity int, id uint32, aligned bool, alignment int) *Shard {
 	return &Shard{
-		buffer: NewBuffer(capacity, id),
+		buffer: newBuffer(capacity, id, aligned, alignment),
 	}
 }
 
@@ -24,6 +37,23 @@ func (s *Shard) Write(p []byte) (int, bool) {
 	return s.buffer.Write(p)
 }
 
+// write is Write with the entry's sequence number (see Buffer.write)
+func (s *Shard) write(p []byte, seq uint64) (int, bool) {
+	return s.buffer.write(p, seq)
+}
+
+// reserve claims size bytes in the shard's buffer for LogEntry (see Buffer.reserve)
+func (s *Shard) reserve(size int32) (int32, bool) {
+	return s.buffer.reserve(size)
+}
+
+// seal seals the shard's buffer for a flush and returns the entries to write (see Buffer.seal)
+func (s *Shard) seal(timeout time.Duration) sealedData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buffer.seal(timeout)
+}
+
 // GetData returns the current data in the shard's buffer
 // Should only be called during flush operations
 // Returns the data and whether all writes completed (false if timeout occurred)
@@ -65,3 +95,67 @@ func (s *Shard) IsFull() bool {
 func (s *Shard) HasData() bool {
 	return s.buffer.HasData()
 }
+
+// countDrop counts an entry dropped after the shard refused it (s may be nil when unknown)
+func (s *Shard) countDrop() {
+	if s != nil {
+		s.drops.Add(1)
+	}
+}
+
+// countRetry counts a write that found the shard full and entered the retry path
+func (s *Shard) countRetry() {
+	if s != nil {
+		s.retries.Add(1)
+	}
+}
+
+// countRetryTimeout counts a retry-path write dropped waiting for the swap semaphore
+// The drop itself is counted by countDrop
+func (s *Shard) countRetryTimeout() {
+	if s != nil {
+		s.retryTimeouts.Add(1)
+	}
+}
+
+// countSwap counts a set swap triggered by a write to the shard
+func (s *Shard) countSwap(swapped bool) {
+	if s != nil && swapped {
+		s.swaps.Add(1)
+	}
+}
+
+// collectShardStats returns per-shard statistics of active
+// The sets alternate, so shard i of either set is the same logical shard: the write-path
+// counters are summed over both sets, while the buffer fields describe active only
+func collectShardStats(active, other *BufferSet) []ShardStats {
+	shards := active.Shards()
+	stats := make([]ShardStats, len(shards))
+
+	for i, shard := range shards {
+		stats[i] = ShardStats{
+			ShardID:         i,
+			WriteCount:      shard.buffer.WriteCount(),
+			BytesUsed:       shard.buffer.DataSize(),
+			Capacity:        shard.Capacity(),
+			UtilizationPct:  shard.buffer.UtilizationPct(),
+			Drops:           shard.drops.Load(),
+			RetryPathWrites: shard.retries.Load(),
+			RetryTimeouts:   shard.retryTimeouts.Load(),
+			Swaps:           shard.swaps.Load(),
+			Spills:          shard.spills.Load(),
+		}
+		if other == nil {
+			continue
+		}
+		if twin := other.GetShard(i); twin != nil {
+			stats[i].Drops += twin.drops.Load()
+			stats[i].RetryPathWrites += twin.retries.Load()
+			stats[i].RetryTimeouts += twin.retryTimeouts.Load()
+			stats[i].Swaps += twin.swaps.Load()
+			stats[i].Spills += twin.spills.Load()
+		}
+	}
+
+	return stats
+}
@@ -0,0 +1,407 @@
+package asynclogger
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSinkQueueFull is returned by SocketSink.WriteVectored when QueueSize flushes are still waiting
+// to be sent; the flush is not forwarded
+var ErrSinkQueueFull = errors.New("sink queue is full")
+
+// FlushSink receives the framed shard blocks of every flush, as they are written to the log file
+// ([capacity:u32][validDataBytes:u32][entries...] per shard; see reader). The buffers are only valid
+// during the call, so a sink that sends them later copies them first. Sinks tee'd next to the log
+// file (TeeWriter) must not block on I/O: a slow sink would otherwise hold up every flush
+type FlushSink interface {
+	WriteVectored(buffers [][]byte) (int, error)
+	Close() error
+}
+
+// TeeWriter writes every flush to a FileWriter (the log file) and hands it to further sinks, e.g. a
+// SocketSink forwarding it to a local collector. Only the file's result reaches the logger: each
+// sink keeps its own error accounting, so a collector outage never fails a flush, and a failed
+// file write is still forwarded
+type TeeWriter struct {
+	FileWriter // The log file; its GetLastPwritevDuration is reported
+	sinks      []FlushSink
+}
+
+var _ FileWriter = (*TeeWriter)(nil)
+
+// NewTeeWriter tees the flushes written to file to sinks, e.g. for NewWithWriter
+// The TeeWriter owns file and sinks and closes them on Close
+func NewTeeWriter(file FileWriter, sinks ...FlushSink) *TeeWriter {
+	return &TeeWriter{FileWriter: file, sinks: sinks}
+}
+
+// WriteVectored writes buffers to the file, then to every sink; sink errors are left to the sinks
+func (t *TeeWriter) WriteVectored(buffers [][]byte) (int, error) {
+	n, err := t.FileWriter.WriteVectored(buffers)
+	for _, sink := range t.sinks {
+		sink.WriteVectored(buffers)
+	}
+	return n, err
+}
+
+// Close closes the file and every sink and returns the file's error; as for writes, what a sink
+// could not deliver shows in its own statistics (SinkStats.FramesDropped)
+func (t *TeeWriter) Close() error {
+	err := t.FileWriter.Close()
+	for _, sink := range t.sinks {
+		sink.Close()
+	}
+	return err
+}
+
+// warmup warms up the file (Logger.Warmup)
+func (t *TeeWriter) warmup(size int64) (prime, preallocate time.Duration, err error) {
+	if warmer, ok := t.FileWriter.(fileWarmer); ok {
+		return warmer.warmup(size)
+	}
+	return 0, 0, nil
+}
+
+// SinkStats reports the flushes one SocketSink forwarded (see Logger.GetSinkStats)
+type SinkStats struct {
+	Sink          string // Network and address, e.g. "unix:/run/fluent-bit.sock"
+	Connected     bool
+	FramesSent    int64 // Flushes written to the socket
+	BytesSent     int64
+	FramesDropped int64 // Flushes not forwarded: the queue was full, or Close gave up on them
+	BytesDropped  int64
+	WriteErrors   int64 // Failed dials and writes; the flush is retried on the next connection
+	Reconnects    int64 // Connections made after the first
+	Queued        int   // Flushes waiting to be sent
+}
+
+// SocketSink forwards flushes to a unix or TCP socket, e.g. a local fluent-bit, as one stream of
+// framed shard blocks that reader.NewLogReader decodes. Shards are sent without their alignment
+// padding (capacity is rewritten to 8 + validDataBytes, as IOModeBuffered writes them).
+//
+// WriteVectored copies the flush into a queue of QueueSize flushes and returns; one goroutine dials,
+// writes and reconnects with exponential backoff, so a slow or absent collector costs the flush
+// path a copy and, once the queue is full, the forwarded flush. A flush whose write fails is sent
+// again in full on the next connection: each connection starts at a shard boundary, and a
+// collector may see a flush twice. With Config.OutputFormat OutputPlain the stream is the lines of
+// the log file instead
+type SocketSink struct {
+	config SinkConfig
+	name   string
+	plain  bool // Forward buffers as is: they hold lines, not shard blocks (Config.OutputFormat)
+
+	mu     sync.Mutex // Guards closed and sending on queue
+	closed bool
+	queue  chan []byte
+	free   chan []byte // Frame buffers to reuse
+	ctx    context.Context
+	cancel context.CancelFunc // Gives up on the queue (Close after CloseTimeout)
+	done   chan struct{}      // Closed when the sender goroutine exits
+
+	conn net.Conn // Owned by the sender goroutine
+
+	connected     atomic.Bool
+	everConnected bool // Sender goroutine only
+	framesSent    atomic.Int64
+	bytesSent     atomic.Int64
+	framesDropped atomic.Int64
+	bytesDropped  atomic.Int64
+	writeErrors   atomic.Int64
+	reconnects    atomic.Int64
+}
+
+var (
+	_ FlushSink  = (*SocketSink)(nil)
+	_ FileWriter = (*SocketSink)(nil)
+)
+
+// minSinkBackoff is the first wait before redialing a collector
+const minSinkBackoff = 50 * time.Millisecond
+
+// NewSocketSink starts a sink for config (Network "unix" or "tcp"). It does not wait for the
+// collector: the first connection is made in the background, and flushes queue until then
+func NewSocketSink(config SinkConfig) (*SocketSink, error) {
+	if config.Network != "unix" && config.Network != "tcp" {
+		return nil, fmt.Errorf("socket sink network must be unix or tcp, got %q", config.Network)
+	}
+	if config.Address == "" {
+		return nil, fmt.Errorf("socket sink address is required")
+	}
+	config = config.withDefaults()
+
+	s := &SocketSink{
+		config: config,
+		name:   config.Network + ":" + config.Address,
+		queue:  make(chan []byte, config.QueueSize),
+		free:   make(chan []byte, config.QueueSize),
+		done:   make(chan struct{}),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	go s.run()
+	return s, nil
+}
+
+// WriteVectored queues a copy of the flush and returns the bytes given, or ErrSinkQueueFull
+func (s *SocketSink) WriteVectored(buffers [][]byte) (int, error) {
+	total := 0
+	for _, buf := range buffers {
+		total += len(buf)
+	}
+
+	frame := s.frame(buffers)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		s.drop(frame)
+		return 0, ErrClosed
+	}
+	select {
+	case s.queue <- frame:
+		return total, nil
+	default:
+		s.drop(frame)
+		return 0, fmt.Errorf("%s: %w", s.name, ErrSinkQueueFull)
+	}
+}
+
+// frame copies the shard blocks of buffers without their padding into a reused buffer
+// A buffer holds one shard, or several packed by Config.CompactFlush; each header says how far
+// the next one is. Plain output has no headers or padding and is copied as is
+func (s *SocketSink) frame(buffers [][]byte) []byte {
+	var frame []byte
+	select {
+	case frame = <-s.free:
+		frame = frame[:0]
+	default:
+	}
+
+	for _, buf := range buffers {
+		if s.plain {
+			frame = append(frame, buf...)
+			continue
+		}
+		for off := 0; off+headerOffset <= len(buf); {
+			capacity := int(binary.LittleEndian.Uint32(buf[off : off+4]))
+			valid := int(binary.LittleEndian.Uint32(buf[off+4 : off+8]))
+			if capacity < headerOffset || off+headerOffset+valid > len(buf) {
+				break
+			}
+			start := len(frame)
+			frame = append(frame, buf[off:off+headerOffset+valid]...)
+			binary.LittleEndian.PutUint32(frame[start:start+4], uint32(headerOffset+valid))
+			off += capacity
+		}
+	}
+	return frame
+}
+
+// drop counts a flush that is not forwarded and keeps its buffer for reuse
+func (s *SocketSink) drop(frame []byte) {
+	s.framesDropped.Add(1)
+	s.bytesDropped.Add(int64(len(frame)))
+	s.recycle(frame)
+}
+
+// recycle keeps frame for a later flush if the free list has room
+func (s *SocketSink) recycle(frame []byte) {
+	select {
+	case s.free <- frame:
+	default:
+	}
+}
+
+// GetLastPwritevDuration returns 0: WriteVectored only queues, the socket is written in the background
+func (s *SocketSink) GetLastPwritevDuration() time.Duration {
+	return 0
+}
+
+// Close stops taking flushes and waits up to CloseTimeout for the queued ones to be sent
+// Returns an error if some of them were given up
+func (s *SocketSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+
+	droppedBefore := s.framesDropped.Load()
+	timer := time.AfterFunc(s.config.CloseTimeout, s.cancel)
+	<-s.done
+	timer.Stop()
+	s.cancel()
+
+	if dropped := s.framesDropped.Load() - droppedBefore; dropped > 0 {
+		return fmt.Errorf("%s: %d queued flushes not sent within %v", s.name, dropped, s.config.CloseTimeout)
+	}
+	return nil
+}
+
+// Stats returns the sink's forwarding statistics
+func (s *SocketSink) Stats() SinkStats {
+	return SinkStats{
+		Sink:          s.name,
+		Connected:     s.connected.Load(),
+		FramesSent:    s.framesSent.Load(),
+		BytesSent:     s.bytesSent.Load(),
+		FramesDropped: s.framesDropped.Load(),
+		BytesDropped:  s.bytesDropped.Load(),
+		WriteErrors:   s.writeErrors.Load(),
+		Reconnects:    s.reconnects.Load(),
+		Queued:        len(s.queue),
+	}
+}
+
+// run sends queued flushes until the queue is closed and drained (or given up)
+func (s *SocketSink) run() {
+	defer close(s.done)
+	for frame := range s.queue {
+		if !s.send(frame) {
+			s.drop(frame)
+			continue
+		}
+		s.recycle(frame)
+	}
+	if s.conn != nil {
+		s.conn.Close()
+		s.connected.Store(false)
+	}
+}
+
+// send writes frame, dialing and redialing with backoff as needed
+// Returns false if the sink gave up first (Close after CloseTimeout)
+func (s *SocketSink) send(frame []byte) bool {
+	backoff := minSinkBackoff
+	for {
+		if s.ctx.Err() != nil {
+			return false
+		}
+		if s.conn == nil {
+			if err := s.dial(); err != nil {
+				s.writeErrors.Add(1)
+				select {
+				case <-time.After(backoff):
+				case <-s.ctx.Done():
+					return false
+				}
+				if backoff *= 2; backoff > s.config.MaxBackoff {
+					backoff = s.config.MaxBackoff
+				}
+				continue
+			}
+		}
+
+		s.conn.SetWriteDeadline(time.Now().Add(s.config.Timeout))
+		if _, err := s.conn.Write(frame); err != nil {
+			// The collector may hold part of the frame; the next connection starts with all of it
+			s.writeErrors.Add(1)
+			s.conn.Close()
+			s.conn = nil
+			s.connected.Store(false)
+			continue
+		}
+		s.framesSent.Add(1)
+		s.bytesSent.Add(int64(len(frame)))
+		return true
+	}
+}
+
+// dial connects to the collector
+func (s *SocketSink) dial() error {
+	dialer := net.Dialer{Timeout: s.config.Timeout}
+	conn, err := dialer.DialContext(s.ctx, s.config.Network, s.config.Address)
+	if err != nil {
+		return err
+	}
+	if s.everConnected {
+		s.reconnects.Add(1)
+	}
+	s.everConnected = true
+	s.conn = conn
+	s.connected.Store(true)
+	return nil
+}
+
+// newSinkWriter creates the writer New uses for config.Sinks: the log file tee'd to the socket
+// sinks, or just the socket sinks when SinkFile is not listed
+func newSinkWriter(config Config) (FileWriter, error) {
+	var file FileWriter
+	var sinks []FlushSink
+	closeAll := func() {
+		if file != nil {
+			file.Close()
+		}
+		for _, sink := range sinks {
+			sink.Close()
+		}
+	}
+
+	for _, sc := range config.Sinks {
+		if sc.Network == SinkFile {
+			fw, err := newLogFileWriter(config)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			file = fw
+			continue
+		}
+		sink, err := NewSocketSink(sc)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		sink.plain = config.OutputFormat == OutputPlain
+		sinks = append(sinks, sink)
+	}
+
+	if file == nil {
+		if len(sinks) == 1 {
+			return sinks[0].(*SocketSink), nil
+		}
+		// Several collectors and no file: the first one's queue decides whether a flush is lost
+		return NewTeeWriter(sinks[0].(*SocketSink), sinks[1:]...), nil
+	}
+	return NewTeeWriter(file, sinks...), nil
+}
+
+// sinkNames lists config.Sinks for Config.Explain
+func sinkNames(sinks []SinkConfig) string {
+	names := make([]string, len(sinks))
+	for i, sc := range sinks {
+		if sc.Network == SinkFile {
+			names[i] = SinkFile
+		} else {
+			names[i] = sc.Network + ":" + sc.Address
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// GetSinkStats returns the statistics of each socket sink in Config.Sinks order, and nil without any
+func (l *Logger) GetSinkStats() []SinkStats {
+	var stats []SinkStats
+	add := func(w any) {
+		if s, ok := w.(*SocketSink); ok {
+			stats = append(stats, s.Stats())
+		}
+	}
+	if t, ok := l.fileWriter.(*TeeWriter); ok {
+		add(t.FileWriter)
+		for _, sink := range t.sinks {
+			add(sink)
+		}
+	} else {
+		add(l.fileWriter)
+	}
+	return stats
+}
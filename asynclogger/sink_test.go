@@ -0,0 +1,261 @@
+package asynclogger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collector is an in-process unix socket server that keeps what each connection sent
+type collector struct {
+	listener net.Listener
+	read     bool // Whether connections are read; a collector that does not read stalls its writers
+
+	mu      sync.Mutex
+	streams [][]byte
+	conns   []net.Conn
+	wg      sync.WaitGroup
+}
+
+// startCollector listens on path
+func startCollector(t *testing.T, path string, read bool) *collector {
+	t.Helper()
+	listener, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	c := &collector{listener: listener, read: read}
+	c.wg.Add(1)
+	go c.accept()
+	t.Cleanup(c.stop)
+	return c
+}
+
+func (c *collector) accept() {
+	defer c.wg.Done()
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			return
+		}
+		c.mu.Lock()
+		c.conns = append(c.conns, conn)
+		i := len(c.streams)
+		c.streams = append(c.streams, nil)
+		c.mu.Unlock()
+		if !c.read {
+			continue
+		}
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			data, _ := io.ReadAll(conn)
+			c.mu.Lock()
+			c.streams[i] = data
+			c.mu.Unlock()
+		}()
+	}
+}
+
+// stop closes the listener and every connection and waits for the readers
+func (c *collector) stop() {
+	c.listener.Close()
+	c.mu.Lock()
+	for _, conn := range c.conns {
+		conn.Close()
+	}
+	c.mu.Unlock()
+	c.wg.Wait()
+}
+
+// entries waits for a connection and for every sender to hang up, then decodes each stream with the reader
+func (c *collector) entries(t *testing.T) []string {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if len(c.streams) == 0 {
+			return false
+		}
+		for _, stream := range c.streams {
+			if stream == nil {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	var entries []string
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, stream := range c.streams {
+		r := reader.NewLogReader(bytes.NewReader(stream), reader.Options{})
+		for {
+			entry, err := r.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+			entries = append(entries, string(entry))
+		}
+	}
+	return entries
+}
+
+func TestLogger_SocketSink(t *testing.T) {
+	for name, tee := range map[string]bool{"Tee": true, "SocketOnly": false} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			c := startCollector(t, filepath.Join(dir, "collector.sock"), true)
+
+			config := DefaultConfig(filepath.Join(dir, "app.log"))
+			config.BufferSize = 4 * 64 * 1024
+			config.NumShards = 4
+			config.Sinks = []SinkConfig{{Network: "unix", Address: filepath.Join(dir, "collector.sock")}}
+			if tee {
+				config.Sinks = append(config.Sinks, SinkConfig{Network: SinkFile})
+			}
+
+			logger, err := New(config)
+			require.NoError(t, err)
+			var want []string
+			for flush := 0; flush < 3; flush++ {
+				for i := 0; i < 500; i++ {
+					msg := fmt.Sprintf("flush-%d-%03d", flush, i)
+					require.NoError(t, logger.TryLogBytes([]byte(msg)))
+					want = append(want, msg)
+				}
+				require.NoError(t, logger.Flush(t.Context()))
+			}
+			require.NoError(t, logger.Close())
+
+			stats := logger.GetSinkStats()
+			require.Len(t, stats, 1)
+			assert.Equal(t, "unix:"+filepath.Join(dir, "collector.sock"), stats[0].Sink)
+			assert.Equal(t, int64(3), stats[0].FramesSent)
+			assert.Zero(t, stats[0].FramesDropped)
+			assert.Zero(t, stats[0].WriteErrors)
+
+			// Shards are forwarded without padding, in the order they are written to the file
+			forwarded := c.entries(t)
+			assert.ElementsMatch(t, want, forwarded)
+			if tee {
+				assert.Equal(t, readEntries(t, config.LogFilePath), forwarded)
+				_, _, bytesWritten, _, _, _, _, _ := logger.GetStatsSnapshot()
+				assert.Less(t, stats[0].BytesSent, bytesWritten)
+			} else {
+				_, err := os.Stat(config.LogFilePath)
+				assert.True(t, os.IsNotExist(err), "no file sink, nothing written to disk")
+			}
+		})
+	}
+}
+
+func TestSocketSink_CollectorOutage(t *testing.T) {
+	dir := t.TempDir()
+	socketPath := filepath.Join(dir, "collector.sock")
+	config := DefaultConfig(filepath.Join(dir, "app.log"))
+	config.BufferSize = 64 * 1024
+	config.NumShards = 1
+	config.Sinks = []SinkConfig{
+		{Network: SinkFile},
+		{Network: "unix", Address: socketPath, QueueSize: 2, MaxBackoff: 20 * time.Millisecond},
+	}
+
+	logger, err := New(config)
+	require.NoError(t, err)
+	defer logger.Close()
+
+	// No collector yet: flushes queue up, then are dropped, and the file gets all of them
+	for flush := 0; flush < 6; flush++ {
+		require.NoError(t, logger.TryLogBytes(fmt.Appendf(nil, "down-%d", flush)))
+		require.NoError(t, logger.Flush(t.Context()))
+	}
+	stats := logger.GetSinkStats()[0]
+	assert.False(t, stats.Connected)
+	assert.Positive(t, stats.WriteErrors)
+	assert.GreaterOrEqual(t, stats.FramesDropped, int64(3), "queue of 2 plus the flush being dialed")
+	_, _, _, _, flushErrors, _, _, _ := logger.GetStatsSnapshot()
+	assert.Zero(t, flushErrors)
+
+	// The sink connects once the collector is up and sends the queued flushes
+	c := startCollector(t, socketPath, true)
+	require.Eventually(t, func() bool {
+		return logger.GetSinkStats()[0].FramesSent == 6-stats.FramesDropped
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, logger.TryLogBytes([]byte("up")))
+	require.NoError(t, logger.Close())
+
+	forwarded := c.entries(t)
+	assert.Len(t, forwarded, int(6-stats.FramesDropped)+1)
+	assert.Equal(t, "up", forwarded[len(forwarded)-1])
+	assert.Len(t, readEntries(t, config.LogFilePath), 7)
+}
+
+func TestSocketSink_SlowCollectorDoesNotBlockFile(t *testing.T) {
+	dir := t.TempDir()
+	socketPath := filepath.Join(dir, "collector.sock")
+	startCollector(t, socketPath, false) // Accepts, never reads
+
+	config := DefaultConfig(filepath.Join(dir, "app.log"))
+	config.BufferSize = 256 * 1024
+	config.NumShards = 1
+	config.Sinks = []SinkConfig{
+		{Network: SinkFile},
+		{Network: "unix", Address: socketPath, QueueSize: 2, Timeout: 200 * time.Millisecond, CloseTimeout: 50 * time.Millisecond},
+	}
+	logger, err := New(config)
+	require.NoError(t, err)
+
+	msg := bytes.Repeat([]byte("x"), 1000)
+	const flushes = 40
+	for flush := 0; flush < flushes; flush++ {
+		for i := 0; i < 200; i++ {
+			require.NoError(t, logger.TryLogBytes(msg))
+		}
+		start := time.Now()
+		require.NoError(t, logger.Flush(t.Context()))
+		assert.Less(t, time.Since(start), 100*time.Millisecond, "flush %d waited for the collector", flush)
+	}
+	require.NoError(t, logger.Close(), "the file closes cleanly while the collector stalls")
+
+	stats := logger.GetSinkStats()[0]
+	assert.Positive(t, stats.FramesDropped)
+	assert.Equal(t, int64(flushes), stats.FramesSent+stats.FramesDropped)
+	assert.Len(t, readEntries(t, config.LogFilePath), flushes*200)
+}
+
+func TestConfig_Sinks(t *testing.T) {
+	for name, tc := range map[string]struct {
+		sinks []SinkConfig
+		want  string
+	}{
+		"UnknownNetwork":  {[]SinkConfig{{Network: "udp", Address: "x:1"}}, `Sinks: unknown network "udp" (use "file", "unix" or "tcp")`},
+		"MissingAddress":  {[]SinkConfig{{Network: "tcp"}}, "Sinks: tcp sink needs an address"},
+		"FileWithAddress": {[]SinkConfig{{Network: SinkFile, Address: "/tmp/x"}}, "Sinks: the file sink takes no address (it writes LogFilePath), got /tmp/x"},
+		"FileTwice":       {[]SinkConfig{{Network: SinkFile}, {Network: SinkFile}}, "Sinks contains file twice"},
+		"SameSocketTwice": {[]SinkConfig{{Network: "unix", Address: "/run/c.sock"}, {Network: "unix", Address: "/run/c.sock"}}, "Sinks contains unix:/run/c.sock twice"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			config := DefaultConfig("/tmp/sinks.log")
+			config.Sinks = tc.sinks
+			err := config.Validate()
+			require.Error(t, err)
+			assert.Equal(t, tc.want, err.Error())
+		})
+	}
+
+	config := DefaultConfig("/tmp/sinks.log")
+	config.Sinks = []SinkConfig{{Network: SinkFile}, {Network: "unix", Address: "/run/fluent-bit.sock"}}
+	require.NoError(t, config.Validate())
+	assert.Contains(t, config.Explain(), "sinks: file, unix:/run/fluent-bit.sock")
+}
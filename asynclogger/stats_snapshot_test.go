@@ -0,0 +1,158 @@
+package asynclogger
+
+import (
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checkStatsProgress asserts the invariants of s and that no counter went back since prev
+func checkStatsProgress(t *testing.T, prev, s StatsSnapshot) {
+	t.Helper()
+	assert.LessOrEqual(t, s.DroppedLogs, s.TotalLogs, "drops <= total")
+	for _, c := range []struct {
+		name       string
+		prev, curr int64
+	}{
+		{"TotalLogs", prev.TotalLogs, s.TotalLogs},
+		{"DroppedLogs", prev.DroppedLogs, s.DroppedLogs},
+		{"BytesWritten", prev.BytesWritten, s.BytesWritten},
+		{"Flushes", prev.Flushes, s.Flushes},
+		{"SetSwaps", prev.SetSwaps, s.SetSwaps},
+		{"BytesBuffered", prev.BytesBuffered, s.BytesBuffered},
+		{"BytesDurable", prev.BytesDurable, s.BytesDurable},
+	} {
+		assert.GreaterOrEqual(t, c.curr, c.prev, c.name)
+	}
+}
+
+func TestLogger_SnapshotStatsUnderLoad(t *testing.T) {
+	// Small buffers, no retry wait and a fake clock so only swaps flush; the first flush is held,
+	// so writers overflow the other set and drop before the snapshots start
+	config := DefaultConfig(filepath.Join(t.TempDir(), "snapshot.log"))
+	config.BufferSize = 64 * 1024
+	config.NumShards = 1
+	config.WriteRetryTimeout = 0
+	useFakeClock(&config)
+	logger, err := New(config)
+	require.NoError(t, err)
+	defer logger.Close()
+	slow := newSlowFileWriter(logger.fileWriter)
+	logger.fileWriter = slow
+	var release sync.Once
+	releaseFlush := func() { release.Do(func() { close(slow.release) }) }
+	defer releaseFlush()
+
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			msg := make([]byte, 512)
+			for !stop.Load() {
+				logger.LogBytes(msg)
+			}
+		}()
+	}
+
+	select {
+	case <-slow.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("flush worker did not start writing")
+	}
+	require.Eventually(t, func() bool { return logger.stats.DroppedLogs.Load() > 0 }, 5*time.Second, time.Millisecond)
+
+	// At least 100 snapshots, however the scheduler delays this goroutine; halfway through the
+	// held flush completes, so the rest also see flushes and swaps
+	var prev StatsSnapshot
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for i := 0; i < 100 || time.Now().Before(deadline); i++ {
+		if i == 50 {
+			releaseFlush()
+		}
+		s := logger.SnapshotStats()
+		checkStatsProgress(t, prev, s)
+		tl, dl, _, _, _, _, _, _ := logger.GetStatsSnapshot()
+		assert.LessOrEqual(t, dl, tl)
+		prev = s
+	}
+	stop.Store(true)
+	wg.Wait()
+	assert.Positive(t, prev.DroppedLogs, "the load should drop")
+
+	// At rest two collects agree at once
+	s := logger.SnapshotStats()
+	assert.True(t, s.Consistent)
+	checkStatsProgress(t, prev, s)
+	_, _, _, _, _, _, bytesBuffered, _ := logger.GetStatsSnapshot()
+	assert.Equal(t, bytesBuffered, s.BytesBuffered)
+}
+
+func TestLoggerManager_SnapshotStats(t *testing.T) {
+	config := DefaultConfig(filepath.Join(t.TempDir(), "base.log"))
+	config.BufferSize = 64 * 1024
+	config.NumShards = 1
+	config.WriteRetryTimeout = 0
+	lm, err := NewLoggerManager(config)
+	require.NoError(t, err)
+	defer lm.Close()
+
+	empty := lm.SnapshotStats()
+	assert.Empty(t, empty.Events)
+	assert.True(t, empty.Total.Consistent)
+
+	events := []string{"clicks", "orders", "views"}
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	for _, event := range events {
+		require.NoError(t, lm.TryLogBytesWithEvent(event, []byte("first")))
+		for g := 0; g < 3; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				msg := make([]byte, 700)
+				for !stop.Load() {
+					lm.LogBytesWithEvent(event, msg)
+				}
+			}()
+		}
+	}
+
+	var prev ManagerStats
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for i := 0; i < 100 || time.Now().Before(deadline); i++ {
+		stats := lm.SnapshotStats()
+		require.Len(t, stats.Events, len(events))
+		var sum StatsSnapshot
+		for _, event := range events {
+			s := stats.Events[event]
+			checkStatsProgress(t, prev.Events[event], s)
+			sum.TotalLogs += s.TotalLogs
+			sum.DroppedLogs += s.DroppedLogs
+		}
+		checkStatsProgress(t, prev.Total, stats.Total)
+		assert.Equal(t, sum.TotalLogs, stats.Total.TotalLogs)
+		assert.Equal(t, sum.DroppedLogs, stats.Total.DroppedLogs)
+		prev = stats
+	}
+	stop.Store(true)
+	wg.Wait()
+
+	// At rest the snapshot is exact and matches the per-event getters
+	stats := lm.SnapshotStats()
+	assert.True(t, stats.Total.Consistent)
+	for _, event := range events {
+		totalLogs, droppedLogs, _, _, _, _, _, _, err := lm.GetEventStats(event)
+		require.NoError(t, err)
+		assert.Equal(t, totalLogs, stats.Events[event].TotalLogs, event)
+		assert.Equal(t, droppedLogs, stats.Events[event].DroppedLogs, event)
+	}
+	totalLogs, _, _, _, _, _, _, _ := lm.GetStatsSnapshot()
+	assert.Equal(t, totalLogs, stats.Total.TotalLogs)
+}
@@ -0,0 +1,242 @@
+package asynclogger
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/internal/logcore"
+)
+
+// StripedFileWriter spreads the shard buffers of each flush across several files (Config.StripeFiles),
+// e.g. one per NVMe device, and writes them concurrently: the i-th shard buffer of a flush goes to
+// stripe i%N, so shard i lands on stripe i%N whenever every shard has data. Each stripe is a
+// DirectFileWriter with its own offset, rotation, journal and preallocation, and every stripe file is
+// a complete log file on its own; read them together with reader.OpenStripes
+type StripedFileWriter struct {
+	stripes []*stripe
+
+	// Last write duration: the slowest stripe of the last flush, as the stripes write in parallel
+	lastPwritevDuration atomic.Int64 // Nanoseconds
+}
+
+// stripe is one file of a StripedFileWriter and its statistics
+type stripe struct {
+	path   string
+	writer FileWriter
+
+	// buffers is the part of the current flush for this stripe (reused; the flush path is serialized)
+	buffers [][]byte
+
+	bytesWritten    atomic.Int64
+	writes          atomic.Int64
+	errors          atomic.Int64
+	totalPwritevNs  atomic.Int64
+	maxPwritevNs    atomic.Int64
+	lastPwritevNs   atomic.Int64
+	lastWriteResult writeResult // Written by the stripe's goroutine, read after the flush waits for it
+}
+
+// writeResult is the outcome of one stripe's part of a flush
+type writeResult struct {
+	n   int
+	err error
+}
+
+// StripeStats reports the writes of one stripe (see Logger.GetStripeStats)
+// Compare BytesWritten and AvgPwritevDuration across stripes to spot an imbalanced or slow device
+type StripeStats struct {
+	Path                string
+	BytesWritten        int64 // Bytes written to this stripe's files
+	Writes              int64 // Flushes that wrote to this stripe
+	WriteErrors         int64 // Flushes whose write to this stripe failed
+	AvgPwritevDuration  time.Duration
+	MaxPwritevDuration  time.Duration
+	LastPwritevDuration time.Duration
+}
+
+var _ FileWriter = (*StripedFileWriter)(nil)
+
+// NewStripedFileWriter creates a DirectFileWriter for each of config.StripeFiles (config.LogFilePath
+// is not written). Validate config first
+func NewStripedFileWriter(config Config) (*StripedFileWriter, error) {
+	if len(config.StripeFiles) < 2 {
+		return nil, fmt.Errorf("striping needs at least 2 StripeFiles, got %d", len(config.StripeFiles))
+	}
+
+	w := &StripedFileWriter{}
+	for _, path := range config.StripeFiles {
+		stripeConfig := config
+		stripeConfig.LogFilePath = path
+		fw, err := NewFileWriter(stripeConfig)
+		if err != nil {
+			w.Close()
+			return nil, fmt.Errorf("failed to open stripe %s: %w", path, err)
+		}
+		w.stripes = append(w.stripes, &stripe{path: path, writer: fw})
+	}
+	return w, nil
+}
+
+// newFileWriter creates the file writer New uses for config: the log file tee'd to Config.Sinks
+// (see newSinkWriter), or just the log file
+func newFileWriter(config Config) (FileWriter, error) {
+	if len(config.Sinks) > 0 {
+		return newSinkWriter(config)
+	}
+	return newLogFileWriter(config)
+}
+
+// newLogFileWriter creates the log file writer: a StripedFileWriter with StripeFiles, a
+// DirectFileWriter otherwise
+func newLogFileWriter(config Config) (FileWriter, error) {
+	if len(config.StripeFiles) > 0 {
+		return NewStripedFileWriter(config)
+	}
+	return NewFileWriter(config)
+}
+
+// stripePaths returns the stripe files of the event logger named name: its file name in the directory
+// of each base stripe path (LoggerManager), so event loggers keep their stripes on the same devices
+func stripePaths(stripes []string, name string) []string {
+	if len(stripes) == 0 {
+		return nil
+	}
+	paths := make([]string, len(stripes))
+	for i, path := range stripes {
+		paths[i] = filepath.Join(filepath.Dir(path), name+".log")
+	}
+	return paths
+}
+
+// WriteVectored hands buffer i to stripe i%N and writes the stripes concurrently
+// Returns the bytes written by all stripes and the first stripe error; a failed stripe leaves the
+// flush incomplete (n below the total), which the flush path counts as a flush error
+func (w *StripedFileWriter) WriteVectored(buffers [][]byte) (int, error) {
+	if len(buffers) == 0 {
+		return 0, nil
+	}
+
+	for _, s := range w.stripes {
+		s.buffers = s.buffers[:0]
+	}
+	for i, buf := range buffers {
+		s := w.stripes[i%len(w.stripes)]
+		s.buffers = append(s.buffers, buf)
+	}
+
+	var wg sync.WaitGroup
+	for _, s := range w.stripes {
+		if len(s.buffers) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(s *stripe) {
+			defer wg.Done()
+			s.write()
+		}(s)
+	}
+	wg.Wait()
+
+	written := 0
+	var firstErr error
+	var slowest time.Duration
+	for _, s := range w.stripes {
+		if len(s.buffers) == 0 {
+			continue
+		}
+		written += s.lastWriteResult.n
+		if s.lastWriteResult.err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("stripe %s: %w", s.path, s.lastWriteResult.err)
+		}
+		if d := time.Duration(s.lastPwritevNs.Load()); d > slowest {
+			slowest = d
+		}
+	}
+	w.lastPwritevDuration.Store(slowest.Nanoseconds())
+	return written, firstErr
+}
+
+// write writes the stripe's part of the current flush and records its statistics
+func (s *stripe) write() {
+	n, err := s.writer.WriteVectored(s.buffers)
+	s.lastWriteResult = writeResult{n: n, err: err}
+
+	s.writes.Add(1)
+	s.bytesWritten.Add(int64(n))
+	if err != nil {
+		s.errors.Add(1)
+	}
+	d := s.writer.GetLastPwritevDuration().Nanoseconds()
+	s.lastPwritevNs.Store(d)
+	s.totalPwritevNs.Add(d)
+	logcore.StoreMax(&s.maxPwritevNs, d)
+}
+
+// GetLastPwritevDuration returns the write syscall duration of the slowest stripe of the last flush
+func (w *StripedFileWriter) GetLastPwritevDuration() time.Duration {
+	return time.Duration(w.lastPwritevDuration.Load())
+}
+
+// Close syncs and closes every stripe, returning the first error
+func (w *StripedFileWriter) Close() error {
+	var firstErr error
+	for _, s := range w.stripes {
+		if err := s.writer.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("stripe %s: %w", s.path, err)
+		}
+	}
+	return firstErr
+}
+
+// Stats returns the statistics of each stripe, in StripeFiles order
+func (w *StripedFileWriter) Stats() []StripeStats {
+	stats := make([]StripeStats, len(w.stripes))
+	for i, s := range w.stripes {
+		writes := s.writes.Load()
+		stats[i] = StripeStats{
+			Path:                s.path,
+			BytesWritten:        s.bytesWritten.Load(),
+			Writes:              writes,
+			WriteErrors:         s.errors.Load(),
+			MaxPwritevDuration:  time.Duration(s.maxPwritevNs.Load()),
+			LastPwritevDuration: time.Duration(s.lastPwritevNs.Load()),
+		}
+		if writes > 0 {
+			stats[i].AvgPwritevDuration = time.Duration(s.totalPwritevNs.Load() / writes)
+		}
+	}
+	return stats
+}
+
+// warmup primes every stripe for its share of a flush (Logger.Warmup); the timings are summed
+func (w *StripedFileWriter) warmup(size int64) (prime, preallocate time.Duration, err error) {
+	share := (size + int64(len(w.stripes)) - 1) / int64(len(w.stripes))
+	for _, s := range w.stripes {
+		warmer, ok := s.writer.(fileWarmer)
+		if !ok {
+			continue
+		}
+		p, a, err := warmer.warmup(share)
+		prime += p
+		preallocate += a
+		if err != nil {
+			return prime, preallocate, fmt.Errorf("stripe %s: %w", s.path, err)
+		}
+	}
+	return prime, preallocate, nil
+}
+
+// GetStripeStats returns per-stripe write statistics with Config.StripeFiles, and nil otherwise
+func (l *Logger) GetStripeStats() []StripeStats {
+	w := l.fileWriter
+	if t, ok := w.(*TeeWriter); ok {
+		w = t.FileWriter
+	}
+	if w, ok := w.(*StripedFileWriter); ok {
+		return w.Stats()
+	}
+	return nil
+}
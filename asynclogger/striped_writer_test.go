@@ -0,0 +1,209 @@
+package asynclogger
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stripeDirs returns n stripe paths in separate directories, standing in for separate devices
+func stripeDirs(t *testing.T, n int, name string) []string {
+	t.Helper()
+	paths := make([]string, n)
+	for i := range paths {
+		dir := filepath.Join(t.TempDir(), fmt.Sprintf("disk%d", i))
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		paths[i] = filepath.Join(dir, name)
+	}
+	return paths
+}
+
+// readStripes returns the entries of a striped logger's files sorted by sequence number
+func readStripes(t *testing.T, stripes []string) []string {
+	t.Helper()
+	r, err := reader.OpenStripes(stripes, reader.Options{SequenceNumbers: true})
+	require.NoError(t, err)
+	defer r.Close()
+
+	type entry struct {
+		seq uint64
+		msg string
+	}
+	var entries []entry
+	for {
+		data, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		entries = append(entries, entry{seq: r.Sequence(), msg: string(data)})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+	msgs := make([]string, len(entries))
+	for i, e := range entries {
+		msgs[i] = e.msg
+	}
+	return msgs
+}
+
+func TestLogger_StripeFiles(t *testing.T) {
+	stripes := stripeDirs(t, 3, "app.log")
+	config := DefaultConfig(filepath.Join(t.TempDir(), "app.log"))
+	config.StripeFiles = stripes
+	config.BufferSize = 6 * 64 * 1024
+	config.NumShards = 6
+	config.FlushInterval = time.Hour
+	config.SequenceNumbers = true
+
+	logger, err := New(config)
+	require.NoError(t, err)
+
+	const total = 20000
+	var want []string
+	for i := 0; i < total; i++ {
+		msg := fmt.Sprintf("entry-%05d", i)
+		require.NoError(t, logger.TryLogBytes([]byte(msg)))
+		want = append(want, msg)
+	}
+	require.NoError(t, logger.Close())
+
+	// Every entry is in exactly one stripe, and sequence numbers restore the write order
+	assert.Equal(t, want, readStripes(t, stripes))
+	_, err = os.Stat(config.LogFilePath)
+	assert.True(t, os.IsNotExist(err), "LogFilePath is not written")
+
+	stats := logger.GetStripeStats()
+	require.Len(t, stats, 3)
+	_, _, bytesWritten, _, _, _, _, _ := logger.GetStatsSnapshot()
+	var stripeBytes int64
+	for i, s := range stats {
+		assert.Equal(t, stripes[i], s.Path)
+		assert.Positive(t, s.BytesWritten, "shards are spread over every stripe")
+		assert.Positive(t, s.Writes)
+		assert.Zero(t, s.WriteErrors)
+		assert.GreaterOrEqual(t, s.MaxPwritevDuration, s.AvgPwritevDuration)
+		info, err := os.Stat(s.Path)
+		require.NoError(t, err)
+		assert.Equal(t, s.BytesWritten, info.Size())
+		stripeBytes += s.BytesWritten
+	}
+	assert.Equal(t, bytesWritten, stripeBytes)
+}
+
+func TestLogger_StripeFilesRotation(t *testing.T) {
+	stripes := stripeDirs(t, 2, "app.log")
+	config := DefaultConfig(filepath.Join(t.TempDir(), "app.log"))
+	config.StripeFiles = stripes
+	config.BufferSize = 4 * 64 * 1024
+	config.NumShards = 4
+	config.MaxFileSize = 3 * 64 * 1024 // Room for one flush's two shards per stripe, not two flushes
+	config.SequenceNumbers = true
+
+	logger, err := New(config)
+	require.NoError(t, err)
+	var want []string
+	for flush := 0; flush < 3; flush++ {
+		for i := 0; i < 400; i++ {
+			msg := fmt.Sprintf("flush-%d-%03d", flush, i)
+			require.NoError(t, logger.TryLogBytes([]byte(msg)))
+			want = append(want, msg)
+		}
+		require.NoError(t, logger.Flush(t.Context()))
+	}
+	require.NoError(t, logger.Close())
+
+	// Each stripe takes two shards per flush and rotates on its own
+	for _, stripe := range stripes {
+		files, err := reader.RotatedFiles(stripe)
+		require.NoError(t, err)
+		assert.Len(t, files, 3, "stripe %s", stripe)
+	}
+	assert.Equal(t, want, readStripes(t, stripes))
+}
+
+func TestStripedFileWriter_StripeError(t *testing.T) {
+	dir := t.TempDir()
+	newStripe := func(name string) *stripe {
+		config := DefaultConfig(filepath.Join(dir, name))
+		config.IOMode = IOModeBuffered
+		fw, err := NewFileWriter(config)
+		require.NoError(t, err)
+		return &stripe{path: config.LogFilePath, writer: &errorWriter{FileWriter: fw}}
+	}
+	w := &StripedFileWriter{stripes: []*stripe{newStripe("a.log"), newStripe("b.log")}}
+	defer w.Close()
+
+	buffers := [][]byte{make([]byte, 4096), make([]byte, 4096), make([]byte, 4096)}
+	n, err := w.WriteVectored(buffers)
+	require.NoError(t, err)
+	assert.Equal(t, 3*4096, n)
+
+	w.stripes[1].writer.(*errorWriter).setErr(errors.New("device gone"))
+	n, err = w.WriteVectored(buffers)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "b.log")
+	assert.Equal(t, 2*4096, n, "the healthy stripe's buffers are written")
+
+	stats := w.Stats()
+	assert.Equal(t, int64(4*4096), stats[0].BytesWritten)
+	assert.Equal(t, int64(2), stats[0].Writes)
+	assert.Equal(t, int64(4096), stats[1].BytesWritten)
+	assert.Equal(t, int64(1), stats[1].WriteErrors)
+}
+
+func TestConfig_StripeFiles(t *testing.T) {
+	for name, tc := range map[string]struct {
+		stripes []string
+		want    string
+	}{
+		"OnePath":   {stripes: []string{"/a/x.log"}, want: "StripeFiles needs at least 2 paths"},
+		"EmptyPath": {stripes: []string{"/a/x.log", ""}, want: "StripeFiles contains an empty path"},
+		"Duplicate": {stripes: []string{"/a/x.log", "/a/../a/x.log"}, want: "StripeFiles contains /a/../a/x.log twice"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			config := DefaultConfig("/tmp/stripes.log")
+			config.StripeFiles = tc.stripes
+			err := config.Validate()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.want)
+		})
+	}
+
+	config := DefaultConfig("/tmp/stripes.log")
+	config.StripeFiles = []string{"/disk0/x.log", "/disk1/x.log", "/disk2/x.log"}
+	assert.Contains(t, config.Explain(), "stripes: 3 files, 3 shards each per full flush")
+}
+
+func TestLoggerManager_StripeFiles(t *testing.T) {
+	stripes := stripeDirs(t, 2, "base.log")
+	config := DefaultConfig(filepath.Join(t.TempDir(), "base.log"))
+	config.StripeFiles = stripes
+	config.BufferSize = 2 * 64 * 1024
+	config.NumShards = 2
+
+	lm, err := NewLoggerManager(config)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, lm.TryLogBytesWithEvent("payments", []byte("payment")))
+		require.NoError(t, lm.TryLogBytesWithEvent("search", []byte("query")))
+	}
+	require.NoError(t, lm.Close())
+
+	// Each event stripes its own file across the stripe directories
+	for _, event := range []string{"payments", "search"} {
+		for _, stripe := range stripes {
+			info, err := os.Stat(filepath.Join(filepath.Dir(stripe), event+".log"))
+			require.NoError(t, err)
+			assert.Positive(t, info.Size())
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package testsupport
+
+import (
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/clock"
+)
+
+// FakeClock is a clock.Fake: set it as Config.Clock, then Advance it to fire the logger's flush
+// ticker, rotation interval and timeouts instead of sleeping. The logger creates its flush ticker
+// in New and other timers on its own goroutines, so call BlockUntil before advancing past a timer
+// that may not exist yet (see clock.Fake)
+type FakeClock = clock.Fake
+
+// NewFakeClock returns a FakeClock reading start
+func NewFakeClock(start time.Time) *FakeClock {
+	return clock.NewFake(start)
+}
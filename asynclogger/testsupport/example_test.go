@@ -0,0 +1,80 @@
+package testsupport_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger"
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/testsupport"
+)
+
+// handlePayment stands in for application code that logs through an injected logger
+func handlePayment(logger *asynclogger.Logger, amount int) {
+	logger.Log(fmt.Sprintf("payment amount=%d", amount))
+	if amount > 1000 {
+		logger.Log("payment flagged for review")
+	}
+}
+
+// A test asserts exactly what a handler logged, without reading log files
+func ExampleWriter() {
+	config := asynclogger.DefaultConfig("payments.log") // Validated, never written
+	config.BufferSize = 64 * 1024
+	config.NumShards = 1 // One shard keeps entries in logging order
+
+	w := testsupport.NewWriter()
+	logger, err := asynclogger.NewWithWriter(config, w)
+	if err != nil {
+		panic(err)
+	}
+	defer logger.Close()
+
+	handlePayment(logger, 2500)
+
+	// Entries become visible once flushed
+	if err := logger.Flush(context.Background()); err != nil {
+		panic(err)
+	}
+	entries, err := w.Strings()
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		fmt.Println(entry)
+	}
+	// Output:
+	// payment amount=2500
+	// payment flagged for review
+}
+
+// A test triggers the periodic flush by advancing a fake clock instead of sleeping through FlushInterval
+func ExampleFakeClock() {
+	config := asynclogger.DefaultConfig("payments.log")
+	config.BufferSize = 64 * 1024
+	config.NumShards = 1
+	config.FlushInterval = time.Minute
+	fake := testsupport.NewFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	config.Clock = fake
+
+	w := testsupport.NewWriter()
+	logger, err := asynclogger.NewWithWriter(config, w)
+	if err != nil {
+		panic(err)
+	}
+	defer logger.Close()
+	flushed := make(chan struct{}, 1)
+	logger.SetFlushObserver(func(asynclogger.FlushObservation) { flushed <- struct{}{} })
+
+	handlePayment(logger, 10)
+	fake.Advance(config.FlushInterval) // The flush ticker was created by NewWithWriter
+	<-flushed
+
+	entries, err := w.Strings()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(entries)
+	// Output:
+	// [payment amount=10]
+}
@@ -0,0 +1,124 @@
+package testsupport
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger"
+)
+
+var _ asynclogger.FileWriter = (*FaultyFileWriter)(nil)
+
+// FaultyFileWriter is a Writer whose calls fail, stall or stop short as scripted, to drive a logger's
+// flush error paths deterministically. WriteVectored calls are numbered from 1 (one per flush);
+// calls without a fault are recorded like Writer. Script the faults before handing the writer
+// to asynclogger.NewWithWriter:
+//
+//	w := testsupport.NewFaultyFileWriter().FailWrite(1, syscall.EIO).DelayWrite(2, time.Second)
+type FaultyFileWriter struct {
+	*Writer
+
+	mu       sync.Mutex
+	faults   map[int]*writeFault
+	calls    int
+	closeErr error
+}
+
+// writeFault is the scripted outcome of one WriteVectored call
+type writeFault struct {
+	delay    time.Duration // Sleep before the call returns
+	err      error         // Returned without recording anything
+	rotation bool          // err is returned as a failed rotation
+	short    int           // Bytes recorded and reported (no error); -1 writes everything
+}
+
+// NewFaultyFileWriter creates a FaultyFileWriter with no faults scripted
+func NewFaultyFileWriter() *FaultyFileWriter {
+	return &FaultyFileWriter{Writer: NewWriter(), faults: make(map[int]*writeFault)}
+}
+
+// fault returns the fault of WriteVectored call n, creating it
+func (w *FaultyFileWriter) fault(n int) *writeFault {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	f := w.faults[n]
+	if f == nil {
+		f = &writeFault{short: -1}
+		w.faults[n] = f
+	}
+	return f
+}
+
+// FailWrite makes WriteVectored call n return err, writing nothing
+func (w *FaultyFileWriter) FailWrite(n int, err error) *FaultyFileWriter {
+	w.fault(n).err = err
+	return w
+}
+
+// FailRotation makes WriteVectored call n fail like a rotation that could not open the next file:
+// nothing is written and the error wraps err as the file writers do ("rotation failed: ...")
+func (w *FaultyFileWriter) FailRotation(n int, err error) *FaultyFileWriter {
+	f := w.fault(n)
+	f.err = err
+	f.rotation = true
+	return w
+}
+
+// DelayWrite makes WriteVectored call n take at least d, e.g. a stalled disk
+// It combines with the other faults of the call, which apply after the delay
+func (w *FaultyFileWriter) DelayWrite(n int, d time.Duration) *FaultyFileWriter {
+	w.fault(n).delay = d
+	return w
+}
+
+// ShortWrite makes WriteVectored call n record only the first bytes of its buffers and report that
+// count without an error, like a writer that stops early
+func (w *FaultyFileWriter) ShortWrite(n int, bytes int) *FaultyFileWriter {
+	w.fault(n).short = bytes
+	return w
+}
+
+// FailClose makes Close return err; the writer is closed all the same
+func (w *FaultyFileWriter) FailClose(err error) *FaultyFileWriter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closeErr = err
+	return w
+}
+
+// WriteVectored applies the fault scripted for this call, if any
+func (w *FaultyFileWriter) WriteVectored(buffers [][]byte) (int, error) {
+	w.mu.Lock()
+	w.calls++
+	f := w.faults[w.calls]
+	w.mu.Unlock()
+	if f == nil {
+		return w.Writer.WriteVectored(buffers)
+	}
+
+	time.Sleep(f.delay)
+	switch {
+	case f.rotation:
+		return 0, fmt.Errorf("rotation failed: %w", f.err)
+	case f.err != nil:
+		return 0, f.err
+	}
+	return w.record(buffers, f.short)
+}
+
+// Close closes the Writer and returns the error scripted with FailClose
+func (w *FaultyFileWriter) Close() error {
+	_ = w.Writer.Close()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closeErr
+}
+
+// Calls returns the number of WriteVectored calls, including failed ones
+// Writer.Writes counts only the calls that recorded data
+func (w *FaultyFileWriter) Calls() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.calls
+}
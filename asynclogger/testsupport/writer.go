@@ -0,0 +1,138 @@
+// Package testsupport helps application tests observe what they logged through asynclogger
+//
+// Writer is an in-memory asynclogger.FileWriter: a logger created with asynclogger.NewWithWriter
+// flushes into it instead of files, and Entries decodes what was flushed, so a test can assert
+// that a handler logged exactly the expected entries without touching the filesystem. FakeClock
+// stands in for the wall clock, so flush intervals, rotation and timeouts can be triggered at once.
+package testsupport
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger"
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/reader"
+)
+
+var _ asynclogger.FileWriter = (*Writer)(nil)
+
+// Writer records the shard buffers a logger flushes, in flush order
+// Entries are visible once flushed: call Logger.Flush or Logger.Close before reading them
+type Writer struct {
+	mu     sync.Mutex
+	data   []byte // Every write, concatenated as the file would hold it
+	writes int    // WriteVectored calls
+	closed bool
+}
+
+// NewWriter creates an empty Writer
+func NewWriter() *Writer {
+	return &Writer{}
+}
+
+// WriteVectored copies buffers, which the logger reuses once the call returns
+func (w *Writer) WriteVectored(buffers [][]byte) (int, error) {
+	return w.record(buffers, -1)
+}
+
+// record copies up to limit bytes of buffers (all of them if limit < 0) and returns the bytes copied
+func (w *Writer) record(buffers [][]byte, limit int) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, errors.New("testsupport: write to closed Writer")
+	}
+	n := 0
+	for _, buf := range buffers {
+		if limit >= 0 && n+len(buf) > limit {
+			buf = buf[:limit-n]
+		}
+		w.data = append(w.data, buf...)
+		n += len(buf)
+	}
+	w.writes++
+	return n, nil
+}
+
+// GetLastPwritevDuration returns 0: the Writer makes no syscalls
+func (w *Writer) GetLastPwritevDuration() time.Duration {
+	return 0
+}
+
+// Close marks the Writer closed; recorded data stays readable
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	return nil
+}
+
+// Closed reports whether the logger has closed the Writer
+func (w *Writer) Closed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closed
+}
+
+// Writes returns the number of WriteVectored calls (one per flush)
+func (w *Writer) Writes() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.writes
+}
+
+// Bytes returns a copy of everything written, in the log file format
+func (w *Writer) Bytes() []byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return bytes.Clone(w.data)
+}
+
+// Reset discards the recorded data, e.g. between the steps of a test
+func (w *Writer) Reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.data = nil
+	w.writes = 0
+}
+
+// Reader returns a format reader over the data written so far
+// Set opts.Timestamp to match the logger's Config.PrependTimestamp
+func (w *Writer) Reader(opts reader.Options) *reader.LogReader {
+	return reader.NewLogReader(bytes.NewReader(w.Bytes()), opts)
+}
+
+// Entries decodes the entries written so far, in flush order
+// Entries from different shards interleave in the order their shards were flushed
+func (w *Writer) Entries() ([][]byte, error) {
+	return w.EntriesWith(reader.Options{})
+}
+
+// EntriesWith is Entries with reader options (e.g. to strip PrependTimestamp timestamps)
+func (w *Writer) EntriesWith(opts reader.Options) ([][]byte, error) {
+	r := w.Reader(opts)
+	var entries [][]byte
+	for {
+		entry, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, bytes.Clone(entry))
+	}
+}
+
+// Strings is Entries with each entry converted to a string
+func (w *Writer) Strings() ([]string, error) {
+	entries, err := w.Entries()
+	strs := make([]string, len(entries))
+	for i, entry := range entries {
+		strs[i] = string(entry)
+	}
+	return strs, err
+}
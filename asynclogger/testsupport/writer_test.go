@@ -0,0 +1,98 @@
+package testsupport
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger"
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLogger(t *testing.T, configure func(*asynclogger.Config)) (*asynclogger.Logger, *Writer, string) {
+	t.Helper()
+	dir := t.TempDir()
+	config := asynclogger.DefaultConfig(filepath.Join(dir, "app.log"))
+	config.BufferSize = 64 * 1024
+	config.NumShards = 1
+	if configure != nil {
+		configure(&config)
+	}
+	w := NewWriter()
+	logger, err := asynclogger.NewWithWriter(config, w)
+	require.NoError(t, err)
+	return logger, w, dir
+}
+
+func TestWriter(t *testing.T) {
+	t.Run("entries are visible after flush", func(t *testing.T) {
+		logger, w, dir := newTestLogger(t, nil)
+
+		require.NoError(t, logger.TryLogBytes([]byte("first")))
+		logger.Log("second")
+		entries, err := w.Strings()
+		require.NoError(t, err)
+		assert.Empty(t, entries, "nothing is visible before a flush")
+
+		require.NoError(t, logger.Flush(context.Background()))
+		entries, err = w.Strings()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"first", "second"}, entries)
+		assert.Positive(t, w.Writes())
+
+		require.NoError(t, logger.LogEntry(func(buf *asynclogger.EntryBuffer) { buf.AppendString("third") }))
+		require.NoError(t, logger.Close())
+		assert.True(t, w.Closed())
+		entries, err = w.Strings()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"first", "second", "third"}, entries)
+
+		files, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, files, "the logger must not create files")
+	})
+
+	t.Run("timestamps are stripped with reader options", func(t *testing.T) {
+		logger, w, _ := newTestLogger(t, func(c *asynclogger.Config) {
+			c.PrependTimestamp = asynclogger.TimestampUnixNano
+		})
+		before := time.Now()
+		logger.Log("stamped")
+		require.NoError(t, logger.Close())
+
+		opts := reader.Options{Timestamp: reader.TimestampUnixNano}
+		entries, err := w.EntriesWith(opts)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "stamped", string(entries[0]))
+
+		r := w.Reader(opts)
+		_, err = r.Next()
+		require.NoError(t, err)
+		assert.False(t, r.Timestamp().Before(before))
+	})
+
+	t.Run("reset discards recorded data", func(t *testing.T) {
+		logger, w, _ := newTestLogger(t, nil)
+		defer logger.Close()
+
+		logger.Log("before")
+		require.NoError(t, logger.Flush(context.Background()))
+		w.Reset()
+		logger.Log("after")
+		require.NoError(t, logger.Flush(context.Background()))
+
+		entries, err := w.Strings()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"after"}, entries)
+	})
+
+	t.Run("nil writer is rejected", func(t *testing.T) {
+		_, err := asynclogger.NewWithWriter(asynclogger.DefaultConfig("app.log"), nil)
+		assert.Error(t, err)
+	})
+}
@@ -76,7 +76,7 @@ func TestFlushTimeout_IncompleteEntryInMiddle(t *testing.T) {
 	// Trigger flush while Entry 2 is still copying (should timeout)
 	activeSet := logger.activeSet.Load()
 	if activeSet != nil && activeSet.HasData() {
-		logger.trySwap()
+		logger.trySwap(FlushTriggerThreshold)
 	}
 
 	// Wait for flush to complete (should timeout waiting for Entry 2)
@@ -117,6 +117,10 @@ func verifyRecovery(t *testing.T, data []byte, logFile string) {
 
 		capacity := binary.LittleEndian.Uint32(data[offset : offset+4])
 		validDataBytes := binary.LittleEndian.Uint32(data[offset+4 : offset+8])
+		if capacity < 8 {
+			t.Logf("Invalid shard capacity %d at offset %d", capacity, offset)
+			break
+		}
 
 		// Safety check
 		remainingBytes := len(data) - offset - 8
@@ -124,6 +128,7 @@ func verifyRecovery(t *testing.T, data []byte, logFile string) {
 			validDataBytes = uint32(remainingBytes)
 		}
 
+		shardStart := offset
 		offset += 8
 		shardEnd := offset + int(validDataBytes)
 		if shardEnd > len(data) {
@@ -179,16 +184,8 @@ func verifyRecovery(t *testing.T, data []byte, logFile string) {
 			t.Logf("Entry %d: %d bytes - %q", completeEntries, entryLength, entryStr)
 		}
 
-		// Move to next shard
-		nextShardStart := offset + int(capacity)
-		if nextShardStart > len(data) {
-			break
-		}
-		alignedOffset := ((nextShardStart + 511) / 512) * 512
-		if alignedOffset > len(data) {
-			break
-		}
-		offset = alignedOffset
+		// Move to next shard: the header's capacity is the size written, header included
+		offset = shardStart + int(capacity)
 		shardNum++
 	}
 
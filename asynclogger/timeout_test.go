@@ -75,7 +75,7 @@ func TestFlushTimeout_SimulateSlowWrites(t *testing.T) {
 	// The slow write is still copying data, so GetData() should timeout
 	activeSet := logger.activeSet.Load()
 	if activeSet != nil && activeSet.HasData() {
-		logger.trySwap()
+		logger.trySwap(FlushTriggerThreshold)
 	}
 
 	// Wait for flush to complete (should timeout waiting for slow write)
@@ -0,0 +1,121 @@
+package asynclogger
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger_PrependTimestamp(t *testing.T) {
+	for _, format := range []TimestampFormat{TimestampUnixNano, TimestampRFC3339} {
+		t.Run(string(format), func(t *testing.T) {
+			logPath := filepath.Join(t.TempDir(), "ts.log")
+			config := DefaultConfig(logPath)
+			config.BufferSize = 256 * 1024
+			config.NumShards = 4
+			config.DropPolicy = DropPolicyBlock
+			config.FlushTimeout = 100 * time.Millisecond
+			config.PrependTimestamp = format
+
+			logger, err := New(config)
+			require.NoError(t, err)
+
+			const goroutines = 8
+			const perGoroutine = 2000
+			before := time.Now()
+			var wg sync.WaitGroup
+			for g := 0; g < goroutines; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < perGoroutine; i++ {
+						var err error
+						if i%2 == 0 {
+							err = logger.TryLogBytes([]byte(fmt.Sprintf("%d:%d", g, i)))
+						} else {
+							err = logger.LogEntry(func(buf *EntryBuffer) {
+								buf.AppendString(fmt.Sprintf("%d:%d", g, i))
+							})
+						}
+						if err != nil {
+							t.Error(err)
+							return
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+			require.NoError(t, logger.Close())
+			after := time.Now()
+
+			r, err := reader.Open(logPath, reader.Options{Timestamp: format})
+			require.NoError(t, err)
+			defer r.Close()
+
+			// Shards flush out of order, but within one shard timestamps follow buffer order
+			lastInShard := make(map[int64]time.Time)
+			var payloads []string
+			for {
+				entry, err := r.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				require.NoError(t, err)
+				payloads = append(payloads, string(entry))
+
+				ts := r.Timestamp()
+				assert.False(t, ts.Before(before), "timestamp %v before the writes started", ts)
+				assert.False(t, ts.After(after), "timestamp %v after the writes ended", ts)
+				shard := r.Shard().Offset
+				assert.False(t, ts.Before(lastInShard[shard]), "timestamp went backwards in shard at %d", shard)
+				lastInShard[shard] = ts
+			}
+			assert.Greater(t, len(lastInShard), 4, "expected several flushed shards")
+
+			require.Len(t, payloads, goroutines*perGoroutine)
+			sort.Strings(payloads)
+			for i := 1; i < len(payloads); i++ {
+				assert.NotEqual(t, payloads[i-1], payloads[i])
+			}
+		})
+	}
+
+	t.Run("legacy readers see timestamp and payload", func(t *testing.T) {
+		logPath := filepath.Join(t.TempDir(), "ts.log")
+		config := DefaultConfig(logPath)
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 1
+		config.PrependTimestamp = TimestampRFC3339
+
+		logger, err := New(config)
+		require.NoError(t, err)
+		require.NoError(t, logger.TryLogBytes([]byte("first")))
+		require.NoError(t, logger.LogEntry(func(buf *EntryBuffer) { buf.AppendString("second") }))
+		require.NoError(t, logger.Close())
+
+		entries := readEntries(t, logPath)
+		require.Len(t, entries, 2)
+		for i, payload := range []string{"first", "second"} {
+			assert.Len(t, entries[i], TimestampRFC3339.Size()+len(payload))
+			assert.True(t, strings.HasSuffix(entries[i], "Z "+payload), "entry %q", entries[i])
+			_, err := time.Parse(reader.TimestampLayout, entries[i][:TimestampRFC3339.Size()-1])
+			assert.NoError(t, err)
+		}
+	})
+
+	t.Run("unknown format is rejected", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "ts.log"))
+		config.PrependTimestamp = "iso8601"
+		assert.Error(t, config.Validate())
+	})
+}
@@ -0,0 +1,91 @@
+package asynclogger
+
+import (
+	"context"
+	"sync"
+)
+
+// transformScratchSize is the capacity of a new transform scratch buffer; larger payloads grow it
+const transformScratchSize = 4096
+
+// transformScratch recycles the scratch buffers passed to Config.Transform, so transforming a
+// payload allocates nothing once the pool holds buffers as large as the payloads
+var transformScratch = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, transformScratchSize)
+		return &buf
+	},
+}
+
+// getTransformScratch returns a pooled buffer with room for at least n bytes
+func getTransformScratch(n int) *[]byte {
+	scratch := transformScratch.Get().(*[]byte)
+	if cap(*scratch) < n {
+		*scratch = make([]byte, 0, n)
+	}
+	return scratch
+}
+
+// layerTransforms returns a TransformFunc running outer on the result of inner; either may be nil
+func layerTransforms(inner, outer TransformFunc) TransformFunc {
+	if inner == nil {
+		return outer
+	}
+	if outer == nil {
+		return inner
+	}
+	return func(event string, in []byte, scratch []byte) []byte {
+		mid := inner(event, in, scratch)
+		if mid == nil {
+			return nil
+		}
+		// mid may be in scratch, so outer writes to a second buffer, copied back for the caller
+		second := getTransformScratch(len(mid))
+		defer transformScratch.Put(second)
+		out := outer(event, mid, (*second)[:0])
+		if out == nil {
+			return nil
+		}
+		return append(scratch[:0], out...)
+	}
+}
+
+// logTransformed runs Config.Transform on data and logs the result: with TryLogBytes's drop
+// behavior, or waiting for buffer space like LogBytesBlocking when block is set
+func (l *Logger) logTransformed(ctx context.Context, data []byte, block bool) error {
+	scratch := getTransformScratch(len(data))
+	defer transformScratch.Put(scratch)
+
+	out := l.config.Transform(l.event, data, (*scratch)[:0])
+	if out == nil {
+		l.stats.FilteredLogs.Add(1)
+		return nil
+	}
+	if block {
+		return l.logBytesBlocking(ctx, out)
+	}
+	return l.tryLogBytes(out)
+}
+
+// logEntryTransformed is LogEntry with Config.Transform: fn encodes into a pooled buffer instead of
+// the shard, and the transformed entry is then logged like TryLogBytes
+func (l *Logger) logEntryTransformed(fn func(buf *EntryBuffer)) error {
+	encoded := getTransformScratch(l.config.MaxEntrySize)
+	defer transformScratch.Put(encoded)
+
+	entry := entryBufferPool.Get().(*EntryBuffer)
+	entry.buf, entry.overflow = (*encoded)[:0:l.config.MaxEntrySize], false
+	defer func() {
+		entry.buf = nil
+		entryBufferPool.Put(entry)
+	}()
+	fn(entry)
+
+	if entry.overflow {
+		l.stats.TotalLogs.Add(1)
+		nextSequence(l.config.SequenceNumbers)
+		l.dropped(DropReasonOversized, l.config.MaxEntrySize)
+		return ErrEntryTooLarge
+	}
+	return l.logTransformed(context.Background(), entry.buf, l.config.DropPolicy == DropPolicyBlock)
+}
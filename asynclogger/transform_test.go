@@ -0,0 +1,155 @@
+package asynclogger
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// maskDigits is a redacting Transform: every digit becomes '#'
+func maskDigits(event string, in []byte, scratch []byte) []byte {
+	for _, c := range in {
+		if c >= '0' && c <= '9' {
+			c = '#'
+		}
+		scratch = append(scratch, c)
+	}
+	return scratch
+}
+
+// dropSecrets is a filtering Transform: entries containing "secret" are dropped, others kept as they are
+func dropSecrets(event string, in []byte, scratch []byte) []byte {
+	if bytes.Contains(in, []byte("secret")) {
+		return nil
+	}
+	return in
+}
+
+func TestLogger_Transform(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "transform.log")
+	config := DefaultConfig(logPath)
+	config.BufferSize = 1024 * 1024
+	config.NumShards = 2
+	config.FlushInterval = time.Hour
+	var events sync.Map
+	config.Transform = func(event string, in []byte, scratch []byte) []byte {
+		events.Store(event, true)
+		if dropSecrets(event, in, scratch) == nil {
+			return nil
+		}
+		return maskDigits(event, in, scratch)
+	}
+	logger, err := New(config)
+	require.NoError(t, err)
+
+	// Every write API goes through the transform; the caller's bytes are left alone
+	card := []byte("card 4111-1111-1111-1111")
+	require.NoError(t, logger.TryLogBytes(card))
+	assert.Equal(t, "card 4111-1111-1111-1111", string(card))
+	logger.Log("phone 555-0100")
+	logger.LogBytes([]byte("secret 1234"))
+	require.NoError(t, logger.LogBytesBlocking(context.Background(), []byte("pin 9876")))
+	require.NoError(t, logger.LogEntry(func(buf *EntryBuffer) {
+		buf.AppendString("order ")
+		buf.AppendInt(42)
+	}))
+	require.NoError(t, logger.LogEntry(func(buf *EntryBuffer) { buf.AppendString("secret entry 7") }))
+	assert.ErrorIs(t, logger.LogEntry(func(buf *EntryBuffer) {
+		buf.AppendBytes(make([]byte, config.MaxEntrySize+1))
+	}), ErrEntryTooLarge)
+	require.NoError(t, logger.Close())
+
+	entries := readEntries(t, logPath)
+	sort.Strings(entries)
+	assert.Equal(t, []string{"card ####-####-####-####", "order ##", "phone ###-####", "pin ####"}, entries)
+	_, ok := events.Load("")
+	assert.True(t, ok, "standalone loggers pass no event")
+
+	s := logger.SnapshotStats()
+	assert.Equal(t, int64(2), s.FilteredLogs)
+	assert.Equal(t, int64(5), s.TotalLogs, "filtered logs are not counted")
+	assert.Equal(t, int64(1), s.DroppedLogs, "the oversized entry")
+	assert.Equal(t, int64(len("card ####-####-####-####phone ###-####pin ####order ##")), s.BytesBuffered)
+}
+
+func TestLogger_TransformAllocations(t *testing.T) {
+	config := DefaultConfig(filepath.Join(t.TempDir(), "transform.log"))
+	config.BufferSize = 8 * 1024 * 1024
+	config.NumShards = 2
+	config.FlushInterval = time.Hour
+	config.Transform = maskDigits
+	logger, err := New(config)
+	require.NoError(t, err)
+	defer logger.Close()
+
+	data := []byte("user 12345 logged in from 10.0.0.1")
+	allocs := testing.AllocsPerRun(1000, func() {
+		_ = logger.TryLogBytes(data)
+	})
+	assert.Equal(t, 0.0, allocs)
+
+	// Payloads larger than the pooled scratch buffers grow them once
+	large := bytes.Repeat([]byte("0123456789"), 1000)
+	_ = logger.TryLogBytes(large)
+	allocs = testing.AllocsPerRun(100, func() {
+		_ = logger.TryLogBytes(large)
+	})
+	assert.Equal(t, 0.0, allocs)
+}
+
+func TestLoggerManager_EventTransform(t *testing.T) {
+	config := DefaultConfig(filepath.Join(t.TempDir(), "base.log"))
+	config.BufferSize = 1024 * 1024
+	config.NumShards = 2
+	config.FlushInterval = time.Hour
+	config.Transform = maskDigits
+
+	// The payments transform sees the masked payload and drops the secrets
+	var seen []string
+	var mu sync.Mutex
+	lm, err := NewLoggerManagerWithEventConfigs(config, map[string]EventConfig{
+		"payments": {Transform: func(event string, in []byte, scratch []byte) []byte {
+			mu.Lock()
+			seen = append(seen, event+":"+string(in))
+			mu.Unlock()
+			out := dropSecrets(event, in, scratch)
+			if out == nil {
+				return nil
+			}
+			return append(scratch, strings.ToUpper(string(out))...)
+		}},
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		lm.LogBytesWithEvent("payments", []byte("charge 250 to card 4111"))
+		require.NoError(t, lm.TryLogBytesWithEvent("payments", []byte("secret cvv 123")))
+		lm.LogWithEvent("logins", "user 42 secret")
+	}
+	stats := lm.SnapshotStats()
+	require.NoError(t, lm.Close())
+
+	payments := readEntries(t, filepath.Join(filepath.Dir(config.LogFilePath), "payments.log"))
+	require.Len(t, payments, 100)
+	for _, entry := range payments {
+		assert.Equal(t, "CHARGE ### TO CARD ####", entry)
+	}
+	logins := readEntries(t, filepath.Join(filepath.Dir(config.LogFilePath), "logins.log"))
+	require.Len(t, logins, 100)
+	assert.Equal(t, "user ## secret", logins[0], "only the base transform applies to other events")
+	assert.Contains(t, seen, "payments:secret cvv ###")
+
+	assert.Equal(t, int64(100), stats.Events["payments"].FilteredLogs)
+	assert.Equal(t, int64(100), stats.Events["payments"].TotalLogs)
+	assert.Zero(t, stats.Events["logins"].FilteredLogs)
+	assert.Equal(t, int64(100), stats.Total.FilteredLogs)
+	assert.Zero(t, stats.Total.DroppedLogs)
+}
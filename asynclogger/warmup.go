@@ -0,0 +1,110 @@
+package asynclogger
+
+import (
+	"fmt"
+	"time"
+)
+
+// WarmupTimings reports how long each step of Logger.Warmup took
+type WarmupTimings struct {
+	TouchBuffers time.Duration // Writing a byte to every page of every shard buffer, both sets
+	PagesTouched int           // Pages written by TouchBuffers
+
+	// File steps; zero for writers other than DirectFileWriter (e.g. testsupport.Writer)
+	PrimeWrite  time.Duration // One aligned write at the current offset, truncated away again
+	Preallocate time.Duration // Reserving space for one full flush past the current offset
+
+	Total time.Duration
+}
+
+// fileWarmer is implemented by file writers that can prepare their current file for the first
+// flush (see Logger.Warmup). size is the largest flush the logger writes
+type fileWarmer interface {
+	warmup(size int64) (prime, preallocate time.Duration, err error)
+}
+
+// Warmup takes one-time costs off the first writes and the first flush, which otherwise show up as
+// latency spikes right after startup: it writes a byte to every page of every shard buffer (both
+// sets) so writers do not fault pages in, primes the block allocator with one aligned write at the
+// current file offset that is truncated away again, and preallocates the current file for one full
+// flush. The timings of each step are returned and kept for GetWarmupTimings.
+//
+// Call it before the logger takes traffic (Config.WarmupOnStart calls it from New): pages below a
+// shard's write offset are skipped, but a write racing with Warmup may see its page zeroed
+func (l *Logger) Warmup() (WarmupTimings, error) {
+	var timings WarmupTimings
+	start := time.Now()
+
+	// The flush semaphore keeps the flush worker (and Close's final flush) off the buffers and file
+	l.semaphore <- struct{}{}
+	defer func() { <-l.semaphore }()
+	if l.life.Closed() {
+		return timings, ErrClosed
+	}
+
+	var flushSize int64
+	for _, set := range []*BufferSet{l.setA, l.setB} {
+		for _, shard := range set.Shards() {
+			timings.PagesTouched += shard.buffer.touch()
+		}
+	}
+	for _, shard := range l.setA.Shards() {
+		flushSize += int64(shard.Capacity())
+	}
+	timings.TouchBuffers = time.Since(start)
+
+	var err error
+	if warmer, ok := l.fileWriter.(fileWarmer); ok {
+		timings.PrimeWrite, timings.Preallocate, err = warmer.warmup(flushSize)
+	}
+	timings.Total = time.Since(start)
+
+	l.warmup.Store(&timings)
+	if err != nil {
+		return timings, fmt.Errorf("warmup failed: %w", err)
+	}
+	return timings, nil
+}
+
+// GetWarmupTimings returns the timings of the last Warmup, and false if it never ran
+func (l *Logger) GetWarmupTimings() (WarmupTimings, bool) {
+	timings := l.warmup.Load()
+	if timings == nil {
+		return WarmupTimings{}, false
+	}
+	return *timings, true
+}
+
+// WarmupEvents creates the logger of each event that has none yet (as InitializeEventLogger) and
+// warms it up (see Logger.Warmup), so events known at startup take traffic without lazy-init
+// costs. Returns the timings by sanitized event name; an event that fails is left out, and the
+// first error is returned after the other events are warmed up
+func (lm *LoggerManager) WarmupEvents(eventNames []string) (map[string]WarmupTimings, error) {
+	timings := make(map[string]WarmupTimings, len(eventNames))
+	var firstErr error
+	for _, eventName := range eventNames {
+		logger, err := lm.getOrCreateLogger(eventName)
+		if err == nil {
+			var t WarmupTimings
+			if t, err = logger.Warmup(); err == nil {
+				sanitized, _ := sanitizeEventName(eventName)
+				timings[sanitized] = t
+			}
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error warming up event %s: %w", eventName, err)
+		}
+	}
+	return timings, firstErr
+}
+
+// touch writes a zero byte to every page of the buffer from the write offset on, faulting the pages
+// in before writers reach them (Logger.Warmup). Returns the pages touched
+func (b *Buffer) touch() int {
+	pages := 0
+	for i := int(b.offset.Load()); i < len(b.data); i = (i/alignmentSize + 1) * alignmentSize {
+		b.data[i] = 0
+		pages++
+	}
+	return pages
+}
@@ -0,0 +1,167 @@
+package asynclogger
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// coldWriter is a FileWriter whose first write pays a one-time cost (block allocation on a fresh
+// file) unless warmup ran first
+type coldWriter struct {
+	coldCost   time.Duration
+	steadyCost time.Duration
+	warm       atomic.Bool
+	warmups    atomic.Int64
+}
+
+func (w *coldWriter) WriteVectored(buffers [][]byte) (int, error) {
+	if w.warm.Swap(true) {
+		time.Sleep(w.steadyCost)
+	} else {
+		time.Sleep(w.coldCost)
+	}
+	n := 0
+	for _, buf := range buffers {
+		n += len(buf)
+	}
+	return n, nil
+}
+
+func (w *coldWriter) GetLastPwritevDuration() time.Duration { return 0 }
+
+func (w *coldWriter) Close() error { return nil }
+
+func (w *coldWriter) warmup(size int64) (prime, preallocate time.Duration, err error) {
+	w.warmups.Add(1)
+	w.warm.Store(true)
+	return w.coldCost, 0, nil
+}
+
+func TestLogger_Warmup(t *testing.T) {
+	const coldCost, steadyCost = 50 * time.Millisecond, time.Millisecond
+	newColdLogger := func(t *testing.T, configure func(*Config)) (*Logger, *coldWriter) {
+		t.Helper()
+		config := DefaultConfig(filepath.Join(t.TempDir(), "unused.log"))
+		config.BufferSize = 256 * 1024
+		config.NumShards = 2
+		config.FlushInterval = time.Hour
+		if configure != nil {
+			configure(&config)
+		}
+		writer := &coldWriter{coldCost: coldCost, steadyCost: steadyCost}
+		logger, err := NewWithWriter(config, writer)
+		require.NoError(t, err)
+		t.Cleanup(func() { logger.Close() })
+		return logger, writer
+	}
+	firstFlush := func(t *testing.T, logger *Logger) time.Duration {
+		t.Helper()
+		logger.Log("first entry")
+		require.NoError(t, logger.Flush(context.Background()))
+		return logger.GetFlushMetrics().MaxWriteDuration
+	}
+
+	t.Run("cold first flush", func(t *testing.T) {
+		logger, _ := newColdLogger(t, nil)
+		assert.GreaterOrEqual(t, firstFlush(t, logger), coldCost)
+		_, ok := logger.GetWarmupTimings()
+		assert.False(t, ok)
+	})
+
+	t.Run("first flush after Warmup is steady state", func(t *testing.T) {
+		logger, writer := newColdLogger(t, nil)
+		timings, err := logger.Warmup()
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), writer.warmups.Load())
+
+		// Both sets: 2 shards of at least 128KB (32 pages) each
+		assert.GreaterOrEqual(t, timings.PagesTouched, 4*32)
+		assert.Equal(t, coldCost, timings.PrimeWrite)
+		assert.GreaterOrEqual(t, timings.Total, timings.TouchBuffers)
+		stored, ok := logger.GetWarmupTimings()
+		require.True(t, ok)
+		assert.Equal(t, timings, stored)
+
+		assert.Less(t, firstFlush(t, logger), coldCost/2)
+	})
+
+	t.Run("WarmupOnStart", func(t *testing.T) {
+		logger, writer := newColdLogger(t, func(c *Config) { c.WarmupOnStart = true })
+		assert.Equal(t, int64(1), writer.warmups.Load())
+		_, ok := logger.GetWarmupTimings()
+		assert.True(t, ok)
+		assert.Less(t, firstFlush(t, logger), coldCost/2)
+	})
+
+	t.Run("keeps buffered entries", func(t *testing.T) {
+		logger, _ := newColdLogger(t, nil)
+		logger.Log("before warmup")
+		_, err := logger.Warmup()
+		require.NoError(t, err)
+		require.NoError(t, logger.Flush(context.Background()))
+		totalLogs, droppedLogs, _, _, _, _, _, bytesDurable := logger.GetStatsSnapshot()
+		assert.Equal(t, int64(1), totalLogs)
+		assert.Zero(t, droppedLogs)
+		assert.Equal(t, int64(len("before warmup")), bytesDurable)
+	})
+
+	t.Run("after Close", func(t *testing.T) {
+		logger, _ := newColdLogger(t, nil)
+		require.NoError(t, logger.Close())
+		_, err := logger.Warmup()
+		assert.ErrorIs(t, err, ErrClosed)
+	})
+}
+
+func TestLogger_WarmupDirectFileWriter(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "warm.log")
+	config := DefaultConfig(logPath)
+	config.BufferSize = 256 * 1024
+	config.NumShards = 2
+	config.FlushInterval = time.Hour
+
+	logger, err := New(config)
+	require.NoError(t, err)
+	_, err = logger.Warmup()
+	require.NoError(t, err)
+
+	// The prime write is truncated away: the file holds only what flushes write
+	info, err := os.Stat(logPath)
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+
+	for i := 0; i < 10; i++ {
+		logger.Log("entry")
+	}
+	require.NoError(t, logger.Close())
+	assert.Equal(t, 10, countLogRecords(t, logPath))
+}
+
+func TestLoggerManager_WarmupEvents(t *testing.T) {
+	config := DefaultConfig(filepath.Join(t.TempDir(), "events.log"))
+	config.BufferSize = 256 * 1024
+	config.NumShards = 2
+
+	lm, err := NewLoggerManager(config)
+	require.NoError(t, err)
+	defer lm.Close()
+
+	timings, err := lm.WarmupEvents([]string{"payments", "search/queries"})
+	require.NoError(t, err)
+	require.Len(t, timings, 2)
+	assert.Positive(t, timings["payments"].PagesTouched)
+	assert.Positive(t, timings["search_queries"].PagesTouched)
+	assert.True(t, lm.HasEventLogger("payments"))
+
+	// A bad name does not stop the other events from warming up
+	timings, err = lm.WarmupEvents([]string{"", "orders"})
+	assert.ErrorIs(t, err, ErrInvalidEventName)
+	assert.Contains(t, timings, "orders")
+}
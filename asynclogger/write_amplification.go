@@ -0,0 +1,43 @@
+package asynclogger
+
+// flushBytes is the byte accounting of the shard buffers written by one flush
+// Every written byte is payload, header or padding (see FlushMetrics.WriteAmplificationRatio)
+type flushBytes struct {
+	payload int64 // Log payload (as Statistics.BytesDurable)
+	header  int64 // Shard headers and entry framing (length prefixes, sequence numbers, timestamps, LogEntry padding, plain output's newlines)
+	padding int64 // Bytes after each shard's valid data (Direct I/O alignment)
+}
+
+// add accounts a shard buffer of written bytes holding validDataBytes of entries with payload bytes of log data
+func (b *flushBytes) add(written, validDataBytes, payload int64) {
+	b.payload += payload
+	b.header += headerOffset + validDataBytes - payload
+	b.padding += written - headerOffset - validDataBytes
+}
+
+// addLines accounts a shard of plain output (Config.OutputFormat): validDataBytes of lines with
+// payload bytes of log data, written without a header or padding
+func (b *flushBytes) addLines(validDataBytes, payload int64) {
+	b.payload += payload
+	b.header += validDataBytes - payload
+}
+
+// written returns the bytes of the shard buffers
+func (b flushBytes) written() int64 {
+	return b.payload + b.header + b.padding
+}
+
+// recordFlushBytes counts the bytes of a successful flush
+func (s *Statistics) recordFlushBytes(b flushBytes) {
+	s.BytesDurable.Add(b.payload)
+	s.HeaderBytesFlushed.Add(b.header)
+	s.PaddingBytesFlushed.Add(b.padding)
+}
+
+// writeAmplification returns the bytes written per payload byte (0 before any payload is written)
+func writeAmplification(payload, header, padding int64) float64 {
+	if payload == 0 {
+		return 0
+	}
+	return float64(payload+header+padding) / float64(payload)
+}
@@ -0,0 +1,100 @@
+package asynclogger
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger_WriteAmplification(t *testing.T) {
+	const entrySize = 100
+
+	for _, mode := range ioModes {
+		t.Run(string(mode), func(t *testing.T) {
+			logPath := filepath.Join(t.TempDir(), "test.log")
+			config := fileWriterConfig(logPath, mode)
+			config.BufferSize = 256 * 1024
+			config.NumShards = 2
+			logger, err := New(config)
+			require.NoError(t, err)
+
+			var observed []FlushObservation
+			logger.SetFlushObserver(func(o FlushObservation) { observed = append(observed, o) })
+
+			// Round-robin puts entries on shards 1, 0, 1: one shard holds two entries, the other one
+			for i := 0; i < 3; i++ {
+				require.NoError(t, logger.TryLogBytes(make([]byte, entrySize)))
+			}
+			require.NoError(t, logger.Flush(context.Background()))
+
+			// Each shard is written in full (with Direct I/O) or up to its data (buffered)
+			valid := int64(3 * (reader.LengthPrefixSize + entrySize))
+			written := 2 * int64(logger.activeSet.Load().GetShard(0).Capacity())
+			if mode == IOModeBuffered {
+				written = 2*headerOffset + valid
+			}
+			want := FlushObservation{
+				PayloadBytes: 3 * entrySize,
+				HeaderBytes:  2*headerOffset + 3*reader.LengthPrefixSize,
+				PaddingBytes: written - 2*headerOffset - valid,
+			}
+
+			metrics := logger.GetFlushMetrics()
+			assert.Equal(t, want.PayloadBytes, metrics.PayloadBytes)
+			assert.Equal(t, want.HeaderBytes, metrics.HeaderBytes)
+			assert.Equal(t, want.PaddingBytes, metrics.PaddingBytes)
+			assert.Equal(t, float64(written)/float64(3*entrySize), metrics.WriteAmplificationRatio)
+			if mode == IOModeBuffered {
+				assert.Zero(t, metrics.PaddingBytes)
+			}
+
+			require.Len(t, observed, 1)
+			assert.Equal(t, int(written), observed[0].Bytes)
+			assert.Equal(t, want.PayloadBytes, observed[0].PayloadBytes)
+			assert.Equal(t, want.HeaderBytes, observed[0].HeaderBytes)
+			assert.Equal(t, want.PaddingBytes, observed[0].PaddingBytes)
+			require.NoError(t, logger.Close())
+
+			// The reader accounts the file the same way
+			acct, err := reader.AccountFiles([]string{logPath}, reader.Options{})
+			require.NoError(t, err)
+			assert.Equal(t, reader.ByteAccounting{
+				PayloadBytes: want.PayloadBytes,
+				HeaderBytes:  want.HeaderBytes,
+				PaddingBytes: want.PaddingBytes,
+			}, acct)
+			assert.Equal(t, metrics.WriteAmplificationRatio, acct.WriteAmplificationRatio())
+		})
+	}
+
+	t.Run("aggregated by LoggerManager", func(t *testing.T) {
+		config := fileWriterConfig(filepath.Join(t.TempDir(), "events.log"), IOModeBuffered)
+		config.BufferSize = 256 * 1024
+		config.NumShards = 2
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+
+		manager.LogBytesWithEvent("a", make([]byte, entrySize))
+		manager.LogBytesWithEvent("b", make([]byte, 3*entrySize))
+		require.NoError(t, manager.FlushAll(context.Background()))
+
+		// One single-entry shard per event
+		metrics := manager.GetAggregatedFlushMetrics()
+		assert.Equal(t, int64(4*entrySize), metrics.PayloadBytes)
+		assert.Equal(t, int64(2*(headerOffset+reader.LengthPrefixSize)), metrics.HeaderBytes)
+		assert.Zero(t, metrics.PaddingBytes)
+		assert.Equal(t, float64(4*entrySize+2*(headerOffset+reader.LengthPrefixSize))/float64(4*entrySize), metrics.WriteAmplificationRatio)
+	})
+
+	t.Run("zero before any payload", func(t *testing.T) {
+		logger, err := New(DefaultConfig(filepath.Join(t.TempDir(), "test.log")))
+		require.NoError(t, err)
+		defer logger.Close()
+		assert.Zero(t, logger.GetFlushMetrics().WriteAmplificationRatio)
+	})
+}
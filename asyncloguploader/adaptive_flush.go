@@ -0,0 +1,85 @@
+package asyncloguploader
+
+import "time"
+
+const (
+	// adaptiveSampleInterval is how often AdaptiveFlush samples shard fill rates
+	adaptiveSampleInterval = 10 * time.Millisecond
+
+	// adaptiveRateWeight is the weight of the newest sample in the smoothed fill rate
+	adaptiveRateWeight = 0.5
+
+	// adaptiveInitialFlushEstimate stands in for the average flush duration until a flush completes
+	adaptiveInitialFlushEstimate = 10 * time.Millisecond
+)
+
+// fillRateSampler projects when each shard's active buffer will be full (AdaptiveFlush)
+// Only used by the ticker worker, so it needs no synchronization
+type fillRateSampler struct {
+	lastBytes  []int64   // bufferedBytes of each shard at the last sample
+	rates      []float64 // Smoothed fill rate of each shard (bytes/second)
+	lastSample time.Time
+}
+
+func newFillRateSampler(numShards int) *fillRateSampler {
+	return &fillRateSampler{
+		lastBytes:  make([]int64, numShards),
+		rates:      make([]float64, numShards),
+		lastSample: time.Now(),
+	}
+}
+
+// atRisk updates the fill rates and returns the shards whose active buffer is projected to be
+// full within horizon. Bytes removed by a flush since the last sample count as no growth, so
+// the rate is briefly underestimated after each flush rather than going negative
+func (f *fillRateSampler) atRisk(shards []*Shard, now time.Time, horizon time.Duration) []*Shard {
+	elapsed := now.Sub(f.lastSample).Seconds()
+	f.lastSample = now
+	if elapsed <= 0 {
+		return nil
+	}
+
+	var risky []*Shard
+	for i, shard := range shards {
+		buffered := shard.bufferedBytes()
+		growth := max(buffered-f.lastBytes[i], 0)
+		f.lastBytes[i] = buffered
+		f.rates[i] = adaptiveRateWeight*float64(growth)/elapsed + (1-adaptiveRateWeight)*f.rates[i]
+
+		if f.rates[i] <= 0 || buffered == 0 {
+			continue
+		}
+		timeToFull := time.Duration(float64(shard.room()) / f.rates[i] * float64(time.Second))
+		if timeToFull < horizon {
+			risky = append(risky, shard)
+		}
+	}
+	return risky
+}
+
+// adaptiveHorizon is how soon a shard may fill before it is flushed early: twice the average
+// flush duration, plus one sample interval since the next sample may come too late
+func (l *Logger) adaptiveHorizon() time.Duration {
+	avgFlush := adaptiveInitialFlushEstimate
+	if flushes := l.stats.Flushes.Load(); flushes > 0 {
+		avgFlush = time.Duration(l.stats.TotalFlushDuration.Load() / flushes)
+	}
+	return 2*avgFlush + adaptiveSampleInterval
+}
+
+// sampleFillRates queues the shards projected to fill within the horizon and asks their flush
+// workers to flush them now instead of waiting for the shard threshold
+func (l *Logger) sampleFillRates(sampler *fillRateSampler, now time.Time) {
+	sc := l.shardCollection.Load()
+	risky := sampler.atRisk(sc.Shards(), now, l.adaptiveHorizon())
+	for _, shard := range risky {
+		sc.EnqueueShardForFlush(shard)
+	}
+	for _, shard := range risky {
+		select {
+		case l.groups[int(shard.ID())%len(l.groups)].earlyFlush <- struct{}{}:
+		default:
+			// An early flush is already pending; it picks up the shards queued above
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package asyncloguploader
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// latencyFileWriter adds a fixed delay to every write, like a disk with high per-write latency
+type latencyFileWriter struct {
+	FileWriter
+	latency time.Duration
+}
+
+func (w *latencyFileWriter) WriteVectored(buffers [][]byte) (int, error) {
+	time.Sleep(w.latency)
+	return w.FileWriter.WriteVectored(buffers)
+}
+
+// runBurstyLoad writes 256-byte logs in four 300ms bursts of ~5MB/s, separated by 200ms pauses,
+// to a 512KB logger whose writes take 50ms, and returns the final statistics
+func runBurstyLoad(t *testing.T, adaptive bool) StatsSnapshot {
+	t.Helper()
+	config := DefaultConfig(filepath.Join(t.TempDir(), "burst.log"))
+	config.BufferSize = 512 * 1024
+	config.NumShards = 8
+	config.AdaptiveFlush = adaptive
+
+	logger, err := NewLogger(config)
+	require.NoError(t, err)
+	logger.groups[0].fileWriter = &latencyFileWriter{FileWriter: logger.groups[0].fileWriter, latency: 50 * time.Millisecond}
+
+	msg := make([]byte, 256)
+	for burst := 0; burst < 4; burst++ {
+		end := time.Now().Add(300 * time.Millisecond)
+		for time.Now().Before(end) {
+			for i := 0; i < 100; i++ {
+				logger.LogBytes(msg)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	require.NoError(t, logger.Close())
+	return logger.Snapshot().Stats
+}
+
+func TestLogger_AdaptiveFlush(t *testing.T) {
+	t.Run("ReducesDropsUnderBurstyLoad", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("load test")
+		}
+
+		baseline := runBurstyLoad(t, false)
+		adaptive := runBurstyLoad(t, true)
+		dropRate := func(s StatsSnapshot) float64 { return float64(s.DroppedLogs) / float64(s.TotalLogs) * 100 }
+		t.Logf("drop rate: threshold only %.2f%% (%d/%d), adaptive %.2f%% (%d/%d, %d early flushes)",
+			dropRate(baseline), baseline.DroppedLogs, baseline.TotalLogs,
+			dropRate(adaptive), adaptive.DroppedLogs, adaptive.TotalLogs, adaptive.EarlyFlushes)
+
+		require.Greater(t, baseline.DroppedLogs, int64(0), "workload should overflow the threshold-only logger")
+		assert.Less(t, dropRate(adaptive), dropRate(baseline)/2)
+		assert.Greater(t, adaptive.EarlyFlushes, int64(0))
+		assert.Equal(t, int64(0), baseline.EarlyFlushes)
+	})
+
+	t.Run("FlushesShardsProjectedToFill", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "adaptive.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 4
+		config.FlushInterval = time.Hour
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		defer logger.Close()
+
+		shards := logger.shardCollection.Load().Shards()
+		sampler := newFillRateSampler(len(shards))
+		now := sampler.lastSample
+		horizon := logger.adaptiveHorizon() // 30ms before any flush completes
+
+		// Half a buffer in one sample interval: the rest fills in ~20ms, within the horizon
+		_, _ = shards[0].Write(make([]byte, int(shards[0].room())/2))
+		assert.Equal(t, []*Shard{shards[0]}, sampler.atRisk(shards, now.Add(adaptiveSampleInterval), horizon))
+
+		// No growth in the next interval halves the smoothed rate, pushing time-to-full past the horizon
+		assert.Empty(t, sampler.atRisk(shards, now.Add(2*adaptiveSampleInterval), horizon))
+	})
+
+	t.Run("CoalescesQueuedShards", func(t *testing.T) {
+		flushChan := make(chan *Shard, 1)
+		collection, err := NewShardCollection(1024*1024, 4, flushChan)
+		require.NoError(t, err)
+		defer collection.Close()
+
+		shard := collection.GetShard(0)
+		collection.EnqueueShardForFlush(shard)
+		collection.EnqueueShardForFlush(shard) // Coalesced: would block on the full channel otherwise
+		assert.Len(t, flushChan, 1)
+
+		dequeued(<-flushChan)
+		collection.EnqueueShardForFlush(shard)
+		assert.Len(t, flushChan, 1)
+	})
+}
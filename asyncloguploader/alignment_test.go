@@ -0,0 +1,87 @@
+package asyncloguploader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger_IOAlignment(t *testing.T) {
+	// Shards of 64KB+512 bytes: a multiple of 512 but not of 4096
+	const shardSize = 64*1024 + 512
+	for alignment, capacity := range map[int]int32{512: shardSize, 8192: 9 * 8192} {
+		t.Run(fmt.Sprint(alignment), func(t *testing.T) {
+			tmpDir := t.TempDir()
+			config := DefaultConfig(filepath.Join(tmpDir, "aligned.log"))
+			config.BufferSize = 2 * shardSize
+			config.NumShards = 2
+			config.FlushInterval = time.Hour
+			config.IOAlignment = alignment
+			require.NoError(t, config.Validate())
+			assert.Contains(t, config.Explain(), fmt.Sprintf("shard buffer: %d bytes aligned to %d", capacity, alignment))
+
+			logger, err := NewLogger(config)
+			require.NoError(t, err)
+			for _, shard := range logger.shardCollection.Load().shards {
+				assert.Equal(t, capacity, shard.Capacity())
+			}
+
+			var want [][]byte
+			size := int64(0)
+			for flush := 0; flush < 3; flush++ {
+				for i := 0; i < 50+flush*20; i++ {
+					msg := []byte(fmt.Sprintf("flush-%d-%03d", flush, i))
+					require.NoError(t, logger.TryLogBytes(msg))
+					want = append(want, msg)
+				}
+				require.NoError(t, logger.Flush(t.Context()))
+				info, err := os.Stat(findLogFile(t, tmpDir, "aligned"))
+				require.NoError(t, err)
+				assert.Zero(t, info.Size()%int64(alignment), "file offset %d after flush %d", info.Size(), flush)
+				assert.Greater(t, info.Size(), size)
+				size = info.Size()
+			}
+			require.NoError(t, logger.Close())
+
+			// The file header fills one alignment block and records it
+			messages, reader := readAllMessages(t, findLogFile(t, tmpDir, "aligned"))
+			assert.ElementsMatch(t, want, messages)
+			header, ok := reader.FileHeader()
+			require.True(t, ok)
+			assert.Equal(t, alignment, header.Size)
+			assert.Equal(t, alignment, header.Alignment)
+			assert.Equal(t, int(capacity), header.ShardCapacity)
+		})
+	}
+}
+
+func TestConfig_IOAlignment(t *testing.T) {
+	for _, alignment := range []int{256, 1000, 128 * 1024} {
+		config := DefaultConfig("/tmp/aligned.log")
+		config.IOAlignment = alignment
+		err := config.Validate()
+		require.Error(t, err)
+		assert.Equal(t, fmt.Sprintf("IOAlignment must be a power of two between 512 and 65536, got %d", alignment), err.Error())
+	}
+
+	config := DefaultConfig("/tmp/aligned.log")
+	require.NoError(t, config.Validate())
+	assert.Equal(t, alignmentSize, config.IOAlignment)
+
+	// Auto resolves to a supported alignment (or the default, with a warning, where detection fails)
+	config = DefaultConfig(filepath.Join(t.TempDir(), "auto", "aligned.log"))
+	config.IOAlignment = IOAlignmentAuto
+	config.InternalLogger = &captureLogger{}
+	require.NoError(t, config.Validate())
+	assert.GreaterOrEqual(t, config.IOAlignment, 512)
+	assert.LessOrEqual(t, config.IOAlignment, 65536)
+	assert.Zero(t, config.IOAlignment&(config.IOAlignment-1))
+	entries, err := os.ReadDir(filepath.Dir(config.LogFilePath))
+	require.NoError(t, err)
+	assert.Empty(t, entries, "the probe file is removed")
+}
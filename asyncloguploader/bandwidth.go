@@ -0,0 +1,137 @@
+package asyncloguploader
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxThrottledRead caps each read of a ThrottledReader, so a low limit paces in small steps
+const maxThrottledRead = 32 * 1024
+
+// throughputWindow is the interval Stats.Throughput is measured over
+const throughputWindow = time.Second
+
+// bandwidthLimiter paces the file reads of all uploads of an Uploader to one shared byte rate
+// Like eventLimiter it keeps a theoretical arrival time: each read reserves the next n bytes of the
+// rate's schedule and waits until its slot starts, so the aggregate of all readers stays at the cap
+type bandwidthLimiter struct {
+	bytesPerSec atomic.Int64 // 0 = unlimited (reads are only metered)
+	tat         atomic.Int64 // Theoretical arrival time (Unix nanoseconds)
+
+	// Bytes read in the current window and the rate of the last complete one (Stats.Throughput)
+	mu          sync.Mutex
+	windowStart time.Time
+	windowBytes int64
+	lastRate    float64
+}
+
+// newBandwidthLimiter creates a limiter for bytesPerSec (0 = unlimited)
+func newBandwidthLimiter(bytesPerSec int64) *bandwidthLimiter {
+	l := &bandwidthLimiter{windowStart: time.Now()}
+	l.bytesPerSec.Store(bytesPerSec)
+	return l
+}
+
+// setLimit changes the rate for reads from now on; reads already waiting keep their slot
+func (l *bandwidthLimiter) setLimit(bytesPerSec int64) {
+	l.bytesPerSec.Store(bytesPerSec)
+	l.tat.Store(0) // The schedule of the old rate no longer applies
+}
+
+// wait counts n bytes read and blocks until they fit the rate, or ctx is done
+func (l *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	l.meter(n)
+	rate := l.bytesPerSec.Load()
+	if rate <= 0 || n <= 0 {
+		return nil
+	}
+
+	cost := int64(n) * int64(time.Second) / rate
+	now := time.Now().UnixNano()
+	var start int64
+	for {
+		tat := l.tat.Load()
+		start = max(tat, now)
+		if l.tat.CompareAndSwap(tat, start+cost) {
+			break
+		}
+	}
+	if start <= now {
+		return nil
+	}
+
+	timer := time.NewTimer(time.Duration(start - now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// meter adds n bytes to the throughput window
+func (l *bandwidthLimiter) meter(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if elapsed := now.Sub(l.windowStart); elapsed >= throughputWindow {
+		l.lastRate = float64(l.windowBytes) / elapsed.Seconds()
+		l.windowStart = now
+		l.windowBytes = 0
+	}
+	l.windowBytes += int64(n)
+}
+
+// throughput returns the bytes per second read over the last complete window; an idle window
+// lowers it as time passes
+func (l *bandwidthLimiter) throughput() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if elapsed := time.Since(l.windowStart); elapsed >= throughputWindow {
+		return float64(l.windowBytes) / elapsed.Seconds()
+	}
+	return l.lastRate
+}
+
+// bandwidthKey is the context key of the limiter passed to backends
+type bandwidthKey struct{}
+
+// throttledReader is a reader paced by a bandwidthLimiter
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *bandwidthLimiter
+}
+
+// ThrottledReader returns r paced by the bandwidth limit (GCSUploadConfig.MaxBandwidthBytesPerSec)
+// of the Uploader whose context ctx is, and counted in its Stats.Throughput; r itself for other
+// contexts. Backends read files through it, so the limit covers every concurrent upload and chunk
+func ThrottledReader(ctx context.Context, r io.Reader) io.Reader {
+	limiter, ok := ctx.Value(bandwidthKey{}).(*bandwidthLimiter)
+	if !ok {
+		return r
+	}
+	return &throttledReader{ctx: ctx, r: r, limiter: limiter}
+}
+
+// Read implements io.Reader
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > maxThrottledRead {
+		p = p[:maxThrottledRead]
+	}
+	n, err := t.r.Read(p)
+	if waitErr := t.limiter.wait(t.ctx, n); waitErr != nil && err == nil {
+		err = waitErr
+	}
+	return n, err
+}
+
+// SetBandwidthLimit changes MaxBandwidthBytesPerSec for uploads in progress and to come, e.g. to
+// stop uploads from competing with serving traffic during an incident; 0 removes the limit
+func (u *Uploader) SetBandwidthLimit(bytesPerSec int64) {
+	u.limiter.setLimit(max(bytesPerSec, 0))
+}
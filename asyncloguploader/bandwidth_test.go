@@ -0,0 +1,159 @@
+package asyncloguploader
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pacedStore is an UploadBackend that reads each file through ThrottledReader in small pieces,
+// recording when the bytes arrived and how many uploads ran at once
+type pacedStore struct {
+	mu        sync.Mutex
+	first     time.Time
+	last      time.Time
+	bytes     int64
+	active    int
+	maxActive int
+}
+
+func (s *pacedStore) Upload(ctx context.Context, localPath, objectName string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s.mu.Lock()
+	s.active++
+	s.maxActive = max(s.maxActive, s.active)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.active--
+		s.mu.Unlock()
+	}()
+
+	r := ThrottledReader(ctx, f)
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			s.mu.Lock()
+			if s.first.IsZero() {
+				s.first = time.Now()
+			}
+			s.last = time.Now()
+			s.bytes += int64(n)
+			s.mu.Unlock()
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *pacedStore) Stat(ctx context.Context, objectName string) (ObjectInfo, error) {
+	return ObjectInfo{}, ErrObjectNotFound
+}
+
+func (s *pacedStore) Close() error {
+	return nil
+}
+
+func TestUploader_BandwidthLimit(t *testing.T) {
+	// writeFiles creates count files of size bytes each
+	writeFiles := func(t *testing.T, count, size int) []string {
+		t.Helper()
+		dir := t.TempDir()
+		paths := make([]string, count)
+		for i := range paths {
+			paths[i] = filepath.Join(dir, "app_"+strconv.Itoa(i)+".log")
+			require.NoError(t, os.WriteFile(paths[i], bytes.Repeat([]byte{'x'}, size), 0644))
+		}
+		return paths
+	}
+
+	t.Run("PacesConcurrentUploadsTogether", func(t *testing.T) {
+		const limit = 1024 * 1024
+		store := &pacedStore{}
+		config := GCSUploadConfig{MaxConcurrentUploads: 5, MaxBandwidthBytesPerSec: limit, InternalLogger: &captureLogger{}}
+		uploader, err := NewUploaderWithBackend(config, store)
+		require.NoError(t, err)
+
+		uploader.Start()
+		for _, path := range writeFiles(t, 5, 256*1024) {
+			uploader.GetUploadChannel() <- path
+		}
+		uploader.Stop()
+
+		stats := uploader.GetStats()
+		require.Equal(t, int64(5), stats.Successful)
+		assert.Equal(t, 5, store.maxActive, "uploads run concurrently")
+
+		// The first read is not delayed; every byte after it waits for the shared rate
+		elapsed := store.last.Sub(store.first)
+		assert.GreaterOrEqual(t, elapsed, time.Duration(float64(store.bytes-4096)/limit*float64(time.Second))*9/10)
+		assert.Less(t, elapsed, 5*time.Second)
+		assert.InDelta(t, limit, stats.Throughput, limit/4, "observed throughput matches the cap")
+		assert.Equal(t, int64(limit), stats.BandwidthLimit)
+	})
+
+	t.Run("SetBandwidthLimitAppliesToRunningUploads", func(t *testing.T) {
+		store := &pacedStore{}
+		config := GCSUploadConfig{MaxBandwidthBytesPerSec: 64 * 1024, InternalLogger: &captureLogger{}}
+		uploader, err := NewUploaderWithBackend(config, store)
+		require.NoError(t, err)
+
+		// 1MB takes 16s at 64KB/s; lifting the limit finishes it at once
+		uploader.Start()
+		uploader.GetUploadChannel() <- writeFiles(t, 1, 1024*1024)[0]
+		time.Sleep(200 * time.Millisecond)
+		uploader.SetBandwidthLimit(0)
+		start := time.Now()
+		uploader.Stop()
+
+		assert.Less(t, time.Since(start), 2*time.Second)
+		assert.Equal(t, int64(1), uploader.GetStats().Successful)
+		assert.Zero(t, uploader.GetStats().BandwidthLimit)
+	})
+
+	t.Run("UnlimitedByDefault", func(t *testing.T) {
+		store := &pacedStore{}
+		uploader, err := NewUploaderWithBackend(GCSUploadConfig{InternalLogger: &captureLogger{}}, store)
+		require.NoError(t, err)
+
+		uploader.Start()
+		for _, path := range writeFiles(t, 3, 1024*1024) {
+			uploader.GetUploadChannel() <- path
+		}
+		start := time.Now()
+		uploader.Stop()
+
+		assert.Less(t, time.Since(start), 2*time.Second)
+		assert.Equal(t, 1, store.maxActive, "one upload at a time by default")
+		assert.Equal(t, int64(3*1024*1024), store.bytes, "reads are metered without a limit")
+	})
+
+	t.Run("RejectsNegativeLimit", func(t *testing.T) {
+		_, err := NewUploaderWithBackend(GCSUploadConfig{MaxBandwidthBytesPerSec: -1}, &pacedStore{})
+		assert.ErrorContains(t, err, "MaxBandwidthBytesPerSec")
+	})
+
+	t.Run("OtherContextsAreNotThrottled", func(t *testing.T) {
+		r := bytes.NewReader(nil)
+		assert.Same(t, r, ThrottledReader(context.Background(), r))
+	})
+}
@@ -0,0 +1,230 @@
+package asyncloguploader
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/internal/logcore"
+)
+
+// LogBatch writes entries like LogBytes, amortizing the per-entry overhead: consecutive entries
+// are written to one shard with a single offset reservation, and statistics are updated once
+// per reservation instead of once per entry. A shard that cannot take the next entry hands it to
+// the LogBytes retry path, then batching resumes. Entries keep their relative order within a shard
+//
+// Acceptance is per entry, not per batch: accepted is the number of entries written, and err is
+// the reason the first rejected entry was refused (nil when all were accepted). Rejected entries are
+// counted as for LogBytes. Batches are not recorded in the write-latency histogram
+func (l *Logger) LogBatch(entries [][]byte) (accepted int, err error) {
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	l.stats.TotalLogs.Add(int64(len(entries)))
+
+	if l.life.Closed() {
+		l.stats.DroppedLogs.Add(int64(len(entries)))
+		return 0, ErrClosed
+	}
+	if l.degraded.Load() {
+		l.stats.DroppedLogs.Add(int64(len(entries)))
+		l.stats.FreeSpaceDrops.Add(int64(len(entries)))
+		return 0, ErrLowDiskSpace
+	}
+	if l.retainingGroups.Load() > 0 {
+		l.stats.DroppedLogs.Add(int64(len(entries)))
+		l.stats.DiskFullDrops.Add(int64(len(entries)))
+		return 0, ErrDiskFull
+	}
+
+	for i := 0; i < len(entries); {
+		// Run of entries that fit in one shard entry; others take the single-entry path
+		j := i
+		for j < len(entries) && l.batchable(entries[j]) {
+			j++
+		}
+		if j == i {
+			if logErr := l.writeLog(nil, entries[i], 0, false, nil); logErr != nil {
+				err = firstError(err, logErr)
+			} else {
+				accepted++
+			}
+			i++
+			continue
+		}
+
+		n, runErr := l.writeRun(entries[i:j])
+		accepted += n
+		err = firstError(err, runErr)
+		i = j
+	}
+	return accepted, err
+}
+
+// batchable reports whether data can be written by writeRun (not empty, oversized or chunked)
+func (l *Logger) batchable(data []byte) bool {
+	return len(data) > 0 && len(data) <= l.maxEntry && len(data) <= l.config.MaxMessageSize
+}
+
+// writeRun writes batchable entries, each shard taking as many as fit in its active buffer
+func (l *Logger) writeRun(run [][]byte) (accepted int, err error) {
+	sc := l.acquireShards()
+	defer l.releaseShards(sc)
+
+	var fastPath, dropped int64
+	for len(run) > 0 {
+		count, n := sc.writeBatch(run)
+		if count > 0 {
+			l.stats.BytesWritten.Add(int64(n))
+			l.stats.BytesBuffered.Add(int64(n - count*lengthPrefixSize))
+			fastPath += int64(count)
+			accepted += count
+			run = run[count:]
+			continue
+		}
+
+		// The shard is full: the next entry waits for a swap like a LogBytes call would
+		if shard, ok := l.writeEntry(nil, run[0], 0, 0, false, nil); ok {
+			accepted++
+		} else {
+			dropped++
+			shard.countDrop()
+			err = ErrBufferFull
+		}
+		run = run[1:]
+	}
+
+	l.stats.FastPathWrites.Add(fastPath)
+	if dropped > 0 {
+		l.stats.DroppedLogs.Add(dropped)
+	}
+	return accepted, err
+}
+
+// firstError returns err, or next if err is nil
+func firstError(err, next error) error {
+	if err != nil {
+		return err
+	}
+	return next
+}
+
+// writeBatch writes the longest prefix of entries that fits in one shard's active buffer
+// Returns the number of entries and bytes written (0, 0 when the first entry does not fit)
+func (sc *ShardCollection) writeBatch(entries [][]byte) (count, n int) {
+	shard := sc.shards[sc.selectShard(0, false)]
+
+	count, n, needsFlush := shard.writeBatch(entries)
+	if needsFlush {
+		sc.EnqueueShardForFlush(shard)
+		sc.MarkShardReady()
+	}
+	return count, n
+}
+
+// writeBatch writes the longest prefix of entries that fits in the active buffer with a single
+// reservation, each with its length prefix as in writeEntry. Entries must not be empty.
+// Returns the number of entries and bytes written, and whether the buffer needs flushing
+func (s *Shard) writeBatch(entries [][]byte) (count, n int, needsFlush bool) {
+	activeBufPtr := s.activeBuffer.Load()
+	if activeBufPtr == nil {
+		return 0, 0, true
+	}
+
+	var offset *atomic.Int32
+	var inflight, written, payload *atomic.Int64
+	var committed *logcore.CommittedMark
+	if activeBufPtr == &s.bufferA {
+		offset, inflight, written, payload, committed = &s.offsetA, &s.inflightA, &s.entriesA, &s.payloadA, &s.committedA
+	} else {
+		offset, inflight, written, payload, committed = &s.offsetB, &s.inflightB, &s.entriesB, &s.payloadB, &s.committedB
+	}
+
+	// Same in-flight protocol as writeEntry
+	inflight.Add(1)
+	if s.activeBuffer.Load() != activeBufPtr {
+		inflight.Add(-1)
+		return s.writeBatch(entries)
+	}
+
+	currentOffset := offset.Load()
+	room := int(min(s.limit, int32(len(*activeBufPtr))) - currentOffset)
+	for count < len(entries) && n+lengthPrefixSize+len(entries[count]) <= room {
+		n += lengthPrefixSize + len(entries[count])
+		count++
+	}
+	if count == 0 {
+		inflight.Add(-1)
+		s.readyForFlush.Store(true)
+		return 0, 0, true
+	}
+
+	newOffset := currentOffset + int32(n)
+	if !offset.CompareAndSwap(currentOffset, newOffset) {
+		inflight.Add(-1)
+		return s.writeBatch(entries)
+	}
+	written.Add(int64(count))
+	payload.Add(int64(n - count*lengthPrefixSize))
+	s.writes.Add(int64(count))
+
+	activeBuf := *activeBufPtr
+	pos := currentOffset
+	for _, entry := range entries[:count] {
+		binary.LittleEndian.PutUint32(activeBuf[pos:pos+lengthPrefixSize], uint32(len(entry)))
+		pos += lengthPrefixSize + int32(copy(activeBuf[pos+lengthPrefixSize:], entry))
+	}
+	committed.Finish(offset, inflight)
+
+	if newOffset-headerOffset >= s.flushThreshold.Load() {
+		s.swapIfFlushed()
+		s.readyForFlush.Store(true)
+		return count, n, true
+	}
+	return count, n, false
+}
+
+// LogBatchWithEvent writes entries to the event-specific logger (see Logger.LogBatch)
+// If the event is refused, every entry counts as refused and the guardrail error is returned.
+// An event with MirrorEvents also writes the batch to each mirror; accepted counts the event's own
+// entries and err is the first error from any target
+func (lm *LoggerManager) LogBatchWithEvent(eventName string, entries [][]byte) (accepted int, err error) {
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	targets, ok := lm.mirrors[eventName]
+	if !ok {
+		return lm.logBatchToEvent(eventName, entries)
+	}
+	for i, target := range targets {
+		n, targetErr := lm.logBatchToEvent(target, entries)
+		if i == 0 {
+			accepted = n
+		}
+		err = firstError(err, targetErr)
+	}
+	return accepted, err
+}
+
+// logBatchToEvent writes entries to one event logger for LogBatchWithEvent
+func (lm *LoggerManager) logBatchToEvent(eventName string, entries [][]byte) (accepted int, err error) {
+	logger, err := lm.acquireLogger(eventName)
+	if err != nil {
+		// The guardrail or drain counted one refused log; count the rest of the batch
+		lm.guard.countRefused(err, len(entries)-1)
+		if errors.Is(err, ErrDraining) {
+			lm.drainRejected.Add(int64(len(entries) - 1))
+		}
+		return 0, err
+	}
+	entries, err = logger.admitBatch(entries)
+	var batchErr error
+	var buf [routeTagSize]byte
+	if tag := lm.router.tagFor(&buf, eventName, logger); tag != nil {
+		accepted, batchErr = logger.logTaggedBatch(tag, entries)
+	} else {
+		accepted, batchErr = logger.LogBatch(entries)
+	}
+	lm.releaseLogger(logger)
+	return accepted, firstError(err, batchErr)
+}
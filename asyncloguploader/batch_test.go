@@ -0,0 +1,182 @@
+package asyncloguploader
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeBatch returns count distinct entries of about size bytes
+func makeBatch(count, size int) [][]byte {
+	entries := make([][]byte, count)
+	for i := range entries {
+		entry := make([]byte, size)
+		copy(entry, fmt.Sprintf("entry-%06d", i))
+		entries[i] = entry
+	}
+	return entries
+}
+
+func TestLogger_LogBatch(t *testing.T) {
+	newBatchLogger := func(t *testing.T) (*Logger, string) {
+		t.Helper()
+		dir := t.TempDir()
+		config := DefaultConfig(filepath.Join(dir, "batch.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 1
+		config.FlushInterval = time.Hour
+		config.WriteRetryTimeout = 0
+		config.MaxMessageSize = 1024
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		t.Cleanup(func() { logger.Close() })
+		return logger, dir
+	}
+
+	t.Run("WritesEntriesInOrder", func(t *testing.T) {
+		logger, dir := newBatchLogger(t)
+		entries := makeBatch(100, 64)
+
+		accepted, err := logger.LogBatch(entries)
+		require.NoError(t, err)
+		assert.Equal(t, 100, accepted)
+
+		stats := logger.loadStats()
+		assert.Equal(t, int64(100), stats.TotalLogs)
+		assert.Equal(t, int64(100*(lengthPrefixSize+64)), stats.BytesWritten)
+		assert.Equal(t, int64(100), stats.FastPathWrites)
+		assert.Equal(t, int64(100), logger.GetShardStats()[0].Writes)
+
+		require.NoError(t, logger.Close())
+		messages, _ := readAllMessages(t, findLogFile(t, dir, "batch"))
+		assert.Equal(t, entries, messages)
+	})
+
+	t.Run("RejectsEntriesIndividually", func(t *testing.T) {
+		logger, _ := newBatchLogger(t)
+		entries := [][]byte{[]byte("first"), make([]byte, 2048), []byte("last")}
+
+		accepted, err := logger.LogBatch(entries)
+		assert.Equal(t, 2, accepted)
+		assert.ErrorIs(t, err, ErrOversized)
+
+		stats := logger.loadStats()
+		assert.Equal(t, int64(3), stats.TotalLogs)
+		assert.Equal(t, int64(1), stats.OversizedLogs)
+		assert.Zero(t, stats.DroppedLogs)
+	})
+
+	t.Run("AcceptsWhatFitsWhenBuffersAreFull", func(t *testing.T) {
+		logger, _ := newBatchLogger(t)
+		shard := logger.shardCollection.Load().GetShard(0)
+		shard.swapSemaphore <- struct{}{}
+		defer func() { <-shard.swapSemaphore }()
+
+		// Room for exactly two 10-byte entries in the active buffer; the inactive one is full
+		shard.offsetA.Store(shard.limit - 2*(lengthPrefixSize+10))
+		shard.offsetB.Store(shard.capacity)
+
+		accepted, err := logger.LogBatch(makeBatch(5, 10))
+		assert.Equal(t, 2, accepted)
+		assert.ErrorIs(t, err, ErrBufferFull)
+
+		stats := logger.loadStats()
+		assert.Equal(t, int64(5), stats.TotalLogs)
+		assert.Equal(t, int64(3), stats.DroppedLogs)
+		assert.Equal(t, int64(3), logger.GetShardStats()[0].Drops)
+	})
+
+	t.Run("ClosedLoggerDropsBatch", func(t *testing.T) {
+		logger, _ := newBatchLogger(t)
+		require.NoError(t, logger.Close())
+
+		accepted, err := logger.LogBatch(makeBatch(4, 10))
+		assert.Zero(t, accepted)
+		assert.ErrorIs(t, err, ErrClosed)
+		assert.Equal(t, int64(4), logger.loadStats().DroppedLogs)
+	})
+}
+
+func TestLoggerManager_LogBatchWithEvent(t *testing.T) {
+	config := newGuardTestConfig(t)
+	config.AllowedEvents = []string{"payment"}
+
+	manager, err := NewLoggerManager(config)
+	require.NoError(t, err)
+	defer manager.Close()
+
+	accepted, err := manager.LogBatchWithEvent("payment", makeBatch(10, 32))
+	require.NoError(t, err)
+	assert.Equal(t, 10, accepted)
+	require.NoError(t, manager.FlushAll(context.Background()))
+
+	accepted, err = manager.LogBatchWithEvent("unknown", makeBatch(4, 32))
+	assert.Zero(t, accepted)
+	assert.ErrorIs(t, err, ErrEventNotAllowed)
+
+	rejected, _ := manager.GetEventRejectStats()
+	assert.Equal(t, int64(4), rejected)
+	totalLogs, droppedLogs, _, _, _, _, _, _ := manager.GetAggregatedStats()
+	assert.Equal(t, int64(14), totalLogs)
+	assert.Equal(t, int64(4), droppedLogs)
+}
+
+// discardFileWriter drops flushed data, so benchmarks measure the logging path rather than the disk
+type discardFileWriter struct {
+	FileWriter
+}
+
+func (w *discardFileWriter) WriteVectored(buffers [][]byte) (int, error) {
+	n := 0
+	for _, buf := range buffers {
+		n += len(buf)
+	}
+	return n, nil
+}
+
+func BenchmarkLogBatch(b *testing.B) {
+	const batchSize = 100
+	entries := makeBatch(batchSize, 128)
+
+	run := func(b *testing.B, logBatch func(*Logger)) {
+		config := DefaultConfig(filepath.Join(b.TempDir(), "bench.log"))
+		config.BufferSize = 64 * 1024 * 1024
+		config.NumShards = 8
+		config.InternalLogger = &captureLogger{}
+
+		logger, err := NewLogger(config)
+		require.NoError(b, err)
+		defer logger.Close()
+		for _, g := range logger.groups {
+			g.fileWriter = &discardFileWriter{FileWriter: g.fileWriter}
+		}
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			logBatch(logger)
+		}
+		b.StopTimer()
+		b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*batchSize), "ns/entry")
+		_, dropped, _, _, _, _, _, _ := logger.GetStatsSnapshot()
+		b.ReportMetric(float64(dropped)/float64(b.N*batchSize), "drops/entry")
+	}
+
+	b.Run("LoopedLogBytes", func(b *testing.B) {
+		run(b, func(logger *Logger) {
+			for _, entry := range entries {
+				logger.LogBytes(entry)
+			}
+		})
+	})
+	b.Run("LogBatch", func(b *testing.B) {
+		run(b, func(logger *Logger) {
+			logger.LogBatch(entries)
+		})
+	})
+}
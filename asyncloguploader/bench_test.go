@@ -0,0 +1,170 @@
+package asyncloguploader
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Standard benchmark suite (run with `make bench`): LogBytes at fixed payload sizes, parallel LogBytes,
+// flushShardsEnhanced alone, and end-to-end throughput. The writers keep the disk out of the numbers;
+// allocs/op is reported so the zero-allocation write path stays zero-allocation
+
+// benchPayloadSizes are the LogBytes payloads every write benchmark covers
+var benchPayloadSizes = []struct {
+	name string
+	size int
+}{
+	{"64B", 64},
+	{"1KB", 1024},
+	{"300KB", 300 * 1024},
+}
+
+// memFileWriter copies every flush into memory, standing in for an infinitely fast disk
+// The copy is overwritten by the next flush, so memory stays bounded however long the benchmark runs
+type memFileWriter struct {
+	FileWriter
+	mu      sync.Mutex
+	data    []byte
+	written int64
+}
+
+func (w *memFileWriter) WriteVectored(buffers [][]byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.data = w.data[:0]
+	for _, buf := range buffers {
+		w.data = append(w.data, buf...)
+	}
+	w.written += int64(len(w.data))
+	return len(w.data), nil
+}
+
+// newBenchLogger creates a logger with 8MB shards (room for 300KB payloads) whose flush workers
+// write through wrap
+func newBenchLogger(b *testing.B, wrap func(FileWriter) FileWriter) *Logger {
+	b.Helper()
+	config := DefaultConfig(filepath.Join(b.TempDir(), "bench.log"))
+	config.BufferSize = 64 * 1024 * 1024
+	config.NumShards = 8
+	config.InternalLogger = &captureLogger{}
+	logger, err := NewLogger(config)
+	require.NoError(b, err)
+	for _, g := range logger.groups {
+		g.fileWriter = wrap(g.fileWriter)
+	}
+	b.Cleanup(func() { logger.Close() })
+	return logger
+}
+
+// discard wraps a file writer in a discardFileWriter
+func discard(w FileWriter) FileWriter {
+	return &discardFileWriter{FileWriter: w}
+}
+
+// reportDrops reports the share of the benchmark's logs that were dropped
+func reportDrops(b *testing.B, logger *Logger) {
+	totalLogs, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
+	if totalLogs > 0 {
+		b.ReportMetric(float64(droppedLogs)/float64(totalLogs), "drops/op")
+	}
+}
+
+func BenchmarkLogBytes(b *testing.B) {
+	for _, payload := range benchPayloadSizes {
+		b.Run(payload.name, func(b *testing.B) {
+			logger := newBenchLogger(b, discard)
+			msg := make([]byte, payload.size)
+
+			b.ReportAllocs()
+			b.SetBytes(int64(payload.size))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				logger.LogBytes(msg)
+			}
+			b.StopTimer()
+			reportDrops(b, logger)
+		})
+	}
+}
+
+func BenchmarkLogBytesParallel(b *testing.B) {
+	for _, goroutines := range []int{8, 64} {
+		for _, payload := range benchPayloadSizes {
+			b.Run(fmt.Sprintf("goroutines=%d/%s", goroutines, payload.name), func(b *testing.B) {
+				logger := newBenchLogger(b, discard)
+
+				b.ReportAllocs()
+				b.SetBytes(int64(payload.size))
+				// RunParallel starts parallelism * GOMAXPROCS goroutines
+				b.SetParallelism((goroutines + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0))
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					msg := make([]byte, payload.size)
+					for pb.Next() {
+						logger.LogBytes(msg)
+					}
+				})
+				b.StopTimer()
+				reportDrops(b, logger)
+			})
+		}
+	}
+}
+
+// BenchmarkFlushShards measures one flush of all shards, each holding 1MB of 1KB entries
+func BenchmarkFlushShards(b *testing.B) {
+	logger := newBenchLogger(b, discard)
+	g := logger.groups[0]
+	msg := make([]byte, 1024)
+	entries := len(g.shards) * 1024
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		for j := 0; j < entries; j++ {
+			require.NoError(b, logger.TryLogBytes(msg))
+		}
+		b.StartTimer()
+		require.NoError(b, logger.flushShardsWithData(g, g.shards))
+	}
+}
+
+// BenchmarkThroughput measures logging and flushing end to end, with 64 goroutines logging 1KB entries
+// into an in-memory writer; flushed-MB/s counts what reached the writer, including headers and padding
+func BenchmarkThroughput(b *testing.B) {
+	var writers []*memFileWriter
+	logger := newBenchLogger(b, func(w FileWriter) FileWriter {
+		mem := &memFileWriter{FileWriter: w}
+		writers = append(writers, mem)
+		return mem
+	})
+
+	b.ReportAllocs()
+	b.SetBytes(1024)
+	b.SetParallelism((64 + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		msg := make([]byte, 1024)
+		for pb.Next() {
+			logger.LogBytes(msg)
+		}
+	})
+	require.NoError(b, logger.Flush(context.Background()))
+	b.StopTimer()
+
+	var written int64
+	for _, w := range writers {
+		w.mu.Lock()
+		written += w.written
+		w.mu.Unlock()
+	}
+	b.ReportMetric(float64(written)/1e6/b.Elapsed().Seconds(), "flushed-MB/s")
+	reportDrops(b, logger)
+}
@@ -0,0 +1,182 @@
+package asyncloguploader
+
+import "time"
+
+// bufferResizer decides after each flush interval whether to grow or shrink the shard buffers
+// (Config.MaxBufferSize). Only used by the ticker worker, so it needs no synchronization
+type bufferResizer struct {
+	lastDrops      int64 // Buffer-full drops at the last interval
+	lastWritten    int64 // BytesWritten at the last interval
+	quietIntervals int   // Consecutive intervals below BufferShrinkUtilization
+}
+
+func newBufferResizer(l *Logger) *bufferResizer {
+	return &bufferResizer{
+		lastDrops:   bufferDrops(&l.stats),
+		lastWritten: l.stats.BytesWritten.Load(),
+	}
+}
+
+// bufferDrops returns the logs dropped for lack of buffer space (free-space and disk-full drops excluded)
+func bufferDrops(stats *Statistics) int64 {
+	return stats.DroppedLogs.Load() - stats.FreeSpaceDrops.Load() - stats.DiskFullDrops.Load()
+}
+
+// nextSize returns the buffer size to switch to after a flush interval, or 0 to keep current
+// More than BufferGrowDrops drops double the size, up to MaxBufferSize. BufferShrinkIntervals
+// intervals in a row whose traffic stays below BufferShrinkUtilization of the buffers halve it,
+// down to BufferSize
+func (r *bufferResizer) nextSize(config Config, stats *Statistics, current int) int {
+	drops, written := bufferDrops(stats), stats.BytesWritten.Load()
+	newDrops, newBytes := drops-r.lastDrops, written-r.lastWritten
+	r.lastDrops, r.lastWritten = drops, written
+
+	if newDrops > config.BufferGrowDrops {
+		r.quietIntervals = 0
+		if current >= config.MaxBufferSize {
+			return 0
+		}
+		return min(2*current, config.MaxBufferSize)
+	}
+
+	if current <= config.BufferSize || float64(newBytes) >= config.BufferShrinkUtilization*float64(current) {
+		r.quietIntervals = 0
+		return 0
+	}
+	r.quietIntervals++
+	if r.quietIntervals < config.BufferShrinkIntervals {
+		return 0
+	}
+	r.quietIntervals = 0
+	return max(current/2, config.BufferSize)
+}
+
+// autoResize resizes the buffers if the last flush interval calls for it (called on each tick)
+func (l *Logger) autoResize(resizer *bufferResizer) {
+	current := l.shardCollection.Load().BufferSize()
+	size := resizer.nextSize(l.config, &l.stats, current)
+	if size == 0 {
+		return
+	}
+	if !l.resizeBuffers(size) {
+		return
+	}
+	if size > current {
+		l.stats.BufferGrowths.Add(1)
+		l.config.InternalLogger.Printf("[WARNING] Logs dropped for %s, buffers grown from %d to %d bytes",
+			l.config.LogFilePath, current, size)
+	} else {
+		l.stats.BufferShrinks.Add(1)
+	}
+}
+
+// shardSwap is one step of a resize, run by a flush worker (see Logger.swapGroupShards)
+type shardSwap struct {
+	shards []*Shard   // The group's shards in the new set; nil to drop the retired shards
+	done   chan error // Receives the flush result (buffered)
+}
+
+// resizeBuffers replaces the shard collection with one of size bytes
+// Each flush worker first adopts its shards of the new set and keeps the old ones as retired,
+// flushing them ahead of their replacements. Writers then switch to the new set; once no write
+// to the old set is in progress, the workers write what it still holds and it is released.
+// Both sets are allocated meanwhile. The new buffers are not registered with io_uring.
+// Returns false if the set could not be allocated or the logger closed first
+func (l *Logger) resizeBuffers(size int) bool {
+	old := l.shardCollection.Load()
+	next, err := newShardSet(l.config, size, l.flushTimeout)
+	if err != nil {
+		l.config.InternalLogger.Printf("[WARNING] Failed to resize buffers for %s to %d bytes: %v",
+			l.config.LogFilePath, size, err)
+		return false
+	}
+	next.flushChans = old.flushChans
+	next.coalesced = old.coalesced
+	next.spilled = old.spilled
+
+	groupShards := make([][]*Shard, len(l.groups))
+	for _, shard := range next.Shards() {
+		i := int(shard.ID()) % len(l.groups)
+		groupShards[i] = append(groupShards[i], shard)
+	}
+	for i, g := range l.groups {
+		if !l.runShardSwap(g, groupShards[i]) {
+			l.spareShards = next // Flushed and released by Close
+			return false
+		}
+	}
+
+	l.shardCollection.Store(next)
+	// After the store, so a concurrent UpdateConfig reaches next either way (see applyFlushThresholds)
+	l.applyFlushThresholds(next)
+	for old.writers.Load() > 0 {
+		select {
+		case <-l.life.Done():
+			l.spareShards = old
+			return false
+		default:
+		}
+		time.Sleep(chunkRetryInterval)
+	}
+
+	for _, g := range l.groups {
+		if !l.runShardSwap(g, nil) {
+			l.spareShards = old
+			return false
+		}
+	}
+	old.Close()
+	return true
+}
+
+// runShardSwap hands one resize step to g's flush worker and waits for it
+// Returns false if the logger closed before the worker took it. Flush errors are counted by the
+// flush itself, so the step's result is not needed here
+func (l *Logger) runShardSwap(g *flushGroup, shards []*Shard) bool {
+	swap := shardSwap{shards: shards, done: make(chan error, 1)}
+	select {
+	case g.swaps <- swap:
+	case <-l.life.Done():
+		return false
+	}
+	<-swap.done
+	return true
+}
+
+// swapGroupShards runs a resize step on g's flush worker: with shards set, the group flushes them
+// from now on and keeps its previous shards as retired; with shards nil, the retired shards are
+// flushed, along with every other shard of the group holding data, and dropped
+func (l *Logger) swapGroupShards(g *flushGroup, shards []*Shard) error {
+	if shards != nil {
+		g.retired, g.shards = g.shards, shards
+		return nil
+	}
+	err := l.flushAllShards(g)
+	g.retired = nil
+	return err
+}
+
+// acquireShards returns the shard collection to write to
+// With auto-resize the write is counted on the collection, so that a resize does not flush and
+// release it while the write is in progress; releaseShards ends it
+func (l *Logger) acquireShards() *ShardCollection {
+	if l.config.MaxBufferSize == 0 {
+		return l.shardCollection.Load()
+	}
+	for {
+		sc := l.shardCollection.Load()
+		sc.writers.Add(1)
+		if l.shardCollection.Load() == sc {
+			return sc
+		}
+		// Replaced meanwhile: the resize may already be waiting for the old set's writers
+		sc.writers.Add(-1)
+	}
+}
+
+// releaseShards ends a write started with acquireShards
+func (l *Logger) releaseShards(sc *ShardCollection) {
+	if l.config.MaxBufferSize != 0 {
+		sc.writers.Add(-1)
+	}
+}
@@ -0,0 +1,175 @@
+package asyncloguploader
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger_BufferResize(t *testing.T) {
+	t.Run("ValidatesConfig", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		config.BufferSize = 8 * 1024 * 1024
+		config.MaxBufferSize = 64 * 1024 * 1024
+		require.NoError(t, config.Validate())
+		assert.Equal(t, 0.1, config.BufferShrinkUtilization)
+		assert.Equal(t, 5, config.BufferShrinkIntervals)
+
+		config.MaxBufferSize = 4 * 1024 * 1024 // Below BufferSize
+		assert.Error(t, config.Validate())
+
+		config.MaxBufferSize = 64 * 1024 * 1024
+		config.BufferShrinkUtilization = 1
+		assert.Error(t, config.Validate())
+
+		config.BufferShrinkUtilization = 0.1
+		config.BufferGrowDrops = -1
+		assert.Error(t, config.Validate())
+	})
+
+	t.Run("DecidesSize", func(t *testing.T) {
+		config := Config{
+			BufferSize:              8 << 20,
+			MaxBufferSize:           32 << 20,
+			BufferGrowDrops:         10,
+			BufferShrinkUtilization: 0.5,
+			BufferShrinkIntervals:   2,
+		}
+		var stats Statistics
+		r := &bufferResizer{}
+
+		// Drops up to the threshold are tolerated, more double the size up to the maximum
+		stats.DroppedLogs.Add(10)
+		stats.BytesWritten.Add(100 << 20)
+		assert.Equal(t, 0, r.nextSize(config, &stats, 8<<20))
+		stats.DroppedLogs.Add(11)
+		assert.Equal(t, 16<<20, r.nextSize(config, &stats, 8<<20))
+		stats.DroppedLogs.Add(11)
+		assert.Equal(t, 32<<20, r.nextSize(config, &stats, 16<<20))
+		stats.DroppedLogs.Add(11)
+		assert.Equal(t, 0, r.nextSize(config, &stats, 32<<20))
+
+		// Free-space drops are not a buffer problem
+		stats.DroppedLogs.Add(100)
+		stats.FreeSpaceDrops.Add(100)
+		stats.BytesWritten.Add(100 << 20)
+		assert.Equal(t, 0, r.nextSize(config, &stats, 16<<20))
+
+		// Halved after two quiet intervals in a row, never below BufferSize
+		stats.BytesWritten.Add(1 << 20)
+		assert.Equal(t, 0, r.nextSize(config, &stats, 16<<20))
+		stats.BytesWritten.Add(9 << 20) // Busy interval resets the count
+		assert.Equal(t, 0, r.nextSize(config, &stats, 16<<20))
+		stats.BytesWritten.Add(1 << 20)
+		assert.Equal(t, 0, r.nextSize(config, &stats, 16<<20))
+		assert.Equal(t, 8<<20, r.nextSize(config, &stats, 16<<20))
+		assert.Equal(t, 0, r.nextSize(config, &stats, 8<<20))
+		assert.Equal(t, 0, r.nextSize(config, &stats, 8<<20))
+	})
+
+	t.Run("GrowsUnderBurstAndShrinksBack", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("soak test")
+		}
+		dir := t.TempDir()
+		config := DefaultConfig(filepath.Join(dir, "app.log"))
+		config.BufferSize = 8 * 1024 * 1024
+		config.MaxBufferSize = 64 * 1024 * 1024
+		config.NumShards = 8
+		config.FlushInterval = 50 * time.Millisecond
+		config.WriteRetryTimeout = 0
+		config.BufferShrinkIntervals = 2
+		config.InternalLogger = &captureLogger{}
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		path := logger.groups[0].fileWriter.(*SizeFileWriter).filePath
+		assert.Equal(t, int64(8*1024*1024), logger.Snapshot().BufferSize)
+
+		// Burst: writers outrun the flushes until the buffers reach MaxBufferSize
+		var nextSeq atomic.Uint64
+		var acceptedMu sync.Mutex
+		var accepted []uint64
+		stop := make(chan struct{})
+		var writers sync.WaitGroup
+		for w := 0; w < 8; w++ {
+			writers.Add(1)
+			go func() {
+				defer writers.Done()
+				msg := make([]byte, 1024)
+				var mine []uint64
+				for {
+					select {
+					case <-stop:
+						acceptedMu.Lock()
+						accepted = append(accepted, mine...)
+						acceptedMu.Unlock()
+						return
+					default:
+					}
+					seq := nextSeq.Add(1)
+					binary.LittleEndian.PutUint64(msg, seq)
+					if logger.TryLogBytes(msg) == nil {
+						mine = append(mine, seq)
+					}
+				}
+			}()
+		}
+		grown := assert.Eventually(t, func() bool {
+			return logger.Snapshot().Stats.BufferGrowths == 3 // 8 -> 16 -> 32 -> 64MB
+		}, 20*time.Second, 10*time.Millisecond)
+		close(stop)
+		writers.Wait()
+		require.True(t, grown, "buffers did not grow to MaxBufferSize")
+
+		snap := logger.Snapshot()
+		assert.Equal(t, int64(config.MaxBufferSize), snap.BufferSize)
+		assert.Equal(t, int64(2*config.MaxBufferSize-2*config.NumShards*int(headerOffset)), snap.BufferCapacity)
+		assert.Greater(t, snap.Stats.DroppedLogs, int64(0))
+
+		// Quiet: back to BufferSize, one halving per two intervals
+		require.Eventually(t, func() bool {
+			return logger.Snapshot().Stats.BufferShrinks == 3
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, int64(config.BufferSize), logger.Snapshot().BufferSize)
+		require.NoError(t, logger.Close())
+
+		// Every accepted entry reached the file exactly once, across all buffer sets
+		got := readResizeSequences(t, path)
+		sort.Slice(accepted, func(a, b int) bool { return accepted[a] < accepted[b] })
+		require.Equal(t, len(accepted), len(got))
+		assert.True(t, slices.Equal(accepted, got), "flushed entries differ from accepted ones")
+	})
+}
+
+// readResizeSequences reads the sequence number at the start of each entry in path, sorted
+func readResizeSequences(t *testing.T, path string) []uint64 {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var seqs []uint64
+	reader := NewReader(f)
+	for {
+		msg, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		seqs = append(seqs, binary.LittleEndian.Uint64(msg))
+	}
+	sort.Slice(seqs, func(a, b int) bool { return seqs[a] < seqs[b] })
+	return seqs
+}
@@ -0,0 +1,153 @@
+package asyncloguploader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// payloadBytes sums the lengths of messages
+func payloadBytes(messages [][]byte) int64 {
+	var n int64
+	for _, msg := range messages {
+		n += int64(len(msg))
+	}
+	return n
+}
+
+func TestLogger_ByteAccounting(t *testing.T) {
+	t.Run("CountsPayloadOnly", func(t *testing.T) {
+		logger, tmpDir := newSizeTestLogger(t, "payload", nil)
+		messages := [][]byte{[]byte("a"), []byte("bb"), bytes.Repeat([]byte{'c'}, 1000)}
+		for _, msg := range messages {
+			require.NoError(t, logger.TryLogBytes(msg))
+		}
+		batch := [][]byte{[]byte("batch one"), []byte("batch two")}
+		accepted, err := logger.LogBatch(batch)
+		require.NoError(t, err)
+		require.Equal(t, 2, accepted)
+		messages = append(messages, batch...)
+
+		require.NoError(t, logger.Flush(context.Background()))
+		_, _, bytesWritten, _, _, _, bytesBuffered, bytesDurable := logger.GetStatsSnapshot()
+		want := payloadBytes(messages)
+		assert.Equal(t, want, bytesBuffered)
+		assert.Equal(t, want, bytesDurable)
+		assert.Equal(t, want+int64(len(messages)*lengthPrefixSize), bytesWritten, "BytesWritten keeps counting length prefixes")
+		require.NoError(t, logger.Close())
+
+		onDisk, _ := readAllMessages(t, findLogFile(t, tmpDir, "payload"))
+		assert.Equal(t, want, payloadBytes(onDisk))
+	})
+
+	t.Run("ChunkHeadersAreNotPayload", func(t *testing.T) {
+		logger, tmpDir := newSizeTestLogger(t, "chunked", func(c *Config) {
+			c.AllowChunking = true
+			c.MaxMessageSize = 1024 * 1024
+		})
+		large := bytes.Repeat([]byte{'x'}, 600*1024) // More than two 256KB shards
+		require.NoError(t, logger.TryLogBytes(large))
+		require.NoError(t, logger.Close())
+
+		snap := logger.Snapshot()
+		assert.Equal(t, int64(len(large)), snap.Stats.BytesBuffered)
+		assert.Equal(t, int64(len(large)), snap.Stats.BytesDurable)
+		assert.Greater(t, snap.Stats.BytesWritten, snap.Stats.BytesBuffered)
+
+		onDisk, _ := readAllMessages(t, findLogFile(t, tmpDir, "chunked"))
+		require.Len(t, onDisk, 1)
+		assert.Equal(t, large, onDisk[0])
+	})
+
+	t.Run("ExcludesLostFlushes", func(t *testing.T) {
+		logger, writer, _, tmpDir := newDiskFullTestLogger(t, nil)
+		lost := logMessages(t, logger, "lost", 10)
+		writer.setErr(fmt.Errorf("vectored I/O write failed: %w", syscall.EIO))
+		assert.Error(t, logger.Flush(context.Background()))
+		assert.Equal(t, int64(10), logger.stats.EntriesLost.Load())
+		assert.Zero(t, logger.stats.BytesDurable.Load())
+
+		writer.setErr(nil)
+		kept := logMessages(t, logger, "kept", 10)
+		require.NoError(t, logger.Close())
+
+		snap := logger.Snapshot()
+		assert.Equal(t, payloadBytes(lost)+payloadBytes(kept), snap.Stats.BytesBuffered)
+		assert.Equal(t, payloadBytes(kept), snap.Stats.BytesDurable)
+
+		onDisk, _ := readAllMessages(t, findLogFile(t, tmpDir, "full"))
+		assert.Equal(t, payloadBytes(kept), payloadBytes(onDisk))
+	})
+
+	t.Run("CountsRetriedFlushesOnce", func(t *testing.T) {
+		logger, writer, _, tmpDir := newDiskFullTestLogger(t, nil)
+		messages := logMessages(t, logger, "retried", 50)
+		writer.setErr(enospc)
+		assert.Error(t, logger.Flush(context.Background()))
+		assert.Zero(t, logger.stats.BytesDurable.Load(), "retained data is not durable yet")
+
+		writer.setErr(nil)
+		require.Eventually(t, func() bool { return !logger.IsDiskFull() }, 5*time.Second, 10*time.Millisecond)
+		require.NoError(t, logger.Close())
+
+		snap := logger.Snapshot()
+		assert.Equal(t, payloadBytes(messages), snap.Stats.BytesBuffered)
+		assert.Equal(t, payloadBytes(messages), snap.Stats.BytesDurable)
+
+		onDisk, _ := readAllMessages(t, findLogFile(t, tmpDir, "full"))
+		assert.Equal(t, payloadBytes(messages), payloadBytes(onDisk))
+	})
+
+	t.Run("AcrossRotation", func(t *testing.T) {
+		logger, _ := newSizeTestLogger(t, "rotate", func(c *Config) {
+			c.NumShards = 2
+			c.MaxFileSize = 512 * 1024 // A flush writes the file header and a whole 512KB shard, so every later flush rotates
+		})
+		var messages [][]byte
+		for i := 0; i < 3; i++ {
+			msg := []byte(fmt.Sprintf("file %d", i))
+			require.NoError(t, logger.TryLogBytes(msg))
+			messages = append(messages, msg)
+			require.NoError(t, logger.Flush(context.Background()))
+		}
+		require.NoError(t, logger.Close())
+
+		files := logger.RotatedFiles()
+		require.Len(t, files, 3)
+		var onDisk [][]byte
+		for _, info := range files {
+			fileMessages, _ := readAllMessages(t, info.OldPath)
+			onDisk = append(onDisk, fileMessages...)
+		}
+		assert.Equal(t, messages, onDisk)
+
+		snap := logger.Snapshot()
+		assert.Equal(t, payloadBytes(messages), snap.Stats.BytesBuffered)
+		assert.Equal(t, payloadBytes(messages), snap.Stats.BytesDurable)
+	})
+
+	t.Run("AggregatesEventLoggers", func(t *testing.T) {
+		manager, err := NewLoggerManager(newGuardTestConfig(t))
+		require.NoError(t, err)
+		defer manager.Close()
+
+		manager.LogWithEvent("payment", "12345")
+		manager.LogWithEvent("login", "abc")
+		require.NoError(t, manager.FlushAll(context.Background()))
+
+		_, _, _, _, _, _, bytesBuffered, bytesDurable := manager.GetAggregatedStats()
+		assert.Equal(t, int64(8), bytesBuffered)
+		assert.Equal(t, int64(8), bytesDurable)
+
+		_, _, _, _, _, _, bytesBuffered, bytesDurable, err = manager.GetEventStats("login")
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), bytesBuffered)
+		assert.Equal(t, int64(3), bytesDurable)
+	})
+}
@@ -0,0 +1,33 @@
+package asyncloguploader
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/internal/logcore"
+)
+
+// Shard format versions, stored in the low byte of the header's capacity field
+// Capacities are 512-byte aligned, so the low byte is always zero in version 0 (the original format)
+// The reader package decodes both versions
+const (
+	formatVersionChecksum = 1 // Shard ends with a CRC32C of its valid data bytes
+)
+
+// checksumTrailerSize is the CRC32C stored in the last 4 bytes of a version 1 shard
+const checksumTrailerSize = 4
+
+// castagnoliTable is the CRC32C table (hardware accelerated on amd64 and arm64)
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// sealShard writes the shard header into data[0:8] and, with checksums, the CRC32C trailer
+// data is the full shard buffer; validDataBytes counts the entry bytes after the header
+func sealShard(data []byte, capacity, validDataBytes int32, checksums bool) {
+	header := uint32(capacity)
+	if checksums {
+		header |= formatVersionChecksum
+		crc := crc32.Checksum(data[headerOffset:headerOffset+validDataBytes], castagnoliTable)
+		binary.LittleEndian.PutUint32(data[capacity-checksumTrailerSize:capacity], crc)
+	}
+	logcore.PutShardHeader(data, header, validDataBytes)
+}
@@ -0,0 +1,143 @@
+package asyncloguploader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asyncloguploader/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// firstShard decodes the first shard of a log file with the reader package
+func firstShard(t *testing.T, data []byte) reader.ShardInfo {
+	t.Helper()
+	var shards []reader.ShardInfo
+	r := reader.NewLogReader(bytes.NewReader(data), reader.Options{
+		OnShard: func(info reader.ShardInfo) { shards = append(shards, info) },
+	})
+	_, err := r.Next()
+	require.NoError(t, err)
+	require.NotEmpty(t, shards)
+	return shards[0]
+}
+
+func TestLogger_Checksums(t *testing.T) {
+	// writeMessages logs count messages and returns the single log file
+	writeMessages := func(t *testing.T, name string, enable bool, count int) string {
+		logger, tmpDir := newSizeTestLogger(t, name, func(c *Config) {
+			c.EnableChecksums = enable
+			c.WriteFileHeader = false // The first shard at offset 0
+		})
+		for i := 0; i < count; i++ {
+			logger.LogBytes([]byte(fmt.Sprintf("message %d", i)))
+		}
+		require.NoError(t, logger.Close())
+		return findLogFile(t, tmpDir, name)
+	}
+
+	t.Run("DefaultFormatUnchanged", func(t *testing.T) {
+		path := writeMessages(t, "plain", false, 10)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		shard := firstShard(t, data)
+		assert.Equal(t, 0, shard.Version)
+		assert.Equal(t, int64(0), shard.Capacity%512)
+	})
+
+	t.Run("WritesVersionAndChecksum", func(t *testing.T) {
+		path := writeMessages(t, "checksummed", true, 100)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		shard := firstShard(t, data)
+		assert.Equal(t, formatVersionChecksum, shard.Version)
+		assert.False(t, shard.BadChecksum)
+
+		messages, _ := readAllMessages(t, path)
+		assert.Len(t, messages, 100)
+	})
+
+	t.Run("DetectsFlippedBytes", func(t *testing.T) {
+		path := writeMessages(t, "flipped", true, 100)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		shard := firstShard(t, data)
+		firstShardEntries := 0
+		for pos := headerOffset; pos < headerOffset+int(shard.ValidDataBytes); firstShardEntries++ {
+			pos += lengthPrefixSize + int(binary.LittleEndian.Uint32(data[pos:]))
+		}
+		require.Less(t, firstShardEntries, 100, "messages should span several shards")
+
+		// Flip a payload byte: the entry still parses, so only the checksum can catch it
+		data[headerOffset+lengthPrefixSize] ^= 0xFF
+		require.Less(t, int(shard.Capacity), len(data))
+
+		reader := NewReader(bytes.NewReader(data))
+		var messages, corrupt int
+		for {
+			_, err := reader.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if errors.Is(err, ErrCorruptLog) {
+				corrupt++
+				continue
+			}
+			require.NoError(t, err)
+			messages++
+		}
+		assert.Equal(t, 1, corrupt)
+		assert.Equal(t, 100-firstShardEntries, messages)
+	})
+
+	t.Run("FullShardKeepsTrailer", func(t *testing.T) {
+		logger, tmpDir := newSizeTestLogger(t, "full", func(c *Config) { c.EnableChecksums = true })
+		payload := bytes.Repeat([]byte("x"), logger.maxEntry)
+		require.NoError(t, logger.TryLogBytes(payload))
+		assert.ErrorIs(t, logger.TryLogBytes(append(payload, 'x')), ErrOversized)
+		require.NoError(t, logger.Close())
+
+		messages, _ := readAllMessages(t, findLogFile(t, tmpDir, "full"))
+		require.Len(t, messages, 1)
+		assert.Equal(t, payload, messages[0])
+	})
+
+	t.Run("MaxMessageSizeExcludesTrailer", func(t *testing.T) {
+		config := DefaultConfig("/tmp/checksums.log")
+		require.NoError(t, config.Validate())
+		plainMax := config.MaxMessageSize
+
+		config = DefaultConfig("/tmp/checksums.log")
+		config.EnableChecksums = true
+		require.NoError(t, config.Validate())
+		assert.Equal(t, plainMax-checksumTrailerSize, config.MaxMessageSize)
+	})
+}
+
+// BenchmarkSealShard measures the flush-path cost of sealing a full shard with and without checksums
+func BenchmarkSealShard(b *testing.B) {
+	for _, size := range []int{256 * 1024, 8 * 1024 * 1024} {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		validDataBytes := int32(size - headerOffset - checksumTrailerSize)
+
+		for _, checksums := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%dKB/Checksums=%v", size/1024, checksums), func(b *testing.B) {
+				b.SetBytes(int64(validDataBytes))
+				for i := 0; i < b.N; i++ {
+					sealShard(data, int32(size), validDataBytes, checksums)
+				}
+			})
+		}
+	}
+}
@@ -3,14 +3,14 @@ package asyncloguploader
 import (
 	"context"
 	"fmt"
-	"log"
 
 	"cloud.google.com/go/storage"
 )
 
 // ChunkManager handles GCS compose operations with 32-chunk limit
 type ChunkManager struct {
-	maxChunksPerCompose int // Default: 32 (GCS limit)
+	maxChunksPerCompose int            // Default: 32 (GCS limit)
+	logger              InternalLogger // Receives cleanup warnings (set by NewUploader)
 }
 
 // NewChunkManager creates a new chunk manager
@@ -20,6 +20,7 @@ func NewChunkManager(maxChunksPerCompose int) *ChunkManager {
 	}
 	return &ChunkManager{
 		maxChunksPerCompose: maxChunksPerCompose,
+		logger:              defaultInternalLogger,
 	}
 }
 
@@ -125,7 +126,7 @@ func (cm *ChunkManager) cleanupObjects(ctx context.Context, client *storage.Clie
 	bkt := client.Bucket(bucket)
 	for _, obj := range objects {
 		if err := bkt.Object(obj).Delete(ctx); err != nil {
-			log.Printf("[WARNING] Failed to cleanup object %s: %v", obj, err)
+			cm.logger.Printf("[WARNING] Failed to cleanup object %s: %v", obj, err)
 		}
 	}
 }
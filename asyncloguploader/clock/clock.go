@@ -0,0 +1,64 @@
+// Package clock is the time source of the asyncloguploader Logger and Uploader: flush ticks, write
+// retry, flush and close timeouts, rotated file names, upload retry backoffs and the times naming
+// uploaded objects read it, so tests can drive them with a Fake instead of sleeping. Durations
+// that are measured rather than waited for (write, flush and upload latencies) use real time
+package clock
+
+import "time"
+
+// Clock tells the time and creates timers; Real is the wall clock
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+	NewTimer(d time.Duration) Timer
+	After(d time.Duration) <-chan time.Time
+}
+
+// Ticker is a time.Ticker created by a Clock
+type Ticker interface {
+	C() <-chan time.Time
+	Reset(d time.Duration)
+	Stop()
+}
+
+// Timer is a time.Timer created by a Clock
+type Timer interface {
+	C() <-chan time.Time
+	Reset(d time.Duration) bool
+	Stop() bool
+}
+
+// Real is the wall clock, backed by the time package
+type Real struct{}
+
+var _ Clock = Real{}
+
+// Now returns time.Now()
+func (Real) Now() time.Time { return time.Now() }
+
+// NewTicker returns a time.NewTicker
+func (Real) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+
+// NewTimer returns a time.NewTimer
+func (Real) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+// After returns time.After(d)
+func (Real) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// realTicker adapts *time.Ticker to Ticker
+type realTicker struct{ *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// realTimer adapts *time.Timer to Timer
+type realTimer struct{ *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.Timer.C }
+
+// OrReal returns c, or Real if c is nil
+func OrReal(c Clock) Clock {
+	if c == nil {
+		return Real{}
+	}
+	return c
+}
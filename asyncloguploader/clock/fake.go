@@ -0,0 +1,194 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a Clock that only moves when told to. Its timers and tickers fire during Advance, in
+// deadline order, with Now set to each deadline; like the time package's, a ticker whose last
+// tick was not received skips ticks instead of queueing them. Code under test usually creates its
+// timers on other goroutines, so tests call BlockUntil before advancing past them:
+//
+//	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+//	config.Clock = fake
+//	uploader, _ := asyncloguploader.NewUploaderWithBackend(config, backend)
+//	uploader.Start()
+//	uploader.GetUploadChannel() <- path // The upload fails
+//	fake.BlockUntil(1)                  // The retry backoff
+//	fake.Advance(config.MaxBackoff)     // Retries once
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+	changed chan struct{} // Closed and replaced whenever waiters changes, for BlockUntil
+}
+
+// fakeWaiter is a pending Fake timer or ticker
+type fakeWaiter struct {
+	fake   *Fake
+	c      chan time.Time
+	when   time.Time
+	period time.Duration // 0 for timers
+}
+
+var _ Clock = (*Fake)(nil)
+
+// NewFake returns a Fake reading start
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start, changed: make(chan struct{})}
+}
+
+// Now returns the fake time
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// NewTicker returns a ticker firing every d of fake time
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for clock.Fake.NewTicker")
+	}
+	w := &fakeWaiter{fake: f, c: make(chan time.Time, 1)}
+	f.schedule(w, d, d)
+	return fakeTicker{w}
+}
+
+// NewTimer returns a timer firing once d of fake time has passed (at the next Advance if d <= 0)
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	w := &fakeWaiter{fake: f, c: make(chan time.Time, 1)}
+	f.schedule(w, d, 0)
+	return fakeTimer{w}
+}
+
+// After returns NewTimer(d).C()
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// Advance moves the fake time forward by d, firing the timers and tickers due on the way
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	end := f.now.Add(d)
+	for len(f.waiters) > 0 && !f.waiters[0].when.After(end) {
+		w := f.waiters[0]
+		f.now = w.when
+		skipped := false
+		select {
+		case w.c <- w.when:
+		default: // Not received yet: skip the tick
+			skipped = true
+		}
+		f.removeLocked(w)
+		if w.period > 0 {
+			if skipped {
+				// Every later tick up to end would be skipped too
+				w.when = w.when.Add(end.Sub(w.when) / w.period * w.period)
+			}
+			w.when = w.when.Add(w.period)
+			f.insertLocked(w)
+		}
+	}
+	f.now = end
+}
+
+// Waiters returns the number of timers and tickers that have not fired or been stopped
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// BlockUntil waits until at least n timers and tickers are pending
+func (f *Fake) BlockUntil(n int) {
+	for {
+		f.mu.Lock()
+		pending, changed := len(f.waiters), f.changed
+		f.mu.Unlock()
+		if pending >= n {
+			return
+		}
+		<-changed
+	}
+}
+
+// schedule (re)arms w to fire d from now and every period after (0 for timers), discarding a tick
+// that was not received as the time package does since Go 1.23; reports whether w was pending
+func (f *Fake) schedule(w *fakeWaiter, d, period time.Duration) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	active := f.stopLocked(w)
+	w.when, w.period = f.now.Add(d), period
+	f.insertLocked(w)
+	return active
+}
+
+// stop disarms w like schedule and reports whether it was pending
+func (f *Fake) stop(w *fakeWaiter) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stopLocked(w)
+}
+
+// stopLocked removes w and discards its unreceived tick
+func (f *Fake) stopLocked(w *fakeWaiter) bool {
+	select {
+	case <-w.c:
+	default:
+	}
+	return f.removeLocked(w)
+}
+
+// insertLocked adds w in deadline order (after waiters with the same deadline)
+func (f *Fake) insertLocked(w *fakeWaiter) {
+	i := sort.Search(len(f.waiters), func(i int) bool { return f.waiters[i].when.After(w.when) })
+	f.waiters = append(f.waiters, nil)
+	copy(f.waiters[i+1:], f.waiters[i:])
+	f.waiters[i] = w
+	f.notifyLocked()
+}
+
+// removeLocked removes w if pending and reports whether it was
+func (f *Fake) removeLocked(w *fakeWaiter) bool {
+	for i, pending := range f.waiters {
+		if pending == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			f.notifyLocked()
+			return true
+		}
+	}
+	return false
+}
+
+// notifyLocked wakes BlockUntil callers
+func (f *Fake) notifyLocked() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// fakeTicker is the Ticker of Fake.NewTicker
+type fakeTicker struct{ w *fakeWaiter }
+
+func (t fakeTicker) C() <-chan time.Time { return t.w.c }
+
+func (t fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("non-positive interval for clock.Fake ticker Reset")
+	}
+	t.w.fake.schedule(t.w, d, d)
+}
+
+func (t fakeTicker) Stop() { t.w.fake.stop(t.w) }
+
+// fakeTimer is the Timer of Fake.NewTimer
+type fakeTimer struct{ w *fakeWaiter }
+
+func (t fakeTimer) C() <-chan time.Time { return t.w.c }
+
+func (t fakeTimer) Reset(d time.Duration) bool { return t.w.fake.schedule(t.w, d, 0) }
+
+func (t fakeTimer) Stop() bool { return t.w.fake.stop(t.w) }
@@ -0,0 +1,254 @@
+package asyncloguploader
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CompressionCodec compresses rotated files for Config.Compression
+type CompressionCodec struct {
+	Extension       string // Appended to the rotated file name, e.g. ".gz" (app_<timestamp>.log.gz)
+	ContentEncoding string // Content-Encoding set on uploaded objects, e.g. "gzip"
+
+	// NewWriter wraps w in a compressing writer; Close must flush the compressed stream
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+var (
+	compressionCodecsMu sync.RWMutex
+	compressionCodecs   = map[string]CompressionCodec{
+		"gzip": {
+			Extension:       ".gz",
+			ContentEncoding: "gzip",
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+				return gzip.NewWriter(w), nil
+			},
+		},
+	}
+)
+
+// RegisterCompression makes a codec available as Config.Compression = name
+// gzip is built in. zstd is not, to keep the module free of a compression dependency; register it
+// with any zstd implementation, e.g. github.com/klauspost/compress/zstd:
+//
+//	asyncloguploader.RegisterCompression("zstd", asyncloguploader.CompressionCodec{
+//		Extension:       ".zst",
+//		ContentEncoding: "zstd",
+//		NewWriter:       func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) },
+//	})
+func RegisterCompression(name string, codec CompressionCodec) error {
+	if name == "" || codec.Extension == "" || codec.NewWriter == nil {
+		return fmt.Errorf("compression codec needs a name, an extension and NewWriter")
+	}
+	compressionCodecsMu.Lock()
+	defer compressionCodecsMu.Unlock()
+	compressionCodecs[name] = codec
+	return nil
+}
+
+// lookupCompression returns the codec registered as name
+func lookupCompression(name string) (CompressionCodec, bool) {
+	compressionCodecsMu.RLock()
+	defer compressionCodecsMu.RUnlock()
+	codec, ok := compressionCodecs[name]
+	return codec, ok
+}
+
+// compressionNames returns the registered codec names, sorted (for error messages)
+func compressionNames() []string {
+	compressionCodecsMu.RLock()
+	defer compressionCodecsMu.RUnlock()
+	names := make([]string, 0, len(compressionCodecs))
+	for name := range compressionCodecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// contentEncodingFor returns the Content-Encoding for an uploaded file, from its extension
+// Empty for raw .log files
+func contentEncodingFor(path string) string {
+	compressionCodecsMu.RLock()
+	defer compressionCodecsMu.RUnlock()
+	for _, codec := range compressionCodecs {
+		if strings.HasSuffix(path, ".log"+codec.Extension) {
+			return codec.ContentEncoding
+		}
+	}
+	return ""
+}
+
+// compressionStage compresses files closed by the file writers on a pool of workers, then hands the
+// compressed files to the upload channel in place of the raw ones
+type compressionStage struct {
+	codec   CompressionCodec
+	queue   chan FileReadyEvent
+	publish func(file FileReadyEvent) // Queues a finished file for upload and wakes retention
+	stats   *Statistics
+	logger  InternalLogger
+	tracker *UploadTracker // Files being compressed count as open for recovery scans (nil = untracked)
+	wg      sync.WaitGroup
+
+	// Raw and compressed paths of files being compressed; retention skips them
+	mu     sync.Mutex
+	active map[string]struct{}
+}
+
+// newCompressionStage creates a stage for config.Compression with config.CompressionConcurrency workers
+// publish receives each finished file: compressed, or raw when compression failed
+func newCompressionStage(config Config, publish func(file FileReadyEvent), stats *Statistics) *compressionStage {
+	codec, _ := lookupCompression(config.Compression) // Checked by Config.Validate
+	return &compressionStage{
+		codec:   codec,
+		queue:   make(chan FileReadyEvent, 100),
+		publish: publish,
+		stats:   stats,
+		logger:  config.InternalLogger,
+		tracker: config.UploadTracker,
+		active:  make(map[string]struct{}),
+	}
+}
+
+// start starts the compression workers
+func (c *compressionStage) start(workers int) {
+	c.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go c.worker()
+	}
+}
+
+// stop compresses the files still queued, then waits for the workers
+// Called after the file writers are closed, so nothing is submitted afterwards
+func (c *compressionStage) stop() {
+	close(c.queue)
+	c.wg.Wait()
+}
+
+// submit queues a closed file for compression without blocking the flush worker
+// When the queue is full, the file is published raw
+func (c *compressionStage) submit(file FileReadyEvent) {
+	c.setActive(file.Path, true)
+	select {
+	case c.queue <- file:
+	default:
+		c.setActive(file.Path, false)
+		c.logger.Printf("[WARNING] Compression queue full, uploading %s uncompressed", file.Path)
+		c.publish(file)
+	}
+}
+
+// worker compresses queued files until the queue is closed
+func (c *compressionStage) worker() {
+	defer c.wg.Done()
+	for file := range c.queue {
+		c.publish(c.compressFile(file))
+		c.setActive(file.Path, false)
+	}
+}
+
+// compressFile compresses file to its path+Extension and removes the raw file
+// Returns the file to publish: the compressed one, or file itself if compression failed
+func (c *compressionStage) compressFile(file FileReadyEvent) FileReadyEvent {
+	path := file.Path
+	outPath := path + c.codec.Extension
+	c.setActive(outPath, true)
+	defer c.setActive(outPath, false)
+
+	start := time.Now()
+	bytesIn, bytesOut, err := c.compress(path, outPath)
+	if err != nil {
+		os.Remove(outPath)
+		c.stats.CompressionFailures.Add(1)
+		c.logger.Printf("[WARNING] Failed to compress %s, uploading it uncompressed: %v", path, err)
+		return file
+	}
+
+	if err := os.Remove(path); err != nil {
+		// The compressed copy is complete; the raw file is left for retention
+		c.logger.Printf("[WARNING] Failed to delete %s after compression: %v", path, err)
+	}
+	c.stats.CompressedFiles.Add(1)
+	c.stats.CompressionBytesIn.Add(bytesIn)
+	c.stats.CompressionBytesOut.Add(bytesOut)
+	c.stats.TotalCompressionDuration.Add(int64(time.Since(start)))
+	file.Path = outPath
+	file.SizeBytes = bytesOut
+	return file
+}
+
+// compress writes the compressed contents of path to outPath and returns both sizes
+func (c *compressionStage) compress(path, outPath string) (bytesIn, bytesOut int64, err error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(outPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer out.Close()
+
+	zw, err := c.codec.NewWriter(out)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create compressor: %w", err)
+	}
+	if bytesIn, err = io.Copy(zw, in); err != nil {
+		zw.Close()
+		return 0, 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, 0, err
+	}
+
+	// Durable before the raw file is removed
+	if err := out.Sync(); err != nil {
+		return 0, 0, err
+	}
+	info, err := out.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	return bytesIn, info.Size(), nil
+}
+
+// setActive marks path as being compressed (or no longer)
+func (c *compressionStage) setActive(path string, active bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if active {
+		c.active[path] = struct{}{}
+	} else {
+		delete(c.active, path)
+	}
+	if c.tracker != nil {
+		if active {
+			c.tracker.opened(path)
+		} else {
+			c.tracker.closed(path)
+		}
+	}
+}
+
+// busy reports whether any file is queued for or being compressed
+func (c *compressionStage) busy() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.active) > 0
+}
+
+// isActive reports whether path is queued for or being compressed
+func (c *compressionStage) isActive(path string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.active[path]
+	return ok
+}
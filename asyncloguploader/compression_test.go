@@ -0,0 +1,198 @@
+package asyncloguploader
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readGzipMessages decodes a gzip-compressed log file with Reader
+func readGzipMessages(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	defer zr.Close()
+
+	var messages []string
+	reader := NewReader(zr)
+	for {
+		msg, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return messages
+		}
+		require.NoError(t, err)
+		messages = append(messages, string(msg))
+	}
+}
+
+func TestLogger_Compression(t *testing.T) {
+	t.Run("ValidatesConfig", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		config.Compression = "gzip"
+		require.NoError(t, config.Validate())
+		assert.Equal(t, 1, config.CompressionConcurrency)
+
+		config.Compression = "zstd" // Not built in
+		err := config.Validate()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "RegisterCompression")
+
+		config.Compression = "gzip"
+		config.CompressionConcurrency = -1
+		assert.Error(t, config.Validate())
+
+		assert.Error(t, RegisterCompression("", CompressionCodec{Extension: ".x"}))
+	})
+
+	t.Run("RoundTripsThroughGzip", func(t *testing.T) {
+		dir := t.TempDir()
+		uploads := make(chan string, 10)
+		config := DefaultConfig(filepath.Join(dir, "app.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 2
+		config.Compression = "gzip"
+		config.UploadChannel = uploads
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		raw := logger.groups[0].fileWriter.(*SizeFileWriter).filePath
+
+		var want []string
+		for i := 0; i < 1000; i++ {
+			msg := fmt.Sprintf(`{"seq":%d,"event":"page_view","user":"u-%d"}`, i, i%10)
+			want = append(want, msg)
+			logger.Log(msg)
+		}
+		require.NoError(t, logger.Close())
+
+		// The compressed file replaces the raw one on the upload channel and on disk
+		var uploaded string
+		select {
+		case uploaded = <-uploads:
+		default:
+			t.Fatal("no file was queued for upload")
+		}
+		assert.Equal(t, raw+".gz", uploaded)
+		assert.NoFileExists(t, raw)
+		assert.Equal(t, "gzip", contentEncodingFor(uploaded))
+
+		got := readGzipMessages(t, uploaded)
+		assert.ElementsMatch(t, want, got)
+
+		stats := logger.Snapshot().Stats
+		assert.Equal(t, int64(1), stats.CompressedFiles)
+		assert.Equal(t, int64(0), stats.CompressionFailures)
+		assert.Greater(t, stats.CompressionBytesIn, 5*stats.CompressionBytesOut)
+		assert.Greater(t, stats.TotalCompressionDuration, int64(0))
+	})
+
+	t.Run("CompressesEachRotation", func(t *testing.T) {
+		dir := t.TempDir()
+		uploads := make(chan string, 10)
+		config := DefaultConfig(filepath.Join(dir, "app.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 2
+		config.Compression = "gzip"
+		config.CompressionConcurrency = 2
+		config.UploadChannel = uploads
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		fw := logger.groups[0].fileWriter.(*SizeFileWriter)
+
+		var rotated []string
+		for i := 0; i < 3; i++ {
+			fw.rotationMu.Lock()
+			rotated = append(rotated, fw.filePath)
+			require.NoError(t, fw.createNextFile())
+			require.NoError(t, fw.swapFiles())
+			fw.rotationMu.Unlock()
+		}
+
+		// Published as each file finishes compressing, in any order
+		var got []string
+		for range rotated {
+			select {
+			case path := <-uploads:
+				got = append(got, strings.TrimSuffix(path, ".gz"))
+			case <-time.After(time.Second):
+				t.Fatal("rotated file was not published")
+			}
+		}
+		assert.ElementsMatch(t, rotated, got)
+		require.NoError(t, logger.Close())
+		assert.Equal(t, int64(3), logger.Snapshot().Stats.CompressedFiles)
+	})
+
+	t.Run("UploadsRawOnFailure", func(t *testing.T) {
+		require.NoError(t, RegisterCompression("failing", CompressionCodec{
+			Extension:       ".fail",
+			ContentEncoding: "fail",
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+				return nil, errors.New("codec unavailable")
+			},
+		}))
+
+		dir := t.TempDir()
+		uploads := make(chan string, 10)
+		internal := &captureLogger{}
+		config := DefaultConfig(filepath.Join(dir, "app.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 2
+		config.Compression = "failing"
+		config.UploadChannel = uploads
+		config.InternalLogger = internal
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		raw := logger.groups[0].fileWriter.(*SizeFileWriter).filePath
+		logger.Log("kept raw")
+		require.NoError(t, logger.Close())
+
+		require.Len(t, uploads, 1)
+		assert.Equal(t, raw, <-uploads)
+		assert.FileExists(t, raw)
+		assert.NoFileExists(t, raw+".fail")
+		assert.Equal(t, "", contentEncodingFor(raw))
+
+		stats := logger.Snapshot().Stats
+		assert.Equal(t, int64(0), stats.CompressedFiles)
+		assert.Equal(t, int64(1), stats.CompressionFailures)
+		assert.Contains(t, strings.Join(internal.Messages(), "\n"), "uploading it uncompressed")
+	})
+
+	t.Run("RetentionCountsCompressedFiles", func(t *testing.T) {
+		dir := t.TempDir()
+		old := writeRotatedFiles(t, dir, "app", 4, 1000)
+		for i, path := range old {
+			require.NoError(t, os.Rename(path, path+".gz"))
+			old[i] = path + ".gz"
+		}
+
+		config := DefaultConfig(filepath.Join(dir, "app.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 2
+		config.Compression = "gzip"
+		config.MaxRotatedFiles = 2
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		assert.NoFileExists(t, old[0])
+		assert.NoFileExists(t, old[1])
+		assert.FileExists(t, old[2])
+		assert.FileExists(t, old[3])
+		require.NoError(t, logger.Close())
+	})
+}
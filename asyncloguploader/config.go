@@ -2,39 +2,355 @@ package asyncloguploader
 
 import (
 	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
 	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asyncloguploader/clock"
 )
 
 // Config holds the configuration for the async logger
 type Config struct {
 	// Buffer configuration
 	BufferSize int // Total buffer size in bytes (default: 64MB)
-	NumShards  int // Number of shards (default: 8)
+	NumShards  int // Number of shards (default: 8, at most GOMAXPROCS*8)
+
+	// Buffer auto-resize. With MaxBufferSize set, more than BufferGrowDrops drops within one
+	// FlushInterval double the buffers (up to MaxBufferSize), and BufferShrinkIntervals intervals in
+	// a row writing less than BufferShrinkUtilization of the buffer size halve them (down to
+	// BufferSize). Data in the replaced buffers is still flushed. Messages are still limited to
+	// BufferSize's shard entry
+	MaxBufferSize           int     // Upper bound for growth (0 = buffers stay at BufferSize)
+	BufferGrowDrops         int64   // Drops per FlushInterval tolerated before growing (default: 0)
+	BufferShrinkUtilization float64 // Low-water mark as a fraction of the buffer size (default: 0.1)
+	BufferShrinkIntervals   int     // Quiet intervals in a row before shrinking (default: 5)
 
 	// File configuration
 	LogFilePath         string // Path to log file (required)
-	MaxFileSize         int64  // Maximum file size before rotation (0 = disabled)
-	PreallocateFileSize int64  // Size to preallocate using fallocate (0 = disabled)
+	MaxFileSize         int64  // Maximum file size before rotation (0 = disabled, else at least one shard)
+	PreallocateFileSize int64  // Size to preallocate using fallocate (0 = disabled, at most MaxFileSize)
+
+	// On-disk format
+	// With EnableChecksums each shard block ends with a CRC32C of its valid data and the header's
+	// format version byte is set to 1; readers use it to detect shards torn by a crash mid-flush
+	EnableChecksums bool // Append a per-shard CRC32C (reserves 4 bytes per shard buffer)
+	// With WriteFileHeader each file starts with a FileHeader block (format version, creation
+	// time, alignment, flags) ahead of its first shard. Readers accept files with or without it
+	WriteFileHeader bool // Start each file with a FileHeader (DefaultConfig: true)
 
 	// Flush timing
 	FlushInterval time.Duration // Periodic flush trigger (default: 10s)
-	FlushTimeout  time.Duration // Wait for write completion before flush (default: 10ms)
+	FlushTimeout  time.Duration // Wait for write completion before flush (default: 10ms, under FlushInterval)
+
+	// Flush thresholds in percent (1-100; both can be changed at runtime with UpdateConfig)
+	// A buffer requests a flush once ShardFlushThresholdPct of its usable capacity is used, and a
+	// flush worker writes its queued shards once ReadyShardsFlushPct of its shards are queued (at
+	// least 1). Large entries waste up to an entry of each buffer below 100%; many shards delay
+	// flushes at high ReadyShardsFlushPct
+	ShardFlushThresholdPct int // Default: 90
+	ReadyShardsFlushPct    int // Default: 25
+
+	// AdaptiveFlush samples per-shard fill rates and flushes early, without waiting for the
+	// ReadyShardsFlushPct shard threshold, when a shard is projected to fill before a flush could complete.
+	// Useful for bursty traffic with large buffers and a long FlushInterval
+	AdaptiveFlush bool
+
+	// FlushConcurrency is the number of flush workers (default: 1). Shards are split evenly between
+	// them and each worker writes its own file segment: worker 0 writes LogFilePath, worker i writes
+	// the same path with a "_w<i>" suffix before .log. A slow write then stalls only that worker's
+	// shards. Capped at NumShards; not supported with AllowChunking, whose chunks span shards
+	FlushConcurrency int
+
+	// Disk-full handling (see disk_full.go). A flush that fails with ENOSPC or EDQUOT keeps its
+	// shard buffers and is retried every FlushInterval; meanwhile new logs are rejected with
+	// ErrDiskFull. After MaxFlushRetries failed retries the data is dropped (EntriesLost)
+	MaxFlushRetries int                   // Retries before buffered data is dropped (DefaultConfig: 10, 0 = drop at once)
+	OnFlushError    func(err *FlushError) // Optional: called on the flush worker after each failed flush write; must not block
+
+	// Write path
+	WriteRetryTimeout time.Duration // Max wait for a full shard's swap permit before dropping (DefaultConfig: 50ms, 0 = never wait)
+
+	// ShardSelection chooses the shard each entry is written to (default: random). See ShardSelection
+	ShardSelection ShardSelection
+
+	// TrackWriteLatency records how long each LogBytes call takes in a fixed-bucket histogram
+	// (GetWriteLatencyHistogram). Costs a time.Now/time.Since pair per call; disabled, the hot path
+	// only checks the flag. Compare with go test -run XXX -bench WriteLatency
+	TrackWriteLatency bool
+
+	// Message size limits
+	// Messages larger than MaxMessageSize are rejected and counted in OversizedLogs. With AllowChunking,
+	// messages that don't fit in one shard entry (up to MaxMessageSize) are split into chunk entries
+	// that Reader reassembles
+	MaxMessageSize int  // Largest accepted payload in bytes (default: the largest single shard entry)
+	AllowChunking  bool // Split messages larger than a shard entry instead of rejecting them
 
 	// Upload configuration
-	UploadChannel   chan<- string    // Optional: channel for completed files
+	UploadChannel   chan<- string    // Optional: channel for completed files (paths only; see FileEventChannel)
 	GCSUploadConfig *GCSUploadConfig // Optional: GCS upload configuration
+	UploadTracker   *UploadTracker   // Optional: Uploader.GetUploadTracker(); retention keeps files until uploaded
+	EventName       string           // Optional: passed with each file via UploadTracker for ObjectNameTemplate (set by LoggerManager)
+
+	// FileEventChannel receives each completed file with its event, completion time, size and reason
+	// (Uploader.GetFileEventChannel). Use it instead of UploadChannel, not alongside it
+	FileEventChannel chan<- FileReadyEvent
+
+	// RotationCallback is called with each completed file (rotation, or the last file on Close),
+	// before the file is compressed or sent to UploadChannel/FileEventChannel. It runs on the flush
+	// worker (concurrently with FlushConcurrency > 1), so it must not block
+	RotationCallback func(info RotationInfo)
+	RotationHistory  int // Completed files kept for Logger.RotatedFiles (default: DefaultRotationHistory)
+
+	// Retention of rotated files (see retention.go). After each rotation the oldest rotated files
+	// ({base}_{timestamp}.log, including FlushConcurrency segments) are deleted until both limits hold.
+	// Files sent to UploadChannel are kept until UploadTracker reports them uploaded
+	MaxRotatedFiles  int   // Maximum rotated files kept (0 = unlimited)
+	MaxTotalLogBytes int64 // Maximum total size of rotated files in bytes (0 = unlimited)
+
+	// Compression of rotated files (see compression.go). Each closed file is compressed to
+	// {file}.log.gz (or the codec's extension) by a pool of workers, the raw file is deleted and the
+	// compressed one is sent to UploadChannel. A file that fails to compress is uploaded raw
+	Compression            string // "" (none), "gzip", or a codec added with RegisterCompression (e.g. "zstd")
+	CompressionConcurrency int    // Compression workers (default: 1)
+
+	// Disk space monitoring
+	FreeSpaceConfig *FreeSpaceConfig // Optional: free-space sampling and escalation
+
+	// I/O backend
+	IOBackend  IOBackend // Write backend: pwritev (default) or iouring (experimental, Linux only)
+	UseIOUring bool      // Shorthand for IOBackend = IOBackendIOUring; Validate sets IOBackend from it
+
+	// IOAlignment is the O_DIRECT block size: shard buffers, their padding, the file header and file
+	// offsets are multiples of it (default: 4096). A power of two from 512 to 64KB: 512 saves padding
+	// on devices formatted with 512-byte logical blocks, 8192 suits volumes that want larger direct
+	// writes. IOAlignmentAuto asks the device of the log directory during Validate and falls back to
+	// 4096 with a warning. Files record it in their header (WriteFileHeader); readers need not know it
+	IOAlignment int
+
+	// Advisory locking: each file series, and a LoggerManager's directory, is locked while in use, so
+	// a second logger on the same files fails with ErrFileLocked instead of corrupting them. Set to
+	// skip locking on shared filesystems where flock misbehaves
+	DisableFileLock bool
+
+	// Event name guardrails (LoggerManager only)
+	// If AllowedEvents and/or EventNamePattern is set, an event must be in the allowlist or match the
+	// pattern for its logger to be created (an event sharing a logger created for another name: for
+	// each write)
+	AllowedEvents           []string                                         // Optional: exact event names allowed
+	EventNamePattern        *regexp.Regexp                                   // Optional: pattern event names must match
+	MaxEventLoggers         int                                              // Optional: cap on concurrent event loggers (0 = unlimited)
+	MaxEventLoggersPolicy   MaxEventLoggersPolicy                            // What happens to a new event at the cap (default: reject)
+	OnEventRejected         func(eventName string, reason EventRejectReason) // Optional: rate-limited hook for rejected events
+	EventRejectHookInterval time.Duration                                    // Minimum interval between hook calls per reason (default: 1s)
+
+	// Event names are sanitized into file names, so distinct names can collide ("payment/event" and
+	// "payment event" both become payment_event). The first name keeps the sanitized name; what
+	// happens to later ones is set here (default: hash suffix). Assignments are kept in the base
+	// directory, so they survive restarts (LoggerManager only)
+	OnEventNameCollision EventNameCollisionPolicy
+
+	// Fan-out (LoggerManager only): an entry logged to a key event is also written to the listed
+	// events, as by LogBytesToEvents. Keys match the event name as passed; mirrors are not transitive
+	MirrorEvents map[string][]string
+
+	// Routing (LoggerManager only): an event whose name matches a rule is written to the rule's
+	// Target logger instead of its own; the first matching rule wins. Unmatched events go to
+	// EventRoutingCatchAll if set, else to their own logger. Rules match the event name as passed,
+	// before sanitization and after the AllowedEvents/EventNamePattern check. MirrorEvents apply to
+	// the event name as passed, and each mirror is routed in turn
+	EventRouting         []RouteRule
+	EventRoutingCatchAll string // Optional: target of events no rule matches
+	TagRoutedEvents      bool   // Prefix each entry written to a routing target with "{event name}\t"
+
+	// Self-reporting (LoggerManager only): every interval, and once on Close, each event logger's
+	// statistics are written as a JSON SelfMetricsRecord to the SelfMetricsEvent event (0 = off)
+	SelfMetricsInterval time.Duration
+
+	// Health grading thresholds for Logger.Health and LoggerManager.Health (zero fields take defaults)
+	HealthConfig HealthConfig
+
+	// Diagnostics
+	InternalLogger InternalLogger // Receives internal warnings and errors (default: stderr via the standard log package)
+
+	// Clock drives the FlushInterval ticker, WriteRetryTimeout, FlushTimeout, CloseWithTimeout and
+	// the names and rotation times of rotated files (default: clock.Real). Tests set a clock.Fake
+	// (testsupport.NewFakeClock) to trigger them without sleeping. Measured durations (write, flush
+	// and pwritev latencies) stay on real time
+	Clock clock.Clock
+}
+
+// EventConfig overrides base Config settings for one LoggerManager event
+// Zero fields inherit the manager's base Config
+type EventConfig struct {
+	BufferSize    int           // Total buffer size in bytes
+	NumShards     int           // Number of shards
+	FlushInterval time.Duration // Periodic flush trigger
+	MaxFileSize   int64         // Maximum file size before rotation
+}
+
+// apply returns base with the non-zero overrides applied
+// A defaulted MaxMessageSize is cleared so Validate re-derives it from the event's shard size
+func (e EventConfig) apply(base Config) Config {
+	if (e.BufferSize > 0 || e.NumShards > 0) && base.NumShards > 0 &&
+		base.MaxMessageSize == base.maxShardEntry(base.BufferSize/base.NumShards) {
+		base.MaxMessageSize = 0
+	}
+	if e.BufferSize > 0 {
+		base.BufferSize = e.BufferSize
+	}
+	if e.NumShards > 0 {
+		base.NumShards = e.NumShards
+	}
+	if e.FlushInterval > 0 {
+		base.FlushInterval = e.FlushInterval
+	}
+	if e.MaxFileSize > 0 {
+		base.MaxFileSize = e.MaxFileSize
+	}
+	return base
+}
+
+// MaxEventLoggersPolicy selects what the LoggerManager does with a new event once MaxEventLoggers is reached
+type MaxEventLoggersPolicy string
+
+const (
+	// MaxEventLoggersReject refuses the new event; its logs are counted in MaxEventLoggersDrops
+	MaxEventLoggersReject MaxEventLoggersPolicy = "reject"
+
+	// MaxEventLoggersEvictLRU closes (flushing first) the least recently used event logger to make room
+	MaxEventLoggersEvictLRU MaxEventLoggersPolicy = "evict_lru"
+)
+
+// EventNameCollisionPolicy selects what the LoggerManager does with an event name that sanitizes to
+// another event name's logger key
+type EventNameCollisionPolicy string
+
+const (
+	// EventNameCollisionHash gives the event its own logger, keyed by the sanitized name plus a
+	// hash of the event name (e.g. payment_event_1f2e3d4c)
+	EventNameCollisionHash EventNameCollisionPolicy = "hash"
+
+	// EventNameCollisionError refuses the event with ErrEventNameCollision; its logs are counted
+	// in RejectedEventDrops
+	EventNameCollisionError EventNameCollisionPolicy = "error"
+)
+
+// IOBackend selects the syscall path used to write flushed shard buffers
+type IOBackend string
+
+const (
+	// IOBackendPwritev writes each flush with a single synchronous pwritev on an O_DSYNC file
+	IOBackendPwritev IOBackend = "pwritev"
+
+	// IOBackendIOUring is EXPERIMENTAL: one SQE per shard buffer on a per-logger io_uring,
+	// with the shard buffers registered and an fdatasync queued behind each flush's writes.
+	// Falls back to pwritev (with a warning) if the kernel lacks io_uring support
+	IOBackendIOUring IOBackend = "iouring"
+)
+
+// IOAlignmentAuto makes Validate detect Config.IOAlignment from the device of the log directory
+const IOAlignmentAuto = -1
+
+// Bounds of Config.IOAlignment: the smallest logical block size, and the largest useful direct write unit
+const (
+	minIOAlignment = 512
+	maxIOAlignment = 64 * 1024
+)
+
+// ShardSelection selects how entries are spread across shards
+type ShardSelection string
+
+const (
+	// ShardSelectionRandom picks a random shard for each entry (per-P random source, no shared state)
+	ShardSelectionRandom ShardSelection = "random"
+
+	// ShardSelectionRoundRobin cycles through the shards: the most even spread, at the cost of one
+	// atomic counter shared by all writers
+	ShardSelectionRoundRobin ShardSelection = "round_robin"
+
+	// ShardSelectionGoroutineAffinity keeps each goroutine on one shard, hashed from its stack address,
+	// so concurrent writers rarely meet on a shard. A goroutine may move when its stack grows
+	ShardSelectionGoroutineAffinity ShardSelection = "goroutine_affinity"
+
+	// ShardSelectionKeyHash places entries written with LogBytesKeyed by a hash of their key, so entries
+	// with the same key (e.g. a tenant) share a shard and keep their order. Unkeyed entries are random
+	ShardSelectionKeyHash ShardSelection = "key_hash"
+)
+
+// FreeSpaceConfig holds configuration for filesystem free-space monitoring
+// Thresholds are percentages of available space on the log directory's filesystem;
+// a threshold of 0 disables that escalation step
+type FreeSpaceConfig struct {
+	CheckInterval       time.Duration // How often to statfs the log directory (default: 5s)
+	WarnBelowPct        float64       // Warn when available space drops below this (default: 20)
+	NoPreallocBelowPct  float64       // Stop preallocating new files below this (default: 15)
+	ShrinkFilesBelowPct float64       // Rotate to smaller files below this (default: 10)
+	DegradeBelowPct     float64       // Enter degraded mode (reject new logs) below this (default: 5)
+	ShrunkMaxFileSize   int64         // MaxFileSize used while shrinking (default: 64MB)
+
+	// statfs reports available and total bytes for a path (overridable in tests)
+	statfs func(path string) (available, total uint64, err error)
+}
+
+// HealthConfig holds the thresholds Health grades a logger against
+// A metric at or above its Failing threshold makes the logger Failing; otherwise one at or above its
+// Degraded threshold makes it Degraded. Zero fields take the defaults shown
+type HealthConfig struct {
+	DegradedDropRate float64 // Fraction of logs dropped since the previous FlushInterval tick (default: 0.01)
+	FailingDropRate  float64 // (default: 0.5)
+
+	DegradedFlushErrors int64 // Failed flushes in a row (default: 1)
+	FailingFlushErrors  int64 // (default: 3)
+
+	DegradedFlushAge time.Duration // Time since the last successful flush while data waits to be flushed (default: 3 * FlushInterval)
+	FailingFlushAge  time.Duration // (default: 10 * FlushInterval)
+
+	DegradedUploadBacklog int // Files waiting in UploadTracker for upload (default: 100)
+	FailingUploadBacklog  int // (default: 1000)
 }
 
 // GCSUploadConfig holds configuration for GCS uploader
 type GCSUploadConfig struct {
 	Bucket              string        // GCS bucket name (required)
 	ObjectPrefix        string        // Object prefix (e.g., "logs/event1/")
+	ObjectNameTemplate  string        // Optional: object name layout, e.g. "{prefix}/{event}/{date}/{basename}" (default: ObjectPrefix + file name)
 	ChunkSize           int           // Chunk size for parallel upload (default: 32MB)
+	ParallelThreshold   int64         // Files larger than this are uploaded in parallel chunks and composed (default: ChunkSize; -1: never)
 	MaxChunksPerCompose int           // Maximum chunks per compose (default: 32)
 	MaxRetries          int           // Max retry attempts (default: 3)
-	RetryDelay          time.Duration // Delay between retries (default: 5s)
-	GRPCPoolSize        int           // gRPC connection pool size (default: 64)
-	ChannelBufferSize   int           // Upload channel buffer size (default: 100)
+	InitialBackoff      time.Duration // Delay before the first retry; doubles per retry with jitter (default: RetryDelay, or 1s)
+	MaxBackoff          time.Duration // Cap on the delay between retries (default: 1m)
+	RetryDelay          time.Duration // Deprecated: use InitialBackoff
+	DeadLetterDir       string        // Optional: files that failed all retries are moved here
+
+	// Delete each local file once its upload is verified (size and CRC32C of the stored object
+	// match the file); a mismatch is retried like a failed upload. When false (default), uploaded
+	// files stay on disk for retention (Config.MaxRotatedFiles, Config.MaxTotalLogBytes) to remove
+	DeleteAfterUpload bool
+
+	// Store a JSON Manifest next to each uploaded object (object name + ".manifest.json") with the
+	// file's event, rotation time, checksum and, for uncompressed files, its entry and payload byte
+	// counts, so pipelines need not download the object. A failed manifest does not fail the upload
+	WriteManifests bool
+
+	// Recovery of files left behind by a crash (see Uploader.ScanAndEnqueue)
+	RecoveryDirs          []string       // Optional: directories scanned for rotated files by Start
+	RecoveryGracePeriod   time.Duration  // Files modified more recently are skipped (default: 1m)
+	RecoveryCheckExisting bool           // Skip files already uploaded with the same size (deleted with DeleteAfterUpload)
+	GRPCPoolSize          int            // gRPC connection pool size (default: 64)
+	ChannelBufferSize     int            // Upload channel buffer size (default: 100)
+	InternalLogger        InternalLogger // Receives upload progress, retries and failures (default: stderr)
+
+	// Upload pacing, so uploads do not starve serving traffic of network bandwidth
+	MaxConcurrentUploads    int   // Files uploaded at once (default: 1)
+	MaxBandwidthBytesPerSec int64 // Cap on the bytes per second read by all uploads together (0: unlimited; see Uploader.SetBandwidthLimit)
+
+	// Time source of the retry backoffs, LastUploadTime and ObjectNameTemplate dates (default:
+	// clock.Real). Tests set a clock.Fake to retry without waiting; upload durations stay on real time
+	Clock clock.Clock
 }
 
 // DefaultConfig returns a configuration with baseline defaults
@@ -45,10 +361,16 @@ func DefaultConfig(logPath string) Config {
 		LogFilePath:         logPath,
 		MaxFileSize:         0, // Disabled by default
 		PreallocateFileSize: 0, // Disabled by default
+		WriteFileHeader:     true,
 		FlushInterval:       10 * time.Second,
 		FlushTimeout:        10 * time.Millisecond,
+		WriteRetryTimeout:   50 * time.Millisecond,
+		MaxFlushRetries:     10,
 		UploadChannel:       nil, // Optional
 		GCSUploadConfig:     nil, // Optional
+
+		ShardFlushThresholdPct: flushThresholdPct,
+		ReadyShardsFlushPct:    readyShardsPct,
 	}
 }
 
@@ -60,13 +382,34 @@ func DefaultGCSUploadConfig(bucket string) GCSUploadConfig {
 		ChunkSize:           32 * 1024 * 1024, // 32MB
 		MaxChunksPerCompose: 32,               // GCS limit
 		MaxRetries:          3,
-		RetryDelay:          5 * time.Second,
+		InitialBackoff:      time.Second,
+		MaxBackoff:          time.Minute,
 		GRPCPoolSize:        64,
 		ChannelBufferSize:   100,
 	}
 }
 
+// validatePct checks that a percentage setting is between 1 and 100
+func validatePct(name string, pct int) error {
+	if pct < 1 || pct > 100 {
+		return fmt.Errorf("%s must be between 1 and 100, got %d", name, pct)
+	}
+	return nil
+}
+
+// shardsPerProc is how many shards per GOMAXPROCS Validate allows; more shards than concurrent
+// writers spread writes no further and only add flush work
+const shardsPerProc = 8
+
+// maxUsefulShards returns the largest NumShards Validate keeps
+func maxUsefulShards() int {
+	return runtime.GOMAXPROCS(0) * shardsPerProc
+}
+
 // Validate checks if the configuration is valid and applies defaults where needed
+// Combinations that only waste resources are clamped: NumShards to GOMAXPROCS*8, BufferSize down
+// to a multiple of NumShards, a FlushTimeout not shorter than FlushInterval to half of it and
+// PreallocateFileSize to MaxFileSize. See Explain for the result
 func (c *Config) Validate() error {
 	if c.LogFilePath == "" {
 		return fmt.Errorf("LogFilePath is required")
@@ -86,6 +429,15 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("shard size too small (%d bytes), increase BufferSize or decrease NumShards", shardSize)
 	}
 
+	// Shards beyond what the writers can contend on only add flush overhead; clamp them and let
+	// each remaining shard take a larger part of the buffer
+	if maxShards := maxUsefulShards(); c.NumShards > maxShards {
+		c.NumShards = maxShards
+	}
+	// Each shard gets BufferSize/NumShards bytes, so drop the remainder no shard would use
+	c.BufferSize -= c.BufferSize % c.NumShards
+	shardSize = c.BufferSize / c.NumShards
+
 	if c.FlushInterval <= 0 {
 		c.FlushInterval = 10 * time.Second
 	}
@@ -93,6 +445,188 @@ func (c *Config) Validate() error {
 	if c.FlushTimeout <= 0 {
 		c.FlushTimeout = 10 * time.Millisecond
 	}
+	// A flush waiting out the timeout for a stalled write would run into the next one
+	if c.FlushTimeout >= c.FlushInterval {
+		c.FlushTimeout = c.FlushInterval / 2
+	}
+
+	if c.MaxFileSize < 0 {
+		return fmt.Errorf("MaxFileSize must be >= 0, got %d", c.MaxFileSize)
+	}
+	if c.MaxFileSize > 0 && c.MaxFileSize < int64(shardSize) {
+		return fmt.Errorf("MaxFileSize (%d bytes) is smaller than one shard (%d bytes), so every flush would rotate; set it to at least %d or use smaller shards", c.MaxFileSize, shardSize, shardSize)
+	}
+	if c.PreallocateFileSize < 0 {
+		return fmt.Errorf("PreallocateFileSize must be >= 0, got %d", c.PreallocateFileSize)
+	}
+	// Space preallocated past the rotation size is never written
+	if c.MaxFileSize > 0 && c.PreallocateFileSize > c.MaxFileSize {
+		c.PreallocateFileSize = c.MaxFileSize
+	}
+
+	if c.ShardFlushThresholdPct == 0 {
+		c.ShardFlushThresholdPct = flushThresholdPct
+	}
+	if c.ReadyShardsFlushPct == 0 {
+		c.ReadyShardsFlushPct = readyShardsPct
+	}
+	if err := validatePct("ShardFlushThresholdPct", c.ShardFlushThresholdPct); err != nil {
+		return err
+	}
+	if err := validatePct("ReadyShardsFlushPct", c.ReadyShardsFlushPct); err != nil {
+		return err
+	}
+
+	if c.MaxBufferSize != 0 {
+		if c.MaxBufferSize < c.BufferSize {
+			return fmt.Errorf("MaxBufferSize (%d) must be 0 or at least BufferSize (%d)", c.MaxBufferSize, c.BufferSize)
+		}
+		if c.MaxBufferSize/c.NumShards > math.MaxInt32/2 {
+			return fmt.Errorf("MaxBufferSize too large (%d bytes per shard)", c.MaxBufferSize/c.NumShards)
+		}
+		if c.BufferGrowDrops < 0 {
+			return fmt.Errorf("BufferGrowDrops must be >= 0, got %d", c.BufferGrowDrops)
+		}
+		if c.BufferShrinkUtilization < 0 || c.BufferShrinkUtilization >= 1 {
+			return fmt.Errorf("BufferShrinkUtilization must be in [0, 1), got %v", c.BufferShrinkUtilization)
+		}
+		if c.BufferShrinkUtilization == 0 {
+			c.BufferShrinkUtilization = 0.1
+		}
+		if c.BufferShrinkIntervals < 0 {
+			return fmt.Errorf("BufferShrinkIntervals must be >= 0, got %d", c.BufferShrinkIntervals)
+		}
+		if c.BufferShrinkIntervals == 0 {
+			c.BufferShrinkIntervals = 5
+		}
+	}
+
+	if c.InternalLogger == nil {
+		c.InternalLogger = defaultInternalLogger
+	}
+
+	// Shard capacity, and so the largest entry, depends on the alignment
+	if err := c.resolveIOAlignment(); err != nil {
+		return err
+	}
+
+	maxEntry := c.maxShardEntry(shardSize)
+	if c.MaxMessageSize < 0 {
+		return fmt.Errorf("MaxMessageSize must be >= 0, got %d", c.MaxMessageSize)
+	}
+	if c.MaxMessageSize == 0 {
+		c.MaxMessageSize = maxEntry
+	}
+	if c.MaxMessageSize > maxEntry && !c.AllowChunking {
+		return fmt.Errorf("MaxMessageSize (%d bytes) exceeds the largest shard entry (%d bytes); enable AllowChunking or use larger shards", c.MaxMessageSize, maxEntry)
+	}
+
+	if c.WriteRetryTimeout < 0 {
+		return fmt.Errorf("WriteRetryTimeout must be >= 0, got %v", c.WriteRetryTimeout)
+	}
+
+	if c.MaxFlushRetries < 0 {
+		return fmt.Errorf("MaxFlushRetries must be >= 0, got %d", c.MaxFlushRetries)
+	}
+
+	if c.FlushConcurrency < 0 {
+		return fmt.Errorf("FlushConcurrency must be >= 0, got %d", c.FlushConcurrency)
+	}
+	if c.FlushConcurrency == 0 {
+		c.FlushConcurrency = 1
+	}
+	if c.FlushConcurrency > 1 && c.AllowChunking {
+		return fmt.Errorf("FlushConcurrency > 1 is not supported with AllowChunking (chunks of one message could land in different file segments)")
+	}
+
+	if c.UseIOUring {
+		if c.IOBackend != "" && c.IOBackend != IOBackendIOUring {
+			return fmt.Errorf("UseIOUring conflicts with IOBackend %q", c.IOBackend)
+		}
+		c.IOBackend = IOBackendIOUring
+	}
+	switch c.IOBackend {
+	case "":
+		c.IOBackend = IOBackendPwritev
+	case IOBackendPwritev, IOBackendIOUring:
+	default:
+		return fmt.Errorf("unknown IOBackend %q (want %q or %q)", c.IOBackend, IOBackendPwritev, IOBackendIOUring)
+	}
+
+	switch c.ShardSelection {
+	case "":
+		c.ShardSelection = ShardSelectionRandom
+	case ShardSelectionRandom, ShardSelectionRoundRobin, ShardSelectionGoroutineAffinity, ShardSelectionKeyHash:
+	default:
+		return fmt.Errorf("unknown ShardSelection %q", c.ShardSelection)
+	}
+
+	if c.UploadChannel != nil && c.FileEventChannel != nil {
+		return fmt.Errorf("set UploadChannel or FileEventChannel, not both")
+	}
+
+	if c.RotationHistory < 0 {
+		return fmt.Errorf("RotationHistory must be >= 0, got %d", c.RotationHistory)
+	}
+	if c.MaxRotatedFiles < 0 {
+		return fmt.Errorf("MaxRotatedFiles must be >= 0, got %d", c.MaxRotatedFiles)
+	}
+	if c.MaxTotalLogBytes < 0 {
+		return fmt.Errorf("MaxTotalLogBytes must be >= 0, got %d", c.MaxTotalLogBytes)
+	}
+
+	if c.Compression != "" {
+		if _, ok := lookupCompression(c.Compression); !ok {
+			return fmt.Errorf("unknown Compression %q (registered: %s; register others with RegisterCompression)", c.Compression, strings.Join(compressionNames(), ", "))
+		}
+	}
+	if c.CompressionConcurrency < 0 {
+		return fmt.Errorf("CompressionConcurrency must be >= 0, got %d", c.CompressionConcurrency)
+	}
+	if c.CompressionConcurrency == 0 {
+		c.CompressionConcurrency = 1
+	}
+
+	if c.MaxEventLoggers < 0 {
+		return fmt.Errorf("MaxEventLoggers must be >= 0, got %d", c.MaxEventLoggers)
+	}
+
+	switch c.MaxEventLoggersPolicy {
+	case "":
+		c.MaxEventLoggersPolicy = MaxEventLoggersReject
+	case MaxEventLoggersReject, MaxEventLoggersEvictLRU:
+	default:
+		return fmt.Errorf("unknown MaxEventLoggersPolicy %q (want %q or %q)", c.MaxEventLoggersPolicy, MaxEventLoggersReject, MaxEventLoggersEvictLRU)
+	}
+
+	switch c.OnEventNameCollision {
+	case "":
+		c.OnEventNameCollision = EventNameCollisionHash
+	case EventNameCollisionHash, EventNameCollisionError:
+	default:
+		return fmt.Errorf("unknown OnEventNameCollision %q (want %q or %q)", c.OnEventNameCollision, EventNameCollisionHash, EventNameCollisionError)
+	}
+
+	if err := validateMirrorEvents(c.MirrorEvents); err != nil {
+		return err
+	}
+	reservedEvent := ""
+	if c.SelfMetricsInterval > 0 {
+		reservedEvent = SelfMetricsEvent
+	}
+	if err := validateEventRouting(c.EventRouting, c.EventRoutingCatchAll, reservedEvent); err != nil {
+		return err
+	}
+
+	if c.SelfMetricsInterval < 0 {
+		return fmt.Errorf("SelfMetricsInterval must be >= 0, got %v", c.SelfMetricsInterval)
+	}
+
+	if c.EventRejectHookInterval <= 0 {
+		c.EventRejectHookInterval = time.Second
+	}
+
+	c.Clock = clock.OrReal(c.Clock)
 
 	// Validate GCS config if provided
 	if c.GCSUploadConfig != nil {
@@ -101,6 +635,102 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	// Validate free-space config if provided
+	if c.FreeSpaceConfig != nil {
+		if err := c.FreeSpaceConfig.Validate(); err != nil {
+			return fmt.Errorf("FreeSpaceConfig validation failed: %w", err)
+		}
+	}
+
+	if err := c.HealthConfig.Validate(); err != nil {
+		return fmt.Errorf("HealthConfig validation failed: %w", err)
+	}
+
+	return nil
+}
+
+// Validate checks that the health thresholds are not negative and that no Degraded threshold
+// exceeds its Failing one. Defaults depend on FlushInterval, so they are applied by Health
+func (h *HealthConfig) Validate() error {
+	if h.DegradedDropRate < 0 || h.FailingDropRate < 0 || h.DegradedDropRate > 1 || h.FailingDropRate > 1 {
+		return fmt.Errorf("drop rates must be between 0 and 1, got %v and %v", h.DegradedDropRate, h.FailingDropRate)
+	}
+	if h.DegradedFlushErrors < 0 || h.FailingFlushErrors < 0 || h.DegradedFlushAge < 0 || h.FailingFlushAge < 0 ||
+		h.DegradedUploadBacklog < 0 || h.FailingUploadBacklog < 0 {
+		return fmt.Errorf("thresholds must be >= 0")
+	}
+	limits := h.withDefaults(time.Second)
+	if limits.DegradedDropRate > limits.FailingDropRate || limits.DegradedFlushErrors > limits.FailingFlushErrors ||
+		limits.DegradedUploadBacklog > limits.FailingUploadBacklog {
+		return fmt.Errorf("Degraded thresholds must not exceed Failing thresholds")
+	}
+	if h.DegradedFlushAge > 0 && h.FailingFlushAge > 0 && h.DegradedFlushAge > h.FailingFlushAge {
+		return fmt.Errorf("DegradedFlushAge (%v) must not exceed FailingFlushAge (%v)", h.DegradedFlushAge, h.FailingFlushAge)
+	}
+	return nil
+}
+
+// withDefaults returns h with zero thresholds set to their defaults for the given FlushInterval
+func (h HealthConfig) withDefaults(flushInterval time.Duration) HealthConfig {
+	if h.DegradedDropRate == 0 {
+		h.DegradedDropRate = 0.01
+	}
+	if h.FailingDropRate == 0 {
+		h.FailingDropRate = 0.5
+	}
+	if h.DegradedFlushErrors == 0 {
+		h.DegradedFlushErrors = 1
+	}
+	if h.FailingFlushErrors == 0 {
+		h.FailingFlushErrors = 3
+	}
+	if h.DegradedFlushAge == 0 {
+		h.DegradedFlushAge = 3 * flushInterval
+	}
+	if h.FailingFlushAge == 0 {
+		h.FailingFlushAge = 10 * flushInterval
+	}
+	if h.DegradedUploadBacklog == 0 {
+		h.DegradedUploadBacklog = 100
+	}
+	if h.FailingUploadBacklog == 0 {
+		h.FailingUploadBacklog = 1000
+	}
+	return h
+}
+
+// DefaultFreeSpaceConfig returns a free-space configuration with defaults
+func DefaultFreeSpaceConfig() FreeSpaceConfig {
+	return FreeSpaceConfig{
+		CheckInterval:       5 * time.Second,
+		WarnBelowPct:        20,
+		NoPreallocBelowPct:  15,
+		ShrinkFilesBelowPct: 10,
+		DegradeBelowPct:     5,
+		ShrunkMaxFileSize:   64 * 1024 * 1024, // 64MB
+	}
+}
+
+// Validate checks if the free-space configuration is valid and applies defaults where needed
+func (f *FreeSpaceConfig) Validate() error {
+	if f.CheckInterval <= 0 {
+		f.CheckInterval = 5 * time.Second
+	}
+
+	for _, pct := range []float64{f.WarnBelowPct, f.NoPreallocBelowPct, f.ShrinkFilesBelowPct, f.DegradeBelowPct} {
+		if pct < 0 || pct > 100 {
+			return fmt.Errorf("threshold percentages must be between 0 and 100, got %.2f", pct)
+		}
+	}
+
+	if f.ShrunkMaxFileSize <= 0 {
+		f.ShrunkMaxFileSize = 64 * 1024 * 1024 // 64MB default
+	}
+
+	if f.statfs == nil {
+		f.statfs = statfsAvailable
+	}
+
 	return nil
 }
 
@@ -109,7 +739,11 @@ func (g *GCSUploadConfig) Validate() error {
 	if g.Bucket == "" {
 		return fmt.Errorf("bucket name is required")
 	}
+	return g.applyDefaults()
+}
 
+// applyDefaults validates and defaults the backend-independent upload settings (see NewUploaderWithBackend)
+func (g *GCSUploadConfig) applyDefaults() error {
 	if g.ChunkSize <= 0 {
 		g.ChunkSize = 32 * 1024 * 1024 // 32MB default
 	}
@@ -118,21 +752,143 @@ func (g *GCSUploadConfig) Validate() error {
 		g.MaxChunksPerCompose = 32 // GCS limit
 	}
 
+	if g.ParallelThreshold == 0 {
+		g.ParallelThreshold = int64(g.ChunkSize)
+	}
+
 	if g.MaxRetries <= 0 {
 		g.MaxRetries = 3
 	}
 
-	if g.RetryDelay <= 0 {
-		g.RetryDelay = 5 * time.Second
+	if g.InitialBackoff <= 0 {
+		g.InitialBackoff = g.RetryDelay
+	}
+	if g.InitialBackoff <= 0 {
+		g.InitialBackoff = time.Second
+	}
+	if g.MaxBackoff <= 0 {
+		g.MaxBackoff = time.Minute
+	}
+	if g.MaxBackoff < g.InitialBackoff {
+		return fmt.Errorf("MaxBackoff (%v) must be >= InitialBackoff (%v)", g.MaxBackoff, g.InitialBackoff)
+	}
+
+	if err := validateObjectNameTemplate(g.ObjectNameTemplate); err != nil {
+		return err
+	}
+
+	if g.RecoveryGracePeriod <= 0 {
+		g.RecoveryGracePeriod = time.Minute
 	}
 
 	if g.GRPCPoolSize <= 0 {
 		g.GRPCPoolSize = 64
 	}
 
+	if g.MaxConcurrentUploads <= 0 {
+		g.MaxConcurrentUploads = 1
+	}
+	if g.MaxBandwidthBytesPerSec < 0 {
+		return fmt.Errorf("MaxBandwidthBytesPerSec must be >= 0, got %d", g.MaxBandwidthBytesPerSec)
+	}
+
 	if g.ChannelBufferSize <= 0 {
 		g.ChannelBufferSize = 100
 	}
 
+	if g.InternalLogger == nil {
+		g.InternalLogger = defaultInternalLogger
+	}
+
+	g.Clock = clock.OrReal(g.Clock)
+
+	return nil
+}
+
+// resolveIOAlignment detects IOAlignment for IOAlignmentAuto, defaults it, and checks the result
+func (c *Config) resolveIOAlignment() error {
+	if c.IOAlignment == IOAlignmentAuto {
+		c.IOAlignment = c.detectIOAlignment()
+	}
+	if c.IOAlignment == 0 {
+		c.IOAlignment = alignmentSize
+	}
+	if c.IOAlignment < minIOAlignment || c.IOAlignment > maxIOAlignment || c.IOAlignment&(c.IOAlignment-1) != 0 {
+		return fmt.Errorf("IOAlignment must be a power of two between %d and %d, got %d", minIOAlignment, maxIOAlignment, c.IOAlignment)
+	}
 	return nil
 }
+
+// detectIOAlignment returns the alignment the log directory's device needs, at least
+// minIOAlignment; if the device cannot be asked, it warns and returns the default
+func (c *Config) detectIOAlignment() int {
+	dir := filepath.Dir(c.LogFilePath)
+	detected, err := detectIOAlignment(dir)
+	if err == nil && detected > maxIOAlignment {
+		err = fmt.Errorf("device needs %d bytes, more than %d", detected, maxIOAlignment)
+	}
+	if err != nil {
+		c.InternalLogger.Printf("[WARNING] IOAlignment detection for %s failed, using %d: %v", dir, alignmentSize, err)
+		return alignmentSize
+	}
+	return max(minIOAlignment, detected)
+}
+
+// ioAlignment returns IOAlignment, or the default for configs that were not validated
+func (c Config) ioAlignment() int {
+	if c.IOAlignment > 0 {
+		return c.IOAlignment
+	}
+	return alignmentSize
+}
+
+// maxShardEntry returns the largest payload a single shard entry can hold
+// Shards are aligned to IOAlignment (see newShard); the checksum trailer is not available to entries
+func (c *Config) maxShardEntry(shardSize int) int {
+	maxEntry := maxEntryPayload(alignSize(shardSize, c.ioAlignment()))
+	if c.EnableChecksums {
+		maxEntry -= checksumTrailerSize
+	}
+	return maxEntry
+}
+
+// Explain returns the settings a logger built from c would run with, one per line: c after
+// Validate's defaults and clamps, and the sizes and thresholds derived from it. Load-test harnesses
+// can log it to record exactly what they ran. If c is invalid, Explain returns the error instead
+func (c Config) Explain() string {
+	if err := c.Validate(); err != nil {
+		return fmt.Sprintf("invalid config: %v", err)
+	}
+
+	shardSize := c.BufferSize / c.NumShards
+	capacity := alignSize(shardSize, c.IOAlignment)
+	usable := capacity - headerOffset
+	if c.EnableChecksums {
+		usable -= checksumTrailerSize
+	}
+	workers := max(1, min(c.FlushConcurrency, c.NumShards))
+	workerShards := (c.NumShards + workers - 1) / workers
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "buffers: %d shards x %d bytes (BufferSize %d), each double-buffered; %d bytes mapped in all\n",
+		c.NumShards, shardSize, c.BufferSize, 2*c.NumShards*capacity)
+	fmt.Fprintf(&b, "shard buffer: %d bytes aligned to %d, %d usable for entries\n", capacity, c.IOAlignment, usable)
+	if c.MaxBufferSize > 0 {
+		fmt.Fprintf(&b, "buffer growth: up to %d bytes after %d drops per interval, shrink below %.0f%% for %d intervals\n",
+			c.MaxBufferSize, c.BufferGrowDrops, c.BufferShrinkUtilization*100, c.BufferShrinkIntervals)
+	}
+	fmt.Fprintf(&b, "shard flush threshold: %d bytes (%d%% of usable)\n",
+		flushThresholdBytes(int32(capacity), c.ShardFlushThresholdPct), c.ShardFlushThresholdPct)
+	fmt.Fprintf(&b, "flush workers: %d, each flushing once %d of its %d shards are queued (%d%%)\n",
+		workers, readyShardsThreshold(workerShards, c.ReadyShardsFlushPct), workerShards, c.ReadyShardsFlushPct)
+	fmt.Fprintf(&b, "flush timing: every %v, waiting up to %v for writes in progress\n", c.FlushInterval, c.FlushTimeout)
+	fmt.Fprintf(&b, "messages: up to %d bytes, %d per shard entry (chunking %t)\n",
+		c.MaxMessageSize, c.maxShardEntry(shardSize), c.AllowChunking)
+	fmt.Fprintf(&b, "write path: %s shard selection, %v retry timeout, %s backend\n", c.ShardSelection, c.WriteRetryTimeout, c.IOBackend)
+	if c.MaxFileSize > 0 {
+		fmt.Fprintf(&b, "files: rotate at %d bytes, preallocate %d bytes\n", c.MaxFileSize, c.PreallocateFileSize)
+	} else {
+		fmt.Fprintf(&b, "files: no size rotation, preallocate %d bytes\n", c.PreallocateFileSize)
+	}
+	return b.String()
+}
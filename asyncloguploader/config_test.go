@@ -0,0 +1,120 @@
+package asyncloguploader
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_ValidateCombinations(t *testing.T) {
+	newConfig := func(configure func(c *Config)) Config {
+		config := DefaultConfig("/tmp/combinations.log")
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 4
+		configure(&config)
+		return config
+	}
+
+	t.Run("Rejects", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			configure func(c *Config)
+			want      string
+		}{
+			"MaxFileSizeBelowOneShard": {
+				configure: func(c *Config) { c.MaxFileSize = 64 * 1024 },
+				want:      "MaxFileSize (65536 bytes) is smaller than one shard (262144 bytes), so every flush would rotate; set it to at least 262144 or use smaller shards",
+			},
+			"NegativeMaxFileSize": {
+				configure: func(c *Config) { c.MaxFileSize = -1 },
+				want:      "MaxFileSize must be >= 0, got -1",
+			},
+			"NegativePreallocateFileSize": {
+				configure: func(c *Config) { c.PreallocateFileSize = -1 },
+				want:      "PreallocateFileSize must be >= 0, got -1",
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				config := newConfig(tc.configure)
+				err := config.Validate()
+				require.Error(t, err)
+				assert.Equal(t, tc.want, err.Error())
+				assert.Equal(t, "invalid config: "+tc.want, config.Explain())
+			})
+		}
+	})
+
+	t.Run("Clamps", func(t *testing.T) {
+		t.Run("PreallocateFileSizeAboveMaxFileSize", func(t *testing.T) {
+			config := newConfig(func(c *Config) {
+				c.MaxFileSize = 4 * 1024 * 1024
+				c.PreallocateFileSize = 16 * 1024 * 1024
+			})
+			require.NoError(t, config.Validate())
+			assert.Equal(t, int64(4*1024*1024), config.PreallocateFileSize)
+		})
+
+		t.Run("FlushTimeoutNotShorterThanFlushInterval", func(t *testing.T) {
+			config := newConfig(func(c *Config) {
+				c.FlushInterval = 10 * time.Millisecond
+				c.FlushTimeout = 10 * time.Millisecond
+			})
+			require.NoError(t, config.Validate())
+			assert.Equal(t, 5*time.Millisecond, config.FlushTimeout)
+		})
+
+		t.Run("BufferSizeNotMultipleOfNumShards", func(t *testing.T) {
+			config := newConfig(func(c *Config) {
+				c.BufferSize = 1024*1024 + 3
+				c.NumShards = 4
+			})
+			require.NoError(t, config.Validate())
+			assert.Equal(t, 1024*1024, config.BufferSize)
+		})
+
+		t.Run("NumShardsAboveGOMAXPROCS", func(t *testing.T) {
+			maxShards := runtime.GOMAXPROCS(0) * shardsPerProc
+			config := newConfig(func(c *Config) {
+				c.NumShards = maxShards + 1
+				c.BufferSize = c.NumShards * 64 * 1024
+			})
+			require.NoError(t, config.Validate())
+			assert.Equal(t, maxShards, config.NumShards)
+			assert.Zero(t, config.BufferSize%config.NumShards)
+		})
+	})
+
+	t.Run("KeepsValidCombinations", func(t *testing.T) {
+		config := newConfig(func(c *Config) {
+			c.MaxFileSize = 256 * 1024 // Exactly one shard
+			c.PreallocateFileSize = 256 * 1024
+			c.FlushInterval = time.Second
+			c.FlushTimeout = 100 * time.Millisecond
+		})
+		require.NoError(t, config.Validate())
+		assert.Equal(t, 1024*1024, config.BufferSize)
+		assert.Equal(t, 4, config.NumShards)
+		assert.Equal(t, int64(256*1024), config.PreallocateFileSize)
+		assert.Equal(t, 100*time.Millisecond, config.FlushTimeout)
+	})
+}
+
+func TestConfig_Explain(t *testing.T) {
+	config := DefaultConfig("/tmp/explain.log")
+	config.BufferSize = 1024*1024 + 3
+	config.NumShards = 4
+	config.FlushConcurrency = 2
+	config.MaxFileSize = 8 * 1024 * 1024
+	config.PreallocateFileSize = 16 * 1024 * 1024
+
+	explained := config.Explain()
+	assert.Equal(t, 1024*1024+3, config.BufferSize, "Explain does not change the config")
+	assert.Contains(t, explained, "buffers: 4 shards x 262144 bytes (BufferSize 1048576)")
+	assert.Contains(t, explained, "shard buffer: 262144 bytes aligned to 4096, 262136 usable for entries")
+	assert.Contains(t, explained, "shard flush threshold: 235922 bytes (90% of usable)")
+	assert.Contains(t, explained, "flush workers: 2, each flushing once 1 of its 2 shards are queued (25%)")
+	assert.Contains(t, explained, "flush timing: every 10s, waiting up to 10ms for writes in progress")
+	assert.Contains(t, explained, "files: rotate at 8388608 bytes, preallocate 8388608 bytes")
+}
@@ -0,0 +1,189 @@
+package asyncloguploader
+
+import (
+	"fmt"
+	"time"
+)
+
+// ConfigUpdate changes settings of a running logger (see Logger.UpdateConfig)
+// Nil fields keep their current value
+type ConfigUpdate struct {
+	FlushInterval *time.Duration // Periodic flush trigger; the ticker restarts with the new period
+	FlushTimeout  *time.Duration // Wait for write completion before flush; applies from the next seal
+	MaxFileSize   *int64         // Maximum file size before rotation (0 = disabled); checked before each write
+
+	ShardFlushThresholdPct *int // Buffer fill (1-100%) that requests a flush; applies to the next write
+	ReadyShardsFlushPct    *int // Queued shards (1-100% per flush worker) that trigger a flush; applies to the next queued shard
+}
+
+// maxFileSizeTarget receives MaxFileSize changes from UpdateConfig
+// Implemented by file writers with size-based rotation
+type maxFileSizeTarget interface {
+	setMaxFileSize(size int64)
+}
+
+// Validate checks the values to be changed
+func (u ConfigUpdate) Validate() error {
+	if u.FlushInterval != nil && *u.FlushInterval <= 0 {
+		return fmt.Errorf("FlushInterval must be > 0, got %v", *u.FlushInterval)
+	}
+	if u.FlushTimeout != nil && *u.FlushTimeout <= 0 {
+		return fmt.Errorf("FlushTimeout must be > 0, got %v", *u.FlushTimeout)
+	}
+	if u.MaxFileSize != nil && *u.MaxFileSize < 0 {
+		return fmt.Errorf("MaxFileSize must be >= 0, got %d", *u.MaxFileSize)
+	}
+	if u.ShardFlushThresholdPct != nil {
+		if err := validatePct("ShardFlushThresholdPct", *u.ShardFlushThresholdPct); err != nil {
+			return err
+		}
+	}
+	if u.ReadyShardsFlushPct != nil {
+		if err := validatePct("ReadyShardsFlushPct", *u.ReadyShardsFlushPct); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merge returns u with the non-nil fields of next applied
+func (u ConfigUpdate) merge(next ConfigUpdate) ConfigUpdate {
+	if next.FlushInterval != nil {
+		u.FlushInterval = next.FlushInterval
+	}
+	if next.FlushTimeout != nil {
+		u.FlushTimeout = next.FlushTimeout
+	}
+	if next.MaxFileSize != nil {
+		u.MaxFileSize = next.MaxFileSize
+	}
+	if next.ShardFlushThresholdPct != nil {
+		u.ShardFlushThresholdPct = next.ShardFlushThresholdPct
+	}
+	if next.ReadyShardsFlushPct != nil {
+		u.ReadyShardsFlushPct = next.ReadyShardsFlushPct
+	}
+	return u
+}
+
+// apply returns config with the non-nil fields applied, for loggers created after an update
+func (u ConfigUpdate) apply(config Config) Config {
+	if u.FlushInterval != nil {
+		config.FlushInterval = *u.FlushInterval
+	}
+	if u.FlushTimeout != nil {
+		config.FlushTimeout = *u.FlushTimeout
+	}
+	if u.MaxFileSize != nil {
+		config.MaxFileSize = *u.MaxFileSize
+	}
+	if u.ShardFlushThresholdPct != nil {
+		config.ShardFlushThresholdPct = *u.ShardFlushThresholdPct
+	}
+	if u.ReadyShardsFlushPct != nil {
+		config.ReadyShardsFlushPct = *u.ReadyShardsFlushPct
+	}
+	return config
+}
+
+// UpdateConfig changes FlushInterval, FlushTimeout, MaxFileSize and the flush thresholds without a restart
+// The update is validated as a whole: an invalid value returns an error and changes nothing.
+// FlushInterval restarts the flush ticker, so the next periodic flush is one new interval away.
+// FlushTimeout applies to the next seal. MaxFileSize is checked before each write; a smaller value
+// rotates the current file at the next write that finds it too large. A free-space
+// ShrunkMaxFileSize override stays in force while it is smaller. ShardFlushThresholdPct applies to
+// the next write to each buffer and ReadyShardsFlushPct to the next shard queued for a flush; a
+// lower ReadyShardsFlushPct does not flush shards already waiting. Returns ErrClosed if the logger
+// is closed
+func (l *Logger) UpdateConfig(update ConfigUpdate) error {
+	if err := update.Validate(); err != nil {
+		return fmt.Errorf("invalid config update: %w", err)
+	}
+
+	l.configMu.Lock()
+	defer l.configMu.Unlock()
+	if l.life.Closed() {
+		return ErrClosed
+	}
+
+	if update.FlushInterval != nil {
+		l.flushInterval.Store(int64(*update.FlushInterval))
+		l.ticker.Reset(*update.FlushInterval)
+	}
+	if update.FlushTimeout != nil {
+		l.flushTimeout.Store(int64(*update.FlushTimeout))
+	}
+	if update.MaxFileSize != nil {
+		l.maxFileSize = *update.MaxFileSize
+		for _, g := range l.groups {
+			if target, ok := g.fileWriter.(maxFileSizeTarget); ok {
+				target.setMaxFileSize(l.maxFileSize)
+			}
+		}
+		if l.freeSpace != nil {
+			l.applyShrunkMaxFileSize(l.freeSpace.Level())
+		}
+	}
+	if update.ShardFlushThresholdPct != nil || update.ReadyShardsFlushPct != nil {
+		if update.ShardFlushThresholdPct != nil {
+			l.shardFlushPct.Store(int32(*update.ShardFlushThresholdPct))
+		}
+		if update.ReadyShardsFlushPct != nil {
+			l.readyShardPct.Store(int32(*update.ReadyShardsFlushPct))
+		}
+		l.applyFlushThresholds(l.shardCollection.Load())
+	}
+	return nil
+}
+
+// applyFlushThresholds gives sc and the flush groups the current flush thresholds
+// UpdateConfig stores the thresholds before loading the shard collection and a resize stores the
+// collection before calling this, so one of them applies the new thresholds to the new collection
+func (l *Logger) applyFlushThresholds(sc *ShardCollection) {
+	readyPct := int(l.readyShardPct.Load())
+	sc.setFlushThresholdPct(int(l.shardFlushPct.Load()))
+	sc.setReadyShardsPct(readyPct)
+	for _, g := range l.groups {
+		g.threshold.Store(int32(readyShardsThreshold(g.numShards, readyPct)))
+	}
+}
+
+// UpdateConfig changes settings of every event logger (see Logger.UpdateConfig), replacing
+// EventConfig overrides of the same settings. Event loggers created later start with the update
+// applied. An invalid update changes nothing; otherwise every logger is updated even if one fails
+// (e.g. it closed meanwhile) and the first error is returned
+func (lm *LoggerManager) UpdateConfig(update ConfigUpdate) error {
+	if err := update.Validate(); err != nil {
+		return fmt.Errorf("invalid config update: %w", err)
+	}
+
+	// The write lock keeps loggers from being created (and missing the update) while existing ones are updated
+	lm.eventConfigMu.Lock()
+	defer lm.eventConfigMu.Unlock()
+
+	lm.configUpdate = lm.configUpdate.merge(update)
+	var firstErr error
+	lm.loggers.Range(func(key, value interface{}) bool {
+		if err := value.(*Logger).UpdateConfig(update); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error updating logger for event %s: %w", key.(string), err)
+		}
+		return true
+	})
+	return firstErr
+}
+
+// UpdateEventConfig changes settings of one running event logger (see Logger.UpdateConfig)
+// The change lasts for that logger's lifetime; a logger created again for the event (e.g. after
+// eviction) starts from its configuration
+func (lm *LoggerManager) UpdateEventConfig(eventName string, update ConfigUpdate) error {
+	sanitized, err := lm.loggerKey(eventName)
+	if err != nil {
+		return fmt.Errorf("invalid event name: %w", err)
+	}
+
+	logger, exists := lm.loggers.Load(sanitized)
+	if !exists {
+		return fmt.Errorf("event logger not found: %s", sanitized)
+	}
+	return logger.(*Logger).UpdateConfig(update)
+}
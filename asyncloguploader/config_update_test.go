@@ -0,0 +1,182 @@
+package asyncloguploader
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asyncloguploader/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ptr returns a pointer to v, for ConfigUpdate fields
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestLogger_UpdateConfig(t *testing.T) {
+	t.Run("FlushIntervalTakesEffect", func(t *testing.T) {
+		// All traffic goes to one of 8 shards, so the threshold of 2 ready shards is never reached
+		// and swapped-out buffers are only flushed on the FlushInterval tick
+		var fake *clock.Fake
+		logger, _ := newSizeTestLogger(t, "interval", func(c *Config) {
+			c.BufferSize = 512 * 1024
+			c.NumShards = 8
+			c.ShardSelection = ShardSelectionKeyHash
+			c.FlushInterval = 10 * time.Second
+			fake = useFakeClock(c)
+		})
+		defer logger.Close()
+		// swapOut fills the shard's active buffer, so it is swapped out to wait for a flush
+		swapOut := func() {
+			msg := make([]byte, 1024)
+			for i := 0; i < 70; i++ {
+				logger.TryLogBytesKeyed(7, msg)
+			}
+		}
+		intervalFlushes := func(n int64) {
+			t.Helper()
+			require.Eventually(t, func() bool { return logger.stats.IntervalFlushes.Load() == n },
+				5*time.Second, time.Millisecond, "waiting for %d interval flushes", n)
+		}
+
+		swapOut()
+		fake.Advance(time.Second)
+		assert.Zero(t, logger.stats.IntervalFlushes.Load())
+
+		require.NoError(t, logger.UpdateConfig(ConfigUpdate{FlushInterval: ptr(100 * time.Millisecond)}))
+		assert.Equal(t, int64(100*time.Millisecond), logger.flushInterval.Load())
+		fake.Advance(100 * time.Millisecond)
+		intervalFlushes(1)
+		swapOut()
+		fake.Advance(100 * time.Millisecond)
+		intervalFlushes(2)
+
+		// Back to a long interval: the flushes stop again
+		require.NoError(t, logger.UpdateConfig(ConfigUpdate{FlushInterval: ptr(10 * time.Second)}))
+		swapOut()
+		fake.Advance(time.Second)
+		assert.Equal(t, int64(2), logger.stats.IntervalFlushes.Load())
+	})
+
+	t.Run("FlushTimeoutReachesShards", func(t *testing.T) {
+		logger, _ := newSizeTestLogger(t, "timeout", nil)
+		defer logger.Close()
+
+		require.NoError(t, logger.UpdateConfig(ConfigUpdate{FlushTimeout: ptr(time.Second)}))
+		for _, shard := range logger.shardCollection.Load().Shards() {
+			assert.Equal(t, time.Second, time.Duration(shard.sealTimeout.Load()))
+		}
+	})
+
+	t.Run("MaxFileSizeRotates", func(t *testing.T) {
+		logger, _ := newSizeTestLogger(t, "rotate", nil)
+		defer logger.Close()
+
+		logMessages(t, logger, "first", 10)
+		require.NoError(t, logger.Flush(context.Background()))
+		assert.Empty(t, logger.RotatedFiles())
+
+		// The current file already exceeds the new limit: the next write rotates it
+		require.NoError(t, logger.UpdateConfig(ConfigUpdate{MaxFileSize: ptr(int64(64 * 1024))}))
+		logMessages(t, logger, "second", 10)
+		require.NoError(t, logger.Flush(context.Background()))
+		require.Len(t, logger.RotatedFiles(), 1)
+		assert.Equal(t, FileRotated, logger.RotatedFiles()[0].Reason)
+
+		// 0 disables rotation again
+		require.NoError(t, logger.UpdateConfig(ConfigUpdate{MaxFileSize: ptr(int64(0))}))
+		logMessages(t, logger, "third", 10)
+		require.NoError(t, logger.Flush(context.Background()))
+		assert.Len(t, logger.RotatedFiles(), 1)
+	})
+
+	t.Run("FlushThresholdsReachShardsAndWorkers", func(t *testing.T) {
+		logger, _ := newSizeTestLogger(t, "thresholds", func(c *Config) {
+			c.NumShards = 8
+			c.FlushConcurrency = 2
+		})
+		defer logger.Close()
+
+		require.NoError(t, logger.UpdateConfig(ConfigUpdate{
+			ShardFlushThresholdPct: ptr(50),
+			ReadyShardsFlushPct:    ptr(100),
+		}))
+		sc := logger.shardCollection.Load()
+		for _, shard := range sc.Shards() {
+			assert.Equal(t, flushThresholdBytes(shard.Capacity(), 50), shard.flushThreshold.Load())
+		}
+		assert.Equal(t, int32(8), sc.threshold.Load())
+		for _, g := range logger.groups {
+			assert.Equal(t, int32(g.numShards), g.threshold.Load())
+		}
+
+		// A resized set starts with the updated thresholds
+		require.True(t, logger.resizeBuffers(2*sc.BufferSize()))
+		for _, shard := range logger.shardCollection.Load().Shards() {
+			assert.Equal(t, flushThresholdBytes(shard.Capacity(), 50), shard.flushThreshold.Load())
+		}
+		assert.Equal(t, int32(8), logger.shardCollection.Load().threshold.Load())
+	})
+
+	t.Run("InvalidUpdateChangesNothing", func(t *testing.T) {
+		logger, _ := newSizeTestLogger(t, "invalid", nil)
+		defer logger.Close()
+
+		for name, update := range map[string]ConfigUpdate{
+			"FlushInterval": {FlushInterval: ptr(time.Duration(0)), FlushTimeout: ptr(time.Second)},
+			"FlushTimeout":  {FlushInterval: ptr(time.Second), FlushTimeout: ptr(-time.Millisecond)},
+			"MaxFileSize":   {FlushInterval: ptr(time.Second), MaxFileSize: ptr(int64(-1))},
+			"ShardFlushPct": {FlushInterval: ptr(time.Second), ShardFlushThresholdPct: ptr(0)},
+			"ReadyPct":      {FlushInterval: ptr(time.Second), ReadyShardsFlushPct: ptr(101)},
+		} {
+			t.Run(name, func(t *testing.T) {
+				assert.Error(t, logger.UpdateConfig(update))
+				assert.Equal(t, int64(50*time.Millisecond), logger.flushInterval.Load())
+				assert.Equal(t, int64(10*time.Millisecond), logger.flushTimeout.Load())
+				assert.Zero(t, logger.maxFileSize)
+				assert.Equal(t, int32(flushThresholdPct), logger.shardFlushPct.Load())
+				assert.Equal(t, int32(readyShardsPct), logger.readyShardPct.Load())
+			})
+		}
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		logger, _ := newSizeTestLogger(t, "closed", nil)
+		require.NoError(t, logger.Close())
+		assert.ErrorIs(t, logger.UpdateConfig(ConfigUpdate{FlushInterval: ptr(time.Second)}), ErrClosed)
+	})
+}
+
+func TestLoggerManager_UpdateConfig(t *testing.T) {
+	config := DefaultConfig(filepath.Join(t.TempDir(), "events.log"))
+	config.BufferSize = 1024 * 1024
+	config.NumShards = 4
+	config.FlushInterval = 10 * time.Second
+	manager, err := NewLoggerManager(config)
+	require.NoError(t, err)
+	defer manager.Close()
+
+	manager.LogWithEvent("payment", "before")
+	assert.Error(t, manager.UpdateConfig(ConfigUpdate{FlushInterval: ptr(-time.Second)}))
+	require.NoError(t, manager.UpdateConfig(ConfigUpdate{FlushInterval: ptr(100 * time.Millisecond)}))
+
+	// Existing and later event loggers use the new interval
+	manager.LogWithEvent("login", "after")
+	for _, event := range []string{"payment", "login"} {
+		value, ok := manager.loggers.Load(event)
+		require.True(t, ok)
+		logger := value.(*Logger)
+		assert.Equal(t, int64(100*time.Millisecond), logger.flushInterval.Load(), event)
+	}
+
+	// A per-event update leaves the other events alone
+	require.NoError(t, manager.UpdateEventConfig("login", ConfigUpdate{FlushInterval: ptr(time.Minute)}))
+	payment, _ := manager.loggers.Load("payment")
+	login, _ := manager.loggers.Load("login")
+	assert.Equal(t, int64(100*time.Millisecond), payment.(*Logger).flushInterval.Load())
+	assert.Equal(t, int64(time.Minute), login.(*Logger).flushInterval.Load())
+	assert.Error(t, manager.UpdateEventConfig("unknown", ConfigUpdate{}))
+}
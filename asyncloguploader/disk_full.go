@@ -0,0 +1,134 @@
+package asyncloguploader
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// Disk-full handling: a flush write that fails with ENOSPC or EDQUOT does not reset its shard
+// buffers. The data stays in them and the group's flush worker retries the write on every tick
+// (FlushInterval), rewriting it at the same file offset. While any group holds such data the logger
+// is degraded: new logs are rejected with ErrDiskFull, since the buffers cannot be flushed. A
+// successful flush ends the outage; after Config.MaxFlushRetries failed retries the data is
+// dropped (counted in EntriesLost) and intake resumes, so the next flush probes the disk again.
+// Freeing space, e.g. with MaxRotatedFiles/MaxTotalLogBytes retention, lets the logger recover
+
+// diskFullErrors are the write errors retried by keeping the data (see isDiskFull)
+var diskFullErrors = []error{syscall.ENOSPC, syscall.EDQUOT}
+
+// isDiskFull reports whether err means the file system (or the user's quota) is out of space
+func isDiskFull(err error) bool {
+	for _, target := range diskFullErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// FlushError describes a failed flush write, as passed to Config.OnFlushError
+type FlushError struct {
+	Path     string // File series written by the failed flush (a segment path with FlushConcurrency)
+	Entries  int64  // Entries in the buffers that failed to write
+	Bytes    int64  // Valid data bytes in those buffers (excluding headers)
+	DiskFull bool   // The write failed with ENOSPC or EDQUOT
+	Attempt  int    // Consecutive failed writes of this data, starting at 1
+	Retained bool   // The data is kept for a retry; false means it was dropped (EntriesLost)
+	Err      error  // The write error
+}
+
+// Error implements error
+func (e *FlushError) Error() string {
+	outcome := "dropped"
+	if e.Retained {
+		outcome = "retained for retry"
+	}
+	return fmt.Sprintf("flush of %d entries to %s failed (attempt %d, %s): %v", e.Entries, e.Path, e.Attempt, outcome, e.Err)
+}
+
+// Unwrap returns the write error, so errors.Is(err, syscall.ENOSPC) works
+func (e *FlushError) Unwrap() error {
+	return e.Err
+}
+
+// keepFailedBatch decides what happens to a batch whose write failed: with a disk-full error and
+// retries left its buffers keep their data; otherwise its entries are lost. Runs on g's flush worker
+// Returns true if the batch is retained (the caller must not reset its buffers)
+func (l *Logger) keepFailedBatch(g *flushGroup, batch flushBatch, err error) bool {
+	diskFull := isDiskFull(err)
+	if diskFull {
+		g.failedFlushes++
+	}
+	attempt := max(g.failedFlushes, 1)
+
+	// Close flushes once: data it cannot write is reported in CloseReport.EntriesDropped
+	retain := diskFull && g.failedFlushes <= l.config.MaxFlushRetries && !l.life.Closed()
+	if retain {
+		l.stats.FlushRetries.Add(1)
+	} else {
+		l.stats.EntriesLost.Add(batch.entries)
+		g.failedFlushes = 0
+	}
+	l.setRetaining(g, retain)
+
+	path := segmentLogPath(l.config.LogFilePath, g.id)
+	if retain {
+		l.config.InternalLogger.Printf("[WARNING] Disk full writing %s (attempt %d): %d entries kept for retry, rejecting new logs",
+			path, attempt, batch.entries)
+	}
+	if l.config.OnFlushError != nil {
+		l.config.OnFlushError(&FlushError{
+			Path:     path,
+			Entries:  batch.entries,
+			Bytes:    batch.dataBytes,
+			DiskFull: diskFull,
+			Attempt:  attempt,
+			Retained: retain,
+			Err:      err,
+		})
+	}
+	return retain
+}
+
+// flushSucceeded ends a disk-full outage of g after a flush that wrote data
+func (l *Logger) flushSucceeded(g *flushGroup) {
+	if g.failedFlushes > 0 || g.retaining.Load() {
+		l.config.InternalLogger.Printf("[WARNING] Disk writable again for %s after %d failed flushes",
+			segmentLogPath(l.config.LogFilePath, g.id), g.failedFlushes)
+	}
+	g.failedFlushes = 0
+	l.setRetaining(g, false)
+}
+
+// setRetaining records whether g's shards hold data kept for a retry; the logger is degraded
+// (rejecting logs with ErrDiskFull) while any group does
+func (l *Logger) setRetaining(g *flushGroup, retaining bool) {
+	if g.retaining.Swap(retaining) == retaining {
+		return
+	}
+	if retaining {
+		l.retainingGroups.Add(1)
+	} else {
+		l.retainingGroups.Add(-1)
+	}
+}
+
+// retryRetainedFlushes asks each group holding retained data to flush it again (ticker worker)
+func (l *Logger) retryRetainedFlushes() {
+	for _, g := range l.groups {
+		if !g.retaining.Load() {
+			continue
+		}
+		select {
+		case g.retryFlush <- struct{}{}:
+		default: // A retry is already pending
+		}
+	}
+}
+
+// IsDiskFull returns true while flushed data is kept in the buffers after a disk-full write error
+// New logs are rejected with ErrDiskFull until a retry succeeds or the data is dropped
+func (l *Logger) IsDiskFull() bool {
+	return l.retainingGroups.Load() > 0
+}
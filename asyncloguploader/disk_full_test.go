@@ -0,0 +1,197 @@
+package asyncloguploader
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingWriter wraps a file writer and fails writes with err while it is set, writing nothing
+type failingWriter struct {
+	FileWriter
+	mu  sync.Mutex
+	err error
+}
+
+func (w *failingWriter) WriteVectored(buffers [][]byte) (int, error) {
+	w.mu.Lock()
+	err := w.err
+	w.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	return w.FileWriter.WriteVectored(buffers)
+}
+
+func (w *failingWriter) setErr(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.err = err
+}
+
+// flushErrorRecorder collects the FlushErrors passed to Config.OnFlushError
+type flushErrorRecorder struct {
+	mu     sync.Mutex
+	errors []FlushError
+}
+
+func (r *flushErrorRecorder) record(err *FlushError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, *err)
+}
+
+func (r *flushErrorRecorder) list() []FlushError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]FlushError(nil), r.errors...)
+}
+
+// newDiskFullTestLogger creates a logger writing a real file through a failingWriter
+func newDiskFullTestLogger(t *testing.T, configure func(*Config)) (*Logger, *failingWriter, *flushErrorRecorder, string) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	recorder := &flushErrorRecorder{}
+	config := DefaultConfig(filepath.Join(tmpDir, "full.log"))
+	config.BufferSize = 1024 * 1024
+	config.NumShards = 4
+	config.FlushInterval = 20 * time.Millisecond
+	config.OnFlushError = recorder.record
+	config.InternalLogger = &captureLogger{}
+	if configure != nil {
+		configure(&config)
+	}
+	require.NoError(t, config.Validate())
+
+	fileWriter, err := NewSizeFileWriter(config, nil)
+	require.NoError(t, err)
+	writer := &failingWriter{FileWriter: fileWriter}
+	logger, err := NewLoggerWithWriter(config, writer)
+	require.NoError(t, err)
+	return logger, writer, recorder, tmpDir
+}
+
+// logMessages logs count messages and returns those the logger accepted
+func logMessages(t *testing.T, logger *Logger, prefix string, count int) [][]byte {
+	t.Helper()
+	var accepted [][]byte
+	for i := 0; i < count; i++ {
+		msg := []byte(fmt.Sprintf("%s %03d", prefix, i))
+		if logger.TryLogBytes(msg) == nil {
+			accepted = append(accepted, msg)
+		}
+	}
+	return accepted
+}
+
+// enospc is a disk-full error as the file writer returns it
+var enospc = fmt.Errorf("vectored I/O write failed: %w", syscall.ENOSPC)
+
+func TestLogger_DiskFull(t *testing.T) {
+	t.Run("KeepsDataAndRecovers", func(t *testing.T) {
+		logger, writer, recorder, tmpDir := newDiskFullTestLogger(t, nil)
+		before := logMessages(t, logger, "before", 100)
+		require.Len(t, before, 100)
+
+		// The disk fills: the flush fails, but the data stays buffered and intake pauses
+		writer.setErr(enospc)
+		err := logger.Flush(context.Background())
+		assert.ErrorIs(t, err, syscall.ENOSPC)
+		assert.True(t, logger.IsDiskFull())
+		assert.True(t, logger.IsDegraded())
+		assert.ErrorIs(t, logger.TryLogBytes([]byte("rejected")), ErrDiskFull)
+
+		snap := logger.Snapshot()
+		assert.True(t, snap.DiskFull)
+		assert.True(t, snap.Degraded)
+		assert.Equal(t, int64(1), snap.Stats.DiskFullDrops)
+		assert.Positive(t, snap.Stats.FlushRetries)
+		assert.Zero(t, logger.stats.EntriesLost.Load())
+
+		errs := recorder.list()
+		require.NotEmpty(t, errs)
+		assert.True(t, errs[0].DiskFull)
+		assert.True(t, errs[0].Retained)
+		assert.Equal(t, 1, errs[0].Attempt)
+		assert.Equal(t, int64(100), errs[0].Entries)
+		assert.ErrorIs(t, &errs[0], syscall.ENOSPC)
+
+		// Space is freed: the next periodic retry writes the kept data and intake resumes
+		writer.setErr(nil)
+		require.Eventually(t, func() bool { return !logger.IsDiskFull() }, 5*time.Second, 10*time.Millisecond)
+		assert.False(t, logger.IsDegraded())
+		after := logMessages(t, logger, "after", 100)
+		require.Len(t, after, 100)
+
+		report, err := logger.CloseWithTimeout(5 * time.Second)
+		require.NoError(t, err)
+		assert.Zero(t, report.EntriesDropped)
+		assert.Zero(t, logger.stats.EntriesLost.Load())
+
+		messages, _ := readAllMessages(t, findLogFile(t, tmpDir, "full"))
+		assert.ElementsMatch(t, append(before, after...), messages)
+	})
+
+	t.Run("DropsAfterMaxFlushRetries", func(t *testing.T) {
+		logger, writer, recorder, _ := newDiskFullTestLogger(t, func(c *Config) { c.MaxFlushRetries = 2 })
+		defer logger.Close()
+		require.Len(t, logMessages(t, logger, "lost", 50), 50)
+
+		writer.setErr(enospc)
+		assert.Error(t, logger.Flush(context.Background()))
+		require.Eventually(t, func() bool { return !logger.IsDiskFull() }, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, int64(50), logger.stats.EntriesLost.Load())
+
+		errs := recorder.list()
+		require.Len(t, errs, 3)
+		for i, err := range errs {
+			assert.Equal(t, i+1, err.Attempt)
+			assert.Equal(t, i < 2, err.Retained, "attempt %d", err.Attempt)
+		}
+
+		// With the data dropped, intake resumes and the next flush probes the disk again
+		assert.NoError(t, logger.TryLogBytes([]byte("probe")))
+		assert.Error(t, logger.Flush(context.Background()))
+		assert.True(t, logger.IsDiskFull())
+	})
+
+	t.Run("OtherErrorsDropAtOnce", func(t *testing.T) {
+		logger, writer, recorder, _ := newDiskFullTestLogger(t, nil)
+		defer logger.Close()
+		require.Len(t, logMessages(t, logger, "lost", 10), 10)
+
+		writer.setErr(fmt.Errorf("vectored I/O write failed: %w", syscall.EIO))
+		assert.ErrorIs(t, logger.Flush(context.Background()), syscall.EIO)
+		assert.False(t, logger.IsDiskFull())
+		assert.Equal(t, int64(10), logger.stats.EntriesLost.Load())
+
+		errs := recorder.list()
+		require.Len(t, errs, 1)
+		assert.False(t, errs[0].DiskFull)
+		assert.False(t, errs[0].Retained)
+	})
+
+	t.Run("CloseReportsKeptData", func(t *testing.T) {
+		logger, writer, _, _ := newDiskFullTestLogger(t, nil)
+		require.Len(t, logMessages(t, logger, "kept", 20), 20)
+		writer.setErr(enospc)
+		assert.Error(t, logger.Flush(context.Background()))
+
+		report, err := logger.CloseWithTimeout(5 * time.Second)
+		assert.Error(t, err)
+		assert.Equal(t, int64(20), report.EntriesDropped)
+	})
+
+	t.Run("RejectsNegativeMaxFlushRetries", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		config.MaxFlushRetries = -1
+		assert.Error(t, config.Validate())
+	})
+}
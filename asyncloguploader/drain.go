@@ -0,0 +1,145 @@
+package asyncloguploader
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// drainPollInterval is how often Drain checks for rotated files still compressing or uploading
+const drainPollInterval = 10 * time.Millisecond
+
+// DrainReport describes what LoggerManager.Drain flushed and what it left behind
+type DrainReport struct {
+	Events map[string]EventDrainReport // By event logger name (see ListEventLoggers)
+
+	// Writes refused since Drain started to events without a logger (refusals of an event with a
+	// logger are in its EventDrainReport)
+	RejectedUnknownEvents int64
+
+	// Totals over Events
+	EntriesFlushed     int64
+	RejectedLogs       int64 // Including RejectedUnknownEvents
+	PendingUploads     int
+	PendingUploadBytes int64
+
+	DeadlineExceeded bool // ctx ended before every rotated file was uploaded
+}
+
+// EventDrainReport is the part of a DrainReport for one event logger
+type EventDrainReport struct {
+	EntriesFlushed int64 // Entries written to disk while Drain ran
+	BytesFlushed   int64 // Log data bytes written while Drain ran
+	RejectedLogs   int64 // Writes refused since Drain started (Statistics.DrainRejectedLogs)
+
+	// Rotated files not yet uploaded when Drain returned (zero without Config.UploadTracker)
+	PendingUploads     int
+	PendingUploadBytes int64
+
+	// The file being written is not rotated by Drain; Close completes it and queues it for upload
+	CurrentFile      string
+	CurrentFileBytes int64
+}
+
+// Drain prepares the manager for a handover to another process: it stops accepting writes,
+// flushes every event logger, then waits until the files they rotated are compressed and, with
+// Config.UploadTracker, uploaded, or until ctx ends. Unlike Close it keeps the loggers open and
+// reports progress, so it can be bounded by a deployment's deadline and followed by Close.
+//
+// From the start of Drain, manager writes (LogBytesWithEvent and friends) are refused with
+// ErrDraining and counted in DrainRejectedLogs, not DroppedLogs; no new event logger is created.
+// A write already past that check may land after the flush and is flushed by Close. Draining
+// cannot be undone. Returns ctx.Err() (wrapped) with DeadlineExceeded set if ctx ended first, or
+// the first flush error
+func (lm *LoggerManager) Drain(ctx context.Context) (DrainReport, error) {
+	lm.createMu.Lock()
+	lm.draining.Store(true)
+	pending := make([]*pendingLogger, 0, len(lm.creating))
+	for _, p := range lm.creating {
+		pending = append(pending, p)
+	}
+	lm.createMu.Unlock()
+	for _, p := range pending {
+		<-p.done
+	}
+
+	// Flushed counters of each event logger when writes stopped
+	type drainStart struct {
+		eventName string
+		logger    *Logger
+		entries   int64
+		bytes     int64
+	}
+	var started []drainStart
+	lm.rangeUserLoggers(func(eventName string, logger *Logger) bool {
+		logger.draining.Store(true)
+		started = append(started, drainStart{eventName, logger, logger.stats.EntriesFlushed.Load(), logger.stats.BytesFlushed.Load()})
+		return true
+	})
+
+	err := lm.FlushAll(ctx)
+	if err == nil {
+		err = lm.waitRotatedFiles(ctx)
+	}
+
+	report := DrainReport{
+		Events:                make(map[string]EventDrainReport),
+		RejectedUnknownEvents: lm.drainRejected.Load(),
+	}
+	report.RejectedLogs = report.RejectedUnknownEvents
+	for _, s := range started {
+		files := s.logger.GetFileStats()
+		event := EventDrainReport{
+			EntriesFlushed:     s.logger.stats.EntriesFlushed.Load() - s.entries,
+			BytesFlushed:       s.logger.stats.BytesFlushed.Load() - s.bytes,
+			RejectedLogs:       s.logger.stats.DrainRejectedLogs.Load(),
+			PendingUploads:     files.PendingUploads,
+			PendingUploadBytes: files.PendingUploadBytes,
+			CurrentFile:        files.CurrentFile,
+			CurrentFileBytes:   files.CurrentFileBytes,
+		}
+		report.Events[s.eventName] = event
+		report.EntriesFlushed += event.EntriesFlushed
+		report.RejectedLogs += event.RejectedLogs
+		report.PendingUploads += event.PendingUploads
+		report.PendingUploadBytes += event.PendingUploadBytes
+	}
+
+	if err != nil && ctx.Err() != nil {
+		report.DeadlineExceeded = true
+		err = fmt.Errorf("drain: %d rotated files not uploaded: %w", report.PendingUploads, err)
+	}
+	return report, err
+}
+
+// waitRotatedFiles waits until no event logger has a rotated file compressing or waiting for
+// upload, or until ctx ends
+func (lm *LoggerManager) waitRotatedFiles(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		idle := true
+		lm.rangeUserLoggers(func(eventName string, logger *Logger) bool {
+			idle = !logger.rotating()
+			return idle
+		})
+		if idle {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// rotating reports whether a file the logger rotated is still compressing or, with
+// Config.UploadTracker, waiting for upload
+func (l *Logger) rotating() bool {
+	if l.compression != nil && l.compression.busy() {
+		return true
+	}
+	tracker := l.config.UploadTracker
+	return tracker != nil && len(tracker.pendingMatching(l.ownsRotatedFile)) > 0
+}
@@ -0,0 +1,144 @@
+package asyncloguploader
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedStore is an UploadBackend whose uploads wait until release is closed (or the uploader stops)
+type gatedStore struct {
+	release  chan struct{}
+	uploaded atomic.Int64
+}
+
+func (s *gatedStore) Upload(ctx context.Context, localPath, objectName string) error {
+	select {
+	case <-s.release:
+		s.uploaded.Add(1)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *gatedStore) Stat(ctx context.Context, objectName string) (ObjectInfo, error) {
+	return ObjectInfo{}, ErrObjectNotFound
+}
+
+func (s *gatedStore) Close() error {
+	return nil
+}
+
+func TestLoggerManager_Drain(t *testing.T) {
+	// newDrainManager creates a manager with 1MB files uploaded through store, and logs enough to
+	// the payment event to rotate at least one file
+	newDrainManager := func(t *testing.T, store UploadBackend) (*LoggerManager, *Uploader) {
+		t.Helper()
+		config := DefaultConfig(filepath.Join(t.TempDir(), "app.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 2
+		config.MaxFileSize = 1024 * 1024
+		var uploader *Uploader
+		if store != nil {
+			var err error
+			uploader, err = NewUploaderWithBackend(GCSUploadConfig{InternalLogger: &captureLogger{}}, store)
+			require.NoError(t, err)
+			uploader.Start()
+			config.UploadChannel = uploader.GetUploadChannel()
+			config.UploadTracker = uploader.GetUploadTracker()
+		}
+		lm, err := NewLoggerManager(config)
+		require.NoError(t, err)
+
+		// Flushed every 200KB so the buffer never fills; the last 200 entries stay buffered for Drain
+		entry := make([]byte, 1024)
+		for i := 1; i <= 2600; i++ {
+			require.NoError(t, lm.TryLogBytesWithEvent("payment", entry))
+			if i%200 == 0 && i < 2600 {
+				require.NoError(t, lm.FlushEvent("payment", context.Background()))
+			}
+		}
+		return lm, uploader
+	}
+
+	t.Run("RespectsDeadlineAndReportsLeftovers", func(t *testing.T) {
+		store := &gatedStore{release: make(chan struct{})}
+		lm, uploader := newDrainManager(t, store)
+		require.Eventually(t, func() bool {
+			stats, err := lm.GetEventFileStats("payment")
+			return err == nil && stats.PendingUploads > 0
+		}, 5*time.Second, 5*time.Millisecond)
+		droppedBefore := lm.Snapshot().Aggregate.DroppedLogs
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		report, err := lm.Drain(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), 2*time.Second)
+		assert.True(t, report.DeadlineExceeded)
+		assert.Positive(t, report.PendingUploads)
+		assert.Positive(t, report.PendingUploadBytes)
+		payment := report.Events["payment"]
+		assert.Equal(t, report.PendingUploads, payment.PendingUploads)
+		assert.Positive(t, payment.EntriesFlushed, "buffered entries are flushed")
+		assert.Positive(t, payment.CurrentFileBytes)
+		assert.Zero(t, store.uploaded.Load())
+
+		// Writes are refused and counted, for existing and new events alike
+		assert.ErrorIs(t, lm.TryLogBytesWithEvent("payment", []byte("late")), ErrDraining)
+		assert.ErrorIs(t, lm.TryLogBytesWithEvent("login", []byte("late")), ErrDraining)
+		lm.LogBytesWithEvent("payment", []byte("late"))
+		assert.False(t, lm.HasEventLogger("login"), "no logger is created while draining")
+
+		report, err = lm.Drain(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, int64(2), report.Events["payment"].RejectedLogs)
+		assert.Equal(t, int64(1), report.RejectedUnknownEvents)
+		assert.Equal(t, int64(3), report.RejectedLogs)
+		stats := lm.Snapshot().Aggregate
+		assert.Equal(t, int64(3), stats.DrainRejectedLogs)
+		assert.Equal(t, droppedBefore, stats.DroppedLogs, "refused writes are not drops")
+
+		close(store.release)
+		require.NoError(t, lm.Close())
+		uploader.Stop()
+	})
+
+	t.Run("WaitsForUploads", func(t *testing.T) {
+		store := &gatedStore{release: make(chan struct{})}
+		lm, uploader := newDrainManager(t, store)
+
+		// The slow uploader catches up while Drain waits
+		time.AfterFunc(100*time.Millisecond, func() { close(store.release) })
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		report, err := lm.Drain(ctx)
+		require.NoError(t, err)
+		assert.False(t, report.DeadlineExceeded)
+		assert.Zero(t, report.PendingUploads)
+		assert.Positive(t, store.uploaded.Load())
+		assert.Equal(t, report.Events["payment"].EntriesFlushed, report.EntriesFlushed)
+
+		// Close queues the current file, which the uploader then finishes
+		require.NoError(t, lm.Close())
+		uploader.Stop()
+		assert.Equal(t, 0, uploader.GetUploadTracker().PendingFiles())
+	})
+
+	t.Run("WithoutUploader", func(t *testing.T) {
+		lm, _ := newDrainManager(t, nil)
+
+		report, err := lm.Drain(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, report.PendingUploads)
+		assert.Positive(t, report.Events["payment"].CurrentFileBytes)
+		require.NoError(t, lm.Close())
+	})
+}
@@ -0,0 +1,170 @@
+package asyncloguploader
+
+import (
+	"errors"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventRejectReason describes why the LoggerManager refused an event
+type EventRejectReason string
+
+const (
+	// RejectedEventDrops: event name is not in AllowedEvents and does not match EventNamePattern
+	RejectedEventDrops EventRejectReason = "rejected_event"
+
+	// MaxEventLoggersDrops: creating a logger for the event would exceed MaxEventLoggers
+	MaxEventLoggersDrops EventRejectReason = "max_event_loggers"
+
+	// EventNameCollisionDrops: the event name collides with another after sanitization and
+	// OnEventNameCollision is EventNameCollisionError (counted in RejectedEventDrops)
+	EventNameCollisionDrops EventRejectReason = "event_name_collision"
+)
+
+var (
+	// ErrEventNotAllowed is returned when an event name fails the allowlist/pattern check
+	ErrEventNotAllowed = errors.New("event name not allowed")
+
+	// ErrMaxEventLoggers is returned when the event logger cap has been reached
+	ErrMaxEventLoggers = errors.New("maximum number of event loggers reached")
+)
+
+// eventPolicy is an immutable allowlist/pattern snapshot, swapped atomically on reload
+type eventPolicy struct {
+	allowed map[string]struct{}
+	pattern *regexp.Regexp
+}
+
+// newEventPolicy builds a policy; returns nil when neither allowlist nor pattern is set
+func newEventPolicy(allowedEvents []string, pattern *regexp.Regexp) *eventPolicy {
+	if len(allowedEvents) == 0 && pattern == nil {
+		return nil
+	}
+	p := &eventPolicy{pattern: pattern}
+	if len(allowedEvents) > 0 {
+		p.allowed = make(map[string]struct{}, len(allowedEvents))
+		for _, name := range allowedEvents {
+			p.allowed[name] = struct{}{}
+		}
+	}
+	return p
+}
+
+// allows reports whether eventName is in the allowlist or matches the pattern
+func (p *eventPolicy) allows(eventName string) bool {
+	if _, ok := p.allowed[eventName]; ok {
+		return true
+	}
+	return p.pattern != nil && p.pattern.MatchString(eventName)
+}
+
+// RejectedEvent is the most recent event the LoggerManager refused
+type RejectedEvent struct {
+	EventName string
+	Reason    EventRejectReason
+	Time      time.Time
+}
+
+// eventGuard enforces event name policy and the logger cap, and records rejections
+type eventGuard struct {
+	policy          atomic.Pointer[eventPolicy]
+	policyMu        sync.Mutex // Serializes reloads (readers never lock)
+	maxEventLoggers int64
+
+	// Rejection counters (one per reason)
+	rejectedEventDrops   atomic.Int64
+	maxEventLoggersDrops atomic.Int64
+
+	// Most recent rejection (for diagnostics)
+	lastRejected atomic.Pointer[RejectedEvent]
+
+	// Rate-limited hook: at most one call per reason per hookInterval
+	onRejected         func(eventName string, reason EventRejectReason)
+	hookInterval       time.Duration
+	lastHookRejected   atomic.Int64 // Unix nanoseconds
+	lastHookMaxLoggers atomic.Int64 // Unix nanoseconds
+}
+
+// newEventGuard creates a guard from a validated config
+func newEventGuard(config Config) *eventGuard {
+	g := &eventGuard{
+		maxEventLoggers: int64(config.MaxEventLoggers),
+		onRejected:      config.OnEventRejected,
+		hookInterval:    config.EventRejectHookInterval,
+	}
+	g.policy.Store(newEventPolicy(config.AllowedEvents, config.EventNamePattern))
+	return g
+}
+
+// allows reports whether the current policy permits eventName (always true with no policy)
+func (g *eventGuard) allows(eventName string) bool {
+	p := g.policy.Load()
+	return p == nil || p.allows(eventName)
+}
+
+// setAllowedEvents replaces the allowlist, keeping the current pattern
+func (g *eventGuard) setAllowedEvents(allowedEvents []string) {
+	g.policyMu.Lock()
+	defer g.policyMu.Unlock()
+	var pattern *regexp.Regexp
+	if p := g.policy.Load(); p != nil {
+		pattern = p.pattern
+	}
+	g.policy.Store(newEventPolicy(allowedEvents, pattern))
+}
+
+// setEventNamePattern replaces the pattern, keeping the current allowlist
+func (g *eventGuard) setEventNamePattern(pattern *regexp.Regexp) {
+	g.policyMu.Lock()
+	defer g.policyMu.Unlock()
+	var allowed map[string]struct{}
+	if p := g.policy.Load(); p != nil {
+		allowed = p.allowed
+	}
+	if len(allowed) == 0 && pattern == nil {
+		g.policy.Store(nil)
+		return
+	}
+	// The allowlist map is never mutated after construction, so it can be shared
+	g.policy.Store(&eventPolicy{allowed: allowed, pattern: pattern})
+}
+
+// reject counts a rejection, records it for diagnostics, and calls the hook if not rate-limited
+func (g *eventGuard) reject(eventName string, reason EventRejectReason) {
+	var lastHook *atomic.Int64
+	switch reason {
+	case MaxEventLoggersDrops:
+		g.maxEventLoggersDrops.Add(1)
+		lastHook = &g.lastHookMaxLoggers
+	default:
+		g.rejectedEventDrops.Add(1)
+		lastHook = &g.lastHookRejected
+	}
+
+	now := time.Now()
+	g.lastRejected.Store(&RejectedEvent{EventName: eventName, Reason: reason, Time: now})
+
+	if g.onRejected == nil {
+		return
+	}
+	last := lastHook.Load()
+	if last != 0 && now.UnixNano()-last < g.hookInterval.Nanoseconds() {
+		return
+	}
+	// Only the goroutine that wins the CAS calls the hook for this interval
+	if lastHook.CompareAndSwap(last, now.UnixNano()) {
+		g.onRejected(eventName, reason)
+	}
+}
+
+// countRefused counts n more logs refused for the same reason as err (from getOrCreateLogger)
+func (g *eventGuard) countRefused(err error, n int) {
+	switch {
+	case errors.Is(err, ErrMaxEventLoggers):
+		g.maxEventLoggersDrops.Add(int64(n))
+	case errors.Is(err, ErrEventNotAllowed), errors.Is(err, ErrEventNameCollision):
+		g.rejectedEventDrops.Add(int64(n))
+	}
+}
@@ -0,0 +1,177 @@
+package asyncloguploader
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrEventNameCollision is returned with EventNameCollisionError when an event name sanitizes to
+// the logger key of another event name
+var ErrEventNameCollision = errors.New("event name collides with another event after sanitization")
+
+// eventNamesFileName is the registry of event names and their logger keys in a LoggerManager's
+// base directory, one JSON eventNameRecord per line
+const eventNamesFileName = ".loggermanager.events"
+
+// eventKeyHashLen is the number of hex digits of the hash suffix that disambiguates a logger key
+const eventKeyHashLen = 8
+
+// eventNameRecord is one line of the event name registry file
+type eventNameRecord struct {
+	Event string `json:"event"`
+	Key   string `json:"key"`
+}
+
+// eventNames assigns each event name (after routing) its logger key: the sanitized name, unless
+// another event name already has that key (see Config.OnEventNameCollision). The assignments are
+// appended to the registry file, so a restarted manager gives every name the key it had before
+// whatever order names arrive in
+type eventNames struct {
+	policy EventNameCollisionPolicy
+	path   string
+	logger InternalLogger
+
+	keys sync.Map // Event name (string) -> logger key (string), read without mu on the write path
+
+	mu          sync.Mutex
+	owners      map[string]string   // Logger key -> event name
+	refused     map[string]struct{} // Event names refused with ErrEventNameCollision (logged once)
+	writeFailed bool                // A registry append failed (logged once)
+}
+
+// loadEventNames reads the registry at path (missing is empty); malformed lines, e.g. a line cut
+// short by a crash, are skipped
+func loadEventNames(path string, policy EventNameCollisionPolicy, logger InternalLogger) (*eventNames, error) {
+	n := &eventNames{
+		policy:  policy,
+		path:    path,
+		logger:  logger,
+		owners:  make(map[string]string),
+		refused: make(map[string]struct{}),
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return n, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event name registry: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record eventNameRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil || record.Event == "" || record.Key == "" {
+			continue
+		}
+		if _, taken := n.owners[record.Key]; taken {
+			continue
+		}
+		n.keys.Store(record.Event, record.Key)
+		n.owners[record.Key] = record.Event
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read event name registry: %w", err)
+	}
+	return n, nil
+}
+
+// lookup returns the logger key of eventName without assigning it one: its key if assigned, else
+// the key it would be assigned now
+func (n *eventNames) lookup(eventName string) (string, error) {
+	if key, ok := n.keys.Load(eventName); ok {
+		return key.(string), nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.resolve(eventName, false)
+}
+
+// assign returns the logger key of eventName, assigning and recording it on first use
+func (n *eventNames) assign(eventName string) (string, error) {
+	if key, ok := n.keys.Load(eventName); ok {
+		return key.(string), nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.resolve(eventName, true)
+}
+
+// resolve is lookup (assign false) or assign; n.mu must be held
+func (n *eventNames) resolve(eventName string, assign bool) (string, error) {
+	if key, ok := n.keys.Load(eventName); ok {
+		return key.(string), nil
+	}
+	key, err := sanitizeEventName(eventName)
+	if err != nil {
+		return "", err
+	}
+
+	if owner, taken := n.owners[key]; taken {
+		if n.policy == EventNameCollisionError {
+			return "", fmt.Errorf("%w: %q and %q both sanitize to %q", ErrEventNameCollision, eventName, owner, key)
+		}
+		sanitized := key
+		key = hashedEventKey(sanitized, eventName)
+		if other, taken := n.owners[key]; taken {
+			return "", fmt.Errorf("%w: %q sanitizes to %q, and its disambiguated key %q belongs to %q", ErrEventNameCollision, eventName, sanitized, key, other)
+		}
+	}
+
+	if assign {
+		n.keys.Store(eventName, key)
+		n.owners[key] = eventName
+		n.record(eventName, key)
+	}
+	return key, nil
+}
+
+// warnRefused logs err, the collision that refused a write to eventName, once per event name
+func (n *eventNames) warnRefused(eventName string, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, logged := n.refused[eventName]; !logged {
+		n.refused[eventName] = struct{}{}
+		n.logger.Printf("[WARNING] Refusing event %q: %v", eventName, err)
+	}
+}
+
+// record appends an assignment to the registry file. A failure is logged once and otherwise
+// ignored: the assignment holds until the manager is closed
+func (n *eventNames) record(eventName, key string) {
+	line, err := json.Marshal(eventNameRecord{Event: eventName, Key: key})
+	if err == nil {
+		var file *os.File
+		if err = os.MkdirAll(filepath.Dir(n.path), 0755); err == nil {
+			file, err = os.OpenFile(n.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		}
+		if err == nil {
+			_, err = file.Write(append(line, '\n'))
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	if err != nil && !n.writeFailed {
+		n.writeFailed = true
+		n.logger.Printf("[WARNING] Failed to record event name %q in %s, its logger key may change after a restart: %v", eventName, n.path, err)
+	}
+}
+
+// hashedEventKey disambiguates sanitized, the key of eventName taken by another event name, with a
+// hash of eventName, e.g. payment_event_1f2e3d4c. The result is at most 255 characters long
+func hashedEventKey(sanitized, eventName string) string {
+	h := fnv.New32a()
+	h.Write([]byte(eventName))
+	suffix := fmt.Sprintf("_%0*x", eventKeyHashLen, h.Sum32())
+	if len(sanitized)+len(suffix) > 255 {
+		sanitized = sanitized[:255-len(suffix)]
+	}
+	return sanitized + suffix
+}
@@ -0,0 +1,101 @@
+package asyncloguploader
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggerManager_EventNameCollision(t *testing.T) {
+	t.Run("HashSuffix", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.FlushInterval = time.Hour
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+
+		require.NoError(t, manager.TryLogBytesWithEvent("payment/event", []byte("slash")))
+		require.NoError(t, manager.TryLogBytesWithEvent("payment event", []byte("space")))
+		require.NoError(t, manager.TryLogBytesWithEvent("payment event", []byte("space")))
+
+		// The first name keeps the sanitized key, the second gets its own logger
+		hashed := hashedEventKey("payment_event", "payment event")
+		assert.Regexp(t, `^payment_event_[0-9a-f]{8}$`, hashed)
+		assert.ElementsMatch(t, []string{"payment_event", hashed}, manager.ListEventLoggers())
+
+		total, _, _, _, _, _, _, _, err := manager.GetEventStats("payment/event")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+		total, _, _, _, _, _, _, _, err = manager.GetEventStats("payment event")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), total)
+
+		files, err := manager.GetEventFileStats("payment event")
+		require.NoError(t, err)
+		assert.Contains(t, filepath.Base(files.CurrentFile), hashed)
+
+		// A third spelling is not known until it is logged
+		assert.True(t, manager.HasEventLogger("payment event"))
+		assert.False(t, manager.HasEventLogger("payment:event"))
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.OnEventNameCollision = EventNameCollisionError
+		config.InternalLogger = &captureLogger{}
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+
+		require.NoError(t, manager.TryLogBytesWithEvent("payment/event", []byte("slash")))
+		err = manager.TryLogBytesWithEvent("payment event", []byte("space"))
+		assert.ErrorIs(t, err, ErrEventNameCollision)
+		manager.LogWithEvent("payment event", "space")
+		assert.ErrorIs(t, manager.InitializeEventLogger("payment event"), ErrEventNameCollision)
+
+		assert.Equal(t, []string{"payment_event"}, manager.ListEventLoggers())
+		assert.False(t, manager.HasEventLogger("payment event"))
+		_, _, _, _, _, _, _, _, err = manager.GetEventStats("payment event")
+		assert.ErrorIs(t, err, ErrEventNameCollision)
+
+		rejected, _ := manager.GetEventRejectStats()
+		assert.Equal(t, int64(3), rejected)
+		last, ok := manager.LastRejectedEvent()
+		require.True(t, ok)
+		assert.Equal(t, EventNameCollisionDrops, last.Reason)
+		assert.Len(t, config.InternalLogger.(*captureLogger).Messages(), 1, "each refused name is logged once")
+
+		// The owner of the key is unaffected
+		total, _, _, _, _, _, _, _, err := manager.GetEventStats("payment/event")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+	})
+
+	t.Run("StableAcrossRestarts", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		manager.LogWithEvent("payment/event", "slash")
+		manager.LogWithEvent("payment event", "space")
+		before := manager.ListEventLoggers()
+		require.NoError(t, manager.Close())
+
+		// The names arrive in the other order, and keep their keys
+		manager, err = NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+		manager.LogWithEvent("payment event", "space")
+		files, err := manager.GetEventFileStats("payment event")
+		require.NoError(t, err)
+		assert.Contains(t, filepath.Base(files.CurrentFile), hashedEventKey("payment_event", "payment event"))
+		manager.LogWithEvent("payment/event", "slash")
+		assert.ElementsMatch(t, before, manager.ListEventLoggers())
+
+		total, _, _, _, _, _, _, _, err := manager.GetEventStats("payment/event")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+	})
+}
@@ -0,0 +1,193 @@
+package asyncloguploader
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrSampledOut is returned when an entry is skipped by its event's EventPolicy.SampleRate
+	ErrSampledOut = errors.New("entry sampled out by event policy")
+	// ErrRateLimited is returned when an entry exceeds its event's EventPolicy.MaxEntriesPerSecond
+	ErrRateLimited = errors.New("entry rate limited by event policy")
+)
+
+// EventPolicy limits how many of an event's entries a LoggerManager writes (see SetEventPolicy)
+// Suppressed entries are checked before any copy and counted in SampledOutLogs or RateLimitedLogs,
+// not in TotalLogs or DroppedLogs. Zero fields disable the corresponding limit
+type EventPolicy struct {
+	SampleRate          int     // Write 1 in every SampleRate entries, counting deterministically (0 or 1 = all)
+	MaxEntriesPerSecond float64 // Token-bucket limit on the entries kept by sampling (0 = unlimited)
+	Burst               int     // Token-bucket capacity (default: MaxEntriesPerSecond rounded up)
+}
+
+// validate checks the policy's fields
+func (p EventPolicy) validate() error {
+	if p.SampleRate < 0 {
+		return fmt.Errorf("SampleRate must be >= 0, got %d", p.SampleRate)
+	}
+	if p.MaxEntriesPerSecond < 0 || math.IsNaN(p.MaxEntriesPerSecond) || math.IsInf(p.MaxEntriesPerSecond, 0) {
+		return fmt.Errorf("MaxEntriesPerSecond must be a finite value >= 0, got %v", p.MaxEntriesPerSecond)
+	}
+	if p.Burst < 0 {
+		return fmt.Errorf("Burst must be >= 0, got %d", p.Burst)
+	}
+	return nil
+}
+
+// eventLimiter is the running form of an EventPolicy, installed on an event logger
+// The rate limit is a lock-free token bucket kept as a theoretical arrival time (GCRA): an entry is
+// allowed while tat is at most burstNs ahead of now, and each allowed entry moves tat by intervalNs
+type eventLimiter struct {
+	sampleRate uint64
+	sampled    atomic.Uint64 // Entries seen by sampling
+
+	intervalNs int64        // Nanoseconds per token (0 = no rate limit)
+	burstNs    int64        // Bucket capacity in nanoseconds of tokens
+	tat        atomic.Int64 // Theoretical arrival time (Unix nanoseconds)
+}
+
+// newEventLimiter builds the running form of p, or nil when p limits nothing
+func newEventLimiter(p EventPolicy) *eventLimiter {
+	if p.SampleRate <= 1 && p.MaxEntriesPerSecond == 0 {
+		return nil
+	}
+	limiter := &eventLimiter{sampleRate: uint64(max(p.SampleRate, 1))}
+	if p.MaxEntriesPerSecond > 0 {
+		burst := p.Burst
+		if burst == 0 {
+			burst = max(int(math.Ceil(p.MaxEntriesPerSecond)), 1)
+		}
+		limiter.intervalNs = max(int64(float64(time.Second)/p.MaxEntriesPerSecond), 1)
+		limiter.burstNs = limiter.intervalNs * int64(burst)
+	}
+	return limiter
+}
+
+// admit decides whether the next entry is written: nil, ErrSampledOut or ErrRateLimited
+func (e *eventLimiter) admit() error {
+	if e.sampleRate > 1 && (e.sampled.Add(1)-1)%e.sampleRate != 0 {
+		return ErrSampledOut
+	}
+	if e.intervalNs == 0 {
+		return nil
+	}
+	now := time.Now().UnixNano()
+	for {
+		tat := e.tat.Load()
+		next := max(tat, now) + e.intervalNs
+		if next-now > e.burstNs {
+			return ErrRateLimited
+		}
+		if e.tat.CompareAndSwap(tat, next) {
+			return nil
+		}
+	}
+}
+
+// admit applies the logger's EventPolicy to the next entry, counting suppressed entries
+// While the manager drains, every entry is refused with ErrDraining
+func (l *Logger) admit() error {
+	if l.draining.Load() {
+		l.stats.DrainRejectedLogs.Add(1)
+		return ErrDraining
+	}
+	limiter := l.limiter.Load()
+	if limiter == nil {
+		return nil
+	}
+	err := limiter.admit()
+	switch err {
+	case ErrSampledOut:
+		l.stats.SampledOutLogs.Add(1)
+	case ErrRateLimited:
+		l.stats.RateLimitedLogs.Add(1)
+	}
+	return err
+}
+
+// admitBatch applies the logger's EventPolicy to each entry of a batch
+// Returns the admitted entries (entries itself when none was suppressed) and the first policy error
+func (l *Logger) admitBatch(entries [][]byte) ([][]byte, error) {
+	if l.draining.Load() {
+		l.stats.DrainRejectedLogs.Add(int64(len(entries)))
+		return nil, ErrDraining
+	}
+	if l.limiter.Load() == nil {
+		return entries, nil
+	}
+	var admitted [][]byte
+	var err error
+	for i, entry := range entries {
+		admitErr := l.admit()
+		if admitErr == nil {
+			if admitted != nil {
+				admitted = append(admitted, entry)
+			}
+			continue
+		}
+		if admitted == nil {
+			admitted = append(make([][]byte, 0, len(entries)-1), entries[:i]...)
+		}
+		err = firstError(err, admitErr)
+	}
+	if admitted == nil {
+		return entries, nil
+	}
+	return admitted, err
+}
+
+// SetEventPolicy sets the sampling and rate limit for an event's entries, effective immediately
+// The policy applies to the event logger now or when it is created (and re-created after eviction);
+// a zero EventPolicy removes it. Restarts the event's sampling count and token bucket
+func (lm *LoggerManager) SetEventPolicy(eventName string, policy EventPolicy) error {
+	sanitized, err := lm.assignLoggerKey(eventName)
+	if err != nil {
+		return fmt.Errorf("invalid event name: %w", err)
+	}
+	if err := policy.validate(); err != nil {
+		return fmt.Errorf("invalid policy for event %s: %w", sanitized, err)
+	}
+
+	lm.eventConfigMu.Lock()
+	defer lm.eventConfigMu.Unlock()
+
+	if policy == (EventPolicy{}) {
+		delete(lm.eventPolicies, sanitized)
+	} else {
+		lm.eventPolicies[sanitized] = policy
+	}
+	if logger, ok := lm.loggers.Load(sanitized); ok {
+		logger.(*Logger).limiter.Store(newEventLimiter(policy))
+	}
+	return nil
+}
+
+// GetEventPolicy returns the policy set for an event, and whether one is set
+func (lm *LoggerManager) GetEventPolicy(eventName string) (EventPolicy, bool) {
+	sanitized, err := lm.loggerKey(eventName)
+	if err != nil {
+		return EventPolicy{}, false
+	}
+	lm.eventConfigMu.RLock()
+	defer lm.eventConfigMu.RUnlock()
+	policy, ok := lm.eventPolicies[sanitized]
+	return policy, ok
+}
+
+// GetEventPolicyStats returns the entries an event's policy has suppressed
+func (lm *LoggerManager) GetEventPolicyStats(eventName string) (sampledOut, rateLimited int64, err error) {
+	sanitized, err := lm.loggerKey(eventName)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid event name: %w", err)
+	}
+	logger, ok := lm.loggers.Load(sanitized)
+	if !ok {
+		return 0, 0, fmt.Errorf("event logger not found: %s", sanitized)
+	}
+	stats := &logger.(*Logger).stats
+	return stats.SampledOutLogs.Load(), stats.RateLimitedLogs.Load(), nil
+}
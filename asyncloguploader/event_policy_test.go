@@ -0,0 +1,148 @@
+package asyncloguploader
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggerManager_SetEventPolicy(t *testing.T) {
+	t.Run("sample rate at 10k entries per second", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		tmpDir := filepath.Dir(config.LogFilePath)
+
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		require.NoError(t, manager.SetEventPolicy("debug", EventPolicy{SampleRate: 100}))
+
+		// 10 entries every millisecond for one second
+		const entries = 10000
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		sampledOut := 0
+		for i := 0; i < entries; i++ {
+			if i%10 == 0 {
+				<-ticker.C
+			}
+			if err := manager.TryLogBytesWithEvent("debug", []byte(strconv.Itoa(i))); err != nil {
+				require.ErrorIs(t, err, ErrSampledOut)
+				sampledOut++
+			}
+		}
+		assert.Equal(t, entries-entries/100, sampledOut)
+
+		total, dropped, _, _, _, _, _, _, err := manager.GetEventStats("debug")
+		require.NoError(t, err)
+		assert.Equal(t, int64(entries/100), total)
+		assert.Zero(t, dropped)
+		gotSampled, gotLimited, err := manager.GetEventPolicyStats("debug")
+		require.NoError(t, err)
+		assert.Equal(t, int64(sampledOut), gotSampled)
+		assert.Zero(t, gotLimited)
+		require.NoError(t, manager.Close())
+
+		// Sampling is counter based: exactly every 100th entry, starting with the first
+		messages, _ := readAllMessages(t, findLogFile(t, tmpDir, "debug"))
+		want := make([]string, 0, entries/100)
+		for i := 0; i < entries; i += 100 {
+			want = append(want, strconv.Itoa(i))
+		}
+		got := make([]string, len(messages))
+		for i, msg := range messages {
+			got[i] = string(msg)
+		}
+		assert.ElementsMatch(t, want, got)
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		manager, err := NewLoggerManager(newGuardTestConfig(t))
+		require.NoError(t, err)
+		defer manager.Close()
+		require.NoError(t, manager.SetEventPolicy("debug", EventPolicy{MaxEntriesPerSecond: 100, Burst: 10}))
+
+		start := time.Now()
+		accepted, limited := 0, 0
+		for i := 0; i < 1000; i++ {
+			switch err := manager.TryLogBytesWithEvent("debug", []byte("x")); err {
+			case nil:
+				accepted++
+			case ErrRateLimited:
+				limited++
+			default:
+				t.Fatal(err)
+			}
+		}
+		// The burst, plus one token per 10ms spent in the loop
+		assert.GreaterOrEqual(t, accepted, 10)
+		assert.LessOrEqual(t, accepted, 10+int(time.Since(start)/(10*time.Millisecond))+1)
+
+		total, _, _, _, _, _, _, _, err := manager.GetEventStats("debug")
+		require.NoError(t, err)
+		assert.Equal(t, int64(accepted), total)
+		_, gotLimited, err := manager.GetEventPolicyStats("debug")
+		require.NoError(t, err)
+		assert.Equal(t, int64(limited), gotLimited)
+
+		// Tokens refill over time
+		time.Sleep(50 * time.Millisecond)
+		assert.NoError(t, manager.TryLogBytesWithEvent("debug", []byte("x")))
+	})
+
+	t.Run("policy applies to every write path and can be changed at runtime", func(t *testing.T) {
+		manager, err := NewLoggerManager(newGuardTestConfig(t))
+		require.NoError(t, err)
+		defer manager.Close()
+		require.NoError(t, manager.InitializeEventLogger("debug"))
+		require.NoError(t, manager.SetEventPolicy("debug", EventPolicy{SampleRate: 2}))
+
+		manager.LogBytesWithEvent("debug", []byte("kept"))
+		manager.LogWithEvent("debug", "sampled")
+		assert.NoError(t, manager.LogBytesWithEventCtx(context.Background(), "debug", []byte("kept")))
+		assert.ErrorIs(t, manager.TryLogBytesWithEvent("debug", []byte("sampled")), ErrSampledOut)
+		accepted, err := manager.LogBatchWithEvent("debug", [][]byte{[]byte("kept"), []byte("sampled"), []byte("kept")})
+		assert.ErrorIs(t, err, ErrSampledOut)
+		assert.Equal(t, 2, accepted)
+
+		policy, ok := manager.GetEventPolicy("debug")
+		assert.True(t, ok)
+		assert.Equal(t, 2, policy.SampleRate)
+
+		// A zero policy removes sampling immediately
+		require.NoError(t, manager.SetEventPolicy("debug", EventPolicy{}))
+		_, ok = manager.GetEventPolicy("debug")
+		assert.False(t, ok)
+		for i := 0; i < 5; i++ {
+			assert.NoError(t, manager.TryLogBytesWithEvent("debug", []byte("kept")))
+		}
+
+		total, _, _, _, _, _, _, _, err := manager.GetEventStats("debug")
+		require.NoError(t, err)
+		assert.Equal(t, int64(9), total)
+		sampledOut, _, err := manager.GetEventPolicyStats("debug")
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), sampledOut)
+	})
+
+	t.Run("invalid policy is rejected", func(t *testing.T) {
+		manager, err := NewLoggerManager(newGuardTestConfig(t))
+		require.NoError(t, err)
+		defer manager.Close()
+		assert.Error(t, manager.SetEventPolicy("debug", EventPolicy{SampleRate: -1}))
+		assert.Error(t, manager.SetEventPolicy("debug", EventPolicy{MaxEntriesPerSecond: -5}))
+		assert.Error(t, manager.SetEventPolicy("", EventPolicy{SampleRate: 2}))
+	})
+}
+
+func TestLogger_AdmitAllocations(t *testing.T) {
+	logger := &Logger{}
+	logger.limiter.Store(newEventLimiter(EventPolicy{SampleRate: 100}))
+	allocs := testing.AllocsPerRun(1000, func() {
+		_ = logger.admit()
+	})
+	assert.Zero(t, allocs)
+}
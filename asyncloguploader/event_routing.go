@@ -0,0 +1,209 @@
+package asyncloguploader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sync"
+	"sync/atomic"
+)
+
+// RouteRule sends the entries of every event whose name matches onto the Target event's logger
+// (and so its file, {Target}.log). Set Glob or Regexp, not both (see Config.EventRouting)
+type RouteRule struct {
+	Glob   string         // path.Match pattern on the event name as passed, e.g. "search.*.prod.*"
+	Regexp *regexp.Regexp // Matches if it matches anywhere in the event name (anchor it with ^...$)
+	Target string         // Event whose logger receives the matched events
+}
+
+// matches reports whether eventName matches the rule's pattern
+func (r RouteRule) matches(eventName string) bool {
+	if r.Regexp != nil {
+		return r.Regexp.MatchString(eventName)
+	}
+	matched, _ := path.Match(r.Glob, eventName) // Syntax was checked by Config.Validate
+	return matched
+}
+
+// routeCacheSize bounds the routed event names remembered by eventRouter
+// Names beyond it are matched against the rules on every write
+const routeCacheSize = 4096
+
+// routeTagSize is the longest tag of a routed entry: the event name (cut at 255 bytes) and a tab
+const routeTagSize = 256
+
+// eventRouter resolves event names to the event whose logger writes them (Config.EventRouting)
+type eventRouter struct {
+	rules    []RouteRule
+	catchAll string              // Target of events no rule matches ("" = their own logger)
+	tag      bool                // Config.TagRoutedEvents
+	targets  map[string]struct{} // Sanitized targets, whose entries are tagged with tag set
+
+	// Resolved targets by event name, up to routeCacheSize names
+	cache     sync.Map // string -> string
+	cacheSize atomic.Int64
+}
+
+// newEventRouter creates the router for config's routing (nil when no routing is configured)
+// The rules were checked by Config.Validate
+func newEventRouter(config Config) *eventRouter {
+	if len(config.EventRouting) == 0 && config.EventRoutingCatchAll == "" {
+		return nil
+	}
+	r := &eventRouter{
+		rules:    config.EventRouting,
+		catchAll: config.EventRoutingCatchAll,
+		tag:      config.TagRoutedEvents,
+		targets:  make(map[string]struct{}),
+	}
+	for _, rule := range r.rules {
+		target, _ := sanitizeEventName(rule.Target)
+		r.targets[target] = struct{}{}
+	}
+	if r.catchAll != "" {
+		target, _ := sanitizeEventName(r.catchAll)
+		r.targets[target] = struct{}{}
+	}
+	return r
+}
+
+// route returns the event whose logger receives eventName's entries: the target of the first
+// matching rule, else the catch-all, else eventName itself
+func (r *eventRouter) route(eventName string) string {
+	if r == nil {
+		return eventName
+	}
+	if target, ok := r.cache.Load(eventName); ok {
+		return target.(string)
+	}
+
+	target := eventName
+	if r.catchAll != "" {
+		target = r.catchAll
+	}
+	for _, rule := range r.rules {
+		if rule.matches(eventName) {
+			target = rule.Target
+			break
+		}
+	}
+	if r.cacheSize.Load() < routeCacheSize {
+		if _, loaded := r.cache.LoadOrStore(eventName, target); !loaded {
+			r.cacheSize.Add(1)
+		}
+	}
+	return target
+}
+
+// tagFor fills buf with the tag of an entry of eventName written to logger and returns it, or
+// returns nil when the logger's entries are not tagged
+// Tabs in the name become '_', so the first tab always ends the tag
+func (r *eventRouter) tagFor(buf *[routeTagSize]byte, eventName string, logger *Logger) []byte {
+	if r == nil || !r.tag {
+		return nil
+	}
+	if _, ok := r.targets[logger.config.EventName]; !ok {
+		return nil
+	}
+	n := copy(buf[:routeTagSize-1], eventName)
+	for i, c := range buf[:n] {
+		if c == '\t' {
+			buf[i] = '_'
+		}
+	}
+	buf[n] = '\t'
+	return buf[:n+1]
+}
+
+// validateEventRouting checks Config.EventRouting and EventRoutingCatchAll
+// reserved is the self-metrics event name ("" when self-metrics are off), which cannot be a target
+func validateEventRouting(rules []RouteRule, catchAll, reserved string) error {
+	for i, rule := range rules {
+		if (rule.Glob == "") == (rule.Regexp == nil) {
+			return fmt.Errorf("EventRouting[%d]: set Glob or Regexp", i)
+		}
+		if rule.Glob != "" {
+			if _, err := path.Match(rule.Glob, ""); err != nil {
+				return fmt.Errorf("EventRouting[%d]: invalid Glob %q: %w", i, rule.Glob, err)
+			}
+		}
+		if _, err := sanitizeEventName(rule.Target); err != nil {
+			return fmt.Errorf("EventRouting[%d]: invalid Target: %w", i, err)
+		}
+		if reserved != "" && rule.Target == reserved {
+			return fmt.Errorf("EventRouting[%d]: %s is reserved", i, reserved)
+		}
+	}
+	if catchAll != "" {
+		if _, err := sanitizeEventName(catchAll); err != nil {
+			return fmt.Errorf("EventRoutingCatchAll: %w", err)
+		}
+		if reserved != "" && catchAll == reserved {
+			return fmt.Errorf("EventRoutingCatchAll: %s is reserved", reserved)
+		}
+	}
+	return nil
+}
+
+// RouteEvent returns the event whose logger receives eventName's entries (see Config.EventRouting)
+// Per-event methods taking an event name (GetEventStats, FlushEvent, SetEventPolicy, ...) act on
+// that logger, and ListEventLoggers lists these physical loggers
+func (lm *LoggerManager) RouteEvent(eventName string) string {
+	if lm.isSelfMetricsEvent(eventName) {
+		return eventName
+	}
+	return lm.router.route(eventName)
+}
+
+// loggerKey returns the key of the logger that receives eventName's entries: the routed name,
+// sanitized and disambiguated (see Config.OnEventNameCollision)
+func (lm *LoggerManager) loggerKey(eventName string) (string, error) {
+	return lm.names.lookup(lm.RouteEvent(eventName))
+}
+
+// assignLoggerKey is loggerKey for creating or configuring eventName's logger: a name without a
+// key is assigned one, which it keeps from then on
+func (lm *LoggerManager) assignLoggerKey(eventName string) (string, error) {
+	return lm.names.assign(lm.RouteEvent(eventName))
+}
+
+// logRouted writes data to logger, the logger of eventName, tagged with the event name when the
+// logger is a routing target and TagRoutedEvents is set (see Logger.TryLogBytes)
+// A non-nil ctx writes as Logger.LogBytesCtx
+func (lm *LoggerManager) logRouted(ctx context.Context, eventName string, logger *Logger, data []byte) error {
+	var buf [routeTagSize]byte
+	tag := lm.router.tagFor(&buf, eventName, logger)
+	if ctx == nil {
+		return logger.tryLogBytes(tag, data, 0, false, nil)
+	}
+	if err := logger.tryLogBytes(tag, data, 0, false, ctx.Done()); err != errCancelled {
+		return err
+	}
+	return ctx.Err()
+}
+
+// logTaggedBatch writes entries one by one with tag, for batches to a tagging routing target
+// (LogBatch's runs have no room for a per-entry tag). Returns as Logger.LogBatch
+func (l *Logger) logTaggedBatch(tag []byte, entries [][]byte) (accepted int, err error) {
+	for _, entry := range entries {
+		if logErr := l.tryLogBytes(tag, entry, 0, false, nil); logErr != nil {
+			err = firstError(err, logErr)
+			continue
+		}
+		accepted++
+	}
+	return accepted, err
+}
+
+// SplitRoutedEntry splits an entry read from a routing target's file written with TagRoutedEvents
+// into the event name it was logged under and its data. ok is false if the entry has no tag
+// data aliases entry
+func SplitRoutedEntry(entry []byte) (eventName string, data []byte, ok bool) {
+	i := bytes.IndexByte(entry, '\t')
+	if i <= 0 || i >= routeTagSize {
+		return "", entry, false
+	}
+	return string(entry[:i]), entry[i+1:], true
+}
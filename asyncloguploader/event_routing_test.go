@@ -0,0 +1,214 @@
+package asyncloguploader
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readRoutedEntries splits every message of an event file into its routed event name and data
+// Each event's data is sorted, as entries in different shards are read in shard order
+func readRoutedEntries(t *testing.T, dir, event string) map[string][]string {
+	t.Helper()
+	messages, _ := readAllMessages(t, findLogFile(t, dir, event))
+	entries := make(map[string][]string)
+	for _, msg := range messages {
+		name, data, ok := SplitRoutedEntry(msg)
+		require.True(t, ok, "untagged entry %q", msg)
+		entries[name] = append(entries[name], string(data))
+	}
+	for _, data := range entries {
+		sort.Strings(data)
+	}
+	return entries
+}
+
+func TestLoggerManager_EventRouting(t *testing.T) {
+	rules := []RouteRule{
+		{Glob: "search.*.prod", Target: "search_prod"},
+		{Regexp: regexp.MustCompile(`^search\.`), Target: "search"},
+		{Glob: "search.*", Target: "never"}, // Shadowed by the rule above
+	}
+
+	t.Run("first matching rule wins", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.EventRouting = rules
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+
+		for event, want := range map[string]string{
+			"search.web.prod":    "search_prod",
+			"search.web.staging": "search",
+			"search.api":         "search",
+			"searchweb":          "searchweb", // Unmatched: own logger
+			"payment":            "payment",
+		} {
+			assert.Equal(t, want, manager.RouteEvent(event), event)
+		}
+	})
+
+	t.Run("routed events share the target logger", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.EventRouting = rules
+		tmpDir := filepath.Dir(config.LogFilePath)
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+
+		manager.LogWithEvent("search.web.staging", "a")
+		require.NoError(t, manager.TryLogBytesWithEvent("search.api", []byte("b")))
+		manager.LogWithEvent("search.web.prod", "c")
+		manager.LogWithEvent("payment", "d")
+
+		loggers := manager.ListEventLoggers()
+		sort.Strings(loggers)
+		assert.Equal(t, []string{"payment", "search", "search_prod"}, loggers)
+
+		// Per-event introspection resolves the routed name to its target's logger
+		assert.True(t, manager.HasEventLogger("search.api"))
+		assert.True(t, manager.HasEventLogger("search.anything"))
+		assert.False(t, manager.HasEventLogger("searchweb")) // Unmatched: its own logger, not created
+		total, _, _, _, _, _, _, _, err := manager.GetEventStats("search.api")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), total)
+		require.NoError(t, manager.Close())
+
+		// Untagged: the target file holds the data as logged
+		messages, _ := readAllMessages(t, findLogFile(t, tmpDir, "search"))
+		got := []string{string(messages[0]), string(messages[1])}
+		assert.ElementsMatch(t, []string{"a", "b"}, got)
+	})
+
+	t.Run("catch-all takes unmatched events", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.EventRouting = rules[:1]
+		config.EventRoutingCatchAll = "other"
+		config.TagRoutedEvents = true
+		tmpDir := filepath.Dir(config.LogFilePath)
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+
+		manager.LogWithEvent("payment", "p")
+		manager.LogWithEvent("refund", "r")
+		manager.LogWithEvent("search.web.prod", "s")
+		loggers := manager.ListEventLoggers()
+		sort.Strings(loggers)
+		assert.Equal(t, []string{"other", "search_prod"}, loggers)
+		require.NoError(t, manager.Close())
+
+		assert.Equal(t, map[string][]string{"payment": {"p"}, "refund": {"r"}}, readRoutedEntries(t, tmpDir, "other"))
+		assert.Equal(t, map[string][]string{"search.web.prod": {"s"}}, readRoutedEntries(t, tmpDir, "search_prod"))
+	})
+
+	t.Run("tags carry the logical event name on every write path", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.EventRouting = rules
+		config.TagRoutedEvents = true
+		tmpDir := filepath.Dir(config.LogFilePath)
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+
+		manager.LogBytesWithEvent("search.a", []byte("1"))
+		manager.LogWithEvent("search.b", "2")
+		accepted, err := manager.LogBatchWithEvent("search.c", [][]byte{[]byte("3"), []byte("4")})
+		require.NoError(t, err)
+		assert.Equal(t, 2, accepted)
+		// Both events resolve to one logger: written once, tagged with the first name
+		_, err = manager.LogBytesToEvents([]string{"search.d", "search.e"}, []byte("5"))
+		require.NoError(t, err)
+		manager.LogWithEvent("payment", "untagged")
+		require.NoError(t, manager.Close())
+
+		assert.Equal(t, map[string][]string{
+			"search.a": {"1"},
+			"search.b": {"2"},
+			"search.c": {"3", "4"},
+			"search.d": {"5"},
+		}, readRoutedEntries(t, tmpDir, "search"))
+
+		// Loggers that are not routing targets are not tagged
+		messages, _ := readAllMessages(t, findLogFile(t, tmpDir, "payment"))
+		require.Len(t, messages, 1)
+		assert.Equal(t, "untagged", string(messages[0]))
+	})
+
+	t.Run("tag counts toward MaxMessageSize", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.EventRouting = rules
+		config.TagRoutedEvents = true
+		config.MaxMessageSize = 16
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+
+		assert.NoError(t, manager.TryLogBytesWithEvent("search.a", []byte("0123456")))
+		assert.ErrorIs(t, manager.TryLogBytesWithEvent("search.a", []byte("01234567")), ErrOversized)
+	})
+
+	t.Run("guardrails check the logical name", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.EventRouting = rules
+		config.AllowedEvents = []string{"search.api"}
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+
+		assert.NoError(t, manager.TryLogBytesWithEvent("search.api", []byte("ok")))
+		assert.ErrorIs(t, manager.TryLogBytesWithEvent("search.web", []byte("no")), ErrEventNotAllowed)
+		assert.ErrorIs(t, manager.TryLogBytesWithEvent("search", []byte("no")), ErrEventNotAllowed)
+	})
+
+	t.Run("per-event settings apply to the target", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.EventRouting = rules
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+
+		require.NoError(t, manager.SetEventPolicy("search.api", EventPolicy{SampleRate: 2}))
+		policy, ok := manager.GetEventPolicy("search")
+		require.True(t, ok)
+		assert.Equal(t, 2, policy.SampleRate)
+
+		require.NoError(t, manager.InitializeEventLogger("search.api"))
+		assert.ErrorIs(t, manager.SetEventConfig("search.web", EventConfig{}), ErrEventLoggerExists)
+		require.NoError(t, manager.CloseEventLogger("search.web"))
+		assert.False(t, manager.HasEventLogger("search"))
+	})
+}
+
+func TestConfig_ValidateEventRouting(t *testing.T) {
+	for name, tc := range map[string]struct {
+		rules   []RouteRule
+		errPart string
+	}{
+		"no pattern":    {rules: []RouteRule{{Target: "a"}}, errPart: "set Glob or Regexp"},
+		"both patterns": {rules: []RouteRule{{Glob: "a", Regexp: regexp.MustCompile("a"), Target: "a"}}, errPart: "set Glob or Regexp"},
+		"bad glob":      {rules: []RouteRule{{Glob: "[", Target: "a"}}, errPart: "invalid Glob"},
+		"empty target":  {rules: []RouteRule{{Glob: "a*", Target: ""}}, errPart: "invalid Target"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			config := newGuardTestConfig(t)
+			config.EventRouting = tc.rules
+			err := config.Validate()
+			require.Error(t, err)
+			assert.True(t, strings.Contains(err.Error(), tc.errPart), err.Error())
+		})
+	}
+}
+
+func TestSplitRoutedEntry(t *testing.T) {
+	name, data, ok := SplitRoutedEntry([]byte("search.a\tpayload\twith tab"))
+	require.True(t, ok)
+	assert.Equal(t, "search.a", name)
+	assert.Equal(t, "payload\twith tab", string(data))
+
+	_, data, ok = SplitRoutedEntry([]byte("no tag"))
+	assert.False(t, ok)
+	assert.Equal(t, "no tag", string(data))
+}
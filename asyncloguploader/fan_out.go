@@ -0,0 +1,107 @@
+package asyncloguploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// MaxFanOutEvents is the most events one LogBytesToEvents call or MirrorEvents rule can target
+const MaxFanOutEvents = 64
+
+// ErrTooManyEvents is returned by LogBytesToEvents when given more than MaxFanOutEvents events
+var ErrTooManyEvents = errors.New("too many fan-out events")
+
+// LogBytesToEvents writes one entry to several event streams, copying data into each event's shard
+// Every event logger is resolved before anything is written: if an event is refused by a guardrail,
+// cannot be created, or its logger is closed, nothing is written and that error is returned. Events
+// that resolve to the same logger are written once. Otherwise bit i of accepted is set when events[i]
+// took the entry, and err is the first write error (see Logger.TryLogBytes), wrapped with its event
+func (lm *LoggerManager) LogBytesToEvents(events []string, data []byte) (accepted uint64, err error) {
+	return lm.logToEvents(nil, events, data)
+}
+
+// logToEvents implements LogBytesToEvents; a non-nil ctx writes with Logger.LogBytesCtx
+func (lm *LoggerManager) logToEvents(ctx context.Context, events []string, data []byte) (accepted uint64, err error) {
+	if len(events) > MaxFanOutEvents {
+		return 0, fmt.Errorf("%w: %d (max %d)", ErrTooManyEvents, len(events), MaxFanOutEvents)
+	}
+
+	// Pin every target first, so a refused or closed event short-circuits before any copy
+	var loggers [MaxFanOutEvents]*Logger
+	resolved := 0
+	defer func() {
+		for _, logger := range loggers[:resolved] {
+			lm.releaseLogger(logger)
+		}
+	}()
+	for i, eventName := range events {
+		logger, resolveErr := lm.acquireLogger(eventName)
+		if resolveErr != nil {
+			return 0, fmt.Errorf("event %s: %w", eventName, resolveErr)
+		}
+		loggers[i] = logger
+		resolved++
+		if logger.life.Closed() {
+			return 0, fmt.Errorf("event %s: %w", eventName, ErrClosed)
+		}
+	}
+
+	for i, logger := range loggers[:resolved] {
+		if j := slices.Index(loggers[:i], logger); j >= 0 {
+			accepted |= (accepted >> j & 1) << i
+			continue
+		}
+		// Routed events sharing a logger write once, tagged with the first one's name
+		writeErr := logger.admit()
+		if writeErr == nil {
+			writeErr = lm.logRouted(ctx, events[i], logger, data)
+		}
+		if writeErr != nil {
+			if err == nil {
+				err = fmt.Errorf("event %s: %w", events[i], writeErr)
+			}
+			continue
+		}
+		accepted |= 1 << i
+	}
+	return accepted, err
+}
+
+// newMirrorRules expands Config.MirrorEvents into the targets of each mirrored event: the event
+// itself followed by its mirrors, with duplicates removed. Names were checked by Config.Validate
+func newMirrorRules(mirrorEvents map[string][]string) map[string][]string {
+	if len(mirrorEvents) == 0 {
+		return nil
+	}
+	rules := make(map[string][]string, len(mirrorEvents))
+	for eventName, mirrors := range mirrorEvents {
+		targets := []string{eventName}
+		for _, mirror := range mirrors {
+			if !slices.Contains(targets, mirror) {
+				targets = append(targets, mirror)
+			}
+		}
+		rules[eventName] = targets
+	}
+	return rules
+}
+
+// validateMirrorEvents checks Config.MirrorEvents names and target counts
+func validateMirrorEvents(mirrorEvents map[string][]string) error {
+	for eventName, mirrors := range mirrorEvents {
+		if _, err := sanitizeEventName(eventName); err != nil {
+			return fmt.Errorf("MirrorEvents: %w", err)
+		}
+		if len(mirrors)+1 > MaxFanOutEvents {
+			return fmt.Errorf("MirrorEvents[%q]: %d mirrors exceeds %d events", eventName, len(mirrors), MaxFanOutEvents-1)
+		}
+		for _, mirror := range mirrors {
+			if _, err := sanitizeEventName(mirror); err != nil {
+				return fmt.Errorf("MirrorEvents[%q]: %w", eventName, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package asyncloguploader
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggerManager_LogBytesToEvents(t *testing.T) {
+	t.Run("entry is written to every event once", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		tmpDir := filepath.Dir(config.LogFilePath)
+
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+
+		accepted, err := manager.LogBytesToEvents([]string{"payment", "audit", "payment"}, []byte("paid"))
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0b111), accepted)
+
+		for _, event := range []string{"payment", "audit"} {
+			total, dropped, _, _, _, _, _, _, err := manager.GetEventStats(event)
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), total, event)
+			assert.Zero(t, dropped, event)
+		}
+		require.NoError(t, manager.Close())
+
+		for _, event := range []string{"payment", "audit"} {
+			messages, _ := readAllMessages(t, findLogFile(t, tmpDir, event))
+			require.Len(t, messages, 1, event)
+			assert.Equal(t, "paid", string(messages[0]))
+		}
+	})
+
+	t.Run("refused event writes nothing", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.AllowedEvents = []string{"payment"}
+
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+
+		accepted, err := manager.LogBytesToEvents([]string{"payment", "refund"}, []byte("paid"))
+		assert.ErrorIs(t, err, ErrEventNotAllowed)
+		assert.Zero(t, accepted)
+
+		total, _, _, _, _, _, _, _, err := manager.GetEventStats("payment")
+		require.NoError(t, err)
+		assert.Zero(t, total)
+	})
+
+	t.Run("closed logger writes nothing", func(t *testing.T) {
+		manager, err := NewLoggerManager(newGuardTestConfig(t))
+		require.NoError(t, err)
+		defer manager.Close()
+
+		require.NoError(t, manager.InitializeEventLogger("audit"))
+		logger, _ := manager.loggers.Load("audit")
+		require.NoError(t, logger.(*Logger).Close())
+
+		accepted, err := manager.LogBytesToEvents([]string{"payment", "audit"}, []byte("paid"))
+		assert.ErrorIs(t, err, ErrClosed)
+		assert.Zero(t, accepted)
+
+		total, _, _, _, _, _, _, _, err := manager.GetEventStats("payment")
+		require.NoError(t, err)
+		assert.Zero(t, total)
+	})
+
+	t.Run("too many events", func(t *testing.T) {
+		manager, err := NewLoggerManager(newGuardTestConfig(t))
+		require.NoError(t, err)
+		defer manager.Close()
+
+		events := make([]string, MaxFanOutEvents+1)
+		for i := range events {
+			events[i] = "event" + strconv.Itoa(i)
+		}
+		_, err = manager.LogBytesToEvents(events, []byte("x"))
+		assert.ErrorIs(t, err, ErrTooManyEvents)
+		assert.Empty(t, manager.ListEventLoggers())
+	})
+}
+
+func TestLoggerManager_MirrorEvents(t *testing.T) {
+	config := newGuardTestConfig(t)
+	config.MirrorEvents = map[string][]string{"payment": {"audit", "payment"}, "audit": {"archive"}}
+	tmpDir := filepath.Dir(config.LogFilePath)
+
+	manager, err := NewLoggerManager(config)
+	require.NoError(t, err)
+
+	manager.LogWithEvent("payment", "one")
+	manager.LogBytesWithEvent("payment", []byte("two"))
+	require.NoError(t, manager.TryLogBytesWithEvent("payment", []byte("three")))
+	require.NoError(t, manager.LogBytesWithEventCtx(context.Background(), "payment", []byte("four")))
+	accepted, err := manager.LogBatchWithEvent("payment", [][]byte{[]byte("five")})
+	require.NoError(t, err)
+	assert.Equal(t, 1, accepted)
+	manager.LogWithEvent("login", "not mirrored")
+
+	// Mirrors are not transitive: audit's own rule does not apply to entries mirrored into it
+	assert.False(t, manager.HasEventLogger("archive"))
+	for _, event := range []string{"payment", "audit"} {
+		total, _, _, _, _, _, _, _, err := manager.GetEventStats(event)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), total, event)
+	}
+	require.NoError(t, manager.Close())
+
+	want := []string{"one", "two", "three", "four", "five"}
+	for _, event := range []string{"payment", "audit"} {
+		messages, _ := readAllMessages(t, findLogFile(t, tmpDir, event))
+		got := make([]string, len(messages))
+		for i, msg := range messages {
+			got[i] = string(msg)
+		}
+		assert.ElementsMatch(t, want, got, event)
+	}
+
+	t.Run("invalid names are rejected", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.MirrorEvents = map[string][]string{"payment": {""}}
+		_, err := NewLoggerManager(config)
+		assert.Error(t, err)
+	})
+}
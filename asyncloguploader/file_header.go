@@ -0,0 +1,82 @@
+package asyncloguploader
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// File header written at the start of each log file with Config.WriteFileHeader (all integers
+// little-endian):
+//
+//	magic "ALOG" | version:u16 | flags:u16 | headerSize:u32 | alignment:u32 |
+//	createdUnixNano:i64 | shardCapacity:u32 | numShards:u32 | zero padding up to headerSize
+//
+// The header fills one alignment block (Config.IOAlignment) so shards stay aligned for Direct I/O.
+// Files without it (written before the header existed, or with WriteFileHeader off) start with a
+// shard header, whose first byte is a shard format version (0 or 1), never 'A'
+const (
+	fileHeaderMagic   = "ALOG"
+	fileHeaderVersion = 1
+	fileHeaderSize    = alignmentSize // With the default IOAlignment
+)
+
+// File header flags
+const (
+	FileFlagChecksums = 1 << 0 // Shards end with a CRC32C trailer (Config.EnableChecksums)
+)
+
+// FileHeader describes how a log file was written (see Config.WriteFileHeader)
+type FileHeader struct {
+	Version       int       // File header format version
+	Flags         uint16    // FileFlag* bits
+	Size          int       // Header bytes, including padding; the first shard starts here
+	Alignment     int       // Block size shards are aligned to
+	Created       time.Time // When the file was created
+	ShardCapacity int       // Configured shard buffer size (BufferSize / NumShards, aligned)
+	NumShards     int
+}
+
+// Checksums reports whether the file's shards end with a CRC32C trailer
+func (h FileHeader) Checksums() bool {
+	return h.Flags&FileFlagChecksums != 0
+}
+
+// newFileHeader returns the header for files written with config, or nil without WriteFileHeader
+// Created is set when each file is created
+func newFileHeader(config Config) *FileHeader {
+	if !config.WriteFileHeader {
+		return nil
+	}
+	alignment := config.ioAlignment()
+	h := &FileHeader{
+		Version:       fileHeaderVersion,
+		Size:          alignment,
+		Alignment:     alignment,
+		ShardCapacity: alignSize(config.BufferSize/max(config.NumShards, 1), alignment),
+		NumShards:     config.NumShards,
+	}
+	if config.EnableChecksums {
+		h.Flags |= FileFlagChecksums
+	}
+	return h
+}
+
+// encode writes the header into buf (at least Size bytes, zeroed) with the given creation time
+func (h FileHeader) encode(buf []byte, created time.Time) {
+	copy(buf[0:4], fileHeaderMagic)
+	binary.LittleEndian.PutUint16(buf[4:6], uint16(h.Version))
+	binary.LittleEndian.PutUint16(buf[6:8], h.Flags)
+	binary.LittleEndian.PutUint32(buf[8:12], uint32(h.Size))
+	binary.LittleEndian.PutUint32(buf[12:16], uint32(h.Alignment))
+	binary.LittleEndian.PutUint64(buf[16:24], uint64(created.UnixNano()))
+	binary.LittleEndian.PutUint32(buf[24:28], uint32(h.ShardCapacity))
+	binary.LittleEndian.PutUint32(buf[28:32], uint32(h.NumShards))
+}
+
+// dataStart returns the file offset of the first shard in files written with header (nil = none)
+func (h *FileHeader) dataStart() int64 {
+	if h == nil {
+		return 0
+	}
+	return int64(h.Size)
+}
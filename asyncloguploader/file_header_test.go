@@ -0,0 +1,127 @@
+package asyncloguploader
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeFileHeader reads the file header at the start of data with Reader
+func decodeFileHeader(data []byte) (FileHeader, bool) {
+	reader := NewReader(bytes.NewReader(data))
+	reader.Next()
+	return reader.FileHeader()
+}
+
+func TestFileHeader(t *testing.T) {
+	t.Run("EncodesAndParses", func(t *testing.T) {
+		config := DefaultConfig("/tmp/test.log")
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 4
+		config.EnableChecksums = true
+		h := newFileHeader(config)
+		require.NotNil(t, h)
+
+		created := time.Unix(1700000000, 42)
+		buf := make([]byte, h.Size)
+		h.encode(buf, created)
+		assert.Equal(t, fileHeaderMagic, string(buf[:4]))
+
+		parsed, ok := decodeFileHeader(buf)
+		require.True(t, ok)
+		assert.Equal(t, FileHeader{
+			Version:       fileHeaderVersion,
+			Flags:         FileFlagChecksums,
+			Size:          alignmentSize,
+			Alignment:     alignmentSize,
+			Created:       created,
+			ShardCapacity: 256 * 1024,
+			NumShards:     4,
+		}, parsed)
+		assert.True(t, parsed.Checksums())
+
+		config.WriteFileHeader = false
+		assert.Nil(t, newFileHeader(config))
+		assert.Equal(t, int64(0), newFileHeader(config).dataStart())
+	})
+
+	t.Run("WrittenToEachFile", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		config := DefaultConfig(filepath.Join(tmpDir, "test.log"))
+		config.MaxFileSize = 4 * 1024 * 1024
+		config.PreallocateFileSize = 1024 * 1024
+
+		writer, err := NewSizeFileWriter(config, nil)
+		require.NoError(t, err)
+		buf, cleanup, err := allocMmapBuffer(4096)
+		require.NoError(t, err)
+		defer cleanup()
+		copy(buf, "first")
+		_, err = writer.WriteVectored([][]byte{buf})
+		require.NoError(t, err)
+		first := writer.filePath
+
+		// Force a rotation: the new file also starts with a header
+		writer.rotationMu.Lock()
+		require.NoError(t, writer.createNextFile())
+		require.NoError(t, writer.swapFiles())
+		writer.rotationMu.Unlock()
+		copy(buf, "second")
+		_, err = writer.WriteVectored([][]byte{buf})
+		require.NoError(t, err)
+		second := writer.filePath
+		require.NotEqual(t, first, second)
+		require.NoError(t, writer.Close())
+
+		for i, path := range []string{first, second} {
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.Len(t, data, alignmentSize+4096)
+			header, ok := decodeFileHeader(data)
+			require.True(t, ok)
+			assert.Equal(t, alignmentSize, header.Size)
+			assert.WithinDuration(t, time.Now(), header.Created, time.Minute)
+			assert.Equal(t, []string{"first", "second"}[i], string(data[alignmentSize:alignmentSize+5+i]))
+		}
+	})
+
+	t.Run("ReaderReportsHeader", func(t *testing.T) {
+		logger, tmpDir := newSizeTestLogger(t, "headered", nil)
+		for i := 0; i < 10; i++ {
+			logger.LogBytes([]byte(fmt.Sprintf("message %d", i)))
+		}
+		require.NoError(t, logger.Close())
+
+		messages, reader := readAllMessages(t, findLogFile(t, tmpDir, "headered"))
+		assert.Len(t, messages, 10)
+		header, ok := reader.FileHeader()
+		require.True(t, ok)
+		assert.Equal(t, 256*1024, header.ShardCapacity)
+		assert.Equal(t, 4, header.NumShards)
+		assert.False(t, header.Checksums())
+	})
+
+	t.Run("ReaderAcceptsHeaderlessFiles", func(t *testing.T) {
+		logger, tmpDir := newSizeTestLogger(t, "legacy", func(c *Config) { c.WriteFileHeader = false })
+		for i := 0; i < 10; i++ {
+			logger.LogBytes([]byte(fmt.Sprintf("message %d", i)))
+		}
+		require.NoError(t, logger.Close())
+
+		path := findLogFile(t, tmpDir, "legacy")
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.NotEqual(t, fileHeaderMagic, string(data[:4]))
+
+		messages, reader := readAllMessages(t, path)
+		assert.Len(t, messages, 10)
+		_, ok := reader.FileHeader()
+		assert.False(t, ok)
+	})
+}
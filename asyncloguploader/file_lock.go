@@ -0,0 +1,86 @@
+package asyncloguploader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrFileLocked is returned by NewLogger and NewLoggerManager when another logger (in this or
+// another process) holds the lock on the same log files (see Config.DisableFileLock)
+var ErrFileLocked = errors.New("log files are locked by another logger")
+
+// errLockHeld is returned by lockFile when the lock is held elsewhere
+var errLockHeld = errors.New("lock held")
+
+// managerLockName is the lock file a LoggerManager holds in its base directory
+const managerLockName = ".loggermanager.lock"
+
+// fileLock is an advisory exclusive lock on a sidecar lock file, held until release
+// The lock file is left in place on release: removing it could split a later locker from one
+// that already opened it
+type fileLock struct {
+	file *os.File
+}
+
+// acquireFileLock takes the lock on path without waiting, creating the file if needed
+// The holder's PID is written to the file for the error a later locker reports
+func acquireFileLock(path string) (*fileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		if errors.Is(err, errLockHeld) {
+			return nil, fmt.Errorf("%w: %s%s", ErrFileLocked, path, lockHolder(path))
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+
+	// Best effort: the PID only improves the error message
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &fileLock{file: file}, nil
+}
+
+// lockHolder describes the PID recorded in the lock file at path, if any
+func lockHolder(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	pid := strings.TrimSpace(string(data))
+	if pid == "" {
+		return ""
+	}
+	if pid == strconv.Itoa(os.Getpid()) {
+		return " (held by this process)"
+	}
+	return " (held by pid " + pid + ")"
+}
+
+// release unlocks and closes the lock file; a nil lock does nothing
+func (l *fileLock) release() error {
+	if l == nil {
+		return nil
+	}
+	unlockErr := unlockFile(l.file)
+	if err := l.file.Close(); err != nil && unlockErr == nil {
+		unlockErr = err
+	}
+	return unlockErr
+}
+
+// seriesLockPath returns the lock file of the file series written for baseDir/baseFileName
+// One lock covers every file of the series, so a rotation never leaves the series unlocked
+func seriesLockPath(baseDir, baseFileName string) string {
+	return filepath.Join(baseDir, baseFileName+".lock")
+}
@@ -0,0 +1,86 @@
+package asyncloguploader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileLock(t *testing.T) {
+	t.Run("second manager on a directory fails until the first closes", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		first, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		first.LogWithEvent("payment", "paid")
+
+		_, err = NewLoggerManager(config)
+		require.ErrorIs(t, err, ErrFileLocked)
+		assert.Contains(t, err.Error(), managerLockName)
+		assert.Contains(t, err.Error(), "held by this process")
+
+		require.NoError(t, first.Close())
+		second, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		second.LogWithEvent("payment", "paid again")
+		require.NoError(t, second.Close())
+	})
+
+	t.Run("second logger on a file series fails until the first closes", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		first, err := NewLogger(config)
+		require.NoError(t, err)
+
+		_, err = NewLogger(config)
+		require.ErrorIs(t, err, ErrFileLocked)
+
+		// The refused logger created no file of its own
+		dir := filepath.Dir(config.LogFilePath)
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		logFiles := 0
+		for _, entry := range entries {
+			if filepath.Ext(entry.Name()) == ".log" {
+				logFiles++
+			}
+		}
+		assert.Equal(t, 1, logFiles)
+
+		require.NoError(t, first.Close())
+		second, err := NewLogger(config)
+		require.NoError(t, err)
+		require.NoError(t, second.Close())
+	})
+
+	t.Run("lock is held across rotations", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		defer logger.Close()
+
+		fw := logger.groups[0].fileWriter.(*SizeFileWriter)
+		fw.rotationMu.Lock()
+		require.NoError(t, fw.createNextFile())
+		require.NoError(t, fw.swapFiles())
+		fw.rotationMu.Unlock()
+
+		_, err = NewLogger(config)
+		assert.ErrorIs(t, err, ErrFileLocked)
+	})
+
+	t.Run("DisableFileLock skips locking", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.DisableFileLock = true
+		first, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer first.Close()
+		second, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer second.Close()
+
+		_, err = os.Stat(filepath.Join(filepath.Dir(config.LogFilePath), managerLockName))
+		assert.True(t, os.IsNotExist(err))
+	})
+}
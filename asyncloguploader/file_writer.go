@@ -1,9 +1,25 @@
 package asyncloguploader
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
+const (
+	// alignmentSize is the default alignment for O_DIRECT on Linux (Config.IOAlignment): the ext4
+	// block size. The fallback writer sizes preallocation with the same alignment
+	alignmentSize = 4096
+
+	// prepareNextFileAt is the fraction of MaxFileSize after which the next file is opened and
+	// preallocated in the background, so the rotation itself is only a swap
+	prepareNextFileAt = 0.8
+)
+
 // FileWriter defines the interface for file writing operations
 type FileWriter interface {
 	// WriteVectored writes multiple buffers to the file using vectored I/O
@@ -16,3 +32,252 @@ type FileWriter interface {
 	// Close closes the file writer and releases resources
 	Close() error
 }
+
+// SizeFileWriter has two implementations selected by build tags: file_writer_linux.go (O_DIRECT with
+// pwritev or io_uring) and file_writer_default.go (portable fallback for macOS and Windows)
+var _ FileWriter = (*SizeFileWriter)(nil)
+
+// FileReadyReason tells why a file was completed
+type FileReadyReason string
+
+const (
+	// FileRotated is a file completed by rotation (MaxFileSize); the logger continues in a new file
+	FileRotated FileReadyReason = "rotated"
+
+	// FileClosed is a logger's last file, completed by Close
+	FileClosed FileReadyReason = "closed"
+)
+
+// FileReadyEvent describes a completed file, as sent on Config.FileEventChannel
+// With Compression, Path and SizeBytes refer to the compressed file
+type FileReadyEvent struct {
+	Path      string
+	Event     string    // Config.EventName of the logger (set by LoggerManager); empty if unset
+	RotatedAt time.Time // When the file was completed
+	SizeBytes int64
+	Reason    FileReadyReason
+}
+
+// PreallocMethod tells how a file's PreallocateFileSize was reserved
+type PreallocMethod string
+
+const (
+	// PreallocFallocate reserves real extents with fallocate (Linux), so writes allocate no blocks
+	PreallocFallocate PreallocMethod = "fallocate"
+
+	// PreallocTruncate extends the file with truncate, leaving it sparse; used where fallocate is
+	// unsupported (tmpfs, some network filesystems) and on non-Linux platforms
+	PreallocTruncate PreallocMethod = "truncate"
+
+	// PreallocNone is a file without preallocation (PreallocateFileSize 0, low free space, or
+	// preallocation failed)
+	PreallocNone PreallocMethod = "none"
+)
+
+// ioBackendWriter is implemented by file writers that support the experimental io_uring backend
+type ioBackendWriter interface {
+	// activeIOBackend returns the backend actually in use (after any fallback)
+	activeIOBackend() IOBackend
+
+	// registerBuffers registers long-lived buffers (the shard double buffers) with the backend
+	registerBuffers(buffers [][]byte) error
+
+	// GetLastSubmitDuration returns the time spent submitting the last write
+	GetLastSubmitDuration() time.Duration
+
+	// GetLastCompletionDuration returns the time spent waiting for the last write to complete
+	GetLastCompletionDuration() time.Duration
+}
+
+// alignUp rounds n up to the next multiple of align (power of 2)
+func alignUp(n, align int64) int64 {
+	return (n + align - 1) &^ (align - 1)
+}
+
+// extractBasePathSize extracts directory and base filename from a full file path
+func extractBasePathSize(fullPath string) (dir, baseName string, err error) {
+	dir = filepath.Dir(fullPath)
+	if dir == "." || dir == "" {
+		dir = "."
+	}
+
+	baseName = filepath.Base(fullPath)
+	// Remove .log extension if present
+	baseName = strings.TrimSuffix(baseName, ".log")
+
+	if baseName == "" {
+		return "", "", fmt.Errorf("invalid file path: base name is empty after extraction")
+	}
+
+	return dir, baseName, nil
+}
+
+// completeFile records a closed file of size bytes (next is the file writing continues in, if
+// any), then hands it to the compression stage, if any, or publishes it directly
+func (fw *SizeFileWriter) completeFile(path, next string, size int64, reason FileReadyReason) {
+	fw.trackClosed(path)
+	now := fw.clock.Now()
+	fw.recordRotation(RotationInfo{Event: fw.eventName, OldPath: path, NewPath: next, Bytes: size, Reason: reason, RotatedAt: now})
+	file := FileReadyEvent{Path: path, Event: fw.eventName, RotatedAt: now, SizeBytes: size, Reason: reason}
+	if fw.compression != nil {
+		fw.compression.submit(file)
+		return
+	}
+	queueUpload(fw.completedFileChan, fw.fileEventChan, fw.uploadTracker, fw.logger, file)
+	if hook := fw.rotationHook.Load(); hook != nil {
+		(*hook)()
+	}
+}
+
+// queueUpload sends a finished file to the file event channel, or its path to the upload channel
+// (non-blocking), marking it pending in the upload tracker along with its event. No-op without
+// either channel
+func queueUpload(ch chan<- string, events chan<- FileReadyEvent, tracker *UploadTracker, logger InternalLogger, file FileReadyEvent) {
+	if ch == nil && events == nil {
+		return
+	}
+	// Mark before sending so the upload cannot complete first
+	if tracker != nil {
+		tracker.queuedEvent(file.Path, file.Event)
+	}
+
+	sent := false
+	if events != nil {
+		select {
+		case events <- file:
+			sent = true
+		default:
+		}
+	} else {
+		select {
+		case ch <- file.Path:
+			sent = true
+		default:
+		}
+	}
+	if !sent {
+		// Channel full - log warning but don't block rotation or close
+		if tracker != nil {
+			tracker.done(file.Path)
+		}
+		logger.Printf("[WARNING] Upload channel full, skipping upload for %s", file.Path)
+	}
+}
+
+// trackOpen registers a file this writer writes (or preallocated for rotation) with the upload
+// tracker, so recovery scans (Uploader.ScanAndEnqueue) skip it
+func (fw *SizeFileWriter) trackOpen(path string) {
+	if fw.uploadTracker != nil {
+		fw.uploadTracker.opened(path)
+	}
+}
+
+// trackClosed clears a file registered with trackOpen
+func (fw *SizeFileWriter) trackClosed(path string) {
+	if fw.uploadTracker != nil {
+		fw.uploadTracker.closed(path)
+	}
+}
+
+// setCompression routes closed files through stage (called before the flush workers start)
+func (fw *SizeFileWriter) setCompression(stage *compressionStage) {
+	fw.compression = stage
+}
+
+// setRotationHistory records completed files in h (called before the flush workers start)
+func (fw *SizeFileWriter) setRotationHistory(h *rotationHistory) {
+	fw.rotations = h
+}
+
+// setRotationHook registers fn to run after each rotation (on the flush worker, so it must not block)
+func (fw *SizeFileWriter) setRotationHook(fn func()) {
+	fw.rotationHook.Store(&fn)
+}
+
+// PreallocMethod returns how the current file was preallocated
+func (fw *SizeFileWriter) PreallocMethod() PreallocMethod {
+	method, _ := fw.preallocMethod.Load().(PreallocMethod)
+	return method
+}
+
+// currentFile returns the file being written, the bytes written to it (including its file header)
+// and when the last rotation completed (zero if the writer has not rotated)
+func (fw *SizeFileWriter) currentFile() (path string, size int64, lastRotation time.Time) {
+	fw.rotationMu.Lock()
+	path = fw.filePath
+	fw.rotationMu.Unlock()
+
+	if ns := fw.lastRotation.Load(); ns != 0 {
+		lastRotation = time.Unix(0, ns)
+	}
+	return path, fw.fileOffset.Load(), lastRotation
+}
+
+// fileMoved reports whether the current file's path no longer names it, e.g. after an external
+// tool renamed or removed it (rotationMu must be held)
+func (fw *SizeFileWriter) fileMoved() (bool, error) {
+	current, err := fw.file.Stat()
+	if err != nil {
+		return false, fmt.Errorf("failed to stat current file: %w", err)
+	}
+	onDisk, err := os.Stat(fw.filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to stat %s: %w", fw.filePath, err)
+	}
+	return !os.SameFile(current, onDisk), nil
+}
+
+// warnPreallocTruncate logs once per writer that fallocate is unsupported for path's filesystem
+func (fw *SizeFileWriter) warnPreallocTruncate(path string) {
+	if fw.preallocTruncateWarned.CompareAndSwap(false, true) {
+		fw.logger.Printf("[WARNING] fallocate is not supported for %s, preallocating with truncate (sparse file)", path)
+	}
+}
+
+// openFiles returns the paths of the current and preallocated next file
+func (fw *SizeFileWriter) openFiles() map[string]struct{} {
+	fw.rotationMu.Lock()
+	defer fw.rotationMu.Unlock()
+
+	open := map[string]struct{}{fw.filePath: {}}
+	if fw.nextFilePath != "" {
+		open[fw.nextFilePath] = struct{}{}
+	}
+	return open
+}
+
+// rotatedNames hands out the file names of one writer's series (only used under rotationMu)
+// Names are {baseFileName}_{YYYY-MM-DD_HH-MM-SS-mmm}_{seq}.log. seq counts the files created
+// within the same millisecond, so small MaxFileSize values can rotate several times per
+// millisecond without reusing a name, even one whose file was already uploaded and deleted
+type rotatedNames struct {
+	timestamp string // Timestamp of the last name handed out
+	seq       int    // Sequence number of the last name handed out
+}
+
+// rotatedTimestamp formats t as the timestamp of a rotated file name (YYYY-MM-DD_HH-MM-SS-mmm)
+func rotatedTimestamp(t time.Time) string {
+	return fmt.Sprintf("%s-%03d", t.Format("2006-01-02_15-04-05"), t.Nanosecond()/int(time.Millisecond))
+}
+
+// next returns the path of the series' next file in dir, created at now
+// The sequence number is also bumped past names already taken on disk (e.g. by another process
+// writing the same series), so an existing file is never truncated
+func (n *rotatedNames) next(dir, baseFileName string, now time.Time) string {
+	timestamp := rotatedTimestamp(now)
+	if timestamp == n.timestamp {
+		n.seq++
+	} else {
+		n.timestamp, n.seq = timestamp, 0
+	}
+	for {
+		path := filepath.Join(dir, fmt.Sprintf("%s_%s_%d.log", baseFileName, timestamp, n.seq))
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+		n.seq++
+	}
+}
@@ -6,20 +6,23 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asyncloguploader/clock"
 )
 
 // SizeFileWriter manages file handles, offset tracking, and size-based rotation for non-Linux systems
+// Portable counterpart of the Linux writer: same file naming, rotation, preallocation and metrics,
+// using buffered I/O with one pwrite per flush instead of O_DIRECT pwritev
 type SizeFileWriter struct {
 	// Current file
 	file        *os.File
 	fd          int
 	filePath    string
 	fileOffset  atomic.Int64
-	maxFileSize int64
+	maxFileSize atomic.Int64
 
 	// Next file (for rotation)
 	nextFile     *os.File
@@ -31,14 +34,68 @@ type SizeFileWriter struct {
 	baseFileName        string
 	preallocateFileSize int64
 
+	// Written at the start of each file (nil = Config.WriteFileHeader off)
+	fileHeader *FileHeader
+
+	// Unique names for the series' files
+	names rotatedNames
+
+	// Config.Clock: names, header creation times and rotation times of the series' files
+	clock clock.Clock
+
+	// Lock on the series' lock file, held until Close (nil with Config.DisableFileLock)
+	lock *fileLock
+
+	// Held by WriteVectored, Reopen and Close, so a reopen never closes the file under a write
+	writeMu sync.Mutex
+
 	// Mutex for rotation operations
 	rotationMu sync.Mutex
 
+	// Background preparation of the next file (guarded by rotationMu)
+	preparing  chan struct{} // Closed when the preparation in progress ends (nil = none running)
+	prepareErr error         // Failure of the last preparation, returned by the next write
+
+	// Opens and preallocates a new file (openDirectIOSize; overridable in tests)
+	openFile func(path string, preallocateSize int64) (*os.File, PreallocMethod, error)
+
+	// How the files were preallocated
+	preallocMethod         atomic.Value   // PreallocMethod of the current file
+	nextPreallocMethod     PreallocMethod // PreallocMethod of the next file (guarded by rotationMu)
+	preallocTruncateWarned atomic.Bool    // Truncate fallback already logged
+
+	// When the last rotation completed (UnixNano; 0 = never rotated)
+	lastRotation atomic.Int64
+
 	// Last write duration (for metrics tracking)
 	lastPwritevDuration atomic.Int64 // Nanoseconds
 
 	// Channel for completed files (for GCS upload)
 	completedFileChan chan<- string
+
+	// Marks files sent to completedFileChan as pending upload (nil = untracked)
+	uploadTracker *UploadTracker
+	eventName     string // Recorded with each queued file (Config.EventName)
+
+	// Receives completed files with their metadata (Config.FileEventChannel); replaces completedFileChan
+	fileEventChan chan<- FileReadyEvent
+
+	// Completed files (Config.RotationCallback; the history is shared by a logger's writers)
+	onRotate  func(RotationInfo)
+	rotations *rotationHistory
+
+	// Called after each rotation, e.g. to wake the retention janitor (nil = none)
+	rotationHook atomic.Pointer[func()]
+
+	// Compresses closed files before they are published (nil = publish raw files)
+	compression *compressionStage
+
+	// Receives fallback and skipped-upload warnings
+	logger InternalLogger
+
+	// Free-space escalation overrides (set by the free-space monitor)
+	preallocDisabled    atomic.Bool
+	maxFileSizeOverride atomic.Int64 // 0 = use maxFileSize
 }
 
 // NewSizeFileWriter creates a new SizeFileWriter (non-Linux fallback)
@@ -49,39 +106,80 @@ func NewSizeFileWriter(config Config, completedFileChan chan<- string) (*SizeFil
 		return nil, fmt.Errorf("failed to extract base path: %w", err)
 	}
 
-	// Generate timestamped filename for initial file
-	timestamp := time.Now().Format("2006-01-02_15-04-05")
-	initialPath := filepath.Join(baseDir, fmt.Sprintf("%s_%s.log", baseFileName, timestamp))
+	// Generate timestamped filename for initial file (consistent naming)
+	clk := clock.OrReal(config.Clock)
+	var names rotatedNames
+	initialPath := names.next(baseDir, baseFileName, clk.Now())
+
+	// io_uring is Linux-only
+	logger := internalLoggerOrDefault(config.InternalLogger)
+	if config.IOBackend == IOBackendIOUring {
+		logger.Printf("[WARNING] io_uring backend is only available on Linux, falling back to pwritev for %s", config.LogFilePath)
+	}
+
+	// Lock the series before creating its first file, so a second writer fails before truncating anything
+	var lock *fileLock
+	if !config.DisableFileLock {
+		if lock, err = acquireFileLock(seriesLockPath(baseDir, baseFileName)); err != nil {
+			return nil, err
+		}
+	}
 
 	// Open initial file (always starts at offset 0 for new files)
-	file, err := openDirectIOSize(initialPath, config.PreallocateFileSize)
+	alignment := int64(config.ioAlignment())
+	file, preallocMethod, err := openDirectIOSize(initialPath, config.PreallocateFileSize, alignment)
 	if err != nil {
+		lock.release()
 		return nil, fmt.Errorf("failed to open initial file: %w", err)
 	}
+	fileHeader := newFileHeader(config)
+	if err := writeFileHeader(file, fileHeader, clk.Now()); err != nil {
+		file.Close()
+		lock.release()
+		return nil, err
+	}
 
 	fw := &SizeFileWriter{
 		file:                file,
 		fd:                  0, // Not used on non-Linux
 		filePath:            initialPath,
-		maxFileSize:         config.MaxFileSize,
 		baseDir:             baseDir,
 		baseFileName:        baseFileName,
 		preallocateFileSize: config.PreallocateFileSize,
 		completedFileChan:   completedFileChan,
+		uploadTracker:       config.UploadTracker,
+		eventName:           config.EventName,
+		fileEventChan:       config.FileEventChannel,
+		onRotate:            config.RotationCallback,
+		logger:              logger,
+		fileHeader:          fileHeader,
+		names:               names,
+		clock:               clk,
+		lock:                lock,
+		openFile: func(path string, preallocateSize int64) (*os.File, PreallocMethod, error) {
+			return openDirectIOSize(path, preallocateSize, alignment)
+		},
 	}
+	fw.maxFileSize.Store(config.MaxFileSize)
+	fw.preallocMethod.Store(preallocMethod)
 
-	// New files always start at offset 0
-	fw.fileOffset.Store(0)
+	// Shards start after the file header
+	fw.fileOffset.Store(fileHeader.dataStart())
+	fw.trackOpen(initialPath)
 
 	return fw, nil
 }
 
 // WriteVectored writes multiple buffers to the file (non-Linux fallback)
+// Handles rotation automatically before writing
 func (fw *SizeFileWriter) WriteVectored(buffers [][]byte) (int, error) {
 	if len(buffers) == 0 {
 		return 0, nil
 	}
 
+	fw.writeMu.Lock()
+	defer fw.writeMu.Unlock()
+
 	// Check and perform rotation if needed
 	if err := fw.rotateIfNeeded(); err != nil {
 		return 0, fmt.Errorf("rotation failed: %w", err)
@@ -90,26 +188,45 @@ func (fw *SizeFileWriter) WriteVectored(buffers [][]byte) (int, error) {
 	// Get current offset
 	offset := fw.fileOffset.Load()
 
-	// Write sequentially (non-Linux fallback)
-	writeStart := time.Now()
-	totalWritten := 0
-	for _, buf := range buffers {
-		if len(buf) == 0 {
-			continue
-		}
-		n, err := fw.file.WriteAt(buf, offset+int64(totalWritten))
-		if err != nil {
-			fw.lastPwritevDuration.Store(time.Since(writeStart).Nanoseconds())
-			return totalWritten, err
-		}
-		totalWritten += n
+	// Track only the write syscall time, as the Linux writer does for pwritev
+	pwritevStart := time.Now()
+	n, err := writevAlignedWithOffset(fw.file, buffers, offset)
+	pwritevDuration := time.Since(pwritevStart)
+
+	// Store write duration for metrics (even on error, to track syscall time)
+	fw.lastPwritevDuration.Store(pwritevDuration.Nanoseconds())
+
+	if err != nil {
+		return n, err
+	}
+
+	// Update offset atomically after successful write
+	fw.fileOffset.Add(int64(n))
+
+	return n, nil
+}
+
+// effectiveMaxFileSize returns the rotation threshold, honoring any free-space override
+func (fw *SizeFileWriter) effectiveMaxFileSize() int64 {
+	if override := fw.maxFileSizeOverride.Load(); override > 0 {
+		return override
 	}
-	writeDuration := time.Since(writeStart)
+	return fw.maxFileSize.Load()
+}
 
-	fw.lastPwritevDuration.Store(writeDuration.Nanoseconds())
-	fw.fileOffset.Add(int64(totalWritten))
+// setPreallocationEnabled toggles preallocation of files created by subsequent rotations
+func (fw *SizeFileWriter) setPreallocationEnabled(enabled bool) {
+	fw.preallocDisabled.Store(!enabled)
+}
 
-	return totalWritten, nil
+// setMaxFileSize changes the rotation threshold from the next write on (0 disables rotation)
+func (fw *SizeFileWriter) setMaxFileSize(size int64) {
+	fw.maxFileSize.Store(size)
+}
+
+// setMaxFileSizeOverride overrides MaxFileSize for subsequent rotations (0 restores the configured value)
+func (fw *SizeFileWriter) setMaxFileSizeOverride(size int64) {
+	fw.maxFileSizeOverride.Store(size)
 }
 
 // GetLastPwritevDuration returns the duration of the last write
@@ -119,8 +236,16 @@ func (fw *SizeFileWriter) GetLastPwritevDuration() time.Duration {
 
 // Close syncs and closes the current file
 func (fw *SizeFileWriter) Close() error {
+	fw.writeMu.Lock()
+	defer fw.writeMu.Unlock()
+
 	var firstErr error
 
+	// Let a preparation in progress finish, so its file is cleaned up below
+	fw.rotationMu.Lock()
+	fw.waitPrepared()
+	fw.rotationMu.Unlock()
+
 	// If nextFile exists, it means rotation was in progress
 	// We need to complete the rotation: swap files, then close both
 	if fw.nextFile != nil && fw.file != nil {
@@ -135,13 +260,16 @@ func (fw *SizeFileWriter) Close() error {
 	// Now close the current file (which might be the swapped file or original current file)
 	if fw.file != nil {
 		// Check if file has data (offset > 0 means data was written)
-		hasData := fw.fileOffset.Load() > 0
+		hasData := fw.fileOffset.Load() > fw.fileHeader.dataStart()
 
 		// Store file path before closing (for upload)
 		completedFilePath := fw.filePath
 
-		// Get actual written size
+		// Get actual written size (a file without shards is emptied, header included)
 		actualSize := fw.fileOffset.Load()
+		if !hasData {
+			actualSize = 0
+		}
 
 		// Sync file to ensure all data is written before closing
 		if hasData {
@@ -150,12 +278,11 @@ func (fw *SizeFileWriter) Close() error {
 			}
 		}
 
-		// Truncate file to actual written size (removes preallocated space)
-		// This is fast for sparse files (metadata-only operation)
-		if hasData && actualSize > 0 {
-			if err := fw.file.Truncate(actualSize); err != nil && firstErr == nil {
-				firstErr = fmt.Errorf("failed to truncate file to actual size: %w", err)
-			}
+		// Truncate file to actual written size (removes preallocated space), also when nothing was
+		// written, e.g. to the next file of a rotation completed above. Every write is whole
+		// shard buffers, so the file ends on the last shard written
+		if err := fw.file.Truncate(actualSize); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to truncate file to actual size: %w", err)
 		}
 
 		// Close current file
@@ -164,45 +291,109 @@ func (fw *SizeFileWriter) Close() error {
 		}
 
 		// Send completed file to upload channel (non-blocking) if it has data
-		if hasData && fw.completedFileChan != nil {
-			select {
-			case fw.completedFileChan <- completedFilePath:
-				// Successfully sent to channel
-			default:
-				// Channel full - log warning but don't block close
-				fmt.Printf("[WARNING] Upload channel full, skipping upload for %s\n", completedFilePath)
-			}
+		if hasData {
+			fw.completeFile(completedFilePath, "", actualSize, FileClosed)
+		} else {
+			fw.trackClosed(completedFilePath)
 		}
 
 		fw.file = nil
 	}
 
 	// Clean up nextFile if it still exists (shouldn't happen after swap, but be safe)
+	// It holds no data: drop its preallocated space
 	if fw.nextFile != nil {
+		if err := fw.nextFile.Truncate(0); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to truncate unused next file: %w", err)
+		}
 		if err := fw.nextFile.Close(); err != nil {
 			if firstErr == nil {
 				firstErr = err
 			}
 		}
+		fw.trackClosed(fw.nextFilePath)
 		fw.nextFile = nil
 		fw.nextFilePath = ""
 	}
 
+	// Released last: the series is unlocked only once its files are closed
+	if err := fw.lock.release(); err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("failed to release file lock: %w", err)
+	}
+	fw.lock = nil
+
+	return firstErr
+}
+
+// Reopen re-creates the current file at its path after an external tool (e.g. logrotate) renamed
+// or removed it, and continues writing there. A write in progress finishes first. The renamed file
+// is synced, truncated to its data and closed, and left to that tool: it is not compressed,
+// uploaded or passed to RotationCallback. Reopen does nothing while the path still names the
+// current file
+func (fw *SizeFileWriter) Reopen() error {
+	fw.writeMu.Lock()
+	defer fw.writeMu.Unlock()
+	fw.rotationMu.Lock()
+	defer fw.rotationMu.Unlock()
+
+	if fw.file == nil {
+		return fmt.Errorf("file writer is closed")
+	}
+	moved, err := fw.fileMoved()
+	if err != nil || !moved {
+		return err
+	}
+
+	// Preallocated like a rotation's next file, with the same fallback
+	file, preallocMethod, err := fw.openNextFile(fw.filePath, fw.nextPreallocateSize())
+	if err != nil {
+		return fmt.Errorf("failed to reopen %s: %w", fw.filePath, err)
+	}
+
+	// Finish the renamed file as Close would, without publishing it
+	var firstErr error
+	size := fw.fileOffset.Load()
+	if err := fw.file.Sync(); err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("failed to sync renamed file: %w", err)
+	}
+	if err := fw.file.Truncate(size); err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("failed to truncate renamed file to actual size: %w", err)
+	}
+	if err := fw.file.Close(); err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("failed to close renamed file: %w", err)
+	}
+
+	fw.file = file
+	fw.preallocMethod.Store(preallocMethod)
+	fw.lastRotation.Store(fw.clock.Now().UnixNano())
+	fw.fileOffset.Store(fw.fileHeader.dataStart()) // Shards of the new file start after its header
 	return firstErr
 }
 
 // rotateIfNeeded checks if rotation is needed
 func (fw *SizeFileWriter) rotateIfNeeded() error {
-	if fw.maxFileSize <= 0 {
+	maxFileSize := fw.effectiveMaxFileSize()
+	if maxFileSize <= 0 {
 		return nil
 	}
 
 	fw.rotationMu.Lock()
 	defer fw.rotationMu.Unlock()
 
+	if err := fw.prepareErr; err != nil {
+		fw.prepareErr = nil
+		return fmt.Errorf("failed to prepare next file: %w", err)
+	}
+
 	currentOffset := fw.fileOffset.Load()
 
-	if currentOffset >= fw.maxFileSize {
+	if currentOffset >= maxFileSize {
+		fw.waitPrepared()
+		if err := fw.prepareErr; err != nil {
+			fw.prepareErr = nil
+			return fmt.Errorf("failed to prepare next file: %w", err)
+		}
+
 		if fw.nextFile == nil {
 			if err := fw.createNextFile(); err != nil {
 				return fmt.Errorf("failed to create next file: %w", err)
@@ -215,32 +406,100 @@ func (fw *SizeFileWriter) rotateIfNeeded() error {
 		return nil
 	}
 
-	if currentOffset >= int64(float64(fw.maxFileSize)*0.9) {
-		if fw.nextFile == nil {
-			if err := fw.createNextFile(); err != nil {
-				return nil // Non-blocking
-			}
-		}
+	if currentOffset >= int64(float64(maxFileSize)*prepareNextFileAt) && fw.nextFile == nil && fw.preparing == nil {
+		fw.prepareNextFile()
 	}
 
 	return nil
 }
 
+// prepareNextFile starts creating the next file in the background (rotationMu must be held)
+func (fw *SizeFileWriter) prepareNextFile() {
+	nextPath := fw.names.next(fw.baseDir, fw.baseFileName, fw.clock.Now())
+	preallocateSize := fw.nextPreallocateSize()
+	done := make(chan struct{})
+	fw.preparing = done
+
+	go func() {
+		file, preallocMethod, err := fw.openNextFile(nextPath, preallocateSize)
+
+		fw.rotationMu.Lock()
+		defer fw.rotationMu.Unlock()
+		if err != nil {
+			fw.prepareErr = err
+		} else {
+			fw.setNextFile(file, nextPath, preallocMethod)
+		}
+		fw.preparing = nil
+		close(done)
+	}()
+}
+
+// waitPrepared waits for a preparation in progress to end (rotationMu must be held; it is released
+// while waiting)
+func (fw *SizeFileWriter) waitPrepared() {
+	for fw.preparing != nil {
+		done := fw.preparing
+		fw.rotationMu.Unlock()
+		<-done
+		fw.rotationMu.Lock()
+	}
+}
+
+// nextPreallocateSize returns the preallocation for the next file (none while free space is low)
+func (fw *SizeFileWriter) nextPreallocateSize() int64 {
+	if fw.preallocDisabled.Load() {
+		return 0
+	}
+	return fw.preallocateFileSize
+}
+
 // createNextFile creates a new file for rotation
 func (fw *SizeFileWriter) createNextFile() error {
-	timestamp := time.Now().Format("2006-01-02_15-04-05")
-	nextPath := filepath.Join(fw.baseDir, fmt.Sprintf("%s_%s.log", fw.baseFileName, timestamp))
+	// Generate timestamped filename: {baseFileName}_{YYYY-MM-DD_HH-MM-SS-mmm}_{seq}.log
+	nextPath := fw.names.next(fw.baseDir, fw.baseFileName, fw.clock.Now())
 
-	file, err := openDirectIOSize(nextPath, fw.preallocateFileSize)
+	file, preallocMethod, err := fw.openNextFile(nextPath, fw.nextPreallocateSize())
 	if err != nil {
-		return fmt.Errorf("failed to open next file: %w", err)
+		return err
 	}
+	fw.setNextFile(file, nextPath, preallocMethod)
+	return nil
+}
 
+// openNextFile opens and preallocates a file for rotation and writes its header
+func (fw *SizeFileWriter) openNextFile(nextPath string, preallocateSize int64) (*os.File, PreallocMethod, error) {
+	// Try to open new file with preallocation
+	file, preallocMethod, err := fw.openFile(nextPath, preallocateSize)
+	if err != nil && preallocateSize > 0 {
+		// If preallocation fails, try creating file without preallocation as fallback
+		file, preallocMethod, err = fw.openFile(nextPath, 0)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to open next file (with and without preallocation): %w", err)
+		}
+		fw.logger.Printf("[WARNING] Failed to preallocate %d bytes for %s, continuing without preallocation",
+			preallocateSize, nextPath)
+	} else if err != nil {
+		return nil, "", fmt.Errorf("failed to open next file: %w", err)
+	}
+	if preallocMethod == PreallocTruncate {
+		fw.warnPreallocTruncate(nextPath)
+	}
+	if err := writeFileHeader(file, fw.fileHeader, fw.clock.Now()); err != nil {
+		file.Close()
+		os.Remove(nextPath)
+		return nil, "", err
+	}
+	return file, preallocMethod, nil
+}
+
+// setNextFile stores file as the next file of the rotation
+func (fw *SizeFileWriter) setNextFile(file *os.File, nextPath string, preallocMethod PreallocMethod) {
 	fw.nextFile = file
+	fw.nextPreallocMethod = preallocMethod
 	fw.nextFd = 0
 	fw.nextFilePath = nextPath
-
-	return nil
+	fw.trackOpen(nextPath)
 }
 
 // swapFiles atomically swaps from current file to next file
@@ -263,10 +522,8 @@ func (fw *SizeFileWriter) swapFiles() error {
 
 	// Truncate file to actual written size (removes preallocated space)
 	// This is fast for sparse files (metadata-only operation)
-	if actualSize > 0 {
-		if err := fw.file.Truncate(actualSize); err != nil {
-			return fmt.Errorf("failed to truncate file to actual size: %w", err)
-		}
+	if err := fw.file.Truncate(actualSize); err != nil {
+		return fmt.Errorf("failed to truncate file to actual size: %w", err)
 	}
 
 	completedFilePath := fw.filePath
@@ -276,20 +533,16 @@ func (fw *SizeFileWriter) swapFiles() error {
 		return fmt.Errorf("failed to close current file: %w", err)
 	}
 
-	// Send completed file to upload channel (non-blocking)
-	if fw.completedFileChan != nil {
-		select {
-		case fw.completedFileChan <- completedFilePath:
-		default:
-			fmt.Printf("[WARNING] Upload channel full, skipping upload for %s\n", completedFilePath)
-		}
-	}
+	// Send completed file to upload channel (non-blocking) and wake retention
+	fw.completeFile(completedFilePath, fw.nextFilePath, actualSize, FileRotated)
 
 	// Swap next file to current
 	fw.file = fw.nextFile
 	fw.fd = fw.nextFd
 	fw.filePath = fw.nextFilePath
-	fw.fileOffset.Store(0)
+	fw.preallocMethod.Store(fw.nextPreallocMethod)
+	fw.lastRotation.Store(fw.clock.Now().UnixNano())
+	fw.fileOffset.Store(fw.fileHeader.dataStart())
 
 	// Clear next file fields
 	fw.nextFile = nil
@@ -299,36 +552,78 @@ func (fw *SizeFileWriter) swapFiles() error {
 	return nil
 }
 
-// openDirectIOSize opens a file (non-Linux fallback)
-// Returns the file and error. New files always start at offset 0.
-func openDirectIOSize(path string, preallocateSize int64) (*os.File, error) {
+// writeFileHeader writes h, stamped with created, at the start of a new file; a nil h writes nothing
+func writeFileHeader(file *os.File, h *FileHeader, created time.Time) error {
+	if h == nil {
+		return nil
+	}
+	buf := make([]byte, h.Size)
+	h.encode(buf, created)
+	if _, err := file.WriteAt(buf, 0); err != nil {
+		return fmt.Errorf("failed to write file header: %w", err)
+	}
+	return nil
+}
+
+// openDirectIOSize opens a file (non-Linux fallback), preallocating with Truncate to a multiple of
+// alignment (Config.IOAlignment)
+// Truncate extends the file with zeros (sparse where the filesystem supports it), so the file
+// layout matches the Linux fallocate path. Returns the file, the preallocation method used and
+// error. New files always start at offset 0.
+func openDirectIOSize(path string, preallocateSize, alignment int64) (*os.File, PreallocMethod, error) {
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create directory: %w", err)
+		return nil, "", fmt.Errorf("failed to create directory: %w", err)
 	}
 
 	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %w", err)
+		return nil, "", fmt.Errorf("failed to open file: %w", err)
+	}
+
+	// Preallocate to the same block-aligned size as fallocate on Linux
+	if preallocateSize <= 0 {
+		return file, PreallocNone, nil
+	}
+	if err := file.Truncate(alignUp(preallocateSize, alignment)); err != nil {
+		file.Close()
+		return nil, "", fmt.Errorf("failed to preallocate file with truncate: %w", err)
 	}
 
 	// New files with O_TRUNC always start at offset 0
-	return file, nil
+	return file, PreallocTruncate, nil
 }
 
-// extractBasePathSize extracts directory and base filename
-func extractBasePathSize(fullPath string) (dir, baseName string, err error) {
-	dir = filepath.Dir(fullPath)
-	if dir == "." || dir == "" {
-		dir = "."
+// writevAlignedWithOffset writes multiple buffers to file at a specific offset (non-Linux fallback)
+// Emulates pwritev with a single pwrite: one buffer is written in place, several are concatenated first
+func writevAlignedWithOffset(file *os.File, buffers [][]byte, offset int64) (int, error) {
+	totalSize := 0
+	nonEmpty := 0
+	var single []byte
+	for _, buf := range buffers {
+		if len(buf) > 0 {
+			totalSize += len(buf)
+			nonEmpty++
+			single = buf
+		}
+	}
+
+	if totalSize == 0 {
+		return 0, nil
 	}
 
-	baseName = filepath.Base(fullPath)
-	baseName = strings.TrimSuffix(baseName, ".log")
+	data := single
+	if nonEmpty > 1 {
+		data = make([]byte, 0, totalSize)
+		for _, buf := range buffers {
+			data = append(data, buf...)
+		}
+	}
 
-	if baseName == "" {
-		return "", "", fmt.Errorf("invalid file path: base name is empty after extraction")
+	n, err := file.WriteAt(data, offset)
+	if err != nil {
+		return n, fmt.Errorf("vectored I/O write failed: %w", err)
 	}
 
-	return dir, baseName, nil
+	return n, nil
 }
@@ -3,23 +3,19 @@
 package asyncloguploader
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/neehar-mavuduru/logger-double-buffer/asyncloguploader/clock"
 	"golang.org/x/sys/unix"
 )
 
-const (
-	// alignmentSize is the required alignment for O_DIRECT on Linux (ext4 filesystem)
-	// Must be 4096 bytes (4KB), not 512 bytes!
-	alignmentSize = 4096
-)
-
 // SizeFileWriter manages file handles, offset tracking, and size-based rotation for Direct I/O writes
 type SizeFileWriter struct {
 	// Current file
@@ -27,7 +23,7 @@ type SizeFileWriter struct {
 	fd          int
 	filePath    string
 	fileOffset  atomic.Int64
-	maxFileSize int64 // Maximum file size before rotation
+	maxFileSize atomic.Int64 // Maximum file size before rotation (0 = disabled; see setMaxFileSize)
 
 	// Next file (for rotation)
 	nextFile     *os.File
@@ -39,14 +35,78 @@ type SizeFileWriter struct {
 	baseFileName        string
 	preallocateFileSize int64 // Size to preallocate using fallocate
 
+	// Written at the start of each file (nil = Config.WriteFileHeader off)
+	fileHeader *FileHeader
+
+	// Unique names for the series' files
+	names rotatedNames
+
+	// Config.Clock: names, header creation times and rotation times of the series' files
+	clock clock.Clock
+
+	// Lock on the series' lock file, held until Close (nil with Config.DisableFileLock)
+	lock *fileLock
+
+	// Held by WriteVectored, Reopen and Close, so a reopen never closes the file under a write
+	writeMu sync.Mutex
+
 	// Mutex for rotation operations (only held during rotation)
 	rotationMu sync.Mutex
 
+	// Background preparation of the next file (guarded by rotationMu)
+	preparing  chan struct{} // Closed when the preparation in progress ends (nil = none running)
+	prepareErr error         // Failure of the last preparation, returned by the next write
+
+	// Opens and preallocates a new file (openDirectIOSize; overridable in tests)
+	openFile func(path string, preallocateSize int64) (*os.File, PreallocMethod, error)
+
+	// How the files were preallocated
+	preallocMethod         atomic.Value   // PreallocMethod of the current file
+	nextPreallocMethod     PreallocMethod // PreallocMethod of the next file (guarded by rotationMu)
+	preallocTruncateWarned atomic.Bool    // Truncate fallback already logged
+
+	// When the last rotation completed (UnixNano; 0 = never rotated)
+	lastRotation atomic.Int64
+
 	// Last Pwritev duration (for metrics tracking)
 	lastPwritevDuration atomic.Int64 // Nanoseconds
 
 	// Channel for completed files (for GCS upload)
 	completedFileChan chan<- string
+
+	// Marks files sent to completedFileChan as pending upload (nil = untracked)
+	uploadTracker *UploadTracker
+	eventName     string // Recorded with each queued file (Config.EventName)
+
+	// Receives completed files with their metadata (Config.FileEventChannel); replaces completedFileChan
+	fileEventChan chan<- FileReadyEvent
+
+	// Completed files (Config.RotationCallback; the history is shared by a logger's writers)
+	onRotate  func(RotationInfo)
+	rotations *rotationHistory
+
+	// Called after each rotation, e.g. to wake the retention janitor (nil = none)
+	rotationHook atomic.Pointer[func()]
+
+	// Compresses closed files before they are published (nil = publish raw files)
+	compression *compressionStage
+
+	// Receives fallback and skipped-upload warnings
+	logger InternalLogger
+
+	// Free-space escalation overrides (set by the free-space monitor)
+	preallocDisabled    atomic.Bool
+	maxFileSizeOverride atomic.Int64 // 0 = use maxFileSize
+
+	// Experimental io_uring backend (nil = pwritev)
+	ring *ioUring
+
+	// O_DSYNC for pwritev; 0 when durability comes from fdatasync after each write
+	syncFlag int
+
+	// Last io_uring submit/completion durations (for metrics tracking)
+	lastSubmitDuration     atomic.Int64 // Nanoseconds
+	lastCompletionDuration atomic.Int64 // Nanoseconds
 }
 
 // NewSizeFileWriter creates a new SizeFileWriter with the given configuration
@@ -59,28 +119,86 @@ func NewSizeFileWriter(config Config, completedFileChan chan<- string) (*SizeFil
 	}
 
 	// Generate timestamped filename for initial file (consistent naming)
-	timestamp := time.Now().Format("2006-01-02_15-04-05")
-	initialPath := filepath.Join(baseDir, fmt.Sprintf("%s_%s.log", baseFileName, timestamp))
+	clk := clock.OrReal(config.Clock)
+	var names rotatedNames
+	initialPath := names.next(baseDir, baseFileName, clk.Now())
+
+	logger := internalLoggerOrDefault(config.InternalLogger)
+
+	// Lock the series before creating its first file, so a second writer fails before truncating anything
+	var lock *fileLock
+	if !config.DisableFileLock {
+		if lock, err = acquireFileLock(seriesLockPath(baseDir, baseFileName)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Set up the experimental io_uring backend if requested, falling back to pwritev
+	var ring *ioUring
+	syncFlag := unix.O_DSYNC
+	if config.IOBackend == IOBackendIOUring {
+		ring, err = newIOUring(ioUringEntries(config.NumShards))
+		if err != nil {
+			logger.Printf("[WARNING] io_uring backend unavailable for %s, falling back to pwritev: %v", config.LogFilePath, err)
+			ring = nil
+		} else {
+			// Durability comes from the fdatasync queued behind each flush's writes
+			syncFlag = 0
+		}
+	}
 
 	// Open initial file with preallocation (always starts at offset 0 for new files)
-	file, err := openDirectIOSize(initialPath, config.PreallocateFileSize)
+	alignment := int64(config.ioAlignment())
+	file, preallocMethod, err := openDirectIOSize(initialPath, config.PreallocateFileSize, alignment, syncFlag)
 	if err != nil {
+		if ring != nil {
+			ring.close()
+		}
+		lock.release()
 		return nil, fmt.Errorf("failed to open initial file: %w", err)
 	}
+	fileHeader := newFileHeader(config)
+	if err := writeFileHeader(int(file.Fd()), fileHeader, clk.Now()); err != nil {
+		file.Close()
+		if ring != nil {
+			ring.close()
+		}
+		lock.release()
+		return nil, err
+	}
 
 	fw := &SizeFileWriter{
 		file:                file,
 		fd:                  int(file.Fd()),
 		filePath:            initialPath,
-		maxFileSize:         config.MaxFileSize,
 		baseDir:             baseDir,
 		baseFileName:        baseFileName,
 		preallocateFileSize: config.PreallocateFileSize,
 		completedFileChan:   completedFileChan,
+		uploadTracker:       config.UploadTracker,
+		eventName:           config.EventName,
+		fileEventChan:       config.FileEventChannel,
+		onRotate:            config.RotationCallback,
+		logger:              logger,
+		ring:                ring,
+		syncFlag:            syncFlag,
+		fileHeader:          fileHeader,
+		names:               names,
+		clock:               clk,
+		lock:                lock,
+		openFile: func(path string, preallocateSize int64) (*os.File, PreallocMethod, error) {
+			return openDirectIOSize(path, preallocateSize, alignment, syncFlag)
+		},
+	}
+	fw.maxFileSize.Store(config.MaxFileSize)
+	fw.preallocMethod.Store(preallocMethod)
+	if preallocMethod == PreallocTruncate {
+		fw.warnPreallocTruncate(initialPath)
 	}
 
-	// New files always start at offset 0
-	fw.fileOffset.Store(0)
+	// Shards start after the file header
+	fw.fileOffset.Store(fileHeader.dataStart())
+	fw.trackOpen(initialPath)
 
 	return fw, nil
 }
@@ -93,6 +211,9 @@ func (fw *SizeFileWriter) WriteVectored(buffers [][]byte) (int, error) {
 		return 0, nil
 	}
 
+	fw.writeMu.Lock()
+	defer fw.writeMu.Unlock()
+
 	// Check and perform rotation if needed
 	if err := fw.rotateIfNeeded(); err != nil {
 		return 0, fmt.Errorf("rotation failed: %w", err)
@@ -101,9 +222,26 @@ func (fw *SizeFileWriter) WriteVectored(buffers [][]byte) (int, error) {
 	// Get current offset
 	offset := fw.fileOffset.Load()
 
+	if fw.ring != nil {
+		if err := fw.ring.retired(); err != nil {
+			// Ring is in an unknown state: close it and continue on pwritev
+			fw.logger.Printf("[WARNING] io_uring backend failed for %s, falling back to pwritev: %v", fw.filePath, err)
+			fw.ring.close()
+			fw.ring = nil
+		} else {
+			return fw.writeVectoredIOUring(buffers, offset)
+		}
+	}
+
 	// Write using vectored I/O at specific offset
 	pwritevStart := time.Now()
 	n, err := writevAlignedWithOffset(fw.fd, buffers, offset)
+	if err == nil && fw.syncFlag == 0 {
+		// File was opened for io_uring (no O_DSYNC): sync explicitly to keep durability
+		if syncErr := unix.Fdatasync(fw.fd); syncErr != nil {
+			err = fmt.Errorf("fdatasync failed: %w", syncErr)
+		}
+	}
 	pwritevDuration := time.Since(pwritevStart)
 
 	// Store write duration for metrics
@@ -119,6 +257,73 @@ func (fw *SizeFileWriter) WriteVectored(buffers [][]byte) (int, error) {
 	return n, nil
 }
 
+// writeVectoredIOUring writes buffers through the io_uring backend
+// As with pwritev, fileOffset advances only when every buffer was written: a failed write is
+// retried in place by the logger (disk full) or overwritten by the next flush
+func (fw *SizeFileWriter) writeVectoredIOUring(buffers [][]byte, offset int64) (int, error) {
+	result, err := fw.ring.writeAt(fw.fd, buffers, offset, true)
+
+	// Store submit/completion split; the total stands in for the Pwritev duration
+	fw.lastSubmitDuration.Store(result.submitDuration.Nanoseconds())
+	fw.lastCompletionDuration.Store(result.completionDuration.Nanoseconds())
+	fw.lastPwritevDuration.Store((result.submitDuration + result.completionDuration).Nanoseconds())
+
+	if err == nil {
+		fw.fileOffset.Add(int64(result.confirmed))
+	}
+
+	return result.confirmed, err
+}
+
+// activeIOBackend returns the backend currently used for writes
+func (fw *SizeFileWriter) activeIOBackend() IOBackend {
+	if fw.ring != nil {
+		return IOBackendIOUring
+	}
+	return IOBackendPwritev
+}
+
+// registerBuffers registers the shard buffers with the io_uring backend (no-op for pwritev)
+func (fw *SizeFileWriter) registerBuffers(buffers [][]byte) error {
+	if fw.ring == nil {
+		return nil
+	}
+	return fw.ring.registerBuffers(buffers)
+}
+
+// GetLastSubmitDuration returns the time spent submitting the last io_uring write (0 for pwritev)
+func (fw *SizeFileWriter) GetLastSubmitDuration() time.Duration {
+	return time.Duration(fw.lastSubmitDuration.Load())
+}
+
+// GetLastCompletionDuration returns the time spent waiting for the last io_uring write (0 for pwritev)
+func (fw *SizeFileWriter) GetLastCompletionDuration() time.Duration {
+	return time.Duration(fw.lastCompletionDuration.Load())
+}
+
+// effectiveMaxFileSize returns the rotation threshold, honoring any free-space override
+func (fw *SizeFileWriter) effectiveMaxFileSize() int64 {
+	if override := fw.maxFileSizeOverride.Load(); override > 0 {
+		return override
+	}
+	return fw.maxFileSize.Load()
+}
+
+// setPreallocationEnabled toggles preallocation of files created by subsequent rotations
+func (fw *SizeFileWriter) setPreallocationEnabled(enabled bool) {
+	fw.preallocDisabled.Store(!enabled)
+}
+
+// setMaxFileSize changes the rotation threshold from the next write on (0 disables rotation)
+func (fw *SizeFileWriter) setMaxFileSize(size int64) {
+	fw.maxFileSize.Store(size)
+}
+
+// setMaxFileSizeOverride overrides MaxFileSize for subsequent rotations (0 restores the configured value)
+func (fw *SizeFileWriter) setMaxFileSizeOverride(size int64) {
+	fw.maxFileSizeOverride.Store(size)
+}
+
 // GetLastPwritevDuration returns the duration of the last Pwritev syscall
 func (fw *SizeFileWriter) GetLastPwritevDuration() time.Duration {
 	return time.Duration(fw.lastPwritevDuration.Load())
@@ -126,8 +331,16 @@ func (fw *SizeFileWriter) GetLastPwritevDuration() time.Duration {
 
 // Close syncs and closes the current file, and closes next file if it exists
 func (fw *SizeFileWriter) Close() error {
+	fw.writeMu.Lock()
+	defer fw.writeMu.Unlock()
+
 	var firstErr error
 
+	// Let a preparation in progress finish, so its file is cleaned up below
+	fw.rotationMu.Lock()
+	fw.waitPrepared()
+	fw.rotationMu.Unlock()
+
 	// If nextFile exists, it means rotation was in progress
 	// We need to complete the rotation: swap files, then close both
 	if fw.nextFile != nil && fw.file != nil {
@@ -142,13 +355,16 @@ func (fw *SizeFileWriter) Close() error {
 	// Now close the current file (which might be the swapped file or original current file)
 	if fw.file != nil {
 		// Check if file has data (offset > 0 means data was written)
-		hasData := fw.fileOffset.Load() > 0
+		hasData := fw.fileOffset.Load() > fw.fileHeader.dataStart()
 
 		// Store file path before closing (for upload)
 		completedFilePath := fw.filePath
 
-		// Get actual written size
+		// Get actual written size (a file without shards is emptied, header included)
 		actualSize := fw.fileOffset.Load()
+		if !hasData {
+			actualSize = 0
+		}
 
 		// Sync file to ensure all data is written before closing
 		if hasData && fw.fd > 0 {
@@ -157,9 +373,11 @@ func (fw *SizeFileWriter) Close() error {
 			}
 		}
 
-		// Truncate file to actual written size (removes preallocated space)
-		// This is fast for sparse files (metadata-only operation)
-		if hasData && actualSize > 0 && fw.fd > 0 {
+		// Truncate file to actual written size (removes preallocated space), also when nothing was
+		// written, e.g. to the next file of a rotation completed above. O_DIRECT does not restrict
+		// ftruncate, and every write is whole aligned shard buffers, so the file ends on the last
+		// shard written. This is fast for sparse files (metadata-only operation)
+		if fw.fd > 0 {
 			if err := unix.Ftruncate(fw.fd, actualSize); err != nil && firstErr == nil {
 				firstErr = fmt.Errorf("failed to truncate file to actual size: %w", err)
 			}
@@ -171,14 +389,10 @@ func (fw *SizeFileWriter) Close() error {
 		}
 
 		// Send completed file to upload channel (non-blocking) if it has data
-		if hasData && fw.completedFileChan != nil {
-			select {
-			case fw.completedFileChan <- completedFilePath:
-				// Successfully sent to channel
-			default:
-				// Channel full - log warning but don't block close
-				fmt.Printf("[WARNING] Upload channel full, skipping upload for %s\n", completedFilePath)
-			}
+		if hasData {
+			fw.completeFile(completedFilePath, "", actualSize, FileClosed)
+		} else {
+			fw.trackClosed(completedFilePath)
 		}
 
 		fw.file = nil
@@ -186,22 +400,88 @@ func (fw *SizeFileWriter) Close() error {
 	}
 
 	// Clean up nextFile if it still exists (shouldn't happen after swap, but be safe)
+	// It holds no data: drop its preallocated space
 	if fw.nextFile != nil {
+		if err := unix.Ftruncate(fw.nextFd, 0); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to truncate unused next file: %w", err)
+		}
 		if err := fw.nextFile.Close(); err != nil && firstErr == nil {
 			firstErr = err
 		}
+		fw.trackClosed(fw.nextFilePath)
 		fw.nextFile = nil
 		fw.nextFd = 0
 		fw.nextFilePath = ""
 	}
 
+	// Release the io_uring instance
+	if fw.ring != nil {
+		if err := fw.ring.close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to close io_uring: %w", err)
+		}
+		fw.ring = nil
+	}
+
+	// Released last: the series is unlocked only once its files are closed
+	if err := fw.lock.release(); err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("failed to release file lock: %w", err)
+	}
+	fw.lock = nil
+
+	return firstErr
+}
+
+// Reopen re-creates the current file at its path after an external tool (e.g. logrotate) renamed
+// or removed it, and continues writing there. A write in progress finishes first. The renamed file
+// is synced, truncated to its data and closed, and left to that tool: it is not compressed,
+// uploaded or passed to RotationCallback. Reopen does nothing while the path still names the
+// current file
+func (fw *SizeFileWriter) Reopen() error {
+	fw.writeMu.Lock()
+	defer fw.writeMu.Unlock()
+	fw.rotationMu.Lock()
+	defer fw.rotationMu.Unlock()
+
+	if fw.file == nil {
+		return fmt.Errorf("file writer is closed")
+	}
+	moved, err := fw.fileMoved()
+	if err != nil || !moved {
+		return err
+	}
+
+	// Preallocated like a rotation's next file, with the same fallback
+	file, preallocMethod, err := fw.openNextFile(fw.filePath, fw.nextPreallocateSize())
+	if err != nil {
+		return fmt.Errorf("failed to reopen %s: %w", fw.filePath, err)
+	}
+
+	// Finish the renamed file as Close would, without publishing it
+	var firstErr error
+	size := fw.fileOffset.Load()
+	if err := unix.Fsync(fw.fd); err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("failed to sync renamed file: %w", err)
+	}
+	if err := unix.Ftruncate(fw.fd, size); err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("failed to truncate renamed file to actual size: %w", err)
+	}
+	if err := fw.file.Close(); err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("failed to close renamed file: %w", err)
+	}
+
+	fw.file = file
+	fw.fd = int(file.Fd())
+	fw.preallocMethod.Store(preallocMethod)
+	fw.lastRotation.Store(fw.clock.Now().UnixNano())
+	fw.fileOffset.Store(fw.fileHeader.dataStart()) // Shards of the new file start after its header
 	return firstErr
 }
 
 // rotateIfNeeded checks if rotation is needed based on file size and performs it if necessary
 func (fw *SizeFileWriter) rotateIfNeeded() error {
 	// If rotation is disabled (maxFileSize is 0), skip
-	if fw.maxFileSize <= 0 {
+	maxFileSize := fw.effectiveMaxFileSize()
+	if maxFileSize <= 0 {
 		return nil
 	}
 
@@ -209,11 +489,24 @@ func (fw *SizeFileWriter) rotateIfNeeded() error {
 	fw.rotationMu.Lock()
 	defer fw.rotationMu.Unlock()
 
+	// A preparation that failed fails this write, so a full disk is not hidden until the swap
+	if err := fw.prepareErr; err != nil {
+		fw.prepareErr = nil
+		return fmt.Errorf("failed to prepare next file: %w", err)
+	}
+
 	// Get current offset (after acquiring lock to ensure consistency)
 	currentOffset := fw.fileOffset.Load()
 
 	// Check if we've actually exceeded the max file size (need to swap immediately)
-	if currentOffset >= fw.maxFileSize {
+	if currentOffset >= maxFileSize {
+		// A preparation still running (e.g. one write crossed both thresholds) is waited for
+		fw.waitPrepared()
+		if err := fw.prepareErr; err != nil {
+			fw.prepareErr = nil
+			return fmt.Errorf("failed to prepare next file: %w", err)
+		}
+
 		// Ensure next file exists
 		if fw.nextFile == nil {
 			if err := fw.createNextFile(); err != nil {
@@ -228,46 +521,105 @@ func (fw *SizeFileWriter) rotateIfNeeded() error {
 		return nil
 	}
 
-	// Check if we're approaching max file size (proactive rotation at 90%)
-	if currentOffset >= int64(float64(fw.maxFileSize)*0.9) {
-		// If next file doesn't exist, create it proactively
-		if fw.nextFile == nil {
-			if err := fw.createNextFile(); err != nil {
-				// Don't fail the write if proactive creation fails - we'll try again next time
-				// This prevents fallocate blocking from causing write failures
-				return nil
-			}
-		}
+	// Approaching max file size: open and preallocate the next file in the background, so the
+	// rotation itself is only a swap
+	if currentOffset >= int64(float64(maxFileSize)*prepareNextFileAt) && fw.nextFile == nil && fw.preparing == nil {
+		fw.prepareNextFile()
 	}
 
 	return nil
 }
 
+// prepareNextFile starts creating the next file in the background (rotationMu must be held)
+// The file is stored as the next file once ready; a failure is kept in prepareErr
+func (fw *SizeFileWriter) prepareNextFile() {
+	nextPath := fw.names.next(fw.baseDir, fw.baseFileName, fw.clock.Now())
+	preallocateSize := fw.nextPreallocateSize()
+	done := make(chan struct{})
+	fw.preparing = done
+
+	go func() {
+		file, preallocMethod, err := fw.openNextFile(nextPath, preallocateSize)
+
+		fw.rotationMu.Lock()
+		defer fw.rotationMu.Unlock()
+		if err != nil {
+			fw.prepareErr = err
+		} else {
+			fw.setNextFile(file, nextPath, preallocMethod)
+		}
+		fw.preparing = nil
+		close(done)
+	}()
+}
+
+// waitPrepared waits for a preparation in progress to end (rotationMu must be held; it is released
+// while waiting)
+func (fw *SizeFileWriter) waitPrepared() {
+	for fw.preparing != nil {
+		done := fw.preparing
+		fw.rotationMu.Unlock()
+		<-done
+		fw.rotationMu.Lock()
+	}
+}
+
+// nextPreallocateSize returns the preallocation for the next file (none while free space is low)
+func (fw *SizeFileWriter) nextPreallocateSize() int64 {
+	if fw.preallocDisabled.Load() {
+		return 0
+	}
+	return fw.preallocateFileSize
+}
+
 // createNextFile creates a new file for rotation with preallocation
 func (fw *SizeFileWriter) createNextFile() error {
-	// Generate timestamped filename: {baseFileName}_{YYYY-MM-DD_HH-MM-SS}.log
-	timestamp := time.Now().Format("2006-01-02_15-04-05")
-	nextPath := filepath.Join(fw.baseDir, fmt.Sprintf("%s_%s.log", fw.baseFileName, timestamp))
+	// Generate timestamped filename: {baseFileName}_{YYYY-MM-DD_HH-MM-SS-mmm}_{seq}.log
+	nextPath := fw.names.next(fw.baseDir, fw.baseFileName, fw.clock.Now())
 
-	// Try to open new file with preallocation
-	file, err := openDirectIOSize(nextPath, fw.preallocateFileSize)
+	file, preallocMethod, err := fw.openNextFile(nextPath, fw.nextPreallocateSize())
 	if err != nil {
+		return err
+	}
+	fw.setNextFile(file, nextPath, preallocMethod)
+	return nil
+}
+
+// openNextFile opens and preallocates a file for rotation and writes its header
+// It only uses fields fixed at construction, so it can run without rotationMu
+func (fw *SizeFileWriter) openNextFile(nextPath string, preallocateSize int64) (*os.File, PreallocMethod, error) {
+	// Try to open new file with preallocation
+	file, preallocMethod, err := fw.openFile(nextPath, preallocateSize)
+	if err != nil && preallocateSize > 0 {
 		// If preallocation fails, try creating file without preallocation as fallback
-		file, err = openDirectIOSize(nextPath, 0)
+		file, preallocMethod, err = fw.openFile(nextPath, 0)
 		if err != nil {
-			return fmt.Errorf("failed to open next file (with and without preallocation): %w", err)
+			return nil, "", fmt.Errorf("failed to open next file (with and without preallocation): %w", err)
 		}
 		// Log warning but continue (file will work, just without preallocation)
-		fmt.Printf("[WARNING] Failed to preallocate %d bytes for %s, continuing without preallocation\n",
-			fw.preallocateFileSize, nextPath)
+		fw.logger.Printf("[WARNING] Failed to preallocate %d bytes for %s, continuing without preallocation",
+			preallocateSize, nextPath)
+	} else if err != nil {
+		return nil, "", fmt.Errorf("failed to open next file: %w", err)
 	}
+	if preallocMethod == PreallocTruncate {
+		fw.warnPreallocTruncate(nextPath)
+	}
+	if err := writeFileHeader(int(file.Fd()), fw.fileHeader, fw.clock.Now()); err != nil {
+		file.Close()
+		os.Remove(nextPath)
+		return nil, "", err
+	}
+	return file, preallocMethod, nil
+}
 
-	// Store next file details
+// setNextFile stores file as the next file of the rotation
+func (fw *SizeFileWriter) setNextFile(file *os.File, nextPath string, preallocMethod PreallocMethod) {
 	fw.nextFile = file
+	fw.nextPreallocMethod = preallocMethod
 	fw.nextFd = int(file.Fd())
 	fw.nextFilePath = nextPath
-
-	return nil
+	fw.trackOpen(nextPath)
 }
 
 // swapFiles atomically swaps from current file to next file
@@ -291,10 +643,8 @@ func (fw *SizeFileWriter) swapFiles() error {
 
 	// Truncate file to actual written size (removes preallocated space)
 	// This is fast for sparse files (metadata-only operation)
-	if actualSize > 0 {
-		if err := unix.Ftruncate(fw.fd, actualSize); err != nil {
-			return fmt.Errorf("failed to truncate file to actual size: %w", err)
-		}
+	if err := unix.Ftruncate(fw.fd, actualSize); err != nil {
+		return fmt.Errorf("failed to truncate file to actual size: %w", err)
 	}
 
 	// Store current file path before closing (for upload)
@@ -305,22 +655,16 @@ func (fw *SizeFileWriter) swapFiles() error {
 		return fmt.Errorf("failed to close current file: %w", err)
 	}
 
-	// Send completed file to upload channel (non-blocking)
-	if fw.completedFileChan != nil {
-		select {
-		case fw.completedFileChan <- completedFilePath:
-			// Successfully sent to channel
-		default:
-			// Channel full - log warning but don't block rotation
-			fmt.Printf("[WARNING] Upload channel full, skipping upload for %s\n", completedFilePath)
-		}
-	}
+	// Send completed file to upload channel (non-blocking) and wake retention
+	fw.completeFile(completedFilePath, fw.nextFilePath, actualSize, FileRotated)
 
 	// Swap next file to current
 	fw.file = fw.nextFile
 	fw.fd = fw.nextFd
 	fw.filePath = fw.nextFilePath
-	fw.fileOffset.Store(0) // Reset offset for new file
+	fw.preallocMethod.Store(fw.nextPreallocMethod)
+	fw.lastRotation.Store(fw.clock.Now().UnixNano())
+	fw.fileOffset.Store(fw.fileHeader.dataStart()) // Shards of the new file start after its header
 
 	// Clear next file fields
 	fw.nextFile = nil
@@ -330,42 +674,115 @@ func (fw *SizeFileWriter) swapFiles() error {
 	return nil
 }
 
-// openDirectIOSize opens a file with O_DIRECT and O_DSYNC flags, preallocating with fallocate
-// Returns the file and error. New files always start at offset 0.
-func openDirectIOSize(path string, preallocateSize int64) (*os.File, error) {
+// writeFileHeader writes h, stamped with created, at the start of a new file; a nil h writes nothing
+// The header block is written from an aligned buffer, as O_DIRECT requires
+func writeFileHeader(fd int, h *FileHeader, created time.Time) error {
+	if h == nil {
+		return nil
+	}
+	buf, cleanup, err := allocMmapBuffer(h.Size)
+	if err != nil {
+		return fmt.Errorf("failed to allocate file header: %w", err)
+	}
+	defer freeMmapBuffer(buf)
+	defer cleanup()
+
+	h.encode(buf, created)
+	if _, err := unix.Pwrite(fd, buf[:h.Size], 0); err != nil {
+		return fmt.Errorf("failed to write file header: %w", err)
+	}
+	return nil
+}
+
+// fallocate reserves extents for a file (unix.Fallocate; overridable in tests)
+var fallocate = unix.Fallocate
+
+// openDirectIOSize opens a file with O_DIRECT and syncFlag (O_DSYNC or 0), preallocating with fallocate
+// a multiple of alignment (Config.IOAlignment)
+// Where fallocate is unsupported (EOPNOTSUPP, e.g. tmpfs) the file is extended with ftruncate instead.
+// Returns the file, the preallocation method used and error. New files always start at offset 0.
+func openDirectIOSize(path string, preallocateSize, alignment int64, syncFlag int) (*os.File, PreallocMethod, error) {
 	// Ensure parent directory exists
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create directory: %w", err)
+		return nil, "", fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	// Align preallocate size to filesystem block size
-	alignedSize := alignUp(preallocateSize, alignmentSize)
+	// Align preallocate size to the Direct I/O block size
+	alignedSize := alignUp(preallocateSize, alignment)
 
-	// Open with O_DIRECT, O_DSYNC, O_WRONLY, O_CREAT, O_TRUNC using unix package
+	// Open with O_DIRECT, O_WRONLY, O_CREAT, O_TRUNC (plus O_DSYNC for pwritev) using unix package
 	fd, err := unix.Open(path,
-		unix.O_WRONLY|unix.O_CREAT|unix.O_TRUNC|unix.O_DIRECT|unix.O_DSYNC,
+		unix.O_WRONLY|unix.O_CREAT|unix.O_TRUNC|unix.O_DIRECT|syncFlag,
 		0644)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file with O_DIRECT: %w", err)
+		return nil, "", fmt.Errorf("failed to open file with O_DIRECT: %w", err)
 	}
 
-	// Preallocate file using fallocate
+	// Preallocate file using fallocate (mode 0: real extents, so writes allocate no blocks)
+	method := PreallocNone
 	if preallocateSize > 0 {
-		if err := unix.Fallocate(fd, 0, 0, alignedSize); err != nil {
+		method = PreallocFallocate
+		err := fallocate(fd, 0, 0, alignedSize)
+		if errors.Is(err, unix.EOPNOTSUPP) {
+			method = PreallocTruncate
+			err = unix.Ftruncate(fd, alignedSize)
+		}
+		if err != nil {
 			unix.Close(fd)
-			return nil, fmt.Errorf("failed to preallocate file with fallocate: %w", err)
+			return nil, "", fmt.Errorf("failed to preallocate file with %s: %w", method, err)
 		}
 	}
 
 	file := os.NewFile(uintptr(fd), path)
 	if file == nil {
 		unix.Close(fd)
-		return nil, fmt.Errorf("failed to create file descriptor")
+		return nil, "", fmt.Errorf("failed to create file descriptor")
 	}
 
 	// File is always truncated and preallocated, so offset is always 0
-	return file, nil
+	return file, method, nil
+}
+
+// pwritev is the vectored write syscall (unix.Pwritev); tests replace it to inject short writes
+// and EINTR
+var pwritev = unix.Pwritev
+
+// pwritevFull writes every byte of buffers at offset: a short write continues from the first
+// unwritten byte, and EINTR/EAGAIN are retried. It returns fewer bytes than buffers hold only with
+// a hard error. The slices in buffers are advanced past what was written, so callers pass a copy
+// A short O_DIRECT write ends on a block boundary, so the continuation stays aligned
+func pwritevFull(fd int, buffers [][]byte, offset int64) (int, error) {
+	written := 0
+	for len(buffers) > 0 {
+		n, err := pwritev(fd, buffers, offset+int64(written))
+		if n > 0 {
+			written += n
+			buffers = advanceBuffers(buffers, n)
+		}
+		if err == unix.EINTR || err == unix.EAGAIN {
+			continue
+		}
+		if err != nil {
+			return written, err
+		}
+		if n <= 0 && len(buffers) > 0 {
+			return written, io.ErrShortWrite // No progress and no error: give up rather than spin
+		}
+	}
+	return written, nil
+}
+
+// advanceBuffers drops the first n bytes of buffers
+func advanceBuffers(buffers [][]byte, n int) [][]byte {
+	for len(buffers) > 0 && n >= len(buffers[0]) {
+		n -= len(buffers[0])
+		buffers = buffers[1:]
+	}
+	if len(buffers) > 0 {
+		buffers[0] = buffers[0][n:]
+	}
+	return buffers
 }
 
 // writevAlignedWithOffset writes multiple buffers to file at a specific offset using vectored I/O
@@ -386,8 +803,8 @@ func writevAlignedWithOffset(fd int, buffers [][]byte, offset int64) (int, error
 		return 0, nil
 	}
 
-	// Use unix.Pwritev for vectored I/O
-	n, err := unix.Pwritev(fd, nonEmptyBuffers, offset)
+	// Use unix.Pwritev for vectored I/O, continuing short writes so a flush is never cut off mid-shard
+	n, err := pwritevFull(fd, nonEmptyBuffers, offset)
 	if err != nil {
 		return n, fmt.Errorf("vectored I/O write failed: %w", err)
 	}
@@ -395,27 +812,11 @@ func writevAlignedWithOffset(fd int, buffers [][]byte, offset int64) (int, error
 	return n, nil
 }
 
-// alignUp rounds n up to the next multiple of align (power of 2)
-func alignUp(n, align int64) int64 {
-	return (n + align - 1) &^ (align - 1)
-}
-
-// extractBasePathSize extracts directory and base filename from a full file path
-func extractBasePathSize(fullPath string) (dir, baseName string, err error) {
-	dir = filepath.Dir(fullPath)
-	if dir == "." || dir == "" {
-		dir = "."
+// ioUringEntries sizes the ring for one flush: up to two buffers per shard plus the fdatasync
+func ioUringEntries(numShards int) uint32 {
+	entries := 2*numShards + 1
+	if entries > 4096 {
+		entries = 4096
 	}
-
-	baseName = filepath.Base(fullPath)
-	// Remove .log extension if present
-	if strings.HasSuffix(baseName, ".log") {
-		baseName = strings.TrimSuffix(baseName, ".log")
-	}
-
-	if baseName == "" {
-		return "", "", fmt.Errorf("invalid file path: base name is empty after extraction")
-	}
-
-	return dir, baseName, nil
+	return uint32(entries)
 }
@@ -0,0 +1,286 @@
+//go:build linux
+
+package asyncloguploader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// stubFallocate replaces fallocate for the duration of the test
+func stubFallocate(t *testing.T, fn func(fd int, mode uint32, off, size int64) error) {
+	t.Helper()
+	original := fallocate
+	fallocate = fn
+	t.Cleanup(func() { fallocate = original })
+}
+
+// stubPwritev scripts pwritev for the duration of the test: script sees each call's buffers and
+// returns an error to fail the call with, or how many bytes the real pwritev may write (< 0: all)
+func stubPwritev(t *testing.T, script func(call int, buffers [][]byte) (limit int, err error)) {
+	t.Helper()
+	original := pwritev
+	call := 0
+	pwritev = func(fd int, buffers [][]byte, offset int64) (int, error) {
+		limit, err := script(call, buffers)
+		call++
+		if err != nil {
+			return -1, err
+		}
+		if limit >= 0 {
+			buffers = limitBuffers(buffers, limit)
+		}
+		return original(fd, buffers, offset)
+	}
+	t.Cleanup(func() { pwritev = original })
+}
+
+// limitBuffers returns the leading buffers holding the first limit bytes of buffers
+func limitBuffers(buffers [][]byte, limit int) [][]byte {
+	limited := make([][]byte, 0, len(buffers))
+	for _, buf := range buffers {
+		if limit <= 0 {
+			break
+		}
+		buf = buf[:min(len(buf), limit)]
+		limited = append(limited, buf)
+		limit -= len(buf)
+	}
+	return limited
+}
+
+func TestPwritevFull_ContinuesShortWrites(t *testing.T) {
+	buffers := [][]byte{
+		bytes.Repeat([]byte("a"), 100),
+		bytes.Repeat([]byte("b"), 50),
+		bytes.Repeat([]byte("c"), 70),
+	}
+	want := bytes.Join(buffers, nil)
+
+	for name, limits := range map[string][]int{
+		"MidBuffer":       {30, 30, 60, 1},
+		"AtBufferEdge":    {100, 50},
+		"AcrossBuffers":   {120, 95},
+		"OneBytePerCall":  {1, 1, 1, 1, 1, 1, 1, 1},
+		"InterruptedOnly": {},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var calls int
+			stubPwritev(t, func(call int, _ [][]byte) (int, error) {
+				calls++
+				switch {
+				case call == 0:
+					return 0, unix.EINTR
+				case call == 1:
+					return 0, unix.EAGAIN
+				case call-2 < len(limits):
+					return limits[call-2], nil
+				}
+				return -1, nil
+			})
+
+			file, err := os.Create(filepath.Join(t.TempDir(), "test.log"))
+			require.NoError(t, err)
+			defer file.Close()
+			_, err = file.Write([]byte("head"))
+			require.NoError(t, err)
+
+			// The caller's slice is left alone: pwritevFull only advances its own copy
+			input := append([][]byte{}, buffers...)
+			n, err := writevAlignedWithOffset(int(file.Fd()), input, 4)
+			require.NoError(t, err)
+			assert.Equal(t, len(want), n)
+			assert.Equal(t, buffers, input)
+			assert.Equal(t, len(limits)+3, calls)
+
+			data, err := os.ReadFile(file.Name())
+			require.NoError(t, err)
+			assert.Equal(t, append([]byte("head"), want...), data)
+		})
+	}
+
+	t.Run("HardErrorReportsWrittenBytes", func(t *testing.T) {
+		stubPwritev(t, func(call int, _ [][]byte) (int, error) {
+			if call == 0 {
+				return 120, nil
+			}
+			return 0, unix.EIO
+		})
+
+		file, err := os.Create(filepath.Join(t.TempDir(), "test.log"))
+		require.NoError(t, err)
+		defer file.Close()
+		n, err := writevAlignedWithOffset(int(file.Fd()), buffers, 0)
+		assert.ErrorIs(t, err, unix.EIO)
+		assert.Equal(t, 120, n)
+	})
+}
+
+func TestLogger_ShortPwritevKeepsFileIntact(t *testing.T) {
+	// O_DIRECT short writes end on a block boundary: cut flushes at the first block of a shard
+	// buffer (mid-buffer) and at the end of the first buffer (buffer edge), with EINTR in between
+	var midBuffer, bufferEdge int
+	stubPwritev(t, func(call int, buffers [][]byte) (int, error) {
+		switch call % 4 {
+		case 0:
+			if len(buffers[0]) > 4096 {
+				midBuffer++
+				return 4096, nil
+			}
+		case 1:
+			return 0, unix.EINTR
+		case 2:
+			if len(buffers) > 1 {
+				bufferEdge++
+				return len(buffers[0]), nil
+			}
+		}
+		return -1, nil
+	})
+
+	logger, tmpDir := newSizeTestLogger(t, "short", nil)
+	var want [][]byte
+	for i := 0; i < 600; i++ {
+		msg := []byte(fmt.Sprintf("message %04d %s", i, bytes.Repeat([]byte("x"), 1000)))
+		logger.LogBytes(msg)
+		want = append(want, msg)
+	}
+	require.NoError(t, logger.Close())
+	assert.Positive(t, midBuffer)
+	assert.Positive(t, bufferEdge)
+
+	messages, _ := readAllMessages(t, findLogFile(t, tmpDir, "short"))
+	assert.ElementsMatch(t, want, messages) // Shards interleave messages, so only the set is fixed
+}
+
+func TestOpenDirectIOSize_Preallocation(t *testing.T) {
+	t.Run("UsesFallocate", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.log")
+		file, method, err := openDirectIOSize(path, 1024*1024+1, alignmentSize, 0)
+		require.NoError(t, err)
+		defer file.Close()
+		if method == PreallocTruncate {
+			t.Skip("fallocate is not supported by the test filesystem")
+		}
+		assert.Equal(t, PreallocFallocate, method)
+
+		var stat unix.Stat_t
+		require.NoError(t, unix.Fstat(int(file.Fd()), &stat))
+		assert.Equal(t, int64(1024*1024+4096), stat.Size)
+		assert.GreaterOrEqual(t, stat.Blocks*512, stat.Size, "fallocate reserves real blocks")
+	})
+
+	t.Run("FallsBackToTruncateWhenFallocateUnsupported", func(t *testing.T) {
+		stubFallocate(t, func(int, uint32, int64, int64) error { return unix.EOPNOTSUPP })
+
+		path := filepath.Join(t.TempDir(), "test.log")
+		file, method, err := openDirectIOSize(path, 1024*1024+1, alignmentSize, 0)
+		require.NoError(t, err)
+		defer file.Close()
+		assert.Equal(t, PreallocTruncate, method)
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1024*1024+4096), info.Size())
+	})
+
+	t.Run("AlignsToIOAlignment", func(t *testing.T) {
+		stubFallocate(t, func(int, uint32, int64, int64) error { return unix.EOPNOTSUPP })
+
+		for alignment, want := range map[int64]int64{512: 1024*1024 + 512, 8192: 1024*1024 + 8192} {
+			path := filepath.Join(t.TempDir(), "test.log")
+			file, _, err := openDirectIOSize(path, 1024*1024+1, alignment, 0)
+			require.NoError(t, err)
+			file.Close()
+
+			info, err := os.Stat(path)
+			require.NoError(t, err)
+			assert.Equal(t, want, info.Size(), "alignment %d", alignment)
+		}
+	})
+
+	t.Run("OtherFallocateErrorsFail", func(t *testing.T) {
+		stubFallocate(t, func(int, uint32, int64, int64) error { return unix.ENOSPC })
+
+		_, _, err := openDirectIOSize(filepath.Join(t.TempDir(), "test.log"), 1024*1024, alignmentSize, 0)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, unix.ENOSPC)
+	})
+
+	t.Run("WriterWarnsOnceAndReportsTruncate", func(t *testing.T) {
+		stubFallocate(t, func(int, uint32, int64, int64) error { return unix.EOPNOTSUPP })
+		capture := &captureLogger{}
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		config.PreallocateFileSize = 1024 * 1024
+		config.InternalLogger = capture
+
+		writer, err := NewSizeFileWriter(config, nil)
+		require.NoError(t, err)
+		assert.Equal(t, PreallocTruncate, writer.PreallocMethod())
+
+		writer.rotationMu.Lock()
+		require.NoError(t, writer.createNextFile())
+		require.NoError(t, writer.swapFiles())
+		writer.rotationMu.Unlock()
+		assert.Equal(t, PreallocTruncate, writer.PreallocMethod())
+		require.NoError(t, writer.Close())
+
+		var warnings int
+		for _, message := range capture.Messages() {
+			if strings.Contains(message, "fallocate is not supported") {
+				warnings++
+			}
+		}
+		assert.Equal(t, 1, warnings)
+	})
+}
+
+func TestLogger_FlushMetricsPwritev(t *testing.T) {
+	logger, _ := newSizeTestLogger(t, "metrics", nil)
+	logMessages(t, logger, "flushed", 100)
+	require.NoError(t, logger.Flush(context.Background()))
+	logMessages(t, logger, "again", 100)
+	require.NoError(t, logger.Flush(context.Background()))
+
+	metrics := logger.GetFlushMetrics()
+	assert.GreaterOrEqual(t, metrics.TotalFlushes, int64(2))
+	assert.Zero(t, metrics.FlushErrors)
+	assert.Greater(t, metrics.TotalFlushDuration, time.Duration(0))
+	assert.Greater(t, metrics.AvgFlushDuration, time.Duration(0))
+	assert.GreaterOrEqual(t, metrics.MaxFlushDuration, metrics.AvgFlushDuration)
+	assert.Greater(t, metrics.AvgWriteDuration, time.Duration(0))
+	assert.Greater(t, metrics.AvgPwritevDuration, time.Duration(0))
+	assert.GreaterOrEqual(t, metrics.MaxPwritevDuration, metrics.AvgPwritevDuration)
+	assert.Greater(t, metrics.PwritevPercent, 0.0)
+	assert.LessOrEqual(t, metrics.PwritevPercent, metrics.WritePercent)
+	assert.Zero(t, metrics.FlushQueueDepth)
+
+	t.Run("aggregated by LoggerManager", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+
+		for _, event := range []string{"payment", "login"} {
+			manager.LogWithEvent(event, "entry")
+			require.NoError(t, manager.FlushEvent(event, context.Background()))
+		}
+		aggregated := manager.GetAggregatedFlushMetrics()
+		assert.Equal(t, int64(2), aggregated.TotalFlushes)
+		assert.Greater(t, aggregated.TotalFlushDuration, time.Duration(0))
+		assert.Greater(t, aggregated.AvgPwritevDuration, time.Duration(0))
+		assert.Greater(t, aggregated.MaxPwritevDuration, time.Duration(0))
+		assert.Greater(t, aggregated.PwritevPercent, 0.0)
+	})
+	require.NoError(t, logger.Close())
+}
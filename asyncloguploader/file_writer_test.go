@@ -1,7 +1,12 @@
 package asyncloguploader
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
@@ -11,6 +16,17 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+// alignedBlock returns s at the start of a zeroed 4096-byte block: the Linux writer uses O_DIRECT,
+// which takes whole aligned blocks like the shard buffers it is normally handed
+func alignedBlock(t *testing.T, s string) []byte {
+	t.Helper()
+	buf, cleanup, err := allocMmapBuffer(4096)
+	require.NoError(t, err)
+	t.Cleanup(cleanup)
+	copy(buf, s)
+	return buf
+}
+
 func TestFileWriter_WriteVectored(t *testing.T) {
 	t.Run("WritesBuffersToFile", func(t *testing.T) {
 		tmpDir := t.TempDir()
@@ -22,8 +38,8 @@ func TestFileWriter_WriteVectored(t *testing.T) {
 		defer writer.Close()
 
 		buffers := [][]byte{
-			[]byte("buffer1"),
-			[]byte("buffer2"),
+			alignedBlock(t, "buffer1"),
+			alignedBlock(t, "buffer2"),
 		}
 
 		n, err := writer.WriteVectored(buffers)
@@ -53,10 +69,10 @@ func TestFileWriter_WriteVectored(t *testing.T) {
 		defer writer.Close()
 
 		buffers := [][]byte{
-			[]byte("data"),
+			alignedBlock(t, "data"),
 			nil,
 			[]byte{},
-			[]byte("more data"),
+			alignedBlock(t, "more data"),
 		}
 
 		n, err := writer.WriteVectored(buffers)
@@ -111,9 +127,65 @@ func TestFileWriter_Rotation(t *testing.T) {
 		}
 
 		// Write more data (should go to new file)
-		_, err = writer.WriteVectored([][]byte{[]byte("new file data")})
+		_, err = writer.WriteVectored([][]byte{alignedBlock(t, "new file data")})
 		assert.NoError(t, err)
 	})
+
+	t.Run("RotationsWithinOneSecondKeepEveryFile", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		config := DefaultConfig(filepath.Join(tmpDir, "test.log"))
+		config.MaxFileSize = 2 * 4096 // The file header and one write fill a file
+		useFakeClock(&config)         // Frozen: every rotation falls in the same second (and millisecond)
+
+		uploadChan := make(chan string, 10)
+		writer, err := NewSizeFileWriter(config, uploadChan)
+		require.NoError(t, err)
+		buf, cleanup, err := allocMmapBuffer(4096)
+		require.NoError(t, err)
+		defer cleanup()
+
+		contents := []string{"first", "second", "third"}
+		for _, content := range contents {
+			clear(buf)
+			copy(buf, content)
+			_, err := writer.WriteVectored([][]byte{buf})
+			require.NoError(t, err)
+		}
+		require.NoError(t, writer.Close())
+
+		var files []string
+		for len(uploadChan) > 0 {
+			files = append(files, <-uploadChan)
+		}
+		require.Len(t, files, len(contents))
+		for i, path := range files {
+			assert.Equal(t, fmt.Sprintf("test_2025-03-14_09-26-53-000_%d.log", i), filepath.Base(path))
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			data = data[writer.fileHeader.dataStart():]
+			assert.Equal(t, contents[i], string(bytes.TrimRight(data, "\x00")))
+		}
+	})
+
+	t.Run("NamesAreNotReusedWithinAMillisecond", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		now := time.Date(2026, 1, 2, 18, 55, 2, 7*int(time.Millisecond), time.Local)
+		var names rotatedNames
+
+		first := names.next(tmpDir, "test", now)
+		assert.Equal(t, filepath.Join(tmpDir, "test_2026-01-02_18-55-02-007_0.log"), first)
+
+		// The sequence goes on although the first file does not exist (e.g. uploaded and deleted)
+		assert.Equal(t, filepath.Join(tmpDir, "test_2026-01-02_18-55-02-007_1.log"), names.next(tmpDir, "test", now))
+
+		// A name taken on disk is skipped
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "test_2026-01-02_18-55-02-007_2.log"), nil, 0644))
+		assert.Equal(t, filepath.Join(tmpDir, "test_2026-01-02_18-55-02-007_3.log"), names.next(tmpDir, "test", now))
+
+		// A new millisecond starts over
+		later := now.Add(time.Millisecond)
+		assert.Equal(t, filepath.Join(tmpDir, "test_2026-01-02_18-55-02-008_0.log"), names.next(tmpDir, "test", later))
+	})
 }
 
 func TestFileWriter_FileIntegrity(t *testing.T) {
@@ -129,7 +201,7 @@ func TestFileWriter_FileIntegrity(t *testing.T) {
 		// Create test buffers with headers
 		buffer1 := make([]byte, 1024)
 		binary.LittleEndian.PutUint32(buffer1[0:4], 1024) // Capacity
-		binary.LittleEndian.PutUint32(buffer1[4:8], 100) // Valid data bytes
+		binary.LittleEndian.PutUint32(buffer1[4:8], 100)  // Valid data bytes
 		copy(buffer1[8:], []byte("test data 1"))
 
 		buffer2 := make([]byte, 1024)
@@ -237,6 +309,7 @@ func TestFileWriter_HeaderFormat(t *testing.T) {
 		data, err := os.ReadFile(actualFile)
 		require.NoError(t, err)
 
+		data = data[writer.fileHeader.dataStart():]
 		if len(data) >= 8 {
 			readCapacity := binary.LittleEndian.Uint32(data[0:4])
 			readValidBytes := binary.LittleEndian.Uint32(data[4:8])
@@ -247,6 +320,95 @@ func TestFileWriter_HeaderFormat(t *testing.T) {
 	})
 }
 
+func TestFileWriter_AsyncRotation(t *testing.T) {
+	newWriter := func(t *testing.T) (*SizeFileWriter, chan string, []byte) {
+		tmpDir := t.TempDir()
+		config := DefaultConfig(filepath.Join(tmpDir, "test.log"))
+		config.MaxFileSize = 10 * 4096 // The next file is prepared from the 8th write on
+
+		uploadChan := make(chan string, 10)
+		writer, err := NewSizeFileWriter(config, uploadChan)
+		require.NoError(t, err)
+		buf, cleanup, err := allocMmapBuffer(4096)
+		require.NoError(t, err)
+		t.Cleanup(cleanup)
+		return writer, uploadChan, buf
+	}
+
+	t.Run("WritesDoNotWaitForSlowPreallocation", func(t *testing.T) {
+		writer, uploadChan, buf := newWriter(t)
+		started := make(chan struct{})
+		release := make(chan struct{})
+		openFile := writer.openFile
+		writer.openFile = func(path string, preallocateSize int64) (*os.File, PreallocMethod, error) {
+			close(started)
+			<-release // Stands in for a slow fallocate
+			return openFile(path, preallocateSize)
+		}
+
+		// Writes 1-9 fill the file to 90% while the preparation is blocked
+		done := make(chan error, 1)
+		go func() {
+			for i := 0; i < 9; i++ {
+				if _, err := writer.WriteVectored([][]byte{buf}); err != nil {
+					done <- err
+					return
+				}
+			}
+			done <- nil
+		}()
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("writes blocked on the next file's preallocation")
+		}
+		<-started
+		close(release)
+
+		// The 10th write reaches MaxFileSize and rotates to the prepared file
+		_, err := writer.WriteVectored([][]byte{buf})
+		require.NoError(t, err)
+		require.Len(t, uploadChan, 1)
+		rotated := <-uploadChan
+		assert.NotEqual(t, rotated, writer.filePath)
+		require.NoError(t, writer.Close())
+
+		info, err := os.Stat(rotated)
+		require.NoError(t, err)
+		assert.Equal(t, int64(10*4096), info.Size())
+	})
+
+	t.Run("PreparationFailureFailsNextWrite", func(t *testing.T) {
+		writer, uploadChan, buf := newWriter(t)
+		openFile := writer.openFile
+		writer.openFile = func(path string, preallocateSize int64) (*os.File, PreallocMethod, error) {
+			return nil, "", errors.New("no space left on device")
+		}
+
+		for i := 0; i < 8; i++ {
+			_, err := writer.WriteVectored([][]byte{buf})
+			require.NoError(t, err)
+		}
+		writer.rotationMu.Lock()
+		writer.waitPrepared()
+		writer.rotationMu.Unlock()
+
+		_, err := writer.WriteVectored([][]byte{buf})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to prepare next file")
+		assert.Contains(t, err.Error(), "no space left on device")
+
+		// Once the disk recovers, preparation is retried and the file rotates as usual
+		writer.openFile = openFile
+		for i := 0; i < 3; i++ {
+			_, err := writer.WriteVectored([][]byte{buf})
+			require.NoError(t, err)
+		}
+		require.NoError(t, writer.Close())
+		assert.Len(t, uploadChan, 2)
+	})
+}
 func TestFileWriter_GetLastPwritevDuration(t *testing.T) {
 	t.Run("ReturnsDurationAfterWrite", func(t *testing.T) {
 		tmpDir := t.TempDir()
@@ -256,7 +418,7 @@ func TestFileWriter_GetLastPwritevDuration(t *testing.T) {
 		require.NoError(t, err)
 		defer writer.Close()
 
-		buffers := [][]byte{[]byte("test")}
+		buffers := [][]byte{alignedBlock(t, "test")}
 		_, err = writer.WriteVectored(buffers)
 		require.NoError(t, err)
 
@@ -265,3 +427,247 @@ func TestFileWriter_GetLastPwritevDuration(t *testing.T) {
 	})
 }
 
+func TestFileWriter_Preallocation(t *testing.T) {
+	t.Run("PreallocatesAndTruncatesToWrittenSize", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		config := DefaultConfig(filepath.Join(tmpDir, "test.log"))
+		config.MaxFileSize = 0                     // Disable rotation
+		config.PreallocateFileSize = 1024*1024 + 1 // Rounded up to the next block
+
+		writer, err := NewSizeFileWriter(config, nil)
+		require.NoError(t, err)
+		path := writer.filePath
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, alignUp(config.PreallocateFileSize, alignmentSize), info.Size())
+
+		// Block-aligned buffers so the write also satisfies O_DIRECT on Linux
+		first, cleanupFirst, err := allocMmapBuffer(4096)
+		require.NoError(t, err)
+		defer cleanupFirst()
+		second, cleanupSecond, err := allocMmapBuffer(4096)
+		require.NoError(t, err)
+		defer cleanupSecond()
+		copy(first, "first")
+		copy(second, "second")
+
+		n, err := writer.WriteVectored([][]byte{first, second})
+		require.NoError(t, err)
+		assert.Equal(t, 8192, n)
+		require.NoError(t, writer.Close())
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		start := int(writer.fileHeader.dataStart())
+		require.Len(t, data, start+8192)
+		assert.Equal(t, "first", string(data[start:start+5]))
+		assert.Equal(t, "second", string(data[start+4096:start+4102]))
+	})
+
+	t.Run("ReportsPreallocMethod", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		config := DefaultConfig(filepath.Join(tmpDir, "test.log"))
+		config.PreallocateFileSize = 1024 * 1024
+
+		writer, err := NewSizeFileWriter(config, nil)
+		require.NoError(t, err)
+		// Truncate where fallocate is unsupported (e.g. tmpfs) and on non-Linux platforms
+		assert.Contains(t, []PreallocMethod{PreallocFallocate, PreallocTruncate}, writer.PreallocMethod())
+
+		// Files created while preallocation is disabled report none
+		writer.setPreallocationEnabled(false)
+		writer.rotationMu.Lock()
+		require.NoError(t, writer.createNextFile())
+		require.NoError(t, writer.swapFiles())
+		writer.rotationMu.Unlock()
+		assert.Equal(t, PreallocNone, writer.PreallocMethod())
+		require.NoError(t, writer.Close())
+	})
+
+	t.Run("TruncatesUnwrittenFilesOnClose", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		config := DefaultConfig(filepath.Join(tmpDir, "test.log"))
+		config.MaxFileSize = 4 * 1024 * 1024
+		config.PreallocateFileSize = 4 * 1024 * 1024
+
+		// Never written
+		writer, err := NewSizeFileWriter(config, nil)
+		require.NoError(t, err)
+		unwritten := writer.filePath
+		require.NoError(t, writer.Close())
+		info, err := os.Stat(unwritten)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), info.Size())
+
+		// Closed with a rotation pending: Close completes it onto the preallocated next file
+		writer, err = NewSizeFileWriter(config, nil)
+		require.NoError(t, err)
+		buf, cleanup, err := allocMmapBuffer(4096)
+		require.NoError(t, err)
+		defer cleanup()
+		_, err = writer.WriteVectored([][]byte{buf})
+		require.NoError(t, err)
+		written := writer.filePath
+		writer.rotationMu.Lock()
+		require.NoError(t, writer.createNextFile())
+		next := writer.nextFilePath
+		writer.rotationMu.Unlock()
+		require.NoError(t, writer.Close())
+
+		info, err = os.Stat(written)
+		require.NoError(t, err)
+		assert.Equal(t, writer.fileHeader.dataStart()+4096, info.Size())
+		info, err = os.Stat(next)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), info.Size(), "no preallocated zeros left in the unused next file")
+	})
+
+	t.Run("LoggerFileDecodesWithoutPreallocatedTail", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		config := DefaultConfig(filepath.Join(tmpDir, "app.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 8
+		config.PreallocateFileSize = 1024 * 1024 * 1024
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		path := logger.groups[0].fileWriter.(*SizeFileWriter).filePath
+
+		// 10MB of 1000-byte messages
+		const dataBytes = 10 * 1024 * 1024
+		msg := make([]byte, 1000)
+		var accepted, written int
+		for written < dataBytes {
+			binary.LittleEndian.PutUint64(msg, uint64(accepted))
+			if logger.TryLogBytes(msg) == nil {
+				accepted++
+				written += len(msg)
+			}
+		}
+		require.NoError(t, logger.Close())
+
+		// Whole shard buffers only: the data plus the unused room of partially filled shards
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, info.Size(), int64(dataBytes))
+		assert.Less(t, info.Size(), int64(dataBytes+2*config.BufferSize))
+
+		f, err := os.Open(path)
+		require.NoError(t, err)
+		defer f.Close()
+		reader := NewReader(f)
+		decoded := 0
+		for {
+			_, err := reader.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+			decoded++
+		}
+		assert.Equal(t, accepted, decoded)
+	})
+}
+
+func TestFileWriter_FileReadyEvents(t *testing.T) {
+	t.Run("RejectsBothChannels", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		config.UploadChannel = make(chan string)
+		config.FileEventChannel = make(chan FileReadyEvent)
+		assert.Error(t, config.Validate())
+	})
+
+	t.Run("DescribesRotatedAndClosedFiles", func(t *testing.T) {
+		events := make(chan FileReadyEvent, 10)
+		config := DefaultConfig(filepath.Join(t.TempDir(), "payment.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 2
+		config.EventName = "payment"
+		config.FileEventChannel = events
+		fake := useFakeClock(&config)
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		fw := logger.groups[0].fileWriter.(*SizeFileWriter)
+
+		logger.Log("before rotation")
+		require.NoError(t, logger.Flush(context.Background()))
+		fake.Advance(time.Minute)
+		fw.rotationMu.Lock()
+		rotated := fw.filePath
+		require.NoError(t, fw.createNextFile())
+		require.NoError(t, fw.swapFiles())
+		fw.rotationMu.Unlock()
+		closed := fw.filePath
+		assert.Equal(t, "payment_2025-03-14_09-26-53-000_0.log", filepath.Base(rotated)) // Named by Config.Clock
+		assert.Equal(t, "payment_2025-03-14_09-27-53-000_0.log", filepath.Base(closed))
+		_, _, lastRotation := fw.currentFile()
+		assert.True(t, lastRotation.Equal(testClockStart.Add(time.Minute)))
+		logger.Log("after rotation")
+		fake.Advance(time.Minute)
+		require.NoError(t, logger.Close())
+
+		require.Len(t, events, 2)
+		for _, want := range []struct {
+			path      string
+			reason    FileReadyReason
+			rotatedAt time.Time
+		}{{rotated, FileRotated, testClockStart.Add(time.Minute)}, {closed, FileClosed, testClockStart.Add(2 * time.Minute)}} {
+			event := <-events
+			assert.Equal(t, want.path, event.Path)
+			assert.Equal(t, want.reason, event.Reason)
+			assert.Equal(t, "payment", event.Event)
+			assert.True(t, event.RotatedAt.Equal(want.rotatedAt), "RotatedAt %v", event.RotatedAt)
+			info, err := os.Stat(event.Path)
+			require.NoError(t, err)
+			assert.Equal(t, info.Size(), event.SizeBytes)
+			assert.Greater(t, event.SizeBytes, int64(0))
+		}
+	})
+
+	t.Run("DescribesCompressedFile", func(t *testing.T) {
+		events := make(chan FileReadyEvent, 10)
+		config := DefaultConfig(filepath.Join(t.TempDir(), "app.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 2
+		config.Compression = "gzip"
+		config.FileEventChannel = events
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		raw := logger.groups[0].fileWriter.(*SizeFileWriter).filePath
+		logger.Log("compressed")
+		require.NoError(t, logger.Close())
+
+		require.Len(t, events, 1)
+		event := <-events
+		assert.Equal(t, raw+".gz", event.Path)
+		assert.Equal(t, FileClosed, event.Reason)
+		info, err := os.Stat(event.Path)
+		require.NoError(t, err)
+		assert.Equal(t, info.Size(), event.SizeBytes)
+	})
+
+	t.Run("UploaderAcceptsFileEvents", func(t *testing.T) {
+		dst := t.TempDir()
+		uploader, err := NewUploaderWithBackend(GCSUploadConfig{ObjectNameTemplate: "{event}/{basename}"}, NewFileSystemBackend(dst))
+		require.NoError(t, err)
+		uploader.Start()
+
+		// No shared tracker: the event travels with the file
+		config := DefaultConfig(filepath.Join(t.TempDir(), "events.log"))
+		config.BufferSize = 256 * 1024
+		config.NumShards = 2
+		config.FileEventChannel = uploader.GetFileEventChannel()
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		manager.LogWithEvent("login", "session")
+		require.NoError(t, manager.Close())
+		uploader.Stop()
+
+		completion := <-uploader.GetCompletedUploads()
+		assert.Equal(t, "login", completion.Event)
+		objects, err := filepath.Glob(filepath.Join(dst, "login", "login_*.log"))
+		require.NoError(t, err)
+		assert.Len(t, objects, 1)
+	})
+}
@@ -0,0 +1,198 @@
+package asyncloguploader
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/internal/logcore"
+)
+
+// flushGroup is one flush worker's share of the logger (Config.FlushConcurrency)
+// Each group owns a disjoint set of shards and its own file writer, so groups flush in parallel
+// without interleaving writes. A shard is only ever flushed by its group, one flush at a time,
+// so its data lands in its segment file in the order it was swapped
+type flushGroup struct {
+	id     int
+	shards []*Shard // Shards with shard.ID() % len(groups) == id
+
+	// Shards of the set replaced by a resize, flushed ahead of shards until no write to them is in
+	// progress (nil outside a resize). shards and retired are only used by the group's flush worker
+	retired []*Shard
+
+	// Number of shards, which resizes keep (read without the flush worker)
+	numShards int
+
+	// FileWriter for this group's file segment
+	fileWriter FileWriter
+
+	// Channel for flush requests (individual shards sent on swap)
+	flushChan chan *Shard
+
+	// On-demand flush requests from Flush; the worker replies with the flush result
+	flushReqs chan chan error
+
+	// Resize steps from the ticker worker (see Logger.resizeBuffers)
+	swaps chan shardSwap
+
+	// AdaptiveFlush requests from the ticker worker to flush queued shards now (coalesced, capacity 1)
+	earlyFlush chan struct{}
+
+	// Disk-full retries from the ticker worker (coalesced, capacity 1; see disk_full.go)
+	retryFlush chan struct{}
+
+	// FlushInterval ticks from the ticker worker, flushing shards still waiting for the threshold
+	// (coalesced, capacity 1)
+	intervalFlush chan struct{}
+
+	// Consecutive flushes that failed with a disk-full error (flush worker only), and whether the
+	// shards hold data kept for a retry
+	failedFlushes int
+	retaining     atomic.Bool
+
+	// Semaphore to prevent concurrent flushes of this group's shards
+	semaphore chan struct{}
+
+	// Queued shards that trigger a flush (ReadyShardsFlushPct of the group's shards, at least 1)
+	// Atomic so UpdateConfig can change it while the flush worker runs
+	threshold atomic.Int32
+
+	// Per-worker statistics (the logger-wide Statistics aggregate all groups)
+	flushes            atomic.Int64
+	flushErrors        atomic.Int64
+	totalFlushDuration atomic.Int64 // Nanoseconds
+	maxFlushDuration   atomic.Int64 // Nanoseconds
+}
+
+// FlushWorkerStats holds one flush worker's statistics (see Config.FlushConcurrency)
+type FlushWorkerStats struct {
+	Worker           int           // Worker index; worker i writes file segment i
+	Shards           int           // Number of shards assigned to the worker
+	Flushes          int64         // Flush operations completed
+	FlushErrors      int64         // Flush operations that failed
+	AvgFlushDuration time.Duration // Average over all flushes, including failed ones
+	MaxFlushDuration time.Duration
+}
+
+// newFlushGroups splits the shards between min(FlushConcurrency, NumShards) groups, each with its
+// own file writer, and points the shard collection at the groups' flush channels
+// A non-nil w is the only group's writer (see NewLoggerWithWriter)
+func newFlushGroups(config Config, sc *ShardCollection, w FileWriter) ([]*flushGroup, error) {
+	n := max(1, min(config.FlushConcurrency, sc.NumShards()))
+	if w != nil {
+		n = 1
+	}
+	groups := make([]*flushGroup, n)
+	for i := range groups {
+		groups[i] = &flushGroup{id: i}
+	}
+	for _, shard := range sc.Shards() {
+		g := groups[int(shard.ID())%n]
+		g.shards = append(g.shards, shard)
+	}
+
+	flushChans := make([]chan<- *Shard, n)
+	for i, g := range groups {
+		fileWriter := w
+		if fileWriter == nil {
+			segmentConfig := config
+			segmentConfig.LogFilePath = segmentLogPath(config.LogFilePath, i)
+			sizeWriter, err := NewSizeFileWriter(segmentConfig, config.UploadChannel)
+			if err != nil {
+				closeFlushGroups(groups[:i])
+				return nil, fmt.Errorf("failed to create file writer for %s: %w", segmentConfig.LogFilePath, err)
+			}
+			fileWriter = sizeWriter
+		}
+
+		// Register the group's shard buffers with the io_uring backend (unregistered buffers still work, just slower)
+		if registrar, ok := any(fileWriter).(ioBackendWriter); ok {
+			if err := registrar.registerBuffers(doubleBuffers(g.shards)); err != nil {
+				config.InternalLogger.Printf("[WARNING] %v, continuing with unregistered buffers", err)
+			}
+		}
+
+		// With room for every shard, coalesced enqueues never block
+		g.fileWriter = fileWriter
+		g.flushChan = make(chan *Shard, max(32, len(g.shards)))
+		g.flushReqs = make(chan chan error)
+		g.swaps = make(chan shardSwap)
+		g.numShards = len(g.shards)
+		g.earlyFlush = make(chan struct{}, 1)
+		g.retryFlush = make(chan struct{}, 1)
+		g.intervalFlush = make(chan struct{}, 1)
+		g.semaphore = make(chan struct{}, 1)
+		g.threshold.Store(int32(readyShardsThreshold(len(g.shards), config.ReadyShardsFlushPct)))
+		flushChans[i] = g.flushChan
+	}
+
+	sc.flushChans = flushChans
+	return groups, nil
+}
+
+// segmentLogPath returns the log path written by flush worker i
+// Worker 0 keeps the configured path so a single worker behaves as before
+func segmentLogPath(logPath string, i int) string {
+	if i == 0 {
+		return logPath
+	}
+	dir := filepath.Dir(logPath)
+	base := strings.TrimSuffix(filepath.Base(logPath), ".log")
+	return filepath.Join(dir, fmt.Sprintf("%s_w%d.log", base, i))
+}
+
+// closeFlushGroups closes the groups' file writers and returns the first error
+func closeFlushGroups(groups []*flushGroup) error {
+	var firstErr error
+	for _, g := range groups {
+		if err := g.fileWriter.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// withRetired returns shards preceded by the group's retired shards during a resize, so entries
+// in a retired shard are written before those in its replacement
+func (g *flushGroup) withRetired(shards []*Shard) []*Shard {
+	if len(g.retired) == 0 {
+		return shards
+	}
+	list := append(make([]*Shard, 0, len(g.retired)+len(shards)), g.retired...)
+	for _, shard := range shards {
+		list = appendUnique(list, shard)
+	}
+	return list
+}
+
+// recordFlush updates the group's statistics after a flush
+func (g *flushGroup) recordFlush(duration time.Duration, err error) {
+	if err != nil {
+		g.flushErrors.Add(1)
+	} else {
+		g.flushes.Add(1)
+	}
+	g.totalFlushDuration.Add(duration.Nanoseconds())
+	logcore.StoreMax(&g.maxFlushDuration, duration.Nanoseconds())
+}
+
+// GetFlushWorkerStats returns the statistics of each flush worker, in worker order
+func (l *Logger) GetFlushWorkerStats() []FlushWorkerStats {
+	stats := make([]FlushWorkerStats, len(l.groups))
+	for i, g := range l.groups {
+		flushes, flushErrors := g.flushes.Load(), g.flushErrors.Load()
+		stats[i] = FlushWorkerStats{
+			Worker:           g.id,
+			Shards:           g.numShards,
+			Flushes:          flushes,
+			FlushErrors:      flushErrors,
+			MaxFlushDuration: time.Duration(g.maxFlushDuration.Load()),
+		}
+		if total := flushes + flushErrors; total > 0 {
+			stats[i].AvgFlushDuration = time.Duration(g.totalFlushDuration.Load() / total)
+		}
+	}
+	return stats
+}
@@ -0,0 +1,329 @@
+package asyncloguploader
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readSequences reads every message of a log file as a little-endian uint64 sequence number
+func readSequences(t *testing.T, path string) []uint64 {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var seqs []uint64
+	reader := NewReader(f)
+	for {
+		msg, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return seqs
+		}
+		require.NoError(t, err)
+		require.Len(t, msg, 8)
+		seqs = append(seqs, binary.LittleEndian.Uint64(msg))
+	}
+}
+
+func TestLogger_FlushConcurrency(t *testing.T) {
+	t.Run("ValidatesConfig", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		require.NoError(t, config.Validate())
+		assert.Equal(t, 1, config.FlushConcurrency)
+
+		config.FlushConcurrency = -1
+		assert.Error(t, config.Validate())
+
+		config.FlushConcurrency = 2
+		config.AllowChunking = true
+		assert.Error(t, config.Validate())
+	})
+
+	t.Run("SplitsShardsAndFileSegments", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		config := DefaultConfig(filepath.Join(tmpDir, "test.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 8
+		config.FlushConcurrency = 16 // Capped at NumShards
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		defer logger.Close()
+
+		require.Len(t, logger.groups, 8)
+		for i, g := range logger.groups {
+			require.Len(t, g.shards, 1)
+			assert.Equal(t, uint32(i), g.shards[0].ID())
+		}
+		assert.Equal(t, filepath.Join(tmpDir, "test.log"), segmentLogPath(config.LogFilePath, 0))
+		assert.Equal(t, filepath.Join(tmpDir, "test_w3.log"), segmentLogPath(config.LogFilePath, 3))
+	})
+
+	t.Run("KeepsPerShardOrder", func(t *testing.T) {
+		// One shard per worker, so each segment file holds exactly one shard's entries
+		tmpDir := t.TempDir()
+		config := DefaultConfig(filepath.Join(tmpDir, "order.log"))
+		config.BufferSize = 256 * 1024
+		config.NumShards = 4
+		config.FlushConcurrency = 4
+		config.FlushInterval = 10 * time.Millisecond
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+
+		// ~1.2MB of entries: every shard swaps and flushes several times
+		var msg [8]byte
+		for seq := uint64(1); seq <= 100000; seq++ {
+			binary.LittleEndian.PutUint64(msg[:], seq)
+			logger.LogBytes(msg[:])
+		}
+		paths := make([]string, len(logger.groups))
+		for i, g := range logger.groups {
+			paths[i] = g.fileWriter.(*SizeFileWriter).filePath
+		}
+		require.NoError(t, logger.Close())
+
+		stats := logger.Snapshot().Stats
+		var total int64
+		for i, path := range paths {
+			seqs := readSequences(t, path)
+			assert.True(t, sort.SliceIsSorted(seqs, func(a, b int) bool { return seqs[a] < seqs[b] }),
+				"segment %d is out of order", i)
+			total += int64(len(seqs))
+		}
+		assert.Equal(t, stats.TotalLogs-stats.DroppedLogs, total)
+	})
+
+	t.Run("SlowWorkerDoesNotStallOthers", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "stall.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 4
+		config.FlushConcurrency = 2
+		config.FlushInterval = time.Hour // Only explicit flushes
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		slow := newSlowFileWriter(logger.groups[1].fileWriter)
+		logger.groups[1].fileWriter = slow
+
+		for i := 0; i < 100; i++ {
+			logger.Log(fmt.Sprintf("entry %d", i))
+		}
+		go logger.Flush(context.Background())
+		select {
+		case <-slow.started:
+		case <-time.After(time.Second):
+			t.Fatal("worker 1 did not start writing")
+		}
+
+		// Worker 0 flushes its shards while worker 1 is stuck in its write
+		reply := make(chan error, 1)
+		logger.groups[0].flushReqs <- reply
+		select {
+		case err := <-reply:
+			require.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("worker 0 was stalled by worker 1")
+		}
+
+		workers := logger.GetFlushWorkerStats()
+		require.Len(t, workers, 2)
+		assert.Greater(t, workers[0].Flushes, int64(0))
+		assert.Equal(t, int64(0), workers[1].Flushes)
+
+		close(slow.release)
+		require.NoError(t, logger.Close())
+	})
+
+	t.Run("WorkerStatsMatchAggregate", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "stats.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 8
+		config.FlushConcurrency = 4
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+
+		msg := make([]byte, 200)
+		for i := 0; i < 20000; i++ {
+			logger.LogBytes(msg)
+		}
+		require.NoError(t, logger.Close())
+
+		stats := logger.Snapshot().Stats
+		var flushes int64
+		var maxDuration time.Duration
+		for _, w := range logger.GetFlushWorkerStats() {
+			assert.Equal(t, 2, w.Shards)
+			flushes += w.Flushes
+			maxDuration = max(maxDuration, w.MaxFlushDuration)
+		}
+		assert.Equal(t, stats.Flushes, flushes)
+		assert.Equal(t, time.Duration(stats.MaxFlushDuration), maxDuration)
+	})
+}
+
+// stallingFileWriter models a persistent disk: writes take 1ms plus 5ms per MB, and the write
+// that crosses each 64MB written stalls for 200ms
+type stallingFileWriter struct {
+	FileWriter
+	written int64
+}
+
+func (w *stallingFileWriter) WriteVectored(buffers [][]byte) (int, error) {
+	const stallEvery = 64 * 1024 * 1024
+	before := w.written
+	latency := time.Millisecond
+	for _, buf := range buffers {
+		w.written += int64(len(buf))
+		latency += time.Duration(len(buf)) * 5 * time.Millisecond / (1024 * 1024)
+	}
+	if w.written/stallEvery != before/stallEvery {
+		latency += 200 * time.Millisecond
+	}
+	time.Sleep(latency)
+	return w.FileWriter.WriteVectored(buffers)
+}
+
+// BenchmarkFlushConcurrency compares drop rate and p99 flush duration across flush worker counts
+// on a disk that stalls for 200ms once per 64MB written. Run with -benchtime 2000000x or more so
+// the load lasts through several stalls
+func BenchmarkFlushConcurrency(b *testing.B) {
+	for _, concurrency := range []int{1, 2, 4} {
+		b.Run(fmt.Sprintf("workers=%d", concurrency), func(b *testing.B) {
+			config := DefaultConfig(filepath.Join(b.TempDir(), "bench.log"))
+			config.BufferSize = 4 * 1024 * 1024
+			config.NumShards = 16
+			config.FlushConcurrency = concurrency
+
+			logger, err := NewLogger(config)
+			require.NoError(b, err)
+			for _, g := range logger.groups {
+				g.fileWriter = &stallingFileWriter{FileWriter: g.fileWriter}
+			}
+
+			var mu sync.Mutex
+			var durations []time.Duration
+			logger.SetFlushObserver(func(o FlushObservation) {
+				mu.Lock()
+				durations = append(durations, o.Duration)
+				mu.Unlock()
+			})
+
+			// Offer a fixed 64MB/s so drop rates are comparable; an unpaced writer saturates any disk
+			msg := make([]byte, 256)
+			const msgsPerMs = 64 * 1024 * 1024 / 256 / 1000
+			b.ResetTimer()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				logger.LogBytes(msg)
+				if i%msgsPerMs == 0 {
+					if ahead := time.Duration(i/msgsPerMs)*time.Millisecond - time.Since(start); ahead > 0 {
+						time.Sleep(ahead)
+					}
+				}
+			}
+			b.StopTimer()
+			require.NoError(b, logger.Close())
+
+			stats := logger.Snapshot().Stats
+			b.ReportMetric(float64(stats.DroppedLogs)/float64(stats.TotalLogs)*100, "drop%")
+			if len(durations) > 0 {
+				sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+				p99 := durations[(len(durations)*99)/100]
+				b.ReportMetric(float64(p99)/float64(time.Millisecond), "p99-flush-ms")
+			}
+		})
+	}
+}
+
+// flushTimesWriter records when each flush write happens
+type flushTimesWriter struct {
+	FileWriter
+	mu    sync.Mutex
+	times []time.Time
+}
+
+func (w *flushTimesWriter) WriteVectored(buffers [][]byte) (int, error) {
+	w.mu.Lock()
+	w.times = append(w.times, time.Now())
+	w.mu.Unlock()
+	return w.FileWriter.WriteVectored(buffers)
+}
+
+// maxGap returns the longest time between start, the recorded writes before end, and end
+func (w *flushTimesWriter) maxGap(start, end time.Time) time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var gap time.Duration
+	last := start
+	for _, t := range append(w.times, end) {
+		if t.After(end) {
+			t = end
+		}
+		gap = max(gap, t.Sub(last))
+		last = t
+	}
+	return gap
+}
+
+func TestLogger_SkewedTrafficFlushesEachInterval(t *testing.T) {
+	if testing.Short() {
+		t.Skip("load test")
+	}
+
+	// All traffic goes to one of 8 shards, so the threshold of 2 ready shards is never reached:
+	// the swapped-out buffer must still be flushed within a FlushInterval
+	tmpDir := t.TempDir()
+	config := DefaultConfig(filepath.Join(tmpDir, "skewed.log"))
+	config.BufferSize = 512 * 1024
+	config.NumShards = 8
+	config.ShardSelection = ShardSelectionKeyHash
+	config.FlushInterval = 50 * time.Millisecond
+	logger, err := NewLogger(config)
+	require.NoError(t, err)
+	writer := &flushTimesWriter{FileWriter: logger.groups[0].fileWriter}
+	logger.groups[0].fileWriter = writer
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var accepted [][]byte
+	start := time.Now()
+	end := start.Add(1500 * time.Millisecond)
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; time.Now().Before(end); i++ {
+				msg := []byte(fmt.Sprintf("writer %d message %064d", g, i))
+				if logger.TryLogBytesKeyed(7, msg) == nil {
+					mu.Lock()
+					accepted = append(accepted, msg)
+					mu.Unlock()
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	assert.Less(t, writer.maxGap(start, end), 500*time.Millisecond, "swapped shard waited for the threshold")
+	stats := logger.Snapshot().Stats
+	assert.Positive(t, stats.IntervalFlushes)
+	require.NoError(t, logger.Close())
+
+	messages, _ := readAllMessages(t, findLogFile(t, tmpDir, "skewed"))
+	assert.ElementsMatch(t, accepted, messages)
+}
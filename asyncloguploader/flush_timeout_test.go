@@ -0,0 +1,118 @@
+package asyncloguploader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stallWriter makes the writer of msg block mid-copy until release is closed
+// Returns a channel closed once that writer has reserved its space
+func stallWriter(t *testing.T, msg []byte) (reserved, release chan struct{}) {
+	reserved, release = make(chan struct{}), make(chan struct{})
+	writeCopyHook = func(p []byte) {
+		if bytes.Equal(p, msg) {
+			close(reserved)
+			<-release
+		}
+	}
+	t.Cleanup(func() { writeCopyHook = nil })
+	return reserved, release
+}
+
+func TestLogger_FlushTimeoutKeepsInFlightEntries(t *testing.T) {
+	for _, checksums := range []bool{false, true} {
+		t.Run(fmt.Sprintf("Checksums=%v", checksums), func(t *testing.T) {
+			logger, tmpDir := newSizeTestLogger(t, "timeout", func(c *Config) {
+				c.NumShards = 1
+				c.FlushTimeout = 20 * time.Millisecond
+				c.FlushInterval = time.Hour
+				c.EnableChecksums = checksums
+			})
+			stalled := bytes.Repeat([]byte{'s'}, 4096)
+			reserved, release := stallWriter(t, stalled)
+
+			before := logMessages(t, logger, "before", 10)
+			done := make(chan error, 1)
+			go func() { done <- logger.TryLogBytes(stalled) }()
+			<-reserved
+			after := logMessages(t, logger, "after", 10)
+
+			// The flush times out on the stalled write and writes only the entries ahead of it
+			require.NoError(t, logger.Flush(context.Background()))
+			path := findLogFile(t, tmpDir, "timeout")
+			onDisk, _ := readAllMessages(t, path)
+			assert.Equal(t, before, onDisk)
+			assert.Equal(t, int64(len(before)), logger.stats.EntriesFlushed.Load())
+			assert.Equal(t, payloadBytes(before), logger.stats.BytesDurable.Load())
+
+			// Once the writer finishes, the next flush writes it and the entries behind it
+			close(release)
+			require.NoError(t, <-done)
+			require.NoError(t, logger.Flush(context.Background()))
+			require.NoError(t, logger.Close())
+
+			want := append(append(append([][]byte{}, before...), stalled), after...)
+			onDisk, _ = readAllMessages(t, path)
+			assert.Equal(t, want, onDisk)
+
+			snap := logger.Snapshot()
+			assert.Equal(t, int64(len(want)), logger.stats.EntriesFlushed.Load())
+			assert.Equal(t, payloadBytes(want), snap.Stats.BytesDurable)
+			assert.Zero(t, logger.bufferedEntries())
+		})
+	}
+}
+
+func TestShard_PartialSeal(t *testing.T) {
+	shard, err := NewShard(64*1024, 0)
+	require.NoError(t, err)
+	defer shard.Close()
+
+	stalled := []byte("stalled")
+	reserved, release := stallWriter(t, stalled)
+
+	shard.Write([]byte("first"))
+	done := make(chan struct{})
+	go func() {
+		shard.Write(stalled)
+		close(done)
+	}()
+	<-reserved
+	shard.Write([]byte("third"))
+	shard.trySwap()
+
+	// Only the entry below the stalled reservation is committed
+	sealed, ok := shard.seal(5*time.Millisecond, false)
+	require.True(t, ok)
+	assert.False(t, sealed.complete)
+	assert.Equal(t, int32(lengthPrefixSize+len("first")), sealed.dataBytes)
+	assert.Equal(t, int64(1), sealed.entries)
+	assert.Equal(t, int64(len("first")), sealed.payload)
+	shard.resetBuffers([]*[]byte{sealed.buf})
+
+	// Still stalled: nothing new to seal, and the buffer keeps its entries
+	_, ok = shard.seal(5*time.Millisecond, false)
+	assert.False(t, ok)
+	assert.True(t, shard.HasData())
+
+	close(release)
+	<-done
+	sealed, ok = shard.seal(time.Second, false)
+	require.True(t, ok)
+	assert.True(t, sealed.complete)
+	assert.Equal(t, int64(2), sealed.entries)
+	assert.Equal(t, int64(len(stalled)+len("third")), sealed.payload)
+	assert.Equal(t, int32(2*lengthPrefixSize+len(stalled)+len("third")), sealed.dataBytes)
+	entries, _ := countEntries(sealed.data, headerOffset, headerOffset+sealed.dataBytes)
+	assert.Equal(t, int64(2), entries)
+	assert.Equal(t, stalled, sealed.data[headerOffset+lengthPrefixSize:headerOffset+lengthPrefixSize+int32(len(stalled))])
+
+	shard.resetBuffers([]*[]byte{sealed.buf})
+	assert.False(t, shard.HasData())
+}
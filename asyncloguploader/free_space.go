@@ -0,0 +1,195 @@
+package asyncloguploader
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// FreeSpaceLevel is the escalation level derived from available disk space
+type FreeSpaceLevel int32
+
+const (
+	FreeSpaceNormal      FreeSpaceLevel = iota // Enough space, normal operation
+	FreeSpaceWarn                              // Space is getting low, warning emitted
+	FreeSpaceNoPrealloc                        // New rotation files are not preallocated
+	FreeSpaceShrinkFiles                       // Subsequent rotations use ShrunkMaxFileSize
+	FreeSpaceDegraded                          // Logger rejects new logs before ENOSPC is hit
+
+	numFreeSpaceLevels = int(FreeSpaceDegraded) + 1
+)
+
+// String returns the level name
+func (l FreeSpaceLevel) String() string {
+	switch l {
+	case FreeSpaceNormal:
+		return "normal"
+	case FreeSpaceWarn:
+		return "warn"
+	case FreeSpaceNoPrealloc:
+		return "no_prealloc"
+	case FreeSpaceShrinkFiles:
+		return "shrink_files"
+	case FreeSpaceDegraded:
+		return "degraded"
+	default:
+		return fmt.Sprintf("unknown(%d)", int32(l))
+	}
+}
+
+// FreeSpaceStatus is a snapshot of the free-space monitor state
+type FreeSpaceStatus struct {
+	AvailableBytes uint64
+	TotalBytes     uint64
+	AvailablePct   float64
+	Level          FreeSpaceLevel
+	LastCheck      time.Time
+	LastError      error
+
+	// FreeSpaceEscalations counts transitions into each level (indexed by FreeSpaceLevel)
+	FreeSpaceEscalations [numFreeSpaceLevels]int64
+}
+
+// freeSpaceTarget receives level changes from the monitor
+// Implemented by file writers that support preallocation and size-based rotation
+type freeSpaceTarget interface {
+	setPreallocationEnabled(enabled bool)
+	setMaxFileSizeOverride(size int64)
+}
+
+// freeSpaceMonitor samples the log directory filesystem and escalates behavior as space runs out
+type freeSpaceMonitor struct {
+	config FreeSpaceConfig
+	dir    string
+
+	// Sampled values
+	availableBytes atomic.Uint64
+	totalBytes     atomic.Uint64
+	lastCheck      atomic.Int64 // Unix nanoseconds
+	lastErr        atomic.Pointer[error]
+
+	// Current escalation level and per-level escalation counters
+	level       atomic.Int32
+	escalations [numFreeSpaceLevels]atomic.Int64
+
+	// Called (from the sampling goroutine) when the level changes
+	onLevelChange func(oldLevel, newLevel FreeSpaceLevel)
+
+	done chan struct{}
+}
+
+// newFreeSpaceMonitor creates a monitor for the filesystem holding dir
+// config must already be validated
+func newFreeSpaceMonitor(config FreeSpaceConfig, dir string, onLevelChange func(oldLevel, newLevel FreeSpaceLevel)) *freeSpaceMonitor {
+	return &freeSpaceMonitor{
+		config:        config,
+		dir:           dir,
+		onLevelChange: onLevelChange,
+		done:          make(chan struct{}),
+	}
+}
+
+// start samples once synchronously, then keeps sampling in the background
+func (m *freeSpaceMonitor) start() {
+	m.sample()
+	go m.run()
+}
+
+// run samples free space every CheckInterval until stopped
+func (m *freeSpaceMonitor) run() {
+	ticker := time.NewTicker(m.config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.sample()
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// stop terminates the sampling goroutine
+func (m *freeSpaceMonitor) stop() {
+	close(m.done)
+}
+
+// sample performs one statfs and applies any resulting level change
+func (m *freeSpaceMonitor) sample() {
+	available, total, err := m.config.statfs(m.dir)
+	m.lastCheck.Store(time.Now().UnixNano())
+	if err != nil {
+		// Keep the previous level on error: a failed statfs says nothing about space
+		m.lastErr.Store(&err)
+		return
+	}
+	m.lastErr.Store(nil)
+	m.availableBytes.Store(available)
+	m.totalBytes.Store(total)
+
+	newLevel := m.levelFor(availablePct(available, total))
+	oldLevel := FreeSpaceLevel(m.level.Swap(int32(newLevel)))
+	if newLevel == oldLevel {
+		return
+	}
+
+	if newLevel > oldLevel {
+		m.escalations[newLevel].Add(1)
+	}
+	if m.onLevelChange != nil {
+		m.onLevelChange(oldLevel, newLevel)
+	}
+}
+
+// levelFor maps an available-space percentage to the highest triggered escalation level
+func (m *freeSpaceMonitor) levelFor(pct float64) FreeSpaceLevel {
+	switch {
+	case m.config.DegradeBelowPct > 0 && pct < m.config.DegradeBelowPct:
+		return FreeSpaceDegraded
+	case m.config.ShrinkFilesBelowPct > 0 && pct < m.config.ShrinkFilesBelowPct:
+		return FreeSpaceShrinkFiles
+	case m.config.NoPreallocBelowPct > 0 && pct < m.config.NoPreallocBelowPct:
+		return FreeSpaceNoPrealloc
+	case m.config.WarnBelowPct > 0 && pct < m.config.WarnBelowPct:
+		return FreeSpaceWarn
+	default:
+		return FreeSpaceNormal
+	}
+}
+
+// Level returns the current escalation level
+func (m *freeSpaceMonitor) Level() FreeSpaceLevel {
+	return FreeSpaceLevel(m.level.Load())
+}
+
+// status returns a snapshot of the monitor state
+func (m *freeSpaceMonitor) status() FreeSpaceStatus {
+	available := m.availableBytes.Load()
+	total := m.totalBytes.Load()
+
+	status := FreeSpaceStatus{
+		AvailableBytes: available,
+		TotalBytes:     total,
+		AvailablePct:   availablePct(available, total),
+		Level:          m.Level(),
+	}
+	if ts := m.lastCheck.Load(); ts > 0 {
+		status.LastCheck = time.Unix(0, ts)
+	}
+	if errPtr := m.lastErr.Load(); errPtr != nil {
+		status.LastError = *errPtr
+	}
+	for i := range m.escalations {
+		status.FreeSpaceEscalations[i] = m.escalations[i].Load()
+	}
+	return status
+}
+
+// availablePct returns available space as a percentage of total (100 when total is unknown)
+func availablePct(available, total uint64) float64 {
+	if total == 0 {
+		return 100.0
+	}
+	return float64(available) / float64(total) * 100.0
+}
@@ -0,0 +1,183 @@
+package asyncloguploader
+
+import (
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStatfs reports a controllable amount of free space out of 100GB
+type fakeStatfs struct {
+	availablePct atomic.Int64
+	fail         atomic.Bool
+}
+
+func (f *fakeStatfs) statfs(path string) (uint64, uint64, error) {
+	if f.fail.Load() {
+		return 0, 0, errors.New("statfs failed")
+	}
+	const total = 100 * 1024 * 1024 * 1024
+	return uint64(f.availablePct.Load()) * (total / 100), total, nil
+}
+
+func newFreeSpaceTestLogger(t *testing.T, fake *fakeStatfs) *Logger {
+	t.Helper()
+	fsConfig := DefaultFreeSpaceConfig()
+	fsConfig.CheckInterval = time.Hour // Samples are driven manually
+	fsConfig.ShrunkMaxFileSize = 1024 * 1024
+	fsConfig.statfs = fake.statfs
+
+	config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+	config.BufferSize = 1024 * 1024
+	config.NumShards = 4
+	config.MaxFileSize = 16 * 1024 * 1024
+	config.PreallocateFileSize = 16 * 1024 * 1024
+	config.FreeSpaceConfig = &fsConfig
+
+	logger, err := NewLogger(config)
+	require.NoError(t, err)
+	return logger
+}
+
+func TestFreeSpace_Escalation(t *testing.T) {
+	t.Run("WalksThresholdsAndDeEscalates", func(t *testing.T) {
+		fake := &fakeStatfs{}
+		fake.availablePct.Store(50)
+		logger := newFreeSpaceTestLogger(t, fake)
+		defer logger.Close()
+
+		fw := logger.groups[0].fileWriter.(*SizeFileWriter)
+
+		status, ok := logger.GetFreeSpaceStatus()
+		require.True(t, ok)
+		assert.Equal(t, FreeSpaceNormal, status.Level)
+		assert.InDelta(t, 50.0, status.AvailablePct, 0.01)
+		assert.False(t, fw.preallocDisabled.Load())
+		assert.Equal(t, int64(16*1024*1024), fw.effectiveMaxFileSize())
+
+		// Warn: only observable via status and counters
+		fake.availablePct.Store(18)
+		logger.freeSpace.sample()
+		status, _ = logger.GetFreeSpaceStatus()
+		assert.Equal(t, FreeSpaceWarn, status.Level)
+		assert.Equal(t, int64(1), status.FreeSpaceEscalations[FreeSpaceWarn])
+		assert.False(t, fw.preallocDisabled.Load())
+
+		// No preallocation for new rotations
+		fake.availablePct.Store(12)
+		logger.freeSpace.sample()
+		assert.True(t, fw.preallocDisabled.Load())
+		assert.Equal(t, int64(16*1024*1024), fw.effectiveMaxFileSize())
+
+		// Smaller files for subsequent rotations
+		fake.availablePct.Store(8)
+		logger.freeSpace.sample()
+		assert.Equal(t, int64(1024*1024), fw.effectiveMaxFileSize())
+		assert.False(t, logger.IsDegraded())
+
+		// Degraded: new logs are rejected
+		fake.availablePct.Store(3)
+		logger.freeSpace.sample()
+		assert.True(t, logger.IsDegraded())
+		logger.LogBytes([]byte("rejected"))
+		totalLogs, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
+		assert.Equal(t, int64(1), totalLogs)
+		assert.Equal(t, int64(1), droppedLogs)
+		assert.Equal(t, int64(1), logger.stats.FreeSpaceDrops.Load())
+
+		// Recovery restores normal behavior in one step
+		fake.availablePct.Store(60)
+		logger.freeSpace.sample()
+		status, _ = logger.GetFreeSpaceStatus()
+		assert.Equal(t, FreeSpaceNormal, status.Level)
+		assert.False(t, logger.IsDegraded())
+		assert.False(t, fw.preallocDisabled.Load())
+		assert.Equal(t, int64(16*1024*1024), fw.effectiveMaxFileSize())
+
+		logger.LogBytes([]byte("accepted"))
+		_, droppedLogs, _, _, _, _, _, _ = logger.GetStatsSnapshot()
+		assert.Equal(t, int64(1), droppedLogs)
+
+		// Each level was escalated into exactly once
+		for level := FreeSpaceWarn; level <= FreeSpaceDegraded; level++ {
+			assert.Equal(t, int64(1), status.FreeSpaceEscalations[level], "level %s", level)
+		}
+	})
+
+	t.Run("JumpsDirectlyToDegraded", func(t *testing.T) {
+		fake := &fakeStatfs{}
+		fake.availablePct.Store(1)
+		logger := newFreeSpaceTestLogger(t, fake)
+		defer logger.Close()
+
+		assert.True(t, logger.IsDegraded())
+		status, _ := logger.GetFreeSpaceStatus()
+		assert.Equal(t, int64(1), status.FreeSpaceEscalations[FreeSpaceDegraded])
+		assert.Equal(t, int64(0), status.FreeSpaceEscalations[FreeSpaceWarn])
+	})
+
+	t.Run("KeepsLevelOnStatfsError", func(t *testing.T) {
+		fake := &fakeStatfs{}
+		fake.availablePct.Store(8)
+		logger := newFreeSpaceTestLogger(t, fake)
+		defer logger.Close()
+
+		fake.fail.Store(true)
+		logger.freeSpace.sample()
+		status, _ := logger.GetFreeSpaceStatus()
+		assert.Equal(t, FreeSpaceShrinkFiles, status.Level)
+		assert.Error(t, status.LastError)
+	})
+
+	t.Run("DisabledStepIsSkipped", func(t *testing.T) {
+		fake := &fakeStatfs{}
+		fake.availablePct.Store(12)
+		fsConfig := DefaultFreeSpaceConfig()
+		fsConfig.CheckInterval = time.Hour
+		fsConfig.NoPreallocBelowPct = 0
+		fsConfig.statfs = fake.statfs
+
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 4
+		config.FreeSpaceConfig = &fsConfig
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		defer logger.Close()
+
+		status, _ := logger.GetFreeSpaceStatus()
+		assert.Equal(t, FreeSpaceWarn, status.Level)
+		assert.False(t, logger.groups[0].fileWriter.(*SizeFileWriter).preallocDisabled.Load())
+	})
+}
+
+func TestFreeSpace_NotConfigured(t *testing.T) {
+	config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+	config.BufferSize = 1024 * 1024
+	config.NumShards = 4
+
+	logger, err := NewLogger(config)
+	require.NoError(t, err)
+	defer logger.Close()
+
+	_, ok := logger.GetFreeSpaceStatus()
+	assert.False(t, ok)
+	assert.False(t, logger.IsDegraded())
+}
+
+func TestFreeSpaceConfig_Validate(t *testing.T) {
+	fsConfig := FreeSpaceConfig{WarnBelowPct: 120}
+	assert.Error(t, fsConfig.Validate())
+
+	fsConfig = FreeSpaceConfig{}
+	require.NoError(t, fsConfig.Validate())
+	assert.Equal(t, 5*time.Second, fsConfig.CheckInterval)
+	assert.Equal(t, int64(64*1024*1024), fsConfig.ShrunkMaxFileSize)
+	assert.NotNil(t, fsConfig.statfs)
+}
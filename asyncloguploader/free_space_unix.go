@@ -0,0 +1,18 @@
+//go:build !windows
+
+package asyncloguploader
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// statfsAvailable returns the bytes available to unprivileged users and the total size of the filesystem holding path
+func statfsAvailable(path string) (available, total uint64, err error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, 0, fmt.Errorf("statfs %s: %w", path, err)
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), uint64(st.Blocks) * uint64(st.Bsize), nil
+}
@@ -0,0 +1,22 @@
+//go:build windows
+
+package asyncloguploader
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+// statfsAvailable returns the bytes available to the caller and the total size of the volume holding path
+func statfsAvailable(path string) (available, total uint64, err error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("statfs %s: %w", path, err)
+	}
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(pathPtr, &available, &total, &free); err != nil {
+		return 0, 0, fmt.Errorf("statfs %s: %w", path, err)
+	}
+	return available, total, nil
+}
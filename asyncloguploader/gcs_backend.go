@@ -0,0 +1,124 @@
+package asyncloguploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+// gcsBackend uploads files to a GCS bucket; the Uploader composes large files from parallel chunks
+type gcsBackend struct {
+	client    *storage.Client
+	bucket    string
+	chunkSize int
+	chunkMgr  *ChunkManager
+}
+
+// NewGCSBackend creates the GCS backend used by NewUploader, with a gRPC connection pool of
+// config.GRPCPoolSize. config must be validated
+func NewGCSBackend(ctx context.Context, config GCSUploadConfig) (UploadBackend, error) {
+	// Create GCS client with gRPC pool
+	client, err := storage.NewClient(ctx,
+		option.WithGRPCConnectionPool(config.GRPCPoolSize),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %w", err)
+	}
+
+	chunkMgr := NewChunkManager(config.MaxChunksPerCompose)
+	chunkMgr.logger = config.InternalLogger
+	return &gcsBackend{
+		client:    client,
+		bucket:    config.Bucket,
+		chunkSize: config.ChunkSize,
+		chunkMgr:  chunkMgr,
+	}, nil
+}
+
+// Upload implements UploadBackend, streaming the file into one object
+// The Uploader uploads files above ParallelThreshold with UploadRange and Compose instead
+func (b *gcsBackend) Upload(ctx context.Context, localPath, objectName string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	return b.write(ctx, objectName, file, contentEncodingFor(objectName))
+}
+
+// UploadRange implements ComposingBackend
+func (b *gcsBackend) UploadRange(ctx context.Context, localPath, objectName string, offset, length int64) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	return b.write(ctx, objectName, io.NewSectionReader(file, offset, length), "")
+}
+
+// write streams r into objectName; the object only exists once the writer is closed
+func (b *gcsBackend) write(ctx context.Context, objectName string, r io.Reader, encoding string) error {
+	w := b.client.Bucket(b.bucket).Object(objectName).NewWriter(ctx)
+	w.ChunkSize = b.chunkSize
+	w.ContentType = "application/octet-stream"
+	w.ContentEncoding = encoding
+
+	if _, err := io.Copy(w, ThrottledReader(ctx, r)); err != nil {
+		w.Close()
+		return fmt.Errorf("write error: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("close error: %w", err)
+	}
+	return nil
+}
+
+// Compose implements ComposingBackend; compressed files also get their Content-Encoding
+// (compose only sets the content type)
+func (b *gcsBackend) Compose(ctx context.Context, objectName string, sources []string) error {
+	// The chunk manager handles the 32-chunk limit
+	if err := b.chunkMgr.Compose(ctx, b.client, b.bucket, objectName, sources); err != nil {
+		return err
+	}
+	if encoding := contentEncodingFor(objectName); encoding != "" {
+		update := storage.ObjectAttrsToUpdate{ContentEncoding: encoding}
+		if _, err := b.client.Bucket(b.bucket).Object(objectName).Update(ctx, update); err != nil {
+			return fmt.Errorf("failed to set content encoding: %w", err)
+		}
+	}
+	return nil
+}
+
+// Delete implements ComposingBackend
+func (b *gcsBackend) Delete(ctx context.Context, objectName string) error {
+	err := b.client.Bucket(b.bucket).Object(objectName).Delete(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Stat implements UploadBackend
+// GCS computes CRC32C for every object, including composed ones
+func (b *gcsBackend) Stat(ctx context.Context, objectName string) (ObjectInfo, error) {
+	attrs, err := b.client.Bucket(b.bucket).Object(objectName).Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Size: attrs.Size, CRC32C: attrs.CRC32C, HasCRC32C: true}, nil
+}
+
+// Close implements UploadBackend
+func (b *gcsBackend) Close() error {
+	return b.client.Close()
+}
@@ -0,0 +1,236 @@
+package asyncloguploader
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthState grades a logger for readiness probes
+type HealthState string
+
+const (
+	// HealthOK means every metric is below its Degraded threshold
+	HealthOK HealthState = "ok"
+
+	// HealthDegraded means a Degraded threshold is reached; logs are still being written
+	HealthDegraded HealthState = "degraded"
+
+	// HealthFailing means a Failing threshold is reached, or new logs are being rejected
+	HealthFailing HealthState = "failing"
+
+	// HealthClosed means the logger (or manager) is closed
+	HealthClosed HealthState = "closed"
+)
+
+// Ready reports whether the state passes a readiness probe (OK or Degraded)
+func (s HealthState) Ready() bool {
+	return s == HealthOK || s == HealthDegraded
+}
+
+// severity orders states from best to worst
+func (s HealthState) severity() int {
+	switch s {
+	case HealthOK:
+		return 0
+	case HealthDegraded:
+		return 1
+	case HealthFailing:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// HealthStatus answers "is logging healthy?" (see Logger.Health and LoggerManager.Health)
+type HealthStatus struct {
+	State   HealthState `json:"state"`
+	Reasons []string    `json:"reasons,omitempty"` // Why the state is not OK
+
+	// Logs and drops since the previous FlushInterval tick (one to two intervals back)
+	RecentLogs  int64   `json:"recent_logs"`
+	RecentDrops int64   `json:"recent_drops"`
+	DropRate    float64 `json:"drop_rate"` // RecentDrops / RecentLogs (0 without logs)
+
+	ConsecutiveFlushErrors int64         `json:"consecutive_flush_errors"`
+	FlushQueueDepth        int64         `json:"flush_queue_depth"`   // Shards queued for a flush, plus flushes in progress
+	FlushPending           bool          `json:"flush_pending"`       // Swapped-out or retained data waits to be flushed
+	SinceLastFlush         time.Duration `json:"since_last_flush_ns"` // Since the last successful flush (or creation)
+
+	// Uploads (only with Config.UploadTracker)
+	UploadBacklog     int       `json:"upload_backlog,omitempty"` // Files waiting for upload
+	LastUploadError   string    `json:"last_upload_error,omitempty"`
+	LastUploadErrorAt time.Time `json:"last_upload_error_at,omitzero"`
+
+	// Per-event status (LoggerManager only)
+	Events map[string]HealthStatus `json:"events,omitempty"`
+}
+
+// raise records reason and raises the state to state if that is worse
+func (s *HealthStatus) raise(state HealthState, reason string) {
+	if state.severity() > s.State.severity() {
+		s.State = state
+	}
+	s.Reasons = append(s.Reasons, reason)
+}
+
+// grade raises the state by value against a Degraded and a Failing threshold
+func (s *HealthStatus) grade(value, degraded, failing float64, reason func() string) {
+	switch {
+	case value >= failing:
+		s.raise(HealthFailing, reason())
+	case value >= degraded:
+		s.raise(HealthDegraded, reason())
+	}
+}
+
+// gradeUploads fills in the upload fields from tracker and grades them
+func (s *HealthStatus) gradeUploads(tracker *UploadTracker, limits HealthConfig) {
+	status := tracker.Status()
+	s.UploadBacklog = status.PendingFiles
+	if status.LastError != nil {
+		s.LastUploadError = status.LastError.Error()
+		s.LastUploadErrorAt = status.LastErrorAt
+	}
+	s.grade(float64(status.PendingFiles), float64(limits.DegradedUploadBacklog), float64(limits.FailingUploadBacklog), func() string {
+		return fmt.Sprintf("upload backlog %d files", status.PendingFiles)
+	})
+	if status.Failing() {
+		s.raise(HealthDegraded, fmt.Sprintf("last upload failed: %v", status.LastError))
+	}
+}
+
+// dropRate returns drops as a fraction of logs (0 without logs)
+func dropRate(logs, drops int64) float64 {
+	if logs <= 0 {
+		return 0
+	}
+	return float64(drops) / float64(logs)
+}
+
+// healthWindow holds TotalLogs and DroppedLogs at the last two FlushInterval ticks
+// Health reports the drop rate since the earlier one, so it always covers at least one full
+// interval once the logger has run that long
+type healthWindow struct {
+	mu      sync.Mutex
+	total   [2]int64 // [0] at the earlier tick
+	dropped [2]int64
+}
+
+// tick records the counters at a FlushInterval tick
+func (w *healthWindow) tick(total, dropped int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.total[0], w.dropped[0] = w.total[1], w.dropped[1]
+	w.total[1], w.dropped[1] = total, dropped
+}
+
+// since returns the logs and drops since the earlier tick
+func (w *healthWindow) since(total, dropped int64) (logs, drops int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return total - w.total[0], dropped - w.dropped[0]
+}
+
+// Health grades the logger against Config.HealthConfig, e.g. for a readiness probe (see HealthHandler)
+// Rejecting new logs (low disk space, disk full) makes the logger Failing. With Config.UploadTracker
+// the upload backlog is graded too, and a failed last upload makes the logger Degraded
+func (l *Logger) Health() HealthStatus {
+	return l.healthStatus(true)
+}
+
+// healthStatus builds the logger's status; uploads are left out for LoggerManager, which grades them once
+func (l *Logger) healthStatus(uploads bool) HealthStatus {
+	if l.life.Closed() {
+		return HealthStatus{State: HealthClosed}
+	}
+	limits := l.config.HealthConfig.withDefaults(time.Duration(l.flushInterval.Load()))
+
+	status := HealthStatus{State: HealthOK}
+	status.RecentLogs, status.RecentDrops = l.health.since(l.stats.TotalLogs.Load(), l.stats.DroppedLogs.Load())
+	status.DropRate = dropRate(status.RecentLogs, status.RecentDrops)
+	status.ConsecutiveFlushErrors = l.flushErrorsInRow.Load()
+	status.FlushQueueDepth = l.stats.FlushQueueDepth.Load()
+	for _, g := range l.groups {
+		status.FlushQueueDepth += int64(len(g.flushChan))
+	}
+	sc := l.shardCollection.Load()
+	status.FlushPending = sc.HasData() || sc.AnyShardFull() || l.retainingGroups.Load() > 0
+	status.SinceLastFlush = time.Since(time.Unix(0, l.lastFlushOK.Load()))
+
+	status.grade(status.DropRate, limits.DegradedDropRate, limits.FailingDropRate, func() string {
+		return fmt.Sprintf("%.1f%% of recent logs dropped", status.DropRate*100)
+	})
+	status.grade(float64(status.ConsecutiveFlushErrors), float64(limits.DegradedFlushErrors), float64(limits.FailingFlushErrors), func() string {
+		return fmt.Sprintf("%d consecutive flush errors", status.ConsecutiveFlushErrors)
+	})
+	if status.FlushPending {
+		status.grade(float64(status.SinceLastFlush), float64(limits.DegradedFlushAge), float64(limits.FailingFlushAge), func() string {
+			return fmt.Sprintf("no successful flush for %v", status.SinceLastFlush.Round(time.Millisecond))
+		})
+	}
+	if l.IsDiskFull() {
+		status.raise(HealthFailing, "disk full: new logs rejected")
+	} else if l.degraded.Load() {
+		status.raise(HealthFailing, "low disk space: new logs rejected")
+	}
+	if uploads && l.config.UploadTracker != nil {
+		status.gradeUploads(l.config.UploadTracker, limits)
+	}
+	return status
+}
+
+// Health aggregates the health of every event logger (in Events) for a readiness probe
+// The state is the worst event state, or the upload grading of the shared Config.UploadTracker if
+// that is worse; reasons are prefixed with their event. Recent logs and drops are summed, the drop
+// rate is recomputed from the sums, and flush errors in a row and time since the last flush are
+// the worst across events. A manager without event loggers is OK
+func (lm *LoggerManager) Health() HealthStatus {
+	if lm.closed.Load() {
+		return HealthStatus{State: HealthClosed}
+	}
+	status := HealthStatus{State: HealthOK, Events: make(map[string]HealthStatus)}
+	lm.rangeUserLoggers(func(eventName string, logger *Logger) bool {
+		event := logger.healthStatus(false)
+		if event.State == HealthClosed {
+			return true // Evicted or closed meanwhile
+		}
+		for _, reason := range event.Reasons {
+			status.raise(event.State, eventName+": "+reason)
+		}
+		status.Events[eventName] = event
+
+		status.RecentLogs += event.RecentLogs
+		status.RecentDrops += event.RecentDrops
+		status.ConsecutiveFlushErrors = max(status.ConsecutiveFlushErrors, event.ConsecutiveFlushErrors)
+		status.FlushQueueDepth += event.FlushQueueDepth
+		status.FlushPending = status.FlushPending || event.FlushPending
+		status.SinceLastFlush = max(status.SinceLastFlush, event.SinceLastFlush)
+		return true
+	})
+	status.DropRate = dropRate(status.RecentLogs, status.RecentDrops)
+	if lm.config.UploadTracker != nil {
+		status.gradeUploads(lm.config.UploadTracker, lm.config.HealthConfig.withDefaults(lm.config.FlushInterval))
+	}
+	return status
+}
+
+// HealthHandler returns an HTTP handler that reports health() as JSON, with status 200 while the
+// state is Ready and 503 otherwise. Pass Logger.Health or LoggerManager.Health:
+//
+//	http.Handle("/healthz", asyncloguploader.HealthHandler(logger.Health))
+func HealthHandler(health func() HealthStatus) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := health()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if status.State.Ready() {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	})
+}
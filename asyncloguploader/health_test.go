@@ -0,0 +1,261 @@
+package asyncloguploader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stalledWriter wraps a file writer and holds every write until release is closed
+type stalledWriter struct {
+	FileWriter
+	release chan struct{}
+}
+
+func (w *stalledWriter) WriteVectored(buffers [][]byte) (int, error) {
+	<-w.release
+	return w.FileWriter.WriteVectored(buffers)
+}
+
+// hasReason reports whether one of status's reasons contains substr
+func hasReason(status HealthStatus, substr string) bool {
+	for _, reason := range status.Reasons {
+		if strings.Contains(reason, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLogger_Health(t *testing.T) {
+	t.Run("OKWhenIdle", func(t *testing.T) {
+		logger, _ := newSizeTestLogger(t, "idle", nil)
+		logMessages(t, logger, "fine", 10)
+
+		status := logger.Health()
+		assert.Equal(t, HealthOK, status.State)
+		assert.True(t, status.State.Ready())
+		assert.Empty(t, status.Reasons)
+		assert.Equal(t, int64(10), status.RecentLogs)
+		assert.Zero(t, status.DropRate)
+
+		require.NoError(t, logger.Close())
+		assert.Equal(t, HealthClosed, logger.Health().State)
+		assert.False(t, logger.Health().State.Ready())
+	})
+
+	t.Run("DropsAndStalledFlushes", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "stalled.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 4
+		config.FlushInterval = 20 * time.Millisecond
+		config.WriteRetryTimeout = 0
+		config.InternalLogger = &captureLogger{}
+		config.HealthConfig = HealthConfig{DegradedFlushAge: 100 * time.Millisecond, FailingFlushAge: 300 * time.Millisecond}
+		require.NoError(t, config.Validate())
+		fileWriter, err := NewSizeFileWriter(config, nil)
+		require.NoError(t, err)
+		writer := &stalledWriter{FileWriter: fileWriter, release: make(chan struct{})}
+		logger, err := NewLoggerWithWriter(config, writer)
+		require.NoError(t, err)
+
+		// Both buffers of every shard fill while the first flush is stuck, so later logs drop
+		msg := make([]byte, 4096)
+		for i := 0; i < 700; i++ {
+			logger.TryLogBytes(msg)
+		}
+		status := logger.Health()
+		assert.Equal(t, HealthDegraded, status.State)
+		assert.Greater(t, status.RecentDrops, int64(0))
+		assert.Greater(t, status.DropRate, 0.01)
+		assert.True(t, hasReason(status, "recent logs dropped"), status.Reasons)
+		assert.True(t, status.FlushPending)
+		assert.Greater(t, status.FlushQueueDepth, int64(0))
+
+		// Nothing reaches the disk: the flush age crosses the Failing threshold
+		require.Eventually(t, func() bool {
+			return logger.Health().State == HealthFailing
+		}, 5*time.Second, 10*time.Millisecond)
+		status = logger.Health()
+		assert.True(t, hasReason(status, "no successful flush"), status.Reasons)
+		assert.GreaterOrEqual(t, status.SinceLastFlush, 300*time.Millisecond)
+
+		// Writes resume: flushes succeed and the drops age out of the window
+		close(writer.release)
+		require.Eventually(t, func() bool {
+			return logger.Health().State == HealthOK
+		}, 5*time.Second, 10*time.Millisecond)
+		require.NoError(t, logger.Close())
+	})
+
+	t.Run("ConsecutiveFlushErrors", func(t *testing.T) {
+		logger, writer, _, _ := newDiskFullTestLogger(t, func(c *Config) {
+			c.FlushInterval = time.Hour
+		})
+		defer logger.Close()
+		writer.setErr(fmt.Errorf("vectored I/O write failed: %w", syscall.EIO))
+
+		logMessages(t, logger, "lost", 5)
+		assert.Error(t, logger.Flush(context.Background()))
+		status := logger.Health()
+		assert.Equal(t, HealthDegraded, status.State)
+		assert.Equal(t, int64(1), status.ConsecutiveFlushErrors)
+
+		for i := 0; i < 2; i++ {
+			logMessages(t, logger, "lost", 5)
+			assert.Error(t, logger.Flush(context.Background()))
+		}
+		status = logger.Health()
+		assert.Equal(t, HealthFailing, status.State)
+		assert.Equal(t, int64(3), status.ConsecutiveFlushErrors)
+		assert.True(t, hasReason(status, "3 consecutive flush errors"), status.Reasons)
+
+		// One successful flush clears the streak
+		writer.setErr(nil)
+		logMessages(t, logger, "kept", 5)
+		require.NoError(t, logger.Flush(context.Background()))
+		status = logger.Health()
+		assert.Equal(t, HealthOK, status.State, status.Reasons)
+		assert.Zero(t, status.ConsecutiveFlushErrors)
+		assert.Less(t, status.SinceLastFlush, time.Second)
+	})
+
+	t.Run("DiskFull", func(t *testing.T) {
+		logger, writer, _, _ := newDiskFullTestLogger(t, nil)
+		defer logger.Close()
+		logMessages(t, logger, "retained", 5)
+		writer.setErr(enospc)
+		assert.Error(t, logger.Flush(context.Background()))
+
+		status := logger.Health()
+		assert.Equal(t, HealthFailing, status.State)
+		assert.True(t, hasReason(status, "disk full"), status.Reasons)
+		assert.True(t, status.FlushPending)
+
+		writer.setErr(nil)
+		require.Eventually(t, func() bool {
+			return logger.Health().State == HealthOK
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Uploads", func(t *testing.T) {
+		tracker := NewUploadTracker()
+		logger, _ := newSizeTestLogger(t, "uploads", func(c *Config) {
+			c.UploadTracker = tracker
+			c.HealthConfig = HealthConfig{DegradedUploadBacklog: 2, FailingUploadBacklog: 4}
+		})
+		defer logger.Close()
+		assert.Equal(t, HealthOK, logger.Health().State)
+
+		tracker.queued("a.log")
+		tracker.queued("b.log")
+		status := logger.Health()
+		assert.Equal(t, HealthDegraded, status.State)
+		assert.Equal(t, 2, status.UploadBacklog)
+
+		tracker.queued("c.log")
+		tracker.queued("d.log")
+		assert.Equal(t, HealthFailing, logger.Health().State)
+
+		// Backlog cleared, but the last attempt failed
+		for _, path := range []string{"a.log", "b.log", "c.log", "d.log"} {
+			tracker.done(path)
+		}
+		tracker.attempted(errors.New("bucket unreachable"))
+		status = logger.Health()
+		assert.Equal(t, HealthDegraded, status.State)
+		assert.Equal(t, "bucket unreachable", status.LastUploadError)
+		assert.False(t, status.LastUploadErrorAt.IsZero())
+
+		// The error is kept for reference once uploads succeed again
+		tracker.attempted(nil)
+		status = logger.Health()
+		assert.Equal(t, HealthOK, status.State)
+		assert.Equal(t, "bucket unreachable", status.LastUploadError)
+	})
+}
+
+func TestLoggerManager_Health(t *testing.T) {
+	tracker := NewUploadTracker()
+	config := newGuardTestConfig(t)
+	config.UploadTracker = tracker
+	manager, err := NewLoggerManager(config)
+	require.NoError(t, err)
+
+	assert.Equal(t, HealthOK, manager.Health().State)
+	manager.LogWithEvent("payment", "12345")
+	manager.LogWithEvent("login", "abc")
+
+	status := manager.Health()
+	assert.Equal(t, HealthOK, status.State)
+	require.Len(t, status.Events, 2)
+	assert.Equal(t, HealthOK, status.Events["payment"].State)
+	assert.Equal(t, int64(2), status.RecentLogs)
+
+	// Uploads are graded once for the shared tracker, not per event
+	tracker.attempted(errors.New("bucket unreachable"))
+	status = manager.Health()
+	assert.Equal(t, HealthDegraded, status.State)
+	assert.Equal(t, []string{"last upload failed: bucket unreachable"}, status.Reasons)
+	assert.Equal(t, HealthOK, status.Events["login"].State)
+	assert.Empty(t, status.Events["login"].LastUploadError)
+
+	require.NoError(t, manager.Close())
+	assert.Equal(t, HealthClosed, manager.Health().State)
+}
+
+func TestHealthHandler(t *testing.T) {
+	for _, tc := range []struct {
+		state HealthState
+		code  int
+	}{
+		{HealthOK, http.StatusOK},
+		{HealthDegraded, http.StatusOK},
+		{HealthFailing, http.StatusServiceUnavailable},
+		{HealthClosed, http.StatusServiceUnavailable},
+	} {
+		t.Run(string(tc.state), func(t *testing.T) {
+			handler := HealthHandler(func() HealthStatus {
+				return HealthStatus{State: tc.state, Reasons: []string{"because"}, DropRate: 0.25}
+			})
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+			assert.Equal(t, tc.code, recorder.Code)
+			assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+			var body map[string]any
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+			assert.Equal(t, string(tc.state), body["state"])
+			assert.Equal(t, 0.25, body["drop_rate"])
+			assert.NotContains(t, body, "last_upload_error_at")
+		})
+	}
+}
+
+func TestHealthConfig_Validate(t *testing.T) {
+	valid := HealthConfig{DegradedDropRate: 0.1, FailingDropRate: 0.2}
+	assert.NoError(t, valid.Validate())
+
+	for name, config := range map[string]HealthConfig{
+		"NegativeThreshold":     {DegradedFlushErrors: -1},
+		"DropRateAboveOne":      {FailingDropRate: 2},
+		"DegradedAboveFailing":  {DegradedFlushErrors: 5, FailingFlushErrors: 2},
+		"DegradedAboveDefault":  {DegradedUploadBacklog: 5000},
+		"DegradedAgeAboveFails": {DegradedFlushAge: time.Minute, FailingFlushAge: time.Second},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, config.Validate())
+		})
+	}
+}
@@ -25,7 +25,7 @@ func findLogFile(t *testing.T, dir, baseName string) string {
 			continue
 		}
 		name := entry.Name()
-		// Match pattern: baseName_YYYY-MM-DD_HH-MM-SS.log
+		// Match pattern: baseName_YYYY-MM-DD_HH-MM-SS-mmm_N.log
 		if strings.HasPrefix(name, baseName+"_") && strings.HasSuffix(name, ".log") {
 			return filepath.Join(dir, name)
 		}
@@ -67,7 +67,7 @@ func TestLogger_FileIntegrity_EndToEnd(t *testing.T) {
 	actualFile := findLogFile(t, tmpDir, "integrity_test")
 	if actualFile == "" {
 		// File might not exist if no flush occurred - check if data was written
-		totalLogs, _, bytesWritten, flushes, _, _ := logger.GetStatsSnapshot()
+		totalLogs, _, bytesWritten, flushes, _, _, _, _ := logger.GetStatsSnapshot()
 		if totalLogs == 0 || bytesWritten == 0 {
 			t.Fatalf("No data was written - TotalLogs: %d, BytesWritten: %d", totalLogs, bytesWritten)
 		}
@@ -85,7 +85,7 @@ func TestLogger_FileIntegrity_EndToEnd(t *testing.T) {
 	
 	if len(data) == 0 {
 		// File is empty - check if there were any flush errors
-		totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, _ := logger.GetStatsSnapshot()
+		totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, _, _, _ := logger.GetStatsSnapshot()
 		t.Fatalf("File is empty! Stats: TotalLogs=%d, DroppedLogs=%d, BytesWritten=%d, Flushes=%d, FlushErrors=%d",
 			totalLogs, droppedLogs, bytesWritten, flushes, flushErrors)
 	}
@@ -103,7 +103,7 @@ func TestLogger_FileIntegrity_EndToEnd(t *testing.T) {
 
 	// Parse file format and verify messages
 	// File format: [8-byte shard header][4-byte length][data][4-byte length][data]... [next shard header]...
-	offset := 0
+	offset := shardDataStart(data)
 	foundMessages := make(map[string]bool)
 	shardCount := 0
 	
@@ -174,6 +174,14 @@ func TestLogger_FileIntegrity_EndToEnd(t *testing.T) {
 	verifyFileFormat(t, data)
 }
 
+// shardDataStart returns the offset of the first shard in data, after the file header if any
+func shardDataStart(data []byte) int {
+	if h, ok := decodeFileHeader(data); ok {
+		return h.Size
+	}
+	return 0
+}
+
 // verifyFileFormat verifies the file format structure
 func verifyFileFormat(t *testing.T, data []byte) {
 	if len(data) < 8 {
@@ -181,7 +189,7 @@ func verifyFileFormat(t *testing.T, data []byte) {
 		return
 	}
 
-	offset := 0
+	offset := shardDataStart(data)
 	shardCount := 0
 
 	for offset < len(data) {
@@ -285,7 +293,7 @@ func TestLogger_ConcurrentWrites_FileIntegrity(t *testing.T) {
 	// Wait for flush to complete
 	deadline := time.Now().Add(2 * time.Second)
 	for time.Now().Before(deadline) {
-		_, _, bytesWritten, flushes, _, _ := logger.GetStatsSnapshot()
+		_, _, bytesWritten, flushes, _, _, _, _ := logger.GetStatsSnapshot()
 		if bytesWritten > 0 && flushes > 0 {
 			time.Sleep(100 * time.Millisecond)
 			break
@@ -300,7 +308,7 @@ func TestLogger_ConcurrentWrites_FileIntegrity(t *testing.T) {
 	actualFile := findLogFile(t, tmpDir, "concurrent_test")
 	if actualFile == "" {
 		// Check if data was written
-		totalLogs, _, bytesWritten, _, _, _ := logger.GetStatsSnapshot()
+		totalLogs, _, bytesWritten, _, _, _, _, _ := logger.GetStatsSnapshot()
 		if totalLogs == 0 || bytesWritten == 0 {
 			t.Fatal("No data was written")
 		}
@@ -413,7 +421,7 @@ func TestLogger_DataCorrectness(t *testing.T) {
 	// Wait for flush to complete
 	deadline := time.Now().Add(2 * time.Second)
 	for time.Now().Before(deadline) {
-		_, _, bytesWritten, flushes, _, _ := logger.GetStatsSnapshot()
+		_, _, bytesWritten, flushes, _, _, _, _ := logger.GetStatsSnapshot()
 		if bytesWritten > 0 && flushes > 0 {
 			time.Sleep(100 * time.Millisecond)
 			break
@@ -428,7 +436,7 @@ func TestLogger_DataCorrectness(t *testing.T) {
 	actualFile := findLogFile(t, tmpDir, "correctness_test")
 	if actualFile == "" {
 		// Check if data was written
-		totalLogs, _, bytesWritten, _, _, _ := logger.GetStatsSnapshot()
+		totalLogs, _, bytesWritten, _, _, _, _, _ := logger.GetStatsSnapshot()
 		if totalLogs == 0 || bytesWritten == 0 {
 			t.Fatal("No data was written")
 		}
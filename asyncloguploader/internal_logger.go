@@ -0,0 +1,77 @@
+package asyncloguploader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// InternalLogger receives the package's own diagnostics (flush errors, partial flushes, free-space,
+// rotation and upload warnings). Messages start with a bracketed tag ("[WARNING] ...", "[FLUSH_ERROR] ...")
+// and have no trailing newline. *log.Logger satisfies it; NewSlogInternalLogger adapts log/slog
+type InternalLogger interface {
+	Printf(format string, args ...any)
+}
+
+// defaultInternalLogger writes diagnostics to stderr with the standard log flags
+var defaultInternalLogger InternalLogger = log.New(os.Stderr, "", log.LstdFlags)
+
+// internalLoggerOrDefault returns l, or the stderr logger when l is nil (unvalidated configs)
+func internalLoggerOrDefault(l InternalLogger) InternalLogger {
+	if l == nil {
+		return defaultInternalLogger
+	}
+	return l
+}
+
+// slogInternalLogger sends diagnostics to a slog.Logger
+type slogInternalLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogInternalLogger returns an InternalLogger that writes to logger (e.g. a JSON handler)
+// The leading tag selects the level ([DEBUG] debug, [WARNING] warn, [ERROR]/[FLUSH_ERROR] error,
+// otherwise info) and is passed as the "tag" attribute instead of being part of the message
+func NewSlogInternalLogger(logger *slog.Logger) InternalLogger {
+	return slogInternalLogger{logger: logger}
+}
+
+// Printf implements InternalLogger
+func (s slogInternalLogger) Printf(format string, args ...any) {
+	tag, msg := splitTag(fmt.Sprintf(format, args...))
+	if tag == "" {
+		s.logger.Log(context.Background(), slog.LevelInfo, msg)
+		return
+	}
+	s.logger.Log(context.Background(), tagLevel(tag), msg, "tag", tag)
+}
+
+// splitTag splits "[TAG] message" into its tag and message
+func splitTag(msg string) (tag, rest string) {
+	msg = strings.TrimSuffix(msg, "\n")
+	if !strings.HasPrefix(msg, "[") {
+		return "", msg
+	}
+	end := strings.Index(msg, "]")
+	if end < 0 {
+		return "", msg
+	}
+	return msg[1:end], strings.TrimSpace(msg[end+1:])
+}
+
+// tagLevel maps a diagnostic tag to a slog level
+func tagLevel(tag string) slog.Level {
+	switch tag {
+	case "DEBUG":
+		return slog.LevelDebug
+	case "WARNING":
+		return slog.LevelWarn
+	case "ERROR", "FLUSH_ERROR":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
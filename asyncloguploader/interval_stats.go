@@ -0,0 +1,103 @@
+package asyncloguploader
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IntervalStats holds the statistics accumulated between two GetIntervalStats calls
+// Counters in Stats are deltas and Max* fields are the maxima seen during the interval;
+// FlushQueueDepth is a gauge and holds its current value. Consecutive intervals add up to the
+// lifetime counters: every sample is counted in exactly one interval
+type IntervalStats struct {
+	Start    time.Time     // End of the previous interval (or when the logger was created)
+	Duration time.Duration // Length of the interval
+
+	Stats        StatsSnapshot
+	FlushMetrics FlushMetrics // Derived from Stats
+}
+
+// intervalState is where the current interval started
+type intervalState struct {
+	mu    sync.Mutex
+	start time.Time
+	base  StatsSnapshot // Lifetime counters at start
+}
+
+// intervalMaxima hold the Max* durations of the current interval, reset when it ends
+// They are raised alongside the lifetime maxima in Statistics
+type intervalMaxima struct {
+	flush      atomic.Int64
+	write      atomic.Int64
+	pwritev    atomic.Int64
+	submit     atomic.Int64
+	completion atomic.Int64
+}
+
+// take moves the interval maxima into s and resets them for the next interval
+func (m *intervalMaxima) take(s *StatsSnapshot) {
+	s.MaxFlushDuration = m.flush.Swap(0)
+	s.MaxWriteDuration = m.write.Swap(0)
+	s.MaxPwritevDuration = m.pwritev.Swap(0)
+	s.MaxSubmitDuration = m.submit.Swap(0)
+	s.MaxCompletionDuration = m.completion.Swap(0)
+}
+
+// GetIntervalStats returns the statistics accumulated since the previous call (or since the
+// logger was created) and starts a new interval. Lifetime counters (GetStatsSnapshot, Snapshot)
+// are not affected. A flush that completes during the call may have its maximum reported in
+// this interval and its counters in the next
+func (l *Logger) GetIntervalStats() IntervalStats {
+	l.interval.mu.Lock()
+	defer l.interval.mu.Unlock()
+
+	now := time.Now()
+	current := l.loadStats()
+	stats := subStats(current, l.interval.base)
+	l.stats.interval.take(&stats)
+
+	result := IntervalStats{
+		Start:        l.interval.start,
+		Duration:     now.Sub(l.interval.start),
+		Stats:        stats,
+		FlushMetrics: flushMetricsFrom(stats),
+	}
+	l.interval.start = now
+	l.interval.base = current
+	return result
+}
+
+// GetAggregatedIntervalStats returns the statistics accumulated across all event loggers since
+// the previous call (see Logger.GetIntervalStats). Logs refused by event guardrails and the last
+// interval of evicted loggers are included. It ends the interval of every event logger, so
+// per-event intervals should not be read from the same loggers
+func (lm *LoggerManager) GetAggregatedIntervalStats() IntervalStats {
+	// Exclusive: eviction moves a logger's last interval into retiredInterval under this lock
+	lm.retiredMu.Lock()
+	defer lm.retiredMu.Unlock()
+
+	now := time.Now()
+	stats := lm.retiredInterval
+	lm.retiredInterval = StatsSnapshot{}
+
+	rejected, capped := lm.GetEventRejectStats()
+	refused := rejected + capped
+	stats.TotalLogs += refused - lm.intervalRefused
+	stats.DroppedLogs += refused - lm.intervalRefused
+	lm.intervalRefused = refused
+
+	lm.rangeUserLoggers(func(eventName string, logger *Logger) bool {
+		addStats(&stats, logger.GetIntervalStats().Stats)
+		return true
+	})
+
+	result := IntervalStats{
+		Start:        lm.intervalStart,
+		Duration:     now.Sub(lm.intervalStart),
+		Stats:        stats,
+		FlushMetrics: flushMetricsFrom(stats),
+	}
+	lm.intervalStart = now
+	return result
+}
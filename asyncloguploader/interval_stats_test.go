@@ -0,0 +1,142 @@
+package asyncloguploader
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger_GetIntervalStats(t *testing.T) {
+	newIntervalLogger := func(t *testing.T, flushInterval time.Duration) *Logger {
+		t.Helper()
+		config := DefaultConfig(filepath.Join(t.TempDir(), "interval.log"))
+		config.BufferSize = 256 * 1024
+		config.NumShards = 2
+		config.FlushInterval = flushInterval
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		t.Cleanup(func() { logger.Close() })
+		return logger
+	}
+
+	t.Run("ReturnsDeltasAndKeepsLifetimeTotals", func(t *testing.T) {
+		logger := newIntervalLogger(t, time.Hour)
+		for i := 0; i < 5; i++ {
+			logger.Log("first")
+		}
+		first := logger.GetIntervalStats()
+		assert.Equal(t, int64(5), first.Stats.TotalLogs)
+
+		for i := 0; i < 3; i++ {
+			logger.Log("second")
+		}
+		second := logger.GetIntervalStats()
+		assert.Equal(t, int64(3), second.Stats.TotalLogs)
+		assert.WithinDuration(t, first.Start.Add(first.Duration), second.Start, time.Microsecond)
+
+		totalLogs, _, _, _, _, _, _, _ := logger.GetStatsSnapshot()
+		assert.Equal(t, int64(8), totalLogs)
+	})
+
+	t.Run("MaxDurationsResetEachInterval", func(t *testing.T) {
+		logger := newIntervalLogger(t, time.Hour)
+		logger.Log("flushed")
+		require.NoError(t, logger.Flush(context.Background()))
+		require.Positive(t, logger.GetIntervalStats().Stats.MaxFlushDuration)
+
+		idle := logger.GetIntervalStats()
+		assert.Zero(t, idle.Stats.MaxFlushDuration)
+		assert.Zero(t, idle.Stats.MaxWriteDuration)
+		assert.Zero(t, idle.Stats.Flushes)
+		assert.Positive(t, logger.loadStats().MaxFlushDuration, "lifetime maximum is kept")
+	})
+
+	t.Run("NoSamplesLostOrDoubleCountedUnderLoad", func(t *testing.T) {
+		const writers = 4
+		const logsPerWriter = 5000
+		logger := newIntervalLogger(t, 5*time.Millisecond)
+
+		var sum StatsSnapshot
+		stop := make(chan struct{})
+		readerDone := make(chan struct{})
+		go func() {
+			defer close(readerDone)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				addStats(&sum, logger.GetIntervalStats().Stats)
+			}
+		}()
+
+		var wg sync.WaitGroup
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < logsPerWriter; i++ {
+					logger.Log(fmt.Sprintf("writer %d message %d", w, i))
+					if i%500 == 0 {
+						logger.Flush(context.Background())
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+		require.NoError(t, logger.Flush(context.Background()))
+		close(stop)
+		<-readerDone
+		addStats(&sum, logger.GetIntervalStats().Stats)
+
+		lifetime := logger.loadStats()
+		assert.Equal(t, int64(writers*logsPerWriter), sum.TotalLogs)
+		assert.Equal(t, lifetime.TotalLogs, sum.TotalLogs)
+		assert.Equal(t, lifetime.DroppedLogs, sum.DroppedLogs)
+		assert.Equal(t, lifetime.BytesWritten, sum.BytesWritten)
+		assert.Equal(t, lifetime.BytesFlushed, sum.BytesFlushed)
+		assert.Equal(t, lifetime.Flushes, sum.Flushes)
+		assert.Equal(t, lifetime.TotalFlushDuration, sum.TotalFlushDuration)
+		assert.Equal(t, lifetime.MaxFlushDuration, sum.MaxFlushDuration)
+	})
+}
+
+func TestLoggerManager_GetAggregatedIntervalStats(t *testing.T) {
+	config := newGuardTestConfig(t)
+	config.MaxEventLoggers = 2
+	config.MaxEventLoggersPolicy = MaxEventLoggersEvictLRU
+	config.AllowedEvents = []string{"a", "b", "c"}
+
+	manager, err := NewLoggerManager(config)
+	require.NoError(t, err)
+	defer manager.Close()
+
+	manager.LogWithEvent("a", "first")
+	manager.LogWithEvent("b", "first")
+	first := manager.GetAggregatedIntervalStats()
+	assert.Equal(t, int64(2), first.Stats.TotalLogs)
+
+	// "a" is evicted with one log in the current interval; the refused event counts as a drop
+	manager.LogWithEvent("a", "second")
+	time.Sleep(time.Millisecond)
+	manager.LogWithEvent("b", "second")
+	manager.LogWithEvent("c", "evicts a")
+	manager.LogWithEvent("unknown", "refused")
+	require.Equal(t, int64(1), manager.GetEventLoggerEvictions())
+
+	second := manager.GetAggregatedIntervalStats()
+	assert.Equal(t, int64(4), second.Stats.TotalLogs)
+	assert.Equal(t, int64(1), second.Stats.DroppedLogs)
+
+	assert.Zero(t, manager.GetAggregatedIntervalStats().Stats.TotalLogs)
+	totalLogs, _, _, _, _, _, _, _ := manager.GetAggregatedStats()
+	assert.Equal(t, first.Stats.TotalLogs+second.Stats.TotalLogs, totalLogs)
+}
@@ -0,0 +1,483 @@
+//go:build linux
+
+package asyncloguploader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// io_uring ABI constants (from include/uapi/linux/io_uring.h)
+const (
+	ioringOffSQRing = 0
+	ioringOffCQRing = 0x8000000
+	ioringOffSQEs   = 0x10000000
+
+	ioringOpWritev     = 2
+	ioringOpFsync      = 3
+	ioringOpWriteFixed = 5
+
+	ioringFsyncDatasync = 1 << 0
+
+	iosqeIODrain = 1 << 1
+
+	ioringEnterGetEvents = 1 << 0
+
+	ioringRegisterBuffers   = 0
+	ioringUnregisterBuffers = 1
+
+	ioringFeatSingleMmap = 1 << 0
+
+	// fsyncUserData tags the fdatasync SQE so its completion is not mistaken for a write
+	fsyncUserData = ^uint64(0)
+)
+
+// ErrIOUringUnsupported is returned when the kernel does not provide io_uring (or it is disabled)
+var ErrIOUringUnsupported = errors.New("io_uring is not supported by this kernel")
+
+// ioUringParams mirrors struct io_uring_params
+type ioUringParams struct {
+	sqEntries    uint32
+	cqEntries    uint32
+	flags        uint32
+	sqThreadCPU  uint32
+	sqThreadIdle uint32
+	features     uint32
+	wqFd         uint32
+	resv         [3]uint32
+	sqOff        ioSQRingOffsets
+	cqOff        ioCQRingOffsets
+}
+
+// ioSQRingOffsets mirrors struct io_sqring_offsets
+type ioSQRingOffsets struct {
+	head        uint32
+	tail        uint32
+	ringMask    uint32
+	ringEntries uint32
+	flags       uint32
+	dropped     uint32
+	array       uint32
+	resv1       uint32
+	userAddr    uint64
+}
+
+// ioCQRingOffsets mirrors struct io_cqring_offsets
+type ioCQRingOffsets struct {
+	head        uint32
+	tail        uint32
+	ringMask    uint32
+	ringEntries uint32
+	overflow    uint32
+	cqes        uint32
+	flags       uint32
+	resv1       uint32
+	userAddr    uint64
+}
+
+// ioUringSQE mirrors struct io_uring_sqe (64 bytes)
+type ioUringSQE struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	opFlags     uint32
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFdIn  int32
+	addr3       uint64
+	pad         uint64
+}
+
+// ioUringCQE mirrors struct io_uring_cqe (16 bytes)
+type ioUringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// ioUring is a minimal per-logger io_uring instance for the experimental write backend
+// Only one batch is in flight at a time; callers are serialized by mu
+type ioUring struct {
+	mu sync.Mutex
+	fd int
+
+	// Mapped rings
+	sqRing []byte
+	cqRing []byte
+	sqeMem []byte
+
+	// Submission queue
+	sqTail    *uint32
+	sqMask    uint32
+	sqEntries uint32
+	sqArray   []uint32
+	sqes      []ioUringSQE
+
+	// Completion queue
+	cqHead *uint32
+	cqTail *uint32
+	cqMask uint32
+	cqes   []ioUringCQE
+
+	// Buffers registered with IORING_REGISTER_BUFFERS (index = buf_index)
+	registered [][]byte
+
+	// Scratch iovecs for unregistered buffers (kept alive until completion)
+	iovecs []unix.Iovec
+
+	// Set when the ring is left in an unknown state (SQEs the kernel never consumed)
+	// All later writes fail fast with this error so the caller can fall back to pwritev
+	failed error
+}
+
+// ioUringWriteResult describes a completed io_uring batch
+type ioUringWriteResult struct {
+	confirmed          int           // Contiguous bytes confirmed by the kernel from the start offset
+	submitDuration     time.Duration // Time spent in io_uring_enter submitting SQEs
+	completionDuration time.Duration // Time spent waiting for CQEs
+}
+
+// newIOUring creates a ring with at least entries submission slots
+func newIOUring(entries uint32) (*ioUring, error) {
+	var p ioUringParams
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uintptr(entries), uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		if errno == unix.ENOSYS || errno == unix.EPERM {
+			return nil, fmt.Errorf("%w: io_uring_setup: %v", ErrIOUringUnsupported, errno)
+		}
+		return nil, fmt.Errorf("io_uring_setup failed: %w", errno)
+	}
+
+	r := &ioUring{fd: int(fd)}
+	if err := r.mapRings(&p); err != nil {
+		r.close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// mapRings maps the submission queue, completion queue and SQE array
+func (r *ioUring) mapRings(p *ioUringParams) error {
+	sqSize := int(p.sqOff.array + p.sqEntries*4)
+	cqSize := int(p.cqOff.cqes + p.cqEntries*uint32(unsafe.Sizeof(ioUringCQE{})))
+	singleMmap := p.features&ioringFeatSingleMmap != 0
+	if singleMmap && cqSize > sqSize {
+		sqSize = cqSize
+	}
+
+	var err error
+	r.sqRing, err = unix.Mmap(r.fd, ioringOffSQRing, sqSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		return fmt.Errorf("failed to mmap io_uring SQ ring: %w", err)
+	}
+	if singleMmap {
+		r.cqRing = r.sqRing
+	} else {
+		r.cqRing, err = unix.Mmap(r.fd, ioringOffCQRing, cqSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+		if err != nil {
+			return fmt.Errorf("failed to mmap io_uring CQ ring: %w", err)
+		}
+	}
+	sqeSize := int(p.sqEntries) * int(unsafe.Sizeof(ioUringSQE{}))
+	r.sqeMem, err = unix.Mmap(r.fd, ioringOffSQEs, sqeSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		return fmt.Errorf("failed to mmap io_uring SQEs: %w", err)
+	}
+
+	r.sqTail = (*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.tail]))
+	r.sqMask = *(*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.ringMask]))
+	r.sqEntries = p.sqEntries
+	r.sqArray = unsafe.Slice((*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.array])), p.sqEntries)
+	r.sqes = unsafe.Slice((*ioUringSQE)(unsafe.Pointer(&r.sqeMem[0])), p.sqEntries)
+
+	r.cqHead = (*uint32)(unsafe.Pointer(&r.cqRing[p.cqOff.head]))
+	r.cqTail = (*uint32)(unsafe.Pointer(&r.cqRing[p.cqOff.tail]))
+	r.cqMask = *(*uint32)(unsafe.Pointer(&r.cqRing[p.cqOff.ringMask]))
+	r.cqes = unsafe.Slice((*ioUringCQE)(unsafe.Pointer(&r.cqRing[p.cqOff.cqes])), p.cqEntries)
+
+	r.iovecs = make([]unix.Iovec, p.sqEntries)
+	return nil
+}
+
+// registerBuffers registers long-lived buffers (the shard double buffers) to avoid per-submit page mapping
+func (r *ioUring) registerBuffers(buffers [][]byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(buffers) == 0 {
+		return nil
+	}
+
+	iovecs := make([]unix.Iovec, len(buffers))
+	for i, buf := range buffers {
+		if len(buf) == 0 {
+			return fmt.Errorf("cannot register empty buffer %d", i)
+		}
+		iovecs[i].Base = &buf[0]
+		iovecs[i].SetLen(len(buf))
+	}
+
+	_, _, errno := unix.Syscall6(unix.SYS_IO_URING_REGISTER, uintptr(r.fd), ioringRegisterBuffers,
+		uintptr(unsafe.Pointer(&iovecs[0])), uintptr(len(iovecs)), 0, 0)
+	runtime.KeepAlive(iovecs)
+	if errno != 0 {
+		return fmt.Errorf("io_uring buffer registration failed: %w", errno)
+	}
+
+	r.registered = buffers
+	return nil
+}
+
+// registeredIndex returns the index of the registered buffer containing buf, or -1
+func (r *ioUring) registeredIndex(buf []byte) int {
+	start := uintptr(unsafe.Pointer(&buf[0]))
+	end := start + uintptr(len(buf))
+	for i, reg := range r.registered {
+		regStart := uintptr(unsafe.Pointer(&reg[0]))
+		if start >= regStart && end <= regStart+uintptr(len(reg)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// writeAt writes buffers back-to-back starting at offset, one SQE per buffer
+// If datasync is set, an fdatasync SQE is queued behind the writes (IOSQE_IO_DRAIN) in the final batch
+// The result reports only bytes the kernel confirmed contiguously from offset
+func (r *ioUring) writeAt(fd int, buffers [][]byte, offset int64, datasync bool) (ioUringWriteResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var result ioUringWriteResult
+	if r.failed != nil {
+		return result, r.failed
+	}
+
+	// Filter out empty buffers
+	nonEmpty := make([][]byte, 0, len(buffers))
+	for _, buf := range buffers {
+		if len(buf) > 0 {
+			nonEmpty = append(nonEmpty, buf)
+		}
+	}
+	if len(nonEmpty) == 0 {
+		return result, nil
+	}
+
+	// Reserve one slot for the fdatasync SQE
+	perBatch := int(r.sqEntries) - 1
+	if perBatch < 1 {
+		perBatch = 1
+	}
+
+	writeOffset := offset
+	for start := 0; start < len(nonEmpty); start += perBatch {
+		end := start + perBatch
+		if end > len(nonEmpty) {
+			end = len(nonEmpty)
+		}
+		batch := nonEmpty[start:end]
+		lastBatch := end == len(nonEmpty)
+
+		confirmed, err := r.submitBatch(fd, batch, writeOffset, datasync && lastBatch, &result)
+		result.confirmed += confirmed
+		if err != nil {
+			return result, err
+		}
+		writeOffset += int64(confirmed)
+	}
+
+	return result, nil
+}
+
+// submitBatch submits one batch of writes (plus optional fdatasync) and waits for all completions
+func (r *ioUring) submitBatch(fd int, batch [][]byte, offset int64, datasync bool, result *ioUringWriteResult) (int, error) {
+	tail := atomic.LoadUint32(r.sqTail)
+	sqeOffset := offset
+	for i, buf := range batch {
+		sqe := r.nextSQE(tail)
+		sqe.fd = int32(fd)
+		sqe.off = uint64(sqeOffset)
+		sqe.addr = uint64(uintptr(unsafe.Pointer(&buf[0])))
+		sqe.len = uint32(len(buf))
+		sqe.userData = uint64(i)
+		if idx := r.registeredIndex(buf); idx >= 0 {
+			sqe.opcode = ioringOpWriteFixed
+			sqe.bufIndex = uint16(idx)
+		} else {
+			r.iovecs[i].Base = &buf[0]
+			r.iovecs[i].SetLen(len(buf))
+			sqe.opcode = ioringOpWritev
+			sqe.addr = uint64(uintptr(unsafe.Pointer(&r.iovecs[i])))
+			sqe.len = 1
+		}
+		sqeOffset += int64(len(buf))
+		tail++
+	}
+
+	toSubmit := uint32(len(batch))
+	if datasync {
+		// Drain: the fdatasync only starts once every write ahead of it has completed
+		// A linked chain (IOSQE_IO_LINK) would also serialize the writes and cancel the rest after
+		// a failure; neither is needed: each write carries its own offset, so they may complete in
+		// any order, and the confirmed bytes stop at the first gap whatever happened after it
+		sqe := r.nextSQE(tail)
+		sqe.opcode = ioringOpFsync
+		sqe.flags = iosqeIODrain
+		sqe.fd = int32(fd)
+		sqe.opFlags = ioringFsyncDatasync
+		sqe.userData = fsyncUserData
+		tail++
+		toSubmit++
+	}
+
+	// Publish the new tail before entering the kernel
+	atomic.StoreUint32(r.sqTail, tail)
+
+	submitStart := time.Now()
+	submitted := uint32(0)
+	for submitted < toSubmit {
+		n, err := r.enter(toSubmit-submitted, 0, 0)
+		if err == nil && n == 0 {
+			err = fmt.Errorf("kernel consumed %d of %d entries", submitted, toSubmit)
+		}
+		if err != nil {
+			// Unconsumed SQEs still reference the caller's buffers: retire the ring
+			result.submitDuration += time.Since(submitStart)
+			r.failed = fmt.Errorf("io_uring submit failed: %w", err)
+			return 0, r.failed
+		}
+		submitted += n
+	}
+	result.submitDuration += time.Since(submitStart)
+
+	// Reap completions
+	results := make([]int32, len(batch))
+	fsyncRes := int32(0)
+	remaining := toSubmit
+	completionStart := time.Now()
+	for remaining > 0 {
+		reaped := r.reap(results, &fsyncRes)
+		remaining -= reaped
+		if remaining == 0 {
+			break
+		}
+		if _, err := r.enter(0, remaining, ioringEnterGetEvents); err != nil {
+			// In-flight writes still reference the caller's buffers: retire the ring
+			result.completionDuration += time.Since(completionStart)
+			r.failed = fmt.Errorf("io_uring wait failed: %w", err)
+			return 0, r.failed
+		}
+	}
+	result.completionDuration += time.Since(completionStart)
+	runtime.KeepAlive(batch)
+
+	// Count contiguous confirmed bytes; stop at the first failed or short write
+	confirmed := 0
+	for i, res := range results {
+		if res < 0 {
+			return confirmed, fmt.Errorf("io_uring write failed: %w", unix.Errno(-res))
+		}
+		confirmed += int(res)
+		if int(res) < len(batch[i]) {
+			return confirmed, fmt.Errorf("io_uring write: %w", io.ErrShortWrite)
+		}
+	}
+
+	if fsyncRes < 0 {
+		// Nothing in this batch is known to be durable
+		return 0, fmt.Errorf("io_uring fdatasync failed: %w", unix.Errno(-fsyncRes))
+	}
+
+	return confirmed, nil
+}
+
+// retired returns the error that retired the ring, or nil if it is usable
+func (r *ioUring) retired() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.failed
+}
+
+// nextSQE returns a zeroed SQE for the slot at tail and links it into the SQ array
+func (r *ioUring) nextSQE(tail uint32) *ioUringSQE {
+	idx := tail & r.sqMask
+	r.sqArray[idx] = idx
+	sqe := &r.sqes[idx]
+	*sqe = ioUringSQE{}
+	return sqe
+}
+
+// reap consumes available CQEs and returns how many were reaped
+func (r *ioUring) reap(results []int32, fsyncRes *int32) uint32 {
+	head := atomic.LoadUint32(r.cqHead)
+	tail := atomic.LoadUint32(r.cqTail)
+	reaped := uint32(0)
+	for ; head != tail; head++ {
+		cqe := r.cqes[head&r.cqMask]
+		if cqe.userData == fsyncUserData {
+			*fsyncRes = cqe.res
+		} else if cqe.userData < uint64(len(results)) {
+			results[cqe.userData] = cqe.res
+		}
+		reaped++
+	}
+	atomic.StoreUint32(r.cqHead, head)
+	return reaped
+}
+
+// enter calls io_uring_enter, retrying on EINTR
+func (r *ioUring) enter(toSubmit, minComplete, flags uint32) (uint32, error) {
+	for {
+		n, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(r.fd), uintptr(toSubmit), uintptr(minComplete), uintptr(flags), 0, 0)
+		if errno == unix.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return 0, errno
+		}
+		return uint32(n), nil
+	}
+}
+
+// close unregisters buffers, unmaps the rings and closes the ring fd
+func (r *ioUring) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.registered != nil {
+		unix.Syscall6(unix.SYS_IO_URING_REGISTER, uintptr(r.fd), ioringUnregisterBuffers, 0, 0, 0, 0)
+		r.registered = nil
+	}
+	if r.sqeMem != nil {
+		unix.Munmap(r.sqeMem)
+		r.sqeMem = nil
+	}
+	if r.cqRing != nil && &r.cqRing[0] != &r.sqRing[0] {
+		unix.Munmap(r.cqRing)
+	}
+	r.cqRing = nil
+	if r.sqRing != nil {
+		unix.Munmap(r.sqRing)
+		r.sqRing = nil
+	}
+	if r.fd > 0 {
+		err := unix.Close(r.fd)
+		r.fd = -1
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+//go:build linux
+
+package asyncloguploader
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestIOUring creates a ring or skips the test if the kernel lacks io_uring
+func newTestIOUring(t *testing.T, entries uint32) *ioUring {
+	t.Helper()
+	ring, err := newIOUring(entries)
+	if errors.Is(err, ErrIOUringUnsupported) {
+		t.Skipf("io_uring not available: %v", err)
+	}
+	require.NoError(t, err)
+	t.Cleanup(func() { ring.close() })
+	return ring
+}
+
+// newTestAlignedBuffer allocates an O_DIRECT-compatible buffer filled with fill
+func newTestAlignedBuffer(t *testing.T, size int, fill byte) []byte {
+	t.Helper()
+	buf, cleanup, err := allocMmapBuffer(size)
+	require.NoError(t, err)
+	t.Cleanup(cleanup)
+	for i := range buf {
+		buf[i] = fill
+	}
+	return buf
+}
+
+func TestIOUring_WriteAt(t *testing.T) {
+	t.Run("WritesRegisteredAndUnregisteredBuffers", func(t *testing.T) {
+		ring := newTestIOUring(t, 8)
+
+		registered := newTestAlignedBuffer(t, 8192, 'a')
+		unregistered := newTestAlignedBuffer(t, 4096, 'b')
+		require.NoError(t, ring.registerBuffers([][]byte{registered}))
+		assert.Equal(t, 0, ring.registeredIndex(registered[:4096]))
+		assert.Equal(t, -1, ring.registeredIndex(unregistered))
+
+		path := filepath.Join(t.TempDir(), "iouring.log")
+		file, _, err := openDirectIOSize(path, 0, alignmentSize, 0)
+		require.NoError(t, err)
+		defer file.Close()
+
+		result, err := ring.writeAt(int(file.Fd()), [][]byte{registered, nil, unregistered}, 0, true)
+		require.NoError(t, err)
+		assert.Equal(t, 8192+4096, result.confirmed)
+		assert.Greater(t, result.submitDuration, time.Duration(0))
+		assert.Greater(t, result.completionDuration, time.Duration(0))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Len(t, data, 8192+4096)
+		assert.Equal(t, bytes.Repeat([]byte{'a'}, 8192), data[:8192])
+		assert.Equal(t, bytes.Repeat([]byte{'b'}, 4096), data[8192:])
+	})
+
+	t.Run("SplitsBatchesLargerThanRing", func(t *testing.T) {
+		ring := newTestIOUring(t, 2)
+
+		buffers := [][]byte{
+			newTestAlignedBuffer(t, 4096, 'x'),
+			newTestAlignedBuffer(t, 4096, 'y'),
+			newTestAlignedBuffer(t, 4096, 'z'),
+		}
+
+		path := filepath.Join(t.TempDir(), "iouring.log")
+		file, _, err := openDirectIOSize(path, 0, alignmentSize, 0)
+		require.NoError(t, err)
+		defer file.Close()
+
+		result, err := ring.writeAt(int(file.Fd()), buffers, 4096, true)
+		require.NoError(t, err)
+		assert.Equal(t, 3*4096, result.confirmed)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Len(t, data, 4*4096)
+		assert.Equal(t, bytes.Repeat([]byte{'z'}, 4096), data[3*4096:])
+	})
+
+	t.Run("ReportsKernelErrors", func(t *testing.T) {
+		ring := newTestIOUring(t, 4)
+
+		// Unaligned O_DIRECT write is rejected by the kernel with EINVAL
+		path := filepath.Join(t.TempDir(), "iouring.log")
+		file, _, err := openDirectIOSize(path, 0, alignmentSize, 0)
+		require.NoError(t, err)
+		defer file.Close()
+
+		buf := newTestAlignedBuffer(t, 4096, 'e')
+		result, err := ring.writeAt(int(file.Fd()), [][]byte{buf[:100]}, 0, true)
+		assert.Error(t, err)
+		assert.Equal(t, 0, result.confirmed)
+		assert.NoError(t, ring.retired(), "kernel-reported errors must not retire the ring")
+	})
+}
+
+func TestLogger_IOUringBackend(t *testing.T) {
+	newTestIOUring(t, 4) // Skips if io_uring is unavailable
+
+	tmpDir := t.TempDir()
+	config := DefaultConfig(filepath.Join(tmpDir, "iouring_test.log"))
+	config.BufferSize = 2 * 1024 * 1024
+	config.NumShards = 4
+	config.FlushInterval = 50 * time.Millisecond
+	config.IOBackend = IOBackendIOUring
+
+	logger, err := NewLogger(config)
+	require.NoError(t, err)
+	assert.Equal(t, IOBackendIOUring, logger.IOBackend())
+
+	testMessages := []string{"iouring message 1", "iouring message 2", "iouring message 3"}
+	for _, msg := range testMessages {
+		logger.LogBytes([]byte(msg))
+	}
+	forceFlush(t, logger, config.NumShards, config.BufferSize)
+
+	metrics := logger.GetFlushMetrics()
+	assert.Greater(t, metrics.AvgCompletionDuration, time.Duration(0))
+	assert.Greater(t, metrics.MaxSubmitDuration, time.Duration(0))
+
+	require.NoError(t, logger.Close())
+	_, _, _, _, flushErrors, _, _, _ := logger.GetStatsSnapshot()
+	assert.Equal(t, int64(0), flushErrors)
+
+	actualFile := findLogFile(t, tmpDir, "iouring_test")
+	require.NotEmpty(t, actualFile)
+	data, err := os.ReadFile(actualFile)
+	require.NoError(t, err)
+	for _, msg := range testMessages {
+		assert.Contains(t, string(data), msg)
+	}
+	verifyFileFormatImproved(t, data)
+}
+
+func TestConfig_IOBackend(t *testing.T) {
+	config := DefaultConfig("/tmp/test.log")
+	config.IOBackend = ""
+	require.NoError(t, config.Validate())
+	assert.Equal(t, IOBackendPwritev, config.IOBackend)
+
+	config.IOBackend = "aio"
+	assert.Error(t, config.Validate())
+
+	config = DefaultConfig("/tmp/test.log")
+	config.UseIOUring = true
+	require.NoError(t, config.Validate())
+	assert.Equal(t, IOBackendIOUring, config.IOBackend)
+	require.NoError(t, config.Validate(), "validating twice keeps the backend")
+
+	config.IOBackend = IOBackendPwritev
+	assert.ErrorContains(t, config.Validate(), "UseIOUring conflicts with IOBackend")
+}
@@ -1,11 +1,39 @@
 package asyncloguploader
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
 	"sync/atomic"
 	"time"
-	"unsafe"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asyncloguploader/clock"
+	"github.com/neehar-mavuduru/logger-double-buffer/internal/logcore"
+)
+
+// Sentinel errors returned by TryLogBytes; they are preallocated so rejecting a log does not allocate
+var (
+	// ErrClosed is returned when the logger has been closed
+	ErrClosed = errors.New("logger is closed")
+
+	// ErrBufferFull is returned when no buffer space became available within WriteRetryTimeout
+	ErrBufferFull = errors.New("log buffer full")
+
+	// ErrOversized is returned when the message exceeds MaxMessageSize
+	ErrOversized = errors.New("log message exceeds MaxMessageSize")
+
+	// ErrLowDiskSpace is returned while the logger is degraded by free-space monitoring
+	ErrLowDiskSpace = errors.New("logger degraded: low disk space")
+
+	// ErrDiskFull is returned while flushed data is kept for a retry after a disk-full write error
+	ErrDiskFull = errors.New("logger degraded: disk full")
+
+	// ErrDraining is returned by LoggerManager writes once Drain has started
+	ErrDraining = errors.New("logger manager is draining")
 )
 
 // Statistics holds operational statistics for the logger
@@ -13,14 +41,41 @@ type Statistics struct {
 	TotalLogs    atomic.Int64 // Total log attempts (successful + dropped)
 	DroppedLogs  atomic.Int64 // Logs dropped (buffer full, logger closed, etc.)
 	BytesWritten atomic.Int64 // Total bytes successfully written to buffers
+	BytesFlushed atomic.Int64 // Buffer data bytes (excluding shard headers) written to disk by successful flushes
 	Flushes      atomic.Int64 // Number of flush operations completed
 	FlushErrors  atomic.Int64 // Number of flush operations that failed
 
+	// Log payload bytes (excluding length prefixes, entry headers, shard headers and padding)
+	BytesBuffered atomic.Int64 // Payload accepted into shard buffers
+	BytesDurable  atomic.Int64 // Payload written to disk by successful flushes; never counts lost or dropped data
+
+	// Bytes written by successful flushes besides the payload (see FlushMetrics.WriteAmplificationRatio)
+	HeaderBytesFlushed  atomic.Int64 // Shard headers, checksum trailers and entry framing (length prefixes, chunk headers, route tags)
+	PaddingBytesFlushed atomic.Int64 // Shard bytes after the entries (every shard is written in full)
+
+	// Entries (length-prefixed records, one per chunk for chunked logs) by flush outcome
+	EntriesFlushed atomic.Int64 // Entries written to disk by successful flushes
+	EntriesLost    atomic.Int64 // Entries discarded because their flush failed
+	FlushRetries   atomic.Int64 // Failed flushes whose data was kept for a retry (disk full; also counted in FlushErrors)
+
 	// Flush performance metrics
 	TotalFlushDuration atomic.Int64 // Total time spent in flush operations (nanoseconds)
 	MaxFlushDuration   atomic.Int64 // Maximum flush duration seen (nanoseconds)
 	FlushQueueDepth    atomic.Int64 // Current depth of flush queue
 	BlockedSwaps       atomic.Int64 // Number of swaps that blocked waiting for flush
+	EarlyFlushes       atomic.Int64 // AdaptiveFlush flushes started before the shard threshold was reached
+	IntervalFlushes    atomic.Int64 // Flushes of shards that waited below the threshold until the next FlushInterval tick
+	FlushesCoalesced   atomic.Int64 // Flush requests for shards already queued, merged into the pending request
+	PresealedBuffers   atomic.Int64 // Shard buffers flushed as sealed by the writer that swapped them out
+
+	// Flushes that wrote at least one shard buffer sealed after FlushTimeout with writes still in
+	// progress (counted once per flush); the unfinished entries are left for a later flush
+	PartialFlushes           atomic.Int64
+	LastPartialFlushUnixNano atomic.Int64 // When the last partial flush started (Config.Clock); 0 if none
+
+	// Buffer auto-resize (Config.MaxBufferSize)
+	BufferGrowths atomic.Int64 // Shard buffer sets replaced by larger ones after drops
+	BufferShrinks atomic.Int64 // Shard buffer sets replaced by smaller ones after quiet intervals
 
 	// Detailed I/O breakdown
 	TotalWriteDuration atomic.Int64 // Time spent in WriteVectored() including rotation checks (nanoseconds)
@@ -29,199 +84,631 @@ type Statistics struct {
 	// Pwritev syscall timing (pure disk I/O, excludes rotation checks)
 	TotalPwritevDuration atomic.Int64 // Time spent in Pwritev syscall only (nanoseconds)
 	MaxPwritevDuration   atomic.Int64 // Maximum Pwritev duration (nanoseconds)
+
+	// Write path breakdown (for tuning WriteRetryTimeout)
+	FastPathWrites  atomic.Int64 // Writes that succeeded on the first attempt
+	RetryPathWrites atomic.Int64 // Writes that found their shard full and entered the retry path
+	RetryTimeouts   atomic.Int64 // Retry-path writes dropped because the swap permit wasn't acquired in time (also counted in DroppedLogs)
+	SpilledWrites   atomic.Int64 // Fast-path writes placed in one of the next shards because theirs had no space left
+
+	// LogBytes durations (Config.TrackWriteLatency)
+	WriteLatency writeLatencyCounters
+
+	// Message size limits
+	OversizedLogs atomic.Int64 // Logs rejected for exceeding MaxMessageSize (counted in TotalLogs, not DroppedLogs)
+
+	// Context-aware logging (LogBytesCtx)
+	CancelledLogs atomic.Int64 // Logs skipped because their context was done (counted in TotalLogs, not DroppedLogs)
+	ChunkedLogs   atomic.Int64 // Logs split into chunk entries (AllowChunking)
+
+	// LoggerManager event policies (SetEventPolicy); suppressed logs are not counted in TotalLogs
+	SampledOutLogs    atomic.Int64 // Logs skipped by EventPolicy.SampleRate
+	RateLimitedLogs   atomic.Int64 // Logs refused by EventPolicy.MaxEntriesPerSecond
+	DrainRejectedLogs atomic.Int64 // Logs refused after LoggerManager.Drain started
+
+	// Free-space protection
+	FreeSpaceDrops atomic.Int64 // Logs rejected while degraded due to low disk space (also counted in DroppedLogs)
+	DiskFullDrops  atomic.Int64 // Logs rejected while a disk-full flush is retried (also counted in DroppedLogs)
+
+	// Retention (MaxRotatedFiles, MaxTotalLogBytes)
+	RetentionFilesDeleted   atomic.Int64 // Rotated files deleted by retention
+	RetentionBytesReclaimed atomic.Int64 // Bytes freed by deleting rotated files
+
+	// Compression of rotated files (Config.Compression)
+	CompressedFiles          atomic.Int64 // Rotated files compressed
+	CompressionFailures      atomic.Int64 // Rotated files that failed to compress (uploaded raw)
+	CompressionBytesIn       atomic.Int64 // Raw bytes read by compression
+	CompressionBytesOut      atomic.Int64 // Compressed bytes written
+	TotalCompressionDuration atomic.Int64 // Time spent compressing files (nanoseconds)
+
+	// io_uring backend timing (zero for pwritev)
+	TotalSubmitDuration     atomic.Int64 // Time spent submitting SQEs (nanoseconds)
+	MaxSubmitDuration       atomic.Int64 // Maximum submit duration (nanoseconds)
+	TotalCompletionDuration atomic.Int64 // Time spent waiting for CQEs (nanoseconds)
+	MaxCompletionDuration   atomic.Int64 // Maximum completion wait (nanoseconds)
+
+	// Maxima of the current GetIntervalStats interval
+	interval intervalMaxima
 }
 
 // Logger is an async logger using Sharded Double Buffer CAS with Direct I/O
 // Each shard has its own double buffer and swaps individually
 type Logger struct {
 	// Collection of shards, each with its own double buffer
-	shardCollection *ShardCollection
+	// Replaced by a larger or smaller one when buffers are auto-resized (Config.MaxBufferSize)
+	shardCollection atomic.Pointer[ShardCollection]
 
-	// FileWriter for writing logs with Direct I/O and rotation support
-	fileWriter FileWriter
+	// Shard collection left behind by a resize interrupted by Close, released by Close
+	// Only used by the ticker worker, then by Close once the workers have exited
+	spareShards *ShardCollection
 
-	// Channel for flush requests (individual shards sent on swap)
-	flushChan chan *Shard
+	// Flush workers (Config.FlushConcurrency), each with its own shards and file writer
+	groups []*flushGroup
 
-	// Ticker for periodic flushing
-	ticker *time.Ticker
+	// Ticker for periodic flushing (Config.Clock)
+	ticker clock.Ticker
 
-	// Channel for shutdown signal
-	done chan struct{}
+	// Open and closed state; its Done channel is the shutdown signal
+	life *logcore.Lifecycle
 
-	// Semaphore to prevent concurrent flushes
-	semaphore chan struct{}
+	// Flush and ticker workers, waited for by Close
+	workers sync.WaitGroup
 
 	// Configuration
 	config Config
 
+	// Settings changed at runtime by UpdateConfig; config keeps the values the logger was created with
+	flushInterval atomic.Int64  // Nanoseconds (the ticker's period)
+	flushTimeout  *atomic.Int64 // Nanoseconds (shared with the shards, which seal with it on swap)
+	shardFlushPct atomic.Int32  // ShardFlushThresholdPct, applied to resized shard sets
+	readyShardPct atomic.Int32  // ReadyShardsFlushPct, applied to resized shard sets
+	configMu      sync.Mutex    // Serializes UpdateConfig and free-space MaxFileSize overrides
+	maxFileSize   int64         // Guarded by configMu
+
 	// Statistics
 	stats Statistics
 
-	// Closed flag
-	closed atomic.Bool
+	// Start of the current GetIntervalStats interval
+	interval intervalState
+
+	// Free-space monitor (nil when FreeSpaceConfig is not set)
+	freeSpace *freeSpaceMonitor
+
+	// Rotated-file retention (nil when MaxRotatedFiles and MaxTotalLogBytes are unset)
+	retention *retentionJanitor
+
+	// Compression of rotated files (nil when Compression is unset)
+	compression *compressionStage
+
+	// Files completed by the logger's writers (nil for a NewLoggerWithWriter writer)
+	rotations *rotationHistory
+
+	// Degraded flag: new logs are rejected to protect the disk
+	degraded atomic.Bool
+
+	// Flush groups holding data kept for a retry after a disk-full write error (see disk_full.go)
+	retainingGroups atomic.Int32
+
+	// Health state (see health.go): drop counters at the last FlushInterval ticks, flushes that
+	// failed in a row, and when a flush last succeeded (Unix nanoseconds; creation until the first)
+	health           healthWindow
+	flushErrorsInRow atomic.Int64
+	lastFlushOK      atomic.Int64
+
+	// Largest entry payload a single shard can hold; longer messages are chunked
+	maxEntry int
+
+	// Message IDs for chunked messages (unique per logger, i.e. per log file series)
+	nextChunkedID atomic.Uint64
+
+	// Sequence number of the last Snapshot taken
+	snapshotSeq atomic.Uint64
+
+	// Optional per-flush callback (e.g. for latency histograms); nil when unset
+	flushObserver atomic.Pointer[func(FlushObservation)]
+
+	// LoggerManager LRU bookkeeping: last lookup (Unix nanoseconds of Config.Clock), manager writes in
+	// progress, and whether the logger has been evicted
+	lastUsed atomic.Int64
+	inUse    atomic.Int32
+	evicted  atomic.Bool
+
+	// Partial flush warnings: when the last was printed and the partial flushes since (rate limiting)
+	partialWarnedAt     atomic.Int64
+	partialsSinceWarned atomic.Int64
+
+	// LoggerManager event policy (SetEventPolicy); nil writes every entry
+	limiter atomic.Pointer[eventLimiter]
+
+	// Event name the LoggerManager created the logger for, which passed its guardrails then
+	createdFor string
+
+	// Set by LoggerManager.Drain: manager writes are refused with ErrDraining
+	draining atomic.Bool
 }
 
 // NewLogger creates a new async logger
 func NewLogger(config Config) (*Logger, error) {
+	return newLogger(config, nil)
+}
+
+// NewLoggerWithWriter creates a logger that flushes to w instead of its own files, e.g. an in-memory
+// testsupport.Writer. One flush worker writes to w (FlushConcurrency is ignored), and retention and
+// compression, which work on rotated files, are not started. The logger takes ownership of w and
+// closes it on Close. Config.LogFilePath is validated but not written
+func NewLoggerWithWriter(config Config, w FileWriter) (*Logger, error) {
+	if w == nil {
+		return nil, fmt.Errorf("file writer cannot be nil")
+	}
+	return newLogger(config, w)
+}
+
+// newLogger creates a logger whose flush workers write to their own files, or to w if not nil
+func newLogger(config Config, w FileWriter) (*Logger, error) {
 	// Validate configuration
 	if err := config.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
 
-	// Create file writer
-	fileWriter, err := NewSizeFileWriter(config, config.UploadChannel)
+	// Create shard collection (each shard has its own double buffer)
+	// The flush groups below give it the flush channels shards enqueue themselves on
+	flushTimeout := new(atomic.Int64)
+	flushTimeout.Store(int64(config.FlushTimeout))
+	shardCollection, err := newShardSet(config, config.BufferSize, flushTimeout)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create file writer: %w", err)
+		return nil, fmt.Errorf("failed to create shard collection: %w", err)
 	}
 
-	// Create flush channel first
-	flushChan := make(chan *Shard, 32) // Buffer for individual shard flush requests
-
-	// Create shard collection (each shard has its own double buffer)
-	// Pass flush channel so shards can enqueue themselves on swap
-	shardCollection, err := NewShardCollection(config.BufferSize, config.NumShards, flushChan)
+	// Create the flush workers' file writers and split the shards between them
+	groups, err := newFlushGroups(config, shardCollection, w)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create shard collection: %w", err)
+		shardCollection.Close()
+		return nil, err
 	}
 
 	// Initialize logger
+	// maxEntry stays that of BufferSize: resized buffers are never smaller
 	l := &Logger{
-		shardCollection: shardCollection,
-		fileWriter:      fileWriter,
-		flushChan:       flushChan,
-		ticker:          time.NewTicker(config.FlushInterval),
-		done:            make(chan struct{}),
-		semaphore:       make(chan struct{}, 1),
-		config:          config,
+		groups:   groups,
+		ticker:   config.Clock.NewTicker(config.FlushInterval),
+		life:     logcore.NewLifecycle(),
+		config:   config,
+		maxEntry: shardCollection.GetShard(0).maxEntryPayload(),
+
+		flushTimeout: flushTimeout,
+		maxFileSize:  config.MaxFileSize,
+	}
+	l.flushInterval.Store(int64(config.FlushInterval))
+	l.shardFlushPct.Store(int32(config.ShardFlushThresholdPct))
+	l.readyShardPct.Store(int32(config.ReadyShardsFlushPct))
+	l.interval.start = time.Now()
+	l.lastFlushOK.Store(l.interval.start.UnixNano())
+	shardCollection.coalesced = &l.stats.FlushesCoalesced
+	shardCollection.spilled = &l.stats.SpilledWrites
+	l.shardCollection.Store(shardCollection)
+
+	// Start free-space monitoring before taking traffic so a nearly full disk is caught immediately
+	if config.FreeSpaceConfig != nil {
+		l.freeSpace = newFreeSpaceMonitor(*config.FreeSpaceConfig, filepath.Dir(config.LogFilePath), l.applyFreeSpaceLevel)
+		l.freeSpace.start()
+	}
+
+	writers := make([]*SizeFileWriter, 0, len(groups))
+	for _, g := range groups {
+		if w, ok := g.fileWriter.(*SizeFileWriter); ok {
+			writers = append(writers, w)
+		}
+	}
+
+	if len(writers) > 0 {
+		l.rotations = newRotationHistory(config.RotationHistory)
+		for _, w := range writers {
+			w.setRotationHistory(l.rotations)
+		}
+	}
+
+	// Route closed files through compression; compressed files are published once done
+	// (a NewLoggerWithWriter writer has no files, so neither compression nor retention applies)
+	if config.Compression != "" && len(writers) > 0 {
+		l.compression = newCompressionStage(config, l.publishFile, &l.stats)
+		for _, w := range writers {
+			w.setCompression(l.compression)
+		}
+		l.compression.start(config.CompressionConcurrency)
+	}
+
+	// Start retention, which first removes rotated files left over beyond the limits
+	if (config.MaxRotatedFiles > 0 || config.MaxTotalLogBytes > 0) && len(writers) > 0 {
+		l.retention = newRetentionJanitor(config, writers, l.compression, &l.stats)
+		l.retention.start()
 	}
 
 	// Start background workers
-	go l.flushWorker()
+	l.workers.Add(len(groups) + 1)
+	for _, g := range groups {
+		go l.flushWorker(g)
+	}
 	go l.tickerWorker()
 
 	return l, nil
 }
 
+// newShardSet creates a shard collection of size bytes for config, ready to take writes
+// Its shards seal with flushTimeout on swap. The caller sets its flush channels
+func newShardSet(config Config, size int, flushTimeout *atomic.Int64) (*ShardCollection, error) {
+	sc, err := newShardCollection(size, config.NumShards, config.ioAlignment(), nil)
+	if err != nil {
+		return nil, err
+	}
+	sc.selection = config.ShardSelection
+	sc.setReadyShardsPct(config.ReadyShardsFlushPct)
+	sc.setFlushThresholdPct(config.ShardFlushThresholdPct)
+
+	// Reserve the checksum trailer and let writers seal the buffers they swap out, before any
+	// writes reach the shards
+	for _, shard := range sc.Shards() {
+		if config.EnableChecksums {
+			shard.reserveChecksumTrailer()
+		}
+		shard.enableSealOnSwap(flushTimeout, config.EnableChecksums)
+		shard.clock = config.Clock
+	}
+	return sc, nil
+}
+
+// publishFile queues a compressed (or failed-to-compress) file for upload and wakes retention
+// Called by the compression workers
+func (l *Logger) publishFile(file FileReadyEvent) {
+	queueUpload(l.config.UploadChannel, l.config.FileEventChannel, l.config.UploadTracker, l.config.InternalLogger, file)
+	if l.retention != nil {
+		l.retention.notify()
+	}
+}
+
 // LogBytes writes raw byte data to the logger (zero-allocation path)
+// Fire-and-forget: rejected logs are only reflected in the statistics; use TryLogBytes to see why
 func (l *Logger) LogBytes(data []byte) {
+	_ = l.TryLogBytes(data)
+}
+
+// LogBytesCtx is TryLogBytes for request-scoped logs: once ctx is done the log is skipped before
+// it is copied, and a write waiting on the retry path gives up. Returns ctx.Err() for skipped logs,
+// which are counted in CancelledLogs rather than DroppedLogs. A live ctx costs one channel check
+func (l *Logger) LogBytesCtx(ctx context.Context, data []byte) error {
+	if err := l.tryLogBytes(nil, data, 0, false, ctx.Done()); err != errCancelled {
+		return err
+	}
+	return ctx.Err()
+}
+
+// LogBytesKeyed is LogBytes with a key: under ShardSelectionKeyHash, entries with the same key go
+// to the same shard and keep their relative order (e.g. per tenant). Other strategies ignore key
+func (l *Logger) LogBytesKeyed(key uint64, data []byte) {
+	_ = l.tryLogBytes(nil, data, key, true, nil)
+}
+
+// TryLogBytes writes raw byte data like LogBytes and reports whether the log was accepted
+// Returns nil on success, or ErrClosed, ErrLowDiskSpace, ErrOversized or ErrBufferFull.
+// Statistics are updated exactly as for LogBytes
+func (l *Logger) TryLogBytes(data []byte) error {
+	return l.tryLogBytes(nil, data, 0, false, nil)
+}
+
+// TryLogBytesKeyed is TryLogBytes with a key, as for LogBytesKeyed
+func (l *Logger) TryLogBytesKeyed(key uint64, data []byte) error {
+	return l.tryLogBytes(nil, data, key, true, nil)
+}
+
+// tryLogBytes implements TryLogBytes and TryLogBytesKeyed (keyed is false for unkeyed writes)
+// done is the context's Done channel for LogBytesCtx (nil otherwise); see cancelled
+// tag is written before data in the same entry (routed event names, see Config.TagRoutedEvents)
+// Without TrackWriteLatency the hot path only gains a branch and a call (no clock reads)
+func (l *Logger) tryLogBytes(tag, data []byte, key uint64, keyed bool, done <-chan struct{}) error {
+	if l.config.TrackWriteLatency {
+		return l.timedLogBytes(tag, data, key, keyed, done)
+	}
+	return l.logBytes(tag, data, key, keyed, done)
+}
+
+// timedLogBytes is logBytes timed into the write-latency histogram
+func (l *Logger) timedLogBytes(tag, data []byte, key uint64, keyed bool, done <-chan struct{}) error {
+	start := time.Now()
+	err := l.logBytes(tag, data, key, keyed, done)
+	l.stats.WriteLatency.observe(time.Since(start))
+	return err
+}
+
+// logBytes writes one log (see tryLogBytes)
+func (l *Logger) logBytes(tag, data []byte, key uint64, keyed bool, done <-chan struct{}) error {
 	// Count every log attempt (successful or dropped)
 	l.stats.TotalLogs.Add(1)
 
-	if l.closed.Load() {
+	if l.life.Closed() {
 		l.stats.DroppedLogs.Add(1)
-		return
+		return ErrClosed
 	}
 
+	// Degraded: disk is nearly full, reject before filling buffers we cannot flush
+	if l.degraded.Load() {
+		l.stats.DroppedLogs.Add(1)
+		l.stats.FreeSpaceDrops.Add(1)
+		return ErrLowDiskSpace
+	}
+	if l.retainingGroups.Load() > 0 {
+		l.stats.DroppedLogs.Add(1)
+		l.stats.DiskFullDrops.Add(1)
+		return ErrDiskFull
+	}
+
+	// Request already cancelled: skip the copy
+	if done != nil && cancelled(done) {
+		l.stats.CancelledLogs.Add(1)
+		return errCancelled
+	}
+	return l.writeLog(tag, data, key, keyed, done)
+}
+
+// writeLog writes one counted log once the logger is known to accept logs, counting a rejection
+// A non-empty tag counts toward MaxMessageSize as part of the entry
+func (l *Logger) writeLog(tag, data []byte, key uint64, keyed bool, done <-chan struct{}) error {
+	// Oversized: rejected outright (never retried, not counted in DroppedLogs)
+	if len(tag)+len(data) > l.config.MaxMessageSize {
+		l.stats.OversizedLogs.Add(1)
+		return ErrOversized
+	}
+
+	// Larger than a single shard entry: split into chunk entries (only reachable with AllowChunking)
+	// The chunks carry the tag and data as one message, so a tagged message is copied once here
+	if len(tag)+len(data) > l.maxEntry {
+		if len(tag) > 0 {
+			data = append(tag[:len(tag):len(tag)], data...)
+		}
+		return l.logChunked(data, key, keyed, done)
+	}
+
+	if shard, ok := l.writeEntry(tag, data, 0, key, keyed, done); !ok {
+		return l.writeFailed(shard, done)
+	}
+	return nil
+}
+
+// writeFailed counts an entry that writeEntry refused: cancelled if done is closed, else dropped
+func (l *Logger) writeFailed(shard *Shard, done <-chan struct{}) error {
+	if done != nil && cancelled(done) {
+		l.stats.CancelledLogs.Add(1)
+		return errCancelled
+	}
+	l.stats.DroppedLogs.Add(1)
+	shard.countDrop()
+	return ErrBufferFull
+}
+
+// errCancelled is returned internally for logs skipped by LogBytesCtx (which returns ctx.Err())
+var errCancelled = errors.New("log cancelled")
+
+// cancelled reports whether done is closed without blocking
+func cancelled(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+// chunkRetryInterval is the pause between attempts to write a chunk while buffers are flushed
+const chunkRetryInterval = 100 * time.Microsecond
+
+// logChunked splits data into chunk entries that Reader reassembles
+// Chunks are half a shard entry so they fit in partially filled buffers; they may land in
+// different shards and flushes. If one is dropped the reader discards the whole message.
+// Returns ErrBufferFull if a chunk was dropped, or errCancelled if done closed first
+func (l *Logger) logChunked(data []byte, key uint64, keyed bool, done <-chan struct{}) error {
+	l.stats.ChunkedLogs.Add(1)
+
+	chunkSize := l.maxEntry/2 - chunkHeaderSize
+	count := (len(data) + chunkSize - 1) / chunkSize
+
+	var hdr [chunkHeaderSize]byte
+	binary.LittleEndian.PutUint64(hdr[0:8], l.nextChunkedID.Add(1))
+	binary.LittleEndian.PutUint32(hdr[12:16], uint32(count))
+
+	for i := 0; i < count; i++ {
+		binary.LittleEndian.PutUint32(hdr[8:12], uint32(i))
+		chunk := data[i*chunkSize : min((i+1)*chunkSize, len(data))]
+		if shard, ok := l.writeChunk(hdr[:], chunk, key, keyed, done); !ok {
+			return l.writeFailed(shard, done)
+		}
+	}
+	return nil
+}
+
+// writeChunk writes one chunk entry, retrying until WriteRetryTimeout (of Config.Clock) elapses or done closes
+// A large message outruns the buffers, so later chunks usually have to wait for a flush.
+// On failure, shard is the shard that refused the last attempt (see writeEntry)
+func (l *Logger) writeChunk(hdr, chunk []byte, key uint64, keyed bool, done <-chan struct{}) (shard *Shard, ok bool) {
+	deadline := l.config.Clock.Now().Add(l.config.WriteRetryTimeout)
+	for {
+		shard, ok := l.writeEntry(hdr, chunk, chunkFlag, key, keyed, done)
+		if ok {
+			return nil, true
+		}
+		if l.life.Closed() || !l.config.Clock.Now().Before(deadline) || (done != nil && cancelled(done)) {
+			return shard, false
+		}
+		time.Sleep(chunkRetryInterval)
+	}
+}
+
+// writeEntry writes one entry to a shard, falling back to the per-shard semaphore retry path
+// when the shard is full. Returns false if the entry could not be written, with the shard that
+// refused it (nil if unknown)
+// key selects the shard under ShardSelectionKeyHash when keyed is set; the permit wait ends early
+// when done closes
+func (l *Logger) writeEntry(hdr, data []byte, flags uint32, key uint64, keyed bool, done <-chan struct{}) (*Shard, bool) {
+	sc := l.acquireShards()
+	defer l.releaseShards(sc)
+
 	// First attempt: Try to write (fast path)
-	n, needsFlush, shardID := l.shardCollection.Write(data)
+	n, needsFlush, shardID := sc.writeEntry(hdr, data, flags, key, keyed)
 
 	if n > 0 {
 		// Success! Shard is already enqueued to flush channel if needsFlush=true
 		// Flush worker will accumulate and flush when threshold reached
 		l.stats.BytesWritten.Add(int64(n))
-		return
+		l.stats.BytesBuffered.Add(int64(len(data)))
+		l.stats.FastPathWrites.Add(1)
+		return nil, true
 	}
 
 	// Buffer full - use per-shard semaphore retry mechanism
-	// Use non-blocking select with timeout to avoid blocking hot path
-	shard := l.shardCollection.GetShard(shardID)
+	// Waits at most WriteRetryTimeout for the permit so the hot path is bounded
+	l.stats.RetryPathWrites.Add(1)
+	shard := sc.GetShard(shardID)
 	if shard == nil {
-		l.stats.DroppedLogs.Add(1)
-		return
+		return nil, false
 	}
+	shard.retries.Add(1)
 
-	// Increase timeout to 50ms to allow flush operations to complete
-	// Under high load, flushes can take longer, and we want to avoid dropping logs
-	timeout := time.NewTimer(50 * time.Millisecond)
-	defer timeout.Stop()
-
-	select {
-	case shard.swapSemaphore <- struct{}{}: // Acquired permit for this shard
-		defer func() { <-shard.swapSemaphore }() // Release when done
-
-		// Re-check 1: Swap might have happened by another thread
-		n, needsFlush = shard.Write(data)
-		if n > 0 {
-			// Success after re-check! Shard is already enqueued if needsFlush=true
-			l.stats.BytesWritten.Add(int64(n))
-			return
+	if !l.acquireSwapPermit(shard, done) {
+		// Timeout: Couldn't acquire semaphore in time (or the log was cancelled)
+		if done == nil || !cancelled(done) {
+			l.stats.RetryTimeouts.Add(1)
+			shard.retryTimeouts.Add(1)
 		}
+		return shard, false
+	}
+	defer func() { <-shard.swapSemaphore }() // Release when done
 
-		// Still full - trigger swap (only one thread will succeed per shard)
-		if needsFlush {
-			shard.trySwap()
-			// After swap, readyForFlush is still true (inactive buffer needs flush)
-			// But the new active buffer is empty and should accept writes
-		}
-
-		// Re-check 2: After swap, try writing again to the new active buffer
-		// The Write() method now checks buffer space before readyForFlush,
-		// so it will succeed if the new buffer has space
-		n, _ = shard.Write(data)
-		if n == 0 {
-			// Still failed after swap - this means both buffers are truly full
-			// (very rare, but possible under extreme load)
-			l.stats.DroppedLogs.Add(1)
-		} else {
-			// Success after swap! Shard is already enqueued if needsFlush=true
-			l.stats.BytesWritten.Add(int64(n))
-		}
+	// Re-check 1: Swap might have happened by another thread
+	n, needsFlush = shard.writeEntry(hdr, data, flags)
+	if n > 0 {
+		// Success after re-check! Shard is already enqueued if needsFlush=true
+		l.stats.BytesWritten.Add(int64(n))
+		l.stats.BytesBuffered.Add(int64(len(data)))
+		return nil, true
+	}
 
-	case <-timeout.C:
-		// Timeout: Couldn't acquire semaphore quickly, drop log
-		l.stats.DroppedLogs.Add(1)
+	// Still full - trigger swap (only one thread will succeed per shard)
+	// Never onto an unflushed buffer: the entry is dropped instead of reordering the shard's data
+	if needsFlush {
+		shard.swapIfFlushed()
+		// After swap, readyForFlush is still true (inactive buffer needs flush)
+		// But the new active buffer is empty and should accept writes
+	}
+
+	// Re-check 2: After swap, try writing again to the new active buffer
+	// The Write() method now checks buffer space before readyForFlush,
+	// so it will succeed if the new buffer has space
+	n, _ = shard.writeEntry(hdr, data, flags)
+	if n == 0 {
+		// Still failed after swap - this means both buffers are truly full
+		// (very rare, but possible under extreme load)
+		return shard, false
+	}
+
+	// Success after swap! Shard is already enqueued if needsFlush=true
+	l.stats.BytesWritten.Add(int64(n))
+	l.stats.BytesBuffered.Add(int64(len(data)))
+	return nil, true
+}
+
+// acquireSwapPermit takes shard's swap semaphore permit like logcore.AcquirePermit, waiting at most
+// WriteRetryTimeout of Config.Clock: a write on the retry path of a logger with a clock.Fake waits
+// until the clock is advanced past it (or a permit is released, or done closes)
+func (l *Logger) acquireSwapPermit(shard *Shard, done <-chan struct{}) bool {
+	clk := l.config.Clock
+	if _, real := clk.(clock.Real); real {
+		return logcore.AcquirePermit(shard.swapSemaphore, l.config.WriteRetryTimeout, done)
+	}
+
+	select {
+	case shard.swapSemaphore <- struct{}{}:
+		return true
+	default:
+		if l.config.WriteRetryTimeout <= 0 {
+			return false
+		}
+	}
+	timer := clk.NewTimer(l.config.WriteRetryTimeout)
+	defer timer.Stop()
+	select {
+	case shard.swapSemaphore <- struct{}{}:
+		return true
+	case <-timer.C():
+		return false
+	case <-done:
+		return false
 	}
 }
 
 // Log writes a string message to the logger (convenience API)
 func (l *Logger) Log(message string) {
 	// Convert string to []byte without allocation using unsafe
-	data := stringToBytes(message)
+	data := logcore.StringToBytes(message)
 	l.LogBytes(data)
 }
 
-// stringToBytes converts a string to []byte without allocation
-func stringToBytes(s string) []byte {
-	if len(s) == 0 {
-		return nil
-	}
-	// Use unsafe to access string's backing array directly
-	return unsafe.Slice(unsafe.StringData(s), len(s))
-}
-
-// flushWorker processes flush requests
-// Accumulates shards in a list and flushes when threshold is reached
-func (l *Logger) flushWorker() {
-	flushList := make([]*Shard, 0, l.shardCollection.NumShards())
+// flushWorker processes one flush group's flush requests
+// Accumulates shards in a list and flushes when the group's threshold is reached or, at the
+// latest, on the next FlushInterval tick
+func (l *Logger) flushWorker(g *flushGroup) {
+	defer l.workers.Done()
+	flushList := make([]*Shard, 0, len(g.shards))
 
 	for {
 		select {
-		case shard := <-l.flushChan:
-			// Deduplicate: Check if shard already in list
-			alreadyInList := false
-			for _, s := range flushList {
-				if s.ID() == shard.ID() {
-					alreadyInList = true
-					break
-				}
+		case shard := <-g.flushChan:
+			flushList = appendUnique(flushList, dequeued(shard))
+
+			// Check if threshold reached
+			if len(flushList) >= int(g.threshold.Load()) {
+				l.flushShardsEnhanced(g, g.withRetired(flushList))
+				flushList = flushList[:0] // Clear list
 			}
 
-			if !alreadyInList {
-				flushList = append(flushList, shard)
+		case <-g.earlyFlush:
+			// AdaptiveFlush: a shard is about to fill, flush the queued shards without waiting for the threshold
+			flushList = collectQueued(g, flushList)
+			if len(flushList) > 0 {
+				l.stats.EarlyFlushes.Add(1)
+				l.flushShardsEnhanced(g, g.withRetired(flushList))
+				flushList = flushList[:0]
 			}
 
-			// Check if threshold reached
-			if len(flushList) >= int(l.shardCollection.threshold) {
-				l.flushShardsEnhanced(flushList)
-				flushList = flushList[:0] // Clear list
+		case <-g.intervalFlush:
+			// A swapped-out shard waits at most one FlushInterval for the threshold: with skewed
+			// traffic the other shards may not fill, and its writers drop once both buffers are full
+			flushList = collectQueued(g, flushList)
+			if len(flushList) > 0 {
+				l.stats.IntervalFlushes.Add(1)
+				l.flushShardsEnhanced(g, g.withRetired(flushList))
+				flushList = flushList[:0]
+			}
+
+		case <-g.retryFlush:
+			// Disk-full retry: rewrite the retained buffers (and whatever else is buffered)
+			flushList = flushList[:0]
+			l.flushAllShards(g)
+
+		case reply := <-g.flushReqs:
+			// Shards already in the list are covered by the on-demand flush, so drop them
+			// rather than writing them again once the threshold is reached
+			flushList = flushList[:0]
+			reply <- l.flushAllShards(g)
+
+		case swap := <-g.swaps:
+			// Buffers resized: the queued shards are covered when the retired shards are flushed
+			if swap.shards == nil {
+				flushList = flushList[:0]
 			}
+			swap.done <- l.swapGroupShards(g, swap.shards)
 
-		case <-l.done:
+		case <-l.life.Done():
 			// Flush any remaining data in the channel and list
-			l.drainFlushChannel()
+			l.drainFlushChannel(g)
 			if len(flushList) > 0 {
-				l.flushShardsEnhanced(flushList)
+				l.flushShardsEnhanced(g, g.withRetired(flushList))
 			}
 			return
 		}
@@ -230,186 +717,162 @@ func (l *Logger) flushWorker() {
 
 // tickerWorker triggers periodic flushes
 func (l *Logger) tickerWorker() {
+	defer l.workers.Done()
+
+	// AdaptiveFlush samples fill rates between ticks (a nil channel never fires)
+	var sampleC <-chan time.Time
+	var sampler *fillRateSampler
+	if l.config.AdaptiveFlush {
+		sampleTicker := l.config.Clock.NewTicker(adaptiveSampleInterval)
+		defer sampleTicker.Stop()
+		sampleC = sampleTicker.C()
+		sampler = newFillRateSampler(l.shardCollection.Load().NumShards())
+	}
+
+	// Auto-resize compares drops and traffic across flush intervals
+	var resizer *bufferResizer
+	if l.config.MaxBufferSize > 0 {
+		resizer = newBufferResizer(l)
+	}
+
 	for {
 		select {
-		case <-l.ticker.C:
+		case <-l.ticker.C():
 			// Periodic flush: collect all ready shards and flush if threshold reached
-			if l.shardCollection.HasData() && l.shardCollection.ThresholdReached() {
-				readyShards := l.shardCollection.GetReadyShards()
-				if len(readyShards) > 0 {
-					// Send each shard individually (they may already be in flush worker's list)
-					for _, shard := range readyShards {
-						select {
-						case l.flushChan <- shard:
-							// Successfully queued
-						default:
-							// Channel full, skip (will retry next tick)
-						}
-					}
+			sc := l.shardCollection.Load()
+			if sc.HasData() && sc.ThresholdReached() {
+				// Queue each shard individually (shards already queued are coalesced)
+				for _, shard := range sc.GetReadyShards() {
+					sc.EnqueueShardForFlush(shard)
 				}
 			}
-		case <-l.done:
+			l.flushWaitingShards()
+			l.health.tick(l.stats.TotalLogs.Load(), l.stats.DroppedLogs.Load())
+			if l.retainingGroups.Load() > 0 {
+				l.retryRetainedFlushes()
+			}
+			if resizer != nil {
+				l.autoResize(resizer)
+			}
+		case now := <-sampleC:
+			l.sampleFillRates(sampler, now)
+		case <-l.life.Done():
 			return
 		}
 	}
 }
 
-// flushShardsEnhanced writes all data from ready shards to disk using batch flush
-// Handles the case where both buffers of a shard are full
-func (l *Logger) flushShardsEnhanced(readyShards []*Shard) {
+// flushWaitingShards asks each flush worker to flush the shards it holds below the threshold
+func (l *Logger) flushWaitingShards() {
+	for _, g := range l.groups {
+		select {
+		case g.intervalFlush <- struct{}{}:
+		default: // The previous tick's request is still pending
+		}
+	}
+}
+
+// flushAllShards flushes every shard of the group with data in either buffer, regardless of threshold
+// Runs on the group's flush worker; queued flush requests are discarded since their shards are included
+func (l *Logger) flushAllShards(g *flushGroup) error {
+	for drained := false; !drained; {
+		select {
+		case shard := <-g.flushChan:
+			dequeued(shard)
+		default:
+			drained = true
+		}
+	}
+
+	return l.flushShardsWithData(g, g.withRetired(g.shards))
+}
+
+// flushShardsWithData flushes the shards (of g) with data in either buffer
+func (l *Logger) flushShardsWithData(g *flushGroup, shards []*Shard) error {
+	shardsWithData := make([]*Shard, 0, len(shards))
+	for _, shard := range shards {
+		if shard.HasData() || shard.Offset() > headerOffset {
+			shardsWithData = append(shardsWithData, shard)
+		}
+	}
+	if len(shardsWithData) == 0 {
+		return nil
+	}
+	return l.flushShardsEnhanced(g, shardsWithData)
+}
+
+// flushShardsEnhanced writes all data from ready shards to the group's file using batch flush
+// Handles the case where both buffers of a shard are full. The shards must belong to g
+// Returns the write error, if any (also counted in FlushErrors)
+func (l *Logger) flushShardsEnhanced(g *flushGroup, readyShards []*Shard) error {
 	// Track flush operation timing
 	flushStart := time.Now()
+	started := l.config.Clock.Now()
 
 	// Increment queue depth (for monitoring)
 	l.stats.FlushQueueDepth.Add(1)
 	defer l.stats.FlushQueueDepth.Add(-1)
 
-	// Acquire semaphore to prevent concurrent flushes
+	// Acquire the group's semaphore to prevent concurrent flushes of its shards
 	semaphoreAcquireStart := time.Now()
-	l.semaphore <- struct{}{}
+	g.semaphore <- struct{}{}
 	semaphoreWaitDuration := time.Since(semaphoreAcquireStart)
 	if semaphoreWaitDuration > time.Millisecond {
 		// Track if we blocked waiting for semaphore
 		l.stats.BlockedSwaps.Add(1)
 	}
-	defer func() { <-l.semaphore }()
-
-	// Collect all shard buffers for batched write (single Pwritev syscall)
-	shardBuffers := make([][]byte, 0, len(readyShards)*2) // *2 in case both buffers full
-	shardsToReset := make([]*Shard, 0, len(readyShards))
-
-	for _, shard := range readyShards {
-		// Track if we need to reset this shard
-		needsReset := false
-
-		// Check inactive buffer first (normal case)
-		if shard.HasData() {
-			data, allWritesCompleted := shard.GetData(l.config.FlushTimeout)
-			if data != nil {
-				shardOffset := shard.GetInactiveOffset()
-				if shardOffset > headerOffset {
-					capacity := shard.Capacity()
-					validDataBytes := shardOffset - headerOffset
-					if validDataBytes < 0 {
-						validDataBytes = 0
-					}
-
-					if !allWritesCompleted {
-						fmt.Printf("[WARNING] Shard %d: Not all writes completed before flush timeout, flushing partial data\n", shard.ID())
-					}
-
-					if len(data) >= int(headerOffset) {
-						// Write header directly into the first 8 bytes
-						binary.LittleEndian.PutUint32(data[0:4], uint32(capacity))
-						binary.LittleEndian.PutUint32(data[4:8], uint32(validDataBytes))
-						shardBuffers = append(shardBuffers, data)
-						needsReset = true
-					}
-				}
-			}
-		}
-
-		// CRITICAL: Check if active buffer also has data (both buffers full)
-		activeOffset := shard.Offset()
-		if activeOffset > headerOffset {
-			// Active buffer also has data - need to flush it too
-			// Force swap to make active buffer inactive
-			shard.trySwap()
-
-			// Now get the data (previously active, now inactive)
-			data, allWritesCompleted := shard.GetData(l.config.FlushTimeout)
-			if data != nil {
-				shardOffset := shard.GetInactiveOffset()
-				if shardOffset > headerOffset {
-					capacity := shard.Capacity()
-					validDataBytes := shardOffset - headerOffset
-					if validDataBytes < 0 {
-						validDataBytes = 0
-					}
-
-					if !allWritesCompleted {
-						fmt.Printf("[WARNING] Shard %d: Not all writes completed before flush timeout, flushing partial data\n", shard.ID())
-					}
-
-					if len(data) >= int(headerOffset) {
-						// Write header directly into the first 8 bytes
-						binary.LittleEndian.PutUint32(data[0:4], uint32(capacity))
-						binary.LittleEndian.PutUint32(data[4:8], uint32(validDataBytes))
-						shardBuffers = append(shardBuffers, data)
-						needsReset = true
-					}
-				}
-			}
+	defer func() { <-g.semaphore }()
+
+	// Write the shards' inactive buffers in one batched write (single Pwritev syscall). A shard
+	// whose active buffer also has data (both buffers full) is swapped and written in a second
+	// batch once its inactive buffer has been reset: swapping first would make the buffer being
+	// written active again, and entries appended to it would be wiped by the reset
+	var flushErr error
+	var observation FlushObservation
+	var wroteData bool
+	partialShards := 0
+	for pending := readyShards; len(pending) > 0; {
+		batch, next := l.collectFlushBatch(pending)
+		pending = next
+		if len(batch.buffers) == 0 {
+			continue
 		}
-
-		if needsReset {
-			shardsToReset = append(shardsToReset, shard)
+		wroteData = true
+		partialShards += batch.partial
+		err := l.writeFlushBatch(g, batch, &observation)
+		if err != nil && flushErr == nil {
+			flushErr = err
 		}
-	}
-
-	// Single batched write for all shards - track timing
-	if len(shardBuffers) > 0 {
-		writeStart := time.Now()
-		_, err := l.fileWriter.WriteVectored(shardBuffers)
-		writeDuration := time.Since(writeStart)
 
-		// Track write duration (includes rotation checks)
-		writeDurationNs := writeDuration.Nanoseconds()
-		l.stats.TotalWriteDuration.Add(writeDurationNs)
-
-		// Update max write duration atomically
-		for {
-			currentMax := l.stats.MaxWriteDuration.Load()
-			if writeDurationNs <= currentMax {
-				break
-			}
-			if l.stats.MaxWriteDuration.CompareAndSwap(currentMax, writeDurationNs) {
-				break
-			}
+		// Disk full: the buffers keep their data for a retry. Later batches hold newer entries of
+		// the same shards, so they wait too
+		if err != nil && l.keepFailedBatch(g, batch, err) {
+			break
 		}
 
-		// Track Pwritev syscall duration (pure disk I/O, excludes rotation checks)
-		pwritevDuration := l.fileWriter.GetLastPwritevDuration()
-		if pwritevDuration > 0 {
-			pwritevDurationNs := pwritevDuration.Nanoseconds()
-			l.stats.TotalPwritevDuration.Add(pwritevDurationNs)
-
-			// Update max Pwritev duration atomically
-			for {
-				currentMax := l.stats.MaxPwritevDuration.Load()
-				if pwritevDurationNs <= currentMax {
-					break
-				}
-				if l.stats.MaxPwritevDuration.CompareAndSwap(currentMax, pwritevDurationNs) {
-					break
-				}
-			}
+		// Reset the flushed buffers; entries written to the other buffer during the flush are kept
+		for i, shard := range batch.shards {
+			shard.resetBuffers(batch.flushed[i : i+1])
 		}
-
-		if err != nil {
+	}
+	if wroteData {
+		if flushErr != nil {
 			l.stats.FlushErrors.Add(1)
-			// Calculate total bytes for error message
-			totalBytes := 0
-			for _, buf := range shardBuffers {
-				totalBytes += len(buf)
-			}
-			fmt.Printf("[FLUSH_ERROR] Shards=%d Bytes=%d Error=%v Duration=%v\n",
-				len(shardBuffers), totalBytes, err, writeDuration)
-			// Continue processing - reset shards even on error to prevent deadlock
+			l.flushErrorsInRow.Add(1)
 		} else {
-			// Note: BytesWritten is already counted when data is written to buffers in LogBytes()
-			// We don't count again here to avoid double-counting
 			l.stats.Flushes.Add(1)
+			l.flushErrorsInRow.Store(0)
+			l.lastFlushOK.Store(time.Now().UnixNano())
+			l.flushSucceeded(g)
 		}
 	}
 
-	// Reset all shards that were flushed (enhanced Reset handles both buffers)
-	for _, shard := range shardsToReset {
-		shard.ResetEnhanced()
+	if partialShards > 0 {
+		l.recordPartialFlush(partialShards, started)
 	}
 
 	// Reset ready shards count
-	l.shardCollection.ResetReadyShards()
+	l.shardCollection.Load().ResetReadyShards()
 
 	// Track flush duration
 	flushDuration := time.Since(flushStart)
@@ -426,33 +889,292 @@ func (l *Logger) flushShardsEnhanced(readyShards []*Shard) {
 			break
 		}
 	}
+	logcore.StoreMax(&l.stats.interval.flush, flushDurationNs)
+
+	// Per-worker statistics and the flush observer only count flushes that wrote (or failed to
+	// write) data, matching the Flushes/FlushErrors counters
+	if wroteData {
+		g.recordFlush(flushDuration, flushErr)
+	}
+	if observer := l.flushObserver.Load(); observer != nil && wroteData {
+		observation.Duration = flushDuration
+		observation.Err = flushErr
+		(*observer)(observation)
+	}
+	return flushErr
 }
 
-// drainFlushChannel drains any remaining flush requests from the channel
-func (l *Logger) drainFlushChannel() {
-	flushList := make([]*Shard, 0, l.shardCollection.NumShards())
+// flushBatch is the shard buffers written by one WriteVectored call
+type flushBatch struct {
+	buffers   [][]byte  // Sealed shard buffers, in write order
+	shards    []*Shard  // Shards with buffers in the batch
+	flushed   []*[]byte // Buffer of shards[i] included in buffers (reset after the write)
+	dataBytes int64     // Valid data bytes (excluding headers) in buffers
+	entries   int64     // Entries in buffers
+	payload   int64     // Log payload bytes of the entries
+	header    int64     // Shard headers, checksum trailers and entry framing in buffers
+	padding   int64     // Bytes of buffers after the entries
+	partial   int       // Buffers sealed after FlushTimeout with writes still in progress
+}
 
-	for {
-		select {
-		case shard := <-l.flushChan:
-			// Deduplicate
-			alreadyInList := false
-			for _, s := range flushList {
-				if s.ID() == shard.ID() {
-					alreadyInList = true
-					break
-				}
+// collectFlushBatch adds the sealed inactive buffer of each shard with data to a batch
+// Buffers swapped out by a writer were already sealed by it; the rest (swapped here or by the
+// flush path) are sealed now. A shard with data only in its active buffer is swapped first.
+// Shards whose active buffer also has data are returned in next, to be swapped and collected
+// after the batch is written
+func (l *Logger) collectFlushBatch(shards []*Shard) (batch flushBatch, next []*Shard) {
+	batch.buffers = make([][]byte, 0, len(shards))
+	for _, shard := range shards {
+		activeHasData := false
+		if !shard.HasData() {
+			if shard.Offset() <= headerOffset {
+				continue
 			}
-			if !alreadyInList {
-				flushList = append(flushList, shard)
+			// Only the active buffer has data: swap so it becomes inactive (flushable)
+			// The inactive buffer is empty, so the new active buffer holds no unflushed data
+			shard.trySwap()
+		} else {
+			activeHasData = shard.Offset() > headerOffset
+		}
+
+		sealed, ok := shard.takeSealed()
+		if ok {
+			l.stats.PresealedBuffers.Add(1)
+		} else if sealed, ok = l.sealForFlush(shard); !ok {
+			// Nothing committed to write: once the inactive buffer is empty, the active one follows
+			if activeHasData && !shard.HasData() {
+				next = append(next, shard)
 			}
+			continue
+		}
+		if !sealed.complete {
+			// The inactive buffer keeps the rest of its entries, so the active one waits its turn
+			batch.partial++
+		} else if activeHasData {
+			// Both buffers have data: the inactive one is older, write it first
+			next = append(next, shard)
+		}
+
+		batch.buffers = append(batch.buffers, sealed.data)
+		batch.shards = append(batch.shards, shard)
+		batch.flushed = append(batch.flushed, sealed.buf)
+		batch.dataBytes += int64(sealed.dataBytes)
+		batch.entries += sealed.entries
+		batch.payload += sealed.payload
+		overhead := int64(headerOffset + shard.capacity - shard.limit) // Shard header and checksum trailer
+		batch.header += overhead + int64(sealed.dataBytes) - sealed.payload
+		batch.padding += int64(len(sealed.data)) - overhead - int64(sealed.dataBytes)
+	}
+	return batch, next
+}
+
+// partialFlushWarnInterval is the least time between two partial flush warnings of one logger
+const partialFlushWarnInterval = 10 * time.Second
+
+// recordPartialFlush counts a flush in which shards shard buffers still had writes in progress when
+// FlushTimeout expired, and warns through InternalLogger at most once per partialFlushWarnInterval
+func (l *Logger) recordPartialFlush(shards int, start time.Time) {
+	l.stats.PartialFlushes.Add(1)
+	l.stats.LastPartialFlushUnixNano.Store(start.UnixNano())
+
+	suppressed := l.partialsSinceWarned.Add(1) - 1
+	last := l.partialWarnedAt.Load()
+	if last != 0 && start.Sub(time.Unix(0, last)) < partialFlushWarnInterval {
+		return
+	}
+	l.partialWarnedAt.Store(start.UnixNano())
+	l.partialsSinceWarned.Store(0)
+	l.config.InternalLogger.Printf("[WARNING] Logger=%s: %d shard(s): Not all writes completed before flush timeout (FlushTimeout=%v), flushing committed entries only; the rest are left for the next flush (%d more partial flushes since the last warning)",
+		l.config.LogFilePath, shards, time.Duration(l.flushTimeout.Load()), suppressed)
+}
+
+// sealForFlush seals a shard's inactive buffer on the flush worker (it was not sealed on swap)
+// Returns false if the inactive buffer holds no entries to write
+func (l *Logger) sealForFlush(shard *Shard) (sealedBuffer, bool) {
+	return shard.seal(time.Duration(l.flushTimeout.Load()), l.config.EnableChecksums)
+}
+
+// writeFlushBatch writes a batch to the group's file and records write timing and entry counts
+// Timing is added to observation; returns the write error (the caller counts the flush)
+func (l *Logger) writeFlushBatch(g *flushGroup, batch flushBatch, observation *FlushObservation) error {
+	totalBytes := 0
+	for _, buf := range batch.buffers {
+		totalBytes += len(buf)
+	}
+	writeStart := time.Now()
+	n, err := g.fileWriter.WriteVectored(batch.buffers)
+	writeDuration := time.Since(writeStart)
+	if err == nil && n < totalBytes {
+		// The writer stopped early without an error: the batch is not on disk
+		err = io.ErrShortWrite
+	}
+	observation.WriteDuration += writeDuration
+
+	// Track write duration (includes rotation checks)
+	writeDurationNs := writeDuration.Nanoseconds()
+	l.stats.TotalWriteDuration.Add(writeDurationNs)
+	logcore.StoreMax(&l.stats.MaxWriteDuration, writeDurationNs)
+	logcore.StoreMax(&l.stats.interval.write, writeDurationNs)
+
+	// Track Pwritev syscall duration (pure disk I/O, excludes rotation checks)
+	pwritevDuration := g.fileWriter.GetLastPwritevDuration()
+	observation.PwritevDuration += pwritevDuration
+	if pwritevDuration > 0 {
+		pwritevDurationNs := pwritevDuration.Nanoseconds()
+		l.stats.TotalPwritevDuration.Add(pwritevDurationNs)
+		logcore.StoreMax(&l.stats.MaxPwritevDuration, pwritevDurationNs)
+		logcore.StoreMax(&l.stats.interval.pwritev, pwritevDurationNs)
+	}
+
+	// Track io_uring submit vs completion latency
+	if iow, ok := g.fileWriter.(ioBackendWriter); ok {
+		submitNs := iow.GetLastSubmitDuration().Nanoseconds()
+		completionNs := iow.GetLastCompletionDuration().Nanoseconds()
+		l.stats.TotalSubmitDuration.Add(submitNs)
+		l.stats.TotalCompletionDuration.Add(completionNs)
+		logcore.StoreMax(&l.stats.MaxSubmitDuration, submitNs)
+		logcore.StoreMax(&l.stats.MaxCompletionDuration, completionNs)
+		logcore.StoreMax(&l.stats.interval.submit, submitNs)
+		logcore.StoreMax(&l.stats.interval.completion, completionNs)
+	}
+
+	if err != nil {
+		l.config.InternalLogger.Printf("[FLUSH_ERROR] Logger=%s Shards=%d Bytes=%d Error=%v Duration=%v",
+			l.config.LogFilePath, len(batch.buffers), totalBytes, err, writeDuration)
+		// The caller keeps the buffers for a retry (disk full) or resets them, losing the entries
+		return err
+	}
+
+	// Note: BytesWritten is already counted when data is written to buffers in LogBytes()
+	// We don't count again here to avoid double-counting
+	l.stats.BytesFlushed.Add(batch.dataBytes)
+	l.stats.EntriesFlushed.Add(batch.entries)
+	l.stats.BytesDurable.Add(batch.payload)
+	l.stats.HeaderBytesFlushed.Add(batch.header)
+	l.stats.PaddingBytesFlushed.Add(batch.padding)
+	observation.Bytes += batch.dataBytes
+	observation.PayloadBytes += batch.payload
+	observation.HeaderBytes += batch.header
+	observation.PaddingBytes += batch.padding
+	return nil
+}
+
+// FlushObservation describes one flush that wrote data, as passed to a flush observer
+type FlushObservation struct {
+	Duration        time.Duration // Whole flush, including waiting for in-flight writes
+	WriteDuration   time.Duration // WriteVectored() (includes rotation checks)
+	PwritevDuration time.Duration // Pwritev syscall only (pure disk I/O)
+	Bytes           int64         // Log data bytes flushed (excluding headers and padding); zero when Err is set
+	Err             error         // Write error (also counted in FlushErrors)
+
+	// Split of the bytes written into payload, headers and entry framing, and padding; zero when Err is set
+	PayloadBytes int64
+	HeaderBytes  int64
+	PaddingBytes int64
+}
+
+// SetFlushObserver registers fn to be called after every flush that wrote data; nil removes it
+// fn runs on the flush path, so it must be fast and must not call back into the logger
+func (l *Logger) SetFlushObserver(fn func(FlushObservation)) {
+	if fn == nil {
+		l.flushObserver.Store(nil)
+		return
+	}
+	l.flushObserver.Store(&fn)
+}
+
+// drainFlushChannel drains any remaining flush requests from the group's channel
+func (l *Logger) drainFlushChannel(g *flushGroup) {
+	flushList := collectQueued(g, make([]*Shard, 0, len(g.shards)))
+	if len(flushList) > 0 {
+		l.flushShardsEnhanced(g, g.withRetired(flushList))
+	}
+}
+
+// collectQueued adds the shards waiting in the group's flush channel to flushList without blocking
+func collectQueued(g *flushGroup, flushList []*Shard) []*Shard {
+	for {
+		select {
+		case shard := <-g.flushChan:
+			flushList = appendUnique(flushList, dequeued(shard))
 		default:
-			if len(flushList) > 0 {
-				l.flushShardsEnhanced(flushList)
+			return flushList
+		}
+	}
+}
+
+// appendUnique appends shard to flushList unless it is already in it
+// Compared by identity: a resize's retired shards share IDs with their replacements
+func appendUnique(flushList []*Shard, shard *Shard) []*Shard {
+	for _, s := range flushList {
+		if s == shard {
+			return flushList
+		}
+	}
+	return append(flushList, shard)
+}
+
+// Flush writes all data logged before the call to the log file and waits for it
+// Each flush worker flushes its shards alongside threshold and periodic flushes, so it is safe to
+// call under concurrent LogBytes traffic and never writes a shard twice. With O_DSYNC (or the
+// fdatasync used with io_uring) the data is on disk when Flush returns nil. Returns ErrClosed if
+// the logger is closed, ctx.Err() if ctx ends first (the flush still completes in the background),
+// or the first flush write error
+func (l *Logger) Flush(ctx context.Context) error {
+	if l.life.Closed() {
+		return ErrClosed
+	}
+
+	// Every worker replies once; the buffer lets workers reply after ctx has ended
+	reply := make(chan error, len(l.groups))
+	for _, g := range l.groups {
+		select {
+		case g.flushReqs <- reply:
+		case <-l.life.Done():
+			return ErrClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	var flushErr error
+	for range l.groups {
+		select {
+		case err := <-reply:
+			if err != nil && flushErr == nil {
+				flushErr = fmt.Errorf("flush failed: %w", err)
 			}
-			return
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
+	return flushErr
+}
+
+// Reopen makes every flush worker re-create its current file if an external tool (e.g. logrotate)
+// renamed or removed it, so writing continues at the file's path (see SizeFileWriter.Reopen).
+// A flush in progress finishes first and the next one waits for the reopen. Writers without
+// Reopen (NewLoggerWithWriter) are skipped. Returns ErrClosed if the logger is closed, or the first
+// reopen error
+func (l *Logger) Reopen() error {
+	if l.life.Closed() {
+		return ErrClosed
+	}
+
+	var firstErr error
+	for _, g := range l.groups {
+		reopener, ok := g.fileWriter.(interface{ Reopen() error })
+		if !ok {
+			continue
+		}
+		g.semaphore <- struct{}{}
+		err := reopener.Reopen()
+		<-g.semaphore
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
 
 // GetStats returns a snapshot of the current statistics
@@ -475,142 +1197,449 @@ func (l *Logger) GetStats() Statistics {
 }
 
 // GetStatsSnapshot returns a snapshot of current statistics values
-func (l *Logger) GetStatsSnapshot() (totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps int64) {
-	return l.stats.TotalLogs.Load(),
-		l.stats.DroppedLogs.Load(),
-		l.stats.BytesWritten.Load(),
-		l.stats.Flushes.Load(),
-		l.stats.FlushErrors.Load(),
-		0 // setSwaps not applicable for per-shard swap
+// bytesWritten counts buffered bytes including length prefixes; bytesBuffered and bytesDurable count
+// log payload only (see Statistics.BytesBuffered, BytesDurable)
+func (l *Logger) GetStatsSnapshot() (totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, bytesBuffered, bytesDurable int64) {
+	stats := l.loadStats()
+	return stats.TotalLogs,
+		stats.DroppedLogs,
+		stats.BytesWritten,
+		stats.Flushes,
+		stats.FlushErrors,
+		0, // setSwaps not applicable for per-shard swap
+		stats.BytesBuffered,
+		stats.BytesDurable
+}
+
+// GetStatsStruct returns all statistics counters as a struct, including those GetStatsSnapshot
+// leaves out such as PartialFlushes and LastPartialFlushUnixNano
+func (l *Logger) GetStatsStruct() StatsSnapshot {
+	return l.loadStats()
+}
+
+// GetMessageSizeStats returns how many logs were rejected for exceeding MaxMessageSize
+// and how many were split into chunk entries
+func (l *Logger) GetMessageSizeStats() (oversized, chunked int64) {
+	return l.stats.OversizedLogs.Load(), l.stats.ChunkedLogs.Load()
+}
+
+// GetWritePathStats returns how many writes succeeded on the fast path, entered the retry path,
+// and were dropped because the retry path timed out waiting for a swap permit
+func (l *Logger) GetWritePathStats() (fastPath, retryPath, retryTimeouts int64) {
+	return l.stats.FastPathWrites.Load(),
+		l.stats.RetryPathWrites.Load(),
+		l.stats.RetryTimeouts.Load()
+}
+
+// GetWriteLatencyHistogram returns LogBytes call durations by bucket (see WriteLatencyBuckets)
+// All counts stay zero unless Config.TrackWriteLatency is set
+func (l *Logger) GetWriteLatencyHistogram() WriteLatencyHistogram {
+	return l.stats.WriteLatency.load()
 }
 
 // GetFlushMetrics returns flush performance metrics
 func (l *Logger) GetFlushMetrics() FlushMetrics {
-	flushes := l.stats.Flushes.Load()
-	if flushes == 0 {
-		return FlushMetrics{}
-	}
-
-	avgFlushDuration := time.Duration(l.stats.TotalFlushDuration.Load() / flushes)
-	maxFlushDuration := time.Duration(l.stats.MaxFlushDuration.Load())
-	avgWriteDuration := time.Duration(l.stats.TotalWriteDuration.Load() / flushes)
-	maxWriteDuration := time.Duration(l.stats.MaxWriteDuration.Load())
-	avgPwritevDuration := time.Duration(l.stats.TotalPwritevDuration.Load() / flushes)
-	maxPwritevDuration := time.Duration(l.stats.MaxPwritevDuration.Load())
+	return flushMetricsFrom(l.loadStats())
+}
 
-	writePercent := 0.0
-	if avgFlushDuration > 0 {
-		writePercent = float64(avgWriteDuration) / float64(avgFlushDuration) * 100.0
+// flushMetricsFrom derives flush metrics from loaded counters
+// Deriving from one StatsSnapshot keeps flush metrics consistent with the counters reported alongside them
+func flushMetricsFrom(stats StatsSnapshot) FlushMetrics {
+	metrics := FlushMetrics{
+		TotalFlushDuration:    time.Duration(stats.TotalFlushDuration),
+		MaxFlushDuration:      time.Duration(stats.MaxFlushDuration),
+		FlushQueueDepth:       stats.FlushQueueDepth,
+		BlockedSwaps:          stats.BlockedSwaps,
+		TotalFlushes:          stats.Flushes,
+		FlushErrors:           stats.FlushErrors,
+		MaxWriteDuration:      time.Duration(stats.MaxWriteDuration),
+		MaxPwritevDuration:    time.Duration(stats.MaxPwritevDuration),
+		MaxSubmitDuration:     time.Duration(stats.MaxSubmitDuration),
+		MaxCompletionDuration: time.Duration(stats.MaxCompletionDuration),
+
+		PayloadBytes:            stats.BytesDurable,
+		HeaderBytes:             stats.HeaderBytesFlushed,
+		PaddingBytes:            stats.PaddingBytesFlushed,
+		WriteAmplificationRatio: writeAmplification(stats.BytesDurable, stats.HeaderBytesFlushed, stats.PaddingBytesFlushed),
+	}
+	flushes := stats.Flushes
+	if flushes == 0 {
+		return metrics
 	}
 
-	pwritevPercent := 0.0
-	if avgFlushDuration > 0 {
-		pwritevPercent = float64(avgPwritevDuration) / float64(avgFlushDuration) * 100.0
+	metrics.AvgFlushDuration = time.Duration(stats.TotalFlushDuration / flushes)
+	metrics.AvgWriteDuration = time.Duration(stats.TotalWriteDuration / flushes)
+	metrics.AvgPwritevDuration = time.Duration(stats.TotalPwritevDuration / flushes)
+	metrics.AvgSubmitDuration = time.Duration(stats.TotalSubmitDuration / flushes)
+	metrics.AvgCompletionDuration = time.Duration(stats.TotalCompletionDuration / flushes)
+	if metrics.AvgFlushDuration > 0 {
+		metrics.WritePercent = float64(metrics.AvgWriteDuration) / float64(metrics.AvgFlushDuration) * 100.0
+		metrics.PwritevPercent = float64(metrics.AvgPwritevDuration) / float64(metrics.AvgFlushDuration) * 100.0
 	}
+	return metrics
+}
 
-	return FlushMetrics{
-		AvgFlushDuration:   avgFlushDuration,
-		MaxFlushDuration:   maxFlushDuration,
-		AvgWriteDuration:   avgWriteDuration,
-		MaxWriteDuration:   maxWriteDuration,
-		WritePercent:       writePercent,
-		AvgPwritevDuration: avgPwritevDuration,
-		MaxPwritevDuration: maxPwritevDuration,
-		PwritevPercent:     pwritevPercent,
+// writeAmplification returns the bytes written per payload byte (0 before any payload is written)
+func writeAmplification(payload, header, padding int64) float64 {
+	if payload == 0 {
+		return 0
 	}
+	return float64(payload+header+padding) / float64(payload)
 }
 
 // FlushMetrics holds flush performance metrics
+// The fields up to WriteAmplificationRatio match asynclogger.FlushMetrics, so both packages report alike
 type FlushMetrics struct {
-	AvgFlushDuration   time.Duration
-	MaxFlushDuration   time.Duration
-	AvgWriteDuration   time.Duration
-	MaxWriteDuration   time.Duration
-	WritePercent       float64
-	AvgPwritevDuration time.Duration
-	MaxPwritevDuration time.Duration
-	PwritevPercent     float64
+	TotalFlushDuration time.Duration // Total time spent in flush operations
+	AvgFlushDuration   time.Duration // Average flush duration
+	MaxFlushDuration   time.Duration // Maximum flush duration seen
+	FlushQueueDepth    int64         // Flushes in progress now (summed across loggers when aggregated)
+	BlockedSwaps       int64         // Number of swaps that blocked waiting for a flush
+	TotalFlushes       int64         // Total number of flushes
+	FlushErrors        int64         // Flushes whose write failed
+
+	// I/O breakdown
+	AvgWriteDuration time.Duration // Average time for WriteVectored() (includes rotation checks)
+	MaxWriteDuration time.Duration // Maximum write duration
+	WritePercent     float64       // % of flush time spent in write
+
+	// Pwritev syscall timing (pure disk I/O, excludes rotation checks)
+	AvgPwritevDuration time.Duration // For io_uring: submit + completion
+	MaxPwritevDuration time.Duration // Maximum Pwritev duration
+	PwritevPercent     float64       // % of flush time spent in Pwritev syscall
+
+	// Bytes written by successful flushes (summed across loggers when aggregated)
+	PayloadBytes            int64   // Log payload (StatsSnapshot.BytesDurable)
+	HeaderBytes             int64   // Shard headers, checksum trailers and entry framing (length prefixes, chunk headers, route tags)
+	PaddingBytes            int64   // Shard bytes after the entries (every shard is written in full)
+	WriteAmplificationRatio float64 // (PayloadBytes + HeaderBytes + PaddingBytes) / PayloadBytes; 0 before any payload
+
+	// io_uring backend only (zero for pwritev)
+	AvgSubmitDuration     time.Duration // Time in io_uring_enter submitting SQEs
+	MaxSubmitDuration     time.Duration
+	AvgCompletionDuration time.Duration // Time waiting for the kernel to confirm writes
+	MaxCompletionDuration time.Duration
 }
 
 // StatsSnapshot is a snapshot of statistics values (safe to copy)
 type StatsSnapshot struct {
-	TotalLogs            int64
-	DroppedLogs          int64
-	BytesWritten         int64
-	Flushes              int64
-	FlushErrors          int64
-	TotalFlushDuration   int64
-	MaxFlushDuration     int64
-	FlushQueueDepth      int64
-	BlockedSwaps         int64
-	TotalWriteDuration   int64
-	MaxWriteDuration     int64
-	TotalPwritevDuration int64
-	MaxPwritevDuration   int64
-}
-
-// Close gracefully shuts down the logger
+	TotalLogs                int64
+	DroppedLogs              int64
+	BytesWritten             int64
+	BytesFlushed             int64
+	BytesBuffered            int64
+	BytesDurable             int64
+	HeaderBytesFlushed       int64
+	PaddingBytesFlushed      int64
+	Flushes                  int64
+	FlushErrors              int64
+	TotalFlushDuration       int64
+	MaxFlushDuration         int64
+	FlushQueueDepth          int64
+	BlockedSwaps             int64
+	EarlyFlushes             int64
+	IntervalFlushes          int64
+	FlushesCoalesced         int64
+	PresealedBuffers         int64
+	PartialFlushes           int64
+	LastPartialFlushUnixNano int64 // When the last partial flush started; 0 if none
+	BufferGrowths            int64
+	BufferShrinks            int64
+	TotalWriteDuration       int64
+	MaxWriteDuration         int64
+	TotalPwritevDuration     int64
+	MaxPwritevDuration       int64
+	FreeSpaceDrops           int64
+	DiskFullDrops            int64
+	FlushRetries             int64
+	RetentionFilesDeleted    int64
+	RetentionBytesReclaimed  int64
+	CompressedFiles          int64
+	CompressionFailures      int64
+	CompressionBytesIn       int64
+	CompressionBytesOut      int64
+	TotalCompressionDuration int64
+	FastPathWrites           int64
+	RetryPathWrites          int64
+	RetryTimeouts            int64
+	SpilledWrites            int64
+	OversizedLogs            int64
+	ChunkedLogs              int64
+	CancelledLogs            int64
+	SampledOutLogs           int64
+	RateLimitedLogs          int64
+	DrainRejectedLogs        int64
+	TotalSubmitDuration      int64
+	MaxSubmitDuration        int64
+	TotalCompletionDuration  int64
+	MaxCompletionDuration    int64
+	WriteLatency             WriteLatencyHistogram // Zero unless Config.TrackWriteLatency
+}
+
+// DefaultCloseTimeout bounds how long Close waits for pending data to be flushed
+const DefaultCloseTimeout = 10 * time.Second
+
+// CloseReport describes what happened to buffered data during Close
+type CloseReport struct {
+	EntriesFlushed   int64 // Entries written to disk during Close (queued and buffered shards)
+	BytesFlushed     int64 // Log data bytes written during Close (excluding headers and padding)
+	EntriesDropped   int64 // Buffered entries not confirmed on disk: failed final flushes, or left at the deadline
+	DeadlineExceeded bool  // The context ended before all pending data was flushed (or uploaded)
+
+	// Files of the logger (the last one and any rotated ones) not yet uploaded when Close returned;
+	// zero without Config.UploadTracker
+	PendingUploads int
+}
+
+// Close gracefully shuts down the logger, flushing all pending data
+// Equivalent to CloseWithTimeout(DefaultCloseTimeout) without the report
 func (l *Logger) Close() error {
-	if !l.closed.CompareAndSwap(false, true) {
-		return nil // Already closed
+	_, err := l.CloseWithTimeout(DefaultCloseTimeout)
+	return err
+}
+
+// CloseWithTimeout is CloseContext with a deadline of d from now (of Config.Clock)
+func (l *Logger) CloseWithTimeout(d time.Duration) (CloseReport, error) {
+	ctx, cancel := withClockTimeout(l.config.Clock, d)
+	defer cancel()
+	return l.CloseContext(ctx)
+}
+
+// withClockTimeout is context.WithTimeout timed by clk. With a clock other than clock.Real the
+// context is canceled when clk reaches the deadline, with context.DeadlineExceeded as its cause
+func withClockTimeout(clk clock.Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	if _, real := clk.(clock.Real); real {
+		return context.WithTimeout(context.Background(), d)
+	}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	timer := clk.NewTimer(d)
+	go func() {
+		select {
+		case <-timer.C():
+			cancel(context.DeadlineExceeded)
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}()
+	return ctx, func() { cancel(context.Canceled) }
+}
+
+// CloseContext shuts down the logger: it stops accepting writes, waits for the flush worker to
+// finish the in-progress and queued flushes, flushes every shard with data and closes the file.
+// If ctx ends first, it returns context.Cause(ctx) with DeadlineExceeded set; the remaining shards
+// are not flushed, and the shard buffers and file are released in the background once the
+// in-progress write returns. Closing an already closed logger waits for the first Close to finish
+// flushing (or ctx to end), then returns an empty report and nil.
+//
+// Close completes the last file like a rotation (FileClosed): it is truncated to its data and
+// queued for upload. With Config.UploadTracker and a started Uploader, CloseContext then waits
+// until the logger's files are uploaded, so the tail of the log is not left on local disk; files
+// still pending when ctx ends (or the Uploader stops) are counted in PendingUploads.
+func (l *Logger) CloseContext(ctx context.Context) (CloseReport, error) {
+	core, first, err := l.life.Close(ctx, perShardSwap{l}, l.stopBackground)
+	report := CloseReport{
+		EntriesFlushed:   core.EntriesFlushed,
+		BytesFlushed:     core.BytesFlushed,
+		EntriesDropped:   core.EntriesDropped,
+		DeadlineExceeded: core.DeadlineExceeded,
+	}
+	if !first {
+		return report, nil // Already closed
 	}
 
-	// Stop ticker
+	if err == nil {
+		if err = l.waitUploads(ctx); err != nil {
+			report.DeadlineExceeded = true
+		}
+	}
+	if tracker := l.config.UploadTracker; tracker != nil {
+		report.PendingUploads = len(tracker.pendingMatching(l.ownsRotatedFile))
+	}
+	return report, err
+}
+
+// waitUploads waits until no file of the logger is waiting for upload, or until ctx ends
+// Returns at once without Config.UploadTracker, and once no Uploader is attached to it
+func (l *Logger) waitUploads(ctx context.Context) error {
+	tracker := l.config.UploadTracker
+	if tracker == nil {
+		return nil
+	}
+	wake := make(chan struct{}, 1)
+	tracker.subscribe(wake)
+	defer tracker.unsubscribe(wake)
+	for {
+		pending := len(tracker.pendingMatching(l.ownsRotatedFile))
+		if pending == 0 || !tracker.attached() {
+			return nil
+		}
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return fmt.Errorf("close: %d files not uploaded: %w", pending, ctx.Err())
+		}
+	}
+}
+
+// stopBackground stops the ticker and the background jobs before Close stops the workers: free-space
+// sampling and retention (files rotated by the final flush are left for the next run)
+func (l *Logger) stopBackground() {
 	l.ticker.Stop()
+	if l.freeSpace != nil {
+		l.freeSpace.stop()
+	}
+	if l.retention != nil {
+		l.retention.stop()
+	}
+}
 
-	// Signal shutdown (this will cause flushWorker to drain channel and exit)
-	close(l.done)
+// perShardSwap is the logcore.SwapStrategy of Logger: each shard swaps its own two buffers, and
+// each flush group writes its shards to its own file
+type perShardSwap struct {
+	l *Logger
+}
 
-	// First, drain any pending flushes from the channel
-	// This ensures any flushes already queued complete before we do our final flush
-	l.drainFlushChannel()
+// Counters returns the entries flushed and lost and the bytes flushed (see CloseReport)
+func (s perShardSwap) Counters() (entriesFlushed, entriesLost, bytesFlushed int64) {
+	return s.l.stats.EntriesFlushed.Load(), s.l.stats.EntriesLost.Load(), s.l.stats.BytesFlushed.Load()
+}
 
-	// Wait for any ongoing flush to complete by acquiring and releasing the semaphore
-	// This ensures no flush is in progress before we swap buffers
-	// We acquire and immediately release to ensure the flush worker has finished
-	// Use a timeout to prevent deadlock if flush worker is stuck
-	timeout := time.NewTimer(5 * time.Second)
-	defer timeout.Stop()
+// WaitIdle waits for the workers: the flush worker drains queued flushes before exiting, so no
+// flush is in progress after this
+func (s perShardSwap) WaitIdle(abandon *atomic.Bool) {
+	s.l.workers.Wait()
+}
 
-	select {
-	case l.semaphore <- struct{}{}:
-		// Successfully acquired semaphore - flush worker has finished
-		<-l.semaphore
-	case <-timeout.C:
-		// Timeout: flush worker might be stuck, but we'll proceed anyway
-		// This prevents deadlock during shutdown
-		fmt.Printf("[WARNING] Timeout waiting for flush semaphore during Close(), proceeding anyway\n")
-	}
-
-	// Now it's safe to prepare shards for final flush
-	// Get all shards with data, not just ready ones (threshold doesn't matter during close)
-	allShards := l.shardCollection.Shards()
-	shardsWithData := make([]*Shard, 0, len(allShards))
-	for _, shard := range allShards {
-		// Check if shard has data in active buffer
-		if shard.Offset() > headerOffset {
-			// Data is in active buffer - need to swap first so GetData() can access it
-			// It's safe to swap now because:
-			// 1. We've drained the flush channel (no pending flushes)
-			// 2. We've confirmed no flush is in progress (semaphore was available)
-			// 3. The inactive buffer (if any) was already flushed or is empty
-			shard.readyForFlush.Store(true)
-			shard.trySwap() // Swap so active buffer becomes inactive (flushable)
-			shardsWithData = append(shardsWithData, shard)
-		} else if shard.HasData() {
-			// Has data in inactive buffer (already flushable)
-			shardsWithData = append(shardsWithData, shard)
+// FlushRemaining flushes each group's remaining data to its own file
+func (s perShardSwap) FlushRemaining(abandon *atomic.Bool) error {
+	var flushErr error
+	for _, g := range s.l.groups {
+		// Get all shards with data, not just ready ones (threshold doesn't matter during close)
+		// Retired shards of an interrupted resize first, ahead of their replacements
+		shards := g.withRetired(g.shards)
+		shardsWithData := make([]*Shard, 0, len(shards))
+		for _, shard := range shards {
+			if shard.HasData() {
+				// Has data in inactive buffer (already flushable); the flush takes the active one after it
+				shardsWithData = append(shardsWithData, shard)
+			} else if shard.Offset() > headerOffset {
+				// Data is in active buffer - need to swap first so GetData() can access it
+				// It's safe to swap now because the workers have exited, so no flush is in
+				// progress and the inactive buffer is empty
+				shard.readyForFlush.Store(true)
+				shard.trySwap() // Swap so active buffer becomes inactive (flushable)
+				shardsWithData = append(shardsWithData, shard)
+			}
+		}
+
+		// Flush remaining data (flushShardsEnhanced will acquire semaphore itself)
+		if len(shardsWithData) > 0 && !abandon.Load() {
+			if err := s.l.flushShardsEnhanced(g, shardsWithData); err != nil && flushErr == nil {
+				flushErr = fmt.Errorf("final flush failed: %w", err)
+			}
 		}
 	}
+	return flushErr
+}
 
-	// Flush remaining data (flushShardsEnhanced will acquire semaphore itself)
-	if len(shardsWithData) > 0 {
-		l.flushShardsEnhanced(shardsWithData)
+// Release closes the shard buffers and the file writers, then compresses the files they completed
+// The buffers are released even when abandoned, once the in-progress write returns
+func (s perShardSwap) Release(abandoned bool) error {
+	l := s.l
+	// Close shard collection (and the other set of a resize interrupted by Close)
+	l.shardCollection.Load().Close()
+	if l.spareShards != nil {
+		l.spareShards.Close()
 	}
 
-	// Close shard collection
-	l.shardCollection.Close()
+	err := closeFlushGroups(l.groups)
+	if l.compression != nil {
+		l.compression.stop()
+	}
+	return err
+}
+
+// BufferedEntries counts the entries still held in the shard buffers
+func (s perShardSwap) BufferedEntries() int64 {
+	return s.l.bufferedEntries()
+}
+
+// bufferedEntries counts the entries still held in the shard buffers
+func (l *Logger) bufferedEntries() int64 {
+	var entries int64
+	for _, shard := range l.shardCollection.Load().Shards() {
+		entries += shard.entriesA.Load() + shard.entriesB.Load()
+	}
+	return entries
+}
+
+// applyFreeSpaceLevel adjusts file writer and intake behavior for a new free-space level
+func (l *Logger) applyFreeSpaceLevel(oldLevel, newLevel FreeSpaceLevel) {
+	status := l.freeSpace.status()
+	if newLevel > oldLevel {
+		l.config.InternalLogger.Printf("[WARNING] Free space low for %s: %.1f%% available (%d bytes), escalating %s -> %s",
+			l.config.LogFilePath, status.AvailablePct, status.AvailableBytes, oldLevel, newLevel)
+	} else {
+		l.config.InternalLogger.Printf("[WARNING] Free space recovered for %s: %.1f%% available (%d bytes), de-escalating %s -> %s",
+			l.config.LogFilePath, status.AvailablePct, status.AvailableBytes, oldLevel, newLevel)
+	}
+
+	for _, g := range l.groups {
+		if target, ok := g.fileWriter.(freeSpaceTarget); ok {
+			target.setPreallocationEnabled(newLevel < FreeSpaceNoPrealloc)
+		}
+	}
+	l.configMu.Lock()
+	l.applyShrunkMaxFileSize(newLevel)
+	l.configMu.Unlock()
+
+	l.degraded.Store(newLevel >= FreeSpaceDegraded)
+}
+
+// applyShrunkMaxFileSize sets the writers' MaxFileSize override for a free-space level
+// Only shrinks: files never grow beyond the current MaxFileSize (configMu must be held)
+func (l *Logger) applyShrunkMaxFileSize(level FreeSpaceLevel) {
+	var override int64
+	shrunk := l.config.FreeSpaceConfig.ShrunkMaxFileSize
+	if level >= FreeSpaceShrinkFiles && (l.maxFileSize <= 0 || shrunk < l.maxFileSize) {
+		override = shrunk
+	}
+	for _, g := range l.groups {
+		if target, ok := g.fileWriter.(freeSpaceTarget); ok {
+			target.setMaxFileSizeOverride(override)
+		}
+	}
+}
+
+// GetFreeSpaceStatus returns the latest free-space sample and escalation counters
+// Returns false if free-space monitoring is not configured
+func (l *Logger) GetFreeSpaceStatus() (FreeSpaceStatus, bool) {
+	if l.freeSpace == nil {
+		return FreeSpaceStatus{}, false
+	}
+	return l.freeSpace.status(), true
+}
+
+// IOBackend returns the write backend in use (IOBackendPwritev after any io_uring fallback)
+// With several flush workers this is the first worker's backend; all are configured alike
+func (l *Logger) IOBackend() IOBackend {
+	if iow, ok := l.groups[0].fileWriter.(ioBackendWriter); ok {
+		return iow.activeIOBackend()
+	}
+	return IOBackendPwritev
+}
+
+// PreallocMethod returns how the current file was preallocated (first flush worker's file)
+// PreallocTruncate means fallocate is unsupported on this filesystem, so writes still allocate blocks
+func (l *Logger) PreallocMethod() PreallocMethod {
+	if pw, ok := l.groups[0].fileWriter.(interface{ PreallocMethod() PreallocMethod }); ok {
+		return pw.PreallocMethod()
+	}
+	return PreallocNone
+}
 
-	// Close file writer
-	return l.fileWriter.Close()
+// IsDegraded returns true if the logger is rejecting new logs to protect the disk: free space is
+// low (FreeSpaceConfig) or a disk-full flush is being retried (IsDiskFull)
+func (l *Logger) IsDegraded() bool {
+	return l.degraded.Load() || l.IsDiskFull()
 }
@@ -1,11 +1,19 @@
 package asyncloguploader
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/internal/logcore"
 )
 
 // LoggerManager manages multiple Logger instances, one per event name
@@ -15,8 +23,77 @@ type LoggerManager struct {
 	baseDir       string        // Base directory for log files
 	config        Config        // Base config (shared settings)
 	uploadChannel chan<- string // Shared upload channel for all events
+
+	// Event name guardrails and logger count (for MaxEventLoggers)
+	guard      *eventGuard
+	numLoggers atomic.Int64
+
+	// Logger key of each event name (Config.OnEventNameCollision)
+	names *eventNames
+
+	// Guards the start of logger creation: concurrent first writes to one event wait for a single
+	// pending creation (and slot), whose files are opened outside the lock
+	createMu sync.Mutex
+	creating map[string]*pendingLogger // Logger key -> creation in progress
+
+	// Set by Drain under createMu, which then waits for the creations in progress, so no logger is
+	// created afterwards; writes to events without a logger are refused and counted in drainRejected
+	draining      atomic.Bool
+	drainRejected atomic.Int64
+
+	// LRU eviction (MaxEventLoggersEvictLRU). Evicted loggers' final counters move into retired
+	// under retiredMu, which aggregate readers hold shared so totals never skip or double count
+	evictLRU  bool
+	evictions atomic.Int64
+	retiredMu sync.RWMutex
+	retired   StatsSnapshot
+
+	// GetAggregatedIntervalStats state (guarded by retiredMu): evicted loggers' last interval,
+	// guardrail refusals already reported, and where the current interval started
+	retiredInterval StatsSnapshot
+	intervalRefused int64
+	intervalStart   time.Time
+
+	// Sequence number of the last Snapshot taken
+	snapshotSeq atomic.Uint64
+
+	// Per-event overrides keyed by sanitized event name. Logger creation holds the read lock
+	// so SetEventConfig cannot register an override that a concurrently created logger misses
+	eventConfigMu sync.RWMutex
+	eventConfigs  map[string]EventConfig
+
+	// Per-event sampling and rate limits keyed by sanitized event name (guarded by eventConfigMu,
+	// which also orders SetEventPolicy against logger creation)
+	eventPolicies map[string]EventPolicy
+
+	// Config.MirrorEvents expanded: event name -> [event, mirrors...] (nil when unset)
+	mirrors map[string][]string
+
+	// Config.EventRouting (nil when unset)
+	router *eventRouter
+
+	// Flush observer installed on every event logger (guarded by eventConfigMu like the overrides)
+	flushObserver func(eventName string, observation FlushObservation)
+
+	// Runtime changes from UpdateConfig, applied to loggers created later (guarded by eventConfigMu)
+	configUpdate ConfigUpdate
+
+	// Self-metrics writer (Config.SelfMetricsInterval; nil channels when disabled)
+	selfMetricsStop     chan struct{}
+	selfMetricsDone     chan struct{}
+	selfMetricsStopOnce sync.Once
+
+	// Set by Close (Health reports HealthClosed)
+	closed atomic.Bool
+
+	// Lock on the base directory's manager lock file, released once by Close (nil with Config.DisableFileLock)
+	dirLock        *fileLock
+	releaseDirLock sync.Once
 }
 
+// ErrEventLoggerExists is returned by SetEventConfig when the event logger was already created
+var ErrEventLoggerExists = errors.New("event logger already exists")
+
 // NewLoggerManager creates a new LoggerManager
 // The base directory is extracted from config.LogFilePath
 func NewLoggerManager(config Config) (*LoggerManager, error) {
@@ -31,11 +108,83 @@ func NewLoggerManager(config Config) (*LoggerManager, error) {
 		baseDir = "."
 	}
 
-	return &LoggerManager{
+	// A second manager on the directory fails here rather than on its first event
+	var dirLock *fileLock
+	if !config.DisableFileLock {
+		var err error
+		if dirLock, err = acquireFileLock(filepath.Join(baseDir, managerLockName)); err != nil {
+			return nil, err
+		}
+	}
+
+	names, err := loadEventNames(filepath.Join(baseDir, eventNamesFileName), config.OnEventNameCollision, config.InternalLogger)
+	if err != nil {
+		if dirLock != nil {
+			dirLock.release()
+		}
+		return nil, err
+	}
+
+	lm := &LoggerManager{
 		baseDir:       baseDir,
+		names:         names,
 		config:        config,
 		uploadChannel: config.UploadChannel,
-	}, nil
+		guard:         newEventGuard(config),
+		evictLRU:      config.MaxEventLoggersPolicy == MaxEventLoggersEvictLRU,
+		creating:      make(map[string]*pendingLogger),
+		eventConfigs:  make(map[string]EventConfig),
+		eventPolicies: make(map[string]EventPolicy),
+		mirrors:       newMirrorRules(config.MirrorEvents),
+		router:        newEventRouter(config),
+		dirLock:       dirLock,
+		intervalStart: time.Now(),
+	}
+	if config.SelfMetricsInterval > 0 {
+		lm.selfMetricsStop = make(chan struct{})
+		lm.selfMetricsDone = make(chan struct{})
+		go lm.runSelfMetrics()
+	}
+	return lm, nil
+}
+
+// NewLoggerManagerWithEventConfigs creates a LoggerManager with per-event overrides of base
+func NewLoggerManagerWithEventConfigs(base Config, perEvent map[string]EventConfig) (*LoggerManager, error) {
+	lm, err := NewLoggerManager(base)
+	if err != nil {
+		return nil, err
+	}
+	for eventName, overrides := range perEvent {
+		if err := lm.SetEventConfig(eventName, overrides); err != nil {
+			return nil, err
+		}
+	}
+	return lm, nil
+}
+
+// SetEventConfig registers overrides for an event's logger, used when the logger is created
+// Overrides cannot change a running logger: if the event logger already exists, ErrEventLoggerExists
+// is returned (close it with CloseEventLogger first). The resulting config is validated up front.
+// A routed event's overrides apply to its target's logger
+func (lm *LoggerManager) SetEventConfig(eventName string, overrides EventConfig) error {
+	sanitized, err := lm.assignLoggerKey(eventName)
+	if err != nil {
+		return fmt.Errorf("invalid event name: %w", err)
+	}
+
+	eventConfig := overrides.apply(lm.config)
+	if err := eventConfig.Validate(); err != nil {
+		return fmt.Errorf("invalid config for event %s: %w", sanitized, err)
+	}
+
+	lm.eventConfigMu.Lock()
+	defer lm.eventConfigMu.Unlock()
+
+	if _, exists := lm.loggers.Load(sanitized); exists {
+		return fmt.Errorf("%w: %s", ErrEventLoggerExists, sanitized)
+	}
+	lm.eventConfigs[sanitized] = overrides
+	return nil
 }
 
 // sanitizeEventName validates and sanitizes an event name for use as a filename
@@ -68,36 +217,141 @@ func sanitizeEventName(name string) (string, error) {
 }
 
 // getOrCreateLogger retrieves an existing logger or creates a new one for the event
+// The guardrails decide which loggers are created, so the event name (before routing and
+// sanitization) is checked against AllowedEvents/EventNamePattern when the lookup misses. A logger
+// created for another name (a routing target, say) checks the event on every write
 func (lm *LoggerManager) getOrCreateLogger(eventName string) (*Logger, error) {
-	sanitized, err := sanitizeEventName(eventName)
+	// The self-metrics logger is exempt from the guardrails and takes no logger slot
+	reserved := lm.isSelfMetricsEvent(eventName)
+
+	// Fast path: check if logger exists
+	sanitized, err := lm.loggerKey(eventName)
+	if err == nil {
+		if value, ok := lm.loggers.Load(sanitized); ok {
+			logger := value.(*Logger)
+			if logger.createdFor == eventName || reserved || lm.guard.allows(eventName) {
+				if lm.evictLRU {
+					logger.lastUsed.Store(lm.config.Clock.Now().UnixNano())
+				}
+				return logger, nil
+			}
+		}
+	}
+
+	if !reserved && !lm.guard.allows(eventName) {
+		lm.guard.reject(eventName, RejectedEventDrops)
+		return nil, fmt.Errorf("%w: %q", ErrEventNotAllowed, eventName)
+	}
 	if err != nil {
+		lm.rejectCollision(eventName, err)
 		return nil, err
 	}
 
-	// Fast path: check if logger exists
+	// Slow path: concurrent first writes to an event share one creation, which reserves a single slot
+	// (at MaxEventLoggers, separate reservations would refuse all but one). createMu covers the lookup
+	// and the reservation; the files are opened, and an LRU victim closed, outside it
+	lm.createMu.Lock()
+	if logger, ok := lm.loggers.Load(sanitized); ok {
+		lm.createMu.Unlock()
+		return logger.(*Logger), nil
+	}
+	if lm.draining.Load() {
+		lm.createMu.Unlock()
+		lm.drainRejected.Add(1)
+		return nil, ErrDraining
+	}
+	// Another event name may have taken the key since the lookup
+	if sanitized, err = lm.assignLoggerKey(eventName); err != nil {
+		lm.createMu.Unlock()
+		lm.rejectCollision(eventName, err)
+		return nil, err
+	}
 	if logger, ok := lm.loggers.Load(sanitized); ok {
+		lm.createMu.Unlock()
 		return logger.(*Logger), nil
 	}
+	if p, ok := lm.creating[sanitized]; ok {
+		lm.createMu.Unlock()
+		<-p.done
+		if errors.Is(p.err, ErrMaxEventLoggers) {
+			lm.guard.reject(eventName, MaxEventLoggersDrops)
+		}
+		return p.logger, p.err
+	}
+
+	// Reserve a logger slot before creating files (final backstop against unbounded cardinality)
+	// With LRU eviction, a full cap is handled by createLogger
+	slot := reserved || lm.reserveLoggerSlot()
+	if !slot && !lm.evictLRU {
+		lm.createMu.Unlock()
+		return nil, lm.rejectMaxEventLoggers(eventName)
+	}
+	p := &pendingLogger{done: make(chan struct{})}
+	lm.creating[sanitized] = p
+	lm.createMu.Unlock()
+
+	p.logger, p.err = lm.createLogger(eventName, sanitized, reserved, slot)
+
+	lm.createMu.Lock()
+	delete(lm.creating, sanitized)
+	lm.createMu.Unlock()
+	close(p.done)
+	return p.logger, p.err
+}
+
+// pendingLogger is a logger creation in progress (LoggerManager.creating); done is closed once
+// logger or err is set
+type pendingLogger struct {
+	done   chan struct{}
+	logger *Logger
+	err    error
+}
+
+// createLogger creates and stores the logger with key sanitized for eventName, outside createMu
+// Without a slot (MaxEventLoggers reached, with LRU eviction) it first closes the least recently
+// used logger until a slot frees up
+func (lm *LoggerManager) createLogger(eventName, sanitized string, reserved, slot bool) (*Logger, error) {
+	for !slot {
+		if !lm.evictLeastRecentlyUsed() {
+			return nil, lm.rejectMaxEventLoggers(eventName)
+		}
+		slot = lm.reserveLoggerSlot()
+	}
+
+	// Hold the override lock until the logger is stored so a concurrent SetEventConfig either
+	// lands before creation or sees the logger and fails
+	lm.eventConfigMu.RLock()
+	defer lm.eventConfigMu.RUnlock()
 
-	// Slow path: create new logger
 	// Generate file path: {baseDir}/{eventName}.log
 	eventLogPath := filepath.Join(lm.baseDir, sanitized+".log")
 
-	// Create config for this event logger (same settings, different file path)
-	eventConfig := lm.config
+	// Create config for this event logger (base settings plus any overrides and runtime updates,
+	// own file path)
+	eventConfig := lm.configUpdate.apply(lm.eventConfigs[sanitized].apply(lm.config))
 	eventConfig.LogFilePath = eventLogPath
 	eventConfig.UploadChannel = lm.uploadChannel // Share upload channel
+	eventConfig.EventName = sanitized
 
 	// Create new logger
 	logger, err := NewLogger(eventConfig)
 	if err != nil {
+		lm.releaseLoggerSlot(reserved)
 		return nil, fmt.Errorf("failed to create logger for event %s: %w", sanitized, err)
 	}
 
+	logger.limiter.Store(newEventLimiter(lm.eventPolicies[sanitized]))
+	logger.createdFor = eventName
+	if lm.flushObserver != nil {
+		logger.SetFlushObserver(eventFlushObserver(sanitized, lm.flushObserver))
+	}
+
 	// Use LoadOrStore to ensure only one logger is created per event
+	logger.lastUsed.Store(lm.config.Clock.Now().UnixNano())
 	actual, loaded := lm.loggers.LoadOrStore(sanitized, logger)
 	if loaded {
 		// Another goroutine created it first, close ours to avoid resource leak
+		lm.releaseLoggerSlot(reserved)
 		logger.Close()
 		return actual.(*Logger), nil
 	}
@@ -105,63 +359,353 @@ func (lm *LoggerManager) getOrCreateLogger(eventName string) (*Logger, error) {
 	return logger, nil
 }
 
+// rejectMaxEventLoggers counts a write refused at MaxEventLoggers and returns its error
+func (lm *LoggerManager) rejectMaxEventLoggers(eventName string) error {
+	lm.guard.reject(eventName, MaxEventLoggersDrops)
+	return fmt.Errorf("%w (%d): cannot create logger for event %q", ErrMaxEventLoggers, lm.guard.maxEventLoggers, eventName)
+}
+
+// rejectCollision counts a write refused with ErrEventNameCollision and logs it once per event name
+// (other errors are ignored)
+func (lm *LoggerManager) rejectCollision(eventName string, err error) {
+	if errors.Is(err, ErrEventNameCollision) {
+		lm.guard.reject(eventName, EventNameCollisionDrops)
+		lm.names.warnRefused(eventName, err)
+	}
+}
+
+// SetFlushObserver registers fn to be called after every flush of every event logger, including
+// loggers created later; nil removes it. fn runs on the flush path, so it must be fast
+func (lm *LoggerManager) SetFlushObserver(fn func(eventName string, observation FlushObservation)) {
+	// The write lock keeps loggers from being created (and missing fn) while existing ones are updated
+	lm.eventConfigMu.Lock()
+	defer lm.eventConfigMu.Unlock()
+
+	lm.flushObserver = fn
+	lm.loggers.Range(func(key, value interface{}) bool {
+		if fn == nil {
+			value.(*Logger).SetFlushObserver(nil)
+		} else {
+			value.(*Logger).SetFlushObserver(eventFlushObserver(key.(string), fn))
+		}
+		return true
+	})
+}
+
+// eventFlushObserver binds a manager flush observer to one event
+func eventFlushObserver(eventName string, fn func(string, FlushObservation)) func(FlushObservation) {
+	return func(observation FlushObservation) {
+		fn(eventName, observation)
+	}
+}
+
+// reserveLoggerSlot counts a new logger, failing if MaxEventLoggers would be exceeded
+func (lm *LoggerManager) reserveLoggerSlot() bool {
+	maxLoggers := lm.guard.maxEventLoggers
+	if maxLoggers <= 0 {
+		lm.numLoggers.Add(1)
+		return true
+	}
+	for {
+		n := lm.numLoggers.Load()
+		if n >= maxLoggers {
+			return false
+		}
+		if lm.numLoggers.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// releaseLoggerSlot uncounts a logger, unless it is the self-metrics logger (which takes no slot)
+func (lm *LoggerManager) releaseLoggerSlot(reserved bool) {
+	if !reserved {
+		lm.numLoggers.Add(-1)
+	}
+}
+
+// evictLeastRecentlyUsed closes and removes the least recently used event logger
+// The logger is flushed by Close before its slot is released. Returns false if there is nothing to evict
+func (lm *LoggerManager) evictLeastRecentlyUsed() bool {
+	var victimKey string
+	var victim *Logger
+	oldest := int64(math.MaxInt64)
+	lm.rangeUserLoggers(func(eventName string, logger *Logger) bool {
+		if lastUsed := logger.lastUsed.Load(); lastUsed < oldest {
+			oldest, victimKey, victim = lastUsed, eventName, logger
+		}
+		return true
+	})
+	if victim == nil {
+		return false
+	}
+
+	lm.retiredMu.Lock()
+	defer lm.retiredMu.Unlock()
+
+	// Another goroutine may have evicted or closed it first; the caller retries the reservation
+	if !lm.loggers.CompareAndDelete(victimKey, victim) {
+		return true
+	}
+
+	// Writers that acquired the logger before it was marked finish first, so no log lands
+	// on the closed logger after its counters are retired (see acquireLogger)
+	victim.evicted.Store(true)
+	for victim.inUse.Load() > 0 {
+		runtime.Gosched()
+	}
+	if err := victim.Close(); err != nil {
+		lm.config.InternalLogger.Printf("[WARNING] Failed to close evicted logger for event %s: %v", victimKey, err)
+	}
+	addStats(&lm.retired, victim.loadStats())
+	addStats(&lm.retiredInterval, victim.GetIntervalStats().Stats)
+	lm.evictions.Add(1)
+	lm.numLoggers.Add(-1)
+	return true
+}
+
+// acquireLogger returns the event logger for a write, pinning it against LRU eviction
+// Callers must releaseLogger when the write is done
+func (lm *LoggerManager) acquireLogger(eventName string) (*Logger, error) {
+	for {
+		logger, err := lm.getOrCreateLogger(eventName)
+		if err != nil || !lm.evictLRU {
+			return logger, err
+		}
+		logger.inUse.Add(1)
+		if !logger.evicted.Load() {
+			return logger, nil
+		}
+		// Lost a race with eviction; retry on the event's next logger
+		logger.inUse.Add(-1)
+	}
+}
+
+// releaseLogger unpins a logger returned by acquireLogger
+func (lm *LoggerManager) releaseLogger(logger *Logger) {
+	if lm.evictLRU {
+		logger.inUse.Add(-1)
+	}
+}
+
+// GetEventLoggerEvictions returns the number of event loggers evicted by MaxEventLoggersEvictLRU
+func (lm *LoggerManager) GetEventLoggerEvictions() int64 {
+	return lm.evictions.Load()
+}
+
 // LogBytesWithEvent writes raw byte data to the event-specific logger
+// Entries for an event with MirrorEvents are also written to its mirrors
 func (lm *LoggerManager) LogBytesWithEvent(eventName string, data []byte) {
-	logger, err := lm.getOrCreateLogger(eventName)
+	if targets, ok := lm.mirrors[eventName]; ok {
+		lm.logToEvents(nil, targets, data)
+		return
+	}
+	logger, err := lm.acquireLogger(eventName)
 	if err != nil {
 		// Drop log on error
 		return
 	}
-	logger.LogBytes(data)
+	if logger.admit() == nil {
+		_ = lm.logRouted(nil, eventName, logger, data)
+	}
+	lm.releaseLogger(logger)
+}
+
+// TryLogBytesWithEvent is LogBytesWithEvent that reports whether the log was accepted
+// Returns the logger's sentinel errors (see Logger.TryLogBytes), or the error from resolving
+// the event logger, which wraps ErrEventNotAllowed or ErrMaxEventLoggers when a guardrail refuses it
+// With MirrorEvents, the entry is written as by LogBytesToEvents and the first error is returned
+func (lm *LoggerManager) TryLogBytesWithEvent(eventName string, data []byte) error {
+	if targets, ok := lm.mirrors[eventName]; ok {
+		_, err := lm.logToEvents(nil, targets, data)
+		return err
+	}
+	logger, err := lm.acquireLogger(eventName)
+	if err != nil {
+		return err
+	}
+	if err = logger.admit(); err == nil {
+		err = lm.logRouted(nil, eventName, logger, data)
+	}
+	lm.releaseLogger(logger)
+	return err
+}
+
+// LogBytesWithEventCtx is TryLogBytesWithEvent for request-scoped logs (see Logger.LogBytesCtx)
+// Returns ctx.Err() when the log was skipped because ctx is done
+func (lm *LoggerManager) LogBytesWithEventCtx(ctx context.Context, eventName string, data []byte) error {
+	if targets, ok := lm.mirrors[eventName]; ok {
+		_, err := lm.logToEvents(ctx, targets, data)
+		return err
+	}
+	logger, err := lm.acquireLogger(eventName)
+	if err != nil {
+		return err
+	}
+	if err = logger.admit(); err == nil {
+		err = lm.logRouted(ctx, eventName, logger, data)
+	}
+	lm.releaseLogger(logger)
+	return err
 }
 
 // LogWithEvent writes a string message to the event-specific logger
 func (lm *LoggerManager) LogWithEvent(eventName string, message string) {
-	logger, err := lm.getOrCreateLogger(eventName)
+	if targets, ok := lm.mirrors[eventName]; ok {
+		lm.logToEvents(nil, targets, logcore.StringToBytes(message))
+		return
+	}
+	logger, err := lm.acquireLogger(eventName)
 	if err != nil {
 		// Drop log on error
 		return
 	}
-	logger.Log(message)
+	if logger.admit() == nil {
+		_ = lm.logRouted(nil, eventName, logger, logcore.StringToBytes(message))
+	}
+	lm.releaseLogger(logger)
 }
 
 // InitializeEventLogger creates a logger for the specified event if it doesn't exist
+// Returns ErrEventNotAllowed or ErrMaxEventLoggers (wrapped) if the event is refused
 func (lm *LoggerManager) InitializeEventLogger(eventName string) error {
-	sanitized, err := sanitizeEventName(eventName)
-	if err != nil {
+	if _, err := sanitizeEventName(eventName); err != nil {
 		return fmt.Errorf("invalid event name: %w", err)
 	}
 
-	// Check if logger already exists
-	if _, exists := lm.loggers.Load(sanitized); exists {
-		return nil // Already exists, no-op
-	}
-
-	// Create logger
-	_, err = lm.getOrCreateLogger(sanitized)
+	// Create logger (no-op if it already exists; policy is checked on the caller's name)
+	_, err := lm.getOrCreateLogger(eventName)
 	return err
 }
 
 // CloseEventLogger closes and removes the logger for the specified event
+// Equivalent to CloseEventLoggerContext with a deadline of DefaultCloseTimeout, without the report
 func (lm *LoggerManager) CloseEventLogger(eventName string) error {
-	sanitized, err := sanitizeEventName(eventName)
+	ctx, cancel := withClockTimeout(lm.config.Clock, DefaultCloseTimeout)
+	defer cancel()
+	_, err := lm.CloseEventLoggerContext(eventName, ctx)
+	return err
+}
+
+// CloseEventLoggerContext closes and removes the logger for the specified event (see
+// Logger.CloseContext): its last file is queued for upload and, with an Uploader attached to
+// Config.UploadTracker, uploaded before it returns, unless ctx ends first
+func (lm *LoggerManager) CloseEventLoggerContext(eventName string, ctx context.Context) (CloseReport, error) {
+	sanitized, err := lm.loggerKey(eventName)
 	if err != nil {
-		return fmt.Errorf("invalid event name: %w", err)
+		return CloseReport{}, fmt.Errorf("invalid event name: %w", err)
 	}
 
 	// Load and delete atomically
 	logger, exists := lm.loggers.LoadAndDelete(sanitized)
 	if !exists {
-		return fmt.Errorf("event logger not found: %s", sanitized)
+		return CloseReport{}, fmt.Errorf("event logger not found: %s", sanitized)
 	}
+	lm.releaseLoggerSlot(lm.isSelfMetricsEvent(sanitized))
 
 	// Close the logger
-	return logger.(*Logger).Close()
+	return logger.(*Logger).CloseContext(ctx)
+}
+
+// FlushEvent flushes the logger for the specified event (see Logger.Flush)
+func (lm *LoggerManager) FlushEvent(eventName string, ctx context.Context) error {
+	sanitized, err := lm.loggerKey(eventName)
+	if err != nil {
+		return fmt.Errorf("invalid event name: %w", err)
+	}
+
+	logger, exists := lm.loggers.Load(sanitized)
+	if !exists {
+		return fmt.Errorf("event logger not found: %s", sanitized)
+	}
+	return logger.(*Logger).Flush(ctx)
+}
+
+// FlushAll flushes every event logger (see Logger.Flush)
+// All loggers are flushed even if one fails; the first error is returned
+func (lm *LoggerManager) FlushAll(ctx context.Context) error {
+	var firstErr error
+	lm.loggers.Range(func(key, value interface{}) bool {
+		if err := value.(*Logger).Flush(ctx); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error flushing logger for event %s: %w", key.(string), err)
+		}
+		return true
+	})
+	return firstErr
 }
 
-// HasEventLogger checks if a logger exists for the specified event
+// ReopenAll reopens every event logger's files after an external rotation (see Logger.Reopen)
+// All loggers are reopened even if one fails; the first error is returned
+func (lm *LoggerManager) ReopenAll() error {
+	var firstErr error
+	lm.loggers.Range(func(key, value interface{}) bool {
+		if err := value.(*Logger).Reopen(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error reopening logger for event %s: %w", key.(string), err)
+		}
+		return true
+	})
+	return firstErr
+}
+
+// GetEventStats returns statistics for a specific event logger (see Logger.GetStatsSnapshot)
+func (lm *LoggerManager) GetEventStats(eventName string) (totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, bytesBuffered, bytesDurable int64, err error) {
+	sanitized, err := lm.loggerKey(eventName)
+	if err != nil {
+		return 0, 0, 0, 0, 0, 0, 0, 0, fmt.Errorf("invalid event name: %w", err)
+	}
+
+	logger, exists := lm.loggers.Load(sanitized)
+	if !exists {
+		return 0, 0, 0, 0, 0, 0, 0, 0, fmt.Errorf("event logger not found: %s", sanitized)
+	}
+
+	totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, bytesBuffered, bytesDurable = logger.(*Logger).GetStatsSnapshot()
+	return totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, bytesBuffered, bytesDurable, nil
+}
+
+// GetEventFileStats returns the current file and pending uploads of a specific event logger
+// (see Logger.GetFileStats). Pending uploads need Config.UploadTracker
+func (lm *LoggerManager) GetEventFileStats(eventName string) (FileStats, error) {
+	sanitized, err := lm.loggerKey(eventName)
+	if err != nil {
+		return FileStats{}, fmt.Errorf("invalid event name: %w", err)
+	}
+
+	logger, exists := lm.loggers.Load(sanitized)
+	if !exists {
+		return FileStats{}, fmt.Errorf("event logger not found: %s", sanitized)
+	}
+	return logger.(*Logger).GetFileStats(), nil
+}
+
+// GetEventShardStats returns per-shard statistics for a specific event logger (see Logger.GetShardStats)
+func (lm *LoggerManager) GetEventShardStats(eventName string) ([]ShardStats, error) {
+	sanitized, err := lm.loggerKey(eventName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event name: %w", err)
+	}
+
+	logger, exists := lm.loggers.Load(sanitized)
+	if !exists {
+		return nil, fmt.Errorf("event logger not found: %s", sanitized)
+	}
+	return logger.(*Logger).GetShardStats(), nil
+}
+
+// GetShardStatsByEvent returns the per-shard statistics of every event logger, keyed by logger
+// name. Drops and retries of an event piling up on one shard point at a hot shard (see ShardStats)
+func (lm *LoggerManager) GetShardStatsByEvent() map[string][]ShardStats {
+	stats := make(map[string][]ShardStats)
+	lm.rangeUserLoggers(func(eventName string, logger *Logger) bool {
+		stats[eventName] = logger.GetShardStats()
+		return true
+	})
+	return stats
+}
+
+// HasEventLogger checks if a logger exists for the specified event (for a routed event, its target's)
 func (lm *LoggerManager) HasEventLogger(eventName string) bool {
-	sanitized, err := sanitizeEventName(eventName)
+	sanitized, err := lm.loggerKey(eventName)
 	if err != nil {
 		return false
 	}
@@ -171,7 +715,11 @@ func (lm *LoggerManager) HasEventLogger(eventName string) bool {
 }
 
 // ListEventLoggers returns a list of all active event logger names
+// With EventRouting these are the loggers created, i.e. routing targets rather than routed event names
 func (lm *LoggerManager) ListEventLoggers() []string {
+	lm.retiredMu.RLock()
+	defer lm.retiredMu.RUnlock()
+
 	events := make([]string, 0)
 	lm.loggers.Range(func(key, value interface{}) bool {
 		events = append(events, key.(string))
@@ -181,93 +729,193 @@ func (lm *LoggerManager) ListEventLoggers() []string {
 }
 
 // Close gracefully shuts down all loggers, flushing all pending data
+// Equivalent to CloseWithTimeout(DefaultCloseTimeout) without the report
 func (lm *LoggerManager) Close() error {
-	var firstErr error
+	_, err := lm.CloseWithTimeout(DefaultCloseTimeout)
+	return err
+}
+
+// CloseWithTimeout is CloseContext with a deadline of d from now (of Config.Clock)
+func (lm *LoggerManager) CloseWithTimeout(d time.Duration) (CloseReport, error) {
+	ctx, cancel := withClockTimeout(lm.config.Clock, d)
+	defer cancel()
+	return lm.CloseContext(ctx)
+}
+
+// CloseContext closes all event loggers concurrently under one deadline (see Logger.CloseContext)
+// The report sums the per-logger reports; DeadlineExceeded is set if any logger hit the deadline.
+// Each logger's last file is queued for upload; with an Uploader attached to Config.UploadTracker,
+// CloseContext waits for the uploads too, so stop the Uploader after closing the manager
+func (lm *LoggerManager) CloseContext(ctx context.Context) (CloseReport, error) {
+	// Final self-metrics records are written before their logger closes
+	lm.stopSelfMetrics()
+	lm.closed.Store(true)
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		report   CloseReport
+		firstErr error
+	)
 	lm.loggers.Range(func(key, value interface{}) bool {
+		eventName := key.(string)
 		logger := value.(*Logger)
-		if err := logger.Close(); err != nil && firstErr == nil {
-			firstErr = err
-		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := logger.CloseContext(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.EntriesFlushed += r.EntriesFlushed
+			report.BytesFlushed += r.BytesFlushed
+			report.EntriesDropped += r.EntriesDropped
+			report.DeadlineExceeded = report.DeadlineExceeded || r.DeadlineExceeded
+			report.PendingUploads += r.PendingUploads
+			if err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("error closing logger for event %s: %w", eventName, err)
+			}
+		}()
 		return true // continue iteration
 	})
-	return firstErr
+	wg.Wait()
+
+	// A logger abandoned at the deadline keeps its series locks until its writers close
+	lm.releaseDirLock.Do(func() {
+		if err := lm.dirLock.release(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to release directory lock: %w", err)
+		}
+	})
+
+	return report, firstErr
+}
+
+// SetAllowedEvents replaces the event allowlist at runtime (nil or empty removes it)
+// The allowlist decides which loggers are created: the logger of an event no longer allowed keeps
+// accepting the event's logs until closed (CloseEventLogger)
+func (lm *LoggerManager) SetAllowedEvents(allowedEvents []string) {
+	lm.guard.setAllowedEvents(allowedEvents)
+}
+
+// SetEventNamePattern replaces the event name pattern at runtime (nil removes it)
+// Like SetAllowedEvents, it applies to events without a logger
+func (lm *LoggerManager) SetEventNamePattern(pattern *regexp.Regexp) {
+	lm.guard.setEventNamePattern(pattern)
+}
+
+// GetEventRejectStats returns the number of logs refused per reason
+func (lm *LoggerManager) GetEventRejectStats() (rejectedEventDrops, maxEventLoggersDrops int64) {
+	return lm.guard.rejectedEventDrops.Load(), lm.guard.maxEventLoggersDrops.Load()
+}
+
+// LastRejectedEvent returns the most recently refused event name (false if none)
+func (lm *LoggerManager) LastRejectedEvent() (RejectedEvent, bool) {
+	last := lm.guard.lastRejected.Load()
+	if last == nil {
+		return RejectedEvent{}, false
+	}
+	return *last, true
 }
 
 // GetAggregatedStats returns aggregated statistics across all loggers
-func (lm *LoggerManager) GetAggregatedStats() (totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps int64) {
-	lm.loggers.Range(func(key, value interface{}) bool {
-		logger := value.(*Logger)
-		t, d, b, f, fe, s := logger.GetStatsSnapshot()
+// Logs refused by event guardrails and the final counters of evicted loggers are included
+func (lm *LoggerManager) GetAggregatedStats() (totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, bytesBuffered, bytesDurable int64) {
+	lm.retiredMu.RLock()
+	defer lm.retiredMu.RUnlock()
+
+	rejected, capped := lm.GetEventRejectStats()
+	totalLogs = rejected + capped + lm.retired.TotalLogs
+	droppedLogs = rejected + capped + lm.retired.DroppedLogs
+	bytesWritten = lm.retired.BytesWritten
+	flushes = lm.retired.Flushes
+	flushErrors = lm.retired.FlushErrors
+	bytesBuffered = lm.retired.BytesBuffered
+	bytesDurable = lm.retired.BytesDurable
+
+	lm.rangeUserLoggers(func(eventName string, logger *Logger) bool {
+		t, d, b, f, fe, s, bb, bd := logger.GetStatsSnapshot()
 		totalLogs += t
 		droppedLogs += d
 		bytesWritten += b
 		flushes += f
 		flushErrors += fe
 		setSwaps += s
+		bytesBuffered += bb
+		bytesDurable += bd
 		return true
 	})
 	return
 }
 
-// GetAggregatedFlushMetrics returns aggregated flush metrics across all loggers
-func (lm *LoggerManager) GetAggregatedFlushMetrics() FlushMetrics {
-	var totalFlushDuration, maxFlushDuration int64
-	var totalWriteDuration, maxWriteDuration int64
-	var totalPwritevDuration, maxPwritevDuration int64
-	var totalFlushes int64
-
-	lm.loggers.Range(func(key, value interface{}) bool {
-		logger := value.(*Logger)
-		metrics := logger.GetFlushMetrics()
-		flushes := logger.stats.Flushes.Load()
-
-		if flushes > 0 {
-			totalFlushDuration += metrics.AvgFlushDuration.Nanoseconds() * flushes
-			if metrics.MaxFlushDuration.Nanoseconds() > maxFlushDuration {
-				maxFlushDuration = metrics.MaxFlushDuration.Nanoseconds()
-			}
-
-			totalWriteDuration += metrics.AvgWriteDuration.Nanoseconds() * flushes
-			if metrics.MaxWriteDuration.Nanoseconds() > maxWriteDuration {
-				maxWriteDuration = metrics.MaxWriteDuration.Nanoseconds()
-			}
-
-			totalPwritevDuration += metrics.AvgPwritevDuration.Nanoseconds() * flushes
-			if metrics.MaxPwritevDuration.Nanoseconds() > maxPwritevDuration {
-				maxPwritevDuration = metrics.MaxPwritevDuration.Nanoseconds()
-			}
+// GetStatsStruct returns GetStatsStruct summed across all loggers, like GetAggregatedStats
+// Max* fields and LastPartialFlushUnixNano are the largest of any logger
+func (lm *LoggerManager) GetStatsStruct() StatsSnapshot {
+	lm.retiredMu.RLock()
+	defer lm.retiredMu.RUnlock()
+
+	total := lm.retired
+	rejected, capped := lm.GetEventRejectStats()
+	total.TotalLogs += rejected + capped
+	total.DroppedLogs += rejected + capped
+	lm.rangeUserLoggers(func(eventName string, logger *Logger) bool {
+		addStats(&total, logger.GetStatsStruct())
+		return true
+	})
+	return total
+}
 
-			totalFlushes += flushes
-		}
+// GetAggregatedWritePathStats returns write path counters summed across all loggers
+func (lm *LoggerManager) GetAggregatedWritePathStats() (fastPath, retryPath, retryTimeouts int64) {
+	lm.retiredMu.RLock()
+	defer lm.retiredMu.RUnlock()
+
+	fastPath, retryPath, retryTimeouts = lm.retired.FastPathWrites, lm.retired.RetryPathWrites, lm.retired.RetryTimeouts
+	lm.rangeUserLoggers(func(eventName string, logger *Logger) bool {
+		f, r, t := logger.GetWritePathStats()
+		fastPath += f
+		retryPath += r
+		retryTimeouts += t
 		return true
 	})
+	return
+}
 
-	if totalFlushes == 0 {
-		return FlushMetrics{}
-	}
+// GetAggregatedMessageSizeStats returns oversized and chunked log counts summed across all loggers
+func (lm *LoggerManager) GetAggregatedMessageSizeStats() (oversized, chunked int64) {
+	lm.retiredMu.RLock()
+	defer lm.retiredMu.RUnlock()
 
-	avgFlushDuration := time.Duration(totalFlushDuration / totalFlushes)
-	avgWriteDuration := time.Duration(totalWriteDuration / totalFlushes)
-	avgPwritevDuration := time.Duration(totalPwritevDuration / totalFlushes)
+	oversized, chunked = lm.retired.OversizedLogs, lm.retired.ChunkedLogs
+	lm.rangeUserLoggers(func(eventName string, logger *Logger) bool {
+		o, c := logger.GetMessageSizeStats()
+		oversized += o
+		chunked += c
+		return true
+	})
+	return
+}
 
-	writePercent := 0.0
-	if avgFlushDuration > 0 {
-		writePercent = float64(avgWriteDuration) / float64(avgFlushDuration) * 100.0
-	}
+// GetAggregatedWriteLatencyHistogram returns LogBytes call durations summed across all loggers
+func (lm *LoggerManager) GetAggregatedWriteLatencyHistogram() WriteLatencyHistogram {
+	lm.retiredMu.RLock()
+	defer lm.retiredMu.RUnlock()
 
-	pwritevPercent := 0.0
-	if avgFlushDuration > 0 {
-		pwritevPercent = float64(avgPwritevDuration) / float64(avgFlushDuration) * 100.0
-	}
+	h := lm.retired.WriteLatency
+	lm.rangeUserLoggers(func(eventName string, logger *Logger) bool {
+		h.add(logger.GetWriteLatencyHistogram())
+		return true
+	})
+	return h
+}
 
-	return FlushMetrics{
-		AvgFlushDuration:   avgFlushDuration,
-		MaxFlushDuration:   time.Duration(maxFlushDuration),
-		AvgWriteDuration:   avgWriteDuration,
-		MaxWriteDuration:   time.Duration(maxWriteDuration),
-		WritePercent:       writePercent,
-		AvgPwritevDuration: avgPwritevDuration,
-		MaxPwritevDuration: time.Duration(maxPwritevDuration),
-		PwritevPercent:     pwritevPercent,
-	}
+// GetAggregatedFlushMetrics returns aggregated flush metrics across all loggers
+// Averages are weighted by each logger's flushes; FlushQueueDepth is the sum of current depths
+func (lm *LoggerManager) GetAggregatedFlushMetrics() FlushMetrics {
+	var total StatsSnapshot
+	lm.rangeUserLoggers(func(eventName string, logger *Logger) bool {
+		addStats(&total, logger.loadStats())
+		return true
+	})
+	return flushMetricsFrom(total)
 }
@@ -0,0 +1,652 @@
+package asyncloguploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/internal/logcore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newGuardTestConfig returns a small config suitable for creating many event loggers
+func newGuardTestConfig(t *testing.T) Config {
+	t.Helper()
+	config := DefaultConfig(filepath.Join(t.TempDir(), "events.log"))
+	config.BufferSize = 256 * 1024
+	config.NumShards = 2
+	return config
+}
+
+func TestLoggerManager_EventGuard(t *testing.T) {
+	t.Run("AllowlistRejectsUnknownEvents", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.AllowedEvents = []string{"payment", "login"}
+
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+
+		manager.LogWithEvent("payment", "ok")
+		manager.LogWithEvent("user-12345", "abuse")
+		assert.True(t, manager.HasEventLogger("payment"))
+		assert.False(t, manager.HasEventLogger("user-12345"))
+
+		err = manager.InitializeEventLogger("user-67890")
+		assert.True(t, errors.Is(err, ErrEventNotAllowed))
+		require.NoError(t, manager.InitializeEventLogger("login"))
+
+		rejected, capped := manager.GetEventRejectStats()
+		assert.Equal(t, int64(2), rejected)
+		assert.Equal(t, int64(0), capped)
+
+		last, ok := manager.LastRejectedEvent()
+		require.True(t, ok)
+		assert.Equal(t, "user-67890", last.EventName)
+		assert.Equal(t, RejectedEventDrops, last.Reason)
+
+		totalLogs, droppedLogs, _, _, _, _, _, _ := manager.GetAggregatedStats()
+		assert.Equal(t, int64(3), totalLogs) // 1 accepted + 2 rejected
+		assert.Equal(t, int64(2), droppedLogs)
+	})
+
+	t.Run("PatternRejectsNonMatchingEvents", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.EventNamePattern = regexp.MustCompile(`^[a-z_]{1,32}$`)
+
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+
+		require.NoError(t, manager.InitializeEventLogger("checkout_started"))
+		assert.ErrorIs(t, manager.InitializeEventLogger("user_42"), ErrEventNotAllowed)
+		assert.ErrorIs(t, manager.InitializeEventLogger("../etc"), ErrEventNotAllowed)
+		assert.Equal(t, []string{"checkout_started"}, manager.ListEventLoggers())
+	})
+
+	t.Run("CapActsAsBackstop", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.MaxEventLoggers = 2
+
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+
+		require.NoError(t, manager.InitializeEventLogger("a"))
+		require.NoError(t, manager.InitializeEventLogger("b"))
+		assert.ErrorIs(t, manager.InitializeEventLogger("c"), ErrMaxEventLoggers)
+
+		// Existing events keep working at the cap
+		require.NoError(t, manager.InitializeEventLogger("a"))
+		manager.LogWithEvent("b", "still accepted")
+
+		// Closing a logger frees a slot
+		require.NoError(t, manager.CloseEventLogger("a"))
+		require.NoError(t, manager.InitializeEventLogger("c"))
+
+		rejected, capped := manager.GetEventRejectStats()
+		assert.Equal(t, int64(0), rejected)
+		assert.Equal(t, int64(1), capped)
+	})
+
+	t.Run("CapHoldsUnderConcurrentCreation", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.MaxEventLoggers = 3
+
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+
+		const offenders = 32
+		var wg sync.WaitGroup
+		for i := 0; i < offenders; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				manager.LogWithEvent(fmt.Sprintf("event-%d", i), "data")
+			}(i)
+		}
+		wg.Wait()
+
+		assert.Len(t, manager.ListEventLoggers(), 3)
+		_, capped := manager.GetEventRejectStats()
+		assert.Equal(t, int64(offenders-3), capped)
+		last, ok := manager.LastRejectedEvent()
+		require.True(t, ok)
+		assert.Equal(t, MaxEventLoggersDrops, last.Reason)
+	})
+
+	t.Run("ConcurrentFirstWritesShareOneSlot", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.MaxEventLoggers = 1
+
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+
+		const writers = 16
+		var wg sync.WaitGroup
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, manager.TryLogBytesWithEvent("payment", []byte("first")))
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, []string{"payment"}, manager.ListEventLoggers())
+		assert.Equal(t, int64(1), manager.numLoggers.Load())
+		_, capped := manager.GetEventRejectStats()
+		assert.Equal(t, int64(0), capped)
+	})
+
+	t.Run("ReloadUpdatesAllowlist", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.AllowedEvents = []string{"payment"}
+
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+
+		assert.ErrorIs(t, manager.InitializeEventLogger("refund"), ErrEventNotAllowed)
+		manager.SetAllowedEvents([]string{"payment", "refund"})
+		require.NoError(t, manager.InitializeEventLogger("refund"))
+
+		// Removing the policy entirely allows everything
+		manager.SetAllowedEvents(nil)
+		require.NoError(t, manager.InitializeEventLogger("anything"))
+
+		// Pattern can be added without touching the allowlist
+		manager.SetEventNamePattern(regexp.MustCompile(`^pay`))
+		assert.ErrorIs(t, manager.InitializeEventLogger("other"), ErrEventNotAllowed)
+		require.NoError(t, manager.InitializeEventLogger("payout"))
+	})
+
+	t.Run("ExistingLoggersSkipTheGuard", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.AllowedEvents = []string{"payment"}
+
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+		require.NoError(t, manager.InitializeEventLogger("payment"))
+
+		// The allowlist decides which loggers are created; writes only look the logger up
+		manager.SetAllowedEvents([]string{"refund"})
+		require.NoError(t, manager.TryLogBytesWithEvent("payment", []byte("still accepted")))
+		assert.ErrorIs(t, manager.TryLogBytesWithEvent("other", []byte("refused")), ErrEventNotAllowed)
+
+		rejected, _ := manager.GetEventRejectStats()
+		assert.Equal(t, int64(1), rejected)
+	})
+
+	t.Run("ConcurrentOffendersCountedAccurately", func(t *testing.T) {
+		var hookCalls atomic.Int64
+		config := newGuardTestConfig(t)
+		config.AllowedEvents = []string{"payment"}
+		config.MaxEventLoggers = 1
+		config.EventRejectHookInterval = time.Hour
+		config.OnEventRejected = func(eventName string, reason EventRejectReason) {
+			hookCalls.Add(1)
+		}
+
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+
+		const goroutines = 16
+		const perGoroutine = 100
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < perGoroutine; i++ {
+					manager.LogWithEvent(fmt.Sprintf("user-%d-%d", g, i), "abuse")
+					manager.LogWithEvent("payment", "legit")
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		rejected, capped := manager.GetEventRejectStats()
+		assert.Equal(t, int64(goroutines*perGoroutine), rejected)
+		assert.Equal(t, int64(0), capped)
+		assert.Equal(t, int64(1), hookCalls.Load(), "hook must be rate-limited")
+		assert.Equal(t, []string{"payment"}, manager.ListEventLoggers())
+
+		// Legitimate traffic is unaffected
+		totalLogs, droppedLogs, _, _, _, _, _, _ := manager.GetAggregatedStats()
+		assert.Equal(t, int64(2*goroutines*perGoroutine), totalLogs)
+		assert.Equal(t, int64(goroutines*perGoroutine), droppedLogs)
+	})
+}
+
+func TestConfig_EventGuardValidate(t *testing.T) {
+	config := DefaultConfig("/tmp/test.log")
+	config.MaxEventLoggers = -1
+	assert.Error(t, config.Validate())
+
+	config.MaxEventLoggers = 0
+	require.NoError(t, config.Validate())
+	assert.Equal(t, time.Second, config.EventRejectHookInterval)
+}
+
+func TestLoggerManager_TryLogBytesWithEvent(t *testing.T) {
+	config := newGuardTestConfig(t)
+	config.AllowedEvents = []string{"payment"}
+
+	manager, err := NewLoggerManager(config)
+	require.NoError(t, err)
+	defer manager.Close()
+
+	assert.NoError(t, manager.TryLogBytesWithEvent("payment", []byte("ok")))
+	assert.ErrorIs(t, manager.TryLogBytesWithEvent("payment", make([]byte, config.BufferSize)), ErrOversized)
+	assert.ErrorIs(t, manager.TryLogBytesWithEvent("refund", []byte("refused")), ErrEventNotAllowed)
+}
+
+func TestLoggerManager_LogBytesWithEventCtx(t *testing.T) {
+	config := newGuardTestConfig(t)
+	config.AllowedEvents = []string{"payment"}
+
+	manager, err := NewLoggerManager(config)
+	require.NoError(t, err)
+	defer manager.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.NoError(t, manager.LogBytesWithEventCtx(ctx, "payment", []byte("ok")))
+	cancel()
+	assert.ErrorIs(t, manager.LogBytesWithEventCtx(ctx, "payment", []byte("cancelled")), context.Canceled)
+	assert.ErrorIs(t, manager.LogBytesWithEventCtx(context.Background(), "refund", []byte("refused")), ErrEventNotAllowed)
+
+	total, dropped, _, _, _, _, _, _, err := manager.GetEventStats("payment")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Zero(t, dropped)
+	logger, _ := manager.loggers.Load("payment")
+	assert.Equal(t, int64(1), logger.(*Logger).loadStats().CancelledLogs)
+}
+
+func TestLoggerManager_Flush(t *testing.T) {
+	config := newGuardTestConfig(t)
+	config.FlushInterval = time.Hour
+	tmpDir := filepath.Dir(config.LogFilePath)
+
+	manager, err := NewLoggerManager(config)
+	require.NoError(t, err)
+	defer manager.Close()
+
+	manager.LogWithEvent("payment", "paid")
+	manager.LogWithEvent("login", "logged in")
+
+	require.NoError(t, manager.FlushEvent("payment", context.Background()))
+	messages, _ := readAllMessages(t, findLogFile(t, tmpDir, "payment"))
+	assert.Len(t, messages, 1)
+	messages, _ = readAllMessages(t, findLogFile(t, tmpDir, "login"))
+	assert.Empty(t, messages)
+
+	require.NoError(t, manager.FlushAll(context.Background()))
+	messages, _ = readAllMessages(t, findLogFile(t, tmpDir, "login"))
+	assert.Len(t, messages, 1)
+
+	assert.Error(t, manager.FlushEvent("unknown", context.Background()))
+}
+
+func TestLoggerManager_GetEventShardStats(t *testing.T) {
+	config := newGuardTestConfig(t)
+	config.FlushInterval = time.Hour
+
+	manager, err := NewLoggerManager(config)
+	require.NoError(t, err)
+	defer manager.Close()
+
+	for i := 0; i < 10; i++ {
+		manager.LogWithEvent("payment", "paid")
+	}
+	stats, err := manager.GetEventShardStats("payment")
+	require.NoError(t, err)
+	require.Len(t, stats, config.NumShards)
+	var writes int64
+	for _, shard := range stats {
+		writes += shard.Writes
+	}
+	assert.Equal(t, int64(10), writes)
+
+	_, err = manager.GetEventShardStats("unknown")
+	assert.Error(t, err)
+}
+
+func TestLoggerManager_GetEventStats(t *testing.T) {
+	config := newGuardTestConfig(t)
+	config.FlushInterval = time.Hour
+
+	manager, err := NewLoggerManager(config)
+	require.NoError(t, err)
+	defer manager.Close()
+
+	for i := 0; i < 3; i++ {
+		manager.LogWithEvent("payment", "paid")
+	}
+	manager.LogWithEvent("login", "logged in")
+
+	total, dropped, _, _, _, _, _, _, err := manager.GetEventStats("payment")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.Zero(t, dropped)
+
+	files, err := manager.GetEventFileStats("login")
+	require.NoError(t, err)
+	assert.Contains(t, filepath.Base(files.CurrentFile), "login")
+
+	_, _, _, _, _, _, _, _, err = manager.GetEventStats("unknown")
+	assert.Error(t, err)
+	_, err = manager.GetEventFileStats("unknown")
+	assert.Error(t, err)
+}
+
+func TestLoggerManager_CloseContext(t *testing.T) {
+	config := newGuardTestConfig(t)
+	config.FlushInterval = time.Hour
+	tmpDir := filepath.Dir(config.LogFilePath)
+
+	manager, err := NewLoggerManager(config)
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		manager.LogWithEvent("payment", "paid")
+		manager.LogWithEvent("login", "logged in")
+	}
+
+	report, err := manager.CloseWithTimeout(5 * time.Second)
+	require.NoError(t, err)
+	assert.False(t, report.DeadlineExceeded)
+	assert.Equal(t, int64(10), report.EntriesFlushed)
+	assert.Equal(t, int64(0), report.EntriesDropped)
+
+	messages, _ := readAllMessages(t, findLogFile(t, tmpDir, "payment"))
+	assert.Len(t, messages, 5)
+}
+
+func TestLoggerManager_CloseUploadsLastFile(t *testing.T) {
+	// newUploadingManager creates a manager whose files are uploaded through store
+	newUploadingManager := func(t *testing.T, store UploadBackend, start bool) (*LoggerManager, *Uploader) {
+		t.Helper()
+		uploader, err := NewUploaderWithBackend(GCSUploadConfig{InternalLogger: &captureLogger{}}, store)
+		require.NoError(t, err)
+		if start {
+			uploader.Start()
+		}
+		config := newGuardTestConfig(t)
+		config.FlushInterval = time.Hour
+		config.UploadChannel = uploader.GetUploadChannel()
+		config.UploadTracker = uploader.GetUploadTracker()
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		for i := 0; i < 5; i++ {
+			manager.LogWithEvent("payment", "paid")
+			manager.LogWithEvent("login", "logged in")
+		}
+		return manager, uploader
+	}
+
+	t.Run("UploadedBeforeCloseReturns", func(t *testing.T) {
+		store := newFakeStore(1) // One retry before each upload succeeds
+		manager, uploader := newUploadingManager(t, store, true)
+		defer uploader.Stop()
+		uploadedFiles := func() []string {
+			store.mu.Lock()
+			defer store.mu.Unlock()
+			var paths []string
+			for path := range store.uploaded {
+				paths = append(paths, path)
+			}
+			return paths
+		}
+
+		report, err := manager.CloseEventLoggerContext("payment", context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), report.EntriesFlushed)
+		assert.Zero(t, report.PendingUploads)
+		uploaded := uploadedFiles()
+		require.Len(t, uploaded, 1)
+		assert.Contains(t, filepath.Base(uploaded[0]), "payment_")
+		messages, _ := readAllMessages(t, uploaded[0])
+		assert.Len(t, messages, 5)
+
+		// The manager's Close uploads the remaining events' last files
+		managerReport, err := manager.CloseWithTimeout(5 * time.Second)
+		require.NoError(t, err)
+		assert.Zero(t, managerReport.PendingUploads)
+		assert.Len(t, uploadedFiles(), 2)
+		assert.Zero(t, uploader.GetUploadTracker().PendingFiles())
+	})
+
+	t.Run("BoundedByContext", func(t *testing.T) {
+		store := &gatedStore{release: make(chan struct{})}
+		manager, uploader := newUploadingManager(t, store, true)
+		defer uploader.Stop()
+		defer close(store.release)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		report, err := manager.CloseEventLoggerContext("payment", ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.True(t, report.DeadlineExceeded)
+		assert.Equal(t, int64(5), report.EntriesFlushed, "the data is on disk, only the upload is late")
+		assert.Equal(t, 1, report.PendingUploads)
+		assert.False(t, manager.HasEventLogger("payment"))
+	})
+
+	t.Run("NoWaitWithoutRunningUploader", func(t *testing.T) {
+		manager, _ := newUploadingManager(t, newFakeStore(0), false)
+
+		start := time.Now()
+		report, err := manager.CloseWithTimeout(5 * time.Second)
+		require.NoError(t, err)
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Equal(t, 2, report.PendingUploads, "queued for an uploader that never started")
+	})
+}
+
+func TestLoggerManager_EventConfig(t *testing.T) {
+	t.Run("EventsRunWithDifferentSettings", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		tmpDir := filepath.Dir(config.LogFilePath)
+
+		manager, err := NewLoggerManagerWithEventConfigs(config, map[string]EventConfig{
+			"payment": {BufferSize: 1024 * 1024, NumShards: 4, FlushInterval: 20 * time.Millisecond},
+			"debug":   {FlushInterval: time.Minute, MaxFileSize: 8 * 1024 * 1024},
+		})
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		for _, event := range []string{"payment", "debug"} {
+			wg.Add(1)
+			go func(event string) {
+				defer wg.Done()
+				for i := 0; i < 1000; i++ {
+					manager.LogWithEvent(event, fmt.Sprintf("%s-%d", event, i))
+				}
+			}(event)
+		}
+		wg.Wait()
+
+		snap := manager.Snapshot()
+		payment, debug := snap.Events["payment"], snap.Events["debug"]
+		require.Len(t, payment.Shards, 4)
+		require.Len(t, debug.Shards, 2)
+		assert.Greater(t, payment.Shards[0].Capacity, debug.Shards[0].Capacity)
+
+		paymentLogger, err := manager.getOrCreateLogger("payment")
+		require.NoError(t, err)
+		debugLogger, err := manager.getOrCreateLogger("debug")
+		require.NoError(t, err)
+		assert.Equal(t, 20*time.Millisecond, paymentLogger.config.FlushInterval)
+		assert.Equal(t, time.Minute, debugLogger.config.FlushInterval)
+		assert.Equal(t, int64(8*1024*1024), debugLogger.config.MaxFileSize)
+		assert.Equal(t, config.MaxFileSize, paymentLogger.config.MaxFileSize)
+
+		require.NoError(t, manager.Close())
+		for _, event := range []string{"payment", "debug"} {
+			messages, _ := readAllMessages(t, findLogFile(t, tmpDir, event))
+			assert.Len(t, messages, 1000, event)
+		}
+	})
+
+	t.Run("RejectsOverridesForExistingLogger", func(t *testing.T) {
+		manager, err := NewLoggerManager(newGuardTestConfig(t))
+		require.NoError(t, err)
+		defer manager.Close()
+
+		require.NoError(t, manager.InitializeEventLogger("payment"))
+		err = manager.SetEventConfig("payment", EventConfig{FlushInterval: time.Second})
+		assert.ErrorIs(t, err, ErrEventLoggerExists)
+
+		// Closing the logger lets the next one pick up the overrides
+		require.NoError(t, manager.CloseEventLogger("payment"))
+		require.NoError(t, manager.SetEventConfig("payment", EventConfig{FlushInterval: time.Second}))
+		logger, err := manager.getOrCreateLogger("payment")
+		require.NoError(t, err)
+		assert.Equal(t, time.Second, logger.config.FlushInterval)
+	})
+
+	t.Run("RejectsInvalidOverrides", func(t *testing.T) {
+		_, err := NewLoggerManagerWithEventConfigs(newGuardTestConfig(t), map[string]EventConfig{
+			"tiny": {NumShards: 16},
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("SmallerShardsRederiveMaxMessageSize", func(t *testing.T) {
+		manager, err := NewLoggerManagerWithEventConfigs(newGuardTestConfig(t), map[string]EventConfig{
+			"small": {BufferSize: 128 * 1024},
+		})
+		require.NoError(t, err)
+		defer manager.Close()
+
+		logger, err := manager.getOrCreateLogger("small")
+		require.NoError(t, err)
+		assert.Equal(t, logger.maxEntry, logger.config.MaxMessageSize)
+	})
+}
+
+func TestLoggerManager_EvictLRU(t *testing.T) {
+	newEvictConfig := func(t *testing.T, maxLoggers int) Config {
+		config := newGuardTestConfig(t)
+		config.MaxEventLoggers = maxLoggers
+		config.MaxEventLoggersPolicy = MaxEventLoggersEvictLRU
+		return config
+	}
+
+	t.Run("EvictsLeastRecentlyUsedAfterFlushing", func(t *testing.T) {
+		config := newEvictConfig(t, 2)
+		tmpDir := filepath.Dir(config.LogFilePath)
+		fake := useFakeClock(&config)
+
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+
+		manager.LogWithEvent("a", "first")
+		fake.Advance(time.Millisecond)
+		manager.LogWithEvent("b", "second")
+		fake.Advance(time.Millisecond)
+		manager.LogWithEvent("a", "third") // "b" is now least recently used
+		manager.LogWithEvent("c", "fourth")
+
+		assert.ElementsMatch(t, []string{"a", "c"}, manager.ListEventLoggers())
+		assert.Equal(t, int64(1), manager.GetEventLoggerEvictions())
+		_, capped := manager.GetEventRejectStats()
+		assert.Equal(t, int64(0), capped)
+
+		// The evicted logger was flushed and its counters are kept in the aggregate
+		messages, _ := readAllMessages(t, findLogFile(t, tmpDir, "b"))
+		assert.Len(t, messages, 1)
+		totalLogs, droppedLogs, _, _, _, _, _, _ := manager.GetAggregatedStats()
+		assert.Equal(t, int64(4), totalLogs)
+		assert.Equal(t, int64(0), droppedLogs)
+	})
+
+	t.Run("ThousandsOfUniqueEventsStayBounded", func(t *testing.T) {
+		const maxLoggers = 8
+		const numEvents = 2000
+		const numWorkers = 8
+
+		manager, err := NewLoggerManager(newEvictConfig(t, maxLoggers))
+		require.NoError(t, err)
+		defer manager.Close()
+
+		baseGoroutines := runtime.NumGoroutine()
+		var maxListed atomic.Int64
+		stop := make(chan struct{})
+		var observer sync.WaitGroup
+		observer.Add(1)
+		go func() {
+			defer observer.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				logcore.StoreMax(&maxListed, int64(len(manager.ListEventLoggers())))
+
+				// Aggregates never lose an evicted logger's counters
+				totalLogs, _, _, _, _, _, _, _ := manager.GetAggregatedStats()
+				assert.GreaterOrEqual(t, totalLogs, manager.GetEventLoggerEvictions())
+				time.Sleep(time.Millisecond)
+			}
+		}()
+
+		var wg sync.WaitGroup
+		for w := 0; w < numWorkers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := w; i < numEvents; i += numWorkers {
+					manager.LogWithEvent(fmt.Sprintf("request-%d", i), "payload")
+				}
+			}(w)
+		}
+		wg.Wait()
+		close(stop)
+		observer.Wait()
+
+		assert.LessOrEqual(t, maxListed.Load(), int64(maxLoggers))
+		assert.LessOrEqual(t, len(manager.ListEventLoggers()), maxLoggers)
+		assert.LessOrEqual(t, manager.numLoggers.Load(), int64(maxLoggers))
+		assert.GreaterOrEqual(t, manager.GetEventLoggerEvictions(), int64(numEvents-maxLoggers))
+
+		// Each live logger runs two workers; evicted loggers' workers must exit
+		maxGoroutines := baseGoroutines + 2*maxLoggers
+		for deadline := time.Now().Add(2 * time.Second); runtime.NumGoroutine() > maxGoroutines && time.Now().Before(deadline); {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.LessOrEqual(t, runtime.NumGoroutine(), maxGoroutines)
+
+		totalLogs, droppedLogs, _, _, _, _, _, _ := manager.GetAggregatedStats()
+		assert.Equal(t, int64(numEvents), totalLogs)
+		snap := manager.Snapshot()
+		assert.Equal(t, totalLogs, snap.Aggregate.TotalLogs)
+		assert.Equal(t, droppedLogs, snap.Aggregate.DroppedLogs)
+	})
+
+	t.Run("RejectIsDefault", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.MaxEventLoggers = 1
+		require.NoError(t, config.Validate())
+		assert.Equal(t, MaxEventLoggersReject, config.MaxEventLoggersPolicy)
+
+		config.MaxEventLoggersPolicy = "oldest"
+		assert.Error(t, config.Validate())
+	})
+}
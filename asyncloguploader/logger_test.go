@@ -1,15 +1,41 @@
 package asyncloguploader
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
 	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/neehar-mavuduru/logger-double-buffer/asyncloguploader/clock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// testClockStart is the time fake clocks start at in tests (rotated files are named after it)
+var testClockStart = time.Date(2025, 3, 14, 9, 26, 53, 0, time.UTC)
+
+// useFakeClock sets a clock.Fake reading testClockStart as config's Clock and returns it
+func useFakeClock(config *Config) *clock.Fake {
+	fake := clock.NewFake(testClockStart)
+	config.Clock = fake
+	return fake
+}
+
+// waitForFlushes waits until logger has finished n flushes, failed ones included, e.g. those
+// triggered by advancing its fake clock
+func waitForFlushes(t *testing.T, logger *Logger, n int64) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		return logger.stats.Flushes.Load()+logger.stats.FlushErrors.Load() >= n
+	}, 5*time.Second, time.Millisecond, "waiting for %d flushes", n)
+}
+
 func TestLogger_NewLogger(t *testing.T) {
 	t.Run("CreatesLoggerWithValidConfig", func(t *testing.T) {
 		tmpDir := t.TempDir()
@@ -22,10 +48,11 @@ func TestLogger_NewLogger(t *testing.T) {
 		require.NoError(t, err)
 		defer logger.Close()
 
-		assert.NotNil(t, logger.shardCollection)
-		assert.NotNil(t, logger.fileWriter)
-		assert.NotNil(t, logger.flushChan)
-		assert.NotNil(t, logger.semaphore)
+		assert.NotNil(t, logger.shardCollection.Load())
+		require.Len(t, logger.groups, 1)
+		assert.NotNil(t, logger.groups[0].fileWriter)
+		assert.NotNil(t, logger.groups[0].flushChan)
+		assert.NotNil(t, logger.groups[0].semaphore)
 	})
 
 	t.Run("ReturnsErrorForInvalidConfig", func(t *testing.T) {
@@ -52,10 +79,7 @@ func TestLogger_LogBytes(t *testing.T) {
 		data := []byte("test log entry")
 		logger.LogBytes(data)
 
-		// Give time for async operations
-		time.Sleep(50 * time.Millisecond)
-
-		totalLogs, droppedLogs, bytesWritten, _, _, _ := logger.GetStatsSnapshot()
+		totalLogs, droppedLogs, bytesWritten, _, _, _, _, _ := logger.GetStatsSnapshot()
 		assert.Equal(t, int64(1), totalLogs)
 		assert.Equal(t, int64(0), droppedLogs)
 		assert.Greater(t, bytesWritten, int64(0))
@@ -73,7 +97,7 @@ func TestLogger_LogBytes(t *testing.T) {
 		logger.Close()
 		logger.LogBytes([]byte("test"))
 
-		totalLogs, droppedLogs, _, _, _, _ := logger.GetStatsSnapshot()
+		totalLogs, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
 		assert.Equal(t, int64(1), totalLogs)
 		assert.Equal(t, int64(1), droppedLogs)
 	})
@@ -105,9 +129,8 @@ func TestLogger_LogBytes(t *testing.T) {
 		}
 
 		wg.Wait()
-		time.Sleep(200 * time.Millisecond) // Wait for flushes
 
-		totalLogs, _, bytesWritten, _, _, _ := logger.GetStatsSnapshot()
+		totalLogs, _, bytesWritten, _, _, _, _, _ := logger.GetStatsSnapshot()
 		assert.Equal(t, int64(numGoroutines*writesPerGoroutine), totalLogs)
 		assert.Greater(t, bytesWritten, int64(0))
 	})
@@ -131,10 +154,8 @@ func TestLogger_SwapCoordination(t *testing.T) {
 			logger.LogBytes(largeData)
 		}
 
-		time.Sleep(200 * time.Millisecond)
-
 		// Should have triggered swap and flush
-		totalLogs, _, _, _, _, _ := logger.GetStatsSnapshot()
+		totalLogs, _, _, _, _, _, _, _ := logger.GetStatsSnapshot()
 		assert.Greater(t, totalLogs, int64(0))
 	})
 
@@ -158,13 +179,315 @@ func TestLogger_SwapCoordination(t *testing.T) {
 		// Write after buffer is full (should retry after swap)
 		logger.LogBytes([]byte("after fill"))
 
-		time.Sleep(200 * time.Millisecond)
-
-		totalLogs, _, _, _, _, _ := logger.GetStatsSnapshot()
+		totalLogs, _, _, _, _, _, _, _ := logger.GetStatsSnapshot()
 		assert.Greater(t, totalLogs, int64(5))
 	})
 }
 
+func TestLogger_WriteRetryTimeout(t *testing.T) {
+	// newHeldPermitLogger returns a single-shard logger whose swap permit is held
+	// The logger's clock is a clock.Fake, returned with it
+	newHeldPermitLogger := func(t *testing.T, timeout time.Duration) (*Logger, *clock.Fake) {
+		t.Helper()
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 1
+		config.WriteRetryTimeout = timeout
+		fake := useFakeClock(&config)
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		t.Cleanup(func() { logger.Close() })
+
+		shard := logger.shardCollection.Load().GetShard(0)
+		shard.swapSemaphore <- struct{}{}
+		t.Cleanup(func() { <-shard.swapSemaphore })
+		return logger, fake
+	}
+
+	// fillShard marks both buffers full so every write misses the fast path and needs the permit
+	fillShard := func(logger *Logger) {
+		shard := logger.shardCollection.Load().GetShard(0)
+		shard.offsetA.Store(shard.capacity)
+		shard.offsetB.Store(shard.capacity)
+	}
+
+	t.Run("DefaultKeepsFiftyMilliseconds", func(t *testing.T) {
+		config := DefaultConfig("/tmp/test.log")
+		require.NoError(t, config.Validate())
+		assert.Equal(t, 50*time.Millisecond, config.WriteRetryTimeout)
+
+		config.WriteRetryTimeout = -time.Millisecond
+		assert.Error(t, config.Validate())
+	})
+
+	t.Run("ZeroFailsImmediately", func(t *testing.T) {
+		logger, _ := newHeldPermitLogger(t, 0)
+		fillShard(logger)
+
+		// The fake clock never moves, so the write returns without waiting
+		logger.LogBytes([]byte("full"))
+
+		_, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
+		assert.Equal(t, int64(1), droppedLogs)
+		_, retryPath, retryTimeouts := logger.GetWritePathStats()
+		assert.Equal(t, int64(1), retryPath)
+		assert.Equal(t, int64(1), retryTimeouts)
+	})
+
+	t.Run("WaitsUpToTimeout", func(t *testing.T) {
+		logger, fake := newHeldPermitLogger(t, 30*time.Millisecond)
+		fillShard(logger)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			logger.LogBytes([]byte("full"))
+		}()
+		fake.BlockUntil(2) // The flush ticker and the permit wait
+		fake.Advance(29 * time.Millisecond)
+		select {
+		case <-done:
+			t.Fatal("write gave up before WriteRetryTimeout")
+		case <-time.After(10 * time.Millisecond):
+		}
+		fake.Advance(time.Millisecond)
+		<-done
+
+		_, _, retryTimeouts := logger.GetWritePathStats()
+		assert.Equal(t, int64(1), retryTimeouts)
+	})
+
+	t.Run("CountsFastAndRetryPaths", func(t *testing.T) {
+		logger, _ := newHeldPermitLogger(t, 0)
+
+		for i := 0; i < 5; i++ {
+			logger.LogBytes([]byte("fits"))
+		}
+		fillShard(logger)
+		logger.LogBytes([]byte("full"))
+
+		fastPath, retryPath, retryTimeouts := logger.GetWritePathStats()
+		assert.Equal(t, int64(5), fastPath)
+		assert.Equal(t, int64(1), retryPath)
+		assert.Equal(t, int64(1), retryTimeouts)
+
+		snap := logger.Snapshot()
+		assert.Equal(t, fastPath, snap.Stats.FastPathWrites)
+		assert.Equal(t, retryPath, snap.Stats.RetryPathWrites)
+	})
+}
+
+func TestLogger_FlushThresholds(t *testing.T) {
+	t.Run("DefaultsKeepNinetyAndTwentyFive", func(t *testing.T) {
+		for _, config := range []Config{DefaultConfig("/tmp/test.log"), {LogFilePath: "/tmp/test.log"}} {
+			require.NoError(t, config.Validate())
+			assert.Equal(t, 90, config.ShardFlushThresholdPct)
+			assert.Equal(t, 25, config.ReadyShardsFlushPct)
+		}
+
+		// A default logger's shards and workers use the same thresholds as before they were configurable
+		logger, _ := newSizeTestLogger(t, "defaults", func(c *Config) { c.NumShards = 8 })
+		defer logger.Close()
+		standalone, err := NewShard(int(logger.shardCollection.Load().GetShard(0).Capacity()), 0)
+		require.NoError(t, err)
+		defer standalone.Close()
+		for _, shard := range logger.shardCollection.Load().Shards() {
+			assert.Equal(t, standalone.flushThreshold.Load(), shard.flushThreshold.Load())
+		}
+		assert.Equal(t, int32(2), logger.shardCollection.Load().threshold.Load())
+		assert.Equal(t, int32(2), logger.groups[0].threshold.Load())
+	})
+
+	t.Run("RejectsOutOfRange", func(t *testing.T) {
+		for _, pct := range []int{-1, 101} {
+			config := DefaultConfig("/tmp/test.log")
+			config.ShardFlushThresholdPct = pct
+			assert.Error(t, config.Validate())
+
+			config = DefaultConfig("/tmp/test.log")
+			config.ReadyShardsFlushPct = pct
+			assert.Error(t, config.Validate())
+		}
+	})
+
+	for _, pct := range []int{50, 99} {
+		t.Run(fmt.Sprintf("Configured%d", pct), func(t *testing.T) {
+			logger, _ := newSizeTestLogger(t, "configured", func(c *Config) {
+				c.NumShards = 8
+				c.ShardFlushThresholdPct = pct
+				c.ReadyShardsFlushPct = pct
+			})
+			defer logger.Close()
+
+			sc := logger.shardCollection.Load()
+			shard := sc.GetShard(0)
+			usable := int64(shard.Capacity() - headerOffset)
+			assert.Equal(t, int32(usable*int64(pct)/100), shard.flushThreshold.Load())
+			assert.Equal(t, int32(max(1, 8*pct/100)), sc.threshold.Load())
+			assert.Equal(t, int32(max(1, 8*pct/100)), logger.groups[0].threshold.Load())
+		})
+	}
+}
+
+func TestLogger_TryLogBytes(t *testing.T) {
+	newTryLogger := func(t *testing.T) *Logger {
+		t.Helper()
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 1
+		config.WriteRetryTimeout = 0
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		t.Cleanup(func() { logger.Close() })
+		return logger
+	}
+
+	t.Run("Accepted", func(t *testing.T) {
+		logger := newTryLogger(t)
+		assert.NoError(t, logger.TryLogBytes([]byte("ok")))
+	})
+
+	t.Run("BufferFull", func(t *testing.T) {
+		logger := newTryLogger(t)
+		shard := logger.shardCollection.Load().GetShard(0)
+		shard.swapSemaphore <- struct{}{}
+		defer func() { <-shard.swapSemaphore }()
+		shard.offsetA.Store(shard.capacity)
+		shard.offsetB.Store(shard.capacity)
+
+		assert.ErrorIs(t, logger.TryLogBytes([]byte("full")), ErrBufferFull)
+		_, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
+		assert.Equal(t, int64(1), droppedLogs)
+	})
+
+	t.Run("Oversized", func(t *testing.T) {
+		logger := newTryLogger(t)
+		assert.ErrorIs(t, logger.TryLogBytes(make([]byte, logger.config.MaxMessageSize+1)), ErrOversized)
+		oversized, _ := logger.GetMessageSizeStats()
+		assert.Equal(t, int64(1), oversized)
+	})
+
+	t.Run("LowDiskSpace", func(t *testing.T) {
+		logger := newTryLogger(t)
+		logger.degraded.Store(true)
+		assert.ErrorIs(t, logger.TryLogBytes([]byte("degraded")), ErrLowDiskSpace)
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		logger := newTryLogger(t)
+		require.NoError(t, logger.Close())
+		assert.ErrorIs(t, logger.TryLogBytes([]byte("late")), ErrClosed)
+	})
+
+	t.Run("FastPathDoesNotAllocate", func(t *testing.T) {
+		logger := newTryLogger(t)
+		data := []byte("allocation free")
+		allocs := testing.AllocsPerRun(1000, func() {
+			_ = logger.TryLogBytes(data)
+		})
+		assert.Equal(t, 0.0, allocs)
+	})
+}
+
+func TestLogger_LogBytesCtx(t *testing.T) {
+	newCtxLogger := func(t *testing.T) (*Logger, string) {
+		t.Helper()
+		dir := t.TempDir()
+		config := DefaultConfig(filepath.Join(dir, "ctx.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 1
+		config.FlushInterval = time.Hour
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		t.Cleanup(func() { logger.Close() })
+		return logger, dir
+	}
+
+	t.Run("LiveContextWrites", func(t *testing.T) {
+		logger, dir := newCtxLogger(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		require.NoError(t, logger.LogBytesCtx(ctx, []byte("live")))
+		require.NoError(t, logger.LogBytesCtx(context.Background(), []byte("background")))
+
+		require.NoError(t, logger.Close())
+		messages, _ := readAllMessages(t, findLogFile(t, dir, "ctx"))
+		assert.Equal(t, [][]byte{[]byte("live"), []byte("background")}, messages)
+	})
+
+	t.Run("CancelledBeforeCopy", func(t *testing.T) {
+		logger, dir := newCtxLogger(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		assert.ErrorIs(t, logger.LogBytesCtx(ctx, []byte("cancelled")), context.Canceled)
+
+		stats := logger.loadStats()
+		assert.Equal(t, int64(1), stats.TotalLogs)
+		assert.Equal(t, int64(1), stats.CancelledLogs)
+		assert.Zero(t, stats.DroppedLogs)
+		assert.Zero(t, stats.BytesWritten)
+
+		require.NoError(t, logger.LogBytesCtx(context.Background(), []byte("kept")))
+		require.NoError(t, logger.Close())
+		messages, _ := readAllMessages(t, findLogFile(t, dir, "ctx"))
+		assert.Equal(t, [][]byte{[]byte("kept")}, messages)
+	})
+
+	t.Run("CancelledDuringRetryWait", func(t *testing.T) {
+		logger, dir := newCtxLogger(t)
+		require.Equal(t, 50*time.Millisecond, logger.config.WriteRetryTimeout)
+		require.NoError(t, logger.TryLogBytes([]byte("kept")))
+
+		// Hold the permit and fill both buffers so the write has to wait on the retry path
+		shard := logger.shardCollection.Load().GetShard(0)
+		shard.swapSemaphore <- struct{}{}
+		offsetA, offsetB := shard.offsetA.Load(), shard.offsetB.Load()
+		shard.offsetA.Store(shard.capacity)
+		shard.offsetB.Store(shard.capacity)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(5*time.Millisecond, cancel)
+		start := time.Now()
+		err := logger.LogBytesCtx(ctx, []byte("cancelled"))
+		elapsed := time.Since(start)
+
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Less(t, elapsed, 40*time.Millisecond, "the wait should end when the context is cancelled")
+		stats := logger.loadStats()
+		assert.Equal(t, int64(1), stats.CancelledLogs)
+		assert.Equal(t, int64(1), stats.RetryPathWrites)
+		assert.Zero(t, stats.RetryTimeouts)
+		assert.Zero(t, stats.DroppedLogs)
+		assert.Equal(t, int64(lengthPrefixSize+len("kept")), stats.BytesWritten)
+
+		// The filled buffers may already have been flushed as-is, so check the raw file contents
+		shard.offsetA.Store(offsetA)
+		shard.offsetB.Store(offsetB)
+		<-shard.swapSemaphore
+		require.NoError(t, logger.Close())
+		data, err := os.ReadFile(findLogFile(t, dir, "ctx"))
+		require.NoError(t, err)
+		assert.True(t, bytes.Contains(data, []byte("kept")))
+		assert.False(t, bytes.Contains(data, []byte("cancelled")))
+	})
+
+	t.Run("LiveContextDoesNotAllocate", func(t *testing.T) {
+		logger, _ := newCtxLogger(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		data := []byte("allocation free")
+		allocs := testing.AllocsPerRun(1000, func() {
+			_ = logger.LogBytesCtx(ctx, data)
+		})
+		assert.Equal(t, 0.0, allocs)
+	})
+}
+
 func TestLogger_Flush(t *testing.T) {
 	t.Run("FlushesWhenThresholdReached", func(t *testing.T) {
 		tmpDir := t.TempDir()
@@ -172,6 +495,7 @@ func TestLogger_Flush(t *testing.T) {
 		config.BufferSize = 8 * 1024 * 1024
 		config.NumShards = 8
 		config.FlushInterval = 100 * time.Millisecond
+		useFakeClock(&config) // No ticks: only the threshold triggers a flush
 
 		logger, err := NewLogger(config)
 		require.NoError(t, err)
@@ -184,11 +508,8 @@ func TestLogger_Flush(t *testing.T) {
 			logger.LogBytes(largeData)
 		}
 
-		time.Sleep(500 * time.Millisecond)
-
-		_, _, _, flushes, _, _ := logger.GetStatsSnapshot()
-		// May or may not flush depending on timing and threshold
-		_ = flushes
+		waitForFlushes(t, logger, 1)
+		assert.Zero(t, logger.stats.IntervalFlushes.Load())
 	})
 
 	t.Run("FlushesOnInterval", func(t *testing.T) {
@@ -197,18 +518,106 @@ func TestLogger_Flush(t *testing.T) {
 		config.BufferSize = 8 * 1024 * 1024
 		config.NumShards = 8
 		config.FlushInterval = 50 * time.Millisecond
+		config.ShardSelection = ShardSelectionKeyHash
+		fake := useFakeClock(&config)
 
 		logger, err := NewLogger(config)
 		require.NoError(t, err)
 		defer logger.Close()
 
-		logger.LogBytes([]byte("test"))
+		// Swap out one shard: the threshold of 2 ready shards is not reached
+		largeData := make([]byte, 400*1024)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, logger.TryLogBytesKeyed(7, largeData))
+		}
+		assert.Zero(t, logger.stats.Flushes.Load())
+
+		// The next tick flushes the swapped-out shard anyway
+		fake.Advance(config.FlushInterval)
+		waitForFlushes(t, logger, 1)
+		assert.Equal(t, int64(1), logger.stats.IntervalFlushes.Load())
+	})
+}
+
+func TestLogger_OnDemandFlush(t *testing.T) {
+	newFlushLogger := func(t *testing.T) (*Logger, string) {
+		t.Helper()
+		tmpDir := t.TempDir()
+		config := DefaultConfig(filepath.Join(tmpDir, "flush.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 4
+		config.FlushInterval = time.Hour // Only explicit flushes
 
-		time.Sleep(100 * time.Millisecond)
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		t.Cleanup(func() { logger.Close() })
+		return logger, tmpDir
+	}
+
+	t.Run("DataOnDiskWhenFlushReturns", func(t *testing.T) {
+		logger, tmpDir := newFlushLogger(t)
+		for i := 0; i < 100; i++ {
+			logger.Log(fmt.Sprintf("record %d", i))
+		}
 
-		_, _, _, flushes, _, _ := logger.GetStatsSnapshot()
-		// May or may not flush depending on threshold
-		_ = flushes
+		require.NoError(t, logger.Flush(context.Background()))
+		messages, _ := readAllMessages(t, findLogFile(t, tmpDir, "flush"))
+		assert.Len(t, messages, 100)
+
+		// Flushing with nothing buffered is a no-op
+		require.NoError(t, logger.Flush(context.Background()))
+		messages, _ = readAllMessages(t, findLogFile(t, tmpDir, "flush"))
+		assert.Len(t, messages, 100)
+	})
+
+	t.Run("SafeUnderConcurrentTraffic", func(t *testing.T) {
+		logger, _ := newFlushLogger(t)
+
+		var wg sync.WaitGroup
+		stop := make(chan struct{})
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						logger.LogBytes([]byte("concurrent"))
+					}
+				}
+			}()
+		}
+		for i := 0; i < 20; i++ {
+			require.NoError(t, logger.Flush(context.Background()))
+		}
+		close(stop)
+		wg.Wait()
+
+		_, _, _, flushes, flushErrors, _, _, _ := logger.GetStatsSnapshot()
+		assert.Greater(t, flushes, int64(0))
+		assert.Equal(t, int64(0), flushErrors)
+	})
+
+	t.Run("ContextEndsWhileFlushWorkerBusy", func(t *testing.T) {
+		logger, _ := newFlushLogger(t)
+		logger.Log("queued")
+
+		// Hold the flush semaphore so the worker blocks inside the first on-demand flush
+		logger.groups[0].semaphore <- struct{}{}
+		go logger.Flush(context.Background())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, logger.Flush(ctx), context.DeadlineExceeded)
+		<-logger.groups[0].semaphore
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		logger, _ := newFlushLogger(t)
+		require.NoError(t, logger.Close())
+		assert.ErrorIs(t, logger.Flush(context.Background()), ErrClosed)
 	})
 }
 
@@ -226,7 +635,7 @@ func TestLogger_Close(t *testing.T) {
 		err = logger.Close()
 		assert.NoError(t, err)
 
-		totalLogs, _, _, _, _, _ := logger.GetStatsSnapshot()
+		totalLogs, _, _, _, _, _, _, _ := logger.GetStatsSnapshot()
 		assert.Greater(t, totalLogs, int64(0))
 	})
 
@@ -247,6 +656,155 @@ func TestLogger_Close(t *testing.T) {
 	})
 }
 
+// slowFileWriter wraps a FileWriter and blocks every write until release is closed
+type slowFileWriter struct {
+	FileWriter
+	started chan struct{} // Signaled when a write starts
+	release chan struct{} // Closed to let writes proceed
+	closed  chan struct{} // Closed after Close
+}
+
+func newSlowFileWriter(inner FileWriter) *slowFileWriter {
+	return &slowFileWriter{
+		FileWriter: inner,
+		started:    make(chan struct{}, 1),
+		release:    make(chan struct{}),
+		closed:     make(chan struct{}),
+	}
+}
+
+func (w *slowFileWriter) WriteVectored(buffers [][]byte) (int, error) {
+	select {
+	case w.started <- struct{}{}:
+	default:
+	}
+	<-w.release
+	return w.FileWriter.WriteVectored(buffers)
+}
+
+func (w *slowFileWriter) Close() error {
+	defer close(w.closed)
+	return w.FileWriter.Close()
+}
+
+func TestLogger_CloseContext(t *testing.T) {
+	// newMidFlushLogger returns a logger whose flush worker is blocked writing 10 entries,
+	// with 10 more entries buffered behind it. Its clock is a clock.Fake, returned with it
+	newMidFlushLogger := func(t *testing.T) (*Logger, *slowFileWriter, string, *clock.Fake) {
+		t.Helper()
+		tmpDir := t.TempDir()
+		config := DefaultConfig(filepath.Join(tmpDir, "close.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 4
+		config.FlushInterval = time.Hour // Only explicit flushes
+		fake := useFakeClock(&config)
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		slow := newSlowFileWriter(logger.groups[0].fileWriter)
+		logger.groups[0].fileWriter = slow
+
+		for i := 0; i < 10; i++ {
+			logger.Log(fmt.Sprintf("in-flight %d", i))
+		}
+		go logger.Flush(context.Background())
+		select {
+		case <-slow.started:
+		case <-time.After(time.Second):
+			t.Fatal("flush worker did not start writing")
+		}
+		for i := 0; i < 10; i++ {
+			logger.Log(fmt.Sprintf("buffered %d", i))
+		}
+		return logger, slow, tmpDir, fake
+	}
+
+	t.Run("FlushesEverythingWithinDeadline", func(t *testing.T) {
+		logger, slow, tmpDir, _ := newMidFlushLogger(t)
+
+		type result struct {
+			report CloseReport
+			err    error
+		}
+		results := make(chan result, 1)
+		go func() {
+			report, err := logger.CloseWithTimeout(5 * time.Second)
+			results <- result{report, err}
+		}()
+
+		// Close must wait for the in-flight write instead of proceeding without it
+		select {
+		case <-results:
+			t.Fatal("Close returned while a flush was in progress")
+		case <-time.After(50 * time.Millisecond):
+		}
+		close(slow.release)
+
+		res := <-results
+		require.NoError(t, res.err)
+		assert.False(t, res.report.DeadlineExceeded)
+		assert.Equal(t, int64(20), res.report.EntriesFlushed)
+		assert.Equal(t, int64(0), res.report.EntriesDropped)
+		assert.Greater(t, res.report.BytesFlushed, int64(0))
+
+		messages, _ := readAllMessages(t, findLogFile(t, tmpDir, "close"))
+		assert.Len(t, messages, 20)
+	})
+
+	t.Run("ReportsEntriesLeftAtDeadline", func(t *testing.T) {
+		logger, slow, tmpDir, fake := newMidFlushLogger(t)
+
+		type result struct {
+			report CloseReport
+			err    error
+		}
+		results := make(chan result, 1)
+		go func() {
+			report, err := logger.CloseWithTimeout(50 * time.Millisecond)
+			results <- result{report, err}
+		}()
+
+		// The deadline timer exists once Close has started; the deadline passes when the clock reaches it
+		require.Eventually(t, logger.life.Closed, time.Second, time.Millisecond)
+		fake.Advance(50 * time.Millisecond)
+		res := <-results
+		report, err := res.report, res.err
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.True(t, report.DeadlineExceeded)
+		assert.Equal(t, int64(0), report.EntriesFlushed)
+		assert.Equal(t, int64(20), report.EntriesDropped)
+		assert.ErrorIs(t, logger.TryLogBytes([]byte("late")), ErrClosed)
+
+		// The in-flight write completes in the background; the buffered entries are abandoned
+		close(slow.release)
+		select {
+		case <-slow.closed:
+		case <-time.After(time.Second):
+			t.Fatal("file writer was not closed after the in-flight write")
+		}
+		messages, _ := readAllMessages(t, findLogFile(t, tmpDir, "close"))
+		assert.Len(t, messages, 10)
+	})
+
+	t.Run("SecondCloseReturnsEmptyReport", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "close.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 4
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		logger.Log("once")
+
+		report, err := logger.CloseContext(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), report.EntriesFlushed)
+
+		report, err = logger.CloseContext(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, CloseReport{}, report)
+	})
+}
+
 func TestLogger_GetStatsSnapshot(t *testing.T) {
 	t.Run("ReturnsStatsSnapshot", func(t *testing.T) {
 		tmpDir := t.TempDir()
@@ -259,9 +817,8 @@ func TestLogger_GetStatsSnapshot(t *testing.T) {
 		defer logger.Close()
 
 		logger.LogBytes([]byte("test"))
-		time.Sleep(50 * time.Millisecond)
 
-		totalLogs, droppedLogs, bytesWritten, _, _, _ := logger.GetStatsSnapshot()
+		totalLogs, droppedLogs, bytesWritten, _, _, _, _, _ := logger.GetStatsSnapshot()
 		assert.Equal(t, int64(1), totalLogs)
 		assert.Equal(t, int64(0), droppedLogs)
 		assert.Greater(t, bytesWritten, int64(0))
@@ -275,22 +832,22 @@ func TestLogger_GetFlushMetrics(t *testing.T) {
 		config.BufferSize = 8 * 1024 * 1024
 		config.NumShards = 8
 		config.FlushInterval = 50 * time.Millisecond
+		useFakeClock(&config)
 
 		logger, err := NewLogger(config)
 		require.NoError(t, err)
 		defer logger.Close()
 
-		// Trigger flush
-		largeData := make([]byte, 1024*1024)
+		// Trigger flush: fill enough shards to reach the threshold
+		largeData := make([]byte, 512*1024)
 		for i := 0; i < 20; i++ {
 			logger.LogBytes(largeData)
 		}
 
-		time.Sleep(200 * time.Millisecond)
-
+		waitForFlushes(t, logger, 1)
 		metrics := logger.GetFlushMetrics()
-		// Metrics may be zero if no flushes occurred yet
-		_ = metrics
+		assert.Positive(t, metrics.TotalFlushes)
+		assert.Positive(t, metrics.MaxFlushDuration)
 	})
 }
 
@@ -306,11 +863,109 @@ func TestLogger_Log(t *testing.T) {
 		defer logger.Close()
 
 		logger.Log("test message")
-		time.Sleep(50 * time.Millisecond)
 
-		totalLogs, droppedLogs, bytesWritten, _, _, _ := logger.GetStatsSnapshot()
+		totalLogs, droppedLogs, bytesWritten, _, _, _, _, _ := logger.GetStatsSnapshot()
 		assert.Equal(t, int64(1), totalLogs)
 		assert.Equal(t, int64(0), droppedLogs)
 		assert.Greater(t, bytesWritten, int64(0))
 	})
 }
+
+// captureLogger is an InternalLogger that records formatted messages
+type captureLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (c *captureLogger) Printf(format string, args ...any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, fmt.Sprintf(format, args...))
+}
+
+func (c *captureLogger) Messages() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.messages...)
+}
+
+func TestLogger_InternalLogger(t *testing.T) {
+	t.Run("DefaultsToStderr", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		require.NoError(t, config.Validate())
+		assert.Equal(t, defaultInternalLogger, config.InternalLogger)
+
+		gcsConfig := DefaultGCSUploadConfig("bucket")
+		require.NoError(t, gcsConfig.Validate())
+		assert.Equal(t, defaultInternalLogger, gcsConfig.InternalLogger)
+	})
+
+	t.Run("ReceivesFlushErrors", func(t *testing.T) {
+		capture := &captureLogger{}
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 4
+		config.InternalLogger = capture
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		defer logger.Close()
+
+		// Closing the file underneath the writer makes the next flush fail
+		logger.Log("lost")
+		require.NoError(t, logger.groups[0].fileWriter.(*SizeFileWriter).file.Close())
+		assert.Error(t, logger.Flush(context.Background()))
+
+		messages := capture.Messages()
+		require.NotEmpty(t, messages)
+		assert.Contains(t, messages[0], "[FLUSH_ERROR] Logger="+config.LogFilePath)
+		assert.NotContains(t, messages[0], "\n")
+	})
+
+	t.Run("ReceivesFreeSpaceWarnings", func(t *testing.T) {
+		capture := &captureLogger{}
+		fake := &fakeStatfs{}
+		fake.availablePct.Store(50)
+		fsConfig := DefaultFreeSpaceConfig()
+		fsConfig.CheckInterval = time.Hour
+		fsConfig.statfs = fake.statfs
+
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 4
+		config.FreeSpaceConfig = &fsConfig
+		config.InternalLogger = capture
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		defer logger.Close()
+
+		fake.availablePct.Store(3)
+		logger.freeSpace.sample()
+		fake.availablePct.Store(50)
+		logger.freeSpace.sample()
+
+		messages := capture.Messages()
+		require.Len(t, messages, 2)
+		assert.Contains(t, messages[0], "[WARNING] Free space low for "+config.LogFilePath)
+		assert.Contains(t, messages[1], "[WARNING] Free space recovered for "+config.LogFilePath)
+	})
+
+	t.Run("SlogAdapterMapsTagsToLevels", func(t *testing.T) {
+		var buf bytes.Buffer
+		internal := NewSlogInternalLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+		internal.Printf("[DEBUG] Processing file for upload: %s", "a.log")
+		internal.Printf("[ERROR] Failed to upload %s", "a.log")
+
+		lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+		require.Len(t, lines, 2)
+		var debug, failure map[string]any
+		require.NoError(t, json.Unmarshal(lines[0], &debug))
+		require.NoError(t, json.Unmarshal(lines[1], &failure))
+		assert.Equal(t, "DEBUG", debug["level"])
+		assert.Equal(t, "Processing file for upload: a.log", debug["msg"])
+		assert.Equal(t, "ERROR", failure["level"])
+		assert.Equal(t, "ERROR", failure["tag"])
+	})
+}
@@ -0,0 +1,170 @@
+package asyncloguploader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ManifestSuffix is appended to an uploaded object's name to name its manifest
+const ManifestSuffix = ".manifest.json"
+
+// Manifest summarizes an uploaded log object for downstream pipelines (GCSUploadConfig.WriteManifests)
+type Manifest struct {
+	Object          string          `json:"object"`
+	Event           string          `json:"event,omitempty"`
+	FileName        string          `json:"file_name"`                  // Base name of the local file
+	CreatedAt       time.Time       `json:"created_at,omitzero"`        // From the file header; omitted for headerless and compressed files
+	RotatedAt       time.Time       `json:"rotated_at"`                 // FileReadyEvent.RotatedAt, or the file's modification time
+	Reason          FileReadyReason `json:"reason,omitempty"`           // From FileReadyEvent; omitted for paths sent on the upload channel
+	FileBytes       int64           `json:"file_bytes"`                 // Size of the object
+	CRC32C          uint32          `json:"crc32c"`                     // Castagnoli checksum of the object
+	ContentEncoding string          `json:"content_encoding,omitempty"` // Set for compressed files
+
+	// Decoded with Reader before upload; only for uncompressed files (Decoded false otherwise)
+	Decoded            bool  `json:"decoded"`
+	Entries            int64 `json:"entries"`                       // Messages, with chunked messages counted once
+	PayloadBytes       int64 `json:"payload_bytes"`                 // Message bytes, excluding framing, headers and padding
+	IncompleteMessages int   `json:"incomplete_messages,omitempty"` // Chunked messages missing chunks (see Reader.IncompleteMessages)
+	CorruptRegions     int   `json:"corrupt_regions,omitempty"`     // Corrupt entries or shards skipped while decoding
+}
+
+// fileSummary is the result of the pass over a file before its upload
+type fileSummary struct {
+	size    int64
+	crc     uint32
+	modTime time.Time
+
+	// Set when the file was decoded in the same pass
+	decoded            bool
+	created            time.Time
+	entries            int64
+	payloadBytes       int64
+	incompleteMessages int
+	corruptRegions     int
+}
+
+// summarizeFile checksums the file at path and, with decode, decodes it in the same read to count
+// its entries. Decoding errors are counted, never returned
+func summarizeFile(path string, decode bool) (fileSummary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return fileSummary{}, err
+	}
+	defer f.Close()
+
+	var summary fileSummary
+	if info, err := f.Stat(); err == nil {
+		summary.modTime = info.ModTime()
+	}
+	h := crc32.New(castagnoliTable)
+	r := io.TeeReader(f, h)
+	if decode {
+		summary.decoded = true
+		decodeSummary(NewReader(r), &summary)
+	}
+	// The reader stops at a zero-filled tail or unrecoverable corruption; checksum the rest too
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return fileSummary{}, err
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fileSummary{}, err
+	}
+	summary.size = size
+	summary.crc = h.Sum32()
+	return summary, nil
+}
+
+// decodeSummary counts the messages of reader into summary
+func decodeSummary(reader *Reader, summary *fileSummary) {
+	var last error
+	for {
+		msg, err := reader.Next()
+		if err == nil {
+			summary.entries++
+			summary.payloadBytes += int64(len(msg))
+			continue
+		}
+		// The reader repeats unrecoverable errors; recoverable ones are new values
+		if errors.Is(err, io.EOF) || !errors.Is(err, ErrCorruptLog) || err == last {
+			break
+		}
+		summary.corruptRegions++
+		last = err
+	}
+	if header, ok := reader.FileHeader(); ok {
+		summary.created = header.Created
+	}
+	summary.incompleteMessages = reader.IncompleteMessages()
+}
+
+// newManifest builds the manifest of a file uploaded as objectName
+func newManifest(job uploadJob, objectName string, summary fileSummary) Manifest {
+	m := Manifest{
+		Object:             objectName,
+		Event:              job.event,
+		FileName:           filepath.Base(job.filePath),
+		CreatedAt:          summary.created,
+		RotatedAt:          job.rotatedAt,
+		Reason:             job.reason,
+		FileBytes:          summary.size,
+		CRC32C:             summary.crc,
+		ContentEncoding:    contentEncodingFor(job.filePath),
+		Decoded:            summary.decoded,
+		Entries:            summary.entries,
+		PayloadBytes:       summary.payloadBytes,
+		IncompleteMessages: summary.incompleteMessages,
+		CorruptRegions:     summary.corruptRegions,
+	}
+	if m.RotatedAt.IsZero() {
+		m.RotatedAt = summary.modTime
+	}
+	return m
+}
+
+// writeManifest stores the manifest of the file uploaded as objectName and returns the manifest's
+// object name. Failures are logged and counted in Stats.ManifestFailures; the upload stands
+func (u *Uploader) writeManifest(job uploadJob, objectName string, summary fileSummary) string {
+	name := objectName + ManifestSuffix
+	if err := u.uploadManifest(name, newManifest(job, objectName, summary)); err != nil {
+		u.logger.Printf("[WARNING] Failed to write manifest %s: %v", name, err)
+		u.statsMu.Lock()
+		u.uploadStats.ManifestFailures++
+		u.statsMu.Unlock()
+		return ""
+	}
+	u.statsMu.Lock()
+	u.uploadStats.Manifests++
+	u.statsMu.Unlock()
+	return name
+}
+
+// uploadManifest uploads manifest as objectName through a temporary file, as backends upload files
+func (u *Uploader) uploadManifest(objectName string, manifest Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp("", "manifest-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := u.backend.Upload(u.ctx, tmp.Name(), objectName); err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+	return nil
+}
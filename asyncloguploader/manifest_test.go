@@ -0,0 +1,152 @@
+package asyncloguploader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// manifestFailingBackend is a filesystem backend whose manifest uploads fail
+type manifestFailingBackend struct {
+	UploadBackend
+}
+
+func (b manifestFailingBackend) Upload(ctx context.Context, localPath, objectName string) error {
+	if strings.HasSuffix(objectName, ManifestSuffix) {
+		return errors.New("googleapi: Error 503: Service Unavailable")
+	}
+	return b.UploadBackend.Upload(ctx, localPath, objectName)
+}
+
+// readManifest decodes the manifest stored for object in a filesystem backend directory
+func readManifest(t *testing.T, dir, object string) Manifest {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, object+ManifestSuffix))
+	require.NoError(t, err)
+	var m Manifest
+	require.NoError(t, json.Unmarshal(data, &m))
+	return m
+}
+
+func TestUploader_WriteManifests(t *testing.T) {
+	t.Run("MatchesDecodedFile", func(t *testing.T) {
+		dst := t.TempDir()
+		uploader, err := NewUploaderWithBackend(GCSUploadConfig{ObjectPrefix: "events/", WriteManifests: true}, NewFileSystemBackend(dst))
+		require.NoError(t, err)
+		uploader.Start()
+
+		config := DefaultConfig(filepath.Join(t.TempDir(), "app.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 2
+		config.EventName = "payment"
+		config.FileEventChannel = uploader.GetFileEventChannel()
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		for i := 0; i < 100; i++ {
+			logger.LogBytes([]byte(strings.Repeat("x", i+1)))
+		}
+		require.NoError(t, logger.Close())
+		uploader.Stop()
+
+		completion := <-uploader.GetCompletedUploads()
+		assert.Equal(t, "events/"+filepath.Base(completion.FilePath)+ManifestSuffix, completion.Manifest)
+		m := readManifest(t, dst, completion.Object)
+
+		messages, reader := readAllMessages(t, completion.FilePath)
+		var payload int64
+		for _, msg := range messages {
+			payload += int64(len(msg))
+		}
+		header, ok := reader.FileHeader()
+		require.True(t, ok)
+		object, err := os.ReadFile(filepath.Join(dst, completion.Object))
+		require.NoError(t, err)
+
+		assert.Equal(t, completion.Object, m.Object)
+		assert.Equal(t, "payment", m.Event)
+		assert.Equal(t, filepath.Base(completion.FilePath), m.FileName)
+		assert.Equal(t, FileClosed, m.Reason)
+		assert.WithinDuration(t, time.Now(), m.RotatedAt, time.Minute)
+		assert.True(t, header.Created.Equal(m.CreatedAt))
+		assert.Equal(t, int64(len(object)), m.FileBytes)
+		assert.Equal(t, crc32.Checksum(object, castagnoliTable), m.CRC32C)
+		assert.Empty(t, m.ContentEncoding)
+		assert.True(t, m.Decoded)
+		assert.Equal(t, int64(100), m.Entries)
+		assert.Equal(t, int64(len(messages)), m.Entries)
+		assert.Equal(t, payload, m.PayloadBytes)
+		assert.Zero(t, m.IncompleteMessages)
+		assert.Zero(t, m.CorruptRegions)
+		assert.Equal(t, int64(1), uploader.GetStats().Manifests)
+	})
+
+	t.Run("CompressedFilesAreNotDecoded", func(t *testing.T) {
+		dst := t.TempDir()
+		uploader, err := NewUploaderWithBackend(GCSUploadConfig{WriteManifests: true}, NewFileSystemBackend(dst))
+		require.NoError(t, err)
+		path := writeUploadFile(t, t.TempDir(), "app_1.log.gz")
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+
+		uploader.Start()
+		uploader.GetUploadChannel() <- path
+		uploader.Stop()
+
+		m := readManifest(t, dst, "app_1.log.gz")
+		assert.Equal(t, "gzip", m.ContentEncoding)
+		assert.False(t, m.Decoded)
+		assert.Zero(t, m.Entries)
+		assert.True(t, m.CreatedAt.IsZero())
+		assert.True(t, info.ModTime().Equal(m.RotatedAt), "paths fall back to the modification time")
+		assert.Empty(t, m.Reason)
+		assert.Equal(t, int64(len("log data")), m.FileBytes)
+	})
+
+	t.Run("ManifestFailureDoesNotFailUpload", func(t *testing.T) {
+		dst := t.TempDir()
+		config := GCSUploadConfig{WriteManifests: true, DeleteAfterUpload: true, InternalLogger: &captureLogger{}}
+		uploader, err := NewUploaderWithBackend(config, manifestFailingBackend{NewFileSystemBackend(dst)})
+		require.NoError(t, err)
+		path := writeUploadFile(t, t.TempDir(), "app_1.log")
+
+		uploader.Start()
+		uploader.GetUploadChannel() <- path
+		uploader.Stop()
+
+		completion, ok := <-uploader.GetCompletedUploads()
+		require.True(t, ok)
+		assert.Empty(t, completion.Manifest)
+		assert.True(t, completion.Deleted)
+		assert.FileExists(t, filepath.Join(dst, "app_1.log"))
+		assert.NoFileExists(t, filepath.Join(dst, "app_1.log"+ManifestSuffix))
+
+		stats := uploader.GetStats()
+		assert.Equal(t, int64(1), stats.Successful)
+		assert.Zero(t, stats.Failed)
+		assert.Zero(t, stats.RetriedUploads)
+		assert.Equal(t, int64(1), stats.ManifestFailures)
+		assert.Zero(t, stats.Manifests)
+	})
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		dst := t.TempDir()
+		uploader, err := NewUploaderWithBackend(GCSUploadConfig{}, NewFileSystemBackend(dst))
+		require.NoError(t, err)
+
+		uploader.Start()
+		uploader.GetUploadChannel() <- writeUploadFile(t, t.TempDir(), "app_1.log")
+		uploader.Stop()
+
+		assert.NoFileExists(t, filepath.Join(dst, "app_1.log"+ManifestSuffix))
+		assert.Empty(t, (<-uploader.GetCompletedUploads()).Manifest)
+	})
+}
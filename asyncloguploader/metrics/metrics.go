@@ -0,0 +1,256 @@
+// Package metrics exports asyncloguploader statistics as Prometheus metrics
+//
+// Counters and gauges are read from Snapshot at scrape time, so they are always consistent with
+// GetStatsSnapshot and the Snapshot invariants. Duration and size histograms are fed by the flush
+// and upload observers, which each collector installs on construction (replacing any observer
+// set before). The package is separate so that users who do not want the Prometheus client do
+// not link it.
+//
+//	logger, _ := asyncloguploader.NewLogger(config)
+//	prometheus.MustRegister(metrics.NewPrometheusCollector(logger))
+package metrics
+
+import (
+	"github.com/neehar-mavuduru/logger-double-buffer/asyncloguploader"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "asyncloguploader"
+
+// DurationBuckets are the histogram buckets (seconds) for flush, write and upload durations:
+// 100µs doubling up to ~6.5s
+var DurationBuckets = prometheus.ExponentialBuckets(0.0001, 2, 17)
+
+// FileSizeBuckets are the histogram buckets (bytes) for uploaded file sizes: 1MB doubling up to 8GB
+var FileSizeBuckets = prometheus.ExponentialBuckets(1<<20, 2, 14)
+
+// Collector exports logger statistics
+// A Collector for a LoggerManager labels every logger metric with "event"
+type Collector struct {
+	snapshots func() map[string]asyncloguploader.Snapshot // Keyed by event name ("" for a single logger)
+	manager   *asyncloguploader.LoggerManager
+	labels    []string
+
+	counters []counterDesc
+	gauges   []gaugeDesc
+
+	rejectedEventDrops   *prometheus.Desc
+	maxEventLoggersDrops *prometheus.Desc
+	evictedEventLoggers  *prometheus.Desc
+
+	flushDuration   *prometheus.HistogramVec
+	writeDuration   *prometheus.HistogramVec
+	pwritevDuration *prometheus.HistogramVec
+}
+
+// counterDesc is a counter read from a Snapshot
+type counterDesc struct {
+	desc  *prometheus.Desc
+	value func(asyncloguploader.Snapshot) int64
+}
+
+// gaugeDesc is a gauge read from a Snapshot
+type gaugeDesc struct {
+	desc  *prometheus.Desc
+	value func(asyncloguploader.Snapshot) float64
+}
+
+// NewPrometheusCollector creates a Collector for a single Logger and installs its flush observer
+func NewPrometheusCollector(logger *asyncloguploader.Logger) *Collector {
+	c := newCollector(nil, func() map[string]asyncloguploader.Snapshot {
+		return map[string]asyncloguploader.Snapshot{"": logger.Snapshot()}
+	})
+	logger.SetFlushObserver(func(observation asyncloguploader.FlushObservation) {
+		c.observeFlush(observation)
+	})
+	return c
+}
+
+// NewManagerCollector creates a Collector for every event logger of a LoggerManager (labeled by
+// event) and installs the manager's flush observer, which also covers loggers created later
+func NewManagerCollector(lm *asyncloguploader.LoggerManager) *Collector {
+	c := newCollector([]string{"event"}, func() map[string]asyncloguploader.Snapshot {
+		return lm.Snapshot().Events
+	})
+	c.manager = lm
+	c.rejectedEventDrops = prometheus.NewDesc(namespace+"_rejected_event_drops_total",
+		"Logs dropped because the event name was not allowed", nil, nil)
+	c.maxEventLoggersDrops = prometheus.NewDesc(namespace+"_max_event_loggers_drops_total",
+		"Logs dropped because MaxEventLoggers was reached", nil, nil)
+	c.evictedEventLoggers = prometheus.NewDesc(namespace+"_evicted_event_loggers_total",
+		"Event loggers closed by LRU eviction", nil, nil)
+	lm.SetFlushObserver(func(eventName string, observation asyncloguploader.FlushObservation) {
+		c.observeFlush(observation, eventName)
+	})
+	return c
+}
+
+// newCollector builds the descriptors shared by logger and manager collectors
+func newCollector(labels []string, snapshots func() map[string]asyncloguploader.Snapshot) *Collector {
+	counter := func(name, help string, value func(asyncloguploader.Snapshot) int64) counterDesc {
+		return counterDesc{prometheus.NewDesc(namespace+"_"+name, help, labels, nil), value}
+	}
+	gauge := func(name, help string, value func(asyncloguploader.Snapshot) float64) gaugeDesc {
+		return gaugeDesc{prometheus.NewDesc(namespace+"_"+name, help, labels, nil), value}
+	}
+	histogram := func(name, help string) *prometheus.HistogramVec {
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      name,
+			Help:      help,
+			Buckets:   DurationBuckets,
+		}, labels)
+	}
+
+	return &Collector{
+		snapshots: snapshots,
+		labels:    labels,
+		counters: []counterDesc{
+			counter("logs_total", "Log calls, including dropped ones",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.TotalLogs }),
+			counter("dropped_logs_total", "Logs dropped (full buffers, oversized, free space, disk full or closed)",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.DroppedLogs }),
+			counter("oversized_logs_total", "Logs rejected for exceeding MaxMessageSize",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.OversizedLogs }),
+			counter("chunked_logs_total", "Logs split into chunks",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.ChunkedLogs }),
+			counter("cancelled_logs_total", "Logs skipped because their context was done (LogBytesCtx)",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.CancelledLogs }),
+			counter("sampled_out_logs_total", "Logs skipped by the event's sample rate (LoggerManager.SetEventPolicy)",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.SampledOutLogs }),
+			counter("rate_limited_logs_total", "Logs refused by the event's rate limit (LoggerManager.SetEventPolicy)",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.RateLimitedLogs }),
+			counter("drain_rejected_logs_total", "Logs refused while the manager drained (LoggerManager.Drain)",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.DrainRejectedLogs }),
+			counter("free_space_drops_total", "Logs dropped while the disk was low on free space",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.FreeSpaceDrops }),
+			counter("disk_full_drops_total", "Logs dropped while a disk-full flush was retried",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.DiskFullDrops }),
+			counter("bytes_written_total", "Bytes accepted into shard buffers",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.BytesWritten }),
+			counter("bytes_flushed_total", "Log data bytes written to disk",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.BytesFlushed }),
+			counter("bytes_buffered_total", "Log payload bytes accepted into shard buffers",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.BytesBuffered }),
+			counter("bytes_durable_total", "Log payload bytes written to disk by successful flushes",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.BytesDurable }),
+			counter("flushes_total", "Successful flushes",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.Flushes }),
+			counter("flush_errors_total", "Failed flushes",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.FlushErrors }),
+			counter("flush_retries_total", "Failed flushes whose data was kept for a retry (disk full)",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.FlushRetries }),
+			counter("blocked_swaps_total", "Flushes that waited for the flush semaphore",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.BlockedSwaps }),
+			counter("early_flushes_total", "AdaptiveFlush flushes started before the shard threshold",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.EarlyFlushes }),
+			counter("interval_flushes_total", "Flushes of shards that waited below the threshold for a FlushInterval tick",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.IntervalFlushes }),
+			counter("flushes_coalesced_total", "Flush requests merged into one already pending for the shard",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.FlushesCoalesced }),
+			counter("presealed_buffers_total", "Shard buffers sealed by the writer that swapped them out",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.PresealedBuffers }),
+			counter("partial_flushes_total", "Flushes that wrote shard buffers with writes still in progress after FlushTimeout",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.PartialFlushes }),
+			counter("buffer_growths_total", "Shard buffers grown after drops (MaxBufferSize)",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.BufferGrowths }),
+			counter("buffer_shrinks_total", "Shard buffers shrunk after quiet intervals (MaxBufferSize)",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.BufferShrinks }),
+			counter("retention_files_deleted_total", "Rotated files deleted by retention",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.RetentionFilesDeleted }),
+			counter("retention_bytes_reclaimed_total", "Bytes freed by deleting rotated files",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.RetentionBytesReclaimed }),
+			counter("compressed_files_total", "Rotated files compressed",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.CompressedFiles }),
+			counter("compression_failures_total", "Rotated files that failed to compress and were uploaded raw",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.CompressionFailures }),
+			counter("compression_bytes_in_total", "Raw bytes read by compression",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.CompressionBytesIn }),
+			counter("compression_bytes_out_total", "Compressed bytes written",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.CompressionBytesOut }),
+			counter("retry_path_writes_total", "Writes that entered the retry path",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.RetryPathWrites }),
+			counter("retry_timeouts_total", "Writes dropped after the retry path timed out",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.RetryTimeouts }),
+			counter("spilled_writes_total", "Writes placed in a following shard because theirs had no space left",
+				func(s asyncloguploader.Snapshot) int64 { return s.Stats.SpilledWrites }),
+		},
+		gauges: []gaugeDesc{
+			gauge("flush_queue_depth", "Flushes queued or in progress",
+				func(s asyncloguploader.Snapshot) float64 { return float64(s.Stats.FlushQueueDepth) }),
+			gauge("buffered_bytes", "Data bytes in shard buffers awaiting flush",
+				func(s asyncloguploader.Snapshot) float64 { return float64(s.BufferedBytes) }),
+			gauge("buffer_capacity_bytes", "Usable bytes across all shard buffers",
+				func(s asyncloguploader.Snapshot) float64 { return float64(s.BufferCapacity) }),
+			gauge("buffer_size_bytes", "Current buffer size (BufferSize, as auto-resized up to MaxBufferSize)",
+				func(s asyncloguploader.Snapshot) float64 { return float64(s.BufferSize) }),
+			gauge("degraded", "1 while new logs are rejected to protect the disk",
+				func(s asyncloguploader.Snapshot) float64 { return boolValue(s.Degraded) }),
+			gauge("disk_full", "1 while a disk-full flush is retried and new logs are rejected",
+				func(s asyncloguploader.Snapshot) float64 { return boolValue(s.DiskFull) }),
+			gauge("pending_uploads", "Rotated files queued for upload and not yet uploaded (requires UploadTracker)",
+				func(s asyncloguploader.Snapshot) float64 { return float64(s.PendingUploads) }),
+		},
+		flushDuration:   histogram("flush_duration_seconds", "Flush duration, including waiting for in-flight writes"),
+		writeDuration:   histogram("write_duration_seconds", "WriteVectored duration (includes rotation checks)"),
+		pwritevDuration: histogram("pwritev_duration_seconds", "Write syscall duration (pure disk I/O)"),
+	}
+}
+
+// observeFlush records one flush in the histograms
+func (c *Collector) observeFlush(observation asyncloguploader.FlushObservation, labelValues ...string) {
+	c.flushDuration.WithLabelValues(labelValues...).Observe(observation.Duration.Seconds())
+	c.writeDuration.WithLabelValues(labelValues...).Observe(observation.WriteDuration.Seconds())
+	c.pwritevDuration.WithLabelValues(labelValues...).Observe(observation.PwritevDuration.Seconds())
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, counter := range c.counters {
+		ch <- counter.desc
+	}
+	for _, gauge := range c.gauges {
+		ch <- gauge.desc
+	}
+	if c.manager != nil {
+		ch <- c.rejectedEventDrops
+		ch <- c.maxEventLoggersDrops
+		ch <- c.evictedEventLoggers
+	}
+	c.flushDuration.Describe(ch)
+	c.writeDuration.Describe(ch)
+	c.pwritevDuration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for event, snap := range c.snapshots() {
+		var labelValues []string
+		if len(c.labels) > 0 {
+			labelValues = []string{event}
+		}
+		for _, counter := range c.counters {
+			ch <- prometheus.MustNewConstMetric(counter.desc, prometheus.CounterValue, float64(counter.value(snap)), labelValues...)
+		}
+		for _, gauge := range c.gauges {
+			ch <- prometheus.MustNewConstMetric(gauge.desc, prometheus.GaugeValue, gauge.value(snap), labelValues...)
+		}
+	}
+	if c.manager != nil {
+		rejected, maxLoggers := c.manager.GetEventRejectStats()
+		ch <- prometheus.MustNewConstMetric(c.rejectedEventDrops, prometheus.CounterValue, float64(rejected))
+		ch <- prometheus.MustNewConstMetric(c.maxEventLoggersDrops, prometheus.CounterValue, float64(maxLoggers))
+		ch <- prometheus.MustNewConstMetric(c.evictedEventLoggers, prometheus.CounterValue, float64(c.manager.GetEventLoggerEvictions()))
+	}
+	c.flushDuration.Collect(ch)
+	c.writeDuration.Collect(ch)
+	c.pwritevDuration.Collect(ch)
+}
+
+// boolValue converts a flag to a gauge value
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
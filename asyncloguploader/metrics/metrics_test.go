@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asyncloguploader"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gather registers c in a fresh registry and returns the gathered families by name
+func gather(t *testing.T, c prometheus.Collector) map[string]*dto.MetricFamily {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(c))
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+	return byName
+}
+
+// metricWithLabel returns the family's metric whose label name has value (or the only metric when name is "")
+func metricWithLabel(t *testing.T, family *dto.MetricFamily, name, value string) *dto.Metric {
+	t.Helper()
+	require.NotNil(t, family)
+	for _, metric := range family.GetMetric() {
+		if name == "" {
+			return metric
+		}
+		for _, label := range metric.GetLabel() {
+			if label.GetName() == name && label.GetValue() == value {
+				return metric
+			}
+		}
+	}
+	require.Failf(t, "metric not found", "%s{%s=%q}", family.GetName(), name, value)
+	return nil
+}
+
+func newTestConfig(t *testing.T, name string) asyncloguploader.Config {
+	config := asyncloguploader.DefaultConfig(filepath.Join(t.TempDir(), name+".log"))
+	config.BufferSize = 256 * 1024
+	config.NumShards = 2
+	return config
+}
+
+func TestPrometheusCollector(t *testing.T) {
+	t.Run("ExportsLoggerStatistics", func(t *testing.T) {
+		logger, err := asyncloguploader.NewLogger(newTestConfig(t, "metrics"))
+		require.NoError(t, err)
+		defer logger.Close()
+		collector := NewPrometheusCollector(logger)
+
+		for i := 0; i < 100; i++ {
+			logger.LogBytes([]byte(fmt.Sprintf("message %d", i)))
+		}
+		require.NoError(t, logger.Flush(context.Background()))
+
+		families := gather(t, collector)
+		snap := logger.Snapshot()
+		assert.Equal(t, float64(100), metricWithLabel(t, families["asyncloguploader_logs_total"], "", "").GetCounter().GetValue())
+		assert.Equal(t, float64(snap.Stats.BytesFlushed), metricWithLabel(t, families["asyncloguploader_bytes_flushed_total"], "", "").GetCounter().GetValue())
+		assert.Equal(t, float64(snap.Stats.BytesDurable), metricWithLabel(t, families["asyncloguploader_bytes_durable_total"], "", "").GetCounter().GetValue())
+		assert.Equal(t, float64(snap.Stats.Flushes), metricWithLabel(t, families["asyncloguploader_flushes_total"], "", "").GetCounter().GetValue())
+		assert.Equal(t, float64(snap.BufferCapacity), metricWithLabel(t, families["asyncloguploader_buffer_capacity_bytes"], "", "").GetGauge().GetValue())
+
+		flushes := metricWithLabel(t, families["asyncloguploader_flush_duration_seconds"], "", "").GetHistogram()
+		assert.Equal(t, uint64(snap.Stats.Flushes), flushes.GetSampleCount())
+		assert.Greater(t, flushes.GetSampleSum(), 0.0)
+		assert.NotNil(t, families["asyncloguploader_pwritev_duration_seconds"])
+	})
+
+	t.Run("ManagerLabelsEvents", func(t *testing.T) {
+		lm, err := asyncloguploader.NewLoggerManager(newTestConfig(t, "events"))
+		require.NoError(t, err)
+		defer lm.Close()
+
+		// Loggers created before and after the collector are both observed
+		lm.LogWithEvent("payment", "before")
+		collector := NewManagerCollector(lm)
+		lm.LogWithEvent("login", "after")
+		lm.LogWithEvent("login", "after")
+		require.NoError(t, lm.FlushAll(context.Background()))
+
+		families := gather(t, collector)
+		logs := families["asyncloguploader_logs_total"]
+		assert.Equal(t, float64(1), metricWithLabel(t, logs, "event", "payment").GetCounter().GetValue())
+		assert.Equal(t, float64(2), metricWithLabel(t, logs, "event", "login").GetCounter().GetValue())
+
+		flushes := families["asyncloguploader_flush_duration_seconds"]
+		assert.Equal(t, uint64(1), metricWithLabel(t, flushes, "event", "payment").GetHistogram().GetSampleCount())
+		assert.Equal(t, uint64(1), metricWithLabel(t, flushes, "event", "login").GetHistogram().GetSampleCount())
+
+		assert.Equal(t, float64(0), metricWithLabel(t, families["asyncloguploader_rejected_event_drops_total"], "", "").GetCounter().GetValue())
+	})
+}
+
+func TestUploaderCollector(t *testing.T) {
+	uploader := &asyncloguploader.Uploader{}
+	families := gather(t, NewUploaderCollector(uploader))
+
+	uploads := families["asyncloguploader_uploads_total"]
+	assert.Equal(t, float64(0), metricWithLabel(t, uploads, "result", "success").GetCounter().GetValue())
+	assert.Equal(t, float64(0), metricWithLabel(t, uploads, "result", "failure").GetCounter().GetValue())
+	assert.Equal(t, uint64(0), metricWithLabel(t, families["asyncloguploader_upload_duration_seconds"], "", "").GetHistogram().GetSampleCount())
+}
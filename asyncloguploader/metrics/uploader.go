@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"github.com/neehar-mavuduru/logger-double-buffer/asyncloguploader"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// UploaderCollector exports Uploader statistics
+type UploaderCollector struct {
+	uploader *asyncloguploader.Uploader
+
+	uploads      *prometheus.Desc
+	uploadBytes  *prometheus.Desc
+	retries      *prometheus.Desc
+	deadLettered *prometheus.Desc
+	verifyFails  *prometheus.Desc
+	deleteFails  *prometheus.Desc
+	manifests    *prometheus.Desc
+
+	parallelUploads  *prometheus.Desc
+	parallelChunks   *prometheus.Desc
+	composeFallbacks *prometheus.Desc
+
+	throughput     *prometheus.Desc
+	bandwidthLimit *prometheus.Desc
+
+	uploadDuration prometheus.Histogram
+	fileSize       prometheus.Histogram
+}
+
+// NewUploaderCollector creates a collector for an Uploader and installs its upload observer
+func NewUploaderCollector(uploader *asyncloguploader.Uploader) *UploaderCollector {
+	c := &UploaderCollector{
+		uploader: uploader,
+		uploads: prometheus.NewDesc(namespace+"_uploads_total",
+			"Files processed by the uploader, by result (success or failure after all retries)", []string{"result"}, nil),
+		uploadBytes: prometheus.NewDesc(namespace+"_upload_bytes_total",
+			"Bytes uploaded successfully", nil, nil),
+		retries: prometheus.NewDesc(namespace+"_upload_retries_total",
+			"Upload attempts retried after a failure", nil, nil),
+		deadLettered: prometheus.NewDesc(namespace+"_dead_lettered_files_total",
+			"Files moved to the dead-letter directory after all retries failed", nil, nil),
+		verifyFails: prometheus.NewDesc(namespace+"_upload_verify_failures_total",
+			"Uploads whose stored object did not match the local file (retried)", nil, nil),
+		deleteFails: prometheus.NewDesc(namespace+"_upload_delete_failures_total",
+			"Verified uploads whose local file could not be deleted", nil, nil),
+		manifests: prometheus.NewDesc(namespace+"_upload_manifests_total",
+			"Object manifests written after upload, by result (success or failure)", []string{"result"}, nil),
+		parallelUploads: prometheus.NewDesc(namespace+"_parallel_uploads_total",
+			"Files uploaded in parallel chunks composed into the object", nil, nil),
+		parallelChunks: prometheus.NewDesc(namespace+"_parallel_upload_chunks_total",
+			"Chunks uploaded by parallel uploads", nil, nil),
+		composeFallbacks: prometheus.NewDesc(namespace+"_compose_fallbacks_total",
+			"Parallel uploads whose compose failed, uploaded again in a single stream", nil, nil),
+		throughput: prometheus.NewDesc(namespace+"_upload_throughput_bytes_per_second",
+			"Bytes per second read by uploads over the last second", nil, nil),
+		bandwidthLimit: prometheus.NewDesc(namespace+"_upload_bandwidth_limit_bytes_per_second",
+			"Cap on the upload read rate of all uploads together (0 = unlimited)", nil, nil),
+		uploadDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "upload_duration_seconds",
+			Help:      "Duration of the successful upload attempt of each file",
+			Buckets:   DurationBuckets,
+		}),
+		fileSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "upload_file_bytes",
+			Help:      "Size of each successfully uploaded file",
+			Buckets:   FileSizeBuckets,
+		}),
+	}
+	uploader.SetUploadObserver(func(observation asyncloguploader.UploadObservation) {
+		if observation.Err != nil {
+			return
+		}
+		c.uploadDuration.Observe(observation.Duration.Seconds())
+		c.fileSize.Observe(float64(observation.Bytes))
+	})
+	return c
+}
+
+// Describe implements prometheus.Collector
+func (c *UploaderCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.uploads
+	ch <- c.uploadBytes
+	ch <- c.retries
+	ch <- c.deadLettered
+	ch <- c.verifyFails
+	ch <- c.deleteFails
+	ch <- c.manifests
+	ch <- c.parallelUploads
+	ch <- c.parallelChunks
+	ch <- c.composeFallbacks
+	ch <- c.throughput
+	ch <- c.bandwidthLimit
+	c.uploadDuration.Describe(ch)
+	c.fileSize.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *UploaderCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.uploader.GetStats()
+	ch <- prometheus.MustNewConstMetric(c.uploads, prometheus.CounterValue, float64(stats.Successful), "success")
+	ch <- prometheus.MustNewConstMetric(c.uploads, prometheus.CounterValue, float64(stats.Failed), "failure")
+	ch <- prometheus.MustNewConstMetric(c.uploadBytes, prometheus.CounterValue, float64(stats.TotalBytes))
+	ch <- prometheus.MustNewConstMetric(c.retries, prometheus.CounterValue, float64(stats.RetriedUploads))
+	ch <- prometheus.MustNewConstMetric(c.deadLettered, prometheus.CounterValue, float64(stats.DeadLettered))
+	ch <- prometheus.MustNewConstMetric(c.verifyFails, prometheus.CounterValue, float64(stats.VerifyFailures))
+	ch <- prometheus.MustNewConstMetric(c.deleteFails, prometheus.CounterValue, float64(stats.DeleteFailures))
+	ch <- prometheus.MustNewConstMetric(c.manifests, prometheus.CounterValue, float64(stats.Manifests), "success")
+	ch <- prometheus.MustNewConstMetric(c.manifests, prometheus.CounterValue, float64(stats.ManifestFailures), "failure")
+	ch <- prometheus.MustNewConstMetric(c.parallelUploads, prometheus.CounterValue, float64(stats.ParallelUploads))
+	ch <- prometheus.MustNewConstMetric(c.parallelChunks, prometheus.CounterValue, float64(stats.ParallelChunks))
+	ch <- prometheus.MustNewConstMetric(c.composeFallbacks, prometheus.CounterValue, float64(stats.ComposeFallbacks))
+	ch <- prometheus.MustNewConstMetric(c.throughput, prometheus.GaugeValue, stats.Throughput)
+	ch <- prometheus.MustNewConstMetric(c.bandwidthLimit, prometheus.GaugeValue, float64(stats.BandwidthLimit))
+	c.uploadDuration.Collect(ch)
+	c.fileSize.Collect(ch)
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+
+package asyncloguploader
+
+import (
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// allocMmapBuffer allocates a buffer using anonymous mmap
+// Returns the buffer, cleanup function, and error
+func allocMmapBuffer(size int) ([]byte, func(), error) {
+	// Round up to page size alignment
+	alignedSize := alignSize(size, alignmentSize)
+
+	// Create anonymous private mapping
+	data, err := unix.Mmap(
+		-1, 0,
+		alignedSize,
+		unix.PROT_READ|unix.PROT_WRITE,
+		unix.MAP_PRIVATE|unix.MAP_ANONYMOUS,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Cleanup function keeps buffer alive during use
+	cleanup := func() {
+		runtime.KeepAlive(data)
+		// Don't unmap during normal operation - reuse buffers
+	}
+
+	// NOTE: Finalizer is NOT set here - it's set on the Shard struct instead
+	// This prevents premature unmapping while the buffer is still in use
+
+	return data, cleanup, nil
+}
+
+// freeMmapBuffer unmaps a buffer returned by allocMmapBuffer
+func freeMmapBuffer(data []byte) {
+	unix.Munmap(data)
+}
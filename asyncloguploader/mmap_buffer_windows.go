@@ -0,0 +1,30 @@
+//go:build windows
+
+package asyncloguploader
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+// allocMmapBuffer allocates a page-aligned buffer from the Go heap (no anonymous mmap on Windows)
+// The slice is carved out of a larger allocation so its start is 4096-byte aligned like an mmap page
+// Returns the buffer, cleanup function, and error
+func allocMmapBuffer(size int) ([]byte, func(), error) {
+	const pageSize = 4096
+	alignedSize := alignSize(size, pageSize)
+
+	raw := make([]byte, alignedSize+pageSize)
+	offset := int(pageSize-uintptr(unsafe.Pointer(&raw[0]))%pageSize) % pageSize
+	data := raw[offset : offset+alignedSize : offset+alignedSize]
+
+	// Cleanup function keeps buffer alive during use
+	cleanup := func() {
+		runtime.KeepAlive(raw)
+	}
+
+	return data, cleanup, nil
+}
+
+// freeMmapBuffer releases a buffer returned by allocMmapBuffer (the garbage collector reclaims it)
+func freeMmapBuffer(data []byte) {}
@@ -0,0 +1,81 @@
+package asyncloguploader
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// objectNamePlaceholder matches a {field} in GCSUploadConfig.ObjectNameTemplate
+var objectNamePlaceholder = regexp.MustCompile(`\{(\w+)\}`)
+
+// objectNameFields are the fields an object name template may use
+var objectNameFields = map[string]struct{}{
+	"prefix":   {}, // GCSUploadConfig.ObjectPrefix
+	"event":    {}, // Config.EventName of the logger that wrote the file
+	"date":     {}, // Rotation date from the file name, YYYY-MM-DD
+	"basename": {}, // File name
+}
+
+// rotatedLogParts splits a rotated file name ({base}[_w<i>]_YYYY-MM-DD_HH-MM-SS[-mmm][_N].log[.ext])
+// into the base name, without the flush worker suffix, and the rotation date
+var rotatedLogParts = regexp.MustCompile(`^(.+?)(?:_w\d+)?_(\d{4}-\d{2}-\d{2})_\d{2}-\d{2}-\d{2}(?:-\d{3})?(?:_\d+)?\.log(?:\.\w+)?$`)
+
+// validateObjectNameTemplate checks that template only uses known fields and includes {basename},
+// without which files of the same event and day would overwrite each other
+func validateObjectNameTemplate(template string) error {
+	if template == "" {
+		return nil
+	}
+	for _, match := range objectNamePlaceholder.FindAllStringSubmatch(template, -1) {
+		if _, ok := objectNameFields[match[1]]; !ok {
+			return fmt.Errorf("ObjectNameTemplate: unknown field {%s} (use {prefix}, {event}, {date} or {basename})", match[1])
+		}
+	}
+	if !strings.Contains(template, "{basename}") {
+		return fmt.Errorf("ObjectNameTemplate must contain {basename}")
+	}
+	return nil
+}
+
+// expandObjectName builds the object name for filePath from a validated template
+// event is the one recorded by the logger; when unknown (e.g. files queued by a recovery scan) it is
+// taken from the file name. Without a rotation timestamp in the name, {date} is the date of now.
+// Empty path segments are dropped, so an unset or slash-terminated prefix does not leave "//"
+func expandObjectName(template, prefix, event, filePath string, now time.Time) string {
+	fileName := filepath.Base(filePath)
+	date := now.Format("2006-01-02")
+	if match := rotatedLogParts.FindStringSubmatch(fileName); match != nil {
+		if event == "" {
+			event = match[1]
+		}
+		date = match[2]
+	}
+	if event == "" {
+		event, _, _ = strings.Cut(fileName, ".")
+	}
+
+	name := objectNamePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		switch placeholder {
+		case "{prefix}":
+			return prefix
+		case "{event}":
+			return event
+		case "{date}":
+			return date
+		default:
+			return fileName
+		}
+	})
+
+	segments := strings.Split(name, "/")
+	kept := segments[:0]
+	for _, segment := range segments {
+		if segment != "" {
+			kept = append(kept, segment)
+		}
+	}
+	return strings.Join(kept, "/")
+}
@@ -0,0 +1,100 @@
+package asyncloguploader
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObjectNameTemplate(t *testing.T) {
+	t.Run("ValidatesTemplate", func(t *testing.T) {
+		config := GCSUploadConfig{ObjectNameTemplate: "{prefix}/{event}/{date}/{basename}"}
+		require.NoError(t, config.applyDefaults())
+
+		config.ObjectNameTemplate = "{prefix}/{event}/{hour}/{basename}"
+		assert.ErrorContains(t, config.applyDefaults(), "{hour}")
+
+		config.ObjectNameTemplate = "{prefix}/{event}/{date}"
+		assert.ErrorContains(t, config.applyDefaults(), "{basename}")
+	})
+
+	t.Run("ExpandsFields", func(t *testing.T) {
+		template := "{prefix}/{event}/{date}/{basename}"
+		now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+		for _, tc := range []struct {
+			name, prefix, event, path, want string
+		}{
+			{"RecordedEvent", "logs", "payment", "/var/logs/payment_2024-05-31_23-59-59.log", "logs/payment/2024-05-31/payment_2024-05-31_23-59-59.log"},
+			{"SlashTerminatedPrefix", "logs/prod/", "payment", "/var/logs/payment_2024-05-31_23-59-59.log.gz", "logs/prod/payment/2024-05-31/payment_2024-05-31_23-59-59.log.gz"},
+			{"NoPrefix", "", "payment", "/var/logs/payment_2024-05-31_23-59-59_2.log", "payment/2024-05-31/payment_2024-05-31_23-59-59_2.log"},
+			{"EventFromFileName", "logs", "", "/var/logs/checkout_started_2024-05-31_10-00-00.log", "logs/checkout_started/2024-05-31/checkout_started_2024-05-31_10-00-00.log"},
+			{"FlushWorkerSegment", "logs", "", "/var/logs/payment_w1_2024-05-31_10-00-00.log", "logs/payment/2024-05-31/payment_w1_2024-05-31_10-00-00.log"},
+			{"MillisecondName", "logs", "", "/var/logs/payment_w1_2024-05-31_23-59-59-999_3.log.gz", "logs/payment/2024-05-31/payment_w1_2024-05-31_23-59-59-999_3.log.gz"},
+			{"NotRotated", "logs", "", "/var/logs/custom.log", "logs/custom/2024-06-01/custom.log"},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				assert.Equal(t, tc.want, expandObjectName(template, tc.prefix, tc.event, tc.path, now))
+			})
+		}
+	})
+
+	t.Run("UsesEventRecordedByLogger", func(t *testing.T) {
+		store := newFakeStore(0)
+		uploader := newFakeUploader(t, GCSUploadConfig{ObjectNameTemplate: "{event}/{basename}"}, store)
+		dir := t.TempDir()
+		recorded := writeUploadFile(t, dir, "app_2024-05-31_10-00-00.log")
+		unknown := writeUploadFile(t, dir, "app_2024-05-31_10-00-01.log")
+		sent := writeUploadFile(t, dir, "app_2024-05-31_10-00-02.log")
+		uploader.tracker.queuedEvent(recorded, "billing")
+
+		uploader.Start()
+		uploader.GetUploadChannel() <- recorded
+		uploader.GetUploadChannel() <- unknown
+		uploader.GetFileEventChannel() <- FileReadyEvent{Path: sent, Event: "checkout"}
+		uploader.Stop()
+
+		assert.Contains(t, store.objects, "billing/app_2024-05-31_10-00-00.log")
+		assert.Contains(t, store.objects, "app/app_2024-05-31_10-00-01.log", "taken from the file name")
+		assert.Contains(t, store.objects, "checkout/app_2024-05-31_10-00-02.log")
+	})
+
+	t.Run("SeparatesEventsEndToEnd", func(t *testing.T) {
+		dst := t.TempDir()
+		uploader, err := NewUploaderWithBackend(GCSUploadConfig{
+			ObjectPrefix:       "logs/",
+			ObjectNameTemplate: "{prefix}/{event}/{date}/{basename}",
+			DeleteAfterUpload:  true,
+		}, NewFileSystemBackend(dst))
+		require.NoError(t, err)
+		uploader.Start()
+
+		config := DefaultConfig(filepath.Join(t.TempDir(), "events.log"))
+		config.BufferSize = 256 * 1024
+		config.NumShards = 2
+		config.FlushConcurrency = 2
+		config.UploadChannel = uploader.GetUploadChannel()
+		config.UploadTracker = uploader.GetUploadTracker()
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		for i := 0; i < 10; i++ {
+			manager.LogWithEvent("payment", "charge")
+			manager.LogWithEvent("login", "session")
+		}
+		require.NoError(t, manager.Close())
+		uploader.Stop()
+
+		// Each event's files, including the second flush worker's segment, land under its own prefix
+		for _, event := range []string{"payment", "login"} {
+			objects, err := filepath.Glob(filepath.Join(dst, "logs", event, "*", event+"_*.log"))
+			require.NoError(t, err)
+			assert.Len(t, objects, 2, event)
+		}
+		stray, err := filepath.Glob(filepath.Join(dst, "logs", "*", "*", "*"))
+		require.NoError(t, err)
+		assert.Len(t, stray, 4)
+		assert.Equal(t, int64(4), uploader.GetStats().Successful)
+	})
+}
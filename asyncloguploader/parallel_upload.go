@@ -0,0 +1,135 @@
+package asyncloguploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ComposingBackend is an UploadBackend that can store parts of a file as separate objects and
+// concatenate them, so the Uploader uploads files above GCSUploadConfig.ParallelThreshold in
+// parallel chunks. The GCS backend implements it with compose
+type ComposingBackend interface {
+	UploadBackend
+
+	// UploadRange stores length bytes of the file at localPath, starting at offset, as objectName
+	UploadRange(ctx context.Context, localPath, objectName string, offset, length int64) error
+
+	// Compose concatenates sources, in order, into objectName, replacing any existing object
+	Compose(ctx context.Context, objectName string, sources []string) error
+
+	// Delete removes objectName; a missing object is not an error
+	Delete(ctx context.Context, objectName string) error
+}
+
+// errComposeFailed marks a parallel upload whose chunks could not be composed; the file is then
+// uploaded in a single stream
+var errComposeFailed = errors.New("compose failed")
+
+// upload stores the file at filePath as objectName, in parallel chunks when it is above
+// ParallelThreshold and the backend can compose them
+// Returns the number of chunks (1 for a single stream) and whether the stored object was verified
+func (u *Uploader) upload(filePath, objectName string, size int64, crc uint32, statErr error) (chunks int, verified bool, err error) {
+	composer, ok := u.backend.(ComposingBackend)
+	if !ok || statErr != nil || u.config.ParallelThreshold < 0 || size <= u.config.ParallelThreshold {
+		return 1, false, u.backend.Upload(u.ctx, filePath, objectName)
+	}
+
+	chunks, err = u.uploadParallel(composer, filePath, objectName, size, crc)
+	if errors.Is(err, errComposeFailed) {
+		u.logger.Printf("[WARNING] Parallel upload of %s failed, uploading in a single stream: %v", filePath, err)
+		u.statsMu.Lock()
+		u.uploadStats.ComposeFallbacks++
+		u.statsMu.Unlock()
+		return 1, false, u.backend.Upload(u.ctx, filePath, objectName)
+	}
+	return chunks, err == nil, err
+}
+
+// uploadParallel uploads the file in ChunkSize chunks at once as temporary objects, composes them
+// into objectName and checks the result against the local size and CRC32C. The temporary objects
+// are deleted whatever the outcome, and an object failing the check is deleted too
+// Returns the number of chunks; compose errors wrap errComposeFailed
+func (u *Uploader) uploadParallel(backend ComposingBackend, filePath, objectName string, size int64, crc uint32) (int, error) {
+	chunkSize := int64(u.config.ChunkSize)
+	numChunks := int((size + chunkSize - 1) / chunkSize)
+
+	tempPrefix := fmt.Sprintf("%s.tmp.%d", objectName, time.Now().UnixNano())
+	chunkObjects := make([]string, numChunks)
+	for i := range chunkObjects {
+		chunkObjects[i] = fmt.Sprintf("%s.chunk.%d", tempPrefix, i)
+	}
+	defer u.deleteObjects(backend, chunkObjects)
+
+	// The first failed chunk cancels the others: the file is retried as a whole
+	ctx, cancel := context.WithCancel(u.ctx)
+	defer cancel()
+	errs := make([]error, numChunks)
+	var wg sync.WaitGroup
+	for i, chunkObject := range chunkObjects {
+		offset := int64(i) * chunkSize
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if errs[i] = backend.UploadRange(ctx, filePath, chunkObject, offset, min(chunkSize, size-offset)); errs[i] != nil {
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	if i, err := firstChunkError(errs); err != nil {
+		return numChunks, fmt.Errorf("chunk %d/%d failed: %w", i+1, numChunks, err)
+	}
+
+	if err := backend.Compose(u.ctx, objectName, chunkObjects); err != nil {
+		return numChunks, fmt.Errorf("%w: %w", errComposeFailed, err)
+	}
+
+	object, err := backend.Stat(u.ctx, objectName)
+	if err != nil {
+		err = fmt.Errorf("failed to verify upload: %w", err)
+	} else if err = compareObject(object, size, crc); err != nil {
+		u.deleteObjects(backend, []string{objectName})
+	}
+	if err != nil {
+		u.statsMu.Lock()
+		u.uploadStats.VerifyFailures++
+		u.statsMu.Unlock()
+		return numChunks, err
+	}
+
+	u.logger.Printf("[DEBUG] Uploaded %s in %d parallel chunks", filePath, numChunks)
+	return numChunks, nil
+}
+
+// firstChunkError returns the first chunk error that is not a cancellation caused by another
+// chunk's failure, with its index; (-1, nil) if every chunk succeeded
+func firstChunkError(errs []error) (int, error) {
+	first := -1
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, context.Canceled) {
+			return i, err
+		}
+		if first < 0 {
+			first = i
+		}
+	}
+	if first < 0 {
+		return -1, nil
+	}
+	return first, errs[first]
+}
+
+// deleteObjects deletes temporary or malformed objects; failures are only logged
+func (u *Uploader) deleteObjects(backend ComposingBackend, objects []string) {
+	for _, object := range objects {
+		if err := backend.Delete(u.ctx, object); err != nil {
+			u.logger.Printf("[WARNING] Failed to delete object %s: %v", object, err)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package asyncloguploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// composingStore is a ComposingBackend keeping objects in memory
+// The first chunkFailures uploads of chunk failChunk fail, the first corruptComposes composes store
+// a flipped byte, and the first composeFailures composes fail
+type composingStore struct {
+	failChunk       int
+	chunkFailures   int
+	corruptComposes int
+	composeFailures int
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads int // Single-stream uploads
+	ranges  int // Chunk uploads, including failed ones
+}
+
+func newComposingStore() *composingStore {
+	return &composingStore{failChunk: -1, objects: make(map[string][]byte)}
+}
+
+func (s *composingStore) Upload(ctx context.Context, localPath, objectName string) error {
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uploads++
+	s.objects[objectName] = data
+	return nil
+}
+
+func (s *composingStore) UploadRange(ctx context.Context, localPath, objectName string, offset, length int64) error {
+	s.mu.Lock()
+	s.ranges++
+	if strings.HasSuffix(objectName, fmt.Sprintf(".chunk.%d", s.failChunk)) && s.chunkFailures > 0 {
+		s.chunkFailures--
+		s.mu.Unlock()
+		return errors.New("googleapi: Error 503: Service Unavailable")
+	}
+	s.mu.Unlock()
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.NewSectionReader(f, offset, length))
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[objectName] = data
+	return nil
+}
+
+func (s *composingStore) Compose(ctx context.Context, objectName string, sources []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.composeFailures > 0 {
+		s.composeFailures--
+		return errors.New("googleapi: Error 400: too many components")
+	}
+	var data []byte
+	for _, source := range sources {
+		chunk, ok := s.objects[source]
+		if !ok {
+			return fmt.Errorf("missing source %s", source)
+		}
+		data = append(data, chunk...)
+	}
+	if s.corruptComposes > 0 {
+		s.corruptComposes--
+		data[len(data)/2] ^= 0xff
+	}
+	s.objects[objectName] = data
+	return nil
+}
+
+func (s *composingStore) Delete(ctx context.Context, objectName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, objectName)
+	return nil
+}
+
+func (s *composingStore) Stat(ctx context.Context, objectName string) (ObjectInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[objectName]
+	if !ok {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	return ObjectInfo{Size: int64(len(data)), CRC32C: crc32.Checksum(data, castagnoliTable), HasCRC32C: true}, nil
+}
+
+func (s *composingStore) Close() error {
+	return nil
+}
+
+// objectNames returns the names of the stored objects, sorted
+func (s *composingStore) objectNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.objects))
+	for name := range s.objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestUploader_ParallelUpload(t *testing.T) {
+	const chunkSize = 1024
+	data := make([]byte, 4*chunkSize-100) // Four chunks, the last one short
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	// run uploads one file through store and returns its completion (ok false if the file failed)
+	run := func(t *testing.T, store *composingStore, config GCSUploadConfig) (*Uploader, UploadCompletion, bool) {
+		t.Helper()
+		config.ChunkSize = chunkSize
+		config.InitialBackoff = time.Millisecond
+		config.MaxBackoff = time.Millisecond
+		config.InternalLogger = &captureLogger{}
+		uploader, err := NewUploaderWithBackend(config, store)
+		require.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "app_1.log")
+		require.NoError(t, os.WriteFile(path, data, 0644))
+
+		uploader.Start()
+		uploader.GetUploadChannel() <- path
+		uploader.Stop()
+		completion, ok := <-uploader.GetCompletedUploads()
+		return uploader, completion, ok
+	}
+
+	t.Run("ComposesChunks", func(t *testing.T) {
+		store := newComposingStore()
+		uploader, completion, ok := run(t, store, GCSUploadConfig{})
+		require.True(t, ok)
+
+		assert.Equal(t, []string{"app_1.log"}, store.objectNames(), "temporary chunks are deleted")
+		assert.Equal(t, data, store.objects["app_1.log"])
+		assert.Equal(t, 4, store.ranges)
+		assert.Zero(t, store.uploads)
+		assert.Equal(t, 4, completion.Chunks)
+		assert.True(t, completion.Verified, "parallel uploads are always verified")
+
+		stats := uploader.GetStats()
+		assert.Equal(t, int64(1), stats.ParallelUploads)
+		assert.Equal(t, int64(4), stats.ParallelChunks)
+		assert.Zero(t, stats.VerifyFailures)
+	})
+
+	t.Run("SmallFilesUseOneStream", func(t *testing.T) {
+		store := newComposingStore()
+		uploader, completion, ok := run(t, store, GCSUploadConfig{ParallelThreshold: int64(len(data))})
+		require.True(t, ok)
+		assert.Equal(t, 1, store.uploads)
+		assert.Zero(t, store.ranges)
+		assert.Equal(t, 1, completion.Chunks)
+		assert.False(t, completion.Verified)
+		assert.Zero(t, uploader.GetStats().ParallelUploads)
+
+		store = newComposingStore()
+		_, _, ok = run(t, store, GCSUploadConfig{ParallelThreshold: -1})
+		require.True(t, ok)
+		assert.Equal(t, 1, store.uploads, "-1 disables parallel uploads")
+	})
+
+	t.Run("RetriesChunkFailure", func(t *testing.T) {
+		store := newComposingStore()
+		store.failChunk = 2
+		store.chunkFailures = 1
+		uploader, completion, ok := run(t, store, GCSUploadConfig{MaxRetries: 1})
+		require.True(t, ok)
+
+		assert.Equal(t, []string{"app_1.log"}, store.objectNames(), "chunks of the failed attempt are deleted")
+		assert.Equal(t, data, store.objects["app_1.log"])
+		assert.Equal(t, 4, completion.Chunks)
+		stats := uploader.GetStats()
+		assert.Equal(t, int64(1), stats.RetriedUploads)
+		assert.Equal(t, int64(1), stats.Successful)
+		assert.Equal(t, int64(1), stats.ParallelUploads)
+	})
+
+	t.Run("FailsAfterChunkFailures", func(t *testing.T) {
+		store := newComposingStore()
+		store.failChunk = 1
+		store.chunkFailures = 100
+		uploader, _, ok := run(t, store, GCSUploadConfig{MaxRetries: 1})
+		require.False(t, ok)
+
+		failed := <-uploader.GetFailedFiles()
+		assert.ErrorContains(t, failed.Err, "chunk 2/4 failed")
+		assert.Empty(t, store.objectNames(), "no chunk or partial object is left")
+		assert.Equal(t, int64(1), uploader.GetStats().Failed)
+	})
+
+	t.Run("RetriesVerificationMismatch", func(t *testing.T) {
+		store := newComposingStore()
+		store.corruptComposes = 1
+		uploader, completion, ok := run(t, store, GCSUploadConfig{MaxRetries: 1})
+		require.True(t, ok)
+
+		assert.Equal(t, data, store.objects["app_1.log"])
+		assert.True(t, completion.Verified)
+		stats := uploader.GetStats()
+		assert.Equal(t, int64(1), stats.VerifyFailures)
+		assert.Equal(t, int64(1), stats.RetriedUploads)
+		assert.Equal(t, int64(1), stats.Successful)
+	})
+
+	t.Run("DeletesObjectFailingVerification", func(t *testing.T) {
+		store := newComposingStore()
+		store.corruptComposes = 100
+		uploader, _, ok := run(t, store, GCSUploadConfig{MaxRetries: 1, DeleteAfterUpload: true})
+		require.False(t, ok)
+
+		failed := <-uploader.GetFailedFiles()
+		assert.ErrorContains(t, failed.Err, "upload verification failed: object CRC32C")
+		assert.FileExists(t, failed.FilePath)
+		assert.Empty(t, store.objectNames(), "the corrupted object is deleted")
+		stats := uploader.GetStats()
+		assert.Equal(t, int64(2), stats.VerifyFailures, "verified once per attempt")
+		assert.Equal(t, int64(1), stats.Failed)
+	})
+
+	t.Run("FallsBackOnComposeError", func(t *testing.T) {
+		store := newComposingStore()
+		store.composeFailures = 1
+		uploader, completion, ok := run(t, store, GCSUploadConfig{})
+		require.True(t, ok)
+
+		assert.Equal(t, []string{"app_1.log"}, store.objectNames())
+		assert.Equal(t, data, store.objects["app_1.log"])
+		assert.Equal(t, 1, store.uploads)
+		assert.Equal(t, 1, completion.Chunks)
+		stats := uploader.GetStats()
+		assert.Equal(t, int64(1), stats.ComposeFallbacks)
+		assert.Zero(t, stats.ParallelUploads)
+		assert.Zero(t, stats.RetriedUploads)
+	})
+}
@@ -0,0 +1,161 @@
+package asyncloguploader
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asyncloguploader/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowWrite stands for a writer still in flight on the buffer a flush is about to swap out: it holds
+// the shard's active buffer open, so the flush seals it after FlushTimeout. The returned func ends it
+func slowWrite(shard *Shard) (release func()) {
+	inflight := &shard.inflightA
+	if shard.activeBuffer.Load() == &shard.bufferB {
+		inflight = &shard.inflightB
+	}
+	inflight.Add(1)
+	return func() { inflight.Add(-1) }
+}
+
+// flushPastTimeout flushes logger, advancing fake until the flush gives up waiting for slow writes
+func flushPastTimeout(t *testing.T, logger *Logger, fake *clock.Fake) {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- logger.Flush(t.Context()) }()
+	for {
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+			return
+		case <-time.After(time.Millisecond):
+			fake.Advance(logger.config.FlushTimeout)
+		}
+	}
+}
+
+// partialWarnings counts the partial flush warnings capture has received
+func partialWarnings(capture *captureLogger) int {
+	n := 0
+	for _, msg := range capture.Messages() {
+		if strings.Contains(msg, "Not all writes completed before flush timeout") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestLogger_PartialFlushes(t *testing.T) {
+	capture := &captureLogger{}
+	config := DefaultConfig(filepath.Join(t.TempDir(), "partial.log"))
+	config.BufferSize = 256 * 1024
+	config.NumShards = 2
+	config.FlushInterval = time.Hour
+	config.FlushTimeout = 5 * time.Millisecond
+	config.InternalLogger = capture
+	config.ShardSelection = ShardSelectionRoundRobin
+	fake := useFakeClock(&config)
+
+	logger, err := NewLogger(config)
+	require.NoError(t, err)
+	defer logger.Close()
+	shards := logger.shardCollection.Load().shards
+
+	// Round robin gives every shard one entry
+	fillShards := func() {
+		for range shards {
+			logger.LogBytes([]byte("entry"))
+		}
+	}
+
+	// Two shards stuck in one flush count as one partial flush
+	fillShards()
+	release0, release1 := slowWrite(shards[0]), slowWrite(shards[1])
+	flushPastTimeout(t, logger, fake)
+	stats := logger.GetStatsStruct()
+	assert.Equal(t, int64(1), stats.PartialFlushes)
+	assert.GreaterOrEqual(t, stats.LastPartialFlushUnixNano, testClockStart.UnixNano())
+	assert.LessOrEqual(t, stats.LastPartialFlushUnixNano, fake.Now().UnixNano())
+	require.Equal(t, 1, partialWarnings(capture))
+	assert.Contains(t, capture.Messages()[0], "2 shard(s)")
+	release0()
+	release1()
+
+	// A flush whose writes all complete is not partial
+	logger.LogBytes([]byte("fast"))
+	require.NoError(t, logger.Flush(t.Context()))
+	assert.Equal(t, int64(1), logger.GetStatsStruct().PartialFlushes)
+
+	// The next partial flush is counted, but its warning is rate limited
+	fillShards()
+	release := slowWrite(shards[0])
+	flushPastTimeout(t, logger, fake)
+	release()
+	assert.Equal(t, int64(2), logger.GetStatsStruct().PartialFlushes)
+	assert.Equal(t, 1, partialWarnings(capture))
+
+	// Once partialFlushWarnInterval has passed, the next one warns with the count it held back
+	fake.Advance(partialFlushWarnInterval)
+	fillShards()
+	release = slowWrite(shards[0])
+	flushPastTimeout(t, logger, fake)
+	release()
+	stats = logger.GetStatsStruct()
+	assert.Equal(t, int64(3), stats.PartialFlushes)
+	require.Equal(t, 2, partialWarnings(capture))
+	assert.Contains(t, capture.Messages()[len(capture.Messages())-1], "(1 more partial flushes since the last warning)")
+
+	// The struct agrees with the tuple accessor
+	totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, _, bytesBuffered, bytesDurable := logger.GetStatsSnapshot()
+	assert.Equal(t, totalLogs, stats.TotalLogs)
+	assert.Equal(t, droppedLogs, stats.DroppedLogs)
+	assert.Equal(t, bytesWritten, stats.BytesWritten)
+	assert.Equal(t, flushes, stats.Flushes)
+	assert.Equal(t, flushErrors, stats.FlushErrors)
+	assert.Equal(t, bytesBuffered, stats.BytesBuffered)
+	assert.Equal(t, bytesDurable, stats.BytesDurable)
+}
+
+func TestLoggerManager_GetStatsStruct(t *testing.T) {
+	config := newGuardTestConfig(t)
+	config.FlushInterval = time.Hour
+	config.FlushTimeout = 5 * time.Millisecond
+	config.InternalLogger = &captureLogger{}
+	config.AllowedEvents = []string{"payment", "login"}
+	fake := useFakeClock(&config)
+
+	lm, err := NewLoggerManager(config)
+	require.NoError(t, err)
+	defer lm.Close()
+	lm.LogBytesWithEvent("payment", []byte("one"))
+	lm.LogBytesWithEvent("login", []byte("two"))
+	lm.LogBytesWithEvent("unknown", []byte("rejected"))
+
+	// Stall a write of one event across a flush
+	value, ok := lm.loggers.Load("payment")
+	require.True(t, ok)
+	payment := value.(*Logger)
+	var release []func()
+	for _, shard := range payment.shardCollection.Load().shards {
+		release = append(release, slowWrite(shard))
+	}
+	flushPastTimeout(t, payment, fake)
+	for _, r := range release {
+		r()
+	}
+	require.NoError(t, lm.FlushAll(t.Context()))
+
+	stats := lm.GetStatsStruct()
+	assert.Equal(t, int64(1), stats.PartialFlushes)
+	assert.Equal(t, payment.GetStatsStruct().LastPartialFlushUnixNano, stats.LastPartialFlushUnixNano)
+	totalLogs, droppedLogs, bytesWritten, flushes, _, _, _, _ := lm.GetAggregatedStats()
+	assert.Equal(t, int64(3), stats.TotalLogs)
+	assert.Equal(t, totalLogs, stats.TotalLogs)
+	assert.Equal(t, droppedLogs, stats.DroppedLogs)
+	assert.Equal(t, bytesWritten, stats.BytesWritten)
+	assert.Equal(t, flushes, stats.Flushes)
+}
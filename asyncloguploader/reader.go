@@ -0,0 +1,169 @@
+package asyncloguploader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asyncloguploader/reader"
+)
+
+// chunkFlag is set in an entry's length prefix when the entry is one chunk of a larger message
+const chunkFlag = 1 << 31
+
+// chunkHeaderSize is the per-chunk header: [8 bytes message ID][4 bytes chunk index][4 bytes chunk count]
+const chunkHeaderSize = 16
+
+// ErrCorruptLog is returned by Reader when a shard header or entry is inconsistent
+// It is reader.ErrCorrupt, so errors.Is matches the errors of either reader
+var ErrCorruptLog = reader.ErrCorrupt
+
+// Reader decodes log messages from a file written by Logger and reassembles chunked messages
+// The file format (file header, shards, checksums and entry framing) is decoded by
+// reader.LogReader, see the reader package; Reader reads the file in order, so it works on any
+// io.Reader (e.g. a decompressing or checksumming stream), and adds the reassembly of chunks
+type Reader struct {
+	log     *reader.LogReader
+	pending map[uint64]*chunkedMessage // Chunked messages still missing chunks, by message ID
+}
+
+// chunkedMessage collects the chunks of one message until all have been read
+type chunkedMessage struct {
+	chunks   [][]byte
+	received int
+}
+
+// NewReader creates a Reader over a log file
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		log:     reader.NewLogReader(&streamReaderAt{r: r}, reader.Options{}),
+		pending: make(map[uint64]*chunkedMessage),
+	}
+}
+
+// Next returns the next log message, or io.EOF when the file is exhausted
+// Chunked messages are returned once their last chunk has been read (chunks may span shards).
+// The returned slice is only valid until the next call to Next. An ErrCorruptLog for an entry or a
+// shard checksum mismatch skips the rest of that shard; Next may be called again to continue
+func (r *Reader) Next() ([]byte, error) {
+	for {
+		entry, chunk, err := r.log.NextEntry()
+		if err != nil || !chunk {
+			return entry, err
+		}
+		msg, err := r.addChunk(entry)
+		if err != nil || msg != nil {
+			return msg, err
+		}
+	}
+}
+
+// FileHeader returns the file's header, or false for a file written without one
+// The header is read with the first shard, so it is only known after the first call to Next
+func (r *Reader) FileHeader() (FileHeader, bool) {
+	h, ok := r.log.FileHeader()
+	if !ok {
+		return FileHeader{}, false
+	}
+	return FileHeader{
+		Version:       h.Version,
+		Flags:         h.Flags,
+		Size:          int(h.Size),
+		Alignment:     int(h.Alignment),
+		Created:       h.Created,
+		ShardCapacity: int(h.ShardCapacity),
+		NumShards:     h.NumShards,
+	}, true
+}
+
+// IncompleteMessages returns the number of chunked messages still missing chunks
+// After io.EOF this counts messages lost to a dropped chunk or split across a file rotation
+func (r *Reader) IncompleteMessages() int {
+	return len(r.pending)
+}
+
+// streamReaderAt reads a stream for reader.LogReader, which reads a file at increasing offsets
+// except for the file header, read twice from offset 0. It keeps the bytes from the last read
+// offset on and reads r strictly in order, never past the last byte asked for
+type streamReaderAt struct {
+	r    io.Reader
+	mem  []byte // Backing array of buf
+	buf  []byte // Bytes read from r, starting at file offset base
+	base int64
+	err  error // Error that ended r
+}
+
+// ReadAt reads len(p) bytes at off, which must not be before the previous read's offset
+func (s *streamReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < s.base {
+		return 0, fmt.Errorf("offset %d was already read from the stream", off)
+	}
+
+	// Drop the bytes before off, reading through a gap so the stream is consumed in order
+	if skip := off - s.base; skip <= int64(len(s.buf)) {
+		s.buf = s.buf[skip:]
+	} else {
+		if s.err == nil {
+			if _, err := io.CopyN(io.Discard, s.r, skip-int64(len(s.buf))); err != nil {
+				s.err = err
+			}
+		}
+		s.buf = s.buf[:0]
+	}
+	s.base = off
+
+	if len(s.buf) < len(p) && s.err == nil {
+		if cap(s.buf) < len(p) {
+			if cap(s.mem) < len(p) {
+				s.mem = make([]byte, len(p))
+			}
+			s.buf = append(s.mem[:0], s.buf...)
+		}
+		n, err := io.ReadFull(s.r, s.buf[len(s.buf):len(p)])
+		s.buf = s.buf[:len(s.buf)+n]
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = io.EOF
+		}
+		s.err = err
+	}
+
+	n := copy(p, s.buf)
+	if n < len(p) {
+		return n, s.err
+	}
+	return n, nil
+}
+
+// addChunk records one chunk entry and returns the reassembled message once all chunks are present
+func (r *Reader) addChunk(entry []byte) ([]byte, error) {
+	if len(entry) <= chunkHeaderSize {
+		return nil, fmt.Errorf("%w: chunk entry too short (%d bytes)", ErrCorruptLog, len(entry))
+	}
+	id := binary.LittleEndian.Uint64(entry[0:8])
+	index := int(binary.LittleEndian.Uint32(entry[8:12]))
+	count := int(binary.LittleEndian.Uint32(entry[12:16]))
+	if count == 0 || index >= count {
+		return nil, fmt.Errorf("%w: chunk %d of %d for message %d", ErrCorruptLog, index, count, id)
+	}
+
+	msg, ok := r.pending[id]
+	if !ok {
+		msg = &chunkedMessage{chunks: make([][]byte, count)}
+		r.pending[id] = msg
+	}
+	if len(msg.chunks) != count || msg.chunks[index] != nil {
+		return nil, fmt.Errorf("%w: conflicting chunk %d of %d for message %d", ErrCorruptLog, index, count, id)
+	}
+
+	// Copy: the entry points into the shard buffer, which is reused for the next shard
+	msg.chunks[index] = bytes.Clone(entry[chunkHeaderSize:])
+	msg.received++
+	if msg.received < count {
+		return nil, nil
+	}
+
+	delete(r.pending, id)
+	return bytes.Join(msg.chunks, nil), nil
+}
@@ -0,0 +1,67 @@
+package reader
+
+import "io"
+
+// chunkHeaderSize is the [message ID][chunk index][chunk count] header that starts a chunk's data
+const chunkHeaderSize = 16
+
+// ByteAccounting splits the shard bytes of log files like asyncloguploader's FlushMetrics
+// (PayloadBytes, HeaderBytes, PaddingBytes), to check the write amplification a logger reported
+// against its files. File headers are not counted: flushes do not write them
+type ByteAccounting struct {
+	PayloadBytes int64 // Entry data, excluding chunk headers (and including route tags, see AccountFiles)
+	HeaderBytes  int64 // Shard headers, checksum trailers and entry framing (length prefixes, chunk headers)
+	PaddingBytes int64 // Shard bytes after the entries
+}
+
+// WriteAmplificationRatio returns the shard bytes per payload byte (0 without payload)
+func (a ByteAccounting) WriteAmplificationRatio() float64 {
+	if a.PayloadBytes == 0 {
+		return 0
+	}
+	return float64(a.PayloadBytes+a.HeaderBytes+a.PaddingBytes) / float64(a.PayloadBytes)
+}
+
+// AccountFiles reads log files like OpenFiles and accounts the bytes of their shards
+// opts.OnShard, if set, is still called. Entries of shards that are skipped (bad checksum or
+// corruption) count as header bytes. The route tags of TagRoutedEvents are part of an entry's data
+// here, while FlushMetrics counts them as header bytes
+func AccountFiles(paths []string, opts Options) (ByteAccounting, error) {
+	var acct ByteAccounting
+	var validDataBytes int64
+	onShard := opts.OnShard
+	opts.OnShard = func(info ShardInfo) {
+		trailer := int64(0)
+		if info.Version == FormatVersionChecksum {
+			trailer = ChecksumTrailerSize
+		}
+		acct.HeaderBytes += ShardHeaderSize + trailer
+		acct.PaddingBytes += info.Capacity - ShardHeaderSize - trailer - info.ValidDataBytes
+		validDataBytes += info.ValidDataBytes
+		if onShard != nil {
+			onShard(info)
+		}
+	}
+
+	r, err := OpenFiles(paths, opts)
+	if err != nil {
+		return ByteAccounting{}, err
+	}
+	defer r.Close()
+	for {
+		entry, chunk, err := r.NextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ByteAccounting{}, err
+		}
+		payload := int64(len(entry))
+		if chunk {
+			payload -= chunkHeaderSize
+		}
+		acct.PayloadBytes += payload
+	}
+	acct.HeaderBytes += validDataBytes - acct.PayloadBytes
+	return acct, nil
+}
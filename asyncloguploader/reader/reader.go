@@ -0,0 +1,510 @@
+// Package reader decodes log files written by asyncloguploader
+//
+// File format (all integers little-endian):
+//
+//	file   = [fileHeader] shard* [zero padding]
+//	fileHeader = "ALOG" version:u16 flags:u16 headerSize:u32 alignment:u32 createdUnixNano:i64
+//	             shardCapacity:u32 numShards:u32 zero padding up to headerSize
+//	shard  = capacity|version:u32 validDataBytes:u32 entry* padding [crc32c:u32]
+//	entry  = flags|length:u32 data[length]
+//
+// The high bit of an entry's length prefix (ChunkFlag) marks one chunk of a message larger than
+// MaxMessageSize; chunk data starts with a [message ID u64][chunk index u32][chunk count u32] header.
+// Each flush writes every non-empty shard buffer in full: capacity is the buffer size including the
+// 8-byte header and is a multiple of 512 (Direct I/O alignment), so the next shard header starts
+// capacity bytes after the current one. validDataBytes counts the entry bytes after the header;
+// the rest of the shard is padding. A zero capacity marks the end of the written data (e.g. the
+// zero-filled tail of a preallocated file). Rotation starts a new file, so each file is self-contained
+// apart from chunked messages, whose chunks never span files.
+//
+// Capacities are multiples of 512, so the low byte of the capacity field carries the format version.
+// Version 0 is the original format. Version 1 (Config.EnableChecksums) ends each shard with a
+// CRC32C (Castagnoli) of its validDataBytes entry bytes in the last 4 bytes of the shard.
+//
+// Files written with Config.WriteFileHeader start with a file header filling one alignment block,
+// so the first shard starts headerSize bytes into the file. Headerless files start with a shard
+// header, whose first byte is a format version and never the 'A' of the magic.
+package reader
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ShardHeaderSize is the [capacity][validDataBytes] header at the start of each shard
+	ShardHeaderSize = 8
+
+	// LengthPrefixSize is the length prefix before each entry
+	LengthPrefixSize = 4
+
+	// ChunkFlag is set in an entry's length prefix when the entry is one chunk of a larger message
+	ChunkFlag = 1 << 31
+
+	// FormatVersionChecksum marks shards that end with a CRC32C of their valid data bytes
+	FormatVersionChecksum = 1
+
+	// ChecksumTrailerSize is the CRC32C at the end of a version 1 shard
+	ChecksumTrailerSize = 4
+
+	// formatVersionMask selects the format version in the capacity field
+	formatVersionMask = 0xFF
+
+	// Alignment is the Direct I/O block size; shard capacities and offsets are multiples of it
+	Alignment = 512
+
+	// FileHeaderMagic starts files written with a file header
+	FileHeaderMagic = "ALOG"
+
+	// FileFlagChecksums is set in the file header when shards end with a CRC32C
+	FileFlagChecksums = 1 << 0
+
+	// fileHeaderFieldsSize is the encoded file header fields before the padding
+	fileHeaderFieldsSize = 32
+
+	// maxShardCapacity bounds plausible shard headers (shards are far smaller in practice)
+	maxShardCapacity = 1 << 30
+)
+
+// ErrCorrupt is returned when a shard header or entry is inconsistent
+var ErrCorrupt = errors.New("corrupt log file")
+
+// Options configures a LogReader
+type Options struct {
+	// SkipCorruptShards resynchronizes on the next plausible shard header instead of returning
+	// ErrCorrupt when a shard header is invalid or a shard is truncated
+	SkipCorruptShards bool
+
+	// OnShard is called for every shard header read, including empty and truncated shards
+	OnShard func(ShardInfo)
+}
+
+// ShardInfo describes one shard in a log file
+type ShardInfo struct {
+	Source         int   // Index of the file in the series
+	Index          int   // Shard number within the file
+	Offset         int64 // File offset of the shard header
+	Capacity       int64 // Shard size including the header and padding
+	ValidDataBytes int64 // Entry bytes declared by the header
+	Version        int   // Shard format version
+	Truncated      bool  // Part of the shard's data (or its checksum) did not make it to disk
+	BadChecksum    bool  // The version 1 checksum did not match; the shard's entries are skipped
+}
+
+// FileHeader describes how a log file was written
+type FileHeader struct {
+	Version       int       // File header format version
+	Flags         uint16    // FileFlag* bits
+	Size          int64     // Header bytes, including padding; the first shard starts here
+	Alignment     int64     // Block size shards are aligned to
+	Created       time.Time // When the file was created
+	ShardCapacity int64     // Configured shard buffer size (auto-resize may change it later)
+	NumShards     int
+}
+
+// castagnoliTable is the CRC32C table used by version 1 shards
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// LogReader iterates the entries of one log file or a rotated series of log files
+type LogReader struct {
+	sources []source
+	opts    Options
+
+	off      int64  // Offset of the next shard header in the current source
+	shardBuf []byte // Current shard data (reused across shards)
+	data     []byte // Unread entries in the current shard
+	dataOff  int64  // File offset of data[0]
+
+	started bool        // The current source's file header (if any) has been read
+	header  *FileHeader // The current source's file header (nil = headerless)
+
+	source   int       // Index of the current source in the series
+	shardIdx int       // Index of the next shard in the current source
+	shard    ShardInfo // Shard holding the unread entries
+	entryOff int64     // File offset of the last entry returned
+
+	corruptShards int
+	err           error // Sticky error (io.EOF or unrecoverable corruption)
+}
+
+// source is one file in the series; closer is set for files opened by the reader
+type source struct {
+	r      io.ReaderAt
+	closer io.Closer
+}
+
+// NewLogReader creates a LogReader over a single log file
+func NewLogReader(r io.ReaderAt, opts Options) *LogReader {
+	return &LogReader{sources: []source{{r: r}}, opts: opts}
+}
+
+// Open opens a single log file
+func Open(path string, opts Options) (*LogReader, error) {
+	return OpenFiles([]string{path}, opts)
+}
+
+// OpenFiles opens log files to be read in order (e.g. the result of RotatedFiles)
+func OpenFiles(paths []string, opts Options) (*LogReader, error) {
+	r := &LogReader{opts: opts}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		r.sources = append(r.sources, source{r: file, closer: file})
+	}
+	return r, nil
+}
+
+// rotatedSuffix matches the timestamp and sequence number the file writer appends to every file it
+// creates: _YYYY-MM-DD_HH-MM-SS-mmm_N.log, or _YYYY-MM-DD_HH-MM-SS[_N].log from earlier versions
+var rotatedSuffix = regexp.MustCompile(`^_(\d{4}-\d{2}-\d{2}_\d{2}-\d{2}-\d{2}(?:-\d{3})?)(?:_(\d+))?\.log$`)
+
+// RotatedFiles returns the files written for logPath ({base}_{YYYY-MM-DD_HH-MM-SS-mmm}_{N}.log) oldest
+// first. Files already handed to the uploader and removed are not included
+func RotatedFiles(logPath string) ([]string, error) {
+	dir := filepath.Dir(logPath)
+	base := strings.TrimSuffix(filepath.Base(logPath), ".log")
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list log directory: %w", err)
+	}
+
+	type rotatedFile struct {
+		path      string
+		timestamp string
+		seq       int
+	}
+	var rotated []rotatedFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, base) {
+			continue
+		}
+		if match := rotatedSuffix.FindStringSubmatch(name[len(base):]); match != nil {
+			seq, _ := strconv.Atoi(match[2]) // 0 without a sequence number
+			rotated = append(rotated, rotatedFile{path: filepath.Join(dir, name), timestamp: match[1], seq: seq})
+		}
+	}
+	// Timestamps are zero-padded, so lexical order is chronological; sequence numbers are not
+	sort.Slice(rotated, func(a, b int) bool {
+		if rotated[a].timestamp != rotated[b].timestamp {
+			return rotated[a].timestamp < rotated[b].timestamp
+		}
+		return rotated[a].seq < rotated[b].seq
+	})
+	var files []string
+	for _, f := range rotated {
+		files = append(files, f.path)
+	}
+	return files, nil
+}
+
+// Next returns the next entry, or io.EOF after the last file
+// Chunk entries are returned as stored (chunk header included); use NextEntry to tell them apart.
+// The returned slice is only valid until the next call to Next. Without SkipCorruptShards an
+// ErrCorrupt for an entry or a checksum mismatch skips the rest of that shard, and Next may be
+// called again to continue;
+// an ErrCorrupt for a shard header is sticky because the next shard's position is unknown
+func (r *LogReader) Next() ([]byte, error) {
+	entry, _, err := r.NextEntry()
+	return entry, err
+}
+
+// NextEntry is like Next and also reports whether the entry is a chunk of a larger message
+func (r *LogReader) NextEntry() (data []byte, chunk bool, err error) {
+	for {
+		if len(r.data) == 0 {
+			if err := r.nextShard(); err != nil {
+				return nil, false, err
+			}
+			continue
+		}
+
+		if len(r.data) < LengthPrefixSize {
+			r.data = nil
+			if err := r.corrupt("truncated length prefix"); err != nil {
+				return nil, false, err
+			}
+			continue
+		}
+		prefix := binary.LittleEndian.Uint32(r.data)
+		size := int(prefix &^ ChunkFlag)
+		if size == 0 || size > len(r.data)-LengthPrefixSize {
+			r.data = nil
+			if err := r.corrupt(fmt.Sprintf("entry length %d exceeds shard data", size)); err != nil {
+				return nil, false, err
+			}
+			continue
+		}
+		entry := r.data[LengthPrefixSize : LengthPrefixSize+size]
+		r.data = r.data[LengthPrefixSize+size:]
+		r.entryOff = r.dataOff
+		r.dataOff += int64(LengthPrefixSize + size)
+		return entry, prefix&ChunkFlag != 0, nil
+	}
+}
+
+// Shard describes the shard holding the last entry returned by Next
+func (r *LogReader) Shard() ShardInfo {
+	return r.shard
+}
+
+// Offset returns the file offset of the last entry returned by Next (its length prefix)
+func (r *LogReader) Offset() int64 {
+	return r.entryOff
+}
+
+// FileHeader returns the header of the file holding the last entry returned by Next, or false
+// for a file written without one
+func (r *LogReader) FileHeader() (FileHeader, bool) {
+	if r.header == nil {
+		return FileHeader{}, false
+	}
+	return *r.header, true
+}
+
+// CorruptShards returns the number of shards skipped or cut short because of corruption
+func (r *LogReader) CorruptShards() int {
+	return r.corruptShards
+}
+
+// Close closes the files opened by Open or OpenFiles
+func (r *LogReader) Close() error {
+	var firstErr error
+	for _, src := range r.sources {
+		if src.closer != nil {
+			if err := src.closer.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	r.sources = nil
+	return firstErr
+}
+
+// corrupt counts a corrupt shard and returns nil if it should be skipped, or ErrCorrupt
+func (r *LogReader) corrupt(detail string) error {
+	r.corruptShards++
+	if r.opts.SkipCorruptShards {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrCorrupt, detail)
+}
+
+// nextShard loads the next shard's entries, moving on to the next file at the end of each one
+func (r *LogReader) nextShard() error {
+	for r.err == nil {
+		if len(r.sources) == 0 {
+			r.err = io.EOF
+			break
+		}
+
+		loaded, err := r.readShard(r.sources[0].r)
+		if err != nil {
+			if loaded {
+				// The shard was consumed, so the next one can still be read
+				return err
+			}
+			r.err = err
+			break
+		}
+		if loaded {
+			return nil
+		}
+
+		// End of this file
+		if closer := r.sources[0].closer; closer != nil {
+			closer.Close()
+		}
+		r.sources = r.sources[1:]
+		r.off = 0
+		r.started = false
+		r.source++
+		r.shardIdx = 0
+	}
+	return r.err
+}
+
+// readShard reads the shard at r.off; returns false at the end of the file
+func (r *LogReader) readShard(src io.ReaderAt) (bool, error) {
+	var header [ShardHeaderSize]byte
+	n, err := src.ReadAt(header[:], r.off)
+	if n < ShardHeaderSize {
+		if n == 0 && errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return false, fmt.Errorf("failed to read shard header: %w", err)
+		}
+		return false, r.corrupt("truncated shard header")
+	}
+	if !r.started {
+		r.started = true
+		r.header = nil
+		if string(header[:4]) == FileHeaderMagic {
+			if err := r.readFileHeader(src); err != nil {
+				return false, err
+			}
+			return r.readShard(src)
+		}
+	}
+
+	capacity, validDataBytes, version := parseHeader(header)
+	if capacity == 0 && version == 0 {
+		// Zero-filled preallocated tail
+		return false, nil
+	}
+	if !plausibleHeader(capacity, validDataBytes, version) {
+		if err := r.corrupt(fmt.Sprintf("shard header at offset %d: capacity=%d valid=%d version=%d", r.off, capacity, validDataBytes, version)); err != nil {
+			return false, err
+		}
+		return r.resync(src)
+	}
+
+	dataSize := int(capacity - ShardHeaderSize)
+	if cap(r.shardBuf) < dataSize {
+		r.shardBuf = make([]byte, dataSize)
+	}
+	r.shardBuf = r.shardBuf[:dataSize]
+	n, err = src.ReadAt(r.shardBuf, r.off+ShardHeaderSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, fmt.Errorf("failed to read shard data: %w", err)
+	}
+
+	complete := int64(n) >= validDataBytes
+	if version == FormatVersionChecksum {
+		complete = n == dataSize
+	}
+	r.shard = ShardInfo{
+		Source:         r.source,
+		Index:          r.shardIdx,
+		Offset:         r.off,
+		Capacity:       capacity,
+		ValidDataBytes: validDataBytes,
+		Version:        version,
+		Truncated:      !complete,
+		BadChecksum:    complete && version == FormatVersionChecksum && !validChecksum(r.shardBuf, validDataBytes),
+	}
+	r.shardIdx++
+	r.dataOff = r.off + ShardHeaderSize
+	r.off += capacity
+	if r.opts.OnShard != nil {
+		r.opts.OnShard(r.shard)
+	}
+
+	if r.shard.Truncated {
+		// Truncated shard at the end of the file: keep the complete entries that made it to disk
+		if err := r.corrupt(fmt.Sprintf("shard truncated at %d of %d data bytes", n, validDataBytes)); err != nil {
+			return false, err
+		}
+		r.data = completeEntries(r.shardBuf[:min(int64(n), validDataBytes)])
+		return true, nil
+	}
+	if r.shard.BadChecksum {
+		r.data = nil
+		return true, r.corrupt(fmt.Sprintf("shard checksum mismatch at offset %d", r.shard.Offset))
+	}
+	r.data = r.shardBuf[:validDataBytes]
+	return true, nil
+}
+
+// resync scans forward from the corrupt header for the next plausible shard header
+// Shards start on Alignment boundaries, so only aligned offsets are checked
+func (r *LogReader) resync(src io.ReaderAt) (bool, error) {
+	var header [ShardHeaderSize]byte
+	for off := (r.off/Alignment + 1) * Alignment; ; off += Alignment {
+		n, err := src.ReadAt(header[:], off)
+		if n < ShardHeaderSize {
+			if err != nil && !errors.Is(err, io.EOF) {
+				return false, fmt.Errorf("failed to read shard header: %w", err)
+			}
+			return false, nil
+		}
+		capacity, validDataBytes, version := parseHeader(header)
+		if capacity == 0 && validDataBytes == 0 && version == 0 {
+			continue
+		}
+		if plausibleHeader(capacity, validDataBytes, version) {
+			r.off = off
+			return r.readShard(src)
+		}
+	}
+}
+
+// readFileHeader reads the file header at the start of src and moves r.off to the first shard
+// An invalid file header is not skipped: the first shard's position is unknown
+func (r *LogReader) readFileHeader(src io.ReaderAt) error {
+	var b [fileHeaderFieldsSize]byte
+	if n, err := src.ReadAt(b[:], 0); n < len(b) {
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read file header: %w", err)
+		}
+		return fmt.Errorf("%w: truncated file header", ErrCorrupt)
+	}
+	h := FileHeader{
+		Version:       int(binary.LittleEndian.Uint16(b[4:6])),
+		Flags:         binary.LittleEndian.Uint16(b[6:8]),
+		Size:          int64(binary.LittleEndian.Uint32(b[8:12])),
+		Alignment:     int64(binary.LittleEndian.Uint32(b[12:16])),
+		Created:       time.Unix(0, int64(binary.LittleEndian.Uint64(b[16:24]))),
+		ShardCapacity: int64(binary.LittleEndian.Uint32(b[24:28])),
+		NumShards:     int(binary.LittleEndian.Uint32(b[28:32])),
+	}
+	if h.Size < fileHeaderFieldsSize || h.Alignment <= 0 || h.Size%h.Alignment != 0 {
+		return fmt.Errorf("%w: file header size=%d alignment=%d", ErrCorrupt, h.Size, h.Alignment)
+	}
+	r.header = &h
+	r.off = h.Size
+	return nil
+}
+
+// parseHeader splits a shard header into capacity, valid data bytes and format version
+func parseHeader(header [ShardHeaderSize]byte) (capacity, validDataBytes int64, version int) {
+	word := binary.LittleEndian.Uint32(header[0:4])
+	return int64(word &^ formatVersionMask), int64(binary.LittleEndian.Uint32(header[4:8])), int(word & formatVersionMask)
+}
+
+// plausibleHeader reports whether a shard header is consistent with the format
+func plausibleHeader(capacity, validDataBytes int64, version int) bool {
+	trailer := int64(0)
+	if version == FormatVersionChecksum {
+		trailer = ChecksumTrailerSize
+	}
+	return version <= FormatVersionChecksum &&
+		capacity > ShardHeaderSize+trailer &&
+		capacity <= maxShardCapacity &&
+		capacity%Alignment == 0 &&
+		validDataBytes <= capacity-ShardHeaderSize-trailer
+}
+
+// validChecksum checks a version 1 shard's trailer; shardData is the shard after its header
+func validChecksum(shardData []byte, validDataBytes int64) bool {
+	trailer := shardData[len(shardData)-ChecksumTrailerSize:]
+	return crc32.Checksum(shardData[:validDataBytes], castagnoliTable) == binary.LittleEndian.Uint32(trailer)
+}
+
+// completeEntries trims data to the entries that fit entirely
+func completeEntries(data []byte) []byte {
+	pos := 0
+	for pos+LengthPrefixSize <= len(data) {
+		size := int(binary.LittleEndian.Uint32(data[pos:]) &^ ChunkFlag)
+		if size == 0 || pos+LengthPrefixSize+size > len(data) {
+			break
+		}
+		pos += LengthPrefixSize + size
+	}
+	return data[:pos]
+}
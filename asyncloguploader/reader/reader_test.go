@@ -0,0 +1,372 @@
+package reader_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asyncloguploader"
+	"github.com/neehar-mavuduru/logger-double-buffer/asyncloguploader/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildShard encodes entries into a full-capacity shard buffer as the flush path writes it
+func buildShard(capacity int, entries ...string) []byte {
+	buf := make([]byte, capacity)
+	pos := reader.ShardHeaderSize
+	for _, entry := range entries {
+		binary.LittleEndian.PutUint32(buf[pos:], uint32(len(entry)))
+		copy(buf[pos+reader.LengthPrefixSize:], entry)
+		pos += reader.LengthPrefixSize + len(entry)
+	}
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(capacity))
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(pos-reader.ShardHeaderSize))
+	return buf
+}
+
+// buildFileHeader encodes a file header of size bytes as the file writer writes it
+func buildFileHeader(size int, created time.Time) []byte {
+	buf := make([]byte, size)
+	copy(buf, reader.FileHeaderMagic)
+	binary.LittleEndian.PutUint16(buf[4:6], 1)
+	binary.LittleEndian.PutUint16(buf[6:8], reader.FileFlagChecksums)
+	binary.LittleEndian.PutUint32(buf[8:12], uint32(size))
+	binary.LittleEndian.PutUint32(buf[12:16], 4096)
+	binary.LittleEndian.PutUint64(buf[16:24], uint64(created.UnixNano()))
+	binary.LittleEndian.PutUint32(buf[24:28], 512)
+	binary.LittleEndian.PutUint32(buf[28:32], 2)
+	return buf
+}
+
+// readAll drains a LogReader
+func readAll(t *testing.T, r *reader.LogReader) []string {
+	t.Helper()
+	var entries []string
+	for {
+		entry, err := r.Next()
+		if err == io.EOF {
+			return entries
+		}
+		require.NoError(t, err)
+		entries = append(entries, string(entry))
+	}
+}
+
+func TestLogReader_Next(t *testing.T) {
+	t.Run("EntriesAcrossShards", func(t *testing.T) {
+		file := append(buildShard(512, "a", "bb"), buildShard(1024, "ccc")...)
+		r := reader.NewLogReader(bytes.NewReader(file), reader.Options{})
+
+		assert.Equal(t, []string{"a", "bb", "ccc"}, readAll(t, r))
+		assert.Equal(t, 0, r.CorruptShards())
+	})
+
+	t.Run("ZeroFilledPreallocatedTail", func(t *testing.T) {
+		file := append(buildShard(512), buildShard(512, "a")...)
+		file = append(file, make([]byte, 4096)...)
+		r := reader.NewLogReader(bytes.NewReader(file), reader.Options{})
+
+		assert.Equal(t, []string{"a"}, readAll(t, r))
+	})
+
+	t.Run("ChunkFlag", func(t *testing.T) {
+		file := buildShard(512, "whole", "part")
+		prefixOffset := reader.ShardHeaderSize + reader.LengthPrefixSize + len("whole")
+		binary.LittleEndian.PutUint32(file[prefixOffset:], uint32(len("part"))|reader.ChunkFlag)
+		r := reader.NewLogReader(bytes.NewReader(file), reader.Options{})
+
+		data, chunk, err := r.NextEntry()
+		require.NoError(t, err)
+		assert.Equal(t, "whole", string(data))
+		assert.False(t, chunk)
+
+		data, chunk, err = r.NextEntry()
+		require.NoError(t, err)
+		assert.Equal(t, "part", string(data))
+		assert.True(t, chunk)
+	})
+
+	t.Run("CorruptHeaderIsSticky", func(t *testing.T) {
+		bad := buildShard(512, "a")
+		binary.LittleEndian.PutUint32(bad[0:4], 100) // Not aligned
+		r := reader.NewLogReader(bytes.NewReader(bad), reader.Options{})
+
+		_, err := r.Next()
+		assert.True(t, errors.Is(err, reader.ErrCorrupt))
+		_, err = r.Next()
+		assert.True(t, errors.Is(err, reader.ErrCorrupt))
+	})
+
+	t.Run("SkipCorruptShardsResynchronizes", func(t *testing.T) {
+		bad := buildShard(1024, "lost")
+		binary.LittleEndian.PutUint32(bad[4:8], 5000) // Valid bytes exceed capacity
+		file := append(buildShard(512, "a"), bad...)
+		file = append(file, buildShard(512, "b")...)
+		r := reader.NewLogReader(bytes.NewReader(file), reader.Options{SkipCorruptShards: true})
+
+		assert.Equal(t, []string{"a", "b"}, readAll(t, r))
+		assert.Equal(t, 1, r.CorruptShards())
+	})
+
+	t.Run("TruncatedShard", func(t *testing.T) {
+		file := append(buildShard(512, "a"), buildShard(512, "b", "cc")...)
+		file = file[:512+reader.ShardHeaderSize+reader.LengthPrefixSize+1+2] // Cut inside "cc"'s length prefix
+
+		r := reader.NewLogReader(bytes.NewReader(file), reader.Options{})
+		entry, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "a", string(entry))
+		_, err = r.Next()
+		assert.True(t, errors.Is(err, reader.ErrCorrupt))
+
+		r = reader.NewLogReader(bytes.NewReader(file), reader.Options{SkipCorruptShards: true})
+		assert.Equal(t, []string{"a", "b"}, readAll(t, r))
+		assert.Equal(t, 1, r.CorruptShards())
+	})
+}
+
+func TestLogReader_Position(t *testing.T) {
+	file := append(buildShard(512, "a", "bb"), buildShard(512)...)
+	file = append(file, buildShard(512, "ccc")...)
+
+	var shards []reader.ShardInfo
+	r := reader.NewLogReader(bytes.NewReader(file), reader.Options{OnShard: func(info reader.ShardInfo) {
+		shards = append(shards, info)
+	}})
+
+	_, err := r.Next()
+	require.NoError(t, err)
+	entry, err := r.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "bb", string(entry))
+	assert.Equal(t, int64(reader.ShardHeaderSize+reader.LengthPrefixSize+1), r.Offset())
+	assert.Equal(t, 0, r.Shard().Index)
+
+	entry, err = r.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "ccc", string(entry))
+	assert.Equal(t, int64(1024+reader.ShardHeaderSize), r.Offset())
+	assert.Equal(t, reader.ShardInfo{Index: 2, Offset: 1024, Capacity: 512, ValidDataBytes: 7}, r.Shard())
+
+	_, err = r.Next()
+	assert.Equal(t, io.EOF, err)
+	require.Len(t, shards, 3)
+	assert.Equal(t, int64(0), shards[1].ValidDataBytes)
+}
+
+func TestLogReader_FileHeader(t *testing.T) {
+	created := time.Unix(1700000000, 123)
+
+	t.Run("SkipsHeader", func(t *testing.T) {
+		file := append(buildFileHeader(4096, created), buildShard(512, "a", "bb")...)
+		r := reader.NewLogReader(bytes.NewReader(file), reader.Options{})
+
+		entry, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "a", string(entry))
+		assert.Equal(t, int64(4096+reader.ShardHeaderSize), r.Offset())
+		assert.Equal(t, int64(4096), r.Shard().Offset)
+
+		header, ok := r.FileHeader()
+		require.True(t, ok)
+		assert.Equal(t, reader.FileHeader{
+			Version:       1,
+			Flags:         reader.FileFlagChecksums,
+			Size:          4096,
+			Alignment:     4096,
+			Created:       created,
+			ShardCapacity: 512,
+			NumShards:     2,
+		}, header)
+		assert.Equal(t, []string{"bb"}, readAll(t, r))
+	})
+
+	t.Run("HeaderPerFileInSeries", func(t *testing.T) {
+		dir := t.TempDir()
+		headered := filepath.Join(dir, "a.log")
+		legacy := filepath.Join(dir, "b.log")
+		require.NoError(t, os.WriteFile(headered, append(buildFileHeader(4096, created), buildShard(512, "a")...), 0644))
+		require.NoError(t, os.WriteFile(legacy, buildShard(512, "b"), 0644))
+
+		r, err := reader.OpenFiles([]string{headered, legacy}, reader.Options{})
+		require.NoError(t, err)
+		defer r.Close()
+
+		_, err = r.Next()
+		require.NoError(t, err)
+		_, ok := r.FileHeader()
+		assert.True(t, ok)
+
+		entry, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "b", string(entry))
+		_, ok = r.FileHeader()
+		assert.False(t, ok, "legacy file has no header")
+		assert.Equal(t, int64(reader.ShardHeaderSize), r.Offset())
+	})
+
+	t.Run("InvalidHeaderIsCorrupt", func(t *testing.T) {
+		file := append(buildFileHeader(4096, created), buildShard(512, "a")...)
+		binary.LittleEndian.PutUint32(file[8:12], 100) // Not a multiple of the alignment
+		r := reader.NewLogReader(bytes.NewReader(file), reader.Options{})
+
+		_, err := r.Next()
+		assert.True(t, errors.Is(err, reader.ErrCorrupt))
+	})
+}
+
+func TestRotatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "payment.log")
+
+	write := func(name string, entries ...string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), buildShard(512, entries...), 0644))
+	}
+	write("payment_2026-01-02_10-00-00-500_10.log", "5")
+	write("payment_2026-01-02_10-00-00-500_2.log", "4")
+	write("payment_2026-01-02_10-00-00-042_0.log", "3")
+	write("payment_2026-01-02_10-00-00.log", "2") // Written before names had milliseconds
+	write("payment_2026-01-01_23-59-59.log", "1")
+	write("payment_refund_2026-01-01_00-00-00-000_0.log", "other")
+
+	files, err := reader.RotatedFiles(logPath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "payment_2026-01-01_23-59-59.log"),
+		filepath.Join(dir, "payment_2026-01-02_10-00-00.log"),
+		filepath.Join(dir, "payment_2026-01-02_10-00-00-042_0.log"),
+		filepath.Join(dir, "payment_2026-01-02_10-00-00-500_2.log"),
+		filepath.Join(dir, "payment_2026-01-02_10-00-00-500_10.log"),
+	}, files)
+
+	r, err := reader.OpenFiles(files, reader.Options{})
+	require.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, readAll(t, r))
+}
+
+func TestLogReader_LoggerOutput(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "events.log")
+	config := asyncloguploader.DefaultConfig(logPath)
+	config.BufferSize = 256 * 1024
+	config.NumShards = 2
+	config.PreallocateFileSize = 1024 * 1024
+	config.FlushInterval = 50 * time.Millisecond
+	config.MaxMessageSize = 1024 * 1024
+	config.AllowChunking = true
+
+	logger, err := asyncloguploader.NewLogger(config)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		logger.LogBytes([]byte(fmt.Sprintf("message %d", i)))
+	}
+	logger.LogBytes(bytes.Repeat([]byte("x"), 300*1024)) // Chunked
+	require.NoError(t, logger.Close())
+
+	files, err := reader.RotatedFiles(logPath)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	r, err := reader.Open(files[0], reader.Options{})
+	require.NoError(t, err)
+	defer r.Close()
+
+	messages, chunks := 0, 0
+	for {
+		_, chunk, err := r.NextEntry()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if chunk {
+			chunks++
+		} else {
+			messages++
+		}
+	}
+	assert.Equal(t, 100, messages)
+	assert.Greater(t, chunks, 1)
+	assert.Equal(t, 0, r.CorruptShards())
+
+	header, ok := r.FileHeader()
+	require.True(t, ok)
+	assert.Equal(t, int64(128*1024), header.ShardCapacity)
+	assert.Equal(t, 2, header.NumShards)
+	assert.Equal(t, header.Size, header.Alignment)
+	assert.WithinDuration(t, time.Now(), header.Created, time.Minute)
+}
+
+func TestLogReader_Checksums(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "checksummed.log")
+	config := asyncloguploader.DefaultConfig(logPath)
+	config.BufferSize = 1024 * 1024
+	config.NumShards = 4
+	config.EnableChecksums = true
+	config.WriteFileHeader = false // The first shard at offset 0
+
+	logger, err := asyncloguploader.NewLogger(config)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		logger.LogBytes([]byte(fmt.Sprintf("message %d", i)))
+	}
+	require.NoError(t, logger.Close())
+
+	files, err := reader.RotatedFiles(logPath)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+
+	var shards []reader.ShardInfo
+	r := reader.NewLogReader(bytes.NewReader(data), reader.Options{OnShard: func(info reader.ShardInfo) { shards = append(shards, info) }})
+	assert.Len(t, readAll(t, r), 100)
+	require.Greater(t, len(shards), 1)
+	for _, shard := range shards {
+		assert.Equal(t, reader.FormatVersionChecksum, shard.Version)
+		assert.False(t, shard.BadChecksum)
+	}
+	firstShardEntries := 0
+	r = reader.NewLogReader(bytes.NewReader(data), reader.Options{})
+	for {
+		_, err := r.Next()
+		require.NoError(t, err)
+		if r.Shard().Index > 0 {
+			break
+		}
+		firstShardEntries++
+	}
+
+	// Flip a payload byte in the first shard
+	data[reader.ShardHeaderSize+reader.LengthPrefixSize] ^= 0xFF
+
+	t.Run("StrictReportsAndContinues", func(t *testing.T) {
+		r := reader.NewLogReader(bytes.NewReader(data), reader.Options{})
+		_, err := r.Next()
+		assert.True(t, errors.Is(err, reader.ErrCorrupt))
+		assert.Len(t, readAll(t, r), 100-firstShardEntries)
+	})
+
+	t.Run("SkipCorruptShards", func(t *testing.T) {
+		var bad int
+		r := reader.NewLogReader(bytes.NewReader(data), reader.Options{
+			SkipCorruptShards: true,
+			OnShard: func(info reader.ShardInfo) {
+				if info.BadChecksum {
+					bad++
+				}
+			},
+		})
+		assert.Len(t, readAll(t, r), 100-firstShardEntries)
+		assert.Equal(t, 1, r.CorruptShards())
+		assert.Equal(t, 1, bad)
+	})
+}
@@ -0,0 +1,273 @@
+package asyncloguploader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readAllMessages decodes every message in a log file with Reader
+func readAllMessages(t *testing.T, path string) ([][]byte, *Reader) {
+	t.Helper()
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	reader := NewReader(file)
+	var messages [][]byte
+	for {
+		msg, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return messages, reader
+		}
+		require.NoError(t, err)
+		messages = append(messages, bytes.Clone(msg))
+	}
+}
+
+// newSizeTestLogger creates a 4-shard logger with 256KB shards
+func newSizeTestLogger(t *testing.T, name string, configure func(*Config)) (*Logger, string) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	config := DefaultConfig(filepath.Join(tmpDir, name+".log"))
+	config.BufferSize = 1024 * 1024
+	config.NumShards = 4
+	config.FlushInterval = 50 * time.Millisecond
+	if configure != nil {
+		configure(&config)
+	}
+
+	logger, err := NewLogger(config)
+	require.NoError(t, err)
+	return logger, tmpDir
+}
+
+func TestLogger_MaxMessageSize(t *testing.T) {
+	const shardCapacity = 256 * 1024
+	maxEntry := shardCapacity - headerOffset - lengthPrefixSize
+
+	t.Run("DefaultsToLargestShardEntry", func(t *testing.T) {
+		config := DefaultConfig("/tmp/test.log")
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 4
+		require.NoError(t, config.Validate())
+		assert.Equal(t, maxEntry, config.MaxMessageSize)
+
+		config.MaxMessageSize = maxEntry + 1
+		assert.Error(t, config.Validate(), "larger than a shard entry requires AllowChunking")
+
+		config.AllowChunking = true
+		assert.NoError(t, config.Validate())
+
+		config.MaxMessageSize = -1
+		assert.Error(t, config.Validate())
+	})
+
+	t.Run("AcceptsMessageFillingShardExactly", func(t *testing.T) {
+		logger, tmpDir := newSizeTestLogger(t, "exact", nil)
+
+		msg := bytes.Repeat([]byte{'x'}, maxEntry)
+		logger.LogBytes(msg)
+		require.NoError(t, logger.Close())
+
+		totalLogs, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
+		oversized, chunked := logger.GetMessageSizeStats()
+		assert.Equal(t, int64(1), totalLogs)
+		assert.Equal(t, int64(0), droppedLogs)
+		assert.Equal(t, int64(0), oversized)
+		assert.Equal(t, int64(0), chunked)
+
+		messages, _ := readAllMessages(t, findLogFile(t, tmpDir, "exact"))
+		require.Len(t, messages, 1)
+		assert.Equal(t, msg, messages[0])
+	})
+
+	t.Run("RejectsOneByteOver", func(t *testing.T) {
+		logger, _ := newSizeTestLogger(t, "over", nil)
+		defer logger.Close()
+
+		logger.LogBytes(make([]byte, maxEntry+1))
+		logger.LogBytes(make([]byte, shardCapacity))
+
+		totalLogs, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
+		oversized, _ := logger.GetMessageSizeStats()
+		assert.Equal(t, int64(2), totalLogs)
+		assert.Equal(t, int64(0), droppedLogs, "oversized logs are not folded into DroppedLogs")
+		assert.Equal(t, int64(2), oversized)
+		assert.Equal(t, int64(2), logger.Snapshot().Stats.OversizedLogs)
+	})
+
+	t.Run("RejectsAboveMaxMessageSizeWithChunking", func(t *testing.T) {
+		logger, _ := newSizeTestLogger(t, "chunk_limit", func(c *Config) {
+			c.AllowChunking = true
+			c.MaxMessageSize = 2 * shardCapacity
+		})
+		defer logger.Close()
+
+		logger.LogBytes(make([]byte, 2*shardCapacity+1))
+
+		oversized, chunked := logger.GetMessageSizeStats()
+		assert.Equal(t, int64(1), oversized)
+		assert.Equal(t, int64(0), chunked)
+	})
+
+	t.Run("ChunksAndReaderReassembles", func(t *testing.T) {
+		logger, tmpDir := newSizeTestLogger(t, "chunked", func(c *Config) {
+			c.AllowChunking = true
+			c.MaxMessageSize = 4 * shardCapacity
+		})
+
+		large := make([]byte, 2*shardCapacity+shardCapacity/2)
+		for i := range large {
+			large[i] = byte(rand.IntN(256))
+		}
+		justOver := bytes.Repeat([]byte{'e'}, maxEntry+1) // One byte over a shard entry
+
+		logger.LogBytes([]byte("before"))
+		logger.LogBytes(large)
+		logger.LogBytes(justOver)
+		logger.LogBytes([]byte("after"))
+		require.NoError(t, logger.Close())
+
+		_, droppedLogs, _, _, _, _, _, _ := logger.GetStatsSnapshot()
+		oversized, chunked := logger.GetMessageSizeStats()
+		assert.Equal(t, int64(0), droppedLogs)
+		assert.Equal(t, int64(0), oversized)
+		assert.Equal(t, int64(2), chunked)
+
+		messages, reader := readAllMessages(t, findLogFile(t, tmpDir, "chunked"))
+		assert.Equal(t, 0, reader.IncompleteMessages())
+		require.Len(t, messages, 4)
+
+		// Shards are flushed in arbitrary order, so match by content
+		var sawLarge, sawJustOver bool
+		var small []string
+		for _, msg := range messages {
+			switch {
+			case bytes.Equal(msg, large):
+				sawLarge = true
+			case bytes.Equal(msg, justOver):
+				sawJustOver = true
+			default:
+				small = append(small, string(msg))
+			}
+		}
+		assert.True(t, sawLarge, "large message not reassembled")
+		assert.True(t, sawJustOver, "message one byte over a shard entry not reassembled")
+		assert.ElementsMatch(t, []string{"before", "after"}, small)
+	})
+}
+
+func TestReader(t *testing.T) {
+	// shardBuffer builds one flushed shard buffer containing entries
+	shardBuffer := func(capacity int, entries ...[]byte) []byte {
+		buf := make([]byte, capacity)
+		offset := headerOffset
+		for _, entry := range entries {
+			offset += copy(buf[offset:], entry)
+		}
+		binary.LittleEndian.PutUint32(buf[0:4], uint32(capacity))
+		binary.LittleEndian.PutUint32(buf[4:8], uint32(offset-headerOffset))
+		return buf
+	}
+	plain := func(data string) []byte {
+		entry := binary.LittleEndian.AppendUint32(nil, uint32(len(data)))
+		return append(entry, data...)
+	}
+	chunk := func(id uint64, index, count int, data string) []byte {
+		entry := binary.LittleEndian.AppendUint32(nil, uint32(chunkHeaderSize+len(data))|chunkFlag)
+		entry = binary.LittleEndian.AppendUint64(entry, id)
+		entry = binary.LittleEndian.AppendUint32(entry, uint32(index))
+		entry = binary.LittleEndian.AppendUint32(entry, uint32(count))
+		return append(entry, data...)
+	}
+	readAll := func(data []byte) ([]string, *Reader, error) {
+		reader := NewReader(bytes.NewReader(data))
+		var messages []string
+		for {
+			msg, err := reader.Next()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					err = nil
+				}
+				return messages, reader, err
+			}
+			messages = append(messages, string(msg))
+		}
+	}
+
+	t.Run("ReassemblesChunksAcrossShards", func(t *testing.T) {
+		file := append(shardBuffer(4096, chunk(7, 1, 2, "world"), plain("a")),
+			shardBuffer(4096, plain("b"), chunk(7, 0, 2, "hello "))...)
+		file = append(file, make([]byte, 8192)...) // Zero-filled preallocated tail
+
+		messages, reader, err := readAll(file)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b", "hello world"}, messages)
+		assert.Equal(t, 0, reader.IncompleteMessages())
+	})
+
+	t.Run("CountsIncompleteMessages", func(t *testing.T) {
+		messages, reader, err := readAll(shardBuffer(4096, chunk(1, 0, 3, "x"), plain("a")))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a"}, messages)
+		assert.Equal(t, 1, reader.IncompleteMessages())
+	})
+
+	t.Run("SkipsCorruptEntryAndContinues", func(t *testing.T) {
+		bad := binary.LittleEndian.AppendUint32(nil, 1000) // Length past the end of shard data
+		file := append(shardBuffer(4096, plain("a"), bad), shardBuffer(4096, plain("b"))...)
+
+		reader := NewReader(bytes.NewReader(file))
+		msg, err := reader.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "a", string(msg))
+
+		_, err = reader.Next()
+		assert.ErrorIs(t, err, ErrCorruptLog)
+
+		msg, err = reader.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "b", string(msg))
+	})
+	t.Run("ReadsStreamsInOrder", func(t *testing.T) {
+		// A stream without io.ReaderAt, one byte per read: the reader reads through the file
+		// header and stops at the zero-filled tail without reading past its first shard header
+		created := time.Unix(1700000000, 0)
+		header := FileHeader{Version: fileHeaderVersion, Size: fileHeaderSize, Alignment: alignmentSize, ShardCapacity: 4096, NumShards: 2}
+		file := make([]byte, fileHeaderSize)
+		header.encode(file, created)
+		file = append(file, shardBuffer(4096, plain("a"), chunk(3, 0, 2, "hel"))...)
+		file = append(file, shardBuffer(4096, chunk(3, 1, 2, "lo"), plain("b"))...)
+		file = append(file, make([]byte, 4096)...)
+
+		stream := bytes.NewReader(file)
+		reader := NewReader(iotest.OneByteReader(stream))
+		var messages []string
+		for {
+			msg, err := reader.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+			messages = append(messages, string(msg))
+		}
+		assert.Equal(t, []string{"a", "hello", "b"}, messages)
+		assert.Equal(t, 4096-headerOffset, stream.Len())
+
+		header.Created = created
+		got, ok := reader.FileHeader()
+		require.True(t, ok)
+		assert.Equal(t, header, got)
+	})
+}
@@ -0,0 +1,132 @@
+package asyncloguploader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// recoverableLogName matches rotated file names ({base}_YYYY-MM-DD_HH-MM-SS-mmm_N.log, or
+// {base}_YYYY-MM-DD_HH-MM-SS[_N].log from earlier versions), optionally compressed (.log.gz)
+var recoverableLogName = regexp.MustCompile(`_\d{4}-\d{2}-\d{2}_\d{2}-\d{2}-\d{2}(?:-\d{3})?(?:_\d+)?\.log(?:\.\w+)?$`)
+
+// errUploaderStopped is returned by ScanAndEnqueue once Stop has begun
+var errUploaderStopped = errors.New("uploader stopped")
+
+// ScanAndEnqueue queues rotated log files left in dir (e.g. by a crash between rotation and upload)
+// and returns how many were queued. pattern is a filepath.Match pattern on file names ("" matches
+// all); only names following the rotation convention are considered. Skipped files:
+//   - files still open in a logger or already queued (per the UploadTracker shared with the loggers)
+//   - files modified within RecoveryGracePeriod, which may be open in another process
+//   - with RecoveryCheckExisting, files whose object already exists with the same size; with
+//     DeleteAfterUpload they are deleted once their checksum matches too, as the upload had finished
+//
+// Start runs it for each of RecoveryDirs. Must be called between Start and Stop; a scan in progress
+// when Stop is called ends early
+func (u *Uploader) ScanAndEnqueue(dir, pattern string) (int, error) {
+	if pattern != "" {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return 0, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list %s: %w", dir, err)
+	}
+
+	// Held while sending, so Stop cannot close the upload channel under a scan
+	u.scanMu.RLock()
+	defer u.scanMu.RUnlock()
+	select {
+	case <-u.stopping:
+		return 0, errUploaderStopped
+	default:
+	}
+
+	cutoff := time.Now().Add(-u.config.RecoveryGracePeriod)
+	queued := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !recoverableLogName.MatchString(name) {
+			continue
+		}
+		if pattern != "" {
+			if ok, _ := filepath.Match(pattern, name); !ok {
+				continue
+			}
+		}
+		info, err := entry.Info()
+		if err != nil || info.Size() == 0 || info.ModTime().After(cutoff) {
+			continue // Deleted meanwhile, never written, or possibly still being written
+		}
+
+		path := filepath.Join(dir, name)
+		if !u.tracker.claim(path) {
+			continue
+		}
+		if u.config.RecoveryCheckExisting && u.alreadyUploaded(path, info.Size()) {
+			u.tracker.done(path)
+			continue
+		}
+
+		select {
+		case u.uploadChan <- path:
+			queued++
+			u.statsMu.Lock()
+			u.uploadStats.RecoveredFiles++
+			u.statsMu.Unlock()
+		case <-u.stopping:
+			u.tracker.done(path)
+			return queued, errUploaderStopped
+		}
+	}
+	return queued, nil
+}
+
+// alreadyUploaded reports whether path's object exists with the given size. With DeleteAfterUpload,
+// the local file is deleted if its checksum matches too. Lookup errors count as not uploaded, so the
+// file is uploaded again
+func (u *Uploader) alreadyUploaded(path string, size int64) bool {
+	object, err := u.backend.Stat(u.ctx, u.generateObjectName(path, ""))
+	if err != nil {
+		if !errors.Is(err, ErrObjectNotFound) {
+			u.logger.Printf("[WARNING] Recovery: failed to look up object for %s, uploading it: %v", path, err)
+		}
+		return false
+	}
+	if object.Size != size {
+		return false
+	}
+	if !u.config.DeleteAfterUpload {
+		u.logger.Printf("[DEBUG] Recovery: %s was already uploaded, skipping it", path)
+		return true
+	}
+
+	localSize, crc, err := fileChecksum(path)
+	if err != nil || compareObject(object, localSize, crc) != nil {
+		return false
+	}
+	u.logger.Printf("[DEBUG] Recovery: %s was already uploaded, deleting it", path)
+	u.deleteLocal(path)
+	return true
+}
+
+// recoverDirs scans RecoveryDirs (started by Start)
+func (u *Uploader) recoverDirs() {
+	for _, dir := range u.config.RecoveryDirs {
+		queued, err := u.ScanAndEnqueue(dir, "")
+		if errors.Is(err, errUploaderStopped) {
+			return
+		}
+		if err != nil {
+			u.logger.Printf("[WARNING] Recovery: %v", err)
+			continue
+		}
+		if queued > 0 {
+			u.logger.Printf("[DEBUG] Recovery: queued %d files from %s", queued, dir)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package asyncloguploader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeOrphanFile creates a rotated file last modified an hour ago
+func writeOrphanFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	path := writeUploadFile(t, dir, name)
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(path, old, old))
+	return path
+}
+
+func TestUploader_ScanAndEnqueue(t *testing.T) {
+	t.Run("UploadsOrphansExactlyOnce", func(t *testing.T) {
+		dir := t.TempDir()
+		var orphans []string
+		for i := 0; i < 5; i++ {
+			orphans = append(orphans, writeOrphanFile(t, dir, fmt.Sprintf("app_2020-01-01_00-00-0%d.log", i)))
+		}
+		orphans = append(orphans, writeOrphanFile(t, dir, "app_w1_2020-01-01_00-00-00_1.log.gz"))
+		orphans = append(orphans, writeOrphanFile(t, dir, "app_2020-01-01_00-00-00-123_4.log"))
+
+		recent := writeUploadFile(t, dir, "app_2020-01-01_00-01-00.log")   // Within the grace period
+		other := writeOrphanFile(t, dir, "notes.txt")                      // Not a rotated file
+		open := writeOrphanFile(t, dir, "app_2020-01-01_00-02-00.log")     // Still being written
+		inFlight := writeOrphanFile(t, dir, "app_2020-01-01_00-03-00.log") // Queued by a logger
+		empty := filepath.Join(dir, "app_2020-01-01_00-04-00.log")         // Never written
+		require.NoError(t, os.WriteFile(empty, nil, 0644))
+		require.NoError(t, os.Chtimes(empty, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour)))
+
+		store := newFakeStore(0)
+		uploader := newFakeUploader(t, GCSUploadConfig{DeleteAfterUpload: true}, store)
+		tracker := uploader.GetUploadTracker()
+		tracker.opened(open)
+		tracker.queued(inFlight)
+		uploader.GetUploadChannel() <- inFlight
+
+		uploader.Start()
+
+		// Concurrent scans must not queue a file twice
+		var wg sync.WaitGroup
+		counts := make([]int, 3)
+		for i := range counts {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				n, err := uploader.ScanAndEnqueue(dir, "")
+				assert.NoError(t, err)
+				counts[i] = n
+			}(i)
+		}
+		wg.Wait()
+		uploader.Stop()
+
+		assert.Equal(t, len(orphans), counts[0]+counts[1]+counts[2])
+		for _, path := range append(orphans, inFlight) {
+			assert.Equal(t, 1, store.attempts[path], path)
+			assert.NoFileExists(t, path)
+		}
+		for _, path := range []string{recent, other, open, empty} {
+			assert.Zero(t, store.attempts[path], path)
+			assert.FileExists(t, path)
+		}
+		stats := uploader.GetStats()
+		assert.Equal(t, int64(len(orphans)), stats.RecoveredFiles)
+		assert.Equal(t, int64(len(orphans)+1), stats.Successful)
+	})
+
+	t.Run("SkipsLoggerFiles", func(t *testing.T) {
+		dir := t.TempDir()
+		store := newFakeStore(0)
+		uploader := newFakeUploader(t, GCSUploadConfig{}, store)
+
+		config := DefaultConfig(filepath.Join(dir, "app.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 2
+		config.PreallocateFileSize = 1024 * 1024
+		config.UploadTracker = uploader.GetUploadTracker()
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		fw := logger.groups[0].fileWriter.(*SizeFileWriter)
+		fw.rotationMu.Lock()
+		require.NoError(t, fw.createNextFile())
+		fw.rotationMu.Unlock()
+
+		// The current and preallocated next file look like idle orphans, but the logger has them open
+		old := time.Now().Add(-time.Hour)
+		for _, path := range []string{fw.filePath, fw.nextFilePath} {
+			require.NoError(t, os.Chtimes(path, old, old))
+		}
+
+		uploader.Start()
+		n, err := uploader.ScanAndEnqueue(dir, "")
+		require.NoError(t, err)
+		assert.Zero(t, n)
+		uploader.Stop()
+		require.NoError(t, logger.Close())
+	})
+
+	t.Run("FiltersByPattern", func(t *testing.T) {
+		dir := t.TempDir()
+		app := writeOrphanFile(t, dir, "app_2020-01-01_00-00-00.log")
+		other := writeOrphanFile(t, dir, "other_2020-01-01_00-00-00.log")
+
+		store := newFakeStore(0)
+		uploader := newFakeUploader(t, GCSUploadConfig{}, store)
+		uploader.Start()
+		n, err := uploader.ScanAndEnqueue(dir, "app_*")
+		require.NoError(t, err)
+		uploader.Stop()
+
+		assert.Equal(t, 1, n)
+		assert.Equal(t, 1, store.attempts[app])
+		assert.FileExists(t, other)
+
+		_, err = uploader.ScanAndEnqueue(dir, "[")
+		assert.Error(t, err)
+	})
+
+	t.Run("RecoveryDirsOnStart", func(t *testing.T) {
+		dirs := []string{t.TempDir(), t.TempDir()}
+		var orphans []string
+		for _, dir := range dirs {
+			orphans = append(orphans, writeOrphanFile(t, dir, "app_2020-01-01_00-00-00.log"))
+		}
+
+		store := newFakeStore(0)
+		uploader := newFakeUploader(t, GCSUploadConfig{RecoveryDirs: dirs}, store)
+		uploader.Start()
+		require.Eventually(t, func() bool {
+			return uploader.GetStats().Successful == 2
+		}, time.Second, 5*time.Millisecond)
+		uploader.Stop()
+
+		for _, path := range orphans {
+			assert.Equal(t, 1, store.attempts[path])
+		}
+		_, err := uploader.ScanAndEnqueue(dirs[0], "")
+		assert.ErrorIs(t, err, errUploaderStopped)
+	})
+
+	t.Run("SkipsFilesAlreadyInGCS", func(t *testing.T) {
+		dir := t.TempDir()
+		uploaded := writeOrphanFile(t, dir, "app_2020-01-01_00-00-00.log")
+		partial := writeOrphanFile(t, dir, "app_2020-01-01_00-00-01.log")
+		missing := writeOrphanFile(t, dir, "app_2020-01-01_00-00-02.log")
+
+		store := newFakeStore(0)
+		store.objects["logs/"+filepath.Base(uploaded)] = ObjectInfo{Size: int64(len("log data"))}
+		store.objects["logs/"+filepath.Base(partial)] = ObjectInfo{Size: 3} // Interrupted upload
+		uploader := newFakeUploader(t, GCSUploadConfig{ObjectPrefix: "logs/", RecoveryCheckExisting: true, DeleteAfterUpload: true}, store)
+
+		uploader.Start()
+		n, err := uploader.ScanAndEnqueue(dir, "")
+		require.NoError(t, err)
+		uploader.Stop()
+
+		assert.Equal(t, 2, n)
+		assert.Zero(t, store.attempts[uploaded])
+		assert.NoFileExists(t, uploaded, "already uploaded, so deleted locally")
+		assert.Equal(t, 1, store.attempts[partial])
+		assert.Equal(t, 1, store.attempts[missing])
+	})
+}
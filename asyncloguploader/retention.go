@@ -0,0 +1,402 @@
+package asyncloguploader
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UploadTracker records files sent to an UploadChannel until the Uploader reports them uploaded
+// Retention (Config.MaxRotatedFiles, Config.MaxTotalLogBytes) never deletes a pending file.
+// Files whose upload failed after all retries stay pending, so they are kept on disk, unless they
+// were moved to GCSUploadConfig.DeadLetterDir.
+// It also carries each queued file's event (Config.EventName) to the Uploader, for
+// GCSUploadConfig.ObjectNameTemplate
+type UploadTracker struct {
+	mu      sync.Mutex
+	pending map[string]string   // Event of each pending file ("" if unknown)
+	open    map[string]struct{} // Files loggers are writing; recovery scans skip them
+
+	// Woken (non-blocking) whenever a file finishes uploading or an Uploader detaches
+	listeners map[chan struct{}]struct{}
+
+	// Uploaders whose upload worker is running (Uploader.Start until Stop); Close waits for
+	// uploads only while one is attached
+	uploaders int
+
+	// Outcome of the Uploader's upload attempts, for UploadStatus
+	lastErr       error
+	lastErrAt     time.Time
+	lastSuccessAt time.Time
+}
+
+// UploadStatus is the upload progress an UploadTracker reports to the loggers using it (see Logger.Health)
+type UploadStatus struct {
+	PendingFiles  int       // Files queued for upload and not yet uploaded
+	LastError     error     // Error of the most recent failed upload attempt (nil if none failed)
+	LastErrorAt   time.Time // When LastError occurred
+	LastSuccessAt time.Time // When the most recent upload succeeded
+}
+
+// Failing reports whether the most recent upload attempt failed
+func (s UploadStatus) Failing() bool {
+	return s.LastError != nil && s.LastErrorAt.After(s.LastSuccessAt)
+}
+
+// NewUploadTracker creates an empty upload tracker
+func NewUploadTracker() *UploadTracker {
+	return &UploadTracker{
+		pending:   make(map[string]string),
+		open:      make(map[string]struct{}),
+		listeners: make(map[chan struct{}]struct{}),
+	}
+}
+
+// PendingFiles returns the number of files queued for upload and not yet uploaded
+func (t *UploadTracker) PendingFiles() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.pending)
+}
+
+// Status returns the pending files and the outcome of the most recent upload attempts
+func (t *UploadTracker) Status() UploadStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return UploadStatus{
+		PendingFiles:  len(t.pending),
+		LastError:     t.lastErr,
+		LastErrorAt:   t.lastErrAt,
+		LastSuccessAt: t.lastSuccessAt,
+	}
+}
+
+// attempted records the outcome of one upload attempt (err is nil on success)
+func (t *UploadTracker) attempted(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		t.lastErr, t.lastErrAt = err, time.Now()
+	} else {
+		t.lastSuccessAt = time.Now()
+	}
+}
+
+// pendingMatching returns the pending files for which match returns true
+func (t *UploadTracker) pendingMatching(match func(path string) bool) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var paths []string
+	for path := range t.pending {
+		if match(path) {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// queued marks path as waiting for upload
+// Called before the path is sent to the upload channel, so the upload cannot finish first
+func (t *UploadTracker) queued(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.pending[path]; !ok {
+		t.pending[path] = ""
+	}
+}
+
+// queuedEvent marks path as waiting for upload and records the event it belongs to
+func (t *UploadTracker) queuedEvent(path, event string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending[path] = event
+}
+
+// eventOf returns the event recorded for a pending path, or "" if unknown
+func (t *UploadTracker) eventOf(path string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.pending[path]
+}
+
+// done clears path and wakes the listeners: it may now be deleted
+// Also used when a path could not be queued (upload channel full)
+func (t *UploadTracker) done(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.pending, path)
+	for wake := range t.listeners {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// attach records an Uploader starting to upload the files queued with this tracker
+func (t *UploadTracker) attach() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.uploaders++
+}
+
+// detach clears an attach and wakes the listeners: pending files may never be uploaded now
+func (t *UploadTracker) detach() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.uploaders--
+	for wake := range t.listeners {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// attached reports whether an Uploader is uploading the files queued with this tracker
+func (t *UploadTracker) attached() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.uploaders > 0
+}
+
+// isPending reports whether path is waiting for upload
+func (t *UploadTracker) isPending(path string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.pending[path]
+	return ok
+}
+
+// opened marks path as written by a logger
+func (t *UploadTracker) opened(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.open[path] = struct{}{}
+}
+
+// closed clears a path marked with opened
+func (t *UploadTracker) closed(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.open, path)
+}
+
+// claim marks path as queued for upload unless it is already queued or still open
+// Returns false if the path must be skipped
+func (t *UploadTracker) claim(path string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.pending[path]; ok {
+		return false
+	}
+	if _, ok := t.open[path]; ok {
+		return false
+	}
+	t.pending[path] = ""
+	return true
+}
+
+// subscribe registers wake to be signalled after every completed upload
+func (t *UploadTracker) subscribe(wake chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.listeners[wake] = struct{}{}
+}
+
+// unsubscribe removes a channel registered with subscribe
+func (t *UploadTracker) unsubscribe(wake chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.listeners, wake)
+}
+
+// rotatedFileName matches the suffix of rotated files after the base name:
+// _YYYY-MM-DD_HH-MM-SS-mmm_N.log for the Nth file of that millisecond (see rotatedNames), or
+// _YYYY-MM-DD_HH-MM-SS[_N].log from earlier versions, optionally followed by a compression
+// extension (.log.gz)
+var rotatedFileName = regexp.MustCompile(`^_(\d{4}-\d{2}-\d{2}_\d{2}-\d{2}-\d{2}(?:-\d{3})?)(?:_(\d+))?\.log(?:\.\w+)?$`)
+
+// isRotatedFileOf reports whether path is a rotated file of w's series
+func isRotatedFileOf(w *SizeFileWriter, path string) bool {
+	dir, name := filepath.Split(path)
+	return filepath.Clean(dir) == w.baseDir && strings.HasPrefix(name, w.baseFileName) &&
+		rotatedFileName.MatchString(name[len(w.baseFileName):])
+}
+
+// retentionJanitor deletes the oldest rotated files of a logger's file series until
+// MaxRotatedFiles and MaxTotalLogBytes hold
+// It runs in the background, woken after each rotation and each completed upload
+type retentionJanitor struct {
+	maxFiles int
+	maxBytes int64
+	writers  []*SizeFileWriter // One file series per flush worker
+	tracker  *UploadTracker    // nil when uploads are not tracked
+	compress *compressionStage // nil without Compression
+	stats    *Statistics
+	logger   InternalLogger
+
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// rotatedFile is a rotated file found on disk
+type rotatedFile struct {
+	path      string
+	timestamp string // For ordering across series
+	seq       int    // Files rotated within the same timestamp, in order
+	size      int64
+}
+
+// newRetentionJanitor creates a janitor for the writers' file series
+func newRetentionJanitor(config Config, writers []*SizeFileWriter, compress *compressionStage, stats *Statistics) *retentionJanitor {
+	return &retentionJanitor{
+		maxFiles: config.MaxRotatedFiles,
+		maxBytes: config.MaxTotalLogBytes,
+		writers:  writers,
+		tracker:  config.UploadTracker,
+		compress: compress,
+		stats:    stats,
+		logger:   config.InternalLogger,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// start enforces retention once synchronously (removing leftovers from earlier runs), then keeps
+// enforcing it in the background
+func (j *retentionJanitor) start() {
+	for _, w := range j.writers {
+		w.setRotationHook(j.notify)
+	}
+	if j.tracker != nil {
+		j.tracker.subscribe(j.wake)
+	}
+	j.enforce()
+	go j.run()
+}
+
+// run enforces retention whenever woken, until stopped
+func (j *retentionJanitor) run() {
+	defer close(j.stopped)
+	for {
+		select {
+		case <-j.wake:
+			j.enforce()
+		case <-j.done:
+			return
+		}
+	}
+}
+
+// notify wakes the janitor without blocking (called by the writers after each rotation)
+func (j *retentionJanitor) notify() {
+	select {
+	case j.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stop terminates the background goroutine and waits for an in-progress pass
+func (j *retentionJanitor) stop() {
+	if j.tracker != nil {
+		j.tracker.unsubscribe(j.wake)
+	}
+	close(j.done)
+	<-j.stopped
+}
+
+// enforce deletes the oldest rotated files until both limits hold
+// Open files are never counted or deleted. An expired file still waiting for compression or upload
+// is kept until a later pass; newer files are not deleted in its place
+func (j *retentionJanitor) enforce() {
+	files := j.rotatedFiles()
+
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	count := len(files)
+
+	deferred := 0
+	for _, f := range files {
+		if !j.overLimit(count, total) {
+			break
+		}
+		count--
+		total -= f.size
+		if (j.tracker != nil && j.tracker.isPending(f.path)) || (j.compress != nil && j.compress.isActive(f.path)) {
+			deferred++
+			continue
+		}
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			j.logger.Printf("[WARNING] Retention: failed to delete %s: %v", f.path, err)
+			continue
+		}
+		j.stats.RetentionFilesDeleted.Add(1)
+		j.stats.RetentionBytesReclaimed.Add(f.size)
+	}
+
+	if deferred > 0 {
+		j.logger.Printf("[WARNING] Retention: kept %d expired rotated files until their compression or upload completes", deferred)
+	}
+}
+
+// overLimit reports whether count files of total bytes exceed either limit
+func (j *retentionJanitor) overLimit(count int, total int64) bool {
+	return (j.maxFiles > 0 && count > j.maxFiles) || (j.maxBytes > 0 && total > j.maxBytes)
+}
+
+// rotatedFiles lists the closed rotated files of every series, oldest first
+func (j *retentionJanitor) rotatedFiles() []rotatedFile {
+	var files []rotatedFile
+	for _, w := range j.writers {
+		entries, err := os.ReadDir(w.baseDir)
+		if err != nil {
+			j.logger.Printf("[WARNING] Retention: failed to list %s: %v", w.baseDir, err)
+			continue
+		}
+
+		// Listed before the open files are read: a file rotated in between is already closed
+		open := w.openFiles()
+		prefix := w.baseFileName
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			match := rotatedFileName.FindStringSubmatch(name[len(prefix):])
+			if match == nil {
+				continue
+			}
+			path := filepath.Join(w.baseDir, name)
+			if _, isOpen := open[path]; isOpen {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue // Deleted meanwhile
+			}
+			seq, _ := strconv.Atoi(match[2]) // 0 without a suffix
+			files = append(files, rotatedFile{path: path, timestamp: match[1], seq: seq, size: info.Size()})
+		}
+	}
+
+	sort.Slice(files, func(a, b int) bool {
+		if files[a].timestamp != files[b].timestamp {
+			return files[a].timestamp < files[b].timestamp
+		}
+		if files[a].seq != files[b].seq {
+			return files[a].seq < files[b].seq
+		}
+		return files[a].path < files[b].path
+	})
+	return files
+}
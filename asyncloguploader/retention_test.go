@@ -0,0 +1,205 @@
+package asyncloguploader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeRotatedFiles creates n rotated files of the given size for baseName in dir, one second
+// apart starting at 2020-01-01, and returns their paths oldest first
+func writeRotatedFiles(t *testing.T, dir, baseName string, n, size int) []string {
+	t.Helper()
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	paths := make([]string, n)
+	for i := range paths {
+		timestamp := rotatedTimestamp(start.Add(time.Duration(i) * time.Second))
+		paths[i] = filepath.Join(dir, fmt.Sprintf("%s_%s_0.log", baseName, timestamp))
+		require.NoError(t, os.WriteFile(paths[i], make([]byte, size), 0644))
+	}
+	return paths
+}
+
+// remainingFiles returns the base names of the files in dir, sorted
+func remainingFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".lock") {
+			continue // Series lock files (see Config.DisableFileLock)
+		}
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestLogger_Retention(t *testing.T) {
+	t.Run("ValidatesConfig", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		config.MaxRotatedFiles = -1
+		assert.Error(t, config.Validate())
+
+		config = DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		config.MaxTotalLogBytes = -1
+		assert.Error(t, config.Validate())
+	})
+
+	t.Run("CapsRotatedFileCount", func(t *testing.T) {
+		dir := t.TempDir()
+		old := writeRotatedFiles(t, dir, "app", 20, 1000)
+		other := writeRotatedFiles(t, dir, "other", 2, 1000) // Another series in the same directory
+
+		config := DefaultConfig(filepath.Join(dir, "app.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 2
+		config.MaxRotatedFiles = 5
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		current := logger.groups[0].fileWriter.(*SizeFileWriter).filePath
+
+		// The 15 oldest are deleted on start; the newest 5, the open file and the other series remain
+		for _, path := range old[:15] {
+			assert.NoFileExists(t, path)
+		}
+		for _, path := range append(old[15:], other...) {
+			assert.FileExists(t, path)
+		}
+		assert.FileExists(t, current)
+
+		stats := logger.Snapshot().Stats
+		assert.Equal(t, int64(15), stats.RetentionFilesDeleted)
+		assert.Equal(t, int64(15*1000), stats.RetentionBytesReclaimed)
+		require.NoError(t, logger.Close())
+	})
+
+	t.Run("CapsTotalBytesAcrossSegments", func(t *testing.T) {
+		dir := t.TempDir()
+		main := writeRotatedFiles(t, dir, "app", 4, 1000)
+		segment := writeRotatedFiles(t, dir, "app_w1", 4, 1000)
+
+		config := DefaultConfig(filepath.Join(dir, "app.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 2
+		config.FlushConcurrency = 2
+		config.MaxTotalLogBytes = 3500
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+
+		// Eight files of 1000 bytes, oldest first by timestamp across both series: keep 3
+		for i := 0; i < 4; i++ {
+			if i < 2 {
+				assert.NoFileExists(t, main[i])
+				assert.NoFileExists(t, segment[i])
+			}
+		}
+		var kept int
+		for _, path := range append(main, segment...) {
+			if _, err := os.Stat(path); err == nil {
+				kept++
+			}
+		}
+		assert.Equal(t, 3, kept)
+		assert.Equal(t, int64(5000), logger.Snapshot().Stats.RetentionBytesReclaimed)
+		require.NoError(t, logger.Close())
+	})
+
+	t.Run("KeepsFilesPendingUpload", func(t *testing.T) {
+		dir := t.TempDir()
+		old := writeRotatedFiles(t, dir, "app", 6, 1000)
+		tracker := NewUploadTracker()
+		tracker.queued(old[0])
+		tracker.queued(old[1])
+
+		config := DefaultConfig(filepath.Join(dir, "app.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 2
+		config.MaxRotatedFiles = 2
+		config.UploadTracker = tracker
+		config.InternalLogger = &captureLogger{}
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		defer logger.Close()
+
+		// The two oldest wait for upload; the other expired files go, and the newest two stay
+		assert.FileExists(t, old[0])
+		assert.FileExists(t, old[1])
+		assert.NoFileExists(t, old[2])
+		assert.NoFileExists(t, old[3])
+		assert.FileExists(t, old[4])
+		assert.FileExists(t, old[5])
+		assert.Equal(t, int64(2), logger.Snapshot().Stats.RetentionFilesDeleted)
+
+		// Once uploaded, the janitor is woken and deletes them
+		tracker.done(old[0])
+		tracker.done(old[1])
+		require.Eventually(t, func() bool {
+			_, err0 := os.Stat(old[0])
+			_, err1 := os.Stat(old[1])
+			return os.IsNotExist(err0) && os.IsNotExist(err1)
+		}, time.Second, 5*time.Millisecond)
+		assert.Equal(t, 0, tracker.PendingFiles())
+		assert.Equal(t, int64(4), logger.Snapshot().Stats.RetentionFilesDeleted)
+	})
+
+	t.Run("EnforcedAfterEachRotation", func(t *testing.T) {
+		dir := t.TempDir()
+		uploads := make(chan string, 100)
+		tracker := NewUploadTracker()
+
+		config := DefaultConfig(filepath.Join(dir, "app.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 2
+		config.MaxFileSize = 1024 * 1024
+		config.MaxRotatedFiles = 2
+		config.UploadChannel = uploads
+		config.UploadTracker = tracker
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		fw := logger.groups[0].fileWriter.(*SizeFileWriter)
+
+		// Simulate many rotations, all within the same second
+		var rotated []string
+		for i := 0; i < 6; i++ {
+			fw.rotationMu.Lock()
+			require.NoError(t, fw.createNextFile())
+			require.NoError(t, fw.swapFiles())
+			fw.rotationMu.Unlock()
+			rotated = append(rotated, <-uploads)
+		}
+		assert.Len(t, remainingFiles(t, dir), 7, "same-second rotations must not reuse a name")
+
+		// Nothing is deleted while every rotated file waits for upload
+		time.Sleep(20 * time.Millisecond)
+		assert.Equal(t, int64(0), logger.Snapshot().Stats.RetentionFilesDeleted)
+
+		for _, path := range rotated {
+			tracker.done(path)
+		}
+		require.Eventually(t, func() bool {
+			return logger.Snapshot().Stats.RetentionFilesDeleted == 4
+		}, time.Second, 5*time.Millisecond)
+
+		// The newest two rotated files and the open file remain
+		for _, path := range rotated[:4] {
+			assert.NoFileExists(t, path)
+		}
+		for _, path := range append(rotated[4:], fw.filePath) {
+			assert.FileExists(t, path)
+		}
+		require.NoError(t, logger.Close())
+	})
+}
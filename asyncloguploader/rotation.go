@@ -0,0 +1,77 @@
+package asyncloguploader
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultRotationHistory is how many completed files Logger.RotatedFiles keeps when
+// Config.RotationHistory is 0
+const DefaultRotationHistory = 16
+
+// RotationInfo describes a completed file, as passed to Config.RotationCallback
+// Paths and Bytes are those of the raw file, before Compression. Entries are not counted: that
+// would mean scanning every flushed shard
+type RotationInfo struct {
+	Event     string          // Config.EventName of the logger (set by LoggerManager); empty if unset
+	OldPath   string          // The completed file
+	NewPath   string          // The file writing continues in (empty for FileClosed)
+	Bytes     int64           // Size of OldPath, including its file header
+	Reason    FileReadyReason // FileRotated (MaxFileSize) or FileClosed (Close)
+	RotatedAt time.Time
+}
+
+// rotationHistory is a bounded ring of the most recent completed files
+type rotationHistory struct {
+	mu    sync.Mutex
+	infos []RotationInfo
+	next  int // Index the next file is stored at once infos is full
+}
+
+// newRotationHistory creates a ring of size entries (DefaultRotationHistory if size <= 0)
+func newRotationHistory(size int) *rotationHistory {
+	if size <= 0 {
+		size = DefaultRotationHistory
+	}
+	return &rotationHistory{infos: make([]RotationInfo, 0, size)}
+}
+
+// add records info, replacing the oldest file once the ring is full
+func (h *rotationHistory) add(info RotationInfo) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.infos) < cap(h.infos) {
+		h.infos = append(h.infos, info)
+		return
+	}
+	h.infos[h.next] = info
+	h.next = (h.next + 1) % len(h.infos)
+}
+
+// list returns the recorded files, oldest first
+func (h *rotationHistory) list() []RotationInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	list := make([]RotationInfo, 0, len(h.infos))
+	list = append(list, h.infos[h.next:]...)
+	return append(list, h.infos[:h.next]...)
+}
+
+// recordRotation adds info to the writer's history and runs Config.RotationCallback
+func (fw *SizeFileWriter) recordRotation(info RotationInfo) {
+	if fw.rotations != nil {
+		fw.rotations.add(info)
+	}
+	if fw.onRotate != nil {
+		fw.onRotate(info)
+	}
+}
+
+// RotatedFiles returns the last Config.RotationHistory files the logger completed, oldest first
+// With FlushConcurrency, the files of all segments are listed together in completion order
+func (l *Logger) RotatedFiles() []RotationInfo {
+	if l.rotations == nil {
+		return nil
+	}
+	return l.rotations.list()
+}
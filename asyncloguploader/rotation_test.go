@@ -0,0 +1,147 @@
+package asyncloguploader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger_RotationCallback(t *testing.T) {
+	uploads := make(chan string, 10)
+
+	var mu sync.Mutex
+	var infos []RotationInfo
+	var queuedBefore []int // Files already on the upload channel when each callback ran
+
+	config := DefaultConfig(filepath.Join(t.TempDir(), "rotate.log"))
+	config.BufferSize = 1024 * 1024
+	config.NumShards = 2
+	config.MaxFileSize = 512 * 1024 // A flush writes the file header and a whole 512KB shard, so every later flush rotates
+	config.UploadChannel = uploads
+	config.RotationCallback = func(info RotationInfo) {
+		mu.Lock()
+		defer mu.Unlock()
+		infos = append(infos, info)
+		queuedBefore = append(queuedBefore, len(uploads))
+	}
+
+	logger, err := NewLogger(config)
+	require.NoError(t, err)
+
+	for _, msg := range []string{"first file", "second file", "third file"} {
+		logger.Log(msg)
+		require.NoError(t, logger.Flush(context.Background()))
+	}
+	require.NoError(t, logger.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, infos, 3)
+	assert.Equal(t, []FileReadyReason{FileRotated, FileRotated, FileClosed},
+		[]FileReadyReason{infos[0].Reason, infos[1].Reason, infos[2].Reason})
+	assert.Equal(t, []int{0, 1, 2}, queuedBefore, "the callback runs before the upload channel send")
+
+	assert.Equal(t, infos[0].NewPath, infos[1].OldPath)
+	assert.Equal(t, infos[1].NewPath, infos[2].OldPath)
+	assert.Empty(t, infos[2].NewPath)
+	for _, info := range infos {
+		stat, err := os.Stat(info.OldPath)
+		require.NoError(t, err)
+		assert.Equal(t, stat.Size(), info.Bytes)
+		assert.Equal(t, info.OldPath, <-uploads)
+	}
+
+	assert.Equal(t, infos, logger.RotatedFiles())
+}
+
+func TestLogger_RotatedFilesHistory(t *testing.T) {
+	t.Run("KeepsMostRecent", func(t *testing.T) {
+		h := newRotationHistory(3)
+		assert.Empty(t, h.list())
+
+		for _, path := range []string{"a", "b", "c", "d", "e"} {
+			h.add(RotationInfo{OldPath: path})
+		}
+
+		var paths []string
+		for _, info := range h.list() {
+			paths = append(paths, info.OldPath)
+		}
+		assert.Equal(t, []string{"c", "d", "e"}, paths)
+	})
+
+	t.Run("RejectsNegativeHistory", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		config.RotationHistory = -1
+		assert.Error(t, config.Validate())
+	})
+}
+
+func TestLogger_Reopen(t *testing.T) {
+	uploads := make(chan string, 10)
+	logger, tmpDir := newSizeTestLogger(t, "reopen", func(c *Config) {
+		c.PreallocateFileSize = 4 * 1024 * 1024
+		c.UploadChannel = uploads
+	})
+	path := findLogFile(t, tmpDir, "reopen")
+	require.NoError(t, logger.Reopen(), "the path still names the current file")
+
+	// Log in the background until the file has been renamed and reopened
+	var wg sync.WaitGroup
+	var logged [][]byte
+	started, stop := make(chan struct{}), make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if i == 1000 {
+				close(started)
+			}
+			msg := []byte(fmt.Sprintf("entry %06d", i))
+			if assert.NoError(t, logger.TryLogBytes(msg)) {
+				logged = append(logged, msg)
+			}
+			if i >= 1000 {
+				time.Sleep(10 * time.Microsecond)
+			}
+		}
+	}()
+
+	<-started
+	require.NoError(t, logger.Flush(context.Background()))
+	renamed := path + ".1"
+	require.NoError(t, os.Rename(path, renamed))
+	require.NoError(t, logger.Reopen())
+	time.Sleep(20 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+	require.NoError(t, logger.Close())
+
+	// Every entry is in exactly one of the files, and only the recreated file is uploaded
+	before, _ := readAllMessages(t, renamed)
+	after, _ := readAllMessages(t, path)
+	assert.NotEmpty(t, before)
+	assert.NotEmpty(t, after)
+	onDisk := append(append([][]byte{}, before...), after...)
+	assert.ElementsMatch(t, logged, onDisk)
+	require.Len(t, uploads, 1)
+	assert.Equal(t, path, <-uploads)
+
+	stat, err := os.Stat(renamed)
+	require.NoError(t, err)
+	assert.Less(t, stat.Size(), int64(4*1024*1024), "the renamed file is truncated to its data")
+
+	assert.ErrorIs(t, logger.Reopen(), ErrClosed)
+}
@@ -0,0 +1,151 @@
+package asyncloguploader
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger_SealOnSwap(t *testing.T) {
+	t.Run("FlushesPresealedBuffers", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "sealed.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 2
+		config.EnableChecksums = true
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+
+		msg := make([]byte, 100)
+		for i := 0; i < 20000; i++ {
+			logger.LogBytes(msg)
+		}
+		path := logger.groups[0].fileWriter.(*SizeFileWriter).filePath
+		require.NoError(t, logger.Close())
+
+		stats := logger.Snapshot().Stats
+		assert.Greater(t, stats.PresealedBuffers, int64(0))
+		assert.Equal(t, logger.stats.EntriesFlushed.Load(), countMessages(t, path))
+	})
+
+	// Run with -race: writers swap and seal while flush workers, explicit flushes and adaptive
+	// early flushes take, write and reset the same buffers
+	t.Run("ConcurrentSwapSealFlushReset", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "race.log"))
+		config.BufferSize = 512 * 1024
+		config.NumShards = 4
+		config.FlushConcurrency = 2
+		config.FlushInterval = 5 * time.Millisecond
+		config.AdaptiveFlush = true
+		config.EnableChecksums = true
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		paths := make([]string, len(logger.groups))
+		for i, g := range logger.groups {
+			paths[i] = g.fileWriter.(*SizeFileWriter).filePath
+		}
+
+		var wg sync.WaitGroup
+		for w := 0; w < 4; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				var msg [8]byte
+				for i := 0; i < 10000; i++ {
+					binary.LittleEndian.PutUint64(msg[:], uint64(w)<<32|uint64(i))
+					logger.LogBytes(msg[:])
+				}
+			}(w)
+		}
+		stop := make(chan struct{})
+		flushed := make(chan struct{})
+		go func() {
+			defer close(flushed)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					_ = logger.Flush(context.Background())
+				}
+			}
+		}()
+		wg.Wait()
+		close(stop)
+		<-flushed
+		require.NoError(t, logger.Close())
+
+		stats := logger.Snapshot().Stats
+		var total int64
+		for _, path := range paths {
+			total += countMessages(t, path)
+		}
+		assert.Equal(t, logger.stats.EntriesFlushed.Load(), total)
+		assert.Equal(t, stats.TotalLogs-stats.DroppedLogs, total)
+	})
+}
+
+// countMessages counts the messages of a log file, failing on corrupt shards or bad checksums
+func countMessages(t *testing.T, path string) int64 {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var n int64
+	reader := NewReader(f)
+	for {
+		_, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return n
+		}
+		require.NoError(t, err)
+		n++
+	}
+}
+
+// BenchmarkSealOnSwap compares sealing swapped buffers on the writer (the default) with sealing
+// them on the flush worker. With checksums on, sealing a 4MB shard costs a CRC32C pass that the
+// flush worker no longer pays before its write
+func BenchmarkSealOnSwap(b *testing.B) {
+	for _, sealOnSwap := range []bool{false, true} {
+		b.Run(fmt.Sprintf("sealOnSwap=%t", sealOnSwap), func(b *testing.B) {
+			config := DefaultConfig(filepath.Join(b.TempDir(), "bench.log"))
+			config.BufferSize = 64 * 1024 * 1024
+			config.NumShards = 16
+			config.EnableChecksums = true
+
+			logger, err := NewLogger(config)
+			require.NoError(b, err)
+			for _, shard := range logger.shardCollection.Load().Shards() {
+				shard.sealOnSwap = sealOnSwap
+			}
+
+			msg := make([]byte, 256)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					logger.LogBytes(msg)
+				}
+			})
+			b.StopTimer()
+			require.NoError(b, logger.Close())
+
+			stats := logger.Snapshot().Stats
+			b.ReportMetric(float64(stats.MaxFlushDuration)/float64(time.Millisecond), "max-flush-ms")
+			b.ReportMetric(float64(stats.BlockedSwaps), "blocked-swaps")
+			b.ReportMetric(float64(stats.DroppedLogs)/float64(stats.TotalLogs)*100, "drop%")
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package asyncloguploader
+
+import (
+	"encoding/json"
+	"runtime"
+	"time"
+)
+
+// SelfMetricsEvent is the reserved event that Config.SelfMetricsInterval writes to
+// Its logger bypasses the event guardrails and MaxEventLoggers, is never evicted, and is left out
+// of the manager's aggregated statistics and Snapshot so it does not count its own writes
+const SelfMetricsEvent = "__logger_metrics"
+
+// SelfMetricsRecord is one entry of the SelfMetricsEvent stream, encoded as a JSON line
+// Counters are lifetime totals of Event's logger, taken from one Snapshot
+type SelfMetricsRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	Event     string    `json:"event"`
+
+	TotalLogs     int64 `json:"total_logs"`
+	DroppedLogs   int64 `json:"dropped_logs"`
+	BytesWritten  int64 `json:"bytes_written"`
+	BytesFlushed  int64 `json:"bytes_flushed"`
+	BytesBuffered int64 `json:"bytes_buffered"`
+	BytesDurable  int64 `json:"bytes_durable"`
+	Flushes       int64 `json:"flushes"`
+	FlushErrors   int64 `json:"flush_errors"`
+
+	AvgFlushMs   float64 `json:"avg_flush_ms"`
+	MaxFlushMs   float64 `json:"max_flush_ms"`
+	AvgWriteMs   float64 `json:"avg_write_ms"`
+	MaxWriteMs   float64 `json:"max_write_ms"`
+	AvgPwritevMs float64 `json:"avg_pwritev_ms"`
+	MaxPwritevMs float64 `json:"max_pwritev_ms"`
+
+	ShardUtilizationPct []float64 `json:"shard_utilization_pct"`
+
+	// Process memory (runtime.MemStats), the same in every record of one interval
+	HeapAllocBytes uint64  `json:"heap_alloc_bytes"`
+	NumGC          uint32  `json:"num_gc"`
+	GCPauseTotalMs float64 `json:"gc_pause_total_ms"`
+}
+
+// newSelfMetricsRecord builds the record of one event logger
+func newSelfMetricsRecord(eventName string, snap Snapshot, mem *runtime.MemStats) SelfMetricsRecord {
+	record := SelfMetricsRecord{
+		Timestamp:      snap.Timestamp,
+		Event:          eventName,
+		TotalLogs:      snap.Stats.TotalLogs,
+		DroppedLogs:    snap.Stats.DroppedLogs,
+		BytesWritten:   snap.Stats.BytesWritten,
+		BytesFlushed:   snap.Stats.BytesFlushed,
+		BytesBuffered:  snap.Stats.BytesBuffered,
+		BytesDurable:   snap.Stats.BytesDurable,
+		Flushes:        snap.Stats.Flushes,
+		FlushErrors:    snap.Stats.FlushErrors,
+		AvgFlushMs:     durationMs(snap.FlushMetrics.AvgFlushDuration),
+		MaxFlushMs:     durationMs(snap.FlushMetrics.MaxFlushDuration),
+		AvgWriteMs:     durationMs(snap.FlushMetrics.AvgWriteDuration),
+		MaxWriteMs:     durationMs(snap.FlushMetrics.MaxWriteDuration),
+		AvgPwritevMs:   durationMs(snap.FlushMetrics.AvgPwritevDuration),
+		MaxPwritevMs:   durationMs(snap.FlushMetrics.MaxPwritevDuration),
+		HeapAllocBytes: mem.HeapAlloc,
+		NumGC:          mem.NumGC,
+		GCPauseTotalMs: float64(mem.PauseTotalNs) / 1e6,
+	}
+	record.ShardUtilizationPct = make([]float64, len(snap.Shards))
+	for i, shard := range snap.Shards {
+		record.ShardUtilizationPct[i] = shard.UtilizationPct
+	}
+	return record
+}
+
+// durationMs converts d to fractional milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// isSelfMetricsEvent reports whether eventName is the reserved self-metrics event
+// Without SelfMetricsInterval the name is an ordinary event
+func (lm *LoggerManager) isSelfMetricsEvent(eventName string) bool {
+	return lm.config.SelfMetricsInterval > 0 && eventName == SelfMetricsEvent
+}
+
+// rangeUserLoggers calls fn for every event logger except the self-metrics logger
+func (lm *LoggerManager) rangeUserLoggers(fn func(eventName string, logger *Logger) bool) {
+	lm.loggers.Range(func(key, value interface{}) bool {
+		eventName := key.(string)
+		if lm.isSelfMetricsEvent(eventName) {
+			return true
+		}
+		return fn(eventName, value.(*Logger))
+	})
+}
+
+// runSelfMetrics writes every event logger's record each SelfMetricsInterval until stopped,
+// then once more so the stream ends with the final counters
+func (lm *LoggerManager) runSelfMetrics() {
+	defer close(lm.selfMetricsDone)
+
+	ticker := time.NewTicker(lm.config.SelfMetricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			lm.writeSelfMetrics()
+		case <-lm.selfMetricsStop:
+			lm.writeSelfMetrics()
+			return
+		}
+	}
+}
+
+// writeSelfMetrics writes one record per event logger to SelfMetricsEvent
+func (lm *LoggerManager) writeSelfMetrics() {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	lm.rangeUserLoggers(func(eventName string, logger *Logger) bool {
+		line, err := json.Marshal(newSelfMetricsRecord(eventName, logger.Snapshot(), &mem))
+		if err != nil {
+			lm.config.InternalLogger.Printf("[WARNING] Failed to encode self metrics for event %s: %v", eventName, err)
+			return true
+		}
+		lm.LogBytesWithEvent(SelfMetricsEvent, line)
+		return true
+	})
+}
+
+// stopSelfMetrics stops the self-metrics writer after its final records (no-op when disabled)
+func (lm *LoggerManager) stopSelfMetrics() {
+	if lm.selfMetricsStop == nil {
+		return
+	}
+	lm.selfMetricsStopOnce.Do(func() { close(lm.selfMetricsStop) })
+	<-lm.selfMetricsDone
+}
@@ -0,0 +1,79 @@
+package asyncloguploader
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggerManager_SelfMetrics(t *testing.T) {
+	t.Run("RecordsDecodeFromTheMetricsStream", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.SelfMetricsInterval = time.Hour // Only the final records on Close
+		tmpDir := filepath.Dir(config.LogFilePath)
+
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		for i := 0; i < 10; i++ {
+			manager.LogWithEvent("payment", "paid")
+		}
+		manager.LogWithEvent("login", "logged in")
+		require.NoError(t, manager.Close())
+
+		messages, _ := readAllMessages(t, findLogFile(t, tmpDir, SelfMetricsEvent))
+		records := make(map[string]SelfMetricsRecord)
+		for _, msg := range messages {
+			var record SelfMetricsRecord
+			require.NoError(t, json.Unmarshal(msg, &record))
+			records[record.Event] = record
+		}
+		require.Len(t, records, 2, "one record per user event, none for the metrics event itself")
+
+		payment := records["payment"]
+		assert.Equal(t, int64(10), payment.TotalLogs)
+		assert.Zero(t, payment.DroppedLogs)
+		assert.Len(t, payment.ShardUtilizationPct, config.NumShards)
+		assert.NotZero(t, payment.HeapAllocBytes)
+		assert.False(t, payment.Timestamp.IsZero())
+		assert.Equal(t, int64(1), records["login"].TotalLogs)
+	})
+
+	t.Run("ExcludedFromGuardrailsAndAggregates", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.SelfMetricsInterval = 5 * time.Millisecond
+		config.AllowedEvents = []string{"payment"}
+		config.MaxEventLoggers = 1
+
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+
+		for i := 0; i < 3; i++ {
+			manager.LogWithEvent("payment", "paid")
+		}
+		require.Eventually(t, func() bool {
+			total, _, _, _, _, _, _, _, err := manager.GetEventStats(SelfMetricsEvent)
+			return err == nil && total >= 2
+		}, time.Second, 5*time.Millisecond)
+
+		totalLogs, droppedLogs, _, _, _, _, _, _ := manager.GetAggregatedStats()
+		assert.Equal(t, int64(3), totalLogs)
+		assert.Zero(t, droppedLogs)
+		snap := manager.Snapshot()
+		assert.Equal(t, int64(3), snap.Aggregate.TotalLogs)
+		assert.NotContains(t, snap.Events, SelfMetricsEvent)
+		rejected, capped := manager.GetEventRejectStats()
+		assert.Zero(t, rejected+capped)
+	})
+
+	t.Run("RejectsNegativeInterval", func(t *testing.T) {
+		config := newGuardTestConfig(t)
+		config.SelfMetricsInterval = -time.Second
+		_, err := NewLoggerManager(config)
+		assert.Error(t, err)
+	})
+}
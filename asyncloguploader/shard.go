@@ -7,11 +7,20 @@ import (
 	"sync/atomic"
 	"time"
 
-	"golang.org/x/sys/unix"
+	"github.com/neehar-mavuduru/logger-double-buffer/asyncloguploader/clock"
+	"github.com/neehar-mavuduru/logger-double-buffer/internal/logcore"
 )
 
 // headerOffset is the number of bytes reserved at the start of each buffer for the shard header
-const headerOffset = 8
+const headerOffset = logcore.HeaderSize
+
+// lengthPrefixSize is the size of the little-endian length prefix written before each entry
+const lengthPrefixSize = 4
+
+// flushThresholdPct is the default percentage of usable capacity (capacity minus header
+// reservation) at which a buffer requests a flush (Config.ShardFlushThresholdPct); utilization is
+// reported against the same base
+const flushThresholdPct = 90
 
 // Shard represents a single shard with double buffer
 // Merges Buffer and Shard functionality into single struct
@@ -30,6 +39,13 @@ type Shard struct {
 	// Capacity (same for both buffers, includes headerOffset)
 	capacity int32
 
+	// Highest offset entries may reach (capacity minus any checksum trailer)
+	limit int32
+
+	// Data size (excluding headerOffset) at which the active buffer requests a flush
+	// Atomic so UpdateConfig can change it under traffic (see setFlushThresholdPct)
+	flushThreshold atomic.Int32
+
 	// Mutex for flush operations
 	mu sync.Mutex
 
@@ -40,11 +56,57 @@ type Shard struct {
 	swapping      atomic.Bool
 	readyForFlush atomic.Bool
 	swapSemaphore chan struct{} // Per-shard semaphore for swap coordination (buffer size 1)
+	queued        atomic.Bool   // In the flush channel (each shard is queued at most once)
 
 	// Inflight write tracking (for both buffers)
 	inflightA atomic.Int64 // Number of concurrent writes in progress for bufferA
 	inflightB atomic.Int64 // Number of concurrent writes in progress for bufferB
 
+	// Entries written to each buffer since it was last reset
+	entriesA atomic.Int64
+	entriesB atomic.Int64
+
+	// Log payload bytes (excluding length prefixes and entry headers) in each buffer since it was last reset
+	payloadA atomic.Int64
+	payloadB atomic.Int64
+
+	// Committed offset of each buffer: every reservation below it has been written
+	committedA logcore.CommittedMark
+	committedB logcore.CommittedMark
+
+	// End of the entries sealed by a flush that timed out (0 after a complete seal); guarded by mu
+	// resetBuffers keeps the entries from there on, including the in-flight ones, for the next flush
+	partialA int32
+	partialB int32
+
+	// Start of the entries a partial flush left in each buffer (0 when none); guarded by mu
+	carriedA int32
+	carriedB int32
+
+	// Entries written since the shard was created (ShardStats.Writes)
+	writes atomic.Int64
+
+	// Entries dropped because both buffers were full, and buffer swaps (ShardStats.Drops, Swaps)
+	drops atomic.Int64
+	swaps atomic.Int64
+
+	// Writes that found the shard full, and those that timed out waiting for its swap permit
+	// (ShardStats.RetryPathWrites, RetryTimeouts)
+	retries       atomic.Int64
+	retryTimeouts atomic.Int64
+
+	// Entries the shard had no space for that a following shard took (ShardStats.Spills)
+	spills atomic.Int64
+
+	// Seal-on-swap settings (set by Logger before the shard takes writes)
+	sealOnSwap  bool          // Writers seal the buffer they swap out
+	sealTimeout *atomic.Int64 // Max wait for in-flight writes before sealing (the logger's FlushTimeout, in nanoseconds)
+	checksums   bool          // Sealing adds the CRC32C trailer
+	clock       clock.Clock   // Times the wait for in-flight writes (Config.Clock; clock.Real by default)
+
+	// Inactive buffer sealed by the writer that swapped it out (guarded by mu; buf is nil when none)
+	sealed sealedBuffer
+
 	// Cleanup functions for mmap (called on Close)
 	cleanupA func()
 	cleanupB func()
@@ -52,8 +114,13 @@ type Shard struct {
 
 // NewShard creates a new shard with double buffer using anonymous mmap
 func NewShard(capacity int, id uint32) (*Shard, error) {
+	return newShard(capacity, id, alignmentSize)
+}
 
-	alignedCap := alignSize(capacity)
+// newShard is NewShard with the capacity rounded up to alignment (Config.IOAlignment) instead of
+// the default
+func newShard(capacity int, id uint32, alignment int) (*Shard, error) {
+	alignedCap := alignSize(capacity, alignment)
 
 	// Allocate bufferA via anonymous mmap
 	bufferA, cleanupA, err := allocMmapBuffer(alignedCap)
@@ -65,7 +132,7 @@ func NewShard(capacity int, id uint32) (*Shard, error) {
 	bufferB, cleanupB, err := allocMmapBuffer(alignedCap)
 	if err != nil {
 		cleanupA()
-		unix.Munmap(bufferA)
+		freeMmapBuffer(bufferA)
 		return nil, err
 	}
 
@@ -73,18 +140,24 @@ func NewShard(capacity int, id uint32) (*Shard, error) {
 		bufferA:       bufferA,
 		bufferB:       bufferB,
 		capacity:      int32(alignedCap),
+		limit:         int32(alignedCap),
 		id:            id,
 		cleanupA:      cleanupA,
 		cleanupB:      cleanupB,
 		swapSemaphore: make(chan struct{}, 1), // Per-shard semaphore (buffer size 1)
+		clock:         clock.Real{},
 	}
 
+	s.setFlushThresholdPct(flushThresholdPct)
+
 	// Set bufferA as initial active buffer
 	s.activeBuffer.Store(&s.bufferA)
 
 	// Initialize offsets to skip header
 	s.offsetA.Store(headerOffset)
 	s.offsetB.Store(headerOffset)
+	s.committedA.Reset(headerOffset)
+	s.committedB.Reset(headerOffset)
 
 	// Set finalizer on Shard struct (not on individual buffers)
 	// This ensures buffers are only unmapped when Shard is garbage collected
@@ -97,11 +170,11 @@ func NewShard(capacity int, id uint32) (*Shard, error) {
 
 			// Unmap buffers if they still exist
 			if len(shard.bufferA) > 0 {
-				unix.Munmap(shard.bufferA)
+				freeMmapBuffer(shard.bufferA)
 				shard.bufferA = nil
 			}
 			if len(shard.bufferB) > 0 {
-				unix.Munmap(shard.bufferB)
+				freeMmapBuffer(shard.bufferB)
 				shard.bufferB = nil
 			}
 		}
@@ -110,45 +183,32 @@ func NewShard(capacity int, id uint32) (*Shard, error) {
 	return s, nil
 }
 
-// allocMmapBuffer allocates a buffer using anonymous mmap
-// Returns the buffer, cleanup function, and error
-func allocMmapBuffer(size int) ([]byte, func(), error) {
-	// Round up to page size alignment
-	alignedSize := alignSize(size)
-
-	// Create anonymous private mapping
-	data, err := unix.Mmap(
-		-1, 0,
-		alignedSize,
-		unix.PROT_READ|unix.PROT_WRITE,
-		unix.MAP_PRIVATE|unix.MAP_ANONYMOUS,
-	)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	// Cleanup function keeps buffer alive during use
-	cleanup := func() {
-		runtime.KeepAlive(data)
-		// Don't unmap during normal operation - reuse buffers
-	}
-
-	// NOTE: Finalizer is NOT set here - it's set on the Shard struct instead
-	// This prevents premature unmapping while the buffer is still in use
-
-	return data, cleanup, nil
+// alignSize rounds up size to the nearest multiple of alignment (a power of two)
+func alignSize(size, alignment int) int {
+	return int(alignUp(int64(size), int64(alignment)))
 }
 
-// alignSize rounds up size to the nearest alignment boundary (4096 bytes)
-func alignSize(size int) int {
-	const alignmentSize = 4096
-	return ((size + alignmentSize - 1) / alignmentSize) * alignmentSize
+// sealedBuffer is an inactive buffer prepared for writing: its header (and checksum) is in place,
+// so the flush worker only has to write it
+type sealedBuffer struct {
+	buf       *[]byte // &bufferA or &bufferB
+	data      []byte  // Full-capacity slice to write
+	dataBytes int32   // Valid data bytes (excluding header)
+	entries   int64   // Entries in the buffer
+	payload   int64   // Log payload bytes of the entries
+	complete  bool    // All in-flight writes finished before sealing
 }
 
 // Write writes data to the active buffer (lock-free hot path)
 // Prepends a 4-byte length prefix (little-endian) before the log data
 // Returns the number of bytes written (including length prefix) and whether the buffer needs flushing
 func (s *Shard) Write(p []byte) (n int, needsFlush bool) {
+	return s.writeEntry(nil, p, 0)
+}
+
+// writeEntry writes one entry: a length prefix (len(hdr)+len(p), OR'd with flags) followed by hdr and p
+// hdr lets callers prepend a small per-entry header (e.g. chunk metadata) without copying p
+func (s *Shard) writeEntry(hdr, p []byte, flags uint32) (n int, needsFlush bool) {
 	if len(p) == 0 {
 		return 0, false
 	}
@@ -160,27 +220,41 @@ func (s *Shard) Write(p []byte) (n int, needsFlush bool) {
 		return 0, true
 	}
 
-	// Determine which offset to use based on active buffer
+	// Determine which offset and counters to use based on active buffer
 	var offset *atomic.Int32
+	var inflight, entries, payload *atomic.Int64
+	var committed *logcore.CommittedMark
 	if activeBufPtr == &s.bufferA {
-		offset = &s.offsetA
+		offset, inflight, entries, payload, committed = &s.offsetA, &s.inflightA, &s.entriesA, &s.payloadA, &s.committedA
 	} else {
-		offset = &s.offsetB
+		offset, inflight, entries, payload, committed = &s.offsetB, &s.inflightB, &s.entriesB, &s.payloadB, &s.committedB
+	}
+
+	// Register as in-flight BEFORE reserving space, then re-check the active buffer
+	// A swapper waits for inflight to reach zero before reading the offset, so any reservation
+	// made by a writer that passed this check is written before the buffer is sealed, and a
+	// writer that lost the race backs off without touching the offset. Resets never clear inflight:
+	// every increment is paired with a decrement, including those of writers that back off
+	inflight.Add(1)
+	if s.activeBuffer.Load() != activeBufPtr {
+		inflight.Add(-1)
+		return s.writeEntry(hdr, p, flags)
 	}
 
-	// Reserve space for: 4-byte length prefix + log data
-	const lengthPrefixSize = 4
-	totalSize := lengthPrefixSize + len(p)
+	// Reserve space for: 4-byte length prefix + entry header + log data
+	entrySize := len(hdr) + len(p)
+	totalSize := lengthPrefixSize + entrySize
 
 	// Try to reserve space in the buffer (starting after the 8-byte header)
 	currentOffset := offset.Load()
 	newOffset := currentOffset + int32(totalSize)
 
-	// Check if we have enough space in the active buffer
+	// Check if we have enough space in the active buffer (an entry may fill it exactly)
 	// IMPORTANT: Check buffer space BEFORE checking readyForFlush
 	// This allows writes to the new active buffer after swap, even if readyForFlush is still true
-	if newOffset >= s.capacity {
+	if newOffset > s.limit || int(newOffset) > len(*activeBufPtr) {
 		// Active buffer is full - mark for flush
+		inflight.Add(-1)
 		s.readyForFlush.Store(true)
 		return 0, true
 	}
@@ -192,58 +266,39 @@ func (s *Shard) Write(p []byte) (n int, needsFlush bool) {
 	// Note: readyForFlush only prevents writes when BOTH buffers are full
 
 	// Try to atomically update the offset (CAS)
+	// Reservations are never rolled back: rolling back could discard a later writer's reservation
 	if !offset.CompareAndSwap(currentOffset, newOffset) {
 		// Another goroutine updated the offset, retry
-		return s.Write(p)
-	}
-
-	// CRITICAL: Re-check activeBuffer after CAS to ensure it hasn't changed
-	// This prevents race condition where buffer is swapped during CAS operation
-	currentActiveBufPtr := s.activeBuffer.Load()
-	if currentActiveBufPtr != activeBufPtr {
-		// Buffer was swapped during CAS - rollback offset and retry write
-		offset.Store(currentOffset)
-		return s.Write(p)
-	}
-
-	// Now safe to dereference - activeBuffer hasn't changed
-	activeBuf := *currentActiveBufPtr
-
-	// Bounds check: ensure we have enough space in buffer
-	if int(newOffset) > len(activeBuf) {
-		// Buffer overflow detected - reset offset and mark for flush
-		offset.Store(currentOffset)
-		s.readyForFlush.Store(true)
-		return 0, true
-	}
-
-	// Increment inflight counter for the active buffer
-	// Use currentActiveBufPtr (re-checked) instead of activeBufPtr
-	var inflight *atomic.Int64
-	if currentActiveBufPtr == &s.bufferA {
-		inflight = &s.inflightA
-	} else {
-		inflight = &s.inflightB
+		inflight.Add(-1)
+		return s.writeEntry(hdr, p, flags)
 	}
-	inflight.Add(1)
+	entries.Add(1)
+	payload.Add(int64(len(p)))
+	s.writes.Add(1)
+	activeBuf := *activeBufPtr
 
 	// Write 4-byte length prefix (little-endian uint32)
-	binary.LittleEndian.PutUint32(activeBuf[currentOffset:currentOffset+lengthPrefixSize], uint32(len(p)))
+	binary.LittleEndian.PutUint32(activeBuf[currentOffset:currentOffset+lengthPrefixSize], uint32(entrySize)|flags)
 
 	// Use copy() for data copy - Go's copy() is already highly optimized and safe
 	// The performance difference vs memmove is negligible (<10-20% for large buffers)
 	// and not worth the complexity and risk of unsafe pointer manipulation
-	copy(activeBuf[currentOffset+lengthPrefixSize:newOffset], p)
+	dataOffset := currentOffset + lengthPrefixSize + int32(copy(activeBuf[currentOffset+lengthPrefixSize:], hdr))
+	if writeCopyHook != nil {
+		writeCopyHook(p)
+	}
+	copy(activeBuf[dataOffset:newOffset], p)
 
-	// Decrement inflight counter: write completed
-	inflight.Add(-1)
+	// Write completed
+	committed.Finish(offset, inflight)
 
-	// Check if buffer is now full or nearly full (within 10%)
-	if newOffset >= s.capacity*9/10 {
+	// Check if buffer data has reached the flush threshold of usable capacity
+	if newOffset-headerOffset >= s.flushThreshold.Load() {
 		// CRITICAL: Force swap immediately so inactive buffer has the data
-		// This ensures flush can read the data from inactive buffer
-		// trySwap() is idempotent (CAS-protected), so calling it multiple times is safe
-		s.trySwap()
+		// This ensures flush can read the data from inactive buffer. If the inactive buffer has not
+		// been flushed yet, writes continue in this buffer and the flush takes both, oldest first
+		// swapIfFlushed() is idempotent (CAS-protected), so calling it multiple times is safe
+		s.swapIfFlushed()
 		s.readyForFlush.Store(true)
 		return totalSize, true
 	}
@@ -251,18 +306,74 @@ func (s *Shard) Write(p []byte) (n int, needsFlush bool) {
 	return totalSize, false
 }
 
+// writeCopyHook, when set, runs in writeEntry after the entry's space is reserved and before its
+// data is copied (tests use it to stall a writer mid-write); it must be set before writes start
+var writeCopyHook func(p []byte)
+
+// countEntries returns the entries and log payload bytes in data[from:to], which must hold whole entries
+func countEntries(data []byte, from, to int32) (entries, payload int64) {
+	for pos := from; pos < to; {
+		prefix := binary.LittleEndian.Uint32(data[pos : pos+lengthPrefixSize])
+		size := int32(prefix &^ chunkFlag)
+		payload += int64(size)
+		if prefix&chunkFlag != 0 {
+			payload -= chunkHeaderSize
+		}
+		entries++
+		pos += lengthPrefixSize + size
+	}
+	return entries, payload
+}
+
+// maxEntryPayload returns the largest entry (header + data, excluding the length prefix) the shard can hold
+func (s *Shard) maxEntryPayload() int {
+	return maxEntryPayload(int(s.capacity)) - int(s.capacity-s.limit)
+}
+
+// reserveChecksumTrailer keeps entries out of the last checksumTrailerSize bytes of both buffers
+// Must be called before the shard receives writes
+func (s *Shard) reserveChecksumTrailer() {
+	s.limit = s.capacity - checksumTrailerSize
+}
+
+// maxEntryPayload returns the largest entry a buffer of the given capacity can hold
+func maxEntryPayload(capacity int) int {
+	return capacity - headerOffset - lengthPrefixSize
+}
+
 // trySwap attempts to swap the active buffer (CAS-protected)
 func (s *Shard) trySwap() {
+	s.swap(false)
+}
+
+// swapIfFlushed swaps like trySwap unless the inactive buffer still holds unflushed data
+// Writers use it so buffers are flushed in the order they were filled: swapping back onto an
+// unflushed buffer would append newer entries to it while the other buffer is flushed first.
+// With seal-on-swap enabled, the writer that swaps also seals the buffer it swapped out
+func (s *Shard) swapIfFlushed() {
+	if s.swap(true) && s.sealOnSwap {
+		s.sealInactive()
+	}
+}
+
+// swap swaps the active buffer; with requireFlushed it keeps the active buffer if the inactive one has data
+// Returns true if this call swapped the buffers
+func (s *Shard) swap(requireFlushed bool) bool {
 	// Check if already swapping
 	if !s.swapping.CompareAndSwap(false, true) {
-		return // Another goroutine is swapping
+		return false // Another goroutine is swapping
 	}
 	defer s.swapping.Store(false)
 
+	// Checked while holding the swap flag: a flush can only empty the inactive buffer meanwhile
+	if requireFlushed && s.HasData() {
+		return false
+	}
+
 	// Get current active buffer
 	currentBufPtr := s.activeBuffer.Load()
 	if currentBufPtr == nil {
-		return
+		return false
 	}
 
 	// Determine next buffer
@@ -276,11 +387,102 @@ func (s *Shard) trySwap() {
 	// Atomically swap active buffer
 	if !s.activeBuffer.CompareAndSwap(currentBufPtr, nextBufPtr) {
 		// Swap failed, another goroutine beat us
-		return
+		return false
 	}
+	s.swaps.Add(1)
 
 	// Mark shard as ready for flush
 	s.readyForFlush.Store(true)
+	return true
+}
+
+// enableSealOnSwap makes writers seal the buffers they swap out (see swapIfFlushed)
+// timeout is read at each seal, so the logger can change it at runtime (Logger.UpdateConfig)
+// Must be called before the shard receives writes
+func (s *Shard) enableSealOnSwap(timeout *atomic.Int64, checksums bool) {
+	s.sealOnSwap = true
+	s.sealTimeout = timeout
+	s.checksums = checksums
+}
+
+// sealInactive waits for in-flight writes to the inactive buffer and seals it for the flush worker
+// Holding mu keeps a flush from collecting the buffer half-sealed; if a flush got there first and
+// already wrote and reset the buffer, there is nothing left to seal
+func (s *Shard) sealInactive() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sealed, ok := s.sealInactiveLocked(time.Duration(s.sealTimeout.Load()), s.checksums); ok {
+		s.sealed = sealed
+	}
+}
+
+// seal seals the inactive buffer on the flush worker (it was not sealed on swap)
+// Returns false if the inactive buffer holds no entries to write
+func (s *Shard) seal(timeout time.Duration, checksums bool) (sealedBuffer, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sealInactiveLocked(timeout, checksums)
+}
+
+// sealInactiveLocked seals the inactive buffer after waiting up to timeout for in-flight writes
+// If they do not finish, only the entries below the committed mark are sealed: resetBuffers keeps
+// the rest, and the next flush writes them once their writers are done. The caller holds mu
+func (s *Shard) sealInactiveLocked(timeout time.Duration, checksums bool) (sealedBuffer, bool) {
+	data, complete := s.inactiveData(timeout)
+	if data == nil {
+		return sealedBuffer{}, false
+	}
+	buf := s.inactiveBuffer()
+	offset, entries, payload, committed, partial, carried := s.bufferState(buf)
+	end := offset.Load()
+	if *carried != 0 {
+		// Entries left by a partial flush: move them behind the header once their writes are done
+		if !complete {
+			return sealedBuffer{}, false
+		}
+		end = headerOffset + int32(copy(data[headerOffset:], data[*carried:end]))
+		offset.Store(end)
+		committed.Reset(end)
+		*carried = 0
+	}
+
+	sealedEntries, sealedPayload := entries.Load(), payload.Load()
+	*partial = 0
+	if !complete {
+		end = committed.Offset()
+		sealedEntries, sealedPayload = countEntries(data, headerOffset, end)
+		*partial = end
+	}
+	if end <= headerOffset {
+		*partial = 0
+		return sealedBuffer{}, false
+	}
+
+	dataBytes := end - headerOffset
+	sealShard(data, s.capacity, dataBytes, checksums)
+	return sealedBuffer{
+		buf:       buf,
+		data:      data,
+		dataBytes: dataBytes,
+		entries:   sealedEntries,
+		payload:   sealedPayload,
+		complete:  complete,
+	}, true
+}
+
+// takeSealed returns the inactive buffer if a writer sealed it, and clears the sealed state
+// Returns false if the inactive buffer was not sealed (the flush worker seals it instead)
+func (s *Shard) takeSealed() (sealedBuffer, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sealed := s.sealed
+	s.sealed = sealedBuffer{}
+	if sealed.buf == nil || sealed.buf != s.inactiveBuffer() {
+		return sealedBuffer{}, false
+	}
+	return sealed, true
 }
 
 // GetData returns the data from the inactive buffer (the one being flushed)
@@ -290,7 +492,11 @@ func (s *Shard) trySwap() {
 func (s *Shard) GetData(timeout time.Duration) ([]byte, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.inactiveData(timeout)
+}
 
+// inactiveData is GetData without locking mu (the caller holds it)
+func (s *Shard) inactiveData(timeout time.Duration) ([]byte, bool) {
 	// Get the buffer that was swapped out (inactive)
 	activeBufPtr := s.activeBuffer.Load()
 	var inactiveBuf []byte
@@ -310,23 +516,9 @@ func (s *Shard) GetData(timeout time.Duration) ([]byte, bool) {
 		return nil, false
 	}
 
-	// Wait for all inflight writes to complete
-	deadline := time.Now().Add(timeout)
-	const checkInterval = 50 * time.Microsecond
-
-	for time.Now().Before(deadline) {
-		if inflight.Load() == 0 {
-			// All writes have completed
-			return inactiveBuf[:s.capacity], true
-		}
-
-		// Writes still in progress, yield CPU
-		runtime.Gosched()
-		time.Sleep(checkInterval)
-	}
-
-	// Timeout expired: flush anyway (may contain incomplete last write)
-	return inactiveBuf[:s.capacity], false
+	// Wait for all inflight writes to complete; on timeout the caller seals the committed entries only
+	complete := logcore.WaitForWrites(inflight, timeout, s.clock.Now)
+	return inactiveBuf[:s.capacity], complete
 }
 
 // GetInactiveOffset returns the offset of the inactive buffer (the one being flushed)
@@ -338,6 +530,16 @@ func (s *Shard) GetInactiveOffset() int32 {
 	return s.offsetA.Load()
 }
 
+// room returns the bytes left in the active buffer before it is full
+func (s *Shard) room() int32 {
+	return s.limit - s.Offset()
+}
+
+// bufferedBytes returns the data bytes (excluding headers) held in both buffers
+func (s *Shard) bufferedBytes() int64 {
+	return int64(s.offsetA.Load()-headerOffset) + int64(s.offsetB.Load()-headerOffset)
+}
+
 // Reset clears the inactive buffer after flush (legacy method for compatibility)
 func (s *Shard) Reset() {
 	s.ResetEnhanced()
@@ -358,29 +560,79 @@ func (s *Shard) ResetEnhanced() {
 
 	if activeHasData && inactiveHasData {
 		// BOTH buffers are full - clear both
-		s.offsetA.Store(headerOffset)
-		s.offsetB.Store(headerOffset)
-		s.inflightA.Store(0)
-		s.inflightB.Store(0)
+		s.clearBuffer(&s.bufferA)
+		s.clearBuffer(&s.bufferB)
 		// Active pointer stays as-is (both buffers now empty, either can accept writes)
 	} else if inactiveHasData {
 		// Only inactive buffer has data (normal case)
 		if activeBufPtr == nil || activeBufPtr == &s.bufferA {
 			// Active is A, inactive is B
-			s.offsetB.Store(headerOffset)
-			s.inflightB.Store(0)
+			s.clearBuffer(&s.bufferB)
 		} else {
 			// Active is B, inactive is A
-			s.offsetA.Store(headerOffset)
-			s.inflightA.Store(0)
+			s.clearBuffer(&s.bufferA)
 		}
 	}
 	// If only active has data, it means swap happened during flush
 	// This will be handled by the next flush cycle
 
+	s.sealed = sealedBuffer{}
+	s.readyForFlush.Store(false)
+}
+
+// inactiveBuffer returns the buffer currently being flushed
+func (s *Shard) inactiveBuffer() *[]byte {
+	activeBufPtr := s.activeBuffer.Load()
+	if activeBufPtr == nil || activeBufPtr == &s.bufferA {
+		return &s.bufferB
+	}
+	return &s.bufferA
+}
+
+// resetBuffers clears the given buffers after they were flushed
+// Unlike ResetEnhanced, a buffer that received writes during the flush without being flushed keeps them,
+// and a buffer sealed by a flush that timed out keeps the entries past the ones written
+func (s *Shard) resetBuffers(flushed []*[]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, buf := range flushed {
+		if s.sealed.buf == buf {
+			s.sealed = sealedBuffer{}
+		}
+		_, entries, payload, _, partial, carried := s.bufferState(buf)
+		if end := *partial; end != 0 {
+			// Drop the written entries; the offset stays put, so stalled writers finish in place
+			flushedEntries, flushedPayload := countEntries(*buf, headerOffset, end)
+			entries.Add(-flushedEntries)
+			payload.Add(-flushedPayload)
+			*partial, *carried = 0, end
+			continue
+		}
+		s.clearBuffer(buf)
+	}
 	s.readyForFlush.Store(false)
 }
 
+// clearBuffer empties buf (&bufferA or &bufferB); the caller holds mu
+func (s *Shard) clearBuffer(buf *[]byte) {
+	offset, entries, payload, committed, partial, carried := s.bufferState(buf)
+	offset.Store(headerOffset)
+	committed.Reset(headerOffset)
+	entries.Store(0)
+	payload.Store(0)
+	*partial, *carried = 0, 0
+}
+
+// bufferState returns the write state and counters of buf (&bufferA or &bufferB)
+// partial and carried are guarded by mu
+func (s *Shard) bufferState(buf *[]byte) (offset *atomic.Int32, entries, payload *atomic.Int64, committed *logcore.CommittedMark, partial, carried *int32) {
+	if buf == &s.bufferA {
+		return &s.offsetA, &s.entriesA, &s.payloadA, &s.committedA, &s.partialA, &s.carriedA
+	}
+	return &s.offsetB, &s.entriesB, &s.payloadB, &s.committedB, &s.partialB, &s.carriedB
+}
+
 // ID returns the shard identifier
 func (s *Shard) ID() uint32 {
 	return s.id
@@ -417,6 +669,41 @@ func (s *Shard) Capacity() int32 {
 	return s.capacity
 }
 
+// UtilizationPct returns the active buffer's data size as a percentage of usable capacity
+// Uses the same base (capacity minus header reservation) as the flush threshold
+func (s *Shard) UtilizationPct() float64 {
+	dataSize := s.Offset() - headerOffset
+	if dataSize < 0 {
+		dataSize = 0
+	}
+	return utilizationPct(dataSize, s.capacity)
+}
+
+// setFlushThresholdPct makes the buffers request a flush at pct% of their usable capacity
+// Safe under concurrent writes; a write that already passed the check keeps the old threshold
+func (s *Shard) setFlushThresholdPct(pct int) {
+	s.flushThreshold.Store(flushThresholdBytes(s.capacity, pct))
+}
+
+// flushThresholdBytes returns the data size at which a buffer of the given capacity requests a
+// flush when pct% full. Computed in int64 to avoid overflow for large shards
+func flushThresholdBytes(capacity int32, pct int) int32 {
+	usable := int64(capacity) - headerOffset
+	if usable <= 0 {
+		return 0
+	}
+	return int32(usable * int64(pct) / 100)
+}
+
+// utilizationPct returns dataSize as a percentage of the usable capacity (capacity minus header reservation)
+func utilizationPct(dataSize, capacity int32) float64 {
+	usable := capacity - headerOffset
+	if usable <= 0 {
+		return 0.0
+	}
+	return float64(dataSize) / float64(usable) * 100.0
+}
+
 // Close releases resources associated with the shard
 func (s *Shard) Close() {
 	s.mu.Lock()
@@ -434,11 +721,11 @@ func (s *Shard) Close() {
 
 	// Unmap buffers
 	if len(s.bufferA) > 0 {
-		unix.Munmap(s.bufferA)
+		freeMmapBuffer(s.bufferA)
 		s.bufferA = nil
 	}
 	if len(s.bufferB) > 0 {
-		unix.Munmap(s.bufferB)
+		freeMmapBuffer(s.bufferB)
 		s.bufferB = nil
 	}
 }
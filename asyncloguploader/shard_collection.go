@@ -3,23 +3,42 @@ package asyncloguploader
 import (
 	"math/rand/v2"
 	"sync/atomic"
+	"unsafe"
 )
 
+// readyShardsPct is the default percentage of shards that must be ready before they are flushed
+// together (Config.ReadyShardsFlushPct)
+const readyShardsPct = 25
+
 // ShardCollection represents a collection of shards with individual double buffers
 // Each shard manages its own double buffer and swaps independently
 type ShardCollection struct {
 	shards      []*Shard
 	numShards   int
-	readyShards atomic.Int32  // Count of shards ready for flush
-	threshold   int32         // Threshold count (25% of numShards)
-	flushChan   chan<- *Shard // Channel to send shards for flush (set by Logger)
+	readyShards atomic.Int32    // Count of shards ready for flush
+	threshold   atomic.Int32    // Ready shards that reach the threshold (ReadyShardsFlushPct of numShards)
+	flushChans  []chan<- *Shard // Flush channel per flush worker; shard i goes to flushChans[i%len] (set by Logger)
+	selection   ShardSelection  // Config.ShardSelection (set by Logger; "" = random)
+	nextShard   atomic.Uint64   // Round-robin counter
+	size        int             // Total buffer size requested for the shards (per double-buffer half)
+	coalesced   *atomic.Int64   // Counts flush requests for already queued shards (set by Logger; may be nil)
+	spilled     *atomic.Int64   // Counts entries written to a following shard (set by Logger; may be nil)
+
+	// Writes in progress, counted by loggers that resize their buffers so a replaced collection is
+	// only flushed once no writer still uses it (see Logger.acquireShards)
+	writers atomic.Int64
 }
 
 // NewShardCollection creates a new collection of shards with individual double buffers
 // totalCapacity is divided evenly among numShards
-// Threshold is fixed at 25% of numShards
+// The threshold is 25% of numShards (see setReadyShardsPct)
 // flushChan is optional - if provided, shards will be sent to it on swap
 func NewShardCollection(totalCapacity, numShards int, flushChan chan<- *Shard) (*ShardCollection, error) {
+	return newShardCollection(totalCapacity, numShards, alignmentSize, flushChan)
+}
+
+// newShardCollection is NewShardCollection with shards aligned to alignment (Config.IOAlignment)
+func newShardCollection(totalCapacity, numShards, alignment int, flushChan chan<- *Shard) (*ShardCollection, error) {
 	if numShards <= 0 {
 		numShards = 8 // Default
 	}
@@ -36,7 +55,7 @@ func NewShardCollection(totalCapacity, numShards int, flushChan chan<- *Shard) (
 
 	shards := make([]*Shard, numShards)
 	for i := 0; i < numShards; i++ {
-		shard, err := NewShard(shardCapacity, uint32(i))
+		shard, err := newShard(shardCapacity, uint32(i), alignment)
 		if err != nil {
 			// Cleanup already created shards on error
 			for j := 0; j < i; j++ {
@@ -47,59 +66,133 @@ func NewShardCollection(totalCapacity, numShards int, flushChan chan<- *Shard) (
 		shards[i] = shard
 	}
 
-	// Calculate threshold: 25% of numShards
-	threshold := int32((numShards * 25) / 100)
-	if threshold == 0 {
-		threshold = 1 // At least 1 shard
-	}
-
-	return &ShardCollection{
+	sc := &ShardCollection{
 		shards:    shards,
 		numShards: numShards,
-		threshold: threshold,
-		flushChan: flushChan,
-	}, nil
+		size:      shardCapacity * numShards,
+	}
+	sc.setReadyShardsPct(readyShardsPct)
+	if flushChan != nil {
+		sc.flushChans = []chan<- *Shard{flushChan}
+	}
+	return sc, nil
 }
 
-// Write writes data to a shard using random selection for better load distribution
+// spillProbes bounds how many following shards writeEntry tries when the chosen shard has no space
+const spillProbes = 3
+
+// Write writes data to a shard chosen by the selection strategy (random by default)
 // Returns bytes written, whether flush is needed, and which shard was written to
 func (sc *ShardCollection) Write(p []byte) (n int, needsFlush bool, shardID int) {
+	return sc.writeEntry(nil, p, 0, 0, false)
+}
+
+// writeEntry is Write with an optional per-entry header and length-prefix flags (see Shard.writeEntry)
+// key picks the shard under ShardSelectionKeyHash when keyed is set
+// If the shard has no space left for the entry, up to spillProbes following shards are tried in order,
+// except for keyed entries under ShardSelectionKeyHash, which must stay on their shard to keep their order.
+// On failure shardID is the chosen shard
+func (sc *ShardCollection) writeEntry(hdr, p []byte, flags uint32, key uint64, keyed bool) (n int, needsFlush bool, shardID int) {
 	if len(p) == 0 {
 		return 0, false, -1
 	}
 
-	// Random selection for better load distribution across shards
-	shardIdx := rand.IntN(sc.numShards)
-	shard := sc.shards[shardIdx]
+	shardIdx := sc.selectShard(key, keyed)
+	n, needsFlush = sc.writeShard(sc.shards[shardIdx], hdr, p, flags)
+	if n > 0 || (keyed && sc.selection == ShardSelectionKeyHash) {
+		return n, needsFlush, shardIdx
+	}
+
+	// No space left in the shard: spill to one of the next shards instead of failing the write
+	// The refusing shard is already enqueued for its swap
+	for i := 1; i <= spillProbes && i < sc.numShards; i++ {
+		idx := (shardIdx + i) % sc.numShards
+		if spilledN, spilledFlush := sc.writeShard(sc.shards[idx], hdr, p, flags); spilledN > 0 {
+			sc.shards[shardIdx].spills.Add(1)
+			if sc.spilled != nil {
+				sc.spilled.Add(1)
+			}
+			return spilledN, spilledFlush, idx
+		}
+	}
+	return n, needsFlush, shardIdx
+}
 
-	n, needsFlush = shard.Write(p)
+// writeShard writes one entry to shard, enqueueing the shard for flush when it is ready
+func (sc *ShardCollection) writeShard(shard *Shard, hdr, p []byte, flags uint32) (n int, needsFlush bool) {
+	n, needsFlush = shard.writeEntry(hdr, p, flags)
 
 	// If shard is ready for flush, send to flush channel and update ready count
 	if needsFlush {
 		sc.EnqueueShardForFlush(shard)
 		sc.MarkShardReady()
 	}
+	return n, needsFlush
+}
 
-	return n, needsFlush, shardIdx
+// selectShard returns the index of the shard for the next entry
+func (sc *ShardCollection) selectShard(key uint64, keyed bool) int {
+	n := uint64(sc.numShards)
+	switch sc.selection {
+	case ShardSelectionRoundRobin:
+		return int(sc.nextShard.Add(1) % n)
+	case ShardSelectionGoroutineAffinity:
+		// Goroutine stacks start at 2KB, aligned to their size; drop the offset within the stack
+		return int(mix64(uint64(goroutineHint())>>11) % n)
+	case ShardSelectionKeyHash:
+		if keyed {
+			return int(mix64(key) % n)
+		}
+	}
+	return rand.IntN(sc.numShards)
+}
+
+// goroutineHint returns the address of a local variable, which lies in the calling goroutine's
+// own stack: a cheap per-goroutine value that stays stable until the stack is moved
+//
+//go:noinline
+func goroutineHint() uintptr {
+	var marker byte
+	return uintptr(unsafe.Pointer(&marker))
 }
 
-// EnqueueShardForFlush sends a shard to the flush channel (non-blocking)
+// mix64 spreads the bits of x (SplitMix64 finalizer), so sequential keys land on different shards
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// EnqueueShardForFlush sends a shard to its flush worker's channel unless it is already queued
+// Requests for a queued shard are coalesced, so a channel with room for every shard never fills
+// and the send never blocks; the receiver must call dequeued for each shard it takes
 func (sc *ShardCollection) EnqueueShardForFlush(shard *Shard) {
-	if sc.flushChan != nil {
-		select {
-		case sc.flushChan <- shard:
-			// Successfully queued for flush
-		default:
-			// Channel full, skip (will be picked up by periodic flush)
+	if len(sc.flushChans) == 0 {
+		return
+	}
+	if !shard.queued.CompareAndSwap(false, true) {
+		if sc.coalesced != nil {
+			sc.coalesced.Add(1)
 		}
+		return
 	}
+	sc.flushChans[int(shard.id)%len(sc.flushChans)] <- shard
+}
+
+// dequeued marks a shard taken from the flush channel so it can be queued again
+func dequeued(shard *Shard) *Shard {
+	shard.queued.Store(false)
+	return shard
 }
 
 // MarkShardReady increments the ready shards count
 // Returns true if threshold reached and flush should be triggered
 func (sc *ShardCollection) MarkShardReady() bool {
 	count := sc.readyShards.Add(1)
-	return count >= sc.threshold
+	return count >= sc.threshold.Load()
 }
 
 // ResetReadyShards resets the ready shards count
@@ -114,7 +207,24 @@ func (sc *ShardCollection) ReadyShardsCount() int32 {
 
 // ThresholdReached returns true if threshold has been reached
 func (sc *ShardCollection) ThresholdReached() bool {
-	return sc.readyShards.Load() >= sc.threshold
+	return sc.readyShards.Load() >= sc.threshold.Load()
+}
+
+// setReadyShardsPct sets the threshold to pct% of the shards (Config.ReadyShardsFlushPct)
+func (sc *ShardCollection) setReadyShardsPct(pct int) {
+	sc.threshold.Store(int32(readyShardsThreshold(sc.numShards, pct)))
+}
+
+// setFlushThresholdPct sets the flush threshold of every shard (see Shard.setFlushThresholdPct)
+func (sc *ShardCollection) setFlushThresholdPct(pct int) {
+	for _, shard := range sc.shards {
+		shard.setFlushThresholdPct(pct)
+	}
+}
+
+// readyShardsThreshold returns pct% of numShards, at least 1
+func readyShardsThreshold(numShards, pct int) int {
+	return max(1, numShards*pct/100)
 }
 
 // GetShard returns a specific shard by index
@@ -125,6 +235,11 @@ func (sc *ShardCollection) GetShard(idx int) *Shard {
 	return sc.shards[idx]
 }
 
+// BufferSize returns the total buffer size of the shards (one half of each double buffer)
+func (sc *ShardCollection) BufferSize() int {
+	return sc.size
+}
+
 // NumShards returns the number of shards
 func (sc *ShardCollection) NumShards() int {
 	return sc.numShards
@@ -186,6 +301,15 @@ func (sc *ShardCollection) TotalBytes() int64 {
 	return total
 }
 
+// doubleBuffers returns both buffers of every shard (for io_uring buffer registration)
+func doubleBuffers(shards []*Shard) [][]byte {
+	buffers := make([][]byte, 0, len(shards)*2)
+	for _, shard := range shards {
+		buffers = append(buffers, shard.bufferA, shard.bufferB)
+	}
+	return buffers
+}
+
 // Close releases all resources associated with the shard collection
 func (sc *ShardCollection) Close() {
 	for _, shard := range sc.shards {
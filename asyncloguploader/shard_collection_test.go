@@ -1,6 +1,11 @@
 package asyncloguploader
 
 import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -10,7 +15,7 @@ import (
 
 func TestShardCollection_NewShardCollection(t *testing.T) {
 	t.Run("CreatesCollectionWithCorrectShardCount", func(t *testing.T) {
-		collection, err := NewShardCollection(8*1024*1024, 8) // 8MB total, 8 shards
+		collection, err := NewShardCollection(8*1024*1024, 8, nil) // 8MB total, 8 shards
 		require.NoError(t, err)
 		defer collection.Close()
 
@@ -19,25 +24,25 @@ func TestShardCollection_NewShardCollection(t *testing.T) {
 	})
 
 	t.Run("Calculates25PercentThreshold", func(t *testing.T) {
-		collection, err := NewShardCollection(8*1024*1024, 8)
+		collection, err := NewShardCollection(8*1024*1024, 8, nil)
 		require.NoError(t, err)
 		defer collection.Close()
 
 		// 25% of 8 = 2
-		assert.Equal(t, int32(2), collection.threshold)
+		assert.Equal(t, int32(2), collection.threshold.Load())
 	})
 
 	t.Run("SetsMinimumThresholdToOne", func(t *testing.T) {
-		collection, err := NewShardCollection(4*1024*1024, 4)
+		collection, err := NewShardCollection(4*1024*1024, 4, nil)
 		require.NoError(t, err)
 		defer collection.Close()
 
 		// 25% of 4 = 1
-		assert.Equal(t, int32(1), collection.threshold)
+		assert.Equal(t, int32(1), collection.threshold.Load())
 	})
 
 	t.Run("HandlesSmallShardSize", func(t *testing.T) {
-		collection, err := NewShardCollection(64*1024, 8) // Very small total
+		collection, err := NewShardCollection(64*1024, 8, nil) // Very small total
 		require.NoError(t, err)
 		defer collection.Close()
 
@@ -48,7 +53,7 @@ func TestShardCollection_NewShardCollection(t *testing.T) {
 
 func TestShardCollection_Write(t *testing.T) {
 	t.Run("WritesToShardUsingRoundRobin", func(t *testing.T) {
-		collection, err := NewShardCollection(8*1024*1024, 4)
+		collection, err := NewShardCollection(8*1024*1024, 4, nil)
 		require.NoError(t, err)
 		defer collection.Close()
 
@@ -61,7 +66,7 @@ func TestShardCollection_Write(t *testing.T) {
 	})
 
 	t.Run("DistributesWritesRoundRobin", func(t *testing.T) {
-		collection, err := NewShardCollection(8*1024*1024, 4)
+		collection, err := NewShardCollection(8*1024*1024, 4, nil)
 		require.NoError(t, err)
 		defer collection.Close()
 
@@ -76,7 +81,7 @@ func TestShardCollection_Write(t *testing.T) {
 	})
 
 	t.Run("ReturnsZeroForEmptyData", func(t *testing.T) {
-		collection, err := NewShardCollection(8*1024*1024, 4)
+		collection, err := NewShardCollection(8*1024*1024, 4, nil)
 		require.NoError(t, err)
 		defer collection.Close()
 
@@ -88,7 +93,7 @@ func TestShardCollection_Write(t *testing.T) {
 	})
 
 	t.Run("MarksShardReadyWhenFull", func(t *testing.T) {
-		collection, err := NewShardCollection(8*1024*1024, 4)
+		collection, err := NewShardCollection(8*1024*1024, 4, nil)
 		require.NoError(t, err)
 		defer collection.Close()
 
@@ -107,7 +112,7 @@ func TestShardCollection_Write(t *testing.T) {
 
 func TestShardCollection_ThresholdReached(t *testing.T) {
 	t.Run("ReturnsTrueWhenThresholdReached", func(t *testing.T) {
-		collection, err := NewShardCollection(8*1024*1024, 8)
+		collection, err := NewShardCollection(8*1024*1024, 8, nil)
 		require.NoError(t, err)
 		defer collection.Close()
 
@@ -120,18 +125,34 @@ func TestShardCollection_ThresholdReached(t *testing.T) {
 	})
 
 	t.Run("ReturnsFalseWhenBelowThreshold", func(t *testing.T) {
-		collection, err := NewShardCollection(8*1024*1024, 8)
+		collection, err := NewShardCollection(8*1024*1024, 8, nil)
 		require.NoError(t, err)
 		defer collection.Close()
 
 		collection.MarkShardReady()
 		assert.False(t, collection.ThresholdReached())
 	})
+
+	t.Run("ReadyShardsPct", func(t *testing.T) {
+		collection, err := NewShardCollection(8*1024*1024, 8, nil)
+		require.NoError(t, err)
+		defer collection.Close()
+
+		for pct, ready := range map[int]int{50: 4, 99: 7, 100: 8, 1: 1} {
+			collection.ResetReadyShards()
+			collection.setReadyShardsPct(pct)
+			for i := 1; i < ready; i++ {
+				assert.False(t, collection.MarkShardReady(), "%d%%: %d of 8 ready", pct, i)
+			}
+			assert.True(t, collection.MarkShardReady(), "%d%%: %d of 8 ready", pct, ready)
+			assert.True(t, collection.ThresholdReached())
+		}
+	})
 }
 
 func TestShardCollection_GetReadyShards(t *testing.T) {
 	t.Run("ReturnsOnlyFullShards", func(t *testing.T) {
-		collection, err := NewShardCollection(8*1024*1024, 4)
+		collection, err := NewShardCollection(8*1024*1024, 4, nil)
 		require.NoError(t, err)
 		defer collection.Close()
 
@@ -148,7 +169,7 @@ func TestShardCollection_GetReadyShards(t *testing.T) {
 	})
 
 	t.Run("ReturnsEmptyWhenNoShardsReady", func(t *testing.T) {
-		collection, err := NewShardCollection(8*1024*1024, 4)
+		collection, err := NewShardCollection(8*1024*1024, 4, nil)
 		require.NoError(t, err)
 		defer collection.Close()
 
@@ -159,7 +180,7 @@ func TestShardCollection_GetReadyShards(t *testing.T) {
 
 func TestShardCollection_ResetReadyShards(t *testing.T) {
 	t.Run("ResetsReadyShardsCount", func(t *testing.T) {
-		collection, err := NewShardCollection(8*1024*1024, 8)
+		collection, err := NewShardCollection(8*1024*1024, 8, nil)
 		require.NoError(t, err)
 		defer collection.Close()
 
@@ -174,7 +195,7 @@ func TestShardCollection_ResetReadyShards(t *testing.T) {
 
 func TestShardCollection_Reset(t *testing.T) {
 	t.Run("ResetsAllReadyShards", func(t *testing.T) {
-		collection, err := NewShardCollection(8*1024*1024, 4)
+		collection, err := NewShardCollection(8*1024*1024, 4, nil)
 		require.NoError(t, err)
 		defer collection.Close()
 
@@ -197,7 +218,7 @@ func TestShardCollection_Reset(t *testing.T) {
 
 func TestShardCollection_HasData(t *testing.T) {
 	t.Run("ReturnsFalseWhenNoData", func(t *testing.T) {
-		collection, err := NewShardCollection(8*1024*1024, 4)
+		collection, err := NewShardCollection(8*1024*1024, 4, nil)
 		require.NoError(t, err)
 		defer collection.Close()
 
@@ -205,7 +226,7 @@ func TestShardCollection_HasData(t *testing.T) {
 	})
 
 	t.Run("ReturnsTrueWhenHasData", func(t *testing.T) {
-		collection, err := NewShardCollection(8*1024*1024, 4)
+		collection, err := NewShardCollection(8*1024*1024, 4, nil)
 		require.NoError(t, err)
 		defer collection.Close()
 
@@ -223,7 +244,7 @@ func TestShardCollection_HasData(t *testing.T) {
 
 func TestShardCollection_GetShard(t *testing.T) {
 	t.Run("ReturnsCorrectShard", func(t *testing.T) {
-		collection, err := NewShardCollection(8*1024*1024, 4)
+		collection, err := NewShardCollection(8*1024*1024, 4, nil)
 		require.NoError(t, err)
 		defer collection.Close()
 
@@ -233,7 +254,7 @@ func TestShardCollection_GetShard(t *testing.T) {
 	})
 
 	t.Run("ReturnsNilForInvalidIndex", func(t *testing.T) {
-		collection, err := NewShardCollection(8*1024*1024, 4)
+		collection, err := NewShardCollection(8*1024*1024, 4, nil)
 		require.NoError(t, err)
 		defer collection.Close()
 
@@ -244,7 +265,7 @@ func TestShardCollection_GetShard(t *testing.T) {
 
 func TestShardCollection_TotalBytes(t *testing.T) {
 	t.Run("CalculatesTotalBytesCorrectly", func(t *testing.T) {
-		collection, err := NewShardCollection(8*1024*1024, 4)
+		collection, err := NewShardCollection(8*1024*1024, 4, nil)
 		require.NoError(t, err)
 		defer collection.Close()
 
@@ -258,7 +279,7 @@ func TestShardCollection_TotalBytes(t *testing.T) {
 	})
 
 	t.Run("ExcludesHeaderReservation", func(t *testing.T) {
-		collection, err := NewShardCollection(8*1024*1024, 4)
+		collection, err := NewShardCollection(8*1024*1024, 4, nil)
 		require.NoError(t, err)
 		defer collection.Close()
 
@@ -272,3 +293,251 @@ func TestShardCollection_TotalBytes(t *testing.T) {
 	})
 }
 
+// shardWrites returns the Writes of each shard in a logger snapshot
+func shardWrites(logger *Logger) []int64 {
+	var writes []int64
+	for _, shard := range logger.Snapshot().Shards {
+		writes = append(writes, shard.Writes)
+	}
+	return writes
+}
+
+func TestShardCollection_Selection(t *testing.T) {
+	newSelectionLogger := func(t *testing.T, selection ShardSelection) *Logger {
+		t.Helper()
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		config.BufferSize = 8 * 1024 * 1024
+		config.NumShards = 8
+		config.ShardSelection = selection
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		t.Cleanup(func() { logger.Close() })
+		return logger
+	}
+
+	t.Run("ValidatesConfig", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "test.log"))
+		require.NoError(t, config.Validate())
+		assert.Equal(t, ShardSelectionRandom, config.ShardSelection)
+
+		config.ShardSelection = "least_loaded"
+		assert.Error(t, config.Validate())
+	})
+
+	t.Run("RoundRobinIsEven", func(t *testing.T) {
+		logger := newSelectionLogger(t, ShardSelectionRoundRobin)
+		for i := 0; i < 800; i++ {
+			logger.Log("entry")
+		}
+		for id, writes := range shardWrites(logger) {
+			assert.Equal(t, int64(100), writes, "shard %d", id)
+		}
+	})
+
+	t.Run("KeyHashKeepsKeyOnOneShard", func(t *testing.T) {
+		logger := newSelectionLogger(t, ShardSelectionKeyHash)
+		for i := 0; i < 50; i++ {
+			logger.LogBytesKeyed(42, []byte("tenant 42"))
+		}
+		writes := shardWrites(logger)
+		assert.Contains(t, writes, int64(50))
+		assert.Equal(t, 7, countZero(writes))
+
+		// Sequential keys spread over every shard
+		for key := uint64(0); key < 1000; key++ {
+			logger.LogBytesKeyed(key, []byte("tenant"))
+		}
+		assert.Zero(t, countZero(shardWrites(logger)))
+	})
+
+	t.Run("KeyIgnoredByOtherStrategies", func(t *testing.T) {
+		logger := newSelectionLogger(t, ShardSelectionRoundRobin)
+		for i := 0; i < 80; i++ {
+			logger.LogBytesKeyed(42, []byte("tenant 42"))
+		}
+		for _, writes := range shardWrites(logger) {
+			assert.Equal(t, int64(10), writes)
+		}
+	})
+
+	t.Run("GoroutineAffinityKeepsGoroutineOnOneShard", func(t *testing.T) {
+		logger := newSelectionLogger(t, ShardSelectionGoroutineAffinity)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				logger.Log("same goroutine")
+			}
+		}()
+		<-done
+		writes := shardWrites(logger)
+		assert.Contains(t, writes, int64(100))
+
+		// Many goroutines spread over several shards
+		var wg sync.WaitGroup
+		for g := 0; g < 64; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				logger.Log("spread")
+			}()
+		}
+		wg.Wait()
+		assert.Less(t, countZero(shardWrites(logger)), 6)
+	})
+}
+
+// countZero returns how many values are zero
+func countZero(values []int64) int {
+	n := 0
+	for _, v := range values {
+		if v == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// BenchmarkShardSelection compares the strategies with 256 concurrent writers, one key per writer
+// Run with -benchtime=2000000x so every strategy offers the same load; drop% shows how well each one
+// spreads it while the buffers are flushed. The load is unpaced and uneven across writers, which
+// favors random and round-robin: affinity and key hashing keep a busy writer on one shard
+func BenchmarkShardSelection(b *testing.B) {
+	for _, numShards := range []int{8, 32, 64} {
+		for _, selection := range []ShardSelection{ShardSelectionRandom, ShardSelectionRoundRobin, ShardSelectionGoroutineAffinity, ShardSelectionKeyHash} {
+			b.Run(fmt.Sprintf("shards=%d/%s", numShards, selection), func(b *testing.B) {
+				config := DefaultConfig(filepath.Join(b.TempDir(), "bench.log"))
+				config.BufferSize = numShards * 256 * 1024
+				config.NumShards = numShards
+				config.ShardSelection = selection
+				logger, err := NewLogger(config)
+				require.NoError(b, err)
+
+				msg := make([]byte, 256)
+				var tenants atomic.Uint64
+				b.SetParallelism(256 / max(1, runtime.GOMAXPROCS(0)))
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					tenant := tenants.Add(1)
+					for pb.Next() {
+						logger.LogBytesKeyed(tenant, msg)
+					}
+				})
+				b.StopTimer()
+				require.NoError(b, logger.Close())
+
+				stats := logger.Snapshot().Stats
+				b.ReportMetric(float64(stats.DroppedLogs)/float64(stats.TotalLogs)*100, "drop%")
+			})
+		}
+	}
+}
+
+func TestShardCollection_EnqueueCoalesces(t *testing.T) {
+	flushChan := make(chan *Shard, 4)
+	sc, err := NewShardCollection(256*1024, 4, flushChan)
+	require.NoError(t, err)
+	defer sc.Close()
+	var coalesced atomic.Int64
+	sc.coalesced = &coalesced
+
+	shard := sc.GetShard(1)
+	sc.EnqueueShardForFlush(shard)
+	sc.EnqueueShardForFlush(shard)
+	sc.EnqueueShardForFlush(shard)
+	assert.Len(t, flushChan, 1)
+	assert.Equal(t, int64(2), coalesced.Load())
+
+	// Once the worker takes the shard, the next request queues it again
+	dequeued(<-flushChan)
+	sc.EnqueueShardForFlush(shard)
+	assert.Len(t, flushChan, 1)
+	assert.Equal(t, int64(2), coalesced.Load())
+}
+
+func TestShardCollection_Spill(t *testing.T) {
+	entry := []byte("spilled entry")
+	size := int32(lengthPrefixSize + len(entry))
+
+	newCollection := func(t *testing.T, numShards int, selection ShardSelection) (*ShardCollection, chan *Shard) {
+		t.Helper()
+		flushChan := make(chan *Shard, numShards)
+		sc, err := NewShardCollection(numShards*64*1024, numShards, flushChan)
+		require.NoError(t, err)
+		t.Cleanup(sc.Close)
+		sc.selection = selection
+		return sc, flushChan
+	}
+	// fill leaves free bytes in the shard's active buffer; an entry may fill it exactly
+	fill := func(shard *Shard, free int32) {
+		shard.offsetA.Store(shard.limit - free)
+	}
+
+	t.Run("exact fit in the next shard", func(t *testing.T) {
+		sc, flushChan := newCollection(t, 4, ShardSelectionRoundRobin)
+		var spilled atomic.Int64
+		sc.spilled = &spilled
+		fill(sc.GetShard(1), size-1) // One byte short: refused
+		fill(sc.GetShard(2), size)   // Fills the buffer exactly
+
+		n, _, shardID := sc.Write(entry) // Round-robin picks shard 1
+		assert.Equal(t, int(size), n)
+		assert.Equal(t, 2, shardID)
+		assert.Equal(t, sc.GetShard(2).limit, sc.GetShard(2).offsetA.Load())
+		assert.Equal(t, int64(1), sc.GetShard(1).spills.Load())
+		assert.Equal(t, int64(1), spilled.Load())
+
+		// The refusing shard is still enqueued for its swap
+		require.NotEmpty(t, flushChan)
+		assert.Same(t, sc.GetShard(1), <-flushChan)
+
+		// The spill does not advance the round-robin counter
+		assert.Equal(t, uint64(1), sc.nextShard.Load())
+	})
+
+	t.Run("wraps around the collection", func(t *testing.T) {
+		sc, _ := newCollection(t, 4, ShardSelectionRoundRobin)
+		sc.nextShard.Store(2)
+		fill(sc.GetShard(3), size-1)
+
+		n, _, shardID := sc.Write(entry)
+		assert.Equal(t, int(size), n)
+		assert.Equal(t, 0, shardID)
+	})
+
+	t.Run("probes are bounded", func(t *testing.T) {
+		sc, _ := newCollection(t, 8, ShardSelectionRoundRobin)
+		for i := 1; i <= 1+spillProbes; i++ {
+			fill(sc.GetShard(i), size-1)
+		}
+
+		n, needsFlush, shardID := sc.Write(entry)
+		assert.Zero(t, n)
+		assert.True(t, needsFlush)
+		assert.Equal(t, 1, shardID, "failure reports the chosen shard")
+		assert.Zero(t, sc.GetShard(2+spillProbes).writes.Load(), "shards past the probes are not tried")
+		assert.Zero(t, sc.GetShard(1).spills.Load())
+	})
+
+	t.Run("keyed entries stay on their shard", func(t *testing.T) {
+		sc, _ := newCollection(t, 4, ShardSelectionKeyHash)
+		const key = 42
+		home := int(mix64(key) % 4)
+		fill(sc.GetShard(home), size-1)
+
+		n, _, shardID := sc.writeEntry(nil, entry, 0, key, true)
+		assert.Zero(t, n)
+		assert.Equal(t, home, shardID)
+
+		// Unkeyed entries are random and spill as under the other strategies: every full shard
+		// is within spillProbes of the open one
+		for i := range sc.NumShards() {
+			fill(sc.GetShard(i), size-1)
+		}
+		open := (home + 1) % 4
+		fill(sc.GetShard(open), size)
+		n, _, shardID = sc.Write(entry)
+		assert.Equal(t, int(size), n)
+		assert.Equal(t, open, shardID)
+	})
+}
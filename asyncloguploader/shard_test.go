@@ -3,9 +3,11 @@ package asyncloguploader
 import (
 	"encoding/binary"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/neehar-mavuduru/logger-double-buffer/asyncloguploader/clock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -93,16 +95,59 @@ func TestShard_Write(t *testing.T) {
 		t.Fatal("Buffer should have filled")
 	})
 
-	t.Run("ReturnsZeroWhenShardMarkedForFlush", func(t *testing.T) {
+	t.Run("FlushThresholdUsesUsableCapacity", func(t *testing.T) {
+		shard, err := NewShard(4096, 1)
+		require.NoError(t, err)
+		defer shard.Close()
+
+		// Usable capacity excludes the header; threshold is 90% of it
+		usable := shard.Capacity() - headerOffset
+		threshold := usable * flushThresholdPct / 100
+		assert.Equal(t, threshold, shard.flushThreshold.Load())
+
+		// One byte short of the threshold: no flush requested
+		_, needsFlush := shard.Write(make([]byte, int(threshold)-1-4))
+		assert.False(t, needsFlush)
+		assert.Equal(t, threshold-1, shard.Offset()-headerOffset)
+		assert.InDelta(t, float64(threshold-1)/float64(usable)*100.0, shard.UtilizationPct(), 0.001)
+		assert.Less(t, shard.UtilizationPct(), float64(flushThresholdPct))
+
+		// Reaching the threshold requests a flush
+		_, needsFlush = shard.Write([]byte("x"))
+		assert.True(t, needsFlush)
+	})
+
+	t.Run("FlushThresholdPct", func(t *testing.T) {
+		for _, pct := range []int{50, 99} {
+			shard, err := NewShard(64*1024, 1)
+			require.NoError(t, err)
+			defer shard.Close()
+			shard.setFlushThresholdPct(pct)
+
+			usable := int64(shard.Capacity() - headerOffset)
+			threshold := int(usable * int64(pct) / 100)
+			_, needsFlush := shard.Write(make([]byte, threshold-1-lengthPrefixSize))
+			assert.False(t, needsFlush, "%d%%: one byte short", pct)
+			assert.False(t, shard.IsFull())
+
+			_, needsFlush = shard.Write([]byte("x"))
+			assert.True(t, needsFlush, "%d%%: threshold reached", pct)
+			assert.True(t, shard.IsFull())
+		}
+	})
+
+	t.Run("WritesToActiveBufferWhileShardMarkedForFlush", func(t *testing.T) {
 		shard, err := NewShard(1024*1024, 1)
 		require.NoError(t, err)
 		defer shard.Close()
 
+		// readyForFlush is left set after a swap while the other buffer flushes; only a full
+		// active buffer refuses writes (see ReturnsNeedsFlushWhenBufferFull)
 		shard.readyForFlush.Store(true)
 		n, needsFlush := shard.Write([]byte("test"))
 
-		assert.Equal(t, 0, n)
-		assert.True(t, needsFlush)
+		assert.Equal(t, lengthPrefixSize+4, n)
+		assert.False(t, needsFlush)
 	})
 
 	t.Run("HandlesEmptyData", func(t *testing.T) {
@@ -254,13 +299,31 @@ func TestShard_GetData(t *testing.T) {
 		require.NoError(t, err)
 		defer shard.Close()
 
-		// GetData with very short timeout
-		bufferData, allCompleted := shard.GetData(1 * time.Nanosecond)
+		// A write to the inactive buffer that never finishes; the timeout runs on the shard's clock
+		fake := clock.NewFake(testClockStart)
+		shard.clock = fake
+		shard.inflightB.Add(1)
 
-		// Should return data even if timeout (may be empty)
-		assert.NotNil(t, bufferData)
-		// May or may not be completed depending on timing
-		_ = allCompleted
+		type result struct {
+			data     []byte
+			complete bool
+		}
+		results := make(chan result, 1)
+		go func() {
+			data, complete := shard.GetData(100 * time.Millisecond)
+			results <- result{data, complete}
+		}()
+		select {
+		case <-results:
+			t.Fatal("GetData timed out before the clock reached the timeout")
+		case <-time.After(20 * time.Millisecond):
+		}
+		fake.Advance(100 * time.Millisecond)
+
+		// Should return data even on timeout
+		res := <-results
+		assert.NotNil(t, res.data)
+		assert.False(t, res.complete)
 	})
 }
 
@@ -367,3 +430,114 @@ func TestShard_HasData(t *testing.T) {
 		assert.True(t, shard.HasData())
 	})
 }
+
+// sealTimeout returns a seal-on-swap timeout of d, as a logger shares its FlushTimeout with shards
+func sealTimeout(d time.Duration) *atomic.Int64 {
+	timeout := new(atomic.Int64)
+	timeout.Store(int64(d))
+	return timeout
+}
+
+func TestShard_SealOnSwap(t *testing.T) {
+	t.Run("WriterSealsSwappedBuffer", func(t *testing.T) {
+		shard, err := NewShard(1024*1024, 1)
+		require.NoError(t, err)
+		defer shard.Close()
+		shard.reserveChecksumTrailer()
+		shard.enableSealOnSwap(sealTimeout(100*time.Millisecond), true)
+
+		shard.Write([]byte("first"))
+		shard.Write([]byte("second"))
+		offset := shard.Offset()
+		shard.swapIfFlushed()
+
+		sealed, ok := shard.takeSealed()
+		require.True(t, ok)
+		assert.Equal(t, &shard.bufferA, sealed.buf)
+		assert.Equal(t, offset-headerOffset, sealed.dataBytes)
+		assert.Equal(t, int64(2), sealed.entries)
+		assert.True(t, sealed.complete)
+
+		header := firstShard(t, sealed.data)
+		assert.Equal(t, int64(shard.Capacity()), header.Capacity)
+		assert.Equal(t, int64(sealed.dataBytes), header.ValidDataBytes)
+		assert.Equal(t, formatVersionChecksum, header.Version)
+		assert.False(t, header.BadChecksum)
+
+		// Taking clears the sealed state
+		_, ok = shard.takeSealed()
+		assert.False(t, ok)
+	})
+
+	t.Run("TrySwapDoesNotSeal", func(t *testing.T) {
+		shard, err := NewShard(1024*1024, 1)
+		require.NoError(t, err)
+		defer shard.Close()
+		shard.enableSealOnSwap(sealTimeout(100*time.Millisecond), false)
+
+		shard.Write([]byte("test"))
+		shard.trySwap()
+
+		_, ok := shard.takeSealed()
+		assert.False(t, ok)
+	})
+
+	t.Run("ResetDiscardsSealedBuffer", func(t *testing.T) {
+		shard, err := NewShard(1024*1024, 1)
+		require.NoError(t, err)
+		defer shard.Close()
+		shard.enableSealOnSwap(sealTimeout(100*time.Millisecond), false)
+
+		shard.Write([]byte("test"))
+		shard.swapIfFlushed()
+		shard.resetBuffers([]*[]byte{&shard.bufferA})
+
+		_, ok := shard.takeSealed()
+		assert.False(t, ok)
+	})
+
+	t.Run("StaleSealIsNotTaken", func(t *testing.T) {
+		shard, err := NewShard(1024*1024, 1)
+		require.NoError(t, err)
+		defer shard.Close()
+		shard.enableSealOnSwap(sealTimeout(100*time.Millisecond), false)
+
+		// Seal A, then swap back so A is active again: the seal no longer describes the inactive buffer
+		shard.Write([]byte("test"))
+		shard.swapIfFlushed()
+		shard.mu.Lock()
+		shard.offsetA.Store(headerOffset)
+		shard.mu.Unlock()
+		shard.trySwap()
+
+		_, ok := shard.takeSealed()
+		assert.False(t, ok)
+	})
+
+	t.Run("SwapWaitsForReservedWrites", func(t *testing.T) {
+		shard, err := NewShard(1024*1024, 1)
+		require.NoError(t, err)
+		defer shard.Close()
+		shard.enableSealOnSwap(sealTimeout(time.Second), false)
+
+		// A writer registered on bufferA but not finished must be included before sealing
+		shard.inflightA.Add(1)
+		shard.Write([]byte("test"))
+		done := make(chan struct{})
+		go func() {
+			shard.swapIfFlushed()
+			close(done)
+		}()
+		select {
+		case <-done:
+			t.Fatal("seal did not wait for the in-flight write")
+		case <-time.After(20 * time.Millisecond):
+		}
+		shard.inflightA.Add(-1)
+		<-done
+
+		sealed, ok := shard.takeSealed()
+		require.True(t, ok)
+		assert.True(t, sealed.complete)
+	})
+}
@@ -0,0 +1,432 @@
+package asyncloguploader
+
+import (
+	"os"
+	"runtime"
+	"time"
+)
+
+// maxSnapshotRetries bounds how long loadStats waits for an in-flight write to be counted
+const maxSnapshotRetries = 100
+
+// ShardStats holds per-shard buffer statistics
+type ShardStats struct {
+	ID             uint32
+	Capacity       int32   // Per-buffer capacity in bytes (includes the 8-byte header reservation)
+	ActiveBytes    int32   // Data bytes in the active buffer (excluding header)
+	InactiveBytes  int32   // Data bytes in the inactive buffer awaiting flush (excluding header)
+	UtilizationPct float64 // ActiveBytes as a percentage of usable capacity (Capacity - 8)
+	ReadyForFlush  bool
+	Writes         int64 // Entries written since the logger started, to check ShardSelection balance
+	Drops          int64 // Entries dropped because both buffers were full (part of DroppedLogs)
+	Swaps          int64 // Buffer swaps (each hands a filled buffer to the flush worker)
+
+	// Write-path breakdown of the shard (part of RetryPathWrites and RetryTimeouts)
+	// Drops concentrated on one shard point at skewed ShardSelection; drops spread evenly over
+	// all shards at an undersized buffer
+	RetryPathWrites int64 // Writes that found the shard full and waited for its swap permit
+	RetryTimeouts   int64 // Retry-path writes dropped because the permit wasn't acquired in time (also in Drops)
+	Spills          int64 // Entries the shard had no space for that a following shard took (part of SpilledWrites)
+}
+
+// Snapshot is a point-in-time view of every logger statistics family
+//
+// All values come from a single pass over the logger's counters and shards, so every output
+// channel built from one Snapshot agrees on the numbers. Counters are read in dependency order
+// so derived ratios stay bounded even under load:
+//   - DroppedLogs + OversizedLogs + CancelledLogs <= TotalLogs and FreeSpaceDrops + DiskFullDrops <= DroppedLogs
+//   - BytesFlushed <= BytesWritten and BytesDurable <= BytesBuffered
+//   - BufferedBytes <= BufferCapacity and every UtilizationPct <= 100
+//
+// Across families (e.g. counters vs. shard offsets) the residual skew is at most CaptureDuration.
+type Snapshot struct {
+	Sequence        uint64        // Monotonic per logger; a gap or repeat means a torn or duplicate read
+	Timestamp       time.Time     // When the capture started
+	CaptureDuration time.Duration // Upper bound on skew between values in this snapshot
+
+	Stats        StatsSnapshot
+	FlushMetrics FlushMetrics // Derived from Stats
+
+	Shards         []ShardStats
+	BufferedBytes  int64 // Data bytes in all shard buffers (active + inactive)
+	BufferCapacity int64 // Usable bytes across all shard buffers (both halves of each double buffer)
+	BufferSize     int64 // Current buffer size as in Config.BufferSize (changes with MaxBufferSize auto-resize)
+
+	IOBackend      IOBackend
+	PreallocMethod PreallocMethod   // How the current file was preallocated (see Logger.PreallocMethod)
+	Degraded       bool             // Rejecting new logs: low free space or DiskFull
+	DiskFull       bool             // A disk-full flush is being retried (see Logger.IsDiskFull)
+	FreeSpace      *FreeSpaceStatus // Nil when free-space monitoring is not configured
+
+	PendingUploads int64 // Rotated files of this logger queued and not yet uploaded (zero without UploadTracker)
+}
+
+// Snapshot captures all statistics families in one pass
+func (l *Logger) Snapshot() Snapshot {
+	start := time.Now()
+
+	snap := Snapshot{
+		Sequence:       l.snapshotSeq.Add(1),
+		Timestamp:      start,
+		Stats:          l.loadStats(),
+		IOBackend:      l.IOBackend(),
+		PreallocMethod: l.PreallocMethod(),
+		Degraded:       l.IsDegraded(),
+		DiskFull:       l.IsDiskFull(),
+	}
+	snap.FlushMetrics = flushMetricsFrom(snap.Stats)
+
+	sc := l.shardCollection.Load()
+	snap.BufferSize = int64(sc.BufferSize())
+	snap.Shards = collectShardStats(sc)
+	for _, stats := range snap.Shards {
+		snap.BufferedBytes += int64(stats.ActiveBytes) + int64(stats.InactiveBytes)
+		snap.BufferCapacity += 2 * int64(stats.Capacity-headerOffset)
+	}
+
+	if status, ok := l.GetFreeSpaceStatus(); ok {
+		snap.FreeSpace = &status
+	}
+	if tracker := l.config.UploadTracker; tracker != nil {
+		snap.PendingUploads = int64(len(tracker.pendingMatching(l.ownsRotatedFile)))
+	}
+
+	snap.CaptureDuration = time.Since(start)
+	return snap
+}
+
+// FileStats describes a logger's current file and its rotated files awaiting upload
+type FileStats struct {
+	CurrentFile      string    // File being written (with FlushConcurrency, the first worker's segment)
+	CurrentFileBytes int64     // Bytes written to CurrentFile, including its file header
+	LastRotation     time.Time // When the last rotation completed (zero if the logger has not rotated)
+
+	// Rotated files queued for upload and not yet uploaded, from Config.UploadTracker (zero without it)
+	PendingUploads     int
+	PendingUploadBytes int64
+}
+
+// GetFileStats returns the logger's current file and the rotated files it has pending upload
+func (l *Logger) GetFileStats() FileStats {
+	var stats FileStats
+	if w, ok := l.groups[0].fileWriter.(*SizeFileWriter); ok {
+		stats.CurrentFile, stats.CurrentFileBytes, stats.LastRotation = w.currentFile()
+	}
+	if tracker := l.config.UploadTracker; tracker != nil {
+		pending := tracker.pendingMatching(l.ownsRotatedFile)
+		stats.PendingUploads = len(pending)
+		for _, path := range pending {
+			// A file may be uploaded and deleted meanwhile
+			if info, err := os.Stat(path); err == nil {
+				stats.PendingUploadBytes += info.Size()
+			}
+		}
+	}
+	return stats
+}
+
+// ownsRotatedFile reports whether path is a rotated file of one of the logger's file series
+func (l *Logger) ownsRotatedFile(path string) bool {
+	for _, g := range l.groups {
+		if w, ok := g.fileWriter.(*SizeFileWriter); ok && isRotatedFileOf(w, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetShardStats returns per-shard statistics of the current shards, to check shard balance
+// Utilization excludes the 8-byte header reservation (see ShardStats)
+func (l *Logger) GetShardStats() []ShardStats {
+	return collectShardStats(l.shardCollection.Load())
+}
+
+// collectShardStats returns the statistics of every shard in sc
+func collectShardStats(sc *ShardCollection) []ShardStats {
+	shards := sc.Shards()
+	stats := make([]ShardStats, 0, len(shards))
+	for _, shard := range shards {
+		stats = append(stats, shard.stats())
+	}
+	return stats
+}
+
+// loadStats reads all counters in one pass, ordered so derived invariants hold
+// LogBytes increments TotalLogs before DroppedLogs (and DroppedLogs before FreeSpaceDrops and DiskFullDrops),
+// so reading in the reverse order never observes a drop without its attempt
+func (l *Logger) loadStats() StatsSnapshot {
+	var s StatsSnapshot
+	s.FreeSpaceDrops = l.stats.FreeSpaceDrops.Load()
+	s.DiskFullDrops = l.stats.DiskFullDrops.Load()
+	s.DroppedLogs = l.stats.DroppedLogs.Load()
+	s.OversizedLogs = l.stats.OversizedLogs.Load()
+	s.CancelledLogs = l.stats.CancelledLogs.Load()
+	s.SampledOutLogs = l.stats.SampledOutLogs.Load()
+	s.RateLimitedLogs = l.stats.RateLimitedLogs.Load()
+	s.DrainRejectedLogs = l.stats.DrainRejectedLogs.Load()
+	s.ChunkedLogs = l.stats.ChunkedLogs.Load()
+	s.TotalLogs = l.stats.TotalLogs.Load()
+
+	// A flush can pick up a write that LogBytes has not counted yet; the window is a few
+	// instructions, so briefly wait for BytesWritten to catch up rather than report flushed > written
+	s.BytesFlushed = l.stats.BytesFlushed.Load()
+	s.BytesWritten = l.stats.BytesWritten.Load()
+	for i := 0; s.BytesWritten < s.BytesFlushed && i < maxSnapshotRetries; i++ {
+		runtime.Gosched()
+		s.BytesWritten = l.stats.BytesWritten.Load()
+	}
+	s.BytesDurable = l.stats.BytesDurable.Load()
+	s.HeaderBytesFlushed = l.stats.HeaderBytesFlushed.Load()
+	s.PaddingBytesFlushed = l.stats.PaddingBytesFlushed.Load()
+	s.BytesBuffered = l.stats.BytesBuffered.Load()
+	for i := 0; s.BytesBuffered < s.BytesDurable && i < maxSnapshotRetries; i++ {
+		runtime.Gosched()
+		s.BytesBuffered = l.stats.BytesBuffered.Load()
+	}
+
+	s.Flushes = l.stats.Flushes.Load()
+	s.FlushErrors = l.stats.FlushErrors.Load()
+	s.FlushRetries = l.stats.FlushRetries.Load()
+	s.TotalFlushDuration = l.stats.TotalFlushDuration.Load()
+	s.MaxFlushDuration = l.stats.MaxFlushDuration.Load()
+	s.FlushQueueDepth = l.stats.FlushQueueDepth.Load()
+	s.BlockedSwaps = l.stats.BlockedSwaps.Load()
+	s.EarlyFlushes = l.stats.EarlyFlushes.Load()
+	s.IntervalFlushes = l.stats.IntervalFlushes.Load()
+	s.FlushesCoalesced = l.stats.FlushesCoalesced.Load()
+	s.PresealedBuffers = l.stats.PresealedBuffers.Load()
+	s.PartialFlushes = l.stats.PartialFlushes.Load()
+	s.LastPartialFlushUnixNano = l.stats.LastPartialFlushUnixNano.Load()
+	s.BufferGrowths = l.stats.BufferGrowths.Load()
+	s.BufferShrinks = l.stats.BufferShrinks.Load()
+	s.RetentionFilesDeleted = l.stats.RetentionFilesDeleted.Load()
+	s.RetentionBytesReclaimed = l.stats.RetentionBytesReclaimed.Load()
+	s.CompressedFiles = l.stats.CompressedFiles.Load()
+	s.CompressionFailures = l.stats.CompressionFailures.Load()
+	s.CompressionBytesIn = l.stats.CompressionBytesIn.Load()
+	s.CompressionBytesOut = l.stats.CompressionBytesOut.Load()
+	s.TotalCompressionDuration = l.stats.TotalCompressionDuration.Load()
+	s.TotalWriteDuration = l.stats.TotalWriteDuration.Load()
+	s.MaxWriteDuration = l.stats.MaxWriteDuration.Load()
+	s.TotalPwritevDuration = l.stats.TotalPwritevDuration.Load()
+	s.MaxPwritevDuration = l.stats.MaxPwritevDuration.Load()
+	s.FastPathWrites = l.stats.FastPathWrites.Load()
+	s.RetryPathWrites = l.stats.RetryPathWrites.Load()
+	s.RetryTimeouts = l.stats.RetryTimeouts.Load()
+	s.SpilledWrites = l.stats.SpilledWrites.Load()
+	s.TotalSubmitDuration = l.stats.TotalSubmitDuration.Load()
+	s.MaxSubmitDuration = l.stats.MaxSubmitDuration.Load()
+	s.TotalCompletionDuration = l.stats.TotalCompletionDuration.Load()
+	s.MaxCompletionDuration = l.stats.MaxCompletionDuration.Load()
+	s.WriteLatency = l.stats.WriteLatency.load()
+	return s
+}
+
+// stats returns the shard's buffer statistics (offsets clamped to the usable range)
+func (s *Shard) stats() ShardStats {
+	usable := s.capacity - headerOffset
+	active := clampDataBytes(s.Offset()-headerOffset, usable)
+	inactive := clampDataBytes(s.GetInactiveOffset()-headerOffset, usable)
+	return ShardStats{
+		ID:             s.id,
+		Capacity:       s.capacity,
+		ActiveBytes:    active,
+		InactiveBytes:  inactive,
+		UtilizationPct: utilizationPct(active, s.capacity),
+		ReadyForFlush:  s.readyForFlush.Load(),
+		Writes:         s.writes.Load(),
+		Drops:          s.drops.Load(),
+		Swaps:          s.swaps.Load(),
+
+		RetryPathWrites: s.retries.Load(),
+		RetryTimeouts:   s.retryTimeouts.Load(),
+		Spills:          s.spills.Load(),
+	}
+}
+
+// countDrop counts an entry the shard refused (s may be nil when the shard is unknown)
+func (s *Shard) countDrop() {
+	if s != nil {
+		s.drops.Add(1)
+	}
+}
+
+// clampDataBytes bounds a data size to [0, usable]
+func clampDataBytes(dataBytes, usable int32) int32 {
+	if dataBytes < 0 {
+		return 0
+	}
+	if dataBytes > usable {
+		return usable
+	}
+	return dataBytes
+}
+
+// ManagerSnapshot is a point-in-time view of all event loggers managed by a LoggerManager
+// Aggregate sums per-event counters (Max* fields take the maximum); each per-event Snapshot
+// keeps its own invariants, so the sums keep them too
+type ManagerSnapshot struct {
+	Sequence        uint64
+	Timestamp       time.Time
+	CaptureDuration time.Duration
+
+	Aggregate    StatsSnapshot // Includes logs refused by event guardrails or Drain, and evicted loggers' final counters
+	FlushMetrics FlushMetrics  // Derived from Aggregate
+
+	BufferedBytes  int64
+	BufferCapacity int64
+	BufferSize     int64
+	PendingUploads int64
+
+	RejectedEventDrops   int64
+	MaxEventLoggersDrops int64
+	EvictedEventLoggers  int64
+
+	Events map[string]Snapshot // Per-event snapshots keyed by sanitized event name
+}
+
+// Snapshot captures all event loggers in one pass
+func (lm *LoggerManager) Snapshot() ManagerSnapshot {
+	start := time.Now()
+
+	snap := ManagerSnapshot{
+		Sequence:  lm.snapshotSeq.Add(1),
+		Timestamp: start,
+		Events:    make(map[string]Snapshot),
+	}
+	lm.retiredMu.RLock()
+	defer lm.retiredMu.RUnlock()
+
+	snap.RejectedEventDrops, snap.MaxEventLoggersDrops = lm.GetEventRejectStats()
+	snap.EvictedEventLoggers = lm.evictions.Load()
+	snap.Aggregate = lm.retired
+	snap.Aggregate.TotalLogs += snap.RejectedEventDrops + snap.MaxEventLoggersDrops
+	snap.Aggregate.DroppedLogs += snap.RejectedEventDrops + snap.MaxEventLoggersDrops
+	snap.Aggregate.DrainRejectedLogs += lm.drainRejected.Load()
+
+	lm.rangeUserLoggers(func(eventName string, logger *Logger) bool {
+		eventSnap := logger.Snapshot()
+		snap.Events[eventName] = eventSnap
+		addStats(&snap.Aggregate, eventSnap.Stats)
+		snap.BufferedBytes += eventSnap.BufferedBytes
+		snap.BufferCapacity += eventSnap.BufferCapacity
+		snap.BufferSize += eventSnap.BufferSize
+		snap.PendingUploads += eventSnap.PendingUploads
+		return true
+	})
+	snap.FlushMetrics = flushMetricsFrom(snap.Aggregate)
+
+	snap.CaptureDuration = time.Since(start)
+	return snap
+}
+
+// addStats adds counters from src into dst (Max* fields and LastPartialFlushUnixNano take the maximum)
+func addStats(dst *StatsSnapshot, src StatsSnapshot) {
+	dst.TotalLogs += src.TotalLogs
+	dst.DroppedLogs += src.DroppedLogs
+	dst.BytesWritten += src.BytesWritten
+	dst.BytesFlushed += src.BytesFlushed
+	dst.BytesBuffered += src.BytesBuffered
+	dst.BytesDurable += src.BytesDurable
+	dst.HeaderBytesFlushed += src.HeaderBytesFlushed
+	dst.PaddingBytesFlushed += src.PaddingBytesFlushed
+	dst.Flushes += src.Flushes
+	dst.FlushErrors += src.FlushErrors
+	dst.TotalFlushDuration += src.TotalFlushDuration
+	dst.MaxFlushDuration = max(dst.MaxFlushDuration, src.MaxFlushDuration)
+	dst.FlushQueueDepth += src.FlushQueueDepth
+	dst.BlockedSwaps += src.BlockedSwaps
+	dst.EarlyFlushes += src.EarlyFlushes
+	dst.IntervalFlushes += src.IntervalFlushes
+	dst.FlushesCoalesced += src.FlushesCoalesced
+	dst.PresealedBuffers += src.PresealedBuffers
+	dst.PartialFlushes += src.PartialFlushes
+	dst.LastPartialFlushUnixNano = max(dst.LastPartialFlushUnixNano, src.LastPartialFlushUnixNano)
+	dst.BufferGrowths += src.BufferGrowths
+	dst.BufferShrinks += src.BufferShrinks
+	dst.TotalWriteDuration += src.TotalWriteDuration
+	dst.MaxWriteDuration = max(dst.MaxWriteDuration, src.MaxWriteDuration)
+	dst.TotalPwritevDuration += src.TotalPwritevDuration
+	dst.MaxPwritevDuration = max(dst.MaxPwritevDuration, src.MaxPwritevDuration)
+	dst.FreeSpaceDrops += src.FreeSpaceDrops
+	dst.DiskFullDrops += src.DiskFullDrops
+	dst.FlushRetries += src.FlushRetries
+	dst.RetentionFilesDeleted += src.RetentionFilesDeleted
+	dst.RetentionBytesReclaimed += src.RetentionBytesReclaimed
+	dst.CompressedFiles += src.CompressedFiles
+	dst.CompressionFailures += src.CompressionFailures
+	dst.CompressionBytesIn += src.CompressionBytesIn
+	dst.CompressionBytesOut += src.CompressionBytesOut
+	dst.TotalCompressionDuration += src.TotalCompressionDuration
+	dst.FastPathWrites += src.FastPathWrites
+	dst.RetryPathWrites += src.RetryPathWrites
+	dst.RetryTimeouts += src.RetryTimeouts
+	dst.SpilledWrites += src.SpilledWrites
+	dst.OversizedLogs += src.OversizedLogs
+	dst.ChunkedLogs += src.ChunkedLogs
+	dst.CancelledLogs += src.CancelledLogs
+	dst.SampledOutLogs += src.SampledOutLogs
+	dst.RateLimitedLogs += src.RateLimitedLogs
+	dst.DrainRejectedLogs += src.DrainRejectedLogs
+	dst.TotalSubmitDuration += src.TotalSubmitDuration
+	dst.MaxSubmitDuration = max(dst.MaxSubmitDuration, src.MaxSubmitDuration)
+	dst.TotalCompletionDuration += src.TotalCompletionDuration
+	dst.MaxCompletionDuration = max(dst.MaxCompletionDuration, src.MaxCompletionDuration)
+	dst.WriteLatency.add(src.WriteLatency)
+}
+
+// subStats returns the counters accumulated between base and current
+// Max* fields are left zero (lifetime maxima cannot be subtracted); FlushQueueDepth, a gauge, and
+// LastPartialFlushUnixNano, a timestamp, keep their current values
+func subStats(current, base StatsSnapshot) StatsSnapshot {
+	d := StatsSnapshot{
+		TotalLogs:                current.TotalLogs - base.TotalLogs,
+		DroppedLogs:              current.DroppedLogs - base.DroppedLogs,
+		BytesWritten:             current.BytesWritten - base.BytesWritten,
+		BytesFlushed:             current.BytesFlushed - base.BytesFlushed,
+		BytesBuffered:            current.BytesBuffered - base.BytesBuffered,
+		BytesDurable:             current.BytesDurable - base.BytesDurable,
+		HeaderBytesFlushed:       current.HeaderBytesFlushed - base.HeaderBytesFlushed,
+		PaddingBytesFlushed:      current.PaddingBytesFlushed - base.PaddingBytesFlushed,
+		Flushes:                  current.Flushes - base.Flushes,
+		FlushErrors:              current.FlushErrors - base.FlushErrors,
+		TotalFlushDuration:       current.TotalFlushDuration - base.TotalFlushDuration,
+		FlushQueueDepth:          current.FlushQueueDepth,
+		BlockedSwaps:             current.BlockedSwaps - base.BlockedSwaps,
+		EarlyFlushes:             current.EarlyFlushes - base.EarlyFlushes,
+		IntervalFlushes:          current.IntervalFlushes - base.IntervalFlushes,
+		FlushesCoalesced:         current.FlushesCoalesced - base.FlushesCoalesced,
+		PresealedBuffers:         current.PresealedBuffers - base.PresealedBuffers,
+		PartialFlushes:           current.PartialFlushes - base.PartialFlushes,
+		LastPartialFlushUnixNano: current.LastPartialFlushUnixNano,
+		BufferGrowths:            current.BufferGrowths - base.BufferGrowths,
+		BufferShrinks:            current.BufferShrinks - base.BufferShrinks,
+		TotalWriteDuration:       current.TotalWriteDuration - base.TotalWriteDuration,
+		TotalPwritevDuration:     current.TotalPwritevDuration - base.TotalPwritevDuration,
+		FreeSpaceDrops:           current.FreeSpaceDrops - base.FreeSpaceDrops,
+		DiskFullDrops:            current.DiskFullDrops - base.DiskFullDrops,
+		FlushRetries:             current.FlushRetries - base.FlushRetries,
+		RetentionFilesDeleted:    current.RetentionFilesDeleted - base.RetentionFilesDeleted,
+		RetentionBytesReclaimed:  current.RetentionBytesReclaimed - base.RetentionBytesReclaimed,
+		CompressedFiles:          current.CompressedFiles - base.CompressedFiles,
+		CompressionFailures:      current.CompressionFailures - base.CompressionFailures,
+		CompressionBytesIn:       current.CompressionBytesIn - base.CompressionBytesIn,
+		CompressionBytesOut:      current.CompressionBytesOut - base.CompressionBytesOut,
+		TotalCompressionDuration: current.TotalCompressionDuration - base.TotalCompressionDuration,
+		FastPathWrites:           current.FastPathWrites - base.FastPathWrites,
+		RetryPathWrites:          current.RetryPathWrites - base.RetryPathWrites,
+		RetryTimeouts:            current.RetryTimeouts - base.RetryTimeouts,
+		SpilledWrites:            current.SpilledWrites - base.SpilledWrites,
+		OversizedLogs:            current.OversizedLogs - base.OversizedLogs,
+		ChunkedLogs:              current.ChunkedLogs - base.ChunkedLogs,
+		CancelledLogs:            current.CancelledLogs - base.CancelledLogs,
+		SampledOutLogs:           current.SampledOutLogs - base.SampledOutLogs,
+		RateLimitedLogs:          current.RateLimitedLogs - base.RateLimitedLogs,
+		DrainRejectedLogs:        current.DrainRejectedLogs - base.DrainRejectedLogs,
+		TotalSubmitDuration:      current.TotalSubmitDuration - base.TotalSubmitDuration,
+		TotalCompletionDuration:  current.TotalCompletionDuration - base.TotalCompletionDuration,
+		WriteLatency:             current.WriteLatency,
+	}
+	d.WriteLatency.sub(base.WriteLatency)
+	return d
+}
@@ -0,0 +1,325 @@
+package asyncloguploader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// assertSnapshotInvariants checks the consistency guarantees documented on Snapshot
+func assertSnapshotInvariants(t *testing.T, snap Snapshot) {
+	t.Helper()
+	stats := snap.Stats
+	assert.LessOrEqual(t, stats.DroppedLogs+stats.OversizedLogs, stats.TotalLogs, "seq %d: drops > total", snap.Sequence)
+	assert.LessOrEqual(t, stats.FreeSpaceDrops, stats.DroppedLogs, "seq %d: free-space drops > drops", snap.Sequence)
+	assert.LessOrEqual(t, stats.BytesFlushed, stats.BytesWritten, "seq %d: flushed > accepted", snap.Sequence)
+	assert.LessOrEqual(t, snap.BufferedBytes, snap.BufferCapacity, "seq %d: buffered > capacity", snap.Sequence)
+	for _, shard := range snap.Shards {
+		assert.GreaterOrEqual(t, shard.UtilizationPct, 0.0)
+		assert.LessOrEqual(t, shard.UtilizationPct, 100.0, "seq %d: shard %d utilization > 100%%", snap.Sequence, shard.ID)
+	}
+}
+
+// hammer logs from several goroutines until ctx is cancelled
+func hammer(ctx context.Context, wg *sync.WaitGroup, goroutines int, log func(g int, data []byte)) {
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			data := make([]byte, 512+g*64)
+			for ctx.Err() == nil {
+				log(g, data)
+			}
+		}(g)
+	}
+}
+
+func TestLogger_Snapshot(t *testing.T) {
+	t.Run("InvariantsHoldUnderLoad", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "snapshot.log"))
+		config.BufferSize = 512 * 1024 // Small buffers so drops and flushes both happen
+		config.NumShards = 4
+		config.FlushInterval = 10 * time.Millisecond
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		defer logger.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		var wg sync.WaitGroup
+		hammer(ctx, &wg, 8, func(g int, data []byte) { logger.LogBytes(data) })
+
+		var lastSeq uint64
+		snapshots := 0
+		for ctx.Err() == nil {
+			snap := logger.Snapshot()
+			assert.Greater(t, snap.Sequence, lastSeq, "sequence must be monotonic")
+			lastSeq = snap.Sequence
+			assert.Len(t, snap.Shards, config.NumShards)
+			assertSnapshotInvariants(t, snap)
+			snapshots++
+		}
+		wg.Wait()
+
+		final := logger.Snapshot()
+		assertSnapshotInvariants(t, final)
+		assert.Greater(t, final.Stats.Flushes, int64(0))
+		assert.Greater(t, snapshots, 10)
+	})
+
+	t.Run("FlushMetricsAgreeWithCounters", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "snapshot.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 4
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		defer logger.Close()
+
+		forceFlush(t, logger, config.NumShards, config.BufferSize)
+
+		snap := logger.Snapshot()
+		assert.Equal(t, flushMetricsFrom(snap.Stats), snap.FlushMetrics)
+		assert.Equal(t, logger.GetFlushMetrics(), snap.FlushMetrics)
+		assert.Equal(t, IOBackendPwritev, snap.IOBackend)
+		assert.Equal(t, PreallocNone, snap.PreallocMethod) // PreallocateFileSize is 0 by default
+		assert.Nil(t, snap.FreeSpace)
+		assert.False(t, snap.Timestamp.IsZero())
+	})
+}
+
+func TestLoggerManager_Snapshot(t *testing.T) {
+	config := DefaultConfig(filepath.Join(t.TempDir(), "events.log"))
+	config.BufferSize = 256 * 1024
+	config.NumShards = 2
+	config.FlushInterval = 10 * time.Millisecond
+	config.AllowedEvents = []string{"event-0", "event-1", "event-2"}
+
+	manager, err := NewLoggerManager(config)
+	require.NoError(t, err)
+	defer manager.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	var wg sync.WaitGroup
+	// Goroutine 3 logs to an event outside the allowlist
+	hammer(ctx, &wg, 4, func(g int, data []byte) {
+		manager.LogBytesWithEvent(fmt.Sprintf("event-%d", g), data)
+	})
+
+	var lastSeq uint64
+	for ctx.Err() == nil {
+		snap := manager.Snapshot()
+		assert.Greater(t, snap.Sequence, lastSeq)
+		lastSeq = snap.Sequence
+
+		assert.LessOrEqual(t, snap.Aggregate.DroppedLogs, snap.Aggregate.TotalLogs)
+		assert.LessOrEqual(t, snap.Aggregate.BytesFlushed, snap.Aggregate.BytesWritten)
+		assert.LessOrEqual(t, snap.BufferedBytes, snap.BufferCapacity)
+		assert.LessOrEqual(t, snap.RejectedEventDrops, snap.Aggregate.DroppedLogs)
+		for _, eventSnap := range snap.Events {
+			assertSnapshotInvariants(t, eventSnap)
+		}
+	}
+	wg.Wait()
+
+	final := manager.Snapshot()
+	assert.Len(t, final.Events, 3)
+	assert.Greater(t, final.RejectedEventDrops, int64(0))
+}
+
+func TestLogger_GetShardStats(t *testing.T) {
+	newShardStatsLogger := func(t *testing.T) *Logger {
+		t.Helper()
+		config := DefaultConfig(filepath.Join(t.TempDir(), "shards.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 1
+		config.FlushInterval = time.Hour
+		config.WriteRetryTimeout = 0
+
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		t.Cleanup(func() { logger.Close() })
+		return logger
+	}
+
+	t.Run("UtilizationExcludesHeaderReservation", func(t *testing.T) {
+		logger := newShardStatsLogger(t)
+		for i := 0; i < 10; i++ {
+			require.NoError(t, logger.TryLogBytes(make([]byte, 100)))
+		}
+
+		stats := logger.GetShardStats()
+		require.Len(t, stats, 1)
+		shard := stats[0]
+		assert.Equal(t, int32(1024*1024), shard.Capacity)
+		assert.Equal(t, int32(10*(lengthPrefixSize+100)), shard.ActiveBytes)
+		assert.Equal(t, int64(10), shard.Writes)
+		assert.InDelta(t, float64(10*(lengthPrefixSize+100))/float64(1024*1024-8)*100, shard.UtilizationPct, 1e-9)
+
+		// A buffer filled to capacity is 100% used: the header bytes are not counted as usable
+		s := logger.shardCollection.Load().GetShard(0)
+		s.offsetA.Store(s.capacity)
+		s.offsetB.Store(s.capacity)
+		assert.Equal(t, 100.0, logger.GetShardStats()[0].UtilizationPct)
+	})
+
+	t.Run("CountsDropsAndSwaps", func(t *testing.T) {
+		logger := newShardStatsLogger(t)
+		require.NoError(t, logger.TryLogBytes([]byte("flushed")))
+		require.NoError(t, logger.Flush(context.Background()))
+		assert.Equal(t, int64(1), logger.GetShardStats()[0].Swaps)
+
+		shard := logger.shardCollection.Load().GetShard(0)
+		shard.swapSemaphore <- struct{}{}
+		defer func() { <-shard.swapSemaphore }()
+		shard.offsetA.Store(shard.capacity)
+		shard.offsetB.Store(shard.capacity)
+		assert.ErrorIs(t, logger.TryLogBytes([]byte("full")), ErrBufferFull)
+
+		stats := logger.GetShardStats()[0]
+		assert.Equal(t, int64(1), stats.Drops)
+		assert.Equal(t, int64(1), stats.Writes)
+	})
+}
+
+func TestLogger_ShardDropAttribution(t *testing.T) {
+	// fillShard leaves no room in either buffer and takes the swap permit, so writes to the
+	// shard time out on the retry path and are dropped
+	fillShard := func(t *testing.T, shard *Shard) {
+		t.Helper()
+		shard.swapSemaphore <- struct{}{}
+		t.Cleanup(func() { <-shard.swapSemaphore })
+		shard.offsetA.Store(shard.capacity)
+		shard.offsetB.Store(shard.capacity)
+	}
+
+	t.Run("DropsLandOnThePinnedShard", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "pinned.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 4
+		config.ShardSelection = ShardSelectionKeyHash
+		config.FlushInterval = time.Hour
+		config.WriteRetryTimeout = 0
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		defer logger.Close()
+
+		// Key 7 is pinned to the hot shard; find a key on another shard
+		sc := logger.shardCollection.Load()
+		hot := sc.selectShard(7, true)
+		coldKey := uint64(8)
+		for sc.selectShard(coldKey, true) == hot {
+			coldKey++
+		}
+
+		fillShard(t, sc.GetShard(hot))
+		for i := 0; i < 5; i++ {
+			assert.ErrorIs(t, logger.TryLogBytesKeyed(7, []byte("dropped")), ErrBufferFull)
+		}
+		require.NoError(t, logger.TryLogBytesKeyed(coldKey, []byte("kept")))
+
+		var drops, retries, timeouts int64
+		for i, stats := range logger.GetShardStats() {
+			if i == hot {
+				assert.Equal(t, int64(5), stats.Drops)
+				assert.Equal(t, int64(5), stats.RetryPathWrites)
+				assert.Equal(t, int64(5), stats.RetryTimeouts)
+			} else {
+				assert.Zero(t, stats.Drops, "shard %d", i)
+				assert.Zero(t, stats.RetryPathWrites, "shard %d", i)
+				assert.Zero(t, stats.RetryTimeouts, "shard %d", i)
+			}
+			drops += stats.Drops
+			retries += stats.RetryPathWrites
+			timeouts += stats.RetryTimeouts
+		}
+
+		// The per-shard counters add up to the logger's
+		snap := logger.loadStats()
+		assert.Equal(t, snap.DroppedLogs, drops)
+		assert.Equal(t, snap.RetryPathWrites, retries)
+		assert.Equal(t, snap.RetryTimeouts, timeouts)
+	})
+
+	t.Run("ManagerReportsShardsPerEvent", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "events.log"))
+		config.BufferSize = 256 * 1024
+		config.NumShards = 1
+		config.FlushInterval = time.Hour
+		config.WriteRetryTimeout = 0
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+
+		require.NoError(t, manager.InitializeEventLogger("hot"))
+		require.NoError(t, manager.InitializeEventLogger("cold"))
+		hot, _ := manager.loggers.Load("hot")
+		fillShard(t, hot.(*Logger).shardCollection.Load().GetShard(0))
+
+		for i := 0; i < 3; i++ {
+			assert.ErrorIs(t, manager.TryLogBytesWithEvent("hot", []byte("dropped")), ErrBufferFull)
+		}
+		require.NoError(t, manager.TryLogBytesWithEvent("cold", []byte("kept")))
+
+		stats := manager.GetShardStatsByEvent()
+		require.Len(t, stats, 2)
+		assert.Equal(t, int64(3), stats["hot"][0].Drops)
+		assert.Equal(t, int64(3), stats["hot"][0].RetryTimeouts)
+		assert.Zero(t, stats["cold"][0].Drops)
+		assert.Equal(t, int64(1), stats["cold"][0].Writes)
+	})
+}
+
+func TestLogger_GetFileStats(t *testing.T) {
+	uploads := make(chan string, 10)
+	tracker := NewUploadTracker()
+
+	config := DefaultConfig(filepath.Join(t.TempDir(), "files.log"))
+	config.BufferSize = 1024 * 1024
+	config.NumShards = 2
+	config.MaxFileSize = 1024 * 1024
+	config.FlushInterval = time.Hour
+	config.UploadChannel = uploads
+	config.UploadTracker = tracker
+
+	logger, err := NewLogger(config)
+	require.NoError(t, err)
+	defer logger.Close()
+	fw := logger.groups[0].fileWriter.(*SizeFileWriter)
+
+	require.NoError(t, logger.TryLogBytes(make([]byte, 100)))
+	require.NoError(t, logger.Flush(context.Background()))
+
+	stats := logger.GetFileStats()
+	assert.Equal(t, fw.filePath, stats.CurrentFile)
+	assert.Greater(t, stats.CurrentFileBytes, int64(100))
+	assert.True(t, stats.LastRotation.IsZero())
+	assert.Zero(t, stats.PendingUploads)
+
+	fw.rotationMu.Lock()
+	require.NoError(t, fw.createNextFile())
+	require.NoError(t, fw.swapFiles())
+	fw.rotationMu.Unlock()
+	rotated := <-uploads
+	tracker.queued(rotated)
+
+	info, err := os.Stat(rotated)
+	require.NoError(t, err)
+	stats = logger.GetFileStats()
+	assert.NotEqual(t, rotated, stats.CurrentFile)
+	assert.False(t, stats.LastRotation.IsZero())
+	assert.Equal(t, 1, stats.PendingUploads)
+	assert.Equal(t, info.Size(), stats.PendingUploadBytes)
+
+	tracker.done(rotated)
+	assert.Zero(t, logger.GetFileStats().PendingUploads)
+}
@@ -0,0 +1,48 @@
+package testsupport_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asyncloguploader"
+	"github.com/neehar-mavuduru/logger-double-buffer/asyncloguploader/testsupport"
+)
+
+// handlePayment stands in for application code that logs through an injected logger
+func handlePayment(logger *asyncloguploader.Logger, amount int) {
+	logger.Log(fmt.Sprintf("payment amount=%d", amount))
+	if amount > 1000 {
+		logger.Log("payment flagged for review")
+	}
+}
+
+// A test asserts exactly what a handler logged, without reading log files
+func ExampleWriter() {
+	config := asyncloguploader.DefaultConfig("payments.log") // Validated, never written
+	config.BufferSize = 64 * 1024
+	config.NumShards = 1 // One shard keeps entries in logging order
+
+	w := testsupport.NewWriter()
+	logger, err := asyncloguploader.NewLoggerWithWriter(config, w)
+	if err != nil {
+		panic(err)
+	}
+	defer logger.Close()
+
+	handlePayment(logger, 2500)
+
+	// Entries become visible once flushed
+	if err := logger.Flush(context.Background()); err != nil {
+		panic(err)
+	}
+	entries, err := w.Strings()
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		fmt.Println(entry)
+	}
+	// Output:
+	// payment amount=2500
+	// payment flagged for review
+}
@@ -0,0 +1,182 @@
+package testsupport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asyncloguploader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultyFileWriter(t *testing.T) {
+	errDisk := errors.New("disk on fire")
+	ctx := context.Background()
+
+	// newFaultyLogger creates a one-shard logger that flushes to w only on demand
+	// OnFlushError reports are sent to the returned channel
+	newFaultyLogger := func(t *testing.T, w *FaultyFileWriter) (*asyncloguploader.Logger, <-chan *asyncloguploader.FlushError) {
+		t.Helper()
+		config := asyncloguploader.DefaultConfig(filepath.Join(t.TempDir(), "app.log"))
+		config.BufferSize = 64 * 1024
+		config.NumShards = 1
+		config.FlushInterval = time.Hour
+		flushErrs := make(chan *asyncloguploader.FlushError, 8)
+		config.OnFlushError = func(err *asyncloguploader.FlushError) { flushErrs <- err }
+		logger, err := asyncloguploader.NewLoggerWithWriter(config, w)
+		require.NoError(t, err)
+		return logger, flushErrs
+	}
+
+	// requireFlushError returns the OnFlushError report of a failed flush
+	requireFlushError := func(t *testing.T, flushErrs <-chan *asyncloguploader.FlushError, target error) *asyncloguploader.FlushError {
+		t.Helper()
+		select {
+		case err := <-flushErrs:
+			assert.ErrorIs(t, err, target)
+			assert.Equal(t, int64(1), err.Entries)
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("OnFlushError was not called")
+			return nil
+		}
+	}
+
+	t.Run("failed writes lose their flush and later flushes recover", func(t *testing.T) {
+		for name, w := range map[string]*FaultyFileWriter{
+			"write":    NewFaultyFileWriter().FailWrite(1, errDisk),
+			"rotation": NewFaultyFileWriter().FailRotation(1, errDisk),
+		} {
+			t.Run(name, func(t *testing.T) {
+				logger, flushErrs := newFaultyLogger(t, w)
+
+				logger.Log("lost")
+				err := logger.Flush(ctx)
+				assert.ErrorIs(t, err, errDisk)
+				if name == "rotation" {
+					assert.ErrorContains(t, err, "rotation failed")
+				}
+				flushErr := requireFlushError(t, flushErrs, errDisk)
+				assert.False(t, flushErr.Retained)
+				assert.False(t, flushErr.DiskFull)
+				assert.False(t, logger.IsDiskFull())
+
+				// The shard was reset: the failed entry is not written again
+				logger.Log("kept")
+				require.NoError(t, logger.Flush(ctx))
+				require.NoError(t, logger.Close())
+
+				entries, err := w.Strings()
+				require.NoError(t, err)
+				assert.Equal(t, []string{"kept"}, entries)
+				assert.Equal(t, 2, w.Calls())
+				assert.Equal(t, 1, w.Writes())
+
+				totalLogs, droppedLogs, _, flushes, flushErrors, _, bytesBuffered, bytesDurable := logger.GetStatsSnapshot()
+				assert.Equal(t, int64(2), totalLogs)
+				assert.Zero(t, droppedLogs)
+				assert.Equal(t, int64(1), flushes)
+				assert.Equal(t, int64(1), flushErrors)
+				assert.Equal(t, int64(len("lost")+len("kept")), bytesBuffered)
+				assert.Equal(t, int64(len("kept")), bytesDurable)
+			})
+		}
+	})
+
+	t.Run("disk full keeps the data for a retry", func(t *testing.T) {
+		w := NewFaultyFileWriter().FailWrite(1, syscall.ENOSPC)
+		logger, flushErrs := newFaultyLogger(t, w)
+
+		logger.Log("retained")
+		assert.ErrorIs(t, logger.Flush(ctx), syscall.ENOSPC)
+		flushErr := requireFlushError(t, flushErrs, syscall.ENOSPC)
+		assert.True(t, flushErr.DiskFull)
+		assert.True(t, flushErr.Retained)
+		assert.Equal(t, 1, flushErr.Attempt)
+
+		// The shard keeps its data and new logs are rejected until a write succeeds
+		assert.True(t, logger.IsDiskFull())
+		assert.ErrorIs(t, logger.TryLogBytes([]byte("rejected")), asyncloguploader.ErrDiskFull)
+		require.NoError(t, logger.Flush(ctx))
+		assert.False(t, logger.IsDiskFull())
+		require.NoError(t, logger.Close())
+
+		entries, err := w.Strings()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"retained"}, entries)
+
+		totalLogs, droppedLogs, _, flushes, flushErrors, _, _, bytesDurable := logger.GetStatsSnapshot()
+		assert.Equal(t, int64(2), totalLogs)
+		assert.Equal(t, int64(1), droppedLogs)
+		assert.Equal(t, int64(1), flushes)
+		assert.Equal(t, int64(1), flushErrors)
+		assert.Equal(t, int64(len("retained")), bytesDurable)
+	})
+
+	t.Run("short writes are flush errors", func(t *testing.T) {
+		w := NewFaultyFileWriter().ShortWrite(1, 100)
+		logger, flushErrs := newFaultyLogger(t, w)
+
+		logger.Log("cut short")
+		assert.ErrorIs(t, logger.Flush(ctx), io.ErrShortWrite)
+		assert.False(t, requireFlushError(t, flushErrs, io.ErrShortWrite).Retained)
+		assert.Len(t, w.Bytes(), 100)
+		require.NoError(t, logger.Close())
+
+		_, _, _, flushes, flushErrors, _, _, bytesDurable := logger.GetStatsSnapshot()
+		assert.Zero(t, flushes)
+		assert.Equal(t, int64(1), flushErrors)
+		assert.Zero(t, bytesDurable)
+		assert.Zero(t, logger.GetFlushMetrics().PayloadBytes)
+	})
+
+	t.Run("stalled writes delay the flush", func(t *testing.T) {
+		const stall = 50 * time.Millisecond
+		w := NewFaultyFileWriter().DelayWrite(1, stall)
+		logger, _ := newFaultyLogger(t, w)
+
+		logger.Log("slow")
+		short, cancel := context.WithTimeout(ctx, stall/5)
+		defer cancel()
+		assert.ErrorIs(t, logger.Flush(short), context.DeadlineExceeded)
+
+		// The flush completes in the background; Close waits for it
+		require.NoError(t, logger.Close())
+		entries, err := w.Strings()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"slow"}, entries)
+		assert.GreaterOrEqual(t, logger.GetFlushMetrics().MaxWriteDuration, stall)
+		_, _, _, flushes, flushErrors, _, _, _ := logger.GetStatsSnapshot()
+		assert.Equal(t, int64(1), flushes)
+		assert.Zero(t, flushErrors)
+	})
+
+	t.Run("close reports a failed final flush", func(t *testing.T) {
+		w := NewFaultyFileWriter().FailWrite(1, errDisk)
+		logger, flushErrs := newFaultyLogger(t, w)
+
+		logger.Log("unflushed")
+		report, err := logger.CloseWithTimeout(5 * time.Second)
+		assert.ErrorIs(t, err, errDisk)
+		assert.Equal(t, int64(1), report.EntriesDropped)
+		requireFlushError(t, flushErrs, errDisk)
+		assert.True(t, w.Closed())
+	})
+
+	t.Run("close reports a failed close", func(t *testing.T) {
+		w := NewFaultyFileWriter().FailClose(errDisk)
+		logger, _ := newFaultyLogger(t, w)
+
+		logger.Log("flushed")
+		assert.ErrorIs(t, logger.Close(), errDisk)
+		assert.True(t, w.Closed())
+		entries, err := w.Strings()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"flushed"}, entries)
+	})
+}
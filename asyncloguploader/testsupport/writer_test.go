@@ -0,0 +1,95 @@
+package testsupport
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asyncloguploader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLogger(t *testing.T, configure func(*asyncloguploader.Config)) (*asyncloguploader.Logger, *Writer, string) {
+	t.Helper()
+	dir := t.TempDir()
+	config := asyncloguploader.DefaultConfig(filepath.Join(dir, "app.log"))
+	config.BufferSize = 64 * 1024
+	config.NumShards = 1
+	if configure != nil {
+		configure(&config)
+	}
+	w := NewWriter()
+	logger, err := asyncloguploader.NewLoggerWithWriter(config, w)
+	require.NoError(t, err)
+	return logger, w, dir
+}
+
+func TestWriter(t *testing.T) {
+	t.Run("entries are visible after flush", func(t *testing.T) {
+		logger, w, dir := newTestLogger(t, func(c *asyncloguploader.Config) {
+			c.FlushConcurrency = 4 // Ignored: one worker writes to w
+		})
+
+		require.NoError(t, logger.TryLogBytes([]byte("first")))
+		logger.Log("second")
+		entries, err := w.Strings()
+		require.NoError(t, err)
+		assert.Empty(t, entries, "nothing is visible before a flush")
+
+		require.NoError(t, logger.Flush(context.Background()))
+		entries, err = w.Strings()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"first", "second"}, entries)
+		assert.Equal(t, 1, w.Writes())
+
+		require.NoError(t, logger.TryLogBytes([]byte("third")))
+		require.NoError(t, logger.Close())
+		assert.True(t, w.Closed())
+		entries, err = w.Strings()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"first", "second", "third"}, entries)
+
+		files, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, files, "the logger must not create files")
+	})
+
+	t.Run("chunked messages are reassembled", func(t *testing.T) {
+		logger, w, _ := newTestLogger(t, func(c *asyncloguploader.Config) {
+			c.AllowChunking = true
+			c.MaxMessageSize = 256 * 1024
+		})
+
+		big := bytes.Repeat([]byte("x"), 100*1024)
+		require.NoError(t, logger.TryLogBytes(big))
+		require.NoError(t, logger.Close())
+
+		entries, err := w.Entries()
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, big, entries[0])
+	})
+
+	t.Run("reset discards recorded data", func(t *testing.T) {
+		logger, w, _ := newTestLogger(t, nil)
+		defer logger.Close()
+
+		logger.Log("before")
+		require.NoError(t, logger.Flush(context.Background()))
+		w.Reset()
+		logger.Log("after")
+		require.NoError(t, logger.Flush(context.Background()))
+
+		entries, err := w.Strings()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"after"}, entries)
+	})
+
+	t.Run("nil writer is rejected", func(t *testing.T) {
+		_, err := asyncloguploader.NewLoggerWithWriter(asyncloguploader.DefaultConfig("app.log"), nil)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,123 @@
+package asyncloguploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrObjectNotFound is returned by UploadBackend.Stat for objects that do not exist
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectInfo describes a stored object, as returned by UploadBackend.Stat
+type ObjectInfo struct {
+	Size      int64
+	CRC32C    uint32 // Castagnoli checksum of the contents; valid only if HasCRC32C
+	HasCRC32C bool   // False for backends that do not store checksums (only the size is verified)
+}
+
+// UploadBackend stores the files an Uploader uploads
+// The Uploader owns retries, stats, the upload channel, verification and deleting local files; a backend only
+// moves bytes. Implementations: NewGCSBackend (used by NewUploader) and NewFileSystemBackend
+type UploadBackend interface {
+	// Upload stores the file at localPath as objectName, replacing any existing object
+	// Reading the file through ThrottledReader(ctx, ...) applies the Uploader's bandwidth limit
+	Upload(ctx context.Context, localPath, objectName string) error
+
+	// Stat returns the size and checksum of objectName, or ErrObjectNotFound
+	// Used to verify uploads (GCSUploadConfig.DeleteAfterUpload) and by recovery scans
+	// (GCSUploadConfig.RecoveryCheckExisting)
+	Stat(ctx context.Context, objectName string) (ObjectInfo, error)
+
+	// Close releases the backend's resources (called by Uploader.Stop)
+	Close() error
+}
+
+// fileSystemBackend copies files into a directory
+type fileSystemBackend struct {
+	dir string
+}
+
+// NewFileSystemBackend creates a backend that copies uploaded files into dir (objectName is the
+// path below dir, so ObjectPrefix may add subdirectories). For on-prem deployments and tests
+func NewFileSystemBackend(dir string) UploadBackend {
+	return &fileSystemBackend{dir: dir}
+}
+
+// Upload implements UploadBackend
+// The copy is written to a temporary file and renamed, so the object never appears partially written
+func (b *fileSystemBackend) Upload(ctx context.Context, localPath, objectName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	dst := filepath.Join(b.dir, filepath.FromSlash(objectName))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	in, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if _, err := io.Copy(tmp, ThrottledReader(ctx, in)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to copy file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync copy: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close copy: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return fmt.Errorf("failed to rename copy: %w", err)
+	}
+	return nil
+}
+
+// Stat implements UploadBackend
+// The checksum is computed by reading the copy back
+func (b *fileSystemBackend) Stat(ctx context.Context, objectName string) (ObjectInfo, error) {
+	size, crc, err := fileChecksum(filepath.Join(b.dir, filepath.FromSlash(objectName)))
+	if errors.Is(err, os.ErrNotExist) {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Size: size, CRC32C: crc, HasCRC32C: true}, nil
+}
+
+// Close implements UploadBackend
+func (b *fileSystemBackend) Close() error {
+	return nil
+}
+
+// fileChecksum returns the size and CRC32C of the file at path
+func fileChecksum(path string) (int64, uint32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	h := crc32.New(castagnoliTable)
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, 0, err
+	}
+	return size, h.Sum32(), nil
+}
@@ -0,0 +1,71 @@
+package asyncloguploader
+
+import (
+	"context"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSystemBackend(t *testing.T) {
+	t.Run("CopiesAndReportsChecksum", func(t *testing.T) {
+		dst := t.TempDir()
+		backend := NewFileSystemBackend(dst)
+		src := writeUploadFile(t, t.TempDir(), "app_1.log")
+
+		_, err := backend.Stat(context.Background(), "logs/app_1.log")
+		assert.ErrorIs(t, err, ErrObjectNotFound)
+
+		require.NoError(t, backend.Upload(context.Background(), src, "logs/app_1.log"))
+		data, err := os.ReadFile(filepath.Join(dst, "logs", "app_1.log"))
+		require.NoError(t, err)
+		assert.Equal(t, "log data", string(data))
+		assert.FileExists(t, src, "the uploader, not the backend, deletes the local file")
+
+		object, err := backend.Stat(context.Background(), "logs/app_1.log")
+		require.NoError(t, err)
+		assert.Equal(t, int64(len("log data")), object.Size)
+		assert.True(t, object.HasCRC32C)
+		assert.Equal(t, crc32.Checksum([]byte("log data"), castagnoliTable), object.CRC32C)
+
+		entries, err := os.ReadDir(filepath.Join(dst, "logs"))
+		require.NoError(t, err)
+		assert.Len(t, entries, 1, "no temporary files left behind")
+	})
+
+	t.Run("FailsForMissingFile", func(t *testing.T) {
+		backend := NewFileSystemBackend(t.TempDir())
+		assert.Error(t, backend.Upload(context.Background(), filepath.Join(t.TempDir(), "missing.log"), "missing.log"))
+	})
+
+	t.Run("UploadsLoggerFilesEndToEnd", func(t *testing.T) {
+		dst := t.TempDir()
+		uploader, err := NewUploaderWithBackend(GCSUploadConfig{ObjectPrefix: "events/", DeleteAfterUpload: true}, NewFileSystemBackend(dst))
+		require.NoError(t, err)
+		uploader.Start()
+
+		config := DefaultConfig(filepath.Join(t.TempDir(), "app.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 2
+		config.UploadChannel = uploader.GetUploadChannel()
+		config.UploadTracker = uploader.GetUploadTracker()
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		local := logger.groups[0].fileWriter.(*SizeFileWriter).filePath
+		for i := 0; i < 100; i++ {
+			logger.LogBytes([]byte{byte(i), 1, 2, 3, 4, 5, 6, 7})
+		}
+		require.NoError(t, logger.Close())
+		uploader.Stop()
+
+		assert.NoFileExists(t, local)
+		uploaded := filepath.Join(dst, "events", filepath.Base(local))
+		assert.Len(t, readSequences(t, uploaded), 100)
+		assert.Equal(t, int64(1), uploader.GetStats().Successful)
+		assert.Equal(t, 0, uploader.GetUploadTracker().PendingFiles())
+	})
+}
@@ -3,32 +3,90 @@ package asyncloguploader
 import (
 	"context"
 	"fmt"
-	"io"
-	"log"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
-
-	"cloud.google.com/go/storage"
-	"google.golang.org/api/option"
 )
 
 // Note: GCSUploadConfig is now defined in config.go
-// This file uses GCSUploadConfig from the config package
+// This file uses GCSUploadConfig from the config package; gcs_backend.go holds the GCS client code
 
-// Uploader handles uploading completed log files to GCS
+// Uploader handles uploading completed log files to GCS, or another UploadBackend
+// A failed upload is retried with jittered exponential backoff; the file waits on a timer, so other
+// files keep uploading meanwhile. With DeleteAfterUpload, an upload counts only once the stored object
+// matches the local file, which is then deleted. After MaxRetries the file is moved to DeadLetterDir (if set) and
+// reported on GetFailedFiles()
 type Uploader struct {
 	config      GCSUploadConfig
-	client      *storage.Client
+	backend     UploadBackend
 	uploadChan  chan string
+	eventChan   chan FileReadyEvent // Same queue as uploadChan, for loggers with FileEventChannel
+	retryChan   chan uploadJob      // Files whose backoff has elapsed
+	failedChan  chan FailedUpload   // Files given up on after all retries
+	doneChan    chan UploadCompletion
 	wg          sync.WaitGroup
 	ctx         context.Context
 	cancel      context.CancelFunc
 	uploadStats Stats
 	statsMu     sync.RWMutex
-	chunkMgr    *ChunkManager
-	stopOnce    sync.Once // Ensures Stop() is idempotent
+	stopOnce    sync.Once      // Ensures Stop() is idempotent
+	logger      InternalLogger // config.InternalLogger
+	tracker     *UploadTracker // Files queued for upload; cleared on success
+
+	// Recovery scans hold scanMu (read) while sending; stopping ends them early
+	scanMu   sync.RWMutex
+	stopping chan struct{}
+
+	// Optional per-file callback (e.g. for upload histograms); nil when unset
+	uploadObserver atomic.Pointer[func(UploadObservation)]
+
+	// Shared by every upload through the context passed to the backend (see ThrottledReader)
+	limiter *bandwidthLimiter
+}
+
+// uploadJob is a file waiting for its next upload attempt
+type uploadJob struct {
+	filePath string
+	event    string // From FileReadyEvent; empty for paths sent on the upload channel
+	attempts int    // Attempts made so far
+
+	// From FileReadyEvent, for the manifest (GCSUploadConfig.WriteManifests); zero for paths
+	rotatedAt time.Time
+	reason    FileReadyReason
+}
+
+// UploadObservation describes one file upload (after retries), as passed to an upload observer
+type UploadObservation struct {
+	FilePath string
+	Bytes    int64         // File size; zero when Err is set
+	Duration time.Duration // Successful attempt only (matches Stats.TotalDuration); zero when Err is set
+	Attempts int           // Attempts made, including the successful one
+	Err      error         // Final error after all retries (also counted in Stats.Failed)
+}
+
+// UploadCompletion describes a successfully uploaded file, as sent on GetCompletedUploads()
+type UploadCompletion struct {
+	FilePath string
+	Event    string        // FileReadyEvent.Event, or the event recorded in the tracker
+	Object   string        // Object name in the backend
+	Bytes    int64         // Size of the uploaded file
+	Duration time.Duration // Successful attempt, excluding verification (parallel uploads include it)
+	CRC32C   uint32        // Castagnoli checksum of the local file
+	Chunks   int           // Chunks uploaded in parallel (GCSUploadConfig.ParallelThreshold); 1 for a single stream
+	Verified bool          // Size and checksum checked against the stored object (DeleteAfterUpload, parallel uploads)
+	Deleted  bool          // Local file removed; false without DeleteAfterUpload or if the delete failed
+	Manifest string        // Object name of the manifest; empty without WriteManifests or if writing it failed
+}
+
+// FailedUpload is a file the uploader gave up on after all retries, as sent on GetFailedFiles()
+type FailedUpload struct {
+	FilePath       string // Path the file was queued with
+	DeadLetterPath string // Where the file was moved; empty without DeadLetterDir or if the move failed
+	Attempts       int
+	Err            error // Error of the last attempt
 }
 
 // Stats tracks upload statistics
@@ -36,12 +94,26 @@ type Stats struct {
 	TotalFiles        int64
 	Successful        int64
 	Failed            int64
+	RetriedUploads    int64 // Retry attempts scheduled after a failed attempt
+	DeadLettered      int64 // Failed files moved to DeadLetterDir
+	RecoveredFiles    int64 // Files queued by ScanAndEnqueue
+	VerifyFailures    int64 // Uploads whose stored object did not match the local file (retried)
+	ParallelUploads   int64 // Files uploaded in more than one chunk (GCSUploadConfig.ParallelThreshold)
+	ParallelChunks    int64 // Chunks of those files; ParallelChunks / ParallelUploads is the mean parallelism
+	ComposeFallbacks  int64 // Parallel uploads whose compose failed, uploaded again in a single stream
+	DeleteFailures    int64 // Verified uploads whose local file could not be deleted
+	Manifests         int64 // Manifests stored (GCSUploadConfig.WriteManifests)
+	ManifestFailures  int64 // Uploaded files whose manifest could not be stored
 	TotalBytes        int64
 	TotalDuration     time.Duration
 	LastUploadTime    time.Time
 	MinUploadDuration time.Duration
 	MaxUploadDuration time.Duration
 	AvgUploadDuration time.Duration
+
+	// Bandwidth of file reads by the backend (see ThrottledReader)
+	Throughput     float64 // Bytes per second read over the last second
+	BandwidthLimit int64   // Current MaxBandwidthBytesPerSec (0: unlimited; see SetBandwidthLimit)
 }
 
 // NewUploader creates a new GCS uploader service
@@ -50,41 +122,72 @@ func NewUploader(config GCSUploadConfig) (*Uploader, error) {
 		return nil, err
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-
-	// Create GCS client with gRPC pool
-	client, err := storage.NewClient(ctx,
-		option.WithGRPCConnectionPool(config.GRPCPoolSize),
-	)
+	backend, err := NewGCSBackend(context.Background(), config)
 	if err != nil {
-		cancel()
-		return nil, fmt.Errorf("failed to create storage client: %w", err)
+		return nil, err
+	}
+	return newUploader(config, backend), nil
+}
+
+// NewUploaderWithBackend creates an uploader that stores files through backend (e.g. S3, Azure, or
+// NewFileSystemBackend). The upload settings of config apply (retries, backoff, dead-letter and
+// recovery, channel size, ObjectPrefix), and ChunkSize and ParallelThreshold for a ComposingBackend;
+// Bucket and the other GCS-specific fields are ignored.
+// Stop closes the backend
+func NewUploaderWithBackend(config GCSUploadConfig, backend UploadBackend) (*Uploader, error) {
+	if backend == nil {
+		return nil, fmt.Errorf("backend is required")
 	}
+	if err := config.applyDefaults(); err != nil {
+		return nil, err
+	}
+	return newUploader(config, backend), nil
+}
 
+// newUploader creates an uploader for a validated config
+func newUploader(config GCSUploadConfig, backend UploadBackend) *Uploader {
+	limiter := newBandwidthLimiter(config.MaxBandwidthBytesPerSec)
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), bandwidthKey{}, limiter))
 	uploader := &Uploader{
 		config:     config,
-		client:     client,
+		backend:    backend,
 		uploadChan: make(chan string, config.ChannelBufferSize),
+		eventChan:  make(chan FileReadyEvent, config.ChannelBufferSize),
+		retryChan:  make(chan uploadJob),
+		failedChan: make(chan FailedUpload, config.ChannelBufferSize),
+		doneChan:   make(chan UploadCompletion, config.ChannelBufferSize),
+		stopping:   make(chan struct{}),
 		ctx:        ctx,
 		cancel:     cancel,
-		chunkMgr:   NewChunkManager(config.MaxChunksPerCompose),
+		logger:     config.InternalLogger,
+		tracker:    NewUploadTracker(),
+		limiter:    limiter,
 	}
-
-	return uploader, nil
+	return uploader
 }
 
-// Start starts the uploader service (reads from channel and uploads files)
+// Start starts the uploader service (reads from channel and uploads files) and queues the files
+// left in RecoveryDirs
 func (u *Uploader) Start() {
+	u.tracker.attach()
 	u.wg.Add(1)
 	go u.uploadWorker()
+	if len(u.config.RecoveryDirs) > 0 {
+		go u.recoverDirs()
+	}
 }
 
 // Stop stops the uploader service gracefully
+// Waits until every queued file has been uploaded or given up on, including files waiting to retry.
 // Safe to call multiple times (idempotent)
 func (u *Uploader) Stop() {
 	u.stopOnce.Do(func() {
-		// Close channel first to stop accepting new files
+		// End recovery scans, then close channels to stop accepting new files
+		close(u.stopping)
+		u.scanMu.Lock()
 		close(u.uploadChan)
+		close(u.eventChan)
+		u.scanMu.Unlock()
 
 		// Wait for upload worker to finish processing all files in channel
 		u.wg.Wait()
@@ -92,8 +195,10 @@ func (u *Uploader) Stop() {
 		// Now cancel context (this will cancel any ongoing uploads)
 		u.cancel()
 
-		// Close client
-		u.client.Close()
+		// Close backend (e.g. the GCS client)
+		if err := u.backend.Close(); err != nil {
+			u.logger.Printf("[WARNING] Failed to close upload backend: %v", err)
+		}
 	})
 }
 
@@ -102,6 +207,33 @@ func (u *Uploader) GetUploadChannel() chan<- string {
 	return u.uploadChan
 }
 
+// GetFileEventChannel returns the channel to set as Config.FileEventChannel
+// Files sent here are uploaded like paths sent to GetUploadChannel; their Event names the object
+// under ObjectNameTemplate
+func (u *Uploader) GetFileEventChannel() chan<- FileReadyEvent {
+	return u.eventChan
+}
+
+// GetFailedFiles returns the channel of files given up on after all retries, e.g. for alerting
+// Sends never block: when nobody drains the channel, further failures are only logged. Closed once
+// Stop returns
+func (u *Uploader) GetFailedFiles() <-chan FailedUpload {
+	return u.failedChan
+}
+
+// GetCompletedUploads returns the channel of successfully uploaded files, e.g. for auditing
+// Sends never block: completions are dropped while the channel is full. Closed once Stop returns
+func (u *Uploader) GetCompletedUploads() <-chan UploadCompletion {
+	return u.doneChan
+}
+
+// GetUploadTracker returns the tracker to set as Config.UploadTracker alongside Config.UploadChannel
+// Loggers mark the files they queue; the uploader clears each one once it is uploaded, so retention
+// (Config.MaxRotatedFiles, Config.MaxTotalLogBytes) never deletes a file before it reaches GCS
+func (u *Uploader) GetUploadTracker() *UploadTracker {
+	return u.tracker
+}
+
 // GetStats returns current upload statistics
 func (u *Uploader) GetStats() Stats {
 	u.statsMu.RLock()
@@ -112,289 +244,300 @@ func (u *Uploader) GetStats() Stats {
 	if stats.Successful > 0 && stats.TotalDuration > 0 {
 		stats.AvgUploadDuration = stats.TotalDuration / time.Duration(stats.Successful)
 	}
+	if u.limiter != nil {
+		stats.Throughput = u.limiter.throughput()
+		stats.BandwidthLimit = u.limiter.bytesPerSec.Load()
+	}
 
 	return stats
 }
 
-// uploadWorker reads from channel and uploads files
-func (u *Uploader) uploadWorker() {
-	defer u.wg.Done()
-
-	for filePath := range u.uploadChan {
-		if filePath == "" {
-			continue
-		}
-
-		log.Printf("[DEBUG] Processing file for upload: %s", filePath)
-
-		// Upload file with retries (stats are updated inside uploadFileWithRetry)
-		if err := u.uploadFileWithRetry(filePath); err != nil {
-			log.Printf("[ERROR] Failed to upload %s after %d retries: %v", filePath, u.config.MaxRetries, err)
-			u.statsMu.Lock()
-			u.uploadStats.Failed++
-			u.uploadStats.TotalFiles++
-			u.statsMu.Unlock()
-		} else {
-			log.Printf("[DEBUG] Successfully uploaded: %s", filePath)
-			u.statsMu.Lock()
-			u.uploadStats.Successful++
-			u.uploadStats.TotalFiles++
-			u.uploadStats.LastUploadTime = time.Now()
-			u.statsMu.Unlock()
-		}
+// SetUploadObserver registers fn to be called after every file upload completes or fails; nil removes it
+// fn runs on the uploading goroutine, so it must be fast, and concurrently with MaxConcurrentUploads > 1
+func (u *Uploader) SetUploadObserver(fn func(UploadObservation)) {
+	if fn == nil {
+		u.uploadObserver.Store(nil)
+		return
 	}
-
-	log.Printf("[DEBUG] Upload worker exiting (channel closed)")
+	u.uploadObserver.Store(&fn)
 }
 
-// uploadFileWithRetry uploads a file with retry logic
-func (u *Uploader) uploadFileWithRetry(filePath string) error {
-	// Get file size BEFORE upload (file will be deleted after successful upload)
-	fileInfo, statErr := os.Stat(filePath)
-	var fileSize int64
-	if statErr == nil {
-		fileSize = fileInfo.Size()
+// observeUpload reports an upload result to the observer, if any
+func (u *Uploader) observeUpload(observation UploadObservation) {
+	if observer := u.uploadObserver.Load(); observer != nil {
+		(*observer)(observation)
 	}
+}
 
-	var lastErr error
-	for attempt := 0; attempt <= u.config.MaxRetries; attempt++ {
-		if attempt > 0 {
-			// Wait before retry
-			select {
-			case <-u.ctx.Done():
-				return fmt.Errorf("uploader stopped")
-			case <-time.After(u.config.RetryDelay):
-			}
+// uploadWorker uploads files from the upload and file event channels and files whose retry
+// backoff has elapsed, up to MaxConcurrentUploads at once. It exits once both channels are closed
+// and no file is being uploaded or waiting to retry
+func (u *Uploader) uploadWorker() {
+	defer u.wg.Done()
+	defer u.tracker.detach()
+	defer close(u.failedChan)
+	defer close(u.doneChan)
+
+	uploads := u.uploadChan
+	events := u.eventChan
+	finished := make(chan bool) // Result of each attempt: true if the file was scheduled for a retry
+	inflight := 0               // Attempts running; only this goroutine starts and counts them
+	waiting := 0                // Files in backoff; only this goroutine schedules and receives them
+	for uploads != nil || events != nil || waiting > 0 || inflight > 0 {
+		// At the concurrency limit, only wait for an attempt to finish
+		newUploads, newEvents, retries := uploads, events, u.retryChan
+		if inflight >= u.config.MaxConcurrentUploads {
+			newUploads, newEvents, retries = nil, nil, nil
 		}
 
-		start := time.Now()
-		err := u.uploadFile(filePath)
-		duration := time.Since(start)
-
-		if err == nil {
-			// Success - update stats using fileSize we got before upload
-			if statErr == nil && fileSize > 0 {
-				u.statsMu.Lock()
-				u.uploadStats.TotalBytes += fileSize
-				u.uploadStats.TotalDuration += duration
-
-				// Update min/max upload duration
-				if u.uploadStats.MinUploadDuration == 0 || duration < u.uploadStats.MinUploadDuration {
-					u.uploadStats.MinUploadDuration = duration
-				}
-				if duration > u.uploadStats.MaxUploadDuration {
-					u.uploadStats.MaxUploadDuration = duration
-				}
-
-				u.statsMu.Unlock()
+		var job uploadJob
+		select {
+		case filePath, ok := <-newUploads:
+			if !ok {
+				uploads = nil
+				continue
 			}
-			return nil
+			job = uploadJob{filePath: filePath}
+		case file, ok := <-newEvents:
+			if !ok {
+				events = nil
+				continue
+			}
+			job = uploadJob{filePath: file.Path, event: file.Event, rotatedAt: file.RotatedAt, reason: file.Reason}
+		case retry := <-retries:
+			waiting--
+			u.startUpload(retry, finished)
+			inflight++
+			continue
+		case retried := <-finished:
+			inflight--
+			if retried {
+				waiting++
+			}
+			continue
 		}
 
-		lastErr = err
-		if attempt < u.config.MaxRetries {
-			log.Printf("[WARNING] Upload attempt %d/%d failed for %s: %v, retrying...", attempt+1, u.config.MaxRetries+1, filePath, err)
+		if job.filePath == "" {
+			continue
+		}
+		u.logger.Printf("[DEBUG] Processing file for upload: %s", job.filePath)
+		if u.tracker != nil {
+			u.tracker.queued(job.filePath) // Also for loggers without the tracker, so scans skip it
 		}
+		u.startUpload(job, finished)
+		inflight++
 	}
 
-	return fmt.Errorf("upload failed after %d attempts: %w", u.config.MaxRetries+1, lastErr)
+	u.logger.Printf("[DEBUG] Upload worker exiting (channel closed)")
 }
 
-// uploadFile uploads a single file to GCS using parallel chunk upload
-func (u *Uploader) uploadFile(filePath string) error {
-	// Open file for reading
-	file, err := os.Open(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+// startUpload makes an upload attempt in its own goroutine and reports the result on finished
+func (u *Uploader) startUpload(job uploadJob, finished chan<- bool) {
+	go func() {
+		finished <- u.attemptUpload(job)
+	}()
+}
+
+// attemptUpload makes one upload attempt and records the result
+// Returns true if the file was scheduled for a retry
+func (u *Uploader) attemptUpload(job uploadJob) bool {
+	// Checksum the file BEFORE upload (it is compared with the stored object, then deleted); the
+	// same read decodes uncompressed files for the manifest
+	summary, statErr := summarizeFile(job.filePath, u.config.WriteManifests && contentEncodingFor(job.filePath) == "")
+	fileSize, crc := summary.size, summary.crc
+
+	job.attempts++
+	if job.event == "" && u.tracker != nil {
+		job.event = u.tracker.eventOf(job.filePath)
 	}
-	defer file.Close()
+	objectName := u.generateObjectName(job.filePath, job.event)
+	start := time.Now()
+	chunks, verified, err := u.upload(job.filePath, objectName, fileSize, crc, statErr)
+	duration := time.Since(start)
 
-	// Get file size
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return fmt.Errorf("failed to stat file: %w", err)
+	if err == nil && u.config.DeleteAfterUpload && !verified {
+		if err = u.verifyUpload(objectName, fileSize, crc, statErr); err != nil {
+			u.statsMu.Lock()
+			u.uploadStats.VerifyFailures++
+			u.statsMu.Unlock()
+		}
 	}
-	fileSize := fileInfo.Size()
 
-	// Read entire file into memory (for parallel chunk upload)
-	// Note: For very large files, consider streaming instead
-	buf := make([]byte, fileSize)
-	if _, err := io.ReadFull(file, buf); err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+	if u.tracker != nil {
+		u.tracker.attempted(err)
 	}
 
-	// Generate object name
-	objectName := u.generateObjectName(filePath)
+	if err == nil {
+		u.logger.Printf("[DEBUG] Successfully uploaded: %s", job.filePath)
+		u.observeUpload(UploadObservation{FilePath: job.filePath, Bytes: fileSize, Duration: duration, Attempts: job.attempts})
+
+		// Update stats using fileSize we got before upload
+		u.statsMu.Lock()
+		u.uploadStats.Successful++
+		u.uploadStats.TotalFiles++
+		u.uploadStats.LastUploadTime = u.config.Clock.Now()
+		if chunks > 1 {
+			u.uploadStats.ParallelUploads++
+			u.uploadStats.ParallelChunks += int64(chunks)
+		}
+		if statErr == nil && fileSize > 0 {
+			u.uploadStats.TotalBytes += fileSize
+			u.uploadStats.TotalDuration += duration
 
-	// Upload using parallel chunk upload with chunk manager
-	if err := u.uploadParallel(u.ctx, u.client, u.config.Bucket, objectName, buf, u.config.ChunkSize); err != nil {
-		return fmt.Errorf("parallel upload failed: %w", err)
-	}
+			// Update min/max upload duration
+			if u.uploadStats.MinUploadDuration == 0 || duration < u.uploadStats.MinUploadDuration {
+				u.uploadStats.MinUploadDuration = duration
+			}
+			if duration > u.uploadStats.MaxUploadDuration {
+				u.uploadStats.MaxUploadDuration = duration
+			}
+		}
+		u.statsMu.Unlock()
+
+		completion := UploadCompletion{
+			FilePath: job.filePath,
+			Event:    job.event,
+			Object:   objectName,
+			Bytes:    fileSize,
+			Duration: duration,
+			CRC32C:   crc,
+			Chunks:   chunks,
+			Verified: u.config.DeleteAfterUpload || verified,
+		}
+		if u.config.WriteManifests && statErr == nil {
+			completion.Manifest = u.writeManifest(job, objectName, summary)
+		}
+		if u.config.DeleteAfterUpload {
+			completion.Deleted = u.deleteLocal(job.filePath)
+		}
 
-	// Clear buffer reference to help GC (buf will be garbage collected after function returns)
-	buf = nil
+		// Cleared even if the delete failed: the file is safe in the backend, so retention may take it
+		if u.tracker != nil {
+			u.tracker.done(job.filePath)
+		}
+		select {
+		case u.doneChan <- completion:
+		default:
+		}
+		return false
+	}
 
-	// Delete local file after successful upload
-	if err := os.Remove(filePath); err != nil {
-		log.Printf("[WARNING] Failed to delete local file %s after upload: %v", filePath, err)
-		// Non-fatal - upload succeeded
+	if job.attempts <= u.config.MaxRetries {
+		backoff := u.retryBackoff(job.attempts)
+		u.logger.Printf("[WARNING] Upload attempt %d/%d failed for %s: %v, retrying in %v", job.attempts, u.config.MaxRetries+1, job.filePath, err, backoff)
+		u.statsMu.Lock()
+		u.uploadStats.RetriedUploads++
+		u.statsMu.Unlock()
+
+		// The timer holds the file during the backoff; the worker moves on to other files
+		retryAt := u.config.Clock.After(backoff)
+		go func() {
+			<-retryAt
+			u.retryChan <- job
+		}()
+		return true
 	}
 
-	return nil
+	err = fmt.Errorf("upload failed after %d attempts: %w", job.attempts, err)
+	u.logger.Printf("[ERROR] Failed to upload %s after %d retries: %v", job.filePath, u.config.MaxRetries, err)
+	u.observeUpload(UploadObservation{FilePath: job.filePath, Attempts: job.attempts, Err: err})
+	u.statsMu.Lock()
+	u.uploadStats.Failed++
+	u.uploadStats.TotalFiles++
+	u.statsMu.Unlock()
+	u.deadLetter(job, err)
+	return false
 }
 
-// generateObjectName generates the GCS object name from file path
-func (u *Uploader) generateObjectName(filePath string) string {
-	fileName := filepath.Base(filePath)
-	if u.config.ObjectPrefix != "" {
-		return fmt.Sprintf("%s%s", u.config.ObjectPrefix, fileName)
+// retryBackoff returns the delay before retry n (1-based): InitialBackoff doubled per retry, capped
+// at MaxBackoff, with the upper half jittered so files that failed together do not retry together
+func (u *Uploader) retryBackoff(retry int) time.Duration {
+	backoff := u.config.MaxBackoff
+	if shift := retry - 1; shift < 32 && u.config.InitialBackoff<<shift < u.config.MaxBackoff {
+		backoff = u.config.InitialBackoff << shift
 	}
-	return fileName
+	half := backoff / 2
+	return half + time.Duration(rand.Int64N(int64(backoff-half)+1))
 }
 
-// uploadParallel uploads chunks in parallel and composes them into the final object
-// This is based on the existing gcs_uploader module
-func (u *Uploader) uploadParallel(ctx context.Context, client *storage.Client, bucket, object string, buf []byte, chunkSizeBytes int) error {
-	// Calculate number of chunks
-	numChunks := (len(buf) + chunkSizeBytes - 1) / chunkSizeBytes
-
-	// Generate unique prefix for temporary chunk objects
-	uploadID := time.Now().UnixNano()
-	tempPrefix := fmt.Sprintf("%s.tmp.%d", object, uploadID)
-
-	// Track chunk uploads
-	type chunkResult struct {
-		index  int
-		object string
-		size   int64
-		err    error
-	}
-
-	results := make([]chunkResult, numChunks)
-	var wg sync.WaitGroup
-
-	// Upload chunks in parallel
-	for i := 0; i < numChunks; i++ {
-		offset := i * chunkSizeBytes
-		end := offset + chunkSizeBytes
-		if end > len(buf) {
-			end = len(buf)
-		}
-
-		wg.Add(1)
-		go func(chunkIndex int, chunkData []byte) {
-			defer wg.Done()
-
-			chunkObject := fmt.Sprintf("%s.chunk.%d", tempPrefix, chunkIndex)
-
-			// Upload this chunk as a separate object
-			w := client.Bucket(bucket).Object(chunkObject).NewWriter(ctx)
-			w.ChunkSize = chunkSizeBytes
-			w.ContentType = "application/octet-stream"
-
-			if _, err := w.Write(chunkData); err != nil {
-				results[chunkIndex] = chunkResult{
-					index: chunkIndex,
-					err:   fmt.Errorf("write error: %w", err),
-				}
-				return
-			}
-
-			if err := w.Close(); err != nil {
-				results[chunkIndex] = chunkResult{
-					index: chunkIndex,
-					err:   fmt.Errorf("close error: %w", err),
-				}
-				return
-			}
-
-			// Get object attributes to verify size
-			attrs, err := client.Bucket(bucket).Object(chunkObject).Attrs(ctx)
-			if err != nil {
-				results[chunkIndex] = chunkResult{
-					index: chunkIndex,
-					err:   fmt.Errorf("attrs error: %w", err),
-				}
-				return
-			}
+// deadLetter moves a file that failed all retries into DeadLetterDir (if set) and reports it on the
+// failed files channel
+func (u *Uploader) deadLetter(job uploadJob, err error) {
+	failed := FailedUpload{FilePath: job.filePath, Attempts: job.attempts, Err: err}
+
+	if u.config.DeadLetterDir != "" {
+		dst := filepath.Join(u.config.DeadLetterDir, filepath.Base(job.filePath))
+		if mkErr := os.MkdirAll(u.config.DeadLetterDir, 0755); mkErr != nil {
+			u.logger.Printf("[ERROR] Failed to create dead-letter directory %s: %v", u.config.DeadLetterDir, mkErr)
+		} else if mvErr := os.Rename(job.filePath, dst); mvErr != nil {
+			u.logger.Printf("[ERROR] Failed to move %s to dead-letter directory: %v", job.filePath, mvErr)
+		} else {
+			failed.DeadLetterPath = dst
+			u.statsMu.Lock()
+			u.uploadStats.DeadLettered++
+			u.statsMu.Unlock()
 
-			results[chunkIndex] = chunkResult{
-				index:  chunkIndex,
-				object: chunkObject,
-				size:   attrs.Size,
+			// No longer in the log directory, so retention need not wait for it
+			if u.tracker != nil {
+				u.tracker.done(job.filePath)
 			}
-		}(i, buf[offset:end])
-	}
-
-	// Wait for all uploads to complete
-	wg.Wait()
-
-	// Check for errors
-	for _, result := range results {
-		if result.err != nil {
-			// Cleanup: delete any successfully uploaded chunks
-			u.cleanupTempChunks(ctx, client, bucket, tempPrefix, numChunks)
-			return fmt.Errorf("chunk %d failed: %w", result.index, result.err)
 		}
 	}
 
-	// Build list of chunk object names
-	chunkObjects := make([]string, numChunks)
-	for i := 0; i < numChunks; i++ {
-		chunkObjects[i] = fmt.Sprintf("%s.chunk.%d", tempPrefix, i)
-	}
-
-	// Use chunk manager to compose (handles 32-chunk limit)
-	if err := u.chunkMgr.Compose(ctx, client, bucket, object, chunkObjects); err != nil {
-		// Cleanup on failure
-		u.cleanupTempChunks(ctx, client, bucket, tempPrefix, numChunks)
-		log.Printf("[ERROR] Compose failed for %s (%d chunks): %v. Chunks may remain in GCS.", object, numChunks, err)
-		return fmt.Errorf("compose error: %w", err)
+	select {
+	case u.failedChan <- failed:
+	default:
+		u.logger.Printf("[WARNING] Failed files channel full, not reporting %s", job.filePath)
 	}
+}
 
-	// Log successful compose for debugging
-	if numChunks > 1 {
-		log.Printf("[DEBUG] Successfully composed %d chunks into %s", numChunks, object)
+// verifyUpload checks the stored object against the local file's size and checksum
+func (u *Uploader) verifyUpload(objectName string, size int64, crc uint32, statErr error) error {
+	if statErr != nil {
+		return fmt.Errorf("failed to checksum local file: %w", statErr)
 	}
-
-	// Verify final object size matches expected size
-	attrs, err := client.Bucket(bucket).Object(object).Attrs(ctx)
+	object, err := u.backend.Stat(u.ctx, objectName)
 	if err != nil {
-		u.cleanupTempChunks(ctx, client, bucket, tempPrefix, numChunks)
-		return fmt.Errorf("failed to get object attributes: %w", err)
+		return fmt.Errorf("failed to verify upload: %w", err)
 	}
+	return compareObject(object, size, crc)
+}
 
-	if attrs.Size != int64(len(buf)) {
-		// Cleanup and return error
-		u.cleanupTempChunks(ctx, client, bucket, tempPrefix, numChunks)
-		_ = client.Bucket(bucket).Object(object).Delete(ctx) // Try to delete malformed object
-		return fmt.Errorf("size mismatch: expected %d bytes, got %d bytes", len(buf), attrs.Size)
+// compareObject returns an error if object does not match a local file of the given size and checksum
+// The checksum is only compared when the backend reports one
+func compareObject(object ObjectInfo, size int64, crc uint32) error {
+	if object.Size != size {
+		return fmt.Errorf("upload verification failed: object has %d bytes, local file %d", object.Size, size)
 	}
-
-	// Cleanup temporary chunk objects
-	if err := u.cleanupTempChunks(ctx, client, bucket, tempPrefix, numChunks); err != nil {
-		log.Printf("[WARNING] Failed to cleanup some temp chunks: %v", err)
-		// Non-fatal - main upload succeeded
+	if object.HasCRC32C && object.CRC32C != crc {
+		return fmt.Errorf("upload verification failed: object CRC32C %08x, local file %08x", object.CRC32C, crc)
 	}
-
 	return nil
 }
 
-// cleanupTempChunks deletes temporary chunk objects
-func (u *Uploader) cleanupTempChunks(ctx context.Context, client *storage.Client, bucket, prefix string, numChunks int) error {
-	var errs []error
-	bkt := client.Bucket(bucket)
-
-	for i := 0; i < numChunks; i++ {
-		chunkObject := fmt.Sprintf("%s.chunk.%d", prefix, i)
-		if err := bkt.Object(chunkObject).Delete(ctx); err != nil {
-			errs = append(errs, fmt.Errorf("failed to delete %s: %w", chunkObject, err))
-		}
+// deleteLocal removes a file whose upload is complete and reports whether it was removed
+func (u *Uploader) deleteLocal(filePath string) bool {
+	if err := os.Remove(filePath); err != nil {
+		// Non-fatal - the upload succeeded
+		u.logger.Printf("[WARNING] Failed to delete local file %s after upload: %v", filePath, err)
+		u.statsMu.Lock()
+		u.uploadStats.DeleteFailures++
+		u.statsMu.Unlock()
+		return false
 	}
+	return true
+}
 
-	if len(errs) > 0 {
-		return fmt.Errorf("cleanup errors: %v", errs)
+// generateObjectName generates the object name from file path
+// With ObjectNameTemplate, {event} is event, or derived from the file name when empty
+func (u *Uploader) generateObjectName(filePath, event string) string {
+	if u.config.ObjectNameTemplate != "" {
+		return expandObjectName(u.config.ObjectNameTemplate, u.config.ObjectPrefix, event, filePath, u.config.Clock.Now())
 	}
 
-	return nil
+	fileName := filepath.Base(filePath)
+	if u.config.ObjectPrefix != "" {
+		return fmt.Sprintf("%s%s", u.config.ObjectPrefix, fileName)
+	}
+	return fileName
 }
@@ -0,0 +1,378 @@
+package asyncloguploader
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asyncloguploader/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploader_InternalLogger(t *testing.T) {
+	t.Run("ReportsRetriesAndFailures", func(t *testing.T) {
+		capture := &captureLogger{}
+		config := GCSUploadConfig{MaxRetries: 1, RetryDelay: time.Millisecond, InternalLogger: capture}
+		uploader, err := NewUploaderWithBackend(config, NewFileSystemBackend(t.TempDir()))
+		require.NoError(t, err)
+		missing := filepath.Join(t.TempDir(), "missing.log")
+
+		uploader.Start()
+		uploader.uploadChan <- missing
+		close(uploader.uploadChan)
+		close(uploader.eventChan)
+		uploader.wg.Wait()
+
+		messages := capture.Messages()
+		require.Len(t, messages, 4)
+		assert.Equal(t, "[DEBUG] Processing file for upload: "+missing, messages[0])
+		assert.Contains(t, messages[1], "[WARNING] Upload attempt 1/2 failed for "+missing)
+		assert.Contains(t, messages[2], "[ERROR] Failed to upload "+missing)
+		assert.Equal(t, "[DEBUG] Upload worker exiting (channel closed)", messages[3])
+		assert.Equal(t, int64(1), uploader.GetStats().Failed)
+	})
+}
+
+// fakeStore is an UploadBackend standing in for GCS: each file fails its first failures attempts
+// with a transient error, then uploads (failures < 0 always fails). The first shortWrites
+// successful uploads of each file store one byte less, like an interrupted write
+type fakeStore struct {
+	failures    int
+	shortWrites int
+	onUpload    func(localPath string) // Optional, called after each successful upload
+
+	mu       sync.Mutex
+	attempts map[string]int        // By local path
+	uploaded map[string]time.Time  // By local path
+	objects  map[string]ObjectInfo // By object name
+}
+
+func newFakeStore(failures int) *fakeStore {
+	return &fakeStore{
+		failures: failures,
+		attempts: make(map[string]int),
+		uploaded: make(map[string]time.Time),
+		objects:  make(map[string]ObjectInfo),
+	}
+}
+
+func (f *fakeStore) Upload(ctx context.Context, localPath, objectName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts[localPath]++
+	if f.failures < 0 || f.attempts[localPath] <= f.failures {
+		return errors.New("googleapi: Error 503: Service Unavailable")
+	}
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return err
+	}
+	if f.attempts[localPath]-max(f.failures, 0) <= f.shortWrites {
+		data = data[:len(data)-1]
+	}
+	f.uploaded[localPath] = time.Now()
+	f.objects[objectName] = ObjectInfo{Size: int64(len(data)), CRC32C: crc32.Checksum(data, castagnoliTable), HasCRC32C: true}
+	if f.onUpload != nil {
+		f.onUpload(localPath)
+	}
+	return nil
+}
+
+func (f *fakeStore) Stat(ctx context.Context, objectName string) (ObjectInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	object, ok := f.objects[objectName]
+	if !ok {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	return object, nil
+}
+
+func (f *fakeStore) Close() error {
+	return nil
+}
+
+// newFakeUploader creates an uploader backed by store
+func newFakeUploader(t *testing.T, config GCSUploadConfig, store *fakeStore) *Uploader {
+	t.Helper()
+	if config.InternalLogger == nil {
+		config.InternalLogger = &captureLogger{}
+	}
+	uploader, err := NewUploaderWithBackend(config, store)
+	require.NoError(t, err)
+	return uploader
+}
+
+// writeUploadFile creates a small file to upload
+func writeUploadFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte("log data"), 0644))
+	return path
+}
+
+func TestUploader_Retry(t *testing.T) {
+	t.Run("ValidatesBackoff", func(t *testing.T) {
+		config := DefaultGCSUploadConfig("bucket")
+		require.NoError(t, config.Validate())
+		assert.Equal(t, time.Second, config.InitialBackoff)
+		assert.Equal(t, time.Minute, config.MaxBackoff)
+
+		config = GCSUploadConfig{Bucket: "bucket", RetryDelay: 3 * time.Second}
+		require.NoError(t, config.Validate())
+		assert.Equal(t, 3*time.Second, config.InitialBackoff, "RetryDelay is the fallback")
+
+		config = GCSUploadConfig{Bucket: "bucket", InitialBackoff: time.Minute, MaxBackoff: time.Second}
+		assert.Error(t, config.Validate())
+	})
+
+	t.Run("BackoffIsExponentialJitteredAndCapped", func(t *testing.T) {
+		uploader := newFakeUploader(t, GCSUploadConfig{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}, newFakeStore(0))
+		for retry, ceiling := range map[int]time.Duration{
+			1:  100 * time.Millisecond,
+			2:  200 * time.Millisecond,
+			4:  800 * time.Millisecond,
+			5:  time.Second,
+			64: time.Second,
+		} {
+			for i := 0; i < 100; i++ {
+				backoff := uploader.retryBackoff(retry)
+				assert.GreaterOrEqual(t, backoff, ceiling/2)
+				assert.LessOrEqual(t, backoff, ceiling)
+			}
+		}
+	})
+
+	t.Run("RetriesTransientFailures", func(t *testing.T) {
+		store := newFakeStore(2)
+		uploader := newFakeUploader(t, GCSUploadConfig{MaxRetries: 3, InitialBackoff: 5 * time.Millisecond, MaxBackoff: 20 * time.Millisecond, DeleteAfterUpload: true}, store)
+		path := writeUploadFile(t, t.TempDir(), "app_1.log")
+		uploader.tracker.queued(path)
+
+		uploader.Start()
+		uploader.GetUploadChannel() <- path
+		uploader.Stop()
+
+		assert.Equal(t, 3, store.attempts[path])
+		assert.NoFileExists(t, path)
+		assert.Equal(t, 0, uploader.GetUploadTracker().PendingFiles())
+		stats := uploader.GetStats()
+		assert.Equal(t, int64(1), stats.Successful)
+		assert.Equal(t, int64(2), stats.RetriedUploads)
+		assert.Equal(t, int64(0), stats.Failed)
+		assert.Empty(t, uploader.GetFailedFiles())
+	})
+
+	t.Run("DeadLettersAfterRetries", func(t *testing.T) {
+		store := newFakeStore(-1) // Always fails
+		deadLetterDir := filepath.Join(t.TempDir(), "dead")
+		uploader := newFakeUploader(t, GCSUploadConfig{MaxRetries: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, DeadLetterDir: deadLetterDir}, store)
+		path := writeUploadFile(t, t.TempDir(), "app_1.log")
+		uploader.tracker.queued(path)
+
+		uploader.Start()
+		uploader.GetUploadChannel() <- path
+		uploader.Stop()
+
+		failed, ok := <-uploader.GetFailedFiles()
+		require.True(t, ok)
+		assert.Equal(t, path, failed.FilePath)
+		assert.Equal(t, filepath.Join(deadLetterDir, "app_1.log"), failed.DeadLetterPath)
+		assert.Equal(t, 3, failed.Attempts)
+		assert.ErrorContains(t, failed.Err, "503")
+		assert.NoFileExists(t, path)
+		assert.FileExists(t, failed.DeadLetterPath)
+		assert.Equal(t, 0, uploader.GetUploadTracker().PendingFiles())
+
+		_, ok = <-uploader.GetFailedFiles()
+		assert.False(t, ok, "closed once Stop returns")
+
+		stats := uploader.GetStats()
+		assert.Equal(t, int64(1), stats.Failed)
+		assert.Equal(t, int64(1), stats.DeadLettered)
+		assert.Equal(t, int64(2), stats.RetriedUploads)
+	})
+
+	t.Run("KeepsFailedFileWithoutDeadLetterDir", func(t *testing.T) {
+		uploader := newFakeUploader(t, GCSUploadConfig{MaxRetries: 1, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}, newFakeStore(-1))
+		path := writeUploadFile(t, t.TempDir(), "app_1.log")
+		uploader.tracker.queued(path)
+
+		uploader.Start()
+		uploader.GetUploadChannel() <- path
+		uploader.Stop()
+
+		failed := <-uploader.GetFailedFiles()
+		assert.Equal(t, "", failed.DeadLetterPath)
+		assert.FileExists(t, path)
+		assert.Equal(t, 1, uploader.GetUploadTracker().PendingFiles(), "retention keeps the file")
+		assert.Equal(t, int64(0), uploader.GetStats().DeadLettered)
+	})
+
+	t.Run("BackoffDoesNotBlockOtherUploads", func(t *testing.T) {
+		store := newFakeStore(1)
+		fake := clock.NewFake(time.Date(2025, 3, 14, 9, 26, 53, 0, time.UTC))
+		uploader := newFakeUploader(t, GCSUploadConfig{MaxRetries: 1, InitialBackoff: time.Minute, MaxBackoff: time.Minute, Clock: fake}, store)
+		dir := t.TempDir()
+		first := writeUploadFile(t, dir, "app_1.log")
+		second := writeUploadFile(t, dir, "app_2.log")
+
+		uploader.Start()
+		uploader.GetUploadChannel() <- first
+		uploader.GetUploadChannel() <- second
+
+		// Both fail once; the second's first attempt does not wait for the first's backoff, so both
+		// wait out their backoffs together and retry within one
+		fake.BlockUntil(2)
+		fake.Advance(time.Minute)
+		uploader.Stop()
+
+		assert.Contains(t, store.uploaded, first)
+		assert.Contains(t, store.uploaded, second)
+		assert.Equal(t, int64(2), uploader.GetStats().Successful)
+		assert.Equal(t, fake.Now(), uploader.GetStats().LastUploadTime)
+	})
+}
+
+func TestUploader_DeleteAfterUpload(t *testing.T) {
+	t.Run("KeepsFilesByDefault", func(t *testing.T) {
+		uploader := newFakeUploader(t, GCSUploadConfig{ObjectPrefix: "logs/"}, newFakeStore(0))
+		path := writeUploadFile(t, t.TempDir(), "app_1.log")
+
+		uploader.Start()
+		uploader.GetUploadChannel() <- path
+		uploader.Stop()
+
+		completion := <-uploader.GetCompletedUploads()
+		assert.Equal(t, path, completion.FilePath)
+		assert.Equal(t, "logs/app_1.log", completion.Object)
+		assert.False(t, completion.Verified)
+		assert.False(t, completion.Deleted)
+		assert.FileExists(t, path)
+		assert.Equal(t, 0, uploader.GetUploadTracker().PendingFiles(), "retention may delete it")
+	})
+
+	t.Run("VerifiesThenDeletes", func(t *testing.T) {
+		store := newFakeStore(0)
+		uploader := newFakeUploader(t, GCSUploadConfig{DeleteAfterUpload: true}, store)
+		path := writeUploadFile(t, t.TempDir(), "app_1.log")
+
+		uploader.Start()
+		uploader.GetUploadChannel() <- path
+		uploader.Stop()
+
+		completion, ok := <-uploader.GetCompletedUploads()
+		require.True(t, ok)
+		assert.Equal(t, "app_1.log", completion.Object)
+		assert.Equal(t, int64(len("log data")), completion.Bytes)
+		assert.Equal(t, crc32.Checksum([]byte("log data"), castagnoliTable), completion.CRC32C)
+		assert.Greater(t, completion.Duration, time.Duration(0))
+		assert.True(t, completion.Verified)
+		assert.True(t, completion.Deleted)
+		assert.NoFileExists(t, path)
+
+		_, ok = <-uploader.GetCompletedUploads()
+		assert.False(t, ok, "closed once Stop returns")
+		stats := uploader.GetStats()
+		assert.Equal(t, int64(1), stats.Successful)
+		assert.Equal(t, int64(0), stats.VerifyFailures)
+		assert.Equal(t, int64(0), stats.DeleteFailures)
+	})
+
+	t.Run("RetriesSizeMismatch", func(t *testing.T) {
+		store := newFakeStore(0)
+		store.shortWrites = 1
+		uploader := newFakeUploader(t, GCSUploadConfig{MaxRetries: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, DeleteAfterUpload: true}, store)
+		path := writeUploadFile(t, t.TempDir(), "app_1.log")
+
+		uploader.Start()
+		uploader.GetUploadChannel() <- path
+		uploader.Stop()
+
+		assert.Equal(t, 2, store.attempts[path])
+		assert.NoFileExists(t, path)
+		stats := uploader.GetStats()
+		assert.Equal(t, int64(1), stats.VerifyFailures)
+		assert.Equal(t, int64(1), stats.RetriedUploads)
+		assert.Equal(t, int64(1), stats.Successful)
+		assert.Equal(t, int64(0), stats.Failed)
+	})
+
+	t.Run("KeepsFileFailingVerification", func(t *testing.T) {
+		store := newFakeStore(0)
+		store.shortWrites = 100
+		uploader := newFakeUploader(t, GCSUploadConfig{MaxRetries: 1, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, DeleteAfterUpload: true}, store)
+		path := writeUploadFile(t, t.TempDir(), "app_1.log")
+		uploader.tracker.queued(path)
+
+		uploader.Start()
+		uploader.GetUploadChannel() <- path
+		uploader.Stop()
+
+		failed := <-uploader.GetFailedFiles()
+		assert.ErrorContains(t, failed.Err, "upload verification failed")
+		assert.FileExists(t, path)
+		assert.Empty(t, uploader.GetCompletedUploads())
+		assert.Equal(t, 1, uploader.GetUploadTracker().PendingFiles())
+		stats := uploader.GetStats()
+		assert.Equal(t, int64(2), stats.VerifyFailures)
+		assert.Equal(t, int64(1), stats.Failed)
+		assert.Equal(t, int64(0), stats.Successful)
+	})
+
+	t.Run("CountsDeleteFailures", func(t *testing.T) {
+		store := newFakeStore(0)
+		store.onUpload = func(localPath string) {
+			// Replace the file with a non-empty directory, which os.Remove refuses even as root
+			require.NoError(t, os.Remove(localPath))
+			require.NoError(t, os.Mkdir(localPath, 0755))
+			require.NoError(t, os.WriteFile(filepath.Join(localPath, "child"), nil, 0644))
+		}
+		capture := &captureLogger{}
+		uploader := newFakeUploader(t, GCSUploadConfig{DeleteAfterUpload: true, InternalLogger: capture}, store)
+		path := writeUploadFile(t, t.TempDir(), "app_1.log")
+		uploader.tracker.queued(path)
+
+		uploader.Start()
+		uploader.GetUploadChannel() <- path
+		uploader.Stop()
+
+		completion := <-uploader.GetCompletedUploads()
+		assert.True(t, completion.Verified)
+		assert.False(t, completion.Deleted)
+		assert.Equal(t, 0, uploader.GetUploadTracker().PendingFiles(), "uploaded, so retention may take it")
+		stats := uploader.GetStats()
+		assert.Equal(t, int64(1), stats.Successful)
+		assert.Equal(t, int64(1), stats.DeleteFailures)
+		assert.Equal(t, int64(0), stats.VerifyFailures)
+		assert.Contains(t, strings.Join(capture.Messages(), "\n"), "Failed to delete local file "+path)
+	})
+
+	t.Run("LoggerReportsPendingUploads", func(t *testing.T) {
+		dir := t.TempDir()
+		tracker := NewUploadTracker()
+		tracker.queued(filepath.Join(dir, "app_2020-01-01_00-00-00.log"))
+		tracker.queued(filepath.Join(dir, "app_2020-01-01_00-00-01_1.log.gz"))
+		tracker.queued(filepath.Join(dir, "other_2020-01-01_00-00-00.log"))       // Another series
+		tracker.queued(filepath.Join(t.TempDir(), "app_2020-01-01_00-00-00.log")) // Another directory
+
+		config := DefaultConfig(filepath.Join(dir, "app.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 2
+		config.UploadTracker = tracker
+		logger, err := NewLogger(config)
+		require.NoError(t, err)
+		defer logger.Close()
+
+		assert.Equal(t, int64(2), logger.Snapshot().PendingUploads)
+		tracker.done(filepath.Join(dir, "app_2020-01-01_00-00-00.log"))
+		assert.Equal(t, int64(1), logger.Snapshot().PendingUploads)
+	})
+}
@@ -0,0 +1,113 @@
+package asyncloguploader
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asyncloguploader/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger_WriteAmplification(t *testing.T) {
+	const entrySize = 100
+
+	for _, checksums := range []bool{false, true} {
+		name := "Plain"
+		if checksums {
+			name = "Checksums"
+		}
+		t.Run(name, func(t *testing.T) {
+			logPath := filepath.Join(t.TempDir(), "test.log")
+			config := DefaultConfig(logPath)
+			config.BufferSize = 256 * 1024
+			config.NumShards = 2
+			config.ShardSelection = ShardSelectionKeyHash
+			config.FlushInterval = time.Hour
+			config.EnableChecksums = checksums
+			logger, err := NewLogger(config)
+			require.NoError(t, err)
+
+			var observed []FlushObservation
+			logger.SetFlushObserver(func(o FlushObservation) { observed = append(observed, o) })
+
+			// Two entries on one shard, one on the other
+			sc := logger.shardCollection.Load()
+			other := uint64(1)
+			for sc.selectShard(other, true) == sc.selectShard(0, true) {
+				other++
+			}
+			require.NoError(t, logger.TryLogBytesKeyed(0, make([]byte, entrySize)))
+			require.NoError(t, logger.TryLogBytesKeyed(0, make([]byte, entrySize)))
+			require.NoError(t, logger.TryLogBytesKeyed(other, make([]byte, entrySize)))
+			require.NoError(t, logger.Flush(context.Background()))
+
+			// Both shards are written in full (Direct I/O)
+			shard := sc.GetShard(0)
+			written := 2 * int64(shard.capacity)
+			overhead := int64(headerOffset + shard.capacity - shard.limit)
+			want := FlushObservation{
+				Bytes:        3 * (reader.LengthPrefixSize + entrySize),
+				PayloadBytes: 3 * entrySize,
+				HeaderBytes:  2*overhead + 3*reader.LengthPrefixSize,
+			}
+			want.PaddingBytes = written - want.PayloadBytes - want.HeaderBytes
+			if checksums {
+				assert.Equal(t, int64(headerOffset+reader.ChecksumTrailerSize), overhead)
+			}
+
+			metrics := logger.GetFlushMetrics()
+			assert.Equal(t, want.PayloadBytes, metrics.PayloadBytes)
+			assert.Equal(t, want.HeaderBytes, metrics.HeaderBytes)
+			assert.Equal(t, want.PaddingBytes, metrics.PaddingBytes)
+			assert.Equal(t, float64(written)/float64(3*entrySize), metrics.WriteAmplificationRatio)
+
+			require.Len(t, observed, 1)
+			observed[0].Duration, observed[0].WriteDuration, observed[0].PwritevDuration = 0, 0, 0
+			assert.Equal(t, want, observed[0])
+			require.NoError(t, logger.Close())
+
+			// The reader accounts the file the same way
+			files, err := filepath.Glob(filepath.Join(filepath.Dir(logPath), "test_*.log"))
+			require.NoError(t, err)
+			require.Len(t, files, 1)
+			acct, err := reader.AccountFiles(files, reader.Options{})
+			require.NoError(t, err)
+			assert.Equal(t, reader.ByteAccounting{
+				PayloadBytes: want.PayloadBytes,
+				HeaderBytes:  want.HeaderBytes,
+				PaddingBytes: want.PaddingBytes,
+			}, acct)
+			assert.Equal(t, metrics.WriteAmplificationRatio, acct.WriteAmplificationRatio())
+		})
+	}
+
+	t.Run("AggregatedByLoggerManager", func(t *testing.T) {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "events.log"))
+		config.BufferSize = 256 * 1024
+		config.NumShards = 2
+		config.FlushInterval = time.Hour
+		manager, err := NewLoggerManager(config)
+		require.NoError(t, err)
+		defer manager.Close()
+
+		manager.LogBytesWithEvent("a", make([]byte, entrySize))
+		manager.LogBytesWithEvent("b", make([]byte, 3*entrySize))
+		require.NoError(t, manager.FlushAll(context.Background()))
+
+		// One single-entry shard per event
+		metrics := manager.GetAggregatedFlushMetrics()
+		assert.Equal(t, int64(4*entrySize), metrics.PayloadBytes)
+		assert.Equal(t, int64(2*(headerOffset+reader.LengthPrefixSize)), metrics.HeaderBytes)
+		assert.Equal(t, float64(metrics.PayloadBytes+metrics.HeaderBytes+metrics.PaddingBytes)/float64(4*entrySize), metrics.WriteAmplificationRatio)
+	})
+
+	t.Run("ZeroBeforeAnyPayload", func(t *testing.T) {
+		logger, err := NewLogger(DefaultConfig(filepath.Join(t.TempDir(), "test.log")))
+		require.NoError(t, err)
+		defer logger.Close()
+		assert.Zero(t, logger.GetFlushMetrics().WriteAmplificationRatio)
+	})
+}
@@ -0,0 +1,72 @@
+package asyncloguploader
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// WriteLatencyBuckets are the upper bounds of the write-latency histogram buckets
+// A write lands in the first bucket whose bound it is below; slower writes land in the last
+// bucket (>50ms), so WriteLatencyHistogram has one more count than there are bounds
+var WriteLatencyBuckets = [numWriteLatencyBuckets - 1]time.Duration{
+	time.Microsecond,
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+}
+
+// numWriteLatencyBuckets is the number of histogram buckets, including the overflow bucket
+const numWriteLatencyBuckets = 7
+
+// WriteLatencyHistogram counts LogBytes calls by duration (Config.TrackWriteLatency)
+// Counts[i] holds calls faster than WriteLatencyBuckets[i] (and not faster than the previous
+// bound); the last count holds calls of 50ms or more
+type WriteLatencyHistogram struct {
+	Counts [numWriteLatencyBuckets]int64
+}
+
+// Total returns the number of calls recorded
+func (h WriteLatencyHistogram) Total() int64 {
+	var total int64
+	for _, count := range h.Counts {
+		total += count
+	}
+	return total
+}
+
+// add adds the counts of other to h
+func (h *WriteLatencyHistogram) add(other WriteLatencyHistogram) {
+	for i, count := range other.Counts {
+		h.Counts[i] += count
+	}
+}
+
+// sub subtracts the counts of other from h
+func (h *WriteLatencyHistogram) sub(other WriteLatencyHistogram) {
+	for i, count := range other.Counts {
+		h.Counts[i] -= count
+	}
+}
+
+// writeLatencyCounters is the live histogram behind WriteLatencyHistogram
+type writeLatencyCounters [numWriteLatencyBuckets]atomic.Int64
+
+// observe counts one call of duration d
+func (c *writeLatencyCounters) observe(d time.Duration) {
+	i := 0
+	for i < len(WriteLatencyBuckets) && d >= WriteLatencyBuckets[i] {
+		i++
+	}
+	c[i].Add(1)
+}
+
+// load reads the counters
+func (c *writeLatencyCounters) load() WriteLatencyHistogram {
+	var h WriteLatencyHistogram
+	for i := range c {
+		h.Counts[i] = c[i].Load()
+	}
+	return h
+}
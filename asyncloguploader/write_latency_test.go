@@ -0,0 +1,98 @@
+package asyncloguploader
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteLatencyCounters(t *testing.T) {
+	var c writeLatencyCounters
+	for _, d := range []time.Duration{
+		0, 999 * time.Nanosecond, // <1µs
+		time.Microsecond,                   // <10µs
+		99 * time.Microsecond,              // <100µs
+		500 * time.Microsecond,             // <1ms
+		5 * time.Millisecond,               // <10ms
+		49 * time.Millisecond,              // <50ms
+		50 * time.Millisecond, time.Second, // >=50ms
+	} {
+		c.observe(d)
+	}
+
+	h := c.load()
+	assert.Equal(t, [numWriteLatencyBuckets]int64{2, 1, 1, 1, 1, 1, 2}, h.Counts)
+	assert.Equal(t, int64(9), h.Total())
+}
+
+func TestLogger_WriteLatency(t *testing.T) {
+	newLatencyConfig := func(t *testing.T, track bool) Config {
+		config := DefaultConfig(filepath.Join(t.TempDir(), "latency.log"))
+		config.BufferSize = 1024 * 1024
+		config.NumShards = 2
+		config.TrackWriteLatency = track
+		return config
+	}
+
+	t.Run("RecordsEveryCall", func(t *testing.T) {
+		logger, err := NewLogger(newLatencyConfig(t, true))
+		require.NoError(t, err)
+		defer logger.Close()
+
+		for i := 0; i < 100; i++ {
+			logger.Log("message")
+		}
+		assert.Equal(t, int64(100), logger.GetWriteLatencyHistogram().Total())
+		assert.Equal(t, logger.GetWriteLatencyHistogram(), logger.Snapshot().Stats.WriteLatency)
+	})
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		logger, err := NewLogger(newLatencyConfig(t, false))
+		require.NoError(t, err)
+		defer logger.Close()
+
+		logger.Log("message")
+		assert.Zero(t, logger.GetWriteLatencyHistogram().Total())
+	})
+
+	t.Run("AggregatedByManager", func(t *testing.T) {
+		manager, err := NewLoggerManager(newLatencyConfig(t, true))
+		require.NoError(t, err)
+		defer manager.Close()
+
+		for i := 0; i < 10; i++ {
+			manager.LogWithEvent("payment", "paid")
+			manager.LogWithEvent("login", "logged in")
+		}
+		assert.Equal(t, int64(20), manager.GetAggregatedWriteLatencyHistogram().Total())
+	})
+}
+
+// BenchmarkWriteLatency measures the LogBytes fast path with and without TrackWriteLatency
+// Off costs a branch (within noise of the untracked path); on adds one time.Now/time.Since pair,
+// whose cost depends on the clock source (tens of ns with a vDSO TSC clock, more in some VMs)
+func BenchmarkWriteLatency(b *testing.B) {
+	for _, track := range []bool{false, true} {
+		b.Run(fmt.Sprintf("track=%t", track), func(b *testing.B) {
+			config := DefaultConfig(filepath.Join(b.TempDir(), "bench.log"))
+			config.BufferSize = 64 * 1024 * 1024
+			config.NumShards = 16
+			config.TrackWriteLatency = track
+
+			logger, err := NewLogger(config)
+			require.NoError(b, err)
+
+			msg := make([]byte, 64)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				logger.LogBytes(msg)
+			}
+			b.StopTimer()
+			require.NoError(b, logger.Close())
+		})
+	}
+}
@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
+	"net/http"
 	"os"
+	"path/filepath"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -41,8 +43,18 @@ func main() {
 		gcsBucket             = flag.String("gcs-bucket", "", "GCS bucket name for uploads (empty to disable)")
 		gcsPrefix             = flag.String("gcs-prefix", "", "GCS object prefix (e.g., 'logs/event1/')")
 		gcsChunkSizeMB        = flag.Int("gcs-chunk-mb", 32, "GCS upload chunk size in MB")
+		healthAddr            = flag.String("health-addr", "", "Address to serve the /healthz readiness endpoint on (empty to disable)")
+		soak                  = flag.Bool("soak", false, "Soak mode: detect drop rate, flush p95 and memory regime changes and write a summary")
+		soakWindow            = flag.Duration("soak-window", time.Minute, "Soak mode: rolling window for drop rate and flush p95")
+		soakDropThreshold     = flag.Float64("soak-drop-threshold", 1.0, "Soak mode: window drop rate (%) that marks a cliff")
+		soakP95Factor         = flag.Float64("soak-p95-factor", 2.0, "Soak mode: flush p95 over its baseline that marks a spike")
+		soakMemFactor         = flag.Float64("soak-mem-factor", 2.0, "Soak mode: heap over its baseline that marks memory growth")
+		soakOut               = flag.String("soak-out", "", "Soak mode: summary JSON path (default: {log-dir}/soak_summary.json)")
 	)
 	flag.Parse()
+	if *soak && (*soakP95Factor <= 1 || *soakMemFactor <= 1) {
+		log.Fatalf("-soak-p95-factor and -soak-mem-factor must be greater than 1")
+	}
 
 	// Create log directory
 	if err := os.MkdirAll(*logDir, 0755); err != nil {
@@ -91,6 +103,9 @@ func main() {
 		config.MaxFileSize = maxFileSize
 		config.PreallocateFileSize = preallocateSize
 		config.UploadChannel = uploadChan
+		if uploader != nil {
+			config.UploadTracker = uploader.GetUploadTracker()
+		}
 
 		loggerManager, err = asyncloguploader.NewLoggerManager(config)
 		if err != nil {
@@ -109,6 +124,9 @@ func main() {
 		config.MaxFileSize = maxFileSize
 		config.PreallocateFileSize = preallocateSize
 		config.UploadChannel = uploadChan
+		if uploader != nil {
+			config.UploadTracker = uploader.GetUploadTracker()
+		}
 
 		logger, err = asyncloguploader.NewLogger(config)
 		if err != nil {
@@ -119,6 +137,47 @@ func main() {
 		// This ensures we can wait for uploads before closing
 	}
 
+	// Start health endpoint if enabled
+	if *healthAddr != "" {
+		health := asyncloguploader.HealthHandler(func() asyncloguploader.HealthStatus {
+			if loggerManager != nil {
+				return loggerManager.Health()
+			}
+			return logger.Health()
+		})
+		go func() {
+			log.Printf("Starting health server on %s", *healthAddr)
+			if err := http.ListenAndServe(*healthAddr, health); err != nil {
+				log.Printf("health server error: %v", err)
+			}
+		}()
+	}
+
+	// Soak mode watches every flush and each stats sample
+	var soakMon *soakMonitor
+	if *soak {
+		summaryPath := *soakOut
+		if summaryPath == "" {
+			summaryPath = filepath.Join(*logDir, "soak_summary.json")
+		}
+		soakMon, err = newSoakMonitor(soakConfig{
+			Window:        *soakWindow,
+			DropThreshold: *soakDropThreshold,
+			P95Factor:     *soakP95Factor,
+			MemFactor:     *soakMemFactor,
+			ProfileDir:    filepath.Join(filepath.Dir(summaryPath), "soak_profiles"),
+			SummaryPath:   summaryPath,
+		})
+		if err != nil {
+			log.Fatalf("Failed to start soak mode: %v", err)
+		}
+		if loggerManager != nil {
+			loggerManager.SetFlushObserver(func(_ string, o asyncloguploader.FlushObservation) { soakMon.observeFlush(o) })
+		} else {
+			logger.SetFlushObserver(soakMon.observeFlush)
+		}
+	}
+
 	// Calculate rate per thread
 	ratePerThread := float64(*targetRPS) / float64(*numThreads)
 	intervalPerThread := time.Duration(float64(time.Second) / ratePerThread)
@@ -142,6 +201,10 @@ func main() {
 	if *useEvents {
 		log.Printf("  Number of events: %d", *numEvents)
 	}
+	if *soak {
+		log.Printf("  Soak: window %v, drop threshold %.2f%%, p95 factor %.1f, mem factor %.1f",
+			*soakWindow, *soakDropThreshold, *soakP95Factor, *soakMemFactor)
+	}
 	log.Println()
 
 	// Prepare log data template
@@ -163,16 +226,11 @@ func main() {
 		for {
 			select {
 			case <-ticker.C:
-				var totalLogs, droppedLogs, bytesWritten, flushes, flushErrors int64
-				var flushMetrics asyncloguploader.FlushMetrics
-
-				if *useEvents {
-					totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, _ = loggerManager.GetAggregatedStats()
-					flushMetrics = loggerManager.GetAggregatedFlushMetrics()
-				} else {
-					totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, _ = logger.GetStatsSnapshot()
-					flushMetrics = logger.GetFlushMetrics()
-				}
+				// Single snapshot so every number in the line describes the same instant
+				stats, flushMetrics := takeSnapshot(loggerManager, logger)
+				totalLogs, droppedLogs, bytesWritten := stats.TotalLogs, stats.DroppedLogs, stats.BytesWritten
+				bytesBuffered, bytesDurable := stats.BytesBuffered, stats.BytesDurable
+				flushes, flushErrors := stats.Flushes, stats.FlushErrors
 
 				var m runtime.MemStats
 				runtime.ReadMemStats(&m)
@@ -192,15 +250,23 @@ func main() {
 					pwritevPct = flushMetrics.PwritevPercent
 				}
 
-				log.Printf("METRICS: Logs: %d Dropped: %d (%.4f%%) | Bytes: %d | Flushes: %d Errors: %d | "+
+				log.Printf("METRICS: Logs: %d Dropped: %d (%.4f%%) | Bytes: %d Buffered: %d Durable: %d | Flushes: %d Errors: %d Queue: %d Blocked: %d | "+
 					"AvgFlush: %.2fms MaxFlush: %.2fms | AvgWrite: %.2fms MaxWrite: %.2fms WritePct: %.1f%% | "+
 					"AvgPwritev: %.2fms MaxPwritev: %.2fms PwritevPct: %.1f%% | GC: %d cycles %.2fms pause | Mem: %.2fMB",
-					totalLogs, droppedLogs, dropRate, bytesWritten, flushes, flushErrors,
+					totalLogs, droppedLogs, dropRate, bytesWritten, bytesBuffered, bytesDurable, flushes, flushErrors,
+					flushMetrics.FlushQueueDepth, flushMetrics.BlockedSwaps,
 					float64(flushMetrics.AvgFlushDuration)/1e6, float64(flushMetrics.MaxFlushDuration)/1e6,
 					float64(flushMetrics.AvgWriteDuration)/1e6, float64(flushMetrics.MaxWriteDuration)/1e6, writePct,
 					float64(flushMetrics.AvgPwritevDuration)/1e6, float64(flushMetrics.MaxPwritevDuration)/1e6, pwritevPct,
 					m.NumGC, float64(m.PauseTotalNs)/1e6, float64(m.Alloc)/1024/1024)
 
+				if loggerManager != nil {
+					printEventStats(loggerManager)
+				}
+				if soakMon != nil {
+					soakMon.sample(stats, flushMetrics, &m)
+				}
+
 			case <-done:
 				return
 			}
@@ -304,22 +370,23 @@ func main() {
 	}
 
 	close(done)
+	if soakMon != nil {
+		soakMon.finish()
+	}
 
 	// Final statistics
-	var finalTotalLogs, finalDroppedLogs, finalBytesWritten, finalFlushes, finalFlushErrors int64
-	if *useEvents {
-		finalTotalLogs, finalDroppedLogs, finalBytesWritten, finalFlushes, finalFlushErrors, _ = loggerManager.GetAggregatedStats()
-	} else {
-		finalTotalLogs, finalDroppedLogs, finalBytesWritten, finalFlushes, finalFlushErrors, _ = logger.GetStatsSnapshot()
-	}
+	finalStats, _ := takeSnapshot(loggerManager, logger)
 
 	log.Println()
 	log.Printf("Final Statistics:")
-	log.Printf("  Total Logs: %d", finalTotalLogs)
-	log.Printf("  Dropped Logs: %d", finalDroppedLogs)
-	log.Printf("  Bytes Written: %d", finalBytesWritten)
-	log.Printf("  Flushes: %d", finalFlushes)
-	log.Printf("  Flush Errors: %d", finalFlushErrors)
+	log.Printf("  Total Logs: %d", finalStats.TotalLogs)
+	log.Printf("  Dropped Logs: %d", finalStats.DroppedLogs)
+	log.Printf("  Bytes Written: %d", finalStats.BytesWritten)
+	log.Printf("  Bytes Flushed: %d", finalStats.BytesFlushed)
+	log.Printf("  Payload Bytes Buffered: %d", finalStats.BytesBuffered)
+	log.Printf("  Payload Bytes Durable: %d", finalStats.BytesDurable)
+	log.Printf("  Flushes: %d", finalStats.Flushes)
+	log.Printf("  Flush Errors: %d", finalStats.FlushErrors)
 
 	// Close logger to flush remaining data and send final file to upload channel
 	log.Printf("Closing logger(s)...")
@@ -411,3 +478,37 @@ func main() {
 		log.Printf("Uploader stopped")
 	}
 }
+
+// takeSnapshot returns counters and flush metrics from one snapshot of the manager (if set) or logger
+func takeSnapshot(loggerManager *asyncloguploader.LoggerManager, logger *asyncloguploader.Logger) (asyncloguploader.StatsSnapshot, asyncloguploader.FlushMetrics) {
+	if loggerManager != nil {
+		snap := loggerManager.Snapshot()
+		return snap.Aggregate, snap.FlushMetrics
+	}
+	snap := logger.Snapshot()
+	return snap.Stats, snap.FlushMetrics
+}
+
+// printEventStats prints the counters and file state of every event logger
+func printEventStats(lm *asyncloguploader.LoggerManager) {
+	for _, event := range lm.ListEventLoggers() {
+		totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, _, bytesBuffered, bytesDurable, err := lm.GetEventStats(event)
+		if err != nil {
+			continue // Closed since listed
+		}
+		files, err := lm.GetEventFileStats(event)
+		if err != nil {
+			continue
+		}
+
+		lastRotation := "never"
+		if !files.LastRotation.IsZero() {
+			lastRotation = time.Since(files.LastRotation).Truncate(time.Second).String() + " ago"
+		}
+		log.Printf("EVENT_STATS: event=%s logs=%d dropped=%d bytes=%d buffered=%d durable=%d flushes=%d errors=%d | "+
+			"file=%s size=%.2fMB lastRotation=%s | pendingUploads=%d (%.2fMB)",
+			event, totalLogs, droppedLogs, bytesWritten, bytesBuffered, bytesDurable, flushes, flushErrors,
+			filepath.Base(files.CurrentFile), float64(files.CurrentFileBytes)/1024/1024, lastRotation,
+			files.PendingUploads, float64(files.PendingUploadBytes)/1024/1024)
+	}
+}
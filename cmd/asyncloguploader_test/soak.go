@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/neeharmavuduru/logger-double-buffer/asyncloguploader"
+)
+
+// Soak mode (-soak): while the load runs, track the drop rate and flush p95 over a rolling window and
+// the heap, and flag regime changes as SOAK_EVENT JSON lines with pprof profiles taken at detection.
+// The summary file holds every sample and event; scripts/analyze_cliff.go reads it instead of
+// scraping METRICS lines
+
+// soakConfig holds the soak mode flags
+type soakConfig struct {
+	Window        time.Duration `json:"window_ns"`      // Rolling window for drop rate and flush p95
+	DropThreshold float64       `json:"drop_threshold"` // Window drop rate (%) that marks a cliff
+	P95Factor     float64       `json:"p95_factor"`     // Flush p95 over the baseline p95 that marks a spike
+	MemFactor     float64       `json:"mem_factor"`     // Heap over the baseline heap that marks growth
+	ProfileDir    string        `json:"profile_dir"`    // Where profiles are written at each event
+	SummaryPath   string        `json:"summary_path"`   // Summary JSON, rewritten after every sample
+}
+
+// soakPoint is one sample; the fields up to FlushTotal match analyze_cliff.go's MetricPoint
+type soakPoint struct {
+	Timestamp    int     `json:"timestamp"` // Seconds since the start
+	Logs         int64   `json:"logs"`
+	Dropped      int64   `json:"dropped"`
+	DropRate     float64 `json:"drop_rate"` // Cumulative, %
+	GCCycles     int     `json:"gc_cycles"`
+	GCPause      float64 `json:"gc_pause_ms"`
+	Memory       float64 `json:"memory_mb"`
+	FlushAvg     float64 `json:"flush_avg_ms"`
+	FlushMax     float64 `json:"flush_max_ms"`
+	FlushQueue   int64   `json:"flush_queue"`
+	FlushBlocked int64   `json:"flush_blocked"`
+	FlushTotal   int64   `json:"flush_total"`
+
+	WindowDropRate float64 `json:"window_drop_rate"` // Over the rolling window, %
+	FlushP95       float64 `json:"flush_p95_ms"`     // Over the rolling window
+	HeapInuse      float64 `json:"heap_inuse_mb"`
+	Goroutines     int     `json:"goroutines"`
+}
+
+// soakEvent is a regime change; Kind is one of the soakEvent* constants
+type soakEvent struct {
+	Time      time.Time `json:"time"`
+	Timestamp int       `json:"timestamp"` // Seconds since the start
+	Kind      string    `json:"kind"`
+	Value     float64   `json:"value"`
+	Baseline  float64   `json:"baseline,omitempty"`
+	Threshold float64   `json:"threshold"`
+	Profiles  []string  `json:"profiles,omitempty"`
+}
+
+const (
+	soakEventDropCliff     = "drop_rate_cliff"     // Window drop rate rose above DropThreshold
+	soakEventDropRecovered = "drop_rate_recovered" // and fell back below it
+	soakEventP95Spike      = "flush_p95_spike"     // Window flush p95 reached P95Factor x baseline
+	soakEventP95Recovered  = "flush_p95_recovered" // and fell back below it
+	soakEventMemGrowth     = "memory_growth"       // Heap reached MemFactor x baseline (once per doubling)
+)
+
+// soakSummary is the file written to SummaryPath
+type soakSummary struct {
+	Start       time.Time   `json:"start"`
+	Config      soakConfig  `json:"config"`
+	BaselineP95 float64     `json:"baseline_flush_p95_ms"`
+	BaselineMem float64     `json:"baseline_heap_mb"`
+	Points      []soakPoint `json:"points"`
+	Events      []soakEvent `json:"events"`
+}
+
+// soakCounter is the cumulative log counters at one sample
+type soakCounter struct {
+	at          time.Time
+	logs, drops int64
+}
+
+// flushSample is the duration of one flush
+type flushSample struct {
+	at time.Time
+	d  time.Duration
+}
+
+// soakMonitor tracks the rolling windows and detects regime changes; safe for concurrent use
+type soakMonitor struct {
+	cfg   soakConfig
+	start time.Time
+
+	mu       sync.Mutex
+	counters []soakCounter // Samples within the window, plus the last one before it
+	flushes  []flushSample // Flushes within the window
+	summary  soakSummary
+	cliff    bool    // Window drop rate is above the threshold
+	spike    bool    // Window flush p95 is above the threshold
+	memLimit float64 // Heap (MB) of the next memory_growth event
+}
+
+// newSoakMonitor starts block profiling (for the profiles taken at events) and returns a monitor
+func newSoakMonitor(cfg soakConfig) (*soakMonitor, error) {
+	if err := os.MkdirAll(cfg.ProfileDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create profile directory: %w", err)
+	}
+	runtime.SetBlockProfileRate(int(time.Millisecond))
+	start := time.Now()
+	return &soakMonitor{
+		cfg:     cfg,
+		start:   start,
+		summary: soakSummary{Start: start, Config: cfg},
+	}, nil
+}
+
+// observeFlush records a flush duration (flush observer)
+func (m *soakMonitor) observeFlush(o asyncloguploader.FlushObservation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.flushes = append(m.flushes, flushSample{at: time.Now(), d: o.Duration})
+}
+
+// sample records the counters of one stats tick, checks for regime changes and rewrites the summary
+func (m *soakMonitor) sample(stats asyncloguploader.StatsSnapshot, flush asyncloguploader.FlushMetrics, mem *runtime.MemStats) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Keep the newest counter sample before the window as the window's base
+	m.counters = append(m.counters, soakCounter{at: now, logs: stats.TotalLogs, drops: stats.DroppedLogs})
+	windowStart := now.Add(-m.cfg.Window)
+	for len(m.counters) > 2 && !m.counters[1].at.After(windowStart) {
+		m.counters = m.counters[1:]
+	}
+	for len(m.flushes) > 0 && m.flushes[0].at.Before(windowStart) {
+		m.flushes = m.flushes[1:]
+	}
+
+	base, last := m.counters[0], m.counters[len(m.counters)-1]
+	windowDropRate := 0.0
+	if logs := last.logs - base.logs; logs > 0 {
+		windowDropRate = float64(last.drops-base.drops) / float64(logs) * 100
+	}
+	p95 := m.flushP95()
+
+	point := soakPoint{
+		Timestamp:      int(now.Sub(m.start).Seconds()),
+		Logs:           stats.TotalLogs,
+		Dropped:        stats.DroppedLogs,
+		GCCycles:       int(mem.NumGC),
+		GCPause:        float64(mem.PauseTotalNs) / 1e6,
+		Memory:         float64(mem.Alloc) / 1024 / 1024,
+		FlushAvg:       float64(flush.AvgFlushDuration) / 1e6,
+		FlushMax:       float64(flush.MaxFlushDuration) / 1e6,
+		FlushQueue:     flush.FlushQueueDepth,
+		FlushBlocked:   flush.BlockedSwaps,
+		FlushTotal:     flush.TotalFlushes,
+		WindowDropRate: windowDropRate,
+		FlushP95:       float64(p95) / 1e6,
+		HeapInuse:      float64(mem.HeapInuse) / 1024 / 1024,
+		Goroutines:     runtime.NumGoroutine(),
+	}
+	if stats.TotalLogs > 0 {
+		point.DropRate = float64(stats.DroppedLogs) / float64(stats.TotalLogs) * 100
+	}
+	m.summary.Points = append(m.summary.Points, point)
+
+	m.detect(now, point)
+	if err := m.writeSummary(); err != nil {
+		log.Printf("[WARNING] Soak: %v", err)
+	}
+}
+
+// flushP95 returns the p95 flush duration in the window (0 without flushes)
+func (m *soakMonitor) flushP95() time.Duration {
+	if len(m.flushes) == 0 {
+		return 0
+	}
+	durations := make([]time.Duration, len(m.flushes))
+	for i, f := range m.flushes {
+		durations[i] = f.d
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	return durations[(len(durations)-1)*95/100]
+}
+
+// detect compares a sample with the thresholds and emits an event for every crossing
+// The flush p95 and heap baselines are taken from the first sample after one full window
+func (m *soakMonitor) detect(now time.Time, point soakPoint) {
+	switch {
+	case !m.cliff && point.WindowDropRate > m.cfg.DropThreshold:
+		m.cliff = true
+		m.emit(now, point, soakEventDropCliff, point.WindowDropRate, 0, m.cfg.DropThreshold)
+	case m.cliff && point.WindowDropRate <= m.cfg.DropThreshold:
+		m.cliff = false
+		m.emit(now, point, soakEventDropRecovered, point.WindowDropRate, 0, m.cfg.DropThreshold)
+	}
+
+	if now.Sub(m.start) < m.cfg.Window {
+		return
+	}
+	if m.summary.BaselineP95 == 0 && point.FlushP95 > 0 {
+		m.summary.BaselineP95 = point.FlushP95
+	}
+	if m.summary.BaselineMem == 0 {
+		m.summary.BaselineMem = point.Memory
+		m.memLimit = point.Memory * m.cfg.MemFactor
+	}
+
+	if baseline := m.summary.BaselineP95; baseline > 0 {
+		threshold := baseline * m.cfg.P95Factor
+		switch {
+		case !m.spike && point.FlushP95 >= threshold:
+			m.spike = true
+			m.emit(now, point, soakEventP95Spike, point.FlushP95, baseline, threshold)
+		case m.spike && point.FlushP95 < threshold:
+			m.spike = false
+			m.emit(now, point, soakEventP95Recovered, point.FlushP95, baseline, threshold)
+		}
+	}
+
+	if m.memLimit > 0 && point.Memory >= m.memLimit {
+		m.emit(now, point, soakEventMemGrowth, point.Memory, m.summary.BaselineMem, m.memLimit)
+		for m.memLimit <= point.Memory {
+			m.memLimit *= m.cfg.MemFactor
+		}
+	}
+}
+
+// emit records an event, captures profiles for the onset of a regime and logs it as a SOAK_EVENT line
+func (m *soakMonitor) emit(now time.Time, point soakPoint, kind string, value, baseline, threshold float64) {
+	event := soakEvent{
+		Time:      now,
+		Timestamp: point.Timestamp,
+		Kind:      kind,
+		Value:     value,
+		Baseline:  baseline,
+		Threshold: threshold,
+	}
+	if kind != soakEventDropRecovered && kind != soakEventP95Recovered {
+		event.Profiles = m.captureProfiles(fmt.Sprintf("%05ds_%s", point.Timestamp, kind))
+	}
+	m.summary.Events = append(m.summary.Events, event)
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	log.Printf("SOAK_EVENT: %s", line)
+}
+
+// captureProfiles writes the heap, goroutine and block profiles as {prefix}_{profile}.pprof
+func (m *soakMonitor) captureProfiles(prefix string) []string {
+	var paths []string
+	for _, name := range []string{"heap", "goroutine", "block"} {
+		path := filepath.Join(m.cfg.ProfileDir, fmt.Sprintf("%s_%s.pprof", prefix, name))
+		f, err := os.Create(path)
+		if err != nil {
+			log.Printf("[WARNING] Soak: failed to create %s profile: %v", name, err)
+			continue
+		}
+		err = pprof.Lookup(name).WriteTo(f, 0)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			log.Printf("[WARNING] Soak: failed to write %s profile: %v", name, err)
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// writeSummary replaces the summary file, so a run stopped early still leaves a complete one
+func (m *soakMonitor) writeSummary() error {
+	data, err := json.MarshalIndent(m.summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode summary: %w", err)
+	}
+	tmp := m.cfg.SummaryPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+	if err := os.Rename(tmp, m.cfg.SummaryPath); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+	return nil
+}
+
+// finish logs the events of the run and where the summary is
+func (m *soakMonitor) finish() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.writeSummary(); err != nil {
+		log.Printf("[WARNING] Soak: %v", err)
+	}
+	log.Printf("Soak summary: %d samples, %d events -> %s", len(m.summary.Points), len(m.summary.Events), m.cfg.SummaryPath)
+	for _, event := range m.summary.Events {
+		log.Printf("  %6ds %-20s value=%.3f threshold=%.3f", event.Timestamp, event.Kind, event.Value, event.Threshold)
+	}
+}
@@ -0,0 +1,89 @@
+// Command cshim exports an asynclogger.LoggerManager to C and C++ code. Build it as a static library:
+//
+//	go build -buildmode=c-archive -o libasynclogger.a ./cmd/cshim
+//
+// which also writes libasynclogger.h with the functions below and the LOGGER_* result codes; link
+// the archive with -lpthread. One manager serves the whole process:
+//
+//	int logger_init(const char *config_json);                          // See shimConfig
+//	int logger_log_event(const char *event, const void *data, size_t len);
+//	int logger_flush(void);                                            // LoggerManager.FlushAll
+//	int logger_close(void);                                            // LoggerManager.Close
+//
+// Every function may be called from any thread, including threads the Go runtime did not create.
+// logger_log_event is LoggerManager.TryLogBytesWithEvent: it does not wait for flushes (the first
+// call for an event creates its log file), copies data straight into a shard buffer before
+// returning (data is read in place, without an intermediate copy, and is not retained) and returns
+// LOGGER_ERR_BUFFER_FULL instead of waiting when the buffers are full, unless drop_policy is
+// "block". Calls racing with logger_close either complete first or return
+// LOGGER_ERR_NOT_INITIALIZED. Errors beyond the result code are printed to stderr.
+// testdata/cshim_test.c is a small example
+package main
+
+/*
+#include <stddef.h>
+
+// Results of the logger_* functions: LOGGER_OK, or a negative LOGGER_ERR_* code
+enum {
+	LOGGER_OK = 0,
+	LOGGER_ERR_NOT_INITIALIZED = -1,     // logger_init has not been called, or logger_close has
+	LOGGER_ERR_ALREADY_INITIALIZED = -2, // logger_init was called twice without logger_close
+	LOGGER_ERR_INVALID_CONFIG = -3,      // The config JSON is malformed or invalid
+	LOGGER_ERR_CLOSED = -4,              // The event's logger is closed (asynclogger.ErrClosed)
+	LOGGER_ERR_BUFFER_FULL = -5,         // Dropped: buffers full (asynclogger.ErrBufferFull)
+	LOGGER_ERR_OVERSIZED = -6,           // Dropped: larger than a shard (asynclogger.ErrOversized)
+	LOGGER_ERR_INVALID_EVENT = -7,       // The event name is empty or unusable as a file name
+	LOGGER_ERR_DRAINING = -8,            // The manager is draining (asynclogger.ErrDraining)
+	LOGGER_ERR_FAILED = -9,              // Any other error, e.g. the event's log file could not be created
+};
+*/
+import "C"
+
+import "unsafe"
+
+// Result codes, as declared for C above
+const (
+	resultOK                 = C.LOGGER_OK
+	resultNotInitialized     = C.LOGGER_ERR_NOT_INITIALIZED
+	resultAlreadyInitialized = C.LOGGER_ERR_ALREADY_INITIALIZED
+	resultInvalidConfig      = C.LOGGER_ERR_INVALID_CONFIG
+	resultClosed             = C.LOGGER_ERR_CLOSED
+	resultBufferFull         = C.LOGGER_ERR_BUFFER_FULL
+	resultOversized          = C.LOGGER_ERR_OVERSIZED
+	resultInvalidEvent       = C.LOGGER_ERR_INVALID_EVENT
+	resultDraining           = C.LOGGER_ERR_DRAINING
+	resultFailed             = C.LOGGER_ERR_FAILED
+)
+
+//export logger_init
+func logger_init(configJSON *C.char) C.int {
+	if configJSON == nil {
+		return resultInvalidConfig
+	}
+	return C.int(initLogger([]byte(C.GoString(configJSON))))
+}
+
+//export logger_log_event
+func logger_log_event(event *C.char, data unsafe.Pointer, length C.size_t) C.int {
+	if event == nil {
+		return resultInvalidEvent
+	}
+	var payload []byte
+	if data != nil && length > 0 {
+		payload = unsafe.Slice((*byte)(data), int(length))
+	}
+	return C.int(logEvent(C.GoString(event), payload))
+}
+
+//export logger_flush
+func logger_flush() C.int {
+	return C.int(flushLogger())
+}
+
+//export logger_close
+func logger_close() C.int {
+	return C.int(closeLogger())
+}
+
+// main is required by -buildmode=c-archive and never runs
+func main() {}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger"
+)
+
+// shimConfig is the JSON object logger_init takes; fields left out keep asynclogger.DefaultConfig.
+// Durations are strings for time.ParseDuration, e.g. "10s"; unknown fields are rejected
+type shimConfig struct {
+	LogDir           string `json:"log_dir"` // Required: each event is written to {log_dir}/{event}.log
+	BufferSize       int    `json:"buffer_size"`
+	NumShards        int    `json:"num_shards"`
+	FlushInterval    string `json:"flush_interval"`
+	RotationInterval string `json:"rotation_interval"`
+	MaxFileSize      int64  `json:"max_file_size"`
+	DropPolicy       string `json:"drop_policy"`
+	IOMode           string `json:"io_mode"`
+	OutputFormat     string `json:"output_format"`
+	PrependTimestamp string `json:"prepend_timestamp"`
+	SequenceNumbers  bool   `json:"sequence_numbers"`
+}
+
+// parseShimConfig decodes the JSON of logger_init into a manager config
+func parseShimConfig(data []byte) (asynclogger.Config, error) {
+	var sc shimConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&sc); err != nil {
+		return asynclogger.Config{}, fmt.Errorf("invalid config JSON: %w", err)
+	}
+	if sc.LogDir == "" {
+		return asynclogger.Config{}, fmt.Errorf("log_dir is required")
+	}
+
+	// The manager puts event files in the directory of LogFilePath
+	config := asynclogger.DefaultConfig(filepath.Join(sc.LogDir, "cshim.log"))
+	if sc.BufferSize > 0 {
+		config.BufferSize = sc.BufferSize
+	}
+	if sc.NumShards > 0 {
+		config.NumShards = sc.NumShards
+	}
+	for _, d := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"flush_interval", sc.FlushInterval, &config.FlushInterval},
+		{"rotation_interval", sc.RotationInterval, &config.RotationInterval},
+	} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil {
+			return asynclogger.Config{}, fmt.Errorf("%s: %w", d.name, err)
+		}
+		*d.dst = v
+	}
+	config.MaxFileSize = sc.MaxFileSize
+	if sc.DropPolicy != "" {
+		config.DropPolicy = asynclogger.DropPolicy(sc.DropPolicy)
+	}
+	if sc.IOMode != "" {
+		config.IOMode = asynclogger.IOMode(sc.IOMode)
+	}
+	config.OutputFormat = asynclogger.OutputFormat(sc.OutputFormat)
+	config.PrependTimestamp = asynclogger.TimestampFormat(sc.PrependTimestamp)
+	config.SequenceNumbers = sc.SequenceNumbers
+	return config, nil
+}
+
+// mu guards manager: logging and flushing hold it for reading, so they run concurrently, and
+// logger_init and logger_close for writing, so close waits for the calls in progress
+var (
+	mu      sync.RWMutex
+	manager *asynclogger.LoggerManager
+)
+
+// initLogger creates the process-wide manager (logger_init)
+func initLogger(configJSON []byte) int {
+	config, err := parseShimConfig(configJSON)
+	if err != nil {
+		log.Printf("[CSHIM_ERROR] logger_init: %v", err)
+		return resultInvalidConfig
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if manager != nil {
+		return resultAlreadyInitialized
+	}
+	lm, err := asynclogger.NewLoggerManager(config)
+	if err != nil {
+		log.Printf("[CSHIM_ERROR] logger_init: %v", err)
+		return resultInvalidConfig
+	}
+	manager = lm
+	return resultOK
+}
+
+// logEvent logs data to the event's logger (logger_log_event)
+func logEvent(event string, data []byte) int {
+	mu.RLock()
+	defer mu.RUnlock()
+	if manager == nil {
+		return resultNotInitialized
+	}
+	return resultCode(manager.TryLogBytesWithEvent(event, data))
+}
+
+// flushLogger flushes every event logger (logger_flush)
+func flushLogger() int {
+	mu.RLock()
+	defer mu.RUnlock()
+	if manager == nil {
+		return resultNotInitialized
+	}
+	if err := manager.FlushAll(context.Background()); err != nil {
+		log.Printf("[CSHIM_ERROR] logger_flush: %v", err)
+		return resultFailed
+	}
+	return resultOK
+}
+
+// closeLogger closes the manager (logger_close); logger_init may be called again afterwards
+func closeLogger() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if manager == nil {
+		return resultNotInitialized
+	}
+	err := manager.Close()
+	manager = nil
+	if err != nil {
+		log.Printf("[CSHIM_ERROR] logger_close: %v", err)
+		return resultFailed
+	}
+	return resultOK
+}
+
+// resultCode maps an error of TryLogBytesWithEvent to its LOGGER_* code
+func resultCode(err error) int {
+	switch {
+	case err == nil:
+		return resultOK
+	case errors.Is(err, asynclogger.ErrClosed):
+		return resultClosed
+	case errors.Is(err, asynclogger.ErrBufferFull):
+		return resultBufferFull
+	case errors.Is(err, asynclogger.ErrOversized):
+		return resultOversized
+	case errors.Is(err, asynclogger.ErrInvalidEventName):
+		return resultInvalidEvent
+	case errors.Is(err, asynclogger.ErrDraining):
+		return resultDraining
+	default:
+		return resultFailed
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readEvent returns the entries of an event's log file and its rotated files, sorted
+func readEvent(t *testing.T, dir, event string) []string {
+	t.Helper()
+	files, err := reader.RotatedFiles(filepath.Join(dir, event+".log"))
+	require.NoError(t, err)
+	r, err := reader.OpenFiles(files, reader.Options{})
+	require.NoError(t, err)
+	defer r.Close()
+
+	var entries []string
+	for {
+		entry, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		entries = append(entries, string(entry))
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+func TestShim_LogEvents(t *testing.T) {
+	dir := t.TempDir()
+	assert.Equal(t, resultNotInitialized, logEvent("events", []byte("early")))
+	assert.Equal(t, resultNotInitialized, flushLogger())
+
+	config := fmt.Sprintf(`{"log_dir": %q, "buffer_size": 1048576, "num_shards": 4, "flush_interval": "1h"}`, dir)
+	require.Equal(t, resultOK, initLogger([]byte(config)))
+	assert.Equal(t, resultAlreadyInitialized, initLogger([]byte(config)))
+
+	// Concurrent writers, as from several C threads
+	const goroutines, entries = 8, 200
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < entries; i++ {
+				assert.Equal(t, resultOK, logEvent("events", []byte(fmt.Sprintf("%d/%03d", g, i))))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, resultInvalidEvent, logEvent("", []byte("no event")))
+	assert.Equal(t, resultOversized, logEvent("events", make([]byte, 1024*1024)))
+	assert.Equal(t, resultOK, flushLogger())
+	require.Equal(t, resultOK, closeLogger())
+	assert.Equal(t, resultNotInitialized, logEvent("events", []byte("late")))
+	assert.Equal(t, resultNotInitialized, closeLogger())
+
+	got := readEvent(t, dir, "events")
+	require.Len(t, got, goroutines*entries)
+	assert.Equal(t, "0/000", got[0])
+	assert.Equal(t, fmt.Sprintf("%d/%03d", goroutines-1, entries-1), got[len(got)-1])
+
+	// logger_init works again after logger_close
+	require.Equal(t, resultOK, initLogger([]byte(config)))
+	require.Equal(t, resultOK, closeLogger())
+}
+
+func TestShim_Config(t *testing.T) {
+	for _, config := range []string{
+		`not json`,
+		`{}`,
+		`{"log_dir": "/tmp", "flush_interval": "soon"}`,
+		`{"log_dir": "/tmp", "unknown": 1}`,
+		`{"log_dir": "/tmp", "io_mode": "mmap"}`,
+	} {
+		assert.Equal(t, resultInvalidConfig, initLogger([]byte(config)), config)
+	}
+
+	config, err := parseShimConfig([]byte(`{"log_dir": "/var/log/app", "num_shards": 2, "rotation_interval": "1h", "output_format": "plain", "io_mode": "buffered"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "/var/log/app/cshim.log", config.LogFilePath)
+	assert.Equal(t, 2, config.NumShards)
+	assert.Equal(t, "1h0m0s", config.RotationInterval.String())
+	require.NoError(t, config.Validate())
+}
+
+// TestShim_CProgram builds the library and testdata/cshim_test.c, which logs from four pthreads
+func TestShim_CProgram(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a c-archive")
+	}
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler")
+	}
+
+	build := t.TempDir()
+	run := func(name string, args ...string) {
+		t.Helper()
+		out, err := exec.Command(name, args...).CombinedOutput()
+		require.NoError(t, err, "%s %v: %s", name, args, out)
+	}
+	run("go", "build", "-buildmode=c-archive", "-o", filepath.Join(build, "libasynclogger.a"), ".")
+	prog := filepath.Join(build, "cshim_test")
+	run(cc, "-I", build, "-o", prog, filepath.Join("testdata", "cshim_test.c"), filepath.Join(build, "libasynclogger.a"), "-lpthread")
+
+	logs := t.TempDir()
+	run(prog, logs)
+
+	got := readEvent(t, logs, "cpp_events")
+	require.Len(t, got, 4*1000)
+	_, err = os.Stat(filepath.Join(logs, "cpp_events.log"))
+	assert.NoError(t, err)
+}
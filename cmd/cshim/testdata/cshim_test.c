@@ -0,0 +1,71 @@
+// Exercises the cshim library from C: logger_init, logger_log_event from several threads,
+// logger_flush and logger_close. Build and run it (the Go test TestShim_CProgram does both):
+//
+//	go build -buildmode=c-archive -o libasynclogger.a ./cmd/cshim
+//	cc -I. -o cshim_test cmd/cshim/testdata/cshim_test.c libasynclogger.a -lpthread
+//	./cshim_test /tmp/logs   # Writes /tmp/logs/cpp_events.log
+//
+// Exits with status 0 when every call returned LOGGER_OK
+#include <pthread.h>
+#include <stdio.h>
+#include <string.h>
+
+#include "libasynclogger.h"
+
+#define THREADS 4
+#define ENTRIES 1000
+
+static void *log_entries(void *arg) {
+	long id = (long)arg;
+	char msg[64];
+	for (int i = 0; i < ENTRIES; i++) {
+		int n = snprintf(msg, sizeof msg, "thread %ld entry %d", id, i);
+		int rc = logger_log_event("cpp_events", msg, (size_t)n);
+		if (rc != LOGGER_OK) {
+			fprintf(stderr, "logger_log_event: %d\n", rc);
+			return (void *)1;
+		}
+	}
+	return NULL;
+}
+
+int main(int argc, char **argv) {
+	if (argc != 2) {
+		fprintf(stderr, "usage: %s log_dir\n", argv[0]);
+		return 2;
+	}
+
+	char config[512];
+	snprintf(config, sizeof config,
+		"{\"log_dir\": \"%s\", \"buffer_size\": 4194304, \"num_shards\": 4, \"drop_policy\": \"block\"}", argv[1]);
+	int rc = logger_init(config);
+	if (rc != LOGGER_OK) {
+		fprintf(stderr, "logger_init: %d\n", rc);
+		return 1;
+	}
+
+	pthread_t threads[THREADS];
+	for (long t = 0; t < THREADS; t++) {
+		pthread_create(&threads[t], NULL, log_entries, (void *)t);
+	}
+	int failed = 0;
+	for (int t = 0; t < THREADS; t++) {
+		void *result;
+		pthread_join(threads[t], &result);
+		failed |= result != NULL;
+	}
+
+	if ((rc = logger_flush()) != LOGGER_OK) {
+		fprintf(stderr, "logger_flush: %d\n", rc);
+		failed = 1;
+	}
+	if ((rc = logger_close()) != LOGGER_OK) {
+		fprintf(stderr, "logger_close: %d\n", rc);
+		failed = 1;
+	}
+	if ((rc = logger_log_event("cpp_events", "late", 4)) != LOGGER_ERR_NOT_INITIALIZED) {
+		fprintf(stderr, "logger_log_event after close: %d\n", rc);
+		failed = 1;
+	}
+	return failed;
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -34,6 +35,8 @@ func main() {
 		logDir           = flag.String("log-dir", "logs", "Log directory")
 		eventName        = flag.String("event", "test", "Event name for event-based logging")
 		useEventLogger   = flag.Bool("use-events", false, "Use LoggerManager with event-based logging")
+		flushHistory     = flag.Int("flush-history", 0, "Flushes to keep in each logger's flush history (0 to disable)")
+		flushHistoryOut  = flag.String("flush-history-out", "", "Flush history JSON file (default: <log-dir>/flush_history.json)")
 	)
 	flag.Parse()
 
@@ -50,11 +53,13 @@ func main() {
 	if *useEventLogger {
 		// Use LoggerManager for event-based logging
 		config := asynclogger.Config{
-			BufferSize:       *bufferMB * 1024 * 1024,
-			NumShards:        *numShards,
-			FlushInterval:    *flushInterval,
-			RotationInterval: *rotationInterval,
-			LogFilePath:      fmt.Sprintf("%s/%s.log", *logDir, *eventName),
+			BufferSize:        *bufferMB * 1024 * 1024,
+			NumShards:         *numShards,
+			FlushInterval:     *flushInterval,
+			RotationInterval:  *rotationInterval,
+			WriteRetryTimeout: 10 * time.Millisecond,
+			FlushHistorySize:  *flushHistory,
+			LogFilePath:       fmt.Sprintf("%s/%s.log", *logDir, *eventName),
 		}
 		loggerManager, err = asynclogger.NewLoggerManager(config)
 		if err != nil {
@@ -64,11 +69,13 @@ func main() {
 	} else {
 		// Use single Logger
 		config := asynclogger.Config{
-			BufferSize:       *bufferMB * 1024 * 1024,
-			NumShards:        *numShards,
-			FlushInterval:    *flushInterval,
-			RotationInterval: *rotationInterval,
-			LogFilePath:      fmt.Sprintf("%s/direct_test.log", *logDir),
+			BufferSize:        *bufferMB * 1024 * 1024,
+			NumShards:         *numShards,
+			FlushInterval:     *flushInterval,
+			RotationInterval:  *rotationInterval,
+			WriteRetryTimeout: 10 * time.Millisecond,
+			FlushHistorySize:  *flushHistory,
+			LogFilePath:       fmt.Sprintf("%s/direct_test.log", *logDir),
 		}
 		logger, err = asynclogger.New(config)
 		if err != nil {
@@ -142,10 +149,36 @@ func main() {
 	log.Println("=== Final Statistics ===")
 	printStats(loggerManager, logger, *useEventLogger)
 
+	if *flushHistory > 0 {
+		path := *flushHistoryOut
+		if path == "" {
+			path = fmt.Sprintf("%s/flush_history.json", *logDir)
+		}
+		if *useEventLogger {
+			writeFlushHistory(path, loggerManager.GetFlushHistoryByEvent())
+		} else {
+			writeFlushHistory(path, logger.GetFlushHistory())
+		}
+	}
+
 	elapsed := time.Since(startTime)
 	log.Printf("Test completed in %v", elapsed)
 }
 
+// writeFlushHistory writes v (Logger.GetFlushHistory or LoggerManager.GetFlushHistoryByEvent) to path as JSON
+func writeFlushHistory(path string, v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode flush history: %v", err)
+		return
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		log.Printf("Failed to write flush history: %v", err)
+		return
+	}
+	log.Printf("Flush history written to %s", path)
+}
+
 func worker(
 	loggerManager *asynclogger.LoggerManager,
 	logger *asynclogger.Logger,
@@ -184,15 +217,16 @@ func worker(
 }
 
 func printStats(loggerManager *asynclogger.LoggerManager, logger *asynclogger.Logger, useEventLogger bool) {
-	var totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps int64
+	var totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, bytesBuffered, bytesDurable int64
 	var avgFlushMs, maxFlushMs float64
 	var avgWriteMs, maxWriteMs float64
 	var writePercent float64
 	var avgPwritevMs, maxPwritevMs float64
 	var pwritevPercent float64
+	var queueDepth, blockedSwaps int64
 
 	if useEventLogger && loggerManager != nil {
-		totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps = loggerManager.GetStatsSnapshot()
+		totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, bytesBuffered, bytesDurable = loggerManager.GetStatsSnapshot()
 		flushMetrics := loggerManager.GetAggregatedFlushMetrics()
 		avgFlushMs = float64(flushMetrics.AvgFlushDuration.Nanoseconds()) / 1e6
 		maxFlushMs = float64(flushMetrics.MaxFlushDuration.Nanoseconds()) / 1e6
@@ -202,8 +236,9 @@ func printStats(loggerManager *asynclogger.LoggerManager, logger *asynclogger.Lo
 		avgPwritevMs = float64(flushMetrics.AvgPwritevDuration.Nanoseconds()) / 1e6
 		maxPwritevMs = float64(flushMetrics.MaxPwritevDuration.Nanoseconds()) / 1e6
 		pwritevPercent = flushMetrics.PwritevPercent
+		queueDepth, blockedSwaps = flushMetrics.FlushQueueDepth, flushMetrics.BlockedSwaps
 	} else if logger != nil {
-		totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps = logger.GetStatsSnapshot()
+		totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, bytesBuffered, bytesDurable = logger.GetStatsSnapshot()
 		flushMetrics := logger.GetFlushMetrics()
 		avgFlushMs = float64(flushMetrics.AvgFlushDuration.Nanoseconds()) / 1e6
 		maxFlushMs = float64(flushMetrics.MaxFlushDuration.Nanoseconds()) / 1e6
@@ -213,6 +248,7 @@ func printStats(loggerManager *asynclogger.LoggerManager, logger *asynclogger.Lo
 		avgPwritevMs = float64(flushMetrics.AvgPwritevDuration.Nanoseconds()) / 1e6
 		maxPwritevMs = float64(flushMetrics.MaxPwritevDuration.Nanoseconds()) / 1e6
 		pwritevPercent = flushMetrics.PwritevPercent
+		queueDepth, blockedSwaps = flushMetrics.FlushQueueDepth, flushMetrics.BlockedSwaps
 	}
 
 	dropRate := 0.0
@@ -223,8 +259,9 @@ func printStats(loggerManager *asynclogger.LoggerManager, logger *asynclogger.Lo
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
 
-	log.Printf("METRICS: Logs: %d Dropped: %d (%.4f%%) | Bytes: %d | Flushes: %d Errors: %d Swaps: %d | AvgFlush: %.2fms MaxFlush: %.2fms | AvgWrite: %.2fms MaxWrite: %.2fms WritePct: %.1f%% | AvgPwritev: %.2fms MaxPwritev: %.2fms PwritevPct: %.1f%% | GC: %d cycles %.2fms pause | Mem: %.2fMB",
-		totalLogs, droppedLogs, dropRate, bytesWritten, flushes, flushErrors, setSwaps,
+	log.Printf("METRICS: Logs: %d Dropped: %d (%.4f%%) | Bytes: %d Buffered: %d Durable: %d | Flushes: %d Errors: %d Swaps: %d Queue: %d Blocked: %d | AvgFlush: %.2fms MaxFlush: %.2fms | AvgWrite: %.2fms MaxWrite: %.2fms WritePct: %.1f%% | AvgPwritev: %.2fms MaxPwritev: %.2fms PwritevPct: %.1f%% | GC: %d cycles %.2fms pause | Mem: %.2fMB",
+		totalLogs, droppedLogs, dropRate, bytesWritten, bytesBuffered, bytesDurable, flushes, flushErrors, setSwaps,
+		queueDepth, blockedSwaps,
 		avgFlushMs, maxFlushMs,
 		avgWriteMs, maxWriteMs, writePercent,
 		avgPwritevMs, maxPwritevMs, pwritevPercent,
@@ -0,0 +1,222 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Minimal io_uring writer mirroring the logger's experimental backend:
+// one WRITE_FIXED SQE per buffer plus a drained fdatasync SQE per write
+
+const (
+	ioringOffSQRing      = 0
+	ioringOffCQRing      = 0x8000000
+	ioringOffSQEs        = 0x10000000
+	ioringOpFsync        = 3
+	ioringOpWriteFixed   = 5
+	ioringFsyncDatasync  = 1 << 0
+	iosqeIODrain         = 1 << 1
+	ioringEnterGetEvents = 1 << 0
+	ioringRegisterBufs   = 0
+	ioringFeatSingleMmap = 1 << 0
+)
+
+type ioUringParams struct {
+	sqEntries, cqEntries, flags, sqThreadCPU, sqThreadIdle, features, wqFd uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  [10]uint32 // head, tail, ring_mask, ring_entries, flags, dropped, array, resv1, user_addr
+	cqOff                                                                  [10]uint32 // head, tail, ring_mask, ring_entries, overflow, cqes, flags, resv1, user_addr
+}
+
+type ioUringSQE struct {
+	opcode, flags uint8
+	ioprio        uint16
+	fd            int32
+	off, addr     uint64
+	len, opFlags  uint32
+	userData      uint64
+	bufIndex      uint16
+	_             [22]byte
+}
+
+type ioUringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// benchRing is a single-producer io_uring used by the benchmark loop
+type benchRing struct {
+	fd      int
+	sqRing  []byte
+	cqRing  []byte
+	sqeMem  []byte
+	sqTail  *uint32
+	sqMask  uint32
+	sqArray []uint32
+	sqes    []ioUringSQE
+	cqHead  *uint32
+	cqTail  *uint32
+	cqMask  uint32
+	cqes    []ioUringCQE
+	buffers [][]byte
+}
+
+// newBenchRing creates a ring and registers the pre-generated buffers
+func newBenchRing(buffers [][]byte) (*benchRing, error) {
+	var p ioUringParams
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, 4, uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("io_uring_setup failed (kernel lacks io_uring support?): %w", errno)
+	}
+	r := &benchRing{fd: int(fd)}
+
+	sqSize := int(p.sqOff[6] + p.sqEntries*4)
+	cqSize := int(p.cqOff[5] + p.cqEntries*uint32(unsafe.Sizeof(ioUringCQE{})))
+	if p.features&ioringFeatSingleMmap != 0 && cqSize > sqSize {
+		sqSize = cqSize
+	}
+
+	var err error
+	prot, flags := unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE
+	if r.sqRing, err = unix.Mmap(r.fd, ioringOffSQRing, sqSize, prot, flags); err != nil {
+		r.Close()
+		return nil, fmt.Errorf("failed to mmap SQ ring: %w", err)
+	}
+	r.cqRing = r.sqRing
+	if p.features&ioringFeatSingleMmap == 0 {
+		if r.cqRing, err = unix.Mmap(r.fd, ioringOffCQRing, cqSize, prot, flags); err != nil {
+			r.Close()
+			return nil, fmt.Errorf("failed to mmap CQ ring: %w", err)
+		}
+	}
+	if r.sqeMem, err = unix.Mmap(r.fd, ioringOffSQEs, int(p.sqEntries)*int(unsafe.Sizeof(ioUringSQE{})), prot, flags); err != nil {
+		r.Close()
+		return nil, fmt.Errorf("failed to mmap SQEs: %w", err)
+	}
+
+	r.sqTail = (*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff[1]]))
+	r.sqMask = *(*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff[2]]))
+	r.sqArray = unsafe.Slice((*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff[6]])), p.sqEntries)
+	r.sqes = unsafe.Slice((*ioUringSQE)(unsafe.Pointer(&r.sqeMem[0])), p.sqEntries)
+	r.cqHead = (*uint32)(unsafe.Pointer(&r.cqRing[p.cqOff[0]]))
+	r.cqTail = (*uint32)(unsafe.Pointer(&r.cqRing[p.cqOff[1]]))
+	r.cqMask = *(*uint32)(unsafe.Pointer(&r.cqRing[p.cqOff[2]]))
+	r.cqes = unsafe.Slice((*ioUringCQE)(unsafe.Pointer(&r.cqRing[p.cqOff[5]])), p.cqEntries)
+
+	// Register buffers so each submit avoids page mapping (same as logger)
+	iovecs := make([]unix.Iovec, len(buffers))
+	for i, buf := range buffers {
+		iovecs[i].Base = &buf[0]
+		iovecs[i].SetLen(len(buf))
+	}
+	_, _, errno = unix.Syscall6(unix.SYS_IO_URING_REGISTER, uintptr(r.fd), ioringRegisterBufs,
+		uintptr(unsafe.Pointer(&iovecs[0])), uintptr(len(iovecs)), 0, 0)
+	runtime.KeepAlive(iovecs)
+	if errno != 0 {
+		r.Close()
+		return nil, fmt.Errorf("io_uring buffer registration failed: %w", errno)
+	}
+	r.buffers = buffers
+
+	return r, nil
+}
+
+// writeAligned writes registered buffer bufIndex at offset and waits for the write and fdatasync
+func (r *benchRing) writeAligned(fd int, bufIndex int, offset int64) (int, error) {
+	buf := r.buffers[bufIndex]
+	tail := atomic.LoadUint32(r.sqTail)
+
+	sqe := r.nextSQE(tail)
+	sqe.opcode = ioringOpWriteFixed
+	sqe.fd = int32(fd)
+	sqe.off = uint64(offset)
+	sqe.addr = uint64(uintptr(unsafe.Pointer(&buf[0])))
+	sqe.len = uint32(len(buf))
+	sqe.bufIndex = uint16(bufIndex)
+	sqe.userData = 0
+
+	sqe = r.nextSQE(tail + 1)
+	sqe.opcode = ioringOpFsync
+	sqe.flags = iosqeIODrain
+	sqe.fd = int32(fd)
+	sqe.opFlags = ioringFsyncDatasync
+	sqe.userData = 1
+
+	atomic.StoreUint32(r.sqTail, tail+2)
+	if err := r.enter(2, 2, ioringEnterGetEvents); err != nil {
+		return 0, fmt.Errorf("io_uring_enter failed: %w", err)
+	}
+
+	// Reap both completions
+	var writeRes, syncRes int32
+	for reaped := 0; reaped < 2; {
+		head := atomic.LoadUint32(r.cqHead)
+		cqTail := atomic.LoadUint32(r.cqTail)
+		if head == cqTail {
+			if err := r.enter(0, 1, ioringEnterGetEvents); err != nil {
+				return 0, fmt.Errorf("io_uring_enter failed: %w", err)
+			}
+			continue
+		}
+		for ; head != cqTail; head++ {
+			cqe := r.cqes[head&r.cqMask]
+			if cqe.userData == 0 {
+				writeRes = cqe.res
+			} else {
+				syncRes = cqe.res
+			}
+			reaped++
+		}
+		atomic.StoreUint32(r.cqHead, head)
+	}
+
+	if writeRes < 0 {
+		return 0, fmt.Errorf("write failed: %w", unix.Errno(-writeRes))
+	}
+	if syncRes < 0 {
+		return 0, fmt.Errorf("fdatasync failed: %w", unix.Errno(-syncRes))
+	}
+	return int(writeRes), nil
+}
+
+func (r *benchRing) nextSQE(tail uint32) *ioUringSQE {
+	idx := tail & r.sqMask
+	r.sqArray[idx] = idx
+	sqe := &r.sqes[idx]
+	*sqe = ioUringSQE{}
+	return sqe
+}
+
+func (r *benchRing) enter(toSubmit, minComplete, flags uint32) error {
+	for {
+		_, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(r.fd), uintptr(toSubmit), uintptr(minComplete), uintptr(flags), 0, 0)
+		if errno == unix.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	}
+}
+
+// Close unmaps the rings and closes the ring fd
+func (r *benchRing) Close() error {
+	if r.sqeMem != nil {
+		unix.Munmap(r.sqeMem)
+	}
+	if r.cqRing != nil && &r.cqRing[0] != &r.sqRing[0] {
+		unix.Munmap(r.cqRing)
+	}
+	if r.sqRing != nil {
+		unix.Munmap(r.sqRing)
+	}
+	return unix.Close(r.fd)
+}
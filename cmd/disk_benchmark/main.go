@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"syscall"
 	"time"
 	"unsafe"
@@ -31,16 +32,19 @@ func allocAlignedBuffer(size int) []byte {
 	return buf[offset : offset+alignedSize]
 }
 
-// openDirectIOBenchmark opens a file with O_DIRECT and O_DSYNC flags (same as logger)
-func openDirectIOBenchmark(path string) (*os.File, error) {
+// openDirectIOBenchmark opens a file with O_DIRECT, plus O_DSYNC when dsync is set (same as logger)
+// The io_uring backend opens without O_DSYNC and relies on its fdatasync SQE instead
+func openDirectIOBenchmark(path string, dsync bool) (*os.File, error) {
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	fd, err := syscall.Open(path,
-		syscall.O_WRONLY|syscall.O_CREAT|syscall.O_DIRECT|syscall.O_DSYNC,
-		0644)
+	flags := syscall.O_WRONLY | syscall.O_CREAT | syscall.O_DIRECT
+	if dsync {
+		flags |= syscall.O_DSYNC
+	}
+	fd, err := syscall.Open(path, flags, 0644)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file with O_DIRECT: %w", err)
 	}
@@ -54,6 +58,21 @@ func openDirectIOBenchmark(path string) (*os.File, error) {
 	return file, nil
 }
 
+// preallocate reserves size bytes of file with method: fallocate (real extents), truncate (sparse) or none
+func preallocate(file *os.File, method string, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	switch method {
+	case "fallocate":
+		return unix.Fallocate(int(file.Fd()), 0, 0, size)
+	case "truncate":
+		return file.Truncate(size)
+	default:
+		return nil
+	}
+}
+
 // writeAligned writes aligned buffer using Pwritev at specific offset
 func writeAligned(fd int, buffer []byte, offset int64) (int, error) {
 	if len(buffer) == 0 {
@@ -139,18 +158,48 @@ type Stats struct {
 func main() {
 	var (
 		bufferSizeMB = flag.Int("buffer-mb", 32, "Buffer size in MB")
-		duration     = flag.Duration("duration", 5*time.Minute, "Test duration")
+		duration     = flag.Duration("duration", 5*time.Minute, "Test duration (per backend)")
 		logPath      = flag.String("log-path", "logs/disk_benchmark.log", "Log file path")
 		numBuffers   = flag.Int("num-buffers", 10, "Number of pre-generated buffers (for different data)")
+		backend      = flag.String("backend", "pwritev", "Write backend: pwritev, iouring (experimental), or both to compare on the same device")
+		prealloc     = flag.String("prealloc", "none", "Preallocation before writing: fallocate, truncate, none, or all to compare them")
+		preallocMB   = flag.Int("prealloc-mb", 1024, "Size to preallocate in MB (with -prealloc)")
+		stripePaths  = flag.String("stripe-paths", "", "Comma-separated files on separate devices: write every buffer to 1..N of them concurrently and report the scaling (pwritev only)")
 	)
 	flag.Parse()
 
+	var backends []string
+	switch *backend {
+	case "pwritev", "iouring":
+		backends = []string{*backend}
+	case "both":
+		backends = []string{"pwritev", "iouring"}
+	default:
+		log.Fatalf("Unknown backend %q (want pwritev, iouring, or both)", *backend)
+	}
+
+	var preallocs []string
+	switch *prealloc {
+	case "fallocate", "truncate", "none":
+		preallocs = []string{*prealloc}
+	case "all":
+		preallocs = []string{"fallocate", "truncate", "none"}
+	default:
+		log.Fatalf("Unknown prealloc %q (want fallocate, truncate, none, or all)", *prealloc)
+	}
+	if len(backends) > 1 && len(preallocs) > 1 {
+		log.Fatalf("Compare either backends (-backend both) or preallocation (-prealloc all), not both at once")
+	}
+	preallocSize := int64(*preallocMB) * 1024 * 1024
+
 	bufferSize := *bufferSizeMB * 1024 * 1024
 	log.Printf("Starting disk benchmark:")
 	log.Printf("  Buffer Size: %d MB (%d bytes)", *bufferSizeMB, bufferSize)
 	log.Printf("  Duration: %v", *duration)
 	log.Printf("  Log Path: %s", *logPath)
 	log.Printf("  Pre-generated Buffers: %d", *numBuffers)
+	log.Printf("  Backends: %v", backends)
+	log.Printf("  Preallocation: %v (%d MB)", preallocs, *preallocMB)
 	log.Println()
 
 	// Pre-generate buffers with different data (to avoid affecting measurements)
@@ -168,39 +217,101 @@ func main() {
 	log.Printf("✓ Pre-generated %d buffers", *numBuffers)
 	log.Println()
 
+	if *stripePaths != "" {
+		if len(backends) > 1 || len(preallocs) > 1 || backends[0] != "pwritev" {
+			log.Fatalf("-stripe-paths uses the pwritev backend with a single -prealloc method")
+		}
+		if err := runStripedBenchmarks(strings.Split(*stripePaths, ","), preallocs[0], preallocSize, buffers, *duration, *bufferSizeMB); err != nil {
+			log.Fatalf("Striped benchmark failed: %v", err)
+		}
+		return
+	}
+
+	results := make(map[string]Stats, len(backends)*len(preallocs))
+	for _, name := range backends {
+		for _, method := range preallocs {
+			// Separate file per run so every run starts from an empty file on the same device
+			path := *logPath
+			key := name
+			if len(backends) > 1 {
+				path = fmt.Sprintf("%s.%s", *logPath, name)
+			} else if len(preallocs) > 1 {
+				path = fmt.Sprintf("%s.%s", *logPath, method)
+				key = method
+			}
+			metrics, err := runBenchmark(name, method, preallocSize, path, buffers, *duration)
+			if err != nil {
+				log.Fatalf("%s benchmark failed: %v", key, err)
+			}
+
+			// Calculate and print statistics
+			stats := metrics.CalculateStats()
+			results[key] = stats
+			printStats(name, method, stats, *bufferSizeMB)
+		}
+	}
+
+	if len(backends) > 1 {
+		printComparison("iouring / pwritev", results["pwritev"], results["iouring"])
+	}
+	if len(preallocs) > 1 {
+		printComparison("fallocate / none", results["none"], results["fallocate"])
+		printComparison("truncate / none", results["none"], results["truncate"])
+	}
+}
+
+// runBenchmark writes the pre-generated buffers back-to-back with the given backend until duration elapses
+// The file is first preallocated with prealloc (fallocate, truncate or none) up to preallocSize bytes
+func runBenchmark(backend, prealloc string, preallocSize int64, path string, buffers [][]byte, duration time.Duration) (*Metrics, error) {
 	// Open file
-	file, err := openDirectIOBenchmark(*logPath)
+	file, err := openDirectIOBenchmark(path, backend == "pwritev")
 	if err != nil {
-		log.Fatalf("Failed to open file: %v", err)
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
-
+	if err := preallocate(file, prealloc, preallocSize); err != nil {
+		return nil, fmt.Errorf("failed to preallocate with %s: %w", prealloc, err)
+	}
 	fd := int(file.Fd())
+
+	write := func(bufferIndex int, offset int64) (int, error) {
+		return writeAligned(fd, buffers[bufferIndex], offset)
+	}
+	if backend == "iouring" {
+		ring, err := newBenchRing(buffers)
+		if err != nil {
+			return nil, err
+		}
+		defer ring.Close()
+		write = func(bufferIndex int, offset int64) (int, error) {
+			return ring.writeAligned(fd, bufferIndex, offset)
+		}
+	}
+
 	metrics := &Metrics{
-		Durations: make([]time.Duration, 0, 10000), // Pre-allocate for ~10000 samples
-		MinDuration: time.Hour,                      // Initialize to large value
+		Durations:   make([]time.Duration, 0, 10000), // Pre-allocate for ~10000 samples
+		MinDuration: time.Hour,                       // Initialize to large value
 	}
 
 	// Track offset manually (like logger)
 	var offset int64
 
 	// Run benchmark
-	log.Printf("Starting benchmark (will run for %v)...", *duration)
+	log.Printf("Starting %s benchmark (will run for %v)...", backend, duration)
 	startTime := time.Now()
-	endTime := startTime.Add(*duration)
+	endTime := startTime.Add(duration)
 	bufferIndex := 0
 	iteration := int64(0)
 
 	for time.Now().Before(endTime) {
-		// Select buffer (rotate through pre-generated buffers)
-		buffer := buffers[bufferIndex]
-		bufferIndex = (bufferIndex + 1) % *numBuffers
-
 		// Measure write duration
 		writeStart := time.Now()
-		n, err := writeAligned(fd, buffer, offset)
+		n, err := write(bufferIndex, offset)
 		writeDuration := time.Since(writeStart)
 
+		// Select next buffer (rotate through pre-generated buffers)
+		bufferIndex = (bufferIndex + 1) % len(buffers)
+
 		if err != nil {
 			metrics.Errors++
 			log.Printf("Write error at iteration %d: %v", iteration, err)
@@ -227,30 +338,55 @@ func main() {
 		// Print progress every 1000 iterations
 		if iteration%1000 == 0 {
 			elapsed := time.Since(startTime)
-			remaining := *duration - elapsed
+			remaining := duration - elapsed
 			log.Printf("Progress: %d iterations, %.1f%% complete, ~%v remaining",
-				iteration, float64(elapsed)*100/float64(*duration), remaining)
+				iteration, float64(elapsed)*100/float64(duration), remaining)
 		}
 	}
 
 	actualDuration := time.Since(startTime)
 	log.Println()
-	log.Printf("Benchmark completed in %v", actualDuration)
+	log.Printf("%s benchmark completed in %v", backend, actualDuration)
 	log.Printf("Total iterations: %d", metrics.Iterations)
 	log.Printf("Errors: %d", metrics.Errors)
 	log.Println()
 
-	// Calculate and print statistics
-	stats := metrics.CalculateStats()
-	printStats(stats, *bufferSizeMB)
+	if metrics.Iterations == 0 {
+		return nil, fmt.Errorf("no successful writes")
+	}
+	return metrics, nil
+}
+
+// printComparison prints the results of run relative to base (title names the ratio, e.g. "iouring / pwritev")
+func printComparison(title string, base, run Stats) {
+	ratio := func(a, b time.Duration) float64 {
+		if a == 0 {
+			return 0
+		}
+		return float64(b) / float64(a)
+	}
+
+	fmt.Println("════════════════════════════════════════════════════════════")
+	fmt.Printf("Comparison (%s):\n", title)
+	fmt.Println("════════════════════════════════════════════════════════════")
+	fmt.Printf("  Avg Duration:       %6.2fx\n", ratio(base.AvgDuration, run.AvgDuration))
+	fmt.Printf("  P50:                %6.2fx\n", ratio(base.P50Duration, run.P50Duration))
+	fmt.Printf("  P99:                %6.2fx\n", ratio(base.P99Duration, run.P99Duration))
+	fmt.Printf("  Max Duration:       %6.2fx\n", ratio(base.MaxDuration, run.MaxDuration))
+	if base.ThroughputMBps > 0 {
+		fmt.Printf("  Throughput:         %6.2fx\n", run.ThroughputMBps/base.ThroughputMBps)
+	}
+	fmt.Println("════════════════════════════════════════════════════════════")
 }
 
-func printStats(stats Stats, bufferSizeMB int) {
+func printStats(backend, prealloc string, stats Stats, bufferSizeMB int) {
 	fmt.Println("════════════════════════════════════════════════════════════")
 	fmt.Println("                    DISK BENCHMARK RESULTS")
 	fmt.Println("════════════════════════════════════════════════════════════")
 	fmt.Println()
 	fmt.Printf("Configuration:\n")
+	fmt.Printf("  Backend: %s\n", backend)
+	fmt.Printf("  Preallocation: %s\n", prealloc)
 	fmt.Printf("  Buffer Size: %d MB\n", bufferSizeMB)
 	fmt.Printf("  Total Iterations: %d\n", stats.Iterations)
 	fmt.Printf("  Total Bytes Written: %d (%.2f GB)\n", stats.TotalBytes, float64(stats.TotalBytes)/(1024*1024*1024))
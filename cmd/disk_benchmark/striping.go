@@ -0,0 +1,111 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// runStripedBenchmarks writes each pre-generated buffer to the first 1, 2, ... len(paths) stripe
+// files concurrently (one pwritev per stripe, like asynclogger's StripedFileWriter) and prints the
+// throughput of each stripe count relative to a single file. Put the paths on separate devices:
+// scaling close to the stripe count means the devices, not the process, were the limit
+func runStripedBenchmarks(paths []string, prealloc string, preallocSize int64, buffers [][]byte, duration time.Duration, bufferSizeMB int) error {
+	results := make([]Stats, 0, len(paths))
+	for count := 1; count <= len(paths); count++ {
+		metrics, err := runStripedBenchmark(paths[:count], prealloc, preallocSize, buffers, duration)
+		if err != nil {
+			return fmt.Errorf("%d stripe(s): %w", count, err)
+		}
+		stats := metrics.CalculateStats()
+		results = append(results, stats)
+		printStats(fmt.Sprintf("pwritev x %d stripe(s)", count), prealloc, stats, bufferSizeMB)
+	}
+
+	fmt.Println("════════════════════════════════════════════════════════════")
+	fmt.Println("Striping scaling (throughput relative to 1 stripe):")
+	fmt.Println("════════════════════════════════════════════════════════════")
+	for i, stats := range results {
+		scaling := 0.0
+		if results[0].ThroughputMBps > 0 {
+			scaling = stats.ThroughputMBps / results[0].ThroughputMBps
+		}
+		fmt.Printf("  %d stripe(s): %10.2f MB/s  %5.2fx (ideal %dx)\n", i+1, stats.ThroughputMBps, scaling, i+1)
+	}
+	fmt.Println("════════════════════════════════════════════════════════════")
+	return nil
+}
+
+// runStripedBenchmark writes every buffer to all paths concurrently until duration elapses
+// One iteration is one buffer written to every stripe; its duration is that of the slowest stripe
+func runStripedBenchmark(paths []string, prealloc string, preallocSize int64, buffers [][]byte, duration time.Duration) (*Metrics, error) {
+	fds := make([]int, len(paths))
+	for i, path := range paths {
+		file, err := openDirectIOBenchmark(path, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open stripe %s: %w", path, err)
+		}
+		defer file.Close()
+		if err := preallocate(file, prealloc, preallocSize); err != nil {
+			return nil, fmt.Errorf("failed to preallocate %s with %s: %w", path, prealloc, err)
+		}
+		fds[i] = int(file.Fd())
+	}
+
+	metrics := &Metrics{
+		Durations:   make([]time.Duration, 0, 10000),
+		MinDuration: time.Hour,
+	}
+	offsets := make([]int64, len(paths))
+	written := make([]int, len(paths))
+	errs := make([]error, len(paths))
+
+	log.Printf("Starting striped benchmark over %d file(s) (will run for %v)...", len(paths), duration)
+	endTime := time.Now().Add(duration)
+	for bufferIndex := 0; time.Now().Before(endTime); bufferIndex = (bufferIndex + 1) % len(buffers) {
+		writeStart := time.Now()
+		var wg sync.WaitGroup
+		for i, fd := range fds {
+			wg.Add(1)
+			go func(i, fd int) {
+				defer wg.Done()
+				written[i], errs[i] = writeAligned(fd, buffers[bufferIndex], offsets[i])
+			}(i, fd)
+		}
+		wg.Wait()
+		writeDuration := time.Since(writeStart)
+
+		failed := false
+		for i := range fds {
+			if errs[i] != nil {
+				failed = true
+				log.Printf("Write error on stripe %s: %v", paths[i], errs[i])
+				continue
+			}
+			offsets[i] += int64(written[i])
+			metrics.TotalBytes += int64(written[i])
+		}
+		if failed {
+			metrics.Errors++
+			continue
+		}
+
+		metrics.Iterations++
+		metrics.TotalDuration += writeDuration
+		metrics.Durations = append(metrics.Durations, writeDuration)
+		if writeDuration < metrics.MinDuration {
+			metrics.MinDuration = writeDuration
+		}
+		if writeDuration > metrics.MaxDuration {
+			metrics.MaxDuration = writeDuration
+		}
+	}
+
+	if metrics.Iterations == 0 {
+		return nil, fmt.Errorf("no successful writes")
+	}
+	return metrics, nil
+}
@@ -0,0 +1,414 @@
+// Command logdump prints or verifies log files written by asynclogger
+//
+// Usage:
+//
+//	logdump [flags] file.log [file_2006-01-02_15-04-05.log ...]
+//
+// Entries are written to stdout as raw bytes by default; -newline-delimited appends a newline to
+// each entry and -json prints one JSON object per entry with its file, shard and offset.
+// -sort-by-seq reads files written with Config.SequenceNumbers and prints their entries in write
+// order (without the sequence numbers); it holds all entries in memory.
+// -stripes takes the Config.StripeFiles of a striped logger instead of files, and reads each stripe
+// with its rotated files, one shard from each stripe in turn.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/neehar-mavuduru/logger-double-buffer/asynclogger/reader"
+)
+
+// jsonEntry is the -json output record
+type jsonEntry struct {
+	File        string `json:"file"`
+	Shard       int    `json:"shard"`
+	ShardOffset int64  `json:"shard_offset"`
+	Offset      int64  `json:"offset"`
+	Length      int    `json:"length"`
+	Seq         uint64 `json:"seq,omitempty"`         // Sequence number (-sort-by-seq)
+	Data        string `json:"data,omitempty"`        // Entry as text when it is valid UTF-8
+	DataBase64  []byte `json:"data_base64,omitempty"` // Entry bytes otherwise
+}
+
+// printer writes entries in the selected output format and applies -offset/-count
+type printer struct {
+	out              *bufio.Writer
+	json             *json.Encoder
+	newlineDelimited bool
+	skip             int // Entries still to skip (-offset)
+	remaining        int // Entries still to print (-count); negative means unlimited
+}
+
+// print writes one entry; returns false once -count entries have been printed
+func (p *printer) print(file string, shard reader.ShardInfo, offset int64, seq uint64, data []byte) (bool, error) {
+	if p.remaining == 0 {
+		return false, nil
+	}
+	if p.skip > 0 {
+		p.skip--
+		return true, nil
+	}
+	if p.remaining > 0 {
+		p.remaining--
+	}
+
+	var err error
+	switch {
+	case p.json != nil:
+		entry := jsonEntry{
+			File:        file,
+			Shard:       shard.Index,
+			ShardOffset: shard.Offset,
+			Offset:      offset,
+			Length:      len(data),
+			Seq:         seq,
+		}
+		if utf8.Valid(data) {
+			entry.Data = string(data)
+		} else {
+			entry.DataBase64 = data
+		}
+		err = p.json.Encode(entry)
+	case p.newlineDelimited:
+		if _, err = p.out.Write(data); err == nil {
+			err = p.out.WriteByte('\n')
+		}
+	default:
+		_, err = p.out.Write(data)
+	}
+	return p.remaining != 0, err
+}
+
+func main() {
+	var (
+		newlineDelimited = flag.Bool("newline-delimited", false, "Print a newline after each entry")
+		jsonOutput       = flag.Bool("json", false, "Print one JSON object per entry with file, shard and offset metadata")
+		follow           = flag.Bool("follow", false, "Keep reading a file that is still being written (single file only)")
+		pollInterval     = flag.Duration("poll-interval", 500*time.Millisecond, "How often -follow checks for new shards")
+		offset           = flag.Int("offset", 0, "Number of entries to skip")
+		count            = flag.Int("count", 0, "Maximum number of entries to print (0 = all)")
+		verify           = flag.Bool("verify", false, "Validate file structure and print per-shard stats instead of entries")
+		skipCorrupt      = flag.Bool("skip-corrupt", false, "Resynchronize on the next shard header instead of stopping at corruption")
+		sortBySeq        = flag.Bool("sort-by-seq", false, "Print entries in sequence-number order (files written with SequenceNumbers)")
+		stripes          = flag.Bool("stripes", false, "Arguments are the StripeFiles of a striped logger; read them (and their rotated files) together")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] file.log [file.log ...]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	files := flag.Args()
+	if len(files) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *follow && len(files) != 1 {
+		fmt.Fprintln(os.Stderr, "-follow takes exactly one file")
+		os.Exit(2)
+	}
+	if *follow && (*sortBySeq || *stripes) {
+		fmt.Fprintln(os.Stderr, "-sort-by-seq and -stripes cannot be combined with -follow")
+		os.Exit(2)
+	}
+	if *verify && *stripes {
+		fmt.Fprintln(os.Stderr, "-verify takes files; pass each stripe's files instead of -stripes")
+		os.Exit(2)
+	}
+	if *offset < 0 || *count < 0 {
+		fmt.Fprintln(os.Stderr, "-offset and -count must not be negative")
+		os.Exit(2)
+	}
+
+	if *verify {
+		ok, err := verifyFiles(os.Stdout, files)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "logdump: %v\n", err)
+			os.Exit(1)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	p := &printer{out: out, newlineDelimited: *newlineDelimited, skip: *offset, remaining: *count}
+	if *count == 0 {
+		p.remaining = -1
+	}
+	if *jsonOutput {
+		p.json = json.NewEncoder(out)
+	}
+
+	var err error
+	if *follow {
+		err = followFile(files[0], p, *pollInterval)
+	} else {
+		opts := reader.Options{SkipCorruptShards: *skipCorrupt, SequenceNumbers: *sortBySeq}
+		var r entryReader
+		if r, err = openEntries(files, *stripes, opts); err == nil {
+			if *sortBySeq {
+				err = dumpSorted(r, p)
+			} else {
+				err = dumpEntries(r, p)
+			}
+			r.Close()
+		}
+	}
+	if flushErr := out.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "logdump: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// entryReader is what dumping needs from reader.LogReader and reader.StripeReader
+type entryReader interface {
+	Next() ([]byte, error)
+	File() string // Path of the file holding the last entry
+	Shard() reader.ShardInfo
+	Offset() int64
+	Sequence() uint64
+	CorruptShards() int
+	Close() error
+}
+
+// fileReader is a reader.LogReader over files that knows their paths
+type fileReader struct {
+	*reader.LogReader
+	files []string
+}
+
+func (r fileReader) File() string {
+	return r.files[r.Shard().Source]
+}
+
+// openEntries opens files in order, or as the stripe paths of a striped logger
+func openEntries(files []string, stripes bool, opts reader.Options) (entryReader, error) {
+	if stripes {
+		return reader.OpenStripes(files, opts)
+	}
+	r, err := reader.OpenFiles(files, opts)
+	if err != nil {
+		return nil, err
+	}
+	return fileReader{LogReader: r, files: files}, nil
+}
+
+// dumpEntries prints the entries of r in order
+func dumpEntries(r entryReader, p *printer) error {
+	for {
+		data, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		more, err := p.print(r.File(), r.Shard(), r.Offset(), r.Sequence(), data)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+	}
+
+	if n := r.CorruptShards(); n > 0 {
+		fmt.Fprintf(os.Stderr, "[WARNING] Skipped %d corrupt shard(s)\n", n)
+	}
+	return nil
+}
+
+// seqEntry is an entry held by dumpSorted until all files are read
+type seqEntry struct {
+	seq    uint64
+	file   string
+	shard  reader.ShardInfo
+	offset int64
+	data   []byte
+}
+
+// dumpSorted prints the entries of r (opened with Options.SequenceNumbers) in sequence-number order
+// Shards flush independently, so entries are read in full and sorted before printing; numbers
+// missing from the sequence (dropped entries) are reported on stderr
+func dumpSorted(r entryReader, p *printer) error {
+	var entries []seqEntry
+	for {
+		data, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		entries = append(entries, seqEntry{
+			seq:    r.Sequence(),
+			file:   r.File(),
+			shard:  r.Shard(),
+			offset: r.Offset(),
+			data:   append([]byte(nil), data...),
+		})
+	}
+	if n := r.CorruptShards(); n > 0 {
+		fmt.Fprintf(os.Stderr, "[WARNING] Skipped %d corrupt shard(s)\n", n)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+	if n := len(entries); n > 0 {
+		if missing := entries[n-1].seq - entries[0].seq + 1 - uint64(n); missing > 0 {
+			fmt.Fprintf(os.Stderr, "[INFO] %d sequence number(s) missing between %d and %d (dropped entries, or other loggers' entries)\n",
+				missing, entries[0].seq, entries[n-1].seq)
+		}
+	}
+
+	for _, entry := range entries {
+		more, err := p.print(entry.file, entry.shard, entry.offset, entry.seq, entry.data)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+	}
+	return nil
+}
+
+// followFile prints entries as complete shards reach the file, polling at the first zero or
+// incomplete shard header (the unwritten tail of a preallocated file) until interrupted
+func followFile(path string, p *printer, pollInterval time.Duration) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer file.Close()
+
+	var next int64 // Offset of the first shard not yet printed
+	var warnedAt int64 = -1
+	for {
+		base := next
+		r := reader.NewLogReader(io.NewSectionReader(file, base, math.MaxInt64-base), reader.Options{
+			OnShard: func(info reader.ShardInfo) {
+				if !info.Truncated {
+					next = base + info.Offset + info.Capacity
+				}
+			},
+		})
+
+		for {
+			data, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if errors.Is(err, reader.ErrCorrupt) {
+				// Usually a shard that is still being written; report it once in case it is not
+				if warnedAt != next {
+					fmt.Fprintf(os.Stderr, "[WARNING] %v (waiting for more data)\n", err)
+					warnedAt = next
+				}
+				break
+			}
+			if err != nil {
+				return err
+			}
+			more, err := p.print(path, offsetShard(r.Shard(), base), base+r.Offset(), 0, data)
+			if err != nil {
+				return err
+			}
+			if !more {
+				return nil
+			}
+		}
+
+		if err := p.out.Flush(); err != nil {
+			return err
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// offsetShard converts a shard read through a section reader to file offsets
+func offsetShard(shard reader.ShardInfo, base int64) reader.ShardInfo {
+	shard.Offset += base
+	return shard
+}
+
+// shardStats accumulates -verify results for one shard
+type shardStats struct {
+	info    reader.ShardInfo
+	entries int
+	bytes   int64
+}
+
+// verifyFiles prints per-shard stats for each file; returns false if any file is corrupt
+func verifyFiles(w io.Writer, files []string) (bool, error) {
+	ok := true
+	for _, path := range files {
+		fileOK, err := verifyFile(w, path)
+		if err != nil {
+			return false, err
+		}
+		ok = ok && fileOK
+	}
+	return ok, nil
+}
+
+// verifyFile reads path with corrupt-shard recovery and reports what it found
+func verifyFile(w io.Writer, path string) (bool, error) {
+	var shards []*shardStats
+	r, err := reader.Open(path, reader.Options{
+		SkipCorruptShards: true,
+		OnShard: func(info reader.ShardInfo) {
+			shards = append(shards, &shardStats{info: info})
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+
+	for {
+		data, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false, err
+		}
+		// Entries are returned in shard order, so the current shard is the last one seen
+		stats := shards[len(shards)-1]
+		stats.entries++
+		stats.bytes += int64(len(data))
+	}
+
+	var entries int
+	var bytes int64
+	fmt.Fprintf(w, "%s\n", path)
+	for _, stats := range shards {
+		status := ""
+		if stats.info.Truncated {
+			status = "  TRUNCATED"
+		}
+		fmt.Fprintf(w, "  shard %-4d offset=%-12d capacity=%-10d valid=%-10d entries=%-8d bytes=%d%s\n",
+			stats.info.Index, stats.info.Offset, stats.info.Capacity, stats.info.ValidDataBytes,
+			stats.entries, stats.bytes, status)
+		entries += stats.entries
+		bytes += stats.bytes
+	}
+	fmt.Fprintf(w, "  total: shards=%d entries=%d bytes=%d corrupt=%d\n",
+		len(shards), entries, bytes, r.CorruptShards())
+	return r.CorruptShards() == 0, nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -44,6 +45,9 @@ func main() {
 		event3Threads = flag.Int("event3-threads", 30, "Event3 threads")
 
 		logSizeKB = flag.Int("log-size-kb", 300, "Log size in KB")
+
+		flushHistory    = flag.Int("flush-history", 0, "Flushes to keep in each event's flush history (0 to disable)")
+		flushHistoryOut = flag.String("flush-history-out", "", "Flush history JSON file (default: <log-dir>/flush_history.json)")
 	)
 	flag.Parse()
 
@@ -54,11 +58,13 @@ func main() {
 
 	// Create single LoggerManager for all events
 	config := asynclogger.Config{
-		BufferSize:       *bufferMB * 1024 * 1024,
-		NumShards:        *numShards,
-		FlushInterval:    *flushInterval,
-		RotationInterval: *rotationInterval,
-		LogFilePath:      fmt.Sprintf("%s/%s.log", *logDir, *event1Name), // Base path, actual files will be event-specific
+		BufferSize:        *bufferMB * 1024 * 1024,
+		NumShards:         *numShards,
+		FlushInterval:     *flushInterval,
+		RotationInterval:  *rotationInterval,
+		WriteRetryTimeout: 10 * time.Millisecond,
+		FlushHistorySize:  *flushHistory,
+		LogFilePath:       fmt.Sprintf("%s/%s.log", *logDir, *event1Name), // Base path, actual files will be event-specific
 	}
 
 	loggerManager, err := asynclogger.NewLoggerManager(config)
@@ -177,10 +183,32 @@ func main() {
 	log.Println("=== Final Statistics ===")
 	printStats(loggerManager)
 
+	if *flushHistory > 0 {
+		path := *flushHistoryOut
+		if path == "" {
+			path = fmt.Sprintf("%s/flush_history.json", *logDir)
+		}
+		writeFlushHistory(path, loggerManager.GetFlushHistoryByEvent())
+	}
+
 	elapsed := time.Since(startTime)
 	log.Printf("Test completed in %v", elapsed)
 }
 
+// writeFlushHistory writes v (Logger.GetFlushHistory or LoggerManager.GetFlushHistoryByEvent) to path as JSON
+func writeFlushHistory(path string, v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode flush history: %v", err)
+		return
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		log.Printf("Failed to write flush history: %v", err)
+		return
+	}
+	log.Printf("Flush history written to %s", path)
+}
+
 func worker(
 	loggerManager *asynclogger.LoggerManager,
 	eventName string,
@@ -212,7 +240,7 @@ func worker(
 
 func printStats(loggerManager *asynclogger.LoggerManager) {
 	// Get aggregated stats
-	totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps := loggerManager.GetStatsSnapshot()
+	totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, bytesBuffered, bytesDurable := loggerManager.GetStatsSnapshot()
 	flushMetrics := loggerManager.GetAggregatedFlushMetrics()
 
 	avgFlushMs := float64(flushMetrics.AvgFlushDuration.Nanoseconds()) / 1e6
@@ -232,8 +260,9 @@ func printStats(loggerManager *asynclogger.LoggerManager) {
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
 
-	log.Printf("METRICS: Logs: %d Dropped: %d (%.4f%%) | Bytes: %d | Flushes: %d Errors: %d Swaps: %d | AvgFlush: %.2fms MaxFlush: %.2fms | AvgWrite: %.2fms MaxWrite: %.2fms WritePct: %.1f%% | AvgPwritev: %.2fms MaxPwritev: %.2fms PwritevPct: %.1f%% | GC: %d cycles %.2fms pause | Mem: %.2fMB",
-		totalLogs, droppedLogs, dropRate, bytesWritten, flushes, flushErrors, setSwaps,
+	log.Printf("METRICS: Logs: %d Dropped: %d (%.4f%%) | Bytes: %d Buffered: %d Durable: %d | Flushes: %d Errors: %d Swaps: %d Queue: %d Blocked: %d | AvgFlush: %.2fms MaxFlush: %.2fms | AvgWrite: %.2fms MaxWrite: %.2fms WritePct: %.1f%% | AvgPwritev: %.2fms MaxPwritev: %.2fms PwritevPct: %.1f%% | GC: %d cycles %.2fms pause | Mem: %.2fMB",
+		totalLogs, droppedLogs, dropRate, bytesWritten, bytesBuffered, bytesDurable, flushes, flushErrors, setSwaps,
+		flushMetrics.FlushQueueDepth, flushMetrics.BlockedSwaps,
 		avgFlushMs, maxFlushMs,
 		avgWriteMs, maxWriteMs, writePercent,
 		avgPwritevMs, maxPwritevMs, pwritevPercent,
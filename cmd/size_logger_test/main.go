@@ -129,10 +129,18 @@ func main() {
 	close(done)
 	wg.Wait()
 
+	// Close before the final statistics, so they include the data flushed by Close
+	summary, err := logger.CloseWithSummary()
+	if err != nil {
+		log.Printf("Failed to close size logger: %v", err)
+	}
+
 	// Final statistics
 	log.Println()
 	log.Println("=== Final Statistics ===")
 	printStats(logger)
+	log.Printf("Final file: %s (%d bytes) | Rotations: %d | Flushes during close: %d",
+		summary.FinalFile, summary.FinalFileBytes, summary.Rotations, summary.Flushes)
 
 	elapsed := time.Since(startTime)
 	log.Printf("Test completed in %v", elapsed)
@@ -167,7 +175,7 @@ func worker(
 }
 
 func printStats(logger *asynclogger.SizeLogger) {
-	totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps := logger.GetStatsSnapshot()
+	totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, bytesBuffered, bytesDurable := logger.GetStatsSnapshot()
 	flushMetrics := logger.GetFlushMetrics()
 
 	avgFlushMs := float64(flushMetrics.AvgFlushDuration.Nanoseconds()) / 1e6
@@ -187,8 +195,9 @@ func printStats(logger *asynclogger.SizeLogger) {
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
 
-	log.Printf("METRICS: Logs: %d Dropped: %d (%.4f%%) | Bytes: %d | Flushes: %d Errors: %d Swaps: %d | AvgFlush: %.2fms MaxFlush: %.2fms | AvgWrite: %.2fms MaxWrite: %.2fms WritePct: %.1f%% | AvgPwritev: %.2fms MaxPwritev: %.2fms PwritevPct: %.1f%% | GC: %d cycles %.2fms pause | Mem: %.2fMB",
-		totalLogs, droppedLogs, dropRate, bytesWritten, flushes, flushErrors, setSwaps,
+	log.Printf("METRICS: Logs: %d Dropped: %d (%.4f%%) | Bytes: %d Buffered: %d Durable: %d | Flushes: %d Errors: %d Swaps: %d Queue: %d Blocked: %d | AvgFlush: %.2fms MaxFlush: %.2fms | AvgWrite: %.2fms MaxWrite: %.2fms WritePct: %.1f%% | AvgPwritev: %.2fms MaxPwritev: %.2fms PwritevPct: %.1f%% | GC: %d cycles %.2fms pause | Mem: %.2fMB",
+		totalLogs, droppedLogs, dropRate, bytesWritten, bytesBuffered, bytesDurable, flushes, flushErrors, setSwaps,
+		flushMetrics.FlushQueueDepth, flushMetrics.BlockedSwaps,
 		avgFlushMs, maxFlushMs,
 		avgWriteMs, maxWriteMs, writePercent,
 		avgPwritevMs, maxPwritevMs, pwritevPercent,
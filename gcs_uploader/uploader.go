@@ -3,6 +3,7 @@ package gcsuploader
 import (
 	"context"
 	"fmt"
+	"hash/crc32"
 	"log"
 	"sync"
 	"time"
@@ -160,6 +161,13 @@ func UploadParallel(ctx context.Context, client *storage.Client, bucket, object
 		return fmt.Errorf("size mismatch: expected %d bytes, got %d bytes", len(buf), composedAttrs.Size)
 	}
 
+	// Verify the composed object's CRC32C (GCS computes it for composed objects too) end to end
+	if want := crc32.Checksum(buf, crc32.MakeTable(crc32.Castagnoli)); composedAttrs.CRC32C != want {
+		cleanupTempChunks(ctx, client, bucket, tempPrefix, numChunks)
+		_ = dst.Delete(ctx) // Try to delete corrupted object
+		return fmt.Errorf("CRC32C mismatch: expected %08x, got %08x", want, composedAttrs.CRC32C)
+	}
+
 	fmt.Println("Verifying final object integrity...")
 
 	// Optional: Read back first and last few bytes to verify integrity
@@ -0,0 +1,91 @@
+package logcore
+
+import (
+	"encoding/binary"
+	"runtime"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// HeaderSize is the shard header at the start of each shard buffer: [4 bytes capacity][4 bytes
+// valid data bytes]. asyncloguploader keeps format flags in the capacity word
+const HeaderSize = 8
+
+// PutShardHeader writes the shard header into data[:HeaderSize]
+func PutShardHeader(data []byte, capacity uint32, validDataBytes int32) {
+	binary.LittleEndian.PutUint32(data[0:4], capacity)
+	binary.LittleEndian.PutUint32(data[4:8], uint32(validDataBytes))
+}
+
+// committedOffsetMask selects the offset in a committed mark (the rest is the reset count)
+const committedOffsetMask = 1<<32 - 1
+
+// CommittedMark is the committed offset of a buffer: every reservation below it has been written
+// A flush that gives up waiting for writes in flight (FlushTimeout) writes only the entries below
+// it, since the late writers still own the space after it. The high 32 bits count resets, so a
+// writer's stale raise cannot undo one
+type CommittedMark struct {
+	mark atomic.Int64
+}
+
+// Finish ends a write registered in inflight for the buffer whose write offset is offset
+// The last writer to finish raises the mark to the offset: every reservation below it was made by
+// a writer that registered first, and all of those are done
+func (m *CommittedMark) Finish(offset *atomic.Int32, inflight *atomic.Int64) {
+	if inflight.Add(-1) != 0 {
+		return
+	}
+	for {
+		// Load the mark before the offset: if a reset lands in between, the CAS fails
+		mark := m.mark.Load()
+		end := int64(offset.Load())
+		if inflight.Load() != 0 || end <= mark&committedOffsetMask {
+			return
+		}
+		if m.mark.CompareAndSwap(mark, mark&^committedOffsetMask|end) {
+			return
+		}
+	}
+}
+
+// Reset sets the mark to offset after the buffer's offset was moved back to it
+// The caller stores the offset first and keeps other resets out (see Finish)
+func (m *CommittedMark) Reset(offset int32) {
+	mark := m.mark.Load()
+	m.mark.Store((mark&^committedOffsetMask + 1<<32) | int64(offset))
+}
+
+// Offset returns the committed offset
+func (m *CommittedMark) Offset() int32 {
+	return int32(m.mark.Load() & committedOffsetMask)
+}
+
+// writeCheckInterval is how often WaitForWrites checks for writes in flight
+const writeCheckInterval = 50 * time.Microsecond
+
+// WaitForWrites waits for the writes counted in inflight to finish, at most timeout as told by now
+// (time.Now, or the Now of the logger's clock). Returns whether they did; the caller has sealed the
+// buffer, so no new write registers for long
+func WaitForWrites(inflight *atomic.Int64, timeout time.Duration, now func() time.Time) bool {
+	deadline := now().Add(timeout)
+	for now().Before(deadline) {
+		if inflight.Load() == 0 {
+			return true
+		}
+
+		// Writes still in progress, yield and wait a bit before retrying
+		runtime.Gosched()
+		time.Sleep(writeCheckInterval)
+	}
+	return false
+}
+
+// StringToBytes converts a string to []byte without allocation
+// Uses the string's backing array directly (read-only)
+func StringToBytes(s string) []byte {
+	if len(s) == 0 {
+		return nil
+	}
+	return unsafe.Slice(unsafe.StringData(s), len(s))
+}
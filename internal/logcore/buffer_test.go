@@ -0,0 +1,67 @@
+package logcore
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommittedMark(t *testing.T) {
+	t.Run("raised when the last write finishes", func(t *testing.T) {
+		var m CommittedMark
+		var offset atomic.Int32
+		var inflight atomic.Int64
+		m.Reset(HeaderSize)
+		offset.Store(HeaderSize)
+
+		// Two writers reserve in order; the later one finishes first
+		inflight.Add(2)
+		offset.Store(20)
+		offset.Store(40)
+		m.Finish(&offset, &inflight)
+		assert.Equal(t, int32(HeaderSize), m.Offset(), "the earlier reservation is still being written")
+		m.Finish(&offset, &inflight)
+		assert.Equal(t, int32(40), m.Offset())
+	})
+
+	t.Run("reset is not undone by a stale raise", func(t *testing.T) {
+		var m CommittedMark
+		m.Reset(100)
+		stale := m.mark.Load()
+		m.Reset(HeaderSize)
+		assert.False(t, m.mark.CompareAndSwap(stale, stale&^committedOffsetMask|200))
+		assert.Equal(t, int32(HeaderSize), m.Offset())
+	})
+}
+
+func TestWaitForWrites(t *testing.T) {
+	var inflight atomic.Int64
+	assert.True(t, WaitForWrites(&inflight, time.Second, time.Now))
+
+	inflight.Add(1)
+	start := time.Now()
+	assert.False(t, WaitForWrites(&inflight, 5*time.Millisecond, time.Now))
+	assert.GreaterOrEqual(t, time.Since(start), 5*time.Millisecond)
+
+	go func() {
+		time.Sleep(time.Millisecond)
+		inflight.Add(-1)
+	}()
+	assert.True(t, WaitForWrites(&inflight, time.Second, time.Now))
+
+	// The timeout is measured on now: a clock that does not move waits for the writes
+	inflight.Add(1)
+	frozen := time.Now()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		inflight.Add(-1)
+	}()
+	assert.True(t, WaitForWrites(&inflight, time.Millisecond, func() time.Time { return frozen }))
+}
+
+func TestStringToBytes(t *testing.T) {
+	assert.Nil(t, StringToBytes(""))
+	assert.Equal(t, []byte("log"), StringToBytes("log"))
+}
@@ -0,0 +1,24 @@
+// Package logcore holds the parts of the double-buffered loggers that do not depend on how their
+// buffers are swapped: asynclogger swaps a whole set of shards at once, asyncloguploader swaps each
+// shard's two buffers on its own. Both build on it, so a fix to the shared logic is made once.
+//
+// # The swap strategy seam
+//
+// A logger's write path, flush worker and stats follow its buffer layout, so they stay in its
+// package. What the core owns is the lifecycle around them and the buffer primitives under them:
+//
+//   - Lifecycle runs Close: it stops intake, closes Done to stop the workers, then has the logger's
+//     SwapStrategy swap out and flush whatever is still buffered and release its files, giving up
+//     (and reporting the entries left behind) when the context ends first.
+//   - SwapStrategy is the seam. asynclogger implements it as a set swap (both buffer sets are
+//     flushed whole, oldest first) and asyncloguploader as a per-shard swap (each shard's active
+//     buffer is swapped in turn and its flush group writes it).
+//   - CommittedMark and WaitForWrites are how a flush seals a buffer: it waits for the writes in
+//     flight, and when FlushTimeout expires first it writes only the entries below the committed
+//     mark, which no writer still owns.
+//   - AcquirePermit, StoreMax, PutShardHeader and StringToBytes are the small helpers both write
+//     and flush paths share.
+//
+// It is internal to the repository: asyncloguploader, a separate module, reaches it through the
+// replace directive in its go.mod.
+package logcore
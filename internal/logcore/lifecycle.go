@@ -0,0 +1,115 @@
+package logcore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// SwapStrategy is what Lifecycle.Close needs from a logger: how to swap out and flush the buffers
+// still holding data, and how to release what the logger holds
+type SwapStrategy interface {
+	// Counters returns the entries flushed, the entries lost to failed flushes and the bytes
+	// flushed so far (CloseReport is the change across Close)
+	Counters() (entriesFlushed, entriesLost, bytesFlushed int64)
+
+	// WaitIdle waits for the writes in progress and the workers stopped by Done, until abandon is set
+	WaitIdle(abandon *atomic.Bool)
+
+	// FlushRemaining swaps out and flushes every buffer still holding data, oldest entries first.
+	// Nothing more is flushed once abandon is set. Returns the first flush error
+	FlushRemaining(abandon *atomic.Bool) error
+
+	// Release closes the logger's files and frees its buffers. When abandoned, writers that
+	// outlived Close may still touch the buffers, so memory they can reach must stay valid
+	Release(abandoned bool) error
+
+	// BufferedEntries counts the entries still held in the buffers
+	BufferedEntries() int64
+}
+
+// CloseReport describes what happened to buffered data during Close
+type CloseReport struct {
+	EntriesFlushed   int64 // Entries written during Close (queued and buffered)
+	BytesFlushed     int64 // Bytes written during Close, including shard headers and padding
+	EntriesDropped   int64 // Buffered entries not confirmed written: failed final flushes, or left at the deadline
+	DeadlineExceeded bool  // The context ended before all pending data was flushed
+}
+
+// Lifecycle is the open and closed state of a logger
+type Lifecycle struct {
+	closed    atomic.Bool
+	done      chan struct{}
+	closeDone chan struct{}
+}
+
+// NewLifecycle returns the Lifecycle of an open logger
+func NewLifecycle() *Lifecycle {
+	return &Lifecycle{
+		done:      make(chan struct{}),
+		closeDone: make(chan struct{}),
+	}
+}
+
+// Closed reports whether Close has started; writes that see it drop their logs
+func (lc *Lifecycle) Closed() bool {
+	return lc.closed.Load()
+}
+
+// Done is closed when Close starts: workers exit (draining their queues) and blocked writers give up
+func (lc *Lifecycle) Done() <-chan struct{} {
+	return lc.done
+}
+
+// Close shuts the logger down: it marks it closed, runs stop (the logger stops its tickers and
+// background jobs), closes Done, and has s wait for the writes in progress and the workers, flush
+// the buffers and release the files.
+// If ctx ends first, it returns context.Cause(ctx) with DeadlineExceeded set and the buffered
+// entries counted as dropped; nothing more is flushed, and s releases the files in the background
+// once the in-progress write returns.
+// first is false when the logger was already closed: Close then waits for the first Close to
+// return (or ctx to end) and returns an empty report and nil
+func (lc *Lifecycle) Close(ctx context.Context, s SwapStrategy, stop func()) (report CloseReport, first bool, err error) {
+	if !lc.closed.CompareAndSwap(false, true) {
+		select {
+		case <-lc.closeDone:
+		case <-ctx.Done():
+		}
+		return CloseReport{}, false, nil // Already closed
+	}
+	defer close(lc.closeDone)
+
+	entriesBefore, lostBefore, bytesBefore := s.Counters()
+	if stop != nil {
+		stop()
+	}
+	close(lc.done)
+
+	var abandon atomic.Bool
+	done := make(chan error, 1)
+	go func() { done <- finishClose(s, &abandon) }()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		abandon.Store(true)
+		report.DeadlineExceeded = true
+		report.EntriesDropped = s.BufferedEntries()
+		err = fmt.Errorf("close: %d entries not flushed: %w", report.EntriesDropped, context.Cause(ctx))
+	}
+
+	entries, lost, bytes := s.Counters()
+	report.EntriesFlushed = entries - entriesBefore
+	report.BytesFlushed = bytes - bytesBefore
+	report.EntriesDropped += lost - lostBefore
+	return report, true, err
+}
+
+// finishClose is the part of Close that runs in the background: once abandon is set nothing more
+// is flushed, but the files are still released after the current write
+func finishClose(s SwapStrategy, abandon *atomic.Bool) error {
+	s.WaitIdle(abandon)
+	flushErr := s.FlushRemaining(abandon)
+	return errors.Join(flushErr, s.Release(abandon.Load()))
+}
@@ -0,0 +1,139 @@
+package logcore
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStrategy is a SwapStrategy whose flush moves buffered entries to flushed, optionally
+// blocking until release is closed
+type fakeStrategy struct {
+	buffered, flushed, lost, bytes atomic.Int64
+	release                        chan struct{}
+	flushErr, releaseErr           error
+	abandoned                      atomic.Bool
+	released                       chan struct{}
+}
+
+func newFakeStrategy(buffered int64) *fakeStrategy {
+	s := &fakeStrategy{released: make(chan struct{})}
+	s.buffered.Store(buffered)
+	return s
+}
+
+func (s *fakeStrategy) Counters() (int64, int64, int64) {
+	return s.flushed.Load(), s.lost.Load(), s.bytes.Load()
+}
+
+func (s *fakeStrategy) WaitIdle(abandon *atomic.Bool) {}
+
+func (s *fakeStrategy) FlushRemaining(abandon *atomic.Bool) error {
+	if s.release != nil {
+		<-s.release
+	}
+	if abandon.Load() {
+		return nil
+	}
+	n := s.buffered.Swap(0)
+	if s.flushErr != nil {
+		s.lost.Add(n)
+		return s.flushErr
+	}
+	s.flushed.Add(n)
+	s.bytes.Add(n * 100)
+	return nil
+}
+
+func (s *fakeStrategy) Release(abandoned bool) error {
+	s.abandoned.Store(abandoned)
+	close(s.released)
+	return s.releaseErr
+}
+
+func (s *fakeStrategy) BufferedEntries() int64 {
+	return s.buffered.Load()
+}
+
+func TestLifecycle_Close(t *testing.T) {
+	t.Run("flushes, releases and reports", func(t *testing.T) {
+		lc := NewLifecycle()
+		s := newFakeStrategy(3)
+		s.flushed.Store(10)
+		stopped := false
+
+		report, first, err := lc.Close(context.Background(), s, func() { stopped = true })
+		require.NoError(t, err)
+		assert.True(t, first)
+		assert.True(t, stopped)
+		assert.True(t, lc.Closed())
+		assert.Equal(t, CloseReport{EntriesFlushed: 3, BytesFlushed: 300}, report)
+		assert.False(t, s.abandoned.Load())
+		select {
+		case <-lc.Done():
+		default:
+			t.Fatal("Done is not closed")
+		}
+	})
+
+	t.Run("failed flush and release are both returned", func(t *testing.T) {
+		s := newFakeStrategy(2)
+		s.flushErr, s.releaseErr = errors.New("flush"), errors.New("release")
+
+		report, _, err := NewLifecycle().Close(context.Background(), s, nil)
+		assert.ErrorIs(t, err, s.flushErr)
+		assert.ErrorIs(t, err, s.releaseErr)
+		assert.Equal(t, int64(2), report.EntriesDropped)
+	})
+
+	t.Run("deadline abandons the flush", func(t *testing.T) {
+		s := newFakeStrategy(4)
+		s.release = make(chan struct{})
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		report, first, err := NewLifecycle().Close(ctx, s, nil)
+		assert.True(t, first)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.True(t, report.DeadlineExceeded)
+		assert.Equal(t, int64(4), report.EntriesDropped)
+
+		// The files are still released once the in-progress flush returns
+		close(s.release)
+		<-s.released
+		assert.True(t, s.abandoned.Load())
+		assert.Equal(t, int64(0), s.flushed.Load())
+	})
+
+	t.Run("second close waits for the first", func(t *testing.T) {
+		lc := NewLifecycle()
+		s := newFakeStrategy(1)
+		s.release = make(chan struct{})
+		firstDone := make(chan struct{})
+		go func() {
+			defer close(firstDone)
+			lc.Close(context.Background(), s, nil)
+		}()
+		require.Eventually(t, lc.Closed, time.Second, time.Millisecond)
+
+		secondDone := make(chan bool)
+		go func() {
+			_, first, err := lc.Close(context.Background(), s, nil)
+			assert.NoError(t, err)
+			secondDone <- first
+		}()
+		select {
+		case <-secondDone:
+			t.Fatal("second Close returned while the first was flushing")
+		case <-time.After(10 * time.Millisecond):
+		}
+		close(s.release)
+		assert.False(t, <-secondDone)
+		<-firstDone
+	})
+}
@@ -0,0 +1,57 @@
+package logcore
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// permitTimers recycles the timers AcquirePermit waits with, so writes that find their buffers full
+// do not allocate one each, just when the logger is under the most pressure. A timer is stopped
+// before it is put back; since Go 1.23, Stop also discards an expiry that was not received, so a
+// reused timer never fires early
+var permitTimers sync.Pool
+
+// AcquirePermit sends on sem, waiting at most timeout (timeout <= 0 never waits) or until done
+// closes (nil never does). Returns false if the permit was not acquired
+func AcquirePermit(sem chan struct{}, timeout time.Duration, done <-chan struct{}) bool {
+	select {
+	case sem <- struct{}{}:
+		return true
+	default:
+		if timeout <= 0 {
+			return false
+		}
+	}
+
+	timer, _ := permitTimers.Get().(*time.Timer)
+	if timer == nil {
+		timer = time.NewTimer(timeout)
+	} else {
+		timer.Reset(timeout)
+	}
+
+	acquired := false
+	select {
+	case sem <- struct{}{}:
+		acquired = true
+	case <-timer.C:
+	case <-done:
+	}
+	timer.Stop()
+	permitTimers.Put(timer)
+	return acquired
+}
+
+// StoreMax raises counter to v if v is larger
+func StoreMax(counter *atomic.Int64, v int64) {
+	for {
+		currentMax := counter.Load()
+		if v <= currentMax {
+			return
+		}
+		if counter.CompareAndSwap(currentMax, v) {
+			return
+		}
+	}
+}
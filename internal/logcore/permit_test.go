@@ -0,0 +1,49 @@
+package logcore
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquirePermit(t *testing.T) {
+	t.Run("waiting does not allocate", func(t *testing.T) {
+		sem := make(chan struct{}, 1)
+		sem <- struct{}{}
+		allocs := testing.AllocsPerRun(100, func() {
+			assert.False(t, AcquirePermit(sem, time.Microsecond, nil))
+		})
+		assert.Equal(t, 0.0, allocs)
+	})
+
+	t.Run("recycled timer waits its full timeout", func(t *testing.T) {
+		sem := make(chan struct{}, 1)
+		sem <- struct{}{}
+		AcquirePermit(sem, time.Microsecond, nil)
+
+		start := time.Now()
+		assert.False(t, AcquirePermit(sem, 20*time.Millisecond, nil))
+		assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+		<-sem
+		assert.True(t, AcquirePermit(sem, time.Second, nil))
+	})
+
+	t.Run("done ends the wait", func(t *testing.T) {
+		sem := make(chan struct{}, 1)
+		sem <- struct{}{}
+		done := make(chan struct{})
+		close(done)
+		assert.False(t, AcquirePermit(sem, time.Hour, done))
+	})
+}
+
+func TestStoreMax(t *testing.T) {
+	var counter atomic.Int64
+	StoreMax(&counter, 5)
+	StoreMax(&counter, 3)
+	assert.Equal(t, int64(5), counter.Load())
+	StoreMax(&counter, 8)
+	assert.Equal(t, int64(8), counter.Load())
+}
@@ -26,30 +26,78 @@ type GHZReport struct {
 }
 
 type MetricPoint struct {
-	Timestamp    int
-	Logs         int64
-	Dropped      int64
-	DropRate     float64
-	GCCycles     int
-	GCPause      float64
-	Memory       float64
-	FlushAvg     float64
-	FlushMax     float64
-	FlushQueue   int64
-	FlushBlocked int64
-	FlushTotal   int64
+	Timestamp    int     `json:"timestamp"`
+	Logs         int64   `json:"logs"`
+	Dropped      int64   `json:"dropped"`
+	DropRate     float64 `json:"drop_rate"`
+	GCCycles     int     `json:"gc_cycles"`
+	GCPause      float64 `json:"gc_pause_ms"`
+	Memory       float64 `json:"memory_mb"`
+	FlushAvg     float64 `json:"flush_avg_ms"`
+	FlushMax     float64 `json:"flush_max_ms"`
+	FlushQueue   int64   `json:"flush_queue"`
+	FlushBlocked int64   `json:"flush_blocked"`
+	FlushTotal   int64   `json:"flush_total"`
+}
+
+// SoakEvent is a threshold crossing recorded by the harness in soak mode
+type SoakEvent struct {
+	Timestamp int      `json:"timestamp"`
+	Kind      string   `json:"kind"`
+	Value     float64  `json:"value"`
+	Baseline  float64  `json:"baseline"`
+	Threshold float64  `json:"threshold"`
+	Profiles  []string `json:"profiles"`
+}
+
+// FlushRecord is one entry of flush_history.json, written by the harnesses with -flush-history
+// (asynclogger.FlushRecord)
+type FlushRecord struct {
+	Seq     uint64    `json:"seq"`
+	Trigger string    `json:"trigger"`
+	Start   time.Time `json:"start"`
+	Shards  []struct {
+		ShardID  uint32  `json:"shard_id"`
+		Bytes    int32   `json:"bytes"`
+		FillPct  float64 `json:"fill_pct"`
+		Complete bool    `json:"complete"`
+	} `json:"shards"`
+	Bytes         int           `json:"bytes"`
+	SemaphoreWait time.Duration `json:"semaphore_wait_ns"`
+	WaitForWrites time.Duration `json:"wait_for_writes_ns"`
+	Pwritev       time.Duration `json:"pwritev_ns"`
+	Duration      time.Duration `json:"duration_ns"`
+	Error         string        `json:"error"`
+
+	Event string `json:"-"` // Set by loadFlushHistory for LoggerManager dumps
+}
+
+// SoakSummary is the subset of soak_summary.json this script reads
+type SoakSummary struct {
+	Points []MetricPoint `json:"points"`
+	Events []SoakEvent   `json:"events"`
 }
 
 func main() {
 	resultsDir := "results/cliff_investigation"
+	if len(os.Args) > 1 {
+		resultsDir = os.Args[1]
+	}
 	
 	fmt.Println("════════════════════════════════════════════════════════════")
 	fmt.Println("       210s Cliff Investigation - Analysis Report")
 	fmt.Println("════════════════════════════════════════════════════════════")
 	fmt.Println()
 	
-	// Parse server logs
-	metrics := parseServerLogs(resultsDir + "/server.log")
+	// Prefer the soak summary written by the harness, fall back to server logs
+	var metrics []MetricPoint
+	summary, err := loadSoakSummary(resultsDir + "/soak_summary.json")
+	if err == nil {
+		metrics = summary.Points
+		printSoakEvents(summary.Events)
+	} else {
+		metrics = parseServerLogs(resultsDir + "/server.log")
+	}
 	
 	if len(metrics) == 0 {
 		fmt.Println("❌ No metrics found in server logs!")
@@ -65,6 +113,11 @@ func main() {
 	// Analyze flush performance
 	analyzeFlushPerformance(metrics)
 	
+	// Per-flush records, if the harness ran with -flush-history
+	if history, err := loadFlushHistory(resultsDir + "/flush_history.json"); err == nil {
+		analyzeFlushHistory(history)
+	}
+	
 	// Analyze resource usage
 	analyzeResourceUsage(resultsDir + "/resource_timeline.csv")
 	
@@ -75,6 +128,111 @@ func main() {
 	generateDetailedTimeline(metrics, resultsDir)
 }
 
+func loadSoakSummary(path string) (*SoakSummary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var summary SoakSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &summary, nil
+}
+
+// loadFlushHistory reads a flush history dump: a list of records (single logger) or lists by event
+// (LoggerManager), returned in start order
+func loadFlushHistory(path string) ([]FlushRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var records []FlushRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		var byEvent map[string][]FlushRecord
+		if err := json.Unmarshal(data, &byEvent); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		for event, eventRecords := range byEvent {
+			for _, r := range eventRecords {
+				r.Event = event
+				records = append(records, r)
+			}
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Start.Before(records[j].Start) })
+	return records, nil
+}
+
+// analyzeFlushHistory reports the flushes by trigger and the slowest ones, with where their time went
+func analyzeFlushHistory(records []FlushRecord) {
+	fmt.Println("## 🔬 Flush History")
+	fmt.Println()
+	if len(records) == 0 {
+		fmt.Println("No flushes recorded")
+		fmt.Println()
+		return
+	}
+	
+	byTrigger := make(map[string]int)
+	partial := 0
+	for _, r := range records {
+		byTrigger[r.Trigger]++
+		for _, shard := range r.Shards {
+			if !shard.Complete {
+				partial++
+				break
+			}
+		}
+	}
+	triggers := make([]string, 0, len(byTrigger))
+	for trigger := range byTrigger {
+		triggers = append(triggers, fmt.Sprintf("%s: %d", trigger, byTrigger[trigger]))
+	}
+	sort.Strings(triggers)
+	fmt.Printf("%d flushes from %s to %s (%s), %d partial\n\n", len(records),
+		records[0].Start.Format("15:04:05.000"), records[len(records)-1].Start.Format("15:04:05.000"),
+		strings.Join(triggers, ", "), partial)
+	
+	slowest := append([]FlushRecord(nil), records...)
+	sort.Slice(slowest, func(i, j int) bool { return slowest[i].Duration > slowest[j].Duration })
+	if len(slowest) > 10 {
+		slowest = slowest[:10]
+	}
+	fmt.Println("| Start | Event | Trigger | Shards | Avg Fill | Bytes | Semaphore | Wait Writes | Pwritev | Total |")
+	fmt.Println("|-------|-------|---------|--------|----------|-------|-----------|-------------|---------|-------|")
+	for _, r := range slowest {
+		avgFill := 0.0
+		for _, shard := range r.Shards {
+			avgFill += shard.FillPct
+		}
+		if len(r.Shards) > 0 {
+			avgFill /= float64(len(r.Shards))
+		}
+		fmt.Printf("| %s | %s | %s | %d | %.1f%% | %d | %v | %v | %v | %v |\n",
+			r.Start.Format("15:04:05.000"), r.Event, r.Trigger, len(r.Shards), avgFill, r.Bytes,
+			r.SemaphoreWait, r.WaitForWrites, r.Pwritev, r.Duration)
+	}
+	fmt.Println()
+}
+
+func printSoakEvents(events []SoakEvent) {
+	fmt.Println("## 🚨 Soak Events")
+	fmt.Println()
+	if len(events) == 0 {
+		fmt.Println("✅ No thresholds crossed during the soak run")
+		fmt.Println()
+		return
+	}
+	fmt.Println("| Time | Event | Value | Baseline | Threshold | Profiles |")
+	fmt.Println("|------|-------|-------|----------|-----------|----------|")
+	for _, e := range events {
+		fmt.Printf("| %ds | %s | %.2f | %.2f | %.2f | %s |\n",
+			e.Timestamp, e.Kind, e.Value, e.Baseline, e.Threshold, strings.Join(e.Profiles, ", "))
+	}
+	fmt.Println()
+}
+
 func parseServerLogs(logFile string) []MetricPoint {
 	file, err := os.Open(logFile)
 	if err != nil {
@@ -180,16 +180,16 @@ func worker(
 }
 
 func printStats(loggerManager *asynclogger.LoggerManager, logger *asynclogger.Logger, useEventLogger bool) {
-	var totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps int64
+	var totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, bytesBuffered, bytesDurable int64
 	var avgFlushMs, maxFlushMs float64
 
 	if useEventLogger && loggerManager != nil {
-		totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps = loggerManager.GetStatsSnapshot()
+		totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, bytesBuffered, bytesDurable = loggerManager.GetStatsSnapshot()
 		flushMetrics := loggerManager.GetAggregatedFlushMetrics()
 		avgFlushMs = float64(flushMetrics.AvgFlushDuration.Nanoseconds()) / 1e6
 		maxFlushMs = float64(flushMetrics.MaxFlushDuration.Nanoseconds()) / 1e6
 	} else if logger != nil {
-		totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps = logger.GetStatsSnapshot()
+		totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, bytesBuffered, bytesDurable = logger.GetStatsSnapshot()
 		flushMetrics := logger.GetFlushMetrics()
 		avgFlushMs = float64(flushMetrics.AvgFlushDuration.Nanoseconds()) / 1e6
 		maxFlushMs = float64(flushMetrics.MaxFlushDuration.Nanoseconds()) / 1e6
@@ -203,8 +203,8 @@ func printStats(loggerManager *asynclogger.LoggerManager, logger *asynclogger.Lo
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
 
-	log.Printf("METRICS: Logs: %d Dropped: %d (%.4f%%) | Bytes: %d | Flushes: %d Errors: %d Swaps: %d | AvgFlush: %.2fms MaxFlush: %.2fms | GC: %d cycles %.2fms pause | Mem: %.2fMB",
-		totalLogs, droppedLogs, dropRate, bytesWritten, flushes, flushErrors, setSwaps,
+	log.Printf("METRICS: Logs: %d Dropped: %d (%.4f%%) | Bytes: %d Buffered: %d Durable: %d | Flushes: %d Errors: %d Swaps: %d | AvgFlush: %.2fms MaxFlush: %.2fms | GC: %d cycles %.2fms pause | Mem: %.2fMB",
+		totalLogs, droppedLogs, dropRate, bytesWritten, bytesBuffered, bytesDurable, flushes, flushErrors, setSwaps,
 		avgFlushMs, maxFlushMs,
 		memStats.NumGC, float64(memStats.PauseTotalNs)/1e6,
 		float64(memStats.Alloc)/1024/1024)
@@ -65,6 +65,7 @@ func main() {
 			}
 
 			entryLength := binary.LittleEndian.Uint32(data[entryOffset : entryOffset+4])
+			entryLength &^= 1 << 31 // High bit marks a chunk of a larger message (AllowChunking)
 			entryOffset += 4
 
 			// Validate entry length (sanity check)
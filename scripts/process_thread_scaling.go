@@ -74,6 +74,7 @@ type ShardStat struct {
 	ShardID        int
 	Utilization    float64
 	WriteCount     int64
+	Drops          int64 // 0 for logs written before the /<drops> suffix was added
 }
 
 type GHZReport struct {
@@ -388,7 +389,7 @@ func extractServerMetrics(logPath string) (*ServerMetrics, []ShardStat, error) {
 
 	metricsPattern := regexp.MustCompile(`METRICS:.*Logs: (\d+) Dropped: (\d+).*GC: (\d+) cycles ([\d.]+)ms`)
 	shardPattern := regexp.MustCompile(`SHARD_STATS: (.+)`)
-	shardEntryPattern := regexp.MustCompile(`S(\d+):([\d.]+)%\((\d+)\)`)
+	shardEntryPattern := regexp.MustCompile(`S(\d+):([\d.]+)%\((\d+)\)(?:/(\d+))?`)
 
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -410,11 +411,16 @@ func extractServerMetrics(logPath string) (*ServerMetrics, []ShardStat, error) {
 				shardID := parseInt(match[1])
 				utilization := parseFloat(match[2])
 				writeCount := parseInt64(match[3])
+				var drops int64
+				if match[4] != "" {
+					drops = parseInt64(match[4])
+				}
 				
 				shardStats = append(shardStats, ShardStat{
 					ShardID:     shardID,
 					Utilization: utilization,
 					WriteCount:  writeCount,
+					Drops:       drops,
 				})
 			}
 		}
@@ -578,11 +584,11 @@ func generateResultsReport(resultsDir string, allScenarios, scenarios50, scenari
 		fmt.Fprintln(w, "## Per-Shard Utilization (50 Threads Winner)")
 		fmt.Fprintln(w)
 		winner := scenarios50[0]
-		fmt.Fprintln(w, "| Shard ID | Utilization % | Write Count |")
-		fmt.Fprintln(w, "|----------|---------------|-------------|")
+		fmt.Fprintln(w, "| Shard ID | Utilization % | Write Count | Drops |")
+		fmt.Fprintln(w, "|----------|---------------|-------------|-------|")
 		for _, stat := range winner.ShardStats {
-			fmt.Fprintf(w, "| %d | %.2f%% | %d |\n", 
-				stat.ShardID, stat.Utilization, stat.WriteCount)
+			fmt.Fprintf(w, "| %d | %.2f%% | %d | %d |\n", 
+				stat.ShardID, stat.Utilization, stat.WriteCount, stat.Drops)
 		}
 		fmt.Fprintln(w)
 	}
@@ -591,11 +597,11 @@ func generateResultsReport(resultsDir string, allScenarios, scenarios50, scenari
 		fmt.Fprintln(w, "## Per-Shard Utilization (200 Threads Winner)")
 		fmt.Fprintln(w)
 		winner := scenarios200[0]
-		fmt.Fprintln(w, "| Shard ID | Utilization % | Write Count |")
-		fmt.Fprintln(w, "|----------|---------------|-------------|")
+		fmt.Fprintln(w, "| Shard ID | Utilization % | Write Count | Drops |")
+		fmt.Fprintln(w, "|----------|---------------|-------------|-------|")
 		for _, stat := range winner.ShardStats {
-			fmt.Fprintf(w, "| %d | %.2f%% | %d |\n",
-				stat.ShardID, stat.Utilization, stat.WriteCount)
+			fmt.Fprintf(w, "| %d | %.2f%% | %d | %d |\n",
+				stat.ShardID, stat.Utilization, stat.WriteCount, stat.Drops)
 		}
 		fmt.Fprintln(w)
 	}
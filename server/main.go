@@ -13,6 +13,7 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -157,6 +158,7 @@ func main() {
 	logFlushInterval := flag.Duration("log-flush-interval", 10*time.Second, "Log flush interval (default: 10s)")
 	logFilePath := flag.String("log-file", "logs/server.log", "Log file path")
 	logNumShards := flag.Int("log-num-shards", 8, "Number of shards (default: 8)")
+	drainTimeout := flag.Duration("drain-timeout", 20*time.Second, "Time allowed to drain the loggers on shutdown (default: 20s)")
 	flag.Parse()
 
 	// Seed the random number generator
@@ -172,6 +174,8 @@ func main() {
 		FlushInterval: *logFlushInterval,
 		LogFilePath:   *logFilePath,
 		NumShards:     *logNumShards,
+
+		WriteRetryTimeout: 10 * time.Millisecond,
 	}
 
 	loggerManager, err := asynclogger.NewLoggerManager(loggerConfig)
@@ -184,11 +188,12 @@ func main() {
 		ticker := time.NewTicker(5 * time.Second)
 		defer ticker.Stop()
 		for range ticker.C {
-			// Aggregate logger stats
-			totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps := loggerManager.GetStatsSnapshot()
+			// Aggregate and per-event logger stats, from one snapshot so drop rates stay consistent
+			stats := loggerManager.SnapshotStats()
+			total := stats.Total
 			dropRate := 0.0
-			if totalLogs > 0 {
-				dropRate = float64(droppedLogs) / float64(totalLogs) * 100.0
+			if total.TotalLogs > 0 {
+				dropRate = float64(total.DroppedLogs) / float64(total.TotalLogs) * 100.0
 			}
 
 			// GC stats
@@ -199,31 +204,54 @@ func main() {
 			flushMetrics := loggerManager.GetAggregatedFlushMetrics()
 			avgFlushMs := float64(flushMetrics.AvgFlushDuration.Nanoseconds()) / 1e6
 			maxFlushMs := float64(flushMetrics.MaxFlushDuration.Nanoseconds()) / 1e6
+			avgWriteMs := float64(flushMetrics.AvgWriteDuration.Nanoseconds()) / 1e6
+			maxWriteMs := float64(flushMetrics.MaxWriteDuration.Nanoseconds()) / 1e6
+			avgPwritevMs := float64(flushMetrics.AvgPwritevDuration.Nanoseconds()) / 1e6
+			maxPwritevMs := float64(flushMetrics.MaxPwritevDuration.Nanoseconds()) / 1e6
 
 			// Overall metrics
-			log.Printf("METRICS: Logs: %d Dropped: %d (%.4f%%) | Bytes: %d | Flushes: %d Errors: %d Swaps: %d | AvgFlush: %.2fms MaxFlush: %.2fms | GC: %d cycles %.2fms pause | Mem: %.2fMB",
-				totalLogs, droppedLogs, dropRate, bytesWritten, flushes, flushErrors, setSwaps,
+			log.Printf("METRICS: Logs: %d Dropped: %d (%.4f%%) | Bytes: %d Buffered: %d Durable: %d | Flushes: %d Errors: %d Swaps: %d Queue: %d Blocked: %d | AvgFlush: %.2fms MaxFlush: %.2fms | AvgWrite: %.2fms MaxWrite: %.2fms WritePct: %.1f%% | AvgPwritev: %.2fms MaxPwritev: %.2fms PwritevPct: %.1f%% | GC: %d cycles %.2fms pause | Mem: %.2fMB",
+				total.TotalLogs, total.DroppedLogs, dropRate, total.BytesWritten, total.BytesBuffered, total.BytesDurable, total.Flushes, total.FlushErrors, total.SetSwaps,
+				flushMetrics.FlushQueueDepth, flushMetrics.BlockedSwaps,
 				avgFlushMs, maxFlushMs,
+				avgWriteMs, maxWriteMs, flushMetrics.WritePercent,
+				avgPwritevMs, maxPwritevMs, flushMetrics.PwritevPercent,
 				memStats.NumGC, float64(memStats.PauseTotalNs)/1e6,
 				float64(memStats.Alloc)/1024/1024)
 
 			// Per-event statistics
-			events := loggerManager.ListEventLoggers()
+			events := make([]string, 0, len(stats.Events))
+			for eventName := range stats.Events {
+				events = append(events, eventName)
+			}
+			sort.Strings(events)
 			if len(events) > 0 {
 				var eventStatStrs []string
 				for _, eventName := range events {
-					totalLogs, droppedLogs, _, _, _, _, err := loggerManager.GetEventStats(eventName)
-					if err == nil {
-						eventDropRate := 0.0
-						if totalLogs > 0 {
-							eventDropRate = float64(droppedLogs) / float64(totalLogs) * 100.0
-						}
-						eventStatStrs = append(eventStatStrs, fmt.Sprintf("%s:%d(%.2f%%)", eventName, totalLogs, eventDropRate))
+					eventStats := stats.Events[eventName]
+					eventDropRate := 0.0
+					if eventStats.TotalLogs > 0 {
+						eventDropRate = float64(eventStats.DroppedLogs) / float64(eventStats.TotalLogs) * 100.0
 					}
+					eventStatStrs = append(eventStatStrs, fmt.Sprintf("%s:%d(%.2f%%)", eventName, eventStats.TotalLogs, eventDropRate))
 				}
 				if len(eventStatStrs) > 0 {
 					log.Printf("EVENT_STATS: %s", strings.Join(eventStatStrs, " "))
 				}
+
+				// Per-shard utilization, write and drop counts, one line per event (S<id>:<util>%(<writes>)/<drops>)
+				// The drop count is a suffix so parsers of the S<id>:<util>%(<writes>) form still match
+				for _, eventName := range events {
+					shardStats, err := loggerManager.GetEventShardStats(eventName)
+					if err != nil {
+						continue
+					}
+					shardStatStrs := make([]string, 0, len(shardStats))
+					for _, shard := range shardStats {
+						shardStatStrs = append(shardStatStrs, fmt.Sprintf("S%d:%.2f%%(%d)/%d", shard.ShardID, shard.UtilizationPct, shard.WriteCount, shard.Drops))
+					}
+					log.Printf("SHARD_STATS: event=%s %s", eventName, strings.Join(shardStatStrs, " "))
+				}
 			}
 		}
 	}()
@@ -233,9 +261,9 @@ func main() {
 			log.Printf("Error closing logger manager: %v", err)
 		}
 		// Print final stats
-		totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps := loggerManager.GetStatsSnapshot()
-		log.Printf("Logger Stats - Total: %d, Dropped: %d, Bytes: %d, Flushes: %d, Errors: %d, Swaps: %d",
-			totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps)
+		totalLogs, droppedLogs, bytesWritten, flushes, flushErrors, setSwaps, bytesBuffered, bytesDurable := loggerManager.GetStatsSnapshot()
+		log.Printf("Logger Stats - Total: %d, Dropped: %d, Bytes: %d, Buffered: %d, Durable: %d, Flushes: %d, Errors: %d, Swaps: %d",
+			totalLogs, droppedLogs, bytesWritten, bytesBuffered, bytesDurable, flushes, flushErrors, setSwaps)
 	}()
 
 	log.Printf("Async logger initialized with buffer size: %d bytes, shards: %d", *logBufferSize, *logNumShards)
@@ -317,14 +345,18 @@ func main() {
 	n += copy(shutdownMsg[n:], "] INFO: Received shutdown signal, stopping server gracefully...\n")
 	loggerManager.LogBytesWithEvent("server", shutdownMsg[:n])
 
-	grpcServer.GracefulStop()
+	// Stop accepting logs and flush what is buffered before the in-flight RPCs finish; their
+	// logs are counted as rejected
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), *drainTimeout)
+	drainReport, err := loggerManager.Drain(drainCtx)
+	cancelDrain()
+	if err != nil {
+		log.Printf("Error draining logger manager: %v", err)
+	}
+	log.Printf("Drained loggers - Flushed: %d entries, Rejected: %d, Deadline exceeded: %v",
+		drainReport.EntriesFlushed, drainReport.RejectedLogs, drainReport.DeadlineExceeded)
 
-	// Log stopped using LogBytes
-	stoppedMsg := make([]byte, 256)
-	n = copy(stoppedMsg, "[")
-	n += copy(stoppedMsg[n:], time.Now().Format("2006-01-02 15:04:05.000"))
-	n += copy(stoppedMsg[n:], "] INFO: Server stopped\n")
-	loggerManager.LogBytesWithEvent("server", stoppedMsg[:n])
+	grpcServer.GracefulStop()
 
 	fmt.Println("Server stopped")
 }